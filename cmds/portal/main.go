@@ -23,6 +23,7 @@ import (
 	"cloudiac/portal/web"
 	"cloudiac/utils/kafka"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/rdb"
 )
 
 type Option struct {
@@ -70,6 +71,9 @@ func main() {
 
 		services.MaintenanceRunnerPerMax()
 		kafka.InitKafkaProducerBuilder()
+		if err := rdb.Init(); err != nil {
+			panic(errors.Wrap(err, "connect redis"))
+		}
 		rbac.InitPolicy()
 	}
 
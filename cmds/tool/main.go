@@ -17,8 +17,10 @@ type Option struct {
 	ChangePassword ChangePassword        `command:"password" description:"update user password"`
 	Version        common.VersionCommand `command:"version" description:"show version"`
 	InitDemo       InitDemo              `command:"init-demo" description:"init demo data with config file"`
+	Seed           Seed                  `command:"seed" description:"seed database with synthetic data (development only)"`
 	Scan           ScanCmd               `command:"scan" description:"scan template with policy"`
 	Parse          ParseCmd              `command:"parse" description:"parse rego"`
+	Wait           WaitCmd               `command:"wait" description:"wait for deploy or scan task to finish, exit with task result"`
 }
 
 var (
@@ -43,6 +43,8 @@ import (
 //    iac-tool scan --debug xxx.tf xxx.rego
 // 5. 内置引擎扫描
 //    iac-tool scan --internal -p policies -f tfscan.json -o tfscan.json
+// 6. 内置引擎增量扫描，只对相对上次扫描发生变化的资源重新执行策略
+//    iac-tool scan --internal -p policies -i tfscan.json -o scan_result.json --base-input tfscan.base.json --base-result scan_result.base.json
 
 type ScanCmd struct {
 	Debug          bool   `long:"debug" description:"run raw rego script \nuse \"--debug -d code xxx.rego\" or \"--debug xxx.tf xxx.rego\"" required:"false"`
@@ -62,6 +64,9 @@ type ScanCmd struct {
 	Internal      bool   `long:"internal" description:"use internal scan engine to execute scan" required:"false"`
 	InputFile     string `long:"input" short:"i" description:"the input json file path" required:"false"`
 	SourceMapFile string `long:"map" short:"m" description:"the source map json file path" required:"false"`
+	DecisionLog   string `long:"decision-log" description:"the decision log file path to output, only for internal scan" required:"false"`
+	BaseInput     string `long:"base-input" description:"the input json file of last scan, used with --base-result to run incremental scan" required:"false"`
+	BaseResult    string `long:"base-result" description:"the result json file of last scan, used with --base-input to run incremental scan" required:"false"`
 }
 
 var ErrMissingIacFileOrRego = errors.New("missing iac file or rego script")
@@ -173,6 +178,13 @@ func (c *ScanCmd) Execute(args []string) error { //nolint:cyclop
 	if c.SourceMapFile != "" {
 		scanner.MapFile = c.SourceMapFile
 	}
+	if c.DecisionLog != "" {
+		scanner.DecisionLogFile = c.DecisionLog
+	}
+	if c.BaseInput != "" && c.BaseResult != "" {
+		scanner.BaseInputFile = c.BaseInput
+		scanner.BaseResultFile = c.BaseResult
+	}
 
 	err := scanner.Run()
 	if err != nil {
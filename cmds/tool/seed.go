@@ -0,0 +1,352 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// ./iac-tool seed --dev --orgs 10 --envs 20 --tasks 50
+
+// Seed 生成模拟数据，用于开发环境下的界面开发及列表、报表接口的性能测试，禁止在生产环境使用
+type Seed struct {
+	Dev       bool  `long:"dev" description:"confirm that the database is for development" required:"true"`
+	Orgs      int   `long:"orgs" default:"3" description:"number of organizations"`
+	Projects  int   `long:"projects" default:"3" description:"number of projects per organization"`
+	Templates int   `long:"templates" default:"5" description:"number of templates per organization"`
+	Envs      int   `long:"envs" default:"5" description:"number of environments per project"`
+	Tasks     int   `long:"tasks" default:"10" description:"number of deploy tasks per environment"`
+	Resources int   `long:"resources" default:"20" description:"number of resources per environment"`
+	Policies  int   `long:"policies" default:"10" description:"number of policies per organization"`
+	RandSeed  int64 `long:"rand-seed" default:"0" description:"random seed, 0 means using current time"`
+}
+
+const seedDescription = "synthetic data generated by iac-tool seed"
+
+var (
+	seedProviders = map[string][]string{
+		"alicloud": {"alicloud_instance", "alicloud_vpc", "alicloud_vswitch", "alicloud_security_group", "alicloud_oss_bucket"},
+		"aws":      {"aws_instance", "aws_vpc", "aws_subnet", "aws_security_group", "aws_s3_bucket"},
+	}
+	seedSeverities = []string{consts.PolicySeverityHigh, consts.PolicySeverityMedium, consts.PolicySeverityLow}
+)
+
+type seeder struct {
+	*Seed
+	tx    *db.Session
+	rand  *rand.Rand
+	vcsId models.Id
+	now   time.Time
+}
+
+func (s *Seed) Execute(args []string) error {
+	configs.Init(opt.Config)
+	db.Init(configs.Get().Mysql)
+	models.Init(false)
+
+	randSeed := s.RandSeed
+	if randSeed == 0 {
+		randSeed = time.Now().UnixNano()
+	}
+	logger.Infof("seed database, random seed %d", randSeed)
+
+	vcs, er := services.GetDefaultVcs(db.Get())
+	if er != nil {
+		return fmt.Errorf("missing default vcs, err %s", er)
+	}
+
+	sd := &seeder{
+		Seed:  s,
+		rand:  rand.New(rand.NewSource(randSeed)), //nolint:gosec
+		vcsId: vcs.Id,
+		now:   time.Now(),
+	}
+	for i := 0; i < s.Orgs; i++ {
+		// 每个组织单独提交，数据量大时避免事务过大
+		sd.tx = db.Get().Begin()
+		if err := sd.seedOrg(i); err != nil {
+			_ = sd.tx.Rollback()
+			return err
+		}
+		if err := sd.tx.Commit(); err != nil {
+			_ = sd.tx.Rollback()
+			return err
+		}
+	}
+
+	logger.Infof("seed completed")
+	return nil
+}
+
+func (s *seeder) pick(items []string) string {
+	return items[s.rand.Intn(len(items))]
+}
+
+// randTime 返回过去 days 天内的随机时间
+func (s *seeder) randTime(days int) time.Time {
+	return s.now.Add(-time.Duration(s.rand.Int63n(int64(days) * int64(24*time.Hour))))
+}
+
+func (s *seeder) seedOrg(n int) error {
+	org, err := services.CreateOrganization(s.tx, models.Organization{
+		Name:        fmt.Sprintf("seed-org-%d-%s", n, models.NewId("")[:6]),
+		Description: seedDescription,
+		CreatorId:   consts.SysUserId,
+	})
+	if err != nil {
+		return fmt.Errorf("create org: %v", err)
+	}
+	logger.Infof("seed org %s(%s)", org.Name, org.Id)
+
+	policies, er := s.seedPolicies(org)
+	if er != nil {
+		return er
+	}
+
+	tpls := make([]*models.Template, 0, s.Templates)
+	for i := 0; i < s.Templates; i++ {
+		provider := s.pick([]string{"alicloud", "aws"})
+		tpl, err := services.CreateTemplate(s.tx, models.Template{
+			OrgId:        org.Id,
+			Name:         fmt.Sprintf("seed-tpl-%d", i),
+			TplType:      provider,
+			Description:  seedDescription,
+			VcsId:        s.vcsId,
+			RepoId:       fmt.Sprintf("seed/%s-%d", provider, i),
+			RepoFullName: fmt.Sprintf("seed/%s-%d", provider, i),
+			RepoRevision: "master",
+			CreatorId:    consts.SysUserId,
+		})
+		if err != nil {
+			return fmt.Errorf("create template: %v", err)
+		}
+		tpls = append(tpls, tpl)
+	}
+
+	for i := 0; i < s.Projects; i++ {
+		project, err := services.CreateProject(s.tx, &models.Project{
+			OrgId:       org.Id,
+			Name:        fmt.Sprintf("seed-project-%d", i),
+			Description: seedDescription,
+			CreatorId:   consts.SysUserId,
+		})
+		if err != nil {
+			return fmt.Errorf("create project: %v", err)
+		}
+		if len(tpls) == 0 {
+			continue
+		}
+
+		for _, tpl := range tpls {
+			if err := services.CreateTemplateProject(s.tx, []models.Id{project.Id}, tpl.Id); err != nil {
+				return fmt.Errorf("create template relation: %v", err)
+			}
+		}
+		for j := 0; j < s.Envs; j++ {
+			if err := s.seedEnv(project, tpls[s.rand.Intn(len(tpls))], j, policies); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *seeder) seedPolicies(org *models.Organization) ([]*models.Policy, error) {
+	if s.Policies == 0 {
+		return nil, nil
+	}
+	group, err := services.CreatePolicyGroup(s.tx, &models.PolicyGroup{
+		OrgId:       org.Id,
+		CreatorId:   consts.SysUserId,
+		Name:        "seed-policy-group",
+		Description: seedDescription,
+		Enabled:     true,
+		Source:      "upload",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create policy group: %v", err)
+	}
+
+	policies := make([]*models.Policy, 0, s.Policies)
+	for i := 0; i < s.Policies; i++ {
+		provider := s.pick([]string{"alicloud", "aws"})
+		policy, err := services.CreatePolicy(s.tx, &models.Policy{
+			OrgId:        org.Id,
+			GroupId:      group.Id,
+			CreatorId:    consts.SysUserId,
+			Name:         fmt.Sprintf("seed policy %d", i),
+			RuleName:     fmt.Sprintf("seedRule%d", i),
+			ReferenceId:  fmt.Sprintf("seed_%s_%d_%s", provider, i, group.Id),
+			Enabled:      true,
+			Severity:     s.pick(seedSeverities),
+			PolicyType:   provider,
+			ResourceType: s.pick(seedProviders[provider]),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create policy: %v", err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func (s *seeder) seedEnv(project *models.Project, tpl *models.Template, n int, policies []*models.Policy) error {
+	env, err := services.CreateEnv(s.tx, models.Env{
+		OrgId:       project.OrgId,
+		ProjectId:   project.Id,
+		TplId:       tpl.Id,
+		CreatorId:   consts.SysUserId,
+		Name:        fmt.Sprintf("seed-env-%d", n),
+		Description: seedDescription,
+		Status:      s.pick([]string{models.EnvStatusActive, models.EnvStatusActive, models.EnvStatusFailed, models.EnvStatusInactive}),
+		Revision:    tpl.RepoRevision,
+	})
+	if err != nil {
+		return fmt.Errorf("create env: %v", err)
+	}
+
+	var lastTask *models.Task
+	for i := 0; i < s.Tasks; i++ {
+		startAt := s.randTime(90)
+		endAt := startAt.Add(time.Duration(30+s.rand.Intn(600)) * time.Second)
+		added, changed, destroyed := s.rand.Intn(10), s.rand.Intn(5), s.rand.Intn(3)
+		task := &models.Task{
+			OrgId:     env.OrgId,
+			ProjectId: env.ProjectId,
+			TplId:     env.TplId,
+			EnvId:     env.Id,
+			Name:      fmt.Sprintf("seed task %d", i),
+			CreatorId: consts.SysUserId,
+			RepoAddr:  tpl.RepoFullName,
+			Revision:  env.Revision,
+			CommitId:  fmt.Sprintf("%040x", s.rand.Int63()),
+			StatePath: env.StatePath,
+			Result:    models.TaskResult{ResAdded: &added, ResChanged: &changed, ResDestroyed: &destroyed},
+		}
+		task.Id = models.Task{}.NewId()
+		task.Type = s.pick([]string{common.TaskTypePlan, common.TaskTypeApply, common.TaskTypeApply, common.TaskTypeDestroy})
+		task.Status = s.pick([]string{common.TaskComplete, common.TaskComplete, common.TaskComplete, common.TaskFailed})
+		task.RunnerId = "seed-runner"
+		task.StartAt, task.EndAt = (*models.Time)(&startAt), (*models.Time)(&endAt)
+		if err := models.Create(s.tx, task); err != nil {
+			return fmt.Errorf("create task: %v", err)
+		}
+		if task.Type == common.TaskTypeApply && (lastTask == nil || startAt.After(time.Time(*lastTask.StartAt))) {
+			lastTask = task
+		}
+	}
+
+	attrs := models.Attrs{}
+	if lastTask != nil {
+		attrs["LastTaskId"], attrs["LastResTaskId"] = lastTask.Id, lastTask.Id
+		if err := s.seedResources(env, lastTask); err != nil {
+			return err
+		}
+	}
+	if len(policies) > 0 {
+		scanTaskId, err := s.seedScanResults(env, policies)
+		if err != nil {
+			return err
+		}
+		attrs["LastScanTaskId"] = scanTaskId
+	}
+	if len(attrs) > 0 {
+		if _, err := services.UpdateEnv(s.tx, env.Id, attrs); err != nil {
+			return fmt.Errorf("update env: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *seeder) seedResources(env *models.Env, task *models.Task) error {
+	if s.Resources == 0 {
+		return nil
+	}
+	provider := s.pick([]string{"alicloud", "aws"})
+	resources := make([]*models.Resource, 0, s.Resources)
+	for i := 0; i < s.Resources; i++ {
+		typ := s.pick(seedProviders[provider])
+		name := fmt.Sprintf("seed_%d", i)
+		res := &models.Resource{
+			OrgId:     env.OrgId,
+			ProjectId: env.ProjectId,
+			EnvId:     env.Id,
+			TaskId:    task.Id,
+			Provider:  fmt.Sprintf("registry.terraform.io/hashicorp/%s", provider),
+			Address:   fmt.Sprintf("%s.%s", typ, name),
+			Type:      typ,
+			Name:      name,
+			Attrs:     models.ResAttrs{"id": fmt.Sprintf("i-%012x", s.rand.Int63())},
+		}
+		res.Id = models.NewId("r")
+		resources = append(resources, res)
+	}
+	if err := s.tx.Insert(&resources); err != nil {
+		return fmt.Errorf("create resources: %v", err)
+	}
+	return nil
+}
+
+func (s *seeder) seedScanResults(env *models.Env, policies []*models.Policy) (models.Id, error) {
+	startAt := s.randTime(30)
+	endAt := startAt.Add(time.Duration(10+s.rand.Intn(120)) * time.Second)
+	task := &models.ScanTask{
+		OrgId:       env.OrgId,
+		ProjectId:   env.ProjectId,
+		TplId:       env.TplId,
+		EnvId:       env.Id,
+		Name:        "seed scan task",
+		CreatorId:   consts.SysUserId,
+		StatePath:   env.StatePath,
+		ScanContext: models.ScanContextManual,
+	}
+	task.Id = models.ScanTask{}.NewId()
+	task.Type = common.TaskTypeEnvScan
+	task.Status = common.TaskComplete
+	task.RunnerId = "seed-runner"
+	task.StartAt, task.EndAt = (*models.Time)(&startAt), (*models.Time)(&endAt)
+	task.PolicyStatus = common.PolicyStatusPassed
+
+	results := make([]*models.PolicyResult, 0, len(policies))
+	for _, p := range policies {
+		status := common.PolicyStatusPassed
+		if s.rand.Intn(4) == 0 {
+			status = common.PolicyStatusViolated
+			task.PolicyStatus = common.PolicyStatusViolated
+		}
+		results = append(results, &models.PolicyResult{
+			OrgId:         env.OrgId,
+			ProjectId:     env.ProjectId,
+			TplId:         env.TplId,
+			EnvId:         env.Id,
+			TaskId:        task.Id,
+			PolicyId:      p.Id,
+			PolicyGroupId: p.GroupId,
+			StartAt:       models.Time(startAt),
+			Status:        status,
+			Violation: models.Violation{
+				RuleName:     p.RuleName,
+				RuleId:       p.ReferenceId,
+				Severity:     p.Severity,
+				ResourceType: p.ResourceType,
+				ResourceName: "seed",
+			},
+		})
+	}
+
+	if err := models.Create(s.tx, task); err != nil {
+		return "", fmt.Errorf("create scan task: %v", err)
+	}
+	if err := s.tx.Insert(&results); err != nil {
+		return "", fmt.Errorf("create policy results: %v", err)
+	}
+	return task.Id, nil
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package main
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// iac-tool wait 等待部署任务或扫描任务结束，以任务结果作为命令退出码，用于 CI 流水线卡点
+//    --task run-xxx 等待部署任务
+//    --scan run-xxx 等待扫描任务
+//
+// 退出码: 0 执行成功或扫描通过，1 任务失败，2 存在不合规资源，3 等待超时，4 请求出错
+//
+// Example:
+//    IAC_ADDR=http://cloudiac.example.com IAC_TOKEN=xxx IAC_ORG_ID=org-xxx IAC_PROJECT_ID=p-xxx \
+//      iac-tool wait --task run-xxx --timeout 1800
+
+const (
+	waitExitError = 4 // 请求出错
+
+	// 单次请求的最长等待时间，避免长时间占用连接
+	waitRequestTimeout = 300
+)
+
+type WaitCmd struct {
+	Addr      string `long:"addr" env:"IAC_ADDR" description:"cloudiac portal address" required:"true"`
+	Token     string `long:"token" env:"IAC_TOKEN" description:"api token" required:"true"`
+	OrgId     string `long:"org" env:"IAC_ORG_ID" description:"organization id" required:"true"`
+	ProjectId string `long:"project" env:"IAC_PROJECT_ID" description:"project id, required when waiting for deploy task" required:"false"`
+	TaskId    string `long:"task" description:"deploy task id to wait for" required:"false"`
+	ScanId    string `long:"scan" description:"scan task id to wait for" required:"false"`
+	Timeout   int    `long:"timeout" default:"1800" description:"max seconds to wait" required:"false"`
+}
+
+func (*WaitCmd) Usage() string {
+	return ""
+}
+
+func (c *WaitCmd) Execute(args []string) error {
+	if (c.TaskId == "") == (c.ScanId == "") {
+		return fmt.Errorf("one of --task or --scan is required")
+	}
+	if c.TaskId != "" && c.ProjectId == "" {
+		return fmt.Errorf("--project is required when waiting for deploy task")
+	}
+
+	deadline := time.Now().Add(time.Duration(c.Timeout) * time.Second)
+	for {
+		timeout := int(time.Until(deadline).Seconds())
+		if timeout > waitRequestTimeout {
+			timeout = waitRequestTimeout
+		}
+		if timeout < 1 {
+			timeout = 1
+		}
+
+		result, err := c.wait(timeout)
+		if err != nil {
+			logger.Errorf("wait task: %v", err)
+			os.Exit(waitExitError)
+		}
+		if result.Exited || !time.Now().Before(deadline) {
+			bs, _ := json.Marshal(result)
+			fmt.Println(string(bs))
+			os.Exit(result.ExitCode)
+		}
+	}
+}
+
+func (c *WaitCmd) wait(timeout int) (*services.TaskWaitResult, error) {
+	path := fmt.Sprintf("/api/v1/tasks/%s/wait", c.TaskId)
+	if c.ScanId != "" {
+		path = fmt.Sprintf("/api/v1/policies/scans/%s/wait", c.ScanId)
+	}
+	u := fmt.Sprintf("%s%s?%s", strings.TrimSuffix(c.Addr, "/"), path,
+		url.Values{"timeout": {fmt.Sprint(timeout)}}.Encode())
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", c.Token)
+	req.Header.Set("IaC-Org-Id", c.OrgId)
+	if c.ProjectId != "" {
+		req.Header.Set("IaC-Project-Id", c.ProjectId)
+	}
+
+	client := &http.Client{Timeout: time.Duration(timeout+30) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body := struct {
+		Code          int                     `json:"code"`
+		Message       string                  `json:"message"`
+		MessageDetail string                  `json:"message_detail"`
+		Result        services.TaskWaitResult `json:"result"`
+		Error         *e.ErrorInfo            `json:"error"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode response(status %d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if body.Error != nil && body.Error.Hint != "" {
+			return nil, fmt.Errorf("%s(%s): %s, %s", body.Message, body.Error.Key, body.MessageDetail, body.Error.Hint)
+		}
+		return nil, fmt.Errorf("%s: %s", body.Message, body.MessageDetail)
+	}
+	return &body.Result, nil
+}
@@ -18,6 +18,7 @@ const (
 	TaskTypeEnvParse = "envParse" // 环境策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplScan  = "tplScan"  // 云模板策略扫描，只执行策略扫描，不修改资源或配置
 	TaskTypeTplParse = "tplParse" // 云模板策略扫描，只执行策略扫描，不修改资源或配置
+	TaskTypeImport   = "import"   // 执行 terraform import 将已有资源导入环境的 state，不修改资源
 
 	// TODO 与 taskTypexxx 重复，需要替换
 	TaskJobPlan     = "plan"
@@ -29,6 +30,7 @@ const (
 	TaskJobEnvParse = "envParse"
 	TaskJobTplScan  = "tplScan"
 	TaskJobTplParse = "tplParse"
+	TaskJobImport   = "import"
 
 	TaskPending   = "pending"
 	TaskRunning   = "running"
@@ -36,12 +38,16 @@ const (
 	TaskRejected  = "rejected"
 	TaskFailed    = "failed"
 	TaskComplete  = "complete"
+	TaskCancelled = "cancelled"
 
 	TaskStepCheckout  = "checkout"
 	TaskStepTfInit    = "terraformInit"
 	TaskStepTfPlan    = "terraformPlan"
 	TaskStepTfApply   = "terraformApply"
 	TaskStepTfDestroy = "terraformDestroy"
+	TaskStepTfImport  = "terraformImport"
+
+	TaskStepTfValidate = "terraformValidate" // terraform validate 及 fmt 检查
 
 	// 0.3 扫描步骤名称
 	TaskStepOpaScan = "opaScan" // 云模板策略扫描
@@ -53,6 +59,7 @@ const (
 
 	TaskStepAnsiblePlay = "ansiblePlay" // play playbook
 	TaskStepCommand     = "command"     // run command
+	TaskStepCheckov     = "checkov"     // checkov 安全扫描
 	TaskStepCollect     = "collect"     // 任务结束后的信息采集
 	TaskStepScanInit    = "scaninit"
 	CronDriftTaskName   = "Drift Detection" // 漂移检测任务名称
@@ -69,6 +76,7 @@ const (
 	TaskStepFailed    = "failed"
 	TaskStepComplete  = "complete"
 	TaskStepTimeout   = "timeout"
+	TaskStepCancelled = "cancelled"
 
 	TaskStepPolicyViolationExitCode = 3 // 合规检查不通过时的退出码
 
@@ -80,14 +88,16 @@ const (
 	TaskTypeEnvParseName = "envParse"
 	TaskTypeTplScanName  = "tplScan"
 	TaskTypeTplParseName = "tplParse"
+	TaskTypeImportName   = "import"
 
 	// 默认步骤超时时间(秒)
 	DefaultTaskStepTimeout = 1800
 
-	VcsGitlab = "gitlab"
-	VcsGitea  = "gitea"
-	VcsGitee  = "gitee"
-	VcsGithub = "github"
+	VcsGitlab    = "gitlab"
+	VcsGitea     = "gitea"
+	VcsGitee     = "gitee"
+	VcsGithub    = "github"
+	VcsBitbucket = "bitbucket"
 
 	// PolicyStatusPending 检测中
 	PolicyStatusPending = "pending"
@@ -120,4 +130,17 @@ var (
 		"0.15.5",
 		"1.0.6",
 	}
+
+	// OpenTofuVersions 内置的 OpenTofu 版本
+	OpenTofuVersions = []string{
+		"1.6.2",
+		"1.7.3",
+		"1.8.5",
+	}
+)
+
+const (
+	// 云模板使用的 IaC 引擎
+	EngineTerraform = "terraform"
+	EngineOpenTofu  = "opentofu"
 )
@@ -17,5 +17,6 @@ var (
 		TaskJobEnvParse,
 		TaskJobTplScan,
 		TaskJobTplParse,
+		TaskJobImport,
 	}
 )
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"gopkg.in/yaml.v2"
@@ -23,6 +25,13 @@ type KafkaConfig struct {
 	SaslPassword string   `yaml:"sasl_password"`
 }
 
+// RedisConfig portal 多实例部署时用于在实例间共享状态，未配置时只支持单实例部署
+type RedisConfig struct {
+	Address  string `yaml:"address"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
 type ConsulConfig struct {
 	Address         string `yaml:"address"`
 	ServiceID       string `yaml:"id"`
@@ -36,12 +45,49 @@ type ConsulConfig struct {
 
 type RunnerConfig struct {
 	DefaultImage string `yaml:"default_image"`
+	// OpenTofuImage 使用 OpenTofu 引擎的任务使用的镜像(需要预装 tofuenv)，为空时使用 DefaultImage
+	OpenTofuImage string `yaml:"opentofu_image"`
 	// AssetsPath  预置 providers 也在该目录下
 	AssetsPath       string `yaml:"assets_path"`
 	StoragePath      string `yaml:"storage_path"`
 	PluginCachePath  string `yaml:"plugin_cache_path"`
-	OfflineMode      bool   `yaml:"offline_mode"`       // 离线模式?
+	OfflineMode      bool   `yaml:"offline_mode"`       // 离线模式?(兼容旧配置，同 offline.enabled)
 	ReserveContainer bool   `yaml:"reserver_container"` // 任务结束后保留容器?(停止容器但不删除)
+
+	// PrewarmProviders 预热 plugins 缓存时默认下载的 provider，格式为 source[@version]，如 hashicorp/aws@~> 5.0
+	PrewarmProviders []string `yaml:"prewarm_providers"`
+
+	// Backend 任务执行后端，docker(默认，在本机启动容器) 或 kubernetes(每个步骤启动一个 pod)
+	Backend    string           `yaml:"backend"`
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+}
+
+const (
+	RunnerBackendDocker     = "docker"
+	RunnerBackendKubernetes = "kubernetes"
+)
+
+// KubernetesConfig kubernetes 执行后端配置，api_server 为空时使用 pod 内的 service account 访问集群。
+// runner 需要与任务 pod 通过 storage_pvc 共享 storage_path 目录，步骤的脚本、日志及产物都保存在该目录下
+type KubernetesConfig struct {
+	ApiServer string `yaml:"api_server"` // 如 https://kubernetes.default.svc
+	Token     string `yaml:"token"`      // 访问 api server 的 bearer token，为空时读取 service account token
+	CAFile    string `yaml:"ca_file"`
+	Insecure  bool   `yaml:"insecure"` // 不校验 api server 证书
+	Namespace string `yaml:"namespace"`
+
+	ServiceAccount   string            `yaml:"service_account"`    // 任务 pod 使用的 service account
+	StoragePVC       string            `yaml:"storage_pvc"`        // 挂载到 runner storage_path 的 PVC
+	PluginCachePVC   string            `yaml:"plugin_cache_pvc"`   // provider 缓存 PVC，为空时每个步骤使用独立的临时目录
+	ImagePullPolicy  string            `yaml:"image_pull_policy"`  // Always/IfNotPresent/Never
+	ImagePullSecrets []string          `yaml:"image_pull_secrets"` // 拉取私有镜像使用的 secret
+	NodeSelector     map[string]string `yaml:"node_selector"`
+
+	// 任务 pod 的资源限制，格式同 kubernetes resources，如 cpu: "500m"、memory: "1Gi"，为空表示不设置
+	CPURequest    string `yaml:"cpu_request"`
+	CPULimit      string `yaml:"cpu_limit"`
+	MemoryRequest string `yaml:"memory_request"`
+	MemoryLimit   string `yaml:"memory_limit"`
 }
 
 type PortalConfig struct {
@@ -58,6 +104,10 @@ func (c *RunnerConfig) mustAbs(path string) string {
 	return p
 }
 
+func (c *RunnerConfig) IsKubernetesBackend() bool {
+	return c.Backend == RunnerBackendKubernetes
+}
+
 func (c *RunnerConfig) ProviderPath() string {
 	if c.AssetsPath == "" {
 		return ""
@@ -82,6 +132,10 @@ func (c *RunnerConfig) AbsTfenvVersionsCachePath() string {
 	return c.mustAbs(filepath.Join(c.PluginCachePath, ".tfenv-versions"))
 }
 
+func (c *RunnerConfig) AbsTofuenvVersionsCachePath() string {
+	return c.mustAbs(filepath.Join(c.PluginCachePath, ".tofuenv-versions"))
+}
+
 type LogConfig struct {
 	LogLevel   string `yaml:"log_level"`
 	LogPath    string `yaml:"log_path"`
@@ -97,8 +151,95 @@ type SMTPServerConfig struct {
 	FromName string `yaml:"fromName"`
 }
 
+// DecisionLogConfig 策略决策日志导出配置
+type DecisionLogConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Sink    string `yaml:"sink"`  // 导出方式: file/http
+	Path    string `yaml:"path"`  // sink 为 file 时追加写入的文件路径
+	Url     string `yaml:"url"`   // sink 为 http 时的接收地址，兼容 OPA decision log 服务接口
+	Token   string `yaml:"token"` // sink 为 http 时的 Bearer token
+}
+
 type PolicyConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	DecisionLog DecisionLogConfig `yaml:"decision_log"`
+
+	// 关闭环境/云模板合规检测时对已有扫描结果的处理方式: keep(保留), archive(归档，默认), clear(删除)
+	DisableAction string `yaml:"disable_action"`
+
+	// 扫描任务并发限制，避免大量扫描任务占满 runner 导致部署任务无法执行
+	MaxScanTasksPerRunner int `yaml:"max_scan_tasks_per_runner"` // 每个 runner 并发扫描任务数量，默认为 runner 并发任务数量的一半
+	MaxScanTasksPerOrg    int `yaml:"max_scan_tasks_per_org"`    // 每个组织并发扫描任务数量，默认不限制
+
+	// 增量扫描，重复扫描同一环境/云模板时只对发生变化的资源类型重新执行策略，其他策略沿用上次扫描结果
+	IncrementalScan bool `yaml:"incremental_scan"`
+}
+
+// GuardrailsConfig 环境部署的资源规模限制，在 plan 完成后检查，超出限制的任务必须由管理员审批，0 表示不限制
+type GuardrailsConfig struct {
+	MaxEnvResources int `yaml:"max_env_resources"` // 部署后环境的资源总数上限
+	MaxPlanSize     int `yaml:"max_plan_size"`     // plan json 文件大小上限(KB)
+	MaxVariables    int `yaml:"max_variables"`     // 任务使用的变量数量上限
+}
+
+// ChatOpsConfig 聊天指令配置，未配置签名密钥的平台不接收指令
+type ChatOpsConfig struct {
+	SlackSigningSecret string `yaml:"slack_signing_secret"` // Slack App 的 Signing Secret
+	DingTalkAppSecret  string `yaml:"dingtalk_app_secret"`  // 钉钉机器人的 AppSecret
+
+	// 钉钉的签名不包含消息内容，需要配置接收指令的机器人或群会话(至少配置一项)，其他机器人或会话的消息不处理
+	DingTalkRobotCode       string   `yaml:"dingtalk_robot_code"`       // 机器人的 robotCode
+	DingTalkConversationIds []string `yaml:"dingtalk_conversation_ids"` // 允许发送指令的会话 id
+}
+
+// SchedulerConfig 多租户部署时的任务调度配置
+type SchedulerConfig struct {
+	// 按组织及项目的权重公平调度等待中的任务，避免单个租户的大量任务占满共享的 runner
+	FairShare      bool           `yaml:"fair_share"`
+	OrgWeights     map[string]int `yaml:"org_weights"`     // 组织权重，key 为组织 id，未配置的组织权重为 1
+	ProjectWeights map[string]int `yaml:"project_weights"` // 项目在组织内的权重，key 为项目 id，未配置的项目权重为 1
+}
+
+// OfflineConfig 离线(内网)部署配置，portal 与 runner 需要使用相同的配置。
+// 开启后任务不再访问公网，registry 模块、provider、pip/ansible 依赖及镜像均从内网镜像源获取
+type OfflineConfig struct {
 	Enabled bool `yaml:"enabled"`
+
+	RegistryMirror      string `yaml:"registry_mirror"`       // terraform registry 镜像地址，如 https://registry.example.com
+	ProviderMirror      string `yaml:"provider_mirror"`       // provider network mirror 地址，如 https://mirror.example.com/providers/
+	PipIndexUrl         string `yaml:"pip_index_url"`         // pip 镜像源地址
+	AnsibleGalaxyServer string `yaml:"ansible_galaxy_server"` // ansible galaxy 镜像地址
+	ImageRegistry       string `yaml:"image_registry"`        // 镜像仓库地址，任务及步骤镜像的仓库替换为该地址，如 harbor.example.com/mirror
+}
+
+// Validate 检查镜像源地址格式
+func (c *OfflineConfig) Validate() error {
+	for _, item := range [][2]string{
+		{"registry_mirror", c.RegistryMirror},
+		{"provider_mirror", c.ProviderMirror},
+		{"pip_index_url", c.PipIndexUrl},
+		{"ansible_galaxy_server", c.AnsibleGalaxyServer},
+	} {
+		name, addr := item[0], item[1]
+		if addr == "" {
+			continue
+		}
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid offline.%s '%s'", name, addr)
+		}
+	}
+	if strings.Contains(c.ImageRegistry, "://") || strings.HasSuffix(c.ImageRegistry, "/") {
+		return fmt.Errorf("invalid offline.image_registry '%s', should be like 'harbor.example.com/mirror'", c.ImageRegistry)
+	}
+	return nil
+}
+
+// VcsCacheConfig 代码仓库接口数据(仓库列表、分支/tag 列表、文件列表及内容)缓存配置，
+// 配置了 redis 时缓存保存在 redis 中，否则保存在实例内存中
+type VcsCacheConfig struct {
+	Disabled bool `yaml:"disabled"`
+	TTL      int  `yaml:"ttl"` // 缓存有效期(秒)，默认 60 秒
 }
 
 type Config struct {
@@ -116,6 +257,27 @@ type Config struct {
 	ExportSecretKey    string           `yaml:"exportSecretKey"`
 	HttpClientInsecure bool             `yaml:"httpClientInsecure"`
 	Policy             PolicyConfig     `yaml:"policy"`
+
+	// 组织数据清除的保留期(天)，计划清除后在保留期内可以取消，默认为 30 天
+	OrgPurgeRetentionDays int `yaml:"orgPurgeRetentionDays"`
+
+	// 环境自动销毁前发送提醒通知的提前时间，如 ["24h", "1h"]，默认为 24h 及 1h
+	AutoDestroyReminders []string `yaml:"autoDestroyReminders"`
+
+	// 取消任务时等待 terraform 中断退出的时间(秒)，超时后强制停止任务容器，默认为 60 秒
+	TaskCancelGracePeriod int `yaml:"taskCancelGracePeriod"`
+
+	Redis RedisConfig `yaml:"redis"`
+
+	Guardrails GuardrailsConfig `yaml:"guardrails"`
+
+	ChatOps ChatOpsConfig `yaml:"chatops"`
+
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+
+	Offline OfflineConfig `yaml:"offline"`
+
+	VcsCache VcsCacheConfig `yaml:"vcs_cache"`
 }
 
 const (
@@ -166,6 +328,9 @@ func ParsePortalConfig(filename string) error {
 	if cfg.ExportSecretKey == "" {
 		cfg.ExportSecretKey = defaultExportSecretKey
 	}
+	if err := cfg.Offline.Validate(); err != nil {
+		return err
+	}
 
 	lock.Lock()
 	defer lock.Unlock()
@@ -183,6 +348,16 @@ func ParseRunnerConfig(filename string) error {
 	if err := ensureSecretKey(&cfg); err != nil {
 		panic(err)
 	}
+	if cfg.Runner.IsKubernetesBackend() && cfg.Runner.Kubernetes.StoragePVC == "" {
+		return fmt.Errorf("runner.kubernetes.storage_pvc is required for kubernetes backend")
+	}
+	// 兼容 runner.offline_mode 配置
+	if cfg.Runner.OfflineMode {
+		cfg.Offline.Enabled = true
+	}
+	if err := cfg.Offline.Validate(); err != nil {
+		return err
+	}
 
 	lock.Lock()
 	defer lock.Unlock()
@@ -45,6 +45,7 @@ var Polices = []Policy{
 	//    4. admin: 组织管理员
 	//    5. member: 普通用户
 	//    6. complianceManager: 合规管理员
+	//    7. auditor: 审计员，只读访问组织下的所有资源
 	//    项目角色
 	//    1. manager: 管理者
 	//    2. approver: 审批者
@@ -77,6 +78,7 @@ var Polices = []Policy{
 	// 组织角色
 	{"admin", "policies", "*"},
 	{"member", "policies", "read"},
+	{"auditor", "policies", "read"},
 	{"complianceManager", "policies", "*"},
 	// 项目角色
 	{"manager", "policies", "suppress/enablescan/scan"},
@@ -90,10 +92,12 @@ var Polices = []Policy{
 	// 用户
 	{"admin", "users", "*"},
 	{"member", "users", "read"},
+	{"auditor", "users", "read"},
 	{"complianceManager", "users", "read"},
 	{"login", "self", "read/update"},
 	{"admin", "self", "read/update"},
 	{"member", "self", "read/update"},
+	{"auditor", "self", "read/update"},
 	{"complianceManager", "self", "read/update"},
 
 	// 组织
@@ -102,11 +106,13 @@ var Polices = []Policy{
 	{"admin", "orgs", "read/update"},
 	{"admin", "orgs", "listuser/adduser/removeuser/updaterole"},
 	{"member", "orgs", "read"},
+	{"auditor", "orgs", "read"},
 	{"complianceManager", "orgs", "read"},
 
 	// 项目
 	{"admin", "projects", "*"},
 	{"member", "projects", "read"},
+	{"auditor", "projects", "read"},
 	{"complianceManager", "projects", "read"},
 	{"manager", "projects", "*"},
 	{"approver", "projects", "read"},
@@ -114,20 +120,30 @@ var Polices = []Policy{
 	{"guest", "projects", "read"},
 
 	// 环境
+	{"auditor", "envs", "read"},
 	{"manager", "envs", "*"},
 	{"approver", "envs", "*"},
-	{"operator", "envs", "read/update/deploy/destroy"},
+	{"operator", "envs", "read/update/deploy/destroy/attest/lock/suspend"},
 	{"guest", "envs", "read"},
 
+	// 环境晋级链
+	{"auditor", "promotion_chains", "read"},
+	{"manager", "promotion_chains", "*"},
+	{"approver", "promotion_chains", "read/promote"},
+	{"operator", "promotion_chains", "read/promote"},
+	{"guest", "promotion_chains", "read"},
+
 	// 任务
+	{"auditor", "tasks", "read"},
 	{"manager", "tasks", "*"},
 	{"approver", "tasks", "*"},
-	{"operator", "tasks", "read"},
+	{"operator", "tasks", "read/cancel/retry"},
 	{"guest", "tasks", "read"},
 
 	// 云模板
 	{"admin", "templates", "*"},
 	{"member", "templates", "read"},
+	{"auditor", "templates", "read"},
 	{"complianceManager", "templates", "read"},
 
 	{"manager", "templates", "*"},
@@ -138,6 +154,7 @@ var Polices = []Policy{
 	// 变量
 	{"admin", "variables", "*"},
 	{"member", "variables", "read"},
+	{"auditor", "variables", "read"},
 	{"complianceManager", "variables", "read"},
 
 	{"manager", "variables", "*"},
@@ -148,6 +165,7 @@ var Polices = []Policy{
 	// 资源账号(变量组)
 	{"admin", "var_groups", "*"},
 	{"member", "var_groups", "read"},
+	{"auditor", "var_groups", "read"},
 	{"complianceManager", "var_groups", "read"},
 
 	//token
@@ -161,11 +179,13 @@ var Polices = []Policy{
 	//通知
 	{"admin", "notifications", "*"},
 	{"member", "notifications", "read"},
+	{"auditor", "notifications", "read"},
 	{"complianceManager", "notifications", "read"},
 
 	//vcs
 	{"admin", "vcs", "*"},
 	{"member", "vcs", "read"},
+	{"auditor", "vcs", "read"},
 	{"complianceManager", "vcs", "read"},
 
 	{"manager", "vcs", "read"},
@@ -175,6 +195,7 @@ var Polices = []Policy{
 
 	//runner
 	{"member", "runners", "read"},
+	{"auditor", "runners", "read"},
 	{"complianceManager", "runners", "read"},
 	{"manager", "runners", "read"},
 	{"approver", "runners", "read"},
@@ -189,6 +210,7 @@ var Polices = []Policy{
 	// Registry 配置
 	{"admin", "system_config", "*"},
 	{"member", "system_config", "read"},
+	{"auditor", "system_config", "read"},
 	{"complianceManager", "system_config", "read"},
 
 	{"manager", "system_config", "*"},
@@ -197,11 +219,61 @@ var Polices = []Policy{
 	{"guest", "system_config", "read"},
 
 	// Registry
+	{"auditor", "registry", "read"},
 	{"manager", "registry", "*"},
 	{"approver", "registry", "read"},
 	{"operator", "registry", "read"},
 	{"guest", "registry", "read"},
 
+	// 账单导入
+	{"admin", "billing", "*"},
+	{"member", "billing", "read"},
+	{"auditor", "billing", "read"},
+	{"complianceManager", "billing", "read"},
+
+	// 费用估算价格配置及费用看板
+	{"admin", "cost", "*"},
+	{"member", "cost", "read"},
+	{"auditor", "cost", "read"},
+	{"complianceManager", "cost", "read"},
+	{"manager", "cost", "read"},
+	{"approver", "cost", "read"},
+	{"operator", "cost", "read"},
+	{"guest", "cost", "read"},
+
+	// 聊天账号绑定
+	{"admin", "chatops", "*"},
+
+	// 部署冻结窗口，override 为冻结期间紧急放行
+	{"admin", "freeze_windows", "*"},
+	{"member", "freeze_windows", "read"},
+	{"auditor", "freeze_windows", "read"},
+	{"complianceManager", "freeze_windows", "read"},
+	{"manager", "freeze_windows", "read/override"},
+	{"approver", "freeze_windows", "read"},
+	{"operator", "freeze_windows", "read"},
+	{"guest", "freeze_windows", "read"},
+
+	// 项目配额，只有组织管理员可以修改
+	{"admin", "project_quotas", "*"},
+	{"member", "project_quotas", "read"},
+	{"auditor", "project_quotas", "read"},
+	{"complianceManager", "project_quotas", "read"},
+	{"manager", "project_quotas", "read"},
+	{"approver", "project_quotas", "read"},
+	{"operator", "project_quotas", "read"},
+	{"guest", "project_quotas", "read"},
+
+	// 批量部署
+	{"admin", "fleet_deploys", "*"},
+	{"member", "fleet_deploys", "read"},
+	{"auditor", "fleet_deploys", "read"},
+	{"complianceManager", "fleet_deploys", "read"},
+
+	// 待审批任务，只返回用户有权限审批的任务
+	{"admin", "approvals", "read"},
+	{"member", "approvals", "read"},
+
 	// 演示模式，当访问演示组织下的资源，进入受限模式
 	{"demo", "orgs", "read"},
 	{"demo", "users", "read"},
@@ -218,4 +290,11 @@ var Polices = []Policy{
 	{"demo", "variables", "*"},
 	{"demo", "policies", "read"},
 	{"demo", "registry", "read"},
+	{"demo", "billing", "read"},
+	{"demo", "cost", "read"},
+	{"demo", "freeze_windows", "read"},
+	{"demo", "project_quotas", "read"},
+	{"demo", "fleet_deploys", "read"},
+	{"demo", "promotion_chains", "read"},
+	{"demo", "approvals", "read"},
 }
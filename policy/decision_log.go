@@ -0,0 +1,100 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"bufio"
+	"bytes"
+	"cloudiac/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+const (
+	DecisionPassed   = "passed"
+	DecisionViolated = "violated"
+	DecisionFailed   = "failed"
+)
+
+// DecisionLog OPA 风格的策略决策日志，每次策略评估生成一条
+type DecisionLog struct {
+	DecisionId  string                `json:"decision_id"`
+	Labels      map[string]string     `json:"labels,omitempty"` // 由 portal 在导出时填充任务、环境等信息
+	Path        string                `json:"path"`             // 规则路径，格式为 <策略id>/<规则名称>
+	PolicyId    string                `json:"policy_id"`
+	Bundles     map[string]BundleInfo `json:"bundles,omitempty"` // 策略组及其版本
+	InputDigest string                `json:"input_digest"`      // 输入内容的 sha256 摘要
+	Result      []string              `json:"result"`            // 不合规的资源列表
+	Decision    string                `json:"decision"`          // passed/violated/failed
+	Error       string                `json:"error,omitempty"`
+	Timestamp   time.Time             `json:"timestamp"`
+	Metrics     map[string]int64      `json:"metrics"`
+}
+
+type BundleInfo struct {
+	Revision string `json:"revision"`
+}
+
+// NewDecisionLog 根据策略元数据生成决策日志，latency 为策略评估耗时
+func NewDecisionLog(meta Meta, inputDigest string, start time.Time, latency time.Duration) DecisionLog {
+	id, _ := utils.GetUUID()
+	log := DecisionLog{
+		DecisionId:  id,
+		Path:        meta.Id + "/" + meta.Name,
+		PolicyId:    meta.Id,
+		InputDigest: inputDigest,
+		Result:      make([]string, 0),
+		Timestamp:   start.UTC(),
+		Metrics: map[string]int64{
+			"timer_rego_query_eval_ns": latency.Nanoseconds(),
+		},
+	}
+	if meta.Bundle != "" {
+		log.Bundles = map[string]BundleInfo{meta.Bundle: {Revision: meta.BundleRevision}}
+	}
+	return log
+}
+
+// InputDigest 计算策略输入文件的 sha256 摘要，文件不存在时返回空
+func InputDigest(inputFile string) string {
+	content, err := os.ReadFile(inputFile)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// WriteDecisionLogs 以 json lines 格式写入决策日志
+func WriteDecisionLogs(path string, logs []DecisionLog) error {
+	buf := bytes.NewBuffer(nil)
+	enc := json.NewEncoder(buf)
+	for _, l := range logs {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644) //nolint:gosec
+}
+
+// ParseDecisionLogs 解析 json lines 格式的决策日志
+func ParseDecisionLogs(content []byte) ([]DecisionLog, error) {
+	logs := make([]DecisionLog, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		l := DecisionLog{}
+		if err := json.Unmarshal(line, &l); err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, scanner.Err()
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDecisionLogsRoundTrip(t *testing.T) {
+	meta := Meta{Id: "po-1", Name: "instanceWithNoVpc", Bundle: "pog-1", BundleRevision: "abc123"}
+	log := NewDecisionLog(meta, "sha256:00", time.Now(), time.Millisecond)
+	log.Decision, log.Result = DecisionViolated, []string{"alicloud_instance.web"}
+
+	path := filepath.Join(t.TempDir(), "decision_log.json")
+	if err := WriteDecisionLogs(path, []DecisionLog{log, log}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := ParseDecisionLogs(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("ParseDecisionLogs() len = %d, want 2", len(logs))
+	}
+	got := logs[0]
+	if got.Path != "po-1/instanceWithNoVpc" || got.Decision != DecisionViolated ||
+		got.Bundles["pog-1"].Revision != "abc123" || got.Metrics["timer_rego_query_eval_ns"] != int64(time.Millisecond) {
+		t.Errorf("unexpected decision log: %+v", got)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// ScanBase 增量扫描的基准数据，由上次扫描的输入及结果生成
+type ScanBase struct {
+	ChangedTypes     map[string]bool // 发生变化(新增、删除或修改)的资源类型
+	ChangedResources int             // 发生变化的资源数量
+
+	results map[string]baseResult // 以策略 id 索引的上次扫描结果
+}
+
+type baseResult struct {
+	digest    string
+	resources []string // 不合规的资源，为空表示通过
+}
+
+// NewScanBase 对比上次及本次扫描的输入，得到发生变化的资源，并读取上次的扫描结果
+func NewScanBase(baseInputFile string, baseResultFile string, inputFile string) (*ScanBase, error) {
+	baseInput, err := readScanInput(baseInputFile)
+	if err != nil {
+		return nil, err
+	}
+	input, err := readScanInput(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	baseOutput, err := ReadTfResultJson(baseResultFile)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &ScanBase{ChangedTypes: make(map[string]bool)}
+	for resType, resources := range input {
+		if n := countChangedResources(baseInput[resType], resources); n > 0 {
+			base.ChangedTypes[resType] = true
+			base.ChangedResources += n
+		}
+	}
+	for resType, resources := range baseInput {
+		if _, ok := input[resType]; !ok && len(resources) > 0 {
+			base.ChangedTypes[resType] = true
+			base.ChangedResources += len(resources)
+		}
+	}
+	base.results = indexBaseResults(baseOutput.Results)
+	return base, nil
+}
+
+// Reuse 策略关联的资源类型未发生变化，且策略内容与上次扫描一致时，返回上次扫描的不合规资源
+func (b *ScanBase) Reuse(meta Meta, digest string) ([]string, bool) {
+	if b == nil || meta.ResourceType == "" || meta.ResourceType == "*" || b.ChangedTypes[meta.ResourceType] {
+		return nil, false
+	}
+	r, ok := b.results[meta.Id]
+	if !ok || r.digest == "" || r.digest != digest {
+		return nil, false
+	}
+	return r.resources, true
+}
+
+// PolicyDigest 计算策略内容摘要，用于判断策略自上次扫描后是否被修改
+func PolicyDigest(p *PolicyWithMeta) string {
+	content, err := os.ReadFile(filepath.Join(p.Meta.Root, p.Meta.File))
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	h.Write(content)
+	h.Write([]byte(p.Meta.Name + "\x00" + p.Meta.OpaVersion + "\x00" + p.Meta.RegoVersion))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func indexBaseResults(results TsResult) map[string]baseResult {
+	index := make(map[string]baseResult)
+	for _, r := range results.PassedRules {
+		index[r.RuleId] = baseResult{digest: r.Digest, resources: make([]string, 0)}
+	}
+	for _, v := range results.Violations {
+		r := index[v.RuleId]
+		r.digest = v.Digest
+		r.resources = append(r.resources, v.ResourceName)
+		index[v.RuleId] = r
+	}
+	return index
+}
+
+// readScanInput 读取扫描输入，按资源类型及资源 id 索引资源内容。
+// 资源的源码位置不参与对比，违规资源的行号会根据本次输入重新计算
+func readScanInput(path string) (map[string]map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	input := make(map[string][]map[string]interface{})
+	if err := json.Unmarshal(content, &input); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]map[string]string, len(input))
+	for resType, resources := range input {
+		ret[resType] = make(map[string]string, len(resources))
+		for _, res := range resources {
+			id, _ := res["id"].(string)
+			delete(res, "line")
+			delete(res, "source")
+			bs, _ := json.Marshal(res)
+			ret[resType][id] = string(bs)
+		}
+	}
+	return ret, nil
+}
+
+func countChangedResources(base map[string]string, current map[string]string) int {
+	changed := 0
+	for id, res := range current {
+		if baseRes, ok := base[id]; !ok || baseRes != res {
+			changed++
+		}
+	}
+	for id := range base {
+		if _, ok := current[id]; !ok {
+			changed++
+		}
+	}
+	return changed
+}
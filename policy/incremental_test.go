@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanBaseReuse(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	baseInput := write("base.json", `{
+"alicloud_instance": [{"id": "alicloud_instance.web", "line": 1, "config": {"vpc": ""}}],
+"alicloud_vpc": [{"id": "alicloud_vpc.main", "config": {"cidr": "10.0.0.0/8"}}]
+}`)
+	input := write("input.json", `{
+"alicloud_instance": [{"id": "alicloud_instance.web", "line": 10, "config": {"vpc": ""}}],
+"alicloud_vpc": [{"id": "alicloud_vpc.main", "config": {"cidr": "172.16.0.0/12"}}]
+}`)
+	baseResult := write("result.json", `{"results": {
+"violations": [{"rule_id": "po-1", "resource_name": "alicloud_instance.web", "digest": "d1"}],
+"passed_rules": [{"rule_id": "po-2", "digest": "d2"}]
+}}`)
+
+	base, err := NewScanBase(baseInput, baseResult, input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base.ChangedResources != 1 || !base.ChangedTypes["alicloud_vpc"] || base.ChangedTypes["alicloud_instance"] {
+		t.Fatalf("unexpected changes: %v, %d", base.ChangedTypes, base.ChangedResources)
+	}
+
+	cases := []struct {
+		meta   Meta
+		digest string
+		reused bool
+		res    int
+	}{
+		{Meta{Id: "po-1", ResourceType: "alicloud_instance"}, "d1", true, 1},
+		{Meta{Id: "po-1", ResourceType: "alicloud_instance"}, "changed", false, 0},
+		{Meta{Id: "po-2", ResourceType: "alicloud_vpc"}, "d2", false, 0},
+		{Meta{Id: "po-3", ResourceType: "alicloud_instance"}, "d3", false, 0},
+		{Meta{Id: "po-1", ResourceType: ""}, "d1", false, 0},
+	}
+	for _, c := range cases {
+		res, reused := base.Reuse(c.meta, c.digest)
+		if reused != c.reused || len(res) != c.res {
+			t.Errorf("reuse %s(%s): got %v %v", c.meta.Id, c.digest, res, reused)
+		}
+	}
+
+	var nilBase *ScanBase
+	if _, reused := nilBase.Reuse(Meta{Id: "po-1", ResourceType: "alicloud_instance"}, "d1"); reused {
+		t.Errorf("nil base should not reuse results")
+	}
+}
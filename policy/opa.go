@@ -0,0 +1,196 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"bytes"
+	"cloudiac/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-policy-agent/opa/cover"
+)
+
+const (
+	RegoVersionV0 = "v0"
+	RegoVersionV1 = "v1"
+)
+
+var (
+	// OpaBinDir 外部 opa 可执行文件的存放目录，按版本号存放，如 /usr/yunji/cloudiac/opa/0.59.0/opa
+	OpaBinDir = "/usr/yunji/cloudiac/opa"
+	// OpaEvalTimeout 外部 opa 执行超时时间
+	OpaEvalTimeout = time.Minute
+
+	opaVersionRegex = regexp.MustCompile(`^v?\d+\.\d+\.\d+$`)
+	regoPkgRegex    = regexp.MustCompile(`(?m)^\s*package\s+([\w.]+)`)
+	regoRuleRegex   = regexp.MustCompile(`(?m)^(?:default\s+)?([A-Za-z_]\w*)\s*(\[|\{|=|:=|contains\s|if\s)`)
+	regoMarkRegex   = regexp.MustCompile(`(?m)#+\s*@rule.*\n\s*([A-Za-z_]\w*)`)
+)
+
+// Engine 策略执行引擎选项，OpaVersion 为空且使用 v0 语法时使用内置的 opa 引擎
+type Engine struct {
+	OpaVersion  string `json:"opa_version"`
+	RegoVersion string `json:"rego_version"`
+}
+
+func (e Engine) IsEmbedded() bool {
+	return e.OpaVersion == "" && (e.RegoVersion == "" || e.RegoVersion == RegoVersionV0)
+}
+
+// ValidateEngine 检查 opa 版本及 rego 语法版本是否合法
+func ValidateEngine(opaVersion, regoVersion string) error {
+	if opaVersion != "" && !opaVersionRegex.MatchString(opaVersion) {
+		return fmt.Errorf("invalid opa version '%s'", opaVersion)
+	}
+	switch regoVersion {
+	case "", RegoVersionV0, RegoVersionV1:
+	default:
+		return fmt.Errorf("invalid rego version '%s'", regoVersion)
+	}
+	if regoVersion == RegoVersionV1 && opaVersion != "" && !opaSupportsRegoV1(opaVersion) {
+		return fmt.Errorf("rego v1 syntax requires opa >= 0.59.0")
+	}
+	return nil
+}
+
+func opaMajorMinor(version string) (int, int) {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 {
+		return 0, 0
+	}
+	major, _ := strconv.Atoi(parts[0])
+	minor, _ := strconv.Atoi(parts[1])
+	return major, minor
+}
+
+func opaSupportsRegoV1(version string) bool {
+	major, minor := opaMajorMinor(version)
+	return major >= 1 || minor >= 59
+}
+
+// opaCompatFlags 根据 opa 版本选择语法兼容参数:
+// opa 1.x 默认使用 v1 语法，执行 v0 语法需要 --v0-compatible; 0.x 版本执行 v1 语法需要 --v1-compatible
+func opaCompatFlags(e Engine) []string {
+	major := 1
+	if e.OpaVersion != "" {
+		major, _ = opaMajorMinor(e.OpaVersion)
+	}
+	switch {
+	case major >= 1 && e.RegoVersion != RegoVersionV1:
+		return []string{"--v0-compatible"}
+	case major < 1 && e.RegoVersion == RegoVersionV1:
+		return []string{"--v1-compatible"}
+	}
+	return nil
+}
+
+// OpaBinary 返回指定版本的 opa 可执行文件路径，未指定版本时使用 PATH 中的 opa
+func OpaBinary(version string) string {
+	if version == "" {
+		return "opa"
+	}
+	return filepath.Join(OpaBinDir, strings.TrimPrefix(version, "v"), "opa")
+}
+
+// RegoEval 使用策略组选择的引擎执行规则检查
+func RegoEval(engine Engine, regoFile string, inputFile string, ruleName ...string) ([]interface{}, error) {
+	if engine.IsEmbedded() {
+		return RegoParse(regoFile, inputFile, ruleName...)
+	}
+	return opaEval(engine, regoFile, inputFile, ruleName...)
+}
+
+// RegoEvalWithCoverage 同 RegoEval，使用外部 opa 时不统计覆盖率
+func RegoEvalWithCoverage(engine Engine, regoFile string, inputFile string, cov *cover.Cover, ruleName ...string) ([]interface{}, error) {
+	if engine.IsEmbedded() {
+		return RegoParseWithCoverage(regoFile, inputFile, cov, ruleName...)
+	}
+	return opaEval(engine, regoFile, inputFile, ruleName...)
+}
+
+// searchRegoRule 外部引擎执行时无法使用内置编译器解析规则列表，通过文本匹配查找规则，查找顺序与 searchRule 一致
+func searchRegoRule(content string, regoFile string, ruleName ...string) string {
+	rules := make([]string, 0)
+	for _, m := range regoRuleRegex.FindAllStringSubmatch(content, -1) {
+		switch m[1] {
+		case "package", "import", "default":
+			continue
+		}
+		rules = append(rules, m[1])
+	}
+	if len(rules) == 0 {
+		return ""
+	}
+
+	if len(ruleName) > 0 && utils.StrInArray(ruleName[0], rules...) {
+		return ruleName[0]
+	}
+	if name := utils.FileNameWithoutExt(regoFile); utils.StrInArray(name, rules...) {
+		return name
+	}
+	if match := regoMarkRegex.FindStringSubmatch(content); len(match) == 2 {
+		return match[1]
+	}
+	return rules[0]
+}
+
+type opaEvalOutput struct {
+	Result []struct {
+		Expressions []struct {
+			Value interface{} `json:"value"`
+		} `json:"expressions"`
+	} `json:"result"`
+}
+
+func opaEval(engine Engine, regoFile string, inputFile string, ruleName ...string) ([]interface{}, error) {
+	content, err := os.ReadFile(regoFile)
+	if err != nil {
+		return nil, fmt.Errorf("read rego file: %w", err)
+	}
+	match := regoPkgRegex.FindSubmatch(content)
+	if len(match) != 2 {
+		return nil, fmt.Errorf("rego package not found")
+	}
+	rule := searchRegoRule(string(content), regoFile, ruleName...)
+	if rule == "" {
+		return nil, fmt.Errorf("rego rule not found")
+	}
+	query := fmt.Sprintf("data.%s.%s", match[1], rule)
+
+	args := []string{"eval", "--format", "json", "--data", regoFile, "--input", inputFile}
+	args = append(args, opaCompatFlags(engine)...)
+	args = append(args, query)
+
+	ctx, cancel := context.WithTimeout(context.Background(), OpaEvalTimeout)
+	defer cancel()
+
+	stdout, stderr := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+	cmd := exec.CommandContext(ctx, OpaBinary(engine.OpaVersion), args...) //nolint:gosec
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("evaluating policy: %v: %s%s", err, stderr.String(), stdout.String())
+	}
+
+	output := opaEvalOutput{}
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return nil, fmt.Errorf("parse opa output: %w", err)
+	}
+
+	var result []interface{}
+	if len(output.Result) > 0 && len(output.Result[0].Expressions) > 0 {
+		if v, ok := output.Result[0].Expressions[0].Value.([]interface{}); ok {
+			result = v
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package policy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOpaCompatFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine Engine
+		want   []string
+	}{
+		{"0.x v0", Engine{OpaVersion: "0.45.0", RegoVersion: RegoVersionV0}, nil},
+		{"0.x v1", Engine{OpaVersion: "0.59.0", RegoVersion: RegoVersionV1}, []string{"--v1-compatible"}},
+		{"1.x v0", Engine{OpaVersion: "1.0.0", RegoVersion: RegoVersionV0}, []string{"--v0-compatible"}},
+		{"1.x v1", Engine{OpaVersion: "v1.2.0", RegoVersion: RegoVersionV1}, nil},
+		{"path v1", Engine{RegoVersion: RegoVersionV1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opaCompatFlags(tt.engine); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("opaCompatFlags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEngine(t *testing.T) {
+	tests := []struct {
+		opaVersion  string
+		regoVersion string
+		wantErr     bool
+	}{
+		{"", "", false},
+		{"", RegoVersionV1, false},
+		{"0.59.0", RegoVersionV1, false},
+		{"0.58.1", RegoVersionV1, true},
+		{"0.45.0", RegoVersionV0, false},
+		{"latest", RegoVersionV0, true},
+		{"1.0.0", "v2", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateEngine(tt.opaVersion, tt.regoVersion); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateEngine(%q, %q) error = %v, wantErr %v", tt.opaVersion, tt.regoVersion, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSearchRegoRule(t *testing.T) {
+	content := `package accurics
+
+import rego.v1
+
+default allow := false
+
+helper(x) := x
+
+# @rule
+instanceWithNoVpc contains retVal if {
+	some instance in input.alicloud_instance
+	retVal := instance.id
+}
+`
+	if got := searchRegoRule(content, "policy.rego"); got != "instanceWithNoVpc" {
+		t.Errorf("searchRegoRule() = %v, want instanceWithNoVpc", got)
+	}
+	if got := searchRegoRule(content, "policy.rego", "allow"); got != "allow" {
+		t.Errorf("searchRegoRule() = %v, want allow", got)
+	}
+}
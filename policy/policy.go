@@ -27,6 +27,7 @@ import (
 	en_translation "github.com/go-playground/validator/v10/translations/en"
 	"github.com/hashicorp/hcl"
 	"github.com/open-policy-agent/opa/ast"
+	"github.com/open-policy-agent/opa/cover"
 	"github.com/open-policy-agent/opa/rego"
 	"github.com/open-policy-agent/opa/version"
 
@@ -55,19 +56,23 @@ type Policy struct {
 }
 
 type Meta struct {
-	Category      string `json:"category"`                                           // 分组
-	Root          string `json:"root" validate:"required"`                           // 根目录
-	File          string `json:"file" validate:"required"`                           // 文件名
-	Id            string `json:"id" validate:"required"`                             // 策略id
-	Name          string `json:"name" validate:"required"`                           // 策略名称
-	Label         string `json:"label"`                                              // 策略标签
-	PolicyType    string `json:"policy_type" binding:"required"`                     // 策略类型
-	ReferenceId   string `json:"reference_id"`                                       // 引用策略id
-	ResourceType  string `json:"resource_type" binding:"required"`                   // 资源类型
-	Severity      string `json:"severity" validate:"required,oneof=low medium high"` // 严重程度
-	Version       int    `json:"version"`                                            // 策略版本
-	FixSuggestion string `json:"fix_suggestion"`                                     // 修复建议
-	Description   string `json:"description"`                                        // 描述
+	Category       string `json:"category"`                                           // 分组
+	Root           string `json:"root" validate:"required"`                           // 根目录
+	File           string `json:"file" validate:"required"`                           // 文件名
+	Id             string `json:"id" validate:"required"`                             // 策略id
+	Name           string `json:"name" validate:"required"`                           // 策略名称
+	Label          string `json:"label"`                                              // 策略标签
+	PolicyType     string `json:"policy_type" binding:"required"`                     // 策略类型
+	ReferenceId    string `json:"reference_id"`                                       // 引用策略id
+	ResourceType   string `json:"resource_type" binding:"required"`                   // 资源类型
+	Severity       string `json:"severity" validate:"required,oneof=low medium high"` // 严重程度
+	Version        int    `json:"version"`                                            // 策略版本
+	FixSuggestion  string `json:"fix_suggestion"`                                     // 修复建议
+	Description    string `json:"description"`                                        // 描述
+	OpaVersion     string `json:"opa_version"`                                        // 执行策略的 opa 版本，为空使用内置引擎
+	RegoVersion    string `json:"rego_version"`                                       // rego 语法版本: v0/v1
+	Bundle         string `json:"bundle"`                                             // 所属策略组
+	BundleRevision string `json:"bundle_revision"`                                    // 策略组版本
 }
 
 type Resource struct {
@@ -100,6 +105,7 @@ type Rule struct {
 	RuleId      string `json:"rule_id"`
 	Severity    string `json:"severity"`
 	Category    string `json:"category"`
+	Digest      string `json:"digest,omitempty"` // 策略内容摘要，用于增量扫描
 }
 
 type Violation struct {
@@ -116,6 +122,7 @@ type Violation struct {
 	ModuleName   string `json:"module_name,omitempty"`
 	PlanRoot     string `json:"plan_root,omitempty"`
 	Source       string `json:"source,omitempty"`
+	Digest       string `json:"digest,omitempty"` // 策略内容摘要，用于增量扫描
 }
 
 type TsCount struct {
@@ -561,6 +568,31 @@ func searchRule(reg Rego, ruleName ...string) string {
 }
 
 func RegoParse(regoFile string, inputFile string, ruleName ...string) ([]interface{}, error) {
+	return regoEval(regoFile, inputFile, nil, ruleName...)
+}
+
+// RegoParseWithCoverage 执行规则检查，同时将 rego 脚本的执行轨迹记录到 cov 中用于统计覆盖率，
+// 同一个 cov 可以在多次执行间复用以得到多个输入的累计覆盖率
+func RegoParseWithCoverage(regoFile string, inputFile string, cov *cover.Cover, ruleName ...string) ([]interface{}, error) {
+	return regoEval(regoFile, inputFile, cov, ruleName...)
+}
+
+// RegoCoverage 根据执行轨迹生成 rego 脚本的覆盖率报告
+func RegoCoverage(regoFile string, cov *cover.Cover) (*cover.FileReport, error) {
+	reg := Rego{
+		filePath: regoFile,
+	}
+	if err := reg.Init(); err != nil {
+		return nil, err
+	}
+	report := cov.Report(reg.compiler.Modules)
+	if fr, ok := report.Files[regoFile]; ok {
+		return fr, nil
+	}
+	return &cover.FileReport{}, nil
+}
+
+func regoEval(regoFile string, inputFile string, cov *cover.Cover, ruleName ...string) ([]interface{}, error) {
 	reg := Rego{
 		filePath: regoFile,
 	}
@@ -612,6 +644,9 @@ func RegoParse(regoFile string, inputFile string, ruleName ...string) ([]interfa
 		rego.Load([]string{regoFile}, nil),
 		rego.Runtime(info),
 	}
+	if cov != nil {
+		regoArgs = append(regoArgs, rego.QueryTracer(cov))
+	}
 
 	// 执行规则检查
 	r := rego.New(regoArgs...)
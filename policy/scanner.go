@@ -42,6 +42,11 @@ type Scanner struct {
 	WorkingDir string
 	PolicyDir  string
 
+	DecisionLogFile string // 决策日志输出文件，为空时不输出
+
+	BaseInputFile  string // 上次扫描的输入文件，与 BaseResultFile 同时指定时执行增量扫描
+	BaseResultFile string // 上次扫描的结果文件
+
 	Policies []Policy
 
 	Resources []Resource
@@ -367,9 +372,34 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 		return err
 	}
 
+	var (
+		inputDigest  string
+		decisionLogs []DecisionLog
+	)
+	if s.DecisionLogFile != "" {
+		inputDigest = InputDigest(s.GetConfigPath(code))
+	}
+
+	base := s.loadScanBase(code)
+	reusedPolicies := 0
+
 	violated := false
 	for _, p := range policies {
-		result, err := RegoParse(filepath.Join(p.Meta.Root, p.Meta.File), s.GetConfigPath(code), p.Meta.Name)
+		var err error
+		digest := PolicyDigest(p)
+		startAt := time.Now()
+		res, reused := base.Reuse(p.Meta, digest)
+		if reused {
+			reusedPolicies++
+		} else {
+			engine := Engine{OpaVersion: p.Meta.OpaVersion, RegoVersion: p.Meta.RegoVersion}
+			var result []interface{}
+			result, err = RegoEval(engine, filepath.Join(p.Meta.Root, p.Meta.File), s.GetConfigPath(code), p.Meta.Name)
+			if err == nil {
+				res = (&Rego{}).ParseResource(result)
+			}
+		}
+		decisionLog := NewDecisionLog(p.Meta, inputDigest, startAt, time.Since(startAt))
 		if err != nil {
 			scanError := ScanError{
 				RuleName:    p.Meta.Name,
@@ -386,10 +416,10 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 			output.Results.ScanErrors = append(output.Results.ScanErrors, scanError)
 			output.Results.ScanSummary.PoliciesError++
 			s.Console(s.GetMessage(MSG_TEMPLATE_ERROR, scanError))
+			decisionLog.Decision, decisionLog.Error = DecisionFailed, err.Error()
+			decisionLogs = append(decisionLogs, decisionLog)
 			continue
 		}
-		// parse result
-		res := (&Rego{}).ParseResource(result)
 		// generate result
 		if len(res) > 0 {
 			resName := res[0]
@@ -402,6 +432,7 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 				Category:     p.Meta.Category,
 				ResourceName: resName,
 				ResourceType: resType,
+				Digest:       digest,
 			}
 			if len(inputResource) > 0 {
 				violation.Line, violation.File = findLineNoFromMap(inputResource, resName)
@@ -410,6 +441,7 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 			output.Results.ScanSummary.ViolatedPolicies++
 			s.Console(s.GetMessage(MSG_TEMPLATE_VIOLATED, violation))
 			violated = true
+			decisionLog.Decision, decisionLog.Result = DecisionViolated, res
 		} else {
 			rule := Rule{
 				RuleName:    p.Meta.Name,
@@ -417,11 +449,14 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 				RuleId:      p.Meta.Id,
 				Severity:    p.Meta.Severity,
 				Category:    p.Meta.Category,
+				Digest:      digest,
 			}
 			output.Results.PassedRules = append(output.Results.PassedRules, rule)
 			output.Results.ScanSummary.PoliciesValidated++
 			s.Console(s.GetMessage(MSG_TEMPLATE_PASSED, rule))
+			decisionLog.Decision = DecisionPassed
 		}
+		decisionLogs = append(decisionLogs, decisionLog)
 		switch strings.ToLower(p.Meta.Severity) {
 		case common.PolicySeverityHigh:
 			output.Results.ScanSummary.High++
@@ -434,6 +469,11 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 		}
 	}
 
+	if base != nil {
+		s.Console(fmt.Sprintf("Incremental scan: %d resources changed, %d/%d policies reused",
+			base.ChangedResources, reusedPolicies, len(policies)))
+	}
+
 	if s.ResultFile != "" {
 		outputB, _ := json.Marshal(output)
 		if err := os.WriteFile(s.GetResultPath(code), outputB, 0644); err != nil { //nolint:gosec
@@ -444,6 +484,12 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 		fmt.Printf("%s\n", outputB)
 	}
 
+	if s.DecisionLogFile != "" {
+		if err := WriteDecisionLogs(filepath.Join(s.WorkingDir, s.DecisionLogFile), decisionLogs); err != nil {
+			return err
+		}
+	}
+
 	if violated {
 		return ErrScanExitViolated
 	}
@@ -451,6 +497,20 @@ func (s *Scanner) RunInternalScan(code Resource) error {
 	return nil
 }
 
+// loadScanBase 读取增量扫描的基准数据，未指定或读取失败时返回 nil 执行全量扫描
+func (s *Scanner) loadScanBase(code Resource) *ScanBase {
+	if s.BaseInputFile == "" || s.BaseResultFile == "" {
+		return nil
+	}
+	base, err := NewScanBase(filepath.Join(s.WorkingDir, s.BaseInputFile),
+		filepath.Join(s.WorkingDir, s.BaseResultFile), s.GetConfigPath(code))
+	if err != nil {
+		s.Console(fmt.Sprintf("Incremental scan disabled: %v", err))
+		return nil
+	}
+	return base
+}
+
 func (s *Scanner) ReadPolicies(policyDir string) ([]*PolicyWithMeta, error) {
 	// 文件结构：
 	// policies
@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/libs/page"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// 接口契约测试：v1 接口已冻结，返回结构的字段不允许变更，不兼容的修改需要在 v2 中实现
+
+func jsonKeys(t *testing.T, v interface{}) []string {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(bs, &m); err != nil {
+		t.Fatal(err)
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestApiContract(t *testing.T) {
+	cases := []struct {
+		name string
+		v    interface{}
+		keys []string
+	}{
+		{"v1 page", page.PageResp{}, []string{"list", "pageSize", "total"}},
+		{"v1 scan result", ScanResultPageResp{}, []string{"groups", "pageSize", "policyStatus", "task", "total"}},
+		{"v1 scan result group", PolicyResultGroup{}, []string{"id", "list", "name", "summary"}},
+		{"v2 cursor page", page.CursorResp{}, []string{"list", "nextCursor"}},
+		{"v2 scan result", ScanResultCursorResp{}, []string{"groups", "nextCursor", "policyStatus", "task"}},
+	}
+	for _, c := range cases {
+		if keys := jsonKeys(t, c.v); !reflect.DeepEqual(keys, c.keys) {
+			t.Errorf("%s: got keys %v, want %v", c.name, keys, c.keys)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	cursor := page.EncodeCursor("2022-01-02 15:04:05", "run-c1a2b3")
+	values, err := page.DecodeCursor(cursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(values, []string{"2022-01-02 15:04:05", "run-c1a2b3"}) {
+		t.Errorf("unexpected cursor values %v", values)
+	}
+
+	if _, err := page.DecodeCursor(cursor, 1); err == nil {
+		t.Errorf("expect error for mismatched cursor fields")
+	}
+	if _, err := page.DecodeCursor("not a cursor", 2); err == nil {
+		t.Errorf("expect error for invalid cursor")
+	}
+}
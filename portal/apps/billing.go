@@ -0,0 +1,222 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/billing"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func checkBillingCycle(cycle string) (string, e.Error) {
+	if cycle == "" {
+		return billing.CurrentCycle(time.Now()), nil
+	}
+	if _, err := time.Parse(billing.BillingCycleLayout, cycle); err != nil {
+		return "", e.New(e.BadParam, fmt.Errorf("invalid billing cycle '%s'", cycle), http.StatusBadRequest)
+	}
+	return cycle, nil
+}
+
+// CreateBillingConnector 创建账单导入连接器
+func CreateBillingConnector(c *ctx.ServiceContext, form *forms.CreateBillingConnectorForm) (*models.BillingConnector, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create billing connector %s", form.Name))
+
+	if !utils.StrInArray(form.Provider, billing.Providers...) {
+		return nil, e.New(e.BillingProviderInvalid, http.StatusBadRequest)
+	}
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	if _, err := services.GetResourceAccountById(query, form.ResourceAccountId); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
+	connector := models.BillingConnector{
+		OrgId:             c.OrgId,
+		Name:              form.Name,
+		Provider:          form.Provider,
+		ResourceAccountId: form.ResourceAccountId,
+		Options:           models.JSON(utils.MustJSON(form.Options)),
+		Enabled:           true,
+		SyncInterval:      form.SyncInterval,
+	}
+	if connector.SyncInterval <= 0 {
+		connector.SyncInterval = 24
+	}
+	return services.CreateBillingConnector(c.DB(), connector)
+}
+
+func SearchBillingConnector(c *ctx.ServiceContext, form *forms.SearchBillingConnectorForm) (interface{}, e.Error) {
+	query := services.QueryBillingConnector(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.Q != "" {
+		query = query.WhereLike("name", form.Q)
+	}
+	query = query.Order("created_at DESC")
+
+	connectors := make([]*models.BillingConnector, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), form.Order(query))
+	if err := p.Scan(&connectors); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     connectors,
+	}, nil
+}
+
+func BillingConnectorDetail(c *ctx.ServiceContext, form *forms.DetailBillingConnectorForm) (*models.BillingConnector, e.Error) {
+	return services.GetBillingConnectorById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+}
+
+func UpdateBillingConnector(c *ctx.ServiceContext, form *forms.UpdateBillingConnectorForm) (*models.BillingConnector, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update billing connector %s", form.Id))
+
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	if _, err := services.GetBillingConnectorById(query, form.Id); err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("resourceAccountId") {
+		if _, err := services.GetResourceAccountById(services.QueryWithOrgId(c.DB(), c.OrgId), form.ResourceAccountId); err != nil {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		attrs["resource_account_id"] = form.ResourceAccountId
+	}
+	if form.HasKey("options") && form.Options != nil {
+		attrs["options"] = models.JSON(utils.MustJSON(form.Options))
+	}
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+	if form.HasKey("syncInterval") && form.SyncInterval > 0 {
+		attrs["sync_interval"] = form.SyncInterval
+	}
+	return services.UpdateBillingConnector(c.DB(), form.Id, attrs)
+}
+
+func DeleteBillingConnector(c *ctx.ServiceContext, form *forms.DeleteBillingConnectorForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete billing connector %s", form.Id))
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if _, err := services.GetBillingConnectorById(services.QueryWithOrgId(tx, c.OrgId), form.Id); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := services.DeleteBillingConnector(tx, form.Id); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return nil, nil
+}
+
+type SyncBillingResp struct {
+	BillingCycle string `json:"billingCycle"`
+	Records      int    `json:"records"` // 导入的账单记录数
+}
+
+// SyncBillingConnector 立即执行一次账单同步
+func SyncBillingConnector(c *ctx.ServiceContext, form *forms.SyncBillingConnectorForm) (*SyncBillingResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("sync billing connector %s", form.Id))
+
+	cycle, err := checkBillingCycle(form.BillingCycle)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := services.GetBillingConnectorById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil {
+		return nil, err
+	}
+	count, err := services.SyncBillingConnector(c.DB(), connector, cycle)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncBillingResp{BillingCycle: cycle, Records: count}, nil
+}
+
+type BillingReportResp struct {
+	BillingCycle  string                     `json:"billingCycle"`
+	ManagedCost   map[string]float64         `json:"managedCost"`   // 按币种汇总的已管理资源费用
+	UnmanagedCost map[string]float64         `json:"unmanagedCost"` // 按币种汇总的未管理资源费用
+	Items         []services.BillingCostItem `json:"items"`         // 按环境汇总的费用明细
+
+	Watermark *services.ReportWatermark `json:"watermark,omitempty"` // 审计员导出时记录导出人
+}
+
+// BillingReport 组织账单费用报表
+func BillingReport(c *ctx.ServiceContext, form *forms.BillingReportForm) (*BillingReportResp, e.Error) {
+	cycle, err := checkBillingCycle(form.BillingCycle)
+	if err != nil {
+		return nil, err
+	}
+	items, err := services.BillingCostByEnv(c.DB(), c.OrgId, cycle)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &BillingReportResp{
+		BillingCycle:  cycle,
+		ManagedCost:   make(map[string]float64),
+		UnmanagedCost: make(map[string]float64),
+		Items:         items,
+	}
+	for _, item := range items {
+		resp.ManagedCost[item.Currency] += item.Cost
+	}
+
+	unmanaged := make([]struct {
+		Currency string
+		Cost     float64
+	}, 0)
+	if err := services.QueryUnmanagedBillingRecords(c.DB(), c.OrgId, cycle).
+		Group("currency").Select("currency, SUM(cost) AS cost").Scan(&unmanaged); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, u := range unmanaged {
+		resp.UnmanagedCost[u.Currency] += u.Cost
+	}
+	if resp.Watermark, err = services.NewReportWatermark(c.DB(), c.UserId, c.OrgId); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// SearchUnmanagedBilling 查询未被 CloudIaC 管理的资源费用明细
+func SearchUnmanagedBilling(c *ctx.ServiceContext, form *forms.SearchUnmanagedBillingForm) (interface{}, e.Error) {
+	cycle, err := checkBillingCycle(form.BillingCycle)
+	if err != nil {
+		return nil, err
+	}
+	query := services.QueryUnmanagedBillingRecords(c.DB(), c.OrgId, cycle)
+	records := make([]*models.BillingRecord, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&records); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     records,
+	}, nil
+}
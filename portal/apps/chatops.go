@@ -0,0 +1,338 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/chatops"
+	"cloudiac/portal/services/rbac"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type ChatIdentityResp struct {
+	models.ChatIdentity
+
+	UserName string `json:"userName"` // 绑定用户名称
+}
+
+func SearchChatIdentity(c *ctx.ServiceContext, form *forms.SearchChatIdentityForm) (interface{}, e.Error) {
+	query := services.QueryChatIdentity(c.DB(), c.OrgId)
+	if form.Platform != "" {
+		query = query.Where("iac_chat_identity.platform = ?", form.Platform)
+	}
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	identities := make([]*ChatIdentityResp, 0)
+	if err := p.Scan(&identities); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     identities,
+	}, nil
+}
+
+// CreateChatIdentity 绑定聊天账号与组织用户，每个聊天账号只能绑定一个用户
+func CreateChatIdentity(c *ctx.ServiceContext, form *forms.CreateChatIdentityForm) (*models.ChatIdentity, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create chat identity %s:%s", form.Platform, form.ChatUserId))
+
+	if !services.UserHasOrgRole(form.UserId, c.OrgId, "") {
+		return nil, e.New(e.UserNotExists, fmt.Errorf("user '%s' not in org", form.UserId), http.StatusBadRequest)
+	}
+	identity, err := services.CreateChatIdentity(c.DB(), models.ChatIdentity{
+		OrgId:      c.OrgId,
+		UserId:     form.UserId,
+		Platform:   form.Platform,
+		ChatUserId: form.ChatUserId,
+		CreatorId:  c.UserId,
+	})
+	if err != nil && err.Code() == e.ChatIdentityAlreadyExists {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return identity, err
+}
+
+func DeleteChatIdentity(c *ctx.ServiceContext, form *forms.DeleteChatIdentityForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete chat identity %s", form.Id))
+
+	identity, err := services.GetChatIdentityById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil {
+		if err.Code() == e.ChatIdentityNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if err := services.DeleteChatIdentity(c.DB(), identity.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+type chatOpsRequest struct {
+	Platform   string
+	ChatUserId string
+	Text       string
+	ReplyUrl   string // 异步回复任务结果的地址
+}
+
+// ChatOpsSlack 处理 Slack slash command 请求
+func ChatOpsSlack(c *ctx.ServiceContext, timestamp, signature string, body []byte) (interface{}, e.Error) {
+	secret := configs.Get().ChatOps.SlackSigningSecret
+	if secret == "" {
+		return nil, e.New(e.ChatOpsDisabled, http.StatusNotFound)
+	}
+	if err := chatops.VerifySlackSignature(secret, timestamp, signature, body, time.Now()); err != nil {
+		return nil, e.New(e.ChatOpsSignatureInvalid, err, http.StatusUnauthorized)
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	if replyUrl := values.Get("response_url"); replyUrl != "" {
+		if err := chatops.CheckReplyUrl(models.ChatPlatformSlack, replyUrl); err != nil {
+			return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+		}
+	}
+	reply := runChatOpsCommand(c, &chatOpsRequest{
+		Platform:   models.ChatPlatformSlack,
+		ChatUserId: values.Get("user_id"),
+		Text:       values.Get("text"),
+		ReplyUrl:   values.Get("response_url"),
+	})
+	return chatops.NewReply(models.ChatPlatformSlack, reply), nil
+}
+
+// ChatOpsDingTalk 处理钉钉机器人回调请求
+func ChatOpsDingTalk(c *ctx.ServiceContext, timestamp, signature string, body []byte) (interface{}, e.Error) {
+	conf := configs.Get().ChatOps
+	if conf.DingTalkAppSecret == "" {
+		return nil, e.New(e.ChatOpsDisabled, http.StatusNotFound)
+	}
+	if conf.DingTalkRobotCode == "" && len(conf.DingTalkConversationIds) == 0 {
+		return nil, e.New(e.ChatOpsDisabled, fmt.Errorf("dingtalk robot code or conversation ids not configured"), http.StatusNotFound)
+	}
+	if err := chatops.VerifyDingTalkSignature(conf.DingTalkAppSecret, timestamp, signature, time.Now()); err != nil {
+		return nil, e.New(e.ChatOpsSignatureInvalid, err, http.StatusUnauthorized)
+	}
+	// 签名不包含请求内容，同一签名只能使用一次
+	if ok, err := chatops.ClaimRequestNonce(models.ChatPlatformDingTalk+":"+signature, chatops.DingTalkMaxRequestAge*2); err != nil {
+		return nil, e.New(e.InternalError, err)
+	} else if !ok {
+		return nil, e.New(e.ChatOpsSignatureInvalid, fmt.Errorf("request replayed"), http.StatusUnauthorized)
+	}
+
+	msg := chatops.DingTalkMessage{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, e.New(e.JSONParseError, err, http.StatusBadRequest)
+	}
+	if conf.DingTalkRobotCode != "" && msg.RobotCode != conf.DingTalkRobotCode {
+		return nil, e.New(e.ChatOpsSignatureInvalid, fmt.Errorf("robot '%s' is not allowed", msg.RobotCode), http.StatusForbidden)
+	}
+	if len(conf.DingTalkConversationIds) > 0 && !utils.StrInArray(msg.ConversationId, conf.DingTalkConversationIds...) {
+		return nil, e.New(e.ChatOpsSignatureInvalid, fmt.Errorf("conversation '%s' is not allowed", msg.ConversationId), http.StatusForbidden)
+	}
+	if msg.SessionWebhook != "" {
+		if err := chatops.CheckReplyUrl(models.ChatPlatformDingTalk, msg.SessionWebhook); err != nil {
+			return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+		}
+	}
+	chatUserId := msg.SenderStaffId
+	if chatUserId == "" {
+		chatUserId = msg.SenderId
+	}
+	reply := runChatOpsCommand(c, &chatOpsRequest{
+		Platform:   models.ChatPlatformDingTalk,
+		ChatUserId: chatUserId,
+		Text:       msg.Text.Content,
+		ReplyUrl:   msg.SessionWebhook,
+	})
+	return chatops.NewReply(models.ChatPlatformDingTalk, reply), nil
+}
+
+// runChatOpsCommand 以聊天账号绑定的用户身份执行指令，返回回复的消息内容
+func runChatOpsCommand(c *ctx.ServiceContext, req *chatOpsRequest) string {
+	c.AddLogField("chatUser", fmt.Sprintf("%s:%s", req.Platform, req.ChatUserId))
+
+	identity, err := services.GetChatIdentity(c.DB(), req.Platform, req.ChatUserId)
+	if err != nil {
+		if err.Code() == e.ChatIdentityNotExists {
+			return fmt.Sprintf("聊天账号 %s 未绑定 CloudIaC 用户，请联系组织管理员绑定", req.ChatUserId)
+		}
+		c.Logger().Errorf("get chat identity error: %v", err)
+		return chatOpsErrorReply(err)
+	}
+	user, err := services.GetUserById(c.DB(), identity.UserId)
+	if err != nil {
+		return chatOpsErrorReply(err)
+	}
+	if user.Status == models.Disable {
+		return chatOpsErrorReply(e.New(e.InvalidOperation, fmt.Errorf("user '%s' is disabled", user.Name)))
+	}
+	c.UserId = user.Id
+	c.Username = user.Name
+	c.IsSuperAdmin = user.IsAdmin
+	c.OrgId = identity.OrgId
+
+	cmd, er := chatops.ParseCommand(req.Text)
+	if er != nil {
+		return fmt.Sprintf("%v\n%s", er, chatops.HelpText)
+	}
+	c.AddLogField("action", fmt.Sprintf("chatops %s %s", cmd.Name, cmd.Arg()))
+
+	var (
+		reply  string
+		taskId models.Id
+	)
+	switch cmd.Name {
+	case chatops.CmdDeploy:
+		reply, taskId, err = chatOpsDeploy(c, cmd.Arg())
+	case chatops.CmdScan:
+		reply, taskId, err = chatOpsScan(c, cmd.Arg())
+	case chatops.CmdStatus:
+		reply, err = chatOpsStatus(c, cmd.Arg())
+	default:
+		return chatops.HelpText
+	}
+	if err != nil {
+		return chatOpsErrorReply(err)
+	}
+
+	if taskId != "" && req.ReplyUrl != "" {
+		if _, err := services.CreateChatOpsCommand(c.DB(), models.ChatOpsCommand{
+			OrgId:      c.OrgId,
+			UserId:     c.UserId,
+			Platform:   req.Platform,
+			ChatUserId: req.ChatUserId,
+			Command:    cmd.Name,
+			Args:       cmd.Arg(),
+			TaskId:     taskId,
+			ReplyUrl:   req.ReplyUrl,
+		}); err != nil {
+			c.Logger().Warnf("create chatops command error: %v", err)
+		}
+	}
+	return reply
+}
+
+func chatOpsErrorReply(err e.Error) string {
+	return fmt.Sprintf("执行失败: %s(%v)", e.ErrorMsg(err, ""), err)
+}
+
+// enforceUserPerm 按用户在组织及项目下的角色检查访问权限，与 api 接口的权限规则一致
+func enforceUserPerm(c *ctx.ServiceContext, object, action string) e.Error {
+	role, proj := "", ""
+	if c.IsSuperAdmin {
+		role, proj = consts.RoleRoot, consts.ProjectRoleManager
+	} else if userOrg := services.UserOrgRoles(c.UserId)[c.OrgId]; userOrg != nil {
+		role = userOrg.Role
+		if role == consts.OrgRoleAdmin {
+			proj = consts.ProjectRoleManager
+		} else if userProject := services.UserProjectRoles(c.UserId)[c.ProjectId]; userProject != nil &&
+			role != consts.OrgRoleAuditor {
+			proj = userProject.Role
+		}
+	}
+	if role == "" {
+		return e.New(e.PermissionDeny, fmt.Errorf("user not in org"))
+	}
+
+	allow, err := rbac.Enforce(role, proj, object, action)
+	if err != nil {
+		return e.New(e.InternalError, err)
+	} else if !allow {
+		return e.New(e.PermissionDeny, fmt.Errorf("%s,%s not allowed to %s %s", role, proj, action, object))
+	}
+	return nil
+}
+
+func chatOpsDeploy(c *ctx.ServiceContext, name string) (string, models.Id, e.Error) {
+	env, err := services.GetChatOpsEnv(c.DB(), c.OrgId, name)
+	if err != nil {
+		return "", "", err
+	}
+	c.ProjectId = env.ProjectId
+	if err := enforceUserPerm(c, "envs", "deploy"); err != nil {
+		return "", "", err
+	}
+
+	// 使用环境当前的配置重新部署
+	detail, err := EnvDeploy(c, &forms.DeployEnvForm{
+		Id:              env.Id,
+		TaskType:        common.TaskTypeApply,
+		Triggers:        env.Triggers,
+		AutoApproval:    env.AutoApproval,
+		AutoRepairDrift: env.AutoRepairDrift,
+		KeyId:           env.KeyId,
+		Playbook:        env.Playbook,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	reply := fmt.Sprintf("环境 %s 部署任务已创建: %s", env.Name, detail.TaskId)
+	if !env.AutoApproval {
+		reply += "，plan 完成后需要审批"
+	}
+	return reply, detail.TaskId, nil
+}
+
+func chatOpsScan(c *ctx.ServiceContext, name string) (string, models.Id, e.Error) {
+	tpl, err := services.GetChatOpsTemplate(c.DB(), c.OrgId, name)
+	if err != nil {
+		return "", "", err
+	}
+	if err := enforceUserPerm(c, "policies", "scan"); err != nil {
+		return "", "", err
+	}
+
+	task, err := ScanTemplateOrEnv(c, &forms.ScanTemplateForm{Id: tpl.Id}, "")
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("云模板 %s 合规检测任务已创建: %s", tpl.Name, task.Id), task.Id, nil
+}
+
+func chatOpsStatus(c *ctx.ServiceContext, name string) (string, e.Error) {
+	env, err := services.GetChatOpsEnv(c.DB(), c.OrgId, name)
+	if err != nil {
+		return "", err
+	}
+	c.ProjectId = env.ProjectId
+	if err := enforceUserPerm(c, "envs", "read"); err != nil {
+		return "", err
+	}
+
+	detail, err := EnvDetail(c, forms.DetailEnvForm{Id: env.Id})
+	if err != nil {
+		return "", err
+	}
+	lines := []string{
+		fmt.Sprintf("环境: %s(%s)", detail.Name, detail.Id),
+		fmt.Sprintf("状态: %s", detail.Status),
+		fmt.Sprintf("资源数量: %d", detail.ResourceCount),
+	}
+	if detail.TaskStatus != "" {
+		lines = append(lines, fmt.Sprintf("当前任务: %s", detail.TaskStatus))
+	}
+	if detail.LastTaskId != "" {
+		lines = append(lines, fmt.Sprintf("最近任务: %s %s", detail.LastTaskId, detail.Operator))
+	}
+	lines = append(lines, fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s",
+		configs.Get().Portal.Address, env.OrgId, env.ProjectId, env.Id))
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CreateCostPrice 创建费用估算的价格配置
+func CreateCostPrice(c *ctx.ServiceContext, form *forms.CreateCostPriceForm) (*models.CostPrice, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create cost price %s", form.ResourceType))
+
+	p := models.CostPrice{
+		OrgId:        c.OrgId,
+		ResourceType: strings.TrimSpace(form.ResourceType),
+		MatchAttr:    strings.TrimSpace(form.MatchAttr),
+		MatchValue:   form.MatchValue,
+		MonthlyPrice: form.MonthlyPrice,
+		Description:  form.Description,
+	}
+	if err := services.ValidateCostPrice(&p); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	price, err := services.CreateCostPrice(c.DB(), p)
+	if err != nil && err.Code() == e.ObjectAlreadyExists {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return price, err
+}
+
+func SearchCostPrice(c *ctx.ServiceContext, form *forms.SearchCostPriceForm) (interface{}, e.Error) {
+	query := services.QueryCostPrice(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.Q != "" {
+		query = query.WhereLike("resource_type", form.Q)
+	}
+	if form.ResourceType != "" {
+		query = query.Where("resource_type = ?", form.ResourceType)
+	}
+	query = query.Order("resource_type, match_attr, match_value")
+
+	prices := make([]*models.CostPrice, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), form.Order(query))
+	if err := p.Scan(&prices); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     prices,
+	}, nil
+}
+
+func CostPriceDetail(c *ctx.ServiceContext, form *forms.DetailCostPriceForm) (*models.CostPrice, e.Error) {
+	return services.GetCostPriceById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+}
+
+func UpdateCostPrice(c *ctx.ServiceContext, form *forms.UpdateCostPriceForm) (*models.CostPrice, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update cost price %s", form.Id))
+
+	p, err := services.GetCostPriceById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("matchAttr") {
+		p.MatchAttr = strings.TrimSpace(form.MatchAttr)
+		attrs["match_attr"] = p.MatchAttr
+	}
+	if form.HasKey("matchValue") {
+		p.MatchValue = form.MatchValue
+		attrs["match_value"] = p.MatchValue
+	}
+	if form.HasKey("monthlyPrice") {
+		p.MonthlyPrice = form.MonthlyPrice
+		attrs["monthly_price"] = p.MonthlyPrice
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if err := services.ValidateCostPrice(p); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	price, err := services.UpdateCostPrice(c.DB(), form.Id, attrs)
+	if err != nil && err.Code() == e.ObjectAlreadyExists {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return price, err
+}
+
+func DeleteCostPrice(c *ctx.ServiceContext, form *forms.DeleteCostPriceForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete cost price %s", form.Id))
+
+	if _, err := services.GetCostPriceById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteCostPrice(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+type ProjectCostItem struct {
+	ProjectId     models.Id `json:"projectId"`
+	ProjectName   string    `json:"projectName"`
+	MonthlyCost   float64   `json:"monthlyCost"`
+	MonthlyBudget float64   `json:"monthlyBudget"` // 项目下设置了预算的环境的预算合计
+	EnvCount      int       `json:"envCount"`
+	OverBudget    int       `json:"overBudget"` // 超出预算的环境数量
+}
+
+type CostDashboardResp struct {
+	MonthlyCost float64                `json:"monthlyCost"` // 环境估算月度费用合计
+	OverBudget  int                    `json:"overBudget"`  // 超出预算的环境数量
+	Projects    []*ProjectCostItem     `json:"projects"`    // 按项目汇总的费用
+	Envs        []services.EnvCostItem `json:"envs"`        // 各环境的费用，按费用从高到低排序
+}
+
+// CostDashboard 组织或项目的估算费用看板，费用为各环境最近一次部署时估算的月度费用
+func CostDashboard(c *ctx.ServiceContext, form *forms.CostDashboardForm) (*CostDashboardResp, e.Error) {
+	projectId := form.ProjectId
+	if projectId == "" {
+		projectId = c.ProjectId
+	}
+	envs, err := services.EnvCostByOrg(c.DB(), c.OrgId, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &CostDashboardResp{
+		Projects: make([]*ProjectCostItem, 0),
+		Envs:     envs,
+	}
+	projects := make(map[models.Id]*ProjectCostItem)
+	for _, env := range envs {
+		p, ok := projects[env.ProjectId]
+		if !ok {
+			p = &ProjectCostItem{ProjectId: env.ProjectId, ProjectName: env.ProjectName}
+			projects[env.ProjectId] = p
+			resp.Projects = append(resp.Projects, p)
+		}
+		p.EnvCount += 1
+		p.MonthlyCost += env.MonthlyCost
+		p.MonthlyBudget += env.MonthlyBudget
+		resp.MonthlyCost += env.MonthlyCost
+		if env.OverBudget {
+			p.OverBudget += 1
+			resp.OverBudget += 1
+		}
+	}
+	return resp, nil
+}
+
+type TaskCostEstimateResp struct {
+	page.PageResp
+
+	CostEstimated    bool    `json:"costEstimated"`    // 任务是否进行了费用估算，组织未配置价格时不估算
+	MonthlyCost      float64 `json:"monthlyCost"`      // plan 范围内资源变更后的月度费用
+	MonthlyCostDelta float64 `json:"monthlyCostDelta"` // 月度费用变化
+}
+
+// SearchTaskCostEstimates 查询任务 plan 结果的资源费用估算
+func SearchTaskCostEstimates(c *ctx.ServiceContext, form *forms.SearchTaskCostEstimateForm) (interface{}, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" || form.Id == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	task, err := services.GetTaskById(c.DB(), form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if task.OrgId != c.OrgId || task.ProjectId != c.ProjectId {
+		return nil, e.New(e.TaskNotExists, http.StatusNotFound)
+	}
+
+	query := c.DB().Model(&models.TaskCostEstimate{}).Where("task_id = ?", task.Id).
+		Order("monthly_delta DESC, address")
+	rows := make([]*models.TaskCostEstimate, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&rows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return TaskCostEstimateResp{
+		PageResp: page.PageResp{
+			Total:    p.MustTotal(),
+			PageSize: p.Size,
+			List:     rows,
+		},
+		CostEstimated:    task.CostEstimated,
+		MonthlyCost:      task.MonthlyCost,
+		MonthlyCostDelta: task.MonthlyCostDelta,
+	}, nil
+}
@@ -18,7 +18,6 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
-	"strings"
 	"time"
 
 	"github.com/robfig/cron/v3"
@@ -116,9 +115,56 @@ func createEnvCheck(c *ctx.ServiceContext, form *forms.CreateEnvForm) e.Error {
 		return e.New(e.TemplateKeyIdNotSet)
 	}
 
+	// 回滚任务自动审批等同于跳过审批，需要有审批权限
+	if form.RollbackAutoApprove {
+		if err := checkUserHasApprovalPerm(c); err != nil {
+			return e.AutoNew(err, e.PermissionDeny)
+		}
+	}
+
+	if err := services.ValidateEnvDeployWindows(form.DeployWindows); err != nil {
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := services.ValidateEnvProtection(form.Protection); err != nil {
+		return err
+	}
+	if err := services.ValidateStepTimeouts(form.StepTimeouts); err != nil {
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
 	return nil
 }
 
+// setDefaultValueFromCriticality prod 环境在未传入合规相关参数时默认开启合规检测，并在合规不通过时中止任务
+func setDefaultValueFromCriticality(form *forms.CreateEnvForm) {
+	if form.Criticality != models.EnvCriticalityProd {
+		return
+	}
+	if !form.HasKey("policyEnable") {
+		form.PolicyEnable = true
+	}
+	if !form.HasKey("stopOnViolation") {
+		form.StopOnViolation = true
+	}
+}
+
+// setDriftPolicyFromTpl 未传入时使用云模板设置的偏移检测、存活时间及自动审批默认值
+func setDriftPolicyFromTpl(form *forms.CreateEnvForm, tpl *models.Template) {
+	if !form.HasKey("ttl") && !form.HasKey("destroyAt") {
+		form.TTL = tpl.DefaultTTL
+	}
+	if !form.HasKey("autoApproval") {
+		form.AutoApproval = tpl.DefaultAutoApproval
+	}
+	// 偏移检测的参数需要一起使用，传入任意一个时都不使用云模板的设置
+	if tpl.DefaultCronDriftExpress != "" && !form.HasKey("openCronDrift") &&
+		!form.HasKey("cronDriftExpress") && !form.HasKey("autoRepairDrift") {
+		form.OpenCronDrift = true
+		form.CronDriftExpress = tpl.DefaultCronDriftExpress
+		form.AutoRepairDrift = tpl.DefaultAutoRepairDrift
+	}
+}
+
 func setDefaultValueFromTpl(form *forms.CreateEnvForm, tpl *models.Template, destroyAt *models.Time) e.Error {
 	if !form.HasKey("tfVarsFile") {
 		form.TfVarsFile = tpl.TfVarsFile
@@ -135,6 +181,7 @@ func setDefaultValueFromTpl(form *forms.CreateEnvForm, tpl *models.Template, des
 	if !form.HasKey("revision") {
 		form.Revision = tpl.RepoRevision
 	}
+	setDriftPolicyFromTpl(form, tpl)
 
 	if form.Timeout == 0 {
 		form.Timeout = common.DefaultTaskStepTimeout
@@ -156,10 +203,62 @@ func setDefaultValueFromTpl(form *forms.CreateEnvForm, tpl *models.Template, des
 	return nil
 }
 
-func getRunnerId(form *forms.CreateEnvForm) (string, e.Error) {
+// applyTplLaunchForm 按云模板的部署表单校验环境的 terraform 变量，补全默认值并移除隐藏字段的变量
+func applyTplLaunchForm(tpl *models.Template, form *forms.CreateEnvForm) e.Error {
+	if tpl.LaunchForm == nil {
+		return nil
+	}
+
+	values := make(map[string]string)
+	for _, v := range form.Variables {
+		if v.Type == consts.VarTypeTerraform {
+			values[v.Name] = v.Value
+		}
+	}
+	resolved, err := services.ResolveLaunchForm(tpl.LaunchForm, values)
+	if err != nil {
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
+	vars := make([]forms.Variable, 0, len(form.Variables))
+	for _, v := range form.Variables {
+		if v.Type == consts.VarTypeTerraform {
+			value, ok := resolved[v.Name]
+			if !ok {
+				continue
+			}
+			v.Value = value
+			delete(resolved, v.Name)
+		}
+		vars = append(vars, v)
+	}
+	// 剩余的为使用默认值填充的字段
+	names := make([]string, 0, len(resolved))
+	for name := range resolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		vars = append(vars, forms.Variable{
+			Scope: consts.ScopeEnv,
+			Type:  consts.VarTypeTerraform,
+			Name:  name,
+			Value: resolved[name],
+		})
+	}
+	form.Variables = vars
+	return nil
+}
+
+func getRunnerId(c *ctx.ServiceContext, form *forms.CreateEnvForm, tpl *models.Template) (string, e.Error) {
 	var runnerId string = form.RunnerId
 	if runnerId == "" {
-		rId, err := services.GetDefaultRunner()
+		// 未指定 runner 时按环境的 runner 标签及云模板的 runner 设置选择
+		rId, err := services.SelectRunnerId(tpl, services.RunnerAffinity{
+			OrgId:     c.OrgId,
+			ProjectId: c.ProjectId,
+			Tags:      form.RunnerTags,
+		})
 		if err != nil {
 			return "", err
 		}
@@ -172,12 +271,14 @@ func createEnvToDB(tx *db.Session, c *ctx.ServiceContext, form *forms.CreateEnvF
 	// 检查偏移检测参数
 	cronTaskType, err := GetCronTaskTypeAndCheckParam(form.CronDriftExpress, form.AutoRepairDrift, form.OpenCronDrift)
 	if err != nil {
+		_ = tx.Rollback()
 		return nil, err
 	}
 	// 如果定时任务存在，保存参数到表内容
 	if cronTaskType != "" {
 		nextTime, err := ParseCronpress(form.CronDriftExpress)
 		if err != nil {
+			_ = tx.Rollback()
 			return nil, err
 		}
 		envModel.NextDriftTaskTime = nextTime
@@ -186,6 +287,9 @@ func createEnvToDB(tx *db.Session, c *ctx.ServiceContext, form *forms.CreateEnvF
 	if err != nil && err.Code() == e.EnvAlreadyExists {
 		_ = tx.Rollback()
 		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	} else if err != nil && err.Code() == e.ProjectQuotaExceeded {
+		_ = tx.Rollback()
+		return nil, err
 	} else if err != nil {
 		_ = tx.Rollback()
 		c.Logger().Errorf("error creating env, err %s", err)
@@ -200,6 +304,7 @@ func handlerCreateEnvVars(tx *db.Session, c *ctx.ServiceContext, form *forms.Cre
 	// FIXME 未对变量组的变量进行处理
 	sampleVars, err := services.GetSampleValidVariables(tx, c.OrgId, c.ProjectId, env.TplId, env.Id, form.SampleVariables)
 	if err != nil {
+		_ = tx.Rollback()
 		return nil, nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
@@ -224,9 +329,10 @@ func handlerCreateEnvVars(tx *db.Session, c *ctx.ServiceContext, form *forms.Cre
 		return nil, nil, err
 	}
 
-	targets := make([]string, 0)
-	if len(strings.TrimSpace(form.Targets)) > 0 {
-		targets = strings.Split(strings.TrimSpace(form.Targets), ",")
+	targets := services.ParseTaskTargets(form.Targets)
+	if err := services.CheckTaskTargets(tx, env, form.TaskType, targets); err != nil {
+		_ = tx.Rollback()
+		return nil, nil, e.New(err.Code(), err, http.StatusBadRequest)
 	}
 
 	// 计算变量列表
@@ -260,6 +366,9 @@ func getCreateEnvTpl(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.
 		c.Logger().Errorf("error get template, err %s", err)
 		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
 	}
+	if tpl.Archived {
+		return nil, e.New(e.TemplateArchived, http.StatusBadRequest)
+	}
 
 	return tpl, nil
 }
@@ -268,11 +377,6 @@ func getCreateEnvTpl(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.
 func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDetail, e.Error) {
 	c.AddLogField("action", fmt.Sprintf("create env %s", form.Name))
 
-	err := createEnvCheck(c, form)
-	if err != nil {
-		return nil, err
-	}
-
 	// 检查模板
 	tpl, err := getCreateEnvTpl(c, form)
 	if err != nil {
@@ -287,6 +391,22 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 	if err != nil {
 		return nil, err
 	}
+	setDefaultValueFromCriticality(form)
+
+	// 使用补全默认值后的参数进行检查
+	err = createEnvCheck(c, form)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyTplLaunchForm(tpl, form); err != nil {
+		return nil, err
+	}
+
+	// runner 选择不需要事务，在开启事务前完成
+	runnerId, err := getRunnerId(c, form, tpl)
+	if err != nil {
+		return nil, err
+	}
 
 	tx := c.Tx()
 	defer func() {
@@ -296,11 +416,6 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		}
 	}()
 
-	runnerId, err := getRunnerId(form)
-	if err != nil {
-		return nil, err
-	}
-
 	envModel := models.Env{
 		OrgId:     c.OrgId,
 		ProjectId: c.ProjectId,
@@ -313,6 +428,8 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		OneTime:  form.OneTime,
 		Timeout:  form.Timeout,
 
+		RunnerTags: form.RunnerTags,
+
 		// 模板参数
 		TfVarsFile:   form.TfVarsFile,
 		PlayVarsFile: form.PlayVarsFile,
@@ -335,7 +452,18 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		AutoRepairDrift:  form.AutoRepairDrift,
 		CronDriftExpress: form.CronDriftExpress,
 		OpenCronDrift:    form.OpenCronDrift,
+		DriftMode:        utils.FirstValueStr(form.DriftMode, models.EnvDriftModeDetectOnly),
 		PolicyEnable:     form.PolicyEnable,
+		PlanScan:         form.PlanScan,
+		Criticality:      utils.FirstValueStr(form.Criticality, models.EnvCriticalityDev),
+
+		AutoRollback:        form.AutoRollback,
+		RollbackAutoApprove: form.RollbackAutoApprove,
+
+		DeployWindows: form.DeployWindows,
+		MonthlyBudget: form.MonthlyBudget,
+		StepTimeouts:  form.StepTimeouts,
+		Protection:    form.Protection,
 	}
 
 	env, err := createEnvToDB(tx, c, form, envModel)
@@ -375,9 +503,13 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 		Callback:  form.Callback,
 		Source:    taskSource,
 		SourceSys: taskSourceSys,
+		TicketId:  form.TicketId,
 	})
 
-	if err != nil {
+	if err != nil && err.Code() == e.EnvProtected {
+		_ = tx.Rollback()
+		return nil, err
+	} else if err != nil {
 		_ = tx.Rollback()
 		c.Logger().Errorf("error creating task, err %s", err)
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
@@ -414,6 +546,9 @@ func CreateEnv(c *ctx.ServiceContext, form *forms.CreateEnvForm) (*models.EnvDet
 	if err := vcsrv.SetWebhook(vcs, tpl.RepoId, token.Key, form.Triggers); err != nil {
 		c.Logger().Errorf("set webhook err :%v", err)
 	}
+	if err := services.MarkTemplateUsed(c.DB(), c.UserId, tpl.Id); err != nil {
+		c.Logger().Warnf("mark template used err: %v", err)
+	}
 	return &envDetail, nil
 }
 
@@ -477,6 +612,7 @@ func SearchEnv(c *ctx.ServiceContext, form *forms.SearchEnvForm) (interface{}, e
 		env.MergeTaskStatus()
 		PopulateLastTask(c.DB(), env)
 		env.PolicyStatus = models.PolicyStatusConversion(env.PolicyStatus, env.PolicyEnable)
+		env.AttestationOverdue = env.IsAttestationOverdue()
 	}
 
 	return page.PageResp{
@@ -576,6 +712,9 @@ func setUpdateEnvByForm(attrs models.Attrs, form *forms.UpdateEnvForm) {
 	if form.HasKey("runnerId") {
 		attrs["runner_id"] = form.RunnerId
 	}
+	if form.HasKey("runnerTags") {
+		attrs["runner_tags"] = models.StrSlice(form.RunnerTags)
+	}
 
 	if form.HasKey("retryAble") {
 		attrs["retryAble"] = form.RetryAble
@@ -592,6 +731,18 @@ func setUpdateEnvByForm(attrs models.Attrs, form *forms.UpdateEnvForm) {
 	if form.HasKey("policyEnable") {
 		attrs["policyEnable"] = form.PolicyEnable
 	}
+	if form.HasKey("planScan") {
+		attrs["planScan"] = form.PlanScan
+	}
+	if form.HasKey("criticality") {
+		attrs["criticality"] = form.Criticality
+	}
+	if form.HasKey("monthlyBudget") {
+		attrs["monthly_budget"] = form.MonthlyBudget
+	}
+	if form.HasKey("driftMode") {
+		attrs["drift_mode"] = utils.FirstValueStr(form.DriftMode, models.EnvDriftModeDetectOnly)
+	}
 }
 
 func setAndCheckUpdateEnvAutoApproval(c *ctx.ServiceContext, tx *db.Session, attrs models.Attrs, env *models.Env, form *forms.UpdateEnvForm) e.Error {
@@ -604,6 +755,68 @@ func setAndCheckUpdateEnvAutoApproval(c *ctx.ServiceContext, tx *db.Session, att
 		}
 		attrs["auto_approval"] = form.AutoApproval
 	}
+	if form.HasKey("autoRollback") {
+		attrs["auto_rollback"] = form.AutoRollback
+	}
+	if form.HasKey("rollbackAutoApprove") {
+		if form.RollbackAutoApprove && !env.RollbackAutoApprove {
+			if err := checkUserHasApprovalPerm(c); err != nil {
+				_ = tx.Rollback()
+				return e.AutoNew(err, e.PermissionDeny)
+			}
+		}
+		attrs["rollback_auto_approve"] = form.RollbackAutoApprove
+	}
+	return nil
+}
+
+func setAndCheckUpdateEnvDeployWindows(tx *db.Session, attrs models.Attrs, form *forms.UpdateEnvForm) e.Error {
+	if !form.HasKey("deployWindows") {
+		return nil
+	}
+	if err := services.ValidateEnvDeployWindows(form.DeployWindows); err != nil {
+		_ = tx.Rollback()
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	attrs["deploy_windows"] = form.DeployWindows
+	return nil
+}
+
+// checkUserCanChangeEnvProtection 修改环境保护规则需要项目管理员及以上权限
+func checkUserCanChangeEnvProtection(c *ctx.ServiceContext) e.Error {
+	if c.IsSuperAdmin ||
+		services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+		services.UserHasProjectRole(c.UserId, c.OrgId, c.ProjectId, consts.ProjectRoleManager) {
+		return nil
+	}
+	return e.New(e.PermissionDeny, fmt.Errorf("only project manager can change env protection"), http.StatusForbidden)
+}
+
+func setAndCheckUpdateEnvProtection(c *ctx.ServiceContext, tx *db.Session, attrs models.Attrs, form *forms.UpdateEnvForm) e.Error {
+	if !form.HasKey("protection") {
+		return nil
+	}
+	if err := services.ValidateEnvProtection(form.Protection); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := checkUserCanChangeEnvProtection(c); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	attrs["protection"] = form.Protection
+	return nil
+}
+
+func setAndCheckUpdateEnvStepTimeouts(tx *db.Session, attrs models.Attrs, form *forms.UpdateEnvForm) e.Error {
+	if !form.HasKey("stepTimeouts") {
+		return nil
+	}
+	if err := services.ValidateStepTimeouts(form.StepTimeouts); err != nil {
+		_ = tx.Rollback()
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	attrs["step_timeouts"] = form.StepTimeouts
 	return nil
 }
 
@@ -664,6 +877,28 @@ func setAndCheckUpdateEnvTriggers(c *ctx.ServiceContext, tx *db.Session, attrs m
 	return nil
 }
 
+func setAndCheckUpdateEnvAttestation(tx *db.Session, attrs models.Attrs, env *models.Env, form *forms.UpdateEnvForm) e.Error {
+	if form.HasKey("attestationBlock") {
+		attrs["attestation_block"] = form.AttestationBlock
+	}
+	if !form.HasKey("attestationInterval") || form.AttestationInterval == env.AttestationInterval {
+		return nil
+	}
+
+	attrs["attestation_interval"] = form.AttestationInterval
+	// 声明周期变更后，从最后一次声明(没有则从当前)开始重新计算截止时间
+	from := time.Now()
+	last := models.EnvAttestation{}
+	if err := services.SearchEnvAttestations(tx, env.Id).First(&last); err != nil && !e.IsRecordNotFound(err) {
+		_ = tx.Rollback()
+		return e.New(e.DBError, err)
+	} else if err == nil {
+		from = time.Time(last.CreatedAt)
+	}
+	attrs["attestation_due_at"] = services.NextAttestationDueAt(from, form.AttestationInterval)
+	return nil
+}
+
 func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs models.Attrs, env *models.Env, form *forms.UpdateEnvForm) e.Error {
 
 	if err := setAndCheckUpdateEnvAutoApproval(c, tx, attrs, env, form); err != nil {
@@ -678,6 +913,22 @@ func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs mod
 		return err
 	}
 
+	if err := setAndCheckUpdateEnvAttestation(tx, attrs, env, form); err != nil {
+		return err
+	}
+
+	if err := setAndCheckUpdateEnvDeployWindows(tx, attrs, form); err != nil {
+		return err
+	}
+
+	if err := setAndCheckUpdateEnvProtection(c, tx, attrs, form); err != nil {
+		return err
+	}
+
+	if err := setAndCheckUpdateEnvStepTimeouts(tx, attrs, form); err != nil {
+		return err
+	}
+
 	if form.HasKey("archived") {
 		if env.Status != models.EnvStatusInactive {
 			_ = tx.Rollback()
@@ -685,6 +936,13 @@ func setAndCheckUpdateEnvByForm(c *ctx.ServiceContext, tx *db.Session, attrs mod
 				fmt.Errorf("env can't be archive while env is %s", env.Status),
 				http.StatusBadRequest)
 		}
+		if env.Archived && !form.Archived {
+			// 恢复归档的环境同样受项目环境数量配额的限制
+			if err := services.CheckProjectEnvQuota(tx, env.ProjectId); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
 		attrs["archived"] = form.Archived
 	}
 
@@ -759,7 +1017,7 @@ func UpdateEnv(c *ctx.ServiceContext, form *forms.UpdateEnvForm) (*models.EnvDet
 	}
 
 	env.MergeTaskStatus()
-	detail := &models.EnvDetail{Env: *env}
+	detail := &models.EnvDetail{Env: *env, AttestationOverdue: env.IsAttestationOverdue()}
 	detail = PopulateLastTask(tx, detail)
 
 	if err := tx.Commit(); err != nil {
@@ -796,6 +1054,9 @@ func EnvDetail(c *ctx.ServiceContext, form forms.DetailEnvForm) (*models.EnvDeta
 		envDetail.PolicyGroup = append(envDetail.PolicyGroup, v.PolicyGroupId)
 	}
 	envDetail.PolicyStatus = models.PolicyStatusConversion(envDetail.PolicyStatus, envDetail.PolicyEnable)
+	envDetail.AttestationOverdue = envDetail.IsAttestationOverdue()
+	envDetail.TplChangeWarnings = envTplChangeWarnings(c, &envDetail.Env)
+	envDetail.TplDeprecationWarning = envTplDeprecationWarning(c, &envDetail.Env)
 
 	return envDetail, nil
 }
@@ -855,6 +1116,9 @@ func envTplCheck(tx *db.Session, orgId, tplId models.Id, lg logs.Logger) (*model
 	if tpl.Status == models.Disable {
 		return nil, e.New(e.TemplateDisabled, http.StatusBadRequest)
 	}
+	if tpl.Archived {
+		return nil, e.New(e.TemplateArchived, http.StatusBadRequest)
+	}
 
 	return tpl, nil
 }
@@ -877,6 +1141,9 @@ func setEnvByForm(env *models.Env, form *forms.DeployEnvForm) {
 	if form.HasKey("runnerId") {
 		env.RunnerId = form.RunnerId
 	}
+	if form.HasKey("runnerTags") {
+		env.RunnerTags = form.RunnerTags
+	}
 	if form.HasKey("timeout") {
 		env.Timeout = form.Timeout
 	}
@@ -905,6 +1172,9 @@ func setEnvByForm(env *models.Env, form *forms.DeployEnvForm) {
 	if form.HasKey("policyEnable") {
 		env.PolicyEnable = form.PolicyEnable
 	}
+	if form.HasKey("planScan") {
+		env.PlanScan = form.PlanScan
+	}
 }
 
 func setAndCheckEnvAutoApproval(c *ctx.ServiceContext, env *models.Env, form *forms.DeployEnvForm) e.Error {
@@ -916,6 +1186,17 @@ func setAndCheckEnvAutoApproval(c *ctx.ServiceContext, env *models.Env, form *fo
 		}
 		env.AutoApproval = form.AutoApproval
 	}
+	if form.HasKey("autoRollback") {
+		env.AutoRollback = form.AutoRollback
+	}
+	if form.HasKey("rollbackAutoApprove") {
+		if form.RollbackAutoApprove && !env.RollbackAutoApprove {
+			if err := checkUserHasApprovalPerm(c); err != nil {
+				return e.AutoNew(err, e.PermissionDeny)
+			}
+		}
+		env.RollbackAutoApprove = form.RollbackAutoApprove
+	}
 
 	return nil
 }
@@ -969,7 +1250,21 @@ func setAndCheckEnvCron(env *models.Env, form *forms.DeployEnvForm) e.Error {
 	if cronDriftParam.CronDriftExpress != nil {
 		env.CronDriftExpress = *cronDriftParam.CronDriftExpress
 	}
+	if form.HasKey("driftMode") {
+		env.DriftMode = utils.FirstValueStr(form.DriftMode, models.EnvDriftModeDetectOnly)
+	}
+
+	return nil
+}
 
+func setAndCheckEnvStepTimeouts(env *models.Env, form *forms.DeployEnvForm) e.Error {
+	if !form.HasKey("stepTimeouts") {
+		return nil
+	}
+	if err := services.ValidateStepTimeouts(form.StepTimeouts); err != nil {
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	env.StepTimeouts = form.StepTimeouts
 	return nil
 }
 
@@ -987,6 +1282,10 @@ func setAndCheckEnvByForm(c *ctx.ServiceContext, tx *db.Session, env *models.Env
 		return err
 	}
 
+	if err := setAndCheckEnvStepTimeouts(env, form); err != nil {
+		return err
+	}
+
 	if form.HasKey("variables") {
 		updateVarsForm := forms.UpdateObjectVarsForm{
 			Scope:     consts.ScopeEnv,
@@ -1041,6 +1340,27 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 		return nil, err
 	}
 
+	// 合规声明逾期检查
+	if err := services.CheckEnvAttestation(env, form.TaskType); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusForbidden)
+	}
+
+	// 环境锁定检查
+	if err := services.CheckEnvLock(env, form.TaskType, c.UserId); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusForbidden)
+	}
+
+	scheduledAt, err := parseTaskScheduledAt(form.TaskScheduleForm)
+	if err != nil {
+		return nil, err
+	}
+
+	// 部署冻结窗口检查
+	override, err := checkEnvFreezeWindow(c, tx, env, form.TaskType, form.FreezeOverrideForm)
+	if err != nil {
+		return nil, err
+	}
+
 	// 模板检查
 	tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
 	if err != nil {
@@ -1056,9 +1376,12 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 		return nil, err
 	}
 
-	targets := make([]string, 0)
-	if len(strings.TrimSpace(form.Targets)) > 0 {
-		targets = strings.Split(strings.TrimSpace(form.Targets), ",")
+	targets := services.ParseTaskTargets(form.Targets)
+	if err := services.CheckTaskTargets(tx, env, form.TaskType, targets); err != nil {
+		if err.Code() == e.DBError {
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
 	}
 
 	// 计算变量列表
@@ -1068,7 +1391,7 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 	}
 
 	// 创建任务
-	task, err := services.CreateTask(tx, tpl, env, models.Task{
+	pt := models.Task{
 		Name:            models.Task{}.GetTaskNameByType(form.TaskType),
 		Targets:         targets,
 		CreatorId:       c.UserId,
@@ -1082,18 +1405,36 @@ func envDeploy(c *ctx.ServiceContext, tx *db.Session, form *forms.DeployEnvForm)
 			StepTimeout: form.Timeout,
 			RunnerId:    env.RunnerId,
 		},
-	})
+	}
+	if override != nil {
+		pt.FreezeOverrideId = override.Id
+	}
+	pt.ScheduledAt = scheduledAt
+	pt.TicketId = form.TicketId
+	task, err := services.CreateTask(tx, tpl, env, pt)
 
-	if err != nil {
+	if err != nil && err.Code() == e.EnvProtected {
+		return nil, err
+	} else if err != nil {
 		c.Logger().Errorf("error creating task, err %s", err)
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
+	if override != nil {
+		override.TaskId = task.Id
+		if _, err := services.CreateFreezeOverride(tx, *override); err != nil {
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+	}
+
 	// Save() 调用会全量将结构体中的字段进行保存，即使字段为 zero value
 	if _, err := tx.Save(env); err != nil {
 		c.Logger().Errorf("error save env, err %s", err)
 		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
 	}
+	if err := services.MarkTemplateUsed(tx, c.UserId, tpl.Id); err != nil {
+		c.Logger().Warnf("mark template used err: %v", err)
+	}
 
 	env.MergeTaskStatus()
 	envDetail := &models.EnvDetail{
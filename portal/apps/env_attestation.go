@@ -0,0 +1,122 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+type EnvAttestationResp struct {
+	models.EnvAttestation
+	Attestor string `json:"attestor"` // 声明人姓名
+}
+
+// CreateEnvAttestation 环境负责人(环境创建人、项目管理者及审批者、组织管理员)确认环境当前的合规状态
+func CreateEnvAttestation(c *ctx.ServiceContext, form *forms.CreateEnvAttestationForm) (*models.EnvAttestation, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("attest env %s", form.Id))
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	env, err := services.GetEnvById(services.QueryWithOrgProject(tx, c.OrgId, c.ProjectId), form.Id)
+	if err != nil {
+		_ = tx.Rollback()
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if env.CreatorId != c.UserId {
+		if err := checkUserHasApprovalPerm(c); err != nil {
+			_ = tx.Rollback()
+			return nil, e.AutoNew(err, e.PermissionDeny)
+		}
+	}
+
+	attestation := &models.EnvAttestation{
+		OrgId:        env.OrgId,
+		ProjectId:    env.ProjectId,
+		EnvId:        env.Id,
+		AttestorId:   c.UserId,
+		Comment:      form.Comment,
+		PolicyStatus: common.PolicyStatusDisable,
+	}
+	// 记录声明时环境的合规状态
+	if env.PolicyEnable {
+		attestation.PolicyStatus = common.PolicyStatusEnable
+		if env.LastScanTaskId != "" {
+			scanTask, err := services.GetScanTaskById(tx, env.LastScanTaskId)
+			if err != nil && err.Code() != e.TaskNotExists {
+				_ = tx.Rollback()
+				return nil, err
+			} else if err == nil {
+				summary, err := services.CountPolicyResultByStatus(tx, scanTask.Id)
+				if err != nil {
+					_ = tx.Rollback()
+					return nil, err
+				}
+				attestation.ScanTaskId = scanTask.Id
+				attestation.PolicyStatus = models.PolicyStatusConversion(scanTask.PolicyStatus, env.PolicyEnable)
+				attestation.ComplianceScore = scanTask.ComplianceScore
+				attestation.Passed = summary[common.PolicyStatusPassed]
+				attestation.Violated = summary[common.PolicyStatusViolated]
+				attestation.Failed = summary[common.PolicyStatusFailed]
+				attestation.Suppressed = summary[common.PolicyStatusSuppressed]
+			}
+		}
+	}
+
+	if _, err := services.CreateEnvAttestation(tx, env, attestation); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	return attestation, nil
+}
+
+// SearchEnvAttestations 环境合规声明历史
+func SearchEnvAttestations(c *ctx.ServiceContext, form *forms.SearchEnvAttestationForm) (interface{}, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	if _, err := services.GetEnvById(services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId), form.Id); err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+
+	query := services.SearchEnvAttestations(c.DB(), form.Id).
+		Joins("left join iac_user as u on u.id = iac_env_attestation.attestor_id").
+		LazySelectAppend("iac_env_attestation.*", "u.name as attestor")
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	attestations := make([]*EnvAttestationResp, 0)
+	if err := p.Scan(&attestations); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     attestations,
+	}, nil
+}
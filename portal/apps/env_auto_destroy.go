@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SearchAutoDestroyEnvs 查询组织或项目下将要自动销毁的环境，请求未指定项目时查询整个组织
+func SearchAutoDestroyEnvs(c *ctx.ServiceContext, form *forms.SearchAutoDestroyEnvForm) (interface{}, e.Error) {
+	days := form.Days
+	if days == 0 {
+		days = 7
+	}
+	until := time.Now().Add(time.Duration(days) * 24 * time.Hour)
+	query := services.QueryAutoDestroyEvents(c.DB(), c.OrgId, c.ProjectId, until)
+
+	events := make([]*services.AutoDestroyEvent, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&events); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     events,
+	}, nil
+}
+
+// ExtendEnvAutoDestroy 延长环境的存活时间，未指定延长时间时按环境的 ttl 延长
+func ExtendEnvAutoDestroy(c *ctx.ServiceContext, form *forms.ExtendEnvAutoDestroyForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("extend env %s auto destroy %s", form.Id, form.Extend))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	extend := form.Extend
+	if extend == "" {
+		extend = env.TTL
+	}
+	d, er := services.ParseTTL(extend)
+	if extend == "" || er != nil || d <= 0 {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid extend duration '%s'", extend), http.StatusBadRequest)
+	}
+
+	env, err = services.ExtendEnvAutoDestroy(c.DB(), env, d)
+	if err != nil {
+		switch err.Code() {
+		case e.EnvAutoDestroyNotSet:
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		case e.EnvAutoDestroyStarted:
+			return nil, e.New(err.Code(), err, http.StatusConflict)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return env, nil
+}
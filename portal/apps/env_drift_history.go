@@ -0,0 +1,84 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"time"
+)
+
+const defaultDriftStatsDays = 30
+
+// driftSince 统计的开始时间，从 days 天前的零点开始
+func driftSince(days int) time.Time {
+	if days == 0 {
+		days = defaultDriftStatsDays
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1-days)
+}
+
+// SearchEnvDriftHistory 查询环境的资源偏移历史
+func SearchEnvDriftHistory(c *ctx.ServiceContext, form *forms.SearchEnvDriftHistoryForm) (interface{}, e.Error) {
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryDriftHistory(c.DB(), env.Id, driftSince(form.Days))
+	if form.Address != "" {
+		query = query.Where("address = ?", form.Address)
+	}
+	rows := make([]*models.ResourceDriftHistory, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&rows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     rows,
+	}, nil
+}
+
+type EnvDriftTrendResp struct {
+	Runs        int                           `json:"runs"`        // 统计时间内的偏移检测次数
+	DriftedRuns int                           `json:"driftedRuns"` // 统计时间内发现偏移的检测次数
+	Daily       []*services.DriftTrendItem    `json:"daily"`       // 每天的偏移检测统计
+	Resources   []*services.ResourceDriftStat `json:"resources"`   // 各资源的偏移次数，按偏移次数从多到少排序
+}
+
+// EnvDriftTrend 环境的偏移趋势，包括每天的检测及偏移次数和各资源的偏移频率
+func EnvDriftTrend(c *ctx.ServiceContext, form *forms.EnvDriftTrendForm) (*EnvDriftTrendResp, e.Error) {
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	since := driftSince(form.Days)
+	daily, err := services.EnvDriftTrend(c.DB(), env.Id, since)
+	if err != nil {
+		return nil, err
+	}
+	resources, err := services.ResourceDriftStats(c.DB(), env.Id, since)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &EnvDriftTrendResp{Daily: daily, Resources: resources}
+	for _, d := range daily {
+		resp.Runs += d.Runs
+		resp.DriftedRuns += d.DriftedRuns
+	}
+	return resp, nil
+}
+
+// EnvDriftStats 组织或项目下各环境的偏移频率，请求未指定项目时统计整个组织
+func EnvDriftStats(c *ctx.ServiceContext, form *forms.EnvDriftStatsForm) ([]*services.EnvDriftStat, e.Error) {
+	return services.EnvDriftStats(c.DB(), c.OrgId, c.ProjectId, driftSince(form.Days))
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ImportEnvResource 创建 terraform import 任务，将已有的云资源导入到环境中管理，
+// 导入后需要在云模板代码中添加对应的资源定义，否则下次部署时资源会被销毁
+func ImportEnvResource(c *ctx.ServiceContext, form *forms.ImportEnvResourceForm) (*models.Task, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("import resource %s to env %s", form.Address, form.Id))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	var task *models.Task
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		env, err := envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+		if err != nil {
+			return err
+		}
+		tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+		if err != nil {
+			return err
+		}
+
+		task, err = services.CreateImportTask(tx, tpl, env,
+			strings.TrimSpace(form.Address), strings.TrimSpace(form.ResourceId), c.UserId)
+		if err != nil {
+			c.Logger().Errorf("error creating import task, err %s", err)
+			switch err.Code() {
+			case e.TaskImportAddrInvalid, e.TaskImportNotSupported:
+				return e.New(err.Code(), err, http.StatusBadRequest)
+			case e.EnvLocked:
+				return e.New(err.Code(), err, http.StatusConflict)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+	return task, nil
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func getLockEnv(c *ctx.ServiceContext, id models.Id) (*models.Env, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	env, err := services.GetEnvById(services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId), id)
+	if err != nil {
+		if err.Code() == e.EnvNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return env, nil
+}
+
+// LockEnv 锁定环境，锁定期间其他用户不能发起 apply/destroy 任务
+func LockEnv(c *ctx.ServiceContext, form *forms.LockEnvForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("lock env %s", form.Id))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+	if err := services.LockEnv(c.DB(), env.Id, c.UserId, strings.TrimSpace(form.Reason)); err != nil {
+		if err.Code() == e.EnvLocked {
+			return nil, e.New(err.Code(), err, http.StatusConflict)
+		}
+		return nil, err
+	}
+	return services.GetEnvById(c.DB(), env.Id)
+}
+
+// UnlockEnv 解锁环境，其他用户锁定的环境只有项目管理员可以强制解锁
+func UnlockEnv(c *ctx.ServiceContext, form *forms.UnlockEnvForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("unlock env %s", form.Id))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !env.Locked {
+		return nil, e.New(e.EnvNotLocked, http.StatusBadRequest)
+	}
+	if env.LockedBy != c.UserId {
+		if !form.Force || !(c.IsSuperAdmin ||
+			services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) ||
+			services.UserHasProjectRole(c.UserId, c.OrgId, c.ProjectId, consts.ProjectRoleManager)) {
+			return nil, e.New(e.EnvLockedByOthers,
+				fmt.Errorf("env locked by %s", env.LockedBy), http.StatusForbidden)
+		}
+		c.Logger().Infof("env %s locked by %s force unlocked by %s", env.Id, env.LockedBy, c.UserId)
+	}
+	if err := services.UnlockEnv(c.DB(), env.Id); err != nil {
+		return nil, err
+	}
+	return services.GetEnvById(c.DB(), env.Id)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+const defaultOutputHistoryLimit = 20
+
+// checkOutputReveal 显示敏感 output 的值需要环境的 outputreveal 权限
+func checkOutputReveal(c *ctx.ServiceContext, reveal bool) e.Error {
+	if !reveal {
+		return nil
+	}
+	if err := enforceUserPerm(c, "envs", "outputreveal"); err != nil {
+		return e.New(err.Code(), err, http.StatusForbidden)
+	}
+	return nil
+}
+
+// EnvOutputs 环境最后一次部署的 terraform outputs，默认隐藏敏感 output 的值
+func EnvOutputs(c *ctx.ServiceContext, form *forms.EnvOutputsForm) ([]*services.EnvOutput, e.Error) {
+	if err := checkOutputReveal(c, form.Reveal); err != nil {
+		return nil, err
+	}
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if form.Reveal {
+		c.AddLogField("action", fmt.Sprintf("reveal env %s outputs", env.Id))
+	}
+
+	// 无资源变更
+	if env.LastResTaskId == "" {
+		return make([]*services.EnvOutput, 0), nil
+	}
+	task, err := services.GetTaskById(c.DB(), env.LastResTaskId)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return services.EnvOutputList(services.ParseTaskOutputs(task.Result.Outputs), form.Reveal), nil
+}
+
+// EnvOutputHistory 环境最近多次部署引起的 output 值变化
+func EnvOutputHistory(c *ctx.ServiceContext, form *forms.EnvOutputHistoryForm) ([]*services.OutputChange, e.Error) {
+	if err := checkOutputReveal(c, form.Reveal); err != nil {
+		return nil, err
+	}
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if form.Reveal {
+		c.AddLogField("action", fmt.Sprintf("reveal env %s output history", env.Id))
+	}
+
+	limit := form.Limit
+	if limit == 0 {
+		limit = defaultOutputHistoryLimit
+	}
+	return services.EnvOutputHistory(c.DB(), env.Id, limit, form.Name, form.Reveal)
+}
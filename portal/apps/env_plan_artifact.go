@@ -0,0 +1,143 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func getEnvPlanArtifact(c *ctx.ServiceContext, envId models.Id, id models.Id) (*models.EnvPlanArtifact, e.Error) {
+	a, err := services.GetEnvPlanArtifact(c.DB(), envId, id)
+	if err != nil {
+		if err.Code() == e.EnvPlanNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return a, nil
+}
+
+// SearchEnvPlanArtifacts 查询环境的 plan 产物
+func SearchEnvPlanArtifacts(c *ctx.ServiceContext, form *forms.SearchEnvPlanArtifactForm) (interface{}, e.Error) {
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make([]*models.EnvPlanArtifact, 0)
+	query := services.QueryEnvPlanArtifacts(c.DB(), env.Id).Order("created_at DESC")
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&artifacts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     artifacts,
+	}, nil
+}
+
+// DownloadEnvPlanArtifact 下载 plan 产物，二进制 plan 文件中包含变量的明文值，下载操作记录审计日志
+func DownloadEnvPlanArtifact(c *ctx.ServiceContext, form *forms.DownloadEnvPlanArtifactForm) ([]byte, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("download env %s plan %s", form.Id, form.PlanId))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	artifact, err := getEnvPlanArtifact(c, env.Id, form.PlanId)
+	if err != nil {
+		return nil, err
+	}
+	content, err := services.ReadPlanArtifact(artifact, form.Format == "binary")
+	if err != nil {
+		if err.Code() == e.EnvPlanNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+
+	insertEnvStateOperationLog(c, "downloadPlan", fmt.Sprintf("下载了环境%s的plan", env.Name), map[string]interface{}{
+		"orgId":     env.OrgId,
+		"projectId": env.ProjectId,
+		"envId":     env.Id,
+		"planId":    artifact.Id,
+		"taskId":    artifact.TaskId,
+		"format":    form.Format,
+	})
+	return content, nil
+}
+
+// ApplyEnvPlanArtifact 执行已保存的 plan，只有 plan 之后环境资源没有发生变更时才能执行，每个 plan 只能执行一次
+func ApplyEnvPlanArtifact(c *ctx.ServiceContext, form *forms.ApplyEnvPlanArtifactForm) (*models.Task, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("apply env %s plan %s", form.Id, form.PlanId))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	var task *models.Task
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		env, err := envCheck(tx, c.OrgId, c.ProjectId, form.Id, c.Logger())
+		if err != nil {
+			return err
+		}
+		if err := services.CheckEnvAttestation(env, models.TaskTypeApply); err != nil {
+			return e.New(err.Code(), err, http.StatusForbidden)
+		}
+		if err := services.CheckEnvLock(env, models.TaskTypeApply, c.UserId); err != nil {
+			return e.New(err.Code(), err, http.StatusForbidden)
+		}
+		override, err := checkEnvFreezeWindow(c, tx, env, models.TaskTypeApply, form.FreezeOverrideForm)
+		if err != nil {
+			return err
+		}
+		tpl, err := envTplCheck(tx, c.OrgId, env.TplId, c.Logger())
+		if err != nil {
+			return err
+		}
+		artifact, err := services.GetEnvPlanArtifact(tx, env.Id, form.PlanId)
+		if err != nil {
+			if err.Code() == e.EnvPlanNotExists {
+				return e.New(err.Code(), err, http.StatusNotFound)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+
+		pt := models.Task{CreatorId: c.UserId, TicketId: form.TicketId}
+		if override != nil {
+			pt.FreezeOverrideId = override.Id
+		}
+		task, err = services.CreateApplySavedPlanTask(tx, tpl, env, artifact, pt)
+		if err != nil {
+			c.Logger().Errorf("error creating apply saved plan task, err %s", err)
+			switch err.Code() {
+			case e.EnvPlanApplied, e.EnvPlanStale:
+				return e.New(err.Code(), err, http.StatusConflict)
+			case e.EnvProtected:
+				return err
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+
+		if override != nil {
+			override.TaskId = task.Id
+			if _, err := services.CreateFreezeOverride(tx, *override); err != nil {
+				return e.New(err.Code(), err, http.StatusInternalServerError)
+			}
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+	return task, nil
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// EnvPromotionResp 晋级结果，包含晋级记录及目标环境的部署任务
+type EnvPromotionResp struct {
+	models.EnvPromotion
+
+	Task *models.Task `json:"task"`
+}
+
+func getProjectPromotionChain(c *ctx.ServiceContext, id models.Id) (*models.PromotionChain, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	chain, err := services.GetPromotionChainById(query, id)
+	if err != nil {
+		if err.Code() == e.PromotionChainNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return chain, nil
+}
+
+func promotionStages(ids []models.Id) models.StrSlice {
+	stages := make(models.StrSlice, 0, len(ids))
+	for _, id := range ids {
+		stages = append(stages, string(id))
+	}
+	return stages
+}
+
+// CreatePromotionChain 创建环境晋级链
+func CreatePromotionChain(c *ctx.ServiceContext, form *forms.CreatePromotionChainForm) (*models.PromotionChain, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create promotion chain %s", form.Name))
+
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	chain := models.PromotionChain{
+		OrgId:     c.OrgId,
+		ProjectId: c.ProjectId,
+		CreatorId: c.UserId,
+		Name:      form.Name,
+		Stages:    promotionStages(form.Stages),
+	}
+	if err := services.ValidatePromotionChain(c.DB(), &chain); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	chain.Id = chain.NewId()
+	if err := models.Create(c.DB(), &chain); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &chain, nil
+}
+
+// SearchPromotionChain 查询项目的环境晋级链
+func SearchPromotionChain(c *ctx.ServiceContext, form *forms.SearchPromotionChainForm) (interface{}, e.Error) {
+	query := services.QueryPromotionChain(services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId))
+	if form.Q != "" {
+		query = query.WhereLike("name", form.Q)
+	}
+	if form.EnvId != "" {
+		// stages 为 json 数组，匹配带引号的环境 id
+		query = query.WhereLike("stages", fmt.Sprintf("%q", form.EnvId))
+	}
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	}
+	return getPage(query, form, models.PromotionChain{})
+}
+
+func PromotionChainDetail(c *ctx.ServiceContext, form *forms.DetailPromotionChainForm) (*models.PromotionChain, e.Error) {
+	return getProjectPromotionChain(c, form.Id)
+}
+
+// UpdatePromotionChain 修改环境晋级链，修改阶段后需要重新校验各阶段的环境
+func UpdatePromotionChain(c *ctx.ServiceContext, form *forms.UpdatePromotionChainForm) (*models.PromotionChain, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update promotion chain %s", form.Id))
+
+	chain, err := getProjectPromotionChain(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("stages") {
+		chain.Stages = promotionStages(form.Stages)
+		if err := services.ValidatePromotionChain(c.DB(), chain); err != nil {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		attrs["stages"] = chain.Stages
+		attrs["tpl_id"] = chain.TplId
+	}
+	if _, err := models.UpdateAttr(c.DB().Where("id = ?", chain.Id), &models.PromotionChain{}, attrs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return getProjectPromotionChain(c, chain.Id)
+}
+
+func DeletePromotionChain(c *ctx.ServiceContext, form *forms.DeletePromotionChainForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete promotion chain %s", form.Id))
+
+	if _, err := getProjectPromotionChain(c, form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeletePromotionChain(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// PromoteEnv 将来源环境部署成功的 commit 晋级部署到晋级链的下一阶段环境
+func PromoteEnv(c *ctx.ServiceContext, form *forms.PromoteEnvForm) (*EnvPromotionResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("promote env %s in chain %s", form.FromEnvId, form.Id))
+
+	chain, err := getProjectPromotionChain(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	toEnvId, err := services.PromotionTargetEnvId(chain, form.FromEnvId)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
+	overrides := make([]models.VariableBody, 0, len(form.Variables))
+	for _, v := range form.Variables {
+		if v.Name == "" {
+			return nil, e.New(e.EmptyVarName, http.StatusBadRequest)
+		}
+		overrides = append(overrides, models.VariableBody{
+			Type:        v.Type,
+			Name:        v.Name,
+			Value:       v.Value,
+			Sensitive:   v.Sensitive,
+			Description: v.Description,
+		})
+	}
+
+	resp := &EnvPromotionResp{}
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		fromTask, err := services.GetPromotionSourceTask(tx, form.FromEnvId, form.TaskId)
+		if err != nil {
+			if err.Code() == e.PromotionTaskInvalid || err.Code() == e.TaskNotExists {
+				return e.New(err.Code(), err, http.StatusBadRequest)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		toEnv, err := envCheck(tx, c.OrgId, c.ProjectId, toEnvId, c.Logger())
+		if err != nil {
+			return err
+		}
+		if toEnv.Archived {
+			return e.New(e.EnvArchived, http.StatusBadRequest)
+		}
+		if err := services.CheckEnvAttestation(toEnv, models.TaskTypeApply); err != nil {
+			return e.New(err.Code(), err, http.StatusForbidden)
+		}
+		if err := services.CheckEnvLock(toEnv, models.TaskTypeApply, c.UserId); err != nil {
+			return e.New(err.Code(), err, http.StatusForbidden)
+		}
+		override, err := checkEnvFreezeWindow(c, tx, toEnv, models.TaskTypeApply, form.FreezeOverrideForm)
+		if err != nil {
+			return err
+		}
+
+		pt := models.Task{CreatorId: c.UserId, TicketId: form.TicketId}
+		if override != nil {
+			pt.FreezeOverrideId = override.Id
+		}
+		promotion, task, err := services.PromoteEnv(tx, chain, fromTask, toEnv, overrides, pt)
+		if err != nil {
+			if err.Code() == e.EnvProtected {
+				return err
+			}
+			c.Logger().Errorf("error creating promotion task, err %s", err)
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		if override != nil {
+			override.TaskId = task.Id
+			if _, err := services.CreateFreezeOverride(tx, *override); err != nil {
+				return e.New(err.Code(), err, http.StatusInternalServerError)
+			}
+		}
+		resp.EnvPromotion, resp.Task = *promotion, task
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+	return resp, nil
+}
+
+// SearchEnvPromotion 查询晋级链的晋级记录
+func SearchEnvPromotion(c *ctx.ServiceContext, form *forms.SearchEnvPromotionForm) (interface{}, e.Error) {
+	chain, err := getProjectPromotionChain(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	query := services.QueryEnvPromotions(c.DB(), chain.Id).Order("created_at DESC")
+	promotions := make([]*models.EnvPromotion, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&promotions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     promotions,
+	}, nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+)
+
+type EnvSnapshotResp struct {
+	At    time.Time `json:"at" example:"2006-01-02T15:04:05Z07:00"` // 查询的时间点
+	EnvId models.Id `json:"envId" example:"env-c3lcrjxczjdywmk0go90"`
+	// 该时间点环境的状态，active: 已部署，inactive: 已销毁或未部署
+	Status string `json:"status" enums:"active,inactive" example:"active"`
+
+	Deployment *EnvSnapshotDeployment `json:"deployment"` // 该时间点生效的部署任务，未部署时为空
+	Variables  models.TaskVariables   `json:"variables"`  // 部署使用的变量快照，敏感变量的值不返回
+	Resources  []services.Resource    `json:"resources"`  // 部署任务记录的资源列表
+	Compliance *EnvSnapshotCompliance `json:"compliance"` // 该时间点最近一次合规扫描结果，未扫描时为空
+}
+
+type EnvSnapshotDeployment struct {
+	TaskId       models.Id    `json:"taskId" example:"run-c3lcrjxczjdywmk0go90"`
+	TaskType     string       `json:"taskType" enums:"apply,destroy"`
+	TaskStatus   string       `json:"taskStatus" enums:"complete,failed"`
+	CreatorId    models.Id    `json:"creatorId"`
+	EndAt        *models.Time `json:"endAt"`
+	TplId        models.Id    `json:"tplId"`
+	Revision     string       `json:"revision" example:"master"` // 模板的分支/标签
+	CommitId     string       `json:"commitId"`
+	Workdir      string       `json:"workdir"`
+	TfVersion    string       `json:"tfVersion"`
+	EngineType   string       `json:"engineType"`
+	TfVarsFile   string       `json:"tfVarsFile"`
+	Playbook     string       `json:"playbook"`
+	PlayVarsFile string       `json:"playVarsFile"`
+}
+
+type EnvSnapshotCompliance struct {
+	ScanTaskId   models.Id      `json:"scanTaskId"`
+	PolicyStatus string         `json:"policyStatus" enums:"passed,violated"`
+	ScanAt       *models.Time   `json:"scanAt"`
+	Summary      map[string]int `json:"summary" example:"passed:10,violated:2"` // 各状态的策略检查结果数量
+}
+
+// EnvSnapshot 还原环境在指定时间点的配置，包括模板版本、变量快照、资源列表及合规状态
+func EnvSnapshot(c *ctx.ServiceContext, form *forms.EnvSnapshotForm) (*EnvSnapshotResp, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" || form.Id == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+
+	query := services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId)
+	env, err := services.GetEnvById(query, form.Id)
+	if err != nil && err.Code() == e.EnvNotExists {
+		return nil, e.New(err.Code(), err, http.StatusNotFound)
+	} else if err != nil {
+		c.Logger().Errorf("error get env, err %s", err)
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+
+	resp := &EnvSnapshotResp{
+		At:        form.At,
+		EnvId:     env.Id,
+		Status:    models.EnvStatusInactive,
+		Variables: models.TaskVariables{},
+		Resources: make([]services.Resource, 0),
+	}
+
+	task, err := services.GetEnvEffectTaskAt(query, env.Id, form.At)
+	if err != nil && err.Code() != e.TaskNotExists {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	} else if err == nil {
+		resp.Deployment = &EnvSnapshotDeployment{
+			TaskId:       task.Id,
+			TaskType:     task.Type,
+			TaskStatus:   task.Status,
+			CreatorId:    task.CreatorId,
+			EndAt:        task.EndAt,
+			TplId:        task.TplId,
+			Revision:     task.Revision,
+			CommitId:     task.CommitId,
+			Workdir:      task.Workdir,
+			TfVersion:    task.TfVersion,
+			EngineType:   task.EngineType,
+			TfVarsFile:   task.TfVarsFile,
+			Playbook:     task.Playbook,
+			PlayVarsFile: task.PlayVarsFile,
+		}
+		if task.Type != common.TaskTypeDestroy {
+			resp.Status = models.EnvStatusActive
+		}
+
+		for _, v := range task.Variables {
+			if v.Sensitive {
+				v.Value = ""
+			}
+			resp.Variables = append(resp.Variables, v)
+		}
+		sort.Sort(resp.Variables)
+
+		rs, err := services.GetTaskResourceToTaskId(c.DB(), task)
+		if err != nil {
+			return nil, err
+		}
+		for i := range rs {
+			rs[i].Provider = path.Base(rs[i].Provider)
+			// 资源属性通过资源详情接口查询
+			rs[i].Attrs = nil
+		}
+		resp.Resources = rs
+	}
+
+	scanTask, err := services.GetEnvScanTaskAt(query, env.Id, form.At)
+	if err != nil && err.Code() != e.TaskNotExists {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	} else if err == nil {
+		summary, err := services.CountPolicyResultByStatus(c.DB(), scanTask.Id)
+		if err != nil {
+			return nil, err
+		}
+		resp.Compliance = &EnvSnapshotCompliance{
+			ScanTaskId:   scanTask.Id,
+			PolicyStatus: scanTask.PolicyStatus,
+			ScanAt:       scanTask.EndAt,
+			Summary:      summary,
+		}
+	}
+	return resp, nil
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// ExportEnvState 导出环境当前的 terraform state，state 中可能包含敏感信息，导出操作记录审计日志
+func ExportEnvState(c *ctx.ServiceContext, form *forms.ExportEnvStateForm) ([]byte, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("export env %s state", form.Id))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	statePath := (&models.TaskStep{Workdir: form.Workdir}).StatePath(env.StatePath)
+	content, err := services.ReadTfState(statePath)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if len(content) == 0 {
+		return nil, e.New(e.EnvStateNotExists, http.StatusNotFound)
+	}
+
+	insertEnvStateOperationLog(c, "exportState", fmt.Sprintf("导出了环境%s的state", env.Name), map[string]interface{}{
+		"orgId":     env.OrgId,
+		"projectId": env.ProjectId,
+		"envId":     env.Id,
+		"workdir":   form.Workdir,
+	})
+	return content, nil
+}
+
+// ImportEnvState 将外部管理的 terraform state 导入到未部署过的环境，用于将已有资源迁移到 cloudiac 管理。
+// 导入后环境状态为 active，资源列表基于导入的 state 生成，建议导入后执行 plan 确认代码与资源是否一致
+func ImportEnvState(c *ctx.ServiceContext, form *forms.ImportEnvStateForm) (*models.Task, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("import env %s state", form.Id))
+
+	if len(form.Data) == 0 {
+		return nil, e.New(e.BadParam, fmt.Errorf("state data is empty"), http.StatusBadRequest)
+	}
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+	if env.Deploying {
+		return nil, e.New(e.EnvDeploying, http.StatusConflict)
+	}
+	if env.Locked && env.LockedBy != c.UserId {
+		return nil, e.New(e.EnvLocked, fmt.Errorf("env locked by %s", env.LockedBy), http.StatusConflict)
+	}
+	if env.LastTaskId != "" || env.Status != models.EnvStatusInactive {
+		return nil, e.New(e.EnvStateImportForbidden, fmt.Errorf("env has been deployed"), http.StatusConflict)
+	}
+	tpl, err := services.GetTemplateById(c.DB(), env.TplId)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if len(tpl.Workdirs) > 0 {
+		return nil, e.New(e.EnvStateImportForbidden,
+			fmt.Errorf("env of multi-workdir template does not support state import"), http.StatusBadRequest)
+	}
+	current, err := services.ReadTfState(env.StatePath)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if len(current) > 0 {
+		return nil, e.New(e.EnvStateImportForbidden, fmt.Errorf("env state already exists"), http.StatusConflict)
+	}
+
+	var task *models.Task
+	if er := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		task, err = services.ImportEnvState(tx, tpl, env, form.Data, c.UserId)
+		if err != nil {
+			return err
+		}
+		return nil
+	}); er != nil {
+		if err, ok := er.(e.Error); ok {
+			switch err.Code() {
+			case e.EnvStateInvalid:
+				return nil, e.New(err.Code(), err, http.StatusBadRequest)
+			case e.EnvDeploying:
+				return nil, e.New(err.Code(), err, http.StatusConflict)
+			}
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil, e.New(e.DBError, er, http.StatusInternalServerError)
+	}
+
+	insertEnvStateOperationLog(c, "importState", fmt.Sprintf("导入了环境%s的state", env.Name), map[string]interface{}{
+		"orgId":     env.OrgId,
+		"projectId": env.ProjectId,
+		"envId":     env.Id,
+		"taskId":    task.Id,
+		"resources": task.Result.ResAdded,
+	})
+	return task, nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EnvStateVersionDiff 两个 state 版本间的资源差异
+type EnvStateVersionDiff struct {
+	From *models.EnvStateVersion `json:"from"`
+	To   *models.EnvStateVersion `json:"to"`
+	*services.StateVersionDiff
+}
+
+// EnvStateRestoreResult 恢复 state 版本的结果
+type EnvStateRestoreResult struct {
+	Backup   *models.EnvStateVersion `json:"backup"`   // 恢复前当前 state 的备份，当前 state 已有相同内容的版本时为空
+	Restored *models.EnvStateVersion `json:"restored"` // 恢复后的 state 版本
+}
+
+func getEnvStateVersion(c *ctx.ServiceContext, envId models.Id, version int) (*models.EnvStateVersion, e.Error) {
+	v, err := services.GetEnvStateVersion(c.DB(), envId, version)
+	if err != nil {
+		if err.Code() == e.EnvStateVersionNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return v, nil
+}
+
+// SearchEnvStateVersions 查询环境的 state 历史版本
+func SearchEnvStateVersions(c *ctx.ServiceContext, form *forms.SearchEnvStateVersionForm) (interface{}, e.Error) {
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryEnvStateVersions(c.DB(), env.Id)
+	if form.HasKey("workdir") {
+		query = query.Where("workdir = ?", form.Workdir)
+	}
+	versions := make([]*models.EnvStateVersion, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query.Order("version DESC"))
+	if err := p.Scan(&versions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     versions,
+	}, nil
+}
+
+// DiffEnvStateVersions 比较环境两个 state 版本中的资源
+func DiffEnvStateVersions(c *ctx.ServiceContext, form *forms.DiffEnvStateVersionForm) (*EnvStateVersionDiff, e.Error) {
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]*services.RawTfState, 0, 2)
+	versions := make([]*models.EnvStateVersion, 0, 2)
+	for _, ver := range []int{form.From, form.To} {
+		v, err := getEnvStateVersion(c, env.Id, ver)
+		if err != nil {
+			return nil, err
+		}
+		content, err := services.ReadEnvStateVersion(v)
+		if err != nil {
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		state, er := services.ParseRawTfState(content)
+		if er != nil {
+			return nil, e.New(e.EnvStateInvalid, er, http.StatusInternalServerError)
+		}
+		states = append(states, state)
+		versions = append(versions, v)
+	}
+
+	return &EnvStateVersionDiff{
+		From:             versions[0],
+		To:               versions[1],
+		StateVersionDiff: services.DiffStateResources(states[0], states[1]),
+	}, nil
+}
+
+// RestoreEnvStateVersion 将环境的 state 恢复为历史版本，用于部署失败或 state 被误修改后的恢复。
+// 恢复只修改 state，不会变更实际资源，恢复后需要重新执行 plan 确认资源与 state 是否一致
+func RestoreEnvStateVersion(c *ctx.ServiceContext, form *forms.RestoreEnvStateVersionForm) (*EnvStateRestoreResult, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("restore env %s state version %d", form.Id, form.Version))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+	if env.Deploying {
+		return nil, e.New(e.EnvDeploying, http.StatusConflict)
+	}
+	if env.Locked && env.LockedBy != c.UserId {
+		return nil, e.New(e.EnvLocked, fmt.Errorf("env locked by %s", env.LockedBy), http.StatusConflict)
+	}
+	target, err := getEnvStateVersion(c, env.Id, form.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	reason := strings.TrimSpace(form.Reason)
+	result := &EnvStateRestoreResult{}
+	if er := c.DB().Transaction(func(tx *db.Session) error {
+		backup, restored, err := services.RestoreEnvStateVersion(tx, target, c.UserId, reason)
+		if err != nil {
+			return err
+		}
+		result.Backup, result.Restored = backup, restored
+		return nil
+	}); er != nil {
+		if err, ok := er.(e.Error); ok {
+			if err.Code() == e.EnvDeploying {
+				return nil, e.New(err.Code(), err, http.StatusConflict)
+			}
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil, e.New(e.DBError, er, http.StatusInternalServerError)
+	}
+
+	desc := map[string]interface{}{
+		"orgId":       env.OrgId,
+		"projectId":   env.ProjectId,
+		"envId":       env.Id,
+		"workdir":     target.Workdir,
+		"fromVersion": target.Version,
+		"fromSerial":  target.Serial,
+		"restoredId":  result.Restored.Id,
+		"restoredVer": result.Restored.Version,
+		"reason":      reason,
+	}
+	if result.Backup != nil {
+		desc["backupId"] = result.Backup.Id
+		desc["backupVer"] = result.Backup.Version
+	}
+	insertEnvStateOperationLog(c, "restoreState", fmt.Sprintf("恢复了环境%s的state到版本%d", env.Name, target.Version), desc)
+	c.Logger().Infof("env %s state restored to version %d by %s, reason: %s", env.Id, target.Version, c.UserId, reason)
+	return result, nil
+}
+
+// insertEnvStateOperationLog 记录 state 恢复、导入、导出及 plan 下载等操作的审计日志
+func insertEnvStateOperationLog(c *ctx.ServiceContext, typ string, info string, desc map[string]interface{}) {
+	bs, _ := json.Marshal(desc)
+	opLog := models.OperationLog{
+		UserID:        c.UserId,
+		Username:      c.Username,
+		UserAddr:      c.UserIpAddr,
+		OperationAt:   models.Time(time.Now()),
+		OperationType: typ,
+		OperationInfo: info,
+		Desc:          models.JSON(bs),
+	}
+	if err := opLog.InsertLog(); err != nil {
+		c.Logger().Errorf("insert %s operation log: %v", typ, err)
+	}
+}
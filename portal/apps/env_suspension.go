@@ -0,0 +1,91 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// SuspendEnvJobs 暂停环境的自动销毁、偏移检测及自动部署等定时任务
+func SuspendEnvJobs(c *ctx.ServiceContext, form *forms.SuspendEnvJobsForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("suspend env %s jobs %v", form.Id, form.Jobs))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if env.Archived {
+		return nil, e.New(e.EnvArchived, http.StatusBadRequest)
+	}
+
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		env, err = services.SuspendEnvJobs(tx, env, form.Jobs, form.Reason, c.UserId, form.Until)
+		if err != nil {
+			switch err.Code() {
+			case e.EnvSuspendJobInvalid, e.BadParam:
+				return e.New(err.Code(), err, http.StatusBadRequest)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+	return env, nil
+}
+
+// ResumeEnvJobs 恢复环境暂停的定时任务
+func ResumeEnvJobs(c *ctx.ServiceContext, form *forms.ResumeEnvJobsForm) (*models.Env, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("resume env %s jobs %v", form.Id, form.Jobs))
+
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	er := c.DB().Transaction(func(tx *db.Session) error {
+		var err e.Error
+		env, err = services.ResumeEnvJobs(tx, env, form.Jobs, c.UserId)
+		if err != nil {
+			if err.Code() == e.EnvSuspendJobInvalid {
+				return e.New(err.Code(), err, http.StatusBadRequest)
+			}
+			return e.New(err.Code(), err, http.StatusInternalServerError)
+		}
+		return nil
+	})
+	if er != nil {
+		return nil, e.AutoNew(er, e.DBError)
+	}
+	return env, nil
+}
+
+// SearchEnvSuspensions 查询环境定时任务的暂停记录
+func SearchEnvSuspensions(c *ctx.ServiceContext, form *forms.SearchEnvSuspensionForm) (interface{}, e.Error) {
+	env, err := getLockEnv(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	suspensions := make([]*models.EnvSuspension, 0)
+	query := services.QueryEnvSuspensions(c.DB(), env.Id).Order("created_at DESC")
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&suspensions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     suspensions,
+	}, nil
+}
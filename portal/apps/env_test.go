@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"net/url"
+	"testing"
+)
+
+func TestSetDriftPolicyFromTpl(t *testing.T) {
+	tpl := &models.Template{
+		DefaultCronDriftExpress: "*/30 * * * *",
+		DefaultAutoRepairDrift:  true,
+		DefaultTTL:              "1d",
+		DefaultAutoApproval:     true,
+	}
+
+	form := &forms.CreateEnvForm{}
+	form.Bind(url.Values{})
+	setDriftPolicyFromTpl(form, tpl)
+	if !form.OpenCronDrift || form.CronDriftExpress != tpl.DefaultCronDriftExpress || !form.AutoRepairDrift {
+		t.Errorf("drift policy not inherited: %+v", form)
+	}
+	if form.TTL != "1d" || !form.AutoApproval {
+		t.Errorf("ttl or auto approval not inherited: ttl=%s autoApproval=%v", form.TTL, form.AutoApproval)
+	}
+
+	// 环境传入的参数即使为零值也覆盖云模板的设置
+	form = &forms.CreateEnvForm{}
+	form.Bind(url.Values{"openCronDrift": {"false"}, "ttl": {""}, "autoApproval": {"false"}})
+	setDriftPolicyFromTpl(form, tpl)
+	if form.OpenCronDrift || form.CronDriftExpress != "" || form.AutoRepairDrift {
+		t.Errorf("drift policy should not be inherited: %+v", form)
+	}
+	if form.TTL != "" || form.AutoApproval {
+		t.Errorf("ttl or auto approval should not be inherited: ttl=%s autoApproval=%v", form.TTL, form.AutoApproval)
+	}
+
+	form = &forms.CreateEnvForm{}
+	form.DestroyAt = "2022-01-01 00:00"
+	form.Bind(url.Values{"destroyAt": {"2022-01-01 00:00"}})
+	setDriftPolicyFromTpl(form, tpl)
+	if form.TTL != "" {
+		t.Errorf("ttl should not be inherited when destroyAt is set, got %s", form.TTL)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+)
+
+// FleetDeployEnv 批量部署选中的环境
+type FleetDeployEnv struct {
+	EnvId       models.Id `json:"envId"`
+	EnvName     string    `json:"envName"`
+	ProjectId   models.Id `json:"projectId"`
+	TplId       models.Id `json:"tplId"`
+	Criticality string    `json:"criticality"`
+}
+
+// CreateFleetDeploy 创建批量部署，task manager 按并发数依次为选中的环境创建部署任务。
+// dryRun 时只返回会被部署的环境(按部署顺序)
+func CreateFleetDeploy(c *ctx.ServiceContext, form *forms.CreateFleetDeployForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create fleet deploy %s", form.Name))
+
+	fd := models.FleetDeploy{
+		OrgId:         c.OrgId,
+		CreatorId:     c.UserId,
+		Name:          form.Name,
+		TaskType:      form.TaskType,
+		Selector:      form.Selector,
+		Concurrency:   utils.FirstValueInt(form.Concurrency, 1),
+		FailurePolicy: utils.FirstValueStr(form.FailurePolicy, models.FleetFailurePolicyStop),
+	}
+	if err := services.ValidateFleetDeploy(&fd); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
+	query, err := services.QueryFleetSelectorEnvs(c.DB(), c.OrgId, &fd.Selector)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	envs := make([]*models.Env, 0)
+	if err := query.Order("iac_env.project_id, iac_env.name").Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(envs) == 0 {
+		return nil, e.New(e.FleetDeployNoEnv, http.StatusBadRequest)
+	}
+	services.SortFleetEnvs(envs)
+
+	if form.DryRun {
+		result := make([]FleetDeployEnv, 0, len(envs))
+		for _, env := range envs {
+			result = append(result, FleetDeployEnv{
+				EnvId:       env.Id,
+				EnvName:     env.Name,
+				ProjectId:   env.ProjectId,
+				TplId:       env.TplId,
+				Criticality: env.Criticality,
+			})
+		}
+		return result, nil
+	}
+
+	var created *models.FleetDeploy
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		created, err = services.CreateFleetDeploy(tx, fd, envs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	created.Progress = &models.FleetDeployProgress{Total: len(envs), Pending: len(envs)}
+	return created, nil
+}
+
+func fillFleetDeployProgress(c *ctx.ServiceContext, fds ...*models.FleetDeploy) e.Error {
+	ids := make([]models.Id, 0, len(fds))
+	for _, fd := range fds {
+		ids = append(ids, fd.Id)
+	}
+	progress, err := services.GetFleetDeployProgress(c.DB(), ids)
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds {
+		fd.Progress = progress[fd.Id]
+	}
+	return nil
+}
+
+func getOrgFleetDeploy(c *ctx.ServiceContext, id models.Id) (*models.FleetDeploy, e.Error) {
+	fd, err := services.GetFleetDeployById(services.QueryWithOrgId(c.DB(), c.OrgId), id)
+	if err != nil {
+		if err.Code() == e.FleetDeployNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return fd, nil
+}
+
+// SearchFleetDeploy 查询批量部署
+func SearchFleetDeploy(c *ctx.ServiceContext, form *forms.SearchFleetDeployForm) (interface{}, e.Error) {
+	query := services.QueryFleetDeploy(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.Q != "" {
+		query = query.WhereLike("name", form.Q)
+	}
+	if form.Status != "" {
+		query = query.Where("status = ?", form.Status)
+	}
+	query = query.Order("created_at DESC")
+
+	fds := make([]*models.FleetDeploy, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&fds); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := fillFleetDeployProgress(c, fds...); err != nil {
+		return nil, err
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     fds,
+	}, nil
+}
+
+// FleetDeployDetail 批量部署详情，包含各状态的环境数量
+func FleetDeployDetail(c *ctx.ServiceContext, form *forms.DetailFleetDeployForm) (*models.FleetDeploy, e.Error) {
+	fd, err := getOrgFleetDeploy(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillFleetDeployProgress(c, fd); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+// SearchFleetDeployItems 查询批量部署中各环境的部署状态
+func SearchFleetDeployItems(c *ctx.ServiceContext, form *forms.SearchFleetDeployItemForm) (interface{}, e.Error) {
+	fd, err := getOrgFleetDeploy(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryFleetDeployItems(c.DB(), fd.Id)
+	if form.Status != "" {
+		query = query.Where("status = ?", form.Status)
+	}
+	items := make([]*models.FleetDeployItem, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query.Order("seq"))
+	if err := p.Scan(&items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     items,
+	}, nil
+}
+
+// StopFleetDeploy 停止批量部署，未启动的环境不再部署，已创建的部署任务继续执行
+func StopFleetDeploy(c *ctx.ServiceContext, form *forms.StopFleetDeployForm) (*models.FleetDeploy, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("stop fleet deploy %s", form.Id))
+
+	fd, err := getOrgFleetDeploy(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if fd.IsFinished() {
+		return nil, e.New(e.FleetDeployNotRunning, http.StatusBadRequest)
+	}
+
+	fd.StoppedBy = c.UserId
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		err = services.FinishFleetDeploy(tx, fd, models.FleetDeployStopped, "stopped by user")
+		return err
+	})
+	if err != nil {
+		if err.Code() == e.FleetDeployNotRunning {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	if err := fillFleetDeployProgress(c, fd); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
@@ -0,0 +1,205 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func checkFreezeWindowProject(c *ctx.ServiceContext, projectId models.Id) e.Error {
+	if projectId == "" {
+		return nil
+	}
+	if _, err := services.DetailProject(services.QueryWithOrgId(c.DB(), c.OrgId), projectId); err != nil {
+		return e.New(e.ProjectNotExists, err, http.StatusBadRequest)
+	}
+	return nil
+}
+
+// CreateFreezeWindow 创建部署冻结窗口
+func CreateFreezeWindow(c *ctx.ServiceContext, form *forms.CreateFreezeWindowForm) (*models.FreezeWindow, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create freeze window %s", form.Name))
+
+	if err := checkFreezeWindowProject(c, form.ProjectId); err != nil {
+		return nil, err
+	}
+	w := models.FreezeWindow{
+		OrgId:         c.OrgId,
+		ProjectId:     form.ProjectId,
+		CreatorId:     c.UserId,
+		Name:          form.Name,
+		Description:   form.Description,
+		Enabled:       true,
+		Type:          form.Type,
+		Cron:          strings.TrimSpace(form.Cron),
+		Duration:      form.Duration,
+		Timezone:      form.Timezone,
+		StartAt:       form.StartAt,
+		EndAt:         form.EndAt,
+		TaskTypes:     form.TaskTypes,
+		Criticalities: form.Criticalities,
+	}
+	if err := services.ValidateFreezeWindow(&w); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return services.CreateFreezeWindow(c.DB(), w)
+}
+
+func SearchFreezeWindow(c *ctx.ServiceContext, form *forms.SearchFreezeWindowForm) (interface{}, e.Error) {
+	query := services.QueryFreezeWindow(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.Q != "" {
+		query = query.WhereLike("name", form.Q)
+	}
+	if form.ProjectId != "" {
+		query = query.Where("project_id = '' OR project_id = ?", form.ProjectId)
+	}
+	query = query.Order("created_at DESC")
+
+	windows := make([]*models.FreezeWindow, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), form.Order(query))
+	if err := p.Scan(&windows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     windows,
+	}, nil
+}
+
+func FreezeWindowDetail(c *ctx.ServiceContext, form *forms.DetailFreezeWindowForm) (*models.FreezeWindow, e.Error) {
+	return services.GetFreezeWindowById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+}
+
+func UpdateFreezeWindow(c *ctx.ServiceContext, form *forms.UpdateFreezeWindowForm) (*models.FreezeWindow, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update freeze window %s", form.Id))
+
+	w, err := services.GetFreezeWindowById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{}
+	if form.HasKey("name") {
+		attrs["name"] = form.Name
+	}
+	if form.HasKey("description") {
+		attrs["description"] = form.Description
+	}
+	if form.HasKey("enabled") {
+		attrs["enabled"] = form.Enabled
+	}
+
+	// 时间配置相关字段修改后需要整体重新校验
+	timeChanged := false
+	if form.HasKey("type") {
+		w.Type, timeChanged = form.Type, true
+	}
+	if form.HasKey("cron") {
+		w.Cron, timeChanged = strings.TrimSpace(form.Cron), true
+	}
+	if form.HasKey("duration") {
+		w.Duration, timeChanged = form.Duration, true
+	}
+	if form.HasKey("timezone") {
+		w.Timezone, timeChanged = form.Timezone, true
+	}
+	if form.HasKey("startAt") {
+		w.StartAt, timeChanged = form.StartAt, true
+	}
+	if form.HasKey("endAt") {
+		w.EndAt, timeChanged = form.EndAt, true
+	}
+	if form.HasKey("taskTypes") {
+		w.TaskTypes, timeChanged = form.TaskTypes, true
+	}
+	if form.HasKey("criticalities") {
+		w.Criticalities, timeChanged = form.Criticalities, true
+	}
+	if timeChanged {
+		if err := services.ValidateFreezeWindow(w); err != nil {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		attrs["type"] = w.Type
+		attrs["cron"] = w.Cron
+		attrs["duration"] = w.Duration
+		attrs["timezone"] = w.Timezone
+		attrs["start_at"] = w.StartAt
+		attrs["end_at"] = w.EndAt
+		attrs["task_types"] = w.TaskTypes
+		attrs["criticalities"] = w.Criticalities
+	}
+	return services.UpdateFreezeWindow(c.DB(), form.Id, attrs)
+}
+
+func DeleteFreezeWindow(c *ctx.ServiceContext, form *forms.DeleteFreezeWindowForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete freeze window %s", form.Id))
+
+	if _, err := services.GetFreezeWindowById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteFreezeWindow(c.DB(), form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// SearchFreezeOverride 查询冻结期间的紧急放行记录
+func SearchFreezeOverride(c *ctx.ServiceContext, form *forms.SearchFreezeOverrideForm) (interface{}, e.Error) {
+	query := services.QueryFreezeOverride(services.QueryWithOrgId(c.DB(), c.OrgId))
+	if form.EnvId != "" {
+		query = query.Where("env_id = ?", form.EnvId)
+	}
+	if form.WindowId != "" {
+		query = query.Where("window_id = ?", form.WindowId)
+	}
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	}
+	return getPage(query, form, models.FreezeOverride{})
+}
+
+// checkEnvFreezeWindow 检查环境是否处于部署冻结期，
+// 处于冻结期且用户申请紧急放行时返回放行记录(未保存)，由调用方在任务创建后保存
+func checkEnvFreezeWindow(c *ctx.ServiceContext, tx *db.Session, env *models.Env,
+	taskType string, form forms.FreezeOverrideForm) (*models.FreezeOverride, e.Error) {
+	w, until, err := services.GetEnvActiveFreezeWindow(tx, env, taskType)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return nil, nil
+	}
+
+	frozenErr := fmt.Errorf("freeze window '%s' is active until %s", w.Name, until.Format("2006-01-02 15:04:05"))
+	if !form.FreezeOverride {
+		return nil, e.New(e.EnvDeployFrozen, frozenErr, http.StatusForbidden)
+	}
+	if err := enforceUserPerm(c, "freeze_windows", "override"); err != nil {
+		return nil, e.New(e.EnvDeployFrozen, frozenErr, http.StatusForbidden)
+	}
+	if strings.TrimSpace(form.FreezeOverrideReason) == "" {
+		return nil, e.New(e.FreezeOverrideNoReason, http.StatusBadRequest)
+	}
+
+	c.Logger().Infof("freeze window %s overridden by %s: %s", w.Id, c.UserId, form.FreezeOverrideReason)
+	override := &models.FreezeOverride{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		EnvId:     env.Id,
+		WindowId:  w.Id,
+		UserId:    c.UserId,
+		Reason:    strings.TrimSpace(form.FreezeOverrideReason),
+	}
+	override.Id = override.NewId()
+	return override, nil
+}
@@ -8,9 +8,12 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/sshkey"
 	"cloudiac/utils"
 	"fmt"
 	"net/http"
+
+	"github.com/pkg/errors"
 )
 
 // SearchKey 密钥列表查询
@@ -38,7 +41,18 @@ func SearchKey(c *ctx.ServiceContext, form *forms.SearchKeyForm) (interface{}, e
 func CreateKey(c *ctx.ServiceContext, form *forms.CreateKeyForm) (interface{}, e.Error) {
 	c.AddLogField("action", fmt.Sprintf("create key %s", form.Name))
 
-	encrypted, er := utils.AesEncrypt(form.Key)
+	content, publicKey := form.Key, ""
+	if form.Generate && content == "" {
+		var er error
+		if content, publicKey, er = sshkey.GenerateKeyPair(); er != nil {
+			return nil, e.New(e.InternalError, errors.Wrap(er, "generate key"), http.StatusInternalServerError)
+		}
+	} else if pub, er := sshkey.PublicKeyOf(content); er == nil {
+		// 设置了密码的私钥无法解析公钥，不影响保存
+		publicKey = pub
+	}
+
+	encrypted, er := utils.AesEncrypt(content)
 	if er != nil {
 		return nil, e.New(e.InternalError, fmt.Errorf("error encrypt key"), http.StatusInternalServerError)
 	}
@@ -46,6 +60,7 @@ func CreateKey(c *ctx.ServiceContext, form *forms.CreateKeyForm) (interface{}, e
 		OrgId:     c.OrgId,
 		Name:      form.Name,
 		Content:   encrypted,
+		PublicKey: publicKey,
 		CreatorId: c.UserId,
 	})
 	if err != nil && err.Code() == e.KeyAlreadyExists {
@@ -102,3 +117,14 @@ func DetailKey(c *ctx.ServiceContext, form *forms.DetailKeyForm) (result interfa
 		return key, nil
 	}
 }
+
+// checkOrgKey 校验密钥存在于当前组织
+func checkOrgKey(c *ctx.ServiceContext, keyId models.Id) e.Error {
+	if _, err := services.GetKeyById(services.QueryWithOrgId(c.DB(), c.OrgId), keyId, false); err != nil {
+		if err.Code() == e.KeyNotExist {
+			return e.New(err.Code(), fmt.Errorf("key '%s' not found", keyId), http.StatusBadRequest)
+		}
+		return err
+	}
+	return nil
+}
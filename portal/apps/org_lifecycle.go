@@ -0,0 +1,98 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+func getLifecycleOrg(c *ctx.ServiceContext, orgId models.Id) (*models.Organization, e.Error) {
+	if !c.IsSuperAdmin {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("super admin required"), http.StatusForbidden)
+	}
+	org, err := services.GetOrganizationById(c.DB(), orgId)
+	if err != nil {
+		if err.Code() == e.OrganizationNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return org, nil
+}
+
+// ExportOrgData 导出组织的所有数据
+func ExportOrgData(c *ctx.ServiceContext, form *forms.ExportOrgDataForm) (*services.OrgExportedData, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("export org data %s", form.Id))
+	if _, err := getLifecycleOrg(c, form.Id); err != nil {
+		return nil, err
+	}
+
+	data, err := services.ExportOrgData(c.DB(), form.Id)
+	if err != nil {
+		c.Logger().Errorf("export org data error: %v", err)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return data, nil
+}
+
+// ScheduleOrgPurge 计划在保留期后清除组织数据，清除后不可恢复
+func ScheduleOrgPurge(c *ctx.ServiceContext, form *forms.ScheduleOrgPurgeForm) (*models.Organization, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("schedule org purge %s", form.Id))
+	org, err := getLifecycleOrg(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if org.IsDemo {
+		return nil, e.New(e.BadRequest, fmt.Errorf("demo organization cannot be purged"), http.StatusBadRequest)
+	}
+	if form.ConfirmName != org.Name {
+		return nil, e.New(e.OrgNameMismatch, http.StatusBadRequest)
+	}
+
+	if err := services.ScheduleOrgPurge(c.DB(), org, c.UserId); err != nil {
+		if err.Code() == e.OrgPurgeScheduled {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return org, nil
+}
+
+// CancelOrgPurge 在保留期内取消组织数据清除
+func CancelOrgPurge(c *ctx.ServiceContext, form *forms.CancelOrgPurgeForm) (*models.Organization, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("cancel org purge %s", form.Id))
+	org, err := getLifecycleOrg(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := services.CancelOrgPurge(c.DB(), org); err != nil {
+		if err.Code() == e.OrgPurgeNotScheduled {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return org, nil
+}
+
+// OrgDestructionCert 查询组织数据销毁证明
+func OrgDestructionCert(c *ctx.ServiceContext, form *forms.OrgDestructionCertForm) (*models.OrgDestructionCert, e.Error) {
+	if !c.IsSuperAdmin {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("super admin required"), http.StatusForbidden)
+	}
+
+	cert, err := services.GetOrgDestructionCert(c.DB(), form.Id)
+	if err != nil {
+		if err.Code() == e.OrgCertNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return cert, nil
+}
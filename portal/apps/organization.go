@@ -145,6 +145,9 @@ func ChangeOrgStatus(c *ctx.ServiceContext, form *forms.DisableOrganizationForm)
 	if org.Status == form.Status {
 		return org, nil
 	}
+	if form.Status == models.OrgEnable && org.PurgeAt != nil {
+		return nil, e.New(e.OrgPurgeScheduled, http.StatusBadRequest)
+	}
 
 	if !c.IsSuperAdmin {
 		query = services.QueryWithOrgId(query, c.OrgId)
@@ -255,7 +258,7 @@ func AddUserOrgRel(c *ctx.ServiceContext, form *forms.AddUserOrgRelForm) (*model
 		query = query.Where(fmt.Sprintf("%s.id in (?)", models.User{}.TableName()), userIds)
 	}
 
-	if form.Role != consts.OrgRoleMember && form.Role != consts.OrgRoleAdmin {
+	if !utils.StrInArray(form.Role, consts.OrgRoleMember, consts.OrgRoleAdmin, consts.OrgRoleAuditor) {
 		return nil, e.New(e.InvalidRoleName, http.StatusBadRequest)
 	}
 	user, err := services.GetUserById(query, form.UserId)
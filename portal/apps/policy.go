@@ -21,9 +21,11 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/open-policy-agent/opa/cover"
 	"github.com/pkg/errors"
 )
 
@@ -81,7 +83,7 @@ func ScanTemplateOrEnv(c *ctx.ServiceContext, form *forms.ScanTemplateForm, envI
 	}
 
 	// 创建任务
-	runnerId, err := services.GetDefaultRunnerId()
+	runnerId, err := services.GetTemplateRunnerId(tpl)
 	if err != nil {
 		_ = tx.Rollback()
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
@@ -200,13 +202,13 @@ func IsScanableTpl(tx *db.Session, tplId models.Id, envId models.Id, isParse boo
 func UpdateLastScanTaskId(tx *db.Session, task *models.ScanTask, env *models.Env, tpl *models.Template) e.Error {
 	if task.Type == models.TaskTypeEnvScan {
 		env.LastScanTaskId = task.Id
-		if _, err := tx.Save(env); err != nil {
-			return e.New(e.DBError, err, http.StatusInternalServerError)
+		if err := services.UpdateLastScanTask(tx, consts.ScopeEnv, env.Id, task); err != nil {
+			return e.New(err.Code(), err, http.StatusInternalServerError)
 		}
 	} else if task.Type == models.TaskTypeTplScan {
 		tpl.LastScanTaskId = task.Id
-		if _, err := tx.Save(tpl); err != nil {
-			return e.New(e.DBError, err, http.StatusInternalServerError)
+		if err := services.UpdateLastScanTask(tx, consts.ScopeTemplate, tpl.Id, task); err != nil {
+			return e.New(err.Code(), err, http.StatusInternalServerError)
 		}
 	}
 	return nil
@@ -215,66 +217,99 @@ func UpdateLastScanTaskId(tx *db.Session, task *models.ScanTask, env *models.Env
 // ScanEnvironment 扫描环境策略
 func ScanEnvironment(c *ctx.ServiceContext, form *forms.ScanEnvironmentForm) (*models.ScanTask, e.Error) {
 	c.AddLogField("action", fmt.Sprintf("scan environment %s", form.Id))
+	return scanEnvironment(c, form.Id)
+}
+
+// scanEnvironment 在独立的事务中创建环境扫描任务，出错时回滚事务
+func scanEnvironment(c *ctx.ServiceContext, envId models.Id) (task *models.ScanTask, err e.Error) {
 	if c.OrgId == "" {
 		return nil, e.New(e.BadRequest, http.StatusBadRequest)
 	}
 
 	tx := c.Tx()
-	txWithOrg := services.QueryWithOrgIdAndGlobal(c.Tx(), c.OrgId)
 	defer func() {
 		if r := recover(); r != nil {
 			_ = tx.Rollback()
 			panic(r)
 		}
+		if err != nil {
+			// IsScanableEnv 等函数在部分错误时已经回滚了事务，重复回滚不影响
+			_ = tx.Rollback()
+		}
 	}()
 
 	envQuery := services.QueryWithOrgId(tx, c.OrgId)
-	env, err := IsScanableEnv(envQuery, form.Id, false)
+	env, err := IsScanableEnv(envQuery, envId, false)
 	if err != nil {
 		return nil, err
 	}
 
 	// 模板检查
-	tplQuery := services.QueryWithOrgId(txWithOrg, c.OrgId)
-	tpl, err := IsScanableTpl(tplQuery, env.TplId, form.Id, false)
+	tplQuery := services.QueryWithOrgId(services.QueryWithOrgIdAndGlobal(tx, c.OrgId), c.OrgId)
+	tpl, err := IsScanableTpl(tplQuery, env.TplId, envId, false)
 	if err != nil {
 		return nil, err
 	}
 
 	// 确定任务类型
-	taskType := GetScanTaskType(form.Id, false)
+	taskType := GetScanTaskType(envId, false)
 
-	task, err := services.CreateEnvScanTask(tx, tpl, env, taskType, c.UserId)
+	task, err = services.CreateEnvScanTask(tx, tpl, env, taskType, c.UserId)
 	if err != nil {
-		_ = tx.Rollback()
 		c.Logger().Errorf("error creating scan task, err %s", err)
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
 	env.LastScanTaskId = task.Id
-	if _, err := tx.Save(env); err != nil {
-		_ = tx.Rollback()
+	if err := services.UpdateLastScanTask(tx, consts.ScopeEnv, env.Id, task); err != nil {
 		c.Logger().Errorf("save env, err %s", err)
-		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
 	if err := services.InitScanResult(tx, task); err != nil {
-		_ = tx.Rollback()
 		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
 	}
 
-	if err := tx.Commit(); err != nil {
-		_ = tx.Rollback()
-		c.Logger().Errorf("commit env, err %s", err)
-		return nil, e.New(e.DBError, err)
+	if er := tx.Commit(); er != nil {
+		c.Logger().Errorf("commit env, err %s", er)
+		return nil, e.New(e.DBError, er)
 	}
 	return task, nil
 }
 
+type ScanEnvironmentResult struct {
+	EnvId   models.Id        `json:"envId"`             // 环境ID
+	Task    *models.ScanTask `json:"task,omitempty"`    // 扫描任务，发起失败时为空
+	Code    int              `json:"code,omitempty"`    // 错误码，发起成功时为 0
+	Message string           `json:"message,omitempty"` // 错误信息
+}
+
+// ScanEnvironments 发起执行多个环境的合规检测任务，单个环境发起失败不影响其他环境
+func ScanEnvironments(c *ctx.ServiceContext, form *forms.ScanEnvironmentForms) ([]ScanEnvironmentResult, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("scan environments %v", form.Ids))
+
+	results := make([]ScanEnvironmentResult, 0, len(form.Ids))
+	for _, id := range form.Ids {
+		result := ScanEnvironmentResult{EnvId: id}
+		scanTask, err := scanEnvironment(c, id)
+		if err != nil {
+			c.Logger().Warnf("scan environment %s error: %v", id, err)
+			result.Code = err.Code()
+			result.Message = e.ErrorMsg(err, "")
+		} else {
+			result.Task = scanTask
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
 type PolicyResp struct {
 	models.Policy
-	GroupName string `json:"groupName"`
-	Creator   string `json:"creator"`
+	GroupName        string `json:"groupName"`
+	Creator          string `json:"creator"`
+	OriginalSeverity string `json:"originalSeverity"` // 策略本身定义的严重性
+	OverrideSeverity string `json:"overrideSeverity"` // 组织内覆盖的严重性，未覆盖时为空
 	Summary
 }
 
@@ -286,6 +321,12 @@ func SearchPolicy(c *ctx.ServiceContext, form *forms.SearchPolicyForm) (interfac
 	if err := p.Scan(&policyResps); err != nil {
 		return nil, e.New(e.DBError, err)
 	}
+	for idx := range policyResps {
+		policyResps[idx].OriginalSeverity = policyResps[idx].Severity
+		if policyResps[idx].OverrideSeverity != "" {
+			policyResps[idx].Severity = policyResps[idx].OverrideSeverity
+		}
+	}
 
 	// 扫描结果统计信息
 	var policyIds []models.Id
@@ -331,7 +372,8 @@ func DetailPolicy(c *ctx.ServiceContext, form *forms.DetailPolicyForm) (interfac
 type RespPolicyTpl struct {
 	models.Template
 
-	PolicyStatus string `json:"policyStatus"` // 策略检查状态, enum('passed','violated','pending','failed')
+	PolicyStatus    string `json:"policyStatus"`    // 策略检查状态, enum('passed','violated','pending','failed')
+	ComplianceScore *int   `json:"complianceScore"` // 最近一次扫描的合规评分(0-100)，未扫描时为空
 
 	PolicyGroups []services.NewPolicyGroup `json:"policyGroups" gorm:"-"`
 	OrgName      string                    `json:"orgName" form:"orgName" `
@@ -391,7 +433,8 @@ func SearchPolicyTpl(c *ctx.ServiceContext, form *forms.SearchPolicyTplForm) (in
 type RespPolicyEnv struct {
 	models.Env
 
-	PolicyStatus string `json:"policyStatus"` // 策略检查状态, enum('passed','violated','pending','failed')
+	PolicyStatus    string `json:"policyStatus"`    // 策略检查状态, enum('passed','violated','pending','failed')
+	ComplianceScore *int   `json:"complianceScore"` // 最近一次扫描的合规评分(0-100)，未扫描时为空
 
 	PolicyGroups []services.NewPolicyGroup `json:"policyGroups" gorm:"-"`
 	Summary
@@ -476,6 +519,20 @@ func EnvOfPolicy(c *ctx.ServiceContext, form *forms.EnvOfPolicyForm) (interface{
 	}, nil
 }
 
+// PolicyScoreTrend 环境或云模板的合规评分趋势
+func PolicyScoreTrend(c *ctx.ServiceContext, scope string, form *forms.PolicyScoreTrendForm) (interface{}, e.Error) {
+	if !form.HasKey("to") {
+		form.To = time.Now()
+	}
+	if !form.HasKey("from") {
+		// 默认展示近 30 天的数据
+		form.From = utils.LastDaysMidnight(30, form.To)
+	}
+
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	return services.GetComplianceScoreTrend(query, scope, form.Id, form.From, form.To)
+}
+
 type ValidPolicyResp struct {
 	ValidPolicies      []models.Policy `json:"validPolicies"`
 	SuppressedPolicies []models.Policy `json:"suppressedPolicies"`
@@ -668,8 +725,8 @@ func checkScopeEnabled(query *db.Session, scope string, id models.Id) (bool, e.E
 	}
 }
 
-func getLastScanTaskByScope(query *db.Session, scope string, id models.Id) (*models.ScanTask, e.Error) {
-	scanTask, err := services.GetLastScanTaskByScope(query, scope, id)
+func getLastScanTaskByScope(query *db.Session, scope string, id models.Id, scanContext string) (*models.ScanTask, e.Error) {
+	scanTask, err := services.GetLastScanTaskByContext(query, scope, id, scanContext)
 	if err != nil {
 		if e.IsRecordNotFound(err) {
 			if scope == consts.ScopeEnv {
@@ -683,7 +740,7 @@ func getLastScanTaskByScope(query *db.Session, scope string, id models.Id) (*mod
 	return scanTask, nil
 }
 
-func getScanTaskVarious(query *db.Session, taskId models.Id, scope string, id models.Id) (*models.ScanTask, e.Error) {
+func getScanTaskVarious(query *db.Session, taskId models.Id, scope string, id models.Id, scanContext string) (*models.ScanTask, e.Error) {
 	if taskId != "" {
 		scanTask, err := services.GetScanTaskById(query, taskId)
 		if err != nil {
@@ -694,7 +751,7 @@ func getScanTaskVarious(query *db.Session, taskId models.Id, scope string, id mo
 		}
 		return scanTask, nil
 	} else {
-		scanTask, err := getLastScanTaskByScope(query, scope, id)
+		scanTask, err := getLastScanTaskByScope(query, scope, id, scanContext)
 		if err != nil {
 			if err.Code() == e.EnvNotExists || err.Code() == e.TemplateNotExists {
 				return nil, e.New(e.ObjectNotExists)
@@ -737,7 +794,7 @@ func PolicyScanResult(c *ctx.ServiceContext, scope string, form *forms.PolicySca
 	query := services.QueryWithOrgId(c.DB(), c.OrgId)
 
 	policyEnable, _ := checkScopeEnabled(query, scope, form.Id)
-	scanTask, err := getScanTaskVarious(query, form.TaskId, scope, form.Id)
+	scanTask, err := getScanTaskVarious(query, form.TaskId, scope, form.Id, form.Context)
 	if err != nil {
 		if err.Code() == e.ObjectNotExists {
 			// 默认返回空列表
@@ -760,9 +817,7 @@ func PolicyScanResult(c *ctx.ServiceContext, scope string, form *forms.PolicySca
 		}, nil
 	}
 
-	query = services.QueryWithOrgId(c.DB(), c.OrgId, models.PolicyResult{}.TableName())
-	query = services.QueryPolicyResult(query, scanTask.Id)
-	query = services.QueryPolicySuppress(query, scope, form.Id)
+	query = queryScanResults(c, scope, form.Id, scanTask.Id, form.HasKey("fields"), form.Fields)
 	if form.SortField() == "" {
 		query = query.Order("policy_group_name, policy_name")
 	} else {
@@ -775,6 +830,10 @@ func PolicyScanResult(c *ctx.ServiceContext, scope string, form *forms.PolicySca
 		return nil, e.New(e.DBError, err)
 	}
 
+	if err := overrideResultsSeverity(c, results); err != nil {
+		return nil, err
+	}
+
 	// 按策略组分组
 	resultGroups := groupByGroup(results)
 
@@ -787,6 +846,104 @@ func PolicyScanResult(c *ctx.ServiceContext, scope string, form *forms.PolicySca
 	}, nil
 }
 
+// queryScanResults 查询扫描任务的结果，hasFields 为 false 时返回全部大字段
+func queryScanResults(c *ctx.ServiceContext, scope string, id models.Id, scanTaskId models.Id, hasFields bool, fields string) *db.Session {
+	query := services.QueryWithOrgId(c.DB(), c.OrgId, models.PolicyResult{}.TableName())
+	withRego, withFixSuggestion := true, true
+	if hasFields {
+		fieldList := strings.Split(fields, ",")
+		withRego = utils.StrInArray(consts.PolicyResultFieldRego, fieldList...)
+		withFixSuggestion = utils.StrInArray(consts.PolicyResultFieldFixSuggestion, fieldList...)
+	}
+	query = services.QueryPolicyResultWithFields(query, scanTaskId, withRego, withFixSuggestion)
+	return services.QueryPolicySuppress(query, scope, id)
+}
+
+// overrideResultsSeverity 使用组织内覆盖后的严重性
+func overrideResultsSeverity(c *ctx.ServiceContext, results []PolicyResult) e.Error {
+	overrides, err := services.GetPolicySeverityOverrides(c.DB(), c.OrgId)
+	if err != nil {
+		return err
+	}
+	for idx := range results {
+		if severity, ok := overrides[results[idx].PolicyId]; ok {
+			results[idx].Severity = severity
+		}
+	}
+	return nil
+}
+
+type ScanResultCursorResp struct {
+	PolicyStatus string               `json:"policyStatus"` // 扫描状态
+	Task         *models.ScanTask     `json:"task"`         // 扫描任务
+	Groups       []*PolicyResultGroup `json:"groups"`       // 策略组，每个策略组包含该组全部的扫描结果及统计
+	NextCursor   string               `json:"nextCursor"`   // 下一页的游标，为空表示没有更多数据
+}
+
+// PolicyScanResultByGroup 按策略组分页查询扫描结果，分页使用游标，每页返回完整的策略组
+func PolicyScanResultByGroup(c *ctx.ServiceContext, scope string, form *forms.PolicyScanResultCursorForm) (*ScanResultCursorResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("scan result for %s:%s %s", scope, form.Id, form.TaskId))
+
+	var lastGroupId models.Id
+	if form.Cursor != "" {
+		values, er := page.DecodeCursor(form.Cursor, 1)
+		if er != nil {
+			return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+		}
+		lastGroupId = models.Id(values[0])
+	}
+
+	query := services.QueryWithOrgId(c.DB(), c.OrgId)
+	policyEnable, _ := checkScopeEnabled(query, scope, form.Id)
+	resp := &ScanResultCursorResp{Groups: make([]*PolicyResultGroup, 0)}
+	scanTask, err := getScanTaskVarious(query, form.TaskId, scope, form.Id, form.Context)
+	if err != nil {
+		if err.Code() == e.ObjectNotExists {
+			resp.PolicyStatus = services.MergeScanResultPolicyStatus(policyEnable, nil)
+			return resp, nil
+		}
+		return nil, err
+	}
+	resp.PolicyStatus = services.MergeScanResultPolicyStatus(policyEnable, scanTask)
+	resp.Task = scanTask
+	if scanTask.PolicyStatus == common.TaskPending {
+		return resp, nil
+	}
+
+	groupIds, err := services.GetScanResultGroupIds(c.DB(), scanTask.Id, lastGroupId, form.Limit()+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(groupIds) > form.Limit() {
+		groupIds = groupIds[:form.Limit()]
+		resp.NextCursor = page.EncodeCursor(string(groupIds[len(groupIds)-1]))
+	}
+	if len(groupIds) == 0 {
+		return resp, nil
+	}
+
+	query = queryScanResults(c, scope, form.Id, scanTask.Id, form.HasKey("fields"), form.Fields).
+		Where("iac_policy_result.policy_group_id IN (?)", groupIds).
+		Order("iac_policy_result.policy_group_id, policy_name")
+	results := make([]PolicyResult, 0)
+	if err := query.Scan(&results); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := overrideResultsSeverity(c, results); err != nil {
+		return nil, err
+	}
+	if groups := groupByGroup(results); groups != nil {
+		resp.Groups = groups
+	}
+	return resp, nil
+}
+
+// PolicyResultRego 查询单条扫描结果的 rego 代码及修复建议
+func PolicyResultRego(c *ctx.ServiceContext, form *forms.PolicyResultRegoForm) (*services.PolicyResultRego, e.Error) {
+	query := services.QueryWithOrgId(c.DB(), c.OrgId, models.PolicyResult{}.TableName())
+	return services.GetPolicyResultRego(query, form.Id)
+}
+
 type Summary struct {
 	Passed     int `json:"passed"`
 	Violated   int `json:"violated"`
@@ -811,6 +968,8 @@ type PolicyScanReportResp struct {
 	TaskScanCount    Polyline        `json:"scanCount"`        // 检测源执行次数
 	PolicyScanCount  Polyline        `json:"policyScanCount"`  // 策略运行趋势
 	PolicyPassedRate PolylinePercent `json:"policyPassedRate"` // 检测通过率趋势
+
+	Watermark *services.ReportWatermark `json:"watermark,omitempty"` // 审计员导出时记录导出人
 }
 
 func PolicyScanReport(c *ctx.ServiceContext, form *forms.PolicyScanReportForm) (*PolicyScanReportResp, e.Error) { //nolint:cyclop
@@ -922,6 +1081,9 @@ func PolicyScanReport(c *ctx.ServiceContext, form *forms.PolicyScanReportForm) (
 		taskCount.Value = append(taskCount.Value, s.Count)
 	}
 
+	if report.Watermark, err = services.NewReportWatermark(c.DB(), c.UserId, c.OrgId); err != nil {
+		return nil, err
+	}
 	return &report, nil
 }
 
@@ -942,17 +1104,37 @@ type PolicyTestResp struct {
 	Data         interface{} `json:"data" swaggertype:"string" example:"{\n\"accurics\":{\n\"instanceWithNoVpc\":[\n{\n\"Id\":\"alicloud_instance.instance\"\n}\n]\n}\n}"` // 脚本测试输出，json文本
 	Error        string      `json:"error" example:"1 error occurred: policy.rego:4: rego_parse_error: refs cannot be used for rule\n"`                                    // 脚本执行错误内容
 	PolicyStatus string      `json:"policyStatus"`
+
+	Results  []PolicyTestResult  `json:"results"`  // 每个输入的测试结果
+	Coverage *PolicyTestCoverage `json:"coverage"` // 所有输入累计的 rego 脚本覆盖率，脚本执行出错时为空
+}
+
+type PolicyTestResult struct {
+	Name         string      `json:"name" example:"vpc_missing"` // 输入名称
+	Data         interface{} `json:"data" swaggertype:"string"`  // 脚本测试输出
+	Error        string      `json:"error"`                      // 脚本执行错误内容
+	PolicyStatus string      `json:"policyStatus"`
+	Resources    []string    `json:"resources"` // 违规的资源
 }
 
+type PolicyTestCoverage struct {
+	Coverage   float64       `json:"coverage" example:"85.71"` // 覆盖率百分比
+	Covered    []cover.Range `json:"covered"`                  // 已覆盖的行范围
+	NotCovered []cover.Range `json:"notCovered"`               // 未覆盖的行范围
+}
+
+// PolicyTest 策略测试，支持一次传入多组命名的输入数据，每组数据分别执行并返回结果
 func PolicyTest(c *ctx.ServiceContext, form *forms.PolicyTestForm) (*PolicyTestResp, e.Error) {
 	c.AddLogField("action", "test template")
 
-	var value interface{}
-	if err := json.Unmarshal([]byte(form.Input), &value); err != nil {
-		return &PolicyTestResp{
-			Data:  map[string]interface{}{},
-			Error: fmt.Sprintf("invalid input %v", err),
-		}, nil
+	inputs := form.Inputs
+	if len(inputs) == 0 {
+		inputs = []forms.PolicyTestInput{{Name: "input", Input: form.Input}}
+	}
+
+	engine, er := policyTestEngine(c, form)
+	if er != nil {
+		return nil, er
 	}
 
 	tmpDir, err := os.MkdirTemp("", "*")
@@ -962,33 +1144,105 @@ func PolicyTest(c *ctx.ServiceContext, form *forms.PolicyTestForm) (*PolicyTestR
 	defer os.RemoveAll(tmpDir)
 
 	regoPath := filepath.Join(tmpDir, "policy.rego")
-	inputPath := filepath.Join(tmpDir, "input.json")
-
 	if err := os.WriteFile(regoPath, []byte(form.Rego), 0644); err != nil { //nolint:gosec
 		return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
 	}
-	if err := os.WriteFile(inputPath, []byte(form.Input), 0644); err != nil { //nolint:gosec
-		return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+
+	cov := cover.New()
+	evaluated := false
+	results := make([]PolicyTestResult, 0, len(inputs))
+	for i, input := range inputs {
+		result := PolicyTestResult{
+			Name: input.Name,
+			Data: map[string]interface{}{},
+		}
+
+		var value interface{}
+		if err := json.Unmarshal([]byte(input.Input), &value); err != nil {
+			result.Error = fmt.Sprintf("invalid input %v", err)
+			results = append(results, result)
+			continue
+		}
+
+		inputPath := filepath.Join(tmpDir, fmt.Sprintf("input-%d.json", i))
+		if err := os.WriteFile(inputPath, []byte(input.Input), 0644); err != nil { //nolint:gosec
+			return nil, e.New(e.InternalError, err, http.StatusInternalServerError)
+		}
+
+		data, err := policy.RegoEvalWithCoverage(engine, regoPath, inputPath, cov)
+		if err != nil {
+			result.Error = fmt.Sprintf("%s", err)
+			result.PolicyStatus = common.PolicyStatusFailed
+		} else {
+			evaluated = true
+			result.Data = data
+			result.PolicyStatus = common.PolicyStatusPassed
+			result.Resources = (&policy.Rego{}).ParseResource(data)
+			if len(result.Resources) > 0 {
+				result.PolicyStatus = common.PolicyStatusViolated
+			}
+		}
+		results = append(results, result)
 	}
 
-	if result, err := policy.RegoParse(regoPath, inputPath); err != nil {
-		return &PolicyTestResp{
-			Data:         map[string]interface{}{},
-			Error:        fmt.Sprintf("%s", err),
-			PolicyStatus: common.PolicyStatusFailed,
-		}, nil
+	resp := &PolicyTestResp{
+		Data:    map[string]interface{}{},
+		Results: results,
+	}
+	if len(form.Inputs) == 0 {
+		// 兼容单个输入的调用方式
+		resp.Data = results[0].Data
+		resp.Error = results[0].Error
+		resp.PolicyStatus = results[0].PolicyStatus
 	} else {
-		status := common.PolicyStatusPassed
-		res := (&policy.Rego{}).ParseResource(result)
-		if len(res) > 0 {
+		resp.PolicyStatus = policyTestSummaryStatus(results)
+	}
+
+	// 外部 opa 执行时无法记录执行轨迹，不统计覆盖率
+	if evaluated && engine.IsEmbedded() {
+		if fr, err := policy.RegoCoverage(regoPath, cov); err != nil {
+			c.Logger().Warnf("generate rego coverage error: %v", err)
+		} else {
+			resp.Coverage = &PolicyTestCoverage{
+				Coverage:   fr.Coverage,
+				Covered:    fr.Covered,
+				NotCovered: fr.NotCovered,
+			}
+		}
+	}
+	return resp, nil
+}
+
+// policyTestEngine 获取策略测试使用的执行引擎，指定策略组时使用策略组的设置
+func policyTestEngine(c *ctx.ServiceContext, form *forms.PolicyTestForm) (policy.Engine, e.Error) {
+	engine := policy.Engine{OpaVersion: form.OpaVersion, RegoVersion: form.RegoVersion}
+	if form.GroupId != "" {
+		group, err := services.GetPolicyGroupById(services.QueryWithOrgId(c.DB(), c.OrgId), form.GroupId)
+		if err != nil && err.Code() == e.PolicyGroupNotExist {
+			return engine, e.New(err.Code(), err, http.StatusNotFound)
+		} else if err != nil {
+			return engine, e.New(e.DBError, err, http.StatusInternalServerError)
+		}
+		engine = policy.Engine{OpaVersion: group.OpaVersion, RegoVersion: group.RegoVersion}
+	}
+	if err := policy.ValidateEngine(engine.OpaVersion, engine.RegoVersion); err != nil {
+		return engine, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	return engine, nil
+}
+
+// policyTestSummaryStatus 汇总多个输入的测试状态，任一输入执行失败则为 failed，任一输入违规则为 violated
+func policyTestSummaryStatus(results []PolicyTestResult) string {
+	status := common.PolicyStatusPassed
+	for _, r := range results {
+		if r.Error != "" {
+			return common.PolicyStatusFailed
+		}
+		if r.PolicyStatus == common.PolicyStatusViolated {
 			status = common.PolicyStatusViolated
 		}
-		return &PolicyTestResp{
-			Data:         result,
-			Error:        "",
-			PolicyStatus: status,
-		}, nil
 	}
+	return status
 }
 
 type PieCharPercent []PieSectorPercent
@@ -1148,8 +1402,15 @@ func PolicySummary(c *ctx.ServiceContext) (*PolicySummaryResp, e.Error) { //noli
 		} else {
 			summaryResp.UnresolvedPolicy.Changes = 1
 		}
+		overrides, err := services.GetPolicySeverityOverrides(c.DB(), c.OrgId)
+		if err != nil {
+			return nil, err
+		}
 		var high, medium, low int
 		for _, v := range unresolvedPolicies {
+			if severity, ok := overrides[v.Id]; ok {
+				v.Severity = severity
+			}
 			switch v.Severity {
 			case common.PolicySeverityHigh:
 				high++
@@ -1229,9 +1490,10 @@ func PolicyGroupRepoDownloadAndParse(g *models.PolicyGroup) ([]*policy.PolicyWit
 	return policy.ParsePolicyGroup(filepath.Join(tmpDir, "code", g.Dir))
 }
 
-// policiesUpsert 策略文件同步
+// policiesUpsert 策略文件同步，同时记录本次同步中各策略的变更
 func policiesUpsert(tx *db.Session, userId models.Id, orgId models.Id, policyGroup *models.PolicyGroup, policyMetas []*policy.PolicyWithMeta) e.Error {
 	// 4. 策略同步
+	changes := make(models.PolicyChanges, 0)
 
 	// 删除仓库中已经不存在的策略
 	ops, _ := services.GetPoliciesByGroupId(tx, policyGroup.Id, orgId)
@@ -1248,6 +1510,7 @@ func policiesUpsert(tx *db.Session, userId models.Id, orgId models.Id, policyGro
 				if er != nil {
 					return e.New(e.DBError, er)
 				}
+				changes = append(changes, *services.DiffPolicy(oldPolicy, nil))
 			}
 		}
 	}
@@ -1281,8 +1544,17 @@ func policiesUpsert(tx *db.Session, userId models.Id, orgId models.Id, policyGro
 		if er != nil {
 			return e.New(e.DBError, er)
 		}
+		if change := services.DiffPolicy(op, &np); change != nil {
+			changes = append(changes, *change)
+		}
 	}
-	return nil
+
+	// 更新策略组时传入的 policyGroup 只包含 id，需要重新查询同步的版本信息
+	group, err := services.GetPolicyGroupById(tx, policyGroup.Id)
+	if err != nil {
+		return err
+	}
+	return services.CreatePolicyGroupSync(tx, services.NewPolicyGroupSync(group, userId, changes))
 }
 
 func PolicyTargetSummaryTpl(respPolicyTpls []*RespPolicyTpl, summaries []*services.PolicyScanSummary) []*RespPolicyTpl { //nolint:dupl
@@ -3,6 +3,8 @@
 package apps
 
 import (
+	"archive/zip"
+	"bytes"
 	"cloudiac/common"
 	"cloudiac/policy"
 	"cloudiac/portal/consts"
@@ -12,21 +14,24 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
 	"cloudiac/portal/services/vcsrv"
 	"cloudiac/utils"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
 	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
 )
 
 // CreatePolicyGroup 创建策略组
 func CreatePolicyGroup(c *ctx.ServiceContext, form *forms.CreatePolicyGroupForm) (*models.PolicyGroup, e.Error) {
 	c.AddLogField("action", fmt.Sprintf("create policy group %s", form.Name))
-	logger := c.Logger()
 	g := models.PolicyGroup{
 		Name:        form.Name,
 		Description: form.Description,
@@ -36,6 +41,14 @@ func CreatePolicyGroup(c *ctx.ServiceContext, form *forms.CreatePolicyGroupForm)
 		RepoId:      form.RepoId,
 		OrgId:       c.OrgId,
 		CreatorId:   c.UserId,
+		OpaVersion:  form.OpaVersion,
+		RegoVersion: form.RegoVersion,
+	}
+	if g.RegoVersion == "" {
+		g.RegoVersion = policy.RegoVersionV0
+	}
+	if err := policy.ValidateEngine(g.OpaVersion, g.RegoVersion); err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
 	}
 
 	if form.GitTags != "" {
@@ -59,8 +72,69 @@ func CreatePolicyGroup(c *ctx.ServiceContext, form *forms.CreatePolicyGroupForm)
 		g.Dir = consts.DirRoot
 	}
 
+	return createPolicyGroupWithPolicies(c, &g)
+}
+
+// UploadPolicyGroup 上传 rego 文件压缩包创建策略组，压缩包保存在 logstorage 中，不依赖 VCS
+func UploadPolicyGroup(c *ctx.ServiceContext, form *forms.UploadPolicyGroupForm) (*models.PolicyGroup, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("upload policy group %s", form.Name))
+
+	if form.File.Size > consts.MaxPolicyGroupArchiveSize {
+		return nil, e.New(e.BadParam, fmt.Errorf("archive size exceeds %d bytes", consts.MaxPolicyGroupArchiveSize),
+			http.StatusBadRequest)
+	}
+	fp, er := form.File.Open()
+	if er != nil {
+		return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+	}
+	defer fp.Close()
+	content, er := io.ReadAll(fp)
+	if er != nil {
+		return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+	}
+	if _, er := zip.NewReader(bytes.NewReader(content), int64(len(content))); er != nil {
+		return nil, e.New(e.BadParam, errors.Wrap(er, "invalid zip archive"), http.StatusBadRequest)
+	}
+
+	sum := sha256.Sum256(content)
+	g := models.PolicyGroup{
+		Name:        form.Name,
+		Description: form.Description,
+		Label:       strings.Join(form.Labels, ","),
+		Source:      consts.PolicyGroupSourceUpload,
+		CommitId:    hex.EncodeToString(sum[:]),
+		Dir:         utils.FirstValueStr(form.Dir, consts.DirRoot),
+		OrgId:       c.OrgId,
+		CreatorId:   c.UserId,
+		OpaVersion:  form.OpaVersion,
+		RegoVersion: utils.FirstValueStr(form.RegoVersion, policy.RegoVersionV0),
+	}
+	if err := policy.ValidateEngine(g.OpaVersion, g.RegoVersion); err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	if form.Version != "" {
+		v, err := semver.NewVersion(form.Version)
+		if err != nil {
+			return nil, e.New(e.BadParam, fmt.Errorf("version is invalid semver"), http.StatusBadRequest)
+		}
+		g.Version = v.String()
+	}
+
+	g.Id = models.NewId("pog")
+	g.RepoId = services.PolicyGroupArchivePath(g.Id)
+	if err := logstorage.Get().Write(g.RepoId, content); err != nil {
+		return nil, e.New(e.DBError, errors.Wrap(err, "save policy group archive"), http.StatusInternalServerError)
+	}
+
+	return createPolicyGroupWithPolicies(c, &g)
+}
+
+// createPolicyGroupWithPolicies 下载并解析策略组仓库，创建策略组并同步策略
+func createPolicyGroupWithPolicies(c *ctx.ServiceContext, g *models.PolicyGroup) (*models.PolicyGroup, e.Error) {
+	logger := c.Logger()
+
 	// 策略组仓库解析
-	policies, err := PolicyGroupRepoDownloadAndParse(&g)
+	policies, err := PolicyGroupRepoDownloadAndParse(g)
 	if err != nil {
 		return nil, err
 	}
@@ -74,7 +148,7 @@ func CreatePolicyGroup(c *ctx.ServiceContext, form *forms.CreatePolicyGroupForm)
 	}()
 
 	// 策略组创建
-	group, err := services.CreatePolicyGroup(tx, &g)
+	group, err := services.CreatePolicyGroup(tx, g)
 	if err != nil && err.Code() == e.PolicyGroupAlreadyExist {
 		_ = tx.Rollback()
 		return nil, e.New(err.Code(), err, http.StatusBadRequest)
@@ -138,6 +212,12 @@ func UpdatePolicyGroup(c *ctx.ServiceContext, form *forms.UpdatePolicyGroupForm)
 	pg := models.PolicyGroup{}
 	pg.Id = form.Id
 
+	if form.HasKey("opaVersion") || form.HasKey("regoVersion") {
+		if err := checkPolicyGroupEngine(c, form); err != nil {
+			return nil, err
+		}
+	}
+
 	var (
 		policies []*policy.PolicyWithMeta
 		err      e.Error
@@ -237,6 +317,18 @@ func updatePolicyGroupParamCheck(form *forms.UpdatePolicyGroupForm) models.Attrs
 			attr["dir"] = consts.DirRoot
 		}
 	}
+
+	if form.HasKey("opaVersion") {
+		attr["opaVersion"] = form.OpaVersion
+	}
+
+	if form.HasKey("regoVersion") {
+		if form.RegoVersion != "" {
+			attr["regoVersion"] = form.RegoVersion
+		} else {
+			attr["regoVersion"] = policy.RegoVersionV0
+		}
+	}
 	return attr
 }
 
@@ -431,6 +523,8 @@ func SearchGroupOfPolicy(c *ctx.ServiceContext, form *forms.SearchGroupOfPolicyF
 
 type PolicyGroupScanReportResp struct {
 	PassedRate PolylinePercent `json:"passedRate"` // 检测通过率
+
+	Watermark *services.ReportWatermark `json:"watermark,omitempty"` // 审计员导出时记录导出人
 }
 
 func PolicyGroupScanReport(c *ctx.ServiceContext, form *forms.PolicyScanReportForm) (*PolicyGroupScanReportResp, e.Error) {
@@ -478,6 +572,9 @@ func PolicyGroupScanReport(c *ctx.ServiceContext, form *forms.PolicyScanReportFo
 		}
 	}
 
+	if report.Watermark, err = services.NewReportWatermark(c.DB(), c.UserId, c.OrgId); err != nil {
+		return nil, err
+	}
 	return &report, nil
 }
 
@@ -491,28 +588,8 @@ type RegistryPGResp struct {
 }
 
 func SearchRegistryPG(c *ctx.ServiceContext, form *forms.SearchRegistryPgForm) (interface{}, e.Error) {
-	// registry 侧接口的返回格式
-	type registryPG struct {
-		Id        string `json:"id"`
-		Namespace string `json:"namespace"`
-		Name      string `json:"name"`
-		Label     string `json:"label"`
-		RepoPath  string `json:"repoPath"`
-	}
-
-	type registryResult struct {
-		Page     int          `json:"page"`
-		PageSize int          `json:"pageSize"`
-		Total    int64        `json:"total"`
-		List     []registryPG `json:"list"`
-	}
-
-	rr := registryResult{}
-	val := url.Values{}
-	val.Add("q", form.Q)
-	val.Add("pageSize", fmt.Sprintf("%d", form.PageSize()))
-	val.Add("page", fmt.Sprintf("%d", form.CurrentPage()))
-	if err := services.RegistryGet("iac/policy_groups", val, &rr); err != nil {
+	rr, err := services.SearchRegistryPolicyGroups(form.Q, form.CurrentPage(), form.PageSize())
+	if err != nil {
 		return nil, e.AutoNew(err, e.RegistryServiceErr)
 	}
 
@@ -546,19 +623,8 @@ type RegistryPGVerResp struct {
 }
 
 func SearchRegistryPGVersions(c *ctx.ServiceContext, form *forms.SearchRegistryPgVersForm) (interface{}, e.Error) {
-	type registryPgVer struct {
-		Id        models.Id `json:"id"`
-		Namespace string    `json:"namespace"`
-		GroupName string    `json:"groupName"`
-		GitTag    string    `json:"gitTag"`
-		CommitId  string    `json:"commitId"`
-	}
-
-	rvs := make([]registryPgVer, 0)
-	val := url.Values{}
-	val.Add("ns", form.Namespace)
-	val.Add("gn", form.GroupName)
-	if err := services.RegistryGet("iac/policy_groups/versions", val, &rvs); err != nil {
+	rvs, err := services.GetRegistryPolicyGroupVersions(form.Namespace, form.GroupName)
+	if err != nil {
 		return nil, e.AutoNew(err, e.RegistryServiceErr)
 	}
 
@@ -573,6 +639,65 @@ func SearchRegistryPGVersions(c *ctx.ServiceContext, form *forms.SearchRegistryP
 	return resp, nil
 }
 
+// ImportRegistryPG 从 registry 一键导入策略组，未指定版本时导入最新版本
+func ImportRegistryPG(c *ctx.ServiceContext, form *forms.ImportRegistryPgForm) (*models.PolicyGroup, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("import registry policy group %s/%s", form.Namespace, form.GroupName))
+
+	rg, err := services.GetRegistryPolicyGroup(form.Namespace, form.GroupName)
+	if err != nil {
+		return nil, e.AutoNew(err, e.RegistryServiceErr)
+	} else if rg == nil {
+		return nil, e.New(e.ObjectNotExists, fmt.Errorf("registry policy group %s/%s not found",
+			form.Namespace, form.GroupName), http.StatusNotFound)
+	}
+
+	versions, err := services.GetRegistryPolicyGroupVersions(form.Namespace, form.GroupName)
+	if err != nil {
+		return nil, e.AutoNew(err, e.RegistryServiceErr)
+	}
+	latest := services.LatestRegistryVersion(versions)
+	gitTag := form.GitTag
+	if gitTag == "" {
+		gitTag = latest
+	}
+	found := false
+	for _, v := range versions {
+		if v.GitTag == gitTag {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, e.New(e.ObjectNotExists, fmt.Errorf("version '%s' not found", gitTag), http.StatusNotFound)
+	}
+	ver, er := semver.NewVersion(gitTag)
+	if er != nil {
+		return nil, e.New(e.BadParam, fmt.Errorf("git tag is invalid semver"), http.StatusBadRequest)
+	}
+
+	vcs, err := services.GetRegistryVcs(c.DB())
+	if err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+
+	g := models.PolicyGroup{
+		Name:          utils.FirstValueStr(form.Name, rg.Name),
+		Label:         rg.Label,
+		Source:        consts.GitTypeRegistry,
+		VcsId:         vcs.Id,
+		RepoId:        rg.RepoPath,
+		GitTags:       gitTag,
+		Version:       ver.String(),
+		Dir:           consts.DirRoot,
+		OrgId:         c.OrgId,
+		CreatorId:     c.UserId,
+		RegoVersion:   policy.RegoVersionV0,
+		RegistryRef:   services.RegistryRef(form.Namespace, form.GroupName),
+		LatestVersion: latest,
+	}
+	return createPolicyGroupWithPolicies(c, &g)
+}
+
 func PolicyGroupChecks(c *ctx.ServiceContext, form *forms.PolicyGroupChecksForm) (interface{}, e.Error) {
 	vcs, err := services.QueryVcsByVcsId(form.VcsId, c.DB())
 
@@ -606,3 +731,22 @@ func PolicyGroupChecks(c *ctx.ServiceContext, form *forms.PolicyGroupChecksForm)
 		CheckResult: consts.TplTfCheckSuccess,
 	}, nil
 }
+
+// checkPolicyGroupEngine 检查修改后策略组的 opa 版本与 rego 语法版本组合是否合法
+func checkPolicyGroupEngine(c *ctx.ServiceContext, form *forms.UpdatePolicyGroupForm) e.Error {
+	pg, err := services.GetPolicyGroupById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil {
+		return err
+	}
+	opaVersion, regoVersion := pg.OpaVersion, pg.RegoVersion
+	if form.HasKey("opaVersion") {
+		opaVersion = form.OpaVersion
+	}
+	if form.HasKey("regoVersion") {
+		regoVersion = form.RegoVersion
+	}
+	if er := policy.ValidateEngine(opaVersion, regoVersion); er != nil {
+		return e.New(e.BadParam, er, http.StatusBadRequest)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+)
+
+// SearchPolicyGroupSync 查询策略组的同步历史，列表不返回策略变更明细
+func SearchPolicyGroupSync(c *ctx.ServiceContext, form *forms.SearchPolicyGroupSyncForm) (interface{}, e.Error) {
+	if _, err := services.GetPolicyGroupById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id); err != nil {
+		return nil, err
+	}
+
+	query := services.QueryPolicyGroupSync(services.QueryWithOrgId(c.DB(), c.OrgId)).
+		Where("group_id = ?", form.Id).Omit("changes")
+	if form.SortField() == "" {
+		query = query.Order("created_at DESC")
+	}
+	return getPage(query, form, models.PolicyGroupSync{})
+}
+
+// PolicyGroupSyncDetail 查询一次同步中各策略的 rego 及元数据变更
+func PolicyGroupSyncDetail(c *ctx.ServiceContext, form *forms.DetailPolicyGroupSyncForm) (*models.PolicyGroupSync, e.Error) {
+	return services.GetPolicyGroupSyncById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id, form.SyncId)
+}
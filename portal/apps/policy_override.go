@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// UpdatePolicySeverity 覆盖策略在当前组织内的严重性
+func UpdatePolicySeverity(c *ctx.ServiceContext, form *forms.UpdatePolicySeverityForm) (*models.OrgPolicyOverride, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update policy severity %s %s", form.Id, form.Severity))
+
+	if _, err := services.GetPolicyById(c.DB(), form.Id, c.OrgId); err != nil {
+		if err.Code() == e.PolicyNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+
+	return services.UpsertPolicySeverityOverride(c.DB(), models.OrgPolicyOverride{
+		CreatorId: c.UserId,
+		OrgId:     c.OrgId,
+		PolicyId:  form.Id,
+		Severity:  form.Severity,
+	})
+}
+
+// DeletePolicySeverity 删除严重性覆盖，恢复使用策略本身定义的严重性
+func DeletePolicySeverity(c *ctx.ServiceContext, form *forms.DeletePolicySeverityForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete policy severity override %s", form.Id))
+
+	if _, err := services.GetPolicyById(c.DB(), form.Id, c.OrgId); err != nil {
+		if err.Code() == e.PolicyNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	if err := services.DeletePolicySeverityOverride(c.DB(), c.OrgId, form.Id); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
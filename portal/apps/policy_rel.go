@@ -60,31 +60,67 @@ func EnablePolicyScanRel(c *ctx.ServiceContext, form *forms.EnableScanForm) (int
 		}
 	}
 
+	wasEnabled := false
+	if env != nil {
+		wasEnabled = env.PolicyEnable
+	} else {
+		wasEnabled = tpl.PolicyEnable
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	txWithOrg := services.QueryWithOrgId(tx, c.OrgId)
+
 	// 添加启用关联
-	attrs := models.Attrs{}
-	if form.Enabled {
-		attrs["policyEnable"] = true
-		if form.Scope == consts.ScopeEnv {
-			if _, err := services.UpdateEnv(query, env.Id, attrs); err != nil {
-				return nil, err
-			}
-		} else {
-			if _, err := services.UpdateTemplate(query, tpl.Id, attrs); err != nil {
-				return nil, err
-			}
+	attrs := models.Attrs{"policyEnable": form.Enabled}
+	if form.Scope == consts.ScopeEnv {
+		if _, err := services.UpdateEnv(txWithOrg, env.Id, attrs); err != nil {
+			_ = tx.Rollback()
+			return nil, err
 		}
 	} else {
-		if form.Scope == consts.ScopeEnv {
-			attrs["policyEnable"] = false
-			if _, err := services.UpdateEnv(query, env.Id, attrs); err != nil {
-				return nil, err
+		updated, err := services.UpdateTemplate(txWithOrg, tpl.Id, attrs)
+		if err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+		if _, err := services.CreateTemplateRevision(tx, tpl, updated, c.UserId, models.TplRevisionUpdate, 0); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	// 关闭检测时清理已有的扫描状态，避免列表中展示过期的检测结果
+	if !form.Enabled && wasEnabled {
+		if err := services.ResetPolicyScanState(txWithOrg, form.Scope, form.Id, services.GetPolicyDisableAction()); err != nil {
+			_ = tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	// 开启检测时自动触发一次扫描
+	if form.Enabled && !wasEnabled {
+		go func() {
+			var err e.Error
+			if form.Scope == consts.ScopeEnv {
+				_, err = ScanEnvironment(c, &forms.ScanEnvironmentForm{Id: env.Id})
+			} else {
+				_, err = ScanTemplateOrEnv(c, &forms.ScanTemplateForm{Id: tpl.Id}, "")
 			}
-		} else {
-			attrs["policyEnable"] = false
-			if _, err := services.UpdateTemplate(query, tpl.Id, attrs); err != nil {
-				return nil, err
+			if err != nil {
+				c.Logger().Errorf("open policy scan err: %v, %s id: %s", err, form.Scope, form.Id)
 			}
-		}
+		}()
 	}
 	return nil, nil
 }
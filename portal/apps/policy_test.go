@@ -0,0 +1,129 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeScanDB 只返回预设环境记录的数据库连接，记录事务的开启及结束次数
+type fakeScanDB struct {
+	envs             map[string][]driver.Value // 环境 id -> id, org_id, tpl_id, archived, policy_enable
+	begins, finishes int32
+}
+
+func (d *fakeScanDB) Connect(context.Context) (driver.Conn, error) { return &fakeScanConn{d}, nil }
+func (d *fakeScanDB) Driver() driver.Driver                        { return nil }
+
+type fakeScanConn struct{ d *fakeScanDB }
+
+func (c *fakeScanConn) Prepare(string) (driver.Stmt, error) { return nil, fmt.Errorf("not supported") }
+func (c *fakeScanConn) Close() error                        { return nil }
+func (c *fakeScanConn) Begin() (driver.Tx, error) {
+	atomic.AddInt32(&c.d.begins, 1)
+	return c, nil
+}
+func (c *fakeScanConn) Commit() error {
+	atomic.AddInt32(&c.d.finishes, 1)
+	return nil
+}
+func (c *fakeScanConn) Rollback() error {
+	atomic.AddInt32(&c.d.finishes, 1)
+	return nil
+}
+
+func (c *fakeScanConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeScanConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows := &fakeScanRows{cols: []string{"id", "org_id", "tpl_id", "archived", "policy_enable"}}
+	if strings.Contains(query, "`iac_env`") {
+		for _, arg := range args {
+			if env, ok := c.d.envs[fmt.Sprint(arg.Value)]; ok {
+				rows.values = append(rows.values, env)
+				break
+			}
+		}
+	}
+	// 云模板均不存在
+	return rows, nil
+}
+
+type fakeScanRows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *fakeScanRows) Columns() []string { return r.cols }
+func (r *fakeScanRows) Close() error      { return nil }
+func (r *fakeScanRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestScanEnvironmentsRollback(t *testing.T) {
+	fake := &fakeScanDB{envs: map[string][]driver.Value{
+		"env-archived": {"env-archived", "org-1", "tpl-1", true, true},
+		"env-disabled": {"env-disabled", "org-1", "tpl-1", false, false},
+		"env-notpl":    {"env-notpl", "org-1", "tpl-1", false, true},
+	}}
+	if err := db.InitWithConn(sql.OpenDB(fake)); err != nil {
+		t.Fatal(err)
+	}
+
+	gc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c := ctx.NewGinRequest(gc).Service()
+	c.OrgId = "org-1"
+
+	ids := []models.Id{"env-archived", "env-missing", "env-disabled", "env-notpl"}
+	results, err := ScanEnvironments(c, &forms.ScanEnvironmentForms{Ids: ids})
+	assert.Nil(t, err)
+	assert.Len(t, results, len(ids))
+
+	codes := make([]int, 0, len(results))
+	for _, r := range results {
+		assert.Nil(t, r.Task)
+		codes = append(codes, r.Code)
+	}
+	assert.Equal(t, []int{e.EnvArchived, e.EnvNotExists, e.PolicyScanNotEnabled, e.TemplateNotExists}, codes)
+	// 每个环境发起失败后都需要结束事务，不能占用连接
+	assert.Equal(t, int32(len(ids)), fake.begins)
+	assert.Equal(t, fake.begins, fake.finishes)
+}
+
+func TestPolicyResultRegoNotFound(t *testing.T) {
+	if err := db.InitWithConn(sql.OpenDB(&fakeScanDB{})); err != nil {
+		t.Fatal(err)
+	}
+	gc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c := ctx.NewGinRequest(gc).Service()
+	c.OrgId = "org-1"
+
+	r, err := PolicyResultRego(c, &forms.PolicyResultRegoForm{Id: 1})
+	assert.Nil(t, r)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.ObjectNotExists, err.Code())
+		assert.Equal(t, 404, err.Status())
+	}
+}
@@ -76,7 +76,8 @@ type ProjectResp struct {
 
 func SearchProject(c *ctx.ServiceContext, form *forms.SearchProjectForm) (interface{}, e.Error) {
 	query := services.SearchProject(c.DB(), c.OrgId, form.Q, form.Status)
-	if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+	if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) &&
+		!services.UserIsOrgAuditor(c.UserId, c.OrgId) {
 		projectIds, err := services.GetProjectsByUserOrg(query, c.UserId, c.OrgId)
 		if err != nil {
 			c.Logger().Errorf("error get projects, err %s", err)
@@ -177,6 +178,8 @@ type ProjectStatistics struct {
 	EnvActive   int64 `json:"envActive" form:"envActive" `
 	EnvFailed   int64 `json:"envFailed" form:"envFailed" `
 	EnvInactive int64 `json:"envInactive" form:"envInactive" `
+
+	EnvAttestationOverdue int64 `json:"envAttestationOverdue" form:"envAttestationOverdue" ` // 合规声明已逾期的环境数量
 }
 
 func DetailProject(c *ctx.ServiceContext, form *forms.DetailProjectForm) (interface{}, e.Error) {
@@ -214,6 +217,11 @@ func DetailProject(c *ctx.ServiceContext, form *forms.DetailProjectForm) (interf
 		_ = tx.Rollback()
 		return nil, e.New(e.DBError, er)
 	}
+	overdueCount, er := services.CountAttestationOverdueEnvs(tx, form.Id)
+	if er != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, er)
+	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -228,6 +236,8 @@ func DetailProject(c *ctx.ServiceContext, form *forms.DetailProjectForm) (interf
 			EnvActive:   envResp.EnvActive,
 			EnvFailed:   envResp.EnvFailed,
 			EnvInactive: envResp.EnvInactive,
+
+			EnvAttestationOverdue: overdueCount,
 		},
 	}, nil
 }
@@ -0,0 +1,79 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+type ProjectQuotaResp struct {
+	models.ProjectQuota
+	Usage services.ProjectQuotaUsage `json:"usage"` // 配额的使用情况
+}
+
+func getOrgProject(query *db.Session, orgId, projectId models.Id) (*models.Project, e.Error) {
+	project := models.Project{}
+	if err := services.QueryWithOrgId(query, orgId).Where("id = ?", projectId).First(&project); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ProjectNotExists, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &project, nil
+}
+
+// ProjectQuota 项目配额及使用情况
+func ProjectQuota(c *ctx.ServiceContext, form *forms.ProjectQuotaForm) (*ProjectQuotaResp, e.Error) {
+	project, err := getOrgProject(c.DB(), c.OrgId, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := services.GetProjectQuotaUsage(c.DB(), project.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &ProjectQuotaResp{ProjectQuota: project.ProjectQuota, Usage: *usage}, nil
+}
+
+// UpdateProjectQuota 修改项目配额，已超出配额的项目不受影响，只限制之后新建环境及增加资源或费用的部署
+func UpdateProjectQuota(c *ctx.ServiceContext, form *forms.UpdateProjectQuotaForm) (*ProjectQuotaResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update project %s quota", form.Id))
+
+	project, err := getOrgProject(c.DB(), c.OrgId, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	quota := project.ProjectQuota
+	if form.HasKey("quotaMaxEnvs") {
+		quota.QuotaMaxEnvs = form.QuotaMaxEnvs
+	}
+	if form.HasKey("quotaMaxResources") {
+		quota.QuotaMaxResources = form.QuotaMaxResources
+	}
+	if form.HasKey("quotaMaxMonthlyCost") {
+		quota.QuotaMaxMonthlyCost = form.QuotaMaxMonthlyCost
+	}
+	if form.HasKey("quotaAction") {
+		quota.QuotaAction = form.QuotaAction
+	}
+	if err := services.ValidateProjectQuota(&quota); err != nil {
+		return nil, err
+	}
+
+	if err := services.UpdateProject(c.DB(), project, models.Attrs{
+		"quota_max_envs":         quota.QuotaMaxEnvs,
+		"quota_max_resources":    quota.QuotaMaxResources,
+		"quota_max_monthly_cost": quota.QuotaMaxMonthlyCost,
+		"quota_action":           quota.QuotaAction,
+	}); err != nil {
+		return nil, err
+	}
+	return ProjectQuota(c, &forms.ProjectQuotaForm{Id: project.Id})
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SearchRunnerPool 查询 runner 池中的 runner 及其健康状态
+func SearchRunnerPool(c *ctx.ServiceContext, form *forms.SearchRunnerPoolForm) ([]*models.Runner, e.Error) {
+	query := services.QueryRunners(c.DB())
+	if form.Status != "" {
+		query = query.Where("status = ?", form.Status)
+	}
+	runners := make([]*models.Runner, 0)
+	if err := query.Find(&runners); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if !form.Available {
+		return runners, nil
+	}
+
+	now := time.Now()
+	result := make([]*models.Runner, 0, len(runners))
+	for _, r := range runners {
+		if r.Available(now) {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// RegisterRunner 注册 runner 到 consul 并加入 runner 池
+func RegisterRunner(c *ctx.ServiceContext, form *forms.RegisterRunnerForm) (*models.Runner, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("register runner %s", form.ServiceId))
+
+	var (
+		r   *models.Runner
+		err e.Error
+	)
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		r, err = services.RegisterRunner(tx, form.ServiceId, form.Address, form.Port, form.Tags)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// EnableRunner 启用 runner
+func EnableRunner(c *ctx.ServiceContext, form *forms.ChangeRunnerStatusForm) (*models.Runner, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("enable runner %s", form.Id))
+	return setRunnerDisabled(c, form.Id, false)
+}
+
+// DisableRunner 禁用 runner，禁用后不再分配新任务，已分配且还未开始执行的任务会调度到其他 runner
+func DisableRunner(c *ctx.ServiceContext, form *forms.ChangeRunnerStatusForm) (*models.Runner, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("disable runner %s", form.Id))
+	return setRunnerDisabled(c, form.Id, true)
+}
+
+// UpdateRunnerBindings 设置 runner 绑定的组织及项目，绑定后 runner 只执行这些组织或项目的任务
+func UpdateRunnerBindings(c *ctx.ServiceContext, form *forms.UpdateRunnerBindingsForm) (*models.Runner, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update runner %s bindings", form.Id))
+
+	orgIds := make([]string, 0, len(form.OrgIds))
+	for _, id := range form.OrgIds {
+		if _, err := services.GetOrganizationById(c.DB(), id); err != nil {
+			if err.Code() == e.OrganizationNotExists {
+				return nil, e.New(err.Code(), err, http.StatusBadRequest)
+			}
+			return nil, err
+		}
+		orgIds = append(orgIds, id.String())
+	}
+	projectIds := make([]string, 0, len(form.ProjectIds))
+	for _, id := range form.ProjectIds {
+		if _, err := services.GetProjectsById(c.DB(), id); err != nil {
+			if e.IsRecordNotFound(err) {
+				return nil, e.New(e.ProjectNotExists, err, http.StatusBadRequest)
+			}
+			return nil, err
+		}
+		projectIds = append(projectIds, id.String())
+	}
+
+	r, err := services.SetRunnerBindings(c.DB(), form.Id, orgIds, projectIds)
+	if err != nil {
+		if err.Code() == e.RunnerNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+func setRunnerDisabled(c *ctx.ServiceContext, id models.Id, disabled bool) (*models.Runner, e.Error) {
+	r, err := services.SetRunnerDisabled(c.DB(), id, disabled)
+	if err != nil {
+		if err.Code() == e.RunnerNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// SearchRunnerPluginCache 查询 runner 的 provider 缓存
+func SearchRunnerPluginCache(c *ctx.ServiceContext, form *forms.SearchRunnerPluginCacheForm) ([]runner.CachedProvider, e.Error) {
+	r, err := getRunner(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.ListRunnerCachedProviders(r)
+}
+
+// PrewarmRunnerPluginCache 预热 runner 的 provider 缓存，下载指定的 provider 后任务执行 init 时不再重复下载
+func PrewarmRunnerPluginCache(c *ctx.ServiceContext, form *forms.PrewarmRunnerPluginCacheForm) (*runner.PluginCachePrewarmResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("prewarm runner %s plugin cache", form.Id))
+
+	r, err := getRunner(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.PrewarmRunnerPluginCache(r, runner.PluginCachePrewarmReq{
+		Providers:  form.Providers,
+		EngineType: form.EngineType,
+		TfVersion:  form.TfVersion,
+	})
+}
+
+func getRunner(c *ctx.ServiceContext, id models.Id) (*models.Runner, e.Error) {
+	r, err := services.GetRunnerById(c.DB(), id)
+	if err != nil {
+		if err.Code() == e.RunnerNotExist {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	return r, nil
+}
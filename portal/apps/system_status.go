@@ -4,8 +4,10 @@ package apps
 
 import (
 	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
+	"time"
 )
 
 type SystemStatusResp struct {
@@ -93,3 +95,12 @@ func ConsulTagUpdate(form forms.ConsulTagUpdateForm) (interface{}, e.Error) {
 	}
 	return nil, nil
 }
+
+// SchedulerStats 查询每个组织的任务调度统计，包括正在执行及排队的任务数量、实际占用比例、按权重应占的比例以及排队时长
+func SchedulerStats(c *ctx.ServiceContext, form *forms.SchedulerStatsForm) (interface{}, e.Error) {
+	hours := 24
+	if form.Hours > 0 {
+		hours = form.Hours
+	}
+	return services.TenantSchedulerStats(c.DB(), time.Now().Add(-time.Duration(hours)*time.Hour))
+}
@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
 	"cloudiac/portal/libs/page"
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
@@ -22,6 +23,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 	"errors"
 
 	"github.com/gin-contrib/sse"
@@ -56,6 +58,38 @@ func SearchTask(c *ctx.ServiceContext, form *forms.SearchTaskForm) (interface{},
 	}, nil
 }
 
+// SearchEnvTasksByCursor 按创建时间倒序查询环境的部署历史，使用游标分页
+func SearchEnvTasksByCursor(c *ctx.ServiceContext, form *forms.SearchEnvTasksCursorForm) (*page.CursorResp, e.Error) {
+	query := services.QueryWithProjectId(services.QueryWithOrgId(services.QueryTask(c.DB()), c.OrgId, models.Task{}.TableName()),
+		c.ProjectId, models.Task{}.TableName())
+	query = query.Where("iac_task.env_id = ?", form.Id)
+	if form.Cursor != "" {
+		values, er := page.DecodeCursor(form.Cursor, 2)
+		if er != nil {
+			return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+		}
+		query = query.Where("iac_task.created_at < ? OR (iac_task.created_at = ? AND iac_task.id < ?)",
+			values[0], values[0], values[1])
+	}
+
+	details := make([]*taskDetailResp, 0)
+	if err := query.Order("iac_task.created_at DESC, iac_task.id DESC").Limit(form.Limit() + 1).Scan(&details); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	resp := &page.CursorResp{}
+	if len(details) > form.Limit() {
+		details = details[:form.Limit()]
+		last := details[len(details)-1]
+		resp.NextCursor = page.EncodeCursor(time.Time(last.CreatedAt).Format("2006-01-02 15:04:05"), last.Id.String())
+	}
+	for _, t := range details {
+		t.HideSensitiveVariable()
+	}
+	resp.List = details
+	return resp, nil
+}
+
 type taskDetailResp struct {
 	models.Task
 	Creator string `json:"creator" example:"超级管理员"`
@@ -198,20 +232,86 @@ func ApproveTask(c *ctx.ServiceContext, form *forms.ApproveTaskForm) (interface{
 		return nil, e.New(e.TaskApproveNotPending, http.StatusBadRequest)
 	}
 
-	// 更新审批状态
-	step.ApproverId = c.UserId
-	switch form.Action {
-	case forms.TaskActionApproved:
-		err = services.ApproveTaskStep(c.DB(), task.Id, step.Index, c.UserId)
-	case forms.TaskActionRejected:
-		err = services.RejectTaskStep(c.DB(), task.Id, step.Index, c.UserId)
+	// 超出资源规模限制的任务只有组织管理员可以审批通过
+	if form.Action == forms.TaskActionApproved && len(task.GuardrailViolations) > 0 &&
+		!c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+		return nil, e.New(e.TaskGuardrailApproval, fmt.Errorf("guardrail violations: %v", task.GuardrailViolations),
+			http.StatusForbidden)
 	}
+
+	tpl, err := getTaskTemplate(c, task)
+	if err != nil {
+		return nil, err
+	}
+	// 云模板指定了审批人时只有指定的审批人可以审批通过部署任务
+	if form.Action == forms.TaskActionApproved {
+		if err := checkTplApprover(c, task, tpl); err != nil {
+			return nil, err
+		}
+	}
+
+	// 保存审批记录，任一审批人驳回即驳回该步骤，通过审批的人数达到要求后步骤通过审批
+	status := TaskApprovalStatus{
+		Status:            models.TaskApproving,
+		RequiredApprovals: services.TaskRequiredApprovals(tpl, task.Type),
+	}
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		if _, err = services.CreateTaskApproval(tx, task, step.Index, c.UserId, form.Action, form.Comment); err != nil {
+			return err
+		}
+		index := step.Index
+		event := models.TaskEvent{Type: models.TaskEventApproved, Step: &index, StepType: step.Type, StepName: step.Name,
+			UserId: c.UserId, Message: form.Comment}
+		if form.Action == forms.TaskActionRejected {
+			event.Type = models.TaskEventRejected
+		}
+		services.RecordTaskEvent(tx, task, event)
+		if form.Action == forms.TaskActionRejected {
+			status.Status = models.TaskApprovalRejected
+			err = services.RejectTaskStep(tx, task.Id, step.Index, c.UserId, form.Comment)
+			return err
+		}
+		if status.Approvals, err = services.CountTaskStepApprovals(tx, task.Id, step.Index); err != nil {
+			return err
+		}
+		if status.Approvals >= status.RequiredApprovals {
+			status.Status = models.TaskApprovalApproved
+			err = services.ApproveTaskStep(tx, task.Id, step.Index, c.UserId)
+		}
+		return err
+	})
 	if err != nil {
 		c.Logger().Errorf("error approve task, err %s", err)
+		if err.Code() == e.TaskAlreadyApproved {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// getTaskTemplate 查询任务所属的云模板，云模板已删除时返回 nil
+func getTaskTemplate(c *ctx.ServiceContext, task *models.Task) (*models.Template, e.Error) {
+	tpl, err := services.GetTemplateById(c.DB(), task.TplId)
+	if err != nil && err.Code() == e.TemplateNotExists {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
+	return tpl, nil
+}
 
-	return nil, nil
+// checkTplApprover 检查当前用户是否为任务所属云模板的指定审批人
+func checkTplApprover(c *ctx.ServiceContext, task *models.Task, tpl *models.Template) e.Error {
+	if !services.TemplateRequiresApproval(tpl, task.Type) {
+		return nil
+	}
+	if !services.IsTemplateApprover(tpl.RequiredApprovers, c.UserId, task.OrgId, task.ProjectId) {
+		return e.New(e.TaskTplApproverRequired, fmt.Errorf("user is not a required approver of template"),
+			http.StatusForbidden)
+	}
+	return nil
 }
 
 func getTask(sc *ctx.ServiceContext, id models.Id) (models.Tasker, e.Error) {
@@ -260,6 +360,7 @@ func FollowTaskLog(c *ctx.GinRequest, form forms.TaskLogForm) e.Error {
 		return er
 	}
 
+	redactor := taskLogRedactor(sc, tasker)
 	pr, pw := io.Pipe()
 	go startTaskLog(rCtx, tasker, pw, form, logger)
 
@@ -269,7 +370,7 @@ func FollowTaskLog(c *ctx.GinRequest, form forms.TaskLogForm) e.Error {
 		c.Render(-1, sse.Event{
 			Id:    strconv.Itoa(eventId),
 			Event: "message",
-			Data:  scanner.Text(),
+			Data:  redactor.Redact(scanner.Text()),
 		})
 		c.Writer.Flush()
 		eventId += 1
@@ -380,9 +481,30 @@ func GetTaskStep(c *ctx.ServiceContext, form *forms.GetTaskStepLogForm) (interfa
 	if err != nil {
 		return nil, err
 	}
+	if services.UserIsOrgAuditor(c.UserId, c.OrgId) {
+		step, er := services.GetTaskStepByStepId(c.DB(), form.StepId)
+		if er != nil {
+			return nil, e.AutoNew(er, e.DBError)
+		}
+		if task, err := services.GetTask(c.DB(), step.TaskId); err == nil {
+			return taskLogRedactor(c, task).Redact(string(content)), nil
+		}
+	}
 	return string(content), nil
 }
 
+// taskLogRedactor 审计员查看任务日志时隐藏敏感变量的值，其他用户返回 nil
+func taskLogRedactor(c *ctx.ServiceContext, tasker models.Tasker) *services.LogRedactor {
+	if !services.UserIsOrgAuditor(c.UserId, c.OrgId) {
+		return nil
+	}
+	task, ok := tasker.(*models.Task)
+	if !ok {
+		return nil
+	}
+	return services.NewLogRedactor(task.Variables)
+}
+
 // SearchTaskResourcesGraph 查询环境资源列表
 func SearchTaskResourcesGraph(c *ctx.ServiceContext, form *forms.SearchTaskResourceGraphForm) (interface{}, e.Error) {
 	if c.OrgId == "" || c.ProjectId == "" || form.Id == "" {
@@ -0,0 +1,125 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"net/http"
+)
+
+// TaskApprovalStatus 任务当前步骤的审批进度
+type TaskApprovalStatus struct {
+	Status            string `json:"status" enums:"approving,approved,rejected"` // approving 表示还需要其他审批人审批
+	Approvals         int    `json:"approvals"`                                  // 已通过审批的人数
+	RequiredApprovals int    `json:"requiredApprovals"`                          // 需要通过审批的人数
+}
+
+type TaskApprovalResp struct {
+	models.TaskApproval
+
+	UserName string `json:"userName"` // 审批人名称
+}
+
+type TaskApprovalsResp struct {
+	RequiredApprovals int                 `json:"requiredApprovals"` // 需要通过审批的人数
+	Approvals         []*TaskApprovalResp `json:"approvals"`         // 审批记录
+}
+
+type PendingApprovalResp struct {
+	models.Task
+
+	EnvName           string `json:"envName"`
+	ProjectName       string `json:"projectName"`
+	Approvals         int    `json:"approvals"`         // 当前步骤已通过审批的人数
+	RequiredApprovals int    `json:"requiredApprovals"` // 需要通过审批的人数
+}
+
+// SearchTaskApprovals 查询任务的审批记录
+func SearchTaskApprovals(c *ctx.ServiceContext, form *forms.SearchTaskApprovalForm) (*TaskApprovalsResp, e.Error) {
+	taskQuery := services.QueryWithProjectId(services.QueryWithOrgId(c.DB(), c.OrgId), c.ProjectId)
+	task, err := services.GetTask(taskQuery, form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	tpl, err := getTaskTemplate(c, task)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := make([]*TaskApprovalResp, 0)
+	if err := services.QueryTaskApprovals(c.DB(), task.Id).Scan(&approvals); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &TaskApprovalsResp{
+		RequiredApprovals: services.TaskRequiredApprovals(tpl, task.Type),
+		Approvals:         approvals,
+	}, nil
+}
+
+// SearchPendingApprovals 查询组织下等待当前用户审批的任务，
+// 只返回用户有权限审批且还未审批过当前步骤的任务
+func SearchPendingApprovals(c *ctx.ServiceContext, form *forms.SearchPendingApprovalForm) ([]*PendingApprovalResp, e.Error) {
+	query := services.QueryPendingApprovalTasks(c.DB(), c.OrgId, c.UserId)
+	if form.ProjectId != "" {
+		query = query.Where("iac_task.project_id = ?", form.ProjectId)
+	}
+	tasks := make([]*PendingApprovalResp, 0)
+	if err := query.Scan(&tasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	tpls := make(map[models.Id]*models.Template)
+	result := make([]*PendingApprovalResp, 0, len(tasks))
+	for _, t := range tasks {
+		tpl, ok := tpls[t.TplId]
+		if !ok {
+			var err e.Error
+			if tpl, err = getTaskTemplate(c, &t.Task); err != nil {
+				return nil, err
+			}
+			tpls[t.TplId] = tpl
+		}
+		if !canApproveTask(c, &t.Task, tpl) {
+			continue
+		}
+		t.RequiredApprovals = services.TaskRequiredApprovals(tpl, t.Type)
+		result = append(result, t)
+	}
+
+	ts := make([]*models.Task, 0, len(result))
+	for _, t := range result {
+		ts = append(ts, &t.Task)
+	}
+	counts, err := services.GetTasksApprovalCount(c.DB(), ts)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range result {
+		t.Approvals = counts[t.Id]
+	}
+	return result, nil
+}
+
+// canApproveTask 用户是否可以审批通过任务：需要为组织管理员或项目的管理者、审批者，
+// 超出资源规模限制的任务只有组织管理员可以审批，云模板指定了审批人时还需要是指定的审批人
+func canApproveTask(c *ctx.ServiceContext, task *models.Task, tpl *models.Template) bool {
+	isAdmin := c.IsSuperAdmin || services.UserHasOrgRole(c.UserId, task.OrgId, consts.OrgRoleAdmin)
+	if !isAdmin &&
+		!services.UserHasProjectRole(c.UserId, task.OrgId, task.ProjectId, consts.ProjectRoleManager) &&
+		!services.UserHasProjectRole(c.UserId, task.OrgId, task.ProjectId, consts.ProjectRoleApprover) {
+		return false
+	}
+	if len(task.GuardrailViolations) > 0 && !isAdmin {
+		return false
+	}
+	return !services.TemplateRequiresApproval(tpl, task.Type) ||
+		services.IsTemplateApprover(tpl.RequiredApprovers, c.UserId, task.OrgId, task.ProjectId)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// SearchTaskArtifacts 查询任务步骤发布的产物
+func SearchTaskArtifacts(c *ctx.ServiceContext, form *forms.SearchTaskArtifactForm) ([]*models.TaskArtifact, e.Error) {
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	artifacts := make([]*models.TaskArtifact, 0)
+	if err := services.QueryTaskArtifacts(c.DB(), task.Id).Find(&artifacts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return artifacts, nil
+}
+
+// DownloadTaskArtifact 下载任务产物，返回产物信息及文件内容
+func DownloadTaskArtifact(c *ctx.ServiceContext, form *forms.DownloadTaskArtifactForm) (*models.TaskArtifact, []byte, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("download task %s artifact %s", form.Id, form.ArtifactId))
+
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	artifact, err := services.GetTaskArtifact(c.DB(), task.Id, form.ArtifactId)
+	if err != nil {
+		if err.Code() == e.TaskArtifactNotExists {
+			return nil, nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+
+	content, er := logstorage.Get().Read(artifact.Path)
+	if er != nil {
+		if os.IsNotExist(er) {
+			return nil, nil, e.New(e.TaskArtifactNotExists, er, http.StatusNotFound)
+		}
+		return nil, nil, e.New(e.InternalError, er, http.StatusInternalServerError)
+	}
+	return artifact, content, nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/utils"
+	"fmt"
+)
+
+// CancelTask 取消任务。执行中的任务会先中断 terraform 执行(使其释放 state 锁)，
+// 超过等待时间后 runner 强制停止任务容器，任务最终状态为 cancelled
+func CancelTask(c *ctx.ServiceContext, form *forms.CancelTaskForm) (*models.Task, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("cancel task %s", form.Id))
+
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.CancelTask(c.DB(), task, c.UserId); err != nil {
+		return nil, err
+	}
+
+	if task.Status == models.TaskRunning {
+		step, err := services.GetTaskStep(c.DB(), task.Id, task.CurrStep)
+		if err != nil {
+			return nil, err
+		}
+		// 步骤未在执行时由 task manager 在启动下一步骤前取消任务
+		if step.Status == models.TaskStepRunning {
+			gracePeriod := utils.FirstValueInt(form.GracePeriod, services.GetTaskCancelGracePeriod())
+			logger := c.Logger().WithField("taskId", task.Id)
+			go func() {
+				resp, err := services.CancelTaskOnRunner(task, step.Index, gracePeriod)
+				if err != nil {
+					logger.Errorf("cancel task on runner: %v", err)
+					return
+				}
+				logger.Infof("task step %d cancelled, graceful: %v", step.Index, resp.Graceful)
+			}()
+		}
+	}
+	return services.GetTask(c.DB(), task.Id)
+}
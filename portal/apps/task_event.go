@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"time"
+)
+
+// TaskTimeline 任务执行时间线，包含任务生命周期中的所有事件及各阶段的耗时
+func TaskTimeline(c *ctx.ServiceContext, form *forms.TaskTimelineForm) (*services.TaskTimeline, e.Error) {
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]*models.TaskEvent, 0)
+	if err := services.QueryTaskEvents(c.DB(), task.Id).Find(&events); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return services.BuildTaskTimeline(events, time.Now()), nil
+}
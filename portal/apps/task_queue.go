@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"time"
+)
+
+// SearchTaskQueue 查询各 runner 及组织排队中的任务及预计开始时间
+func SearchTaskQueue(c *ctx.ServiceContext, form *forms.SearchTaskQueueForm) (*services.TaskQueue, e.Error) {
+	return services.GetTaskQueue(c.DB(), form.RunnerId, form.OrgId, time.Now())
+}
+
+// UpdateTaskQueuePriority 调整排队中任务的调度优先级
+func UpdateTaskQueuePriority(c *ctx.ServiceContext, form *forms.UpdateTaskQueuePriorityForm) (models.Tasker, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update queued task %s priority to %d", form.Id, form.Priority))
+	return services.UpdateQueuedTaskPriority(c.DB(), form.Id, form.Priority)
+}
+
+// CancelQueuedTask 取消排队中的任务
+func CancelQueuedTask(c *ctx.ServiceContext, form *forms.CancelQueuedTaskForm) (models.Tasker, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("cancel queued task %s", form.Id))
+	return services.CancelQueuedTask(c.DB(), form.Id, c.UserId)
+}
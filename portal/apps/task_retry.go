@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+)
+
+// RetryTask 从失败的步骤重试任务，已成功执行的步骤不再重复执行
+func RetryTask(c *ctx.ServiceContext, form *forms.RetryTaskForm) (*models.Task, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("retry task %s", form.Id))
+
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	env, err := services.GetEnvById(c.DB(), task.EnvId)
+	if err != nil {
+		return nil, err
+	}
+	if er := services.CheckEnvLock(env, task.Type, c.UserId); er != nil {
+		return nil, er
+	}
+	if er := services.CheckEnvAttestation(env, task.Type); er != nil {
+		return nil, er
+	}
+	if er := services.CheckEnvProtection(env, task); er != nil {
+		return nil, er
+	}
+
+	var retried *models.Task
+	_ = c.DB().Transaction(func(tx *db.Session) error {
+		retried, err = services.RetryTaskFromFailedStep(tx, task)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return retried, nil
+}
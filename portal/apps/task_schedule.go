@@ -0,0 +1,61 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// parseTaskScheduledAt 解析任务的计划执行时间，未指定时返回 nil
+func parseTaskScheduledAt(form forms.TaskScheduleForm) (*models.Time, e.Error) {
+	if form.ScheduledAt == "" {
+		return nil, nil
+	}
+	t, err := models.Time{}.Parse(form.ScheduledAt)
+	if err != nil {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid scheduledAt: %v", err), http.StatusBadRequest)
+	}
+	if !time.Time(t).After(time.Now()) {
+		return nil, e.New(e.BadParam, fmt.Errorf("scheduledAt must be in the future"), http.StatusBadRequest)
+	}
+	return &t, nil
+}
+
+// SearchScheduledTask 查询项目下等待计划执行的任务，按计划执行时间排序
+func SearchScheduledTask(c *ctx.ServiceContext, form *forms.SearchScheduledTaskForm) (interface{}, e.Error) {
+	query := services.QueryScheduledTask(services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId))
+	if form.EnvId != "" {
+		query = query.Where("env_id = ?", form.EnvId)
+	}
+	if form.SortField() == "" {
+		query = query.Order("scheduled_at")
+	}
+	return getPage(query, form, models.Task{})
+}
+
+// CancelScheduledTask 取消等待计划执行的任务
+func CancelScheduledTask(c *ctx.ServiceContext, form *forms.CancelScheduledTaskForm) (*models.Task, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("cancel scheduled task %s", form.Id))
+
+	task, err := services.GetTask(services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId), form.Id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, err
+	}
+	if err := services.CancelScheduledTask(c.DB(), task, c.Username); err != nil {
+		if err.Code() == e.TaskNotScheduled {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	return task, nil
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+)
+
+// SearchTaskStepAttempts 任务步骤自动重试前的失败执行记录
+func SearchTaskStepAttempts(c *ctx.ServiceContext, form *forms.SearchTaskStepAttemptForm) ([]*models.TaskStepAttempt, e.Error) {
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]*models.TaskStepAttempt, 0)
+	if err := services.QueryTaskStepAttempts(c.DB(), task.Id).Find(&attempts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return attempts, nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// getProjectTask 查询当前项目下的部署任务
+func getProjectTask(c *ctx.ServiceContext, id models.Id) (*models.Task, e.Error) {
+	if c.OrgId == "" || c.ProjectId == "" {
+		return nil, e.New(e.BadRequest, http.StatusBadRequest)
+	}
+	task, err := services.GetTask(services.QueryWithOrgProject(c.DB(), c.OrgId, c.ProjectId), id)
+	if err != nil {
+		if err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
+	}
+	return task, nil
+}
+
+// TaskVariables 任务使用的变量快照，敏感变量只返回占位符
+func TaskVariables(c *ctx.ServiceContext, form *forms.TaskVariablesForm) (*models.TaskVarSnapshot, e.Error) {
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.GetTaskVarSnapshot(c.DB(), task)
+}
+
+type TaskVarsDiffResp struct {
+	BaseTaskId       models.Id                 `json:"baseTaskId"`
+	TaskId           models.Id                 `json:"taskId"`
+	BaseTfVarsFile   string                    `json:"baseTfVarsFile"`
+	TfVarsFile       string                    `json:"tfVarsFile"`
+	BasePlayVarsFile string                    `json:"basePlayVarsFile"`
+	PlayVarsFile     string                    `json:"playVarsFile"`
+	Changes          []*services.TaskVarChange `json:"changes"` // 相对于基准任务的变量变化
+}
+
+// DiffTaskVariables 比较任务与基准任务使用的变量，未指定基准任务时与同一环境的上一个任务比较
+func DiffTaskVariables(c *ctx.ServiceContext, form *forms.DiffTaskVariablesForm) (*TaskVarsDiffResp, e.Error) {
+	task, err := getProjectTask(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *models.Task
+	if form.BaseTaskId != "" {
+		base, err = getProjectTask(c, form.BaseTaskId)
+	} else {
+		base, err = services.GetPreviousEnvTask(c.DB(), task)
+		if err != nil && err.Code() == e.TaskNotExists {
+			return nil, e.New(err.Code(), fmt.Errorf("no previous task of env %s", task.EnvId), http.StatusNotFound)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	baseSnapshot, err := services.GetTaskVarSnapshot(c.DB(), base)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := services.GetTaskVarSnapshot(c.DB(), task)
+	if err != nil {
+		return nil, err
+	}
+	return &TaskVarsDiffResp{
+		BaseTaskId:       base.Id,
+		TaskId:           task.Id,
+		BaseTfVarsFile:   baseSnapshot.TfVarsFile,
+		TfVarsFile:       snapshot.TfVarsFile,
+		BasePlayVarsFile: baseSnapshot.PlayVarsFile,
+		PlayVarsFile:     snapshot.PlayVarsFile,
+		Changes:          services.DiffTaskVarSnapshots(baseSnapshot, snapshot),
+	}, nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"context"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTaskWaitTimeout = 300 // 默认等待超时时间(秒)
+	taskWaitInterval       = 2 * time.Second
+)
+
+// WaitTask 阻塞等待部署任务结束，超时后返回任务当前状态
+func WaitTask(c *ctx.GinRequest, form *forms.WaitTaskForm) (*services.TaskWaitResult, e.Error) {
+	sc := c.Service()
+	return waitTask(c.Request.Context(), form.Timeout, func() (models.Tasker, e.Error) {
+		query := services.QueryWithProjectId(services.QueryWithOrgId(sc.DB(), sc.OrgId), sc.ProjectId)
+		return services.GetTask(query, form.Id)
+	})
+}
+
+// WaitScanTask 阻塞等待合规扫描任务结束，超时后返回任务当前状态
+func WaitScanTask(c *ctx.GinRequest, form *forms.WaitTaskForm) (*services.TaskWaitResult, e.Error) {
+	sc := c.Service()
+	return waitTask(c.Request.Context(), form.Timeout, func() (models.Tasker, e.Error) {
+		return services.GetScanTaskById(services.QueryWithOrgId(sc.DB(), sc.OrgId), form.Id)
+	})
+}
+
+func waitTask(rCtx context.Context, timeout int, get func() (models.Tasker, e.Error)) (*services.TaskWaitResult, e.Error) {
+	if timeout == 0 {
+		timeout = defaultTaskWaitTimeout
+	}
+	deadline := time.After(time.Duration(timeout) * time.Second)
+	ticker := time.NewTicker(taskWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		tasker, err := get()
+		if err != nil {
+			if err.Code() == e.TaskNotExists {
+				return nil, e.New(err.Code(), err, http.StatusNotFound)
+			}
+			return nil, err
+		}
+		if tasker.Exited() {
+			return services.NewTaskWaitResult(tasker), nil
+		}
+
+		select {
+		case <-rCtx.Done():
+			return nil, e.New(e.InternalError, rCtx.Err())
+		case <-deadline:
+			return services.NewTaskWaitResult(tasker), nil
+		case <-ticker.C:
+		}
+	}
+}
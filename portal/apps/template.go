@@ -3,6 +3,7 @@
 package apps
 
 import (
+	"cloudiac/common"
 	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
@@ -13,9 +14,11 @@ import (
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
 	"cloudiac/portal/services/vcsrv"
+	"cloudiac/runner"
 	"cloudiac/utils"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/lib/pq"
 )
@@ -39,6 +42,11 @@ type SearchTemplateResp struct {
 	VcsAddr             string      `json:"vcsAddr"`
 	PolicyEnable        bool        `json:"policyEnable"`
 	PolicyStatus        string      `json:"policyStatus"`
+
+	Favorite   bool         `json:"favorite"`   // 当前用户是否收藏
+	LastUsedAt *models.Time `json:"lastUsedAt"` // 当前用户最近使用时间
+
+	Labels map[string]string `json:"labels" gorm:"-"` // 云模板标签
 }
 
 func getRepo(vcsId models.Id, query *db.Session, repoId string) (*vcsrv.Projects, error) {
@@ -65,6 +73,39 @@ func getRepo(vcsId models.Id, query *db.Session, repoId string) (*vcsrv.Projects
 func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*models.Template, e.Error) {
 	c.AddLogField("action", fmt.Sprintf("create template %s", form.Name))
 
+	if err := services.ValidateLaunchForm(form.LaunchForm); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := checkTplDependencies(c, form.Dependencies); err != nil {
+		return nil, err
+	}
+	if err := checkTplApprovers(c, form.RequiredApprovers); err != nil {
+		return nil, err
+	}
+	if form.RepoKeyId != "" {
+		if err := checkOrgKey(c, form.RepoKeyId); err != nil {
+			return nil, err
+		}
+	}
+	if err := services.ValidateStepTimeouts(form.StepTimeouts); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := services.ValidatePipeline(form.Pipeline); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := checkTplEnvDefaults(form.DefaultCronDriftExpress, form.DefaultAutoRepairDrift,
+		form.DefaultTTL, form.DefaultAutoApproval); err != nil {
+		return nil, err
+	}
+	workdirs, err := checkTplWorkdirs(form.Workdirs, form.ModuleSource)
+	if err != nil {
+		return nil, err
+	}
+	triggerBranches, triggerPaths, err := checkTplTriggerFilter(form.TriggerBranches, form.TriggerPaths)
+	if err != nil {
+		return nil, err
+	}
+
 	tx := c.Tx()
 	defer func() {
 		if r := recover(); r != nil {
@@ -89,9 +130,33 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		PlayVarsFile: form.PlayVarsFile,
 		TfVarsFile:   form.TfVarsFile,
 		TfVersion:    form.TfVersion,
+		EngineType:   utils.FirstValueStr(form.EngineType, common.EngineTerraform),
 		PolicyEnable: form.PolicyEnable,
 		Triggers:     form.TplTriggers,
 		KeyId:        form.KeyId,
+		RepoKeyId:    form.RepoKeyId,
+		Workdirs:     workdirs,
+
+		TriggerBranches:    triggerBranches,
+		TriggerPaths:       triggerPaths,
+		TriggerWorkdirOnly: form.TriggerWorkdirOnly,
+
+		ModuleSource:  form.ModuleSource,
+		ModuleVersion: form.ModuleVersion,
+		LaunchForm:    form.LaunchForm,
+		Dependencies:  form.Dependencies,
+
+		RequiredApprovers: form.RequiredApprovers,
+		StepTimeouts:      form.StepTimeouts,
+		Pipeline:          form.Pipeline,
+
+		DefaultRunnerId: form.DefaultRunnerId,
+		RunnerTags:      form.RunnerTags,
+
+		DefaultCronDriftExpress: form.DefaultCronDriftExpress,
+		DefaultAutoRepairDrift:  form.DefaultAutoRepairDrift,
+		DefaultTTL:              form.DefaultTTL,
+		DefaultAutoApproval:     form.DefaultAutoApproval,
 	})
 
 	if err != nil {
@@ -155,8 +220,11 @@ func CreateTemplate(c *ctx.ServiceContext, form *forms.CreateTemplateForm) (*mod
 		}()
 	}
 
+	syncTemplateLockCheck(c, template)
+	syncTemplateVarSchema(c, template)
+
 	// 设置 webhook
-	if err := setVcsRepoWebhook(c, template.VcsId, template.RepoId, form.TplTriggers); err != nil {
+	if err := syncTemplateWebhook(c, template, form.TplTriggers); err != nil {
 		c.Logger().Errorf("set webhook err :%v", err)
 	}
 	return template, nil
@@ -188,6 +256,9 @@ func setAttrsByFormKeys(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 	if form.HasKey("tfVersion") {
 		attrs["tfVersion"] = form.TfVersion
 	}
+	if form.HasKey("engineType") {
+		attrs["engineType"] = utils.FirstValueStr(form.EngineType, common.EngineTerraform)
+	}
 	if form.HasKey("repoRevision") {
 		attrs["repoRevision"] = form.RepoRevision
 	}
@@ -200,6 +271,110 @@ func setAttrsByFormKeys(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 	if form.HasKey("keyId") {
 		attrs["keyId"] = form.KeyId
 	}
+	if form.HasKey("repoKeyId") {
+		attrs["repoKeyId"] = form.RepoKeyId
+	}
+	if form.HasKey("launchForm") {
+		attrs["launchForm"] = form.LaunchForm
+	}
+	if form.HasKey("dependencies") {
+		attrs["dependencies"] = form.Dependencies
+	}
+	if form.HasKey("requiredApprovers") {
+		attrs["requiredApprovers"] = form.RequiredApprovers
+	}
+	if form.HasKey("stepTimeouts") {
+		attrs["stepTimeouts"] = form.StepTimeouts
+	}
+	if form.HasKey("pipeline") {
+		attrs["pipeline"] = form.Pipeline
+	}
+	if form.HasKey("defaultRunnerId") {
+		attrs["defaultRunnerId"] = form.DefaultRunnerId
+	}
+	if form.HasKey("runnerTags") {
+		attrs["runnerTags"] = pq.StringArray(form.RunnerTags)
+	}
+	if form.HasKey("defaultCronDriftExpress") {
+		attrs["defaultCronDriftExpress"] = form.DefaultCronDriftExpress
+	}
+	if form.HasKey("defaultAutoRepairDrift") {
+		attrs["defaultAutoRepairDrift"] = form.DefaultAutoRepairDrift
+	}
+	if form.HasKey("defaultTTL") {
+		attrs["defaultTTL"] = form.DefaultTTL
+	}
+	if form.HasKey("defaultAutoApproval") {
+		attrs["defaultAutoApproval"] = form.DefaultAutoApproval
+	}
+}
+
+// checkUpdateTplEnvDefaults 使用更新后的值检查云模板为新环境设置的默认值
+func checkUpdateTplEnvDefaults(tpl *models.Template, form *forms.UpdateTemplateForm) e.Error {
+	cronExpress, autoRepairDrift := tpl.DefaultCronDriftExpress, tpl.DefaultAutoRepairDrift
+	ttl, autoApproval := tpl.DefaultTTL, tpl.DefaultAutoApproval
+	if form.HasKey("defaultCronDriftExpress") {
+		cronExpress = form.DefaultCronDriftExpress
+	}
+	if form.HasKey("defaultAutoRepairDrift") {
+		autoRepairDrift = form.DefaultAutoRepairDrift
+	}
+	if form.HasKey("defaultTTL") {
+		ttl = form.DefaultTTL
+	}
+	if form.HasKey("defaultAutoApproval") {
+		autoApproval = form.DefaultAutoApproval
+	}
+	return checkTplEnvDefaults(cronExpress, autoRepairDrift, ttl, autoApproval)
+}
+
+// checkTplWorkdirs 检查多工作目录配置，registry 模块生成的云模板不支持多工作目录
+func checkTplWorkdirs(workdirs []string, moduleSource string) ([]string, e.Error) {
+	if len(workdirs) > 0 && moduleSource != "" {
+		return nil, e.New(e.TemplateWorkdirError,
+			fmt.Errorf("workdirs is not supported by registry module template"), http.StatusBadRequest)
+	}
+	dirs, err := services.CleanTemplateWorkdirs(workdirs)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return dirs, nil
+}
+
+// checkTplTriggerFilter 检查云模板 webhook 触发过滤的分支及路径通配符
+func checkTplTriggerFilter(branches, paths []string) ([]string, []string, e.Error) {
+	cleanedBranches, err := services.CleanTriggerPatterns(branches)
+	if err != nil {
+		return nil, nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	cleanedPaths, err := services.CleanTriggerPatterns(paths)
+	if err != nil {
+		return nil, nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return cleanedBranches, cleanedPaths, nil
+}
+
+// checkTplEnvDefaults 检查云模板为新环境设置的默认值，规则与创建环境时相同
+func checkTplEnvDefaults(cronExpress string, autoRepairDrift bool, ttl string, autoApproval bool) e.Error {
+	if cronExpress != "" {
+		if _, err := ParseCronpress(cronExpress); err != nil {
+			return err
+		}
+	}
+	if autoRepairDrift {
+		if cronExpress == "" {
+			return e.New(e.BadParam, http.StatusBadRequest, "Please set defaultCronDriftExpress when defaultAutoRepairDrift is set")
+		}
+		if !autoApproval {
+			return e.New(e.EnvCheckAutoApproval, http.StatusBadRequest)
+		}
+	}
+	if ttl != "" {
+		if _, err := services.ParseTTL(ttl); err != nil {
+			return e.New(e.BadParam, http.StatusBadRequest, err)
+		}
+	}
+	return nil
 }
 
 func setAttrsVcsInfoByForm(attrs models.Attrs, form *forms.UpdateTemplateForm) {
@@ -212,6 +387,10 @@ func setAttrsVcsInfoByForm(attrs models.Attrs, form *forms.UpdateTemplateForm) {
 			attrs["repoAddr"] = ""
 		}
 	}
+	if form.HasKey("moduleSource") {
+		attrs["moduleSource"] = form.ModuleSource
+		attrs["moduleVersion"] = form.ModuleVersion
+	}
 }
 
 func updatetplByFormKey(c *ctx.ServiceContext, tx *db.Session, tpl *models.Template, form *forms.UpdateTemplateForm) e.Error {
@@ -270,7 +449,56 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 	if tpl.OrgId != c.OrgId {
 		return nil, e.New(e.TemplateNotExists, http.StatusForbidden, fmt.Errorf("the organization does not have permission to delete the current template"))
 	}
+	if err := services.ValidateLaunchForm(form.LaunchForm); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := checkTplDependencies(c, form.Dependencies); err != nil {
+		return nil, err
+	}
+	if err := checkTplApprovers(c, form.RequiredApprovers); err != nil {
+		return nil, err
+	}
+	if form.RepoKeyId != "" {
+		if err := checkOrgKey(c, form.RepoKeyId); err != nil {
+			return nil, err
+		}
+	}
+	if err := services.ValidateStepTimeouts(form.StepTimeouts); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := services.ValidatePipeline(form.Pipeline); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if err := checkUpdateTplEnvDefaults(tpl, form); err != nil {
+		return nil, err
+	}
 	attrs := models.Attrs{}
+	if form.HasKey("workdirs") {
+		moduleSource := tpl.ModuleSource
+		if form.HasKey("moduleSource") {
+			moduleSource = form.ModuleSource
+		}
+		workdirs, err := checkTplWorkdirs(form.Workdirs, moduleSource)
+		if err != nil {
+			return nil, err
+		}
+		attrs["workdirs"] = pq.StringArray(workdirs)
+	}
+	if form.HasKey("triggerBranches") || form.HasKey("triggerPaths") {
+		branches, paths, err := checkTplTriggerFilter(form.TriggerBranches, form.TriggerPaths)
+		if err != nil {
+			return nil, err
+		}
+		if form.HasKey("triggerBranches") {
+			attrs["triggerBranches"] = pq.StringArray(branches)
+		}
+		if form.HasKey("triggerPaths") {
+			attrs["triggerPaths"] = pq.StringArray(paths)
+		}
+	}
+	if form.HasKey("triggerWorkdirOnly") {
+		attrs["triggerWorkdirOnly"] = form.TriggerWorkdirOnly
+	}
 	setAttrsByFormKeys(attrs, form)
 	setAttrsVcsInfoByForm(attrs, form)
 
@@ -281,10 +509,15 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 			panic(r)
 		}
 	}()
+	before := tpl
 	if tpl, err = services.UpdateTemplate(tx, form.Id, attrs); err != nil {
 		_ = tx.Rollback()
 		return nil, err
 	}
+	if _, err = services.CreateTemplateRevision(tx, before, tpl, c.UserId, models.TplRevisionUpdate, 0); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
 
 	// 更新和策略组的绑定关系
 	err = updatetplByFormKey(c, tx, tpl, form)
@@ -311,16 +544,25 @@ func UpdateTemplate(c *ctx.ServiceContext, form *forms.UpdateTemplateForm) (*mod
 		}()
 	}
 
+	syncTemplateLockCheck(c, tpl)
+	if tpl.VarSchema == nil || templateSourceChanged(before, tpl) {
+		syncTemplateVarSchema(c, tpl)
+	}
+	if templateSourceChanged(before, tpl) {
+		syncTemplateRevisionDiff(c, before, tpl)
+	}
+
 	// 设置 webhook
-	if err := setVcsRepoWebhook(c, tpl.VcsId, tpl.RepoId, tpl.Triggers); err != nil {
+	if err := syncTemplateWebhook(c, tpl, tpl.Triggers); err != nil {
 		c.Logger().Errorf("set webhook err :%v", err)
 	}
 
 	return tpl, err
 }
 
+// DeleteTemplate 归档云模板，归档后保留云模板及其关联数据，可以恢复或由组织管理员清除
 func DeleteTemplate(c *ctx.ServiceContext, form *forms.DeleteTemplateForm) (interface{}, e.Error) {
-	c.AddLogField("action", fmt.Sprintf("delete template %s", form.Id))
+	c.AddLogField("action", fmt.Sprintf("archive template %s", form.Id))
 	tx := c.Tx()
 	defer func() {
 		if r := recover(); r != nil {
@@ -331,43 +573,46 @@ func DeleteTemplate(c *ctx.ServiceContext, form *forms.DeleteTemplateForm) (inte
 	// 根据ID 查询云模板是否存在
 	tpl, err := services.GetTemplateById(tx, form.Id)
 	if err != nil && err.Code() == e.TemplateNotExists {
+		_ = tx.Rollback()
 		return nil, e.New(err.Code(), err, http.StatusNotFound)
 	} else if err != nil {
+		_ = tx.Rollback()
 		c.Logger().Errorf("error get template by id, err %v", err)
 		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
 	}
 	// 根据云模板ID, 组织ID查询该云模板是否属于该组织
 	if tpl.OrgId != c.OrgId {
+		_ = tx.Rollback()
 		return nil, e.New(e.TemplateNotExists, http.StatusForbidden, fmt.Errorf("The organization does not have permission to delete the current template"))
 	}
+	if tpl.Archived {
+		_ = tx.Rollback()
+		return nil, nil
+	}
 
 	// 查询模板是否有活跃环境
 	if ok, err := services.QueryActiveEnv(tx.Where("tpl_id = ?", form.Id)).Exists(); err != nil {
+		_ = tx.Rollback()
 		return nil, e.AutoNew(err, e.DBError)
 	} else if ok {
+		_ = tx.Rollback()
 		return nil, e.New(e.TemplateActiveEnvExists, http.StatusMethodNotAllowed,
 			fmt.Errorf("The cloud template cannot be deleted because there is an active environment"))
 	}
-	// 删除策略组关系
-	if err := services.DeletePolicyGroupRel(tx, form.Id, consts.ScopeTemplate); err != nil {
-		_ = tx.Rollback()
-		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
-	}
 
-	// 根据ID 删除云模板
-	if err := services.DeleteTemplate(tx, tpl.Id); err != nil {
+	if _, err := services.ArchiveTemplate(tx, tpl.Id, true); err != nil {
 		_ = tx.Rollback()
-		c.Logger().Errorf("error commit del template, err %s", err)
-		return nil, e.New(e.DBError, err)
+		c.Logger().Errorf("error archive template, err %s", err)
+		return nil, err
 	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
-		c.Logger().Errorf("error commit del template, err %s", err)
+		c.Logger().Errorf("error commit archive template, err %s", err)
 		return nil, e.New(e.DBError, err)
 	}
 
-	// 删除 webhook
+	// 归档的云模板不再响应 webhook 推送
 	if err := delVcsRepoWebhook(c, tpl.VcsId, tpl.RepoId); err != nil {
 		c.Logger().Errorf("delete webhook err :%v", err)
 	}
@@ -479,6 +724,33 @@ func SearchTemplate(c *ctx.ServiceContext, form *forms.SearchTemplateForm) (tpl
 	}
 
 	query := services.QueryTemplateByOrgId(c.DB(), form.Q, c.OrgId, tplIdList, c.ProjectId)
+	if form.Labels != "" {
+		selectors, er := services.ParseLabelSelector(form.Labels)
+		if er != nil {
+			return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+		}
+		query = services.QueryTemplateByLabels(query, selectors)
+	}
+	// 云模板归档状态
+	switch form.Archived {
+	case "", "false":
+		// 默认返回未归档云模板
+		query = query.Where("iac_template.archived = ?", false)
+	case "true":
+		query = query.Where("iac_template.archived = ?", true)
+	case "all":
+	// do nothing
+	default:
+		return nil, e.New(e.BadParam, http.StatusBadRequest)
+	}
+	query = services.QueryWithUserTemplate(query, c.UserId)
+	switch form.Sort {
+	case forms.TplSortFavorite:
+		query = query.Order("favorite DESC")
+	case forms.TplSortRecent:
+		query = query.Order("last_used_at IS NULL, last_used_at DESC")
+	}
+	query = query.Order("iac_template.created_at DESC")
 	p := page.New(form.CurrentPage(), form.PageSize(), query)
 	templates := make([]*SearchTemplateResp, 0)
 	if err := p.Scan(&templates); err != nil {
@@ -501,6 +773,10 @@ func SearchTemplate(c *ctx.ServiceContext, form *forms.SearchTemplateForm) (tpl
 	}
 	updateTmplRepoAddr(templates, vcsAttr)
 
+	if err := fillTemplateLabels(c, templates); err != nil {
+		return nil, err
+	}
+
 	return page.PageResp{
 		Total:    p.MustTotal(),
 		PageSize: p.Size,
@@ -509,10 +785,16 @@ func SearchTemplate(c *ctx.ServiceContext, form *forms.SearchTemplateForm) (tpl
 }
 
 type TemplateChecksResp struct {
-	CheckResult string `json:"CheckResult"`
-	Reason      string `json:"reason"`
+	CheckResult string                 `json:"CheckResult"`
+	Reason      string                 `json:"reason"`             // 第一个未通过的检查项的原因
+	Checks      []TemplateCheckItem    `json:"checks"`             // 各检查项的结果
+	Validate    *runner.ValidateResult `json:"validate,omitempty"` // terraform validate 及 fmt 检查结果
+
+	LockCheck *models.TemplateLockCheck `json:"lockCheck,omitempty"` // provider 依赖锁文件检查结果
 }
 
+// TemplateChecks 云模板就绪检查，依次执行工作目录、代码分析、validate、变量文件、playbook、密钥等检查项，
+// 返回每个检查项的结果，任一检查项失败则检查不通过
 func TemplateChecks(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (interface{}, e.Error) {
 
 	// 如果云模版名称传入，校验名称是否重复.
@@ -526,26 +808,59 @@ func TemplateChecks(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (inte
 			return nil, err
 		}
 	}
-	if form.Workdir != "" {
-		// 检查工作目录下.tf 文件是否存在
-		searchForm := &forms.TemplateTfvarsSearchForm{
-			RepoId:       form.RepoId,
-			RepoRevision: form.RepoRevision,
-			VcsId:        form.VcsId,
-			TplChecks:    true,
-			Path:         form.Workdir,
-		}
-		results, err := VcsFileSearch(c, searchForm)
+
+	p := newTemplateCheckPipeline()
+	if form.ModuleSource != "" {
+		p.run(TplCheckModule, true, func() (string, string) { return checkTplModule(form) })
+	} else {
+		hasRepo := form.VcsId != "" && form.RepoId != ""
+		p.run(TplCheckWorkdir, hasRepo, func() (string, string) { return checkTplWorkdir(c, form) })
+		workdirOk := p.passed(TplCheckWorkdir)
+		p.run(TplCheckUnused, form.CheckUnused && workdirOk, func() (string, string) { return checkTplUnused(c, form) })
+		p.run(TplCheckTfVarsFile, form.TfVarsFile != "" && workdirOk, func() (string, string) {
+			return checkTplRepoFile(c, form, form.TfVarsFile)
+		})
+		p.run(TplCheckPlaybook, form.Playbook != "" && workdirOk, func() (string, string) {
+			return checkTplRepoFile(c, form, form.Playbook)
+		})
+	}
+	p.run(TplCheckKey, form.Playbook != "" || form.KeyId != "", func() (string, string) { return checkTplKey(c, form) })
+
+	resp := &TemplateChecksResp{}
+	p.run(TplCheckValidate, form.Validate && p.failed() == nil, func() (string, string) {
+		result, err := validateTemplateRepo(c, form)
 		if err != nil {
-			return nil, err
+			return TplCheckStatusFailed, err.Error()
 		}
-		if len(results.([]string)) == 0 {
-			return nil, e.New(e.TemplateWorkdirError, err)
+		resp.Validate = result
+		if !result.Passed() {
+			return TplCheckStatusFailed, services.FormatValidateResult(result)
 		}
+		return TplCheckStatusPassed, ""
+	})
+	if form.ModuleSource == "" && form.VcsId != "" && form.RepoId != "" {
+		// 依赖锁文件的检查结果只做提示，不影响检查是否通过
+		p.run(TplCheckLockFile, true, func() (string, string) {
+			check, err := checkTemplateLockFile(c, form.VcsId, form.RepoId, form.RepoRevision, form.Workdir)
+			if err != nil {
+				c.Logger().Warnf("check template lock file: %v", err)
+				return TplCheckStatusWarning, err.Error()
+			}
+			resp.LockCheck = check
+			if len(check.Warnings) > 0 {
+				return TplCheckStatusWarning, strings.Join(check.Warnings, "; ")
+			}
+			return TplCheckStatusPassed, ""
+		})
 	}
-	return TemplateChecksResp{
-		CheckResult: consts.TplTfCheckSuccess,
-	}, nil
+
+	resp.Checks = p.items
+	resp.CheckResult = consts.TplTfCheckSuccess
+	if item := p.failed(); item != nil {
+		resp.CheckResult = consts.TplTfCheckFailed
+		resp.Reason = item.Message
+	}
+	return resp, nil
 }
 
 func setVcsRepoWebhook(c *ctx.ServiceContext, vcsId models.Id, repoId string, triggers pq.StringArray) error {
@@ -566,6 +881,43 @@ func setVcsRepoWebhook(c *ctx.ServiceContext, vcsId models.Id, repoId string, tr
 	return nil
 }
 
+// checkTplApprovers 校验云模板的指定审批人，审批人必须是当前组织的用户
+func checkTplApprovers(c *ctx.ServiceContext, approvers *models.TemplateApprovers) e.Error {
+	if err := services.ValidateTemplateApprovers(approvers); err != nil {
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if approvers == nil {
+		return nil
+	}
+	for _, uid := range approvers.UserIds {
+		if !services.UserHasOrgRole(uid, c.OrgId, "") {
+			return e.New(e.TplApproversInvalid, fmt.Errorf("user '%s' is not a member of the organization", uid),
+				http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
 func delVcsRepoWebhook(c *ctx.ServiceContext, vcsId models.Id, repoId string) error {
 	return setVcsRepoWebhook(c, vcsId, repoId, []string{})
 }
+
+// checkTplDependencies 校验云模板外部依赖的定义，引用的 state 必须属于当前组织的环境
+func checkTplDependencies(c *ctx.ServiceContext, deps *models.TemplateDependencies) e.Error {
+	if err := services.ValidateTemplateDependencies(deps); err != nil {
+		return e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	if deps == nil {
+		return nil
+	}
+	for _, rs := range deps.RemoteStates {
+		env, err := services.GetEnvById(c.DB(), rs.EnvId)
+		if err != nil && err.Code() != e.EnvNotExists {
+			return err
+		}
+		if env == nil || env.OrgId != c.OrgId {
+			return e.New(e.TplDependencyInvalid, fmt.Errorf("remote state environment '%s' not found", rs.EnvId), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// RestoreTemplate 恢复已归档的云模板
+func RestoreTemplate(c *ctx.ServiceContext, form *forms.RestoreTemplateForm) (*models.Template, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("restore template %s", form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !tpl.Archived {
+		return tpl, nil
+	}
+
+	after, err := services.ArchiveTemplate(c.DB(), tpl.Id, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(after.Triggers) > 0 {
+		if err := setVcsRepoWebhook(c, after.VcsId, after.RepoId, after.Triggers); err != nil {
+			c.Logger().Errorf("set webhook err :%v", err)
+		}
+	}
+	return after, nil
+}
+
+// PurgeTemplate 清除已归档的云模板，只有组织管理员可以操作
+func PurgeTemplate(c *ctx.ServiceContext, form *forms.PurgeTemplateForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("purge template %s", form.Id))
+
+	if !c.IsSuperAdmin && !services.UserHasOrgRole(c.UserId, c.OrgId, consts.OrgRoleAdmin) {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("only org admin can purge template"), http.StatusForbidden)
+	}
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !tpl.Archived {
+		return nil, e.New(e.TemplateNotArchived, http.StatusBadRequest)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if ok, err := services.QueryActiveEnv(tx.Where("tpl_id = ?", tpl.Id)).Exists(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.AutoNew(err, e.DBError)
+	} else if ok {
+		_ = tx.Rollback()
+		return nil, e.New(e.TemplateActiveEnvExists, http.StatusMethodNotAllowed,
+			fmt.Errorf("the cloud template cannot be purged because there is an active environment"))
+	}
+	if err := services.DeletePolicyGroupRel(tx, tpl.Id, consts.ScopeTemplate); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+	if err := services.PurgeTemplate(tx, tpl.Id); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error commit purge template, err %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+	return nil, nil
+}
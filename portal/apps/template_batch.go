@@ -0,0 +1,129 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+type BatchTemplateItemResult struct {
+	Id      models.Id `json:"id"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"` // 操作失败的原因
+}
+
+type BatchTemplateResp struct {
+	Success bool                      `json:"success"` // 全部云模板操作成功，有任意一个失败时整个批量操作都不会生效
+	Results []BatchTemplateItemResult `json:"results"`
+}
+
+// BatchTemplate 批量启用/禁用、删除(归档)云模板或重新绑定策略组，所有云模板在同一事务中处理
+func BatchTemplate(c *ctx.ServiceContext, form *forms.BatchTemplateForm) (*BatchTemplateResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("batch %s templates %v", form.Action, form.Ids))
+
+	if form.Action == forms.TplBatchBindPolicy {
+		for _, groupId := range form.PolicyGroupIds {
+			if _, err := services.GetPolicyGroupById(services.QueryWithOrgId(c.DB(), c.OrgId), groupId); err != nil {
+				return nil, e.New(err.Code(), err, http.StatusBadRequest)
+			}
+		}
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	resp := &BatchTemplateResp{Success: true, Results: make([]BatchTemplateItemResult, 0, len(form.Ids))}
+	tpls := make([]*models.Template, 0, len(form.Ids))
+	for _, id := range form.Ids {
+		result := BatchTemplateItemResult{Id: id, Success: true}
+		tpl, err := batchTemplateItem(c, tx, id, form)
+		if err != nil {
+			resp.Success = false
+			result.Success = false
+			result.Error = err.Error()
+		} else {
+			tpls = append(tpls, tpl)
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if !resp.Success {
+		_ = tx.Rollback()
+		return resp, nil
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error commit batch template, err %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+
+	if form.Action == forms.TplBatchDelete {
+		for _, tpl := range tpls {
+			if err := delVcsRepoWebhook(c, tpl.VcsId, tpl.RepoId); err != nil {
+				c.Logger().Errorf("delete webhook err :%v", err)
+			}
+		}
+	}
+	return resp, nil
+}
+
+func batchTemplateItem(c *ctx.ServiceContext, tx *db.Session, id models.Id, form *forms.BatchTemplateForm) (*models.Template, e.Error) {
+	tpl, err := services.GetTemplateById(services.QueryWithOrgId(tx, c.OrgId), id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch form.Action {
+	case forms.TplBatchEnable, forms.TplBatchDisable:
+		status := models.Enable
+		if form.Action == forms.TplBatchDisable {
+			status = models.Disable
+		}
+		if tpl.Status == status {
+			return tpl, nil
+		}
+		after, err := services.UpdateTemplate(tx, tpl.Id, models.Attrs{"status": status})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := services.CreateTemplateRevision(tx, tpl, after, c.UserId, models.TplRevisionUpdate, 0); err != nil {
+			return nil, err
+		}
+		return after, nil
+	case forms.TplBatchDelete:
+		if ok, err := services.QueryActiveEnv(tx.Where("tpl_id = ?", tpl.Id)).Exists(); err != nil {
+			return nil, e.AutoNew(err, e.DBError)
+		} else if ok {
+			return nil, e.New(e.TemplateActiveEnvExists,
+				fmt.Errorf("the cloud template cannot be deleted because there is an active environment"))
+		}
+		if tpl.Archived {
+			return tpl, nil
+		}
+		// 与单个删除一致，云模板只归档不清除
+		return services.ArchiveTemplate(tx, tpl.Id, true)
+	case forms.TplBatchBindPolicy:
+		if _, err := services.UpdatePolicyRel(tx, &forms.UpdatePolicyRelForm{
+			Id:             tpl.Id,
+			Scope:          consts.ScopeTemplate,
+			PolicyGroupIds: form.PolicyGroupIds,
+		}); err != nil {
+			return nil, err
+		}
+		return tpl, nil
+	}
+	return nil, e.New(e.BadParam, fmt.Errorf("unknown action '%s'", form.Action))
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"path"
+)
+
+const (
+	TplCheckModule     = "module"     // registry 模块是否存在
+	TplCheckWorkdir    = "workdir"    // 工作目录下是否存在 .tf 文件
+	TplCheckUnused     = "unused"     // 是否存在未使用或未声明的变量、未使用的输出
+	TplCheckTfVarsFile = "tfVarsFile" // tfvars 文件是否存在
+	TplCheckPlaybook   = "playbook"   // playbook 文件是否存在
+	TplCheckKey        = "key"        // 部署密钥是否配置
+	TplCheckValidate   = "validate"   // terraform validate 及 fmt 检查
+	TplCheckLockFile   = "lockFile"   // provider 依赖锁文件检查
+
+	TplCheckStatusPassed  = "passed"
+	TplCheckStatusFailed  = "failed"
+	TplCheckStatusWarning = "warning" // 只做提示，不影响检查结果
+	TplCheckStatusSkipped = "skipped" // 未传入相关参数或前置检查未通过
+)
+
+// TemplateCheckItem 云模板单个检查项的结果
+type TemplateCheckItem struct {
+	Name    string `json:"name" enums:"module,workdir,unused,tfVarsFile,playbook,key,validate,lockFile"`
+	Status  string `json:"status" enums:"passed,failed,warning,skipped"`
+	Message string `json:"message,omitempty"`
+}
+
+type templateCheckPipeline struct {
+	items []TemplateCheckItem
+}
+
+func newTemplateCheckPipeline() *templateCheckPipeline {
+	return &templateCheckPipeline{items: make([]TemplateCheckItem, 0)}
+}
+
+// run 执行检查项，enabled 为 false 时记录为跳过
+func (p *templateCheckPipeline) run(name string, enabled bool, check func() (status string, message string)) {
+	item := TemplateCheckItem{Name: name, Status: TplCheckStatusSkipped}
+	if enabled {
+		item.Status, item.Message = check()
+	}
+	p.items = append(p.items, item)
+}
+
+func (p *templateCheckPipeline) passed(name string) bool {
+	for _, item := range p.items {
+		if item.Name == name {
+			return item.Status == TplCheckStatusPassed
+		}
+	}
+	return false
+}
+
+// failed 返回第一个未通过的检查项
+func (p *templateCheckPipeline) failed() *TemplateCheckItem {
+	for i := range p.items {
+		if p.items[i].Status == TplCheckStatusFailed {
+			return &p.items[i]
+		}
+	}
+	return nil
+}
+
+func checkTplModule(form *forms.TemplateChecksForm) (string, string) {
+	if _, err := services.GetTfRegistryModule(form.ModuleSource, form.ModuleVersion); err != nil {
+		return TplCheckStatusFailed, err.Error()
+	}
+	return TplCheckStatusPassed, ""
+}
+
+func checkTplWorkdir(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (string, string) {
+	results, err := VcsFileSearch(c, &forms.TemplateTfvarsSearchForm{
+		RepoId:       form.RepoId,
+		RepoRevision: form.RepoRevision,
+		VcsId:        form.VcsId,
+		TplChecks:    true,
+		Path:         form.Workdir,
+	})
+	if err != nil {
+		return TplCheckStatusFailed, err.Error()
+	}
+	if len(results.([]string)) == 0 {
+		return TplCheckStatusFailed, fmt.Sprintf("no %s files found in workdir '%s'", consts.TplTfCheck, form.Workdir)
+	}
+	return TplCheckStatusPassed, ""
+}
+
+func checkTplUnused(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (string, string) {
+	if err := checkTemplateHealth(c, form); err != nil {
+		return TplCheckStatusFailed, err.Error()
+	}
+	return TplCheckStatusPassed, ""
+}
+
+// checkTplRepoFile 检查工作目录下的文件是否存在，file 为相对于工作目录的路径
+func checkTplRepoFile(c *ctx.ServiceContext, form *forms.TemplateChecksForm, file string) (string, string) {
+	vcs, err := services.QueryVcsByVcsId(form.VcsId, c.DB())
+	if err != nil {
+		return TplCheckStatusFailed, err.Error()
+	}
+	repo, er := vcsrv.GetRepo(vcs, form.RepoId)
+	if er != nil {
+		return TplCheckStatusFailed, er.Error()
+	}
+	if _, er := repo.ReadFileContent(form.RepoRevision, path.Join(form.Workdir, file)); er != nil {
+		if vcsrv.IsNotFoundErr(er) {
+			return TplCheckStatusFailed, fmt.Sprintf("file '%s' not found in workdir", file)
+		}
+		return TplCheckStatusFailed, er.Error()
+	}
+	return TplCheckStatusPassed, ""
+}
+
+// checkTplKey 使用 playbook 时必须配置部署密钥，配置的密钥需要存在于当前组织
+func checkTplKey(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (string, string) {
+	if form.KeyId == "" {
+		return TplCheckStatusFailed, "key is required when playbook is set"
+	}
+	if _, err := services.GetKeyById(services.QueryWithOrgId(c.DB(), c.OrgId), form.KeyId, false); err != nil {
+		if err.Code() == e.KeyNotExist {
+			return TplCheckStatusFailed, fmt.Sprintf("key '%s' not found", form.KeyId)
+		}
+		return TplCheckStatusFailed, err.Error()
+	}
+	return TplCheckStatusPassed, ""
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TplMigrationResult 环境迁移预览任务的创建结果
+type TplMigrationResult struct {
+	EnvId   models.Id `json:"envId"`
+	EnvName string    `json:"envName"`
+	TaskId  models.Id `json:"taskId"`          // 创建的 plan 任务 id
+	Error   string    `json:"error,omitempty"` // 创建任务失败的原因
+}
+
+func getTplSuccessor(c *ctx.ServiceContext, tpl *models.Template, successorId models.Id) (*models.Template, e.Error) {
+	successor, err := services.GetTemplateById(services.QueryWithOrgId(c.DB(), c.OrgId), successorId)
+	if err != nil {
+		if err.Code() == e.TemplateNotExists {
+			return nil, e.New(e.TplSuccessorInvalid, err, http.StatusBadRequest)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	if err := services.CheckTplSuccessor(tpl, successor); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	return successor, nil
+}
+
+// DeprecateTemplate 废弃云模板并指定替代云模板，废弃后仍可部署，使用该云模板的环境会提示迁移
+func DeprecateTemplate(c *ctx.ServiceContext, form *forms.DeprecateTemplateForm) (*models.Template, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("deprecate template %s", form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if tpl.Archived {
+		return nil, e.New(e.TemplateArchived, http.StatusBadRequest)
+	}
+	if _, err := getTplSuccessor(c, tpl, form.SuccessorId); err != nil {
+		return nil, err
+	}
+	return services.DeprecateTemplate(c.DB(), tpl.Id, form.SuccessorId, strings.TrimSpace(form.Note))
+}
+
+// UndeprecateTemplate 取消云模板的废弃状态
+func UndeprecateTemplate(c *ctx.ServiceContext, form *forms.UndeprecateTemplateForm) (*models.Template, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("undeprecate template %s", form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !tpl.Deprecated {
+		return tpl, nil
+	}
+	return services.UndeprecateTemplate(c.DB(), tpl.Id)
+}
+
+// TemplateDeprecationReport 查询使用已废弃云模板的环境，以及各环境最近一次迁移预览任务
+func TemplateDeprecationReport(c *ctx.ServiceContext, form *forms.TemplateDeprecationReportForm) (interface{}, e.Error) {
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !tpl.Deprecated {
+		return nil, e.New(e.TemplateNotDeprecated, http.StatusBadRequest)
+	}
+
+	query := services.QueryTplMigrationEnvs(c.DB(), tpl.Id).Order("iac_env.project_id, iac_env.created_at")
+	envs := make([]*services.TplMigrationEnv, 0)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	if err := p.Scan(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := services.FillTplMigrationPreviews(c.DB(), tpl.SuccessorTplId, envs); err != nil {
+		return nil, err
+	}
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     envs,
+	}, nil
+}
+
+// MigrateTemplateEnvs 对使用已废弃云模板的环境批量创建基于替代云模板的 plan 任务，预览迁移后的资源变更。
+// 单个环境创建任务失败不影响其他环境，失败原因在结果中返回
+func MigrateTemplateEnvs(c *ctx.ServiceContext, form *forms.MigrateTemplateEnvsForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("migrate envs of template %s", form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !tpl.Deprecated {
+		return nil, e.New(e.TemplateNotDeprecated, http.StatusBadRequest)
+	}
+	successor, err := getTplSuccessor(c, tpl, tpl.SuccessorTplId)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.QueryTplEnvs(c.DB(), tpl.Id)
+	if len(form.EnvIds) > 0 {
+		query = query.Where("iac_env.id IN (?)", form.EnvIds)
+	}
+	envs := make([]*models.Env, 0)
+	if err := query.Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	results := make([]*TplMigrationResult, 0, len(envs))
+	for _, env := range envs {
+		result := &TplMigrationResult{EnvId: env.Id, EnvName: env.Name}
+		_ = c.DB().Transaction(func(tx *db.Session) error {
+			task, err := services.CreateTplMigrationPlanTask(tx, env, successor, c.UserId)
+			if err != nil {
+				c.Logger().Warnf("create migration plan task for env %s: %v", env.Id, err)
+				result.Error = err.Error()
+				return err
+			}
+			result.TaskId = task.Id
+			return nil
+		})
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// envTplDeprecationWarning 环境使用的云模板已废弃时返回迁移提示
+func envTplDeprecationWarning(c *ctx.ServiceContext, env *models.Env) string {
+	tpl, err := services.GetTemplateById(c.DB(), env.TplId)
+	if err != nil || !tpl.Deprecated {
+		return ""
+	}
+	successor, err := services.GetTemplateById(c.DB(), tpl.SuccessorTplId)
+	if err != nil {
+		successor = nil
+	}
+	return services.TplDeprecationWarning(tpl, successor)
+}
@@ -21,7 +21,20 @@ type TplExportForm struct {
 }
 
 func TemplateExport(c *ctx.ServiceContext, form *TplExportForm) (interface{}, e.Error) {
-	return services.ExportTemplates(c.DB(), c.OrgId, form.Ids)
+	data, err := services.ExportTemplates(c.DB(), c.OrgId, form.Ids)
+	if err != nil {
+		return nil, err
+	}
+	watermark, err := services.NewReportWatermark(c.DB(), c.UserId, c.OrgId)
+	if err != nil {
+		return nil, err
+	}
+	if watermark != nil {
+		// 审计员导出的数据不包含敏感信息
+		services.MaskExportedSecrets(data)
+		data.Watermark = watermark
+	}
+	return data, nil
 }
 
 type TplImportForm struct {
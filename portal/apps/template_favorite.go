@@ -0,0 +1,25 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+)
+
+// FavoriteTemplate 收藏或取消收藏云模板，收藏只对当前用户生效
+func FavoriteTemplate(c *ctx.ServiceContext, form *forms.TemplateFavoriteForm, favorite bool) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("favorite template %s: %v", form.Id, favorite))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.SetTemplateFavorite(c.DB(), c.UserId, tpl.Id, favorite); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
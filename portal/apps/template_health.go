@@ -0,0 +1,131 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/portal/services/tfanalysis"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// analyzeTemplateRepo 读取代码仓库工作目录下的 .tf 文件并进行静态分析
+func analyzeTemplateRepo(c *ctx.ServiceContext, vcsId models.Id, repoId, revision, workdir string,
+	resources []tfanalysis.Resource) (*tfanalysis.Report, e.Error) {
+	vcs, err := services.QueryVcsByVcsId(vcsId, c.DB())
+	if err != nil {
+		return nil, err
+	}
+	vcsService, er := vcsrv.GetVcsInstance(vcs)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+	repo, er := vcsService.GetRepo(repoId)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+
+	workdir = path.Clean(workdir)
+	if workdir == "." {
+		workdir = ""
+	}
+	listFiles, er := repo.ListFiles(vcsrv.VcsIfaceOptions{
+		Ref:       revision,
+		Search:    consts.TplTfCheck,
+		Path:      workdir,
+		Recursive: true,
+	})
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+
+	files := make(map[string][]byte, len(listFiles))
+	for _, file := range listFiles {
+		content, er := repo.ReadFileContent(revision, file)
+		if er != nil {
+			return nil, e.New(e.VcsError, er)
+		}
+		name := path.Clean(file)
+		if workdir != "" {
+			name = strings.TrimPrefix(name, workdir+"/")
+		}
+		files[name] = content
+	}
+	return tfanalysis.Analyze(files, resources), nil
+}
+
+// templateParsedResources 读取云模板最后一次扫描任务的解析结果，没有扫描记录时返回空
+func templateParsedResources(c *ctx.ServiceContext, tpl *models.Template) []tfanalysis.Resource {
+	resources := make([]tfanalysis.Resource, 0)
+	if tpl.LastScanTaskId == "" {
+		return resources
+	}
+	task, err := services.GetScanTaskById(c.DB(), tpl.LastScanTaskId)
+	if err != nil {
+		return resources
+	}
+	content, er := logstorage.Get().Read(task.TfParseJsonPath())
+	if er != nil {
+		return resources
+	}
+	tfParse, er := services.UnmarshalTfParseJson(content)
+	if er != nil {
+		c.Logger().Warnf("unmarshal tfparse json of task %s error: %v", task.Id, er)
+		return resources
+	}
+	for _, rs := range *tfParse {
+		for _, r := range rs {
+			resources = append(resources, tfanalysis.Resource{
+				ModuleName: r.ModuleName,
+				Config:     r.Config,
+			})
+		}
+	}
+	return resources
+}
+
+// TemplateHealth 云模板健康报告，包括未使用的变量、未声明的变量引用以及未使用的输出
+func TemplateHealth(c *ctx.ServiceContext, form *forms.TemplateHealthForm) (*tfanalysis.Report, e.Error) {
+	tpl, err := services.GetTemplateById(services.QueryWithOrgId(c.DB(), c.OrgId), form.Id)
+	if err != nil && err.Code() == e.TemplateNotExists {
+		return nil, e.New(err.Code(), err, http.StatusNotFound)
+	} else if err != nil {
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+
+	return analyzeTemplateRepo(c, tpl.VcsId, tpl.RepoId, tpl.RepoRevision, tpl.Workdir,
+		templateParsedResources(c, tpl))
+}
+
+// checkTemplateHealth 检查代码仓库中的模板是否存在问题，存在问题时返回错误
+func checkTemplateHealth(c *ctx.ServiceContext, form *forms.TemplateChecksForm) e.Error {
+	resources := make([]tfanalysis.Resource, 0)
+	if form.TemplateId != "" {
+		if tpl, err := services.GetTemplateById(services.QueryWithOrgId(c.DB(), c.OrgId), form.TemplateId); err == nil {
+			resources = templateParsedResources(c, tpl)
+		}
+	}
+
+	report, err := analyzeTemplateRepo(c, form.VcsId, form.RepoId, form.RepoRevision, form.Workdir, resources)
+	if err != nil {
+		return err
+	}
+	if report.Healthy() {
+		return nil
+	}
+
+	msgs := make([]string, 0)
+	for _, issue := range report.Issues() {
+		msgs = append(msgs, fmt.Sprintf("%s %s (%s:%d)", issue.Type, issue.Name, issue.File, issue.Line))
+	}
+	return e.New(e.TemplateUnhealthy, fmt.Errorf("%s", strings.Join(msgs, "; ")), http.StatusBadRequest)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+// SearchTemplateLabels 查询云模板的标签
+func SearchTemplateLabels(c *ctx.ServiceContext, form *forms.SearchTemplateLabelForm) (interface{}, e.Error) {
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.GetTemplateLabels(c.DB(), tpl.Id)
+}
+
+// SetTemplateLabel 设置云模板标签，标签已存在时更新标签值
+func SetTemplateLabel(c *ctx.ServiceContext, form *forms.TemplateLabelForm) (*models.TemplateLabel, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("set template %s label %s", form.Id, form.Key))
+
+	if err := services.CheckTemplateLabelKey(form.Key); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return services.SetTemplateLabel(c.DB(), tpl, form.Key, form.Value)
+}
+
+// DeleteTemplateLabel 删除云模板标签
+func DeleteTemplateLabel(c *ctx.ServiceContext, form *forms.DeleteTemplateLabelForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete template %s label %s", form.Id, form.Key))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := services.DeleteTemplateLabel(c.DB(), tpl.Id, form.Key); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// 填充云模板列表的标签
+func fillTemplateLabels(c *ctx.ServiceContext, templates []*SearchTemplateResp) e.Error {
+	ids := make([]models.Id, 0, len(templates))
+	for _, t := range templates {
+		ids = append(ids, t.Id)
+	}
+	labels, err := services.GetTemplateLabelsMap(c.DB(), ids)
+	if err != nil {
+		return err
+	}
+	for _, t := range templates {
+		t.Labels = labels[t.Id]
+		if t.Labels == nil {
+			t.Labels = map[string]string{}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/tfanalysis"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"path"
+	"time"
+)
+
+// checkTemplateLockFile 读取代码仓库工作目录下的 .terraform.lock.hcl，检查 provider 是否锁定了版本
+func checkTemplateLockFile(c *ctx.ServiceContext, vcsId models.Id, repoId, revision, workdir string) (*models.TemplateLockCheck, e.Error) {
+	vcs, err := services.QueryVcsByVcsId(vcsId, c.DB())
+	if err != nil {
+		return nil, err
+	}
+	vcsService, er := vcsrv.GetVcsInstance(vcs)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+	repo, er := vcsService.GetRepo(repoId)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+
+	check := &models.TemplateLockCheck{
+		Providers: make([]models.TemplateProviderLock, 0),
+		Warnings:  make([]string, 0),
+		CheckedAt: models.Time(time.Now()),
+	}
+	content, er := repo.ReadFileContent(revision, path.Join(workdir, tfanalysis.LockFileName))
+	if er != nil {
+		if vcsrv.IsNotFoundErr(er) {
+			check.Warnings = append(check.Warnings,
+				fmt.Sprintf("%s not found, provider versions are not locked", tfanalysis.LockFileName))
+			return check, nil
+		}
+		return nil, e.New(e.VcsError, er)
+	}
+
+	check.LockFile = true
+	locks, er := tfanalysis.ParseLockFile(content)
+	if er != nil {
+		check.Warnings = append(check.Warnings, er.Error())
+		return check, nil
+	}
+	for _, l := range locks {
+		check.Providers = append(check.Providers, models.TemplateProviderLock{
+			Source:      l.Source,
+			Version:     l.Version,
+			Constraints: l.Constraints,
+			Pinned:      l.Pinned,
+		})
+		if !l.Pinned {
+			check.Warnings = append(check.Warnings,
+				fmt.Sprintf("provider %s is not pinned to a single version (constraints: '%s')", l.Source, l.Constraints))
+		}
+	}
+	return check, nil
+}
+
+// syncTemplateLockCheck 检查云模板的依赖锁文件并保存结果，检查失败不影响云模板的创建和更新
+func syncTemplateLockCheck(c *ctx.ServiceContext, tpl *models.Template) {
+	if tpl.ModuleSource != "" {
+		// registry 模块没有代码仓库，版本由模块自身管理
+		return
+	}
+	check, err := checkTemplateLockFile(c, tpl.VcsId, tpl.RepoId, tpl.RepoRevision, tpl.Workdir)
+	if err != nil {
+		c.Logger().Warnf("check template %s lock file: %v", tpl.Id, err)
+		return
+	}
+	if err := services.UpdateTemplateLockCheck(c.DB(), tpl.Id, check); err != nil {
+		c.Logger().Errorf("update template lock check: %v", err)
+		return
+	}
+	tpl.LockCheck = check
+}
@@ -0,0 +1,194 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+const (
+	TplSyncCreated    = "created"
+	TplSyncUpdated    = "updated"
+	TplSyncUnchanged  = "unchanged"
+	TplSyncFailed     = "failed"
+	TplSyncUndeclared = "undeclared" // 使用该仓库但未在清单中声明的云模板，不会自动归档
+)
+
+type TemplateSyncResult struct {
+	Name   string    `json:"name" example:"network"`
+	TplId  models.Id `json:"tplId,omitempty" example:"tpl-c3lcrjxczjdywmk0go90"`
+	Action string    `json:"action" enums:"created,updated,unchanged,failed,undeclared"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type SyncTemplateRepoResp struct {
+	Revision string                `json:"revision" example:"master"` // 读取清单文件的分支
+	Results  []*TemplateSyncResult `json:"results"`
+}
+
+// SyncTemplateRepo 读取代码仓库中的云模板清单(.cloudiac.yml)，按名称创建或更新清单中声明的云模板。
+// 每个云模板单独处理，部分云模板同步失败不影响其他云模板
+func SyncTemplateRepo(c *ctx.ServiceContext, form *forms.SyncTemplateRepoForm) (*SyncTemplateRepoResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("sync templates from repo %s", form.RepoId))
+
+	vcs, err := checkOrgVcsAuth(c, form.VcsId)
+	if err != nil {
+		return nil, err
+	}
+	repo, er := vcsrv.GetRepo(vcs, form.RepoId)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	project, err := repo.FormatRepoSearch()
+	if err != nil {
+		return nil, err
+	}
+
+	revision := utils.FirstValueStr(form.RepoRevision, repo.DefaultBranch())
+	content, er := repo.ReadFileContent(revision, consts.TemplateManifestFile)
+	if er != nil {
+		if vcsrv.IsNotFoundErr(er) {
+			return nil, e.New(e.TplManifestInvalid, http.StatusBadRequest,
+				fmt.Errorf("%s not found in '%s'", consts.TemplateManifestFile, revision))
+		}
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	manifest, err := services.ParseTemplateManifest(content)
+	if err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
+	resp := &SyncTemplateRepoResp{Revision: revision, Results: make([]*TemplateSyncResult, 0)}
+	declared := make(map[string]bool)
+	for _, item := range manifest.Templates {
+		declared[item.Name] = true
+		resp.Results = append(resp.Results, syncManifestTemplate(c, vcs, project, revision, item, form.ProjectId))
+	}
+
+	tplList, err := services.QueryTemplateByVcsIdAndRepoId(
+		c.DB().Where("org_id = ? AND archived = ?", c.OrgId, false), vcs.Id.String(), project.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, tpl := range tplList {
+		if !declared[tpl.Name] {
+			resp.Results = append(resp.Results, &TemplateSyncResult{Name: tpl.Name, TplId: tpl.Id, Action: TplSyncUndeclared})
+		}
+	}
+	return resp, nil
+}
+
+func syncManifestTemplate(c *ctx.ServiceContext, vcs *models.Vcs, project *vcsrv.Projects, revision string,
+	item services.TemplateManifestItem, projectIds []models.Id) *TemplateSyncResult {
+
+	result := &TemplateSyncResult{Name: item.Name}
+	failed := func(err error) *TemplateSyncResult {
+		c.Logger().Warnf("sync template %s err: %v", item.Name, err)
+		result.Action = TplSyncFailed
+		result.Error = err.Error()
+		return result
+	}
+	revision = utils.FirstValueStr(item.Revision, revision)
+
+	tpl, er := services.FindOrgTemplateByName(c.DB(), c.OrgId, item.Name)
+	if er != nil {
+		return failed(er)
+	}
+	if tpl.Id == "" {
+		created, err := CreateTemplate(c, &forms.CreateTemplateForm{
+			Name:            item.Name,
+			Description:     item.Description,
+			VcsId:           vcs.Id,
+			RepoId:          project.ID,
+			RepoFullName:    project.FullName,
+			RepoRevision:    revision,
+			Workdir:         item.Workdir,
+			TfVarsFile:      item.TfVarsFile,
+			TfVersion:       item.TfVersion,
+			Playbook:        item.Playbook,
+			PlayVarsFile:    item.PlayVarsFile,
+			ProjectId:       projectIds,
+			TplTriggers:     item.Triggers,
+			TriggerBranches: item.TriggerBranches,
+			TriggerPaths:    item.TriggerPaths,
+		})
+		if err != nil {
+			return failed(err)
+		}
+		result.TplId = created.Id
+		result.Action = TplSyncCreated
+		return result
+	}
+
+	result.TplId = tpl.Id
+	if tpl.Archived {
+		return failed(fmt.Errorf("template is archived"))
+	}
+	if tpl.VcsId != vcs.Id || tpl.RepoId != project.ID {
+		return failed(fmt.Errorf("template name is used by another repository"))
+	}
+
+	form := &forms.UpdateTemplateForm{
+		Id:              tpl.Id,
+		Description:     item.Description,
+		RepoRevision:    revision,
+		Workdir:         item.Workdir,
+		TfVarsFile:      item.TfVarsFile,
+		TfVersion:       item.TfVersion,
+		Playbook:        item.Playbook,
+		PlayVarsFile:    item.PlayVarsFile,
+		TplTriggers:     item.Triggers,
+		TriggerBranches: item.TriggerBranches,
+		TriggerPaths:    item.TriggerPaths,
+	}
+	// 只更新与清单不一致的属性，云模板的其他设置(变量、项目等)保持不变
+	changed := url.Values{}
+	for key, same := range map[string]bool{
+		"description":     tpl.Description == item.Description,
+		"repoRevision":    tpl.RepoRevision == revision,
+		"workdir":         tpl.Workdir == item.Workdir,
+		"tfVarsFile":      tpl.TfVarsFile == item.TfVarsFile,
+		"tfVersion":       tpl.TfVersion == item.TfVersion,
+		"playbook":        tpl.Playbook == item.Playbook,
+		"playVarsFile":    tpl.PlayVarsFile == item.PlayVarsFile,
+		"tplTriggers":     sameStrings(tpl.Triggers, item.Triggers),
+		"triggerBranches": sameStrings(tpl.TriggerBranches, item.TriggerBranches),
+		"triggerPaths":    sameStrings(tpl.TriggerPaths, item.TriggerPaths),
+	} {
+		if !same {
+			changed.Set(key, "")
+		}
+	}
+	if len(changed) == 0 {
+		result.Action = TplSyncUnchanged
+		return result
+	}
+	form.Bind(changed)
+	if _, err := UpdateTemplate(c, form); err != nil {
+		return failed(err)
+	}
+	result.Action = TplSyncUpdated
+	return result
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
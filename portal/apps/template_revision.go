@@ -0,0 +1,123 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"fmt"
+	"net/http"
+)
+
+type TemplateRevisionDiffResp struct {
+	From    int                        `json:"from"`    // 起始修订号
+	To      int                        `json:"to"`      // 目标修订号
+	Changes models.TemplateAttrChanges `json:"changes"` // 两个修订之间变化的属性
+}
+
+func getOrgTemplateRevision(c *ctx.ServiceContext, tplId models.Id, revision int) (*models.TemplateRevision, e.Error) {
+	rev, err := services.GetTemplateRevision(services.QueryWithOrgId(c.DB(), c.OrgId), tplId, revision)
+	if err != nil {
+		if err.Code() == e.TplRevisionNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return rev, nil
+}
+
+// SearchTemplateRevisions 查询云模板的修订记录，按修订号倒序排列
+func SearchTemplateRevisions(c *ctx.ServiceContext, form *forms.SearchTemplateRevisionForm) (interface{}, e.Error) {
+	if _, err := getOrgTemplate(c, form.Id); err != nil {
+		return nil, err
+	}
+
+	query := services.SearchTemplateRevisions(c.DB(), form.Id)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	revisions := make([]*models.TemplateRevision, 0)
+	if err := p.Scan(&revisions); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     revisions,
+	}, nil
+}
+
+// TemplateRevisionDiff 对比云模板两个修订之间的属性差异
+func TemplateRevisionDiff(c *ctx.ServiceContext, form *forms.TemplateRevisionDiffForm) (*TemplateRevisionDiffResp, e.Error) {
+	from, err := getOrgTemplateRevision(c, form.Id, form.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := getOrgTemplateRevision(c, form.Id, form.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TemplateRevisionDiffResp{
+		From:    from.Revision,
+		To:      to.Revision,
+		Changes: services.DiffTemplateSnapshot(from.Snapshot, to.Snapshot),
+	}, nil
+}
+
+// RollbackTemplate 将云模板回滚到指定修订，回滚操作本身也会生成一个修订
+func RollbackTemplate(c *ctx.ServiceContext, form *forms.RollbackTemplateForm) (*models.Template, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("rollback template %s to revision %d", form.Id, form.Revision))
+
+	before, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := getOrgTemplateRevision(c, form.Id, form.Revision)
+	if err != nil {
+		return nil, err
+	}
+	attrs, er := services.TemplateRevisionAttrs(rev)
+	if er != nil {
+		return nil, e.New(e.InternalError, er, http.StatusInternalServerError)
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	tpl, err := services.UpdateTemplate(tx, form.Id, attrs)
+	if err != nil {
+		_ = tx.Rollback()
+		if err.Code() == e.TemplateAlreadyExists {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return nil, err
+	}
+	if _, err := services.CreateTemplateRevision(tx, before, tpl, c.UserId, models.TplRevisionRollback, rev.Revision); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		c.Logger().Errorf("error commit rollback template, err %s", err)
+		return nil, e.New(e.DBError, err)
+	}
+
+	syncTemplateLockCheck(c, tpl)
+	if tpl.VarSchema == nil || templateSourceChanged(before, tpl) {
+		syncTemplateVarSchema(c, tpl)
+	}
+
+	// 触发器可能发生变化，重新设置 webhook
+	if err := syncTemplateWebhook(c, tpl, tpl.Triggers); err != nil {
+		c.Logger().Errorf("set webhook err :%v", err)
+	}
+	return tpl, nil
+}
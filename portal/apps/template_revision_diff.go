@@ -0,0 +1,88 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/tfanalysis"
+	"time"
+)
+
+// compareTemplateRevision 比较云模板变化前后代码的根模块配置
+func compareTemplateRevision(c *ctx.ServiceContext, before, after *models.Template) (*models.TemplateRevisionDiff, e.Error) {
+	oldFiles, err := readTemplateTfFiles(c, before.VcsId, before.RepoId, before.RepoRevision, before.Workdir)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := readTemplateTfFiles(c, after.VcsId, after.RepoId, after.RepoRevision, after.Workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	oldCfg, oldErrors := tfanalysis.ParseModuleConfig(oldFiles)
+	newCfg, newErrors := tfanalysis.ParseModuleConfig(newFiles)
+	diff := &models.TemplateRevisionDiff{
+		Before:      before.RepoRevision,
+		After:       after.RepoRevision,
+		Changes:     make([]models.TemplateConfigChange, 0),
+		Envs:        make([]models.TemplateEnvImpact, 0),
+		ParseErrors: append(oldErrors, newErrors...),
+		ComparedAt:  models.Time(time.Now()),
+	}
+	for _, ch := range tfanalysis.CompareModuleConfig(oldCfg, newCfg) {
+		diff.Changes = append(diff.Changes, models.TemplateConfigChange{
+			Kind:     ch.Kind,
+			Name:     ch.Name,
+			Before:   ch.Before,
+			After:    ch.After,
+			Required: ch.Required,
+			Breaking: ch.Breaking,
+			Message:  ch.Message,
+		})
+	}
+	return diff, nil
+}
+
+// syncTemplateRevisionDiff 云模板代码来源变化时分析新旧版本的差异并检查受影响的环境，
+// 分析失败不影响云模板的更新
+func syncTemplateRevisionDiff(c *ctx.ServiceContext, before, after *models.Template) {
+	if before.ModuleSource != "" || after.ModuleSource != "" || before.VcsId == "" || after.VcsId == "" {
+		// registry 模块没有代码仓库
+		return
+	}
+	diff, err := compareTemplateRevision(c, before, after)
+	if err != nil {
+		c.Logger().Warnf("compare template %s revision: %v", after.Id, err)
+		return
+	}
+	if diff.Envs, err = services.GetTemplateEnvImpacts(c.DB(), after, diff.Changes); err != nil {
+		c.Logger().Errorf("check template %s env impacts: %v", after.Id, err)
+		return
+	}
+	for _, impact := range diff.Envs {
+		c.Logger().Warnf("template %s revision '%s' may break env %s: %v",
+			after.Id, after.RepoRevision, impact.EnvId, impact.Problems)
+	}
+	if err := services.UpdateTemplateRevisionDiff(c.DB(), after.Id, diff); err != nil {
+		c.Logger().Errorf("update template revision diff: %v", err)
+		return
+	}
+	after.RevisionDiff = diff
+}
+
+// envTplChangeWarnings 使用环境当前的变量检查云模板最近一次代码来源变化对环境的影响
+func envTplChangeWarnings(c *ctx.ServiceContext, env *models.Env) []string {
+	tpl, err := services.GetTemplateById(c.DB(), env.TplId)
+	if err != nil || tpl.RevisionDiff == nil || tpl.RevisionDiff.After != tpl.RepoRevision {
+		return []string{}
+	}
+	vars, er := services.GetValidVarsAndVgVars(c.DB(), env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if er != nil {
+		c.Logger().Warnf("get env %s variables: %v", env.Id, er)
+		return []string{}
+	}
+	return services.EnvTplChangeProblems(tpl.RevisionDiff.Changes, env, vars)
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+type TemplateTriggersResp struct {
+	Triggers    []string             `json:"triggers"`    // 触发器
+	Webhook     *vcsrv.WebhookStatus `json:"webhook"`     // 代码仓库中 webhook 的注册状态
+	Error       string               `json:"error"`       // 查询或注册 webhook 失败的原因
+	DeliveredAt *models.Time         `json:"deliveredAt"` // 最近一次收到 webhook 推送的时间
+}
+
+// syncTemplateWebhook 根据触发器设置代码仓库的 webhook，并记录注册结果
+func syncTemplateWebhook(c *ctx.ServiceContext, tpl *models.Template, triggers pq.StringArray) error {
+	if tpl.ModuleSource != "" {
+		// registry 模块没有代码仓库，不需要设置 webhook
+		return nil
+	}
+	err := setVcsRepoWebhook(c, tpl.VcsId, tpl.RepoId, triggers)
+	if er := services.UpdateTemplateWebhookError(c.DB(), tpl.Id, err); er != nil {
+		c.Logger().Errorf("update template webhook error: %v", er)
+	}
+	return err
+}
+
+func getTemplateWebhookStatus(c *ctx.ServiceContext, tpl *models.Template) (*vcsrv.WebhookStatus, error) {
+	vcs, err := services.QueryVcsByVcsId(tpl.VcsId, c.DB())
+	if err != nil {
+		return nil, err
+	}
+	token, err := GetWebhookToken(c)
+	if err != nil {
+		return nil, err
+	}
+	return vcsrv.GetWebhookStatus(vcs, tpl.RepoId, token.Key)
+}
+
+func getOrgTemplate(c *ctx.ServiceContext, id models.Id) (*models.Template, e.Error) {
+	tpl, err := services.GetTemplateById(services.QueryWithOrgId(c.DB(), c.OrgId), id)
+	if err != nil {
+		if err.Code() == e.TemplateNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return tpl, nil
+}
+
+func newTemplateTriggersResp(c *ctx.ServiceContext, tpl *models.Template) *TemplateTriggersResp {
+	resp := &TemplateTriggersResp{
+		Triggers:    tpl.Triggers,
+		Error:       tpl.WebhookError,
+		DeliveredAt: tpl.WebhookDeliveredAt,
+	}
+	if resp.Triggers == nil {
+		resp.Triggers = []string{}
+	}
+	status, err := getTemplateWebhookStatus(c, tpl)
+	if err != nil {
+		c.Logger().Warnf("get template webhook status error: %v", err)
+		if resp.Error == "" {
+			resp.Error = fmt.Sprintf("get webhook status: %v", err)
+		}
+	}
+	resp.Webhook = status
+	return resp
+}
+
+// TemplateTriggers 查询云模板的触发器设置及代码仓库中 webhook 的注册状态
+func TemplateTriggers(c *ctx.ServiceContext, form *forms.TemplateTriggersForm) (*TemplateTriggersResp, e.Error) {
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	return newTemplateTriggersResp(c, tpl), nil
+}
+
+// UpdateTemplateTriggers 更新云模板的触发器并重新注册 webhook，注册失败的原因在结果中返回
+func UpdateTemplateTriggers(c *ctx.ServiceContext, form *forms.UpdateTemplateTriggersForm) (*TemplateTriggersResp, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("update template triggers %s", form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := models.Attrs{"triggers": pq.StringArray(form.Triggers)}
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	before := tpl
+	if tpl, err = services.UpdateTemplate(tx, tpl.Id, attrs); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if _, err = services.CreateTemplateRevision(tx, before, tpl, c.UserId, models.TplRevisionUpdate, 0); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(e.DBError, err)
+	}
+
+	tpl.WebhookError = ""
+	if err := syncTemplateWebhook(c, tpl, tpl.Triggers); err != nil {
+		c.Logger().Errorf("set webhook err :%v", err)
+		tpl.WebhookError = err.Error()
+	}
+	return newTemplateTriggersResp(c, tpl), nil
+}
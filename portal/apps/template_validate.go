@@ -0,0 +1,96 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/runner"
+	"net/http"
+)
+
+// validateTemplateRepo 在 runner 中对代码仓库指定版本的工作目录执行 terraform validate 及 fmt 检查
+func validateTemplateRepo(c *ctx.ServiceContext, form *forms.TemplateChecksForm) (*runner.ValidateResult, e.Error) {
+	tpl := &models.Template{
+		VcsId:         form.VcsId,
+		RepoId:        form.RepoId,
+		Workdir:       form.Workdir,
+		TfVersion:     form.TfVersion,
+		EngineType:    form.EngineType,
+		ModuleSource:  form.ModuleSource,
+		ModuleVersion: form.ModuleVersion,
+		RepoKeyId:     form.RepoKeyId,
+	}
+	if form.TemplateId != "" {
+		t, err := services.GetTemplateById(services.QueryWithOrgId(c.DB(), c.OrgId), form.TemplateId)
+		if err != nil && err.Code() != e.TemplateNotExists {
+			return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+		} else if err == nil {
+			tpl.RepoAddr, tpl.RepoToken = t.RepoAddr, t.RepoToken
+			tpl.DefaultRunnerId, tpl.RunnerTags = t.DefaultRunnerId, t.RunnerTags
+			if tpl.RepoKeyId == "" {
+				tpl.RepoKeyId = t.RepoKeyId
+			}
+			if tpl.EngineType == "" {
+				tpl.EngineType = t.EngineType
+			}
+			// 引擎与云模板不同时不能使用云模板的版本设置
+			if tpl.TfVersion == "" && tpl.EngineType == t.EngineType {
+				tpl.TfVersion = t.TfVersion
+			}
+		}
+	}
+	if tpl.TfVersion == "" {
+		tpl.TfVersion = runner.DefaultEngineVersion(tpl.EngineType)
+	}
+
+	repoAddr, commitId, err := services.GetTaskRepoAddrAndCommitId(c.DB(), tpl, form.RepoRevision)
+	if err != nil {
+		return nil, err
+	}
+	repoKeyId, err := services.GetTplRepoKeyId(c.DB(), tpl)
+	if err != nil {
+		return nil, err
+	}
+	repoPrivateKey, err := services.GetRepoPrivateKey(services.QueryWithOrgId(c.DB(), c.OrgId), repoKeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	runnerId := form.RunnerId
+	if runnerId == "" {
+		if runnerId, err = services.GetTemplateRunnerId(tpl); err != nil {
+			return nil, err
+		}
+	}
+
+	req := runner.RunTaskReq{
+		RunnerId:     runnerId,
+		TaskId:       string(models.NewId("tvc")),
+		RepoAddress:  repoAddr,
+		RepoBranch:   form.RepoRevision,
+		RepoCommitId: commitId,
+
+		RepoPrivateKey: repoPrivateKey,
+		Env: runner.TaskEnv{
+			Id:              "template-validate",
+			Workdir:         form.Workdir,
+			TfVersion:       tpl.TfVersion,
+			EngineType:      tpl.EngineType,
+			EnvironmentVars: map[string]string{},
+			TerraformVars:   map[string]string{},
+			AnsibleVars:     map[string]string{},
+		},
+	}
+	if err := services.SetRunTaskReqModule(&req); err != nil {
+		return nil, e.New(e.TemplateModuleError, err, http.StatusBadRequest)
+	}
+	result, er := services.RunValidateCheck(req)
+	if er != nil {
+		return nil, e.New(e.InternalError, er, http.StatusInternalServerError)
+	}
+	return result, nil
+}
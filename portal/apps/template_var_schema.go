@@ -0,0 +1,106 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/tfanalysis"
+	"cloudiac/portal/services/vcsrv"
+	"path"
+	"time"
+)
+
+// readTemplateTfFiles 读取代码仓库工作目录(根模块)下的 .tf 文件，返回文件名到内容的映射
+func readTemplateTfFiles(c *ctx.ServiceContext, vcsId models.Id, repoId, revision, workdir string) (map[string][]byte, e.Error) {
+	vcs, err := services.QueryVcsByVcsId(vcsId, c.DB())
+	if err != nil {
+		return nil, err
+	}
+	vcsService, er := vcsrv.GetVcsInstance(vcs)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+	repo, er := vcsService.GetRepo(repoId)
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+
+	workdir = path.Clean(workdir)
+	if workdir == "." {
+		workdir = ""
+	}
+	listFiles, er := repo.ListFiles(vcsrv.VcsIfaceOptions{
+		Ref:    revision,
+		Search: consts.TplTfCheck,
+		Path:   workdir,
+	})
+	if er != nil {
+		return nil, e.New(e.VcsError, er)
+	}
+
+	files := make(map[string][]byte, len(listFiles))
+	for _, file := range listFiles {
+		content, er := repo.ReadFileContent(revision, file)
+		if er != nil {
+			return nil, e.New(e.VcsError, er)
+		}
+		files[path.Base(file)] = content
+	}
+	return files, nil
+}
+
+// parseTemplateVarSchema 读取代码仓库工作目录(根模块)下的 .tf 文件，解析其中声明的变量
+func parseTemplateVarSchema(c *ctx.ServiceContext, vcsId models.Id, repoId, revision, workdir string) (*models.TemplateVarSchema, e.Error) {
+	files, err := readTemplateTfFiles(c, vcsId, repoId, revision, workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	decls, parseErrors := tfanalysis.ParseVariables(files)
+	schema := &models.TemplateVarSchema{
+		Variables:   make([]models.TemplateVarDecl, 0, len(decls)),
+		ParseErrors: parseErrors,
+		Revision:    revision,
+		ParsedAt:    models.Time(time.Now()),
+	}
+	for _, d := range decls {
+		schema.Variables = append(schema.Variables, models.TemplateVarDecl{
+			Name:        d.Name,
+			Type:        d.Type,
+			Default:     d.Default,
+			Required:    d.Required,
+			Description: d.Description,
+			Sensitive:   d.Sensitive,
+			File:        d.File,
+		})
+	}
+	return schema, nil
+}
+
+// templateSourceChanged 云模板的代码来源(仓库、分支/标签、工作目录)是否发生变化
+func templateSourceChanged(before, after *models.Template) bool {
+	return before.VcsId != after.VcsId || before.RepoId != after.RepoId ||
+		before.RepoRevision != after.RepoRevision || before.Workdir != after.Workdir
+}
+
+// syncTemplateVarSchema 解析云模板的变量声明并保存结果，解析失败不影响云模板的创建和更新
+func syncTemplateVarSchema(c *ctx.ServiceContext, tpl *models.Template) {
+	if tpl.ModuleSource != "" {
+		// registry 模块没有代码仓库
+		return
+	}
+	schema, err := parseTemplateVarSchema(c, tpl.VcsId, tpl.RepoId, tpl.RepoRevision, tpl.Workdir)
+	if err != nil {
+		c.Logger().Warnf("parse template %s variables: %v", tpl.Id, err)
+		return
+	}
+	if err := services.UpdateTemplateVarSchema(c.DB(), tpl.Id, schema); err != nil {
+		c.Logger().Errorf("update template var schema: %v", err)
+		return
+	}
+	tpl.VarSchema = schema
+}
@@ -29,26 +29,46 @@ type tfVersionList struct {
 	tflist []string
 }
 
-func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearchForm) (interface{}, e.Error) {
+// TemplateEngineVersions 返回引擎内置的版本列表
+func TemplateEngineVersions(c *ctx.ServiceContext, form *forms.TemplateEngineVersionsForm) (interface{}, e.Error) {
+	if form.EngineType == common.EngineOpenTofu {
+		return common.OpenTofuVersions, nil
+	}
+	return common.TerraformVersions, nil
+}
+
+// getRepoTfConstraint 读取仓库 versions.tf 中的版本约束，文件不存在或未指定约束时返回空字符串
+func getRepoTfConstraint(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearchForm) (string, e.Error) {
 	vcs, err := services.QueryVcsByVcsId(form.VcsId, c.DB())
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 	repo, er := vcsrv.GetVcsInstance(vcs)
 	if er != nil {
-		return nil, e.New(e.VcsError, er)
+		return "", e.New(e.VcsError, er)
 	}
 
 	repoDetail, er := repo.GetRepo(form.RepoId)
 	if er != nil {
-		return nil, e.New(e.VcsError, er)
+		return "", e.New(e.VcsError, er)
 	}
 	content, er := repoDetail.ReadFileContent(form.VcsBranch, "versions.tf")
 	// 没有找到versions.tf 文件，使用默认版本，不报错
 	if er != nil {
-		return consts.DefaultTerraformVersion, nil
+		return "", nil
+	}
+	return GetUserTfVersion(content), nil
+}
+
+func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearchForm) (interface{}, e.Error) {
+	if form.EngineType == common.EngineOpenTofu {
+		return autoGetOpenTofuVersion(c, form)
+	}
+
+	tfconstraint, err := getRepoTfConstraint(c, form)
+	if err != nil {
+		return nil, err
 	}
-	tfconstraint := GetUserTfVersion(content)
 	// 如果用户versions.tf 中没有制定terraform 版本，使用我们默认版本
 	if tfconstraint == "" {
 		return consts.DefaultTerraformVersion, nil
@@ -76,6 +96,26 @@ func AutoGetTfVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearch
 	return nil, e.New(e.VcsError, fmt.Errorf("Illegal terrain version number, please enter after verification"))
 }
 
+// autoGetOpenTofuVersion 根据 versions.tf 中的版本约束从内置的 OpenTofu 版本中选择，
+// 未指定约束时使用默认版本
+func autoGetOpenTofuVersion(c *ctx.ServiceContext, form *forms.TemplateTfVersionSearchForm) (interface{}, e.Error) {
+	constraint, err := getRepoTfConstraint(c, form)
+	if err != nil {
+		return nil, err
+	}
+	if constraint == "" {
+		return consts.DefaultOpenTofuVersion, nil
+	}
+	version, er := GetDetailTfVersion(common.OpenTofuVersions, constraint)
+	if er != nil {
+		return nil, e.New(e.InvalidTfVersion, er)
+	}
+	if version == "" {
+		return nil, e.New(e.InvalidTfVersion, fmt.Errorf("no opentofu version matches '%s'", constraint))
+	}
+	return version, nil
+}
+
 // tflist: 提供的terraform版本约束列表
 // tfconstraint: 用户versions.tf中指定的版本约束范围
 func GetDetailTfVersion(tflist []string, tfconstraint string) (string, error) {
@@ -343,6 +343,7 @@ func queryByOrgAndProject(db, query *db.Session, userId, orgId, projectId, input
 		if projectId != "" {
 			// 查询项目用户：组织管理员或项目成员
 			if services.UserHasOrgRole(userId, orgId, consts.OrgRoleAdmin) ||
+				services.UserIsOrgAuditor(userId, orgId) ||
 				services.UserHasProjectRole(userId, orgId, projectId, "") {
 				userIds, _ := services.GetUserIdsByProject(db, projectId)
 				return query.Where(fmt.Sprintf("%s.id in (?)", models.User{}.TableName()), userIds), nil
@@ -379,6 +380,11 @@ func setUserRole(detail *models.UserWithRoleResp, userId, orgId, projectId model
 		if projectId != "" {
 			detail.ProjectRole = consts.ProjectRoleManager
 		}
+	} else if services.UserIsOrgAuditor(userId, orgId) {
+		// 审计员在所有项目中只有访客权限
+		if projectId != "" {
+			detail.ProjectRole = consts.ProjectRoleGuest
+		}
 	}
 }
 
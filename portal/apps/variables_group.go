@@ -12,6 +12,7 @@ import (
 	"cloudiac/portal/services"
 	"cloudiac/utils"
 	"fmt"
+	"net/http"
 )
 
 type CreateVariableGroupForm struct {
@@ -47,6 +48,9 @@ func CreateVariableGroup(c *ctx.ServiceContext, form *forms.CreateVariableGroupF
 			Description: form.Variables[index].Description,
 		})
 	}
+	if err := services.ValidateVarGroupShare(session, c.OrgId, form.ShareProjects, form.ShareTemplates); err != nil {
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
 	// 创建变量组
 	vg, err := services.CreateVariableGroup(session, models.VariableGroup{
 		Name:      form.Name,
@@ -54,6 +58,9 @@ func CreateVariableGroup(c *ctx.ServiceContext, form *forms.CreateVariableGroupF
 		OrgId:     c.OrgId,
 		CreatorId: c.UserId,
 		Variables: models.VarGroupVariables(vb),
+
+		ShareProjects:  idsToStrSlice(form.ShareProjects),
+		ShareTemplates: idsToStrSlice(form.ShareTemplates),
 	})
 	if err != nil {
 		return nil, err
@@ -144,6 +151,18 @@ func UpdateVariableGroup(c *ctx.ServiceContext, form *forms.UpdateVariableGroupF
 		attrs["variables"] = b
 	}
 
+	if form.HasKey("shareProjects") || form.HasKey("shareTemplates") {
+		if err := services.ValidateVarGroupShare(session, c.OrgId, form.ShareProjects, form.ShareTemplates); err != nil {
+			return nil, e.New(err.Code(), err, http.StatusBadRequest)
+		}
+	}
+	if form.HasKey("shareProjects") {
+		attrs["shareProjects"] = idsToStrSlice(form.ShareProjects)
+	}
+	if form.HasKey("shareTemplates") {
+		attrs["shareTemplates"] = idsToStrSlice(form.ShareTemplates)
+	}
+
 	if err := services.UpdateVariableGroup(session, form.Id, attrs); err != nil {
 		return nil, err
 	}
@@ -173,6 +192,26 @@ func DetailVariableGroup(c *ctx.ServiceContext, form *forms.DetailVariableGroupF
 	return vg, nil
 }
 
+// VariableGroupAccess 查询可以使用变量组的环境
+func VariableGroupAccess(c *ctx.ServiceContext, form *forms.VariableGroupAccessForm) (interface{}, e.Error) {
+	vg := models.VariableGroup{}
+	if err := services.DetailVariableGroup(c.DB(), form.Id, c.OrgId).First(&vg); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.VariableGroupNotExist, err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return services.GetVarGroupAccessEnvs(c.DB(), vg)
+}
+
+func idsToStrSlice(ids []models.Id) models.StrSlice {
+	s := make(models.StrSlice, 0, len(ids))
+	for _, id := range ids {
+		s = append(s, id.String())
+	}
+	return s
+}
+
 func SearchRelationship(c *ctx.ServiceContext, form *forms.SearchRelationshipForm) (interface{}, e.Error) {
 	// 继承逻辑 当前作用域下的变量组包含变量组中的变量时 进行覆盖
 	// 查询作用域下的所有变量
@@ -210,6 +249,11 @@ func BatchUpdateRelationship(c *ctx.ServiceContext, form *forms.BatchUpdateRelat
 		return nil, e.New(e.VariableAlreadyExists, fmt.Errorf("the variables under the variable group are repeated"))
 	}
 
+	if err := services.CheckVarGroupsShared(tx, form.VarGroupIds, form.ObjectType, form.ObjectId); err != nil {
+		_ = tx.Rollback()
+		return nil, e.New(err.Code(), err, http.StatusBadRequest)
+	}
+
 	for _, v := range form.VarGroupIds {
 		rel = append(rel, models.VariableGroupRel{
 			VarGroupId: v,
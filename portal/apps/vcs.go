@@ -3,6 +3,7 @@
 package apps
 
 import (
+	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctx"
@@ -20,18 +21,80 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func CreateVcs(c *ctx.ServiceContext, form *forms.CreateVcsForm) (interface{}, e.Error) {
-	token, err := utils.EncryptSecretVar(form.VcsToken)
+// checkVcsAuth 校验 vcs 的认证方式及认证所需的参数
+func checkVcsAuth(vcs *models.Vcs) e.Error {
+	switch vcs.AuthType {
+	case models.VcsAuthToken:
+		if vcs.VcsToken == "" {
+			return e.New(e.VcsAuthInvalid, fmt.Errorf("vcsToken is required"))
+		}
+		return nil
+	case models.VcsAuthOauth:
+		if !vcsrv.SupportOauth(vcs.VcsType) {
+			return e.New(e.VcsAuthInvalid, fmt.Errorf("vcs type '%s' does not support oauth", vcs.VcsType))
+		}
+		if vcs.OauthClientId == "" || vcs.OauthClientSecret == "" {
+			return e.New(e.VcsAuthInvalid, fmt.Errorf("oauthClientId and oauthClientSecret are required"))
+		}
+	case models.VcsAuthGithubApp:
+		if vcs.VcsType != models.VcsGithub {
+			return e.New(e.VcsAuthInvalid, fmt.Errorf("github app is only supported by github"))
+		}
+		if vcs.GithubAppId == 0 || vcs.GithubAppPrivateKey == "" {
+			return e.New(e.VcsAuthInvalid, fmt.Errorf("githubAppId and githubAppPrivateKey are required"))
+		}
+	default:
+		return e.New(e.VcsAuthInvalid, fmt.Errorf("invalid auth type '%s'", vcs.AuthType))
+	}
+	return nil
+}
+
+func encryptVcsSecret(value string) (string, e.Error) {
+	if value == "" {
+		return "", nil
+	}
+	encrypted, err := utils.EncryptSecretVar(value)
 	if err != nil {
-		return nil, e.New(e.VcsError, err)
+		return "", e.New(e.VcsError, err)
+	}
+	return encrypted, nil
+}
+
+func CreateVcs(c *ctx.ServiceContext, form *forms.CreateVcsForm) (interface{}, e.Error) {
+	authType := form.AuthType
+	if authType == "" {
+		authType = models.VcsAuthToken
+	}
+	vcsModel := models.Vcs{
+		OrgId:               c.OrgId,
+		Name:                form.Name,
+		VcsType:             form.VcsType,
+		Address:             form.Address,
+		VcsToken:            form.VcsToken,
+		AuthType:            authType,
+		OauthClientId:       form.OauthClientId,
+		OauthClientSecret:   form.OauthClientSecret,
+		GithubAppId:         form.GithubAppId,
+		GithubAppPrivateKey: form.GithubAppPrivateKey,
+		InstallationId:      form.InstallationId,
+		CloneKeyId:          form.CloneKeyId,
+	}
+	if err := checkVcsAuth(&vcsModel); err != nil {
+		return nil, err
+	}
+	if form.CloneKeyId != "" {
+		if err := checkOrgKey(c, form.CloneKeyId); err != nil {
+			return nil, err
+		}
 	}
-	vcs, err := services.CreateVcs(c.DB(), models.Vcs{
-		OrgId:    c.OrgId,
-		Name:     form.Name,
-		VcsType:  form.VcsType,
-		Address:  form.Address,
-		VcsToken: token,
-	})
+
+	var err e.Error
+	for _, secret := range []*string{&vcsModel.VcsToken, &vcsModel.OauthClientSecret, &vcsModel.GithubAppPrivateKey} {
+		if *secret, err = encryptVcsSecret(*secret); err != nil {
+			return nil, err
+		}
+	}
+	vcs, err := services.CreateVcs(c.DB(), vcsModel)
 
 	if err != nil {
 		return nil, e.AutoNew(err, e.DBError)
@@ -77,9 +140,68 @@ func UpdateVcs(c *ctx.ServiceContext, form *forms.UpdateVcsForm) (vcs *models.Vc
 		}
 		attrs["vcsToken"] = token
 	}
+	if form.HasKey("cloneKeyId") {
+		if form.CloneKeyId != "" {
+			if err := checkOrgKey(c, form.CloneKeyId); err != nil {
+				return nil, err
+			}
+		}
+		attrs["clone_key_id"] = form.CloneKeyId
+	}
+	if err := updateVcsAuthAttrs(vcs, form, attrs); err != nil {
+		return nil, err
+	}
 	return services.UpdateVcs(c.DB(), form.Id, attrs)
 }
 
+// updateVcsAuthAttrs 更新认证方式相关的字段，密钥为空时保留原值，并使用更新后的值校验认证参数
+func updateVcsAuthAttrs(vcs *models.Vcs, form *forms.UpdateVcsForm, attrs models.Attrs) e.Error {
+	updated := *vcs
+	if form.HasKey("vcsType") {
+		updated.VcsType = form.VcsType
+	}
+	if form.HasKey("vcsToken") && form.VcsToken != "" {
+		updated.VcsToken = form.VcsToken
+	}
+	if form.HasKey("authType") && form.AuthType != "" {
+		updated.AuthType = form.AuthType
+		attrs["auth_type"] = form.AuthType
+	}
+	if form.HasKey("oauthClientId") {
+		updated.OauthClientId = form.OauthClientId
+		attrs["oauth_client_id"] = form.OauthClientId
+	}
+	if form.HasKey("githubAppId") {
+		updated.GithubAppId = form.GithubAppId
+		attrs["github_app_id"] = form.GithubAppId
+	}
+	if form.HasKey("installationId") {
+		updated.InstallationId = form.InstallationId
+		attrs["installation_id"] = form.InstallationId
+	}
+	if form.HasKey("oauthClientSecret") && form.OauthClientSecret != "" {
+		secret, err := encryptVcsSecret(form.OauthClientSecret)
+		if err != nil {
+			return err
+		}
+		updated.OauthClientSecret = secret
+		attrs["oauth_client_secret"] = secret
+	}
+	if form.HasKey("githubAppPrivateKey") && form.GithubAppPrivateKey != "" {
+		key, err := encryptVcsSecret(form.GithubAppPrivateKey)
+		if err != nil {
+			return err
+		}
+		updated.GithubAppPrivateKey = key
+		attrs["github_app_private_key"] = key
+	}
+	if updated.AuthType != vcs.AuthType && vcs.AuthType == models.VcsAuthOauth {
+		// 不再使用 OAuth 认证时清空默认授权用户
+		attrs["oauth_user_id"] = ""
+	}
+	return checkVcsAuth(&updated)
+}
+
 func SearchVcs(c *ctx.ServiceContext, form *forms.SearchVcsForm) (interface{}, e.Error) {
 	rs, err := getPage(services.QueryVcs(c.OrgId, form.Status, form.Q, form.IsShowDefaultVcs, false, c.DB()), form, models.Vcs{})
 	if err != nil {
@@ -152,24 +274,17 @@ func ListRepos(c *ctx.ServiceContext, form *forms.GetGitProjectsForm) (interface
 	if err != nil {
 		return nil, err
 	}
-	vcsService, er := vcsrv.GetVcsInstance(vcs)
+	// OAuth 认证时优先列出当前用户授权可访问的仓库
+	vcs, er := vcsrv.ResolveUserVcs(vcs, c.UserId)
 	if er != nil {
 		return nil, e.AutoNew(er, e.VcsError)
 	}
 	limit := form.PageSize()
 	offset := utils.PageSize2Offset(form.CurrentPage(), limit)
-	repo, total, er := vcsService.ListRepos("", form.Q, limit, offset)
+	project, total, er := vcsrv.ListRepoProjects(vcs, form.Q, limit, offset)
 	if er != nil {
 		return nil, e.AutoNew(er, e.VcsError)
 	}
-	project := make([]*vcsrv.Projects, 0)
-	for _, repo := range repo {
-		proj, er := repo.FormatRepoSearch()
-		if er != nil {
-			return nil, er
-		}
-		project = append(project, proj)
-	}
 
 	return page.PageResp{
 		Total:    total,
@@ -224,6 +339,43 @@ func ListRepoTags(c *ctx.ServiceContext, form *forms.GetGitRevisionForm) (tags [
 
 }
 
+// searchRepoRevision 分页查询仓库名称包含关键字的分支或 tag，用于创建环境时自动补全
+func searchRepoRevision(c *ctx.ServiceContext, form *forms.SearchGitRevisionForm, revType string) (interface{}, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	repo, er := vcsrv.GetRepo(vcs, form.RepoId)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+
+	limit := form.PageSize()
+	offset := utils.PageSize2Offset(form.CurrentPage(), limit)
+	names, total, er := vcsrv.SearchRevisions(repo, revType, strings.TrimSpace(form.Q), limit, offset)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+
+	revisions := make([]*Revision, 0, len(names))
+	for _, v := range names {
+		revisions = append(revisions, &Revision{v})
+	}
+	return page.PageResp{
+		Total:    total,
+		PageSize: limit,
+		List:     revisions,
+	}, nil
+}
+
+func SearchRepoBranches(c *ctx.ServiceContext, form *forms.SearchGitRevisionForm) (interface{}, e.Error) {
+	return searchRepoRevision(c, form, vcsrv.RevisionTypeBranch)
+}
+
+func SearchRepoTags(c *ctx.ServiceContext, form *forms.SearchGitRevisionForm) (interface{}, e.Error) {
+	return searchRepoRevision(c, form, vcsrv.RevisionTypeTag)
+}
+
 func VcsFileSearch(c *ctx.ServiceContext, form *forms.TemplateTfvarsSearchForm) (interface{}, e.Error) {
 	vcs, err := services.QueryVcsByVcsId(form.VcsId, c.DB())
 
@@ -352,3 +504,153 @@ func SearchVcsFile(c *ctx.ServiceContext, form *forms.SearchVcsFileForm) (interf
 	res := gin.H{"content": string(b)}
 	return res, nil
 }
+
+func getOrgVcsRepo(c *ctx.ServiceContext, vcsId models.Id, repoId string) (vcsrv.RepoIface, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, vcsId)
+	if err != nil {
+		return nil, err
+	}
+	vcsService, er := vcsrv.GetVcsInstance(vcs)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	repo, er := vcsService.GetRepo(repoId)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	return repo, nil
+}
+
+// ListRepoTree 浏览代码仓库目录
+func ListRepoTree(c *ctx.ServiceContext, form *forms.GetRepoTreeForm) (interface{}, e.Error) {
+	repo, err := getOrgVcsRepo(c, form.Id, form.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	entries, er := vcsrv.ListTree(repo, form.Ref, form.Path)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	return entries, nil
+}
+
+// GetRepoBlob 读取代码仓库指定版本的文件
+func GetRepoBlob(c *ctx.ServiceContext, form *forms.GetRepoBlobForm) (interface{}, e.Error) {
+	repo, err := getOrgVcsRepo(c, form.Id, form.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	blob, er := vcsrv.ReadBlob(repo, form.Ref, form.Path)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	return blob, nil
+}
+
+// ClearVcsCache 清除 vcs 的缓存数据，用于代码仓库变更后立即获取最新的分支及文件
+func ClearVcsCache(c *ctx.ServiceContext, form *forms.ClearVcsCacheForm) (interface{}, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	vcsrv.InvalidateVcsCache(vcs.Id, form.RepoId)
+	return nil, nil
+}
+
+// VcsOauthAuthorize 返回当前用户授权访问代码仓库的地址
+func VcsOauthAuthorize(c *ctx.ServiceContext, form *forms.VcsOauthAuthorizeForm) (interface{}, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !vcs.UseOauth() || vcs.OauthClientId == "" {
+		return nil, e.New(e.VcsAuthInvalid, fmt.Errorf("vcs does not support oauth authorization"))
+	}
+
+	// 授权接口只需要 vcs 的读权限，授权回调时没有用户上下文，在这里确定用户是否可以设置 vcs 的默认授权
+	canUpdate := enforceUserPerm(c, "vcs", "update") == nil
+	state, er := services.GenerateVcsOauthState(vcs.Id, c.UserId, canUpdate)
+	if er != nil {
+		return nil, e.New(e.InternalError, er)
+	}
+	authorizeUrl, er := vcsrv.OauthAuthorizeUrl(vcs, services.VcsOauthRedirectUri(), state)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsAuthInvalid)
+	}
+	return gin.H{"url": authorizeUrl}, nil
+}
+
+// VcsOauthCallback 处理代码仓库授权回调，保存用户的授权 token，返回授权完成后跳转的地址
+func VcsOauthCallback(c *ctx.ServiceContext, form *forms.VcsOauthCallbackForm) (string, e.Error) {
+	claims, err := services.VerifyVcsOauthState(form.State)
+	if err != nil {
+		return "", err
+	}
+	vcs, err := services.QueryVcsByVcsId(claims.VcsId, c.DB())
+	if err != nil {
+		return "", err
+	}
+	token, er := vcsrv.ExchangeOauthCode(vcs, services.VcsOauthRedirectUri(), form.Code)
+	if er != nil {
+		return "", e.AutoNew(er, e.VcsUnauthorized)
+	}
+	installationId := int64(0)
+	if vcs.AuthType == models.VcsAuthGithubApp && form.InstallationId != 0 && claims.CanUpdateVcs {
+		// 只绑定授权用户可以访问的安装，避免通过篡改回调参数绑定其他账号的安装
+		ok, er := vcsrv.GithubUserHasInstallation(vcs, token.AccessToken, form.InstallationId)
+		if er != nil {
+			return "", e.AutoNew(er, e.VcsUnauthorized)
+		} else if !ok {
+			return "", e.New(e.VcsUnauthorized, http.StatusForbidden,
+				fmt.Errorf("installation %d is not accessible to the authorized user", form.InstallationId))
+		}
+		installationId = form.InstallationId
+	}
+
+	tx := c.Tx()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+	if _, err := services.SaveVcsOauthToken(tx, vcs.Id, claims.UserId, token); err != nil {
+		_ = tx.Rollback()
+		return "", err
+	}
+	// 其他成员的授权只保存为个人授权，vcs 的默认授权及安装只能由有编辑权限的用户设置
+	attrs := models.Attrs{}
+	if vcs.OauthUserId == "" && claims.CanUpdateVcs {
+		// 第一个有编辑权限的授权用户作为 vcs 默认使用的授权(webhook、任务 clone 代码等)
+		attrs["oauth_user_id"] = claims.UserId
+	}
+	if installationId != 0 {
+		attrs["installation_id"] = installationId
+	}
+	if len(attrs) > 0 {
+		if _, err := services.UpdateVcs(tx, vcs.Id, attrs); err != nil {
+			_ = tx.Rollback()
+			return "", err
+		}
+	}
+	if er := tx.Commit(); er != nil {
+		_ = tx.Rollback()
+		return "", e.New(e.DBError, er)
+	}
+	return fmt.Sprintf("%s/org/%s", strings.TrimRight(configs.Get().Portal.Address, "/"), vcs.OrgId), nil
+}
+
+// DeleteVcsOauth 删除当前用户对代码仓库的授权
+func DeleteVcsOauth(c *ctx.ServiceContext, form *forms.VcsOauthAuthorizeForm) (interface{}, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := services.GetVcsOauthToken(c.DB(), vcs.Id, c.UserId); err != nil {
+		return nil, err
+	}
+	if err := services.DeleteVcsOauthToken(c.DB(), vcs, c.UserId); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
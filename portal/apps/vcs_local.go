@@ -0,0 +1,133 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getManagedLocalVcs 查询可以管理仓库的本地 vcs，系统默认 vcs 被所有组织共享，只有平台管理员可以管理
+func getManagedLocalVcs(c *ctx.ServiceContext, vcsId models.Id) (*vcsrv.LocalVcs, e.Error) {
+	vcs, err := checkOrgVcsAuth(c, vcsId)
+	if err != nil {
+		return nil, err
+	}
+	if vcs.OrgId == "" && !c.IsSuperAdmin {
+		return nil, e.New(e.PermissionDeny, fmt.Errorf("only platform admin can manage default vcs repos"),
+			http.StatusForbidden)
+	}
+	return vcsrv.GetLocalVcs(vcs)
+}
+
+func getManagedLocalRepo(c *ctx.ServiceContext, vcsId models.Id, repoId string) (*vcsrv.LocalRepo, e.Error) {
+	localVcs, err := getManagedLocalVcs(c, vcsId)
+	if err != nil {
+		return nil, err
+	}
+	return localVcs.GetLocalRepo(repoId)
+}
+
+// CreateLocalRepo 在本地 vcs 中创建代码仓库
+func CreateLocalRepo(c *ctx.ServiceContext, form *forms.CreateLocalRepoForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create local repo %s", form.Name))
+
+	localVcs, err := getManagedLocalVcs(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := localVcs.CreateRepo(form.Name, form.DefaultBranch)
+	if err != nil {
+		return nil, err
+	}
+	return repo.FormatRepoSearch()
+}
+
+// UploadLocalRepoArchive 上传代码压缩包并提交到本地仓库的分支，返回提交的 commit id
+func UploadLocalRepoArchive(c *ctx.ServiceContext, form *forms.UploadLocalRepoArchiveForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("upload local repo archive %s", form.RepoId))
+
+	if form.File.Size > consts.MaxLocalRepoArchiveSize {
+		return nil, e.New(e.BadParam, fmt.Errorf("archive size exceeds %d bytes", consts.MaxLocalRepoArchiveSize),
+			http.StatusBadRequest)
+	}
+	repo, err := getManagedLocalRepo(c, form.Id, form.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	fp, er := form.File.Open()
+	if er != nil {
+		return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+	}
+	defer fp.Close()
+	content, er := io.ReadAll(fp)
+	if er != nil {
+		return nil, e.New(e.BadParam, er, http.StatusBadRequest)
+	}
+
+	user, err := services.GetUserById(c.DB(), c.UserId)
+	if err != nil {
+		return nil, err
+	}
+	opt := vcsrv.LocalCommitOptions{
+		Branch:      form.Branch,
+		Message:     form.Message,
+		Dir:         form.Dir,
+		AuthorName:  user.Name,
+		AuthorEmail: user.Email,
+	}
+	if opt.Branch == "" {
+		opt.Branch = repo.DefaultBranch()
+	}
+	if opt.Message == "" {
+		opt.Message = fmt.Sprintf("Upload %s", form.File.Filename)
+	}
+	commitId, err := repo.CommitArchive(content, opt)
+	if err != nil {
+		return nil, err
+	}
+	return gin.H{"branch": opt.Branch, "commitId": commitId}, nil
+}
+
+// CreateLocalRepoBranch 创建本地仓库分支
+func CreateLocalRepoBranch(c *ctx.ServiceContext, form *forms.CreateLocalRepoBranchForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("create local repo %s branch %s", form.RepoId, form.Name))
+
+	repo, err := getManagedLocalRepo(c, form.Id, form.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	return nil, repo.CreateBranch(form.Name, form.From)
+}
+
+// DeleteLocalRepoBranch 删除本地仓库分支
+func DeleteLocalRepoBranch(c *ctx.ServiceContext, form *forms.DeleteLocalRepoBranchForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("delete local repo %s branch %s", form.RepoId, form.Name))
+
+	repo, err := getManagedLocalRepo(c, form.Id, form.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	return nil, repo.DeleteBranch(form.Name)
+}
+
+// SetLocalRepoDefaultBranch 设置本地仓库的默认分支
+func SetLocalRepoDefaultBranch(c *ctx.ServiceContext, form *forms.SetLocalRepoDefaultBranchForm) (interface{}, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("set local repo %s default branch %s", form.RepoId, form.Branch))
+
+	repo, err := getManagedLocalRepo(c, form.Id, form.RepoId)
+	if err != nil {
+		return nil, err
+	}
+	return nil, repo.SetDefaultBranch(form.Branch)
+}
@@ -11,7 +11,10 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
 	"cloudiac/portal/services"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -23,6 +26,7 @@ const (
 	GitlabPrMerged       = "merged"
 	RefHeads             = "refs/heads/"
 	GiteePrOpen          = "open"
+	BitbucketPrOpen      = "OPEN"
 )
 
 type webhookOptions struct {
@@ -33,15 +37,65 @@ type webhookOptions struct {
 	AfterCommit  string
 	BeforeCommit string
 	PrId         int
+	ChangedFiles []string // push 变更的文件，为 nil 表示变更文件未知
 }
 
-func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOptions) {
+// triggerBranch 返回用于匹配云模板触发分支的分支，push 为推送分支，PR/MR 为源分支
+func (o webhookOptions) triggerBranch() string {
+	if o.PushRef != "" {
+		return strings.Replace(o.PushRef, RefHeads, "", -1)
+	}
+	return o.HeadRef
+}
+
+// pushChangedFiles 返回 push 事件中所有 commit 变更的文件，
+// PR/MR 事件或 commit 列表不完整(gitlab 最多返回 20 个 commit)时返回 nil
+func pushChangedFiles(form forms.WebhooksApiHandler) []string {
+	if form.Ref == "" || len(form.Commits) == 0 || form.TotalCommits > len(form.Commits) {
+		return nil
+	}
+	files := make([]string, 0)
+	for _, commit := range form.Commits {
+		files = append(files, commit.Added...)
+		files = append(files, commit.Modified...)
+		files = append(files, commit.Removed...)
+	}
+	return files
+}
+
+// addWebhookResult 记录 webhook 对云模板或环境的处理结果
+func addWebhookResult(delivery *models.WebhookDelivery, tplId, envId models.Id, task *models.BaseTask, skipReason string, err error) {
+	result := models.WebhookDeliveryResult{TplId: tplId, EnvId: envId}
+	switch {
+	case err != nil:
+		result.Status = models.WebhookResultFailed
+		result.Message = err.Error()
+	case task != nil:
+		result.Status = models.WebhookResultTriggered
+		result.TaskId = task.Id
+		result.TaskType = task.Type
+	default:
+		result.Status = models.WebhookResultSkipped
+		result.Message = skipReason
+	}
+	delivery.Results = append(delivery.Results, result)
+}
+
+func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOptions, delivery *models.WebhookDelivery) {
 
 	for tIndex, tpl := range tplList {
 		sysUserId := models.Id(consts.SysUserId)
 
+		if ok, reason := services.TemplateTriggerMatched(&tplList[tIndex], options.triggerBranch(), options.ChangedFiles); !ok {
+			logs.Get().WithField("webhook", "searchEnv").
+				Infof("skip template %s, %s", tpl.Id, reason)
+			addWebhookResult(delivery, tpl.Id, "", nil, reason, nil)
+			continue
+		}
+
 		if len(tpl.Triggers) > 0 {
-			createTplScan(sysUserId, &tplList[tIndex], options)
+			task, reason, err := createTplScan(sysUserId, &tplList[tIndex], options)
+			addWebhookResult(delivery, tpl.Id, "", task, reason, err)
 		}
 
 		envs, err := services.GetEnvByTplId(tx, tpl.Id)
@@ -49,25 +103,64 @@ func searchTplEnv(tx *db.Session, tplList []models.Template, options webhookOpti
 			logs.Get().WithField("webhook", "searchEnv").
 				Errorf("search env err: %v, tplId: %s", err, tpl.Id)
 			// 记录个日志就行
+			addWebhookResult(delivery, tpl.Id, "", nil, "", err)
 			continue
 		}
 
 		for eIndex, env := range envs {
 			// 跳过已归档环境
 			if env.Archived {
+				addWebhookResult(delivery, tpl.Id, env.Id, nil, "env archived", nil)
+				continue
+			}
+			if len(env.Triggers) == 0 {
+				addWebhookResult(delivery, tpl.Id, env.Id, nil, "env has no triggers", nil)
 				continue
 			}
 			for _, v := range env.Triggers {
-				if er := actionPrOrPush(tx, v, sysUserId, &envs[eIndex], &tplList[tIndex], options); er != nil {
+				task, reason, er := actionPrOrPush(tx, v, sysUserId, &envs[eIndex], &tplList[tIndex], options)
+				if er != nil {
 					logs.Get().WithField("webhook", "createTask").
 						Errorf("create task er: %v, envId: %s", er, env.Id)
 				}
+				addWebhookResult(delivery, tpl.Id, env.Id, task, reason, er)
 			}
 		}
 	}
 }
 
+// WebhooksApiHandler 处理代码仓库的 webhook 请求，处理结果记录到投递日志中
 func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (interface{}, e.Error) {
+	delivery := newWebhookDelivery(form)
+	err := processWebhook(c, form, delivery)
+	saveWebhookDelivery(c, delivery, err)
+	return nil, err
+}
+
+func newWebhookDelivery(form forms.WebhooksApiHandler) *models.WebhookDelivery {
+	headers := services.RedactWebhookHeaders(form.Headers)
+	return &models.WebhookDelivery{
+		VcsId:   models.Id(form.VcsId),
+		Event:   services.WebhookDeliveryEvent(headers, form.ObjectKind),
+		Headers: headers,
+		Payload: string(form.Payload),
+		Results: models.WebhookDeliveryResults{},
+	}
+}
+
+// saveWebhookDelivery 保存投递记录，webhook 处理的事务回滚时投递记录依然需要保存，所以不使用处理 webhook 的事务
+func saveWebhookDelivery(c *ctx.ServiceContext, delivery *models.WebhookDelivery, err e.Error) {
+	delivery.Status = models.WebhookDeliverySuccess
+	if err != nil {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = err.Error()
+	}
+	if er := services.CreateWebhookDelivery(c.DB(), delivery); er != nil {
+		c.Logger().Errorf("save webhook delivery err: %s", er)
+	}
+}
+
+func processWebhook(c *ctx.ServiceContext, form forms.WebhooksApiHandler, delivery *models.WebhookDelivery) e.Error {
 	tx := c.Tx()
 	defer func() {
 		if r := recover(); r != nil {
@@ -81,15 +174,19 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 	if err != nil {
 		_ = tx.Rollback()
 		c.Logger().Errorf("webhook get vcs err: %s", err)
-		return nil, e.New(e.DBError, err)
+		return e.New(e.DBError, err)
 	}
 
-	// 根据VcsId & 仓库Id查询对应的云模板
-	tplList, err := services.QueryTemplateByVcsIdAndRepoId(tx, form.VcsId, getVcsRepoId(vcs.VcsType, form))
+	// 仓库有新的提交或 PR 变更，清除仓库的缓存数据(分支、tag 及文件)
+	repoId := getVcsRepoId(vcs.VcsType, form)
+	vcsrv.InvalidateVcsCache(vcs.Id, repoId)
+
+	// 根据VcsId & 仓库Id查询对应的云模板，已归档的云模板不处理
+	tplList, err := services.QueryTemplateByVcsIdAndRepoId(tx.Where("archived = ?", false), form.VcsId, repoId)
 	if err != nil {
 		_ = tx.Rollback()
 		c.Logger().Errorf("webhook get tpl err: %s", err)
-		return nil, e.New(e.DBError, err)
+		return e.New(e.DBError, err)
 	}
 	options := webhookOptions{
 		PushRef:      form.Ref,
@@ -99,6 +196,7 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		AfterCommit:  form.After,
 		BeforeCommit: form.Before,
 		PrId:         form.PullRequest.Number,
+		ChangedFiles: pushChangedFiles(form),
 	}
 
 	if vcs.VcsType == consts.GitTypeGitLab {
@@ -107,17 +205,33 @@ func WebhooksApiHandler(c *ctx.ServiceContext, form forms.WebhooksApiHandler) (i
 		options.PrStatus = form.ObjectAttributes.State
 		options.PrId = form.ObjectAttributes.Iid
 	}
+	if vcs.VcsType == consts.GitTypeBitbucket {
+		options = bitbucketWebhookOptions(form)
+	}
+
+	delivery.OrgId = vcs.OrgId
+	delivery.RepoId = repoId
+	delivery.Ref = options.triggerBranch()
+	delivery.CommitId = options.AfterCommit
 
 	// 查询云模板对应的环境
-	searchTplEnv(tx, tplList, options)
+	searchTplEnv(tx, tplList, options, delivery)
+
+	tplIds := make([]models.Id, 0, len(tplList))
+	for _, tpl := range tplList {
+		tplIds = append(tplIds, tpl.Id)
+	}
+	if err := services.UpdateTemplateWebhookDelivered(tx, tplIds); err != nil {
+		c.Logger().Warnf("update template webhook delivered time err: %s", err)
+	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		c.Logger().Errorf("error create task, err %s", err)
-		return nil, e.New(e.DBError, err)
+		return e.New(e.DBError, err)
 	}
 
-	return nil, err
+	return nil
 }
 
 type CreateWebhookTaskParam struct {
@@ -132,13 +246,13 @@ type CreateWebhookTaskParam struct {
 }
 
 //nolint
-func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
+func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) (*models.Task, error) {
 	env := param.Env
 	// 计算变量列表
 	vars, er := services.GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
 	if er != nil {
 		_ = tx.Rollback()
-		return e.New(e.DBError, er, http.StatusInternalServerError)
+		return nil, e.New(e.DBError, er, http.StatusInternalServerError)
 	}
 	task := &models.Task{
 		Name:        models.Task{}.GetTaskNameByType(param.TaskType),
@@ -161,7 +275,7 @@ func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
 	if err != nil {
 		_ = tx.Rollback()
 		logs.Get().Errorf("error creating task, err %s", err)
-		return e.New(err.Code(), err, http.StatusInternalServerError)
+		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
 
 	if param.PrId != 0 && param.TaskType == models.TaskTypePlan {
@@ -173,11 +287,45 @@ func CreateWebhookTask(tx *db.Session, param CreateWebhookTaskParam) error {
 			VcsId:  param.Tpl.VcsId,
 		}); err != nil {
 			logs.Get().Errorf("error creating vcs pr, err %s", err)
-			return e.New(err.Code(), err, http.StatusInternalServerError)
+			return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 		}
+		services.SetWebhookPlanPending(tx, task, env)
 	}
 	logs.Get().Infof("create webhook task success. envId:%s, task type: %s", env.Id, param.TaskType)
-	return nil
+	return task, nil
+}
+
+// bitbucketWebhookOptions 将 bitbucket cloud/server 的 push 及 pr 事件转换为 webhook 参数，
+// 一次 push 包含多个分支的变更时只处理第一个分支，bitbucket 事件不包含变更文件
+func bitbucketWebhookOptions(form forms.WebhooksApiHandler) webhookOptions {
+	options := webhookOptions{}
+	if pr := form.BitbucketPullRequest; pr.Id != 0 {
+		options.PrId = pr.Id
+		options.BaseRef = utils.FirstValueStr(pr.Destination.Branch.Name, pr.ToRef.DisplayId)
+		options.HeadRef = utils.FirstValueStr(pr.Source.Branch.Name, pr.FromRef.DisplayId)
+		if pr.State == BitbucketPrOpen {
+			options.PrStatus = GitlabPrOpened
+		}
+		return options
+	}
+
+	for _, change := range form.BitbucketPush.Changes {
+		if change.New.Type == "branch" {
+			options.PushRef = RefHeads + change.New.Name
+			options.AfterCommit = change.New.Target.Hash
+			options.BeforeCommit = change.Old.Target.Hash
+			return options
+		}
+	}
+	for _, change := range form.BitbucketChanges {
+		if strings.HasPrefix(change.Ref.Id, RefHeads) && change.Type != "DELETE" {
+			options.PushRef = change.Ref.Id
+			options.AfterCommit = change.ToHash
+			options.BeforeCommit = change.FromHash
+			return options
+		}
+	}
+	return options
 }
 
 func checkVcsCallbackMessage(revision, pushRef, baseRef string) bool {
@@ -190,14 +338,15 @@ func checkVcsCallbackMessage(revision, pushRef, baseRef string) bool {
 	return true
 }
 
+// actionPrOrPush 根据环境的触发器创建 plan 或 apply 任务，未创建任务时返回跳过原因
 func actionPrOrPush(tx *db.Session, trigger string, userId models.Id,
-	env *models.Env, tpl *models.Template, options webhookOptions) error {
+	env *models.Env, tpl *models.Template, options webhookOptions) (*models.BaseTask, string, error) {
 
 	if !checkVcsCallbackMessage(env.Revision, options.PushRef, options.BaseRef) {
 		logs.Get().WithField("webhook", "createTask").
 			Infof("tplId: %s, envId: %s, revision don't match, env.revision: %s, %s or %s",
 				env.TplId, env.Id, env.Revision, options.PushRef, options.BaseRef)
-		return nil
+		return nil, fmt.Sprintf("env revision %s does not match the push or target branch", env.Revision), nil
 	}
 
 	// 判断pr类型并确认动作
@@ -214,10 +363,19 @@ func actionPrOrPush(tx *db.Session, trigger string, userId models.Id,
 			PrId:     options.PrId,
 			Source:   consts.TaskSourceWebhookPlan,
 		}
-		return CreateWebhookTask(tx, param)
+		task, err := CreateWebhookTask(tx, param)
+		if err != nil {
+			return nil, "", err
+		}
+		return &task.BaseTask, "", nil
 	}
 	// push操作，执行apply计划
 	if trigger == consts.EnvTriggerCommit && options.BeforeCommit != "" {
+		if env.AutoDeploySuspended {
+			logs.Get().WithField("webhook", "createTask").
+				Infof("envId: %s, auto deploy suspended: %s", env.Id, env.SuspendReason)
+			return nil, fmt.Sprintf("auto deploy suspended: %s", env.SuspendReason), nil
+		}
 		param := CreateWebhookTaskParam{
 			TaskType: models.TaskTypeApply,
 			Revision: env.Revision,
@@ -228,10 +386,14 @@ func actionPrOrPush(tx *db.Session, trigger string, userId models.Id,
 			PrId:     options.PrId,
 			Source:   consts.TaskSourceWebhookApply,
 		}
-		return CreateWebhookTask(tx, param)
+		task, err := CreateWebhookTask(tx, param)
+		if err != nil {
+			return nil, "", err
+		}
+		return &task.BaseTask, "", nil
 	}
 
-	return nil
+	return nil, fmt.Sprintf("trigger %s does not match the event", trigger), nil
 }
 
 func getVcsRepoId(vcsType string, form forms.WebhooksApiHandler) string {
@@ -244,36 +406,43 @@ func getVcsRepoId(vcsType string, form forms.WebhooksApiHandler) string {
 		return form.Repository.FullName
 	case consts.GitTypeGitee:
 		return form.Repository.FullName
+	case consts.GitTypeBitbucket:
+		if form.Repository.FullName != "" {
+			return form.Repository.FullName
+		}
+		// bitbucket server 仓库 id 格式为 {projectKey}/{repoSlug}
+		return form.Repository.Project.Key + "/" + form.Repository.Slug
 	default:
 		return ""
 	}
 }
 
-func createTplScan(userId models.Id, tpl *models.Template, options webhookOptions) {
+// createTplScan 创建云模板扫描任务，未创建任务时返回跳过原因
+func createTplScan(userId models.Id, tpl *models.Template, options webhookOptions) (*models.BaseTask, string, error) {
 	logger := logs.Get()
 	// 云模板扫描未启用，不允许发起手动检测
 	if enabled, err := services.IsTemplateEnabledScan(db.Get(), tpl.Id); err != nil {
 		logger.Errorf("template enable err: %s", err)
-		return
+		return nil, "", err
 	} else if !enabled {
 		logger.Infof("template %s not open scan", tpl.Id)
-		return
+		return nil, "template scan not enabled", nil
 	}
 
 	if !checkVcsCallbackMessage(tpl.RepoRevision, options.PushRef, options.BaseRef) {
-		return
+		return nil, fmt.Sprintf("template revision %s does not match the push or target branch", tpl.RepoRevision), nil
 	}
 
 	// 目前云模板的webhook只有push一种
 	if len(tpl.Triggers) > 0 && tpl.Triggers[0] != consts.EnvTriggerCommit {
-		return
+		return nil, "template scan only triggered by commit", nil
 	}
 
 	// 创建任务
-	runnerId, err := services.GetDefaultRunnerId()
+	runnerId, err := services.GetTemplateRunnerId(tpl)
 	if err != nil {
 		logger.Errorf("webhook task scan get runner, err %s", err)
-		return
+		return nil, "", err
 	}
 
 	tx := db.Get().Begin()
@@ -289,6 +458,8 @@ func createTplScan(userId models.Id, tpl *models.Template, options webhookOption
 		Name:      models.ScanTask{}.GetTaskNameByType(taskType),
 		CreatorId: userId,
 		TplId:     tpl.Id,
+		CommitId:  options.AfterCommit,
+		Source:    consts.TaskSourceWebhookScan,
 		BaseTask: models.BaseTask{
 			Type:        taskType,
 			StepTimeout: common.DefaultTaskStepTimeout,
@@ -298,26 +469,31 @@ func createTplScan(userId models.Id, tpl *models.Template, options webhookOption
 	if err != nil {
 		_ = tx.Rollback()
 		logger.Errorf("error creating scan task, err %s", err)
-		return
+		return nil, "", err
 	}
 
 	if err := services.InitScanResult(tx, task); err != nil {
 		_ = tx.Rollback()
 		logger.Errorf("task '%s' init scan result error: %v", task.Id, err)
-		return
+		return nil, "", err
 	}
 
 	if task.Type == models.TaskTypeTplScan {
 		tpl.LastScanTaskId = task.Id
-		if _, err := db.Get().Save(tpl); err != nil {
+		if err := services.UpdateLastScanTask(tx, consts.ScopeTemplate, tpl.Id, task); err != nil {
 			_ = tx.Rollback()
 			logger.Errorf("save template, err %s", err)
+			return nil, "", err
 		}
 	}
 
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		logger.Errorf("commit env, err %s", err)
-		return
+		return nil, "", err
 	}
+
+	// 扫描结果通过 commit 状态反馈到代码仓库
+	services.SetScanTaskCommitStatus(db.Get(), task)
+	return &task.BaseTask, "", nil
 }
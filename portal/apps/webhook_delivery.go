@@ -0,0 +1,112 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package apps
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/libs/page"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// filterTplWebhookResults 只保留投递记录中指定云模板的处理结果，
+// 系统默认 vcs 的仓库可能被多个组织的云模板使用，不返回其他云模板的处理结果
+func filterTplWebhookResults(delivery *models.WebhookDelivery, tplId models.Id) {
+	results := make(models.WebhookDeliveryResults, 0)
+	for _, r := range delivery.Results {
+		if r.TplId == tplId {
+			results = append(results, r)
+		}
+	}
+	delivery.Results = results
+}
+
+func getTplWebhookDelivery(c *ctx.ServiceContext, tpl *models.Template, id models.Id) (*models.WebhookDelivery, e.Error) {
+	delivery, err := services.GetWebhookDelivery(c.DB(), tpl.VcsId, tpl.RepoId, id)
+	if err != nil {
+		if err.Code() == e.WebhookDeliveryNotExists {
+			return nil, e.New(err.Code(), err, http.StatusNotFound)
+		}
+		return nil, e.New(e.DBError, err, http.StatusInternalServerError)
+	}
+	return delivery, nil
+}
+
+// SearchTemplateWebhookDeliveries 查询云模板代码仓库的 webhook 投递记录，按投递时间倒序排列
+func SearchTemplateWebhookDeliveries(c *ctx.ServiceContext, form *forms.SearchTemplateWebhookDeliveryForm) (interface{}, e.Error) {
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := services.SearchWebhookDeliveries(c.DB(), tpl.VcsId, tpl.RepoId, form.Status)
+	p := page.New(form.CurrentPage(), form.PageSize(), query)
+	deliveries := make([]*models.WebhookDelivery, 0)
+	if err := p.Scan(&deliveries); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, d := range deliveries {
+		filterTplWebhookResults(d, tpl.Id)
+	}
+
+	return page.PageResp{
+		Total:    p.MustTotal(),
+		PageSize: p.Size,
+		List:     deliveries,
+	}, nil
+}
+
+// TemplateWebhookDeliveryDetail 查询 webhook 投递记录详情，包含请求头及请求内容
+func TemplateWebhookDeliveryDetail(c *ctx.ServiceContext, form *forms.TemplateWebhookDeliveryForm) (*models.WebhookDelivery, e.Error) {
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := getTplWebhookDelivery(c, tpl, form.DeliveryId)
+	if err != nil {
+		return nil, err
+	}
+	filterTplWebhookResults(delivery, tpl.Id)
+	return delivery, nil
+}
+
+// ReplayTemplateWebhookDelivery 使用投递记录的请求内容重新处理 webhook，重放结果记录为一条新的投递记录
+func ReplayTemplateWebhookDelivery(c *ctx.ServiceContext, form *forms.TemplateWebhookDeliveryForm) (*models.WebhookDelivery, e.Error) {
+	c.AddLogField("action", fmt.Sprintf("replay webhook delivery %s of template %s", form.DeliveryId, form.Id))
+
+	tpl, err := getOrgTemplate(c, form.Id)
+	if err != nil {
+		return nil, err
+	}
+	origin, err := getTplWebhookDelivery(c, tpl, form.DeliveryId)
+	if err != nil {
+		return nil, err
+	}
+	vcs, err := checkOrgVcsAuth(c, origin.VcsId)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookForm := forms.WebhooksApiHandler{}
+	if er := json.Unmarshal([]byte(origin.Payload), &webhookForm); er != nil {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid webhook payload: %v", er), http.StatusBadRequest)
+	}
+	webhookForm.VcsType = vcs.VcsType
+	webhookForm.VcsId = string(vcs.Id)
+	webhookForm.Headers = origin.Headers
+	webhookForm.Payload = []byte(origin.Payload)
+
+	delivery := newWebhookDelivery(webhookForm)
+	delivery.ReplayOf = origin.Id
+	delivery.CreatorId = c.UserId
+	er := processWebhook(c, webhookForm, delivery)
+	saveWebhookDelivery(c, delivery, er)
+
+	filterTplWebhookResults(delivery, tpl.Id)
+	return delivery, nil
+}
@@ -17,6 +17,15 @@ const (
 
 	MaxLogContentSize = 1024 * 1024 // 最大日志文件大小，超限会被截断
 
+	MaxPolicyGroupArchiveSize  = 10 * 1024 * 1024  // 上传的策略组压缩包大小限制
+	MaxPolicyGroupUnzipSize    = 50 * 1024 * 1024  // 策略组压缩包解压后的总大小限制
+	MaxPolicyGroupArchiveFiles = 5000              // 策略组压缩包的文件数量限制
+	MaxLocalRepoArchiveSize    = 50 * 1024 * 1024  // 上传到本地仓库的代码压缩包大小限制
+	MaxLocalRepoUnzipSize      = 200 * 1024 * 1024 // 本地仓库代码压缩包解压后的总大小限制
+	MaxLocalRepoArchiveFiles   = 10000             // 本地仓库代码压缩包的文件数量限制
+
+	TemplateManifestFile = ".cloudiac.yml" // 代码仓库根目录下声明云模板的清单文件
+
 	RunnerConnectTimeout = time.Second * 5
 	DbTaskPollInterval   = time.Second // 轮询 db 任务状态的间隔
 
@@ -31,10 +40,12 @@ const (
 	DefaultSysName  = "System"
 
 	DefaultTerraformVersion = "0.14.11"
+	DefaultOpenTofuVersion  = "1.6.2"
 
 	// token subject
 	JwtSubjectUserAuth = "userAuth" // 用于用户认证
 	JwtSubjectSsoCode  = "ssoCode"  // 用于 sso 单点登录
+	JwtSubjectVcsOauth = "vcsOauth" // 用于 vcs OAuth 授权回调的 state 参数
 
 	DirRoot                          = "/"
 	PolicyGroupDownloadTimeoutSecond = 20 * time.Second
@@ -55,12 +66,15 @@ const (
 	TerraformVar           = "TF_VAR_"
 	WorkFlow               = "workflow"
 
-	GitTypeGitLab   = "gitlab"
-	GitTypeGitEA    = "gitea"
-	GitTypeGithub   = "github"
-	GitTypeGitee    = "gitee"
-	GitTypeLocal    = "local"
-	GitTypeRegistry = "registry"
+	GitTypeGitLab    = "gitlab"
+	GitTypeGitEA     = "gitea"
+	GitTypeGithub    = "github"
+	GitTypeGitee     = "gitee"
+	GitTypeBitbucket = "bitbucket"
+	GitTypeLocal     = "local"
+	GitTypeRegistry  = "registry"
+
+	PolicyGroupSourceUpload = "upload" // 通过上传压缩包创建的策略组
 
 	MetaYmlMatch   = "meta.y*ml"
 	VariablePrefix = "variables.tf"
@@ -100,6 +114,8 @@ const (
 	OrgRoleAdmin  = "admin"
 	OrgRoleMember = "member"
 
+	OrgRoleAuditor = "auditor" // 审计员，只读访问组织下的所有资源，不能查看敏感变量
+
 	ProjectRoleManager  = "manager"  //
 	ProjectRoleApprover = "approver" // 要以创建模板、环境，部署审批
 	ProjectRoleOperator = "operator" // 可以发起 plan、apply
@@ -114,6 +130,9 @@ const (
 	ScopePolicyGroup = "policyGroup"
 	ScopeTask        = "task"
 
+	PolicyResultFieldRego          = "rego"          // 扫描结果中的 rego 代码字段
+	PolicyResultFieldFixSuggestion = "fixSuggestion" // 扫描结果中的修复建议字段
+
 	VarTypeEnv       = "environment"
 	VarTypeTerraform = "terraform"
 	VarTypeAnsible   = "ansible"
@@ -124,25 +143,34 @@ const (
 	EnvTriggerPRMR   = "prmr"
 	EnvTriggerCommit = "commit"
 
-	EventTaskFailed    = "task.failed"
-	EventTaskComplete  = "task.complete"
-	EventTaskRunning   = "task.running"
-	EventTaskApproving = "task.approving"
-	EventTaskRejected  = "task.rejected"
-	EvenvtCronDrift    = "task.crondrift"
+	EventTaskFailed     = "task.failed"
+	EventTaskComplete   = "task.complete"
+	EventTaskRunning    = "task.running"
+	EventTaskApproving  = "task.approving"
+	EventTaskRejected   = "task.rejected"
+	EvenvtCronDrift     = "task.crondrift"
+	EventTaskScheduled  = "task.scheduled"  // 任务在环境部署窗口外提交，排队等待执行
+	EventEnvAutoDestroy = "env.autodestroy" // 环境即将自动销毁的提醒
 
 	DefaultTfMirror   = "https://releases.hashicorp.com/terraform"
 	HttpClientTimeout = 20
 
 	TaskCallbackKafka = "kafka"
 
-	TaskSourceManual       = "manual"
-	TaskSourceDriftPlan    = "driftPlan"
-	TaskSourceDriftApply   = "driftApply"
-	TaskSourceWebhookPlan  = "webhookPlan"
-	TaskSourceWebhookApply = "webhookApply"
-	TaskSourceAutoDestroy  = "autoDestroy"
-	TaskSourceApi          = "api"
+	TaskSourceManual         = "manual"
+	TaskSourceDriftPlan      = "driftPlan"
+	TaskSourceDriftApply     = "driftApply"
+	TaskSourceDriftRemediate = "driftRemediate" // 偏移检测发现偏移后创建的纠偏部署任务
+	TaskSourceWebhookPlan    = "webhookPlan"
+	TaskSourceWebhookApply   = "webhookApply"
+	TaskSourceWebhookScan    = "webhookScan" // 代码仓库 push 触发的云模板扫描任务
+	TaskSourceAutoDestroy    = "autoDestroy"
+	TaskSourceApi            = "api"
+	TaskSourceRollback       = "rollback"
+	TaskSourceTplMigration   = "tplMigration" // 云模板废弃后迁移到替代云模板的预览 plan 任务
+	TaskSourceStateImport    = "stateImport"  // 导入外部 state 时生成的任务记录
+	TaskSourceFleetDeploy    = "fleetDeploy"  // 批量部署创建的任务
+	TaskSourcePromotion      = "promotion"    // 环境晋级创建的部署任务
 )
 
 var (
@@ -178,6 +206,8 @@ var (
 		common.TaskRunning:   EventTaskRunning,
 		common.TaskApproving: EventTaskApproving,
 		common.TaskRejected:  EventTaskFailed,
+		common.TaskCancelled: EventTaskFailed,
 		EvenvtCronDrift:      EvenvtCronDrift,
+		EventTaskScheduled:   EventTaskScheduled,
 	}
 )
@@ -0,0 +1,484 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package e
+
+import (
+	"fmt"
+	"strings"
+)
+
+// errorKeys 错误码对应的稳定标识，错误码调整或错误消息修改时标识保持不变，
+// UI 及 CLI 根据标识识别错误类型并展示处理建议，新增错误码时需要同时添加标识
+var errorKeys = map[int]string{
+	InternalError:                "internal_error",
+	ObjectAlreadyExists:          "object_already_exists",
+	ObjectNotExists:              "object_not_exists",
+	ObjectNotExistsOrNoPerm:      "object_not_exists_or_no_perm",
+	ObjectDisabled:               "object_disabled",
+	NotImplement:                 "not_implement",
+	IOError:                      "io_error",
+	TooManyRetries:               "too_many_retries",
+	EncryptError:                 "encrypt_error",
+	DecryptError:                 "decrypt_error",
+	JSONParseError:               "json_parse_error",
+	HCLParseError:                "hcl_parse_error",
+	URLParseError:                "url_parse_error",
+	DBError:                      "db_error",
+	DBAttrValidateErr:            "db_attr_validate_err",
+	ColValidateError:             "col_validate_error",
+	NameDuplicate:                "name_duplicate",
+	InvalidColumn:                "invalid_column",
+	DataTooLong:                  "data_too_long",
+	NameTooLong:                  "name_too_long",
+	RemarkTooLong:                "remark_too_long",
+	TagTooLong:                   "tag_too_long",
+	TagTooMuch:                   "tag_too_much",
+	BadOrgId:                     "bad_org_id",
+	BadProjectId:                 "bad_project_id",
+	BadTemplateId:                "bad_template_id",
+	BadEnvId:                     "bad_env_id",
+	BadParam:                     "bad_param",
+	BadRequest:                   "bad_request",
+	InvalidPipeline:              "invalid_pipeline",
+	InvalidPipelineVersion:       "invalid_pipeline_version",
+	InvalidExportVersion:         "invalid_export_version",
+	InvalidAccessKeyId:           "invalid_access_key_id",
+	InvalidAccessKeySecret:       "invalid_access_key_secret",
+	ForbiddenAccessKey:           "forbidden_access_key",
+	TemplateNameRepeat:           "template_name_repeat",
+	TemplateWorkdirError:         "template_workdir_error",
+	TemplateModuleError:          "template_module_error",
+	LdapError:                    "ldap_error",
+	MailServerError:              "mail_server_error",
+	ConsulConnError:              "consul_conn_error",
+	VcsError:                     "vcs_error",
+	VcsAddressError:              "vcs_address_error",
+	VcsInvalidToken:              "vcs_invalid_token",
+	VcsConnectError:              "vcs_connect_error",
+	VcsConnectTimeOut:            "vcs_connect_time_out",
+	ImportError:                  "import_error",
+	ImportIdDuplicate:            "import_id_duplicate",
+	ImportUpdateOrgId:            "import_update_org_id",
+	InvalidPassword:              "invalid_password",
+	InvalidToken:                 "invalid_token",
+	InvalidTokenScope:            "invalid_token_scope",
+	TokenExpired:                 "token_expired",
+	InvalidOrgId:                 "invalid_org_id",
+	InvalidProjectId:             "invalid_project_id",
+	PermissionDeny:               "permission_deny",
+	ValidateError:                "validate_error",
+	InvalidOperation:             "invalid_operation",
+	PermDenyApproval:             "perm_deny_approval",
+	UserAlreadyExists:            "user_already_exists",
+	UserNotExists:                "user_not_exists",
+	UserEmailDuplicate:           "user_email_duplicate",
+	UserEmailDuplicateInactive:   "user_email_duplicate_inactive",
+	UserInvalidStatus:            "user_invalid_status",
+	UserInactive:                 "user_inactive",
+	UserDisabled:                 "user_disabled",
+	InvalidPasswordFormat:        "invalid_password_format",
+	UserActivated:                "user_activated",
+	InvalidRoleName:              "invalid_role_name",
+	RoleNameDuplicate:            "role_name_duplicate",
+	OrganizationAlreadyExists:    "organization_already_exists",
+	OrganizationNotExists:        "organization_not_exists",
+	OrganizationDisabled:         "organization_disabled",
+	OrganizationInvalidStatus:    "organization_invalid_status",
+	InvalidOrganizationId:        "invalid_organization_id",
+	OrgPurgeScheduled:            "org_purge_scheduled",
+	OrgPurgeNotScheduled:         "org_purge_not_scheduled",
+	OrgNameMismatch:              "org_name_mismatch",
+	OrgCertNotExists:             "org_cert_not_exists",
+	ProjectAlreadyExists:         "project_already_exists",
+	ProjectNotExists:             "project_not_exists",
+	ProjectAliasDuplicate:        "project_alias_duplicate",
+	ProjectUserAlreadyExists:     "project_user_already_exists",
+	ProjectUserAliasDuplicate:    "project_user_alias_duplicate",
+	ProjectQuotaExceeded:         "project_quota_exceeded",
+	ProjectQuotaInvalid:          "project_quota_invalid",
+	VariableAlreadyExists:        "variable_already_exists",
+	VariableAliasDuplicate:       "variable_alias_duplicate",
+	VariableScopeConflict:        "variable_scope_conflict",
+	InvalidVarName:               "invalid_var_name",
+	EmptyVarName:                 "empty_var_name",
+	EmptyVarValue:                "empty_var_value",
+	TokenAlreadyExists:           "token_already_exists",
+	TokenNotExists:               "token_not_exists",
+	TokenAliasDuplicate:          "token_alias_duplicate",
+	TemplateAlreadyExists:        "template_already_exists",
+	TemplateNotExists:            "template_not_exists",
+	TemplateDisabled:             "template_disabled",
+	TemplateActiveEnvExists:      "template_active_env_exists",
+	TemplateKeyIdNotSet:          "template_key_id_not_set",
+	TemplateUnhealthy:            "template_unhealthy",
+	TplRevisionNotExists:         "tpl_revision_not_exists",
+	TplLaunchFormInvalid:         "tpl_launch_form_invalid",
+	TemplateArchived:             "template_archived",
+	TemplateNotArchived:          "template_not_archived",
+	TplDependencyInvalid:         "tpl_dependency_invalid",
+	TplApproversInvalid:          "tpl_approvers_invalid",
+	TplSuccessorInvalid:          "tpl_successor_invalid",
+	TemplateNotDeprecated:        "template_not_deprecated",
+	TplTriggerFilterInvalid:      "tpl_trigger_filter_invalid",
+	TplManifestInvalid:           "tpl_manifest_invalid",
+	EnvAlreadyExists:             "env_already_exists",
+	EnvNotExists:                 "env_not_exists",
+	EnvAliasDuplicate:            "env_alias_duplicate",
+	EnvArchived:                  "env_archived",
+	EnvCannotArchiveActive:       "env_cannot_archive_active",
+	EnvDeploying:                 "env_deploying",
+	EnvCheckAutoApproval:         "env_check_auto_approval",
+	EnvAttestationOverdue:        "env_attestation_overdue",
+	EnvLaunchFormInvalid:         "env_launch_form_invalid",
+	EnvDeployFrozen:              "env_deploy_frozen",
+	EnvDeployWindowInvalid:       "env_deploy_window_invalid",
+	EnvLocked:                    "env_locked",
+	EnvNotLocked:                 "env_not_locked",
+	EnvLockedByOthers:            "env_locked_by_others",
+	EnvStateVersionNotExists:     "env_state_version_not_exists",
+	EnvStateInvalid:              "env_state_invalid",
+	EnvStateNotExists:            "env_state_not_exists",
+	EnvStateImportForbidden:      "env_state_import_forbidden",
+	EnvPlanNotExists:             "env_plan_not_exists",
+	EnvPlanApplied:               "env_plan_applied",
+	EnvPlanStale:                 "env_plan_stale",
+	EnvAutoDestroyNotSet:         "env_auto_destroy_not_set",
+	EnvAutoDestroyStarted:        "env_auto_destroy_started",
+	EnvSuspendJobInvalid:         "env_suspend_job_invalid",
+	EnvProtected:                 "env_protected",
+	EnvProtectionInvalid:         "env_protection_invalid",
+	TaskAlreadyExists:            "task_already_exists",
+	TaskNotExists:                "task_not_exists",
+	TaskApproveNotPending:        "task_approve_not_pending",
+	TaskStepNotExists:            "task_step_not_exists",
+	TaskNotHaveStep:              "task_not_have_step",
+	TaskGuardrailApproval:        "task_guardrail_approval",
+	TaskTplApproverRequired:      "task_tpl_approver_required",
+	TaskNotScheduled:             "task_not_scheduled",
+	TaskImportAddrInvalid:        "task_import_addr_invalid",
+	TaskImportNotSupported:       "task_import_not_supported",
+	TaskTargetInvalid:            "task_target_invalid",
+	TaskTargetNotFound:           "task_target_not_found",
+	TaskRetryNotAllowed:          "task_retry_not_allowed",
+	TaskCancelNotAllowed:         "task_cancel_not_allowed",
+	TaskStepTimeoutsInvalid:      "task_step_timeouts_invalid",
+	TaskAlreadyApproved:          "task_already_approved",
+	TaskArtifactNotExists:        "task_artifact_not_exists",
+	TaskOfflineCheckFailed:       "task_offline_check_failed",
+	TaskNotQueued:                "task_not_queued",
+	TaskRetryPolicyInvalid:       "task_retry_policy_invalid",
+	KeyAlreadyExists:             "key_already_exists",
+	KeyNotExist:                  "key_not_exist",
+	KeyAliasDuplicate:            "key_alias_duplicate",
+	KeyDecryptFail:               "key_decrypt_fail",
+	VcsNotExists:                 "vcs_not_exists",
+	VcsDeleteError:               "vcs_delete_error",
+	VcsAuthInvalid:               "vcs_auth_invalid",
+	VcsUnauthorized:              "vcs_unauthorized",
+	WebhookDeliveryNotExists:     "webhook_delivery_not_exists",
+	RegistryServiceErr:           "registry_service_err",
+	PolicyAlreadyExist:           "policy_already_exist",
+	PolicyNotExist:               "policy_not_exist",
+	PolicyGroupAlreadyExist:      "policy_group_already_exist",
+	PolicyGroupNotExist:          "policy_group_not_exist",
+	PolicyBelongedToAnotherGroup: "policy_belonged_to_another_group",
+	PolicyGroupSyncNotExist:      "policy_group_sync_not_exist",
+	PolicyResultAlreadyExist:     "policy_result_already_exist",
+	PolicyResultNotExist:         "policy_result_not_exist",
+	PolicyRegoMissingComment:     "policy_rego_missing_comment",
+	PolicyErrorParseTemplate:     "policy_error_parse_template",
+	PolicySuppressNotExist:       "policy_suppress_not_exist",
+	PolicySuppressAlreadyExist:   "policy_suppress_already_exist",
+	PolicyRelNotExist:            "policy_rel_not_exist",
+	PolicyRelAlreadyExist:        "policy_rel_already_exist",
+	PolicyScanNotEnabled:         "policy_scan_not_enabled",
+	PolicyMetaInvalid:            "policy_meta_invalid",
+	PolicyRegoInvalid:            "policy_rego_invalid",
+	PolicyGroupDirError:          "policy_group_dir_error",
+	InvalidTfVersion:             "invalid_tf_version",
+	VariableGroupAlreadyExist:    "variable_group_already_exist",
+	VariableGroupNotExist:        "variable_group_not_exist",
+	VariableGroupAliasDuplicate:  "variable_group_alias_duplicate",
+	VariableGroupShareInvalid:    "variable_group_share_invalid",
+	VariableGroupNotShared:       "variable_group_not_shared",
+	CronExpressError:             "cron_express_error",
+	CronTaskFailed:               "cron_task_failed",
+	SystemConfigNotExist:         "system_config_not_exist",
+	BillingConnectorNotExist:     "billing_connector_not_exist",
+	BillingProviderInvalid:       "billing_provider_invalid",
+	BillingSyncFailed:            "billing_sync_failed",
+	ChatIdentityAlreadyExists:    "chat_identity_already_exists",
+	ChatIdentityNotExists:        "chat_identity_not_exists",
+	ChatOpsDisabled:              "chat_ops_disabled",
+	ChatOpsSignatureInvalid:      "chat_ops_signature_invalid",
+	FreezeWindowNotExist:         "freeze_window_not_exist",
+	FreezeWindowInvalid:          "freeze_window_invalid",
+	FreezeOverrideNoReason:       "freeze_override_no_reason",
+	CostPriceNotExist:            "cost_price_not_exist",
+	CostPriceInvalid:             "cost_price_invalid",
+	FleetDeployNotExist:          "fleet_deploy_not_exist",
+	FleetDeployInvalid:           "fleet_deploy_invalid",
+	FleetDeployNoEnv:             "fleet_deploy_no_env",
+	FleetDeployNotRunning:        "fleet_deploy_not_running",
+	RunnerNotExist:               "runner_not_exist",
+	RunnerAlreadyExists:          "runner_already_exists",
+	RunnerNotAllowed:             "runner_not_allowed",
+	RunnerNoMatch:                "runner_no_match",
+	RunnerRequestFailed:          "runner_request_failed",
+	PromotionChainNotExist:       "promotion_chain_not_exist",
+	PromotionChainInvalid:        "promotion_chain_invalid",
+	PromotionStageInvalid:        "promotion_stage_invalid",
+	PromotionTaskInvalid:         "promotion_task_invalid",
+}
+
+// errorHints 错误的处理建议，只为用户可以自行处理的错误提供
+var errorHints = map[int]map[string]string{
+	BadRequest: {
+		"zh-cn": "请检查请求是否缺少必要的参数或请求头(如 IaC-Org-Id、IaC-Project-Id)",
+	},
+	BadParam: {
+		"zh-cn": "请根据 message_detail 中的错误详情修改参数",
+	},
+	InvalidPipeline: {
+		"zh-cn": "请检查云模板工作目录下 .cloudiac-pipeline.yml 文件的格式及版本",
+	},
+	TemplateWorkdirError: {
+		"zh-cn": "请确认工作目录在代码仓库的对应分支中存在，工作目录为基于仓库根目录的相对路径",
+	},
+	TemplateModuleError: {
+		"zh-cn": "请检查 registry 模块地址及版本是否正确，私有 registry 需要先在系统设置中配置地址",
+	},
+	TaskOfflineCheckFailed: {
+		"zh-cn": "请在 portal 及 runner 的 offline 配置中设置对应的内网镜像源，或修改作业使用的镜像",
+	},
+	ProjectQuotaExceeded: {
+		"zh-cn": "请归档或销毁项目中不再使用的环境，或联系组织管理员调整项目配额",
+	},
+	VcsAddressError: {
+		"zh-cn": "请检查 VCS 地址是否包含协议(http:// 或 https://)",
+	},
+	VcsInvalidToken: {
+		"zh-cn": "请在 VCS 设置中更新 token，并确认 token 具有仓库的读取权限",
+	},
+	VcsAuthInvalid: {
+		"zh-cn": "OAuth 认证需要填写 client id 及 client secret，GitHub App 认证还需要填写 app id、私钥及安装 id，仅 GitHub 及 GitLab 支持 OAuth 认证",
+	},
+	VcsUnauthorized: {
+		"zh-cn": "请在 VCS 设置中完成 OAuth 授权，授权过期时需要重新授权",
+	},
+	VcsConnectError: {
+		"zh-cn": "请检查 VCS 地址是否正确，以及 portal 与 VCS 服务之间的网络是否连通",
+	},
+	VcsConnectTimeOut: {
+		"zh-cn": "请检查 portal 与 VCS 服务之间的网络是否连通，或稍后重试",
+	},
+	InvalidToken: {
+		"zh-cn": "请重新登录或使用有效的 API token",
+	},
+	TokenExpired: {
+		"zh-cn": "请重新登录或重新生成 API token",
+	},
+	InvalidOrgId: {
+		"zh-cn": "请检查请求头 IaC-Org-Id 是否正确，并确认当前用户属于该组织",
+	},
+	InvalidProjectId: {
+		"zh-cn": "请检查请求头 IaC-Project-Id 是否正确，并确认当前用户属于该项目",
+	},
+	PermissionDeny: {
+		"zh-cn": "请联系组织管理员或项目管理员授予相应的角色",
+	},
+	TemplateKeyIdNotSet: {
+		"zh-cn": "执行 playbook 需要先为云模板或环境设置部署密钥",
+	},
+	TemplateArchived: {
+		"zh-cn": "请先恢复云模板再进行操作",
+	},
+	TplSuccessorInvalid: {
+		"zh-cn": "请选择同一组织下未废弃且未归档的云模板作为替代云模板",
+	},
+	TplTriggerFilterInvalid: {
+		"zh-cn": "分支及路径使用通配符格式，如 release/*、modules/*.tf，以 / 结尾的路径匹配目录下的所有文件",
+	},
+	TplManifestInvalid: {
+		"zh-cn": "请确认代码仓库根目录下存在 .cloudiac.yml 文件，每个云模板都需要设置不重复的 name",
+	},
+	EnvArchived: {
+		"zh-cn": "请先恢复环境再进行操作",
+	},
+	EnvDeploying: {
+		"zh-cn": "请等待环境当前的作业结束后再进行操作",
+	},
+	EnvCheckAutoApproval: {
+		"zh-cn": "开启自动审批，或关闭自动纠漂移及推送到分支时重新部署",
+	},
+	EnvAttestationOverdue: {
+		"zh-cn": "请由环境负责人完成合规声明后再发起部署",
+	},
+	EnvDeployFrozen: {
+		"zh-cn": "请在冻结期结束后部署，紧急情况可以填写原因申请紧急放行",
+	},
+	EnvDeployWindowInvalid: {
+		"zh-cn": "星期取值为 0-6(0 为周日)，时间格式为 HH:MM，时区使用 IANA 时区名称(如 Asia/Shanghai)",
+	},
+	EnvLocked: {
+		"zh-cn": "请联系锁定人解锁环境，或由项目管理员强制解锁",
+	},
+	EnvLockedByOthers: {
+		"zh-cn": "只有锁定人可以解锁，项目管理员可以使用 force 参数强制解锁",
+	},
+	EnvStateVersionNotExists: {
+		"zh-cn": "请通过环境的 state 版本列表确认版本号",
+	},
+	EnvStateInvalid: {
+		"zh-cn": "请上传 terraform 0.12 及以上版本生成的 state 文件(version 为 4)",
+	},
+	EnvStateImportForbidden: {
+		"zh-cn": "请新建环境后立即导入，不要先执行部署任务；多工作目录云模板的环境不支持导入",
+	},
+	EnvPlanApplied: {
+		"zh-cn": "每个 plan 只能执行一次，请重新执行 plan 任务",
+	},
+	EnvPlanStale: {
+		"zh-cn": "请重新执行 plan 任务，基于环境最新的资源生成 plan",
+	},
+	EnvAutoDestroyNotSet: {
+		"zh-cn": "请先为环境设置存活时间(ttl)或销毁时间",
+	},
+	EnvSuspendJobInvalid: {
+		"zh-cn": "可以暂停的定时任务为 autoDestroy、drift 及 autoDeploy",
+	},
+	EnvProtected: {
+		"zh-cn": "请根据提示的原因调整任务参数，或由项目管理员修改环境的保护规则",
+	},
+	EnvProtectionInvalid: {
+		"zh-cn": "允许部署的分支支持 * 及 ? 通配符，如 release/*",
+	},
+	TaskNotHaveStep: {
+		"zh-cn": "请检查 pipeline 是否为当前作业类型定义了执行步骤",
+	},
+	TaskImportAddrInvalid: {
+		"zh-cn": "资源地址格式为 [module.<名称>.]<资源类型>.<资源名称>[索引]，如 aws_instance.web 或 module.vpc.aws_subnet.private[0]，数据源不能导入",
+	},
+	TaskTargetInvalid: {
+		"zh-cn": "target 格式为资源地址或模块地址，如 aws_instance.web、aws_instance.web[0] 或 module.vpc，多个 target 用 , 分隔",
+	},
+	TaskTargetNotFound: {
+		"zh-cn": "销毁指定资源时 target 必须匹配环境当前的资源，请在环境资源列表中确认资源地址",
+	},
+	TaskRetryNotAllowed: {
+		"zh-cn": "只有环境最新的失败作业可以从失败步骤重试，且 runner 需保留作业的工作目录，其他情况请重新发起部署",
+	},
+	TaskStepTimeoutsInvalid: {
+		"zh-cn": "可设置超时的步骤类型为 init、plan、apply(同时作用于 destroy)、play，超时时间为大于 0 的秒数",
+	},
+	TaskAlreadyApproved: {
+		"zh-cn": "作业需要多人审批时每个审批人只能审批一次，请等待其他审批人审批",
+	},
+	TaskGuardrailApproval: {
+		"zh-cn": "请联系组织管理员审批该作业，或减少单次变更的资源数量",
+	},
+	TaskTplApproverRequired: {
+		"zh-cn": "请联系云模板设置的审批人审批该作业",
+	},
+	KeyDecryptFail: {
+		"zh-cn": "请确认 portal 的加密密钥配置未变更，或重新上传密钥",
+	},
+	PolicyScanNotEnabled: {
+		"zh-cn": "请先在云模板或环境的合规设置中开启合规检测，并绑定策略组",
+	},
+	PolicyRegoInvalid: {
+		"zh-cn": "请使用策略测试功能检查 rego 语法",
+	},
+	PolicyGroupDirError: {
+		"zh-cn": "请确认策略组目录在代码仓库中存在，且包含 .rego 策略文件",
+	},
+	InvalidTfVersion: {
+		"zh-cn": "请从支持的 terraform 版本列表中选择版本",
+	},
+	CronExpressError: {
+		"zh-cn": "请使用 5 段格式的 cron 表达式，如 */30 * * * *",
+	},
+	ChatOpsDisabled: {
+		"zh-cn": "请在 portal 配置文件的 chatops 配置中启用该平台",
+	},
+	FreezeOverrideNoReason: {
+		"zh-cn": "申请紧急放行时请填写原因",
+	},
+	CostPriceInvalid: {
+		"zh-cn": "价格不能为负数；指定匹配属性时必须同时指定属性值",
+	},
+	FleetDeployInvalid: {
+		"zh-cn": "需要至少指定云模板、云模板标签、项目或环境中的一个筛选条件，并发数需大于 0",
+	},
+	FleetDeployNoEnv: {
+		"zh-cn": "已归档及未部署(inactive)的环境不会被选中，请检查筛选条件",
+	},
+	RunnerNotAllowed: {
+		"zh-cn": "请选择绑定了当前组织或项目的 runner，或者未绑定组织及项目的共享 runner",
+	},
+	RunnerNoMatch: {
+		"zh-cn": "请检查环境设置的 runner 标签，并确认包含这些标签的 runner 在线、已启用且对当前组织或项目可用",
+	},
+	PromotionChainInvalid: {
+		"zh-cn": "晋级链需要包含至少两个使用同一云模板的未归档环境，且环境不能重复",
+	},
+	PromotionStageInvalid: {
+		"zh-cn": "只能从晋级链中非最后一个阶段的环境晋级到下一阶段",
+	},
+	PromotionTaskInvalid: {
+		"zh-cn": "请选择来源环境中执行成功的 apply 任务，或先部署来源环境",
+	},
+}
+
+// ErrorInfo 结构化的错误信息，随接口错误响应返回，便于 UI 及 CLI 展示处理建议
+type ErrorInfo struct {
+	Code    int    `json:"code"`           // 错误码
+	Key     string `json:"key"`            // 稳定的错误标识
+	Message string `json:"message"`        // 本地化的错误消息
+	Hint    string `json:"hint,omitempty"` // 处理建议
+	DocKey  string `json:"docKey"`         // 帮助文档索引
+}
+
+// ErrorKey 返回错误码对应的稳定标识
+func ErrorKey(code int) string {
+	if key, ok := errorKeys[code]; ok {
+		return key
+	}
+	return fmt.Sprintf("error_%d", code)
+}
+
+// ErrorHint 返回错误的处理建议，没有处理建议时返回空字符串
+func ErrorHint(err Error, lang string) string {
+	return localize(errorHints[err.Code()], lang)
+}
+
+// Describe 生成错误的结构化信息
+func Describe(err Error, lang string) *ErrorInfo {
+	key := ErrorKey(err.Code())
+	return &ErrorInfo{
+		Code:    err.Code(),
+		Key:     key,
+		Message: ErrorMsg(err, lang),
+		Hint:    ErrorHint(err, lang),
+		DocKey:  "errors/" + key,
+	}
+}
+
+// parseLang 从 Accept-Language 请求头中解析首选语言，如 "zh-CN,zh;q=0.9" 解析为 "zh-cn"
+func parseLang(acceptLanguage string) string {
+	lang := strings.SplitN(acceptLanguage, ",", 2)[0]
+	lang = strings.SplitN(lang, ";", 2)[0]
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return defaultLang
+	}
+	return lang
+}
+
+// localize 按语言选择文本，没有对应语言时使用默认语言
+func localize(m map[string]string, lang string) string {
+	if msg, ok := m[parseLang(lang)]; ok {
+		return msg
+	}
+	return m[defaultLang]
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package e
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCatalog(t *testing.T) {
+	keys := make(map[string]int)
+	for code, key := range errorKeys {
+		if other, ok := keys[key]; ok {
+			t.Errorf("error key %s duplicated: %d, %d", key, code, other)
+		}
+		keys[key] = code
+		if _, ok := errorMsgs[code]; !ok {
+			t.Errorf("error %d(%s) has no message", code, key)
+		}
+	}
+	for code := range errorMsgs {
+		if _, ok := errorKeys[code]; !ok {
+			t.Errorf("error %d has no key", code)
+		}
+	}
+	for code := range errorHints {
+		if _, ok := errorKeys[code]; !ok {
+			t.Errorf("error hint %d has no key", code)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	info := Describe(New(PolicyScanNotEnabled), "zh-CN,zh;q=0.9,en;q=0.8")
+	assert.Equal(t, PolicyScanNotEnabled, info.Code)
+	assert.Equal(t, "policy_scan_not_enabled", info.Key)
+	assert.Equal(t, "扫描未启用", info.Message)
+	assert.NotEmpty(t, info.Hint)
+	assert.Equal(t, "errors/policy_scan_not_enabled", info.DocKey)
+
+	info = Describe(New(DBError), "en-US")
+	assert.Equal(t, "db_error", info.Key)
+	assert.Empty(t, info.Hint)
+	assert.Equal(t, "error_99999", ErrorKey(99999))
+}
@@ -203,16 +203,8 @@ func AutoNew(err error, code int, status ...int) Error {
 const defaultLang = "zh-cn"
 
 func ErrorMsg(err Error, lang string) string {
-	if lang == "" {
-		lang = defaultLang
-	}
-
-	if m, ok := errorMsgs[err.Code()]; ok {
-		if msg, ok := m[lang]; ok {
-			return msg
-		} else if msg, ok := m[defaultLang]; ok {
-			return msg
-		}
+	if msg := localize(errorMsgs[err.Code()], lang); msg != "" {
+		return msg
 	}
 	return err.Error()
 }
@@ -55,6 +55,7 @@ const (
 	ForbiddenAccessKey     = 10382
 	TemplateNameRepeat     = 10383
 	TemplateWorkdirError   = 10384
+	TemplateModuleError    = 10385
 
 	//// 第三方服务错误 104
 	LdapError       = 10410 // ldap 出错
@@ -108,6 +109,10 @@ const (
 	OrganizationDisabled      = 30312
 	OrganizationInvalidStatus = 30314
 	InvalidOrganizationId     = 30315
+	OrgPurgeScheduled         = 30316
+	OrgPurgeNotScheduled      = 30317
+	OrgNameMismatch           = 30318
+	OrgCertNotExists          = 30319
 
 	//// project 304
 	ProjectAlreadyExists      = 30410
@@ -115,6 +120,8 @@ const (
 	ProjectAliasDuplicate     = 30412
 	ProjectUserAlreadyExists  = 30420
 	ProjectUserAliasDuplicate = 30421
+	ProjectQuotaExceeded      = 30430
+	ProjectQuotaInvalid       = 30431
 
 	//// variable 305
 	VariableAlreadyExists  = 30510
@@ -135,15 +142,45 @@ const (
 	TemplateDisabled        = 30712
 	TemplateActiveEnvExists = 30730
 	TemplateKeyIdNotSet     = 30731
+	TemplateUnhealthy       = 30740
+	TplRevisionNotExists    = 30741
+	TplLaunchFormInvalid    = 30742
+	TemplateArchived        = 30743
+	TemplateNotArchived     = 30744
+	TplDependencyInvalid    = 30745
+	TplApproversInvalid     = 30746
+	TplSuccessorInvalid     = 30747
+	TemplateNotDeprecated   = 30748
+	TplTriggerFilterInvalid = 30749
+	TplManifestInvalid      = 30750
 
 	//// environment 308
-	EnvAlreadyExists       = 30810
-	EnvNotExists           = 30811
-	EnvAliasDuplicate      = 30812
-	EnvArchived            = 30813
-	EnvCannotArchiveActive = 30814
-	EnvDeploying           = 30815
-	EnvCheckAutoApproval   = 30816
+	EnvAlreadyExists         = 30810
+	EnvNotExists             = 30811
+	EnvAliasDuplicate        = 30812
+	EnvArchived              = 30813
+	EnvCannotArchiveActive   = 30814
+	EnvDeploying             = 30815
+	EnvCheckAutoApproval     = 30816
+	EnvAttestationOverdue    = 30817
+	EnvLaunchFormInvalid     = 30818
+	EnvDeployFrozen          = 30819
+	EnvDeployWindowInvalid   = 30820
+	EnvLocked                = 30821
+	EnvNotLocked             = 30822
+	EnvLockedByOthers        = 30823
+	EnvStateVersionNotExists = 30824
+	EnvStateInvalid          = 30825
+	EnvStateNotExists        = 30826
+	EnvStateImportForbidden  = 30827
+	EnvPlanNotExists         = 30828
+	EnvPlanApplied           = 30829
+	EnvPlanStale             = 30830
+	EnvAutoDestroyNotSet     = 30831
+	EnvAutoDestroyStarted    = 30832
+	EnvSuspendJobInvalid     = 30833
+	EnvProtected             = 30834
+	EnvProtectionInvalid     = 30835
 
 	//// task 309
 	TaskAlreadyExists     = 30910
@@ -152,6 +189,22 @@ const (
 	TaskStepNotExists     = 30914
 	TaskNotHaveStep       = 30916
 
+	TaskGuardrailApproval   = 30917
+	TaskTplApproverRequired = 30918
+	TaskNotScheduled        = 30919
+	TaskImportAddrInvalid   = 30920
+	TaskImportNotSupported  = 30921
+	TaskTargetInvalid       = 30922
+	TaskTargetNotFound      = 30923
+	TaskRetryNotAllowed     = 30924
+	TaskCancelNotAllowed    = 30925
+	TaskStepTimeoutsInvalid = 30926
+	TaskAlreadyApproved     = 30927
+	TaskArtifactNotExists   = 30928
+	TaskOfflineCheckFailed  = 30929
+	TaskNotQueued           = 30930
+	TaskRetryPolicyInvalid  = 30931
+
 	//// ssh key 310
 	KeyAlreadyExists  = 31010
 	KeyNotExist       = 31011
@@ -159,8 +212,12 @@ const (
 	KeyDecryptFail    = 31013
 
 	//// vcs 311
-	VcsNotExists   = 31110
-	VcsDeleteError = 31120
+	VcsNotExists    = 31110
+	VcsDeleteError  = 31120
+	VcsAuthInvalid  = 31130
+	VcsUnauthorized = 31131
+
+	WebhookDeliveryNotExists = 31140
 
 	//// 317
 	RegistryServiceErr = 31710
@@ -171,6 +228,7 @@ const (
 	PolicyGroupAlreadyExist      = 31221
 	PolicyGroupNotExist          = 31222
 	PolicyBelongedToAnotherGroup = 31223
+	PolicyGroupSyncNotExist      = 31224
 	PolicyResultAlreadyExist     = 31230
 	PolicyResultNotExist         = 31231
 	PolicyRegoMissingComment     = 31340
@@ -192,6 +250,8 @@ const (
 	VariableGroupAlreadyExist   = 31410
 	VariableGroupNotExist       = 31411
 	VariableGroupAliasDuplicate = 31412
+	VariableGroupShareInvalid   = 31413
+	VariableGroupNotShared      = 31414
 
 	//cron 315
 	CronExpressError = 31500
@@ -199,6 +259,45 @@ const (
 
 	// system config 316
 	SystemConfigNotExist = 31610
+
+	// billing 318
+	BillingConnectorNotExist = 31810
+	BillingProviderInvalid   = 31811
+	BillingSyncFailed        = 31820
+
+	// chatops 319
+	ChatIdentityAlreadyExists = 31910
+	ChatIdentityNotExists     = 31911
+	ChatOpsDisabled           = 31920
+	ChatOpsSignatureInvalid   = 31921
+
+	// freeze window 320
+	FreezeWindowNotExist   = 32010
+	FreezeWindowInvalid    = 32011
+	FreezeOverrideNoReason = 32020
+
+	// cost 321
+	CostPriceNotExist = 32110
+	CostPriceInvalid  = 32111
+
+	// fleet deploy 322
+	FleetDeployNotExist   = 32210
+	FleetDeployInvalid    = 32211
+	FleetDeployNoEnv      = 32212
+	FleetDeployNotRunning = 32213
+
+	// runner 323
+	RunnerNotExist      = 32310
+	RunnerAlreadyExists = 32311
+	RunnerNotAllowed    = 32312
+	RunnerNoMatch       = 32313
+	RunnerRequestFailed = 32314
+
+	// env promotion 324
+	PromotionChainNotExist = 32410
+	PromotionChainInvalid  = 32411
+	PromotionStageInvalid  = 32412
+	PromotionTaskInvalid   = 32413
 )
 
 var errorMsgs = map[int]map[string]string{
@@ -253,6 +352,9 @@ var errorMsgs = map[int]map[string]string{
 	TemplateWorkdirError: {
 		"zh-cn": "工作目录校验失败",
 	},
+	TemplateModuleError: {
+		"zh-cn": "registry 模块不存在或无法访问",
+	},
 	BadRequest: {
 		"zh-cn": "无效请求",
 	},
@@ -385,6 +487,18 @@ var errorMsgs = map[int]map[string]string{
 	InvalidOrganizationId: {
 		"zh-cn": "无效的组织ID",
 	},
+	OrgPurgeScheduled: {
+		"zh-cn": "组织已计划清除数据",
+	},
+	OrgPurgeNotScheduled: {
+		"zh-cn": "组织未计划清除数据",
+	},
+	OrgNameMismatch: {
+		"zh-cn": "确认的组织名称不一致",
+	},
+	OrgCertNotExists: {
+		"zh-cn": "组织数据销毁证明不存在",
+	},
 	NameDuplicate: {
 		"zh-cn": "名称重复",
 	},
@@ -422,6 +536,15 @@ var errorMsgs = map[int]map[string]string{
 	EmptyVarValue: {
 		"zh-cn": "变量值不可为空",
 	},
+	ProjectAlreadyExists: {
+		"zh-cn": "项目已存在",
+	},
+	ProjectNotExists: {
+		"zh-cn": "项目不存在",
+	},
+	ProjectAliasDuplicate: {
+		"zh-cn": "项目名称重复",
+	},
 	ProjectUserAlreadyExists: {
 		"zh-cn": "项目用户已经存在",
 	},
@@ -429,6 +552,12 @@ var errorMsgs = map[int]map[string]string{
 	ProjectUserAliasDuplicate: {
 		"zh-cn": "项目别名重复",
 	},
+	ProjectQuotaExceeded: {
+		"zh-cn": "超出项目配额",
+	},
+	ProjectQuotaInvalid: {
+		"zh-cn": "项目配额设置无效",
+	},
 
 	TokenAlreadyExists: {
 		"zh-cn": "Token已经存在",
@@ -449,6 +578,9 @@ var errorMsgs = map[int]map[string]string{
 	TemplateActiveEnvExists: {
 		"zh-cn": "模板存在活跃环境",
 	},
+	LdapError: {
+		"zh-cn": "LDAP 服务出错",
+	},
 	ConsulConnError: {
 		"zh-cn": "consul链接失败",
 	},
@@ -470,6 +602,63 @@ var errorMsgs = map[int]map[string]string{
 	EnvCheckAutoApproval: {
 		"zh-cn": "配置自动纠漂移、推送到分支时重新部署时，必须配置自动审批",
 	},
+	EnvAttestationOverdue: {
+		"zh-cn": "环境合规声明已逾期，完成合规声明后才能部署",
+	},
+	EnvLaunchFormInvalid: {
+		"zh-cn": "环境变量不符合云模板部署表单的要求",
+	},
+	EnvDeployFrozen: {
+		"zh-cn": "环境处于部署冻结期，需要紧急放行权限才能部署",
+	},
+	EnvDeployWindowInvalid: {
+		"zh-cn": "环境部署窗口配置错误",
+	},
+	EnvLocked: {
+		"zh-cn": "环境已被锁定，解锁前不能发起部署或销毁任务",
+	},
+	EnvNotLocked: {
+		"zh-cn": "环境未锁定",
+	},
+	EnvLockedByOthers: {
+		"zh-cn": "环境由其他用户锁定，只有项目管理员可以强制解锁",
+	},
+	EnvStateVersionNotExists: {
+		"zh-cn": "环境 state 版本不存在",
+	},
+	EnvStateInvalid: {
+		"zh-cn": "环境 state 内容无法解析",
+	},
+	EnvStateNotExists: {
+		"zh-cn": "环境 state 不存在",
+	},
+	EnvStateImportForbidden: {
+		"zh-cn": "只能向未部署过的环境导入 state",
+	},
+	EnvPlanNotExists: {
+		"zh-cn": "plan 产物不存在",
+	},
+	EnvPlanApplied: {
+		"zh-cn": "plan 已经被执行",
+	},
+	EnvPlanStale: {
+		"zh-cn": "plan 已失效，环境资源在 plan 之后发生了变更",
+	},
+	EnvAutoDestroyNotSet: {
+		"zh-cn": "环境未设置自动销毁时间",
+	},
+	EnvAutoDestroyStarted: {
+		"zh-cn": "环境已经开始自动销毁",
+	},
+	EnvSuspendJobInvalid: {
+		"zh-cn": "无效的环境定时任务",
+	},
+	EnvProtected: {
+		"zh-cn": "任务不满足环境的保护规则",
+	},
+	EnvProtectionInvalid: {
+		"zh-cn": "无效的环境保护规则",
+	},
 	TaskAlreadyExists: {
 		"zh-cn": "任务已经存在",
 	},
@@ -497,6 +686,15 @@ var errorMsgs = map[int]map[string]string{
 	VcsDeleteError: {
 		"zh-cn": "vcs存在相关依赖云模版，无法删除",
 	},
+	VcsAuthInvalid: {
+		"zh-cn": "vcs认证配置错误",
+	},
+	VcsUnauthorized: {
+		"zh-cn": "vcs未完成OAuth授权",
+	},
+	WebhookDeliveryNotExists: {
+		"zh-cn": "webhook投递记录不存在",
+	},
 	ImportError: {
 		"zh-cn": "导入出错",
 	},
@@ -509,6 +707,51 @@ var errorMsgs = map[int]map[string]string{
 	TaskApproveNotPending: {
 		"zh-cn": "作业状态非待审批，不允许操作",
 	},
+	TaskGuardrailApproval: {
+		"zh-cn": "作业超出环境资源规模限制，需要组织管理员审批",
+	},
+	TaskTplApproverRequired: {
+		"zh-cn": "云模板要求由指定的审批人审批部署作业",
+	},
+	TaskNotScheduled: {
+		"zh-cn": "任务不是等待计划执行的任务",
+	},
+	TaskImportAddrInvalid: {
+		"zh-cn": "导入的资源地址格式错误",
+	},
+	TaskImportNotSupported: {
+		"zh-cn": "多工作目录云模板的环境不支持导入资源",
+	},
+	TaskTargetInvalid: {
+		"zh-cn": "target 资源地址格式错误",
+	},
+	TaskTargetNotFound: {
+		"zh-cn": "target 资源地址不在环境资源中",
+	},
+	TaskRetryNotAllowed: {
+		"zh-cn": "作业不能从失败步骤重试",
+	},
+	TaskCancelNotAllowed: {
+		"zh-cn": "作业已结束，不能取消",
+	},
+	TaskStepTimeoutsInvalid: {
+		"zh-cn": "步骤超时时间设置无效",
+	},
+	TaskAlreadyApproved: {
+		"zh-cn": "您已审批过该作业",
+	},
+	TaskArtifactNotExists: {
+		"zh-cn": "作业产物不存在",
+	},
+	TaskOfflineCheckFailed: {
+		"zh-cn": "离线模式下作业依赖的资源无法从内网获取",
+	},
+	TaskNotQueued: {
+		"zh-cn": "作业已开始执行，不在排队中",
+	},
+	TaskRetryPolicyInvalid: {
+		"zh-cn": "步骤自动重试策略设置无效",
+	},
 	KeyAlreadyExists: {
 		"zh-cn": "管理密钥已存在",
 	},
@@ -548,6 +791,10 @@ var errorMsgs = map[int]map[string]string{
 		"zh-cn": "策略属于其他策略组",
 	},
 
+	PolicyGroupSyncNotExist: {
+		"zh-cn": "策略组同步记录不存在",
+	},
+
 	PolicyResultAlreadyExist: {
 		"zh-cn": "结果已存在",
 	},
@@ -583,6 +830,21 @@ var errorMsgs = map[int]map[string]string{
 	PolicyScanNotEnabled: {
 		"zh-cn": "扫描未启用",
 	},
+	VariableGroupAlreadyExist: {
+		"zh-cn": "变量组已存在",
+	},
+	VariableGroupNotExist: {
+		"zh-cn": "变量组不存在",
+	},
+	VariableGroupAliasDuplicate: {
+		"zh-cn": "变量组名称重复",
+	},
+	VariableGroupShareInvalid: {
+		"zh-cn": "变量组共享范围设置错误",
+	},
+	VariableGroupNotShared: {
+		"zh-cn": "变量组未共享给当前项目或云模板",
+	},
 	CronExpressError: {
 		"zh-cn": "cron定时任务表达式错误",
 	},
@@ -601,7 +863,118 @@ var errorMsgs = map[int]map[string]string{
 	TemplateKeyIdNotSet: {
 		"zh-cn": "SSH 密钥未配置",
 	},
+	TemplateUnhealthy: {
+		"zh-cn": "云模板存在未使用或未声明的变量、未使用的输出",
+	},
+	TplRevisionNotExists: {
+		"zh-cn": "云模板修订记录不存在",
+	},
+	TplLaunchFormInvalid: {
+		"zh-cn": "云模板部署表单定义错误",
+	},
+	TemplateArchived: {
+		"zh-cn": "云模板已归档",
+	},
+	TemplateNotArchived: {
+		"zh-cn": "云模板未归档，请先归档再清除",
+	},
+	TplDependencyInvalid: {
+		"zh-cn": "云模板外部依赖定义错误",
+	},
+	TplApproversInvalid: {
+		"zh-cn": "云模板审批人设置错误",
+	},
+	TplSuccessorInvalid: {
+		"zh-cn": "替代云模板无效，不能是当前云模板或已废弃、已归档的云模板",
+	},
+	TemplateNotDeprecated: {
+		"zh-cn": "云模板未废弃",
+	},
+	TplTriggerFilterInvalid: {
+		"zh-cn": "云模板触发过滤条件错误",
+	},
+	TplManifestInvalid: {
+		"zh-cn": "代码仓库的云模板清单文件错误",
+	},
+	RegistryServiceErr: {
+		"zh-cn": "registry 服务出错",
+	},
 	PolicyGroupDirError: {
 		"zh-cn": "仓库在当前目录找不到策略文件",
 	},
+	BillingConnectorNotExist: {
+		"zh-cn": "账单连接器不存在",
+	},
+	BillingProviderInvalid: {
+		"zh-cn": "不支持的账单来源",
+	},
+	BillingSyncFailed: {
+		"zh-cn": "账单同步失败",
+	},
+	ChatIdentityAlreadyExists: {
+		"zh-cn": "聊天账号已绑定",
+	},
+	ChatIdentityNotExists: {
+		"zh-cn": "聊天账号绑定不存在",
+	},
+	ChatOpsDisabled: {
+		"zh-cn": "未启用该平台的聊天指令",
+	},
+	ChatOpsSignatureInvalid: {
+		"zh-cn": "聊天指令签名校验失败",
+	},
+	FreezeWindowNotExist: {
+		"zh-cn": "部署冻结窗口不存在",
+	},
+	FreezeWindowInvalid: {
+		"zh-cn": "部署冻结窗口配置错误",
+	},
+	FreezeOverrideNoReason: {
+		"zh-cn": "紧急放行必须填写原因",
+	},
+	CostPriceNotExist: {
+		"zh-cn": "价格配置不存在",
+	},
+	CostPriceInvalid: {
+		"zh-cn": "价格配置错误",
+	},
+	FleetDeployNotExist: {
+		"zh-cn": "批量部署不存在",
+	},
+	FleetDeployInvalid: {
+		"zh-cn": "批量部署参数错误",
+	},
+	FleetDeployNoEnv: {
+		"zh-cn": "没有符合条件的环境",
+	},
+	FleetDeployNotRunning: {
+		"zh-cn": "批量部署已结束",
+	},
+	RunnerNotExist: {
+		"zh-cn": "runner 不存在",
+	},
+	RunnerAlreadyExists: {
+		"zh-cn": "runner 已存在",
+	},
+	RunnerNotAllowed: {
+		"zh-cn": "runner 未分配给当前组织或项目",
+	},
+	RunnerNoMatch: {
+		"zh-cn": "没有满足要求的可用 runner",
+	},
+	RunnerRequestFailed: {
+		"zh-cn": "runner 请求失败",
+	},
+	PromotionChainNotExist: {
+		"zh-cn": "晋级链不存在",
+	},
+	PromotionChainInvalid: {
+		"zh-cn": "晋级链参数错误",
+	},
+	PromotionStageInvalid: {
+		"zh-cn": "环境不能晋级",
+	},
+	PromotionTaskInvalid: {
+		"zh-cn": "晋级的部署任务无效",
+	},
 }
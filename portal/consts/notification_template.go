@@ -148,6 +148,48 @@ var IacTaskApprovingTpl = `
 </html>
 `
 
+var IacTaskScheduledTpl = `
+<html>
+<body>
+<p>尊敬的CloudIaC用户：</p>
+<br />
+<p>	【{{.Creator}}】在CloudIaC平台发起的部署任务不在环境允许部署的时间窗口内，已排队等待执行，详情如下：</p>
+<br />
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	云模板：{{.TemplateName}}</p>
+<p>	分支/tag：{{.Revision}}</p>
+<p>	环境名称：{{.EnvName}}</p>
+<p>	任务类型：{{.TaskType}}</p>
+<p>	计划执行时间：{{.ScheduledAt}}</p>
+<br />
+<p>	更多详情请点击：{{.Addr}}</p>
+<br />
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
+var IacEnvAutoDestroyTpl = `
+<html>
+<body>
+<p>尊敬的CloudIaC用户：</p>
+<br />
+<p>	【{{.Creator}}】在CloudIaC平台部署的环境即将自动销毁，详情如下：</p>
+<br />
+<p>	所属组织：{{.OrgName}}</p>
+<p>	所属项目：{{.ProjectName}}</p>
+<p>	云模板：{{.TemplateName}}</p>
+<p>	环境名称：{{.EnvName}}</p>
+<p>	销毁时间：{{.DestroyAt}}</p>
+<br />
+<p>	如需保留环境，请在销毁前延长环境的存活时间：{{.Addr}}</p>
+<br />
+<p>	-----该邮件由系统自动发出，请勿回复-----</p>
+</body>
+</html>
+`
+
 const (
 	IacTaskRunningMarkdown = `
 尊敬的CloudIaC用户：
@@ -192,6 +234,48 @@ const (
 
 	更多详情请点击：{{.Addr}}
 
+	-----该消息由系统自动发出，请勿回复-----
+`
+	IacTaskScheduledMarkdown = `
+尊敬的CloudIaC用户：
+
+	【{{.Creator}}】在CloudIaC平台发起的部署任务不在环境允许部署的时间窗口内，已排队等待执行，详情如下：
+
+	所属组织：{{.OrgName}}
+
+	所属项目：{{.ProjectName}}
+
+	云模板：{{.TemplateName}}
+
+	分支/tag：{{.Revision}}
+
+	环境名称：{{.EnvName}}
+
+	任务类型：{{.TaskType}}
+
+	计划执行时间：{{.ScheduledAt}}
+
+	更多详情请点击：{{.Addr}}
+
+	-----该消息由系统自动发出，请勿回复-----
+`
+	IacEnvAutoDestroyMarkdown = `
+尊敬的CloudIaC用户：
+
+	【{{.Creator}}】在CloudIaC平台部署的环境即将自动销毁，详情如下：
+
+	所属组织：{{.OrgName}}
+
+	所属项目：{{.ProjectName}}
+
+	云模板：{{.TemplateName}}
+
+	环境名称：{{.EnvName}}
+
+	销毁时间：{{.DestroyAt}}
+
+	如需保留环境，请在销毁前延长环境的存活时间：{{.Addr}}
+
 	-----该消息由系统自动发出，请勿回复-----
 `
 	IacTaskFailedMarkdown = `
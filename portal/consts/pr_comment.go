@@ -5,10 +5,24 @@ package consts
 var PrCommentTpl = `
 🤖&nbsp;&nbsp;PR Plan for CloudIac environment <a href="{{.Addr}}">{{.Name}}</a><br>
 ` + "```Plan {{.Status}}```" + `
+{{- if .Summary}}
+<br>Plan: {{.Summary}}
+{{- end}}
+{{- if .Policy}}
+<br>Policy: {{.Policy}}
+{{- end}}
 <details>
 <summary>Plan Details</summary>
 <pre><code>
 {{.Content}}
 </code></pre>
 </details>
+{{- if .Validate}}
+<details>
+<summary>Validate Details</summary>
+<pre><code>
+{{.Validate}}
+</code></pre>
+</details>
+{{- end}}
 `
@@ -7,4 +7,12 @@ const (
 	RunnerTaskStepStatusURL    = "/api/v1/task/step/status"
 	RunnerTaskStepLogFollowURL = "/api/v1/task/step/log/follow"
 	RunnerStopTaskURL          = "/api/v1/task/stop"
+	RunnerCancelTaskURL        = "/api/v1/task/cancel"
+	RunnerContainersURL        = "/api/v1/containers"
+	RunnerWorkspacesURL        = "/api/v1/workspaces"
+	RunnerCleanupURL           = "/api/v1/cleanup"
+	RunnerHealthURL            = "/api/v1/health"
+
+	RunnerPluginCacheProvidersURL = "/api/v1/plugin_cache/providers"
+	RunnerPluginCachePrewarmURL   = "/api/v1/plugin_cache/prewarm"
 )
@@ -61,6 +61,9 @@ type JSONResult struct {
 	Message       string      `json:"message" example:"ok"`
 	MessageDetail string      `json:"message_detail,omitempty" example:"ok"`
 	Result        interface{} `json:"result,omitempty" swaggertype:"object"`
+
+	// 结构化的错误信息，包含稳定的错误标识及处理建议，只在请求出错时返回
+	Error *e.ErrorInfo `json:"error,omitempty"`
 }
 
 func (c *GinRequest) JSON(status int, msg interface{}, result interface{}) {
@@ -68,19 +71,24 @@ func (c *GinRequest) JSON(status int, msg interface{}, result interface{}) {
 		message = ""
 		code    = 0
 		detail  string
+		info    *e.ErrorInfo
 	)
 
 	if msg != nil {
+		lang := c.GetHeader("accept-language")
 		if er, ok := msg.(e.Error); ok {
 			if er.Status() != 0 {
 				status = er.Status()
 			}
-			message = e.ErrorMsg(er, c.GetHeader("accept-language"))
+			message = e.ErrorMsg(er, lang)
 			code = er.Code()
 			detail = er.Error()
+			info = e.Describe(er, lang)
 		} else {
 			code = e.InternalError
 			message = fmt.Sprintf("%v", msg)
+			info = e.Describe(e.New(code), lang)
+			info.Message = message
 		}
 	}
 
@@ -95,6 +103,7 @@ func (c *GinRequest) JSON(status int, msg interface{}, result interface{}) {
 		Message:       message,
 		MessageDetail: detail,
 		Result:        result,
+		Error:         info,
 	}
 
 	c.Context.JSON(status, jsonResult)
@@ -449,6 +449,10 @@ func openDB(dsn string) error {
 		DSN:               dsn,
 		DefaultStringSize: 255,
 	})
+	return openDialector(mysqlDial, slowThreshold, logLevel)
+}
+
+func openDialector(mysqlDial gorm.Dialector, slowThreshold time.Duration, logLevel gormLogger.LogLevel) error {
 	db, err := gorm.Open(mysqlDial, &gorm.Config{
 		NamingStrategy: namingStrategy,
 		Logger: gormLogger.New(logs.Get(), gormLogger.Config{
@@ -513,3 +517,13 @@ func Init(dsn string) {
 		logs.Get().Fatalln(err)
 	}
 }
+
+// InitWithConn 使用已打开的连接初始化，不查询数据库版本，用于单元测试
+func InitWithConn(conn gorm.ConnPool) error {
+	mysqlDial := mysql.New(mysql.Config{
+		Conn:                      conn,
+		SkipInitializeWithVersion: true,
+		DefaultStringSize:         255,
+	})
+	return openDialector(mysqlDial, time.Second, gormLogger.Silent)
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// CursorResp 游标分页的返回结果，适用于数据持续写入的列表，翻页时不会出现数据重复或遗漏
+type CursorResp struct {
+	List       interface{} `json:"list" swaggertype:"object"`
+	NextCursor string      `json:"nextCursor" example:"WyIyMDIyLTAxLTAxIl0"` // 下一页的游标，为空表示没有更多数据
+}
+
+// EncodeCursor 将最后一条数据的排序字段值编码为游标
+func EncodeCursor(values ...string) string {
+	bs, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+// DecodeCursor 解析游标，n 为游标中应包含的字段数量
+func DecodeCursor(cursor string, n int) ([]string, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	values := make([]string, 0, n)
+	if err := json.Unmarshal(bs, &values); err != nil || len(values) != n {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return values, nil
+}
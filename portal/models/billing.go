@@ -0,0 +1,77 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+// BillingConnector 云账单导入连接器
+type BillingConnector struct {
+	TimedModel
+
+	OrgId             Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`
+	Name              string `json:"name" gorm:"size:64;not null;comment:连接器名称"`
+	Provider          string `json:"provider" gorm:"size:32;not null;comment:账单来源" enums:"'alicloud_bss','aws_cur'"`
+	ResourceAccountId Id     `json:"resourceAccountId" gorm:"size:32;not null;comment:访问凭证所在资源账号ID"`
+	Options           JSON   `json:"options" gorm:"type:json;comment:连接器配置"` // region, bucket, key 等
+	Enabled           bool   `json:"enabled" gorm:"default:true"`
+	SyncInterval      int    `json:"syncInterval" gorm:"default:24;comment:同步间隔(小时)"`
+
+	LastSyncAt     *Time  `json:"lastSyncAt" gorm:"type:datetime;comment:最后一次同步时间"`
+	LastSyncStatus string `json:"lastSyncStatus" gorm:"size:16;default:''" enums:"'','success','failed'"`
+	LastSyncError  string `json:"lastSyncError" gorm:"type:text"`
+	NextSyncAt     *Time  `json:"nextSyncAt" gorm:"type:datetime;index;comment:下次同步时间"`
+}
+
+const (
+	BillingSyncSuccess = "success"
+	BillingSyncFailed  = "failed"
+)
+
+func (BillingConnector) TableName() string {
+	return "iac_billing_connector"
+}
+
+func (BillingConnector) NewId() Id {
+	return NewId("bc")
+}
+
+func (c BillingConnector) Migrate(sess *db.Session) (err error) {
+	return c.AddUniqueIndex(sess, "unique__org__billing_connector__name", "org_id", "name")
+}
+
+// BillingRecord 导入的账单明细，每条记录对应一个账期内单个云资源的费用
+type BillingRecord struct {
+	AutoUintIdModel
+
+	OrgId        Id     `json:"orgId" gorm:"size:32;not null;index"`
+	ConnectorId  Id     `json:"connectorId" gorm:"size:32;not null"`
+	Provider     string `json:"provider" gorm:"size:32;not null"`
+	BillingCycle string `json:"billingCycle" gorm:"size:16;not null;comment:账期(2006-01)"`
+
+	CloudResourceId string   `json:"cloudResourceId" gorm:"size:255;not null;comment:云资源实例ID"`
+	ProductCode     string   `json:"productCode" gorm:"size:64;default:''"`
+	Region          string   `json:"region" gorm:"size:64;default:''"`
+	Cost            float64  `json:"cost" gorm:"type:decimal(20,6);default:0"`
+	Currency        string   `json:"currency" gorm:"size:16;default:''"`
+	Tags            ResAttrs `json:"tags" gorm:"type:json"`
+
+	// 对账结果，未匹配到 CloudIaC 管理资源的记录 Managed 为 false
+	Managed    bool   `json:"managed" gorm:"default:false"`
+	ProjectId  Id     `json:"projectId" gorm:"size:32;default:''"`
+	EnvId      Id     `json:"envId" gorm:"size:32;default:''"`
+	ResourceId Id     `json:"resourceId" gorm:"size:32;default:''"` // 匹配到的 iac_resource id
+	Address    string `json:"address" gorm:"default:''"`            // 匹配到的资源 terraform address
+
+	CreatedAt Time `json:"createdAt" gorm:"type:datetime"`
+}
+
+func (BillingRecord) TableName() string {
+	return "iac_billing_record"
+}
+
+func (r BillingRecord) Migrate(sess *db.Session) (err error) {
+	return r.AddUniqueIndex(sess, "unique__billing_record__connector__cycle__res",
+		"connector_id", "billing_cycle", "cloud_resource_id", "product_code")
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	ChatPlatformSlack    = "slack"
+	ChatPlatformDingTalk = "dingtalk"
+)
+
+// ChatIdentity 聊天平台账号与 CloudIaC 用户的绑定关系，聊天指令以绑定用户的身份及权限执行
+type ChatIdentity struct {
+	TimedModel
+
+	OrgId      Id     `json:"orgId" gorm:"size:32;not null"`
+	UserId     Id     `json:"userId" gorm:"size:32;not null"`
+	Platform   string `json:"platform" gorm:"type:enum('slack','dingtalk');not null" enums:"slack,dingtalk"` // 聊天平台
+	ChatUserId string `json:"chatUserId" gorm:"size:64;not null" example:"U01ABCDEF"`                        // 聊天平台的用户 id(Slack user_id，钉钉 staffId)
+	CreatorId  Id     `json:"creatorId" gorm:"size:32"`
+}
+
+func (ChatIdentity) TableName() string {
+	return "iac_chat_identity"
+}
+
+func (i *ChatIdentity) CustomBeforeCreate(*db.Session) error {
+	if i.Id == "" {
+		i.Id = NewId("chati")
+	}
+	return nil
+}
+
+func (i ChatIdentity) Migrate(sess *db.Session) (err error) {
+	return i.AddUniqueIndex(sess, "unique__platform__chat_user", "platform", "chat_user_id")
+}
+
+// ChatOpsCommand 聊天指令执行记录，任务结束后通过 ReplyUrl 回复执行结果
+type ChatOpsCommand struct {
+	TimedModel
+
+	OrgId      Id     `json:"orgId" gorm:"size:32;not null"`
+	UserId     Id     `json:"userId" gorm:"size:32;not null"`
+	Platform   string `json:"platform" gorm:"type:enum('slack','dingtalk');not null"`
+	ChatUserId string `json:"chatUserId" gorm:"size:64;not null"`
+	Command    string `json:"command" gorm:"size:32;not null" example:"deploy"` // 指令名称
+	Args       string `json:"args" gorm:"size:255"`                             // 指令参数
+	TaskId     Id     `json:"taskId" gorm:"size:32;index"`                      // 指令创建的部署任务或扫描任务 id
+	ReplyUrl   string `json:"-" gorm:"type:text"`                               // 回复消息的地址(Slack response_url，钉钉 sessionWebhook)
+	Replied    bool   `json:"replied" gorm:"default:false"`                     // 是否已回复任务执行结果
+}
+
+func (ChatOpsCommand) TableName() string {
+	return "iac_chatops_command"
+}
+
+func (c *ChatOpsCommand) CustomBeforeCreate(*db.Session) error {
+	if c.Id == "" {
+		c.Id = NewId("chatc")
+	}
+	return nil
+}
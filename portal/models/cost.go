@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+// CostPrice 资源费用估算使用的价格配置，价格为组织结算币种的月度费用。
+// MatchAttr 为空时为该资源类型的默认价格，否则只匹配属性值为 MatchValue 的资源，
+// 如 aws_instance 的 instance_type 为 t3.micro 时每月 7.6
+type CostPrice struct {
+	TimedModel
+
+	OrgId        Id      `json:"orgId" gorm:"size:32;not null;comment:组织ID"`
+	ResourceType string  `json:"resourceType" gorm:"size:128;not null;comment:资源类型" example:"aws_instance"`
+	MatchAttr    string  `json:"matchAttr" gorm:"size:64;default:'';comment:匹配的资源属性" example:"instance_type"`
+	MatchValue   string  `json:"matchValue" gorm:"size:255;default:'';comment:匹配的属性值" example:"t3.micro"`
+	MonthlyPrice float64 `json:"monthlyPrice" gorm:"type:decimal(20,6);default:0;comment:月度费用"`
+	Description  string  `json:"description" gorm:"type:text"`
+}
+
+func (CostPrice) TableName() string {
+	return "iac_cost_price"
+}
+
+func (CostPrice) NewId() Id {
+	return NewId("cp")
+}
+
+func (p CostPrice) Migrate(sess *db.Session) (err error) {
+	return p.AddUniqueIndex(sess, "unique__org__cost_price",
+		"org_id", "resource_type", "match_attr", "match_value")
+}
+
+const (
+	CostActionCreate  = "create"
+	CostActionUpdate  = "update"
+	CostActionReplace = "replace"
+	CostActionDelete  = "delete"
+	CostActionNoop    = "no-op"
+)
+
+// TaskCostEstimate 任务 plan 结果中单个资源的费用估算
+type TaskCostEstimate struct {
+	AutoUintIdModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+
+	Address string `json:"address" gorm:"not null"`
+	Type    string `json:"type" gorm:"size:128;not null"`
+	Action  string `json:"action" gorm:"size:16;not null" enums:"create,update,replace,delete,no-op"`
+	Priced  bool   `json:"priced" gorm:"default:false"` // 是否匹配到了价格配置，未匹配的资源费用按 0 计算
+
+	MonthlyBefore float64 `json:"monthlyBefore" gorm:"type:decimal(20,6);default:0"` // 变更前的月度费用
+	MonthlyAfter  float64 `json:"monthlyAfter" gorm:"type:decimal(20,6);default:0"`  // 变更后的月度费用
+	MonthlyDelta  float64 `json:"monthlyDelta" gorm:"type:decimal(20,6);default:0"`  // 月度费用变化
+}
+
+func (TaskCostEstimate) TableName() string {
+	return "iac_task_cost_estimate"
+}
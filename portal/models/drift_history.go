@@ -0,0 +1,22 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+// ResourceDriftHistory 偏移检测发现的资源偏移历史，每次检测发现偏移的资源各记录一条。
+// iac_resource_drift 只保存资源当前的偏移信息，历史记录用于统计资源及环境的偏移频率
+type ResourceDriftHistory struct {
+	AutoUintIdModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;index"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null"` // 偏移检测任务ID
+
+	Address     string `json:"address" gorm:"not null"`
+	DriftDetail string `json:"driftDetail" gorm:"type:text"`
+	DetectedAt  Time   `json:"detectedAt" gorm:"type:datetime;not null;index"` // 检测时间
+}
+
+func (ResourceDriftHistory) TableName() string {
+	return "iac_resource_drift_history"
+}
@@ -5,6 +5,7 @@ package models
 import (
 	"cloudiac/common"
 	"cloudiac/portal/libs/db"
+	"database/sql/driver"
 	"path"
 	"time"
 
@@ -20,6 +21,29 @@ const (
 	//EnvStatusApproving = "approving" // 等待审批
 )
 
+const (
+	EnvCriticalityProd    = "prod"
+	EnvCriticalityStaging = "staging"
+	EnvCriticalityDev     = "dev"
+)
+
+const (
+	EnvDriftModeDetectOnly = "detect-only" // 只检测偏移并发送通知
+	EnvDriftModeRemediate  = "remediate"   // 检测到偏移后创建部署任务纠正偏移
+)
+
+// EnvCriticalityPriority 返回环境重要程度对应的任务调度优先级，值越大越优先调度
+func EnvCriticalityPriority(criticality string) int {
+	switch criticality {
+	case EnvCriticalityProd:
+		return 2
+	case EnvCriticalityStaging:
+		return 1
+	default:
+		return 0
+	}
+}
+
 var (
 	EnvStatus     = []string{EnvStatusActive, EnvStatusFailed, EnvStatusInactive}
 	EnvTaskStatus = []string{TaskRunning, TaskApproving} // 环境 taskStatus 有效值
@@ -59,6 +83,11 @@ type Env struct {
 
 	LastScanTaskId Id `json:"lastScanTaskId" gorm:"size:32"` // 最后一次策略扫描任务 id
 
+	// 各触发方式最后一次策略扫描任务 id，避免手动扫描覆盖部署时的扫描状态
+	LastManualScanTaskId    Id `json:"lastManualScanTaskId" gorm:"size:32"`    // 最后一次手动触发的扫描任务 id
+	LastDeployScanTaskId    Id `json:"lastDeployScanTaskId" gorm:"size:32"`    // 最后一次部署时执行的扫描任务 id
+	LastScheduledScanTaskId Id `json:"lastScheduledScanTaskId" gorm:"size:32"` // 最后一次系统触发(webhook 等)的扫描任务 id
+
 	AutoApproval    bool `json:"autoApproval" gorm:"default:false"`    // 是否自动审批
 	StopOnViolation bool `json:"stopOnViolation" gorm:"default:false"` // 当合规不通过是否中止部署
 
@@ -84,10 +113,54 @@ type Env struct {
 	AutoRepairDrift   bool       `json:"autoRepairDrift" gorm:"default:false"`   // 是否进行自动纠偏
 	OpenCronDrift     bool       `json:"openCronDrift" gorm:"default:false"`     // 是否开启偏移检测
 	NextDriftTaskTime *time.Time `json:"nextDriftTaskTime" gorm:"type:datetime"` // 下次执行偏移检测任务的时间
+	// 偏移处理模式，remediate 模式下偏移检测(plan)发现偏移后创建纠偏部署任务，任务是否自动审批使用环境的设置
+	DriftMode string `json:"driftMode" gorm:"size:16;default:'detect-only'" enums:"detect-only,remediate"`
 
 	// 合规相关
 	PolicyEnable bool `json:"policyEnable" grom:"default:false"` // 是否开启合规检测
+	PlanScan     bool `json:"planScan" gorm:"default:false"`     // 部署任务是否对 plan 结果执行合规检测
+
+	Criticality string `json:"criticality" gorm:"size:16;default:'dev'" enums:"prod,staging,dev"` // 环境重要程度，影响扫描任务调度优先级及合规检测默认配置
 
+	// 合规声明相关
+	AttestationInterval int   `json:"attestationInterval" gorm:"default:0"`  // 合规声明周期(天)，0 表示不需要定期声明
+	AttestationBlock    bool  `json:"attestationBlock" gorm:"default:false"` // 合规声明逾期后是否禁止部署
+	AttestationDueAt    *Time `json:"attestationDueAt" gorm:"type:datetime"` // 下次合规声明的截止时间
+
+	// 自动回滚相关
+	AutoRollback        bool `json:"autoRollback" gorm:"default:false"`        // apply 失败后是否自动回滚到最后一次成功部署的配置
+	RollbackAutoApprove bool `json:"rollbackAutoApprove" gorm:"default:false"` // 自动回滚任务是否自动审批
+
+	// 允许部署的时间窗口，窗口外提交的 apply/destroy 任务排队到下一个窗口开始时执行
+	DeployWindows *EnvDeployWindows `json:"deployWindows" gorm:"type:json"`
+
+	// 按步骤类型设置的超时时间，覆盖云模板中相同步骤的设置，未设置的步骤使用 timeout
+	StepTimeouts StepTimeouts `json:"stepTimeouts" gorm:"type:json" swaggertype:"object,integer" example:"apply:7200"`
+
+	// 执行环境任务的 runner 需要包含的全部标签，创建任务时没有满足要求的 runner 会返回错误
+	RunnerTags StrSlice `json:"runnerTags" gorm:"type:text" example:"region=cn-hangzhou"`
+
+	// 环境锁定相关，锁定期间只有锁定人可以发起 apply/destroy 任务
+	Locked     bool   `json:"locked" gorm:"default:false"`
+	LockedBy   Id     `json:"lockedBy" gorm:"size:32;default:''"` // 锁定人
+	LockedAt   *Time  `json:"lockedAt" gorm:"type:datetime"`      // 锁定时间
+	LockReason string `json:"lockReason" gorm:"type:text"`        // 锁定原因
+
+	// 定时任务暂停相关，维护期间暂停环境的自动销毁、偏移检测及 commit 自动部署
+	AutoDestroySuspended bool   `json:"autoDestroySuspended" gorm:"default:false"`
+	DriftSuspended       bool   `json:"driftSuspended" gorm:"default:false"`
+	AutoDeploySuspended  bool   `json:"autoDeploySuspended" gorm:"default:false"`
+	SuspendedBy          Id     `json:"suspendedBy" gorm:"size:32;default:''"` // 暂停人
+	SuspendedAt          *Time  `json:"suspendedAt" gorm:"type:datetime"`      // 暂停时间
+	SuspendUntil         *Time  `json:"suspendUntil" gorm:"type:datetime"`     // 到期后自动恢复，为空表示需要手动恢复
+	SuspendReason        string `json:"suspendReason" gorm:"type:text"`        // 暂停原因
+
+	// 费用相关
+	MonthlyBudget float64 `json:"monthlyBudget" gorm:"type:decimal(20,6);default:0"` // 月度预算，部署后的估算费用超出预算时部署需要组织管理员审批，0 表示不限制
+	MonthlyCost   float64 `json:"monthlyCost" gorm:"type:decimal(20,6);default:0"`   // 最后一次部署成功后估算的月度费用
+
+	// 保护规则，创建任务时检查，不满足规则的任务不允许创建
+	Protection *EnvProtection `json:"protection" gorm:"type:json"`
 }
 
 func (Env) TableName() string {
@@ -115,6 +188,11 @@ func (e *Env) DefaultStatPath() string {
 	return path.Join(e.OrgId.String(), e.ProjectId.String(), e.Id.String(), "terraform.tfstate")
 }
 
+// IsAttestationOverdue 环境的合规声明是否已逾期
+func (e *Env) IsAttestationOverdue() bool {
+	return e.AttestationInterval > 0 && e.AttestationDueAt != nil && time.Time(*e.AttestationDueAt).Before(time.Now())
+}
+
 func (e *Env) MergeTaskStatus() string {
 	if e.Deploying {
 		e.Status = e.TaskStatus
@@ -137,6 +215,12 @@ type EnvDetail struct {
 	PolicyEnable  bool   `json:"policyEnable"` // 是否开启合规检测
 	PolicyStatus  string `json:"policyStatus"` // 环境合规检测任务状态
 
+	AttestationOverdue bool `json:"attestationOverdue" gorm:"-"` // 合规声明是否已逾期
+
+	TplChangeWarnings []string `json:"tplChangeWarnings" gorm:"-"` // 云模板代码来源变化后环境变量不再有效的原因
+
+	TplDeprecationWarning string `json:"tplDeprecationWarning" gorm:"-"` // 云模板已废弃时提示迁移到替代云模板
+
 	// PolicyGroup 必须配置 struct tag `gorm:"-"`。
 	// 因为我们定义了 model struct PolicyGroup，
 	// gorm 解析该结构体的 PolicyGroup 字段时会将其理解为 PolicyGroup model 的关联字段，
@@ -156,3 +240,49 @@ func (c *EnvDetail) UpdateEnvPolicyStatus() {
 		c.PolicyStatus = common.PolicyStatusDisable
 	}
 }
+
+// EnvDeployWindow 一个允许部署的时间段，如工作日 09:00 至 18:00
+type EnvDeployWindow struct {
+	Weekdays  []int  `json:"weekdays" example:"1,2,3,4,5"` // 生效的星期，0 表示星期日，为空表示每天
+	StartTime string `json:"startTime" example:"09:00"`    // 开始时间(HH:MM)
+	EndTime   string `json:"endTime" example:"18:00"`      // 结束时间(HH:MM)，小于开始时间表示跨天
+}
+
+// EnvDeployWindows 环境允许部署的时间窗口，满足任一窗口即可部署
+type EnvDeployWindows struct {
+	Timezone string            `json:"timezone" example:"Asia/Shanghai"` // 窗口使用的时区，默认为服务器时区
+	Windows  []EnvDeployWindow `json:"windows"`
+}
+
+// IsEmpty 是否未限制部署时间
+func (v *EnvDeployWindows) IsEmpty() bool {
+	return v == nil || len(v.Windows) == 0
+}
+
+func (v EnvDeployWindows) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *EnvDeployWindows) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// EnvProtection 环境保护规则，类似代码仓库的保护分支
+type EnvProtection struct {
+	DisallowDestroy bool     `json:"disallowDestroy"`                          // 禁止销毁环境
+	RequireTicket   bool     `json:"requireTicket"`                            // 手动发起的部署任务需要填写变更工单号
+	AllowedBranches []string `json:"allowedBranches" example:"main,release/*"` // 只允许部署的分支/标签，支持通配符，为空表示不限制
+}
+
+// IsEmpty 是否未设置任何保护规则
+func (v *EnvProtection) IsEmpty() bool {
+	return v == nil || (!v.DisallowDestroy && !v.RequireTicket && len(v.AllowedBranches) == 0)
+}
+
+func (v EnvProtection) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *EnvProtection) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+// EnvAttestation 环境合规声明记录，环境负责人定期确认环境的合规状态，记录只增不改，供审计使用
+type EnvAttestation struct {
+	TimedModel
+
+	OrgId      Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId  Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId      Id `json:"envId" gorm:"size:32;not null;index"`
+	AttestorId Id `json:"attestorId" gorm:"size:32;not null;comment:声明人"`
+
+	Comment string `json:"comment" gorm:"type:text;comment:声明说明"` // 声明说明
+
+	// 声明时环境的合规状态快照
+	ScanTaskId      Id     `json:"scanTaskId" gorm:"size:32;comment:声明时环境最后一次扫描任务"`  // 声明时环境最后一次扫描任务 id
+	PolicyStatus    string `json:"policyStatus" gorm:"size:16;comment:声明时环境的合规状态"`   // 声明时环境的合规状态
+	ComplianceScore *int   `json:"complianceScore" gorm:"comment:声明时环境的合规评分"`        // 声明时环境的合规评分
+	Passed          int    `json:"passed" gorm:"default:0"`                          // 通过的策略数
+	Violated        int    `json:"violated" gorm:"default:0"`                        // 不通过的策略数
+	Failed          int    `json:"failed" gorm:"default:0"`                          // 检测失败的策略数
+	Suppressed      int    `json:"suppressed" gorm:"default:0"`                      // 屏蔽的策略数
+	DueAt           *Time  `json:"dueAt" gorm:"type:datetime;comment:本次声明的截止时间"`     // 本次声明的截止时间，环境未配置声明周期时为空
+	Overdue         bool   `json:"overdue" gorm:"default:false;comment:是否逾期声明"`      // 是否在截止时间之后才声明
+	NextDueAt       *Time  `json:"nextDueAt" gorm:"type:datetime;comment:下次声明的截止时间"` // 下次声明的截止时间
+}
+
+func (EnvAttestation) TableName() string {
+	return "iac_env_attestation"
+}
+
+func (a *EnvAttestation) CustomBeforeCreate(*db.Session) error {
+	if a.Id == "" {
+		a.Id = NewId("att")
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// EnvDestroyReminder 环境自动销毁提醒的发送记录，同一销毁时间的每个提醒只发送一次，
+// 销毁时间被修改(如延长存活时间)后会重新发送提醒
+type EnvDestroyReminder struct {
+	AutoUintIdModel
+
+	OrgId        Id   `json:"orgId" gorm:"size:32;not null"`
+	ProjectId    Id   `json:"projectId" gorm:"size:32;not null"`
+	EnvId        Id   `json:"envId" gorm:"size:32;not null"`
+	DestroyAt    Time `json:"destroyAt" gorm:"type:datetime;not null"` // 提醒时环境的自动销毁时间
+	RemindBefore int  `json:"remindBefore" gorm:"not null;default:0"`  // 提前提醒的时间(分钟)
+	RemindedAt   Time `json:"remindedAt" gorm:"type:datetime"`
+}
+
+func (EnvDestroyReminder) TableName() string {
+	return "iac_env_destroy_reminder"
+}
+
+func (r EnvDestroyReminder) Migrate(sess *db.Session) (err error) {
+	return r.AddUniqueIndex(sess, "unique__env__destroy__remind", "env_id", "destroy_at", "remind_before")
+}
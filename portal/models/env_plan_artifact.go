@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+// EnvPlanArtifact plan 任务生成的 plan 产物，二进制 plan 文件及 plan json 保存在日志存储中。
+// 产物可以被下载，也可以通过"执行已保存 plan"的部署任务执行，每个产物只能执行一次
+type EnvPlanArtifact struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;index"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null"` // 生成该产物的 plan 任务
+	CreatorId Id `json:"creatorId" gorm:"size:32"`
+
+	Revision string `json:"revision" gorm:"default:''"`
+	CommitId string `json:"commitId" gorm:"default:''"` // plan 时使用的代码 commit id
+
+	// plan 时环境最后一次变更资源的任务，执行 plan 前环境资源被变更过的话 plan 已失效
+	BaseResTaskId Id `json:"baseResTaskId" gorm:"size:32;default:''"`
+
+	ResAdded     int `json:"resAdded" gorm:"default:0"`
+	ResChanged   int `json:"resChanged" gorm:"default:0"`
+	ResDestroyed int `json:"resDestroyed" gorm:"default:0"`
+
+	Size     int    `json:"size" gorm:"default:0"`            // 二进制 plan 文件大小
+	Sha256   string `json:"sha256" gorm:"size:64;default:''"` // 二进制 plan 文件的摘要
+	PlanPath string `json:"-" gorm:"not null"`                // 二进制 plan 文件在日志存储中的路径
+	JsonPath string `json:"-" gorm:"not null"`                // plan json 在日志存储中的路径
+
+	AppliedTaskId Id    `json:"appliedTaskId" gorm:"size:32;default:''"` // 执行该 plan 的部署任务
+	AppliedAt     *Time `json:"appliedAt" gorm:"type:datetime"`
+}
+
+func (EnvPlanArtifact) TableName() string {
+	return "iac_env_plan_artifact"
+}
+
+func (a *EnvPlanArtifact) CustomBeforeCreate(*db.Session) error {
+	if a.Id == "" {
+		a.Id = NewId("pla")
+	}
+	return nil
+}
+
+func (a EnvPlanArtifact) Migrate(sess *db.Session) (err error) {
+	return a.AddUniqueIndex(sess, "unique__plan_artifact__task", "task_id")
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+// PromotionChain 环境晋级链，将同一云模板的多个环境按顺序作为部署阶段(如 dev→staging→prod)，
+// 前一阶段部署成功的 commit 可以晋级部署到下一阶段
+type PromotionChain struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null;index"`
+	TplId     Id     `json:"tplId" gorm:"size:32;not null"`
+	CreatorId Id     `json:"creatorId" gorm:"size:32;not null"`
+	Name      string `json:"name" gorm:"size:64;not null"`
+
+	Stages StrSlice `json:"stages" gorm:"type:json" swaggertype:"array,string" example:"env-dev,env-staging,env-prod"` // 按晋级顺序排列的环境 id
+}
+
+func (PromotionChain) TableName() string {
+	return "iac_promotion_chain"
+}
+
+func (PromotionChain) NewId() Id {
+	return NewId("pc")
+}
+
+// StageIndex 返回环境在晋级链中的阶段序号，环境不在晋级链中时返回 -1
+func (c *PromotionChain) StageIndex(envId Id) int {
+	for i, id := range c.Stages {
+		if Id(id) == envId {
+			return i
+		}
+	}
+	return -1
+}
+
+// EnvPromotion 环境晋级记录，记录只增不改，供审计使用
+type EnvPromotion struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	ChainId   Id `json:"chainId" gorm:"size:32;not null;index"`
+	CreatorId Id `json:"creatorId" gorm:"size:32;not null"`
+
+	FromEnvId  Id `json:"fromEnvId" gorm:"size:32;not null"`  // 晋级来源阶段的环境
+	FromTaskId Id `json:"fromTaskId" gorm:"size:32;not null"` // 来源环境部署成功的任务
+	ToEnvId    Id `json:"toEnvId" gorm:"size:32;not null"`    // 晋级目标阶段的环境
+	TaskId     Id `json:"taskId" gorm:"size:32;not null"`     // 目标环境的部署任务
+
+	Revision     string   `json:"revision" gorm:"default:''"`
+	CommitId     string   `json:"commitId" gorm:"size:64;not null"`
+	OverrideVars StrSlice `json:"overrideVars" gorm:"type:json" swaggertype:"array,string"` // 晋级时覆盖的变量名称
+}
+
+func (EnvPromotion) TableName() string {
+	return "iac_env_promotion"
+}
+
+func (EnvPromotion) NewId() Id {
+	return NewId("ep")
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"path"
+)
+
+const (
+	StateVersionTask    = "task"    // 部署或销毁任务结束后保存的 state
+	StateVersionBackup  = "backup"  // 恢复历史版本前备份的当前 state
+	StateVersionRestore = "restore" // 恢复历史版本后的 state
+)
+
+// EnvStateVersion 环境 terraform state 的历史版本，state 内容保存在日志存储中。
+// 多工作目录云模板的每个工作目录使用独立的 state，分别记录版本
+type EnvStateVersion struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null;index"`
+	TaskId    Id `json:"taskId" gorm:"size:32"` // 产生该版本的任务，恢复操作产生的版本为空
+
+	Version   int    `json:"version" gorm:"not null;comment:版本号" example:"1"` // 环境内从 1 开始递增的版本号
+	Workdir   string `json:"workdir" gorm:"default:''"`                       // 多工作目录云模板的工作目录，为空表示环境的 state
+	StatePath string `json:"-" gorm:"not null"`                               // state 在 backend 中的路径
+
+	Serial        int64  `json:"serial" gorm:"default:0"`   // state 的 serial
+	Lineage       string `json:"lineage" gorm:"default:''"` // state 的 lineage
+	ResourceCount int    `json:"resourceCount" gorm:"default:0"`
+	Sha256        string `json:"sha256" gorm:"size:64;default:''"` // state 内容的摘要，内容未变化时不生成新版本
+
+	Source             string `json:"source" gorm:"type:enum('task','backup','restore');not null" enums:"task,backup,restore"`
+	RestoreFromId      Id     `json:"restoreFromId" gorm:"size:32"`        // 恢复操作使用的历史版本 id
+	RestoreFromVersion int    `json:"restoreFromVersion" gorm:"default:0"` // 恢复操作使用的历史版本号
+	CreatorId          Id     `json:"creatorId" gorm:"size:32"`            // 恢复操作人，任务产生的版本为任务创建人
+	RestoreReason      string `json:"restoreReason" gorm:"type:text"`      // 恢复原因
+}
+
+func (EnvStateVersion) TableName() string {
+	return "iac_env_state_version"
+}
+
+func (v *EnvStateVersion) CustomBeforeCreate(*db.Session) error {
+	if v.Id == "" {
+		v.Id = NewId("stv")
+	}
+	return nil
+}
+
+func (v EnvStateVersion) Migrate(sess *db.Session) (err error) {
+	return v.AddUniqueIndex(sess, "unique__env__state_version", "env_id", "version")
+}
+
+// ContentPath state 内容在日志存储中的路径
+func (v *EnvStateVersion) ContentPath() string {
+	return path.Join(v.ProjectId.String(), v.EnvId.String(), "state_versions", v.Id.String()+".tfstate")
+}
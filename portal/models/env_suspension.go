@@ -0,0 +1,42 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+// 可以暂停的环境定时任务
+const (
+	EnvJobAutoDestroy = "autoDestroy" // 自动销毁
+	EnvJobDrift       = "drift"       // 偏移检测
+	EnvJobAutoDeploy  = "autoDeploy"  // commit 触发的自动部署
+)
+
+var EnvScheduledJobs = []string{EnvJobAutoDestroy, EnvJobDrift, EnvJobAutoDeploy}
+
+// EnvSuspension 环境定时任务的暂停记录，环境所有定时任务恢复后记录恢复人及恢复时间
+type EnvSuspension struct {
+	TimedModel
+
+	OrgId       Id       `json:"orgId" gorm:"size:32;not null"`
+	ProjectId   Id       `json:"projectId" gorm:"size:32;not null"`
+	EnvId       Id       `json:"envId" gorm:"size:32;not null;index"`
+	Jobs        StrSlice `json:"jobs" gorm:"type:json" swaggertype:"array,string"` // 暂停的定时任务
+	Reason      string   `json:"reason" gorm:"type:text"`
+	SuspendedBy Id       `json:"suspendedBy" gorm:"size:32;not null"`
+	Until       *Time    `json:"until" gorm:"type:datetime"`          // 自动恢复时间
+	ResumedBy   Id       `json:"resumedBy" gorm:"size:32;default:''"` // 恢复人，到期自动恢复时为系统用户
+	ResumedAt   *Time    `json:"resumedAt" gorm:"type:datetime"`
+}
+
+func (EnvSuspension) TableName() string {
+	return "iac_env_suspension"
+}
+
+func (s *EnvSuspension) CustomBeforeCreate(*db.Session) error {
+	if s.Id == "" {
+		s.Id = NewId("sus")
+	}
+	return nil
+}
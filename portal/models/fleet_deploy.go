@@ -0,0 +1,118 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+const (
+	FleetDeployRunning  = "running"
+	FleetDeployComplete = "complete" // 所有环境部署成功
+	FleetDeployFailed   = "failed"   // 有环境部署失败
+	FleetDeployStopped  = "stopped"  // 手动停止
+)
+
+const (
+	FleetFailurePolicyStop     = "stop"     // 有环境部署失败后不再启动其他环境的部署
+	FleetFailurePolicyContinue = "continue" // 有环境部署失败时继续部署其他环境
+)
+
+const (
+	FleetItemPending  = "pending"
+	FleetItemRunning  = "running"
+	FleetItemComplete = "complete"
+	FleetItemFailed   = "failed"
+	FleetItemSkipped  = "skipped" // 批量部署停止后未启动的环境
+)
+
+// FleetDeploySelector 批量部署的环境筛选条件，多个条件需要同时满足
+type FleetDeploySelector struct {
+	TplIds        []Id     `json:"tplIds"`                                      // 使用指定云模板的环境
+	Labels        string   `json:"labels" example:"team=payments,tier=backend"` // 云模板标签筛选条件，格式同云模板列表的标签筛选
+	ProjectIds    []Id     `json:"projectIds"`                                  // 指定项目下的环境
+	EnvIds        []Id     `json:"envIds"`                                      // 指定的环境
+	Criticalities []string `json:"criticalities" enums:"prod,staging,dev"`      // 环境重要程度
+}
+
+func (v FleetDeploySelector) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *FleetDeploySelector) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// FleetDeployProgress 批量部署各状态的环境数量
+type FleetDeployProgress struct {
+	Total    int `json:"total"`
+	Pending  int `json:"pending"`
+	Running  int `json:"running"`
+	Complete int `json:"complete"`
+	Failed   int `json:"failed"`
+	Skipped  int `json:"skipped"`
+}
+
+// FleetDeploy 批量部署，按并发数限制依次为筛选出的环境创建部署任务
+type FleetDeploy struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null;index"`
+	CreatorId Id     `json:"creatorId" gorm:"size:32;not null"`
+	Name      string `json:"name" gorm:"size:64;not null"`
+
+	TaskType      string              `json:"taskType" gorm:"size:16;not null" enums:"plan,apply"`
+	Selector      FleetDeploySelector `json:"selector" gorm:"type:json"`
+	Concurrency   int                 `json:"concurrency" gorm:"not null;default:1"`                                      // 同时部署的环境数量
+	FailurePolicy string              `json:"failurePolicy" gorm:"size:16;not null;default:'stop'" enums:"stop,continue"` // 有环境部署失败时的处理方式
+
+	Status    string `json:"status" gorm:"size:16;not null" enums:"running,complete,failed,stopped"`
+	Message   string `json:"message" gorm:"type:text"`
+	StoppedBy Id     `json:"stoppedBy" gorm:"size:32;default:''"` // 手动停止的用户 id
+	EndAt     *Time  `json:"endAt" gorm:"type:datetime"`
+
+	Progress *FleetDeployProgress `json:"progress" gorm:"-"`
+}
+
+func (FleetDeploy) TableName() string {
+	return "iac_fleet_deploy"
+}
+
+func (FleetDeploy) NewId() Id {
+	return NewId("fd")
+}
+
+func (f *FleetDeploy) IsFinished() bool {
+	return f.Status != FleetDeployRunning
+}
+
+// FleetDeployItem 批量部署中单个环境的部署记录
+type FleetDeployItem struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null"`
+	FleetId   Id     `json:"fleetId" gorm:"size:32;not null;index"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"size:32;not null"`
+	EnvName   string `json:"envName" gorm:"not null"`
+	Seq       int    `json:"seq" gorm:"not null"` // 部署顺序
+
+	TaskId  Id     `json:"taskId" gorm:"size:32;default:''"`
+	Status  string `json:"status" gorm:"size:16;not null" enums:"pending,running,complete,failed,skipped"`
+	Message string `json:"message" gorm:"type:text"` // 部署失败的原因
+	StartAt *Time  `json:"startAt" gorm:"type:datetime"`
+	EndAt   *Time  `json:"endAt" gorm:"type:datetime"`
+}
+
+func (FleetDeployItem) TableName() string {
+	return "iac_fleet_deploy_item"
+}
+
+func (FleetDeployItem) NewId() Id {
+	return NewId("fdi")
+}
+
+func (i FleetDeployItem) Migrate(sess *db.Session) (err error) {
+	return i.AddUniqueIndex(sess, "unique__fleet__env", "fleet_id", "env_id")
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type BillingConnectorOptions struct {
+	Region string `json:"region" example:"cn-beijing"`
+	Bucket string `json:"bucket" example:"my-cur-bucket"`          // AWS CUR 报告所在 s3 bucket
+	Key    string `json:"key" example:"cur/report-{cycle}.csv.gz"` // AWS CUR 报告对象路径, {cycle} 会被替换为账期
+}
+
+type CreateBillingConnectorForm struct {
+	BaseForm
+
+	Name              string                  `json:"name" form:"name" binding:"required,gte=2,lte=64"`
+	Provider          string                  `json:"provider" form:"provider" binding:"required" enums:"alicloud_bss,aws_cur"`
+	ResourceAccountId models.Id               `json:"resourceAccountId" form:"resourceAccountId" binding:"required"` // 提供访问凭证的资源账号
+	Options           BillingConnectorOptions `json:"options" form:"options"`
+	SyncInterval      int                     `json:"syncInterval" form:"syncInterval" example:"24"` // 同步间隔(小时)，默认 24
+}
+
+type UpdateBillingConnectorForm struct {
+	BaseForm
+
+	Id                models.Id                `uri:"id" json:"id" swaggerignore:"true"`
+	Name              string                   `json:"name" form:"name"`
+	ResourceAccountId models.Id                `json:"resourceAccountId" form:"resourceAccountId"`
+	Options           *BillingConnectorOptions `json:"options" form:"options"`
+	Enabled           bool                     `json:"enabled" form:"enabled"`
+	SyncInterval      int                      `json:"syncInterval" form:"syncInterval"`
+}
+
+type SearchBillingConnectorForm struct {
+	NoPageSizeForm
+
+	Q string `form:"q" json:"q" binding:""` // 名称模糊搜索
+}
+
+type DeleteBillingConnectorForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type DetailBillingConnectorForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type SyncBillingConnectorForm struct {
+	BaseForm
+
+	Id           models.Id `uri:"id" json:"id" swaggerignore:"true"`
+	BillingCycle string    `json:"billingCycle" form:"billingCycle" example:"2022-03"` // 账期，默认为当月
+}
+
+type BillingReportForm struct {
+	BaseForm
+
+	BillingCycle string `json:"billingCycle" form:"billingCycle" example:"2022-03"` // 账期，默认为当月
+}
+
+type SearchUnmanagedBillingForm struct {
+	PageForm
+
+	BillingCycle string `json:"billingCycle" form:"billingCycle" example:"2022-03"` // 账期，默认为当月
+}
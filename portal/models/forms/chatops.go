@@ -0,0 +1,25 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchChatIdentityForm struct {
+	PageForm
+
+	Platform string `form:"platform" json:"platform" binding:"omitempty,oneof=slack dingtalk" enums:"slack,dingtalk"`
+}
+
+type CreateChatIdentityForm struct {
+	BaseForm
+
+	Platform   string    `json:"platform" form:"platform" binding:"required,oneof=slack dingtalk" enums:"slack,dingtalk"` // 聊天平台
+	ChatUserId string    `json:"chatUserId" form:"chatUserId" binding:"required,max=64" example:"U01ABCDEF"`              // 聊天平台的用户 id(Slack user_id，钉钉 staffId)
+	UserId     models.Id `json:"userId" form:"userId" binding:"required"`                                                 // 绑定的组织用户
+}
+
+type DeleteChatIdentityForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type CreateCostPriceForm struct {
+	BaseForm
+
+	ResourceType string  `json:"resourceType" form:"resourceType" binding:"required" example:"aws_instance"`
+	MatchAttr    string  `json:"matchAttr" form:"matchAttr" example:"instance_type"` // 匹配的资源属性，为空表示该资源类型的默认价格
+	MatchValue   string  `json:"matchValue" form:"matchValue" example:"t3.micro"`    // 匹配的属性值
+	MonthlyPrice float64 `json:"monthlyPrice" form:"monthlyPrice" binding:"min=0"`   // 月度费用
+	Description  string  `json:"description" form:"description"`
+}
+
+type UpdateCostPriceForm struct {
+	BaseForm
+
+	Id           models.Id `uri:"id" json:"id" swaggerignore:"true"`
+	MatchAttr    string    `json:"matchAttr" form:"matchAttr"`
+	MatchValue   string    `json:"matchValue" form:"matchValue"`
+	MonthlyPrice float64   `json:"monthlyPrice" form:"monthlyPrice" binding:"min=0"`
+	Description  string    `json:"description" form:"description"`
+}
+
+type SearchCostPriceForm struct {
+	NoPageSizeForm
+
+	Q            string `form:"q" json:"q" binding:""`                       // 资源类型模糊搜索
+	ResourceType string `form:"resourceType" json:"resourceType" binding:""` // 资源类型
+}
+
+type DetailCostPriceForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type DeleteCostPriceForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type CostDashboardForm struct {
+	BaseForm
+
+	ProjectId models.Id `json:"projectId" form:"projectId"` // 只统计指定项目，默认使用请求头中的项目，都为空时统计整个组织
+}
+
+type SearchTaskCostEstimateForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID
+}
@@ -4,6 +4,9 @@ package forms
 
 import (
 	"cloudiac/portal/models"
+	"encoding/json"
+	"mime/multipart"
+	"time"
 )
 
 type envTtlForm struct {
@@ -27,6 +30,11 @@ type CreateEnvForm struct {
 	RunnerId        string `form:"runnerId" json:"runnerId" binding:""`                             // 环境默认部署通道
 	Revision        string `form:"revision" json:"revision" binding:""`                             // 分支/标签
 	Timeout         int    `form:"timeout" json:"timeout" binding:""`                               // 部署超时时间（单位：秒）
+	TicketId        string `form:"ticketId" json:"ticketId" binding:"max=64"`                       // 变更工单号，环境保护规则要求时必填
+
+	RunnerTags []string `form:"runnerTags" json:"runnerTags" binding:""` // 执行任务的 runner 需要包含的全部标签，例如 ["region=cn-hangzhou"]
+
+	Criticality string `form:"criticality" json:"criticality" binding:"omitempty,oneof=prod staging dev" enums:"prod,staging,dev"` // 环境重要程度，prod 环境默认开启合规检测及合规不通过中止任务
 
 	Variables []Variable `form:"variables" json:"variables" binding:""` // 自定义变量列表，该变量列表会覆盖现有的变量
 
@@ -51,8 +59,22 @@ type CreateEnvForm struct {
 	AutoRepairDrift  bool   `json:"autoRepairDrift" form:"autoRepairDrift"`   // 是否进行自动纠偏
 	OpenCronDrift    bool   `json:"openCronDrift" form:"openCronDrift"`       // 是否开启偏移检测
 
+	DriftMode string `json:"driftMode" form:"driftMode" binding:"omitempty,oneof=detect-only remediate" enums:"detect-only,remediate"` // 偏移处理模式，remediate 表示偏移检测发现偏移后自动创建纠偏部署任务
+
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable"` // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup"`   // 绑定策略组集合
+	PlanScan     bool        `json:"planScan" form:"planScan"`         // 部署任务是否对 plan 结果执行合规检测
+
+	AutoRollback        bool `json:"autoRollback" form:"autoRollback"`               // apply 失败后是否自动回滚到最后一次成功部署的配置
+	RollbackAutoApprove bool `json:"rollbackAutoApprove" form:"rollbackAutoApprove"` // 自动回滚任务是否自动审批
+
+	DeployWindows *models.EnvDeployWindows `json:"deployWindows" form:"deployWindows"` // 允许部署的时间窗口，窗口外提交的 apply/destroy 任务排队等待执行
+
+	Protection *models.EnvProtection `json:"protection" form:"protection"` // 环境保护规则，设置后修改需要项目管理员权限
+
+	StepTimeouts models.StepTimeouts `json:"stepTimeouts" form:"stepTimeouts" swaggertype:"object,integer" example:"apply:7200"` // 按步骤类型(init/plan/apply/play)设置的超时时间(秒)，覆盖云模板的设置
+
+	MonthlyBudget float64 `json:"monthlyBudget" form:"monthlyBudget" binding:"min=0"` // 月度费用预算，部署任务估算费用超出预算时需要组织管理员审批，0 表示不限制
 
 	Source string `json:"source" form:"source" ` // 调用来源
 }
@@ -81,9 +103,13 @@ type UpdateEnvForm struct {
 	RunnerId    string    `form:"runnerId" json:"runnerId" binding:""`              // 环境默认部署通道
 	Archived    bool      `form:"archived" json:"archived" enums:"true,false"`      // 归档状态，默认返回未归档环境
 
+	RunnerTags []string `form:"runnerTags" json:"runnerTags" binding:""` // 执行任务的 runner 需要包含的全部标签，例如 ["region=cn-hangzhou"]
+
 	AutoApproval    bool `form:"autoApproval" json:"autoApproval"  binding:"" enums:"true,false"` // 是否自动审批
 	StopOnViolation bool `form:"stopOnViolation" json:"stopOnViolation" enums:"true,false"`       // 合规不通过是否中止任务
 
+	Criticality string `form:"criticality" json:"criticality" binding:"omitempty,oneof=prod staging dev" enums:"prod,staging,dev"` // 环境重要程度
+
 	Triggers         []string `form:"triggers" json:"triggers" binding:""`       // 启用触发器，触发器：commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 	RetryNumber      int      `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay       int      `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
@@ -92,8 +118,25 @@ type UpdateEnvForm struct {
 	AutoRepairDrift  bool     `json:"autoRepairDrift" form:"autoRepairDrift"`    // 是否进行自动纠偏
 	OpenCronDrift    bool     `json:"openCronDrift" form:"openCronDrift"`        // 是否开启偏移检测
 
+	DriftMode string `json:"driftMode" form:"driftMode" binding:"omitempty,oneof=detect-only remediate" enums:"detect-only,remediate"` // 偏移处理模式，remediate 表示偏移检测发现偏移后自动创建纠偏部署任务
+
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable"` // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup"`   // 绑定策略组集合
+	PlanScan     bool        `json:"planScan" form:"planScan"`         // 部署任务是否对 plan 结果执行合规检测
+
+	AutoRollback        bool `json:"autoRollback" form:"autoRollback"`               // apply 失败后是否自动回滚到最后一次成功部署的配置
+	RollbackAutoApprove bool `json:"rollbackAutoApprove" form:"rollbackAutoApprove"` // 自动回滚任务是否自动审批
+
+	DeployWindows *models.EnvDeployWindows `json:"deployWindows" form:"deployWindows"` // 允许部署的时间窗口，窗口外提交的 apply/destroy 任务排队等待执行
+
+	Protection *models.EnvProtection `json:"protection" form:"protection"` // 环境保护规则，设置后修改需要项目管理员权限
+
+	StepTimeouts models.StepTimeouts `json:"stepTimeouts" form:"stepTimeouts" swaggertype:"object,integer" example:"apply:7200"` // 按步骤类型(init/plan/apply/play)设置的超时时间(秒)，覆盖云模板的设置
+
+	MonthlyBudget float64 `json:"monthlyBudget" form:"monthlyBudget" binding:"min=0"` // 月度费用预算，部署任务估算费用超出预算时需要组织管理员审批，0 表示不限制
+
+	AttestationInterval int  `json:"attestationInterval" form:"attestationInterval" binding:"min=0,max=3650"` // 合规声明周期(天)，0 表示不需要定期声明
+	AttestationBlock    bool `json:"attestationBlock" form:"attestationBlock"`                                // 合规声明逾期后是否禁止部署
 }
 
 type DeployEnvForm struct {
@@ -112,6 +155,11 @@ type DeployEnvForm struct {
 	RunnerId string `form:"runnerId" json:"runnerId" binding:""`                                    // 环境默认部署通道
 	Revision string `form:"revision" json:"revision" binding:""`                                    // 分支/标签
 	Timeout  int    `form:"timeout" json:"timeout" binding:""`                                      // 部署超时时间（单位：秒）
+	TicketId string `form:"ticketId" json:"ticketId" binding:"max=64"`                              // 变更工单号，环境保护规则要求时必填
+
+	RunnerTags []string `form:"runnerTags" json:"runnerTags" binding:""` // 执行任务的 runner 需要包含的全部标签，例如 ["region=cn-hangzhou"]
+
+	StepTimeouts models.StepTimeouts `form:"stepTimeouts" json:"stepTimeouts" swaggertype:"object,integer" example:"apply:7200"` // 按步骤类型设置的超时时间(秒)，覆盖云模板的设置
 
 	RetryNumber int  `form:"retryNumber" json:"retryNumber" binding:""` // 重试总次数
 	RetryDelay  int  `form:"retryDelay" json:"retryDelay" binding:""`   // 重试时间间隔
@@ -131,8 +179,17 @@ type DeployEnvForm struct {
 	AutoRepairDrift  bool   `json:"autoRepairDrift" form:"autoRepairDrift"`   // 是否进行自动纠偏
 	OpenCronDrift    bool   `json:"openCronDrift" form:"openCronDrift"`       // 是否开启偏移检测
 
+	DriftMode string `json:"driftMode" form:"driftMode" binding:"omitempty,oneof=detect-only remediate" enums:"detect-only,remediate"` // 偏移处理模式，remediate 表示偏移检测发现偏移后自动创建纠偏部署任务
+
 	PolicyEnable bool        `json:"policyEnable" form:"policyEnable"` // 是否开启合规检测
 	PolicyGroup  []models.Id `json:"policyGroup" form:"policyGroup"`   // 绑定策略组集合
+	PlanScan     bool        `json:"planScan" form:"planScan"`         // 部署任务是否对 plan 结果执行合规检测
+
+	AutoRollback        bool `json:"autoRollback" form:"autoRollback"`               // apply 失败后是否自动回滚到最后一次成功部署的配置
+	RollbackAutoApprove bool `json:"rollbackAutoApprove" form:"rollbackAutoApprove"` // 自动回滚任务是否自动审批
+
+	FreezeOverrideForm
+	TaskScheduleForm
 }
 
 type ArchiveEnvForm struct {
@@ -178,8 +235,11 @@ type SearchEnvResourceForm struct {
 
 type DestroyEnvForm struct {
 	BaseForm
+	FreezeOverrideForm
+	TaskScheduleForm
 
-	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`  // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Targets string    `form:"targets" json:"targets" binding:""` // 只销毁指定的资源，多个资源地址用 , 进行分隔
 }
 
 type SearchEnvVariableForm struct {
@@ -188,6 +248,13 @@ type SearchEnvVariableForm struct {
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 }
 
+type EnvSnapshotForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`                                    // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	At time.Time `form:"at" json:"at" binding:"required" example:"2006-01-02T15:04:05Z07:00"` // 查询的时间点
+}
+
 type SearchEnvResourceGraphForm struct {
 	BaseForm
 
@@ -201,3 +268,171 @@ type ResourceGraphDetailForm struct {
 	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID，swagger 参数通过 param path 指定，这里忽略
 	ResourceId models.Id `uri:"resourceId" json:"resourceId" swaggerignore:"true"` // 部署成功后后资源ID
 }
+
+type CreateEnvAttestationForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`          // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Comment string    `form:"comment" json:"comment" binding:"max=2048"` // 声明说明
+}
+
+type SearchEnvAttestationForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type LockEnvForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Reason string    `form:"reason" json:"reason" binding:"required,max=2048"` // 锁定原因
+}
+
+type UnlockEnvForm struct {
+	BaseForm
+
+	Id    models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Force bool      `form:"force" json:"force"`               // 强制解锁其他用户锁定的环境，需要项目管理员权限
+}
+
+type SearchEnvStateVersionForm struct {
+	PageForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Workdir string    `form:"workdir" json:"workdir"`           // 按工作目录过滤，多工作目录云模板使用
+}
+
+type DiffEnvStateVersionForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" json:"id" swaggerignore:"true"`          // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	From int       `form:"from" json:"from" binding:"required,min=1"` // 比较的起始版本号
+	To   int       `form:"to" json:"to" binding:"required,min=1"`     // 比较的目标版本号
+}
+
+type RestoreEnvStateVersionForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Version int       `uri:"version" json:"version" swaggerignore:"true"`       // 恢复的版本号
+	Reason  string    `form:"reason" json:"reason" binding:"required,max=2048"` // 恢复原因
+}
+
+type ExportEnvStateForm struct {
+	BaseForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Workdir string    `form:"workdir" json:"workdir"`           // 多工作目录云模板的工作目录，为空时导出环境的 state
+}
+
+type ImportEnvStateForm struct {
+	BaseForm
+
+	Id   models.Id             `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Data json.RawMessage       `json:"data" swaggerignore:"true"`        // 待导入的 state 内容(JSON 格式，与 file 参数二选一)
+	File *multipart.FileHeader `form:"file" swaggerignore:"true"`        // 待导入的 state 文件(与 data 参数二选一)
+}
+
+type ImportEnvResourceForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                                             // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Address    string    `form:"address" json:"address" binding:"required,max=512" example:"aws_instance.web"` // 导入的资源地址
+	ResourceId string    `form:"resourceId" json:"resourceId" binding:"required,max=512" example:"i-abcd1234"` // 云资源 id，格式由 provider 决定
+}
+
+type SearchEnvPlanArtifactForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type DownloadEnvPlanArtifactForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`                                               // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	PlanId models.Id `uri:"planId" json:"planId" swaggerignore:"true"`                                       // plan 产物ID
+	Format string    `form:"format" json:"format" binding:"omitempty,oneof=json binary" enums:"json,binary"` // 下载格式，默认为 json
+}
+
+type ApplyEnvPlanArtifactForm struct {
+	BaseForm
+	FreezeOverrideForm
+
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true"`          // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	PlanId   models.Id `uri:"planId" json:"planId" swaggerignore:"true"`  // plan 产物ID
+	TicketId string    `form:"ticketId" json:"ticketId" binding:"max=64"` // 变更工单号，环境保护规则要求时必填
+}
+
+type SearchAutoDestroyEnvForm struct {
+	PageForm
+
+	Days int `form:"days" json:"days" binding:"omitempty,min=1,max=90"` // 查询未来多少天内将要自动销毁的环境，默认为 7 天
+}
+
+type ExtendEnvAutoDestroyForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`  // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Extend string    `form:"extend" json:"extend" example:"1d"` // 延长的时间，支持 1d/3d/1w 或 12h 等格式，默认为环境的 ttl
+}
+
+type SuspendEnvJobsForm struct {
+	BaseForm
+
+	Id     models.Id    `uri:"id" json:"id" swaggerignore:"true"`                      // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Jobs   []string     `form:"jobs" json:"jobs" enums:"autoDestroy,drift,autoDeploy"` // 暂停的定时任务，为空表示暂停所有定时任务
+	Reason string       `form:"reason" json:"reason" binding:"required,max=2048"`      // 暂停原因
+	Until  *models.Time `form:"until" json:"until"`                                    // 自动恢复时间，为空表示需要手动恢复
+}
+
+type ResumeEnvJobsForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" json:"id" swaggerignore:"true"`                      // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Jobs []string  `form:"jobs" json:"jobs" enums:"autoDestroy,drift,autoDeploy"` // 恢复的定时任务，为空表示恢复所有定时任务
+}
+
+type SearchEnvSuspensionForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchEnvDriftHistoryForm struct {
+	PageForm
+
+	Id      models.Id `uri:"id" json:"id" swaggerignore:"true"`                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Address string    `form:"address" json:"address"`                             // 资源地址
+	Days    int       `form:"days" json:"days" binding:"omitempty,min=1,max=365"` // 查询最近多少天的偏移记录，默认为 30 天
+}
+
+type EnvDriftTrendForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" json:"id" swaggerignore:"true"`                   // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Days int       `form:"days" json:"days" binding:"omitempty,min=1,max=365"` // 统计最近多少天，默认为 30 天
+}
+
+type EnvDriftStatsForm struct {
+	BaseForm
+
+	Days int `form:"days" json:"days" binding:"omitempty,min=1,max=365"` // 统计最近多少天，默认为 30 天
+}
+
+type EnvOutputsForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Reveal bool      `form:"reveal" json:"reveal"`             // 是否显示敏感 output 的值，需要环境的 outputreveal 权限
+}
+
+type EnvOutputHistoryForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`                     // 环境ID，swagger 参数通过 param path 指定，这里忽略
+	Name   string    `form:"name" json:"name"`                                     // output 名称，为空时返回所有 output 的变化
+	Limit  int       `form:"limit" json:"limit" binding:"omitempty,min=1,max=100"` // 查询最近多少次部署，默认为 20
+	Reveal bool      `form:"reveal" json:"reveal"`                                 // 是否显示敏感 output 的值，需要环境的 outputreveal 权限
+}
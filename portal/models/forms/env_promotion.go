@@ -0,0 +1,56 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type CreatePromotionChainForm struct {
+	BaseForm
+
+	Name   string      `json:"name" form:"name" binding:"required,gte=2,lte=64"`
+	Stages []models.Id `json:"stages" form:"stages" binding:"required"` // 按晋级顺序排列的环境 id，如 [dev, staging, prod]
+}
+
+type UpdatePromotionChainForm struct {
+	BaseForm
+
+	Id     models.Id   `uri:"id" json:"id" swaggerignore:"true"`
+	Name   string      `json:"name" form:"name" binding:"omitempty,gte=2,lte=64"`
+	Stages []models.Id `json:"stages" form:"stages"` // 按晋级顺序排列的环境 id
+}
+
+type SearchPromotionChainForm struct {
+	NoPageSizeForm
+
+	Q     string    `form:"q" json:"q" binding:""`         // 名称模糊搜索
+	EnvId models.Id `form:"envId" json:"envId" binding:""` // 查询包含指定环境的晋级链
+}
+
+type DetailPromotionChainForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type DeletePromotionChainForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type PromoteEnvForm struct {
+	BaseForm
+	FreezeOverrideForm
+
+	Id        models.Id  `uri:"id" json:"id" swaggerignore:"true"`
+	FromEnvId models.Id  `json:"fromEnvId" form:"fromEnvId" binding:"required"` // 晋级来源环境，晋级到晋级链中的下一阶段
+	TaskId    models.Id  `json:"taskId" form:"taskId"`                          // 来源环境部署成功的任务，默认为最后一次部署成功的任务
+	Variables []Variable `json:"variables" form:"variables"`                    // 只对本次部署生效的覆盖变量
+	TicketId  string     `json:"ticketId" form:"ticketId" binding:"max=64"`     // 变更工单号，目标环境保护规则要求时必填
+}
+
+type SearchEnvPromotionForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type CreateFleetDeployForm struct {
+	BaseForm
+
+	Name          string                     `json:"name" form:"name" binding:"required,gte=2,lte=64"`
+	TaskType      string                     `json:"taskType" form:"taskType" binding:"required" enums:"plan,apply"` // 各环境执行的任务类型
+	Selector      models.FleetDeploySelector `json:"selector" form:"selector"`                                       // 环境筛选条件，多个条件需要同时满足
+	Concurrency   int                        `json:"concurrency" form:"concurrency" example:"5"`                     // 同时部署的环境数量，默认为 1
+	FailurePolicy string                     `json:"failurePolicy" form:"failurePolicy" enums:"stop,continue"`       // 有环境部署失败时的处理方式，默认为 stop
+	DryRun        bool                       `json:"dryRun" form:"dryRun"`                                           // 只返回会被部署的环境，不创建批量部署
+}
+
+type SearchFleetDeployForm struct {
+	PageForm
+
+	Q      string `form:"q" json:"q" binding:""`                                                   // 名称模糊搜索
+	Status string `form:"status" json:"status" binding:"" enums:"running,complete,failed,stopped"` // 状态
+}
+
+type DetailFleetDeployForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type SearchFleetDeployItemForm struct {
+	PageForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`
+	Status string    `form:"status" json:"status" binding:"" enums:"pending,running,complete,failed,skipped"` // 环境部署状态
+}
+
+type StopFleetDeployForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
@@ -137,3 +137,20 @@ func (b *NoPageSizeForm) PageSize() int {
 	}
 	return b.PageForm.PageSize()
 }
+
+// CursorForm 游标分页表单，首页不传 cursor，之后每次传入上一页返回的 nextCursor
+type CursorForm struct {
+	BaseForm
+
+	Cursor string `form:"cursor" json:"cursor"` // 分页游标
+	Limit_ int    `form:"limit" json:"limit"`   // 每页数量，默认 15 条
+}
+
+func (b *CursorForm) Limit() int {
+	if b.Limit_ > consts.MaxPageSize {
+		return consts.MaxPageSize
+	} else if b.Limit_ <= 0 {
+		return consts.DefaultPageSize
+	}
+	return b.Limit_
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type CreateFreezeWindowForm struct {
+	BaseForm
+
+	Name          string       `json:"name" form:"name" binding:"required,gte=2,lte=64"`
+	Description   string       `json:"description" form:"description"`
+	ProjectId     models.Id    `json:"projectId" form:"projectId"` // 为空表示对组织下所有项目生效
+	Type          string       `json:"type" form:"type" binding:"required" enums:"cron,range"`
+	Cron          string       `json:"cron" form:"cron" example:"0 18 * * 5"`            // 冻结开始时间的 cron 表达式
+	Duration      int          `json:"duration" form:"duration" example:"3720"`          // 每次冻结的时长(分钟)
+	Timezone      string       `json:"timezone" form:"timezone" example:"Asia/Shanghai"` // cron 表达式使用的时区
+	StartAt       *models.Time `json:"startAt" form:"startAt"`
+	EndAt         *models.Time `json:"endAt" form:"endAt"`
+	TaskTypes     []string     `json:"taskTypes" form:"taskTypes" enums:"plan,apply,destroy"`       // 禁止执行的任务类型，默认为 apply 和 destroy
+	Criticalities []string     `json:"criticalities" form:"criticalities" enums:"prod,staging,dev"` // 生效的环境重要程度，为空表示所有环境
+}
+
+type UpdateFreezeWindowForm struct {
+	BaseForm
+
+	Id            models.Id    `uri:"id" json:"id" swaggerignore:"true"`
+	Name          string       `json:"name" form:"name" binding:"omitempty,gte=2,lte=64"`
+	Description   string       `json:"description" form:"description"`
+	Enabled       bool         `json:"enabled" form:"enabled"`
+	Type          string       `json:"type" form:"type" enums:"cron,range"`
+	Cron          string       `json:"cron" form:"cron"`
+	Duration      int          `json:"duration" form:"duration"`
+	Timezone      string       `json:"timezone" form:"timezone"`
+	StartAt       *models.Time `json:"startAt" form:"startAt"`
+	EndAt         *models.Time `json:"endAt" form:"endAt"`
+	TaskTypes     []string     `json:"taskTypes" form:"taskTypes"`
+	Criticalities []string     `json:"criticalities" form:"criticalities"`
+}
+
+type SearchFreezeWindowForm struct {
+	NoPageSizeForm
+
+	Q         string    `form:"q" json:"q" binding:""`                 // 名称模糊搜索
+	ProjectId models.Id `form:"projectId" json:"projectId" binding:""` // 查询对项目生效的冻结窗口(包含组织级别的窗口)
+}
+
+type DetailFreezeWindowForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type DeleteFreezeWindowForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type SearchFreezeOverrideForm struct {
+	PageForm
+
+	EnvId    models.Id `form:"envId" json:"envId" binding:""`
+	WindowId models.Id `form:"windowId" json:"windowId" binding:""`
+}
+
+// FreezeOverrideForm 冻结期间紧急放行参数，需要冻结窗口的 override 权限
+type FreezeOverrideForm struct {
+	FreezeOverride       bool   `json:"freezeOverride" form:"freezeOverride"`             // 冻结期间紧急放行
+	FreezeOverrideReason string `json:"freezeOverrideReason" form:"freezeOverrideReason"` // 紧急放行原因，放行时必填
+}
@@ -9,8 +9,9 @@ import (
 type CreateKeyForm struct {
 	BaseForm
 
-	Name string `json:"name" form:"name"` // 密钥名称
-	Key  string `json:"key" form:"key"`   // 密钥内容
+	Name     string `json:"name" form:"name"`         // 密钥名称
+	Key      string `json:"key" form:"key"`           // 密钥内容
+	Generate bool   `json:"generate" form:"generate"` // 由平台生成密钥对(不需要传 key)，创建后将返回的公钥添加到代码仓库的部署密钥
 }
 
 type SearchKeyForm struct {
@@ -72,3 +72,30 @@ type SearchOrgResourceForm struct {
 	Module string `form:"module" json:"module" binding:"" enums:"name,type"` // 查询模式，选在通过资源名称或者资源类型进行查询
 	Q      string `form:"q" json:"q" binding:""`                             // 资源名称，支持模糊查询
 }
+
+type ExportOrgDataForm struct {
+	BaseForm
+
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true"` // 组织ID，swagger 参数通过 param path 指定，这里忽略
+	Download bool      `json:"download" form:"download"`         // download 模式(直接返回导出数据，并触发浏览器下载)
+}
+
+type ScheduleOrgPurgeForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 组织ID，swagger 参数通过 param path 指定，这里忽略
+
+	ConfirmName string `form:"confirmName" json:"confirmName" binding:"required"` // 确认的组织名称，需要与组织名称一致
+}
+
+type CancelOrgPurgeForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 组织ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type OrgDestructionCertForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 组织ID，swagger 参数通过 param path 指定，这里忽略
+}
@@ -4,6 +4,7 @@ package forms
 
 import (
 	"cloudiac/portal/models"
+	"mime/multipart"
 	"time"
 )
 
@@ -66,6 +67,24 @@ type CreatePolicyGroupForm struct {
 	GitTags string    `json:"gitTags" example:"Git Tags"`
 	Branch  string    `json:"branch" example:"master"`
 	Dir     string    `json:"dir" example:"/"`
+
+	OpaVersion  string `json:"opaVersion" binding:"" example:"0.59.0"`            // 执行策略的 opa 版本，为空使用内置引擎
+	RegoVersion string `json:"regoVersion" binding:"" enums:"v0,v1" example:"v0"` // rego 语法版本
+}
+
+type UploadPolicyGroupForm struct {
+	BaseForm
+
+	Name        string   `form:"name" json:"name" binding:"required" example:"安全合规策略组"`
+	Description string   `form:"description" json:"description" binding:"" example:"本组包含对于安全合规的检查策略"`
+	Labels      []string `form:"labels" json:"labels" binding:"" example:"[security,alicloud]"`
+	Version     string   `form:"version" json:"version" binding:"" example:"1.0.0"` // 策略组版本，需为有效的语义化版本
+	Dir         string   `form:"dir" json:"dir" example:"/"`                        // 策略组在压缩包中的目录，默认为根目录
+
+	OpaVersion  string `form:"opaVersion" json:"opaVersion" binding:"" example:"0.59.0"`             // 执行策略的 opa 版本，为空使用内置引擎
+	RegoVersion string `form:"regoVersion" json:"regoVersion" binding:"" enums:"v0,v1" example:"v0"` // rego 语法版本
+
+	File *multipart.FileHeader `form:"file" binding:"required" swaggerignore:"true"` // 策略组 zip 压缩包
 }
 
 type SearchPolicyGroupForm struct {
@@ -89,6 +108,9 @@ type UpdatePolicyGroupForm struct {
 	GitTags string    `json:"gitTags" example:"Git Tags"`
 	Branch  string    `json:"branch" example:"master"`
 	Dir     string    `json:"dir" example:"/"`
+
+	OpaVersion  string `json:"opaVersion" binding:"" example:"0.59.0"`            // 执行策略的 opa 版本，为空使用内置引擎
+	RegoVersion string `json:"regoVersion" binding:"" enums:"v0,v1" example:"v0"` // rego 语法版本
 }
 
 type DeletePolicyGroupForm struct {
@@ -140,6 +162,12 @@ type ScanEnvironmentForm struct {
 	Parse bool      `json:"parse" binding:""  enums:"true,false" example:"false"` // 是否只执行解析
 }
 
+type ScanEnvironmentForms struct {
+	BaseForm
+
+	Ids []models.Id `json:"ids" binding:"required" example:"[env-c3ek0co6n88ldvq1n6ag, env-c3ek0co6n88ldvasdn6ag]"` // 环境Id
+}
+
 type PolicyParseForm struct {
 	BaseForm
 
@@ -244,11 +272,40 @@ type UpdatePolicySuppressForm struct {
 	//RmSourceIds  []models.Id `json:"rmTargetIds" example:"env-c3ek0co6n88ldvq1n6ag"`  // 删除屏蔽源ID列表
 }
 
+type UpdatePolicySeverityForm struct {
+	BaseForm
+	Id       models.Id `uri:"id" swaggerignore:"true"`                                                                    // 策略ID
+	Severity string    `json:"severity" form:"severity" binding:"required,oneof=high medium low" enums:"high,medium,low"` // 组织内生效的严重性
+}
+
+type DeletePolicySeverityForm struct {
+	BaseForm
+	Id models.Id `uri:"id" swaggerignore:"true"` // 策略ID
+}
+
 type PolicyScanResultForm struct {
 	NoPageSizeForm
 
 	Id     models.Id `uri:"id"`                                                       // 环境ID
 	TaskId models.Id `json:"taskId" form:"taskId" example:"run-c3ek0co6n88ldvq1n6ag"` // 任务ID
+	Fields string    `json:"fields" form:"fields" example:"rego,fixSuggestion"`       // 返回的大字段，多个字段用 , 分隔，不传时返回全部字段，传空值时不返回 rego 及修复建议
+
+	Context string `json:"context" form:"context" enums:"manual,deploy,scheduled"` // 扫描触发方式(manual/deploy/scheduled)，不传时返回最后一次扫描结果，传 taskId 时忽略
+}
+
+type PolicyScanResultCursorForm struct {
+	CursorForm
+
+	Id      models.Id `uri:"id" swaggerignore:"true"`                                  // 环境或云模板ID
+	TaskId  models.Id `json:"taskId" form:"taskId" example:"run-c3ek0co6n88ldvq1n6ag"` // 任务ID
+	Fields  string    `json:"fields" form:"fields" example:"rego,fixSuggestion"`       // 返回的大字段，多个字段用 , 分隔，不传时返回全部字段
+	Context string    `json:"context" form:"context" enums:"manual,deploy,scheduled"`  // 扫描触发方式(manual/deploy/scheduled)，不传时返回最后一次扫描结果
+}
+
+type PolicyResultRegoForm struct {
+	BaseForm
+
+	Id uint `uri:"id" swaggerignore:"true"` // 扫描结果ID
 }
 
 type PolicyScanReportForm struct {
@@ -260,11 +317,30 @@ type PolicyScanReportForm struct {
 	ShowCount int       `json:"showCount" form:"showCount" example:"5"`
 }
 
+type PolicyScoreTrendForm struct {
+	BaseForm
+
+	Id   models.Id `uri:"id" swaggerignore:"true"`                               // 环境/云模板ID
+	From time.Time `json:"from" form:"from" example:"2006-01-02T15:04:05Z07:00"` // 开始日期，默认为 30 天前
+	To   time.Time `json:"to" form:"to" example:"2006-01-02T15:04:05Z07:00"`     // 结束日期，默认为当前时间
+}
+
 type PolicyTestForm struct {
 	BaseForm
 
 	Input string `form:"input" json:"input" binding:"" example:"{\n\"alicloud_instance\": [\n\n{\t\n\"id\": \"alicloud_instance.instance\"..."` // 脚本验证源数据
 	Rego  string `form:"rego" json:"rego" binding:"" example:"package accurics\ninstanceWithNoVpc[retVal] {..."`                                // rego脚本内容
+
+	Inputs []PolicyTestInput `form:"inputs" json:"inputs" binding:"omitempty,dive"` // 多组命名的验证源数据，传入时忽略 input 参数
+
+	GroupId     models.Id `form:"groupId" json:"groupId" binding:"" example:"pog-c3ek0co6n88ldvq1n6ag"` // 策略组ID，传入时使用策略组的执行引擎设置
+	OpaVersion  string    `form:"opaVersion" json:"opaVersion" binding:"" example:"0.59.0"`             // 执行策略的 opa 版本，为空使用内置引擎
+	RegoVersion string    `form:"regoVersion" json:"regoVersion" binding:"" enums:"v0,v1"`              // rego 语法版本
+}
+
+type PolicyTestInput struct {
+	Name  string `form:"name" json:"name" binding:"required" example:"vpc_missing"` // 输入名称
+	Input string `form:"input" json:"input" binding:""`                             // 验证源数据
 }
 
 type PolicyLastTasksForm struct {
@@ -274,6 +350,19 @@ type PolicyLastTasksForm struct {
 	Scope string    `json:"-"`
 }
 
+type SearchPolicyGroupSyncForm struct {
+	PageForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 策略组ID
+}
+
+type DetailPolicyGroupSyncForm struct {
+	BaseForm
+
+	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`         // 策略组ID
+	SyncId models.Id `uri:"syncId" json:"syncId" swaggerignore:"true"` // 同步记录ID
+}
+
 type SearchGroupOfPolicyForm struct {
 	PageForm
 
@@ -14,3 +14,12 @@ type SearchRegistryPgVersForm struct {
 	Namespace string `json:"ns" form:"ns" binding:"required"` // policy namespace
 	GroupName string `json:"gn" form:"gn" binding:"required"` // policy groupname
 }
+
+type ImportRegistryPgForm struct {
+	BaseForm
+
+	Namespace string `json:"ns" form:"ns" binding:"required"`       // registry 策略组 namespace
+	GroupName string `json:"gn" form:"gn" binding:"required"`       // registry 策略组名称
+	GitTag    string `json:"gitTag" form:"gitTag" example:"v1.0.0"` // 导入的版本，为空时导入最新版本
+	Name      string `json:"name" form:"name" example:"安全合规策略组"`    // 导入后的策略组名称，为空时使用 registry 中的名称
+}
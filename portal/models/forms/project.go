@@ -44,3 +44,19 @@ type DetailProjectForm struct {
 
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
 }
+
+type ProjectQuotaForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"`
+}
+
+type UpdateProjectQuotaForm struct {
+	BaseForm
+
+	Id                  models.Id `uri:"id" json:"id" swaggerignore:"true"`
+	QuotaMaxEnvs        int       `json:"quotaMaxEnvs" form:"quotaMaxEnvs" binding:"omitempty,min=0"`               // 最大环境数量，0 表示不限制
+	QuotaMaxResources   int       `json:"quotaMaxResources" form:"quotaMaxResources" binding:"omitempty,min=0"`     // 最大资源数量，0 表示不限制
+	QuotaMaxMonthlyCost float64   `json:"quotaMaxMonthlyCost" form:"quotaMaxMonthlyCost" binding:"omitempty,min=0"` // 最大估算月度费用，0 表示不限制
+	QuotaAction         string    `json:"quotaAction" form:"quotaAction" enums:"approval,block"`                    // 超出资源或费用配额时的处理方式，approval 需要组织管理员审批，block 禁止部署
+}
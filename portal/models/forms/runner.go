@@ -0,0 +1,50 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package forms
+
+import "cloudiac/portal/models"
+
+type SearchRunnerPoolForm struct {
+	BaseForm
+
+	Status    string `form:"status" json:"status" binding:"omitempty,oneof=online offline" enums:"online,offline"`
+	Available bool   `form:"available" json:"available"` // 只返回可以分配任务的 runner(启用且健康)
+}
+
+type RegisterRunnerForm struct {
+	BaseForm
+
+	ServiceId string   `json:"serviceId" form:"serviceId" binding:"required,max=128"` // runner 的服务 id，即任务的 runnerId
+	Address   string   `json:"address" form:"address" binding:"required"`             // runner 服务地址
+	Port      int      `json:"port" form:"port" binding:"required,min=1,max=65535"`   // runner 服务端口
+	Tags      []string `json:"tags" form:"tags"`
+}
+
+type ChangeRunnerStatusForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // runner ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type UpdateRunnerBindingsForm struct {
+	BaseForm
+
+	Id         models.Id   `uri:"id" json:"id" swaggerignore:"true"` // runner ID，swagger 参数通过 param path 指定，这里忽略
+	OrgIds     []models.Id `json:"orgIds" form:"orgIds"`             // 绑定的组织，为空时不限制组织
+	ProjectIds []models.Id `json:"projectIds" form:"projectIds"`     // 绑定的项目
+}
+
+type SearchRunnerPluginCacheForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // runner ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type PrewarmRunnerPluginCacheForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                                                                     // runner ID，swagger 参数通过 param path 指定，这里忽略
+	Providers  []string  `json:"providers" form:"providers"`                                                                           // source[@version] 格式，如 hashicorp/aws@~> 5.0，为空时使用 runner 配置的 prewarm_providers
+	EngineType string    `json:"engineType" form:"engineType" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // 执行 init 的引擎，默认为 terraform
+	TfVersion  string    `json:"tfVersion" form:"tfVersion"`                                                                           // 引擎版本，为空时使用默认版本
+}
@@ -2,6 +2,8 @@
 
 package forms
 
+import "cloudiac/portal/models"
+
 type SearchSystemConfigForm struct {
 	PageForm
 
@@ -23,3 +25,25 @@ type RegistryAddrForm struct {
 	BaseForm
 	RegistryAddr string `form:"registryAddr" json:"registryAddr"`
 }
+
+type SchedulerStatsForm struct {
+	BaseForm
+	Hours int `form:"hours" json:"hours" binding:"omitempty,min=1,max=720"` // 排队时长的统计时间范围(小时)，默认 24
+}
+
+type SearchTaskQueueForm struct {
+	BaseForm
+	RunnerId string    `form:"runnerId" json:"runnerId"` // 只返回该 runner 的队列
+	OrgId    models.Id `form:"orgId" json:"orgId"`       // 只返回该组织的排队任务
+}
+
+type UpdateTaskQueuePriorityForm struct {
+	BaseForm
+	Id       models.Id `uri:"id" json:"id" swaggerignore:"true"`                                 // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Priority int       `form:"priority" json:"priority" binding:"min=-100,max=100" example:"10"` // 调度优先级，值越大越优先执行
+}
+
+type CancelQueuedTaskForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
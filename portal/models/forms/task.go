@@ -20,6 +20,12 @@ type DetailTaskForm struct {
 	Id models.Id `uri:"id" form:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
 }
 
+type WaitTaskForm struct {
+	BaseForm
+	Id      models.Id `uri:"id" form:"id" json:"id" swaggerignore:"true"`                // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	Timeout int       `form:"timeout" json:"timeout" binding:"omitempty,min=0,max=3600"` // 等待超时时间(秒)，默认 300 秒
+}
+
 type DetailTaskStepForm struct {
 	PageForm
 	TaskId models.Id `uri:"id" form:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
@@ -71,6 +77,20 @@ type ApproveTaskForm struct {
 
 	Id     models.Id `uri:"id" json:"id" swaggerignore:"true"`                                  // 任务ID，swagger 参数通过 param path 指定，这里忽略
 	Action string    `form:"action" json:"action" binding:"required" enums:"approved,rejected"` // 审批动作：approved通过, rejected驳回
+
+	Comment string `form:"comment" json:"comment" binding:"max=1024"` // 审批意见，驳回时为驳回原因
+}
+
+type SearchTaskApprovalForm struct {
+	NoPageSizeForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchPendingApprovalForm struct {
+	NoPageSizeForm
+
+	ProjectId models.Id `form:"projectId" json:"projectId" binding:""` // 只查询指定项目的任务
 }
 
 type SearchEnvTasksForm struct {
@@ -79,6 +99,12 @@ type SearchEnvTasksForm struct {
 	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID，swagger 参数通过 param path 指定，这里忽略
 }
 
+type SearchEnvTasksCursorForm struct {
+	CursorForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 环境ID
+}
+
 type SearchTaskResourceForm struct {
 	NoPageSizeForm
 
@@ -105,3 +131,71 @@ type SearchTaskResourceGraphForm struct {
 	Id        models.Id `uri:"id" json:"id" swaggerignore:"true"`              // 任务ID，swagger 参数通过 param path 指定，这里忽略
 	Dimension string    `json:"dimension" form:"dimension" binding:"required"` // 资源名称，支持模糊查询
 }
+
+// TaskScheduleForm 指定任务的计划执行时间，为空时立即执行
+type TaskScheduleForm struct {
+	ScheduledAt string `json:"scheduledAt" form:"scheduledAt"` // 计划执行时间(RFC3339 格式)，环境配置了部署窗口时顺延到窗口开始
+}
+
+type SearchScheduledTaskForm struct {
+	PageForm
+
+	EnvId models.Id `json:"envId" form:"envId"` // 环境ID
+}
+
+type CancelScheduledTaskForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type TaskTimelineForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchTaskStepAttemptForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchTaskArtifactForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type DownloadTaskArtifactForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"`                 // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	ArtifactId models.Id `uri:"artifactId" json:"artifactId" swaggerignore:"true"` // 产物ID
+}
+
+type TaskVariablesForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type RetryTaskForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type CancelTaskForm struct {
+	BaseForm
+
+	Id          models.Id `uri:"id" json:"id" swaggerignore:"true"`                                  // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	GracePeriod int       `form:"gracePeriod" json:"gracePeriod" binding:"omitempty,min=0,max=3600"` // 等待 terraform 中断退出的时间(秒)，默认使用系统配置
+}
+
+type DiffTaskVariablesForm struct {
+	BaseForm
+
+	Id         models.Id `uri:"id" json:"id" swaggerignore:"true"` // 任务ID，swagger 参数通过 param path 指定，这里忽略
+	BaseTaskId models.Id `form:"baseTaskId" json:"baseTaskId"`     // 比较的基准任务ID，默认为同一环境的上一个任务
+}
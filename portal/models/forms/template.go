@@ -18,17 +18,21 @@ type CreateTemplateForm struct {
 
 	Name         string      `form:"name" json:"name" binding:"required,gte=2,lte=64"`
 	Description  string      `form:"description" json:"description" binding:""`
-	RepoId       string      `form:"repoId" json:"repoId" binding:"required"`
-	RepoFullName string      `form:"repoFullName" json:"repoFullName" binding:"required"`
+	RepoId       string      `form:"repoId" json:"repoId" binding:"required_without=ModuleSource"`
+	RepoFullName string      `form:"repoFullName" json:"repoFullName" binding:"required_without=ModuleSource"`
 	RepoRevision string      `form:"repoRevision" json:"repoRevision" binding:""`
 	Extra        string      `form:"extra" json:"extra"`
 	Workdir      string      `form:"workdir" json:"workdir"`
-	VcsId        models.Id   `form:"vcsId" json:"vcsId" binding:"required"`
+	VcsId        models.Id   `form:"vcsId" json:"vcsId" binding:"required_without=ModuleSource"`
 	Playbook     string      `json:"playbook" form:"playbook"`
 	PlayVarsFile string      `json:"playVarsFile" form:"playVarsFile"`
 	TfVarsFile   string      `form:"tfVarsFile" json:"tfVarsFile"`
 	ProjectId    []models.Id `form:"projectId" json:"projectId"` // 项目ID
-	TfVersion    string      `form:"tfVersion" json:"tfVersion"` // 模版使用terraform版本号
+	TfVersion    string      `form:"tfVersion" json:"tfVersion"` // 模版使用的引擎版本号
+
+	EngineType string `form:"engineType" json:"engineType" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // 执行引擎，默认为 terraform
+
+	Workdirs []string `form:"workdirs" json:"workdirs" example:"network,compute"` // 多工作目录(mono-repo)云模板按顺序部署的工作目录
 
 	Variables []Variable `json:"variables" form:"variables" `
 
@@ -38,15 +42,77 @@ type CreateTemplateForm struct {
 	PolicyGroup    []models.Id `json:"policyGroup" form:"policyGroup"`   // 绑定的合规策略组
 	TplTriggers    []string    `json:"tplTriggers" form:"tplTriggers"`   // 分之推送自动触发合规 例如 ["commit"]
 
-	KeyId models.Id `form:"keyId" json:"keyId" binding:""` // 部署密钥ID
+	TriggerBranches    []string `json:"triggerBranches" form:"triggerBranches"`       // 触发分支通配符，例如 ["main", "release/*"]
+	TriggerPaths       []string `json:"triggerPaths" form:"triggerPaths"`             // 变更文件通配符，以 / 结尾时匹配目录下的所有文件，例如 ["modules/", "*.tf"]
+	TriggerWorkdirOnly bool     `json:"triggerWorkdirOnly" form:"triggerWorkdirOnly"` // 只有工作目录下的文件变更时触发
+
+	KeyId     models.Id `form:"keyId" json:"keyId" binding:""`         // 部署密钥ID
+	RepoKeyId models.Id `form:"repoKeyId" json:"repoKeyId" binding:""` // clone 代码使用的 SSH 部署密钥ID，为空时使用 vcs 的设置
+
+	// 使用 terraform registry 模块创建云模板，此时不需要传入代码仓库信息
+	ModuleSource  string `form:"moduleSource" json:"moduleSource"`   // registry 模块地址，例如 terraform-aws-modules/vpc/aws
+	ModuleVersion string `form:"moduleVersion" json:"moduleVersion"` // 模块版本，为空时使用最新版本
+
+	LaunchForm *models.TemplateLaunchForm `form:"launchForm" json:"launchForm"` // 创建环境时使用的部署表单(JSON Schema)
 
+	Dependencies *models.TemplateDependencies `form:"dependencies" json:"dependencies"` // 外部依赖，任务开始执行前检查依赖是否可用
+
+	RequiredApprovers *models.TemplateApprovers `form:"requiredApprovers" json:"requiredApprovers"` // 部署作业必须由指定的用户或角色审批
+
+	StepTimeouts models.StepTimeouts `form:"stepTimeouts" json:"stepTimeouts" swaggertype:"object,integer" example:"apply:7200"` // 按步骤类型(init/plan/apply/play)设置的超时时间(秒)
+
+	Pipeline string `form:"pipeline" json:"pipeline"` // 自定义 pipeline(yaml)，设置后优先于代码仓库中的 pipeline 文件
+
+	DefaultRunnerId string   `form:"defaultRunnerId" json:"defaultRunnerId"` // 默认 runner
+	RunnerTags      []string `form:"runnerTags" json:"runnerTags"`           // 优先选择包含全部标签的 runner，例如 ["region=cn-hangzhou"]
+
+	// 新环境默认继承的设置，创建环境时可以覆盖
+	DefaultCronDriftExpress string `form:"defaultCronDriftExpress" json:"defaultCronDriftExpress"`      // 偏移检测表达式，不为空时新环境默认开启偏移检测
+	DefaultAutoRepairDrift  bool   `form:"defaultAutoRepairDrift" json:"defaultAutoRepairDrift"`        // 是否自动纠偏，需要同时开启自动审批
+	DefaultTTL              string `form:"defaultTTL" json:"defaultTTL" enums:"0,12h,1d,3d,1w,15d,30d"` // 存活时间
+	DefaultAutoApproval     bool   `form:"defaultAutoApproval" json:"defaultAutoApproval"`              // 是否自动审批
 }
 
+const (
+	TplSortFavorite = "favorite" // 收藏的云模板排在前面
+	TplSortRecent   = "recent"   // 按最近使用时间排序
+)
+
 type SearchTemplateForm struct {
 	PageForm
 
-	Q      string `form:"q" json:"q" binding:""`
-	Status string `form:"status" json:"status"`
+	Q        string `form:"q" json:"q" binding:""`
+	Status   string `form:"status" json:"status"`
+	Sort     string `form:"sort" json:"sort" binding:"omitempty,oneof=favorite recent" enums:"favorite,recent"` // 排序方式，favorite 收藏优先，recent 最近使用优先，默认按创建时间逆序
+	Labels   string `form:"labels" json:"labels" example:"team=payments,env=prod"`                              // 标签筛选条件，多个条件以逗号分隔，只写标签名称表示存在该标签
+	Archived string `form:"archived" json:"archived" enums:"true,false,all"`                                    // 归档状态，默认返回未归档云模板
+}
+
+type TemplateFavoriteForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 云模板ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type SearchTemplateLabelForm struct {
+	BaseForm
+
+	Id models.Id `uri:"id" json:"id" swaggerignore:"true"` // 云模板ID，swagger 参数通过 param path 指定，这里忽略
+}
+
+type TemplateLabelForm struct {
+	BaseForm
+
+	Id    models.Id `uri:"id" json:"id" swaggerignore:"true"`                        // 云模板ID，swagger 参数通过 param path 指定，这里忽略
+	Key   string    `json:"key" form:"key" binding:"required,max=63" example:"team"` // 标签名称
+	Value string    `json:"value" form:"value" binding:"max=255" example:"payments"` // 标签值
+}
+
+type DeleteTemplateLabelForm struct {
+	BaseForm
+
+	Id  models.Id `uri:"id" json:"id" swaggerignore:"true"`   // 云模板ID，swagger 参数通过 param path 指定，这里忽略
+	Key string    `uri:"key" json:"key" swaggerignore:"true"` // 标签名称，swagger 参数通过 param path 指定，这里忽略
 }
 
 type UpdateTemplateForm struct {
@@ -67,14 +133,45 @@ type UpdateTemplateForm struct {
 	RepoFullName string      `form:"repoFullName" json:"repoFullName" binding:""`
 	TfVersion    string      `form:"tfVersion" json:"tfVersion" binding:""`
 
+	EngineType string `form:"engineType" json:"engineType" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // 执行引擎
+
+	Workdirs []string `form:"workdirs" json:"workdirs" example:"network,compute"` // 多工作目录云模板按顺序部署的工作目录，传空数组表示取消
+
 	Variables []Variable `json:"variables" form:"variables" `
 
 	VarGroupIds    []models.Id `json:"varGroupIds" form:"varGroupIds" `
 	DelVarGroupIds []models.Id `json:"delVarGroupIds" form:"delVarGroupIds" `
-	PolicyEnable   bool        `json:"policyEnable" form:"policyEnable"` // 是否开启合规检测
-	PolicyGroup    []models.Id `json:"policyGroup" form:"policyGroup"`   // 绑定的合规策略组
-	TplTriggers    []string    `json:"tplTriggers" form:"tplTriggers"`   // 分之推送自动触发合规 例如 ["commit"]
-	KeyId          models.Id   `form:"keyId" json:"keyId" binding:""`    // 部署密钥ID
+	PolicyEnable   bool        `json:"policyEnable" form:"policyEnable"`      // 是否开启合规检测
+	PolicyGroup    []models.Id `json:"policyGroup" form:"policyGroup"`        // 绑定的合规策略组
+	TplTriggers    []string    `json:"tplTriggers" form:"tplTriggers"`        // 分之推送自动触发合规 例如 ["commit"]
+	KeyId          models.Id   `form:"keyId" json:"keyId" binding:""`         // 部署密钥ID
+	RepoKeyId      models.Id   `form:"repoKeyId" json:"repoKeyId" binding:""` // clone 代码使用的 SSH 部署密钥ID，为空时使用 vcs 的设置
+
+	TriggerBranches    []string `json:"triggerBranches" form:"triggerBranches"`       // 触发分支通配符，例如 ["main", "release/*"]
+	TriggerPaths       []string `json:"triggerPaths" form:"triggerPaths"`             // 变更文件通配符，以 / 结尾时匹配目录下的所有文件，例如 ["modules/", "*.tf"]
+	TriggerWorkdirOnly bool     `json:"triggerWorkdirOnly" form:"triggerWorkdirOnly"` // 只有工作目录下的文件变更时触发
+
+	ModuleSource  string `form:"moduleSource" json:"moduleSource"`   // registry 模块地址
+	ModuleVersion string `form:"moduleVersion" json:"moduleVersion"` // 模块版本，为空时使用最新版本
+
+	LaunchForm *models.TemplateLaunchForm `form:"launchForm" json:"launchForm"` // 创建环境时使用的部署表单(JSON Schema)，传 null 表示清除
+
+	Dependencies *models.TemplateDependencies `form:"dependencies" json:"dependencies"` // 外部依赖，传 null 表示清除
+
+	RequiredApprovers *models.TemplateApprovers `form:"requiredApprovers" json:"requiredApprovers"` // 部署作业的指定审批人，传 null 表示清除
+
+	StepTimeouts models.StepTimeouts `form:"stepTimeouts" json:"stepTimeouts" swaggertype:"object,integer" example:"apply:7200"` // 按步骤类型设置的超时时间(秒)，传 null 表示清除
+
+	Pipeline string `form:"pipeline" json:"pipeline"` // 自定义 pipeline(yaml)，传空字符串表示清除
+
+	DefaultRunnerId string   `form:"defaultRunnerId" json:"defaultRunnerId"` // 默认 runner
+	RunnerTags      []string `form:"runnerTags" json:"runnerTags"`           // 优先选择包含全部标签的 runner，例如 ["region=cn-hangzhou"]
+
+	// 新环境默认继承的设置，创建环境时可以覆盖
+	DefaultCronDriftExpress string `form:"defaultCronDriftExpress" json:"defaultCronDriftExpress"`      // 偏移检测表达式，不为空时新环境默认开启偏移检测
+	DefaultAutoRepairDrift  bool   `form:"defaultAutoRepairDrift" json:"defaultAutoRepairDrift"`        // 是否自动纠偏，需要同时开启自动审批
+	DefaultTTL              string `form:"defaultTTL" json:"defaultTTL" enums:"0,12h,1d,3d,1w,15d,30d"` // 存活时间
+	DefaultAutoApproval     bool   `form:"defaultAutoApproval" json:"defaultAutoApproval"`              // 是否自动审批
 }
 
 type DeleteTemplateForm struct {
@@ -82,6 +179,21 @@ type DeleteTemplateForm struct {
 	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
 }
 
+type RestoreTemplateForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
+type PurgeTemplateForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
+type TemplateHealthForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
 type DetailTemplateForm struct {
 	BaseForm
 	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
@@ -129,6 +241,13 @@ type TemplateTfVersionSearchForm struct {
 	VcsId     models.Id `json:"vcsId" form:"vcsId"`
 	VcsBranch string    `json:"vcsBranch" form:"vcsBranch"`
 	RepoId    string    `json:"repoId" form:"repoId"`
+
+	EngineType string `json:"engineType" form:"engineType" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // 执行引擎，默认为 terraform
+}
+
+type TemplateEngineVersionsForm struct {
+	BaseForm
+	EngineType string `json:"engineType" form:"engineType" binding:"omitempty,oneof=terraform opentofu" enums:"terraform,opentofu"` // 执行引擎，默认为 terraform
 }
 
 type TemplateChecksForm struct {
@@ -139,4 +258,91 @@ type TemplateChecksForm struct {
 	VcsId        models.Id `json:"vcsId" form:"vcsId"`
 	Workdir      string    `json:"workdir" form:"workdir"`
 	TemplateId   models.Id `json:"templateId" form:"templateId"`
+	CheckUnused  bool      `json:"checkUnused" form:"checkUnused"` // 检查工作目录下是否存在未使用或未声明的变量、未使用的输出
+	Validate     bool      `json:"validate" form:"validate"`       // 在 runner 中执行 terraform validate 及 fmt 检查
+	TfVersion    string    `json:"tfVersion" form:"tfVersion"`     // 执行检查使用的引擎版本，未传入时使用云模板的设置
+	RunnerId     string    `json:"runnerId" form:"runnerId"`       // 执行检查的 runner，未传入时使用默认 runner
+	TfVarsFile   string    `json:"tfVarsFile" form:"tfVarsFile"`   // 传入时检查 tfvars 文件是否存在
+	Playbook     string    `json:"playbook" form:"playbook"`       // 传入时检查 playbook 文件是否存在，并要求配置部署密钥
+	KeyId        models.Id `json:"keyId" form:"keyId"`             // 部署密钥ID，传入时检查密钥是否存在
+	RepoKeyId    models.Id `json:"repoKeyId" form:"repoKeyId"`     // clone 代码使用的 SSH 部署密钥ID，未传入时使用云模板的设置
+
+	ModuleSource  string `json:"moduleSource" form:"moduleSource"`   // registry 模块地址，传入时检查模块是否存在
+	ModuleVersion string `json:"moduleVersion" form:"moduleVersion"` // 模块版本
+
+	EngineType string `json:"engineType" form:"engineType" binding:"omitempty,oneof=terraform opentofu"` // 执行检查使用的引擎，未传入时使用云模板的设置
+}
+
+type TemplateTriggersForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
+type UpdateTemplateTriggersForm struct {
+	BaseForm
+	Id       models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	Triggers []string  `json:"triggers" form:"triggers" binding:"omitempty,dive,oneof=commit prmr"` // 触发器，为空时删除 webhook 例如 ["commit"]
+}
+
+type SearchTemplateRevisionForm struct {
+	PageForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
+type TemplateRevisionDiffForm struct {
+	BaseForm
+	Id   models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	From int       `form:"from" json:"from" binding:"required,min=1"` // 对比的起始修订号
+	To   int       `form:"to" json:"to" binding:"required,min=1"`     // 对比的目标修订号
+}
+
+type RollbackTemplateForm struct {
+	BaseForm
+	Id       models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	Revision int       `uri:"revision" json:"revision" binding:"required,min=1" swaggerignore:"true"`
+}
+
+const (
+	TplBatchEnable     = "enable"
+	TplBatchDisable    = "disable"
+	TplBatchDelete     = "delete"
+	TplBatchBindPolicy = "bindPolicyGroups"
+)
+
+type BatchTemplateForm struct {
+	BaseForm
+	Ids            []models.Id `json:"ids" form:"ids" binding:"required,min=1,max=500"`                                      // 云模板ID列表
+	Action         string      `json:"action" form:"action" binding:"required,oneof=enable disable delete bindPolicyGroups"` // 批量操作类型
+	PolicyGroupIds []models.Id `json:"policyGroupIds" form:"policyGroupIds"`                                                 // 重新绑定的策略组，action 为 bindPolicyGroups 时有效，为空表示解除绑定
+}
+
+type DeprecateTemplateForm struct {
+	BaseForm
+	Id          models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	SuccessorId models.Id `json:"successorId" form:"successorId" binding:"required"` // 替代云模板 id
+	Note        string    `json:"note" form:"note" binding:"max=1024"`               // 废弃说明
+}
+
+type UndeprecateTemplateForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
+type TemplateDeprecationReportForm struct {
+	PageForm
+	Id models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+}
+
+type MigrateTemplateEnvsForm struct {
+	BaseForm
+	Id     models.Id   `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	EnvIds []models.Id `json:"envIds" form:"envIds" binding:"max=500"` // 需要预览迁移的环境，为空时预览所有使用该云模板的环境
+}
+
+type SyncTemplateRepoForm struct {
+	BaseForm
+	VcsId        models.Id   `form:"vcsId" json:"vcsId" binding:"required"`
+	RepoId       string      `form:"repoId" json:"repoId" binding:"required"`
+	RepoRevision string      `form:"repoRevision" json:"repoRevision"` // 读取清单文件的分支，为空时使用仓库默认分支
+	ProjectId    []models.Id `form:"projectId" json:"projectId"`       // 新创建的云模板关联的项目
 }
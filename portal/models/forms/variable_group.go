@@ -14,6 +14,9 @@ type CreateVariableGroupForm struct {
 	Name      string                    `json:"name" form:"name"`
 	Type      string                    `json:"type" form:"type"`
 	Variables []models.VarGroupVariable `json:"variables" form:"variables" `
+
+	ShareProjects  []models.Id `json:"shareProjects" form:"shareProjects"`   // 共享的项目，为空时不限制
+	ShareTemplates []models.Id `json:"shareTemplates" form:"shareTemplates"` // 共享的云模板，为空时不限制
 }
 
 type UpdateVariableGroupForm struct {
@@ -22,6 +25,9 @@ type UpdateVariableGroupForm struct {
 	Id        models.Id                 `uri:"id"`
 	Name      string                    `json:"name" form:"name"`
 	Variables []models.VarGroupVariable `json:"variables" form:"variables" `
+
+	ShareProjects  []models.Id `json:"shareProjects" form:"shareProjects"`   // 共享的项目，传空数组表示不限制
+	ShareTemplates []models.Id `json:"shareTemplates" form:"shareTemplates"` // 共享的云模板，传空数组表示不限制
 }
 
 type DeleteVariableGroupForm struct {
@@ -34,6 +40,11 @@ type DetailVariableGroupForm struct {
 	Id models.Id `uri:"id"`
 }
 
+type VariableGroupAccessForm struct {
+	BaseForm
+	Id models.Id `uri:"id" swaggerignore:"true"`
+}
+
 type SearchRelationshipForm struct {
 	BaseForm
 	ObjectType string    `json:"objectType" form:"objectType" ` //enum('org','template','project','env')
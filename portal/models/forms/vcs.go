@@ -2,14 +2,26 @@
 
 package forms
 
-import "cloudiac/portal/models"
+import (
+	"cloudiac/portal/models"
+	"mime/multipart"
+)
 
 type CreateVcsForm struct {
 	BaseForm
 	Name     string `form:"name" json:"name" binding:"required"`
 	VcsType  string `form:"vcsType" json:"vcsType" binding:"required"`
 	Address  string `form:"address" json:"address" binding:"required"`
-	VcsToken string `form:"vcsToken" json:"vcsToken" binding:"required"`
+	VcsToken string `form:"vcsToken" json:"vcsToken" binding:""` // 认证方式为 token 时必填
+
+	AuthType            string `form:"authType" json:"authType" binding:"omitempty,oneof=token oauth githubApp" enums:"token,oauth,githubApp"`
+	OauthClientId       string `form:"oauthClientId" json:"oauthClientId" binding:""`
+	OauthClientSecret   string `form:"oauthClientSecret" json:"oauthClientSecret" binding:""`
+	GithubAppId         int64  `form:"githubAppId" json:"githubAppId" binding:""`
+	GithubAppPrivateKey string `form:"githubAppPrivateKey" json:"githubAppPrivateKey" binding:""`
+	InstallationId      int64  `form:"installationId" json:"installationId" binding:""`
+
+	CloneKeyId models.Id `form:"cloneKeyId" json:"cloneKeyId" binding:""` // clone 代码使用的 SSH 部署密钥 ID，为空时使用 https 地址及 token clone
 }
 
 type UpdateVcsForm struct {
@@ -20,6 +32,27 @@ type UpdateVcsForm struct {
 	VcsType  string    `form:"vcsType" json:"vcsType" binding:""`
 	Address  string    `form:"address" json:"address" binding:""`
 	VcsToken string    `form:"vcsToken" json:"vcsToken" binding:""`
+
+	AuthType            string `form:"authType" json:"authType" binding:"omitempty,oneof=token oauth githubApp" enums:"token,oauth,githubApp"`
+	OauthClientId       string `form:"oauthClientId" json:"oauthClientId" binding:""`
+	OauthClientSecret   string `form:"oauthClientSecret" json:"oauthClientSecret" binding:""`
+	GithubAppId         int64  `form:"githubAppId" json:"githubAppId" binding:""`
+	GithubAppPrivateKey string `form:"githubAppPrivateKey" json:"githubAppPrivateKey" binding:""`
+	InstallationId      int64  `form:"installationId" json:"installationId" binding:""`
+
+	CloneKeyId models.Id `form:"cloneKeyId" json:"cloneKeyId" binding:""` // clone 代码使用的 SSH 部署密钥 ID，为空时使用 https 地址及 token clone
+}
+
+type VcsOauthAuthorizeForm struct {
+	BaseForm
+	Id models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+}
+
+type VcsOauthCallbackForm struct {
+	BaseForm
+	Code           string `form:"code" json:"code" binding:"required"`
+	State          string `form:"state" json:"state" binding:"required"`
+	InstallationId int64  `form:"installation_id" json:"installation_id" binding:""` // GitHub App 安装后回调时携带
 }
 
 type SearchVcsForm struct {
@@ -47,6 +80,13 @@ type GetGitRevisionForm struct {
 	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
 }
 
+type SearchGitRevisionForm struct {
+	PageForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
+	Q      string    `form:"q" json:"q"` // 按名称过滤，不区分大小写
+}
+
 type GetReadmeForm struct {
 	BaseForm
 	Id           models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
@@ -55,6 +95,28 @@ type GetReadmeForm struct {
 	Dir          string    `form:"dir" json:"dir"` // 指定目录名，默认读取根目录
 }
 
+type ClearVcsCacheForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId"` // 只清除该仓库的缓存，为空时清除 vcs 的所有缓存
+}
+
+type GetRepoTreeForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
+	Ref    string    `form:"ref" json:"ref"`   // 分支、tag 或 commit id，默认为仓库默认分支
+	Path   string    `form:"path" json:"path"` // 目录路径，默认为根目录
+}
+
+type GetRepoBlobForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
+	Ref    string    `form:"ref" json:"ref"` // 分支、tag 或 commit id，默认为仓库默认分支
+	Path   string    `form:"path" json:"path" binding:"required"`
+}
+
 type SearchVcsFileForm struct {
 	BaseForm
 	Id       models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
@@ -62,3 +124,43 @@ type SearchVcsFileForm struct {
 	Branch   string    `form:"branch" json:"branch" binding:"required"`
 	FileName string    `json:"fileName" form:"fileName" binding:"required"`
 }
+
+type CreateLocalRepoForm struct {
+	BaseForm
+	Id            models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	Name          string    `form:"name" json:"name" binding:"required" example:"network/vpc"` // 仓库名称，支持使用 / 分隔的多级目录
+	DefaultBranch string    `form:"defaultBranch" json:"defaultBranch" example:"main"`         // 默认分支，默认为 master
+}
+
+type UploadLocalRepoArchiveForm struct {
+	BaseForm
+	Id      models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId  string    `form:"repoId" json:"repoId" binding:"required"`
+	Branch  string    `form:"branch" json:"branch"`   // 提交的分支，默认为仓库默认分支，分支不存在时创建
+	Message string    `form:"message" json:"message"` // 提交信息
+	Dir     string    `form:"dir" json:"dir"`         // 作为仓库根目录的压缩包内目录，默认为压缩包根目录
+
+	File *multipart.FileHeader `form:"file" binding:"required" swaggerignore:"true"` // 代码 zip 压缩包，压缩包内容将作为分支的全部代码
+}
+
+type CreateLocalRepoBranchForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
+	Name   string    `form:"name" json:"name" binding:"required"` // 分支名称
+	From   string    `form:"from" json:"from"`                    // 基于该分支、tag 或 commit 创建，默认为仓库默认分支
+}
+
+type DeleteLocalRepoBranchForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
+	Name   string    `form:"name" json:"name" binding:"required"` // 分支名称，不能删除默认分支
+}
+
+type SetLocalRepoDefaultBranchForm struct {
+	BaseForm
+	Id     models.Id `uri:"id" json:"id" binding:"" swaggerignore:"true"`
+	RepoId string    `form:"repoId" json:"repoId" binding:"required"`
+	Branch string    `form:"branch" json:"branch" binding:"required"`
+}
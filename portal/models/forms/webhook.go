@@ -2,6 +2,11 @@
 
 package forms
 
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+)
+
 type WebhooksApiHandler struct {
 	BaseForm
 	VcsType          string           `uri:"vcsType"`            //url参数
@@ -18,6 +23,35 @@ type WebhooksApiHandler struct {
 	Before           string           `json:"before"`            //gitea push时回调的commitid
 	After            string           `json:"after"`             //gitea push时回调的commitid
 	Repository       Repository       `json:"repository"`        //gitea pr回调仓库信息
+	Commits          []Commit         `json:"commits"`           // push 的 commit 列表，包含变更文件
+	TotalCommits     int              `json:"total_commits_count"` // gitlab push 的 commit 总数，超过 20 个时 commits 只包含部分 commit
+
+	BitbucketPush        BitbucketPush        `json:"push"`        // bitbucket cloud push 信息
+	BitbucketChanges     BitbucketChanges     `json:"changes"`     // bitbucket server push 信息
+	BitbucketPullRequest BitbucketPullRequest `json:"pullrequest"` // bitbucket pr 信息，cloud 为 pullrequest，server 为 pullRequest
+
+	Headers map[string]string `json:"-"` // 请求头，用于记录投递日志
+	Payload []byte            `json:"-"` // 原始请求内容，用于记录投递日志及重放
+}
+
+type SearchTemplateWebhookDeliveryForm struct {
+	PageForm
+	Id     models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	Status string    `form:"status" json:"status" binding:"omitempty,oneof=success failed"` // 按处理状态过滤
+}
+
+type TemplateWebhookDeliveryForm struct {
+	BaseForm
+	Id         models.Id `uri:"id" json:"id" binding:"required" swaggerignore:"true"`
+	DeliveryId models.Id `uri:"deliveryId" json:"deliveryId" binding:"required" swaggerignore:"true"`
+}
+
+// Commit push 事件中的 commit 信息，gitlab/github/gitea/gitee 格式相同
+type Commit struct {
+	Id       string   `json:"id"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
 }
 
 type Project struct {
@@ -57,4 +91,71 @@ type Head struct {
 type Repository struct {
 	Id       int    `json:"id"`
 	FullName string `json:"full_name"`
+
+	Slug    string            `json:"slug"`    // bitbucket server 仓库 slug
+	Project RepositoryProject `json:"project"` // bitbucket server 仓库所属项目
+}
+
+type RepositoryProject struct {
+	Key string `json:"key"`
+}
+
+// BitbucketPush bitbucket cloud push 事件
+type BitbucketPush struct {
+	Changes []struct {
+		New BitbucketCloudRef `json:"new"`
+		Old BitbucketCloudRef `json:"old"` // 新建分支时为 null
+	} `json:"changes"`
+}
+
+type BitbucketCloudRef struct {
+	Type   string `json:"type"` // branch 或 tag
+	Name   string `json:"name"`
+	Target struct {
+		Hash string `json:"hash"`
+	} `json:"target"`
+}
+
+// BitbucketChange bitbucket server push 事件的分支变更
+type BitbucketChange struct {
+	Ref struct {
+		Id        string `json:"id"` // refs/heads/{branch}
+		DisplayId string `json:"displayId"`
+	} `json:"ref"`
+	FromHash string `json:"fromHash"`
+	ToHash   string `json:"toHash"`
+	Type     string `json:"type"` // ADD/UPDATE/DELETE
+}
+
+// BitbucketChanges gitlab mr 事件的 changes 为对象，解析失败时忽略
+type BitbucketChanges []BitbucketChange
+
+func (c *BitbucketChanges) UnmarshalJSON(data []byte) error {
+	changes := make([]BitbucketChange, 0)
+	if err := json.Unmarshal(data, &changes); err == nil {
+		*c = changes
+	}
+	return nil
+}
+
+// BitbucketPullRequest bitbucket pr 事件，cloud 使用 source/destination，server 使用 fromRef/toRef
+type BitbucketPullRequest struct {
+	Id     int    `json:"id"`
+	State  string `json:"state"` // OPEN/MERGED/DECLINED
+	Source struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"source"`
+	Destination struct {
+		Branch struct {
+			Name string `json:"name"`
+		} `json:"branch"`
+	} `json:"destination"`
+	FromRef struct {
+		DisplayId string `json:"displayId"`
+	} `json:"fromRef"`
+	ToRef struct {
+		DisplayId string `json:"displayId"`
+	} `json:"toRef"`
 }
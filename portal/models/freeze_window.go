@@ -0,0 +1,68 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+)
+
+const (
+	FreezeWindowCron  = "cron"  // 按 cron 表达式周期性冻结，每次持续 Duration 分钟
+	FreezeWindowRange = "range" // 在指定的时间范围内冻结
+)
+
+// FreezeWindow 部署冻结窗口，冻结期间 task_manager 不会启动匹配的部署任务，
+// 例如 "周五 18:00 至周一 08:00 禁止 prod 环境 apply" 可配置为 cron "0 18 * * 5"，时长 3720 分钟
+type FreezeWindow struct {
+	TimedModel
+
+	OrgId       Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`
+	ProjectId   Id     `json:"projectId" gorm:"size:32;default:'';comment:项目ID"` // 为空表示对组织下所有项目生效
+	CreatorId   Id     `json:"creatorId" gorm:"size:32;not null;comment:创建人"`
+	Name        string `json:"name" gorm:"size:64;not null;comment:冻结窗口名称"`
+	Description string `json:"description" gorm:"type:text"`
+	Enabled     bool   `json:"enabled" gorm:"default:true"`
+
+	Type     string `json:"type" gorm:"size:16;not null" enums:"cron,range"`
+	Cron     string `json:"cron" gorm:"size:128;default:''"`    // 冻结开始时间的 cron 表达式
+	Duration int    `json:"duration" gorm:"default:0"`          // 每次冻结的时长(分钟)
+	Timezone string `json:"timezone" gorm:"size:64;default:''"` // cron 表达式使用的时区，默认为服务器时区
+	StartAt  *Time  `json:"startAt" gorm:"type:datetime"`       // type 为 range 时冻结的开始时间
+	EndAt    *Time  `json:"endAt" gorm:"type:datetime"`         // type 为 range 时冻结的结束时间
+
+	TaskTypes     StrSlice `json:"taskTypes" gorm:"type:json"`     // 禁止执行的任务类型，默认为 apply 和 destroy
+	Criticalities StrSlice `json:"criticalities" gorm:"type:json"` // 生效的环境重要程度，为空表示所有环境
+}
+
+func (FreezeWindow) TableName() string {
+	return "iac_freeze_window"
+}
+
+func (FreezeWindow) NewId() Id {
+	return NewId("fw")
+}
+
+func (w FreezeWindow) Migrate(sess *db.Session) (err error) {
+	return w.AddUniqueIndex(sess, "unique__org__freeze_window__name", "org_id", "name")
+}
+
+// FreezeOverride 冻结期间的紧急放行记录，记录只增不改，供审计使用
+type FreezeOverride struct {
+	TimedModel
+
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null;index"`
+	ProjectId Id     `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id     `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id     `json:"taskId" gorm:"size:32;not null"`
+	WindowId  Id     `json:"windowId" gorm:"size:32;not null;comment:放行的冻结窗口"`
+	UserId    Id     `json:"userId" gorm:"size:32;not null;comment:放行人"`
+	Reason    string `json:"reason" gorm:"type:text;comment:放行原因"`
+}
+
+func (FreezeOverride) TableName() string {
+	return "iac_freeze_override"
+}
+
+func (FreezeOverride) NewId() Id {
+	return NewId("fo")
+}
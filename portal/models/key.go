@@ -12,6 +12,7 @@ type Key struct {
 
 	Name      string `json:"name" gorm:"not null;comment:密钥名称" example:"部署密钥"`                               // 密钥名称
 	Content   string `json:"-" gorm:"type:text;not null;comment:密钥内容" example:"xxxx"`                        // 密钥内容
+	PublicKey string `json:"publicKey" gorm:"type:text;comment:公钥" example:"ssh-ed25519 AAAA..."`            // 公钥(authorized_keys 格式)，用于添加到代码仓库的部署密钥
 	CreatorId Id     `json:"creatorId" gorm:"size:32;not null;comment:创建人" example:"u-c3ek0co6n88ldvq1n6ag"` //创建人ID
 }
 
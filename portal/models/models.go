@@ -202,7 +202,9 @@ func Init(migrate bool) {
 	autoMigrate(&Organization{}, sess)
 	autoMigrate(&Project{}, sess)
 	autoMigrate(&Vcs{}, sess)
+	autoMigrate(&VcsOauthToken{}, sess)
 	autoMigrate(&VcsPr{}, sess)
+	autoMigrate(&WebhookDelivery{}, sess)
 	autoMigrate(&Template{}, sess)
 	autoMigrate(&Env{}, sess)
 	autoMigrate(&Resource{}, sess)
@@ -217,6 +219,7 @@ func Init(migrate bool) {
 	autoMigrate(&User{}, sess)
 	autoMigrate(&UserOrg{}, sess)
 	autoMigrate(&UserProject{}, sess)
+	autoMigrate(&UserTemplate{}, sess)
 
 	autoMigrate(&Notification{}, sess)
 	autoMigrate(&NotificationEvent{}, sess)
@@ -230,12 +233,41 @@ func Init(migrate bool) {
 	autoMigrate(&ProjectTemplate{}, sess)
 	autoMigrate(&Policy{}, sess)
 	autoMigrate(&PolicyGroup{}, sess)
+	autoMigrate(&PolicyGroupSync{}, sess)
 	autoMigrate(&PolicyRel{}, sess)
 	autoMigrate(&PolicyResult{}, sess)
 	autoMigrate(&PolicySuppress{}, sess)
+	autoMigrate(&OrgPolicyOverride{}, sess)
 	autoMigrate(&VariableGroup{}, sess)
 	autoMigrate(&VariableGroupRel{}, sess)
 	autoMigrate(&ResourceDrift{}, sess)
+	autoMigrate(&ResourceDriftHistory{}, sess)
+	autoMigrate(&TaskVarSnapshot{}, sess)
+	autoMigrate(&BillingConnector{}, sess)
+	autoMigrate(&BillingRecord{}, sess)
+	autoMigrate(&OrgDestructionCert{}, sess)
+	autoMigrate(&TemplateRevision{}, sess)
+	autoMigrate(&TemplateLabel{}, sess)
+	autoMigrate(&EnvAttestation{}, sess)
+	autoMigrate(&ChatIdentity{}, sess)
+	autoMigrate(&ChatOpsCommand{}, sess)
+	autoMigrate(&FreezeWindow{}, sess)
+	autoMigrate(&FreezeOverride{}, sess)
+	autoMigrate(&EnvStateVersion{}, sess)
+	autoMigrate(&EnvPlanArtifact{}, sess)
+	autoMigrate(&CostPrice{}, sess)
+	autoMigrate(&TaskCostEstimate{}, sess)
+	autoMigrate(&EnvDestroyReminder{}, sess)
+	autoMigrate(&EnvSuspension{}, sess)
+	autoMigrate(&FleetDeploy{}, sess)
+	autoMigrate(&FleetDeployItem{}, sess)
+	autoMigrate(&TaskApproval{}, sess)
+	autoMigrate(&TaskEvent{}, sess)
+	autoMigrate(&TaskArtifact{}, sess)
+	autoMigrate(&TaskStepAttempt{}, sess)
+	autoMigrate(&Runner{}, sess)
+	autoMigrate(&PromotionChain{}, sess)
+	autoMigrate(&EnvPromotion{}, sess)
 
 	dbMigrate(sess)
 }
@@ -0,0 +1,33 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// OrgDestructionCert 组织数据销毁证明，组织数据清除后保留，用于证明数据已被不可逆地删除
+type OrgDestructionCert struct {
+	TimedModel
+
+	OrgId       Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID" example:"org-c3lcrjxczjdywmk0go90"` // 组织ID
+	OrgName     string `json:"orgName" gorm:"not null;comment:组织名称" example:"研发部"`                            // 组织名称
+	RequestedBy Id     `json:"requestedBy" gorm:"size:32;comment:申请清除数据的用户" example:"u-c3ek0co6n88ldvq1n6ag"` // 申请清除数据的用户
+	ScheduledAt Time   `json:"scheduledAt" gorm:"type:datetime;comment:计划清除时间" example:"2006-01-02 15:04:05"` // 计划清除时间
+	PurgedAt    Time   `json:"purgedAt" gorm:"type:datetime;comment:实际清除时间" example:"2006-01-02 15:04:05"`    // 实际清除时间
+	Records     JSON   `json:"records" gorm:"type:json;comment:各数据表清除的记录数" swaggertype:"object"`              // 各数据表清除的记录数
+	Digest      string `json:"digest" gorm:"size:64;not null;comment:证明内容摘要"`                                 // 证明内容的 sha256 摘要，用于校验证明未被篡改
+}
+
+func (OrgDestructionCert) TableName() string {
+	return "iac_org_destruction_cert"
+}
+
+func (c *OrgDestructionCert) CustomBeforeCreate(*db.Session) error {
+	if c.Id == "" {
+		c.Id = NewId("odc")
+	}
+	return nil
+}
+
+func (c OrgDestructionCert) Migrate(sess *db.Session) (err error) {
+	return c.AddUniqueIndex(sess, "unique__org", "org_id")
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// OrgPolicyOverride 组织级别的策略属性覆盖，用于在不修改 rego 的情况下调整策略在组织内的严重性
+type OrgPolicyOverride struct {
+	TimedModel
+
+	CreatorId Id     `json:"creatorId" gorm:"size:32;not null;comment:操作人" example:"u-c3lcrjxczjdywmk0go90"`             // 操作人
+	OrgId     Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID" example:"org-c3lcrjxczjdywmk0go90"`              // 组织ID
+	PolicyId  Id     `json:"policyId" gorm:"size:32;not null;comment:策略ID" example:"po-c3lcrjxczjdywmk0go90"`            // 策略ID
+	Severity  string `json:"severity" gorm:"type:enum('high','medium','low');not null;comment:覆盖后的严重性" example:"medium"` // 覆盖后的严重性
+}
+
+func (OrgPolicyOverride) TableName() string {
+	return "iac_org_policy_override"
+}
+
+func (o *OrgPolicyOverride) CustomBeforeCreate(*db.Session) error {
+	if o.Id == "" {
+		o.Id = NewId("opo")
+	}
+	return nil
+}
+
+func (o OrgPolicyOverride) Migrate(sess *db.Session) (err error) {
+	return o.AddUniqueIndex(sess, "unique__org__policy", "org_id", "policy_id")
+}
@@ -23,6 +23,9 @@ type Organization struct {
 	RunnerId    string `json:"runnerId" gorm:"not null" example:"runner-01"`                                                                      // 组织默认部署通道
 
 	IsDemo bool `json:"isDemo,omitempty" gorm:"default:false"` // 是否演示组织
+
+	PurgeAt          *Time `json:"purgeAt,omitempty" gorm:"type:datetime;comment:计划清除数据的时间"`    // 计划清除数据的时间，为空表示未计划清除
+	PurgeRequestedBy Id    `json:"purgeRequestedBy,omitempty" gorm:"size:32;comment:申请清除数据的用户"` // 申请清除数据的用户
 }
 
 func (Organization) TableName() string {
@@ -15,9 +15,9 @@ type PolicyGroup struct {
 	Name        string `json:"name" gorm:"not null;size:128;comment:策略组名称" example:"安全合规策略组"`
 	Description string `json:"description" gorm:"type:text;comment:描述" example:"本组包含对于安全合规的检查策略"`
 	Enabled     bool   `json:"enabled" gorm:"default:true;comment:是否启用" example:"true"`
-	Source      string `json:"source" gorm:"type:enum('vcs','registry');comment:来源：VCS/Registry"`
+	Source      string `json:"source" gorm:"type:enum('vcs','registry','upload');comment:来源：VCS/Registry/Upload"`
 	VcsId       Id     `json:"vcsId" gorm:"size:32;not null;comment:VCS ID"`
-	RepoId      string `json:"repoId" gorm:"size:128;not null;comment:VCS 仓库ID"`
+	RepoId      string `json:"repoId" gorm:"size:128;not null;comment:VCS 仓库ID，上传的策略组为压缩包存储路径"`
 	GitTags     string `json:"gitTags" gorm:"size:128;comment:Git 版本标签：\"v1.0.0\""`
 	Branch      string `json:"branch" gorm:"size:128;comment:分支"`
 	CommitId    string `json:"commitId" gorm:"size:128;not null;当前 git commit id"`
@@ -25,6 +25,11 @@ type PolicyGroup struct {
 	Version     string `json:"version" gorm:"size:32;not null;策略组版本：\"1.0.0\""`
 	Dir         string `json:"dir" gorm:"default:\"/\";comment:策略组目录，默认为根目录：/"`
 	Label       string `json:"label" gorm:"size:128;comment:策略组标签，多个值以 , 分隔"`
+	OpaVersion  string `json:"opaVersion" gorm:"size:32;default:'';comment:执行策略的 opa 版本，为空使用内置引擎" example:"0.59.0"`
+	RegoVersion string `json:"regoVersion" gorm:"size:8;default:'v0';comment:rego 语法版本" enums:"v0,v1" example:"v0"`
+
+	RegistryRef   string `json:"registryRef" gorm:"size:255;default:'';comment:从 registry 导入的策略组标识，格式为 namespace/groupName" example:"aliyun/security"`
+	LatestVersion string `json:"latestVersion" gorm:"size:32;default:'';comment:registry 中该策略组的最新版本" example:"v1.1.0"`
 }
 
 func (PolicyGroup) TableName() string {
@@ -42,5 +47,8 @@ func (g PolicyGroup) Migrate(sess *db.Session) error {
 	if err := g.AddUniqueIndex(sess, "unique__name", "name"); err != nil {
 		return err
 	}
+	if err := sess.ModifyModelColumn(&PolicyGroup{}, "source"); err != nil {
+		return err
+	}
 	return nil
 }
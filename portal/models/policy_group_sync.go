@@ -0,0 +1,71 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+const (
+	PolicyChangeCreated = "created"
+	PolicyChangeUpdated = "updated"
+	PolicyChangeDeleted = "deleted"
+)
+
+// PolicyAttrChange 策略元数据的变更内容
+type PolicyAttrChange struct {
+	Attr string `json:"attr" example:"severity"` // 属性名称
+	Old  string `json:"old" example:"medium"`    // 修改前的值
+	New  string `json:"new" example:"high"`      // 修改后的值
+}
+
+// PolicyChange 一次同步中单条策略的变更
+type PolicyChange struct {
+	PolicyId    Id                 `json:"policyId" example:"po-c3lcrjxczjdywmk0go90"`
+	Name        string             `json:"name" example:"ECS分配公网IP"`
+	ReferenceId string             `json:"referenceId" example:"iac_aliyun_public_26"`
+	Action      string             `json:"action" enums:"created,updated,deleted"`
+	MetaChanges []PolicyAttrChange `json:"metaChanges"` // 元数据变更，新建及删除的策略记录全部元数据
+	RegoDiff    string             `json:"regoDiff"`    // unified 格式的 rego 差异
+}
+
+type PolicyChanges []PolicyChange
+
+func (v PolicyChanges) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *PolicyChanges) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// PolicyGroupSync 策略组同步记录，记录每次同步中各策略的变更
+type PolicyGroupSync struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	GroupId   Id `json:"groupId" gorm:"size:32;not null;index"`
+	CreatorId Id `json:"creatorId" gorm:"size:32;comment:同步操作人"`
+
+	Version string `json:"version" gorm:"size:32;default:'';comment:同步的策略组版本"`
+	GitTags string `json:"gitTags" gorm:"size:128;default:'';comment:同步的 git 版本标签"`
+	Branch  string `json:"branch" gorm:"size:128;default:'';comment:同步的分支"`
+
+	Created int `json:"created" gorm:"default:0;comment:新建的策略数量"`
+	Updated int `json:"updated" gorm:"default:0;comment:更新的策略数量"`
+	Deleted int `json:"deleted" gorm:"default:0;comment:删除的策略数量"`
+
+	Changes PolicyChanges `json:"changes,omitempty" gorm:"type:json;comment:策略变更明细"`
+}
+
+func (PolicyGroupSync) TableName() string {
+	return "iac_policy_group_sync"
+}
+
+func (s *PolicyGroupSync) CustomBeforeCreate(*db.Session) error {
+	if s.Id == "" {
+		s.Id = NewId("pgs")
+	}
+	return nil
+}
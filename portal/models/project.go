@@ -12,6 +12,21 @@ type Project struct {
 	Description string `json:"description" gorm:"type:text"`      //组织详情
 	CreatorId   Id     `json:"creatorId" form:"creatorId" `       //用户id
 	Status      string `json:"status" gorm:"type:enum('enable','disable');default:'enable';comment:状态"`
+
+	ProjectQuota
+}
+
+const (
+	ProjectQuotaActionApproval = "approval" // 超出配额的部署需要组织管理员审批
+	ProjectQuotaActionBlock    = "block"    // 禁止超出配额的部署
+)
+
+// ProjectQuota 项目配额，各项配额为 0 时表示不限制
+type ProjectQuota struct {
+	QuotaMaxEnvs        int     `json:"quotaMaxEnvs" gorm:"default:0"`                                        // 最大环境数量(不包括已归档的环境)
+	QuotaMaxResources   int     `json:"quotaMaxResources" gorm:"default:0"`                                   // 项目中所有环境的最大资源数量
+	QuotaMaxMonthlyCost float64 `json:"quotaMaxMonthlyCost" gorm:"type:decimal(20,6);default:0"`              // 项目中所有环境的最大估算月度费用
+	QuotaAction         string  `json:"quotaAction" gorm:"size:16;default:'approval'" enums:"approval,block"` // 部署超出资源或费用配额时的处理方式
 }
 
 func (Project) TableName() string {
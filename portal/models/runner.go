@@ -0,0 +1,92 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"time"
+)
+
+const (
+	RunnerOnline  = "online"  // runner 在 consul 中注册且健康检查通过
+	RunnerOffline = "offline" // runner 已从 consul 注销
+)
+
+// RunnerHeartbeatTimeout 超过该时间没有获取到 runner 的健康状态时认为 runner 不可用
+const RunnerHeartbeatTimeout = 2 * time.Minute
+
+// Runner runner 池中的 runner，runner 启动时注册到 consul，portal 定期同步 consul 中的 runner 并获取健康状态
+type Runner struct {
+	TimedModel
+
+	ServiceId string   `json:"serviceId" gorm:"size:128;not null"` // runner 在 consul 中的服务 id，即任务的 runnerId
+	Name      string   `json:"name" gorm:"size:128;default:''"`    // consul 服务名称
+	Address   string   `json:"address" gorm:"default:''"`
+	Port      int      `json:"port" gorm:"default:0"`
+	Tags      StrSlice `json:"tags" gorm:"type:text"`
+
+	// 禁用的 runner 不再分配新任务，已分配的任务在启动前会调度到其他 runner
+	Disabled bool   `json:"disabled" gorm:"default:false"`
+	Status   string `json:"status" gorm:"size:16;default:'online'" enums:"online,offline"`
+
+	// runner 绑定的组织及项目，绑定后只执行这些组织或项目的任务，都为空时为所有组织共享的 runner
+	OrgIds     StrSlice `json:"orgIds" gorm:"type:text"`
+	ProjectIds StrSlice `json:"projectIds" gorm:"type:text"`
+
+	LastHeartbeatAt *Time   `json:"lastHeartbeatAt" gorm:"type:datetime"` // 最近一次成功获取健康状态的时间
+	HealthError     string  `json:"healthError" gorm:"type:text"`         // 最近一次获取健康状态的错误
+	Version         string  `json:"version" gorm:"size:64;default:''"`
+	RunningTasks    int     `json:"runningTasks" gorm:"default:0"` // 正在运行的任务容器数量
+	CpuNum          int     `json:"cpuNum" gorm:"default:0"`
+	Load1           float64 `json:"load1" gorm:"default:0"`     // 最近 1 分钟的系统负载
+	DiskTotal       uint64  `json:"diskTotal" gorm:"default:0"` // 任务工作目录所在磁盘的总空间(字节)
+	DiskFree        uint64  `json:"diskFree" gorm:"default:0"`  // 任务工作目录所在磁盘的可用空间(字节)
+}
+
+func (Runner) TableName() string {
+	return "iac_runner"
+}
+
+func (Runner) NewId() Id {
+	return NewId("rnr")
+}
+
+func (r Runner) Migrate(sess *db.Session) (err error) {
+	return r.AddUniqueIndex(sess, "unique__runner__service_id", "service_id")
+}
+
+// IsHealthy runner 在线且在超时时间内获取到了健康状态
+func (r *Runner) IsHealthy(now time.Time) bool {
+	return r.Status == RunnerOnline && r.LastHeartbeatAt != nil &&
+		now.Sub(time.Time(*r.LastHeartbeatAt)) < RunnerHeartbeatTimeout
+}
+
+// Available runner 可以分配新任务
+func (r *Runner) Available(now time.Time) bool {
+	return !r.Disabled && r.IsHealthy(now)
+}
+
+const (
+	RunnerAffinityNone    = 0 // runner 绑定了其他组织或项目，不能执行任务
+	RunnerAffinityShared  = 1 // 共享的 runner
+	RunnerAffinityOrg     = 2 // runner 绑定了任务所在的组织
+	RunnerAffinityProject = 3 // runner 绑定了任务所在的项目
+)
+
+// AffinityFor runner 与组织及项目的亲和度，选择 runner 时优先选择亲和度高的 runner
+func (r *Runner) AffinityFor(orgId Id, projectId Id) int {
+	if len(r.OrgIds) == 0 && len(r.ProjectIds) == 0 {
+		return RunnerAffinityShared
+	}
+	for _, id := range r.ProjectIds {
+		if projectId != "" && Id(id) == projectId {
+			return RunnerAffinityProject
+		}
+	}
+	for _, id := range r.OrgIds {
+		if orgId != "" && Id(id) == orgId {
+			return RunnerAffinityOrg
+		}
+	}
+	return RunnerAffinityNone
+}
@@ -25,7 +25,7 @@ type BaseTask struct {
 
 	RunnerId string `json:"runnerId" gorm:"not null"` // 部署通道
 
-	Status  string `json:"status" gorm:"type:enum('pending','running','approving','rejected','failed','complete','timeout');default:'pending'" enums:"'pending','running','approving','rejected','failed','complete','timeout'"`
+	Status  string `json:"status" gorm:"type:enum('pending','running','approving','rejected','failed','complete','timeout','cancelled');default:'pending'" enums:"'pending','running','approving','rejected','failed','complete','timeout','cancelled'"`
 	Message string `json:"message" gorm:"type:text"` // 任务的状态描述信息，如失败原因等
 
 	StartAt *Time `json:"startAt" gorm:"type:datetime;comment:任务开始时间"` // 任务开始时间
@@ -49,16 +49,25 @@ type ScanTask struct {
 	Revision string `json:"revision" gorm:""`
 	CommitId string `json:"commitId" gorm:""` // 创建任务时 revision 对应的 commit id
 
+	RepoKeyId Id `json:"repoKeyId" gorm:"size:32;default:''"` // 使用 SSH 地址 clone 代码时的部署密钥ID
+
 	Workdir string `json:"workdir" gorm:"default:''"`
 
 	Mirror       bool `json:"mirror"`       // 是否属于部署任务的扫描任务
 	MirrorTaskId Id   `json:"mirrorTaskId"` // 部署任务ID
 
 	PolicyStatus string `json:"policyStatus" gorm:"size:16;default:'pending'" enums:"'passed','violated','pending','failed'"` // 策略检查结果
+	Priority     int    `json:"priority" gorm:"default:0"`                                                                    // 调度优先级，值越大越优先执行
+
+	ComplianceScore *int `json:"complianceScore" gorm:"comment:合规评分(0-100)"` // 按严重程度加权计算的合规评分，扫描完成后计算
+
+	ScanContext string `json:"scanContext" gorm:"size:16;default:'manual'" enums:"'manual','deploy','scheduled'"` // 扫描触发方式
+	Source      string `json:"source" gorm:"size:32;default:''"`                                                  // 任务来源，webhook 触发的扫描任务为 webhookScan，完成后会设置 commit 状态
 
 	Playbook     string `json:"playbook" gorm:"default:''"`
 	TfVarsFile   string `json:"tfVarsFile" gorm:"default:''"`
 	TfVersion    string `json:"tfVersion" gorm:"default:''"`
+	EngineType   string `json:"engineType" gorm:"size:16;default:'terraform'"` // 执行引擎(terraform/opentofu)
 	PlayVarsFile string `json:"playVarsFile" gorm:"default:''"`
 
 	Variables TaskVariables `json:"variables" gorm:"type:json"` // 本次执行使用的所有变量(继承、覆盖计算之后的)
@@ -69,6 +78,12 @@ type ScanTask struct {
 	ExtraData JSON `json:"extraData" gorm:"type:json"` // 扩展属性
 }
 
+const (
+	ScanContextManual    = "manual"    // 用户手动触发
+	ScanContextDeploy    = "deploy"    // 部署任务中执行
+	ScanContextScheduled = "scheduled" // 系统触发，如 webhook 触发的扫描
+)
+
 func (ScanTask) TableName() string {
 	return "iac_scan_task"
 }
@@ -0,0 +1,45 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "database/sql/driver"
+
+// 可单独设置超时时间的步骤类型
+const (
+	StepTimeoutInit  = "init"
+	StepTimeoutPlan  = "plan"
+	StepTimeoutApply = "apply" // destroy 步骤同样使用 apply 的超时时间
+	StepTimeoutPlay  = "play"
+)
+
+var StepTimeoutKeys = []string{StepTimeoutInit, StepTimeoutPlan, StepTimeoutApply, StepTimeoutPlay}
+
+// StepTimeouts 按步骤类型设置的超时时间(单位：秒)，未设置的步骤使用任务的步骤超时时间
+type StepTimeouts map[string]int
+
+// StepTimeoutKey 返回步骤类型对应的超时设置 key，不支持单独设置超时的步骤返回空字符串
+func StepTimeoutKey(stepType string) string {
+	switch stepType {
+	case TaskStepInit:
+		return StepTimeoutInit
+	case TaskStepPlan:
+		return StepTimeoutPlan
+	case TaskStepApply, TaskStepDestroy:
+		return StepTimeoutApply
+	case TaskStepPlay:
+		return StepTimeoutPlay
+	default:
+		return ""
+	}
+}
+
+func (v StepTimeouts) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return MarshalValue(v)
+}
+
+func (v *StepTimeouts) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
@@ -71,6 +71,7 @@ const (
 	TaskTypeEnvParse = common.TaskTypeEnvParse
 	TaskTypeTplScan  = common.TaskTypeTplScan
 	TaskTypeTplParse = common.TaskTypeTplParse
+	TaskTypeImport   = common.TaskTypeImport
 
 	TaskPending   = common.TaskPending
 	TaskRunning   = common.TaskRunning
@@ -78,6 +79,7 @@ const (
 	TaskRejected  = common.TaskRejected
 	TaskFailed    = common.TaskFailed
 	TaskComplete  = common.TaskComplete
+	TaskCancelled = common.TaskCancelled
 )
 
 var (
@@ -113,12 +115,18 @@ type Task struct {
 	Revision string `json:"revision" gorm:"not null"`
 	CommitId string `json:"commitId" gorm:"not null"` // 创建任务时 revision 对应的 commit id
 
+	RepoKeyId Id `json:"repoKeyId" gorm:"size:32;default:''"` // 使用 SSH 地址 clone 代码时的部署密钥ID
+
 	Workdir      string   `json:"workdir" gorm:"default:''"`
 	Playbook     string   `json:"playbook" gorm:"default:''"`
 	TfVarsFile   string   `json:"tfVarsFile" gorm:"default:''"`
 	TfVersion    string   `json:"tfVersion" gorm:"default:''"`
+	EngineType   string   `json:"engineType" gorm:"size:16;default:'terraform'"` // 执行引擎(terraform/opentofu)
 	PlayVarsFile string   `json:"playVarsFile" gorm:"default:''"`
-	Targets      StrSlice `json:"targets" gorm:"type:json"` // 指定 terraform target 参数
+	Targets      StrSlice `json:"targets" gorm:"type:json"`     // 指定 terraform target 参数
+	Partial      bool     `json:"partial" gorm:"default:false"` // 是否只部署了部分资源(指定了 target 参数)
+
+	Workdirs StrSlice `json:"workdirs" gorm:"type:json"` // 多工作目录云模板按顺序部署的工作目录
 
 	Variables TaskVariables `json:"variables" gorm:"type:json"` // 本次执行使用的所有变量(继承、覆盖计算之后的)
 
@@ -134,13 +142,48 @@ type Task struct {
 	// 任务执行结果，如 add/change/delete 的资源数量、outputs 等
 	Result TaskResult `json:"result" gorm:"type:json"` // 任务执行结果
 
+	// plan 结果超出的环境资源规模限制，不为空时任务只能由组织管理员审批
+	GuardrailViolations StrSlice `json:"guardrailViolations" gorm:"type:json"`
+
 	RetryNumber int    `json:"retryNumber" gorm:"size:32;default:0"` // 任务重试次数
 	RetryDelay  int    `json:"retryDelay" gorm:"size:32;default:0"`  // 每次任务重试时间，单位为秒
 	RetryAble   bool   `json:"retryAble" gorm:"default:false"`
 	Callback    string `json:"callback" gorm:"default:''"`       // 外部请求的回调方式
 	IsDriftTask bool   `json:"isDriftTask" gorm:"default:false"` // 是否是偏移检测任务
-	Source      string `json:"source" gorm:"not null;default:manual;enum('manual','driftPlan','driftApply','webhookPlan', 'webhookApply', 'autoDestroy', 'api')"`
+	Source      string `json:"source" gorm:"not null;default:manual;enum('manual','driftPlan','driftApply','webhookPlan', 'webhookApply', 'autoDestroy', 'api', 'rollback', 'tplMigration', 'stateImport', 'driftRemediate', 'fleetDeploy', 'promotion')"`
 	SourceSys   string `json:"sourceSys" gorm:"not null;default:''"`
+
+	// 自动回滚相关
+	RollbackFromTaskId Id `json:"rollbackFromTaskId" gorm:"size:32;default:''"` // 回滚任务对应的失败任务 id
+	RollbackTaskId     Id `json:"rollbackTaskId" gorm:"size:32;default:''"`     // 失败任务触发的自动回滚任务 id
+
+	FreezeOverrideId Id `json:"freezeOverrideId" gorm:"size:32;default:''"` // 冻结期间紧急放行的记录 id，不为空时不受冻结窗口限制
+
+	TicketId string `json:"ticketId" gorm:"size:64;default:''"` // 变更工单号，环境要求部署填写工单时必填
+
+	StepRetryCount int `json:"stepRetryCount" gorm:"default:0"` // 任务失败后从失败步骤重试的次数
+
+	CancelledBy Id `json:"cancelledBy" gorm:"size:32;default:''"` // 取消任务的用户 id，不为空表示任务已被请求取消
+
+	// 按步骤类型设置的超时时间(合并云模板及环境的设置)，未设置的步骤使用 stepTimeout
+	StepTimeouts StepTimeouts `json:"stepTimeouts" gorm:"type:json" swaggertype:"object,integer"`
+
+	RunnerTags StrSlice `json:"runnerTags" gorm:"type:text"` // 执行任务的 runner 需要包含的全部标签
+
+	ScheduledAt *Time `json:"scheduledAt" gorm:"type:datetime"` // 在环境部署窗口外提交的任务计划开始执行的时间
+
+	Priority int `json:"priority" gorm:"default:0"` // 调度优先级，值越大越优先执行，管理员可以调整排队中任务的优先级
+
+	// terraform import 任务导入的资源
+	ImportAddress    string `json:"importAddress" gorm:"default:''"`    // 导入的资源地址，如 aws_instance.web
+	ImportResourceId string `json:"importResourceId" gorm:"default:''"` // 导入的云资源 id
+
+	PlanArtifactId Id `json:"planArtifactId" gorm:"size:32;default:''"` // 执行已保存 plan 的部署任务使用的 plan 产物 id
+
+	// 基于 plan 结果的费用估算，组织未配置价格时不进行估算
+	CostEstimated    bool    `json:"costEstimated" gorm:"default:false"`
+	MonthlyCost      float64 `json:"monthlyCost" gorm:"type:decimal(20,6);default:0"`      // plan 执行后 plan 范围内资源的月度费用
+	MonthlyCostDelta float64 `json:"monthlyCostDelta" gorm:"type:decimal(20,6);default:0"` // 月度费用变化
 }
 
 func (Task) TableName() string {
@@ -181,7 +224,7 @@ func (BaseTask) IsStartedStatus(status string) bool {
 }
 
 func (BaseTask) IsExitedStatus(status string) bool {
-	return utils.InArrayStr([]string{TaskFailed, TaskRejected, TaskComplete}, status)
+	return utils.InArrayStr([]string{TaskFailed, TaskRejected, TaskComplete, TaskCancelled}, status)
 }
 
 func (t *BaseTask) IsEffectTask() bool {
@@ -190,7 +233,7 @@ func (t *BaseTask) IsEffectTask() bool {
 
 // IsEffectTaskType 是否产生实际数据变动的任务类型
 func (BaseTask) IsEffectTaskType(typ string) bool {
-	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy)
+	return utils.StrInArray(typ, TaskTypeApply, TaskTypeDestroy, TaskTypeImport)
 }
 
 func (BaseTask) GetTaskNameByType(typ string) string {
@@ -213,6 +256,8 @@ func (BaseTask) GetTaskNameByType(typ string) string {
 		return common.TaskTypeTplScanName
 	case TaskTypeTplParse:
 		return common.TaskTypeTplParseName
+	case TaskTypeImport:
+		return common.TaskTypeImportName
 	default:
 		panic("invalid task type")
 	}
@@ -230,6 +275,11 @@ func (t *Task) PlanJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFPlanJsonFile)
 }
 
+// PlanFilePath plan 步骤生成的二进制 plan 文件路径
+func (t *Task) PlanFilePath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFPlanFile)
+}
+
 func (t *Task) TfParseJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.ScanInputFile)
 }
@@ -238,10 +288,19 @@ func (t *Task) TfResultJsonPath() string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.ScanResultFile)
 }
 
+func (t *Task) TfValidateJsonPath() string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), runner.TFValidateResultFile)
+}
+
 func (t *Task) TFPlanOutputLogPath(step string) string {
 	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), step, runner.TaskLogName)
 }
 
+// ArtifactPath 步骤产物文件在日志存储中的路径
+func (t *Task) ArtifactPath(step int, name string) string {
+	return path.Join(t.ProjectId.String(), t.EnvId.String(), t.Id.String(), fmt.Sprintf("step%d", step), "artifacts", name)
+}
+
 func (t *Task) HideSensitiveVariable() {
 	for index, v := range t.Variables {
 		if v.Sensitive {
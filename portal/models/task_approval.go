@@ -0,0 +1,37 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+const (
+	TaskApprovalApproved = "approved"
+	TaskApprovalRejected = "rejected"
+)
+
+// TaskApproval 任务步骤的审批记录，需要多人审批时每个审批人一条记录
+type TaskApproval struct {
+	TimedModel
+
+	OrgId     Id  `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id  `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id  `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id  `json:"taskId" gorm:"size:32;not null;index"`
+	Step      int `json:"step" gorm:"not null"` // 审批的步骤
+
+	UserId  Id     `json:"userId" gorm:"size:32;not null"`
+	Action  string `json:"action" gorm:"size:16;not null" enums:"approved,rejected"`
+	Comment string `json:"comment" gorm:"type:text"` // 审批意见，驳回时为驳回原因
+}
+
+func (TaskApproval) TableName() string {
+	return "iac_task_approval"
+}
+
+func (TaskApproval) NewId() Id {
+	return NewId("tap")
+}
+
+func (a TaskApproval) Migrate(sess *db.Session) (err error) {
+	return a.AddUniqueIndex(sess, "unique__task__step__user", "task_id", "step", "user_id")
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// TaskArtifact 任务步骤发布的产物文件，如 ansible 报告、测试结果、生成的 kubeconfig 等，
+// 文件内容保存在日志存储中
+type TaskArtifact struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+
+	Step     int    `json:"step" gorm:"not null"`       // 发布产物的步骤
+	StepName string `json:"stepName" gorm:"default:''"` // 步骤名称
+	Name     string `json:"name" gorm:"not null"`       // 文件名，为相对于步骤产物目录的路径
+	Size     int    `json:"size" gorm:"default:0"`      // 文件大小
+	Path     string `json:"-" gorm:"not null"`          // 文件在日志存储中的路径
+}
+
+func (TaskArtifact) TableName() string {
+	return "iac_task_artifact"
+}
+
+func (TaskArtifact) NewId() Id {
+	return NewId("art")
+}
+
+func (a TaskArtifact) Migrate(sess *db.Session) (err error) {
+	return a.AddUniqueIndex(sess, "unique__task__step__name", "task_id", "step", "name")
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+const (
+	TaskEventCreated           = "created"           // 任务创建
+	TaskEventQueued            = "queued"            // 任务排队等待，message 为排队原因
+	TaskEventStarted           = "started"           // 任务开始执行
+	TaskEventContainerAssigned = "containerAssigned" // 任务分配到 runner 容器
+	TaskEventStepStarted       = "stepStarted"       // 步骤开始执行
+	TaskEventStepFinished      = "stepFinished"      // 步骤执行结束，status 为步骤的结束状态
+	TaskEventStepRetry         = "stepRetry"         // 步骤执行失败后自动重试，message 为失败原因及重试等待时间
+	TaskEventApprovalRequired  = "approvalRequired"  // 步骤等待审批
+	TaskEventApproved          = "approved"          // 审批人通过审批
+	TaskEventRejected          = "rejected"          // 审批人驳回
+	TaskEventDone              = "done"              // 任务结束，status 为任务的结束状态
+)
+
+// TaskEvent 任务生命周期中的事件，按时间顺序组成任务的执行时间线
+type TaskEvent struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+
+	Type     string `json:"type" gorm:"size:32;not null" enums:"created,queued,started,containerAssigned,stepStarted,stepFinished,stepRetry,approvalRequired,approved,rejected,done"`
+	Step     *int   `json:"step,omitempty" gorm:""`                       // 步骤事件对应的步骤
+	StepType string `json:"stepType,omitempty" gorm:"size:32;default:''"` // 步骤类型
+	StepName string `json:"stepName,omitempty" gorm:"default:''"`         // 步骤名称
+	Status   string `json:"status,omitempty" gorm:"size:16;default:''"`   // 事件发生后任务或步骤的状态
+	UserId   Id     `json:"userId,omitempty" gorm:"size:32;default:''"`   // 触发事件的用户，如任务创建人、审批人
+	Message  string `json:"message,omitempty" gorm:"type:text"`
+}
+
+func (TaskEvent) TableName() string {
+	return "iac_task_event"
+}
+
+func (TaskEvent) NewId() Id {
+	return NewId("tev")
+}
@@ -26,6 +26,9 @@ type Pipeline struct {
 	EnvParse PipelineTask `json:"envParse" yaml:"envParse"`
 	TplScan  PipelineTask `json:"tplScan" yaml:"tplScan"`
 	TplParse PipelineTask `json:"tplParse" yaml:"tplParse"`
+
+	// terraform import 任务
+	Import PipelineTask `json:"import" yaml:"import"`
 }
 
 func (p Pipeline) GetTask(typ string) PipelineTask {
@@ -48,6 +51,8 @@ func (p Pipeline) GetTask(typ string) PipelineTask {
 		return p.TplScan
 	case common.TaskJobTplParse:
 		return p.TplParse
+	case common.TaskJobImport:
+		return p.Import
 	default:
 		panic(fmt.Errorf("unknown pipeline job type '%s'", typ))
 	}
@@ -59,6 +64,9 @@ type PipelineTask struct {
 
 	OnSuccess *PipelineStep `json:"onSuccess,omitempty" yaml:"onSuccess"`
 	OnFail    *PipelineStep `json:"onFail,omitempty" yaml:"onFail"`
+
+	// 任务所有步骤的自动重试策略，步骤单独设置了 retry 时以步骤的设置为准
+	Retry *PipelineRetry `json:"retry,omitempty" yaml:"retry"`
 }
 
 type PipelineTaskWithType struct {
@@ -70,6 +78,32 @@ type PipelineStep struct {
 	Type string   `json:"type,omitempty" yaml:"type" gorm:"size:32;not null"`
 	Name string   `json:"name,omitempty" yaml:"name" gorm:"size:32;not null"`
 	Args StrSlice `json:"args,omitempty" yaml:"args" gorm:"type:text"`
+
+	// 步骤使用的镜像，为空时在任务容器中执行，否则 runner 使用该镜像启动独立的容器执行步骤
+	Image string `json:"image,omitempty" yaml:"image" gorm:"default:''"`
+
+	// 步骤结束后保存为作业产物的文件(相对于代码工作目录，支持通配符)，如测试报告、生成的 kubeconfig 等
+	Artifacts StrSlice `json:"artifacts,omitempty" yaml:"artifacts" gorm:"type:text"`
+
+	// 步骤因临时性错误(如网络超时、云厂商 api 限流)失败时的自动重试策略
+	Retry *PipelineRetry `json:"retry,omitempty" yaml:"retry" gorm:"type:text"`
+}
+
+// PipelineRetry 步骤自动重试策略，步骤失败且日志匹配临时性错误规则时按指数退避重试
+type PipelineRetry struct {
+	Count    int      `json:"count" yaml:"count"`                           // 最大重试次数
+	Delay    int      `json:"delay,omitempty" yaml:"delay"`                 // 首次重试前的等待时间(秒)，默认 10 秒
+	Backoff  float64  `json:"backoff,omitempty" yaml:"backoff"`             // 每次重试等待时间的增长倍数，默认 2
+	MaxDelay int      `json:"maxDelay,omitempty" yaml:"maxDelay"`           // 重试等待时间的上限(秒)，默认 300 秒
+	Patterns []string `json:"patterns,omitempty" yaml:"patterns,omitempty"` // 识别临时性错误的日志正则，为空时使用内置规则
+}
+
+func (v PipelineRetry) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *PipelineRetry) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
 }
 
 func (v PipelineTask) Value() (driver.Value, error) {
@@ -211,6 +245,17 @@ tplParse:
   steps:
     - type: scaninit
     - type: tplParse
+
+import:
+  steps:
+    - type: checkout
+      name: Checkout Code
+
+    - type: terraformInit
+      name: Terraform Init
+
+    - type: terraformImport
+      name: Terraform Import
 `
 
 const DefaultPipelineVersion = "0.4"
@@ -16,6 +16,7 @@ const (
 	TaskStepPlan     = common.TaskStepTfPlan
 	TaskStepApply    = common.TaskStepTfApply
 	TaskStepDestroy  = common.TaskStepTfDestroy
+	TaskStepImport   = common.TaskStepTfImport
 	TaskStepPlay     = common.TaskStepAnsiblePlay
 	TaskStepCommand  = common.TaskStepCommand
 	TaskStepCollect  = common.TaskStepCollect
@@ -25,6 +26,7 @@ const (
 	TaskStepTplScan  = common.TaskStepTplScan
 	TaskStepScanInit = common.TaskStepScanInit
 	TaskStepOpaScan  = common.TaskStepOpaScan
+	TaskStepValidate = common.TaskStepTfValidate
 
 	TaskStepPending   = common.TaskStepPending
 	TaskStepApproving = common.TaskStepApproving
@@ -33,6 +35,7 @@ const (
 	TaskStepFailed    = common.TaskStepFailed
 	TaskStepComplete  = common.TaskStepComplete
 	TaskStepTimeout   = common.TaskStepTimeout
+	TaskStepCancelled = common.TaskStepCancelled
 )
 
 type TaskStep struct {
@@ -45,7 +48,7 @@ type TaskStep struct {
 	TaskId    Id     `json:"taskId" gorm:"size:32;not null"`
 	NextStep  Id     `json:"nextStep" gorm:"size:32;default:''"`
 	Index     int    `json:"index" gorm:"size:32;not null"`
-	Status    string `json:"status" gorm:"type:enum('pending','approving','rejected','running','failed','complete','timeout')"`
+	Status    string `json:"status" gorm:"type:enum('pending','approving','rejected','running','failed','complete','timeout','cancelled')"`
 	ExitCode  int    `json:"exitCode" gorm:"default:0"` // 执行退出码，status 为 failed 时才有意义
 	Message   string `json:"message" gorm:"type:text"`
 	StartAt   *Time  `json:"startAt" gorm:"type:datetime"`
@@ -60,6 +63,8 @@ type TaskStep struct {
 	RetryNumber       int   `json:"retryNumber" gorm:"size:32;default:0"`       // 每个步骤可以重试的总次数
 
 	IsCallback bool `json:"isCallback" gorm:"default:0"` // 步骤是否为回调
+
+	Workdir string `json:"workdir" gorm:"default:''"` // 多工作目录云模板中步骤执行的工作目录，为空时使用任务的工作目录
 }
 
 func (TaskStep) TableName() string {
@@ -74,6 +79,9 @@ func (t *TaskStep) Migrate(sess *db.Session) (err error) {
 	if err := sess.ModifyModelColumn(t, "type"); err != nil {
 		return err
 	}
+	if err := sess.ModifyModelColumn(t, "status"); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -86,7 +94,7 @@ func (s *TaskStep) IsExited() bool {
 }
 
 func (TaskStep) IsExitedStatus(status string) bool {
-	return utils.StrInArray(status, TaskStepRejected, TaskStepComplete, TaskStepFailed, TaskStepTimeout)
+	return utils.StrInArray(status, TaskStepRejected, TaskStepComplete, TaskStepFailed, TaskStepTimeout, TaskStepCancelled)
 }
 
 // 执行成功
@@ -122,3 +130,11 @@ func (s *TaskStep) GenLogPath() string {
 		runner.TaskLogName,
 	)
 }
+
+// StatePath 返回步骤使用的 state 路径，多工作目录云模板的各工作目录在环境 state 所在目录下独立保存 state
+func (s *TaskStep) StatePath(taskStatePath string) string {
+	if s.Workdir == "" {
+		return taskStatePath
+	}
+	return path.Join(path.Dir(taskStatePath), "workdirs", s.Workdir, path.Base(taskStatePath))
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+// TaskStepAttempt 步骤自动重试前记录的失败执行，步骤最后一次执行的结果记录在步骤中
+type TaskStepAttempt struct {
+	TimedModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null;index"`
+	StepId    Id `json:"stepId" gorm:"size:32;not null"`
+
+	Step     int    `json:"step" gorm:"not null"`           // 步骤序号
+	StepName string `json:"stepName" gorm:"default:''"`     // 步骤名称
+	Attempt  int    `json:"attempt" gorm:"not null"`        // 第几次执行，从 1 开始
+	Status   string `json:"status" gorm:"size:16;not null"` // 本次执行的结束状态
+	ExitCode int    `json:"exitCode" gorm:"default:0"`      // 执行退出码
+	Pattern  string `json:"pattern" gorm:"default:''"`      // 匹配到的临时性错误规则，为空表示按环境的重试设置重试
+	Message  string `json:"message" gorm:"type:text"`       // 失败原因
+	Delay    int    `json:"delay" gorm:"default:0"`         // 下次重试前的等待时间(秒)
+	LogSize  int    `json:"-" gorm:"default:0"`             // 本次执行结束时步骤日志的长度，用于区分各次执行的日志
+	StartAt  *Time  `json:"startAt" gorm:"type:datetime"`   // 本次执行的开始时间
+	EndAt    *Time  `json:"endAt" gorm:"type:datetime"`     // 本次执行的结束时间
+}
+
+func (TaskStepAttempt) TableName() string {
+	return "iac_task_step_attempt"
+}
+
+func (TaskStepAttempt) NewId() Id {
+	return NewId("sta")
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+// TaskVarSnapshotItem 任务使用的单个变量，敏感变量只记录占位符及值的摘要
+type TaskVarSnapshotItem struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Scope     string `json:"scope"` // 变量来源，继承、覆盖计算后生效的变量所在的层级
+	Value     string `json:"value"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+	Digest    string `json:"digest,omitempty"` // 敏感变量值的摘要，用于比较值是否发生变化
+}
+
+type TaskVarSnapshotItems []TaskVarSnapshotItem
+
+func (v TaskVarSnapshotItems) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TaskVarSnapshotItems) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TaskVarSnapshot 任务创建时解析得到的完整变量集合，用于排查两次部署之间的变量差异
+type TaskVarSnapshot struct {
+	AutoUintIdModel
+
+	OrgId     Id `json:"orgId" gorm:"size:32;not null"`
+	ProjectId Id `json:"projectId" gorm:"size:32;not null"`
+	EnvId     Id `json:"envId" gorm:"size:32;not null"`
+	TaskId    Id `json:"taskId" gorm:"size:32;not null"`
+
+	TfVarsFile   string               `json:"tfVarsFile" gorm:"default:''"`
+	PlayVarsFile string               `json:"playVarsFile" gorm:"default:''"`
+	Variables    TaskVarSnapshotItems `json:"variables" gorm:"type:json"`
+}
+
+func (TaskVarSnapshot) TableName() string {
+	return "iac_task_var_snapshot"
+}
+
+func (s TaskVarSnapshot) Migrate(sess *db.Session) (err error) {
+	return s.AddUniqueIndex(sess, "unique__task__id", "task_id")
+}
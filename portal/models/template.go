@@ -4,6 +4,7 @@ package models
 
 import (
 	"cloudiac/portal/libs/db"
+	"database/sql/driver"
 
 	"github.com/lib/pq"
 )
@@ -34,20 +35,269 @@ type Template struct {
 	Workdir    string `json:"workdir" gorm:"default:''" example:"aws"` // 基于项目根目录的相对路径, 默认为空
 	TfVarsFile string `json:"tfVarsFile" gorm:"default:''"`            // Terraform 变量文件路径
 
+	// 多工作目录(mono-repo)云模板按顺序部署的工作目录(基于项目根目录的相对路径)，
+	// 设置后任务的 terraform 步骤会依次在各工作目录中执行，每个工作目录使用独立的 state
+	Workdirs pq.StringArray `json:"workdirs" gorm:"type:text" swaggertype:"array,string" example:"network,compute"`
+
 	// 要执行的 ansible playbook 文件(基于 workdir 的相对路径)
 	Playbook     string `json:"playbook" gorm:"default:''" example:"ansbile/playbook.yml"`
 	PlayVarsFile string `json:"playVarsFile" gorm:"default:''"` // Ansible 变量文件路径
 
 	LastScanTaskId Id `json:"lastScanTaskId" gorm:"size:32"` // 最后一次策略扫描任务 id
 
-	TfVersion string `json:"tfVersion" gorm:"default:''"` // 模版使用的terraform版本号
+	// 各触发方式最后一次策略扫描任务 id，避免手动扫描覆盖部署时的扫描状态
+	LastManualScanTaskId    Id `json:"lastManualScanTaskId" gorm:"size:32"`    // 最后一次手动触发的扫描任务 id
+	LastDeployScanTaskId    Id `json:"lastDeployScanTaskId" gorm:"size:32"`    // 最后一次部署时执行的扫描任务 id
+	LastScheduledScanTaskId Id `json:"lastScheduledScanTaskId" gorm:"size:32"` // 最后一次系统触发(webhook 等)的扫描任务 id
+
+	TfVersion  string `json:"tfVersion" gorm:"default:''"`                                                  // 模版使用的引擎版本号
+	EngineType string `json:"engineType" gorm:"size:16;default:'terraform'" enums:"'terraform','opentofu'"` // 模版使用的执行引擎
 
 	// 触发器设置
 	Triggers     pq.StringArray `json:"tplTriggers" gorm:"type:text" swaggertype:"array,string"` // 触发器。commit（每次推送自动部署），prmr（提交PR/MR的时候自动执行plan）
 	PolicyEnable bool           `json:"policyEnable" gorm:"default:false"`                       // 是否开启合规检测
 
+	// webhook 触发过滤，不满足条件的推送及 PR/MR 事件不触发扫描及环境的部署任务，未设置时不过滤
+	TriggerBranches    pq.StringArray `json:"triggerBranches" gorm:"type:text" swaggertype:"array,string" example:"main,release/*"` // 分支通配符，push 匹配推送分支，PR/MR 匹配源分支
+	TriggerPaths       pq.StringArray `json:"triggerPaths" gorm:"type:text" swaggertype:"array,string" example:"modules/,*.tf"`     // 变更文件通配符，以 / 结尾时匹配目录下的所有文件
+	TriggerWorkdirOnly bool           `json:"triggerWorkdirOnly" gorm:"default:false"`                                              // 只有工作目录下的文件变更时触发
+
 	KeyId Id `json:"keyId" gorm:"size:32"` // 部署密钥ID
 
+	// clone 代码使用的 SSH 部署密钥，为空时使用 vcs 配置的 clone 密钥。
+	// 直接填写仓库地址(未关联 vcs)的云模板设置该字段时 RepoAddr 需要为 SSH 地址
+	RepoKeyId Id `json:"repoKeyId" gorm:"size:32;default:''"`
+
+	// 使用该云模板创建环境及执行扫描时优先使用的 runner，未设置或不可用时按标签选择，仍未匹配时使用默认 runner
+	DefaultRunnerId string         `json:"defaultRunnerId" gorm:"size:64;default:''"`                                           // 默认 runner
+	RunnerTags      pq.StringArray `json:"runnerTags" gorm:"type:text" swaggertype:"array,string" example:"region=cn-hangzhou"` // runner 需要包含的全部标签
+
+	// 使用该云模板创建环境时的默认设置，创建环境时传入对应参数则使用环境的设置
+	DefaultCronDriftExpress string `json:"defaultCronDriftExpress" gorm:"default:''" example:"*/30 * * * *"` // 偏移检测表达式，不为空时新环境默认开启偏移检测
+	DefaultAutoRepairDrift  bool   `json:"defaultAutoRepairDrift" gorm:"default:false"`                      // 是否自动纠偏，需要同时开启自动审批
+	DefaultTTL              string `json:"defaultTTL" gorm:"default:''" example:"1d"`                        // 存活时间，为空表示不自动销毁
+	DefaultAutoApproval     bool   `json:"defaultAutoApproval" gorm:"default:false"`                         // 是否自动审批
+
+	// 引用 terraform registry 模块时不使用代码仓库，runner 会生成引用该模块的根模块
+	ModuleSource  string `json:"moduleSource" gorm:"default:''" example:"terraform-aws-modules/vpc/aws"` // registry 模块地址
+	ModuleVersion string `json:"moduleVersion" gorm:"default:''" example:"3.14.0"`                       // 模块版本，为空时使用最新版本
+
+	// webhook 状态
+	WebhookError       string `json:"webhookError" gorm:"type:text"`           // 最近一次注册 webhook 失败的原因，成功时为空
+	WebhookDeliveredAt *Time  `json:"webhookDeliveredAt" gorm:"type:datetime"` // 最近一次收到 webhook 推送的时间
+
+	// provider 依赖锁文件(.terraform.lock.hcl)检查结果，创建及更新云模板时生成
+	LockCheck *TemplateLockCheck `json:"lockCheck" gorm:"type:json"`
+
+	// 从代码仓库解析的 terraform 变量声明，用于创建环境时生成变量表单
+	VarSchema *TemplateVarSchema `json:"varSchema" gorm:"type:json"`
+
+	// 代码来源变化时新旧版本根模块配置的差异，用于在环境部署前提示不兼容的变更
+	RevisionDiff *TemplateRevisionDiff `json:"revisionDiff" gorm:"type:json"`
+
+	// 创建环境时使用的部署表单，为空时不限制环境的 terraform 变量
+	LaunchForm *TemplateLaunchForm `json:"launchForm" gorm:"type:json"`
+
+	// 外部依赖，任务开始执行前检查依赖是否可用
+	Dependencies *TemplateDependencies `json:"dependencies" gorm:"type:json"`
+
+	// 部署审批人，设置后使用该云模板的环境部署必须由其中的用户或角色审批，不受环境自动审批设置影响
+	RequiredApprovers *TemplateApprovers `json:"requiredApprovers" gorm:"type:json"`
+
+	// 按步骤类型设置的超时时间(init/plan/apply/play)，使用该云模板的环境未设置对应步骤时生效
+	StepTimeouts StepTimeouts `json:"stepTimeouts" gorm:"type:json" swaggertype:"object,integer" example:"apply:7200"`
+
+	// 云模板保存的 pipeline(yaml)，设置后优先于代码仓库中的 pipeline 文件
+	Pipeline string `json:"pipeline" gorm:"type:text"`
+
+	// 归档的云模板默认不在列表中显示，不能用于创建及部署环境，可以恢复
+	Archived   bool  `json:"archived" gorm:"default:false"`   // 是否已归档
+	ArchivedAt *Time `json:"archivedAt" gorm:"type:datetime"` // 归档时间
+
+	// 废弃的云模板仍可以部署，使用该云模板的环境会提示迁移到替代云模板
+	Deprecated      bool   `json:"deprecated" gorm:"default:false"`   // 是否已废弃
+	DeprecatedAt    *Time  `json:"deprecatedAt" gorm:"type:datetime"` // 废弃时间
+	SuccessorTplId  Id     `json:"successorTplId" gorm:"size:32"`     // 替代云模板 id
+	DeprecationNote string `json:"deprecationNote" gorm:"type:text"`  // 废弃说明
+}
+
+// TemplateProviderLock 依赖锁文件中记录的 provider 版本
+type TemplateProviderLock struct {
+	Source      string `json:"source" example:"registry.terraform.io/hashicorp/aws"`
+	Version     string `json:"version" example:"3.63.0"`     // 锁定的版本
+	Constraints string `json:"constraints" example:"~> 3.0"` // 代码中声明的版本约束
+	Pinned      bool   `json:"pinned"`                       // 版本约束是否固定为单一版本
+}
+
+type TemplateLockCheck struct {
+	LockFile  bool                   `json:"lockFile"` // 仓库工作目录下是否存在依赖锁文件
+	Providers []TemplateProviderLock `json:"providers"`
+	Warnings  []string               `json:"warnings"` // provider 未锁定版本等警告信息
+	CheckedAt Time                   `json:"checkedAt"`
+}
+
+func (v TemplateLockCheck) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateLockCheck) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TemplateVarDecl 代码中声明的 terraform 变量
+type TemplateVarDecl struct {
+	Name        string      `json:"name" example:"instance_type"`
+	Type        string      `json:"type" example:"list(string)"` // 类型约束表达式，未声明类型时为空
+	Default     interface{} `json:"default"`                     // 默认值，未声明默认值时为 null
+	Required    bool        `json:"required"`                    // 未声明默认值的变量创建环境时必须传入
+	Description string      `json:"description"`
+	Sensitive   bool        `json:"sensitive"`
+	File        string      `json:"file" example:"variables.tf"` // 声明所在文件，相对于工作目录
+}
+
+type TemplateVarSchema struct {
+	Variables   []TemplateVarDecl `json:"variables"`
+	ParseErrors []string          `json:"parseErrors"` // 解析失败的文件
+	Revision    string            `json:"revision"`    // 解析时使用的分支/标签
+	ParsedAt    Time              `json:"parsedAt"`
+}
+
+func (v TemplateVarSchema) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateVarSchema) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TemplateConfigChange 新旧版本根模块中变量、provider 或 backend 的变化
+type TemplateConfigChange struct {
+	Kind     string `json:"kind" example:"variable_added"`
+	Name     string `json:"name" example:"instance_type"` // 变量名或 provider 名称，backend 变化时为 backend 类型
+	Before   string `json:"before"`                       // 变化前的值(类型约束、版本约束等)
+	After    string `json:"after"`                        // 变化后的值
+	Required bool   `json:"required"`                     // 变量变化后是否必须传入
+	Breaking bool   `json:"breaking"`                     // 是否可能导致已有环境部署失败或资源重建
+	Message  string `json:"message"`
+}
+
+// TemplateEnvImpact 受不兼容变更影响的环境
+type TemplateEnvImpact struct {
+	EnvId    Id       `json:"envId"`
+	EnvName  string   `json:"envName"`
+	Problems []string `json:"problems"` // 环境变量在新版本中无效的原因
+}
+
+type TemplateRevisionDiff struct {
+	Before      string                 `json:"before" example:"v1.0.0"` // 变化前的分支/标签
+	After       string                 `json:"after" example:"v1.1.0"`  // 变化后的分支/标签
+	Changes     []TemplateConfigChange `json:"changes"`
+	Envs        []TemplateEnvImpact    `json:"envs"`        // 分析时受影响的环境
+	ParseErrors []string               `json:"parseErrors"` // 解析失败的文件
+	ComparedAt  Time                   `json:"comparedAt"`
+}
+
+func (v TemplateRevisionDiff) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateRevisionDiff) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+const (
+	TplEndpointHttp   = "http"
+	TplEndpointTcp    = "tcp"
+	TplEndpointConsul = "consul"
+)
+
+// TemplateDependencies 云模板声明的外部依赖
+type TemplateDependencies struct {
+	Endpoints    []TemplateEndpointDep    `json:"endpoints"`                             // 需要可访问的服务
+	Secrets      []string                 `json:"secrets" example:"ALICLOUD_ACCESS_KEY"` // 任务执行时必须配置的变量名称
+	RemoteStates []TemplateRemoteStateDep `json:"remoteStates"`                          // 引用的其他环境的 terraform state
+}
+
+type TemplateEndpointDep struct {
+	Name    string `json:"name" example:"config-center"`
+	Type    string `json:"type" enums:"http,tcp,consul"`
+	Address string `json:"address" example:"https://config.example.com/health"` // http 为 URL，tcp 为 host:port，consul 为 KV 的 key
+	Timeout int    `json:"timeout" example:"5"`                                 // 超时时间(秒)，默认 5 秒
+}
+
+type TemplateRemoteStateDep struct {
+	Name  string `json:"name" example:"network"` // terraform_remote_state 数据源名称，仅用于展示
+	EnvId Id     `json:"envId"`                  // state 所属的环境 id
+}
+
+func (v TemplateDependencies) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateDependencies) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TemplateApprovers 云模板要求的部署审批人，满足任一用户或角色即可审批，
+// 设置 MinApprovals 时需要该数量的审批人通过审批(N-of-M)
+type TemplateApprovers struct {
+	UserIds []Id     `json:"userIds"`                              // 审批用户
+	Roles   []string `json:"roles" enums:"admin,manager,approver"` // 审批角色，可以为组织角色或项目角色
+
+	MinApprovals int `json:"minApprovals" example:"2"` // 需要通过审批的人数，默认为 1
+}
+
+// IsEmpty 是否未设置审批人
+func (v *TemplateApprovers) IsEmpty() bool {
+	return v == nil || (len(v.UserIds) == 0 && len(v.Roles) == 0)
+}
+
+func (v TemplateApprovers) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateApprovers) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TemplateLaunchForm 云模板部署表单，格式为 JSON Schema(object 类型)，
+// 每个属性对应一个 terraform 变量，x- 开头的字段为扩展定义，用于分组、条件显示及默认值推导
+type TemplateLaunchForm struct {
+	Type       string                     `json:"type" example:"object"`
+	Required   []string                   `json:"required,omitempty"` // 必填的字段
+	Properties map[string]LaunchFormField `json:"properties"`         // 表单字段，key 为 terraform 变量名称
+	Groups     []LaunchFormGroup          `json:"x-groups,omitempty"` // 字段分组，按顺序展示
+}
+
+type LaunchFormGroup struct {
+	Name  string `json:"name" example:"network"`
+	Title string `json:"title" example:"网络配置"`
+}
+
+type LaunchFormField struct {
+	Type        string   `json:"type" enums:"string,number,integer,boolean"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Default     *string  `json:"default,omitempty"`
+	Enum        []string `json:"enum,omitempty"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Minimum     *float64 `json:"minimum,omitempty"`
+	Maximum     *float64 `json:"maximum,omitempty"`
+	MinLength   int      `json:"minLength,omitempty"`
+	MaxLength   int      `json:"maxLength,omitempty"`
+
+	Group       string            `json:"x-group,omitempty"`                                 // 所属分组
+	Order       int               `json:"x-order,omitempty"`                                 // 展示顺序
+	VisibleIf   map[string]string `json:"x-visible-if,omitempty" swaggertype:"object"`       // 其他字段的值均满足条件时才显示，隐藏的字段不会作为变量传入
+	DefaultFrom string            `json:"x-default-from,omitempty" example:"${project}-vpc"` // 未传值时由其他字段的值生成默认值，${name} 引用其他字段
+}
+
+func (v TemplateLaunchForm) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateLaunchForm) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
 }
 
 func (Template) TableName() string {
@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// TemplateLabel 云模板标签，用于云模板的分类及筛选
+type TemplateLabel struct {
+	TimedModel
+
+	OrgId Id     `json:"orgId" gorm:"size:32;not null"`
+	TplId Id     `json:"tplId" gorm:"size:32;not null"`
+	Key   string `json:"key" gorm:"column:label_key;size:64;not null;comment:标签名称" example:"team"` // 标签名称
+	Value string `json:"value" gorm:"column:label_value;not null;comment:标签值" example:"payments"`  // 标签值
+}
+
+func (TemplateLabel) TableName() string {
+	return "iac_template_label"
+}
+
+func (l *TemplateLabel) CustomBeforeCreate(*db.Session) error {
+	if l.Id == "" {
+		l.Id = NewId("tpll")
+	}
+	return nil
+}
+
+func (l TemplateLabel) Migrate(sess *db.Session) (err error) {
+	return l.AddUniqueIndex(sess, "unique__tpl__label_key", "tpl_id", "label_key")
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+const (
+	TplRevisionInit     = "init"     // 首次记录修订时保存的修改前状态
+	TplRevisionUpdate   = "update"   // 更新云模板
+	TplRevisionRollback = "rollback" // 回滚到历史修订
+)
+
+// TemplateAttrChange 云模板属性的变更内容
+type TemplateAttrChange struct {
+	Attr string      `json:"attr" example:"workdir"`   // 属性名称
+	Old  interface{} `json:"old" swaggertype:"string"` // 修改前的值
+	New  interface{} `json:"new" swaggertype:"string"` // 修改后的值
+}
+
+type TemplateAttrChanges []TemplateAttrChange
+
+func (v TemplateAttrChanges) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateAttrChanges) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TemplateSnapshot 修订后云模板被记录的属性值，以属性名称索引
+type TemplateSnapshot map[string]interface{}
+
+func (v TemplateSnapshot) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *TemplateSnapshot) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// TemplateRevision 云模板修订记录，每次更新云模板生成一个修订
+type TemplateRevision struct {
+	TimedModel
+
+	OrgId        Id                  `json:"orgId" gorm:"size:32;not null"`
+	TplId        Id                  `json:"tplId" gorm:"size:32;not null;index"`
+	Revision     int                 `json:"revision" gorm:"not null;comment:修订号" example:"1"`                                                       // 修订号，从 1 开始递增
+	Action       string              `json:"action" gorm:"type:enum('init','update','rollback');not null;comment:修订类型" enums:"init,update,rollback"` // 修订类型
+	BaseRevision int                 `json:"baseRevision" gorm:"default:0;comment:回滚的目标修订号"`                                                         // 回滚时的目标修订号
+	CreatorId    Id                  `json:"creatorId" gorm:"size:32;comment:修改人"`
+	Changes      TemplateAttrChanges `json:"changes" gorm:"type:json;comment:变更的属性"`                        // 相对上一修订变更的属性
+	Snapshot     TemplateSnapshot    `json:"snapshot" gorm:"type:json;comment:修订后的属性" swaggertype:"object"` // 修订后云模板被记录的属性值
+}
+
+func (TemplateRevision) TableName() string {
+	return "iac_template_revision"
+}
+
+func (r *TemplateRevision) CustomBeforeCreate(*db.Session) error {
+	if r.Id == "" {
+		r.Id = NewId("tplr")
+	}
+	return nil
+}
+
+func (r TemplateRevision) Migrate(sess *db.Session) (err error) {
+	return r.AddUniqueIndex(sess, "unique__tpl__revision", "tpl_id", "revision")
+}
@@ -7,9 +7,9 @@ import "cloudiac/portal/libs/db"
 type UserOrg struct {
 	BaseModel
 
-	UserId Id     `json:"userId" gorm:"size:32;not null;comment:用户ID"`                                  // 用户ID
-	OrgId  Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`                                   // 组织ID
-	Role   string `json:"role" gorm:"type:enum('admin','complianceManager','member');default:'member'"` // 角色
+	UserId Id     `json:"userId" gorm:"size:32;not null;comment:用户ID"`                                            // 用户ID
+	OrgId  Id     `json:"orgId" gorm:"size:32;not null;comment:组织ID"`                                             // 组织ID
+	Role   string `json:"role" gorm:"type:enum('admin','complianceManager','member','auditor');default:'member'"` // 角色
 }
 
 func (UserOrg) TableName() string {
@@ -21,6 +21,10 @@ func (m UserOrg) Migrate(sess *db.Session) (err error) {
 	if err != nil {
 		return err
 	}
+	// 新增角色后需要修改 enum 定义
+	if err = sess.ModifyModelColumn(&UserOrg{}, "role"); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,23 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import "cloudiac/portal/libs/db"
+
+// UserTemplate 用户对云模板的个人标记，包括收藏及最近使用时间
+type UserTemplate struct {
+	BaseModel
+
+	UserId     Id    `json:"userId" gorm:"size:32;not null;comment:用户ID"`    // 用户ID
+	TplId      Id    `json:"tplId" gorm:"size:32;not null;comment:云模板ID"`    // 云模板ID
+	Favorite   bool  `json:"favorite" gorm:"default:false;comment:是否收藏"`     // 是否收藏
+	LastUsedAt *Time `json:"lastUsedAt" gorm:"type:datetime;comment:最近使用时间"` // 最近一次使用该云模板创建或部署环境的时间
+}
+
+func (UserTemplate) TableName() string {
+	return "iac_user_template"
+}
+
+func (m UserTemplate) Migrate(sess *db.Session) (err error) {
+	return m.AddUniqueIndex(sess, "unique__user_id__tpl_id", "user_id", "tpl_id")
+}
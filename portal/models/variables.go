@@ -57,6 +57,10 @@ type VariableGroup struct {
 	CreatorId Id                `json:"creatorId" gorm:"size:32;not null;comment:创建人" example:"u-c3ek0co6n88ldvq1n6ag"`
 	OrgId     Id                `json:"orgId" gorm:"size:32;not null"`
 	Variables VarGroupVariables `json:"variables" gorm:"type:json;null;comment:变量组下的变量"`
+
+	// 共享范围，为空时不限制。设置后只有指定项目/云模板下的环境可以使用该变量组
+	ShareProjects  StrSlice `json:"shareProjects" gorm:"type:json;null;comment:共享的项目"`
+	ShareTemplates StrSlice `json:"shareTemplates" gorm:"type:json;null;comment:共享的云模板"`
 }
 
 func (VariableGroup) TableName() string {
@@ -13,8 +13,14 @@ const (
 	VcsGitea  = common.VcsGitea
 	VcsGitee  = common.VcsGitee
 	VcsGithub = common.VcsGithub
+	// bitbucket 同时支持 cloud(bitbucket.org)及自部署的 server 版本
+	VcsBitbucket = common.VcsBitbucket
 	// git clone 鉴权时使用的user 默认为token
 	RepoUser = "token"
+
+	VcsAuthToken     = "token"     // 使用静态 token 访问代码仓库
+	VcsAuthOauth     = "oauth"     // 使用 OAuth 应用的用户授权访问代码仓库(github/gitlab)
+	VcsAuthGithubApp = "githubApp" // 使用 GitHub App 安装的授权访问代码仓库
 )
 
 type Vcs struct {
@@ -26,6 +32,22 @@ type Vcs struct {
 	VcsType   string `json:"vcsType" gorm:"not null;comment:vcs代码库类型"`
 	Address   string `json:"address" gorm:"not null;comment:vcs代码库地址"`
 	VcsToken  string `json:"vcsToken" gorm:"not null; comment:代码库的token值"`
+
+	AuthType string `json:"authType" gorm:"size:16;default:'token'"` // 认证方式: token/oauth/githubApp
+
+	// OAuth 应用配置，GitHub App 的用户授权同样使用 app 的 client id 及 secret
+	OauthClientId     string `json:"oauthClientId" gorm:"size:128;default:''"`
+	OauthClientSecret string `json:"-" gorm:"type:text"` // 加密保存
+	// 后台操作(webhook、部署任务等)没有用户上下文，使用该用户的授权访问代码仓库，默认为第一个完成授权的用户
+	OauthUserId Id `json:"oauthUserId" gorm:"size:32;default:''"`
+
+	// GitHub App 配置，使用安装的授权访问代码仓库，可访问的仓库范围由安装时选择的仓库决定
+	GithubAppId         int64  `json:"githubAppId" gorm:"default:0"`
+	GithubAppPrivateKey string `json:"-" gorm:"type:text"` // 加密保存
+	InstallationId      int64  `json:"installationId" gorm:"default:0"`
+
+	// 任务 clone 代码时使用 SSH 地址及该部署密钥，为空时使用 https 地址及 token。仓库列表、分支等接口仍使用 token 访问
+	CloneKeyId Id `json:"cloneKeyId" gorm:"size:32;default:''"`
 }
 
 func (Vcs) TableName() string {
@@ -47,6 +69,35 @@ func (v *Vcs) DecryptToken() (string, error) {
 	return utils.DecryptSecretVar(v.VcsToken)
 }
 
+// UseOauth 是否使用 OAuth 或 GitHub App 授权访问代码仓库
+func (v *Vcs) UseOauth() bool {
+	return v.AuthType == VcsAuthOauth || v.AuthType == VcsAuthGithubApp
+}
+
+// VcsOauthToken 用户对 OAuth vcs 的授权 token
+type VcsOauthToken struct {
+	TimedModel
+
+	VcsId        Id     `json:"vcsId" gorm:"size:32;not null"`
+	UserId       Id     `json:"userId" gorm:"size:32;not null"`
+	Login        string `json:"login" gorm:"size:128;default:''"` // 用户在代码仓库中的登录名
+	AccessToken  string `json:"-" gorm:"type:text"`               // 加密保存
+	RefreshToken string `json:"-" gorm:"type:text"`               // 加密保存
+	ExpiresAt    *Time  `json:"expiresAt" gorm:"type:datetime"`   // 为空表示不过期
+}
+
+func (VcsOauthToken) TableName() string {
+	return "iac_vcs_oauth_token"
+}
+
+func (VcsOauthToken) NewId() Id {
+	return NewId("vot")
+}
+
+func (t VcsOauthToken) Migrate(sess *db.Session) (err error) {
+	return t.AddUniqueIndex(sess, "unique__vcs_user", "vcs_id", "user_id")
+}
+
 type VcsPr struct {
 	AutoUintIdModel
 
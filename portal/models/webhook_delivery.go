@@ -0,0 +1,81 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package models
+
+import (
+	"cloudiac/portal/libs/db"
+	"database/sql/driver"
+)
+
+const (
+	WebhookDeliverySuccess = "success" // 处理完成，是否触发任务见处理结果
+	WebhookDeliveryFailed  = "failed"
+
+	WebhookResultTriggered = "triggered" // 创建了任务
+	WebhookResultSkipped   = "skipped"   // 不满足触发条件
+	WebhookResultFailed    = "failed"    // 创建任务失败
+)
+
+// WebhookDeliveryResult webhook 对单个云模板或环境的处理结果
+type WebhookDeliveryResult struct {
+	TplId    Id     `json:"tplId" example:"tpl-c3lcrjxczjdywmk0go90"`
+	EnvId    Id     `json:"envId,omitempty" example:"env-c3lcrjxczjdywmk0go90"` // 为空表示云模板的处理结果(如触发分支不匹配、云模板扫描)
+	TaskId   Id     `json:"taskId,omitempty" example:"run-c3lcrjxczjdywmk0go90"`
+	TaskType string `json:"taskType,omitempty" example:"apply"`
+	Status   string `json:"status" enums:"triggered,skipped,failed"`
+	Message  string `json:"message,omitempty"` // 跳过原因或错误信息
+}
+
+type WebhookDeliveryResults []WebhookDeliveryResult
+
+func (v WebhookDeliveryResults) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *WebhookDeliveryResults) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+type WebhookDeliveryHeaders map[string]string
+
+func (v WebhookDeliveryHeaders) Value() (driver.Value, error) {
+	return MarshalValue(v)
+}
+
+func (v *WebhookDeliveryHeaders) Scan(value interface{}) error {
+	return UnmarshalValue(value, v)
+}
+
+// WebhookDelivery 代码仓库 webhook 的投递记录，用于排查推送未触发部署的原因及重放请求
+type WebhookDelivery struct {
+	TimedModel
+
+	OrgId  Id     `json:"orgId" gorm:"size:32;not null;default:''"` // vcs 所属组织，系统默认 vcs 为空
+	VcsId  Id     `json:"vcsId" gorm:"size:32;not null;index:idx_vcs_repo"`
+	RepoId string `json:"repoId" gorm:"size:255;not null;default:'';index:idx_vcs_repo"`
+
+	Event    string `json:"event" gorm:"size:64;default:'';comment:事件类型" example:"push"`
+	Ref      string `json:"ref" gorm:"size:255;default:'';comment:push 分支或 PR 源分支"`
+	CommitId string `json:"commitId" gorm:"size:64;default:''"`
+
+	Headers WebhookDeliveryHeaders `json:"headers,omitempty" gorm:"type:json;comment:请求头(已隐藏认证信息)"`
+	Payload string                 `json:"payload,omitempty" gorm:"type:mediumtext;comment:请求内容"`
+
+	Status  string                 `json:"status" gorm:"size:16;not null" enums:"success,failed"`
+	Error   string                 `json:"error" gorm:"type:text"`
+	Results WebhookDeliveryResults `json:"results" gorm:"type:json;comment:各云模板及环境的处理结果"`
+
+	ReplayOf  Id `json:"replayOf" gorm:"size:32;default:'';comment:重放的投递记录 id"`
+	CreatorId Id `json:"creatorId" gorm:"size:32;default:'';comment:重放操作人，代码仓库推送时为空"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "iac_webhook_delivery"
+}
+
+func (d *WebhookDelivery) CustomBeforeCreate(*db.Session) error {
+	if d.Id == "" {
+		d.Id = NewId("whd")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	redactedMask = "******"
+	// 过短的敏感值替换后会导致日志无法阅读，不做替换
+	redactMinLength = 4
+)
+
+// UserIsOrgAuditor 用户是否为组织的审计员
+func UserIsOrgAuditor(userId models.Id, orgId models.Id) bool {
+	// UserHasOrgRole 对系统用户总是返回 true，这里需要单独判断
+	if userId.String() == consts.SysUserId {
+		return false
+	}
+	userOrg := getUserOrgs(userId)[orgId]
+	return userOrg != nil && userOrg.Role == consts.OrgRoleAuditor
+}
+
+// ReportWatermark 审计员导出的报表中附加的导出人信息
+type ReportWatermark struct {
+	UserId     models.Id   `json:"userId"`
+	UserName   string      `json:"userName"`
+	Email      string      `json:"email"`
+	Role       string      `json:"role"`
+	ExportedAt models.Time `json:"exportedAt"`
+}
+
+// NewReportWatermark 生成审计员导出报表的水印，非审计员返回 nil
+func NewReportWatermark(query *db.Session, userId models.Id, orgId models.Id) (*ReportWatermark, e.Error) {
+	if !UserIsOrgAuditor(userId, orgId) {
+		return nil, nil
+	}
+	user, err := GetUserById(query, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &ReportWatermark{
+		UserId:     user.Id,
+		UserName:   user.Name,
+		Email:      user.Email,
+		Role:       consts.OrgRoleAuditor,
+		ExportedAt: models.Time(time.Now()),
+	}, nil
+}
+
+// LogRedactor 将日志中出现的敏感变量值替换为掩码
+type LogRedactor struct {
+	replacer *strings.Replacer
+}
+
+// NewLogRedactor 根据任务变量生成日志脱敏器，没有敏感变量时返回 nil
+func NewLogRedactor(vars []models.VariableBody) *LogRedactor {
+	secrets := make([]string, 0)
+	for _, v := range vars {
+		if !v.Sensitive {
+			continue
+		}
+		val, err := utils.DecryptSecretVar(v.Value)
+		if err != nil || len(val) < redactMinLength {
+			continue
+		}
+		secrets = append(secrets, val)
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	// 优先替换较长的值，避免值之间互相包含时替换不完整
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	oldnew := make([]string, 0, len(secrets)*2)
+	for _, s := range secrets {
+		oldnew = append(oldnew, s, redactedMask)
+	}
+	return &LogRedactor{replacer: strings.NewReplacer(oldnew...)}
+}
+
+func (r *LogRedactor) Redact(s string) string {
+	if r == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// MaskExportedSecrets 清除导出数据中的敏感信息，用于审计员导出
+func MaskExportedSecrets(data *TplExportedData) {
+	for i := range data.Templates {
+		data.Templates[i].RepoToken = ""
+		for j, v := range data.Templates[i].Variables {
+			if v.Sensitive {
+				data.Templates[i].Variables[j].Value = ""
+			}
+		}
+	}
+	for i := range data.Vcs {
+		data.Vcs[i].VcsToken = ""
+	}
+	for i := range data.VarGroups {
+		for j, v := range data.VarGroups[i].Variables {
+			if v.Sensitive {
+				data.VarGroups[i].Variables[j].Value = ""
+			}
+		}
+	}
+}
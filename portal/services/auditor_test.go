@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestLogRedactor(t *testing.T) {
+	vars := []models.VariableBody{
+		{Name: "password", Value: "p@ssw0rd", Sensitive: true},
+		{Name: "password_prefix", Value: "p@ss", Sensitive: true},
+		{Name: "short", Value: "ab", Sensitive: true},
+		{Name: "region", Value: "cn-hangzhou"},
+	}
+	r := NewLogRedactor(vars)
+	got := r.Redact("login with p@ssw0rd and p@ss in cn-hangzhou, ab")
+	expect := "login with ****** and ****** in cn-hangzhou, ab"
+	if got != expect {
+		t.Errorf("expect %q, got %q", expect, got)
+	}
+
+	if r := NewLogRedactor(vars[3:]); r != nil || r.Redact("cn-hangzhou") != "cn-hangzhou" {
+		t.Errorf("redactor without sensitive variables should not change log")
+	}
+}
+
+func TestMaskExportedSecrets(t *testing.T) {
+	data := &TplExportedData{
+		Templates: []exportedTpl{{
+			RepoToken: "token",
+			Variables: []exportedTplVar{
+				{Name: "a", Value: "secret", Sensitive: true},
+				{Name: "b", Value: "plain"},
+			},
+		}},
+		Vcs: []exportedVcs{{VcsToken: "token"}},
+		VarGroups: []exportedVarGroup{{
+			Variables: []models.VarGroupVariable{{Name: "c", Value: "secret", Sensitive: true}},
+		}},
+	}
+	MaskExportedSecrets(data)
+	tpl := data.Templates[0]
+	if tpl.RepoToken != "" || tpl.Variables[0].Value != "" || tpl.Variables[1].Value != "plain" {
+		t.Errorf("template secrets not masked: %+v", tpl)
+	}
+	if data.Vcs[0].VcsToken != "" || data.VarGroups[0].Variables[0].Value != "" {
+		t.Errorf("vcs or var group secrets not masked: %+v", data)
+	}
+}
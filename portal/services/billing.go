@@ -0,0 +1,306 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/models/forms"
+	"cloudiac/portal/services/billing"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// 资源上携带该标签时，即使资源 id 未能匹配也会将费用归属到对应环境
+	BillingEnvTagKey = "cloudiac_env_id"
+)
+
+// 各账单来源从资源账号中读取的凭证变量名
+var billingCredentialKeys = map[string][2]string{
+	billing.ProviderAlicloudBss: {"ALICLOUD_ACCESS_KEY", "ALICLOUD_SECRET_KEY"},
+	billing.ProviderAwsCur:      {"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"},
+}
+
+func CreateBillingConnector(tx *db.Session, c models.BillingConnector) (*models.BillingConnector, e.Error) {
+	if c.Id == "" {
+		c.Id = c.NewId()
+	}
+	if err := models.Create(tx, &c); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.NameDuplicate, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &c, nil
+}
+
+func UpdateBillingConnector(tx *db.Session, id models.Id, attrs models.Attrs) (*models.BillingConnector, e.Error) {
+	c := &models.BillingConnector{}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.BillingConnector{}, attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.NameDuplicate, err)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("update billing connector error: %v", err))
+	}
+	if err := tx.Where("id = ?", id).First(c); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("query billing connector error: %v", err))
+	}
+	return c, nil
+}
+
+func DeleteBillingConnector(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("connector_id = ?", id).Delete(&models.BillingRecord{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete billing records error: %v", err))
+	}
+	if _, err := tx.Where("id = ?", id).Delete(&models.BillingConnector{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete billing connector error: %v", err))
+	}
+	return nil
+}
+
+func GetBillingConnectorById(query *db.Session, id models.Id) (*models.BillingConnector, e.Error) {
+	c := models.BillingConnector{}
+	if err := query.Where("id = ?", id).First(&c); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.BillingConnectorNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &c, nil
+}
+
+func QueryBillingConnector(query *db.Session) *db.Session {
+	return query.Model(&models.BillingConnector{})
+}
+
+// GetDueBillingConnectors 查询到达同步时间的连接器
+func GetDueBillingConnectors(query *db.Session, now time.Time) ([]*models.BillingConnector, e.Error) {
+	cs := make([]*models.BillingConnector, 0)
+	if err := query.Model(&models.BillingConnector{}).
+		Where("enabled = ? AND (next_sync_at IS NULL OR next_sync_at <= ?)", true, now).
+		Find(&cs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return cs, nil
+}
+
+func newBillingConnector(query *db.Session, c *models.BillingConnector) (billing.Connector, e.Error) {
+	keys, ok := billingCredentialKeys[c.Provider]
+	if !ok {
+		return nil, e.New(e.BillingProviderInvalid, fmt.Errorf("unsupported provider '%s'", c.Provider))
+	}
+
+	account, er := GetResourceAccountById(query.Where("org_id = ?", c.OrgId), c.ResourceAccountId)
+	if er != nil {
+		return nil, er
+	}
+	params := make([]forms.Params, 0)
+	if !account.Params.IsNull() {
+		if err := json.Unmarshal(account.Params, &params); err != nil {
+			return nil, e.New(e.JSONParseError, err)
+		}
+	}
+
+	cred := billing.Credential{}
+	for _, p := range params {
+		value := p.Value
+		if p.IsSecret != nil && *p.IsSecret {
+			var err error
+			if value, err = utils.AesDecrypt(value); err != nil {
+				return nil, e.New(e.DecryptError, err)
+			}
+		}
+		switch p.Key {
+		case keys[0]:
+			cred.AccessKeyId = value
+		case keys[1]:
+			cred.AccessKeySecret = value
+		}
+	}
+
+	opts := billing.Options{}
+	if !c.Options.IsNull() {
+		if err := json.Unmarshal(c.Options, &opts); err != nil {
+			return nil, e.New(e.JSONParseError, err)
+		}
+	}
+
+	connector, err := billing.New(c.Provider, cred, opts)
+	if err != nil {
+		return nil, e.New(e.BadParam, err)
+	}
+	return connector, nil
+}
+
+type billingMatchedResource struct {
+	Id        models.Id
+	ProjectId models.Id
+	EnvId     models.Id
+	Address   string
+	Attrs     models.ResAttrs
+}
+
+// ReconcileBillingRecords 将账单明细与组织下各环境当前的资源列表进行对账，
+// 优先通过资源 id/arn 匹配，其次通过 BillingEnvTagKey 标签匹配到环境
+func ReconcileBillingRecords(query *db.Session, connector *models.BillingConnector,
+	records []billing.Record) ([]models.BillingRecord, e.Error) {
+	resources := make([]billingMatchedResource, 0)
+	if err := query.Table("iac_resource AS r").
+		Joins("JOIN iac_env ON iac_env.last_res_task_id = r.task_id AND iac_env.deleted_at_t = 0").
+		Where("r.org_id = ?", connector.OrgId).
+		Select("r.id, r.project_id, r.env_id, r.address, r.attrs").
+		Scan(&resources); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	resMap := make(map[string]*billingMatchedResource, len(resources))
+	for i := range resources {
+		for _, k := range []string{"id", "arn"} {
+			if v, ok := resources[i].Attrs[k].(string); ok && v != "" {
+				resMap[v] = &resources[i]
+			}
+		}
+	}
+
+	envs := make([]models.Env, 0)
+	if err := query.Model(&models.Env{}).Where("org_id = ?", connector.OrgId).
+		Select("id, project_id").Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	envProject := make(map[models.Id]models.Id, len(envs))
+	for _, env := range envs {
+		envProject[env.Id] = env.ProjectId
+	}
+
+	now := models.Time(time.Now())
+	rs := make([]models.BillingRecord, 0, len(records))
+	for _, r := range records {
+		tags := models.ResAttrs{}
+		for k, v := range r.Tags {
+			tags[k] = v
+		}
+		br := models.BillingRecord{
+			OrgId:           connector.OrgId,
+			ConnectorId:     connector.Id,
+			Provider:        connector.Provider,
+			BillingCycle:    r.BillingCycle,
+			CloudResourceId: r.ResourceId,
+			ProductCode:     r.ProductCode,
+			Region:          r.Region,
+			Cost:            r.Cost,
+			Currency:        r.Currency,
+			Tags:            tags,
+			CreatedAt:       now,
+		}
+		if res, ok := resMap[r.ResourceId]; ok {
+			br.Managed = true
+			br.ProjectId = res.ProjectId
+			br.EnvId = res.EnvId
+			br.ResourceId = res.Id
+			br.Address = res.Address
+		} else if envId := models.Id(r.Tags[BillingEnvTagKey]); envId != "" {
+			if projectId, ok := envProject[envId]; ok {
+				br.Managed = true
+				br.ProjectId = projectId
+				br.EnvId = envId
+			}
+		}
+		rs = append(rs, br)
+	}
+	return rs, nil
+}
+
+// SyncBillingConnector 拉取账期账单并对账，同一账期重复导入时会替换之前导入的记录
+func SyncBillingConnector(sess *db.Session, c *models.BillingConnector, cycle string) (int, e.Error) {
+	logger := logs.Get().WithField("func", "SyncBillingConnector").WithField("connectorId", c.Id)
+
+	count, er := func() (int, e.Error) {
+		connector, er := newBillingConnector(sess, c)
+		if er != nil {
+			return 0, er
+		}
+		records, err := connector.FetchRecords(cycle)
+		if err != nil {
+			return 0, e.New(e.BillingSyncFailed, err)
+		}
+		brs, er := ReconcileBillingRecords(sess, c, records)
+		if er != nil {
+			return 0, er
+		}
+
+		err = sess.Transaction(func(tx *db.Session) error {
+			if _, err := tx.Where("connector_id = ? AND billing_cycle = ?", c.Id, cycle).
+				Delete(&models.BillingRecord{}); err != nil {
+				return err
+			}
+			if len(brs) == 0 {
+				return nil
+			}
+			return models.CreateBatch(tx, brs)
+		})
+		if err != nil {
+			return 0, e.New(e.DBError, err)
+		}
+		return len(brs), nil
+	}()
+
+	interval := c.SyncInterval
+	if interval <= 0 {
+		interval = 24
+	}
+	now := time.Now()
+	attrs := models.Attrs{
+		"last_sync_at":     now,
+		"last_sync_status": models.BillingSyncSuccess,
+		"last_sync_error":  "",
+		"next_sync_at":     now.Add(time.Duration(interval) * time.Hour),
+	}
+	if er != nil {
+		logger.Errorf("sync billing cycle %s error: %v", cycle, er)
+		attrs["last_sync_status"] = models.BillingSyncFailed
+		attrs["last_sync_error"] = er.Error()
+	}
+	if _, err := UpdateBillingConnector(sess, c.Id, attrs); err != nil {
+		logger.Errorf("update billing connector error: %v", err)
+	}
+	return count, er
+}
+
+type BillingCostItem struct {
+	ProjectId   models.Id `json:"projectId"`
+	ProjectName string    `json:"projectName"`
+	EnvId       models.Id `json:"envId"`
+	EnvName     string    `json:"envName"`
+	Currency    string    `json:"currency"`
+	Cost        float64   `json:"cost"`
+	Resources   int       `json:"resources"`
+}
+
+// BillingCostByEnv 按环境汇总已匹配的账单费用
+func BillingCostByEnv(query *db.Session, orgId models.Id, cycle string) ([]BillingCostItem, e.Error) {
+	items := make([]BillingCostItem, 0)
+	if err := query.Table("iac_billing_record AS br").
+		Joins("LEFT JOIN iac_project AS p ON p.id = br.project_id").
+		Joins("LEFT JOIN iac_env AS env ON env.id = br.env_id").
+		Where("br.org_id = ? AND br.billing_cycle = ? AND br.managed = ?", orgId, cycle, true).
+		Group("br.project_id, br.env_id, br.currency, p.name, env.name").
+		Select("br.project_id, p.name AS project_name, br.env_id, env.name AS env_name, br.currency, " +
+			"SUM(br.cost) AS cost, COUNT(*) AS resources").
+		Order("cost DESC").
+		Scan(&items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return items, nil
+}
+
+// QueryUnmanagedBillingRecords 查询未被 CloudIaC 管理的资源产生的费用明细
+func QueryUnmanagedBillingRecords(query *db.Session, orgId models.Id, cycle string) *db.Session {
+	return query.Model(&models.BillingRecord{}).
+		Where("org_id = ? AND billing_cycle = ? AND managed = ?", orgId, cycle, false).
+		Order("cost DESC")
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package billing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	alicloudBssEndpoint = "https://business.aliyuncs.com/"
+	alicloudBssVersion  = "2017-12-14"
+	alicloudBssPageSize = 300
+)
+
+type alicloudBss struct {
+	client *http.Client
+	cred   Credential
+}
+
+type alicloudBillItem struct {
+	InstanceID   string  `json:"InstanceID"`
+	ProductCode  string  `json:"ProductCode"`
+	Region       string  `json:"Region"`
+	PretaxAmount float64 `json:"PretaxAmount"`
+	Currency     string  `json:"Currency"`
+	Tag          string  `json:"Tag"`
+}
+
+type alicloudBillResp struct {
+	Code    string `json:"Code"`
+	Message string `json:"Message"`
+	Success bool   `json:"Success"`
+	Data    struct {
+		TotalCount int `json:"TotalCount"`
+		Items      struct {
+			Item []alicloudBillItem `json:"Item"`
+		} `json:"Items"`
+	} `json:"Data"`
+}
+
+// FetchRecords 通过 QueryInstanceBill 接口分页拉取实例账单
+func (a *alicloudBss) FetchRecords(cycle string) ([]Record, error) {
+	records := make(map[string]*Record)
+	for page := 1; ; page++ {
+		resp, err := a.queryInstanceBill(cycle, page)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range resp.Data.Items.Item {
+			// 同一实例在一个账期内可能有多条账单(如按量+包年包月)，按实例汇总
+			key := item.InstanceID + "/" + item.ProductCode
+			if r, ok := records[key]; ok {
+				r.Cost += item.PretaxAmount
+				continue
+			}
+			records[key] = &Record{
+				ResourceId:   item.InstanceID,
+				ProductCode:  item.ProductCode,
+				Region:       item.Region,
+				Cost:         item.PretaxAmount,
+				Currency:     item.Currency,
+				BillingCycle: cycle,
+				Tags:         parseAlicloudTags(item.Tag),
+			}
+		}
+		if page*alicloudBssPageSize >= resp.Data.TotalCount {
+			break
+		}
+	}
+
+	rs := make([]Record, 0, len(records))
+	for _, r := range records {
+		rs = append(rs, *r)
+	}
+	return rs, nil
+}
+
+func (a *alicloudBss) queryInstanceBill(cycle string, page int) (*alicloudBillResp, error) {
+	params := url.Values{}
+	params.Set("Action", "QueryInstanceBill")
+	params.Set("BillingCycle", cycle)
+	params.Set("PageNum", strconv.Itoa(page))
+	params.Set("PageSize", strconv.Itoa(alicloudBssPageSize))
+	params.Set("Format", "JSON")
+	params.Set("Version", alicloudBssVersion)
+	params.Set("AccessKeyId", a.cred.AccessKeyId)
+	params.Set("SignatureMethod", "HMAC-SHA1")
+	params.Set("SignatureVersion", "1.0")
+	params.Set("SignatureNonce", signatureNonce())
+	params.Set("Timestamp", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	params.Set("Signature", alicloudRpcSign(http.MethodGet, params, a.cred.AccessKeySecret))
+
+	res, err := a.client.Get(alicloudBssEndpoint + "?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := alicloudBillResp{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("unmarshal response: %v", err)
+	}
+	if res.StatusCode != http.StatusOK || !resp.Success {
+		return nil, fmt.Errorf("query instance bill: %s %s", resp.Code, resp.Message)
+	}
+	return &resp, nil
+}
+
+func signatureNonce() string {
+	bs := make([]byte, 16)
+	if _, err := rand.Read(bs); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return hex.EncodeToString(bs)
+}
+
+// alicloudPercentEncode 按阿里云 RPC 签名规范进行编码
+func alicloudPercentEncode(s string) string {
+	s = url.QueryEscape(s)
+	s = strings.Replace(s, "+", "%20", -1)
+	s = strings.Replace(s, "*", "%2A", -1)
+	s = strings.Replace(s, "%7E", "~", -1)
+	return s
+}
+
+func alicloudRpcSign(method string, params url.Values, secret string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, alicloudPercentEncode(k)+"="+alicloudPercentEncode(params.Get(k)))
+	}
+	strToSign := method + "&" + alicloudPercentEncode("/") + "&" + alicloudPercentEncode(strings.Join(pairs, "&"))
+
+	mac := hmac.New(sha1.New, []byte(secret+"&"))
+	mac.Write([]byte(strToSign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseAlicloudTags 解析账单中的标签字段，格式为 "key:k1 value:v1; key:k2 value:v2"
+func parseAlicloudTags(s string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ";") {
+		pair = strings.TrimSpace(pair)
+		if !strings.HasPrefix(pair, "key:") {
+			continue
+		}
+		idx := strings.Index(pair, " value:")
+		if idx == -1 {
+			tags[strings.TrimPrefix(pair, "key:")] = ""
+			continue
+		}
+		tags[pair[len("key:"):idx]] = pair[idx+len(" value:"):]
+	}
+	return tags
+}
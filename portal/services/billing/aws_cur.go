@@ -0,0 +1,185 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package billing
+
+import (
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	curColResourceId  = "lineItem/ResourceId"
+	curColProductCode = "lineItem/ProductCode"
+	curColCost        = "lineItem/UnblendedCost"
+	curColCurrency    = "lineItem/CurrencyCode"
+	curColRegion      = "product/region"
+	curColTagPrefix   = "resourceTags/user:"
+)
+
+type awsCur struct {
+	client *http.Client
+	cred   Credential
+	opts   Options
+}
+
+// FetchRecords 从 s3 下载账期对应的 CUR 报告(csv 或 csv.gz)并按资源汇总
+func (a *awsCur) FetchRecords(cycle string) ([]Record, error) {
+	key := strings.Replace(a.opts.Key, "{cycle}", cycle, -1)
+	body, err := a.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var reader io.Reader = body
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return ParseCurReport(reader, cycle)
+}
+
+// ParseCurReport 解析 CUR csv 报告，忽略没有资源 id 的明细(如税费、支持费用)
+func ParseCurReport(r io.Reader, cycle string) ([]Record, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read report header: %v", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, h := range header {
+		cols[h] = i
+	}
+	for _, c := range []string{curColResourceId, curColCost} {
+		if _, ok := cols[c]; !ok {
+			return nil, fmt.Errorf("report column '%s' not found", c)
+		}
+	}
+	get := func(row []string, col string) string {
+		if i, ok := cols[col]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	records := make(map[string]*Record)
+	order := make([]string, 0)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		resId := get(row, curColResourceId)
+		if resId == "" {
+			continue
+		}
+		cost, _ := strconv.ParseFloat(get(row, curColCost), 64)
+		if rec, ok := records[resId]; ok {
+			rec.Cost += cost
+			continue
+		}
+
+		tags := make(map[string]string)
+		for name, i := range cols {
+			if strings.HasPrefix(name, curColTagPrefix) && i < len(row) && row[i] != "" {
+				tags[strings.TrimPrefix(name, curColTagPrefix)] = row[i]
+			}
+		}
+		records[resId] = &Record{
+			ResourceId:   resId,
+			ProductCode:  get(row, curColProductCode),
+			Region:       get(row, curColRegion),
+			Cost:         cost,
+			Currency:     get(row, curColCurrency),
+			BillingCycle: cycle,
+			Tags:         tags,
+		}
+		order = append(order, resId)
+	}
+
+	rs := make([]Record, 0, len(order))
+	for _, id := range order {
+		rs = append(rs, *records[id])
+	}
+	return rs, nil
+}
+
+func (a *awsCur) getObject(key string) (io.ReadCloser, error) {
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", a.opts.Bucket, a.opts.Region)
+	path := "/" + strings.TrimPrefix(key, "/")
+	req, err := http.NewRequest(http.MethodGet, "https://"+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	awsSignV4(req, a.cred, a.opts.Region, "s3", time.Now().UTC())
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		msg, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("get s3 object '%s': %s %s", key, res.Status, msg)
+	}
+	return res.Body, nil
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsSignV4 为无 body 的请求添加 AWS Signature Version 4 签名头
+func awsSignV4(req *http.Request, cred Credential, region, service string, now time.Time) {
+	const unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + unsignedPayload + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	reqHash := sha256.Sum256([]byte(canonicalReq))
+	strToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(reqHash[:])}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+cred.AccessKeySecret), date)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, strToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		cred.AccessKeyId, scope, signedHeaders, signature))
+}
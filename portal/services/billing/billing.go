@@ -0,0 +1,85 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package billing
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+/*
+云账单导入连接器
+
+连接器负责从云厂商拉取某个账期的实际账单明细，并统一转换为 Record 结构，
+账单与 CloudIaC 管理资源的对账逻辑由 services 层实现。
+*/
+
+const (
+	ProviderAlicloudBss = "alicloud_bss" // 阿里云费用中心(BSS OpenAPI)
+	ProviderAwsCur      = "aws_cur"      // AWS Cost and Usage Report
+
+	// 账期格式，如 2022-03
+	BillingCycleLayout = "2006-01"
+
+	httpTimeout = 60 * time.Second
+)
+
+var Providers = []string{ProviderAlicloudBss, ProviderAwsCur}
+
+// Record 账单明细(按资源实例汇总)
+type Record struct {
+	ResourceId   string            `json:"resourceId"`   // 云资源实例 id
+	ProductCode  string            `json:"productCode"`  // 产品代码，如 ecs, AmazonEC2
+	Region       string            `json:"region"`       // 地域
+	Cost         float64           `json:"cost"`         // 费用(应付金额)
+	Currency     string            `json:"currency"`     // 币种
+	BillingCycle string            `json:"billingCycle"` // 账期
+	Tags         map[string]string `json:"tags"`         // 资源标签
+}
+
+// Credential 连接器访问云厂商 API 使用的凭证
+type Credential struct {
+	AccessKeyId     string
+	AccessKeySecret string
+}
+
+// Options 连接器配置
+type Options struct {
+	Region string `json:"region"`
+	// AWS CUR 报告文件所在 s3 bucket 及对象路径，路径中的 {cycle} 会被替换为账期(如 2022-03)
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+type Connector interface {
+	// FetchRecords 拉取指定账期(格式 2006-01)的账单明细
+	FetchRecords(cycle string) ([]Record, error)
+}
+
+func New(provider string, cred Credential, opts Options) (Connector, error) {
+	if cred.AccessKeyId == "" || cred.AccessKeySecret == "" {
+		return nil, fmt.Errorf("access key of '%s' connector is not set", provider)
+	}
+
+	client := &http.Client{Timeout: httpTimeout}
+	switch provider {
+	case ProviderAlicloudBss:
+		return &alicloudBss{client: client, cred: cred}, nil
+	case ProviderAwsCur:
+		if opts.Bucket == "" || opts.Key == "" {
+			return nil, fmt.Errorf("bucket and key of report are required")
+		}
+		if opts.Region == "" {
+			opts.Region = "us-east-1"
+		}
+		return &awsCur{client: client, cred: cred, opts: opts}, nil
+	default:
+		return nil, fmt.Errorf("unsupported billing provider '%s'", provider)
+	}
+}
+
+// CurrentCycle 返回 t 所在的账期
+func CurrentCycle(t time.Time) string {
+	return t.Format(BillingCycleLayout)
+}
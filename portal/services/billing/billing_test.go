@@ -0,0 +1,39 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package billing
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCurReport(t *testing.T) {
+	report := "lineItem/ResourceId,lineItem/ProductCode,lineItem/UnblendedCost,lineItem/CurrencyCode,resourceTags/user:env\n" +
+		"i-0001,AmazonEC2,1.5,USD,prod\n" +
+		",AWSSupport,10,USD,\n" +
+		"i-0001,AmazonEC2,2.5,USD,prod\n" +
+		"vol-0002,AmazonEC2,0.25,USD,\n"
+
+	records, err := ParseCurReport(strings.NewReader(report), "2022-03")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Record{
+		{ResourceId: "i-0001", ProductCode: "AmazonEC2", Cost: 4, Currency: "USD",
+			BillingCycle: "2022-03", Tags: map[string]string{"env": "prod"}},
+		{ResourceId: "vol-0002", ProductCode: "AmazonEC2", Cost: 0.25, Currency: "USD",
+			BillingCycle: "2022-03", Tags: map[string]string{}},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("ParseCurReport() = %+v, want %+v", records, want)
+	}
+}
+
+func TestParseAlicloudTags(t *testing.T) {
+	got := parseAlicloudTags("key:cloudiac_env_id value:env-c3ek0co6n88ldvq1n6ag; key:owner value:ops")
+	want := map[string]string{"cloudiac_env_id": "env-c3ek0co6n88ldvq1n6ag", "owner": "ops"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseAlicloudTags() = %v, want %v", got, want)
+	}
+}
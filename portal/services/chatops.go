@@ -0,0 +1,123 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/chatops"
+	"cloudiac/utils/logs"
+	"fmt"
+)
+
+func CreateChatIdentity(tx *db.Session, identity models.ChatIdentity) (*models.ChatIdentity, e.Error) {
+	if err := models.Create(tx, &identity); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ChatIdentityAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &identity, nil
+}
+
+func DeleteChatIdentity(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.ChatIdentity{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func GetChatIdentityById(query *db.Session, id models.Id) (*models.ChatIdentity, e.Error) {
+	identity := models.ChatIdentity{}
+	if err := query.Where("id = ?", id).First(&identity); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ChatIdentityNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &identity, nil
+}
+
+// GetChatIdentity 查询聊天账号绑定的用户
+func GetChatIdentity(query *db.Session, platform, chatUserId string) (*models.ChatIdentity, e.Error) {
+	identity := models.ChatIdentity{}
+	if err := query.Where("platform = ? AND chat_user_id = ?", platform, chatUserId).First(&identity); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.ChatIdentityNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &identity, nil
+}
+
+func QueryChatIdentity(query *db.Session, orgId models.Id) *db.Session {
+	return query.Model(&models.ChatIdentity{}).
+		Joins("LEFT JOIN iac_user ON iac_user.id = iac_chat_identity.user_id").
+		LazySelectAppend("iac_chat_identity.*", "iac_user.name AS user_name").
+		Where("iac_chat_identity.org_id = ?", orgId).
+		Order("iac_chat_identity.created_at DESC")
+}
+
+func CreateChatOpsCommand(tx *db.Session, cmd models.ChatOpsCommand) (*models.ChatOpsCommand, e.Error) {
+	if err := models.Create(tx, &cmd); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &cmd, nil
+}
+
+// SendChatOpsTaskReply 任务状态变化时回复通过聊天指令创建该任务的会话，每个指令只回复一次最终结果
+func SendChatOpsTaskReply(dbSess *db.Session, taskId models.Id, status, message string) {
+	logger := logs.Get().WithField("taskId", taskId)
+	cmds := make([]*models.ChatOpsCommand, 0)
+	if err := dbSess.Where("task_id = ? AND replied = ?", taskId, false).Find(&cmds); err != nil {
+		logger.Errorf("query chatops command error: %v", err)
+		return
+	}
+
+	for _, cmd := range cmds {
+		if _, err := dbSess.Model(&models.ChatOpsCommand{}).Where("id = ?", cmd.Id).
+			UpdateColumn("replied", true); err != nil {
+			logger.Errorf("update chatops command error: %v", err)
+			continue
+		}
+
+		text := fmt.Sprintf("> %s %s %s\n任务 %s: %s", chatops.CommandPrefix, cmd.Command, cmd.Args, taskId, status)
+		if message != "" {
+			text = fmt.Sprintf("%s\n%s", text, message)
+		}
+		go func(cmd *models.ChatOpsCommand) {
+			if err := chatops.SendReply(cmd.Platform, cmd.ReplyUrl, text); err != nil {
+				logger.Warnf("send chatops reply error: %v", err)
+			}
+		}(cmd)
+	}
+}
+
+// GetChatOpsEnv 按 id 或名称查询组织下未归档的环境，名称对应多个环境时返回错误
+func GetChatOpsEnv(query *db.Session, orgId models.Id, idOrName string) (*models.Env, e.Error) {
+	envs := make([]*models.Env, 0)
+	if err := query.Where("org_id = ? AND archived = ? AND (id = ? OR name = ?)", orgId, false, idOrName, idOrName).
+		Limit(2).Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(envs) == 0 {
+		return nil, e.New(e.EnvNotExists, fmt.Errorf("environment '%s' not found", idOrName))
+	} else if len(envs) > 1 {
+		return nil, e.New(e.BadParam, fmt.Errorf("multiple environments named '%s', please use environment id", idOrName))
+	}
+	return envs[0], nil
+}
+
+// GetChatOpsTemplate 按 id 或名称查询组织下未归档的云模板
+func GetChatOpsTemplate(query *db.Session, orgId models.Id, idOrName string) (*models.Template, e.Error) {
+	tpl := models.Template{}
+	if err := query.Where("org_id = ? AND archived = ? AND (id = ? OR name = ?)", orgId, false, idOrName, idOrName).
+		First(&tpl); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TemplateNotExists, fmt.Errorf("template '%s' not found", idOrName))
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &tpl, nil
+}
@@ -0,0 +1,226 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package chatops
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/utils/rdb"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/parnurzeal/gorequest"
+)
+
+const (
+	CmdDeploy = "deploy"
+	CmdScan   = "scan"
+	CmdStatus = "status"
+	CmdHelp   = "help"
+
+	// 指令前缀，Slack 的 slash command 文本中不包含该前缀
+	CommandPrefix = "/iac"
+
+	// Slack 要求校验请求时间戳，避免重放攻击
+	slackMaxRequestAge = 5 * time.Minute
+	// 钉钉的签名不包含请求内容，有效期缩短为 5 分钟(钉钉要求不超过 1 小时)，并拒绝重复的签名
+	DingTalkMaxRequestAge = 5 * time.Minute
+)
+
+// replyHosts 各平台回复消息地址允许的域名，避免回调中伪造的地址被用于请求任意地址
+var replyHosts = map[string]string{
+	models.ChatPlatformSlack:    "hooks.slack.com",
+	models.ChatPlatformDingTalk: "oapi.dingtalk.com",
+}
+
+// 未配置 redis 时在本实例内记录已使用的 nonce
+var localNonces = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: make(map[string]time.Time)}
+
+var HelpText = strings.Join([]string{
+	"/iac deploy <环境ID或名称>  部署环境",
+	"/iac scan <云模板ID或名称>  对云模板执行合规检测",
+	"/iac status <环境ID或名称>  查看环境状态",
+}, "\n")
+
+// Command 解析后的聊天指令
+type Command struct {
+	Name string
+	Args []string
+}
+
+func (c Command) Arg() string {
+	return strings.Join(c.Args, " ")
+}
+
+// ParseCommand 解析指令文本，如 "/iac deploy my-env"，指令前缀可以省略
+func ParseCommand(text string) (*Command, error) {
+	fields := strings.Fields(text)
+	if len(fields) > 0 && fields[0] == CommandPrefix {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return &Command{Name: CmdHelp}, nil
+	}
+
+	cmd := &Command{Name: strings.ToLower(fields[0]), Args: fields[1:]}
+	switch cmd.Name {
+	case CmdHelp:
+		return cmd, nil
+	case CmdDeploy, CmdScan, CmdStatus:
+		if len(cmd.Args) != 1 {
+			return nil, fmt.Errorf("usage: %s %s <name>", CommandPrefix, cmd.Name)
+		}
+		return cmd, nil
+	default:
+		return nil, fmt.Errorf("unknown command '%s'", cmd.Name)
+	}
+}
+
+func checkRequestTime(t time.Time, now time.Time, maxAge time.Duration) error {
+	if d := now.Sub(t); d > maxAge || d < -maxAge {
+		return fmt.Errorf("request timestamp expired")
+	}
+	return nil
+}
+
+// VerifySlackSignature 校验 Slack 请求签名，
+// doc: https://api.slack.com/authentication/verifying-requests-from-slack
+func VerifySlackSignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp '%s'", timestamp)
+	}
+	if err := checkRequestTime(time.Unix(ts, 0), now, slackMaxRequestAge); err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("v0:%s:", timestamp)))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// VerifyDingTalkSignature 校验钉钉机器人回调请求签名，timestamp 为毫秒时间戳，
+// doc: https://open.dingtalk.com/document/orgapp/receive-message
+func VerifyDingTalkSignature(secret, timestamp, signature string, now time.Time) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp '%s'", timestamp)
+	}
+	if err := checkRequestTime(time.Unix(0, ts*int64(time.Millisecond)), now, DingTalkMaxRequestAge); err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s\n%s", timestamp, secret)))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// ClaimRequestNonce 记录请求的 nonce(如签名)，ttl 内重复出现时返回 false，用于拒绝重放的请求。
+// 多实例部署时使用 redis 记录，未配置 redis 时只在本实例内记录
+func ClaimRequestNonce(nonce string, ttl time.Duration) (bool, error) {
+	return claimNonce(rdb.Get(), nonce, ttl, time.Now())
+}
+
+func claimNonce(client *redis.Client, nonce string, ttl time.Duration, now time.Time) (bool, error) {
+	key := "cloudiac:chatops:nonce:" + nonce
+	if client != nil {
+		return client.SetNX(context.Background(), key, "1", ttl).Result()
+	}
+
+	localNonces.Lock()
+	defer localNonces.Unlock()
+	for k, expire := range localNonces.expires {
+		if !now.Before(expire) {
+			delete(localNonces.expires, k)
+		}
+	}
+	if _, ok := localNonces.expires[key]; ok {
+		return false, nil
+	}
+	localNonces.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+// CheckReplyUrl 检查回复消息的地址是否为平台的地址
+func CheckReplyUrl(platform, replyUrl string) error {
+	u, err := url.Parse(replyUrl)
+	if err != nil {
+		return fmt.Errorf("invalid reply url: %v", err)
+	}
+	host := replyHosts[platform]
+	if host == "" || u.Scheme != "https" || u.User != nil || u.Port() != "" || !strings.EqualFold(u.Hostname(), host) {
+		return fmt.Errorf("reply url host '%s' is not allowed", u.Host)
+	}
+	return nil
+}
+
+// SlackResponse slash command 的回复消息
+type SlackResponse struct {
+	ResponseType string `json:"response_type"` // in_channel 表示频道内所有人可见
+	Text         string `json:"text"`
+}
+
+type DingTalkText struct {
+	Content string `json:"content"`
+}
+
+// DingTalkMessage 钉钉机器人回调的消息及回复消息
+type DingTalkMessage struct {
+	MsgType string       `json:"msgtype"`
+	Text    DingTalkText `json:"text"`
+
+	SenderId       string `json:"senderId,omitempty"`
+	SenderStaffId  string `json:"senderStaffId,omitempty"`
+	SenderNick     string `json:"senderNick,omitempty"`
+	ConversationId string `json:"conversationId,omitempty"`
+	SessionWebhook string `json:"sessionWebhook,omitempty"`
+	RobotCode      string `json:"robotCode,omitempty"` // 接收消息的机器人
+}
+
+// NewReply 生成对应平台的回复消息
+func NewReply(platform, text string) interface{} {
+	if platform == models.ChatPlatformDingTalk {
+		return DingTalkMessage{MsgType: "text", Text: DingTalkText{Content: text}}
+	}
+	return SlackResponse{ResponseType: "in_channel", Text: text}
+}
+
+// SendReply 通过回调地址回复消息，用于异步返回任务执行结果
+func SendReply(platform, replyUrl, text string) error {
+	if err := CheckReplyUrl(platform, replyUrl); err != nil {
+		return err
+	}
+	resp, _, errs := gorequest.New().
+		Post(replyUrl).
+		Timeout(10 * time.Second).
+		Send(NewReply(platform, text)).
+		End()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("error sending reply, status: %v", resp.Status)
+	}
+	return nil
+}
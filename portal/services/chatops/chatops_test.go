@@ -0,0 +1,124 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package chatops
+
+import (
+	"cloudiac/portal/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		text   string
+		expect *Command
+		hasErr bool
+	}{
+		{"", &Command{Name: CmdHelp}, false},
+		{"/iac", &Command{Name: CmdHelp}, false},
+		{"deploy prod-env", &Command{Name: CmdDeploy, Args: []string{"prod-env"}}, false},
+		{"  /iac  Status   prod-env ", &Command{Name: CmdStatus, Args: []string{"prod-env"}}, false},
+		{"/iac scan", nil, true},
+		{"/iac deploy a b", nil, true},
+		{"/iac destroy prod-env", nil, true},
+	}
+	for _, c := range cases {
+		cmd, err := ParseCommand(c.text)
+		if c.hasErr {
+			if err == nil {
+				t.Errorf("%q: expect error", c.text)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.text, err)
+		} else if !reflect.DeepEqual(cmd, c.expect) {
+			t.Errorf("%q: expect %+v, got %+v", c.text, c.expect, cmd)
+		}
+	}
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	secret := "8f742231b10e8888abcd99yyyzzz85a5"
+	body := []byte("token=xyz&command=%2Fiac&text=status+prod")
+	now := time.Unix(1531420618, 0)
+	ts := fmt.Sprintf("%d", now.Unix())
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+	sig := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if err := VerifySlackSignature(secret, ts, sig, body, now); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := VerifySlackSignature(secret, ts, sig, []byte("text=deploy+prod"), now); err == nil {
+		t.Errorf("expect error for tampered body")
+	}
+	if err := VerifySlackSignature(secret, ts, sig, body, now.Add(10*time.Minute)); err == nil {
+		t.Errorf("expect error for expired request")
+	}
+}
+
+func TestVerifyDingTalkSignature(t *testing.T) {
+	secret := "SEC-test"
+	now := time.Unix(1650000000, 0)
+	ts := fmt.Sprintf("%d", now.UnixNano()/1e6)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "\n" + secret))
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if err := VerifyDingTalkSignature(secret, ts, sig, now); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := VerifyDingTalkSignature("other", ts, sig, now); err == nil {
+		t.Errorf("expect error for wrong secret")
+	}
+	if err := VerifyDingTalkSignature(secret, ts, sig, now.Add(10*time.Minute)); err == nil {
+		t.Errorf("expect error for expired request")
+	}
+}
+
+func TestClaimNonce(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	if ok, _ := claimNonce(nil, "dingtalk:sig-1", time.Minute, now); !ok {
+		t.Errorf("expect first request accepted")
+	}
+	if ok, _ := claimNonce(nil, "dingtalk:sig-1", time.Minute, now.Add(30*time.Second)); ok {
+		t.Errorf("expect replayed request rejected")
+	}
+	if ok, _ := claimNonce(nil, "dingtalk:sig-2", time.Minute, now); !ok {
+		t.Errorf("expect other request accepted")
+	}
+	if ok, _ := claimNonce(nil, "dingtalk:sig-1", time.Minute, now.Add(2*time.Minute)); !ok {
+		t.Errorf("expect expired nonce released")
+	}
+}
+
+func TestCheckReplyUrl(t *testing.T) {
+	cases := []struct {
+		platform, url string
+		ok            bool
+	}{
+		{models.ChatPlatformDingTalk, "https://oapi.dingtalk.com/robot/sendBySession?session=xxx", true},
+		{models.ChatPlatformSlack, "https://hooks.slack.com/commands/T1/1/xxx", true},
+		{models.ChatPlatformDingTalk, "https://hooks.slack.com/commands/T1/1/xxx", false},
+		{models.ChatPlatformDingTalk, "http://oapi.dingtalk.com/robot/sendBySession", false},
+		{models.ChatPlatformDingTalk, "https://oapi.dingtalk.com.evil.com/robot", false},
+		{models.ChatPlatformDingTalk, "https://oapi.dingtalk.com@10.0.0.1/robot", false},
+		{models.ChatPlatformSlack, "https://hooks.slack.com:8443/commands", false},
+		{"unknown", "https:///path", false},
+	}
+	for _, c := range cases {
+		if err := CheckReplyUrl(c.platform, c.url); (err == nil) != c.ok {
+			t.Errorf("%s %q: expect ok=%v, got %v", c.platform, c.url, c.ok, err)
+		}
+	}
+}
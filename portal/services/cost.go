@@ -0,0 +1,304 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"math"
+	"strings"
+)
+
+func CreateCostPrice(tx *db.Session, p models.CostPrice) (*models.CostPrice, e.Error) {
+	if p.Id == "" {
+		p.Id = p.NewId()
+	}
+	if err := models.Create(tx, &p); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ObjectAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+func UpdateCostPrice(tx *db.Session, id models.Id, attrs models.Attrs) (*models.CostPrice, e.Error) {
+	p := &models.CostPrice{}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.CostPrice{}, attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.ObjectAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("update cost price error: %v", err))
+	}
+	if err := tx.Where("id = ?", id).First(p); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("query cost price error: %v", err))
+	}
+	return p, nil
+}
+
+func DeleteCostPrice(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.CostPrice{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete cost price error: %v", err))
+	}
+	return nil
+}
+
+func GetCostPriceById(query *db.Session, id models.Id) (*models.CostPrice, e.Error) {
+	p := models.CostPrice{}
+	if err := query.Where("id = ?", id).First(&p); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.CostPriceNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &p, nil
+}
+
+func QueryCostPrice(query *db.Session) *db.Session {
+	return query.Model(&models.CostPrice{})
+}
+
+// ValidateCostPrice 校验价格配置
+func ValidateCostPrice(p *models.CostPrice) e.Error {
+	if strings.TrimSpace(p.ResourceType) == "" {
+		return e.New(e.CostPriceInvalid, fmt.Errorf("resource type is required"))
+	}
+	if p.MonthlyPrice < 0 {
+		return e.New(e.CostPriceInvalid, fmt.Errorf("monthly price must not be negative"))
+	}
+	if (p.MatchAttr == "") != (p.MatchValue == "") {
+		return e.New(e.CostPriceInvalid, fmt.Errorf("match attr and match value must be set together"))
+	}
+	return nil
+}
+
+// costPriceIndex 按资源类型索引的价格配置
+type costPriceIndex map[string][]models.CostPrice
+
+func newCostPriceIndex(prices []models.CostPrice) costPriceIndex {
+	idx := make(costPriceIndex)
+	for _, p := range prices {
+		idx[p.ResourceType] = append(idx[p.ResourceType], p)
+	}
+	return idx
+}
+
+// price 返回资源的月度价格，优先使用属性匹配的价格，其次使用资源类型的默认价格，没有匹配的价格配置时 ok 为 false
+func (idx costPriceIndex) price(resType string, values interface{}) (price float64, ok bool) {
+	attrs, _ := values.(map[string]interface{})
+	if attrs == nil {
+		return 0, false
+	}
+	var def *models.CostPrice
+	for i, p := range idx[resType] {
+		if p.MatchAttr == "" {
+			def = &idx[resType][i]
+			continue
+		}
+		if v, exist := attrs[p.MatchAttr]; exist && fmt.Sprint(v) == p.MatchValue {
+			return p.MonthlyPrice, true
+		}
+	}
+	if def != nil {
+		return def.MonthlyPrice, true
+	}
+	return 0, false
+}
+
+// planCostAction 将 plan 中资源的变更动作转换为费用估算的动作，read 等不影响费用的动作返回空
+func planCostAction(actions []string) string {
+	switch {
+	case utils.SliceEqualStr(actions, []string{"no-op"}):
+		return models.CostActionNoop
+	case utils.SliceEqualStr(actions, []string{"create"}):
+		return models.CostActionCreate
+	case utils.SliceEqualStr(actions, []string{"update"}):
+		return models.CostActionUpdate
+	case utils.SliceEqualStr(actions, []string{"delete", "create"}),
+		utils.SliceEqualStr(actions, []string{"create", "delete"}):
+		return models.CostActionReplace
+	case utils.SliceEqualStr(actions, []string{"delete"}):
+		return models.CostActionDelete
+	}
+	return ""
+}
+
+// CostEstimateSummary 任务费用估算的汇总结果
+type CostEstimateSummary struct {
+	MonthlyCost       float64 `json:"monthlyCost"`       // plan 执行后 plan 范围内资源的月度费用
+	MonthlyCostDelta  float64 `json:"monthlyCostDelta"`  // 月度费用变化
+	PricedResources   int     `json:"pricedResources"`   // 匹配到价格配置的资源数量
+	UnpricedResources int     `json:"unpricedResources"` // 未匹配到价格配置的资源数量
+}
+
+func roundCost(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// estimatePlanCost 根据价格配置估算 plan 中各资源的月度费用，
+// 返回的估算记录包括所有匹配到价格的资源及有变更的资源
+func estimatePlanCost(idx costPriceIndex, plan *TfPlan) ([]models.TaskCostEstimate, CostEstimateSummary) {
+	rows := make([]models.TaskCostEstimate, 0)
+	summary := CostEstimateSummary{}
+	for _, r := range plan.ResourceChanges {
+		if r.Mode == "data" {
+			continue
+		}
+		action := planCostAction(r.Change.Actions)
+		if action == "" {
+			continue
+		}
+
+		var before, after float64
+		var pricedBefore, pricedAfter bool
+		if action != models.CostActionCreate {
+			before, pricedBefore = idx.price(r.Type, r.Change.Before)
+		}
+		if action != models.CostActionDelete {
+			after, pricedAfter = idx.price(r.Type, r.Change.After)
+		}
+		priced := pricedBefore || pricedAfter
+		if priced {
+			summary.PricedResources += 1
+		} else {
+			summary.UnpricedResources += 1
+			if action == models.CostActionNoop {
+				continue
+			}
+		}
+		summary.MonthlyCost += after
+		summary.MonthlyCostDelta += after - before
+
+		rows = append(rows, models.TaskCostEstimate{
+			Address:       r.Address,
+			Type:          r.Type,
+			Action:        action,
+			Priced:        priced,
+			MonthlyBefore: roundCost(before),
+			MonthlyAfter:  roundCost(after),
+			MonthlyDelta:  roundCost(after - before),
+		})
+	}
+	summary.MonthlyCost = roundCost(summary.MonthlyCost)
+	summary.MonthlyCostDelta = roundCost(summary.MonthlyCostDelta)
+	return rows, summary
+}
+
+// EstimateTaskCost 根据任务的 plan 结果估算费用，保存各资源的估算记录并更新任务的费用汇总。
+// 组织未配置价格或任务为多工作目录云模板的任务时不进行估算，返回 nil
+func EstimateTaskCost(tx *db.Session, task *models.Task, planJson []byte) (*CostEstimateSummary, e.Error) {
+	if len(planJson) == 0 || len(task.Workdirs) > 0 {
+		return nil, nil
+	}
+	prices := make([]models.CostPrice, 0)
+	if err := QueryCostPrice(tx).Where("org_id = ?", task.OrgId).Find(&prices); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(prices) == 0 {
+		return nil, nil
+	}
+	plan, err := UnmarshalPlanJson(planJson)
+	if err != nil {
+		return nil, e.New(e.InternalError, fmt.Errorf("unmarshal plan json: %v", err))
+	}
+
+	rows, summary := estimatePlanCost(newCostPriceIndex(prices), plan)
+	for i := range rows {
+		rows[i].OrgId = task.OrgId
+		rows[i].ProjectId = task.ProjectId
+		rows[i].EnvId = task.EnvId
+		rows[i].TaskId = task.Id
+	}
+	// 任务恢复执行时可能会重复估算，先清除已有的记录
+	if _, err := tx.Where("task_id = ?", task.Id).Delete(&models.TaskCostEstimate{}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(rows) > 0 {
+		if err := models.CreateBatch(tx, rows); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+
+	task.CostEstimated = true
+	task.MonthlyCost = summary.MonthlyCost
+	task.MonthlyCostDelta = summary.MonthlyCostDelta
+	if _, err := tx.Model(&models.Task{}).Where("id = ?", task.Id).UpdateAttrs(models.Attrs{
+		"cost_estimated":     task.CostEstimated,
+		"monthly_cost":       task.MonthlyCost,
+		"monthly_cost_delta": task.MonthlyCostDelta,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &summary, nil
+}
+
+// TaskProjectedEnvCost 返回任务执行后环境的估算月度费用。
+// 指定了 target 的任务 plan 只包含部分资源，基于环境当前的费用加上变化量计算
+func TaskProjectedEnvCost(env *models.Env, task *models.Task) float64 {
+	if task.Partial {
+		return roundCost(math.Max(env.MonthlyCost+task.MonthlyCostDelta, 0))
+	}
+	return task.MonthlyCost
+}
+
+// CheckEnvBudget 检查任务执行后环境的估算费用是否超出预算，返回超出预算的说明，未超出时返回空。
+// 任务没有增加费用时不检查，避免已超出预算的环境无法执行降低费用的部署
+func CheckEnvBudget(env *models.Env, task *models.Task) string {
+	if env.MonthlyBudget <= 0 || !task.CostEstimated || task.MonthlyCostDelta <= 0 {
+		return ""
+	}
+	if cost := TaskProjectedEnvCost(env, task); cost > env.MonthlyBudget {
+		return fmt.Sprintf("estimated monthly cost %.2f exceeds the budget %.2f", cost, env.MonthlyBudget)
+	}
+	return ""
+}
+
+// UpdateEnvMonthlyCost 部署任务成功后更新环境的估算月度费用
+func UpdateEnvMonthlyCost(tx *db.Session, task *models.Task) e.Error {
+	if !task.CostEstimated {
+		return nil
+	}
+	env, er := GetEnvById(tx, task.EnvId)
+	if er != nil {
+		return er
+	}
+	if _, err := tx.Model(&models.Env{}).Where("id = ?", env.Id).
+		UpdateColumn("monthly_cost", TaskProjectedEnvCost(env, task)); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// EnvCostItem 环境的费用及预算
+type EnvCostItem struct {
+	EnvId         models.Id `json:"envId"`
+	EnvName       string    `json:"envName"`
+	ProjectId     models.Id `json:"projectId"`
+	ProjectName   string    `json:"projectName"`
+	MonthlyCost   float64   `json:"monthlyCost"`
+	MonthlyBudget float64   `json:"monthlyBudget"`
+	OverBudget    bool      `json:"overBudget"`
+}
+
+// EnvCostByOrg 查询组织(或项目)下未归档环境的估算月度费用，按费用从高到低排序
+func EnvCostByOrg(query *db.Session, orgId models.Id, projectId models.Id) ([]EnvCostItem, e.Error) {
+	items := make([]EnvCostItem, 0)
+	q := query.Table("iac_env AS env").
+		Joins("LEFT JOIN iac_project AS p ON p.id = env.project_id").
+		Where("env.org_id = ? AND env.archived = ?", orgId, false)
+	if projectId != "" {
+		q = q.Where("env.project_id = ?", projectId)
+	}
+	if err := q.Select("env.id AS env_id, env.name AS env_name, env.project_id, p.name AS project_name, " +
+		"env.monthly_cost, env.monthly_budget").
+		Order("env.monthly_cost DESC").Scan(&items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for i := range items {
+		items[i].OverBudget = items[i].MonthlyBudget > 0 && items[i].MonthlyCost > items[i].MonthlyBudget
+	}
+	return items, nil
+}
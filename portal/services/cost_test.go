@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestEstimatePlanCost(t *testing.T) {
+	idx := newCostPriceIndex([]models.CostPrice{
+		{ResourceType: "aws_instance", MonthlyPrice: 30},
+		{ResourceType: "aws_instance", MatchAttr: "instance_type", MatchValue: "t3.micro", MonthlyPrice: 7.5},
+		{ResourceType: "aws_eip", MonthlyPrice: 3.6},
+	})
+	plan, err := UnmarshalPlanJson([]byte(`{"resource_changes": [
+		{"address": "aws_instance.a", "mode": "managed", "type": "aws_instance",
+			"change": {"actions": ["update"], "before": {"instance_type": "t3.micro"}, "after": {"instance_type": "m5.large"}}},
+		{"address": "aws_instance.b", "mode": "managed", "type": "aws_instance",
+			"change": {"actions": ["create"], "before": null, "after": {"instance_type": "t3.micro"}}},
+		{"address": "aws_eip.c", "mode": "managed", "type": "aws_eip",
+			"change": {"actions": ["delete"], "before": {}, "after": null}},
+		{"address": "aws_eip.d", "mode": "managed", "type": "aws_eip",
+			"change": {"actions": ["no-op"], "before": {}, "after": {}}},
+		{"address": "aws_s3_bucket.e", "mode": "managed", "type": "aws_s3_bucket",
+			"change": {"actions": ["no-op"], "before": {}, "after": {}}},
+		{"address": "data.aws_ami.f", "mode": "data", "type": "aws_ami",
+			"change": {"actions": ["read"]}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, summary := estimatePlanCost(idx, plan)
+	if len(rows) != 4 {
+		t.Fatalf("rows = %d, want 4", len(rows))
+	}
+	if rows[0].MonthlyBefore != 7.5 || rows[0].MonthlyAfter != 30 || rows[0].MonthlyDelta != 22.5 {
+		t.Errorf("unexpected estimate for %s: %+v", rows[0].Address, rows[0])
+	}
+	want := CostEstimateSummary{MonthlyCost: 41.1, MonthlyCostDelta: 26.4, PricedResources: 4, UnpricedResources: 1}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+}
+
+func TestCheckEnvBudget(t *testing.T) {
+	cases := []struct {
+		env       models.Env
+		task      models.Task
+		violation bool
+	}{
+		{models.Env{}, models.Task{CostEstimated: true, MonthlyCost: 100, MonthlyCostDelta: 100}, false},
+		{models.Env{MonthlyBudget: 50}, models.Task{CostEstimated: false}, false},
+		{models.Env{MonthlyBudget: 50}, models.Task{CostEstimated: true, MonthlyCost: 100, MonthlyCostDelta: 100}, true},
+		{models.Env{MonthlyBudget: 50}, models.Task{CostEstimated: true, MonthlyCost: 80, MonthlyCostDelta: -20}, false},
+		{models.Env{MonthlyBudget: 50, MonthlyCost: 40}, models.Task{CostEstimated: true, Partial: true, MonthlyCost: 5, MonthlyCostDelta: 5}, false},
+		{models.Env{MonthlyBudget: 50, MonthlyCost: 40}, models.Task{CostEstimated: true, Partial: true, MonthlyCost: 20, MonthlyCostDelta: 20}, true},
+	}
+	for i, c := range cases {
+		if v := CheckEnvBudget(&c.env, &c.task); (v != "") != c.violation {
+			t.Errorf("case %d: violation = %q, want %v", i, v, c.violation)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"sort"
+	"time"
+)
+
+const driftDateLayout = "2006-01-02"
+
+// SaveDriftHistory 保存偏移检测任务发现的资源偏移记录
+func SaveDriftHistory(tx *db.Session, task *models.Task, drifts map[string]models.ResourceDrift, detectedAt time.Time) e.Error {
+	if len(drifts) == 0 {
+		return nil
+	}
+	rows := make([]*models.ResourceDriftHistory, 0, len(drifts))
+	for address, d := range drifts {
+		rows = append(rows, &models.ResourceDriftHistory{
+			OrgId:       task.OrgId,
+			ProjectId:   task.ProjectId,
+			EnvId:       task.EnvId,
+			TaskId:      task.Id,
+			Address:     address,
+			DriftDetail: d.DriftDetail,
+			DetectedAt:  models.Time(detectedAt),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Address < rows[j].Address })
+	if err := models.CreateBatch(tx, rows); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// QueryDriftHistory 查询环境的资源偏移历史，按检测时间倒序
+func QueryDriftHistory(query *db.Session, envId models.Id, since time.Time) *db.Session {
+	return query.Model(&models.ResourceDriftHistory{}).
+		Where("env_id = ? AND detected_at >= ?", envId, since).
+		Order("detected_at DESC, address")
+}
+
+// driftRunsQuery 已完成的偏移检测任务，只有执行完成的任务才有检测结果
+func driftRunsQuery(query *db.Session, since time.Time) *db.Session {
+	return query.Model(&models.Task{}).
+		Where("is_drift_task = ? AND status = ? AND created_at >= ?", true, models.TaskComplete, since)
+}
+
+// DriftTrendItem 每天的偏移检测统计
+type DriftTrendItem struct {
+	Date             string `json:"date" example:"2022-01-01"`
+	Runs             int    `json:"runs"`             // 偏移检测次数
+	DriftedRuns      int    `json:"driftedRuns"`      // 发现偏移的检测次数
+	DriftedResources int    `json:"driftedResources"` // 发现偏移的资源数量(同一资源多次偏移重复计数)
+}
+
+// EnvDriftTrend 统计环境 since 之后每天的偏移检测次数及发现偏移的次数，没有检测的日期也会返回
+func EnvDriftTrend(tx *db.Session, envId models.Id, since time.Time) ([]*DriftTrendItem, e.Error) {
+	runs := make([]*DriftTrendItem, 0)
+	if err := driftRunsQuery(tx, since).Where("env_id = ?", envId).
+		Select("DATE_FORMAT(created_at, '%Y-%m-%d') AS date, COUNT(*) AS runs").
+		Group("date").Scan(&runs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	drifts := make([]*DriftTrendItem, 0)
+	if err := tx.Model(&models.ResourceDriftHistory{}).
+		Where("env_id = ? AND detected_at >= ?", envId, since).
+		Select("DATE_FORMAT(detected_at, '%Y-%m-%d') AS date, " +
+			"COUNT(DISTINCT task_id) AS drifted_runs, COUNT(*) AS drifted_resources").
+		Group("date").Scan(&drifts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return buildDriftTrend(since, time.Now(), runs, drifts), nil
+}
+
+// buildDriftTrend 合并每天的检测次数及偏移统计，生成 since 到 until 的连续日期序列
+func buildDriftTrend(since, until time.Time, runs, drifts []*DriftTrendItem) []*DriftTrendItem {
+	items := make(map[string]*DriftTrendItem)
+	for _, r := range runs {
+		items[r.Date] = &DriftTrendItem{Date: r.Date, Runs: r.Runs}
+	}
+	for _, d := range drifts {
+		item, ok := items[d.Date]
+		if !ok {
+			item = &DriftTrendItem{Date: d.Date}
+			items[d.Date] = item
+		}
+		item.DriftedRuns = d.DriftedRuns
+		item.DriftedResources = d.DriftedResources
+	}
+
+	trend := make([]*DriftTrendItem, 0)
+	day := time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, since.Location())
+	for ; !day.After(until); day = day.AddDate(0, 0, 1) {
+		date := day.Format(driftDateLayout)
+		if item, ok := items[date]; ok {
+			trend = append(trend, item)
+		} else {
+			trend = append(trend, &DriftTrendItem{Date: date})
+		}
+	}
+	return trend
+}
+
+// ResourceDriftStat 资源的偏移频率统计
+type ResourceDriftStat struct {
+	Address     string      `json:"address"`
+	DriftCount  int         `json:"driftCount"`  // 发生偏移的次数
+	LastDriftAt models.Time `json:"lastDriftAt"` // 最近一次发现偏移的时间
+}
+
+// ResourceDriftStats 统计环境各资源 since 之后发生偏移的次数，按偏移次数从多到少排序
+func ResourceDriftStats(tx *db.Session, envId models.Id, since time.Time) ([]*ResourceDriftStat, e.Error) {
+	stats := make([]*ResourceDriftStat, 0)
+	if err := tx.Model(&models.ResourceDriftHistory{}).
+		Where("env_id = ? AND detected_at >= ?", envId, since).
+		Select("address, COUNT(*) AS drift_count, MAX(detected_at) AS last_drift_at").
+		Group("address").Order("drift_count DESC, address").Scan(&stats); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return stats, nil
+}
+
+// EnvDriftStat 环境的偏移频率统计
+type EnvDriftStat struct {
+	EnvId            models.Id    `json:"envId"`
+	EnvName          string       `json:"envName"`
+	ProjectId        models.Id    `json:"projectId"`
+	Runs             int          `json:"runs"`             // 偏移检测次数
+	DriftedRuns      int          `json:"driftedRuns"`      // 发现偏移的检测次数
+	DriftedResources int          `json:"driftedResources"` // 发生过偏移的资源数量
+	LastDriftAt      *models.Time `json:"lastDriftAt"`      // 最近一次发现偏移的时间
+}
+
+// EnvDriftStats 统计组织或项目下各环境 since 之后的偏移检测情况，按发现偏移的次数从多到少排序，
+// projectId 为空时统计整个组织
+func EnvDriftStats(tx *db.Session, orgId, projectId models.Id, since time.Time) ([]*EnvDriftStat, e.Error) {
+	runsQuery := driftRunsQuery(tx, since).Where("org_id = ?", orgId)
+	driftQuery := tx.Model(&models.ResourceDriftHistory{}).Where("org_id = ? AND detected_at >= ?", orgId, since)
+	if projectId != "" {
+		runsQuery = runsQuery.Where("project_id = ?", projectId)
+		driftQuery = driftQuery.Where("project_id = ?", projectId)
+	}
+
+	runs := make([]*EnvDriftStat, 0)
+	if err := runsQuery.Select("env_id, project_id, COUNT(*) AS runs").
+		Group("env_id, project_id").Scan(&runs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	drifts := make([]*EnvDriftStat, 0)
+	if err := driftQuery.Select("env_id, project_id, COUNT(DISTINCT task_id) AS drifted_runs, " +
+		"COUNT(DISTINCT address) AS drifted_resources, MAX(detected_at) AS last_drift_at").
+		Group("env_id, project_id").Scan(&drifts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	stats := mergeEnvDriftStats(runs, drifts)
+	if len(stats) == 0 {
+		return stats, nil
+	}
+	envIds := make([]models.Id, 0, len(stats))
+	for _, s := range stats {
+		envIds = append(envIds, s.EnvId)
+	}
+	envs := make([]*models.Env, 0)
+	if err := tx.Model(&models.Env{}).Where("id IN (?)", envIds).Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	envNames := make(map[models.Id]string, len(envs))
+	for _, env := range envs {
+		envNames[env.Id] = env.Name
+	}
+	for _, s := range stats {
+		s.EnvName = envNames[s.EnvId]
+	}
+	return stats, nil
+}
+
+// mergeEnvDriftStats 合并各环境的检测次数及偏移统计
+func mergeEnvDriftStats(runs, drifts []*EnvDriftStat) []*EnvDriftStat {
+	statMap := make(map[models.Id]*EnvDriftStat)
+	stats := make([]*EnvDriftStat, 0, len(runs))
+	for _, r := range runs {
+		s := &EnvDriftStat{EnvId: r.EnvId, ProjectId: r.ProjectId, Runs: r.Runs}
+		statMap[r.EnvId] = s
+		stats = append(stats, s)
+	}
+	for _, d := range drifts {
+		s, ok := statMap[d.EnvId]
+		if !ok {
+			s = &EnvDriftStat{EnvId: d.EnvId, ProjectId: d.ProjectId}
+			statMap[d.EnvId] = s
+			stats = append(stats, s)
+		}
+		s.DriftedRuns = d.DriftedRuns
+		s.DriftedResources = d.DriftedResources
+		s.LastDriftAt = d.LastDriftAt
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].DriftedRuns != stats[j].DriftedRuns {
+			return stats[i].DriftedRuns > stats[j].DriftedRuns
+		}
+		return stats[i].EnvId < stats[j].EnvId
+	})
+	return stats
+}
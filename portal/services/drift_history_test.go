@@ -0,0 +1,45 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildDriftTrend(t *testing.T) {
+	since := time.Date(2022, 1, 1, 10, 0, 0, 0, time.Local)
+	until := time.Date(2022, 1, 4, 8, 0, 0, 0, time.Local)
+	runs := []*DriftTrendItem{{Date: "2022-01-01", Runs: 2}, {Date: "2022-01-03", Runs: 1}}
+	drifts := []*DriftTrendItem{{Date: "2022-01-01", DriftedRuns: 1, DriftedResources: 3}}
+
+	trend := buildDriftTrend(since, until, runs, drifts)
+	assert.Equal(t, []*DriftTrendItem{
+		{Date: "2022-01-01", Runs: 2, DriftedRuns: 1, DriftedResources: 3},
+		{Date: "2022-01-02"},
+		{Date: "2022-01-03", Runs: 1},
+		{Date: "2022-01-04"},
+	}, trend)
+}
+
+func TestMergeEnvDriftStats(t *testing.T) {
+	at := models.Time(time.Now())
+	runs := []*EnvDriftStat{{EnvId: "env-a", Runs: 3}, {EnvId: "env-b", Runs: 5}}
+	// 检测任务在统计开始之前创建时只有偏移记录
+	drifts := []*EnvDriftStat{
+		{EnvId: "env-b", DriftedRuns: 2, DriftedResources: 1, LastDriftAt: &at},
+		{EnvId: "env-c", DriftedRuns: 1, DriftedResources: 1, LastDriftAt: &at},
+	}
+
+	stats := mergeEnvDriftStats(runs, drifts)
+	assert.Len(t, stats, 3)
+	assert.Equal(t, models.Id("env-b"), stats[0].EnvId)
+	assert.Equal(t, 5, stats[0].Runs)
+	assert.Equal(t, 2, stats[0].DriftedRuns)
+	assert.Equal(t, models.Id("env-c"), stats[1].EnvId)
+	assert.Equal(t, models.Id("env-a"), stats[2].EnvId)
+	assert.Nil(t, stats[2].LastDriftAt)
+}
@@ -26,6 +26,9 @@ func CreateEnv(tx *db.Session, env models.Env) (*models.Env, e.Error) {
 	if env.StatePath == "" {
 		env.StatePath = env.DefaultStatPath()
 	}
+	if er := CheckProjectEnvQuota(tx, env.ProjectId); er != nil {
+		return nil, er
+	}
 	if err := models.Create(tx, &env); err != nil {
 		if e.IsDuplicate(err) {
 			return nil, e.New(e.EnvAlreadyExists, err)
@@ -153,9 +156,18 @@ func ChangeEnvStatusWithTaskAndStep(tx *db.Session, id models.Id, task *models.T
 			// 任务驳回，环境状态不变
 			break
 		case models.TaskFailed:
-			envStatus = models.EnvStatusFailed
+			// 导入资源失败不影响环境中已有的资源，环境状态不变
+			if task.Type != models.TaskTypeImport {
+				envStatus = models.EnvStatusFailed
+			}
+		case models.TaskCancelled:
+			// 部署步骤执行中被取消时可能已变更了部分资源，与失败相同处理；步骤未开始执行即被取消时环境状态不变
+			if step != nil && step.StartAt != nil &&
+				(step.Type == models.TaskStepApply || step.Type == models.TaskStepDestroy) {
+				envStatus = models.EnvStatusFailed
+			}
 		case models.TaskComplete:
-			if task.Type == models.TaskTypeApply {
+			if task.Type == models.TaskTypeApply || task.Type == models.TaskTypeImport {
 				envStatus = models.EnvStatusActive
 			} else if task.Type == models.TaskTypeDestroy {
 				envStatus = models.EnvStatusInactive
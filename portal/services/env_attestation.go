@@ -0,0 +1,63 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"time"
+)
+
+// NextAttestationDueAt 计算从 from 开始的下次合规声明截止时间，interval 为声明周期(天)，未配置周期时返回 nil
+func NextAttestationDueAt(from time.Time, interval int) *models.Time {
+	if interval <= 0 {
+		return nil
+	}
+	t := models.Time(from.AddDate(0, 0, interval))
+	return &t
+}
+
+// CheckEnvAttestation 环境合规声明逾期且配置了禁止部署时，不允许创建 apply 任务。
+// plan 任务不会变更资源，destroy 任务用于回收资源，均不受限制
+func CheckEnvAttestation(env *models.Env, taskType string) e.Error {
+	if taskType != common.TaskTypeApply || !env.AttestationBlock || !env.IsAttestationOverdue() {
+		return nil
+	}
+	return e.New(e.EnvAttestationOverdue,
+		fmt.Errorf("env attestation overdue since %s", time.Time(*env.AttestationDueAt).Format("2006-01-02 15:04:05")))
+}
+
+// CreateEnvAttestation 保存合规声明记录，并更新环境的下次声明截止时间
+func CreateEnvAttestation(tx *db.Session, env *models.Env, attestation *models.EnvAttestation) (*models.EnvAttestation, e.Error) {
+	now := time.Now()
+	attestation.DueAt = env.AttestationDueAt
+	attestation.Overdue = env.IsAttestationOverdue()
+	attestation.NextDueAt = NextAttestationDueAt(now, env.AttestationInterval)
+	if err := models.Create(tx, attestation); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	if _, err := models.UpdateAttr(tx.Where("id = ?", env.Id), &models.Env{}, models.Attrs{
+		"attestation_due_at": attestation.NextDueAt,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	env.AttestationDueAt = attestation.NextDueAt
+	return attestation, nil
+}
+
+func SearchEnvAttestations(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.EnvAttestation{}).Where("iac_env_attestation.env_id = ?", envId).
+		Order("iac_env_attestation.created_at DESC")
+}
+
+// CountAttestationOverdueEnvs 统计项目中合规声明已逾期的环境数量
+func CountAttestationOverdueEnvs(query *db.Session, projectId models.Id) (int64, error) {
+	return query.Model(&models.Env{}).
+		Where("project_id = ? AND archived = 0", projectId).
+		Where("attestation_interval > 0 AND attestation_due_at < ?", time.Now()).
+		Count()
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+)
+
+func TestCheckEnvAttestation(t *testing.T) {
+	past := models.Time(time.Now().Add(-time.Hour))
+	future := models.Time(time.Now().Add(time.Hour))
+
+	cases := []struct {
+		name     string
+		env      models.Env
+		taskType string
+		blocked  bool
+	}{
+		{"overdue apply", models.Env{AttestationInterval: 90, AttestationBlock: true, AttestationDueAt: &past}, common.TaskTypeApply, true},
+		{"overdue plan", models.Env{AttestationInterval: 90, AttestationBlock: true, AttestationDueAt: &past}, common.TaskTypePlan, false},
+		{"overdue destroy", models.Env{AttestationInterval: 90, AttestationBlock: true, AttestationDueAt: &past}, common.TaskTypeDestroy, false},
+		{"overdue not block", models.Env{AttestationInterval: 90, AttestationDueAt: &past}, common.TaskTypeApply, false},
+		{"not due", models.Env{AttestationInterval: 90, AttestationBlock: true, AttestationDueAt: &future}, common.TaskTypeApply, false},
+		{"interval disabled", models.Env{AttestationBlock: true, AttestationDueAt: &past}, common.TaskTypeApply, false},
+	}
+	for _, c := range cases {
+		err := CheckEnvAttestation(&c.env, c.taskType)
+		if c.blocked && (err == nil || err.Code() != e.EnvAttestationOverdue) {
+			t.Errorf("%s: expect blocked, got %v", c.name, err)
+		} else if !c.blocked && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+	}
+}
+
+func TestNextAttestationDueAt(t *testing.T) {
+	from := time.Date(2022, 1, 31, 10, 0, 0, 0, time.Local)
+	if due := NextAttestationDueAt(from, 0); due != nil {
+		t.Errorf("expect nil due time, got %v", time.Time(*due))
+	}
+	due := NextAttestationDueAt(from, 90)
+	if due == nil || !time.Time(*due).Equal(time.Date(2022, 5, 1, 10, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected due time %v", due)
+	}
+}
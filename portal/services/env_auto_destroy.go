@@ -0,0 +1,185 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/notificationrc"
+	"cloudiac/utils/logs"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var defaultAutoDestroyReminders = []time.Duration{24 * time.Hour, time.Hour}
+
+// AutoDestroyEvent 环境的自动销毁计划
+type AutoDestroyEvent struct {
+	EnvId         models.Id    `json:"envId"`
+	EnvName       string       `json:"envName"`
+	ProjectId     models.Id    `json:"projectId"`
+	ProjectName   string       `json:"projectName"`
+	Status        string       `json:"status"`
+	TTL           string       `json:"ttl"`
+	AutoDestroyAt *models.Time `json:"autoDestroyAt"`
+	Suspended     bool         `json:"suspended"` // 自动销毁是否已暂停，暂停期间到达销毁时间也不会销毁
+	CreatorId     models.Id    `json:"creatorId"`
+	Creator       string       `json:"creator"`
+}
+
+// autoDestroyPendingEnvs 已设置自动销毁时间且还未创建销毁任务的环境
+func autoDestroyPendingEnvs(query *db.Session) *db.Session {
+	return query.Where("iac_env.status IN (?)", []string{models.EnvStatusActive, models.EnvStatusFailed}).
+		Where("iac_env.archived = ?", false).
+		Where("iac_env.auto_destroy_task_id = '' AND iac_env.auto_destroy_at IS NOT NULL")
+}
+
+// QueryAutoDestroyEvents 查询 until 之前将要自动销毁的环境，按销毁时间排序
+func QueryAutoDestroyEvents(query *db.Session, orgId models.Id, projectId models.Id, until time.Time) *db.Session {
+	query = autoDestroyPendingEnvs(query.Table(models.Env{}.TableName())).
+		Where("iac_env.org_id = ? AND iac_env.auto_destroy_at <= ?", orgId, until)
+	if projectId != "" {
+		query = query.Where("iac_env.project_id = ?", projectId)
+	}
+	return query.
+		Joins("LEFT JOIN iac_project ON iac_project.id = iac_env.project_id").
+		Joins("LEFT JOIN iac_user ON iac_user.id = iac_env.creator_id").
+		Select("iac_env.id AS env_id, iac_env.name AS env_name, iac_env.project_id, " +
+			"iac_project.name AS project_name, iac_env.status, iac_env.ttl, iac_env.auto_destroy_at, " +
+			"iac_env.auto_destroy_suspended AS suspended, " +
+			"iac_env.creator_id, iac_user.name AS creator").
+		Order("iac_env.auto_destroy_at")
+}
+
+// GetAutoDestroyReminders 返回配置的自动销毁提醒提前时间，按从长到短排序，未配置时使用默认值
+func GetAutoDestroyReminders() []time.Duration {
+	return parseAutoDestroyReminders(configs.Get().AutoDestroyReminders)
+}
+
+func parseAutoDestroyReminders(reminders []string) []time.Duration {
+	if len(reminders) == 0 {
+		return defaultAutoDestroyReminders
+	}
+	rs := make([]time.Duration, 0, len(reminders))
+	for _, r := range reminders {
+		d, err := ParseTTL(r)
+		if err != nil || d <= 0 {
+			logs.Get().Warnf("invalid auto destroy reminder '%s'", r)
+			continue
+		}
+		rs = append(rs, d)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i] > rs[j] })
+	return rs
+}
+
+// dueAutoDestroyReminder 返回距离销毁 remaining 时应该发送的提醒，即提前时间不小于 remaining 的最短的提醒。
+// 设置的存活时间小于提醒时间时会立即发送该提醒，之后的提醒继续按时发送
+func dueAutoDestroyReminder(remaining time.Duration, reminders []time.Duration) (time.Duration, bool) {
+	if remaining <= 0 {
+		return 0, false
+	}
+	due, ok := time.Duration(0), false
+	for _, r := range reminders {
+		if r >= remaining && (!ok || r < due) {
+			due, ok = r, true
+		}
+	}
+	return due, ok
+}
+
+// GetAutoDestroyRemindEnvs 查询 within 时间内将要自动销毁的环境
+func GetAutoDestroyRemindEnvs(query *db.Session, now time.Time, within time.Duration) ([]*models.Env, e.Error) {
+	envs := make([]*models.Env, 0)
+	if err := autoDestroyPendingEnvs(query.Model(&models.Env{})).
+		Where("iac_env.auto_destroy_suspended = ?", false).
+		Where("iac_env.auto_destroy_at > ? AND iac_env.auto_destroy_at <= ?", now, now.Add(within)).
+		Order("iac_env.auto_destroy_at").Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return envs, nil
+}
+
+// RemindEnvAutoDestroy 检查环境是否需要发送自动销毁提醒，需要时记录并发送提醒，返回是否发送了提醒
+func RemindEnvAutoDestroy(tx *db.Session, env *models.Env, now time.Time, reminders []time.Duration) (bool, e.Error) {
+	if env.AutoDestroyAt == nil {
+		return false, nil
+	}
+	before, ok := dueAutoDestroyReminder(time.Time(*env.AutoDestroyAt).Sub(now), reminders)
+	if !ok {
+		return false, nil
+	}
+
+	// 通过唯一索引保证每个提醒只发送一次
+	if err := models.Create(tx, &models.EnvDestroyReminder{
+		OrgId:        env.OrgId,
+		ProjectId:    env.ProjectId,
+		EnvId:        env.Id,
+		DestroyAt:    *env.AutoDestroyAt,
+		RemindBefore: int(before / time.Minute),
+		RemindedAt:   models.Time(now),
+	}); err != nil {
+		if e.IsDuplicate(err) {
+			return false, nil
+		}
+		return false, e.New(e.DBError, err)
+	}
+	EnvAutoDestroySendMessage(env)
+	return true, nil
+}
+
+// EnvAutoDestroySendMessage 发送环境即将自动销毁的通知
+func EnvAutoDestroySendMessage(env *models.Env) {
+	dbSess := db.Get()
+	tpl, _ := GetTemplateById(dbSess, env.TplId)
+	project, _ := GetProjectsById(dbSess, env.ProjectId)
+	org, _ := GetOrganizationById(dbSess, env.OrgId)
+	if tpl == nil || project == nil || org == nil {
+		logs.Get().WithField("envId", env.Id).Warnf("env template, project or org not found, skip auto destroy message")
+		return
+	}
+	ns := notificationrc.NewNotificationService(&notificationrc.NotificationOptions{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		Tpl:       tpl,
+		Project:   project,
+		Org:       org,
+		Env:       env,
+		EventType: consts.EventEnvAutoDestroy,
+	})
+	logs.Get().WithField("envId", env.Id).Infof("new event: %s", ns.EventType)
+	ns.SendMessage()
+}
+
+// ExtendEnvAutoDestroy 延长环境的存活时间，在当前的销毁时间基础上推迟 d，
+// 销毁时间已过但还未开始销毁时从当前时间开始计算
+func ExtendEnvAutoDestroy(tx *db.Session, env *models.Env, d time.Duration) (*models.Env, e.Error) {
+	if env.AutoDestroyAt == nil {
+		return nil, e.New(e.EnvAutoDestroyNotSet)
+	}
+	if env.AutoDestroyTaskId != "" {
+		return nil, e.New(e.EnvAutoDestroyStarted, fmt.Errorf("auto destroy task %s created", env.AutoDestroyTaskId))
+	}
+	if d <= 0 {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid extend duration: %v", d))
+	}
+
+	base := time.Time(*env.AutoDestroyAt)
+	if now := time.Now(); base.Before(now) {
+		base = now
+	}
+	at := models.Time(base.Add(d))
+	// 通过条件更新避免与自动销毁任务的创建冲突
+	if n, err := tx.Model(&models.Env{}).Where("id = ? AND auto_destroy_task_id = ''", env.Id).
+		UpdateAttrs(models.Attrs{"auto_destroy_at": &at}); err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if n == 0 {
+		return nil, e.New(e.EnvAutoDestroyStarted, fmt.Errorf("auto destroy task created"))
+	}
+	env.AutoDestroyAt = &at
+	return env, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAutoDestroyReminders(t *testing.T) {
+	rs := parseAutoDestroyReminders([]string{"1h", "bad", "1d", "30m"})
+	want := []time.Duration{24 * time.Hour, time.Hour, 30 * time.Minute}
+	if len(rs) != len(want) {
+		t.Fatalf("reminders = %v, want %v", rs, want)
+	}
+	for i := range want {
+		if rs[i] != want[i] {
+			t.Errorf("reminders = %v, want %v", rs, want)
+		}
+	}
+	if rs := parseAutoDestroyReminders(nil); len(rs) != len(defaultAutoDestroyReminders) {
+		t.Errorf("default reminders = %v", rs)
+	}
+}
+
+func TestDueAutoDestroyReminder(t *testing.T) {
+	reminders := []time.Duration{24 * time.Hour, time.Hour}
+	cases := []struct {
+		remaining time.Duration
+		due       time.Duration
+		ok        bool
+	}{
+		{48 * time.Hour, 0, false},
+		{24 * time.Hour, 24 * time.Hour, true},
+		{2 * time.Hour, 24 * time.Hour, true},
+		{time.Hour, time.Hour, true},
+		{time.Minute, time.Hour, true},
+		{0, 0, false},
+	}
+	for _, c := range cases {
+		due, ok := dueAutoDestroyReminder(c.remaining, reminders)
+		if due != c.due || ok != c.ok {
+			t.Errorf("remaining %v: got (%v, %v), want (%v, %v)", c.remaining, due, ok, c.due, c.ok)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"time"
+)
+
+const minutesPerDay = 24 * 60
+
+// parseClock 解析 HH:MM 格式的时间，返回距离零点的分钟数
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', format should be HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func deployWindowLocation(w *models.EnvDeployWindows) (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(w.Timezone)
+}
+
+// ValidateEnvDeployWindows 校验环境部署窗口配置
+func ValidateEnvDeployWindows(w *models.EnvDeployWindows) e.Error {
+	if w.IsEmpty() {
+		return nil
+	}
+	if _, err := deployWindowLocation(w); err != nil {
+		return e.New(e.EnvDeployWindowInvalid, fmt.Errorf("invalid timezone '%s'", w.Timezone))
+	}
+	for _, win := range w.Windows {
+		for _, d := range win.Weekdays {
+			if d < 0 || d > 6 {
+				return e.New(e.EnvDeployWindowInvalid, fmt.Errorf("invalid weekday %d", d))
+			}
+		}
+		start, err := parseClock(win.StartTime)
+		if err != nil {
+			return e.New(e.EnvDeployWindowInvalid, err)
+		}
+		end, err := parseClock(win.EndTime)
+		if err != nil {
+			return e.New(e.EnvDeployWindowInvalid, err)
+		}
+		if start == end {
+			return e.New(e.EnvDeployWindowInvalid, fmt.Errorf("startTime and endTime must be different"))
+		}
+	}
+	return nil
+}
+
+func weekdayAllowed(win models.EnvDeployWindow, day time.Weekday) bool {
+	if len(win.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range win.Weekdays {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// DeployWindowNextStart 判断 now 是否处于允许部署的时间窗口内，不在窗口内时返回下一个窗口的开始时间。
+// 结束时间小于开始时间的窗口跨天，星期按窗口开始的日期计算
+func DeployWindowNextStart(w *models.EnvDeployWindows, now time.Time) (bool, time.Time) {
+	if w.IsEmpty() {
+		return true, time.Time{}
+	}
+	loc, err := deployWindowLocation(w)
+	if err != nil {
+		return true, time.Time{}
+	}
+
+	local := now.In(loc)
+	var next time.Time
+	// 从前一天开始检查，以覆盖前一天开始的跨天窗口
+	for offset := -1; offset <= 7; offset++ {
+		day := local.AddDate(0, 0, offset)
+		for _, win := range w.Windows {
+			start, err1 := parseClock(win.StartTime)
+			end, err2 := parseClock(win.EndTime)
+			if err1 != nil || err2 != nil || !weekdayAllowed(win, day.Weekday()) {
+				continue
+			}
+			duration := (end - start + minutesPerDay) % minutesPerDay
+			startAt := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc)
+			endAt := startAt.Add(time.Duration(duration) * time.Minute)
+			if !now.Before(startAt) && now.Before(endAt) {
+				return true, time.Time{}
+			}
+			if startAt.After(now) && (next.IsZero() || startAt.Before(next)) {
+				next = startAt
+			}
+		}
+	}
+	if next.IsZero() {
+		// 窗口配置无效时不限制部署
+		return true, time.Time{}
+	}
+	return false, next
+}
+
+// TaskScheduledStart 返回在环境部署窗口外提交的任务计划开始执行的时间，
+// 只有 apply 和 destroy 任务受部署窗口限制，无需等待时返回 nil
+func TaskScheduledStart(env *models.Env, taskType string, now time.Time) *models.Time {
+	if env.DeployWindows.IsEmpty() || !utils.StrInArray(taskType, common.TaskJobApply, common.TaskJobDestroy) {
+		return nil
+	}
+	in, next := DeployWindowNextStart(env.DeployWindows, now)
+	if in {
+		return nil
+	}
+	t := models.Time(next)
+	return &t
+}
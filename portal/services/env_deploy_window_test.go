@@ -0,0 +1,54 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeployWindowNextStart(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", s)
+		return tm
+	}
+	// 工作日 09:00 至 18:00，以及周六 22:00 至次日 02:00
+	w := &models.EnvDeployWindows{Timezone: "UTC", Windows: []models.EnvDeployWindow{
+		{Weekdays: []int{1, 2, 3, 4, 5}, StartTime: "09:00", EndTime: "18:00"},
+		{Weekdays: []int{6}, StartTime: "22:00", EndTime: "02:00"},
+	}}
+
+	in, _ := DeployWindowNextStart(w, at("2022-04-01 10:00")) // 周五
+	assert.True(t, in)
+	in, next := DeployWindowNextStart(w, at("2022-04-01 18:00"))
+	assert.False(t, in)
+	assert.Equal(t, at("2022-04-02 22:00"), next.UTC())
+	in, _ = DeployWindowNextStart(w, at("2022-04-03 01:00")) // 周六开始的跨天窗口
+	assert.True(t, in)
+	in, next = DeployWindowNextStart(w, at("2022-04-03 02:00"))
+	assert.False(t, in)
+	assert.Equal(t, at("2022-04-04 09:00"), next.UTC())
+
+	in, _ = DeployWindowNextStart(nil, at("2022-04-03 02:00"))
+	assert.True(t, in)
+
+	env := &models.Env{DeployWindows: w}
+	assert.Nil(t, TaskScheduledStart(env, common.TaskJobPlan, at("2022-04-03 02:00")))
+	assert.NotNil(t, TaskScheduledStart(env, common.TaskJobApply, at("2022-04-03 02:00")))
+}
+
+func TestValidateEnvDeployWindows(t *testing.T) {
+	assert.Nil(t, ValidateEnvDeployWindows(nil))
+	assert.NotNil(t, ValidateEnvDeployWindows(&models.EnvDeployWindows{Windows: []models.EnvDeployWindow{
+		{StartTime: "9:00am", EndTime: "18:00"}}}))
+	assert.NotNil(t, ValidateEnvDeployWindows(&models.EnvDeployWindows{Windows: []models.EnvDeployWindow{
+		{Weekdays: []int{7}, StartTime: "09:00", EndTime: "18:00"}}}))
+	assert.NotNil(t, ValidateEnvDeployWindows(&models.EnvDeployWindows{Timezone: "Mars/Base", Windows: []models.EnvDeployWindow{
+		{StartTime: "09:00", EndTime: "18:00"}}}))
+	assert.Nil(t, ValidateEnvDeployWindows(&models.EnvDeployWindows{Windows: []models.EnvDeployWindow{
+		{StartTime: "22:00", EndTime: "02:00"}}}))
+}
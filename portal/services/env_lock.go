@@ -0,0 +1,63 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"time"
+)
+
+// EnvLockBlocksTask 环境锁定期间，只有锁定人创建的 apply/destroy/import 任务可以执行
+func EnvLockBlocksTask(env *models.Env, taskType string, creatorId models.Id) bool {
+	if !env.Locked || env.LockedBy == creatorId {
+		return false
+	}
+	return taskType == common.TaskJobApply || taskType == common.TaskJobDestroy || taskType == common.TaskJobImport
+}
+
+// CheckEnvLock 环境被其他用户锁定时不允许创建 apply/destroy/import 任务
+func CheckEnvLock(env *models.Env, taskType string, creatorId models.Id) e.Error {
+	if !EnvLockBlocksTask(env, taskType, creatorId) {
+		return nil
+	}
+	lockedAt := ""
+	if env.LockedAt != nil {
+		lockedAt = time.Time(*env.LockedAt).Format("2006-01-02 15:04:05")
+	}
+	return e.New(e.EnvLocked, fmt.Errorf("env locked by %s at %s: %s", env.LockedBy, lockedAt, env.LockReason))
+}
+
+// LockEnv 锁定环境，环境已锁定时返回错误
+func LockEnv(tx *db.Session, envId models.Id, userId models.Id, reason string) e.Error {
+	now := models.Time(time.Now())
+	n, err := models.UpdateAttr(tx.Where("id = ? AND locked = ?", envId, false), &models.Env{}, models.Attrs{
+		"locked":      true,
+		"locked_by":   userId,
+		"locked_at":   &now,
+		"lock_reason": reason,
+	})
+	if err != nil {
+		return e.New(e.DBError, err)
+	}
+	if n == 0 {
+		return e.New(e.EnvLocked, fmt.Errorf("env %s is already locked", envId))
+	}
+	return nil
+}
+
+// UnlockEnv 解锁环境
+func UnlockEnv(tx *db.Session, envId models.Id) e.Error {
+	if _, err := models.UpdateAttr(tx.Where("id = ?", envId), &models.Env{}, models.Attrs{
+		"locked":      false,
+		"locked_by":   "",
+		"locked_at":   nil,
+		"lock_reason": "",
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckEnvLock(t *testing.T) {
+	env := &models.Env{}
+	assert.Nil(t, CheckEnvLock(env, common.TaskJobApply, "u-1"))
+
+	env.Locked, env.LockedBy, env.LockReason = true, "u-1", "migrating database"
+	assert.Nil(t, CheckEnvLock(env, common.TaskJobApply, "u-1"))
+	assert.Nil(t, CheckEnvLock(env, common.TaskJobPlan, "u-2"))
+
+	err := CheckEnvLock(env, common.TaskJobDestroy, "u-2")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.EnvLocked, err.Code())
+		assert.Contains(t, err.Error(), "migrating database")
+	}
+}
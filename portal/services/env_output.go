@@ -0,0 +1,153 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+const SensitiveValueMask = "(sensitive value)"
+
+const (
+	OutputChangeAdded   = "added"
+	OutputChangeUpdated = "updated"
+	OutputChangeRemoved = "removed"
+)
+
+// EnvOutput 环境的 terraform output
+type EnvOutput struct {
+	Name      string      `json:"name"`
+	Value     interface{} `json:"value"`
+	Sensitive bool        `json:"sensitive"`
+}
+
+// ParseTaskOutputs 解析任务保存的 outputs(见 SaveTaskOutputs)
+func ParseTaskOutputs(outputs map[string]interface{}) map[string]TfStateVariable {
+	vars := make(map[string]TfStateVariable, len(outputs))
+	for k, v := range outputs {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		tv := TfStateVariable{}
+		if err := json.Unmarshal(bs, &tv); err != nil {
+			continue
+		}
+		vars[k] = tv
+	}
+	return vars
+}
+
+func outputValue(v TfStateVariable, reveal bool) interface{} {
+	if v.Sensitive && !reveal {
+		return SensitiveValueMask
+	}
+	return v.Value
+}
+
+// EnvOutputList 按名称排序返回 outputs，reveal 为 false 时隐藏敏感 output 的值
+func EnvOutputList(outputs map[string]TfStateVariable, reveal bool) []*EnvOutput {
+	rs := make([]*EnvOutput, 0, len(outputs))
+	for name, v := range outputs {
+		rs = append(rs, &EnvOutput{Name: name, Value: outputValue(v, reveal), Sensitive: v.Sensitive})
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Name < rs[j].Name })
+	return rs
+}
+
+// OutputChange 部署任务引起的 output 值变化
+type OutputChange struct {
+	TaskId    models.Id    `json:"taskId"`
+	TaskType  string       `json:"taskType"`
+	CreatorId models.Id    `json:"creatorId"`
+	ChangedAt *models.Time `json:"changedAt"` // 任务结束时间
+	Name      string       `json:"name"`
+	Action    string       `json:"action" enums:"added,updated,removed"`
+	OldValue  interface{}  `json:"oldValue"`
+	NewValue  interface{}  `json:"newValue"`
+	Sensitive bool         `json:"sensitive"`
+}
+
+// diffTaskOutputs 比较两次部署的 outputs，返回按名称排序的变化
+func diffTaskOutputs(prev, cur map[string]TfStateVariable, reveal bool) []*OutputChange {
+	changes := make([]*OutputChange, 0)
+	for name, v := range cur {
+		old, ok := prev[name]
+		if !ok {
+			changes = append(changes, &OutputChange{Name: name, Action: OutputChangeAdded,
+				NewValue: outputValue(v, reveal), Sensitive: v.Sensitive})
+		} else if !reflect.DeepEqual(old.Value, v.Value) || old.Sensitive != v.Sensitive {
+			changes = append(changes, &OutputChange{Name: name, Action: OutputChangeUpdated,
+				OldValue: outputValue(old, reveal), NewValue: outputValue(v, reveal),
+				Sensitive: v.Sensitive || old.Sensitive})
+		}
+	}
+	for name, old := range prev {
+		if _, ok := cur[name]; !ok {
+			changes = append(changes, &OutputChange{Name: name, Action: OutputChangeRemoved,
+				OldValue: outputValue(old, reveal), Sensitive: old.Sensitive})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// buildOutputHistory 按时间顺序比较各部署任务的 outputs，返回最新的变化在前的变更记录。
+// fromStart 表示 tasks 包含环境的第一次部署，此时第一次部署的 outputs 记为新增
+func buildOutputHistory(tasks []*models.Task, fromStart bool, name string, reveal bool) []*OutputChange {
+	groups := make([][]*OutputChange, 0, len(tasks))
+	var prev map[string]TfStateVariable
+	if fromStart {
+		prev = map[string]TfStateVariable{}
+	}
+	for _, t := range tasks {
+		cur := ParseTaskOutputs(t.Result.Outputs)
+		if prev != nil {
+			changes := make([]*OutputChange, 0)
+			for _, c := range diffTaskOutputs(prev, cur, reveal) {
+				if name != "" && c.Name != name {
+					continue
+				}
+				c.TaskId, c.TaskType, c.CreatorId, c.ChangedAt = t.Id, t.Type, t.CreatorId, t.EndAt
+				changes = append(changes, c)
+			}
+			groups = append(groups, changes)
+		}
+		prev = cur
+	}
+
+	history := make([]*OutputChange, 0)
+	for i := len(groups) - 1; i >= 0; i-- {
+		history = append(history, groups[i]...)
+	}
+	return history
+}
+
+// EnvOutputHistory 查询环境最近 limit 次部署引起的 output 值变化，name 不为空时只返回该 output 的变化
+func EnvOutputHistory(tx *db.Session, envId models.Id, limit int, name string, reveal bool) ([]*OutputChange, e.Error) {
+	tasks := make([]*models.Task, 0)
+	// 多查询一个任务作为比较的基准
+	if err := tx.Model(&models.Task{}).
+		Where("env_id = ? AND type IN (?) AND status IN (?)", envId,
+			[]string{common.TaskTypeApply, common.TaskTypeDestroy},
+			[]string{models.TaskComplete, models.TaskFailed}).
+		Order("created_at DESC").Limit(limit + 1).Find(&tasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	fromStart := len(tasks) <= limit
+
+	// 按时间顺序比较，跳过没有保存 outputs 的任务(如未生成 state 的失败任务)
+	deploys := make([]*models.Task, 0, len(tasks))
+	for i := len(tasks) - 1; i >= 0; i-- {
+		if tasks[i].Result.Outputs != nil {
+			deploys = append(deploys, tasks[i])
+		}
+	}
+	return buildOutputHistory(deploys, fromStart, name, reveal), nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvOutputList(t *testing.T) {
+	outputs := ParseTaskOutputs(map[string]interface{}{
+		"ip":       map[string]interface{}{"value": "10.0.0.1"},
+		"password": map[string]interface{}{"value": "secret", "sensitive": true},
+	})
+
+	list := EnvOutputList(outputs, false)
+	assert.Equal(t, []*EnvOutput{
+		{Name: "ip", Value: "10.0.0.1"},
+		{Name: "password", Value: SensitiveValueMask, Sensitive: true},
+	}, list)
+	assert.Equal(t, "secret", EnvOutputList(outputs, true)[1].Value)
+}
+
+func TestBuildOutputHistory(t *testing.T) {
+	newTask := func(id models.Id, outputs map[string]interface{}) *models.Task {
+		task := &models.Task{Result: models.TaskResult{Outputs: outputs}}
+		task.Id = id
+		return task
+	}
+	tasks := []*models.Task{
+		newTask("run-1", map[string]interface{}{
+			"ip":       map[string]interface{}{"value": "10.0.0.1"},
+			"password": map[string]interface{}{"value": "a", "sensitive": true},
+		}),
+		newTask("run-2", map[string]interface{}{
+			"ip":       map[string]interface{}{"value": "10.0.0.2"},
+			"password": map[string]interface{}{"value": "b", "sensitive": true},
+		}),
+		newTask("run-3", map[string]interface{}{
+			"ip": map[string]interface{}{"value": "10.0.0.2"},
+		}),
+	}
+
+	history := buildOutputHistory(tasks, true, "", false)
+	assert.Len(t, history, 5)
+	// 最新的变化在前
+	assert.Equal(t, models.Id("run-3"), history[0].TaskId)
+	assert.Equal(t, OutputChangeRemoved, history[0].Action)
+	assert.Equal(t, SensitiveValueMask, history[0].OldValue)
+	assert.Equal(t, models.Id("run-2"), history[1].TaskId)
+	assert.Equal(t, "ip", history[1].Name)
+	assert.Equal(t, OutputChangeUpdated, history[1].Action)
+	assert.Equal(t, "10.0.0.1", history[1].OldValue)
+	assert.Equal(t, OutputChangeAdded, history[4].Action)
+
+	// 不包含第一次部署时只比较查询到的部署之间的变化
+	history = buildOutputHistory(tasks, false, "ip", false)
+	assert.Len(t, history, 1)
+	assert.Equal(t, "10.0.0.2", history[0].NewValue)
+}
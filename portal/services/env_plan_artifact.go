@@ -0,0 +1,146 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/utils/logs"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SaveTaskPlanArtifact 保存 plan 任务生成的 plan 产物，
+// 多工作目录云模板的 plan 任务会生成多个 plan 文件，不支持保存为产物
+func SaveTaskPlanArtifact(tx *db.Session, task *models.Task) (*models.EnvPlanArtifact, e.Error) {
+	if task.Type != common.TaskTypePlan || len(task.Workdirs) > 0 {
+		return nil, nil
+	}
+	content, err := logstorage.Get().Read(task.PlanFilePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	planJson, err := logstorage.Get().Read(task.PlanJsonPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, e.New(e.DBError, err)
+	}
+
+	env, er := GetEnvById(tx, task.EnvId)
+	if er != nil {
+		return nil, er
+	}
+	artifact := &models.EnvPlanArtifact{
+		OrgId:         task.OrgId,
+		ProjectId:     task.ProjectId,
+		EnvId:         task.EnvId,
+		TaskId:        task.Id,
+		CreatorId:     task.CreatorId,
+		Revision:      task.Revision,
+		CommitId:      task.CommitId,
+		BaseResTaskId: env.LastResTaskId,
+		Size:          len(content),
+		Sha256:        stateSha256(content),
+		PlanPath:      task.PlanFilePath(),
+		JsonPath:      task.PlanJsonPath(),
+	}
+	if len(planJson) > 0 {
+		plan, err := UnmarshalPlanJson(planJson)
+		if err != nil {
+			return nil, e.New(e.InternalError, fmt.Errorf("unmarshal plan json: %v", err))
+		}
+		artifact.ResAdded, artifact.ResChanged, artifact.ResDestroyed =
+			CountPlanChanges(plan.ResourceChanges, logs.Get().WithField("taskId", task.Id))
+	}
+	if err := models.Create(tx, artifact); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return artifact, nil
+}
+
+func QueryEnvPlanArtifacts(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.EnvPlanArtifact{}).Where("env_id = ?", envId)
+}
+
+// GetEnvPlanArtifact 查询环境的 plan 产物
+func GetEnvPlanArtifact(query *db.Session, envId models.Id, id models.Id) (*models.EnvPlanArtifact, e.Error) {
+	a := models.EnvPlanArtifact{}
+	if err := QueryEnvPlanArtifacts(query, envId).Where("id = ?", id).First(&a); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvPlanNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &a, nil
+}
+
+// ReadPlanArtifact 读取 plan 产物的内容，binary 为 true 时返回二进制 plan 文件，否则返回 plan json
+func ReadPlanArtifact(artifact *models.EnvPlanArtifact, binary bool) ([]byte, e.Error) {
+	path := artifact.JsonPath
+	if binary {
+		path = artifact.PlanPath
+	}
+	content, err := logstorage.Get().Read(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, e.New(e.EnvPlanNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return content, nil
+}
+
+// CreateApplySavedPlanTask 创建执行已保存 plan 的部署任务，任务使用 plan 时的代码版本及变量，
+// plan 步骤直接使用保存的 plan 文件，保证 apply 执行的就是该 plan 的内容。
+// pt 只需要传入创建人、冻结窗口放行记录等与执行者相关的属性
+func CreateApplySavedPlanTask(tx *db.Session, tpl *models.Template, env *models.Env,
+	artifact *models.EnvPlanArtifact, pt models.Task) (*models.Task, e.Error) {
+
+	if artifact.AppliedTaskId != "" {
+		return nil, e.New(e.EnvPlanApplied, fmt.Errorf("plan applied by task %s", artifact.AppliedTaskId))
+	}
+	if env.LastResTaskId != artifact.BaseResTaskId {
+		return nil, e.New(e.EnvPlanStale,
+			fmt.Errorf("env resources changed by task %s after plan", env.LastResTaskId))
+	}
+	planTask, er := GetTaskById(tx, artifact.TaskId)
+	if er != nil {
+		return nil, er
+	}
+
+	pt.Name = "Apply saved plan"
+	pt.KeyId = planTask.KeyId
+	pt.Variables = planTask.Variables
+	pt.AutoApprove = env.AutoApproval
+	pt.Revision = artifact.Revision
+	pt.CommitId = artifact.CommitId
+	pt.StopOnViolation = env.StopOnViolation
+	pt.BaseTask = models.BaseTask{
+		Type:     common.TaskJobApply,
+		RunnerId: env.RunnerId,
+	}
+	pt.Source = consts.TaskSourceManual
+	pt.PlanArtifactId = artifact.Id
+	task, er := CreateTask(tx, tpl, env, pt)
+	if er != nil {
+		return nil, er
+	}
+
+	// 通过条件更新避免同一个 plan 被并发执行
+	now := models.Time(time.Now())
+	if n, err := tx.Model(&models.EnvPlanArtifact{}).
+		Where("id = ? AND applied_task_id = ''", artifact.Id).
+		UpdateAttrs(models.Attrs{"applied_task_id": task.Id, "applied_at": &now}); err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if n == 0 {
+		return nil, e.New(e.EnvPlanApplied, fmt.Errorf("plan already applied"))
+	}
+	return task, nil
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+)
+
+const minPromotionStages = 2
+
+// ValidatePromotionChain 校验晋级链的各阶段环境，环境需要属于同一项目、使用同一云模板且未归档，
+// 校验通过后设置晋级链的云模板
+func ValidatePromotionChain(query *db.Session, chain *models.PromotionChain) e.Error {
+	if len(chain.Stages) < minPromotionStages {
+		return e.New(e.PromotionChainInvalid, fmt.Errorf("at least %d stages are required", minPromotionStages))
+	}
+	envIds := make([]models.Id, 0, len(chain.Stages))
+	for i, id := range chain.Stages {
+		if utils.StrInArray(id, chain.Stages[:i]...) {
+			return e.New(e.PromotionChainInvalid, fmt.Errorf("duplicate stage env '%s'", id))
+		}
+		envIds = append(envIds, models.Id(id))
+	}
+
+	envs := make([]*models.Env, 0)
+	if err := query.Model(&models.Env{}).Where("id IN (?) AND project_id = ?", envIds, chain.ProjectId).
+		Find(&envs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if len(envs) != len(envIds) {
+		return e.New(e.PromotionChainInvalid, fmt.Errorf("stage env not exists in the project"))
+	}
+	for _, env := range envs {
+		if env.Archived {
+			return e.New(e.PromotionChainInvalid, fmt.Errorf("stage env '%s' is archived", env.Name))
+		}
+		if env.TplId != envs[0].TplId {
+			return e.New(e.PromotionChainInvalid, fmt.Errorf("stage envs must use the same template"))
+		}
+	}
+	chain.TplId = envs[0].TplId
+	return nil
+}
+
+func GetPromotionChainById(query *db.Session, id models.Id) (*models.PromotionChain, e.Error) {
+	chain := models.PromotionChain{}
+	if err := query.Where("id = ?", id).First(&chain); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.PromotionChainNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &chain, nil
+}
+
+func QueryPromotionChain(query *db.Session) *db.Session {
+	return query.Model(&models.PromotionChain{})
+}
+
+func QueryEnvPromotions(query *db.Session, chainId models.Id) *db.Session {
+	return query.Model(&models.EnvPromotion{}).Where("chain_id = ?", chainId)
+}
+
+// DeletePromotionChain 删除晋级链，晋级记录保留供审计
+func DeletePromotionChain(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.PromotionChain{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// PromotionTargetEnvId 返回环境晋级的下一阶段环境
+func PromotionTargetEnvId(chain *models.PromotionChain, fromEnvId models.Id) (models.Id, e.Error) {
+	i := chain.StageIndex(fromEnvId)
+	if i < 0 {
+		return "", e.New(e.PromotionStageInvalid, fmt.Errorf("env '%s' is not a stage of the chain", fromEnvId))
+	}
+	if i == len(chain.Stages)-1 {
+		return "", e.New(e.PromotionStageInvalid, fmt.Errorf("env '%s' is the last stage of the chain", fromEnvId))
+	}
+	return models.Id(chain.Stages[i+1]), nil
+}
+
+// GetPromotionSourceTask 返回晋级使用的来源环境部署任务，未指定任务时使用来源环境最后一次部署成功的任务
+func GetPromotionSourceTask(query *db.Session, fromEnvId models.Id, taskId models.Id) (*models.Task, e.Error) {
+	if taskId == "" {
+		task, err := GetLastSuccessApplyTask(query, fromEnvId, "")
+		if err != nil && err.Code() == e.TaskNotExists {
+			return nil, e.New(e.PromotionTaskInvalid, fmt.Errorf("env has no successful apply task"))
+		}
+		return task, err
+	}
+
+	task, err := GetTaskById(query, taskId)
+	if err != nil {
+		return nil, err
+	}
+	if task.EnvId != fromEnvId || task.Type != models.TaskTypeApply || task.Status != models.TaskComplete {
+		return nil, e.New(e.PromotionTaskInvalid,
+			fmt.Errorf("task '%s' is not a successful apply task of the env", taskId))
+	}
+	return task, nil
+}
+
+// MergePromotionVars 将晋级时传入的覆盖变量合并到目标环境的变量中，同类型同名的变量被覆盖，
+// 敏感变量的值加密保存
+func MergePromotionVars(vars []models.VariableBody, overrides []models.VariableBody) ([]models.VariableBody, error) {
+	result := make([]models.VariableBody, 0, len(vars)+len(overrides))
+	for _, v := range vars {
+		overridden := false
+		for _, o := range overrides {
+			if o.Type == v.Type && o.Name == v.Name {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			result = append(result, v)
+		}
+	}
+	for _, o := range overrides {
+		o.Scope = consts.ScopeEnv
+		if o.Sensitive && o.Value != "" {
+			value, err := utils.AesEncrypt(o.Value)
+			if err != nil {
+				return nil, err
+			}
+			o.Value = value
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+// PromoteEnv 使用来源环境部署任务的分支及 commit 为下一阶段的环境创建部署任务，并记录晋级记录。
+// 任务使用目标环境自身的变量，overrides 中的变量只对本次部署生效
+func PromoteEnv(tx *db.Session, chain *models.PromotionChain, fromTask *models.Task, toEnv *models.Env,
+	overrides []models.VariableBody, pt models.Task) (*models.EnvPromotion, *models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, toEnv.TplId)
+	if err != nil {
+		return nil, nil, err
+	}
+	vars, er := GetValidVarsAndVgVars(tx, toEnv.OrgId, toEnv.ProjectId, toEnv.TplId, toEnv.Id)
+	if er != nil {
+		return nil, nil, e.New(e.DBError, er)
+	}
+	if vars, er = MergePromotionVars(vars, overrides); er != nil {
+		return nil, nil, e.New(e.InternalError, er)
+	}
+
+	pt.Name = fmt.Sprintf("Promote from %s", fromTask.EnvId)
+	pt.Variables = vars
+	pt.KeyId = toEnv.KeyId
+	pt.Revision = fromTask.Revision
+	pt.CommitId = fromTask.CommitId
+	pt.AutoApprove = toEnv.AutoApproval
+	pt.StopOnViolation = toEnv.StopOnViolation
+	pt.BaseTask = models.BaseTask{
+		Type:        models.TaskTypeApply,
+		Pipeline:    fromTask.Pipeline,
+		StepTimeout: toEnv.Timeout,
+		RunnerId:    toEnv.RunnerId,
+	}
+	pt.Source = consts.TaskSourcePromotion
+	task, err := CreateTask(tx, tpl, toEnv, pt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	overrideVars := make(models.StrSlice, 0, len(overrides))
+	for _, o := range overrides {
+		overrideVars = append(overrideVars, o.Name)
+	}
+	promotion := models.EnvPromotion{
+		OrgId:        chain.OrgId,
+		ProjectId:    chain.ProjectId,
+		ChainId:      chain.Id,
+		CreatorId:    pt.CreatorId,
+		FromEnvId:    fromTask.EnvId,
+		FromTaskId:   fromTask.Id,
+		ToEnvId:      toEnv.Id,
+		TaskId:       task.Id,
+		Revision:     task.Revision,
+		CommitId:     task.CommitId,
+		OverrideVars: overrideVars,
+	}
+	promotion.Id = promotion.NewId()
+	if err := models.Create(tx, &promotion); err != nil {
+		return nil, nil, e.New(e.DBError, err)
+	}
+	return &promotion, task, nil
+}
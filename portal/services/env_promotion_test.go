@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPromotionTargetEnvId(t *testing.T) {
+	chain := &models.PromotionChain{Stages: models.StrSlice{"env-dev", "env-staging", "env-prod"}}
+
+	to, err := PromotionTargetEnvId(chain, "env-dev")
+	assert.Nil(t, err)
+	assert.Equal(t, models.Id("env-staging"), to)
+
+	to, err = PromotionTargetEnvId(chain, "env-staging")
+	assert.Nil(t, err)
+	assert.Equal(t, models.Id("env-prod"), to)
+
+	_, err = PromotionTargetEnvId(chain, "env-prod")
+	assert.Equal(t, e.PromotionStageInvalid, err.Code())
+	_, err = PromotionTargetEnvId(chain, "env-other")
+	assert.Equal(t, e.PromotionStageInvalid, err.Code())
+}
+
+func TestMergePromotionVars(t *testing.T) {
+	vars := []models.VariableBody{
+		{Scope: consts.ScopeEnv, Type: consts.VarTypeTerraform, Name: "instance_type", Value: "t3.small"},
+		{Scope: consts.ScopeProject, Type: consts.VarTypeEnv, Name: "instance_type", Value: "keep"},
+		{Scope: consts.ScopeOrg, Type: consts.VarTypeTerraform, Name: "region", Value: "cn-hangzhou"},
+	}
+	merged, err := MergePromotionVars(vars, []models.VariableBody{
+		{Type: consts.VarTypeTerraform, Name: "instance_type", Value: "t3.large"},
+	})
+	assert.Nil(t, err)
+	assert.Len(t, merged, 3)
+	assert.Equal(t, "keep", merged[0].Value)
+	assert.Equal(t, "cn-hangzhou", merged[1].Value)
+	assert.Equal(t, "t3.large", merged[2].Value)
+	assert.Equal(t, consts.ScopeEnv, merged[2].Scope)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ValidateEnvProtection 校验环境保护规则
+func ValidateEnvProtection(p *models.EnvProtection) e.Error {
+	if p == nil {
+		return nil
+	}
+	for _, b := range p.AllowedBranches {
+		if strings.TrimSpace(b) == "" {
+			return e.New(e.EnvProtectionInvalid, fmt.Errorf("allowed branch must not be empty"), http.StatusBadRequest)
+		}
+		if _, err := utils.GlobMatch(b, ""); err != nil {
+			return e.New(e.EnvProtectionInvalid,
+				fmt.Errorf("invalid allowed branch '%s': %v", b, err), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+// EnvBranchAllowed 分支/标签是否满足环境保护规则的分支限制
+func EnvBranchAllowed(p *models.EnvProtection, revision string) bool {
+	if p == nil || len(p.AllowedBranches) == 0 {
+		return true
+	}
+	for _, b := range p.AllowedBranches {
+		if matched, _ := utils.GlobMatch(b, revision); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// EnvProtectionViolations 返回任务违反的环境保护规则。
+// 工单号只要求手动、通过 api 或晋级发起的部署任务填写，commit 自动部署、回滚等系统创建的任务不检查
+func EnvProtectionViolations(env *models.Env, task *models.Task) []string {
+	p := env.Protection
+	violations := make([]string, 0)
+	if p.IsEmpty() {
+		return violations
+	}
+	switch task.Type {
+	case common.TaskJobDestroy:
+		if p.DisallowDestroy {
+			violations = append(violations, "env is protected from destroy")
+		}
+	case common.TaskJobApply:
+		// 未设置来源的任务为手动发起
+		source := utils.FirstValueStr(task.Source, consts.TaskSourceManual)
+		if p.RequireTicket && strings.TrimSpace(task.TicketId) == "" &&
+			utils.StrInArray(source, consts.TaskSourceManual, consts.TaskSourceApi, consts.TaskSourcePromotion) {
+			violations = append(violations, "ticket id is required to deploy the env")
+		}
+		if !EnvBranchAllowed(p, task.Revision) {
+			violations = append(violations, fmt.Sprintf("revision '%s' is not allowed to deploy, allowed: %s",
+				task.Revision, strings.Join(p.AllowedBranches, ", ")))
+		}
+	}
+	return violations
+}
+
+// CheckEnvProtection 任务违反环境保护规则时返回错误，错误信息包含全部违反的规则
+func CheckEnvProtection(env *models.Env, task *models.Task) e.Error {
+	violations := EnvProtectionViolations(env, task)
+	if len(violations) == 0 {
+		return nil
+	}
+	return e.New(e.EnvProtected, fmt.Errorf("%s", strings.Join(violations, "; ")), http.StatusForbidden)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvProtectionViolations(t *testing.T) {
+	env := &models.Env{}
+	destroy := &models.Task{BaseTask: models.BaseTask{Type: common.TaskJobDestroy}}
+	assert.Empty(t, EnvProtectionViolations(env, destroy))
+
+	env.Protection = &models.EnvProtection{
+		DisallowDestroy: true,
+		RequireTicket:   true,
+		AllowedBranches: []string{"main", "release/*"},
+	}
+	assert.Len(t, EnvProtectionViolations(env, destroy), 1)
+
+	apply := &models.Task{BaseTask: models.BaseTask{Type: common.TaskJobApply}, Revision: "dev"}
+	assert.Len(t, EnvProtectionViolations(env, apply), 2)
+
+	apply.Revision = "release/v1.0"
+	apply.TicketId = "CHG-1024"
+	assert.Empty(t, EnvProtectionViolations(env, apply))
+
+	// 系统创建的部署任务不要求工单号
+	webhook := &models.Task{BaseTask: models.BaseTask{Type: common.TaskJobApply},
+		Revision: "main", Source: consts.TaskSourceWebhookApply}
+	assert.Empty(t, EnvProtectionViolations(env, webhook))
+
+	plan := &models.Task{BaseTask: models.BaseTask{Type: common.TaskJobPlan}, Revision: "dev"}
+	assert.Empty(t, EnvProtectionViolations(env, plan))
+	assert.NotNil(t, CheckEnvProtection(env, destroy))
+}
+
+func TestValidateEnvProtection(t *testing.T) {
+	assert.Nil(t, ValidateEnvProtection(nil))
+	assert.Nil(t, ValidateEnvProtection(&models.EnvProtection{AllowedBranches: []string{"release/*"}}))
+	assert.NotNil(t, ValidateEnvProtection(&models.EnvProtection{AllowedBranches: []string{"release/["}}))
+	assert.NotNil(t, ValidateEnvProtection(&models.EnvProtection{AllowedBranches: []string{" "}}))
+}
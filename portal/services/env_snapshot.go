@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"time"
+)
+
+// GetEnvEffectTaskAt 查询环境在指定时间之前最后结束的部署或销毁任务，即该时间点环境资源对应的任务
+func GetEnvEffectTaskAt(query *db.Session, envId models.Id, at time.Time) (*models.Task, e.Error) {
+	task := models.Task{}
+	err := query.Model(&models.Task{}).
+		Where("env_id = ? AND `type` IN (?)", envId, []string{common.TaskTypeApply, common.TaskTypeDestroy}).
+		Where("status IN (?)", []string{models.TaskComplete, models.TaskFailed}).
+		Where("end_at IS NOT NULL AND end_at <= ?", at).
+		Order("end_at DESC").First(&task)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &task, nil
+}
+
+// GetEnvScanTaskAt 查询环境在指定时间之前最后完成的合规扫描任务(包括部署任务的扫描)
+func GetEnvScanTaskAt(query *db.Session, envId models.Id, at time.Time) (*models.ScanTask, e.Error) {
+	task := models.ScanTask{}
+	err := query.Model(&models.ScanTask{}).
+		Where("env_id = ?", envId).
+		Where("policy_status IN (?)", []string{common.PolicyStatusPassed, common.PolicyStatusViolated}).
+		Where("end_at IS NOT NULL AND end_at <= ?", at).
+		Order("end_at DESC").First(&task)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &task, nil
+}
+
+// CountPolicyResultByStatus 统计扫描任务各状态的策略检查结果数量
+func CountPolicyResultByStatus(query *db.Session, taskId models.Id) (map[string]int, e.Error) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	if err := query.Model(&models.PolicyResult{}).
+		Select("status, count(*) as count").
+		Where("task_id = ?", taskId).
+		Group("status").Scan(&rows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	summary := make(map[string]int)
+	for _, r := range rows {
+		summary[r.Status] = r.Count
+	}
+	return summary, nil
+}
@@ -0,0 +1,155 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ValidateImportState 检查待导入的 state 文件，只支持 terraform 0.12 及以上版本的 state 格式
+func ValidateImportState(content []byte) (*RawTfState, e.Error) {
+	state, err := ParseRawTfState(content)
+	if err != nil {
+		return nil, e.New(e.EnvStateInvalid, err)
+	}
+	if state.Version != 4 {
+		return nil, e.New(e.EnvStateInvalid, fmt.Errorf("unsupported state version %d", state.Version))
+	}
+	if state.Lineage == "" {
+		return nil, e.New(e.EnvStateInvalid, fmt.Errorf("state lineage is empty"))
+	}
+	for _, r := range state.Resources {
+		if r.Type == "" || r.Name == "" {
+			return nil, e.New(e.EnvStateInvalid, fmt.Errorf("invalid resource %s.%s", r.Type, r.Name))
+		}
+	}
+	return state, nil
+}
+
+// rawStateProviderName 从 state 的 provider 配置地址中获取 provider 名称，
+// 如 module.vpc.provider["registry.terraform.io/hashicorp/aws"].west 返回 registry.terraform.io/hashicorp/aws
+func rawStateProviderName(provider string) string {
+	start := strings.Index(provider, `["`)
+	end := strings.Index(provider, `"]`)
+	if start < 0 || end < start {
+		return provider
+	}
+	return provider[start+2 : end]
+}
+
+// StateValues 将 state 文件转换为 terraform show -json 输出的 values 格式，用于统计环境资源
+func (s *RawTfState) StateValues() TfStateValues {
+	values := TfStateValues{
+		Outputs:    s.Outputs,
+		RootModule: TfStateModule{Resources: make([]TfStateResource, 0)},
+	}
+	childIdx := make(map[string]int)
+	for i := range s.Resources {
+		r := &s.Resources[i]
+		resources := make([]TfStateResource, 0, len(r.Instances))
+		for _, ins := range r.Instances {
+			index := ins.IndexKey
+			if key, ok := index.(float64); ok {
+				index = int64(key)
+			}
+			resources = append(resources, TfStateResource{
+				ProviderName: rawStateProviderName(r.Provider),
+				Address:      r.address(ins.IndexKey),
+				Mode:         r.Mode,
+				Type:         r.Type,
+				Name:         r.Name,
+				Index:        index,
+				Values:       ins.Attributes,
+			})
+		}
+
+		if r.Module == "" {
+			values.RootModule.Resources = append(values.RootModule.Resources, resources...)
+			continue
+		}
+		idx, ok := childIdx[r.Module]
+		if !ok {
+			idx = len(values.ChildModules)
+			childIdx[r.Module] = idx
+			values.ChildModules = append(values.ChildModules, TfStateModule{Address: r.Module})
+		}
+		values.ChildModules[idx].Resources = append(values.ChildModules[idx].Resources, resources...)
+	}
+	return values
+}
+
+// ImportEnvState 将外部管理的 state 导入到环境。导入会生成一条已完成的部署任务记录，
+// 并基于该任务统计环境资源及 outputs，之后环境可以像正常部署的环境一样进行 plan/apply
+func ImportEnvState(tx *db.Session, tpl *models.Template, env *models.Env, content []byte, creatorId models.Id) (*models.Task, e.Error) {
+	state, er := ValidateImportState(content)
+	if er != nil {
+		return nil, er
+	}
+
+	task, er := newCommonTask(tpl, env, models.Task{
+		Name:      "Import state",
+		CreatorId: creatorId,
+		BaseTask:  models.BaseTask{Type: common.TaskJobApply},
+		Source:    consts.TaskSourceStateImport,
+	})
+	if er != nil {
+		return nil, er
+	}
+
+	values := state.StateValues()
+	added := 0
+	for _, r := range state.Resources {
+		if r.Mode != "data" {
+			added += len(r.Instances)
+		}
+	}
+	zero := 0
+	task.Result = models.TaskResult{ResAdded: &added, ResChanged: &zero, ResDestroyed: &zero,
+		Outputs: make(map[string]interface{})}
+	for k, v := range values.Outputs {
+		task.Result.Outputs[k] = v
+	}
+	now := models.Time(time.Now())
+	task.Status = models.TaskComplete
+	task.Message = "state imported"
+	task.StartAt = &now
+	task.EndAt = &now
+
+	if err := tx.Insert(task); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := SaveTaskResources(tx, task, values, nil); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if _, er := SaveEnvStateVersion(tx, &models.EnvStateVersion{
+		OrgId:     env.OrgId,
+		ProjectId: env.ProjectId,
+		EnvId:     env.Id,
+		TaskId:    task.Id,
+		StatePath: env.StatePath,
+		Source:    models.StateVersionTask,
+		CreatorId: creatorId,
+	}, content); er != nil {
+		return nil, er
+	}
+	if _, er := UpdateEnv(tx, env.Id, models.Attrs{
+		"status":           models.EnvStatusActive,
+		"last_task_id":     task.Id,
+		"last_res_task_id": task.Id,
+	}); er != nil {
+		return nil, er
+	}
+
+	// 最后写入 backend，写入失败时事务回滚不会留下任务及资源记录
+	if er := WriteTfState(env.StatePath, content); er != nil {
+		return nil, er
+	}
+	return task, nil
+}
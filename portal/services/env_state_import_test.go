@@ -0,0 +1,41 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportStateValues(t *testing.T) {
+	_, err := ValidateImportState([]byte(`{"version": 3, "serial": 1, "lineage": "l-1"}`))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.EnvStateInvalid, err.Code())
+	}
+
+	state, err := ValidateImportState([]byte(`{"version": 4, "serial": 2, "lineage": "l-1",
+		"outputs": {"ip": {"value": "10.0.0.1", "type": "string"}},
+		"resources": [
+			{"mode": "managed", "type": "aws_instance", "name": "web",
+				"provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+				"instances": [{"index_key": 0, "attributes": {"id": "i-1"}}]},
+			{"module": "module.vpc", "mode": "managed", "type": "aws_vpc", "name": "this",
+				"provider": "module.vpc.provider[\"registry.terraform.io/hashicorp/aws\"].west",
+				"instances": [{"attributes": {"id": "vpc-1"}}]}]}`))
+	assert.Nil(t, err)
+
+	values := state.StateValues()
+	assert.Equal(t, "10.0.0.1", values.Outputs["ip"].Value)
+	if assert.Len(t, values.RootModule.Resources, 1) {
+		r := values.RootModule.Resources[0]
+		assert.Equal(t, "aws_instance.web[0]", r.Address)
+		assert.Equal(t, "registry.terraform.io/hashicorp/aws", r.ProviderName)
+		assert.Equal(t, int64(0), r.Index)
+	}
+	if assert.Len(t, values.ChildModules, 1) {
+		assert.Equal(t, "module.vpc", values.ChildModules[0].Address)
+		assert.Equal(t, "module.vpc.aws_vpc.this", values.ChildModules[0].Resources[0].Address)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// terraform consul backend 的锁路径后缀
+const tfStateLockSuffix = "/.lock"
+
+// RawTfState terraform backend 中保存的 state 文件中版本管理需要的内容
+type RawTfState struct {
+	Version   int                        `json:"version"` // state 文件格式版本，terraform 0.12 及以上版本为 4
+	Serial    int64                      `json:"serial"`
+	Lineage   string                     `json:"lineage"`
+	Outputs   map[string]TfStateVariable `json:"outputs"`
+	Resources []rawTfStateResource       `json:"resources"`
+}
+
+type rawTfStateResource struct {
+	Module    string `json:"module"`
+	Mode      string `json:"mode"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Provider  string `json:"provider"` // 如 provider["registry.terraform.io/hashicorp/aws"]
+	Instances []struct {
+		IndexKey   interface{}            `json:"index_key"`
+		Attributes map[string]interface{} `json:"attributes"`
+	} `json:"instances"`
+}
+
+// address 返回资源实例的地址，如 module.vpc.aws_subnet.private[0]
+func (r *rawTfStateResource) address(indexKey interface{}) string {
+	addr := fmt.Sprintf("%s.%s", r.Type, r.Name)
+	if r.Mode == "data" {
+		addr = "data." + addr
+	}
+	if r.Module != "" {
+		addr = r.Module + "." + addr
+	}
+	switch key := indexKey.(type) {
+	case float64:
+		addr = fmt.Sprintf("%s[%d]", addr, int64(key))
+	case string:
+		addr = fmt.Sprintf("%s[%q]", addr, key)
+	}
+	return addr
+}
+
+// ParseRawTfState 解析 terraform state 文件
+func ParseRawTfState(content []byte) (*RawTfState, error) {
+	state := RawTfState{}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// ResourceAttrs 返回 state 中每个资源实例的地址及属性
+func (s *RawTfState) ResourceAttrs() map[string]map[string]interface{} {
+	attrs := make(map[string]map[string]interface{})
+	for i := range s.Resources {
+		r := &s.Resources[i]
+		for _, ins := range r.Instances {
+			attrs[r.address(ins.IndexKey)] = ins.Attributes
+		}
+	}
+	return attrs
+}
+
+// StateResourceChange 两个 state 版本间发生变化的资源，只返回变化的属性名称，不返回属性值(可能包含敏感信息)
+type StateResourceChange struct {
+	Address string   `json:"address"`
+	Attrs   []string `json:"attrs"`
+}
+
+// StateVersionDiff 两个 state 版本间的资源差异
+type StateVersionDiff struct {
+	Added   []string               `json:"added"`   // 目标版本中新增的资源
+	Removed []string               `json:"removed"` // 目标版本中删除的资源
+	Changed []*StateResourceChange `json:"changed"` // 属性发生变化的资源
+}
+
+// DiffStateResources 比较两个 state 中的资源实例
+func DiffStateResources(from, to *RawTfState) *StateVersionDiff {
+	fromAttrs, toAttrs := from.ResourceAttrs(), to.ResourceAttrs()
+	diff := &StateVersionDiff{
+		Added:   make([]string, 0),
+		Removed: make([]string, 0),
+		Changed: make([]*StateResourceChange, 0),
+	}
+
+	for addr, attrs := range toAttrs {
+		oldAttrs, ok := fromAttrs[addr]
+		if !ok {
+			diff.Added = append(diff.Added, addr)
+			continue
+		}
+		changed := make([]string, 0)
+		for k, v := range attrs {
+			if !reflect.DeepEqual(oldAttrs[k], v) {
+				changed = append(changed, k)
+			}
+		}
+		for k := range oldAttrs {
+			if _, ok := attrs[k]; !ok {
+				changed = append(changed, k)
+			}
+		}
+		if len(changed) > 0 {
+			sort.Strings(changed)
+			diff.Changed = append(diff.Changed, &StateResourceChange{Address: addr, Attrs: changed})
+		}
+	}
+	for addr := range fromAttrs {
+		if _, ok := toAttrs[addr]; !ok {
+			diff.Removed = append(diff.Removed, addr)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].Address < diff.Changed[j].Address })
+	return diff
+}
+
+// SetTfStateSerial 修改 state 内容中的 serial，其他内容保持不变
+func SetTfStateSerial(content []byte, serial int64) ([]byte, error) {
+	state := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, err
+	}
+	state["serial"] = json.RawMessage(fmt.Sprintf("%d", serial))
+	return json.MarshalIndent(state, "", "  ")
+}
+
+func consulKV() (*api.KV, e.Error) {
+	config := api.DefaultConfig()
+	config.Address = configs.Get().Consul.Address
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, e.New(e.ConsulConnError, err)
+	}
+	return client.KV(), nil
+}
+
+// ReadTfState 读取 backend 中的 state 内容，state 不存在时返回 nil
+func ReadTfState(statePath string) ([]byte, e.Error) {
+	kv, er := consulKV()
+	if er != nil {
+		return nil, er
+	}
+	pair, _, err := kv.Get(statePath, nil)
+	if err != nil {
+		return nil, e.New(e.ConsulConnError, err)
+	}
+	if pair == nil {
+		return nil, nil
+	}
+	return pair.Value, nil
+}
+
+// WriteTfState 写入 state 内容到 backend，state 被 terraform 锁定时返回错误
+func WriteTfState(statePath string, content []byte) e.Error {
+	kv, er := consulKV()
+	if er != nil {
+		return er
+	}
+	lock, _, err := kv.Get(strings.TrimSuffix(statePath, "/")+tfStateLockSuffix, nil)
+	if err != nil {
+		return e.New(e.ConsulConnError, err)
+	}
+	if lock != nil && lock.Session != "" {
+		return e.New(e.EnvDeploying, fmt.Errorf("state %s is locked", statePath))
+	}
+	if _, err := kv.Put(&api.KVPair{Key: statePath, Value: content}, nil); err != nil {
+		return e.New(e.ConsulConnError, err)
+	}
+	return nil
+}
+
+func stateSha256(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetLastEnvStateVersion 查询环境工作目录的最新 state 版本，不存在时返回 nil
+func GetLastEnvStateVersion(tx *db.Session, envId models.Id, workdir string) (*models.EnvStateVersion, e.Error) {
+	version := models.EnvStateVersion{}
+	if err := tx.Where("env_id = ? AND workdir = ?", envId, workdir).
+		Order("version DESC").First(&version); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &version, nil
+}
+
+// SaveEnvStateVersion 保存 state 内容为环境的新版本，与该工作目录最新版本内容相同时不生成新版本并返回 nil。
+// version 中需要设置环境、工作目录、state 路径及来源等信息，版本号及 state 摘要信息由该函数填充
+func SaveEnvStateVersion(tx *db.Session, version *models.EnvStateVersion, content []byte) (*models.EnvStateVersion, e.Error) {
+	state, err := ParseRawTfState(content)
+	if err != nil {
+		return nil, e.New(e.EnvStateInvalid, err)
+	}
+	version.Sha256 = stateSha256(content)
+	version.Serial = state.Serial
+	version.Lineage = state.Lineage
+	version.ResourceCount = len(state.ResourceAttrs())
+
+	last, er := GetLastEnvStateVersion(tx, version.EnvId, version.Workdir)
+	if er != nil {
+		return nil, er
+	}
+	if last != nil && last.Sha256 == version.Sha256 && version.Source != models.StateVersionRestore {
+		return nil, nil
+	}
+
+	maxVersion := 0
+	if err := tx.Model(&models.EnvStateVersion{}).Where("env_id = ?", version.EnvId).
+		Select("COALESCE(MAX(version), 0)").Row().Scan(&maxVersion); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	version.Version = maxVersion + 1
+	version.Id = models.NewId("stv")
+
+	if err := logstorage.Get().Write(version.ContentPath(), content); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := models.Create(tx, version); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return version, nil
+}
+
+// SaveTaskStateVersions 保存任务执行后环境各工作目录的 state
+func SaveTaskStateVersions(tx *db.Session, task *models.Task) e.Error {
+	workdirs := []string{""}
+	if len(task.Workdirs) > 0 {
+		workdirs = task.Workdirs
+	}
+	for _, wd := range workdirs {
+		statePath := (&models.TaskStep{Workdir: wd}).StatePath(task.StatePath)
+		content, err := ReadTfState(statePath)
+		if err != nil {
+			return err
+		}
+		if len(content) == 0 {
+			continue
+		}
+		if _, err := SaveEnvStateVersion(tx, &models.EnvStateVersion{
+			OrgId:     task.OrgId,
+			ProjectId: task.ProjectId,
+			EnvId:     task.EnvId,
+			TaskId:    task.Id,
+			Workdir:   wd,
+			StatePath: statePath,
+			Source:    models.StateVersionTask,
+			CreatorId: task.CreatorId,
+		}, content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryEnvStateVersions 查询环境的 state 版本
+func QueryEnvStateVersions(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.EnvStateVersion{}).Where("env_id = ?", envId)
+}
+
+// GetEnvStateVersion 按版本号查询环境的 state 版本
+func GetEnvStateVersion(query *db.Session, envId models.Id, version int) (*models.EnvStateVersion, e.Error) {
+	v := models.EnvStateVersion{}
+	if err := QueryEnvStateVersions(query, envId).Where("version = ?", version).First(&v); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.EnvStateVersionNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &v, nil
+}
+
+// ReadEnvStateVersion 读取 state 版本的内容
+func ReadEnvStateVersion(version *models.EnvStateVersion) ([]byte, e.Error) {
+	content, err := logstorage.Get().Read(version.ContentPath())
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return content, nil
+}
+
+// RestoreEnvStateVersion 将环境工作目录的 state 恢复为历史版本的内容。
+// 恢复前备份当前 state，恢复后的 serial 为当前 serial 加 1，避免 terraform 认为 state 已过期
+func RestoreEnvStateVersion(tx *db.Session, target *models.EnvStateVersion, userId models.Id, reason string) (
+	backup *models.EnvStateVersion, restored *models.EnvStateVersion, er e.Error) {
+
+	content, er := ReadEnvStateVersion(target)
+	if er != nil {
+		return nil, nil, er
+	}
+
+	serial := target.Serial
+	current, er := ReadTfState(target.StatePath)
+	if er != nil {
+		return nil, nil, er
+	}
+	if len(current) > 0 {
+		currState, err := ParseRawTfState(current)
+		if err != nil {
+			return nil, nil, e.New(e.EnvStateInvalid, err)
+		}
+		if currState.Serial > serial {
+			serial = currState.Serial
+		}
+		backup, er = SaveEnvStateVersion(tx, &models.EnvStateVersion{
+			OrgId:     target.OrgId,
+			ProjectId: target.ProjectId,
+			EnvId:     target.EnvId,
+			Workdir:   target.Workdir,
+			StatePath: target.StatePath,
+			Source:    models.StateVersionBackup,
+			CreatorId: userId,
+		}, current)
+		if er != nil {
+			return nil, nil, er
+		}
+	}
+
+	newContent, err := SetTfStateSerial(content, serial+1)
+	if err != nil {
+		return nil, nil, e.New(e.EnvStateInvalid, err)
+	}
+	restored, er = SaveEnvStateVersion(tx, &models.EnvStateVersion{
+		OrgId:              target.OrgId,
+		ProjectId:          target.ProjectId,
+		EnvId:              target.EnvId,
+		Workdir:            target.Workdir,
+		StatePath:          target.StatePath,
+		Source:             models.StateVersionRestore,
+		RestoreFromId:      target.Id,
+		RestoreFromVersion: target.Version,
+		CreatorId:          userId,
+		RestoreReason:      reason,
+	}, newContent)
+	if er != nil {
+		return nil, nil, er
+	}
+	// 最后写入 backend，写入失败时事务回滚不会留下版本记录
+	if er := WriteTfState(target.StatePath, newContent); er != nil {
+		return nil, nil, er
+	}
+	return backup, restored, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffStateResources(t *testing.T) {
+	from, err := ParseRawTfState([]byte(`{"serial": 3, "lineage": "l-1", "resources": [
+		{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [
+			{"index_key": 0, "attributes": {"id": "i-1", "tags": {"env": "dev"}}},
+			{"index_key": 1, "attributes": {"id": "i-2"}}]},
+		{"module": "module.db", "mode": "data", "type": "aws_ami", "name": "ubuntu", "instances": [
+			{"attributes": {"id": "ami-1"}}]}]}`))
+	assert.NoError(t, err)
+	to, err := ParseRawTfState([]byte(`{"serial": 4, "lineage": "l-1", "resources": [
+		{"mode": "managed", "type": "aws_instance", "name": "web", "instances": [
+			{"index_key": 0, "attributes": {"id": "i-1", "tags": {"env": "prod"}, "ami": "ami-1"}}]},
+		{"mode": "managed", "type": "aws_s3_bucket", "name": "b", "instances": [
+			{"index_key": "logs", "attributes": {"id": "logs"}}]},
+		{"module": "module.db", "mode": "data", "type": "aws_ami", "name": "ubuntu", "instances": [
+			{"attributes": {"id": "ami-1"}}]}]}`))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), from.Serial)
+
+	diff := DiffStateResources(from, to)
+	assert.Equal(t, []string{`aws_s3_bucket.b["logs"]`}, diff.Added)
+	assert.Equal(t, []string{"aws_instance.web[1]"}, diff.Removed)
+	if assert.Len(t, diff.Changed, 1) {
+		assert.Equal(t, "aws_instance.web[0]", diff.Changed[0].Address)
+		assert.Equal(t, []string{"ami", "tags"}, diff.Changed[0].Attrs)
+	}
+	assert.Contains(t, to.ResourceAttrs(), "module.db.data.aws_ami.ubuntu")
+}
+
+func TestSetTfStateSerial(t *testing.T) {
+	content, err := SetTfStateSerial([]byte(`{"version": 4, "serial": 3, "lineage": "l-1", "resources": []}`), 8)
+	assert.NoError(t, err)
+	state, err := ParseRawTfState(content)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), state.Serial)
+	assert.Equal(t, "l-1", state.Lineage)
+}
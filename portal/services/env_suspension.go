@@ -0,0 +1,149 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"time"
+)
+
+// envJobSuspendColumns 定时任务对应的环境暂停标记字段
+var envJobSuspendColumns = map[string]string{
+	models.EnvJobAutoDestroy: "auto_destroy_suspended",
+	models.EnvJobDrift:       "drift_suspended",
+	models.EnvJobAutoDeploy:  "auto_deploy_suspended",
+}
+
+// checkEnvJobs 校验定时任务名称，为空时返回所有定时任务
+func checkEnvJobs(jobs []string) ([]string, e.Error) {
+	if len(jobs) == 0 {
+		return models.EnvScheduledJobs, nil
+	}
+	rs := make([]string, 0, len(jobs))
+	for _, j := range jobs {
+		if _, ok := envJobSuspendColumns[j]; !ok {
+			return nil, e.New(e.EnvSuspendJobInvalid, fmt.Errorf("invalid env job '%s'", j))
+		}
+		if !utils.StrInArray(j, rs...) {
+			rs = append(rs, j)
+		}
+	}
+	return rs, nil
+}
+
+// EnvSuspendedJobs 返回环境当前暂停的定时任务
+func EnvSuspendedJobs(env *models.Env) []string {
+	jobs := make([]string, 0)
+	if env.AutoDestroySuspended {
+		jobs = append(jobs, models.EnvJobAutoDestroy)
+	}
+	if env.DriftSuspended {
+		jobs = append(jobs, models.EnvJobDrift)
+	}
+	if env.AutoDeploySuspended {
+		jobs = append(jobs, models.EnvJobAutoDeploy)
+	}
+	return jobs
+}
+
+// SuspendEnvJobs 暂停环境的定时任务，jobs 为空时暂停所有定时任务。
+// 环境已有暂停的定时任务时合并暂停，暂停原因及自动恢复时间使用本次的设置
+func SuspendEnvJobs(tx *db.Session, env *models.Env, jobs []string, reason string,
+	userId models.Id, until *models.Time) (*models.Env, e.Error) {
+
+	jobs, er := checkEnvJobs(jobs)
+	if er != nil {
+		return nil, er
+	}
+	if until != nil && !time.Time(*until).After(time.Now()) {
+		return nil, e.New(e.BadParam, fmt.Errorf("suspend until must be in the future"))
+	}
+
+	now := models.Time(time.Now())
+	attrs := models.Attrs{
+		"suspended_by":   userId,
+		"suspended_at":   &now,
+		"suspend_until":  until,
+		"suspend_reason": reason,
+	}
+	for _, j := range jobs {
+		attrs[envJobSuspendColumns[j]] = true
+	}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", env.Id), &models.Env{}, attrs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if err := models.Create(tx, &models.EnvSuspension{
+		OrgId:       env.OrgId,
+		ProjectId:   env.ProjectId,
+		EnvId:       env.Id,
+		Jobs:        jobs,
+		Reason:      reason,
+		SuspendedBy: userId,
+		Until:       until,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return GetEnvById(tx, env.Id)
+}
+
+// ResumeEnvJobs 恢复环境的定时任务，jobs 为空时恢复所有定时任务，
+// 所有定时任务都恢复后清除暂停信息并记录恢复人
+func ResumeEnvJobs(tx *db.Session, env *models.Env, jobs []string, userId models.Id) (*models.Env, e.Error) {
+	jobs, er := checkEnvJobs(jobs)
+	if er != nil {
+		return nil, er
+	}
+
+	attrs := models.Attrs{}
+	for _, j := range jobs {
+		attrs[envJobSuspendColumns[j]] = false
+	}
+	remain := make([]string, 0)
+	for _, j := range EnvSuspendedJobs(env) {
+		if !utils.StrInArray(j, jobs...) {
+			remain = append(remain, j)
+		}
+	}
+	if len(remain) == 0 {
+		attrs["suspended_by"] = ""
+		attrs["suspended_at"] = nil
+		attrs["suspend_until"] = nil
+		attrs["suspend_reason"] = ""
+	}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", env.Id), &models.Env{}, attrs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	if len(remain) == 0 {
+		now := models.Time(time.Now())
+		if _, err := models.UpdateAttr(tx.Where("env_id = ? AND resumed_at IS NULL", env.Id),
+			&models.EnvSuspension{}, models.Attrs{"resumed_by": userId, "resumed_at": &now}); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+	return GetEnvById(tx, env.Id)
+}
+
+// ResumeExpiredEnvSuspensions 恢复暂停已到期的环境定时任务，返回恢复的环境数量
+func ResumeExpiredEnvSuspensions(tx *db.Session, now time.Time) (int, e.Error) {
+	envs := make([]*models.Env, 0)
+	if err := tx.Model(&models.Env{}).Where("suspend_until IS NOT NULL AND suspend_until <= ?", now).
+		Find(&envs); err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	for _, env := range envs {
+		if _, err := ResumeEnvJobs(tx, env, nil, consts.SysUserId); err != nil {
+			return 0, err
+		}
+	}
+	return len(envs), nil
+}
+
+func QueryEnvSuspensions(query *db.Session, envId models.Id) *db.Session {
+	return query.Model(&models.EnvSuspension{}).Where("env_id = ?", envId)
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestCheckEnvJobs(t *testing.T) {
+	jobs, err := checkEnvJobs(nil)
+	if err != nil || len(jobs) != len(models.EnvScheduledJobs) {
+		t.Errorf("empty jobs = %v, %v", jobs, err)
+	}
+	jobs, err = checkEnvJobs([]string{models.EnvJobDrift, models.EnvJobDrift, models.EnvJobAutoDeploy})
+	if err != nil || len(jobs) != 2 {
+		t.Errorf("jobs = %v, %v", jobs, err)
+	}
+	if _, err := checkEnvJobs([]string{"scan"}); err == nil || err.Code() != e.EnvSuspendJobInvalid {
+		t.Errorf("invalid job error = %v", err)
+	}
+}
+
+func TestEnvSuspendedJobs(t *testing.T) {
+	env := &models.Env{AutoDestroySuspended: true, AutoDeploySuspended: true}
+	jobs := EnvSuspendedJobs(env)
+	if len(jobs) != 2 || jobs[0] != models.EnvJobAutoDestroy || jobs[1] != models.EnvJobAutoDeploy {
+		t.Errorf("suspended jobs = %v", jobs)
+	}
+}
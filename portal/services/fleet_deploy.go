@@ -0,0 +1,333 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ValidateFleetDeploy 校验批量部署参数
+func ValidateFleetDeploy(fd *models.FleetDeploy) e.Error {
+	sel := fd.Selector
+	if len(sel.TplIds) == 0 && sel.Labels == "" && len(sel.ProjectIds) == 0 && len(sel.EnvIds) == 0 {
+		return e.New(e.FleetDeployInvalid, fmt.Errorf("env selector is empty"))
+	}
+	if sel.Labels != "" {
+		if _, err := ParseLabelSelector(sel.Labels); err != nil {
+			return e.New(e.FleetDeployInvalid, err)
+		}
+	}
+	for _, c := range sel.Criticalities {
+		if !utils.StrInArray(c, models.EnvCriticalityProd, models.EnvCriticalityStaging, models.EnvCriticalityDev) {
+			return e.New(e.FleetDeployInvalid, fmt.Errorf("invalid criticality '%s'", c))
+		}
+	}
+	if !utils.StrInArray(fd.TaskType, common.TaskJobPlan, common.TaskJobApply) {
+		return e.New(e.FleetDeployInvalid, fmt.Errorf("invalid task type '%s'", fd.TaskType))
+	}
+	if fd.Concurrency <= 0 {
+		return e.New(e.FleetDeployInvalid, fmt.Errorf("concurrency must be positive"))
+	}
+	if !utils.StrInArray(fd.FailurePolicy, models.FleetFailurePolicyStop, models.FleetFailurePolicyContinue) {
+		return e.New(e.FleetDeployInvalid, fmt.Errorf("invalid failure policy '%s'", fd.FailurePolicy))
+	}
+	return nil
+}
+
+// QueryFleetSelectorEnvs 查询符合批量部署筛选条件的环境，已归档及未部署(inactive)的环境不会被选中
+func QueryFleetSelectorEnvs(query *db.Session, orgId models.Id, sel *models.FleetDeploySelector) (*db.Session, e.Error) {
+	query = query.Model(&models.Env{}).Where("iac_env.org_id = ? AND iac_env.archived = ? AND iac_env.status != ?",
+		orgId, false, models.EnvStatusInactive)
+	if len(sel.TplIds) > 0 {
+		query = query.Where("iac_env.tpl_id IN (?)", sel.TplIds)
+	}
+	if len(sel.ProjectIds) > 0 {
+		query = query.Where("iac_env.project_id IN (?)", sel.ProjectIds)
+	}
+	if len(sel.EnvIds) > 0 {
+		query = query.Where("iac_env.id IN (?)", sel.EnvIds)
+	}
+	if len(sel.Criticalities) > 0 {
+		query = query.Where("iac_env.criticality IN (?)", sel.Criticalities)
+	}
+	if sel.Labels != "" {
+		selectors, err := ParseLabelSelector(sel.Labels)
+		if err != nil {
+			return nil, e.New(e.FleetDeployInvalid, err)
+		}
+		for _, s := range selectors {
+			sub := query.New().Model(&models.TemplateLabel{}).Select("tpl_id").Where("label_key = ?", s.Key)
+			if s.Value != "" {
+				sub = sub.Where("label_value = ?", s.Value)
+			}
+			query = query.Where("iac_env.tpl_id IN (?)", sub.Expr())
+		}
+	}
+	return query, nil
+}
+
+// SortFleetEnvs 按环境重要程度排序，dev 环境最先部署，prod 环境最后部署
+func SortFleetEnvs(envs []*models.Env) {
+	sort.SliceStable(envs, func(i, j int) bool {
+		return models.EnvCriticalityPriority(envs[i].Criticality) < models.EnvCriticalityPriority(envs[j].Criticality)
+	})
+}
+
+// CreateFleetDeploy 创建批量部署及各环境的部署记录，环境按传入顺序部署
+func CreateFleetDeploy(tx *db.Session, fd models.FleetDeploy, envs []*models.Env) (*models.FleetDeploy, e.Error) {
+	if fd.Id == "" {
+		fd.Id = fd.NewId()
+	}
+	fd.Status = models.FleetDeployRunning
+	if err := models.Create(tx, &fd); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	items := make([]*models.FleetDeployItem, 0, len(envs))
+	for i, env := range envs {
+		item := &models.FleetDeployItem{
+			OrgId:     fd.OrgId,
+			FleetId:   fd.Id,
+			ProjectId: env.ProjectId,
+			EnvId:     env.Id,
+			EnvName:   env.Name,
+			Seq:       i,
+			Status:    models.FleetItemPending,
+		}
+		item.Id = item.NewId()
+		items = append(items, item)
+	}
+	if err := models.CreateBatch(tx, items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &fd, nil
+}
+
+func GetFleetDeployById(query *db.Session, id models.Id) (*models.FleetDeploy, e.Error) {
+	fd := models.FleetDeploy{}
+	if err := query.Where("id = ?", id).First(&fd); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.FleetDeployNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &fd, nil
+}
+
+func QueryFleetDeploy(query *db.Session) *db.Session {
+	return query.Model(&models.FleetDeploy{})
+}
+
+func QueryFleetDeployItems(query *db.Session, fleetId models.Id) *db.Session {
+	return query.Model(&models.FleetDeployItem{}).Where("fleet_id = ?", fleetId)
+}
+
+// GetRunningFleetDeploys 查询执行中的批量部署
+func GetRunningFleetDeploys(query *db.Session) ([]*models.FleetDeploy, e.Error) {
+	fds := make([]*models.FleetDeploy, 0)
+	if err := query.Where("status = ?", models.FleetDeployRunning).Order("created_at").Find(&fds); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return fds, nil
+}
+
+// GetFleetDeployProgress 统计批量部署各状态的环境数量
+func GetFleetDeployProgress(query *db.Session, fleetIds []models.Id) (map[models.Id]*models.FleetDeployProgress, e.Error) {
+	progress := make(map[models.Id]*models.FleetDeployProgress, len(fleetIds))
+	if len(fleetIds) == 0 {
+		return progress, nil
+	}
+
+	counts := make([]struct {
+		FleetId models.Id
+		Status  string
+		Count   int
+	}, 0)
+	if err := query.Model(&models.FleetDeployItem{}).Where("fleet_id IN (?)", fleetIds).
+		Select("fleet_id, status, COUNT(*) AS count").Group("fleet_id, status").Scan(&counts); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	for _, id := range fleetIds {
+		progress[id] = &models.FleetDeployProgress{}
+	}
+	for _, c := range counts {
+		p, ok := progress[c.FleetId]
+		if !ok {
+			continue
+		}
+		p.Total += c.Count
+		switch c.Status {
+		case models.FleetItemPending:
+			p.Pending = c.Count
+		case models.FleetItemRunning:
+			p.Running = c.Count
+		case models.FleetItemComplete:
+			p.Complete = c.Count
+		case models.FleetItemFailed:
+			p.Failed = c.Count
+		case models.FleetItemSkipped:
+			p.Skipped = c.Count
+		}
+	}
+	return progress, nil
+}
+
+// FleetDeployNextAction 根据当前进度返回可以启动部署的环境数量，所有环境部署结束
+// (或失败后停止且没有执行中的环境)时返回批量部署的最终状态
+func FleetDeployNextAction(fd *models.FleetDeploy, p *models.FleetDeployProgress) (toStart int, finalStatus string) {
+	stopping := fd.FailurePolicy == models.FleetFailurePolicyStop && p.Failed > 0
+	if p.Running == 0 && (p.Pending == 0 || stopping) {
+		if p.Failed > 0 {
+			return 0, models.FleetDeployFailed
+		}
+		return 0, models.FleetDeployComplete
+	}
+	if stopping {
+		return 0, ""
+	}
+
+	toStart = fd.Concurrency - p.Running
+	if toStart > p.Pending {
+		toStart = p.Pending
+	}
+	if toStart < 0 {
+		toStart = 0
+	}
+	return toStart, ""
+}
+
+// SyncFleetDeployItems 同步执行中环境的部署任务状态，任务结束后更新环境的部署结果
+func SyncFleetDeployItems(tx *db.Session, fleetId models.Id) e.Error {
+	items := make([]*models.FleetDeployItem, 0)
+	if err := QueryFleetDeployItems(tx, fleetId).Where("status = ?", models.FleetItemRunning).Find(&items); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	for _, item := range items {
+		status, message := "", ""
+		task, err := GetTaskById(tx, item.TaskId)
+		if err != nil && err.Code() == e.TaskNotExists {
+			status, message = models.FleetItemFailed, "task not exists"
+		} else if err != nil {
+			return err
+		} else if !task.Exited() {
+			continue
+		} else if task.Status == models.TaskComplete {
+			status = models.FleetItemComplete
+		} else {
+			status, message = models.FleetItemFailed, fmt.Sprintf("task %s: %s", task.Status, task.Message)
+		}
+		if err := updateFleetDeployItem(tx, item.Id, status, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func updateFleetDeployItem(tx *db.Session, id models.Id, status string, message string) e.Error {
+	now := models.Time(time.Now())
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.FleetDeployItem{}, models.Attrs{
+		"status":  status,
+		"message": message,
+		"end_at":  &now,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// GetPendingFleetDeployItems 按部署顺序查询未启动的环境
+func GetPendingFleetDeployItems(tx *db.Session, fleetId models.Id, limit int) ([]*models.FleetDeployItem, e.Error) {
+	items := make([]*models.FleetDeployItem, 0)
+	if err := QueryFleetDeployItems(tx, fleetId).Where("status = ?", models.FleetItemPending).
+		Order("seq").Limit(limit).Find(&items); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return items, nil
+}
+
+// CreateFleetDeployTask 为批量部署中的环境创建部署任务，任务使用环境当前的配置及变量
+func CreateFleetDeployTask(tx *db.Session, fd *models.FleetDeploy, env *models.Env) (*models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+	vars, er := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if er != nil {
+		return nil, e.New(e.DBError, er)
+	}
+
+	pt := models.Task{
+		Name:            fmt.Sprintf("Fleet deploy %s", fd.Name),
+		CreatorId:       fd.CreatorId,
+		Variables:       vars,
+		AutoApprove:     env.AutoApproval,
+		StopOnViolation: env.StopOnViolation,
+		BaseTask: models.BaseTask{
+			Type:        fd.TaskType,
+			StepTimeout: env.Timeout,
+		},
+		Source: consts.TaskSourceFleetDeploy,
+	}
+	return CreateTask(tx, tpl, env, pt)
+}
+
+// StartFleetDeployItem 创建环境的部署任务并将环境标记为执行中
+func StartFleetDeployItem(tx *db.Session, fd *models.FleetDeploy, item *models.FleetDeployItem) e.Error {
+	env, err := GetEnvById(tx, item.EnvId)
+	if err != nil {
+		return err
+	}
+	task, err := CreateFleetDeployTask(tx, fd, env)
+	if err != nil {
+		return err
+	}
+
+	now := models.Time(time.Now())
+	if _, err := models.UpdateAttr(tx.Where("id = ?", item.Id), &models.FleetDeployItem{}, models.Attrs{
+		"task_id":  task.Id,
+		"status":   models.FleetItemRunning,
+		"start_at": &now,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	item.TaskId, item.Status, item.StartAt = task.Id, models.FleetItemRunning, &now
+	return nil
+}
+
+// FailFleetDeployItem 环境部署任务创建失败时记录失败原因
+func FailFleetDeployItem(tx *db.Session, item *models.FleetDeployItem, message string) e.Error {
+	return updateFleetDeployItem(tx, item.Id, models.FleetItemFailed, message)
+}
+
+// FinishFleetDeploy 结束批量部署，未启动的环境标记为已跳过
+func FinishFleetDeploy(tx *db.Session, fd *models.FleetDeploy, status string, message string) e.Error {
+	now := models.Time(time.Now())
+	if _, err := models.UpdateAttr(QueryFleetDeployItems(tx, fd.Id).Where("status = ?", models.FleetItemPending),
+		&models.FleetDeployItem{}, models.Attrs{"status": models.FleetItemSkipped, "end_at": &now}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	attrs := models.Attrs{"status": status, "message": message, "end_at": &now}
+	if status == models.FleetDeployStopped {
+		attrs["stopped_by"] = fd.StoppedBy
+	}
+	n, err := models.UpdateAttr(tx.Where("id = ? AND status = ?", fd.Id, models.FleetDeployRunning),
+		&models.FleetDeploy{}, attrs)
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.FleetDeployNotRunning, fmt.Errorf("fleet deploy %s is not running", fd.Id))
+	}
+	fd.Status, fd.Message, fd.EndAt = status, message, &now
+	return nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFleetDeployNextAction(t *testing.T) {
+	cases := []struct {
+		policy   string
+		progress models.FleetDeployProgress
+		toStart  int
+		status   string
+	}{
+		{policy: models.FleetFailurePolicyStop, progress: models.FleetDeployProgress{Pending: 5}, toStart: 3},
+		{policy: models.FleetFailurePolicyStop, progress: models.FleetDeployProgress{Pending: 5, Running: 2}, toStart: 1},
+		{policy: models.FleetFailurePolicyStop, progress: models.FleetDeployProgress{Pending: 1, Running: 1}, toStart: 1},
+		{policy: models.FleetFailurePolicyStop, progress: models.FleetDeployProgress{Complete: 4}, status: models.FleetDeployComplete},
+		// 有环境失败后等待执行中的环境结束，不再启动新的环境
+		{policy: models.FleetFailurePolicyStop, progress: models.FleetDeployProgress{Pending: 3, Running: 1, Failed: 1}},
+		{policy: models.FleetFailurePolicyStop, progress: models.FleetDeployProgress{Pending: 3, Failed: 1}, status: models.FleetDeployFailed},
+		{policy: models.FleetFailurePolicyContinue, progress: models.FleetDeployProgress{Pending: 3, Running: 1, Failed: 1}, toStart: 2},
+		{policy: models.FleetFailurePolicyContinue, progress: models.FleetDeployProgress{Complete: 3, Failed: 1}, status: models.FleetDeployFailed},
+	}
+	for i, c := range cases {
+		fd := &models.FleetDeploy{Concurrency: 3, FailurePolicy: c.policy}
+		toStart, status := FleetDeployNextAction(fd, &c.progress)
+		assert.Equal(t, c.toStart, toStart, "case %d", i)
+		assert.Equal(t, c.status, status, "case %d", i)
+	}
+}
+
+func TestValidateFleetDeploy(t *testing.T) {
+	fd := &models.FleetDeploy{
+		TaskType:      "apply",
+		Concurrency:   1,
+		FailurePolicy: models.FleetFailurePolicyStop,
+	}
+	assert.NotNil(t, ValidateFleetDeploy(fd))
+
+	fd.Selector.Labels = "team=payments"
+	assert.Nil(t, ValidateFleetDeploy(fd))
+
+	fd.TaskType = "destroy"
+	assert.NotNil(t, ValidateFleetDeploy(fd))
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var freezeCronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow)
+
+// 未配置任务类型时默认冻结的任务类型
+var defaultFreezeTaskTypes = []string{common.TaskTypeApply, common.TaskTypeDestroy}
+
+// 计算冻结期时最多检查的 cron 触发次数，避免配置错误(时长不小于触发间隔)的窗口导致死循环
+const maxFreezeCronRuns = 1000
+
+func CreateFreezeWindow(tx *db.Session, w models.FreezeWindow) (*models.FreezeWindow, e.Error) {
+	if w.Id == "" {
+		w.Id = w.NewId()
+	}
+	if err := models.Create(tx, &w); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.NameDuplicate, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &w, nil
+}
+
+func UpdateFreezeWindow(tx *db.Session, id models.Id, attrs models.Attrs) (*models.FreezeWindow, e.Error) {
+	w := &models.FreezeWindow{}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.FreezeWindow{}, attrs); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.NameDuplicate, err)
+		}
+		return nil, e.New(e.DBError, fmt.Errorf("update freeze window error: %v", err))
+	}
+	if err := tx.Where("id = ?", id).First(w); err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("query freeze window error: %v", err))
+	}
+	return w, nil
+}
+
+func DeleteFreezeWindow(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("id = ?", id).Delete(&models.FreezeWindow{}); err != nil {
+		return e.New(e.DBError, fmt.Errorf("delete freeze window error: %v", err))
+	}
+	return nil
+}
+
+func GetFreezeWindowById(query *db.Session, id models.Id) (*models.FreezeWindow, e.Error) {
+	w := models.FreezeWindow{}
+	if err := query.Where("id = ?", id).First(&w); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.FreezeWindowNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &w, nil
+}
+
+func QueryFreezeWindow(query *db.Session) *db.Session {
+	return query.Model(&models.FreezeWindow{})
+}
+
+// ValidateFreezeWindow 校验冻结窗口的时间配置
+func ValidateFreezeWindow(w *models.FreezeWindow) e.Error {
+	switch w.Type {
+	case models.FreezeWindowCron:
+		if _, err := freezeCronParser.Parse(w.Cron); err != nil {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("invalid cron '%s': %v", w.Cron, err))
+		}
+		if w.Duration <= 0 {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("duration must be positive"))
+		}
+		loc, err := freezeWindowLocation(w)
+		if err != nil {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("invalid timezone '%s'", w.Timezone))
+		}
+		// 冻结时长不小于触发间隔时冻结期首尾相连，窗口永远不会结束
+		schedule, _ := freezeCronParser.Parse(w.Cron)
+		if interval := minCronInterval(schedule, time.Now().In(loc)); time.Duration(w.Duration)*time.Minute >= interval {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("duration must be less than cron interval %v", interval))
+		}
+	case models.FreezeWindowRange:
+		if w.StartAt == nil || w.EndAt == nil || !time.Time(*w.EndAt).After(time.Time(*w.StartAt)) {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("endAt must be after startAt"))
+		}
+	default:
+		return e.New(e.FreezeWindowInvalid, fmt.Errorf("invalid type '%s'", w.Type))
+	}
+
+	for _, typ := range w.TaskTypes {
+		if !utils.StrInArray(typ, common.TaskTypePlan, common.TaskTypeApply, common.TaskTypeDestroy) {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("invalid task type '%s'", typ))
+		}
+	}
+	for _, c := range w.Criticalities {
+		if !utils.StrInArray(c, models.EnvCriticalityProd, models.EnvCriticalityStaging, models.EnvCriticalityDev) {
+			return e.New(e.FreezeWindowInvalid, fmt.Errorf("invalid criticality '%s'", c))
+		}
+	}
+	return nil
+}
+
+// freezeWindowLocation 返回 cron 表达式使用的时区，未配置时使用服务器时区
+func freezeWindowLocation(w *models.FreezeWindow) (*time.Location, error) {
+	if w.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(w.Timezone)
+}
+
+// minCronInterval 返回 cron 相邻两次触发时间的最小间隔，最多检查 maxFreezeCronRuns 次触发
+func minCronInterval(schedule cron.Schedule, from time.Time) time.Duration {
+	var interval time.Duration
+	prev := schedule.Next(from)
+	for i := 0; i < maxFreezeCronRuns && !prev.IsZero(); i++ {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if d := next.Sub(prev); interval == 0 || d < interval {
+			interval = d
+		}
+		prev = next
+	}
+	return interval
+}
+
+// FreezeWindowActiveUntil 判断 now 是否处于冻结期，处于冻结期时返回冻结的结束时间
+func FreezeWindowActiveUntil(w *models.FreezeWindow, now time.Time) (bool, time.Time) {
+	switch w.Type {
+	case models.FreezeWindowRange:
+		if w.StartAt == nil || w.EndAt == nil {
+			return false, time.Time{}
+		}
+		start, end := time.Time(*w.StartAt), time.Time(*w.EndAt)
+		if !now.Before(start) && now.Before(end) {
+			return true, end
+		}
+	case models.FreezeWindowCron:
+		schedule, err := freezeCronParser.Parse(w.Cron)
+		if err != nil || w.Duration <= 0 {
+			return false, time.Time{}
+		}
+		loc, err := freezeWindowLocation(w)
+		if err != nil {
+			return false, time.Time{}
+		}
+
+		// 在 (now - duration, now] 之间有冻结开始时间即处于冻结期，
+		// 相邻的冻结期可能重叠，结束时间取最后一个开始时间加上时长
+		duration := time.Duration(w.Duration) * time.Minute
+		start := schedule.Next(now.In(loc).Add(-duration))
+		if start.After(now) {
+			return false, time.Time{}
+		}
+		end := start.Add(duration)
+		next := schedule.Next(start)
+		for i := 0; i < maxFreezeCronRuns && !next.IsZero() && !next.After(end); i++ {
+			end = next.Add(duration)
+			next = schedule.Next(next)
+		}
+		return true, end
+	}
+	return false, time.Time{}
+}
+
+// MatchFreezeWindow 从 windows 中查找对任务生效且处于冻结期的窗口
+func MatchFreezeWindow(windows []*models.FreezeWindow, projectId models.Id, criticality string,
+	taskType string, now time.Time) (*models.FreezeWindow, time.Time) {
+	for _, w := range windows {
+		if !w.Enabled || (w.ProjectId != "" && w.ProjectId != projectId) {
+			continue
+		}
+		taskTypes := []string(w.TaskTypes)
+		if len(taskTypes) == 0 {
+			taskTypes = defaultFreezeTaskTypes
+		}
+		if !utils.StrInArray(taskType, taskTypes...) {
+			continue
+		}
+		if len(w.Criticalities) > 0 && !utils.StrInArray(criticality, w.Criticalities...) {
+			continue
+		}
+		if active, until := FreezeWindowActiveUntil(w, now); active {
+			return w, until
+		}
+	}
+	return nil, time.Time{}
+}
+
+// GetOrgFreezeWindows 查询组织下所有启用的冻结窗口
+func GetOrgFreezeWindows(query *db.Session, orgId models.Id) ([]*models.FreezeWindow, e.Error) {
+	windows := make([]*models.FreezeWindow, 0)
+	if err := QueryFreezeWindow(query).Where("org_id = ? AND enabled = ?", orgId, true).
+		Order("created_at").Find(&windows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return windows, nil
+}
+
+// GetEnvActiveFreezeWindow 查询对环境及任务类型生效且处于冻结期的窗口，不处于冻结期时返回 nil
+func GetEnvActiveFreezeWindow(query *db.Session, env *models.Env, taskType string) (*models.FreezeWindow, time.Time, e.Error) {
+	windows, err := GetOrgFreezeWindows(query, env.OrgId)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	w, until := MatchFreezeWindow(windows, env.ProjectId, env.Criticality, taskType, time.Now())
+	return w, until, nil
+}
+
+func CreateFreezeOverride(tx *db.Session, o models.FreezeOverride) (*models.FreezeOverride, e.Error) {
+	if o.Id == "" {
+		o.Id = o.NewId()
+	}
+	if err := models.Create(tx, &o); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &o, nil
+}
+
+func QueryFreezeOverride(query *db.Session) *db.Session {
+	return query.Model(&models.FreezeOverride{})
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreezeWindowActiveUntil(t *testing.T) {
+	// 周五 18:00 至周一 08:00
+	weekend := &models.FreezeWindow{Type: models.FreezeWindowCron, Cron: "0 18 * * 5", Duration: 62 * 60, Timezone: "UTC"}
+	at := func(s string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", s)
+		return tm
+	}
+
+	active, until := FreezeWindowActiveUntil(weekend, at("2022-04-02 12:00")) // 周六
+	assert.True(t, active)
+	assert.Equal(t, at("2022-04-04 08:00"), until.UTC())
+
+	active, _ = FreezeWindowActiveUntil(weekend, at("2022-04-01 17:59")) // 周五冻结开始前
+	assert.False(t, active)
+	active, _ = FreezeWindowActiveUntil(weekend, at("2022-04-04 08:00")) // 周一冻结结束
+	assert.False(t, active)
+
+	start, end := models.Time(at("2022-04-10 00:00")), models.Time(at("2022-04-11 00:00"))
+	rng := &models.FreezeWindow{Type: models.FreezeWindowRange, StartAt: &start, EndAt: &end}
+	active, until = FreezeWindowActiveUntil(rng, at("2022-04-10 12:00"))
+	assert.True(t, active)
+	assert.Equal(t, at("2022-04-11 00:00"), until)
+	active, _ = FreezeWindowActiveUntil(rng, at("2022-04-11 00:00"))
+	assert.False(t, active)
+}
+
+func TestFreezeWindowDurationNotLessThanInterval(t *testing.T) {
+	// 每小时触发且冻结 60 分钟，冻结期首尾相连
+	hourly := &models.FreezeWindow{Type: models.FreezeWindowCron, Cron: "0 * * * *", Duration: 60, Timezone: "UTC"}
+	assert.NotNil(t, ValidateFreezeWindow(hourly))
+	hourly.Duration = 59
+	assert.Nil(t, ValidateFreezeWindow(hourly))
+	// 每天 9 点及 10 点触发，最小间隔为 1 小时
+	assert.NotNil(t, ValidateFreezeWindow(&models.FreezeWindow{
+		Type: models.FreezeWindowCron, Cron: "0 9,10 * * *", Duration: 90, Timezone: "UTC"}))
+
+	// 已保存的错误配置不会导致死循环
+	hourly.Duration = 60
+	now := time.Date(2022, 4, 1, 12, 30, 0, 0, time.UTC)
+	done := make(chan bool)
+	go func() {
+		active, until := FreezeWindowActiveUntil(hourly, now)
+		assert.True(t, active)
+		assert.True(t, until.After(now))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("FreezeWindowActiveUntil does not return")
+	}
+}
+
+func TestMatchFreezeWindow(t *testing.T) {
+	now := time.Now()
+	start, end := models.Time(now.Add(-time.Hour)), models.Time(now.Add(time.Hour))
+	prod := &models.FreezeWindow{
+		Enabled: true, Type: models.FreezeWindowRange, StartAt: &start, EndAt: &end,
+		ProjectId: "p-1", Criticalities: models.StrSlice{models.EnvCriticalityProd},
+	}
+	windows := []*models.FreezeWindow{prod}
+
+	w, _ := MatchFreezeWindow(windows, "p-1", models.EnvCriticalityProd, common.TaskTypeApply, now)
+	assert.Equal(t, prod, w)
+	w, _ = MatchFreezeWindow(windows, "p-1", models.EnvCriticalityProd, common.TaskTypePlan, now)
+	assert.Nil(t, w)
+	w, _ = MatchFreezeWindow(windows, "p-1", models.EnvCriticalityDev, common.TaskTypeApply, now)
+	assert.Nil(t, w)
+	w, _ = MatchFreezeWindow(windows, "p-2", models.EnvCriticalityProd, common.TaskTypeDestroy, now)
+	assert.Nil(t, w)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+)
+
+// planEnvResourceCount 统计 plan 执行后环境中的资源数量(不包括 data source)
+func planEnvResourceCount(plan *TfPlan) int {
+	count := 0
+	for _, r := range plan.ResourceChanges {
+		if r.Mode == "data" || utils.SliceEqualStr(r.Change.Actions, []string{"delete"}) {
+			continue
+		}
+		count += 1
+	}
+	return count
+}
+
+func checkGuardrails(conf configs.GuardrailsConfig, variables int, planJson []byte) ([]string, error) {
+	violations := make([]string, 0)
+	if conf.MaxVariables > 0 && variables > conf.MaxVariables {
+		violations = append(violations,
+			fmt.Sprintf("variables count %d exceeds the limit %d", variables, conf.MaxVariables))
+	}
+	if conf.MaxPlanSize > 0 && len(planJson) > conf.MaxPlanSize*1024 {
+		violations = append(violations,
+			fmt.Sprintf("plan size %dKB exceeds the limit %dKB", len(planJson)/1024, conf.MaxPlanSize))
+	}
+	if conf.MaxEnvResources > 0 && len(planJson) > 0 {
+		plan, err := UnmarshalPlanJson(planJson)
+		if err != nil {
+			return nil, err
+		}
+		if n := planEnvResourceCount(plan); n > conf.MaxEnvResources {
+			violations = append(violations,
+				fmt.Sprintf("environment resources count %d exceeds the limit %d", n, conf.MaxEnvResources))
+		}
+	}
+	return violations, nil
+}
+
+// CheckTaskGuardrails 根据 plan 结果检查任务是否超出配置的环境资源规模限制，返回超出的限制项
+func CheckTaskGuardrails(task *models.Task, planJson []byte) ([]string, error) {
+	return checkGuardrails(configs.Get().Guardrails, len(task.Variables), planJson)
+}
+
+// RequireTaskGuardrailApproval 记录任务超出的限制项，并将后续的 apply/destroy 步骤设置为需要审批(包括开启了自动审批的任务)
+func RequireTaskGuardrailApproval(tx *db.Session, task *models.Task, afterStep int, violations []string) e.Error {
+	task.GuardrailViolations = violations
+	if _, err := tx.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("guardrail_violations", task.GuardrailViolations); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if _, err := tx.Model(&models.TaskStep{}).
+		Where("task_id = ? AND `index` > ?", task.Id, afterStep).
+		Where("type IN (?)", []string{common.TaskStepTfApply, common.TaskStepTfDestroy}).
+		UpdateColumn("must_approval", true); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"testing"
+)
+
+func TestCheckGuardrails(t *testing.T) {
+	plan := []byte(`{"resource_changes": [
+		{"mode": "managed", "change": {"actions": ["no-op"]}},
+		{"mode": "managed", "change": {"actions": ["create"]}},
+		{"mode": "managed", "change": {"actions": ["delete"]}},
+		{"mode": "data", "change": {"actions": ["read"]}}
+	]}`)
+
+	cases := []struct {
+		conf       configs.GuardrailsConfig
+		variables  int
+		violations int
+	}{
+		{configs.GuardrailsConfig{}, 100, 0},
+		{configs.GuardrailsConfig{MaxEnvResources: 2}, 0, 0},
+		{configs.GuardrailsConfig{MaxEnvResources: 1}, 0, 1},
+		{configs.GuardrailsConfig{MaxVariables: 3, MaxPlanSize: 1}, 4, 1},
+		{configs.GuardrailsConfig{MaxEnvResources: 1, MaxVariables: 3}, 4, 2},
+	}
+	for i, c := range cases {
+		violations, err := checkGuardrails(c.conf, c.variables, plan)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(violations) != c.violations {
+			t.Errorf("case %d: violations = %v, want %d", i, violations, c.violations)
+		}
+	}
+}
@@ -82,3 +82,15 @@ func GetKeyById(query *db.Session, id models.Id, decrypt bool) (*models.Key, e.E
 	}
 	return &key, nil
 }
+
+// GetRepoPrivateKey 返回 clone 代码使用的 SSH 部署密钥(加密后传给 runner)，keyId 为空时返回空字符串
+func GetRepoPrivateKey(query *db.Session, keyId models.Id) (string, e.Error) {
+	if keyId == "" {
+		return "", nil
+	}
+	key, err := GetKeyById(query, keyId, false)
+	if err != nil {
+		return "", err
+	}
+	return utils.EncodeSecretVar(key.Content, true), nil
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	LaunchFieldString  = "string"
+	LaunchFieldNumber  = "number"
+	LaunchFieldInteger = "integer"
+	LaunchFieldBoolean = "boolean"
+)
+
+// 默认值推导表达式中对其他字段的引用，如 ${project}
+var launchFormRefRegex = regexp.MustCompile(`\$\{([^}]+)}`)
+
+func launchFormRefs(expr string) []string {
+	refs := make([]string, 0)
+	for _, m := range launchFormRefRegex.FindAllStringSubmatch(expr, -1) {
+		refs = append(refs, strings.TrimSpace(m[1]))
+	}
+	return refs
+}
+
+// ValidateLaunchForm 检查部署表单定义，保存云模板时调用
+func ValidateLaunchForm(form *models.TemplateLaunchForm) e.Error {
+	if form == nil {
+		return nil
+	}
+	if form.Type != "" && form.Type != "object" {
+		return e.New(e.TplLaunchFormInvalid, fmt.Errorf("launch form type must be 'object'"))
+	}
+
+	groups := make(map[string]bool)
+	for _, g := range form.Groups {
+		groups[g.Name] = true
+	}
+	for _, name := range form.Required {
+		if _, ok := form.Properties[name]; !ok {
+			return e.New(e.TplLaunchFormInvalid, fmt.Errorf("required field '%s' not defined", name))
+		}
+	}
+
+	for name, field := range form.Properties {
+		switch field.Type {
+		case LaunchFieldString, LaunchFieldNumber, LaunchFieldInteger, LaunchFieldBoolean:
+		default:
+			return e.New(e.TplLaunchFormInvalid, fmt.Errorf("field '%s': unsupported type '%s'", name, field.Type))
+		}
+		if field.Group != "" && !groups[field.Group] {
+			return e.New(e.TplLaunchFormInvalid, fmt.Errorf("field '%s': group '%s' not defined", name, field.Group))
+		}
+		if field.Pattern != "" {
+			if _, err := regexp.Compile(field.Pattern); err != nil {
+				return e.New(e.TplLaunchFormInvalid, fmt.Errorf("field '%s': invalid pattern: %v", name, err))
+			}
+		}
+		if field.Default != nil {
+			if err := checkLaunchFieldValue(field, *field.Default); err != nil {
+				return e.New(e.TplLaunchFormInvalid, fmt.Errorf("field '%s': invalid default: %v", name, err))
+			}
+		}
+		for ref := range field.VisibleIf {
+			if _, ok := form.Properties[ref]; !ok || ref == name {
+				return e.New(e.TplLaunchFormInvalid, fmt.Errorf("field '%s': invalid visible condition field '%s'", name, ref))
+			}
+		}
+		for _, ref := range launchFormRefs(field.DefaultFrom) {
+			if _, ok := form.Properties[ref]; !ok || ref == name {
+				return e.New(e.TplLaunchFormInvalid, fmt.Errorf("field '%s': invalid default reference '%s'", name, ref))
+			}
+		}
+	}
+
+	// 条件显示及默认值推导不允许循环依赖
+	deps := func(field models.LaunchFormField) []string {
+		refs := launchFormRefs(field.DefaultFrom)
+		for ref := range field.VisibleIf {
+			refs = append(refs, ref)
+		}
+		return refs
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("circular dependency on field '%s'", name)
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, ref := range deps(form.Properties[name]) {
+			if err := visit(ref); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+	for name := range form.Properties {
+		if err := visit(name); err != nil {
+			return e.New(e.TplLaunchFormInvalid, err)
+		}
+	}
+	return nil
+}
+
+func checkLaunchFieldValue(field models.LaunchFormField, value string) error {
+	switch field.Type {
+	case LaunchFieldBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("'%s' is not a boolean", value)
+		}
+	case LaunchFieldNumber, LaunchFieldInteger:
+		var n float64
+		if field.Type == LaunchFieldInteger {
+			i, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("'%s' is not an integer", value)
+			}
+			n = float64(i)
+		} else {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("'%s' is not a number", value)
+			}
+			n = f
+		}
+		if field.Minimum != nil && n < *field.Minimum {
+			return fmt.Errorf("must be greater than or equal to %v", *field.Minimum)
+		}
+		if field.Maximum != nil && n > *field.Maximum {
+			return fmt.Errorf("must be less than or equal to %v", *field.Maximum)
+		}
+	case LaunchFieldString:
+		length := utf8.RuneCountInString(value)
+		if field.MinLength > 0 && length < field.MinLength {
+			return fmt.Errorf("length must be at least %d", field.MinLength)
+		}
+		if field.MaxLength > 0 && length > field.MaxLength {
+			return fmt.Errorf("length must be at most %d", field.MaxLength)
+		}
+		if field.Pattern != "" {
+			if ok, _ := regexp.MatchString(field.Pattern, value); !ok {
+				return fmt.Errorf("'%s' does not match pattern '%s'", value, field.Pattern)
+			}
+		}
+	}
+	if len(field.Enum) > 0 {
+		for _, v := range field.Enum {
+			if v == value {
+				return nil
+			}
+		}
+		return fmt.Errorf("'%s' is not one of %v", value, field.Enum)
+	}
+	return nil
+}
+
+// ResolveLaunchForm 按部署表单处理创建环境时传入的变量值，values 为变量名称到值的映射。
+// 未传值的字段依次使用默认值及推导的默认值填充，隐藏字段的值被移除，返回处理后的值；
+// 可见字段缺少必填值或值不满足校验规则时返回错误
+func ResolveLaunchForm(form *models.TemplateLaunchForm, values map[string]string) (map[string]string, e.Error) {
+	resolved := make(map[string]string, len(values))
+	for k, v := range values {
+		resolved[k] = v
+	}
+	if form == nil {
+		return resolved, nil
+	}
+
+	names := make([]string, 0, len(form.Properties))
+	for name := range form.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := resolved[name]; !ok && form.Properties[name].Default != nil {
+			resolved[name] = *form.Properties[name].Default
+		}
+	}
+	// 推导的默认值可以引用其他推导字段，循环直到没有新的字段可以推导
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			field := form.Properties[name]
+			if _, ok := resolved[name]; ok || field.DefaultFrom == "" {
+				continue
+			}
+			ready := true
+			for _, ref := range launchFormRefs(field.DefaultFrom) {
+				if _, ok := resolved[ref]; !ok {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				resolved[name] = launchFormRefRegex.ReplaceAllStringFunc(field.DefaultFrom, func(s string) string {
+					return resolved[strings.TrimSpace(launchFormRefRegex.FindStringSubmatch(s)[1])]
+				})
+				changed = true
+			}
+		}
+	}
+
+	// 字段可见需要满足自身的条件，且条件依赖的字段也可见
+	visible := make(map[string]bool)
+	var isVisible func(name string) bool
+	isVisible = func(name string) bool {
+		if v, ok := visible[name]; ok {
+			return v
+		}
+		visible[name] = false // 避免依赖循环导致无限递归
+		v := true
+		for ref, want := range form.Properties[name].VisibleIf {
+			if !isVisible(ref) || resolved[ref] != want {
+				v = false
+				break
+			}
+		}
+		visible[name] = v
+		return v
+	}
+
+	required := make(map[string]bool)
+	for _, name := range form.Required {
+		required[name] = true
+	}
+	errs := make([]string, 0)
+	for _, name := range names {
+		if !isVisible(name) {
+			delete(resolved, name)
+			continue
+		}
+		value, ok := resolved[name]
+		if !ok || value == "" {
+			if required[name] {
+				errs = append(errs, fmt.Sprintf("%s: required", name))
+			}
+			continue
+		}
+		if err := checkLaunchFieldValue(form.Properties[name], value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, e.New(e.EnvLaunchFormInvalid, fmt.Errorf("%s", strings.Join(errs, "; ")))
+	}
+	return resolved, nil
+}
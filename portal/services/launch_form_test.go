@@ -0,0 +1,96 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testLaunchForm = `{
+  "type": "object",
+  "required": ["project", "instance_type"],
+  "x-groups": [{"name": "compute", "title": "计算"}],
+  "properties": {
+    "project": {"type": "string", "pattern": "^[a-z][a-z0-9-]*$", "maxLength": 16},
+    "vpc_name": {"type": "string", "x-default-from": "${project}-vpc"},
+    "instance_type": {"type": "string", "enum": ["small", "large"], "default": "small", "x-group": "compute"},
+    "enable_backup": {"type": "boolean", "default": "false"},
+    "backup_days": {"type": "integer", "minimum": 1, "maximum": 30, "default": "7", "x-visible-if": {"enable_backup": "true"}}
+  }
+}`
+
+func parseTestLaunchForm(t *testing.T, s string) *models.TemplateLaunchForm {
+	form := models.TemplateLaunchForm{}
+	if err := json.Unmarshal([]byte(s), &form); err != nil {
+		t.Fatal(err)
+	}
+	return &form
+}
+
+func TestValidateLaunchForm(t *testing.T) {
+	if err := ValidateLaunchForm(parseTestLaunchForm(t, testLaunchForm)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	invalids := []string{
+		`{"type": "object", "properties": {"a": {"type": "list"}}}`,
+		`{"type": "object", "required": ["b"], "properties": {"a": {"type": "string"}}}`,
+		`{"type": "object", "properties": {"a": {"type": "string", "x-group": "none"}}}`,
+		`{"type": "object", "properties": {"a": {"type": "integer", "default": "x"}}}`,
+		`{"type": "object", "properties": {"a": {"type": "string", "x-default-from": "${b}"}}}`,
+		`{"type": "object", "properties": {
+			"a": {"type": "string", "x-default-from": "${b}"},
+			"b": {"type": "string", "x-visible-if": {"a": "1"}}}}`,
+	}
+	for _, s := range invalids {
+		if err := ValidateLaunchForm(parseTestLaunchForm(t, s)); err == nil {
+			t.Errorf("expect error for %s", s)
+		}
+	}
+}
+
+func TestResolveLaunchForm(t *testing.T) {
+	form := parseTestLaunchForm(t, testLaunchForm)
+
+	cases := []struct {
+		values map[string]string
+		want   map[string]string
+		hasErr bool
+	}{
+		{
+			values: map[string]string{"project": "pay", "backup_days": "10", "other": "x"},
+			want: map[string]string{
+				"project": "pay", "vpc_name": "pay-vpc", "instance_type": "small",
+				"enable_backup": "false", "other": "x",
+			},
+		},
+		{
+			values: map[string]string{"project": "pay", "vpc_name": "main", "enable_backup": "true"},
+			want: map[string]string{
+				"project": "pay", "vpc_name": "main", "instance_type": "small",
+				"enable_backup": "true", "backup_days": "7",
+			},
+		},
+		{values: map[string]string{}, hasErr: true},
+		{values: map[string]string{"project": "Pay"}, hasErr: true},
+		{values: map[string]string{"project": "pay", "instance_type": "huge"}, hasErr: true},
+		{values: map[string]string{"project": "pay", "enable_backup": "true", "backup_days": "60"}, hasErr: true},
+	}
+	for i, c := range cases {
+		got, err := ResolveLaunchForm(form, c.values)
+		if c.hasErr {
+			if err == nil {
+				t.Errorf("case %d: expect error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: got %v, want %v", i, got, c.want)
+		}
+	}
+}
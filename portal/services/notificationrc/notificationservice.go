@@ -11,6 +11,7 @@ import (
 	"cloudiac/utils/logs"
 	"cloudiac/utils/mail"
 	"fmt"
+	"time"
 )
 
 type NotificationService struct {
@@ -65,9 +66,14 @@ func (ns *NotificationService) SyncSendMessage() {
 		logger.Debugln("no notifications")
 		return
 	}
+	// 环境自动销毁提醒等环境事件没有关联的任务，使用环境的创建人
+	creatorId := ns.Env.CreatorId
+	if ns.Task != nil {
+		creatorId = ns.Task.CreatorId
+	}
 	u := models.User{}
-	if err := db.Get().Where("id = ?", ns.Task.CreatorId).First(&u); err != nil {
-		logs.Get().Warnf("get task creator(%s): %v", ns.Task.CreatorId, err)
+	if err := db.Get().Where("id = ?", creatorId).First(&u); err != nil {
+		logs.Get().Warnf("get creator(%s): %v", creatorId, err)
 		return
 	}
 
@@ -84,6 +90,8 @@ func (ns *NotificationService) SyncSendMessage() {
 		ResDestroyed *int
 		Message      string
 		TaskType     string
+		ScheduledAt  string
+		DestroyAt    string
 	}{
 		Creator:      u.Name,
 		OrgName:      ns.Org.Name,
@@ -91,13 +99,23 @@ func (ns *NotificationService) SyncSendMessage() {
 		TemplateName: ns.Tpl.Name,
 		Revision:     ns.Tpl.RepoRevision,
 		EnvName:      ns.Env.Name,
+		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}
+		Addr: fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s", configs.Get().Portal.Address, ns.Org.Id, ns.ProjectId, ns.Env.Id),
+	}
+	if ns.Task != nil {
 		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
-		Addr:         fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, ns.Org.Id, ns.ProjectId, ns.Env.Id, ns.Task.Id),
-		ResAdded:     ns.Task.Result.ResAdded,
-		ResChanged:   ns.Task.Result.ResChanged,
-		ResDestroyed: ns.Task.Result.ResDestroyed,
-		Message:      ns.Task.Message,
-		TaskType:     ns.Task.Type,
+		data.Addr = fmt.Sprintf("%s/task/%s", data.Addr, ns.Task.Id)
+		data.ResAdded = ns.Task.Result.ResAdded
+		data.ResChanged = ns.Task.Result.ResChanged
+		data.ResDestroyed = ns.Task.Result.ResDestroyed
+		data.Message = ns.Task.Message
+		data.TaskType = ns.Task.Type
+		if ns.Task.ScheduledAt != nil {
+			data.ScheduledAt = time.Time(*ns.Task.ScheduledAt).Format("2006-01-02 15:04:05")
+		}
+	}
+	if ns.Env.AutoDestroyAt != nil {
+		data.DestroyAt = time.Time(*ns.Env.AutoDestroyAt).Format("2006-01-02 15:04:05")
 	}
 
 	// 获取消息通知模板
@@ -198,6 +216,12 @@ func (ns *NotificationService) FindNotificationsAndMessageTpl() ([]models.Notifi
 	case consts.EventTaskComplete:
 		tplNotificationTemplate = consts.IacTaskCompleteTpl
 		markdownNotificationTemplate = consts.IacTaskCompleteMarkdown
+	case consts.EventTaskScheduled:
+		tplNotificationTemplate = consts.IacTaskScheduledTpl
+		markdownNotificationTemplate = consts.IacTaskScheduledMarkdown
+	case consts.EventEnvAutoDestroy:
+		tplNotificationTemplate = consts.IacEnvAutoDestroyTpl
+		markdownNotificationTemplate = consts.IacEnvAutoDestroyMarkdown
 	case consts.EvenvtCronDrift:
 		if ns.Task.Type == models.TaskTypeApply && ns.Task.IsDriftTask {
 			tplNotificationTemplate = consts.IacCronDriftApplyTaskTpl
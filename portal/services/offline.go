@@ -0,0 +1,41 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+)
+
+// CheckTaskOffline 离线模式下检查作业使用的镜像是否可以从内网拉取，在创建作业时报错，避免 runner 启动容器时才失败。
+// registry 模块在创建作业查询模块信息时检查(见 tfRegistryModulesBase)
+func CheckTaskOffline(flow models.PipelineTask) e.Error {
+	if !configs.Get().Offline.Enabled {
+		return nil
+	}
+
+	steps := append([]models.PipelineStep{}, flow.Steps...)
+	for _, s := range []*models.PipelineStep{flow.OnSuccess, flow.OnFail} {
+		if s != nil {
+			steps = append(steps, *s)
+		}
+	}
+	if flow.Image != "" {
+		if err := runner.CheckOfflineImage(flow.Image); err != nil {
+			return e.New(e.TaskOfflineCheckFailed, err, http.StatusBadRequest)
+		}
+	}
+	for _, s := range steps {
+		if s.Image == "" {
+			continue
+		}
+		if err := runner.CheckOfflineImage(s.Image); err != nil {
+			return e.New(e.TaskOfflineCheckFailed, fmt.Errorf("step '%s': %v", s.Name, err), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
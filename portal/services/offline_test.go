@@ -0,0 +1,47 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTaskOffline(t *testing.T) {
+	configs.Set(configs.Config{Offline: configs.OfflineConfig{Enabled: true}})
+	defer configs.Set(configs.Config{})
+
+	flow := models.PipelineTask{Steps: []models.PipelineStep{{Name: "test", Image: "harbor.example.com:8443/tools/python:3.9"}}}
+	assert.Nil(t, CheckTaskOffline(flow))
+
+	flow.OnFail = &models.PipelineStep{Name: "notify", Image: "alpine:3"}
+	err := CheckTaskOffline(flow)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.TaskOfflineCheckFailed, err.Code())
+	}
+
+	configs.Set(configs.Config{Offline: configs.OfflineConfig{Enabled: true, ImageRegistry: "harbor.example.com/mirror"}})
+	assert.Nil(t, CheckTaskOffline(flow))
+	flow.Image = "Invalid Image"
+	assert.NotNil(t, CheckTaskOffline(flow))
+}
+
+func TestOfflineImage(t *testing.T) {
+	configs.Set(configs.Config{Offline: configs.OfflineConfig{Enabled: true, ImageRegistry: "harbor.example.com/mirror"}})
+	defer configs.Set(configs.Config{})
+
+	cases := map[string]string{
+		"alpine:3":                          "harbor.example.com/mirror/library/alpine:3",
+		"docker.io/hashicorp/terraform":     "harbor.example.com/mirror/hashicorp/terraform",
+		"cloudiac/ct-worker:latest":         "harbor.example.com/mirror/cloudiac/ct-worker:latest",
+		"registry.local:5000/cloudiac/tool": "registry.local:5000/cloudiac/tool",
+	}
+	for image, expect := range cases {
+		assert.Equal(t, expect, runner.OfflineImage(image), image)
+	}
+}
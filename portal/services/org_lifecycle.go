@@ -0,0 +1,233 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const DefaultOrgPurgeRetentionDays = 30
+
+// orgDataTable 组织数据所在的表及查询条件，条件中的参数为组织 id
+type orgDataTable struct {
+	Table string
+	Where string
+}
+
+// orgDataTables 组织拥有的所有数据，清除数据时按顺序删除，关联表需要在主表之前删除。
+// 同一张表可以有多个条件，日志存储中的文件需要在引用它的记录之前删除
+var orgDataTables = []orgDataTable{
+	// 任务目录下的文件: 步骤日志、步骤产物(iac_task_artifact)、plan 文件(iac_env_plan_artifact)及各类 json 结果
+	{"iac_storage", "EXISTS (SELECT 1 FROM iac_task WHERE iac_task.org_id = ? AND " +
+		"iac_storage.path LIKE CONCAT(iac_task.project_id, '/', iac_task.env_id, '/', iac_task.id, '/%'))"},
+	{"iac_storage", "EXISTS (SELECT 1 FROM iac_scan_task WHERE iac_scan_task.org_id = ? AND " +
+		"iac_storage.path LIKE CONCAT(IF(iac_scan_task.env_id = '', iac_scan_task.tpl_id, " +
+		"CONCAT(iac_scan_task.project_id, '/', iac_scan_task.env_id)), '/', iac_scan_task.id, '/%'))"},
+	// 路径规则见 EnvStateVersion.ContentPath()
+	{"iac_storage", "path IN (SELECT CONCAT(project_id, '/', env_id, '/state_versions/', id, '.tfstate') " +
+		"FROM iac_env_state_version WHERE org_id = ?)"},
+	{"iac_user_project", "project_id IN (SELECT id FROM iac_project WHERE org_id = ?)"},
+	{"iac_project_template", "project_id IN (SELECT id FROM iac_project WHERE org_id = ?)"},
+	{"iac_user_template", "tpl_id IN (SELECT id FROM iac_template WHERE org_id = ?)"},
+	{"iac_task_comment", "task_id IN (SELECT id FROM iac_task WHERE org_id = ?)"},
+	{"iac_vcs_pr", "env_id IN (SELECT id FROM iac_env WHERE org_id = ?)"},
+	{"iac_vcs_oauth_token", "vcs_id IN (SELECT id FROM iac_vcs WHERE org_id = ?)"},
+	{"iac_resource_drift", "res_id IN (SELECT id FROM iac_resource WHERE org_id = ?)"},
+	{"iac_notification_event", "notification_id IN (SELECT id FROM iac_notification WHERE org_id = ?)"},
+	{"iac_variable_group_rel", "var_group_id IN (SELECT id FROM iac_variable_group WHERE org_id = ?)"},
+	{"iac_ct_resource_map", "resource_account_id IN (SELECT id FROM iac_resource_account WHERE org_id = ?)"},
+
+	{"iac_template_label", "org_id = ?"},
+	{"iac_chat_identity", "org_id = ?"},
+	{"iac_chatops_command", "org_id = ?"},
+	{"iac_webhook_delivery", "org_id = ?"},
+	{"iac_freeze_override", "org_id = ?"},
+	{"iac_freeze_window", "org_id = ?"},
+	{"iac_policy_group_sync", "org_id = ?"},
+	{"iac_env_attestation", "org_id = ?"},
+	{"iac_env_plan_artifact", "org_id = ?"},
+	{"iac_env_state_version", "org_id = ?"},
+	{"iac_env_promotion", "org_id = ?"},
+	{"iac_promotion_chain", "org_id = ?"},
+	{"iac_fleet_deploy_item", "org_id = ?"},
+	{"iac_fleet_deploy", "org_id = ?"},
+	{"iac_task_cost_estimate", "org_id = ?"},
+	{"iac_resource_drift_history", "org_id = ?"},
+	{"iac_task_var_snapshot", "org_id = ?"},
+	{"iac_task_approval", "org_id = ?"},
+	{"iac_task_event", "org_id = ?"},
+	{"iac_task_artifact", "org_id = ?"},
+	{"iac_task_step_attempt", "org_id = ?"},
+	{"iac_task_step", "org_id = ?"},
+	{"iac_task", "org_id = ?"},
+	{"iac_scan_task", "org_id = ?"},
+	{"iac_policy_result", "org_id = ?"},
+	{"iac_policy_suppress", "org_id = ?"},
+	{"iac_policy_rel", "org_id = ?"},
+	{"iac_org_policy_override", "org_id = ?"},
+	{"iac_policy", "org_id = ?"},
+	{"iac_policy_group", "org_id = ?"},
+	{"iac_resource", "org_id = ?"},
+	{"iac_env_destroy_reminder", "org_id = ?"},
+	{"iac_env_suspension", "org_id = ?"},
+	{"iac_env", "org_id = ?"},
+	{"iac_template_revision", "org_id = ?"},
+	{"iac_template", "org_id = ?"},
+	{"iac_variable", "org_id = ?"},
+	{"iac_variable_group", "org_id = ?"},
+	{"iac_billing_record", "org_id = ?"},
+	{"iac_billing_connector", "org_id = ?"},
+	{"iac_cost_price", "org_id = ?"},
+	{"iac_notification", "org_id = ?"},
+	{"iac_resource_account", "org_id = ?"},
+	{"iac_vcs", "org_id = ?"},
+	{"iac_key", "org_id = ?"},
+	{"iac_token", "org_id = ?"},
+	{"iac_project", "org_id = ?"},
+	{"iac_user_org", "org_id = ?"},
+}
+
+// OrgExportedData 组织数据导出内容
+type OrgExportedData struct {
+	Org        models.Organization                 `json:"org"`
+	ExportedAt models.Time                         `json:"exportedAt"`
+	Tables     map[string][]map[string]interface{} `json:"tables" swaggertype:"object"` // 以表名索引的数据记录
+}
+
+// ExportOrgData 导出组织的所有数据
+func ExportOrgData(query *db.Session, orgId models.Id) (*OrgExportedData, e.Error) {
+	org, err := GetOrganizationById(query, orgId)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &OrgExportedData{
+		Org:        *org,
+		ExportedAt: models.Time(time.Now()),
+		Tables:     make(map[string][]map[string]interface{}, len(orgDataTables)),
+	}
+	for _, t := range orgDataTables {
+		rows := make([]map[string]interface{}, 0)
+		if err := query.Table(t.Table).Where(t.Where, orgId).Find(&rows); err != nil {
+			return nil, e.New(e.DBError, fmt.Errorf("export %s: %v", t.Table, err))
+		}
+		if prev, ok := data.Tables[t.Table]; ok {
+			rows = append(prev, rows...)
+		}
+		data.Tables[t.Table] = rows
+	}
+	return data, nil
+}
+
+func GetOrgPurgeRetentionDays() int {
+	if days := configs.Get().OrgPurgeRetentionDays; days > 0 {
+		return days
+	}
+	return DefaultOrgPurgeRetentionDays
+}
+
+// ScheduleOrgPurge 计划在保留期后清除组织数据，计划期间组织被禁用
+func ScheduleOrgPurge(tx *db.Session, org *models.Organization, userId models.Id) e.Error {
+	if org.PurgeAt != nil {
+		return e.New(e.OrgPurgeScheduled)
+	}
+
+	purgeAt := models.Time(time.Now().AddDate(0, 0, GetOrgPurgeRetentionDays()))
+	attrs := models.Attrs{
+		"status":             models.OrgDisable,
+		"purge_at":           purgeAt,
+		"purge_requested_by": userId,
+	}
+	if _, err := tx.Model(&models.Organization{}).Where("id = ?", org.Id).UpdateAttrs(attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	org.Status, org.PurgeAt, org.PurgeRequestedBy = models.OrgDisable, &purgeAt, userId
+	return nil
+}
+
+// CancelOrgPurge 在保留期内取消组织数据清除，组织保持禁用状态，需要手动启用
+func CancelOrgPurge(tx *db.Session, org *models.Organization) e.Error {
+	if org.PurgeAt == nil {
+		return e.New(e.OrgPurgeNotScheduled)
+	}
+
+	attrs := models.Attrs{"purge_at": nil, "purge_requested_by": ""}
+	if _, err := tx.Model(&models.Organization{}).Where("id = ?", org.Id).UpdateAttrs(attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	org.PurgeAt, org.PurgeRequestedBy = nil, ""
+	return nil
+}
+
+// GetDueOrgPurges 查询已到达计划清除时间的组织
+func GetDueOrgPurges(query *db.Session, now time.Time) ([]*models.Organization, e.Error) {
+	orgs := make([]*models.Organization, 0)
+	if err := query.Model(&models.Organization{}).
+		Where("purge_at IS NOT NULL AND purge_at <= ?", now).Find(&orgs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return orgs, nil
+}
+
+// PurgeOrgData 不可逆地删除组织的所有数据，并生成数据销毁证明
+func PurgeOrgData(tx *db.Session, org *models.Organization) (*models.OrgDestructionCert, e.Error) {
+	records := make(map[string]int64, len(orgDataTables)+1)
+	for _, t := range orgDataTables {
+		n, err := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE %s", t.Table, t.Where), org.Id)
+		if err != nil {
+			return nil, e.New(e.DBError, fmt.Errorf("purge %s: %v", t.Table, err))
+		}
+		records[t.Table] += n
+	}
+	n, err := tx.Exec("DELETE FROM `iac_org` WHERE id = ?", org.Id)
+	if err != nil {
+		return nil, e.New(e.DBError, fmt.Errorf("purge iac_org: %v", err))
+	}
+	records[models.Organization{}.TableName()] = n
+
+	recordsJson, _ := json.Marshal(records)
+	cert := &models.OrgDestructionCert{
+		OrgId:       org.Id,
+		OrgName:     org.Name,
+		RequestedBy: org.PurgeRequestedBy,
+		PurgedAt:    models.Time(time.Now()),
+		Records:     recordsJson,
+	}
+	if org.PurgeAt != nil {
+		cert.ScheduledAt = *org.PurgeAt
+	}
+	cert.Digest = orgDestructionCertDigest(cert)
+	if err := models.Create(tx, cert); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return cert, nil
+}
+
+// orgDestructionCertDigest 计算销毁证明内容的摘要，records 为 json 格式，key 有序，摘要结果稳定
+func orgDestructionCertDigest(cert *models.OrgDestructionCert) string {
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n%s",
+		cert.OrgId, cert.OrgName, cert.RequestedBy,
+		time.Time(cert.ScheduledAt).UTC().Format(time.RFC3339),
+		time.Time(cert.PurgedAt).UTC().Format(time.RFC3339), cert.Records)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func GetOrgDestructionCert(query *db.Session, orgId models.Id) (*models.OrgDestructionCert, e.Error) {
+	cert := models.OrgDestructionCert{}
+	if err := query.Where("org_id = ?", orgId).First(&cert); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.OrgCertNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &cert, nil
+}
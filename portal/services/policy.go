@@ -4,6 +4,7 @@ package services
 
 import (
 	"cloudiac/common"
+	"cloudiac/configs"
 	"cloudiac/policy"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
@@ -78,7 +79,7 @@ func GetPolicyByName(tx *db.Session, name string, groupId, orgId models.Id) (*mo
 func GetPoliciesByGroupId(tx *db.Session, groupId, orgId models.Id) ([]*models.Policy, e.Error) {
 	var po []*models.Policy
 	if err := tx.Model(models.Policy{}).Where("group_id = ? AND org_id = ?",
-		orgId).Find(&po); err != nil {
+		groupId, orgId).Find(&po); err != nil {
 		if e.IsRecordNotFound(err) {
 			return nil, e.New(e.PolicyNotExist, err)
 		}
@@ -103,20 +104,27 @@ func GetTaskPolicies(query *db.Session, task models.Tasker) ([]runner.TaskPolicy
 
 	for _, p := range policies {
 		category := "general"
+		opaVersion, regoVersion, bundleRevision := "", "", ""
 		group, _ := GetPolicyGroupById(query, p.GroupId)
 		if group != nil {
 			category = group.Name
+			opaVersion, regoVersion = group.OpaVersion, group.RegoVersion
+			bundleRevision = group.CommitId
 		}
 		meta := runner.Meta{
-			Name:         p.RuleName,
-			File:         p.RuleName + ".rego",
-			PolicyType:   p.PolicyType,
-			ResourceType: p.ResourceType,
-			Severity:     strings.ToUpper(p.Severity),
-			ReferenceId:  p.ReferenceId,
-			Category:     category,
-			Version:      p.Revision,
-			Id:           string(p.Id),
+			Name:           p.RuleName,
+			File:           p.RuleName + ".rego",
+			PolicyType:     p.PolicyType,
+			ResourceType:   p.ResourceType,
+			Severity:       strings.ToUpper(p.Severity),
+			ReferenceId:    p.ReferenceId,
+			Category:       category,
+			Version:        p.Revision,
+			Id:             string(p.Id),
+			OpaVersion:     opaVersion,
+			RegoVersion:    regoVersion,
+			Bundle:         string(p.GroupId),
+			BundleRevision: bundleRevision,
 		}
 		taskPolicies = append(taskPolicies, runner.TaskPolicy{
 			PolicyId: string(p.Id),
@@ -127,6 +135,27 @@ func GetTaskPolicies(query *db.Session, task models.Tasker) ([]runner.TaskPolicy
 	return taskPolicies, nil
 }
 
+// GetScanBaseTaskId 获取增量扫描的基准任务，即同一环境(或云模板)最近一次完成的扫描任务，未开启增量扫描时返回空
+func GetScanBaseTaskId(query *db.Session, tplId, envId, taskId models.Id) models.Id {
+	if !configs.Get().Policy.IncrementalScan {
+		return ""
+	}
+
+	query = query.Model(&models.ScanTask{}).Where("id != ?", taskId).
+		Where("policy_status IN (?)", []string{common.PolicyStatusPassed, common.PolicyStatusViolated})
+	if envId != "" {
+		query = query.Where("env_id = ?", envId)
+	} else {
+		query = query.Where("tpl_id = ? AND env_id = ''", tplId)
+	}
+
+	task := models.ScanTask{}
+	if err := query.Order("created_at DESC").First(&task); err != nil {
+		return ""
+	}
+	return task.Id
+}
+
 // GetValidPolicies 获取云模板/环境关联的策略
 func GetValidPolicies(query *db.Session, tplId, envId models.Id) (validPolicies []models.Policy, suppressedPolicies []models.Policy, err e.Error) {
 	var (
@@ -220,7 +249,7 @@ func SearchPolicy(dbSess *db.Session, form *forms.SearchPolicyForm, orgId models
 	}
 
 	if form.Severity != "" {
-		query = query.Where(fmt.Sprintf("%s.severity = ?", pTable), form.Severity)
+		query = WherePolicySeverity(query, orgId, pTable, form.Severity)
 	}
 
 	if form.Q != "" {
@@ -234,6 +263,9 @@ func SearchPolicy(dbSess *db.Session, form *forms.SearchPolicyForm, orgId models
 	query = query.Joins("left join iac_user as u on u.id = iac_policy.creator_id").
 		LazySelectAppend("iac_policy.*,u.name as creator")
 
+	query = query.Joins("left join iac_org_policy_override as ov on ov.policy_id = iac_policy.id and ov.org_id = ?", orgId).
+		LazySelectAppend("ov.severity as override_severity")
+
 	return query
 }
 
@@ -279,7 +311,7 @@ func SearchPolicyTpl(dbSess *db.Session, userId, orgId, tplId models.Id, q strin
 		query = query.WhereLike("iac_template.name", q)
 	}
 	query = query.Joins("LEFT JOIN iac_scan_task AS task ON task.id = iac_template.last_scan_task_id")
-	return query.LazySelect("iac_template.*, task.policy_status").
+	return query.LazySelect("iac_template.*, task.policy_status, task.compliance_score").
 		Joins("LEFT JOIN iac_policy_rel on iac_policy_rel.tpl_id = iac_template.id and iac_policy_rel.group_id = ''").
 		Joins("LEFT JOIN iac_org on iac_org.id = iac_template.org_id").
 		LazySelectAppend("iac_org.name as org_name").
@@ -315,7 +347,7 @@ func SearchPolicyEnv(dbSess *db.Session, userId, orgId, projectId, envId models.
 	return query.
 		LazySelectAppend(fmt.Sprintf("%s.*", envTable)).
 		LazySelectAppend("tpl.name AS template_name, tpl.id AS tpl_id, tpl.repo_addr AS repo_addr").
-		LazySelectAppend("task.policy_status").
+		LazySelectAppend("task.policy_status, task.compliance_score").
 		Joins("LEFT JOIN iac_policy_rel on iac_policy_rel.env_id = iac_env.id and iac_policy_rel.group_id = ''").
 		Joins("LEFT JOIN iac_org as org on org.id = iac_env.org_id").
 		Joins("LEFT JOIN iac_project as project on project.id = iac_env.project_id").
@@ -557,12 +589,12 @@ func SubQueryUserEnvIds(query *db.Session, userId models.Id) *db.Session {
 		return q
 	}
 
-	// 组织管理员相关项目
+	// 组织管理员及审计员相关项目
 	var orgAdminIds []models.Id
 	userOrgs := getUserOrgs(userId)
 	orgAdminProjectQuery := query.Model(models.Project{}).Select("id")
 	for _, userOrg := range userOrgs {
-		if UserHasOrgRole(userId, userOrg.OrgId, consts.OrgRoleAdmin) {
+		if UserHasOrgRole(userId, userOrg.OrgId, consts.OrgRoleAdmin) || UserIsOrgAuditor(userId, userOrg.OrgId) {
 			orgAdminIds = append(orgAdminIds, userOrg.OrgId)
 		}
 	}
@@ -0,0 +1,112 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/policy"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DecisionLogSinkFile = "file"
+	DecisionLogSinkHttp = "http"
+)
+
+var decisionLogFileLock sync.Mutex
+
+// ExportDecisionLogs 为 runner 返回的决策日志添加任务相关的标签，并导出到配置的 sink。
+// 未开启决策日志导出时直接返回
+func ExportDecisionLogs(task *models.Task, scanTask *models.ScanTask, content []byte) error {
+	conf := configs.Get().Policy.DecisionLog
+	if !conf.Enabled || len(content) == 0 {
+		return nil
+	}
+
+	decisionLogs, err := policy.ParseDecisionLogs(content)
+	if err != nil {
+		return errors.Wrap(err, "parse decision logs")
+	}
+	if len(decisionLogs) == 0 {
+		return nil
+	}
+
+	labels := map[string]string{}
+	if task != nil {
+		labels["org_id"] = string(task.OrgId)
+		labels["project_id"] = string(task.ProjectId)
+		labels["tpl_id"] = string(task.TplId)
+		labels["env_id"] = string(task.EnvId)
+		labels["task_id"] = string(task.Id)
+	} else if scanTask != nil {
+		labels["org_id"] = string(scanTask.OrgId)
+		labels["project_id"] = string(scanTask.ProjectId)
+		labels["tpl_id"] = string(scanTask.TplId)
+		labels["env_id"] = string(scanTask.EnvId)
+		labels["task_id"] = string(scanTask.Id)
+	}
+	for i := range decisionLogs {
+		decisionLogs[i].Labels = labels
+	}
+
+	switch conf.Sink {
+	case DecisionLogSinkHttp:
+		return sendDecisionLogs(conf, decisionLogs)
+	case DecisionLogSinkFile, "":
+		return appendDecisionLogs(conf, decisionLogs)
+	default:
+		return fmt.Errorf("unknown decision log sink '%s'", conf.Sink)
+	}
+}
+
+func appendDecisionLogs(conf configs.DecisionLogConfig, decisionLogs []policy.DecisionLog) error {
+	if conf.Path == "" {
+		return fmt.Errorf("decision log path is not configured")
+	}
+
+	decisionLogFileLock.Lock()
+	defer decisionLogFileLock.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(conf.Path), 0755); err != nil {
+		return err
+	}
+	fp, err := os.OpenFile(conf.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	enc := json.NewEncoder(fp)
+	for _, l := range decisionLogs {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDecisionLogs 以 json 数组格式 POST 决策日志，与 OPA decision log 服务的上报格式一致
+func sendDecisionLogs(conf configs.DecisionLogConfig, decisionLogs []policy.DecisionLog) error {
+	if conf.Url == "" {
+		return fmt.Errorf("decision log url is not configured")
+	}
+
+	header := &http.Header{}
+	header.Set("Content-Type", "application/json")
+	if conf.Token != "" {
+		header.Set("Authorization", "Bearer "+conf.Token)
+	}
+	if _, err := utils.HttpService(conf.Url, "POST", header, decisionLogs, 5, 30); err != nil {
+		return errors.Wrap(err, "send decision logs")
+	}
+	return nil
+}
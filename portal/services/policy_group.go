@@ -3,17 +3,22 @@
 package services
 
 import (
+	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
 	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"sync"
 
+	"github.com/Masterminds/semver"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/pkg/errors"
@@ -67,6 +72,46 @@ func UpdatePolicyGroup(query *db.Session, group *models.PolicyGroup, attr models
 	return nil
 }
 
+// GetRegistryPolicyGroups 查询所有从 registry 导入的策略组
+func GetRegistryPolicyGroups(query *db.Session) ([]*models.PolicyGroup, e.Error) {
+	groups := make([]*models.PolicyGroup, 0)
+	if err := query.Model(&models.PolicyGroup{}).
+		Where("registry_ref != ''").
+		Find(&groups); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return groups, nil
+}
+
+// CheckRegistryPolicyGroupUpdate 查询 registry 中策略组的最新版本并记录，返回是否有可用的新版本
+func CheckRegistryPolicyGroupUpdate(query *db.Session, group *models.PolicyGroup) (bool, error) {
+	ns, gn, ok := ParseRegistryRef(group.RegistryRef)
+	if !ok {
+		return false, fmt.Errorf("invalid registry ref '%s'", group.RegistryRef)
+	}
+	versions, err := GetRegistryPolicyGroupVersions(ns, gn)
+	if err != nil {
+		return false, err
+	}
+	latest := LatestRegistryVersion(versions)
+	if latest == "" {
+		return false, nil
+	}
+	if latest != group.LatestVersion {
+		if err := UpdatePolicyGroup(query, group, models.Attrs{"latest_version": latest}); err != nil {
+			return false, err
+		}
+		group.LatestVersion = latest
+	}
+
+	latestVer, _ := semver.NewVersion(latest)
+	currentVer, err := semver.NewVersion(group.GitTags)
+	if err != nil {
+		return false, nil
+	}
+	return latestVer.GreaterThan(currentVer), nil
+}
+
 func DeletePolicyGroup(tx *db.Session, groupId models.Id) e.Error {
 	if _, err := tx.Where("id = ?", groupId).
 		Delete(&models.PolicyGroup{}); err != nil {
@@ -173,6 +218,13 @@ func DownloadPolicyGroup(sess *db.Session, tmpDir string, result *DownloadPolicy
 
 	defer wg.Done()
 
+	// 上传的策略组直接解压存储的压缩包
+	if group.Source == consts.PolicyGroupSourceUpload {
+		logger.Debugf("extracting policy group archive %s", group.RepoId)
+		result.Error = extractPolicyGroupArchive(group, filepath.Join(tmpDir, "code"))
+		return
+	}
+
 	// 1. git download
 	logger.Debugf("downloading git")
 	branch := group.GitTags
@@ -203,6 +255,12 @@ func GetPolicyGroupCommitId(sess *db.Session, vcsId models.Id, repoId string, br
 	}
 
 	var repoUser = models.RepoUser
+	// OAuth 及 GitHub App 认证时使用实际的访问 token clone 代码
+	resolvedVcs, er := vcsrv.ResolveVcs(vcs)
+	if er != nil {
+		return "", "", e.AutoNew(er, e.VcsError)
+	}
+	vcs = resolvedVcs
 	vcsInstance, er := vcsrv.GetVcsInstance(vcs)
 	if er != nil {
 		return "", "", e.New(e.VcsError, er)
@@ -214,6 +272,10 @@ func GetPolicyGroupCommitId(sess *db.Session, vcsId models.Id, repoId string, br
 			return "", "", e.New(e.VcsError, er)
 		}
 		repoUser = user.Login
+	} else if vcs.UseOauth() {
+		repoUser = vcsrv.OauthCloneUser(vcs)
+	} else if vcs.VcsType == models.VcsBitbucket {
+		repoUser = vcsrv.BitbucketCloneUser
 	}
 
 	repo, er := vcsInstance.GetRepo(repoId)
@@ -269,3 +331,32 @@ func GitCheckout(localDir string, repoUrl string, commitId string) error {
 	})
 	return err
 }
+
+// PolicyGroupArchivePath 上传的策略组压缩包在 logstorage 中的存储路径
+func PolicyGroupArchivePath(groupId models.Id) string {
+	return fmt.Sprintf("policy_groups/%s/archive.zip", groupId)
+}
+
+// extractPolicyGroupArchive 从 logstorage 读取上传的策略组压缩包并解压到 destDir
+func extractPolicyGroupArchive(group *models.PolicyGroup, destDir string) e.Error {
+	content, err := logstorage.Get().Read(group.RepoId)
+	if err != nil {
+		return e.New(e.InternalError, errors.Wrapf(err, "read policy group archive"), http.StatusInternalServerError)
+	}
+
+	archive, err := os.CreateTemp("", "policy-group-*.zip")
+	if err != nil {
+		return e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	if _, err := archive.Write(content); err != nil {
+		return e.New(e.InternalError, err, http.StatusInternalServerError)
+	}
+	if err := utils.UnzipFileWithLimit(archive.Name(), destDir,
+		consts.MaxPolicyGroupUnzipSize, consts.MaxPolicyGroupArchiveFiles); err != nil {
+		return e.New(e.BadParam, errors.Wrapf(err, "unzip policy group archive"), http.StatusBadRequest)
+	}
+	return nil
+}
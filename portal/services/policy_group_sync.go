@@ -0,0 +1,110 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"strconv"
+)
+
+// policySyncAttrs 策略组同步时对比的策略元数据，Attr 为属性名称(json 字段名)
+var policySyncAttrs = []struct {
+	Attr  string
+	Value func(p *models.Policy) string
+}{
+	{"referenceId", func(p *models.Policy) string { return p.ReferenceId }},
+	{"revision", func(p *models.Policy) string { return strconv.Itoa(p.Revision) }},
+	{"severity", func(p *models.Policy) string { return p.Severity }},
+	{"fixSuggestion", func(p *models.Policy) string { return p.FixSuggestion }},
+	{"policyType", func(p *models.Policy) string { return p.PolicyType }},
+	{"resourceType", func(p *models.Policy) string { return p.ResourceType }},
+	{"tags", func(p *models.Policy) string { return p.Tags }},
+}
+
+// DiffPolicy 对比同步前后的策略，before 为 nil 表示新建，after 为 nil 表示删除，策略没有变化时返回 nil
+func DiffPolicy(before, after *models.Policy) *models.PolicyChange {
+	change := &models.PolicyChange{MetaChanges: make([]models.PolicyAttrChange, 0)}
+	var oldRego, newRego string
+	switch {
+	case before == nil:
+		change.Action = models.PolicyChangeCreated
+		change.PolicyId, change.Name, change.ReferenceId = after.Id, after.Name, after.ReferenceId
+		newRego = after.Rego
+	case after == nil:
+		change.Action = models.PolicyChangeDeleted
+		change.PolicyId, change.Name, change.ReferenceId = before.Id, before.Name, before.ReferenceId
+		oldRego = before.Rego
+	default:
+		change.Action = models.PolicyChangeUpdated
+		change.PolicyId, change.Name, change.ReferenceId = after.Id, after.Name, after.ReferenceId
+		oldRego, newRego = before.Rego, after.Rego
+	}
+
+	for _, a := range policySyncAttrs {
+		var oldVal, newVal string
+		if before != nil {
+			oldVal = a.Value(before)
+		}
+		if after != nil {
+			newVal = a.Value(after)
+		}
+		if oldVal != newVal {
+			change.MetaChanges = append(change.MetaChanges, models.PolicyAttrChange{Attr: a.Attr, Old: oldVal, New: newVal})
+		}
+	}
+	change.RegoDiff = utils.UnifiedDiff(oldRego, newRego)
+
+	if change.Action == models.PolicyChangeUpdated && len(change.MetaChanges) == 0 && change.RegoDiff == "" {
+		return nil
+	}
+	return change
+}
+
+// NewPolicyGroupSync 根据策略变更生成同步记录
+func NewPolicyGroupSync(group *models.PolicyGroup, userId models.Id, changes models.PolicyChanges) *models.PolicyGroupSync {
+	s := &models.PolicyGroupSync{
+		OrgId:     group.OrgId,
+		GroupId:   group.Id,
+		CreatorId: userId,
+		Version:   group.Version,
+		GitTags:   group.GitTags,
+		Branch:    group.Branch,
+		Changes:   changes,
+	}
+	for _, c := range changes {
+		switch c.Action {
+		case models.PolicyChangeCreated:
+			s.Created++
+		case models.PolicyChangeUpdated:
+			s.Updated++
+		case models.PolicyChangeDeleted:
+			s.Deleted++
+		}
+	}
+	return s
+}
+
+func CreatePolicyGroupSync(tx *db.Session, s *models.PolicyGroupSync) e.Error {
+	if err := models.Create(tx, s); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func QueryPolicyGroupSync(query *db.Session) *db.Session {
+	return query.Model(&models.PolicyGroupSync{})
+}
+
+func GetPolicyGroupSyncById(query *db.Session, groupId, id models.Id) (*models.PolicyGroupSync, e.Error) {
+	s := models.PolicyGroupSync{}
+	if err := query.Where("group_id = ? AND id = ?", groupId, id).First(&s); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.PolicyGroupSyncNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffPolicy(t *testing.T) {
+	before := &models.Policy{
+		Name: "instanceNoVpc", ReferenceId: "iac_aliyun_26", Revision: 1, Severity: "medium",
+		Rego: "package idcos\n\ndefault allow = false\n",
+	}
+	before.Id = "po-1"
+
+	after := *before
+	assert.Nil(t, DiffPolicy(before, &after))
+
+	after.Severity = "high"
+	after.Revision = 2
+	after.Rego = "package idcos\n\ndefault allow = true\n"
+	change := DiffPolicy(before, &after)
+	assert.Equal(t, models.PolicyChangeUpdated, change.Action)
+	assert.Equal(t, []models.PolicyAttrChange{
+		{Attr: "revision", Old: "1", New: "2"},
+		{Attr: "severity", Old: "medium", New: "high"},
+	}, change.MetaChanges)
+	assert.Equal(t, "@@ -1,3 +1,3 @@\n package idcos\n \n-default allow = false\n+default allow = true\n", change.RegoDiff)
+
+	change = DiffPolicy(nil, &after)
+	assert.Equal(t, models.PolicyChangeCreated, change.Action)
+	assert.Equal(t, models.Id("po-1"), change.PolicyId)
+	assert.Contains(t, change.RegoDiff, "+package idcos\n")
+
+	change = DiffPolicy(before, nil)
+	assert.Equal(t, models.PolicyChangeDeleted, change.Action)
+	assert.Contains(t, change.RegoDiff, "-package idcos\n")
+
+	sync := NewPolicyGroupSync(&models.PolicyGroup{}, "u-1", models.PolicyChanges{
+		{Action: models.PolicyChangeCreated}, {Action: models.PolicyChangeCreated}, {Action: models.PolicyChangeDeleted},
+	})
+	assert.Equal(t, []int{2, 0, 1}, []int{sync.Created, sync.Updated, sync.Deleted})
+}
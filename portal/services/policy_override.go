@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+)
+
+// UpsertPolicySeverityOverride 设置策略在组织内的严重性，已存在覆盖记录时更新
+func UpsertPolicySeverityOverride(tx *db.Session, o models.OrgPolicyOverride) (*models.OrgPolicyOverride, e.Error) {
+	exist := models.OrgPolicyOverride{}
+	err := tx.Where("org_id = ? AND policy_id = ?", o.OrgId, o.PolicyId).First(&exist)
+	if err != nil && !e.IsRecordNotFound(err) {
+		return nil, e.New(e.DBError, err)
+	}
+
+	if err == nil {
+		if _, err := models.UpdateAttr(tx.Where("id = ?", exist.Id), &models.OrgPolicyOverride{}, models.Attrs{
+			"severity":   o.Severity,
+			"creator_id": o.CreatorId,
+		}); err != nil {
+			return nil, e.New(e.DBError, fmt.Errorf("update policy override error: %v", err))
+		}
+		exist.Severity = o.Severity
+		exist.CreatorId = o.CreatorId
+		return &exist, nil
+	}
+
+	if err := models.Create(tx, &o); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &o, nil
+}
+
+func DeletePolicySeverityOverride(tx *db.Session, orgId, policyId models.Id) e.Error {
+	if _, err := tx.Where("org_id = ? AND policy_id = ?", orgId, policyId).
+		Delete(&models.OrgPolicyOverride{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// GetPolicySeverityOverrides 获取组织内所有策略的严重性覆盖，返回 policyId => severity
+func GetPolicySeverityOverrides(query *db.Session, orgId models.Id) (map[models.Id]string, e.Error) {
+	overrides := make([]models.OrgPolicyOverride, 0)
+	if err := query.Model(&models.OrgPolicyOverride{}).Where("org_id = ?", orgId).
+		Find(&overrides); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	m := make(map[models.Id]string, len(overrides))
+	for _, o := range overrides {
+		m[o.PolicyId] = o.Severity
+	}
+	return m, nil
+}
+
+// WherePolicySeverity 按组织内生效的严重性过滤策略，policyTable 为查询中策略表的名称或别名
+func WherePolicySeverity(query *db.Session, orgId models.Id, policyTable string, severity string) *db.Session {
+	overrideTable := models.OrgPolicyOverride{}.TableName()
+	return query.Where(fmt.Sprintf("(%s.id IN (SELECT policy_id FROM %s WHERE org_id = ? AND severity = ?) OR "+
+		"(%s.severity = ? AND %s.id NOT IN (SELECT policy_id FROM %s WHERE org_id = ?)))",
+		policyTable, overrideTable, policyTable, policyTable, overrideTable),
+		orgId, severity, severity, orgId)
+}
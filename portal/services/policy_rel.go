@@ -3,6 +3,8 @@
 package services
 
 import (
+	"cloudiac/common"
+	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
@@ -166,3 +168,66 @@ func DeleteRelByPolicyGroupId(tx *db.Session, groupId models.Id) e.Error {
 	}
 	return nil
 }
+
+const (
+	PolicyDisableActionKeep    = "keep"
+	PolicyDisableActionArchive = "archive"
+	PolicyDisableActionClear   = "clear"
+)
+
+// GetPolicyDisableAction 关闭合规检测时对已有扫描结果的处理方式，未配置时默认归档
+func GetPolicyDisableAction() string {
+	switch action := configs.Get().Policy.DisableAction; action {
+	case PolicyDisableActionKeep, PolicyDisableActionClear:
+		return action
+	default:
+		return PolicyDisableActionArchive
+	}
+}
+
+// ResetPolicyScanState 关闭环境/云模板的合规检测后处理已有的扫描状态。
+// 等待执行的扫描任务会被取消，archive 会清除最后一次扫描任务的关联，使列表中不再展示过期的扫描状态，
+// clear 在此基础上删除所有扫描结果
+func ResetPolicyScanState(tx *db.Session, scope string, id models.Id, action string) e.Error {
+	if action == PolicyDisableActionKeep {
+		return nil
+	}
+
+	var (
+		targetModel interface{}
+		targetWhere string
+	)
+	if scope == consts.ScopeEnv {
+		targetModel, targetWhere = &models.Env{}, "env_id = ?"
+	} else {
+		targetModel, targetWhere = &models.Template{}, "tpl_id = ? AND env_id = ''"
+	}
+
+	if _, err := tx.Model(&models.ScanTask{}).
+		Where(targetWhere, id).
+		Where("status = ? AND mirror = 0", models.TaskPending).
+		UpdateAttrs(models.Attrs{
+			"status":        models.TaskFailed,
+			"message":       "policy scan disabled",
+			"policy_status": common.PolicyStatusFailed,
+		}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	if _, err := tx.Model(targetModel).Where("id = ?", id).
+		UpdateAttrs(models.Attrs{
+			"last_scan_task_id":           "",
+			"last_manual_scan_task_id":    "",
+			"last_deploy_scan_task_id":    "",
+			"last_scheduled_scan_task_id": "",
+		}); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	if action == PolicyDisableActionClear {
+		if _, err := tx.Where(targetWhere, id).Delete(&models.PolicyResult{}); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"fmt"
+	"net/http"
 	"time"
 )
 
@@ -159,7 +160,7 @@ func UpdateScanResult(tx *db.Session, task models.Tasker, result policy.TsResult
 	if err := finishPendingScanResult(tx, task, message, status); err != nil {
 		return err
 	}
-	return nil
+	return UpdateComplianceScore(tx, task.GetId())
 }
 
 // finishScanResult 更新状态未知的策略扫描结果
@@ -213,11 +214,22 @@ func GetPolicyGroupScanTasks(query *db.Session, policyGroupId, orgId models.Id)
 }
 
 func QueryPolicyResult(query *db.Session, taskId models.Id) *db.Session {
+	return QueryPolicyResultWithFields(query, taskId, true, true)
+}
+
+// QueryPolicyResultWithFields 查询扫描结果，可选择不查询 rego 及修复建议等大字段
+func QueryPolicyResultWithFields(query *db.Session, taskId models.Id, withRego bool, withFixSuggestion bool) *db.Session {
 	q := query.Model(models.PolicyResult{}).Where("task_id = ?", taskId)
 
 	// 策略信息
 	q = q.Joins("left join iac_policy as p on p.id = iac_policy_result.policy_id").
-		LazySelectAppend("p.name as policy_name, p.fix_suggestion,iac_policy_result.*,p.rego")
+		LazySelectAppend("p.name as policy_name,iac_policy_result.*")
+	if withFixSuggestion {
+		q = q.LazySelectAppend("p.fix_suggestion")
+	}
+	if withRego {
+		q = q.LazySelectAppend("p.rego")
+	}
 	// 策略组信息
 	q = q.Joins("left join iac_policy_group as g on g.id = iac_policy_result.policy_group_id").
 		LazySelectAppend("g.name as policy_group_name,iac_policy_result.*")
@@ -225,6 +237,44 @@ func QueryPolicyResult(query *db.Session, taskId models.Id) *db.Session {
 	return q
 }
 
+// GetScanResultGroupIds 按 id 顺序查询扫描结果中 id 大于 after 的策略组，用于按策略组分页
+func GetScanResultGroupIds(query *db.Session, taskId models.Id, after models.Id, limit int) ([]models.Id, e.Error) {
+	q := query.Model(&models.PolicyResult{}).Where("task_id = ?", taskId)
+	if after != "" {
+		q = q.Where("policy_group_id > ?", after)
+	}
+	ids := make([]models.Id, 0)
+	if err := q.Group("policy_group_id").Order("policy_group_id").Limit(limit).
+		Pluck("policy_group_id", &ids); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return ids, nil
+}
+
+// GetPolicyResultRego 查询单条扫描结果对应策略的 rego 代码及修复建议
+func GetPolicyResultRego(query *db.Session, id uint) (*PolicyResultRego, e.Error) {
+	r := PolicyResultRego{}
+	if err := query.Table(models.PolicyResult{}.TableName()).
+		Joins("left join iac_policy as p on p.id = iac_policy_result.policy_id").
+		Where("iac_policy_result.id = ?", id).
+		LazySelectAppend("iac_policy_result.id, iac_policy_result.policy_id, p.rego, p.fix_suggestion").
+		Scan(&r); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	// Scan 查询不到记录时不返回错误
+	if r.Id == 0 {
+		return nil, e.New(e.ObjectNotExists, fmt.Errorf("policy result %d not found", id), http.StatusNotFound)
+	}
+	return &r, nil
+}
+
+type PolicyResultRego struct {
+	Id            uint      `json:"id"`
+	PolicyId      models.Id `json:"policyId" example:"po-c3lcrjxczjdywmk0go90"`
+	Rego          string    `json:"rego" example:""` // rego 代码文件内容
+	FixSuggestion string    `json:"fixSuggestion" example:"建议您创建一个专有网络..."`
+}
+
 //GetMirrorScanTask 查找部署任务对应的扫描任务
 func GetMirrorScanTask(query *db.Session, taskId models.Id) (*models.ScanTask, e.Error) {
 	t := models.ScanTask{}
@@ -0,0 +1,100 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 合规评分中各严重程度策略的权重
+var complianceSeverityWeight = map[string]int{
+	"high":   5,
+	"medium": 3,
+	"low":    1,
+}
+
+type PolicyResultStat struct {
+	Severity string
+	Status   string
+	Count    int
+}
+
+// CalcComplianceScore 根据扫描结果计算 0-100 的合规评分，通过的策略按严重程度加权后占所有已检测策略的比例。
+// 被屏蔽的策略不参与计算，没有可计算的策略时评分为 100
+func CalcComplianceScore(stats []PolicyResultStat) int {
+	passed, total := 0, 0
+	for _, s := range stats {
+		weight, ok := complianceSeverityWeight[s.Severity]
+		if !ok {
+			weight = complianceSeverityWeight["medium"]
+		}
+		switch s.Status {
+		case common.PolicyStatusPassed:
+			passed += weight * s.Count
+			total += weight * s.Count
+		case common.PolicyStatusViolated, common.PolicyStatusFailed:
+			total += weight * s.Count
+		}
+	}
+	if total == 0 {
+		return 100
+	}
+	return int(math.Floor(float64(passed) * 100 / float64(total)))
+}
+
+// UpdateComplianceScore 统计扫描任务的策略结果，计算并保存合规评分
+func UpdateComplianceScore(tx *db.Session, taskId models.Id) e.Error {
+	stats := make([]PolicyResultStat, 0)
+	// 通过的策略结果中没有记录严重程度，需要从策略中获取
+	if err := tx.Table(fmt.Sprintf("%s AS r", models.PolicyResult{}.TableName())).
+		Joins(fmt.Sprintf("LEFT JOIN %s AS p ON p.id = r.policy_id", models.Policy{}.TableName())).
+		Where("r.task_id = ?", taskId).
+		Group("IF(r.severity = '', p.severity, r.severity), r.status").
+		Select("IF(r.severity = '', p.severity, r.severity) AS severity, r.status AS status, COUNT(*) AS count").
+		Scan(&stats); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	score := CalcComplianceScore(stats)
+	if _, err := tx.Model(&models.ScanTask{}).Where("id = ?", taskId).
+		UpdateColumn("compliance_score", score); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+type ComplianceScorePoint struct {
+	TaskId    models.Id   `json:"taskId"`
+	Score     int         `json:"score" example:"85"`
+	ScannedAt models.Time `json:"scannedAt"`
+}
+
+// GetComplianceScoreTrend 查询环境或云模板在时间段内每次扫描的合规评分，按扫描时间排序
+func GetComplianceScoreTrend(query *db.Session, scope string, id models.Id, from, to time.Time) ([]ComplianceScorePoint, e.Error) {
+	query = query.Model(&models.ScanTask{})
+	switch scope {
+	case consts.ScopeEnv:
+		query = query.Where("env_id = ?", id)
+	case consts.ScopeTemplate:
+		query = query.Where("tpl_id = ? AND env_id = ''", id)
+	default:
+		return nil, e.New(e.BadParam, fmt.Errorf("unknown compliance score scope '%s'", scope))
+	}
+
+	points := make([]ComplianceScorePoint, 0)
+	if err := query.Where("compliance_score IS NOT NULL").
+		Where("created_at >= ? AND created_at <= ?", from, to).
+		Select("id AS task_id, compliance_score AS score, created_at AS scanned_at").
+		Order("created_at").
+		Scan(&points); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return points, nil
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import "testing"
+
+func TestCalcComplianceScore(t *testing.T) {
+	cases := []struct {
+		stats []PolicyResultStat
+		want  int
+	}{
+		{nil, 100},
+		{[]PolicyResultStat{{"high", "suppressed", 3}}, 100},
+		{[]PolicyResultStat{{"high", "passed", 2}, {"low", "violated", 1}}, 90},
+		{[]PolicyResultStat{{"low", "passed", 5}, {"high", "violated", 1}}, 50},
+		{[]PolicyResultStat{{"medium", "failed", 1}, {"", "passed", 1}}, 50},
+	}
+	for _, c := range cases {
+		if got := CalcComplianceScore(c.stats); got != c.want {
+			t.Errorf("CalcComplianceScore(%v) = %d, want %d", c.stats, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"net/http"
+)
+
+// ProjectQuotaUsage 项目配额的使用情况，只统计未归档的环境
+type ProjectQuotaUsage struct {
+	Envs        int     `json:"envs"`        // 环境数量
+	Resources   int     `json:"resources"`   // 各环境最后一次部署后的资源数量之和
+	MonthlyCost float64 `json:"monthlyCost"` // 各环境的估算月度费用之和
+}
+
+// GetProjectQuotaUsage 统计项目当前的配额使用情况
+func GetProjectQuotaUsage(query *db.Session, projectId models.Id) (*ProjectQuotaUsage, e.Error) {
+	usage := ProjectQuotaUsage{}
+	if err := query.Model(&models.Env{}).
+		Where("project_id = ? AND archived = ?", projectId, false).
+		Select("COUNT(*) AS envs, COALESCE(SUM(monthly_cost), 0) AS monthly_cost").
+		Scan(&usage); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	resources, err := query.Table("iac_resource AS r").
+		Joins("JOIN iac_env ON iac_env.last_res_task_id = r.task_id AND iac_env.deleted_at_t = 0").
+		Where("iac_env.project_id = ? AND iac_env.archived = ?", projectId, false).
+		Count()
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	usage.Resources = int(resources)
+	usage.MonthlyCost = roundCost(usage.MonthlyCost)
+	return &usage, nil
+}
+
+// ValidateProjectQuota 检查项目配额设置
+func ValidateProjectQuota(quota *models.ProjectQuota) e.Error {
+	if quota.QuotaMaxEnvs < 0 || quota.QuotaMaxResources < 0 || quota.QuotaMaxMonthlyCost < 0 {
+		return e.New(e.ProjectQuotaInvalid, fmt.Errorf("quota must not be negative"), http.StatusBadRequest)
+	}
+	if quota.QuotaAction == "" {
+		quota.QuotaAction = models.ProjectQuotaActionApproval
+	}
+	if !utils.StrInArray(quota.QuotaAction, models.ProjectQuotaActionApproval, models.ProjectQuotaActionBlock) {
+		return e.New(e.ProjectQuotaInvalid,
+			fmt.Errorf("invalid quota action '%s'", quota.QuotaAction), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// CheckProjectEnvQuota 创建环境前检查项目的环境数量是否已达到配额
+func CheckProjectEnvQuota(tx *db.Session, projectId models.Id) e.Error {
+	project, er := DetailProject(tx, projectId)
+	if er != nil {
+		return er
+	}
+	if project.QuotaMaxEnvs <= 0 {
+		return nil
+	}
+	count, err := tx.Model(&models.Env{}).Where("project_id = ? AND archived = ?", projectId, false).Count()
+	if err != nil {
+		return e.New(e.DBError, err)
+	}
+	if int(count) >= project.QuotaMaxEnvs {
+		return e.New(e.ProjectQuotaExceeded,
+			fmt.Errorf("environments count reaches the quota %d", project.QuotaMaxEnvs), http.StatusForbidden)
+	}
+	return nil
+}
+
+// planResourceAdditions 统计 plan 新增的资源数量(新增减去删除，不包括 data source)
+func planResourceAdditions(plan *TfPlan) int {
+	n := 0
+	for _, r := range plan.ResourceChanges {
+		if r.Mode == "data" {
+			continue
+		}
+		switch {
+		case utils.SliceEqualStr(r.Change.Actions, []string{"create"}):
+			n += 1
+		case utils.SliceEqualStr(r.Change.Actions, []string{"delete"}):
+			n -= 1
+		}
+	}
+	return n
+}
+
+// projectQuotaViolations 检查部署后项目的资源数量及估算费用是否超出配额，返回超出的配额项。
+// 部署没有增加资源或费用时不检查，避免已超出配额的项目无法执行减少资源的部署
+func projectQuotaViolations(quota models.ProjectQuota, usage ProjectQuotaUsage, addResources int, costDelta float64) []string {
+	violations := make([]string, 0)
+	if quota.QuotaMaxResources > 0 && addResources > 0 && usage.Resources+addResources > quota.QuotaMaxResources {
+		violations = append(violations, fmt.Sprintf("project resources count %d exceeds the quota %d",
+			usage.Resources+addResources, quota.QuotaMaxResources))
+	}
+	if quota.QuotaMaxMonthlyCost > 0 && costDelta > 0 && usage.MonthlyCost+costDelta > quota.QuotaMaxMonthlyCost {
+		violations = append(violations, fmt.Sprintf("project estimated monthly cost %.2f exceeds the quota %.2f",
+			roundCost(usage.MonthlyCost+costDelta), quota.QuotaMaxMonthlyCost))
+	}
+	return violations
+}
+
+// CheckTaskProjectQuota 根据部署任务的 plan 结果及费用估算检查是否超出项目配额，
+// 返回超出的配额项及项目设置的处理方式(需要审批或禁止部署)
+func CheckTaskProjectQuota(query *db.Session, env *models.Env, task *models.Task, planJson []byte) (
+	violations []string, action string, err e.Error) {
+	project, err := DetailProject(query, task.ProjectId)
+	if err != nil {
+		return nil, "", err
+	}
+	quota := project.ProjectQuota
+	if quota.QuotaMaxResources <= 0 && quota.QuotaMaxMonthlyCost <= 0 {
+		return nil, "", nil
+	}
+
+	addResources := 0
+	if len(planJson) > 0 {
+		plan, er := UnmarshalPlanJson(planJson)
+		if er != nil {
+			return nil, "", e.New(e.InternalError, fmt.Errorf("unmarshal plan json: %v", er))
+		}
+		addResources = planResourceAdditions(plan)
+	}
+	costDelta := 0.0
+	if task.CostEstimated {
+		costDelta = TaskProjectedEnvCost(env, task) - env.MonthlyCost
+	}
+	usage, err := GetProjectQuotaUsage(query, task.ProjectId)
+	if err != nil {
+		return nil, "", err
+	}
+	return projectQuotaViolations(quota, *usage, addResources, costDelta),
+		utils.FirstValueStr(quota.QuotaAction, models.ProjectQuotaActionApproval), nil
+}
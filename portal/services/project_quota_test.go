@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanResourceAdditions(t *testing.T) {
+	plan, err := UnmarshalPlanJson([]byte(`{"resource_changes": [
+		{"mode": "managed", "change": {"actions": ["no-op"]}},
+		{"mode": "managed", "change": {"actions": ["create"]}},
+		{"mode": "managed", "change": {"actions": ["create"]}},
+		{"mode": "managed", "change": {"actions": ["delete", "create"]}},
+		{"mode": "managed", "change": {"actions": ["delete"]}},
+		{"mode": "data", "change": {"actions": ["read"]}}
+	]}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, planResourceAdditions(plan))
+	}
+}
+
+func TestProjectQuotaViolations(t *testing.T) {
+	quota := models.ProjectQuota{QuotaMaxResources: 10, QuotaMaxMonthlyCost: 100}
+	usage := ProjectQuotaUsage{Resources: 8, MonthlyCost: 90}
+
+	assert.Empty(t, projectQuotaViolations(quota, usage, 2, 10))
+	assert.Len(t, projectQuotaViolations(quota, usage, 3, 10), 1)
+	assert.Len(t, projectQuotaViolations(quota, usage, 3, 10.5), 2)
+
+	// 已超出配额时，不增加资源及费用的部署不受限制
+	usage = ProjectQuotaUsage{Resources: 20, MonthlyCost: 200}
+	assert.Empty(t, projectQuotaViolations(quota, usage, -1, -5))
+	assert.Empty(t, projectQuotaViolations(models.ProjectQuota{}, usage, 10, 10))
+}
+
+func TestValidateProjectQuota(t *testing.T) {
+	quota := models.ProjectQuota{QuotaMaxEnvs: 5}
+	assert.Nil(t, ValidateProjectQuota(&quota))
+	assert.Equal(t, models.ProjectQuotaActionApproval, quota.QuotaAction)
+
+	quota.QuotaAction = "deny"
+	err := ValidateProjectQuota(&quota)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.ProjectQuotaInvalid, err.Code())
+	}
+	assert.NotNil(t, ValidateProjectQuota(&models.ProjectQuota{QuotaMaxResources: -1}))
+}
@@ -14,6 +14,8 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+
+	"github.com/Masterminds/semver"
 )
 
 func GetRegistryAddrStr(db *db.Session) string {
@@ -77,3 +79,97 @@ func RegistryGet(path string, data url.Values, result interface{}) (err error) {
 	}
 	return nil
 }
+
+// RegistryPolicyGroup registry 侧策略组信息
+type RegistryPolicyGroup struct {
+	Id        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	Label     string `json:"label"`
+	RepoPath  string `json:"repoPath"`
+}
+
+type RegistryPolicyGroupPage struct {
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+	Total    int64                 `json:"total"`
+	List     []RegistryPolicyGroup `json:"list"`
+}
+
+// RegistryPolicyGroupVersion registry 侧策略组版本信息
+type RegistryPolicyGroupVersion struct {
+	Id        models.Id `json:"id"`
+	Namespace string    `json:"namespace"`
+	GroupName string    `json:"groupName"`
+	GitTag    string    `json:"gitTag"`
+	CommitId  string    `json:"commitId"`
+}
+
+func SearchRegistryPolicyGroups(q string, page, pageSize int) (*RegistryPolicyGroupPage, error) {
+	rr := RegistryPolicyGroupPage{}
+	val := url.Values{}
+	val.Add("q", q)
+	val.Add("pageSize", fmt.Sprintf("%d", pageSize))
+	val.Add("page", fmt.Sprintf("%d", page))
+	if err := RegistryGet("iac/policy_groups", val, &rr); err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+// GetRegistryPolicyGroup 按 namespace 及名称查找 registry 中的策略组，未找到时返回 nil
+func GetRegistryPolicyGroup(namespace, groupName string) (*RegistryPolicyGroup, error) {
+	rr, err := SearchRegistryPolicyGroups(groupName, 1, 100)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rr.List {
+		if rr.List[i].Namespace == namespace && rr.List[i].Name == groupName {
+			return &rr.List[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func GetRegistryPolicyGroupVersions(namespace, groupName string) ([]RegistryPolicyGroupVersion, error) {
+	rvs := make([]RegistryPolicyGroupVersion, 0)
+	val := url.Values{}
+	val.Add("ns", namespace)
+	val.Add("gn", groupName)
+	if err := RegistryGet("iac/policy_groups/versions", val, &rvs); err != nil {
+		return nil, err
+	}
+	return rvs, nil
+}
+
+// LatestRegistryVersion 返回版本列表中语义化版本最高的 git tag，忽略不合法的版本号
+func LatestRegistryVersion(versions []RegistryPolicyGroupVersion) string {
+	var (
+		latest    *semver.Version
+		latestTag string
+	)
+	for _, v := range versions {
+		ver, err := semver.NewVersion(v.GitTag)
+		if err != nil {
+			continue
+		}
+		if latest == nil || ver.GreaterThan(latest) {
+			latest, latestTag = ver, v.GitTag
+		}
+	}
+	return latestTag
+}
+
+// RegistryRef 生成策略组关联的 registry 策略组标识
+func RegistryRef(namespace, groupName string) string {
+	return namespace + "/" + groupName
+}
+
+// ParseRegistryRef 解析 registry 策略组标识，返回 namespace 及策略组名称
+func ParseRegistryRef(ref string) (string, string, bool) {
+	idx := strings.Index(ref, "/")
+	if idx <= 0 || idx == len(ref)-1 {
+		return "", "", false
+	}
+	return ref[:idx], ref[idx+1:], true
+}
@@ -19,3 +19,15 @@ func TestRegistryRespUnmarshal(t *testing.T) {
 		t.Logf("response.result: %s", resp.Result)
 	}
 }
+
+func TestLatestRegistryVersion(t *testing.T) {
+	versions := []RegistryPolicyGroupVersion{
+		{GitTag: "v1.2.0"}, {GitTag: "v1.10.0"}, {GitTag: "latest"}, {GitTag: "v1.9.3"},
+	}
+	if got := LatestRegistryVersion(versions); got != "v1.10.0" {
+		t.Errorf("LatestRegistryVersion() = %v, want v1.10.0", got)
+	}
+	if got := LatestRegistryVersion(nil); got != "" {
+		t.Errorf("LatestRegistryVersion() = %v, want empty", got)
+	}
+}
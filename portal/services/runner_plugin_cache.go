@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RunnerPluginCachePrewarmTimeout 等待 runner 预热 provider 缓存的时间，需要下载多个 provider 时耗时较长
+const RunnerPluginCachePrewarmTimeout = 30 * time.Minute
+
+// ListRunnerCachedProviders 查询 runner 的 provider 缓存目录中的 provider
+func ListRunnerCachedProviders(r *models.Runner) ([]runner.CachedProvider, e.Error) {
+	providers := make([]runner.CachedProvider, 0)
+	runnerAddr := fmt.Sprintf("http://%s:%d", r.Address, r.Port)
+	if err := requestRunner(runnerAddr, consts.RunnerPluginCacheProvidersURL, "GET", nil, &providers); err != nil {
+		return nil, e.New(e.RunnerRequestFailed, err, http.StatusBadGateway)
+	}
+	return providers, nil
+}
+
+// PrewarmRunnerPluginCache 在 runner 上下载指定的 provider 到缓存目录，等待下载完成后返回结果
+func PrewarmRunnerPluginCache(r *models.Runner, req runner.PluginCachePrewarmReq) (*runner.PluginCachePrewarmResp, e.Error) {
+	for _, p := range req.Providers {
+		if _, _, err := runner.ParseProviderRequirement(p); err != nil {
+			return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+		}
+	}
+
+	resp := &runner.PluginCachePrewarmResp{}
+	runnerAddr := fmt.Sprintf("http://%s:%d", r.Address, r.Port)
+	if err := requestRunnerWithDeadline(runnerAddr, consts.RunnerPluginCachePrewarmURL, "POST", req, resp,
+		int(RunnerPluginCachePrewarmTimeout.Seconds())); err != nil {
+		return nil, e.New(e.RunnerRequestFailed, err, http.StatusBadGateway)
+	}
+	return resp, nil
+}
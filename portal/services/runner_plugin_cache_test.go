@@ -0,0 +1,27 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrewarmRunnerPluginCacheInvalidProvider(t *testing.T) {
+	r := &models.Runner{Address: "127.0.0.1", Port: 1}
+	for _, p := range []string{"aws", "hashicorp/aws@\"5.0\"", "hashicorp/aws\n}", "@5.0"} {
+		_, err := PrewarmRunnerPluginCache(r, runner.PluginCachePrewarmReq{Providers: []string{p}})
+		if assert.NotNil(t, err, p) {
+			assert.Equal(t, e.BadParam, err.Code(), p)
+		}
+	}
+
+	source, version, err := runner.ParseProviderRequirement(" hashicorp/aws @ ~> 5.0 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "hashicorp/aws", source)
+	assert.Equal(t, "~> 5.0", version)
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// RunnerServiceName 通过 portal 注册的 runner 使用的 consul 服务名称，与 runner 启动时注册的名称一致
+const RunnerServiceName = "CT-Runner"
+
+func QueryRunners(sess *db.Session) *db.Session {
+	return sess.Model(&models.Runner{}).Order("service_id")
+}
+
+func GetRunnerById(sess *db.Session, id models.Id) (*models.Runner, e.Error) {
+	r := models.Runner{}
+	if err := sess.Where("id = ?", id).First(&r); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.RunnerNotExist, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// SyncRunnerPool 同步 consul 中注册的 runner 到 runner 池，新发现的 runner 默认启用，
+// 已从 consul 注销的 runner 标记为离线，返回同步后 runner 池中的全部 runner
+func SyncRunnerPool(sess *db.Session, services []*api.AgentService) ([]*models.Runner, e.Error) {
+	pool := make([]*models.Runner, 0)
+	if err := QueryRunners(sess).Find(&pool); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	active := make(map[string]*api.AgentService, len(services))
+	for _, s := range services {
+		active[s.ID] = s
+	}
+
+	for _, r := range pool {
+		attrs := models.Attrs{}
+		if s, ok := active[r.ServiceId]; ok {
+			delete(active, r.ServiceId)
+			r.Name, r.Address, r.Port, r.Tags, r.Status = s.Service, s.Address, s.Port, s.Tags, models.RunnerOnline
+			attrs = models.Attrs{"name": r.Name, "address": r.Address, "port": r.Port, "tags": r.Tags, "status": r.Status}
+		} else if r.Status != models.RunnerOffline {
+			r.Status = models.RunnerOffline
+			attrs = models.Attrs{"status": r.Status}
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+		if _, err := models.UpdateAttr(sess.Where("id = ?", r.Id), &models.Runner{}, attrs); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+
+	for _, s := range MatchRunnersByTags(mapValues(active), nil) {
+		r := &models.Runner{
+			ServiceId: s.ID,
+			Name:      s.Service,
+			Address:   s.Address,
+			Port:      s.Port,
+			Tags:      s.Tags,
+			Status:    models.RunnerOnline,
+		}
+		if err := models.Create(sess, r); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		pool = append(pool, r)
+	}
+	return pool, nil
+}
+
+func mapValues(m map[string]*api.AgentService) []*api.AgentService {
+	result := make([]*api.AgentService, 0, len(m))
+	for _, v := range m {
+		result = append(result, v)
+	}
+	return result
+}
+
+// RegisterRunner 将 runner 注册到 consul 并加入 runner 池，
+// 用于 runner 未配置 consul 自动注册，或者需要修改 runner 地址的场景
+func RegisterRunner(sess *db.Session, serviceId string, address string, port int, tags []string) (*models.Runner, e.Error) {
+	service := &api.AgentService{ID: serviceId, Service: RunnerServiceName, Address: address, Port: port}
+	if err := ConsulServiceRegistered(service, tags); err != nil {
+		return nil, err
+	}
+
+	r := models.Runner{}
+	if err := sess.Where("service_id = ?", serviceId).First(&r); err != nil && !e.IsRecordNotFound(err) {
+		return nil, e.New(e.DBError, err)
+	} else if err == nil {
+		r.Address, r.Port, r.Tags, r.Status = address, port, tags, models.RunnerOnline
+		if _, err := models.UpdateAttr(sess.Where("id = ?", r.Id), &models.Runner{}, models.Attrs{
+			"address": r.Address, "port": r.Port, "tags": r.Tags, "status": r.Status,
+		}); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		return &r, nil
+	}
+
+	r = models.Runner{
+		ServiceId: serviceId,
+		Name:      RunnerServiceName,
+		Address:   address,
+		Port:      port,
+		Tags:      tags,
+		Status:    models.RunnerOnline,
+	}
+	if err := models.Create(sess, &r); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.RunnerAlreadyExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// SetRunnerDisabled 启用或禁用 runner，禁用的 runner 不再分配新任务
+func SetRunnerDisabled(sess *db.Session, id models.Id, disabled bool) (*models.Runner, e.Error) {
+	if _, err := models.UpdateAttr(sess.Where("id = ?", id), &models.Runner{},
+		models.Attrs{"disabled": disabled}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return GetRunnerById(sess, id)
+}
+
+// FetchRunnerHealth 获取 runner 的健康状态
+func FetchRunnerHealth(r *models.Runner) (*runner.RunnerHealth, error) {
+	health := &runner.RunnerHealth{}
+	runnerAddr := fmt.Sprintf("http://%s:%d", r.Address, r.Port)
+	if err := requestRunnerWithDeadline(runnerAddr, consts.RunnerHealthURL, "GET", nil, health,
+		int(consts.RunnerConnectTimeout.Seconds())*2); err != nil {
+		return nil, err
+	}
+	return health, nil
+}
+
+// UpdateRunnerHealth 保存 runner 的健康状态，获取失败时只记录错误信息，
+// 超过 models.RunnerHeartbeatTimeout 没有成功获取时 runner 被视为不可用
+func UpdateRunnerHealth(sess *db.Session, r *models.Runner, health *runner.RunnerHealth, healthErr error) e.Error {
+	var attrs models.Attrs
+	if healthErr != nil {
+		r.HealthError = healthErr.Error()
+		attrs = models.Attrs{"health_error": r.HealthError}
+	} else {
+		now := models.Time(time.Now())
+		r.LastHeartbeatAt, r.HealthError = &now, ""
+		r.Version, r.RunningTasks, r.CpuNum, r.Load1 = health.Version, health.RunningTasks, health.CpuNum, health.Load1
+		r.DiskTotal, r.DiskFree = health.DiskTotal, health.DiskFree
+		attrs = models.Attrs{
+			"last_heartbeat_at": r.LastHeartbeatAt,
+			"health_error":      "",
+			"version":           r.Version,
+			"running_tasks":     r.RunningTasks,
+			"cpu_num":           r.CpuNum,
+			"load1":             r.Load1,
+			"disk_total":        r.DiskTotal,
+			"disk_free":         r.DiskFree,
+		}
+	}
+	if _, err := models.UpdateAttr(sess.Where("id = ?", r.Id), &models.Runner{}, attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// PickRunner 选择包含全部 tags 且负载最低的可用 runner，没有可用 runner 时返回 nil。
+// 负载依次比较正在运行的任务数量、每个 cpu 的系统负载及磁盘可用空间
+func PickRunner(runners []*models.Runner, tags []string, now time.Time) *models.Runner {
+	candidates := make([]*models.Runner, 0, len(runners))
+	for _, r := range runners {
+		if r.Available(now) && hasAllTags(r.Tags, tags) {
+			candidates = append(candidates, r)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	loadPerCpu := func(r *models.Runner) float64 {
+		if r.CpuNum <= 0 {
+			return r.Load1
+		}
+		return r.Load1 / float64(r.CpuNum)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.RunningTasks != b.RunningTasks {
+			return a.RunningTasks < b.RunningTasks
+		}
+		if la, lb := loadPerCpu(a), loadPerCpu(b); la != lb {
+			return la < lb
+		}
+		if a.DiskFree != b.DiskFree {
+			return a.DiskFree > b.DiskFree
+		}
+		return a.ServiceId < b.ServiceId
+	})
+	return candidates[0]
+}
+
+// PickRunnerFor 选择满足 affinity 要求的可用 runner，优先从亲和度高(绑定了项目或组织)的 runner 中选择负载最低的
+func PickRunnerFor(runners []*models.Runner, affinity RunnerAffinity, now time.Time) *models.Runner {
+	tiers := make(map[int][]*models.Runner)
+	for _, r := range runners {
+		if a := r.AffinityFor(affinity.OrgId, affinity.ProjectId); a != models.RunnerAffinityNone {
+			tiers[a] = append(tiers[a], r)
+		}
+	}
+	for a := models.RunnerAffinityProject; a >= models.RunnerAffinityShared; a-- {
+		if r := PickRunner(tiers[a], affinity.Tags, now); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// selectActiveRunner 从 consul 中活跃的 runner 中选择满足 affinity 要求且负载最低的 runner，
+// runner 池中还没有健康状态(如 portal 刚启动)时选择亲和度最高且 runner id 最小的未禁用 runner
+func selectActiveRunner(sess *db.Session, actives []*api.AgentService, affinity RunnerAffinity) (string, e.Error) {
+	pool := make([]*models.Runner, 0)
+	if err := QueryRunners(sess).Find(&pool); err != nil {
+		return "", e.New(e.DBError, err)
+	}
+	poolRunners := make(map[string]*models.Runner, len(pool))
+	for _, r := range pool {
+		poolRunners[r.ServiceId] = r
+	}
+
+	candidates := make([]*models.Runner, 0)
+	for _, s := range MatchRunnersByTags(actives, affinity.Tags) {
+		r := models.Runner{ServiceId: s.ID, Status: models.RunnerOnline}
+		if p, ok := poolRunners[s.ID]; ok {
+			r = *p
+		}
+		// 以 consul 中的标签为准，runner 池中的标签可能还未同步
+		r.Tags = s.Tags
+		if !r.Disabled && r.AffinityFor(affinity.OrgId, affinity.ProjectId) != models.RunnerAffinityNone {
+			candidates = append(candidates, &r)
+		}
+	}
+	if r := PickRunnerFor(candidates, affinity, time.Now()); r != nil {
+		return r.ServiceId, nil
+	}
+	if len(candidates) > 0 {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].AffinityFor(affinity.OrgId, affinity.ProjectId) >
+				candidates[j].AffinityFor(affinity.OrgId, affinity.ProjectId)
+		})
+		return candidates[0].ServiceId, nil
+	}
+	return "", e.New(e.RunnerNoMatch, fmt.Errorf("no available runner matches tags %v", affinity.Tags))
+}
+
+// getPoolRunner 查询 runner 池中的 runner，不存在时返回 nil
+func getPoolRunner(sess *db.Session, serviceId string) (*models.Runner, e.Error) {
+	r := models.Runner{}
+	if err := sess.Model(&models.Runner{}).Where("service_id = ?", serviceId).First(&r); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &r, nil
+}
+
+// SetRunnerBindings 设置 runner 绑定的组织及项目，都为空时 runner 为所有组织共享
+func SetRunnerBindings(sess *db.Session, id models.Id, orgIds []string, projectIds []string) (*models.Runner, e.Error) {
+	if _, err := models.UpdateAttr(sess.Where("id = ?", id), &models.Runner{}, models.Attrs{
+		"org_ids":     models.StrSlice(orgIds),
+		"project_ids": models.StrSlice(projectIds),
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return GetRunnerById(sess, id)
+}
+
+func hasAllTags(runnerTags []string, tags []string) bool {
+	set := make(map[string]bool, len(runnerTags))
+	for _, t := range runnerTags {
+		set[t] = true
+	}
+	for _, t := range tags {
+		if !set[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateTaskRunnerId 修改任务执行的 runner，只能用于还未开始执行的任务
+func UpdateTaskRunnerId(sess *db.Session, taskId models.Id, runnerId string) e.Error {
+	if _, err := sess.Model(&models.Task{}).Where("id = ? AND status = ?", taskId, models.TaskPending).
+		UpdateColumn("runner_id", runnerId); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// RunnerOrphanGracePeriod 容器及工作目录创建后的保护时间，避免清理刚下发还未保存到数据库的任务
+	RunnerOrphanGracePeriod = time.Hour
+	// RunnerWorkspaceRetention 已结束任务的工作目录保留时间，增量扫描会使用基准任务的工作目录
+	RunnerWorkspaceRetention = 7 * 24 * time.Hour
+)
+
+// RunnerTaskState 任务在 portal 中的状态，部署任务与扫描任务统一处理
+type RunnerTaskState struct {
+	Exited bool
+	EndAt  time.Time // 任务结束时间，未记录时使用任务的更新时间，都没有时为零值，不做清理
+}
+
+// GetRunnerTaskStates 查询任务状态，返回结果中不存在的任务 id 表示任务在 portal 中不存在
+func GetRunnerTaskStates(dbSess *db.Session, taskIds []string) (map[string]RunnerTaskState, e.Error) {
+	states := make(map[string]RunnerTaskState, len(taskIds))
+	if len(taskIds) == 0 {
+		return states, nil
+	}
+
+	tasks := make([]*models.Task, 0)
+	if err := dbSess.Model(&models.Task{}).Where("id IN (?)", taskIds).Find(&tasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	scanTasks := make([]*models.ScanTask, 0)
+	if err := dbSess.Model(&models.ScanTask{}).Where("id IN (?)", taskIds).Find(&scanTasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	add := func(t *models.BaseTask) {
+		state := RunnerTaskState{Exited: t.Exited()}
+		if t.EndAt != nil {
+			state.EndAt = time.Time(*t.EndAt)
+		}
+		if state.Exited && state.EndAt.IsZero() {
+			// 未记录结束时间的任务使用最后更新时间作为结束时间
+			state.EndAt = time.Time(t.UpdatedAt)
+		}
+		states[string(t.Id)] = state
+	}
+	for _, t := range tasks {
+		add(&t.BaseTask)
+	}
+	for _, t := range scanTasks {
+		add(&t.BaseTask)
+	}
+	return states, nil
+}
+
+// FindRunnerOrphans 根据任务状态找出需要清理的容器及工作目录:
+//  1. 任务不存在(下发后数据库回滚等)，且创建时间已超过保护时间的容器及工作目录
+//  2. 任务已结束但仍在运行的容器(任务结束时未能成功停止)
+//  3. 任务已结束且超过保留时间的工作目录
+//
+// 已停止的容器由 runner 的 reserver_container 配置决定是否保留，这里不处理
+func FindRunnerOrphans(containers []runner.ContainerInfo, workspaces []runner.WorkspaceInfo,
+	states map[string]RunnerTaskState, now time.Time) runner.CleanupReq {
+	req := runner.CleanupReq{
+		Containers: make([]string, 0),
+		Workspaces: make([]runner.WorkspaceRef, 0),
+	}
+
+	graceBefore := now.Add(-RunnerOrphanGracePeriod)
+	for _, c := range containers {
+		taskId := c.Labels["task-id"]
+		if taskId == "" {
+			continue
+		}
+		state, ok := states[taskId]
+		if !ok {
+			if time.Unix(c.Created, 0).Before(graceBefore) {
+				req.Containers = append(req.Containers, c.Id)
+			}
+		} else if state.Exited && c.State == "running" && !state.EndAt.IsZero() && state.EndAt.Before(graceBefore) {
+			req.Containers = append(req.Containers, c.Id)
+		}
+	}
+
+	retentionBefore := now.Add(-RunnerWorkspaceRetention)
+	for _, ws := range workspaces {
+		state, ok := states[ws.TaskId]
+		if !ok {
+			if time.Unix(ws.ModTime, 0).Before(graceBefore) {
+				req.Workspaces = append(req.Workspaces, runner.WorkspaceRef{EnvId: ws.EnvId, TaskId: ws.TaskId})
+			}
+		} else if state.Exited && !state.EndAt.IsZero() && state.EndAt.Before(retentionBefore) {
+			req.Workspaces = append(req.Workspaces, runner.WorkspaceRef{EnvId: ws.EnvId, TaskId: ws.TaskId})
+		}
+	}
+	return req
+}
+
+// requestRunner 调用 runner 接口，result 不为空时解析返回结果
+func requestRunner(runnerAddr string, path string, method string, data interface{}, result interface{}) error {
+	return requestRunnerWithDeadline(runnerAddr, path, method, data, result,
+		int(consts.RunnerConnectTimeout.Seconds())*10)
+}
+
+// requestRunnerWithDeadline 调用 runner 接口，deadline 为请求的总超时时间(秒)
+func requestRunnerWithDeadline(runnerAddr string, path string, method string,
+	data interface{}, result interface{}, deadline int) error {
+	header := &http.Header{}
+	header.Set("Content-Type", "application/json")
+	timeout := int(consts.RunnerConnectTimeout.Seconds())
+	respData, err := utils.HttpService(utils.JoinURL(runnerAddr, path), method, header, data, timeout, deadline)
+	if err != nil {
+		return err
+	}
+
+	resp := runner.Response{Result: result}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return fmt.Errorf("unexpected response: %s", respData)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf(resp.Error)
+	}
+	return nil
+}
+
+// ReconcileRunner 清理 runner 上的孤儿容器及工作目录，返回 runner 的清理结果
+func ReconcileRunner(dbSess *db.Session, runnerId string) (*runner.CleanupResp, error) {
+	runnerAddr, err := GetRunnerAddress(runnerId)
+	if err != nil {
+		return nil, err
+	}
+
+	containers := make([]runner.ContainerInfo, 0)
+	if err := requestRunner(runnerAddr, consts.RunnerContainersURL+"?all=true", "GET", nil, &containers); err != nil {
+		return nil, fmt.Errorf("list containers: %v", err)
+	}
+	workspaces := make([]runner.WorkspaceInfo, 0)
+	if err := requestRunner(runnerAddr, consts.RunnerWorkspacesURL, "GET", nil, &workspaces); err != nil {
+		return nil, fmt.Errorf("list workspaces: %v", err)
+	}
+
+	taskIds := make([]string, 0, len(containers)+len(workspaces))
+	for _, c := range containers {
+		if id := c.Labels["task-id"]; id != "" {
+			taskIds = append(taskIds, id)
+		}
+	}
+	for _, ws := range workspaces {
+		taskIds = append(taskIds, ws.TaskId)
+	}
+	states, er := GetRunnerTaskStates(dbSess, utils.RemoveDuplicateElement(taskIds))
+	if er != nil {
+		return nil, er
+	}
+
+	req := FindRunnerOrphans(containers, workspaces, states, time.Now())
+	resp := &runner.CleanupResp{}
+	if len(req.Containers) == 0 && len(req.Workspaces) == 0 {
+		return resp, nil
+	}
+	if err := requestRunner(runnerAddr, consts.RunnerCleanupURL, "POST", req, resp); err != nil {
+		return nil, fmt.Errorf("cleanup: %v", err)
+	}
+	return resp, nil
+}
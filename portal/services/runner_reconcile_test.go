@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/runner"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindRunnerOrphans(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-2 * RunnerOrphanGracePeriod)
+	recent := now.Add(-time.Minute)
+
+	container := func(id, taskId, state string, created time.Time) runner.ContainerInfo {
+		return runner.ContainerInfo{Id: id, State: state, Created: created.Unix(), Labels: map[string]string{"task-id": taskId}}
+	}
+	containers := []runner.ContainerInfo{
+		container("c-unknown", "run-unknown", "running", old),
+		container("c-unknown-recent", "run-recent", "running", recent),
+		container("c-exited", "run-exited", "running", old),
+		container("c-exited-stopped", "run-exited", "exited", old),
+		container("c-running", "run-running", "running", old),
+		container("c-noend", "run-noend", "running", old),
+		{Id: "c-nolabel", State: "running", Created: old.Unix()},
+	}
+	workspaces := []runner.WorkspaceInfo{
+		{EnvId: "env-a", TaskId: "run-unknown", ModTime: old.Unix()},
+		{TaskId: "run-recent", ModTime: recent.Unix()},
+		{EnvId: "env-a", TaskId: "run-exited", ModTime: old.Unix()},
+		{EnvId: "env-a", TaskId: "run-expired", ModTime: old.Unix()},
+		{EnvId: "env-a", TaskId: "run-running", ModTime: old.Unix()},
+		{EnvId: "env-a", TaskId: "run-noend", ModTime: old.Unix()},
+	}
+	states := map[string]RunnerTaskState{
+		"run-exited":  {Exited: true, EndAt: old},
+		"run-expired": {Exited: true, EndAt: now.Add(-2 * RunnerWorkspaceRetention)},
+		"run-running": {Exited: false},
+		"run-noend":   {Exited: true},
+	}
+
+	req := FindRunnerOrphans(containers, workspaces, states, now)
+	assert.Equal(t, []string{"c-unknown", "c-exited"}, req.Containers)
+	assert.Equal(t, []runner.WorkspaceRef{
+		{EnvId: "env-a", TaskId: "run-unknown"},
+		{EnvId: "env-a", TaskId: "run-expired"},
+	}, req.Workspaces)
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// MatchRunnersByTags 返回包含全部 tags 的 runner，结果按 runner id 排序
+func MatchRunnersByTags(runners []*api.AgentService, tags []string) []*api.AgentService {
+	matched := make([]*api.AgentService, 0)
+	for _, r := range runners {
+		if hasAllTags(r.Tags, tags) {
+			matched = append(matched, r)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID < matched[j].ID
+	})
+	return matched
+}
+
+// RunnerAffinity 任务对 runner 的要求，runner 需要对组织及项目可用并包含全部 Tags
+type RunnerAffinity struct {
+	OrgId     models.Id
+	ProjectId models.Id
+	Tags      []string
+}
+
+// GetTemplateRunnerId 选择执行云模板任务的 runner，可以选择云模板所在组织绑定的 runner 及共享的 runner
+func GetTemplateRunnerId(tpl *models.Template) (string, e.Error) {
+	affinity := RunnerAffinity{}
+	if tpl != nil {
+		affinity.OrgId = tpl.OrgId
+	}
+	return SelectRunnerId(tpl, affinity)
+}
+
+// SelectRunnerId 选择满足 affinity 要求的 runner，优先级为:
+// 云模板的默认 runner > 包含云模板全部 runner 标签且负载最低的 runner > 负载最低的 runner，
+// 相同优先级时优先选择绑定了项目或组织的 runner，runner 池中禁用的 runner 不会被选择
+func SelectRunnerId(tpl *models.Template, affinity RunnerAffinity) (string, e.Error) {
+	runners, err := RunnerSearch()
+	if err != nil {
+		return "", err
+	}
+	if len(runners) == 0 {
+		return "", e.New(e.ConsulConnError, fmt.Errorf("no active runner found"))
+	}
+	if tpl == nil {
+		return selectActiveRunner(db.Get(), runners, affinity)
+	}
+
+	sess := db.Get()
+	logger := logs.Get().WithField("tplId", tpl.Id)
+	if tpl.DefaultRunnerId != "" {
+		for _, s := range MatchRunnersByTags(runners, affinity.Tags) {
+			if s.ID != tpl.DefaultRunnerId {
+				continue
+			}
+			r, err := getPoolRunner(sess, s.ID)
+			if err != nil {
+				return "", err
+			}
+			if r == nil || (!r.Disabled && r.AffinityFor(affinity.OrgId, affinity.ProjectId) != models.RunnerAffinityNone) {
+				return s.ID, nil
+			}
+		}
+		logger.Warnf("template default runner %s is not available", tpl.DefaultRunnerId)
+	}
+	if len(tpl.RunnerTags) > 0 {
+		tplAffinity := affinity
+		tplAffinity.Tags = append(append([]string{}, affinity.Tags...), tpl.RunnerTags...)
+		if id, err := selectActiveRunner(sess, runners, tplAffinity); err == nil {
+			return id, nil
+		} else if err.Code() != e.RunnerNoMatch {
+			return "", err
+		}
+		logger.Warnf("no available runner matches tags %v", tpl.RunnerTags)
+	}
+	return selectActiveRunner(sess, runners, affinity)
+}
+
+// ResolveTaskRunner 任务入队前检查执行任务的 runner，指定的 runner 绑定了其他组织或项目时返回错误，
+// runner 不在线、已禁用或不包含任务要求的标签时重新选择 runner，没有满足要求的 runner 时返回错误
+func ResolveTaskRunner(sess *db.Session, task *models.Task, tpl *models.Template) e.Error {
+	r, err := getPoolRunner(sess, task.RunnerId)
+	if err != nil {
+		return err
+	}
+	if r != nil && r.AffinityFor(task.OrgId, task.ProjectId) == models.RunnerAffinityNone {
+		return e.New(e.RunnerNotAllowed,
+			fmt.Errorf("runner %s is not assigned to this organization or project", task.RunnerId), http.StatusBadRequest)
+	}
+	// runner 池中还没有该 runner 时(如 portal 刚启动)不做检查
+	if r == nil || (!r.Disabled && r.Status == models.RunnerOnline && hasAllTags(r.Tags, task.RunnerTags)) {
+		return nil
+	}
+
+	runnerId, err := SelectRunnerId(tpl, RunnerAffinity{OrgId: task.OrgId, ProjectId: task.ProjectId, Tags: task.RunnerTags})
+	if err != nil {
+		if err.Code() == e.RunnerNoMatch {
+			return e.New(err.Code(), err, http.StatusBadRequest)
+		}
+		return err
+	}
+	task.RunnerId = runnerId
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchRunnersByTags(t *testing.T) {
+	runners := []*api.AgentService{
+		{ID: "runner-c", Tags: []string{"region=cn-hangzhou", "network=private"}},
+		{ID: "runner-b", Tags: []string{"region=cn-beijing"}},
+		{ID: "runner-a", Tags: []string{"network=private", "region=cn-hangzhou", "gpu"}},
+	}
+
+	ids := func(rs []*api.AgentService) []string {
+		result := make([]string, 0)
+		for _, r := range rs {
+			result = append(result, r.ID)
+		}
+		return result
+	}
+
+	assert.Equal(t, []string{"runner-a", "runner-c"},
+		ids(MatchRunnersByTags(runners, []string{"region=cn-hangzhou", "network=private"})))
+	assert.Equal(t, []string{"runner-b"}, ids(MatchRunnersByTags(runners, []string{"region=cn-beijing"})))
+	assert.Equal(t, []string{}, ids(MatchRunnersByTags(runners, []string{"region=cn-beijing", "gpu"})))
+	assert.Equal(t, []string{"runner-a", "runner-b", "runner-c"}, ids(MatchRunnersByTags(runners, nil)))
+}
+
+func TestPickRunner(t *testing.T) {
+	now := time.Now()
+	heartbeat := models.Time(now.Add(-time.Minute))
+	stale := models.Time(now.Add(-models.RunnerHeartbeatTimeout - time.Second))
+	runner := func(id string, tasks int, load float64, tags ...string) *models.Runner {
+		return &models.Runner{ServiceId: id, Status: models.RunnerOnline, LastHeartbeatAt: &heartbeat,
+			RunningTasks: tasks, CpuNum: 4, Load1: load, Tags: tags}
+	}
+
+	runners := []*models.Runner{
+		runner("runner-a", 2, 0.5, "gpu"),
+		runner("runner-b", 1, 3.0),
+		runner("runner-c", 1, 1.0),
+		runner("runner-d", 0, 0),
+		runner("runner-e", 0, 0),
+	}
+	runners[3].Disabled = true
+	runners[4].LastHeartbeatAt = &stale
+
+	// 禁用及心跳超时的 runner 不会被选择，任务数量相同时选择负载较低的 runner
+	assert.Equal(t, "runner-c", PickRunner(runners, nil, now).ServiceId)
+	assert.Equal(t, "runner-a", PickRunner(runners, []string{"gpu"}, now).ServiceId)
+	assert.Nil(t, PickRunner(runners, []string{"gpu", "arm"}, now))
+
+	runners[2].Status = models.RunnerOffline
+	assert.Equal(t, "runner-b", PickRunner(runners, nil, now).ServiceId)
+}
+
+func TestPickRunnerFor(t *testing.T) {
+	now := time.Now()
+	heartbeat := models.Time(now)
+	runner := func(id string, tasks int, orgIds, projectIds []string) *models.Runner {
+		return &models.Runner{ServiceId: id, Status: models.RunnerOnline, LastHeartbeatAt: &heartbeat,
+			RunningTasks: tasks, OrgIds: orgIds, ProjectIds: projectIds}
+	}
+
+	runners := []*models.Runner{
+		runner("shared", 0, nil, nil),
+		runner("org-a", 3, []string{"org-a"}, nil),
+		runner("project-a1", 5, nil, []string{"p-a1"}),
+		runner("org-b", 0, []string{"org-b"}, nil),
+	}
+	assert.Equal(t, models.RunnerAffinityNone, runners[3].AffinityFor("org-a", "p-a1"))
+
+	// 优先选择绑定了项目的 runner，其次为绑定了组织的 runner，最后为共享 runner
+	pick := func(orgId, projectId models.Id) string {
+		r := PickRunnerFor(runners, RunnerAffinity{OrgId: orgId, ProjectId: projectId}, now)
+		if r == nil {
+			return ""
+		}
+		return r.ServiceId
+	}
+	assert.Equal(t, "project-a1", pick("org-a", "p-a1"))
+	assert.Equal(t, "org-a", pick("org-a", "p-a2"))
+	assert.Equal(t, "org-b", pick("org-b", ""))
+	assert.Equal(t, "shared", pick("org-c", ""))
+
+	runners[0].Disabled = true
+	assert.Equal(t, "", pick("org-c", ""))
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"sort"
+	"time"
+)
+
+// SchedulerOrgWeight 组织的公平调度权重，未配置时为 1
+func SchedulerOrgWeight(orgId models.Id) int {
+	return schedulerWeight(configs.Get().Scheduler.OrgWeights, orgId)
+}
+
+// SchedulerProjectWeight 项目在组织内的公平调度权重，未配置时为 1
+func SchedulerProjectWeight(projectId models.Id) int {
+	return schedulerWeight(configs.Get().Scheduler.ProjectWeights, projectId)
+}
+
+func schedulerWeight(weights map[string]int, id models.Id) int {
+	if w, ok := weights[string(id)]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// TenantSchedulerStat 组织的任务调度统计
+type TenantSchedulerStat struct {
+	OrgId          models.Id `json:"orgId"`
+	OrgName        string    `json:"orgName"`
+	Weight         int       `json:"weight"`         // 公平调度权重
+	Running        int       `json:"running"`        // 正在执行的任务数量
+	Pending        int       `json:"pending"`        // 排队中的任务数量
+	Share          float64   `json:"share"`          // 正在执行的任务占所有正在执行任务的比例
+	FairShare      float64   `json:"fairShare"`      // 按权重计算应占的比例，只在有任务执行或排队的组织间分配
+	Started        int       `json:"started"`        // 统计时间内开始执行的任务数量
+	AvgWaitSeconds float64   `json:"avgWaitSeconds"` // 统计时间内开始执行的任务平均排队时长
+	MaxWaitSeconds float64   `json:"maxWaitSeconds"` // 统计时间内开始执行的任务最长排队时长
+}
+
+type tenantTaskCount struct {
+	OrgId   models.Id
+	Running int
+	Pending int
+}
+
+type tenantTaskWait struct {
+	OrgId     models.Id
+	Started   int
+	TotalWait float64
+	MaxWait   float64
+}
+
+// TenantSchedulerStats 统计每个组织的部署任务及扫描任务的调度情况，排队时长统计 since 之后开始执行的任务
+func TenantSchedulerStats(tx *db.Session, since time.Time) ([]*TenantSchedulerStat, e.Error) {
+	counts := make([]tenantTaskCount, 0)
+	waits := make([]tenantTaskWait, 0)
+
+	countSelect := "org_id, SUM(status IN (?)) AS running, SUM(status = ?) AS pending"
+	runningStatus := []string{models.TaskRunning, models.TaskApproving}
+	activeStatus := []string{models.TaskRunning, models.TaskApproving, models.TaskPending}
+	for _, q := range []*db.Session{
+		tx.Model(&models.Task{}).Where("status IN (?)", activeStatus),
+		// 扫描任务的镜像任务不会被调度执行
+		tx.Model(&models.ScanTask{}).Where("status IN (?) AND mirror = 0", activeStatus),
+	} {
+		rs := make([]tenantTaskCount, 0)
+		if err := q.Select(countSelect, runningStatus, models.TaskPending).Group("org_id").Scan(&rs); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		counts = append(counts, rs...)
+	}
+
+	// 在部署窗口外提交的任务从计划执行时间开始计算排队时长
+	for _, q := range []*db.Session{
+		tx.Model(&models.Task{}).Select("org_id, COUNT(*) AS started, " +
+			"SUM(TIMESTAMPDIFF(SECOND, COALESCE(scheduled_at, created_at), start_at)) AS total_wait, " +
+			"MAX(TIMESTAMPDIFF(SECOND, COALESCE(scheduled_at, created_at), start_at)) AS max_wait"),
+		tx.Model(&models.ScanTask{}).Select("org_id, COUNT(*) AS started, " +
+			"SUM(TIMESTAMPDIFF(SECOND, created_at, start_at)) AS total_wait, " +
+			"MAX(TIMESTAMPDIFF(SECOND, created_at, start_at)) AS max_wait"),
+	} {
+		rs := make([]tenantTaskWait, 0)
+		if err := q.Where("start_at >= ?", since).Group("org_id").Scan(&rs); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		waits = append(waits, rs...)
+	}
+
+	stats := buildTenantStats(counts, waits, SchedulerOrgWeight)
+	if len(stats) == 0 {
+		return stats, nil
+	}
+
+	orgIds := make([]models.Id, 0, len(stats))
+	for _, s := range stats {
+		orgIds = append(orgIds, s.OrgId)
+	}
+	orgs, err := FindOrganization(tx.Where("id IN (?)", orgIds))
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	orgNames := make(map[models.Id]string, len(orgs))
+	for _, org := range orgs {
+		orgNames[org.Id] = org.Name
+	}
+	for _, s := range stats {
+		s.OrgName = orgNames[s.OrgId]
+	}
+	return stats, nil
+}
+
+// buildTenantStats 合并各组织的任务数量及排队时长，计算实际占用比例和按权重应占的比例
+func buildTenantStats(counts []tenantTaskCount, waits []tenantTaskWait, weight func(models.Id) int) []*TenantSchedulerStat {
+	statMap := make(map[models.Id]*TenantSchedulerStat)
+	getStat := func(orgId models.Id) *TenantSchedulerStat {
+		s, ok := statMap[orgId]
+		if !ok {
+			s = &TenantSchedulerStat{OrgId: orgId, Weight: weight(orgId)}
+			statMap[orgId] = s
+		}
+		return s
+	}
+
+	totalWaits := make(map[models.Id]float64)
+	for _, c := range counts {
+		s := getStat(c.OrgId)
+		s.Running += c.Running
+		s.Pending += c.Pending
+	}
+	for _, w := range waits {
+		s := getStat(w.OrgId)
+		s.Started += w.Started
+		totalWaits[w.OrgId] += w.TotalWait
+		if w.MaxWait > s.MaxWaitSeconds {
+			s.MaxWaitSeconds = w.MaxWait
+		}
+	}
+
+	totalRunning, activeWeight := 0, 0
+	for _, s := range statMap {
+		totalRunning += s.Running
+		if s.Running+s.Pending > 0 {
+			activeWeight += s.Weight
+		}
+	}
+
+	stats := make([]*TenantSchedulerStat, 0, len(statMap))
+	for _, s := range statMap {
+		if totalRunning > 0 {
+			s.Share = float64(s.Running) / float64(totalRunning)
+		}
+		if activeWeight > 0 && s.Running+s.Pending > 0 {
+			s.FairShare = float64(s.Weight) / float64(activeWeight)
+		}
+		if s.Started > 0 {
+			s.AvgWaitSeconds = totalWaits[s.OrgId] / float64(s.Started)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Running+stats[i].Pending != stats[j].Running+stats[j].Pending {
+			return stats[i].Running+stats[i].Pending > stats[j].Running+stats[j].Pending
+		}
+		return stats[i].OrgId < stats[j].OrgId
+	})
+	return stats
+}
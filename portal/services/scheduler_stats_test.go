@@ -0,0 +1,50 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTenantStats(t *testing.T) {
+	weight := func(orgId models.Id) int {
+		if orgId == "org-a" {
+			return 3
+		}
+		return 1
+	}
+	counts := []tenantTaskCount{
+		{OrgId: "org-a", Running: 1, Pending: 2},
+		{OrgId: "org-b", Running: 3, Pending: 20},
+		{OrgId: "org-a", Running: 0, Pending: 1},
+	}
+	waits := []tenantTaskWait{
+		{OrgId: "org-a", Started: 2, TotalWait: 20, MaxWait: 15},
+		{OrgId: "org-a", Started: 2, TotalWait: 100, MaxWait: 60},
+		{OrgId: "org-c", Started: 1, TotalWait: 5, MaxWait: 5},
+	}
+
+	stats := buildTenantStats(counts, waits, weight)
+	if !assert.Len(t, stats, 3) {
+		return
+	}
+
+	b, a, c := stats[0], stats[1], stats[2]
+	assert.Equal(t, models.Id("org-b"), b.OrgId)
+	assert.Equal(t, 0.75, b.Share)
+	assert.Equal(t, 0.25, b.FairShare)
+
+	assert.Equal(t, models.Id("org-a"), a.OrgId)
+	assert.Equal(t, 3, a.Pending)
+	assert.Equal(t, 0.75, a.FairShare)
+	assert.Equal(t, 4, a.Started)
+	assert.Equal(t, 30.0, a.AvgWaitSeconds)
+	assert.Equal(t, 60.0, a.MaxWaitSeconds)
+
+	// 没有执行或排队任务的组织不参与分配
+	assert.Equal(t, models.Id("org-c"), c.OrgId)
+	assert.Equal(t, 0.0, c.FairShare)
+}
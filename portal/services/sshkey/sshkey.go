@@ -17,6 +17,7 @@ import (
 	"encoding/pem"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh"
@@ -82,3 +83,26 @@ func InitSSHKeyPair() error {
 	logs.Get().Infof("generate ssh key pair: %s", c.SSHPrivateKey)
 	return generateSSHKeyPair(c.SSHPrivateKey, c.SSHPublicKey)
 }
+
+// GenerateKeyPair 生成部署密钥，返回 PEM 格式的私钥及 authorized_keys 格式的公钥
+func GenerateKeyPair() (privateKeyPem string, publicKey string, err error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return "", "", err
+	}
+	sshPublicKey, err := ssh.NewPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	privateKeyPEM := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+	return string(pem.EncodeToMemory(privateKeyPEM)), strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))), nil
+}
+
+// PublicKeyOf 返回私钥对应的 authorized_keys 格式的公钥，私钥格式错误或设置了密码时返回错误
+func PublicKeyOf(privateKeyPem string) (string, error) {
+	signer, err := ssh.ParsePrivateKey([]byte(privateKeyPem))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
@@ -0,0 +1,23 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package sshkey
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateKeyPair(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(publicKey, "ssh-rsa "))
+
+	pub, err := PublicKeyOf(privateKey)
+	assert.NoError(t, err)
+	assert.Equal(t, publicKey, pub)
+
+	_, err = PublicKeyOf("invalid key")
+	assert.Error(t, err)
+}
@@ -170,13 +170,7 @@ func GetRunnerAddress(serviceId string) (string, error) {
 	return fmt.Sprintf("http://%s:%d", s.Address, s.Port), nil
 }
 
+// GetDefaultRunnerId 选择负载最低的可用共享 runner
 func GetDefaultRunnerId() (string, e.Error) {
-	runners, err := RunnerSearch()
-	if err != nil {
-		return "", err
-	}
-	if len(runners) > 0 {
-		return runners[0].ID, nil
-	}
-	return "", e.New(e.ConsulConnError, fmt.Errorf("no active runner found"))
+	return SelectRunnerId(nil, RunnerAffinity{})
 }
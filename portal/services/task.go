@@ -4,7 +4,6 @@ package services
 
 import (
 	"cloudiac/common"
-	"cloudiac/configs"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
@@ -16,6 +15,7 @@ import (
 	"cloudiac/utils"
 	"cloudiac/utils/kafka"
 	"cloudiac/utils/logs"
+	"cloudiac/utils/rdb"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -138,6 +138,10 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 	if err != nil {
 		return nil, e.AutoNew(err, e.InternalError)
 	}
+	repoKeyId, err := GetTplRepoKeyId(tx, tpl)
+	if err != nil {
+		return nil, err
+	}
 
 	task, er := newCommonTask(tpl, env, src)
 	if er != nil {
@@ -148,6 +152,7 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 	task.Type = cronTaskType
 	task.IsDriftTask = true
 	task.RepoAddr = repoAddr
+	task.RepoKeyId = repoKeyId
 	task.CommitId = src.CommitId
 	task.CreatorId = consts.SysUserId
 	task.AutoApprove = env.AutoApproval
@@ -163,6 +168,9 @@ func CloneNewDriftTask(tx *db.Session, src models.Task, env *models.Env) (*model
 func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models.Task) (*models.Task, e.Error) {
 	// logger := logs.Get().WithField("func", "CreateTask")
 	// logger = logger.WithField("taskId", task.Id)
+	if er := CheckEnvAttestation(env, pt.Type); er != nil {
+		return nil, er
+	}
 	task, er := newCommonTask(tpl, env, pt)
 	if er != nil {
 		return nil, er
@@ -179,6 +187,9 @@ func CreateTask(tx *db.Session, tpl *models.Template, env *models.Env, pt models
 	if task.CommitId == "" {
 		task.CommitId = commitId
 	}
+	if task.RepoKeyId, err = GetTplRepoKeyId(tx, tpl); err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
 
 	return doCreateTask(tx, *task, tpl, env)
 }
@@ -189,6 +200,7 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		// 以下为需要外部传入的属性
 		Name:            pt.Name,
 		Targets:         pt.Targets,
+		Partial:         len(pt.Targets) > 0,
 		CreatorId:       pt.CreatorId,
 		Variables:       pt.Variables,
 		AutoApprove:     pt.AutoApprove,
@@ -209,8 +221,10 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		EnvId:     env.Id,
 		StatePath: env.StatePath,
 
-		Workdir:   tpl.Workdir,
-		TfVersion: tpl.TfVersion,
+		Workdir:    tpl.Workdir,
+		Workdirs:   models.StrSlice(tpl.Workdirs),
+		TfVersion:  tpl.TfVersion,
+		EngineType: tpl.EngineType,
 
 		Playbook:     env.Playbook,
 		TfVarsFile:   env.TfVarsFile,
@@ -229,18 +243,47 @@ func newCommonTask(tpl *models.Template, env *models.Env, pt models.Task) (*mode
 		Callback:  pt.Callback,
 		Source:    pt.Source,
 		SourceSys: pt.SourceSys,
+
+		RollbackFromTaskId: pt.RollbackFromTaskId,
+		FreezeOverrideId:   pt.FreezeOverrideId,
+		ScheduledAt:        pt.ScheduledAt,
+		TicketId:           pt.TicketId,
+
+		ImportAddress:    pt.ImportAddress,
+		ImportResourceId: pt.ImportResourceId,
+
+		PlanArtifactId: pt.PlanArtifactId,
+
+		StepTimeouts: MergeStepTimeouts(tpl.StepTimeouts, env.StepTimeouts),
+		RunnerTags:   env.RunnerTags,
+	}
+	if len(pt.RunnerTags) > 0 {
+		task.RunnerTags = pt.RunnerTags
 	}
 	task.Id = models.Task{}.NewId()
 	return &task, nil
 }
 
 func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *models.Env) (*models.Task, e.Error) {
-	// pipeline 内容可以从外部传入，如果没有传则尝试读取云模板目录下的文件
+	// pipeline 内容可以从外部传入，如果没有传则使用云模板保存的 pipeline，云模板未设置时尝试读取云模板目录下的文件
 	var err error
 	if er := createTaskParamCheck(task); er != nil {
 		return nil, er
 	}
+	if er := CheckEnvLock(env, task.Type, task.CreatorId); er != nil {
+		return nil, er
+	}
+	if er := CheckEnvProtection(env, &task); er != nil {
+		return nil, er
+	}
+	// 确认有满足组织、项目绑定及标签要求的 runner，避免任务入队后无法执行
+	if er := ResolveTaskRunner(tx, &task, tpl); er != nil {
+		return nil, er
+	}
 
+	if task.Pipeline == "" && tpl.Pipeline != "" {
+		task.Pipeline = tpl.Pipeline
+	}
 	if task.Pipeline == "" {
 		task.Pipeline, err = GetTplPipeline(tx, tpl.Id, task.Revision, task.Workdir)
 		if err != nil {
@@ -254,14 +297,43 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 	}
 
 	task.Flow = GetTaskFlowWithPipeline(pipeline, task.Type)
+	if task.Source == consts.TaskSourceWebhookPlan {
+		// PR 触发的 plan 任务同时进行 terraform validate 及 fmt 检查
+		task.Flow.Steps = WithValidateStep(task.Flow.Steps)
+	}
+	if env.PlanScan && (task.Type == common.TaskJobPlan || task.Type == common.TaskJobApply) {
+		// 开启 plan 扫描时，自定义工作流未包含扫描步骤也会在 plan 之后对 plan 结果执行合规检测
+		task.Flow.Steps = WithPlanScanStep(task.Flow.Steps)
+	}
+	if er := CheckTaskOffline(task.Flow); er != nil {
+		return nil, er
+	}
+	if er := CheckTaskRetryPolicy(task.Flow); er != nil {
+		return nil, er
+	}
+	if TemplateRequiresApproval(tpl, task.Type) {
+		// 云模板指定了审批人时部署任务不能自动审批
+		task.AutoApprove = false
+	}
+	// 指定了计划执行时间或在环境部署窗口外提交的任务排队等待，窗口外的时间顺延到下一个窗口开始
+	from := time.Now()
+	if task.ScheduledAt != nil && time.Time(*task.ScheduledAt).After(from) {
+		from = time.Time(*task.ScheduledAt)
+	} else {
+		task.ScheduledAt = nil
+	}
+	if next := TaskScheduledStart(env, task.Type, from); next != nil {
+		task.ScheduledAt = next
+	}
 	steps := make([]models.TaskStep, 0)
 	stepIndex := 0
-	for _, pipelineStep := range task.Flow.Steps {
-		taskStep, er := createTaskStep(tx, env, task, pipelineStep, stepIndex)
+	for _, pipelineStep := range ExpandWorkdirSteps(task.Flow.Steps, task.Workdirs, task.Type) {
+		taskStep, er := createTaskStep(tx, env, task, pipelineStep.PipelineStep, stepIndex)
 		if er != nil {
 			return nil, er
 		}
 		if taskStep != nil {
+			taskStep.Workdir = pipelineStep.Workdir
 			steps = append(steps, *taskStep)
 			stepIndex += 1
 		}
@@ -274,6 +346,15 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 	if err = tx.Insert(&task); err != nil {
 		return nil, e.New(e.DBError, errors.Wrapf(err, "save task"))
 	}
+	if er := CreateTaskVarSnapshot(tx, &task); er != nil {
+		return nil, er
+	}
+	createdEvent := models.TaskEvent{Type: models.TaskEventCreated, Status: task.Status, UserId: task.CreatorId,
+		Message: fmt.Sprintf("source: %s", task.Source)}
+	if task.ScheduledAt != nil {
+		createdEvent.Message += fmt.Sprintf(", scheduled at %s", time.Time(*task.ScheduledAt).Format(time.RFC3339))
+	}
+	RecordTaskEvent(tx, &task, createdEvent)
 
 	for i := range steps {
 		if i+1 < len(steps) {
@@ -283,6 +364,9 @@ func doCreateTask(tx *db.Session, task models.Task, tpl *models.Template, env *m
 			return nil, e.New(e.DBError, errors.Wrapf(err, "save task step"))
 		}
 	}
+	if task.ScheduledAt != nil {
+		TaskStatusChangeSendMessage(&task, consts.EventTaskScheduled)
+	}
 	return &task, nil
 }
 
@@ -313,8 +397,8 @@ func createTaskStep(tx *db.Session, env *models.Env, task models.Task, pipelineS
 		logger.Infoln("not have playbook, skip this step")
 		return nil, nil
 	} else if pipelineStep.Type == models.TaskStepEnvScan || pipelineStep.Type == models.TaskStepOpaScan {
-		// 如果环境扫描未启用，则跳过扫描步骤
-		if !env.PolicyEnable {
+		// 如果环境扫描及 plan 扫描均未启用，则跳过扫描步骤
+		if !env.PolicyEnable && !env.PlanScan {
 			return nil, nil
 		}
 	}
@@ -327,6 +411,11 @@ func createTaskStep(tx *db.Session, env *models.Env, task models.Task, pipelineS
 		}
 	}
 
+	if pipelineStep.Type == models.TaskStepImport {
+		// 导入的资源地址及云资源 id 固定为最后两个参数，runner 执行时对其进行转义
+		pipelineStep.Args = append(pipelineStep.Args, task.ImportAddress, task.ImportResourceId)
+	}
+
 	if pipelineStep.Type == models.TaskStepEnvScan || pipelineStep.Type == models.TaskStepOpaScan {
 		// 对于包含扫描的任务，创建一个对应的 scanTask 作为扫描任务记录，便于后期扫描状态的查询
 		scanTask := CreateMirrorScanTask(&task)
@@ -341,11 +430,21 @@ func createTaskStep(tx *db.Session, env *models.Env, task models.Task, pipelineS
 }
 
 func GetTaskRepoAddrAndCommitId(tx *db.Session, tpl *models.Template, revision string) (string, string, e.Error) {
+	if tpl.ModuleSource != "" {
+		// registry 模块没有代码仓库，repoAddr 记录模块地址，commitId 记录实际使用的模块版本
+		module, err := GetTfRegistryModule(tpl.ModuleSource, tpl.ModuleVersion)
+		if err != nil {
+			return "", "", e.New(e.TemplateModuleError, err)
+		}
+		return TfModuleAddrPrefix + tpl.ModuleSource, module.Version, nil
+	}
+
 	repoInfo := &tplRepoInfo{
 		User:     models.RepoUser,
 		Addr:     tpl.RepoAddr,
 		Token:    tpl.RepoToken,
 		CommitId: "",
+		KeyId:    tpl.RepoKeyId,
 	}
 
 	if tpl.VcsId == "" { // 用户直接填写的 repo 地址
@@ -361,6 +460,10 @@ func GetTaskRepoAddrAndCommitId(tx *db.Session, tpl *models.Template, revision s
 	if repoInfo.Addr == "" {
 		return "", "", e.New(e.BadParam, fmt.Errorf("repo address is blank"))
 	}
+	if repoInfo.KeyId != "" {
+		// SSH 地址(如 git@host:group/repo.git)不是 url 格式，直接返回
+		return repoInfo.Addr, repoInfo.CommitId, nil
+	}
 
 	u, err := url.Parse(repoInfo.Addr)
 	if err != nil {
@@ -377,6 +480,27 @@ type tplRepoInfo struct {
 	Token    string
 	Addr     string
 	CommitId string
+	KeyId    models.Id // clone 代码使用的 SSH 部署密钥，不为空时 Addr 为 SSH 地址
+}
+
+// tplRepoKeyId 云模板 clone 代码使用的 SSH 部署密钥，云模板未设置时使用 vcs 的设置
+func tplRepoKeyId(tpl *models.Template, vcs *models.Vcs) models.Id {
+	if tpl.RepoKeyId != "" || vcs == nil {
+		return tpl.RepoKeyId
+	}
+	return vcs.CloneKeyId
+}
+
+// GetTplRepoKeyId 查询云模板 clone 代码使用的 SSH 部署密钥，为空表示使用 https 地址及 token
+func GetTplRepoKeyId(tx *db.Session, tpl *models.Template) (models.Id, e.Error) {
+	if tpl.ModuleSource != "" || tpl.RepoKeyId != "" || tpl.VcsId == "" {
+		return tplRepoKeyId(tpl, nil), nil
+	}
+	vcs, err := QueryVcsByVcsId(tpl.VcsId, tx)
+	if err != nil {
+		return "", err
+	}
+	return tplRepoKeyId(tpl, vcs), nil
 }
 
 func getTplRepoInfo(tx *db.Session, tpl *models.Template, revision string) (*tplRepoInfo, e.Error) {
@@ -394,6 +518,12 @@ func getTplRepoInfo(tx *db.Session, tpl *models.Template, revision string) (*tpl
 		return nil, e.New(e.DBError, err)
 	}
 
+	// OAuth 及 GitHub App 认证时使用实际的访问 token clone 代码
+	resolvedVcs, er := vcsrv.ResolveVcs(vcs)
+	if er != nil {
+		return nil, e.AutoNew(er, e.VcsError)
+	}
+	vcs = resolvedVcs
 	vcsInstance, er := vcsrv.GetVcsInstance(vcs)
 	if er != nil {
 		return nil, e.New(e.VcsError, er)
@@ -405,6 +535,10 @@ func getTplRepoInfo(tx *db.Session, tpl *models.Template, revision string) (*tpl
 			return nil, e.New(e.VcsError, er)
 		}
 		repoInfo.User = user.Login
+	} else if vcs.UseOauth() {
+		repoInfo.User = vcsrv.OauthCloneUser(vcs)
+	} else if vcs.VcsType == models.VcsBitbucket {
+		repoInfo.User = vcsrv.BitbucketCloneUser
 	}
 
 	repo, er = vcsInstance.GetRepo(tpl.RepoId)
@@ -417,6 +551,15 @@ func getTplRepoInfo(tx *db.Session, tpl *models.Template, revision string) (*tpl
 		return nil, e.New(e.VcsError, er)
 	}
 
+	repoInfo.KeyId = tplRepoKeyId(tpl, vcs)
+	if repoInfo.KeyId != "" {
+		// 使用部署密钥时通过 SSH 地址 clone 代码，不需要 token
+		if repoInfo.Addr, er = vcsrv.GetRepoSshAddress(repo); er != nil {
+			return nil, e.New(e.VcsError, er)
+		}
+		return &repoInfo, nil
+	}
+
 	repoAddr := tpl.RepoAddr
 	if repoAddr == "" {
 		// 如果模板中没有记录 repoAddr，则动态获取
@@ -482,6 +625,7 @@ var stepStatus2TaskStatusMap = map[string]string{
 	models.TaskStepFailed:    models.TaskFailed,
 	models.TaskStepTimeout:   models.TaskFailed,
 	models.TaskStepComplete:  models.TaskComplete,
+	models.TaskStepCancelled: models.TaskCancelled,
 }
 
 func stepStatus2TaskStatus(s string) string {
@@ -528,6 +672,13 @@ func ChangeTaskStatus(dbSess *db.Session, task *models.Task, status, message str
 	if preStatus != status && !task.IsDriftTask {
 		TaskStatusChangeSendMessage(task, status)
 	}
+	if preStatus != status {
+		if preStatus == models.TaskPending && status == models.TaskRunning {
+			RecordTaskEvent(dbSess, task, models.TaskEvent{Type: models.TaskEventStarted, Status: status})
+		} else if task.Exited() {
+			RecordTaskEvent(dbSess, task, models.TaskEvent{Type: models.TaskEventDone, Status: status, Message: message})
+		}
+	}
 
 	if task.Exited() {
 		taskStatusExitedCall(dbSess, task, status)
@@ -559,6 +710,9 @@ func taskStatusExitedCall(dbSess *db.Session, task *models.Task, status string)
 	if task.Type == common.TaskTypePlan {
 		SendVcsComment(dbSess, task, status)
 	}
+
+	// 通过聊天指令创建的任务，结束时回复执行结果
+	SendChatOpsTaskReply(dbSess, task.Id, status, task.Message)
 }
 
 type TfState struct {
@@ -734,11 +888,21 @@ func UnmarshalTfParseJson(bs []byte) (*TfParse, error) {
 }
 
 func SaveTaskChanges(dbSess *db.Session, task *models.Task, rs []TfPlanResource) error {
-	var (
-		resAdded     = 0
-		resChanged   = 0
-		resDestroyed = 0
-	)
+	resAdded, resChanged, resDestroyed := CountPlanChanges(rs, logs.Get().WithField("taskId", task.Id))
+
+	task.Result.ResAdded = &resAdded
+	task.Result.ResChanged = &resChanged
+	task.Result.ResDestroyed = &resDestroyed
+
+	if _, err := dbSess.Model(&models.Task{}).Where("id = ?", task.Id).
+		UpdateColumn("result", task.Result); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CountPlanChanges 统计 plan 中新增、变更、删除的资源数量
+func CountPlanChanges(rs []TfPlanResource, logger logs.Logger) (resAdded, resChanged, resDestroyed int) {
 	for _, r := range rs {
 		actions := r.Change.Actions
 		switch {
@@ -753,19 +917,10 @@ func SaveTaskChanges(dbSess *db.Session, task *models.Task, rs []TfPlanResource)
 		case utils.SliceEqualStr(actions, []string{"delete"}):
 			resDestroyed += 1
 		default:
-			logs.Get().WithField("taskId", task.Id).Errorf("unknown change actions: %v", actions)
+			logger.Errorf("unknown change actions: %v", actions)
 		}
 	}
-
-	task.Result.ResAdded = &resAdded
-	task.Result.ResChanged = &resChanged
-	task.Result.ResDestroyed = &resDestroyed
-
-	if _, err := dbSess.Model(&models.Task{}).Where("id = ?", task.Id).
-		UpdateColumn("result", task.Result); err != nil {
-		return err
-	}
-	return nil
+	return resAdded, resChanged, resDestroyed
 }
 
 func GetTaskStepByStepId(tx *db.Session, stepId models.Id) (*models.TaskStep, error) {
@@ -863,9 +1018,14 @@ func fetchTaskStepLog(ctx context.Context, task models.Tasker, writer io.Writer,
 			return err
 		}
 	} else if step.IsStarted() { // running
+		fetchLog := fetchRunnerTaskStepLog
+		if rdb.Get() != nil {
+			// 多实例部署时通过 redis 共享 runner 日志
+			fetchLog = fetchSharedTaskStepLog
+		}
 		sleepDuration := consts.DbTaskPollInterval
 		for {
-			if err = fetchRunnerTaskStepLog(ctx, task.GetRunnerId(), step, writer); err != nil {
+			if err = fetchLog(ctx, task.GetRunnerId(), step, writer); err != nil {
 				if errors.Is(err, ErrRunnerTaskNotExists) && step.StartAt != nil &&
 					time.Since(time.Time(*step.StartAt)) < consts.RunnerConnectTimeout*2 {
 					// 某些情况下可能步骤被标识为了 running 状态，但调用 runner 执行任务时因为网络等原因导致没有及时启动执行。
@@ -1034,6 +1194,10 @@ func ChangeScanTaskStatus(dbSess *db.Session, task *models.ScanTask, status, mes
 		return e.AutoNew(err, e.DBError)
 	}
 
+	if task.Exited() {
+		SendChatOpsTaskReply(dbSess, task.Id, fmt.Sprintf("%s(%s)", status, task.PolicyStatus), task.Message)
+		SetScanTaskCommitStatus(dbSess, task)
+	}
 	return nil
 }
 
@@ -1066,8 +1230,8 @@ func CreateEnvScanTask(tx *db.Session, tpl *models.Template, env *models.Env, ta
 		err e.Error
 	)
 
-	// 使用默认 runner 执行扫描
-	runnerId, err := GetDefaultRunnerId()
+	// 按环境及云模板的 runner 设置选择执行扫描的 runner
+	runnerId, err := SelectRunnerId(tpl, RunnerAffinity{OrgId: env.OrgId, ProjectId: env.ProjectId, Tags: env.RunnerTags})
 	if err != nil {
 		return nil, e.New(err.Code(), err, http.StatusInternalServerError)
 	}
@@ -1094,12 +1258,15 @@ func CreateEnvScanTask(tx *db.Session, tpl *models.Template, env *models.Env, ta
 		Variables:    vars,
 		Workdir:      tpl.Workdir,
 		TfVersion:    tpl.TfVersion,
+		EngineType:   tpl.EngineType,
 		TfVarsFile:   env.TfVarsFile,
 		PlayVarsFile: env.PlayVarsFile,
 		Playbook:     env.Playbook,
 		ExtraData:    env.ExtraData,
 		StatePath:    env.StatePath,
 		PolicyStatus: common.PolicyStatusPending,
+		Priority:     models.EnvCriticalityPriority(env.Criticality),
+		ScanContext:  scanContextOfCreator(creatorId),
 	}
 
 	task.Id = task.NewId()
@@ -1108,6 +1275,9 @@ func CreateEnvScanTask(tx *db.Session, tpl *models.Template, env *models.Env, ta
 	if err != nil {
 		return nil, e.New(e.InternalError, err)
 	}
+	if task.RepoKeyId, err = GetTplRepoKeyId(tx, tpl); err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
 
 	task.Pipeline = models.DefaultPipelineRaw()
 	pipeline := models.DefaultPipeline()
@@ -1149,6 +1319,7 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 	envRevison := ""
 
 	envId := models.Id("")
+	priority := 0
 	if env != nil { // env != nil 表示为环境扫描任务
 		tpl, er = GetTemplateById(tx, env.TplId)
 		if er != nil {
@@ -1156,6 +1327,7 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 		}
 		envId = env.Id
 		envRevison = env.Revision
+		priority = models.EnvCriticalityPriority(env.Criticality)
 	}
 
 	task := models.ScanTask{
@@ -1163,6 +1335,7 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 		Name:      pt.Name,
 		CreatorId: pt.CreatorId,
 		ExtraData: pt.ExtraData,
+		Source:    pt.Source,
 		Revision:  utils.FirstValueStr(pt.Revision, envRevison, tpl.RepoRevision),
 
 		OrgId:     tpl.OrgId,
@@ -1173,6 +1346,8 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 		Workdir: tpl.Workdir,
 
 		PolicyStatus: common.PolicyStatusPending,
+		Priority:     priority,
+		ScanContext:  scanContextOfCreator(pt.CreatorId),
 
 		BaseTask: models.BaseTask{
 			Type:        pt.Type,
@@ -1190,6 +1365,11 @@ func CreateScanTask(tx *db.Session, tpl *models.Template, env *models.Env, pt mo
 	if err != nil {
 		return nil, e.New(e.InternalError, err)
 	}
+	// webhook 触发的扫描任务扫描推送的 commit
+	task.CommitId = utils.FirstValueStr(pt.CommitId, task.CommitId)
+	if task.RepoKeyId, err = GetTplRepoKeyId(tx, tpl); err != nil {
+		return nil, e.AutoNew(err, e.InternalError)
+	}
 
 	{ // 参数检查
 		if task.RepoAddr == "" {
@@ -1259,20 +1439,31 @@ func CreateMirrorScanTask(task *models.Task) *models.ScanTask {
 		RepoAddr:     task.RepoAddr,
 		Revision:     task.Revision,
 		CommitId:     task.CommitId,
+		RepoKeyId:    task.RepoKeyId,
 		Workdir:      task.Workdir,
 		Mirror:       true,
 		MirrorTaskId: task.Id,
 		Playbook:     task.Playbook,
 		TfVarsFile:   task.TfVarsFile,
 		TfVersion:    task.TfVersion,
+		EngineType:   task.EngineType,
 		PlayVarsFile: task.PlayVarsFile,
 		Variables:    task.Variables,
 		StatePath:    task.StatePath,
 		ExtraData:    task.ExtraData,
 		PolicyStatus: common.TaskPending,
+		ScanContext:  models.ScanContextDeploy,
 	}
 }
 
+// scanContextOfCreator 系统用户创建的扫描任务为系统触发，其他为手动触发
+func scanContextOfCreator(creatorId models.Id) string {
+	if creatorId == consts.SysUserId {
+		return models.ScanContextScheduled
+	}
+	return models.ScanContextManual
+}
+
 // 查询任务所有的步骤信息
 func QueryTaskStepsById(query *db.Session, taskId models.Id) *db.Session {
 	return query.Model(&models.TaskStep{}).Where("task_id = ?", taskId).Order("`index`")
@@ -1369,31 +1560,74 @@ func SendVcsComment(session *db.Session, task *models.Task, taskStatus string) {
 		logs.Get().Errorf("vcs comment err, get vcs data err: %v", er)
 		return
 	}
+	validate := ""
+	if content, err := logstorage.Get().Read(task.TfValidateJsonPath()); err == nil && len(content) > 0 {
+		result := runner.ValidateResult{}
+		if err := json.Unmarshal(content, &result); err != nil {
+			logs.Get().Warnf("vcs comment, unmarshal validate result err: %v", err)
+		} else {
+			validate = FormatValidateResult(&result)
+		}
+	}
+
+	// validate 检查未通过时不会执行 plan 步骤，此时只评论检查结果
+	var logContent []byte
 	taskStep, er := GetTaskPlanStep(session, task.Id)
-	if er != nil {
+	if er != nil && validate == "" {
 		logs.Get().Errorf("vcs comment err, get task step data err: %v", er)
 		return
+	} else if er == nil {
+		logContent, err = logstorage.Get().Read(taskStep.LogPath)
+		if err != nil && validate == "" {
+			logs.Get().Errorf("vcs comment err, get task plan log err: %v", err)
+			return
+		}
 	}
 
-	logContent, err := logstorage.Get().Read(taskStep.LogPath)
-	if err != nil {
-		logs.Get().Errorf("vcs comment err, get task plan log err: %v", err)
-		return
+	summary := PlanSummaryText(task.Result)
+	policy := ""
+	if scans, err := PolicySummary(session, []models.Id{task.Id}, consts.ScopeTask, task.OrgId); err != nil {
+		logs.Get().Warnf("vcs comment, get policy summary err: %v", err)
+	} else {
+		policy = PolicySummaryText(scans)
 	}
 
 	attr := map[string]interface{}{
-		"Status": taskStatus,
-		"Name":   env.Name,
-		//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
-		"Addr":    fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s", configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id),
-		"Content": stripansi.Strip(string(logContent)),
+		"Status":   taskStatus,
+		"Name":     env.Name,
+		"Addr":     TaskDetailAddr(task),
+		"Summary":  summary,
+		"Policy":   policy,
+		"Content":  stripansi.Strip(string(logContent)),
+		"Validate": validate,
 	}
 
 	content := utils.SprintTemplate(consts.PrCommentTpl, attr)
 	if err := vcs.CreatePrComment(vp.PrId, content); err != nil {
 		logs.Get().Errorf("vcs comment err, create comment err: %v", err)
-		return
 	}
+
+	description := fmt.Sprintf("plan %s", taskStatus)
+	if summary != "" {
+		description = fmt.Sprintf("%s: %s", description, summary)
+	}
+	SetTaskCommitStatus(vcs, task, env.Name, taskStatus, description)
+}
+
+// FormatValidateResult 将 validate 及 fmt 检查结果格式化为文本，每行一条诊断信息
+func FormatValidateResult(result *runner.ValidateResult) string {
+	lines := make([]string, 0, len(result.Diagnostics)+len(result.UnformattedFiles))
+	for _, d := range result.Diagnostics {
+		location := d.File
+		if d.Line > 0 {
+			location = fmt.Sprintf("%s:%d", d.File, d.Line)
+		}
+		lines = append(lines, strings.TrimSpace(fmt.Sprintf("%s: %s %s", d.Severity, location, d.Summary)))
+	}
+	for _, f := range result.UnformattedFiles {
+		lines = append(lines, fmt.Sprintf("fmt: %s is not formatted", f))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func QueryResource(dbSess *db.Session, task *models.Task) *db.Session {
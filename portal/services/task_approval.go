@@ -0,0 +1,103 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+)
+
+// TaskRequiredApprovals 任务步骤需要通过审批的人数，云模板指定审批人并设置了审批人数时为该值，否则为 1
+func TaskRequiredApprovals(tpl *models.Template, taskType string) int {
+	if TemplateRequiresApproval(tpl, taskType) && tpl.RequiredApprovers.MinApprovals > 1 {
+		return tpl.RequiredApprovers.MinApprovals
+	}
+	return 1
+}
+
+// CreateTaskApproval 保存用户对任务步骤的审批记录，每个用户只能审批一次
+func CreateTaskApproval(tx *db.Session, task *models.Task, step int, userId models.Id, action, comment string) (*models.TaskApproval, e.Error) {
+	approval := models.TaskApproval{
+		OrgId:     task.OrgId,
+		ProjectId: task.ProjectId,
+		EnvId:     task.EnvId,
+		TaskId:    task.Id,
+		Step:      step,
+		UserId:    userId,
+		Action:    action,
+		Comment:   comment,
+	}
+	if err := models.Create(tx, &approval); err != nil {
+		if e.IsDuplicate(err) {
+			return nil, e.New(e.TaskAlreadyApproved, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &approval, nil
+}
+
+// CountTaskStepApprovals 统计任务步骤通过审批的人数
+func CountTaskStepApprovals(sess *db.Session, taskId models.Id, step int) (int, e.Error) {
+	count, err := sess.Model(&models.TaskApproval{}).
+		Where("task_id = ? AND step = ? AND action = ?", taskId, step, models.TaskApprovalApproved).
+		Count()
+	if err != nil {
+		return 0, e.New(e.DBError, err)
+	}
+	return int(count), nil
+}
+
+// GetTasksApprovalCount 批量统计任务当前步骤通过审批的人数，返回 taskId => 人数
+func GetTasksApprovalCount(sess *db.Session, tasks []*models.Task) (map[models.Id]int, e.Error) {
+	result := make(map[models.Id]int, len(tasks))
+	if len(tasks) == 0 {
+		return result, nil
+	}
+	ids := make([]models.Id, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.Id)
+	}
+
+	rows := make([]struct {
+		TaskId models.Id
+		Step   int
+		Count  int
+	}, 0)
+	if err := sess.Model(&models.TaskApproval{}).
+		Select("task_id, step, COUNT(*) AS count").
+		Where("task_id IN (?) AND action = ?", ids, models.TaskApprovalApproved).
+		Group("task_id, step").Scan(&rows); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	counts := make(map[string]int, len(rows))
+	for _, r := range rows {
+		counts[fmt.Sprintf("%s/%d", r.TaskId, r.Step)] = r.Count
+	}
+	for _, t := range tasks {
+		result[t.Id] = counts[fmt.Sprintf("%s/%d", t.Id, t.CurrStep)]
+	}
+	return result, nil
+}
+
+// QueryTaskApprovals 查询任务的审批记录，包含审批人名称
+func QueryTaskApprovals(sess *db.Session, taskId models.Id) *db.Session {
+	return sess.Model(&models.TaskApproval{}).
+		Joins("LEFT JOIN iac_user ON iac_user.id = iac_task_approval.user_id").
+		LazySelectAppend("iac_task_approval.*", "iac_user.name AS user_name").
+		Where("iac_task_approval.task_id = ?", taskId).
+		Order("iac_task_approval.created_at")
+}
+
+// QueryPendingApprovalTasks 查询组织下等待审批且用户还未审批过当前步骤的任务
+func QueryPendingApprovalTasks(sess *db.Session, orgId, userId models.Id) *db.Session {
+	return sess.Model(&models.Task{}).
+		Joins("LEFT JOIN iac_env ON iac_env.id = iac_task.env_id").
+		Joins("LEFT JOIN iac_project ON iac_project.id = iac_task.project_id").
+		LazySelectAppend("iac_task.*", "iac_env.name AS env_name", "iac_project.name AS project_name").
+		Where("iac_task.org_id = ? AND iac_task.status = ?", orgId, models.TaskApproving).
+		Where("NOT EXISTS (SELECT 1 FROM iac_task_approval AS a "+
+			"WHERE a.task_id = iac_task.id AND a.step = iac_task.curr_step AND a.user_id = ?)", userId).
+		Order("iac_task.created_at")
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/logstorage"
+	"cloudiac/runner"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// SaveTaskArtifacts 保存步骤发布的产物文件到日志存储，步骤重试时同名产物会被覆盖
+func SaveTaskArtifacts(sess *db.Session, task *models.Task, step *models.TaskStep, files []runner.TaskArtifactFile) e.Error {
+	for _, f := range files {
+		name, err := cleanArtifactName(f.Name)
+		if err != nil {
+			return err
+		}
+		artifact := models.TaskArtifact{
+			OrgId:     task.OrgId,
+			ProjectId: task.ProjectId,
+			EnvId:     task.EnvId,
+			TaskId:    task.Id,
+			Step:      step.Index,
+			StepName:  step.Name,
+			Name:      name,
+			Size:      len(f.Content),
+			Path:      task.ArtifactPath(step.Index, name),
+		}
+		if err := logstorage.Get().Write(artifact.Path, f.Content); err != nil {
+			return e.New(e.InternalError, fmt.Errorf("write artifact '%s': %v", name, err))
+		}
+		if err := upsertTaskArtifact(sess, &artifact); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertTaskArtifact(sess *db.Session, artifact *models.TaskArtifact) e.Error {
+	exist := models.TaskArtifact{}
+	err := sess.Where("task_id = ? AND step = ? AND name = ?", artifact.TaskId, artifact.Step, artifact.Name).First(&exist)
+	if err != nil && !e.IsRecordNotFound(err) {
+		return e.New(e.DBError, err)
+	}
+	if err == nil {
+		if _, err := models.UpdateAttr(sess.Where("id = ?", exist.Id), &models.TaskArtifact{}, models.Attrs{
+			"size":      artifact.Size,
+			"step_name": artifact.StepName,
+		}); err != nil {
+			return e.New(e.DBError, err)
+		}
+		return nil
+	}
+	if err := models.Create(sess, artifact); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// cleanArtifactName 规范化产物文件名，文件名不能指向产物目录之外
+func cleanArtifactName(name string) (string, e.Error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(name, "./") {
+		return "", e.New(e.BadParam, fmt.Errorf("invalid artifact name '%s'", name))
+	}
+	return cleaned, nil
+}
+
+// QueryTaskArtifacts 查询任务的产物，按步骤及文件名排序
+func QueryTaskArtifacts(sess *db.Session, taskId models.Id) *db.Session {
+	return sess.Model(&models.TaskArtifact{}).Where("task_id = ?", taskId).Order("step, name")
+}
+
+// GetTaskArtifact 查询任务的产物
+func GetTaskArtifact(sess *db.Session, taskId models.Id, id models.Id) (*models.TaskArtifact, e.Error) {
+	artifact := models.TaskArtifact{}
+	if err := QueryTaskArtifacts(sess, taskId).Where("id = ?", id).First(&artifact); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskArtifactNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &artifact, nil
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanArtifactName(t *testing.T) {
+	cases := []struct {
+		name   string
+		expect string
+		valid  bool
+	}{
+		{"report.xml", "report.xml", true},
+		{"./reports/junit.xml", "reports/junit.xml", true},
+		{"../kubeconfig", "", false},
+		{"reports/../../kubeconfig", "", false},
+		{"/etc/passwd", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		name, err := cleanArtifactName(c.name)
+		if !c.valid {
+			assert.Error(t, err, c.name)
+			continue
+		}
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.expect, name)
+	}
+}
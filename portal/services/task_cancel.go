@@ -0,0 +1,108 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/runner"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	DefaultTaskCancelGracePeriod = 60
+
+	TaskCancelledMessage = "task cancelled"
+)
+
+// GetTaskCancelGracePeriod 取消任务时等待 terraform 退出的时间(秒)
+func GetTaskCancelGracePeriod() int {
+	if n := configs.Get().TaskCancelGracePeriod; n > 0 {
+		return n
+	}
+	return DefaultTaskCancelGracePeriod
+}
+
+// CancelTask 取消任务。未开始执行的任务直接标记为已取消；
+// 执行中的任务只记录取消请求，由 task manager 在当前步骤结束后将步骤及任务标记为已取消
+func CancelTask(tx *db.Session, task *models.Task, userId models.Id) e.Error {
+	now := models.Time(time.Now())
+	n, err := models.UpdateAttr(tx.Where("id = ? AND status = ?", task.Id, models.TaskPending), &models.Task{},
+		models.Attrs{
+			"status":       models.TaskCancelled,
+			"message":      TaskCancelledMessage,
+			"cancelled_by": userId,
+			"end_at":       &now,
+		})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n > 0 {
+		task.Status, task.Message, task.CancelledBy, task.EndAt = models.TaskCancelled, TaskCancelledMessage, userId, &now
+		return nil
+	}
+
+	n, err = models.UpdateAttr(tx.Where("id = ? AND status IN (?)", task.Id,
+		[]string{models.TaskRunning, models.TaskApproving}), &models.Task{},
+		models.Attrs{"cancelled_by": userId})
+	if err != nil {
+		return e.New(e.DBError, err)
+	} else if n == 0 {
+		return e.New(e.TaskCancelNotAllowed, fmt.Errorf("task status is '%s'", task.Status), http.StatusBadRequest)
+	}
+	task.CancelledBy = userId
+	return nil
+}
+
+// IsTaskCancelRequested 任务是否已被请求取消
+func IsTaskCancelRequested(tx *db.Session, taskId models.Id) (bool, e.Error) {
+	exist, err := tx.Model(&models.Task{}).Where("id = ? AND cancelled_by != ''", taskId).Exists()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return exist, nil
+}
+
+// CancelUnstartedTaskStep 将未开始执行(pending 或 approving)的步骤标记为已取消，不设置步骤的开始时间
+func CancelUnstartedTaskStep(tx *db.Session, step *models.TaskStep) e.Error {
+	now := models.Time(time.Now())
+	if _, err := models.UpdateAttr(tx.Where("id = ?", step.Id), &models.TaskStep{}, models.Attrs{
+		"status":  models.TaskStepCancelled,
+		"message": TaskCancelledMessage,
+		"end_at":  &now,
+	}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	step.Status, step.Message, step.EndAt = models.TaskStepCancelled, TaskCancelledMessage, &now
+	return nil
+}
+
+// CancelTaskOnRunner 通知 runner 中断正在执行的步骤，gracePeriod 秒后步骤仍未结束时 runner 会强制停止容器
+func CancelTaskOnRunner(task *models.Task, step int, gracePeriod int) (*runner.TaskCancelResp, error) {
+	runnerAddr, err := GetRunnerAddress(task.RunnerId)
+	if err != nil {
+		return nil, err
+	}
+	req := runner.TaskCancelReq{
+		EnvId:        string(task.EnvId),
+		TaskId:       string(task.Id),
+		Step:         step,
+		ContainerIds: []string{},
+		GracePeriod:  gracePeriod,
+	}
+	if task.ContainerId != "" {
+		req.ContainerIds = append(req.ContainerIds, task.ContainerId)
+	}
+
+	resp := &runner.TaskCancelResp{}
+	// runner 会等待 gracePeriod 后才返回结果
+	deadline := gracePeriod + int(consts.RunnerConnectTimeout.Seconds())*2
+	if err := requestRunnerWithDeadline(runnerAddr, consts.RunnerCancelTaskURL, "POST", req, resp, deadline); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
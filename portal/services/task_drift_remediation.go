@@ -0,0 +1,61 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+)
+
+// NeedDriftRemediation 判断偏移检测任务发现偏移后是否需要创建纠偏部署任务。
+// 只处理偏移检测的 plan 任务，开启自动纠偏(autoRepairDrift)时偏移检测任务本身就是 apply 任务
+func NeedDriftRemediation(env *models.Env, task *models.Task) bool {
+	return env.DriftMode == models.EnvDriftModeRemediate &&
+		task.IsDriftTask &&
+		task.Type == models.TaskTypePlan &&
+		!env.DriftSuspended &&
+		!env.Archived
+}
+
+// HasActiveEnvDeployTask 环境是否有未结束的 apply/destroy 任务
+func HasActiveEnvDeployTask(tx *db.Session, envId models.Id) (bool, e.Error) {
+	exist, err := tx.Model(&models.Task{}).
+		Where("env_id = ? AND type IN (?) AND status IN (?)", envId,
+			[]string{models.TaskTypeApply, models.TaskTypeDestroy},
+			[]string{models.TaskPending, models.TaskRunning, models.TaskApproving}).
+		Exists()
+	if err != nil {
+		return false, e.New(e.DBError, err)
+	}
+	return exist, nil
+}
+
+// CreateDriftRemediationTask 使用偏移检测任务的配置(分支、commit、变量、pipeline)创建纠偏部署任务，
+// 任务是否自动审批使用环境的自动审批设置
+func CreateDriftRemediationTask(tx *db.Session, env *models.Env, driftTask *models.Task) (*models.Task, e.Error) {
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+
+	paramTask := models.Task{
+		Name:            fmt.Sprintf("Drift remediation %s", driftTask.Id),
+		Targets:         driftTask.Targets,
+		CreatorId:       consts.SysUserId,
+		Variables:       driftTask.Variables,
+		KeyId:           driftTask.KeyId,
+		Revision:        driftTask.Revision,
+		CommitId:        driftTask.CommitId,
+		AutoApprove:     env.AutoApproval,
+		StopOnViolation: env.StopOnViolation,
+		BaseTask: models.BaseTask{
+			Type:     models.TaskTypeApply,
+			Pipeline: driftTask.Pipeline,
+		},
+		Source: consts.TaskSourceDriftRemediate,
+	}
+	return CreateTask(tx, tpl, env, paramTask)
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeedDriftRemediation(t *testing.T) {
+	env := &models.Env{DriftMode: models.EnvDriftModeRemediate}
+	newTask := func() *models.Task {
+		return &models.Task{IsDriftTask: true, BaseTask: models.BaseTask{Type: models.TaskTypePlan}}
+	}
+
+	assert.True(t, NeedDriftRemediation(env, newTask()))
+
+	// 只检测偏移
+	assert.False(t, NeedDriftRemediation(&models.Env{DriftMode: models.EnvDriftModeDetectOnly}, newTask()))
+	assert.False(t, NeedDriftRemediation(&models.Env{}, newTask()))
+
+	// 非偏移检测任务
+	task := newTask()
+	task.IsDriftTask = false
+	assert.False(t, NeedDriftRemediation(env, task))
+
+	// 自动纠偏的偏移检测任务本身就是 apply 任务
+	task = newTask()
+	task.Type = models.TaskTypeApply
+	assert.False(t, NeedDriftRemediation(env, task))
+
+	// 偏移检测已暂停
+	assert.False(t, NeedDriftRemediation(&models.Env{DriftMode: models.EnvDriftModeRemediate, DriftSuspended: true}, newTask()))
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"time"
+)
+
+// RecordTaskEvent 记录任务事件，事件只用于展示任务的执行时间线，保存失败时只记录日志，不影响任务执行
+func RecordTaskEvent(sess *db.Session, task *models.Task, event models.TaskEvent) {
+	event.OrgId = task.OrgId
+	event.ProjectId = task.ProjectId
+	event.EnvId = task.EnvId
+	event.TaskId = task.Id
+	if err := models.Create(sess, &event); err != nil {
+		logs.Get().WithField("taskId", task.Id).Warnf("record task event '%s' error: %v", event.Type, err)
+	}
+}
+
+// RecordTaskStepEvent 记录步骤相关的任务事件
+func RecordTaskStepEvent(sess *db.Session, task *models.Task, step *models.TaskStep, typ string) {
+	index := step.Index
+	RecordTaskEvent(sess, task, models.TaskEvent{
+		Type:     typ,
+		Step:     &index,
+		StepType: step.Type,
+		StepName: step.Name,
+		Status:   step.Status,
+		Message:  step.Message,
+	})
+}
+
+// QueryTaskEvents 按时间顺序查询任务事件
+func QueryTaskEvents(sess *db.Session, taskId models.Id) *db.Session {
+	return sess.Model(&models.TaskEvent{}).Where("task_id = ?", taskId).Order("created_at, id")
+}
+
+// TaskTimelineEvent 时间线中的事件
+type TaskTimelineEvent struct {
+	*models.TaskEvent
+
+	Elapsed  int64 `json:"elapsed"`  // 距任务创建的时间(秒)
+	Duration int64 `json:"duration"` // 距下一个事件的时间(秒)，任务未结束时最后一个事件计算到当前时间
+}
+
+// TaskTimelineSummary 任务各阶段耗时统计(秒)
+type TaskTimelineSummary struct {
+	Waiting  int64 `json:"waiting"`  // 创建到开始执行的排队时间
+	Approval int64 `json:"approval"` // 等待审批的时间
+	Running  int64 `json:"running"`  // 开始执行到结束的时间(包含等待审批的时间)
+	Total    int64 `json:"total"`    // 创建到结束的时间
+}
+
+type TaskTimeline struct {
+	Summary TaskTimelineSummary  `json:"summary"`
+	Events  []*TaskTimelineEvent `json:"events"`
+}
+
+// BuildTaskTimeline 根据按时间排序的任务事件计算各事件的耗时及各阶段的耗时，
+// now 用于计算未结束任务的最后一个事件的耗时
+func BuildTaskTimeline(events []*models.TaskEvent, now time.Time) *TaskTimeline {
+	timeline := &TaskTimeline{Events: make([]*TaskTimelineEvent, 0, len(events))}
+	if len(events) == 0 {
+		return timeline
+	}
+
+	seconds := func(from, to models.Time) int64 {
+		return int64(time.Time(to).Sub(time.Time(from)).Seconds())
+	}
+	first := events[0].CreatedAt
+	end := models.Time(now)
+	var (
+		startedAt       *models.Time
+		approvalStartAt *models.Time
+		done            bool
+	)
+	for i, ev := range events {
+		at := ev.CreatedAt
+		if ev.Type == models.TaskEventDone && !done {
+			done = true
+			end = at
+		}
+		// 任务结束后(包含结束事件)不再计算耗时
+		next := at
+		if !done {
+			next = end
+			if i+1 < len(events) {
+				next = events[i+1].CreatedAt
+			}
+		}
+		timeline.Events = append(timeline.Events, &TaskTimelineEvent{
+			TaskEvent: ev,
+			Elapsed:   seconds(first, at),
+			Duration:  seconds(at, next),
+		})
+
+		switch ev.Type {
+		case models.TaskEventStarted:
+			if startedAt == nil {
+				startedAt = &at
+				timeline.Summary.Waiting = seconds(first, at)
+			}
+		case models.TaskEventApprovalRequired:
+			approvalStartAt = &at
+		case models.TaskEventStepStarted, models.TaskEventStepFinished, models.TaskEventDone:
+			// 需要多人审批时以步骤继续执行(或结束)的时间作为审批结束时间
+			if approvalStartAt != nil {
+				timeline.Summary.Approval += seconds(*approvalStartAt, at)
+				approvalStartAt = nil
+			}
+		}
+	}
+	if approvalStartAt != nil {
+		timeline.Summary.Approval += seconds(*approvalStartAt, end)
+	}
+	if startedAt != nil {
+		timeline.Summary.Running = seconds(*startedAt, end)
+	} else {
+		timeline.Summary.Waiting = seconds(first, end)
+	}
+	timeline.Summary.Total = seconds(first, end)
+	return timeline
+}
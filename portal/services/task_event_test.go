@@ -0,0 +1,45 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTaskTimeline(t *testing.T) {
+	base := time.Date(2022, 1, 1, 10, 0, 0, 0, time.Local)
+	event := func(typ string, sec int) *models.TaskEvent {
+		ev := &models.TaskEvent{Type: typ}
+		ev.CreatedAt = models.Time(base.Add(time.Duration(sec) * time.Second))
+		return ev
+	}
+
+	events := []*models.TaskEvent{
+		event(models.TaskEventCreated, 0),
+		event(models.TaskEventQueued, 1),
+		event(models.TaskEventStarted, 30),
+		event(models.TaskEventStepStarted, 31),
+		event(models.TaskEventStepFinished, 60),
+		event(models.TaskEventApprovalRequired, 61),
+		event(models.TaskEventApproved, 100),
+		event(models.TaskEventStepStarted, 121),
+		event(models.TaskEventStepFinished, 180),
+		event(models.TaskEventDone, 190),
+	}
+	timeline := BuildTaskTimeline(events, base.Add(time.Hour))
+	assert.Equal(t, TaskTimelineSummary{Waiting: 30, Approval: 60, Running: 160, Total: 190}, timeline.Summary)
+	assert.Equal(t, int64(29), timeline.Events[1].Duration)
+	assert.Equal(t, int64(121), timeline.Events[7].Elapsed)
+	assert.Equal(t, int64(0), timeline.Events[9].Duration)
+
+	// 未结束的任务计算到当前时间
+	timeline = BuildTaskTimeline(events[:6], base.Add(100*time.Second))
+	assert.Equal(t, TaskTimelineSummary{Waiting: 30, Approval: 39, Running: 70, Total: 100}, timeline.Summary)
+	assert.Equal(t, int64(39), timeline.Events[5].Duration)
+
+	assert.Empty(t, BuildTaskTimeline(nil, base).Events)
+}
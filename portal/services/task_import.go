@@ -0,0 +1,57 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// terraform 资源地址，如 aws_instance.web、module.vpc.aws_subnet.private[0]，数据源不能导入
+var (
+	tfModuleAddrPrefixRegex = regexp.MustCompile(`^(module\.[A-Za-z_][\w-]*(\[[^\]]+\])?\.)*`)
+	tfResourceAddrRegex     = regexp.MustCompile(`^[A-Za-z_][\w-]*\.[A-Za-z_][\w-]*(\[[^\]]+\])?$`)
+)
+
+// CheckImportAddress 检查 terraform import 的资源地址
+func CheckImportAddress(addr string) e.Error {
+	resAddr := tfModuleAddrPrefixRegex.ReplaceAllString(addr, "")
+	if !tfResourceAddrRegex.MatchString(resAddr) || strings.HasPrefix(resAddr, "module.") ||
+		strings.HasPrefix(resAddr, "data.") {
+		return e.New(e.TaskImportAddrInvalid, fmt.Errorf("invalid resource address '%s'", addr))
+	}
+	return nil
+}
+
+// CreateImportTask 创建 terraform import 任务，将已有的云资源导入到环境的 state 中，
+// 任务结束后会重新统计环境资源
+func CreateImportTask(tx *db.Session, tpl *models.Template, env *models.Env,
+	address string, resourceId string, creatorId models.Id) (*models.Task, e.Error) {
+
+	if er := CheckImportAddress(address); er != nil {
+		return nil, er
+	}
+	if len(tpl.Workdirs) > 0 {
+		return nil, e.New(e.TaskImportNotSupported, fmt.Errorf("template %s has multiple workdirs", tpl.Id))
+	}
+
+	vars, err := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return CreateTask(tx, tpl, env, models.Task{
+		Name:             fmt.Sprintf("Import %s", address),
+		CreatorId:        creatorId,
+		Variables:        vars,
+		BaseTask:         models.BaseTask{Type: common.TaskJobImport},
+		Source:           consts.TaskSourceManual,
+		ImportAddress:    address,
+		ImportResourceId: resourceId,
+	})
+}
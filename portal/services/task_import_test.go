@@ -0,0 +1,30 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckImportAddress(t *testing.T) {
+	for _, addr := range []string{
+		"aws_instance.web",
+		"aws_instance.web[0]",
+		`aws_s3_bucket.b["logs"]`,
+		"module.vpc.aws_subnet.private[1]",
+		`module.app["a"].module.db.aws_db_instance.this`,
+	} {
+		assert.Nil(t, CheckImportAddress(addr), addr)
+	}
+	for _, addr := range []string{
+		"",
+		"aws_instance",
+		"data.aws_ami.ubuntu",
+		"module.vpc",
+		"aws_instance.web; rm -rf /",
+	} {
+		assert.NotNil(t, CheckImportAddress(addr), addr)
+	}
+}
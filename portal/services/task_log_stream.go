@@ -0,0 +1,207 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"cloudiac/utils/rdb"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/pkg/errors"
+)
+
+// 多实例部署时，同一个任务步骤的实时日志只由一个 portal 实例从 runner 读取，
+// 读取到的日志写入 redis stream，所有实例(包括自身)的日志请求都从 stream 中读取，
+// 这样请求可以由任意实例处理，且后加入的请求也能读取到完整的日志
+const (
+	taskLogStreamLockTTL     = 30 * time.Second // 日志发布者锁的有效期，发布期间定时续期
+	taskLogStreamTTL         = time.Hour        // 日志发布过程中 stream 的有效期，避免发布者异常退出后数据残留
+	taskLogStreamRetention   = 10 * time.Minute // 步骤结束后 stream 的保留时间，期间任务状态会更新为结束
+	taskLogStreamReadTimeout = 5 * time.Second
+)
+
+var errTaskLogPublisherLost = errors.New("task log publisher lost")
+
+// 发布者锁只能由持有者续期及释放，避免锁过期被其他实例获取后，原发布者续期或删除了其他实例的锁
+var (
+	taskLogLockRenewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+	taskLogLockReleaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+func releaseTaskLogLock(client *redis.Client, lockKey, owner string) {
+	taskLogLockReleaseScript.Run(context.Background(), client, []string{lockKey}, owner)
+}
+
+// taskLogStreamEnded 判断 stream 是否已有步骤结束标记，步骤结束后 stream 会保留一段时间供后续请求读取
+func taskLogStreamEnded(ctx context.Context, client *redis.Client, key string) (bool, error) {
+	msgs, err := client.XRevRangeN(ctx, key, "+", "-", 1).Result()
+	if err != nil {
+		return false, err
+	}
+	if len(msgs) == 0 {
+		return false, nil
+	}
+	_, ok := msgs[0].Values["end"]
+	return ok, nil
+}
+
+func taskLogStreamKey(step *models.TaskStep) string {
+	return fmt.Sprintf("cloudiac:tasklog:%s:%d", step.TaskId, step.Index)
+}
+
+// taskLogStreamWriter 将日志内容写入 redis stream
+type taskLogStreamWriter struct {
+	ctx     context.Context
+	client  *redis.Client
+	key     string
+	started bool
+}
+
+func (w *taskLogStreamWriter) Write(p []byte) (int, error) {
+	err := w.client.XAdd(w.ctx, &redis.XAddArgs{
+		Stream: w.key,
+		Values: map[string]interface{}{"data": p},
+	}).Err()
+	if err != nil {
+		return 0, err
+	}
+	if !w.started {
+		// stream 在第一次写入时创建，创建后才能设置有效期
+		w.started = true
+		w.client.Expire(w.ctx, w.key, taskLogStreamTTL)
+	}
+	return len(p), nil
+}
+
+// publishTaskStepLog 从 runner 读取步骤日志并写入 stream，直到步骤结束
+func publishTaskStepLog(client *redis.Client, runnerId string, step *models.TaskStep, key string, owner string) {
+	logger := logs.Get().WithField("func", "publishTaskStepLog").WithField("stream", key)
+	lockKey := key + ":lock"
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		releaseTaskLogLock(client, lockKey, owner)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(taskLogStreamLockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				renewed, err := taskLogLockRenewScript.Run(ctx, client, []string{lockKey},
+					owner, taskLogStreamLockTTL.Milliseconds()).Int()
+				if err == nil && renewed == 0 {
+					// 锁已过期并可能被其他实例获取，停止发布
+					logger.Warnf("task log publisher lock lost")
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	err := fetchRunnerTaskStepLog(ctx, runnerId, step, &taskLogStreamWriter{ctx: ctx, client: client, key: key})
+	end := map[string]interface{}{"end": "1"}
+	if err != nil {
+		logger.Warnf("fetch runner task step log: %v", err)
+		end = map[string]interface{}{"err": err.Error()}
+	}
+	if err := client.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: end}).Err(); err != nil {
+		logger.Errorf("publish task log end: %v", err)
+	}
+	client.Expire(ctx, key, taskLogStreamRetention)
+}
+
+// fetchSharedTaskStepLog 从 redis stream 读取步骤实时日志，没有实例在发布该步骤的日志时由当前实例发布
+func fetchSharedTaskStepLog(ctx context.Context, runnerId string, step *models.TaskStep, writer io.Writer) error {
+	client := rdb.Get()
+	key := taskLogStreamKey(step)
+	lockKey := key + ":lock"
+
+	// 锁的值包含实例 id 及随机串，同一实例内的多个发布者也不会互相续期或释放锁
+	owner := fmt.Sprintf("%s:%s", configs.Get().Consul.ServiceID, utils.RandomStr(8))
+	acquired, err := client.SetNX(ctx, lockKey, owner, taskLogStreamLockTTL).Result()
+	if err != nil {
+		return errors.Wrap(err, "acquire task log publisher")
+	}
+	if acquired {
+		ended, err := taskLogStreamEnded(ctx, client, key)
+		if err != nil {
+			releaseTaskLogLock(client, lockKey, owner)
+			return errors.Wrap(err, "read task log stream")
+		}
+		if ended {
+			// 步骤已结束，直接读取保留的日志
+			releaseTaskLogLock(client, lockKey, owner)
+		} else {
+			// 清理上一个发布者异常退出时残留的数据
+			if err := client.Del(ctx, key).Err(); err != nil {
+				releaseTaskLogLock(client, lockKey, owner)
+				return err
+			}
+			go publishTaskStepLog(client, runnerId, step, key, owner)
+		}
+	}
+
+	lastId := "0"
+	for {
+		streams, err := client.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{key, lastId},
+			Block:   taskLogStreamReadTimeout,
+		}).Result()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == redis.Nil {
+			// 一段时间内没有新日志，检查发布者是否还在
+			if n, err := client.Exists(ctx, lockKey).Result(); err != nil {
+				return err
+			} else if n == 0 {
+				return errTaskLogPublisherLost
+			}
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "read task log stream")
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				lastId = msg.ID
+				if data, ok := msg.Values["data"].(string); ok {
+					if _, err := writer.Write([]byte(data)); err != nil {
+						if errors.Is(err, io.ErrClosedPipe) {
+							return nil
+						}
+						return err
+					}
+				} else if _, ok := msg.Values["end"]; ok {
+					return nil
+				} else if errMsg, ok := msg.Values["err"].(string); ok {
+					if errMsg == ErrRunnerTaskNotExists.Error() {
+						return ErrRunnerTaskNotExists
+					}
+					return errors.New(errMsg)
+				}
+			}
+		}
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
+	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"fmt"
 	"path/filepath"
 
 	"gopkg.in/yaml.v2"
@@ -48,19 +50,55 @@ func GetTplPipeline(sess *db.Session, tplId models.Id, revision, workdir string)
 		return "", nil
 	}
 
-	if pipeline, err := DecodePipeline(string(content)); err != nil {
-		return "", e.AutoNew(err, e.InvalidPipeline)
-	} else {
-		// 检查 version 是否合法
-		_, ok := models.GetPipelineByVersion(pipeline.Version)
-		if !ok {
-			return "", e.New(e.InvalidPipelineVersion)
-		}
+	if er := ValidatePipeline(string(content)); er != nil {
+		return "", er
 	}
-
 	return string(content), nil
 }
 
+// pipelineStepTypes pipeline 中可以使用的步骤类型
+var pipelineStepTypes = []string{
+	common.TaskStepCheckout, common.TaskStepTfInit, common.TaskStepTfPlan, common.TaskStepTfApply,
+	common.TaskStepTfDestroy, common.TaskStepTfImport, common.TaskStepTfValidate,
+	common.TaskStepOpaScan, common.TaskStepEnvParse, common.TaskStepEnvScan,
+	common.TaskStepTplParse, common.TaskStepTplScan, common.TaskStepScanInit,
+	common.TaskStepAnsiblePlay, common.TaskStepCommand, common.TaskStepCheckov,
+}
+
+// ValidatePipeline 检查 pipeline 内容是否合法，内容为空时使用默认 pipeline
+func ValidatePipeline(content string) e.Error {
+	if content == "" {
+		return nil
+	}
+	pipeline, err := DecodePipeline(content)
+	if err != nil {
+		return e.New(e.InvalidPipeline, err)
+	}
+	// 检查 version 是否合法
+	if _, ok := models.GetPipelineByVersion(pipeline.Version); !ok {
+		return e.New(e.InvalidPipelineVersion)
+	}
+
+	for _, typ := range []string{common.TaskJobPlan, common.TaskJobApply, common.TaskJobDestroy, common.TaskJobImport} {
+		task := pipeline.GetTask(typ)
+		steps := append([]models.PipelineStep{}, task.Steps...)
+		for _, s := range []*models.PipelineStep{task.OnSuccess, task.OnFail} {
+			if s != nil {
+				steps = append(steps, *s)
+			}
+		}
+		for _, step := range steps {
+			if !utils.StrInArray(step.Type, pipelineStepTypes...) {
+				return e.New(e.InvalidPipeline, fmt.Errorf("%s: unknown step type '%s'", typ, step.Type))
+			}
+			if step.Type == common.TaskStepCommand && len(step.Args) == 0 {
+				return e.New(e.InvalidPipeline, fmt.Errorf("%s: command step '%s' has no args", typ, step.Name))
+			}
+		}
+	}
+	return nil
+}
+
 // 从 pipeline 中返回指定 typ 的 task，如果 pipeline 中未定义该类型 task 则返回默认 pipeline 中的值
 func GetTaskFlowWithPipeline(p models.Pipeline, typ string) models.PipelineTask {
 	defaultPipeline := models.MustGetPipelineByVersion(models.DefaultPipelineVersion)
@@ -82,6 +120,103 @@ func GetTaskFlowWithPipeline(p models.Pipeline, typ string) models.PipelineTask
 	return flow
 }
 
+// WithValidateStep 在 terraformInit 步骤之后插入 terraform validate 及 fmt 检查步骤，
+// 没有 init 步骤时插入到 checkout 之后，流程中已包含检查步骤时不做修改
+func WithValidateStep(steps []models.PipelineStep) []models.PipelineStep {
+	index := 0
+	for i, step := range steps {
+		switch step.Type {
+		case models.TaskStepValidate:
+			return steps
+		case models.TaskStepInit:
+			index = i + 1
+		case common.TaskStepCheckout:
+			if index == 0 {
+				index = i + 1
+			}
+		}
+	}
+
+	newSteps := make([]models.PipelineStep, 0, len(steps)+1)
+	newSteps = append(newSteps, steps[:index]...)
+	newSteps = append(newSteps, models.PipelineStep{Type: models.TaskStepValidate, Name: "Terraform Validate"})
+	return append(newSteps, steps[index:]...)
+}
+
+// WithPlanScanStep 在最后一个 terraformPlan 步骤之后插入 envScan 步骤，对 plan 结果执行合规检测，
+// 流程中没有 plan 步骤或已包含扫描步骤时不做修改
+func WithPlanScanStep(steps []models.PipelineStep) []models.PipelineStep {
+	index := -1
+	for i, step := range steps {
+		switch step.Type {
+		case models.TaskStepEnvScan, models.TaskStepOpaScan:
+			return steps
+		case models.TaskStepPlan:
+			index = i + 1
+		}
+	}
+	if index < 0 {
+		return steps
+	}
+
+	newSteps := make([]models.PipelineStep, 0, len(steps)+1)
+	newSteps = append(newSteps, steps[:index]...)
+	newSteps = append(newSteps, models.PipelineStep{Type: models.TaskStepEnvScan, Name: "OPA Scan"})
+	return append(newSteps, steps[index:]...)
+}
+
+// WorkdirStep 多工作目录云模板展开后的流程步骤，Workdir 为空时使用任务的工作目录
+type WorkdirStep struct {
+	models.PipelineStep
+	Workdir string
+}
+
+// ExpandWorkdirSteps 将流程中第一个至最后一个 terraform 步骤之间的部分按工作目录依次展开，
+// 每个工作目录完成 init 至 apply 后再处理下一个目录，destroy 任务按相反的顺序执行。
+// 区间内的其他步骤(如合规检测)只在最后一个工作目录中执行一次
+func ExpandWorkdirSteps(steps []models.PipelineStep, workdirs []string, taskType string) []WorkdirStep {
+	first, last := -1, -1
+	for i, step := range steps {
+		if IsTerraformStep(step.Type) {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	result := make([]WorkdirStep, 0, len(steps))
+	if len(workdirs) == 0 || first < 0 {
+		for _, step := range steps {
+			result = append(result, WorkdirStep{PipelineStep: step})
+		}
+		return result
+	}
+
+	dirs := make([]string, len(workdirs))
+	copy(dirs, workdirs)
+	if taskType == common.TaskJobDestroy {
+		for i, j := 0, len(dirs)-1; i < j; i, j = i+1, j-1 {
+			dirs[i], dirs[j] = dirs[j], dirs[i]
+		}
+	}
+
+	for _, step := range steps[:first] {
+		result = append(result, WorkdirStep{PipelineStep: step})
+	}
+	for n, dir := range dirs {
+		for _, step := range steps[first : last+1] {
+			if IsTerraformStep(step.Type) || n == len(dirs)-1 {
+				result = append(result, WorkdirStep{PipelineStep: step, Workdir: dir})
+			}
+		}
+	}
+	for _, step := range steps[last+1:] {
+		result = append(result, WorkdirStep{PipelineStep: step})
+	}
+	return result
+}
+
 func DecodePipeline(s string) (models.Pipeline, error) {
 	p := models.Pipeline{}
 	if s == "" {
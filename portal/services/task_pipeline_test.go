@@ -0,0 +1,79 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandWorkdirSteps(t *testing.T) {
+	steps := []models.PipelineStep{
+		{Type: common.TaskStepCheckout},
+		{Type: models.TaskStepInit},
+		{Type: models.TaskStepPlan},
+		{Type: models.TaskStepEnvScan},
+		{Type: models.TaskStepApply},
+		{Type: models.TaskStepPlay},
+	}
+	format := func(steps []WorkdirStep) []string {
+		rs := make([]string, 0, len(steps))
+		for _, s := range steps {
+			rs = append(rs, fmt.Sprintf("%s:%s", s.Type, s.Workdir))
+		}
+		return rs
+	}
+
+	assert.Equal(t, []string{
+		"checkout:", "terraformInit:", "terraformPlan:", "envScan:", "terraformApply:", "ansiblePlay:",
+	}, format(ExpandWorkdirSteps(steps, nil, common.TaskJobApply)))
+
+	assert.Equal(t, []string{
+		"checkout:",
+		"terraformInit:network", "terraformPlan:network", "terraformApply:network",
+		"terraformInit:compute", "terraformPlan:compute", "envScan:compute", "terraformApply:compute",
+		"ansiblePlay:",
+	}, format(ExpandWorkdirSteps(steps, []string{"network", "compute"}, common.TaskJobApply)))
+
+	destroySteps := []models.PipelineStep{
+		{Type: common.TaskStepCheckout},
+		{Type: models.TaskStepInit},
+		{Type: models.TaskStepPlan, Args: models.StrSlice{"-destroy"}},
+		{Type: models.TaskStepDestroy},
+	}
+	workdirs := []string{"network", "compute"}
+	assert.Equal(t, []string{
+		"checkout:",
+		"terraformInit:compute", "terraformPlan:compute", "terraformDestroy:compute",
+		"terraformInit:network", "terraformPlan:network", "terraformDestroy:network",
+	}, format(ExpandWorkdirSteps(destroySteps, workdirs, common.TaskJobDestroy)))
+	assert.Equal(t, []string{"network", "compute"}, workdirs)
+}
+
+func TestValidatePipeline(t *testing.T) {
+	assert.Nil(t, ValidatePipeline(""))
+
+	valid := `
+version: 0.4
+apply:
+  steps:
+    - type: checkout
+    - type: terraformInit
+    - type: checkov
+      image: bridgecrew/checkov:2
+      args: ["--soft-fail"]
+    - type: terraformPlan
+    - type: terraformApply
+    - type: command
+      args: ["./smoke-test.sh"]
+`
+	assert.Nil(t, ValidatePipeline(valid))
+
+	assert.NotNil(t, ValidatePipeline("version: 0.1\n"))
+	assert.NotNil(t, ValidatePipeline("version: 0.4\nplan:\n  steps:\n    - type: unknown\n"))
+	assert.NotNil(t, ValidatePipeline("version: 0.4\nplan:\n  onFail:\n    type: command\n"))
+}
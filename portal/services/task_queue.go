@@ -0,0 +1,436 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	QueuedTaskDeploy = "deploy"
+	QueuedTaskScan   = "scan"
+
+	// 没有历史数据时任务执行时长的估算值(秒)
+	DefaultTaskDurationEstimate = 300
+	// 统计任务平均执行时长的时间范围
+	taskDurationStatsPeriod = 7 * 24 * time.Hour
+)
+
+// QueuedTask 排队中的任务
+type QueuedTask struct {
+	Id          models.Id    `json:"id"`
+	Kind        string       `json:"kind" enums:"deploy,scan"` // 部署任务或扫描任务
+	Type        string       `json:"type"`                     // 任务类型，如 plan、apply、scan
+	Name        string       `json:"name"`
+	OrgId       models.Id    `json:"orgId"`
+	ProjectId   models.Id    `json:"projectId"`
+	EnvId       models.Id    `json:"envId"`
+	RunnerId    string       `json:"runnerId"`
+	Priority    int          `json:"priority"`
+	CreatedAt   models.Time  `json:"createdAt"`
+	ScheduledAt *models.Time `json:"scheduledAt"`
+
+	Position         int         `json:"position"`         // 在 runner 队列中的位置，从 1 开始
+	EstimatedStartAt models.Time `json:"estimatedStartAt"` // 预计开始执行的时间
+}
+
+// RunnerQueue runner 的任务队列
+type RunnerQueue struct {
+	RunnerId    string        `json:"runnerId"`
+	Capacity    int           `json:"capacity"`    // 并发任务数量限制
+	Running     int           `json:"running"`     // 正在执行(包括等待审批)的任务数量
+	Pending     int           `json:"pending"`     // 排队中的任务数量
+	AvgDuration int64         `json:"avgDuration"` // 近期任务的平均执行时长(秒)，用于估算开始时间
+	Tasks       []*QueuedTask `json:"tasks"`
+}
+
+// OrgQueue 组织的排队任务统计
+type OrgQueue struct {
+	OrgId       models.Id    `json:"orgId"`
+	OrgName     string       `json:"orgName"`
+	Pending     int          `json:"pending"`
+	NextStartAt *models.Time `json:"nextStartAt"` // 最早开始执行的排队任务的预计开始时间
+	LastStartAt *models.Time `json:"lastStartAt"` // 最晚开始执行的排队任务的预计开始时间
+}
+
+type TaskQueue struct {
+	Runners []*RunnerQueue `json:"runners"`
+	Orgs    []*OrgQueue    `json:"orgs"`
+}
+
+// queueRunningTask 正在执行的任务，用于估算其结束时间
+type queueRunningTask struct {
+	RunnerId string
+	EnvId    models.Id
+	StartAt  *models.Time
+}
+
+type runnerTaskDuration struct {
+	RunnerId string
+	Count    int
+	Total    float64
+}
+
+// GetTaskQueue 查询各 runner 排队中的任务并估算开始执行时间，runnerId 及 orgId 不为空时只返回匹配的 runner 及组织的任务
+func GetTaskQueue(tx *db.Session, runnerId string, orgId models.Id, now time.Time) (*TaskQueue, e.Error) {
+	pending := make([]*QueuedTask, 0)
+	deployTasks := make([]*models.Task, 0)
+	if err := tx.Model(&models.Task{}).Where("status = ?", models.TaskPending).
+		Order("priority DESC, created_at").Find(&deployTasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	scanTasks := make([]*models.ScanTask, 0)
+	// 扫描任务的镜像任务随部署任务执行，不单独排队
+	if err := tx.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending).
+		Order("priority DESC, created_at").Find(&scanTasks); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	// 与 task manager 的调度顺序一致，扫描任务先于部署任务执行
+	for _, t := range scanTasks {
+		pending = append(pending, &QueuedTask{
+			Id: t.Id, Kind: QueuedTaskScan, Type: t.Type, Name: t.Name,
+			OrgId: t.OrgId, ProjectId: t.ProjectId, EnvId: t.EnvId, RunnerId: t.RunnerId,
+			Priority: t.Priority, CreatedAt: t.CreatedAt,
+		})
+	}
+	for _, t := range deployTasks {
+		pending = append(pending, &QueuedTask{
+			Id: t.Id, Kind: QueuedTaskDeploy, Type: t.Type, Name: t.Name,
+			OrgId: t.OrgId, ProjectId: t.ProjectId, EnvId: t.EnvId, RunnerId: t.RunnerId,
+			Priority: t.Priority, CreatedAt: t.CreatedAt, ScheduledAt: t.ScheduledAt,
+		})
+	}
+
+	running := make([]queueRunningTask, 0)
+	durations := make([]runnerTaskDuration, 0)
+	runningStatus := []string{models.TaskRunning, models.TaskApproving}
+	since := now.Add(-taskDurationStatsPeriod)
+	for _, item := range []struct {
+		query         func() *db.Session
+		runningSelect string
+	}{
+		{func() *db.Session { return tx.Model(&models.Task{}) }, "runner_id, env_id, start_at"},
+		// 扫描任务不影响同一环境的部署任务执行
+		{func() *db.Session { return tx.Model(&models.ScanTask{}).Where("mirror = 0") }, "runner_id, start_at"},
+	} {
+		q := item.query
+		rs := make([]queueRunningTask, 0)
+		if err := q().Where("status IN (?)", runningStatus).
+			Select(item.runningSelect).Order("start_at").Scan(&rs); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		running = append(running, rs...)
+
+		ds := make([]runnerTaskDuration, 0)
+		if err := q().Where("start_at IS NOT NULL AND end_at >= ?", since).
+			Select("runner_id, COUNT(*) AS count, SUM(TIMESTAMPDIFF(SECOND, start_at, end_at)) AS total").
+			Group("runner_id").Scan(&ds); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		durations = append(durations, ds...)
+	}
+
+	queue := BuildTaskQueue(pending, running, durations, GetRunnerMax(), now)
+	if err := fillOrgQueueNames(tx, queue.Orgs); err != nil {
+		return nil, err
+	}
+	return filterTaskQueue(queue, runnerId, orgId), nil
+}
+
+// BuildTaskQueue 按调度顺序估算各 runner 排队任务的开始时间。
+// 每个 runner 有 capacity 个并发槽位，正在执行的任务按平均执行时长估算结束时间，
+// 排队任务依次占用最早空闲的槽位，同一环境的部署任务串行执行，计划执行时间之前不会开始
+func BuildTaskQueue(pending []*QueuedTask, running []queueRunningTask, durations []runnerTaskDuration,
+	capacity int, now time.Time) *TaskQueue {
+
+	if capacity < 1 {
+		capacity = 1
+	}
+	queues := make(map[string]*RunnerQueue)
+	getQueue := func(runnerId string) *RunnerQueue {
+		q, ok := queues[runnerId]
+		if !ok {
+			q = &RunnerQueue{RunnerId: runnerId, Capacity: capacity, AvgDuration: DefaultTaskDurationEstimate,
+				Tasks: make([]*QueuedTask, 0)}
+			queues[runnerId] = q
+		}
+		return q
+	}
+
+	totals := make(map[string]*runnerTaskDuration)
+	for i := range durations {
+		d := durations[i]
+		if t, ok := totals[d.RunnerId]; ok {
+			t.Count += d.Count
+			t.Total += d.Total
+		} else {
+			totals[d.RunnerId] = &d
+		}
+	}
+	for runnerId, t := range totals {
+		if t.Count > 0 && t.Total > 0 {
+			getQueue(runnerId).AvgDuration = int64(t.Total / float64(t.Count))
+		}
+	}
+
+	runningByRunner := make(map[string][]queueRunningTask)
+	for _, r := range running {
+		getQueue(r.RunnerId).Running++
+		runningByRunner[r.RunnerId] = append(runningByRunner[r.RunnerId], r)
+	}
+	for _, t := range pending {
+		q := getQueue(t.RunnerId)
+		q.Pending++
+		q.Tasks = append(q.Tasks, t)
+	}
+
+	for _, q := range queues {
+		estimateRunnerQueue(q, runningByRunner[q.RunnerId], now)
+	}
+
+	result := &TaskQueue{Runners: make([]*RunnerQueue, 0, len(queues))}
+	for _, q := range queues {
+		result.Runners = append(result.Runners, q)
+	}
+	sort.Slice(result.Runners, func(i, j int) bool { return result.Runners[i].RunnerId < result.Runners[j].RunnerId })
+	result.Orgs = buildOrgQueues(pending)
+	return result
+}
+
+// estimateRunnerQueue 计算 runner 队列中任务的位置及预计开始时间
+func estimateRunnerQueue(q *RunnerQueue, running []queueRunningTask, now time.Time) {
+	duration := time.Duration(q.AvgDuration) * time.Second
+	slots := make([]time.Time, q.Capacity)
+	for i := range slots {
+		slots[i] = now
+	}
+	earliestSlot := func() int {
+		idx := 0
+		for i := range slots {
+			if slots[i].Before(slots[idx]) {
+				idx = i
+			}
+		}
+		return idx
+	}
+	maxTime := func(a, b time.Time) time.Time {
+		if a.After(b) {
+			return a
+		}
+		return b
+	}
+
+	envReady := make(map[models.Id]time.Time)
+	for _, r := range running {
+		finish := now
+		if r.StartAt != nil {
+			// 已超过平均执行时长的任务视为即将结束
+			finish = maxTime(time.Time(*r.StartAt).Add(duration), now)
+		}
+		idx := earliestSlot()
+		slots[idx] = maxTime(slots[idx], finish)
+		if r.EnvId != "" {
+			envReady[r.EnvId] = maxTime(envReady[r.EnvId], finish)
+		}
+	}
+
+	for i, t := range q.Tasks {
+		idx := earliestSlot()
+		start := slots[idx]
+		if t.ScheduledAt != nil {
+			start = maxTime(start, time.Time(*t.ScheduledAt))
+		}
+		if t.Kind == QueuedTaskDeploy && t.EnvId != "" {
+			start = maxTime(start, envReady[t.EnvId])
+			envReady[t.EnvId] = start.Add(duration)
+		}
+		slots[idx] = start.Add(duration)
+		t.Position = i + 1
+		t.EstimatedStartAt = models.Time(start)
+	}
+}
+
+// buildOrgQueues 按组织统计排队任务及预计开始时间
+func buildOrgQueues(pending []*QueuedTask) []*OrgQueue {
+	orgMap := make(map[models.Id]*OrgQueue)
+	for _, t := range pending {
+		o, ok := orgMap[t.OrgId]
+		if !ok {
+			o = &OrgQueue{OrgId: t.OrgId}
+			orgMap[t.OrgId] = o
+		}
+		o.Pending++
+		startAt := t.EstimatedStartAt
+		if o.NextStartAt == nil || time.Time(startAt).Before(time.Time(*o.NextStartAt)) {
+			o.NextStartAt = &startAt
+		}
+		if o.LastStartAt == nil || time.Time(startAt).After(time.Time(*o.LastStartAt)) {
+			o.LastStartAt = &startAt
+		}
+	}
+
+	orgs := make([]*OrgQueue, 0, len(orgMap))
+	for _, o := range orgMap {
+		orgs = append(orgs, o)
+	}
+	sort.Slice(orgs, func(i, j int) bool {
+		if orgs[i].Pending != orgs[j].Pending {
+			return orgs[i].Pending > orgs[j].Pending
+		}
+		return orgs[i].OrgId < orgs[j].OrgId
+	})
+	return orgs
+}
+
+func fillOrgQueueNames(tx *db.Session, orgQueues []*OrgQueue) e.Error {
+	if len(orgQueues) == 0 {
+		return nil
+	}
+	orgIds := make([]models.Id, 0, len(orgQueues))
+	for _, o := range orgQueues {
+		orgIds = append(orgIds, o.OrgId)
+	}
+	orgs, err := FindOrganization(tx.Where("id IN (?)", orgIds))
+	if err != nil {
+		return e.New(e.DBError, err)
+	}
+	orgNames := make(map[models.Id]string, len(orgs))
+	for _, org := range orgs {
+		orgNames[org.Id] = org.Name
+	}
+	for _, o := range orgQueues {
+		o.OrgName = orgNames[o.OrgId]
+	}
+	return nil
+}
+
+// filterTaskQueue 只保留指定 runner 及组织的任务，任务的位置及预计开始时间仍按完整队列计算
+func filterTaskQueue(queue *TaskQueue, runnerId string, orgId models.Id) *TaskQueue {
+	if runnerId == "" && orgId == "" {
+		return queue
+	}
+	result := &TaskQueue{Runners: make([]*RunnerQueue, 0), Orgs: make([]*OrgQueue, 0)}
+	for _, q := range queue.Runners {
+		if runnerId != "" && q.RunnerId != runnerId {
+			continue
+		}
+		if orgId != "" {
+			tasks := make([]*QueuedTask, 0)
+			for _, t := range q.Tasks {
+				if t.OrgId == orgId {
+					tasks = append(tasks, t)
+				}
+			}
+			if len(tasks) == 0 {
+				continue
+			}
+			filtered := *q
+			filtered.Tasks = tasks
+			q = &filtered
+		}
+		result.Runners = append(result.Runners, q)
+	}
+	for _, o := range queue.Orgs {
+		if orgId == "" || o.OrgId == orgId {
+			result.Orgs = append(result.Orgs, o)
+		}
+	}
+	return result
+}
+
+// getQueuedTask 查询排队中的部署任务或扫描任务，任务存在但已开始执行时返回 TaskNotQueued
+func getQueuedTask(tx *db.Session, id models.Id) (models.Tasker, e.Error) {
+	var task models.Tasker
+	if t, err := GetTaskById(tx, id); err == nil {
+		task = t
+	} else if err.Code() != e.TaskNotExists {
+		return nil, err
+	} else if st, err := GetScanTaskById(tx, id); err == nil && !st.Mirror {
+		task = st
+	} else if err != nil && err.Code() != e.TaskNotExists {
+		return nil, err
+	} else {
+		return nil, e.New(e.TaskNotExists, http.StatusNotFound)
+	}
+
+	if task.Started() {
+		return nil, e.New(e.TaskNotQueued, fmt.Errorf("task status is '%s'", taskStatus(task)), http.StatusBadRequest)
+	}
+	return task, nil
+}
+
+func taskStatus(task models.Tasker) string {
+	switch t := task.(type) {
+	case *models.Task:
+		return t.Status
+	case *models.ScanTask:
+		return t.Status
+	}
+	return ""
+}
+
+// UpdateQueuedTaskPriority 调整排队中任务的调度优先级，值越大越优先执行
+func UpdateQueuedTaskPriority(tx *db.Session, id models.Id, priority int) (models.Tasker, e.Error) {
+	task, er := getQueuedTask(tx, id)
+	if er != nil {
+		return nil, er
+	}
+
+	var (
+		n   int64
+		err error
+	)
+	switch t := task.(type) {
+	case *models.Task:
+		n, err = models.UpdateAttr(tx.Where("id = ? AND status = ?", t.Id, models.TaskPending),
+			&models.Task{}, models.Attrs{"priority": priority})
+		t.Priority = priority
+	case *models.ScanTask:
+		n, err = models.UpdateAttr(tx.Where("id = ? AND status = ?", t.Id, models.TaskPending),
+			&models.ScanTask{}, models.Attrs{"priority": priority})
+		t.Priority = priority
+	}
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if n == 0 {
+		// 查询后任务已开始执行
+		return nil, e.New(e.TaskNotQueued, http.StatusBadRequest)
+	}
+	return task, nil
+}
+
+// CancelQueuedTask 取消未开始执行的任务，任务已开始执行时返回 TaskNotQueued(执行中的任务需要通过取消任务接口取消)
+func CancelQueuedTask(tx *db.Session, id models.Id, userId models.Id) (models.Tasker, e.Error) {
+	task, er := getQueuedTask(tx, id)
+	if er != nil {
+		return nil, er
+	}
+
+	now := models.Time(time.Now())
+	attrs := models.Attrs{"status": models.TaskCancelled, "message": TaskCancelledMessage, "end_at": &now}
+	var model models.Modeler = &models.ScanTask{}
+	if _, ok := task.(*models.Task); ok {
+		attrs["cancelled_by"] = userId
+		model = &models.Task{}
+	}
+	n, err := models.UpdateAttr(tx.Where("id = ? AND status = ?", task.GetId(), models.TaskPending), model, attrs)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	} else if n == 0 {
+		return nil, e.New(e.TaskNotQueued, http.StatusBadRequest)
+	}
+
+	switch t := task.(type) {
+	case *models.Task:
+		t.Status, t.Message, t.CancelledBy, t.EndAt = models.TaskCancelled, TaskCancelledMessage, userId, &now
+	case *models.ScanTask:
+		t.Status, t.Message, t.EndAt = models.TaskCancelled, TaskCancelledMessage, &now
+	}
+	return task, nil
+}
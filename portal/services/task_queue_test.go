@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTaskQueue(t *testing.T) {
+	now := time.Date(2022, 1, 1, 10, 0, 0, 0, time.Local)
+	at := func(d time.Duration) *models.Time {
+		t := models.Time(now.Add(d))
+		return &t
+	}
+
+	running := []queueRunningTask{
+		{RunnerId: "r1", EnvId: "env-a", StartAt: at(-5 * time.Minute)},
+	}
+	durations := []runnerTaskDuration{
+		{RunnerId: "r1", Count: 2, Total: 1000},
+		{RunnerId: "r1", Count: 2, Total: 1400},
+	}
+	pending := []*QueuedTask{
+		{Id: "scan-1", Kind: QueuedTaskScan, RunnerId: "r1", OrgId: "org-1", EnvId: "env-a"},
+		{Id: "run-1", Kind: QueuedTaskDeploy, RunnerId: "r1", OrgId: "org-1", EnvId: "env-a"},
+		{Id: "run-2", Kind: QueuedTaskDeploy, RunnerId: "r1", OrgId: "org-2", EnvId: "env-b", ScheduledAt: at(time.Hour)},
+		{Id: "run-3", Kind: QueuedTaskDeploy, RunnerId: "r2", OrgId: "org-2", EnvId: "env-c"},
+	}
+
+	queue := BuildTaskQueue(pending, running, durations, 2, now)
+	if !assert.Len(t, queue.Runners, 2) {
+		return
+	}
+	r1 := queue.Runners[0]
+	assert.Equal(t, "r1", r1.RunnerId)
+	assert.Equal(t, int64(600), r1.AvgDuration)
+	assert.Equal(t, 1, r1.Running)
+	assert.Equal(t, 3, r1.Pending)
+
+	// 扫描任务使用空闲的槽位立即开始
+	assert.Equal(t, 1, pending[0].Position)
+	assert.Equal(t, models.Time(now), pending[0].EstimatedStartAt)
+	// 同一环境的部署任务等待正在执行的任务结束(开始 5 分钟，平均 10 分钟)
+	assert.Equal(t, models.Time(now.Add(5*time.Minute)), pending[1].EstimatedStartAt)
+	// 计划执行时间之前不会开始
+	assert.Equal(t, models.Time(now.Add(time.Hour)), pending[2].EstimatedStartAt)
+	// 没有历史数据的 runner 使用默认估算时长
+	assert.Equal(t, int64(DefaultTaskDurationEstimate), queue.Runners[1].AvgDuration)
+	assert.Equal(t, models.Time(now), pending[3].EstimatedStartAt)
+
+	if assert.Len(t, queue.Orgs, 2) {
+		assert.Equal(t, models.Id("org-1"), queue.Orgs[0].OrgId)
+		assert.Equal(t, 2, queue.Orgs[1].Pending)
+		assert.Equal(t, models.Time(now), *queue.Orgs[1].NextStartAt)
+		assert.Equal(t, models.Time(now.Add(time.Hour)), *queue.Orgs[1].LastStartAt)
+	}
+
+	filtered := filterTaskQueue(queue, "", "org-2")
+	assert.Len(t, filtered.Runners, 2)
+	assert.Len(t, filtered.Runners[0].Tasks, 1)
+	assert.Equal(t, 3, filtered.Runners[0].Tasks[0].Position)
+}
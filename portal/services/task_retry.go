@@ -0,0 +1,115 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net/http"
+)
+
+// RetryStepIndex 计算从失败步骤重试时开始执行的步骤。
+// apply/destroy 步骤失败时可能已变更了部分资源，保存的 plan 文件已过期，需要从 plan 步骤重新执行
+func RetryStepIndex(task *models.Task, steps []*models.TaskStep) (int, e.Error) {
+	var failed *models.TaskStep
+	for _, s := range steps {
+		if s.Index == task.CurrStep && s.IsFail() {
+			failed = s
+			break
+		}
+	}
+	if failed == nil {
+		return 0, e.New(e.TaskRetryNotAllowed, fmt.Errorf("task has no failed step"), http.StatusBadRequest)
+	}
+
+	index := failed.Index
+	if failed.Type == models.TaskStepApply || failed.Type == models.TaskStepDestroy {
+		if task.PlanArtifactId != "" {
+			return 0, e.New(e.TaskRetryNotAllowed,
+				fmt.Errorf("task applies a saved plan, it can not be replanned"), http.StatusBadRequest)
+		}
+		planIndex := -1
+		for _, s := range steps {
+			if s.Type == models.TaskStepPlan && s.Index >= 0 && s.Index < failed.Index {
+				planIndex = s.Index
+			}
+		}
+		if planIndex < 0 {
+			return 0, e.New(e.TaskRetryNotAllowed,
+				fmt.Errorf("no plan step before step %s", failed), http.StatusBadRequest)
+		}
+		index = planIndex
+	}
+	if index == 0 {
+		// 第一个步骤(代码检出)还没有可复用的工作目录，直接重新发起任务即可
+		return 0, e.New(e.TaskRetryNotAllowed, fmt.Errorf("task failed at the first step"), http.StatusBadRequest)
+	}
+	return index, nil
+}
+
+// checkTaskRetryable 任务失败后环境中有新的变更任务或正在执行的任务时不能重试，避免基于过期的工作目录及 state 执行
+func checkTaskRetryable(tx *db.Session, task *models.Task) e.Error {
+	if task.Status != models.TaskFailed {
+		return e.New(e.TaskRetryNotAllowed, fmt.Errorf("task status is '%s'", task.Status), http.StatusBadRequest)
+	}
+	exist, err := tx.Model(&models.Task{}).
+		Where("env_id = ? AND id != ?", task.EnvId, task.Id).
+		Where("(created_at > ? AND type IN (?)) OR status IN (?)", task.CreatedAt,
+			[]string{models.TaskTypeApply, models.TaskTypeDestroy, models.TaskTypeImport},
+			[]string{models.TaskPending, models.TaskRunning, models.TaskApproving}).
+		Exists()
+	if err != nil {
+		return e.New(e.DBError, err)
+	}
+	if exist {
+		return e.New(e.TaskRetryNotAllowed,
+			fmt.Errorf("env has newer or active tasks"), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// RetryTaskFromFailedStep 从失败的步骤重新执行任务，已成功的步骤不再执行。
+// 任务重置为 pending 状态后由 task manager 调度，runner 会启动新容器并复用任务已有的工作目录
+func RetryTaskFromFailedStep(tx *db.Session, task *models.Task) (*models.Task, e.Error) {
+	if er := checkTaskRetryable(tx, task); er != nil {
+		return nil, er
+	}
+	steps, err := GetTaskSteps(tx, task.Id)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	index, er := RetryStepIndex(task, steps)
+	if er != nil {
+		return nil, er
+	}
+
+	if _, err := models.UpdateAttr(tx.Where("task_id = ? AND `index` >= ?", task.Id, index),
+		&models.TaskStep{}, models.Attrs{
+			"status":              models.TaskStepPending,
+			"message":             "",
+			"exit_code":           0,
+			"start_at":            nil,
+			"end_at":              nil,
+			"approver_id":         "",
+			"current_retry_count": 0,
+			"next_retry_time":     0,
+		}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	// 清空容器 id，runner 会为重试的步骤启动新的容器
+	if _, err := models.UpdateAttr(tx.Where("id = ? AND status = ?", task.Id, models.TaskFailed),
+		&models.Task{}, models.Attrs{
+			"status":           models.TaskPending,
+			"message":          "",
+			"curr_step":        index,
+			"container_id":     "",
+			"end_at":           nil,
+			"step_retry_count": task.StepRetryCount + 1,
+		}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return GetTask(tx, task.Id)
+}
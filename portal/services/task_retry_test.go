@@ -0,0 +1,63 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryStepIndex(t *testing.T) {
+	newSteps := func(failedIndex int) []*models.TaskStep {
+		types := []string{common.TaskStepCheckout, models.TaskStepInit, models.TaskStepPlan, models.TaskStepApply}
+		steps := make([]*models.TaskStep, 0, len(types))
+		for i, typ := range types {
+			s := &models.TaskStep{Index: i, Status: models.TaskStepComplete}
+			s.Type = typ
+			if i == failedIndex {
+				s.Status = models.TaskStepFailed
+			} else if i > failedIndex {
+				s.Status = models.TaskStepPending
+			}
+			steps = append(steps, s)
+		}
+		return steps
+	}
+
+	cases := []struct {
+		failed   int
+		planArt  models.Id
+		expected int
+		errCode  int
+	}{
+		{failed: 1, expected: 1},
+		{failed: 2, expected: 2},
+		// apply 失败时从 plan 步骤重新执行
+		{failed: 3, expected: 2},
+		{failed: 3, planArt: "pa-1", errCode: e.TaskRetryNotAllowed},
+		{failed: 0, errCode: e.TaskRetryNotAllowed},
+	}
+	for _, c := range cases {
+		task := &models.Task{PlanArtifactId: c.planArt}
+		task.CurrStep = c.failed
+		index, err := RetryStepIndex(task, newSteps(c.failed))
+		if c.errCode != 0 {
+			if assert.NotNil(t, err, "failed step %d", c.failed) {
+				assert.Equal(t, c.errCode, err.Code())
+			}
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, c.expected, index, "failed step %d", c.failed)
+	}
+
+	// 当前步骤未失败(如任务被驳回)时不能重试
+	task := &models.Task{}
+	task.CurrStep = 2
+	_, err := RetryStepIndex(task, newSteps(4))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+)
+
+// NeedRollback 判断任务是否需要创建自动回滚任务，只有 apply 步骤执行失败(资源可能已部分变更)才需要回滚。
+// 回滚任务及偏移检测任务失败不再触发回滚，避免循环回滚
+func NeedRollback(env *models.Env, task *models.Task, lastStep *models.TaskStep) bool {
+	return env.AutoRollback &&
+		task.Type == models.TaskTypeApply &&
+		lastStep.Type == models.TaskStepApply &&
+		(lastStep.Status == models.TaskStepFailed || lastStep.Status == models.TaskStepTimeout) &&
+		task.RollbackTaskId == "" &&
+		task.Source != consts.TaskSourceRollback &&
+		!task.IsDriftTask
+}
+
+// GetLastSuccessApplyTask 查询环境最后一次部署成功的任务
+func GetLastSuccessApplyTask(query *db.Session, envId models.Id, excludeTaskId models.Id) (*models.Task, e.Error) {
+	task := models.Task{}
+	err := query.Model(&models.Task{}).
+		Where("env_id = ? AND type = ? AND status = ? AND id != ?",
+			envId, models.TaskTypeApply, models.TaskComplete, excludeTaskId).
+		Order("created_at DESC").First(&task)
+	if err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &task, nil
+}
+
+// CreateRollbackTask 基于环境最后一次部署成功的配置(分支、commit、变量、pipeline)创建回滚任务，
+// 并记录到失败任务的 rollbackTaskId
+func CreateRollbackTask(tx *db.Session, env *models.Env, failedTask *models.Task) (*models.Task, e.Error) {
+	lastTask, err := GetLastSuccessApplyTask(tx, env.Id, failedTask.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	tpl, err := GetTemplateById(tx, env.TplId)
+	if err != nil {
+		return nil, err
+	}
+
+	paramTask := models.Task{
+		Name:            fmt.Sprintf("Rollback %s", failedTask.Id),
+		Targets:         lastTask.Targets,
+		CreatorId:       consts.SysUserId,
+		Variables:       lastTask.Variables,
+		KeyId:           lastTask.KeyId,
+		Revision:        lastTask.Revision,
+		CommitId:        lastTask.CommitId,
+		AutoApprove:     env.RollbackAutoApprove,
+		StopOnViolation: env.StopOnViolation,
+		BaseTask: models.BaseTask{
+			Type:     models.TaskTypeApply,
+			Pipeline: lastTask.Pipeline,
+		},
+		Source:             consts.TaskSourceRollback,
+		RollbackFromTaskId: failedTask.Id,
+	}
+
+	task, err := CreateTask(tx, tpl, env, paramTask)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, er := tx.Model(&models.Task{}).Where("id = ?", failedTask.Id).
+		UpdateColumn("rollback_task_id", task.Id); er != nil {
+		return nil, e.New(e.DBError, er)
+	}
+	return task, nil
+}
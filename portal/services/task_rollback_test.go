@@ -0,0 +1,50 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeedRollback(t *testing.T) {
+	env := &models.Env{AutoRollback: true}
+	newTask := func() *models.Task {
+		return &models.Task{BaseTask: models.BaseTask{Type: models.TaskTypeApply}}
+	}
+	newStep := func(typ, status string) *models.TaskStep {
+		step := &models.TaskStep{Status: status}
+		step.Type = typ
+		return step
+	}
+	applyFailed := newStep(models.TaskStepApply, models.TaskStepFailed)
+
+	assert.True(t, NeedRollback(env, newTask(), applyFailed))
+	assert.True(t, NeedRollback(env, newTask(), newStep(models.TaskStepApply, models.TaskStepTimeout)))
+
+	// 未开启自动回滚
+	assert.False(t, NeedRollback(&models.Env{}, newTask(), applyFailed))
+	// plan 失败时资源未变更，不需要回滚
+	assert.False(t, NeedRollback(env, newTask(), newStep(models.TaskStepPlan, models.TaskStepFailed)))
+	assert.False(t, NeedRollback(env, newTask(), newStep(models.TaskStepApply, models.TaskStepComplete)))
+
+	task := newTask()
+	task.Type = models.TaskTypeDestroy
+	assert.False(t, NeedRollback(env, task, applyFailed))
+
+	// 回滚任务失败不再触发回滚
+	task = newTask()
+	task.Source = consts.TaskSourceRollback
+	assert.False(t, NeedRollback(env, task, applyFailed))
+
+	task = newTask()
+	task.RollbackTaskId = "run-xxx"
+	assert.False(t, NeedRollback(env, task, applyFailed))
+
+	task = newTask()
+	task.IsDriftTask = true
+	assert.False(t, NeedRollback(env, task, applyFailed))
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+)
+
+// QueryScheduledTask 查询排队等待计划执行时间的任务
+func QueryScheduledTask(query *db.Session) *db.Session {
+	return query.Model(&models.Task{}).
+		Where("status = ? AND scheduled_at IS NOT NULL", common.TaskPending)
+}
+
+// CancelScheduledTask 取消等待执行的计划任务，任务标记为驳回，不影响环境状态
+func CancelScheduledTask(tx *db.Session, task *models.Task, username string) e.Error {
+	if task.Status != common.TaskPending || task.ScheduledAt == nil {
+		return e.New(e.TaskNotScheduled, fmt.Errorf("task %s is not waiting for schedule", task.Id))
+	}
+	return ChangeTaskStatus(tx, task, common.TaskRejected, fmt.Sprintf("scheduled task cancelled by %s", username), true)
+}
@@ -9,6 +9,7 @@ import (
 	"cloudiac/portal/models"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
+	"fmt"
 	"time"
 )
 
@@ -57,8 +58,8 @@ func ApproveTaskStep(tx *db.Session, taskId models.Id, step int, userId models.I
 	return ChangeTaskStepStatusAndUpdate(tx, task, taskStep, models.TaskStepPending, "")
 }
 
-// RejectTaskStep 驳回步骤审批
-func RejectTaskStep(dbSess *db.Session, taskId models.Id, step int, userId models.Id) e.Error {
+// RejectTaskStep 驳回步骤审批，reason 为驳回原因
+func RejectTaskStep(dbSess *db.Session, taskId models.Id, step int, userId models.Id, reason string) e.Error {
 	taskStep, er := GetTaskStep(dbSess, taskId, step)
 	if er != nil {
 		return e.AutoNew(er, e.DBError)
@@ -69,13 +70,22 @@ func RejectTaskStep(dbSess *db.Session, taskId models.Id, step int, userId model
 	if task, err := GetTask(dbSess, taskStep.TaskId); err != nil {
 		return e.AutoNew(err, e.DBError)
 	} else {
-		return ChangeTaskStepStatusAndUpdate(dbSess, task, taskStep, models.TaskStepRejected, "rejected")
+		message := "rejected"
+		if reason != "" {
+			message = fmt.Sprintf("rejected: %s", reason)
+		}
+		return ChangeTaskStepStatusAndUpdate(dbSess, task, taskStep, models.TaskStepRejected, message)
 	}
 }
 
 func IsTerraformStep(typ string) bool {
 	return utils.StrInArray(typ, models.TaskStepInit, models.TaskStepPlan,
-		models.TaskStepApply, models.TaskStepDestroy)
+		models.TaskStepApply, models.TaskStepDestroy, models.TaskStepImport)
+}
+
+// IsScanStep 判断是否为策略扫描步骤，扫描步骤的结果包含策略决策日志
+func IsScanStep(typ string) bool {
+	return utils.StrInArray(typ, models.TaskStepEnvScan, models.TaskStepTplScan, models.TaskStepOpaScan)
 }
 
 func ChangeTaskStepStatusAndExitCode(dbSess *db.Session, task models.Tasker, taskStep *models.TaskStep,
@@ -91,6 +101,17 @@ func ChangeTaskStepStatusAndUpdate(dbSess *db.Session, task models.Tasker, taskS
 		return nil
 	}
 
+	// 任务被请求取消后，执行中断的步骤标记为已取消而不是失败
+	if t, ok := task.(*models.Task); ok && taskStep.Id != "" &&
+		(status == models.TaskStepFailed || status == models.TaskStepTimeout) {
+		if cancelled, er := IsTaskCancelRequested(dbSess, t.Id); er != nil {
+			return er
+		} else if cancelled {
+			status, message = models.TaskStepCancelled, TaskCancelledMessage
+		}
+	}
+
+	preStatus := taskStep.Status
 	taskStep.Status = status
 	taskStep.Message = message
 
@@ -117,6 +138,9 @@ func ChangeTaskStepStatusAndUpdate(dbSess *db.Session, task models.Tasker, taskS
 	if _, err := dbSess.Model(taskStep).Update(taskStep); err != nil {
 		return e.New(e.DBError, err)
 	}
+	if t, ok := task.(*models.Task); ok && preStatus != status {
+		recordTaskStepStatusEvent(dbSess, t, taskStep)
+	}
 
 	if taskStep.IsExited() && !taskStep.IsRejected() {
 		// 步骤结束时任务不能同步修改状态，需要等资源采集步骤执行结束并生成统计数据后才能更新任务状态。
@@ -132,6 +156,18 @@ func ChangeTaskStepStatusAndUpdate(dbSess *db.Session, task models.Tasker, taskS
 	return ChangeTaskStatusWithStep(dbSess, task, taskStep)
 }
 
+// recordTaskStepStatusEvent 步骤开始执行、等待审批及结束时记录任务事件
+func recordTaskStepStatusEvent(sess *db.Session, task *models.Task, step *models.TaskStep) {
+	switch {
+	case step.Status == models.TaskStepRunning:
+		RecordTaskStepEvent(sess, task, step, models.TaskEventStepStarted)
+	case step.Status == models.TaskStepApproving:
+		RecordTaskStepEvent(sess, task, step, models.TaskEventApprovalRequired)
+	case step.IsExited():
+		RecordTaskStepEvent(sess, task, step, models.TaskEventStepFinished)
+	}
+}
+
 func newTaskStep(task models.Task, stepBody models.PipelineStep, index int) *models.TaskStep {
 	s := models.TaskStep{
 		PipelineStep: stepBody,
@@ -146,6 +182,11 @@ func newTaskStep(task models.Task, stepBody models.PipelineStep, index int) *mod
 		RetryNumber:  task.RetryNumber,
 	}
 
+	if s.Retry == nil {
+		// 步骤未单独设置自动重试策略时使用工作流的设置
+		s.Retry = task.Flow.Retry
+	}
+
 	// apply 和 destroy 步骤需要审批
 	if !task.AutoApprove && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy) {
 		s.MustApproval = true
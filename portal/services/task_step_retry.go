@@ -0,0 +1,192 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+const (
+	defaultStepRetryDelay    = 10  // 首次重试前的默认等待时间(秒)
+	defaultStepRetryBackoff  = 2.0 // 重试等待时间的默认增长倍数
+	defaultStepRetryMaxDelay = 300 // 重试等待时间的默认上限(秒)
+	maxStepRetryCount        = 10
+)
+
+// DefaultTransientErrorPatterns 内置的临时性错误规则，匹配网络超时、连接中断及云厂商 api 限流等可以通过重试恢复的错误
+var DefaultTransientErrorPatterns = []string{
+	`(?i)i/o timeout`,
+	`(?i)tls handshake timeout`,
+	`(?i)context deadline exceeded`,
+	`(?i)connection (reset by peer|refused)`,
+	`(?i)temporary failure in name resolution`,
+	`(?i)no such host`,
+	`(?i)unexpected eof`,
+	`(?i)(429 too many requests|502 bad gateway|503 service unavailable|504 gateway time-?out)`,
+	`(?i)(throttl(ed|ing)|too ?many ?requests|rate ?exceeded|request ?limit ?exceeded|rate limit)`,
+	`(?i)service ?unavailable`,
+}
+
+// CheckTaskRetryPolicy 创建作业时检查工作流及各步骤设置的自动重试策略
+func CheckTaskRetryPolicy(flow models.PipelineTask) e.Error {
+	if err := checkRetryPolicy(flow.Retry); err != nil {
+		return e.New(e.TaskRetryPolicyInvalid, err, http.StatusBadRequest)
+	}
+	steps := append([]models.PipelineStep{}, flow.Steps...)
+	for _, s := range []*models.PipelineStep{flow.OnSuccess, flow.OnFail} {
+		if s != nil {
+			steps = append(steps, *s)
+		}
+	}
+	for _, s := range steps {
+		if err := checkRetryPolicy(s.Retry); err != nil {
+			return e.New(e.TaskRetryPolicyInvalid, fmt.Errorf("step '%s': %v", s.Name, err), http.StatusBadRequest)
+		}
+	}
+	return nil
+}
+
+func checkRetryPolicy(p *models.PipelineRetry) error {
+	if p == nil {
+		return nil
+	}
+	if p.Count < 0 || p.Count > maxStepRetryCount {
+		return fmt.Errorf("retry count must be between 0 and %d", maxStepRetryCount)
+	}
+	if p.Delay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("retry delay must not be negative")
+	}
+	if p.Backoff != 0 && p.Backoff < 1 {
+		return fmt.Errorf("retry backoff must be greater than or equal to 1")
+	}
+	for _, pattern := range p.Patterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid retry pattern '%s': %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// StepRetryDelay 返回按重试策略第 attempt 次(从 1 开始)重试前的等待时间(秒)，
+// 等待时间为 delay * backoff^(attempt-1)，不超过 maxDelay
+func StepRetryDelay(p models.PipelineRetry, attempt int) int {
+	delay := float64(utils.FirstValueInt(p.Delay, defaultStepRetryDelay))
+	maxDelay := float64(utils.FirstValueInt(p.MaxDelay, defaultStepRetryMaxDelay))
+	backoff := p.Backoff
+	if backoff == 0 {
+		backoff = defaultStepRetryBackoff
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= backoff
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return int(delay)
+}
+
+// MatchTransientError 返回步骤日志匹配到的临时性错误规则，未匹配时返回空字符串。
+// 重试策略未设置 patterns 时使用内置规则
+func MatchTransientError(p models.PipelineRetry, stepLog []byte) string {
+	patterns := p.Patterns
+	if len(patterns) == 0 {
+		patterns = DefaultTransientErrorPatterns
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if re.Match(stepLog) {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// NextStepRetry 判断执行失败的步骤是否自动重试，返回重试前的等待时间及匹配到的临时性错误规则。
+// 步骤设置了重试策略时只重试日志匹配临时性错误的失败，否则按环境的重试设置重试
+func NextStepRetry(task *models.Task, step *models.TaskStep, stepLog []byte) (retry bool, delay int, pattern string) {
+	if p := step.Retry; p != nil && p.Count > 0 {
+		if step.CurrentRetryCount >= p.Count {
+			return false, 0, ""
+		}
+		if pattern = MatchTransientError(*p, stepLog); pattern == "" {
+			return false, 0, ""
+		}
+		return true, StepRetryDelay(*p, step.CurrentRetryCount+1), pattern
+	}
+	if task.RetryAble && step.RetryNumber > 0 && step.CurrentRetryCount < step.RetryNumber {
+		return true, task.RetryDelay, ""
+	}
+	return false, 0, ""
+}
+
+// StepAttemptLog 返回步骤最后一次执行的日志。
+// 步骤重试时日志追加写入同一文件，通过上一次执行记录的日志长度截取本次执行的日志
+func StepAttemptLog(sess *db.Session, step *models.TaskStep, stepLog []byte) []byte {
+	if step.CurrentRetryCount == 0 {
+		return stepLog
+	}
+	last := models.TaskStepAttempt{}
+	if err := sess.Model(&last).Where("step_id = ?", step.Id).
+		Order("attempt DESC").First(&last); err != nil {
+		return stepLog
+	}
+	if last.LogSize > 0 && last.LogSize <= len(stepLog) {
+		return stepLog[last.LogSize:]
+	}
+	return stepLog
+}
+
+// RecordTaskStepAttempt 步骤自动重试前记录本次失败的执行，并记录任务事件。记录失败时只打印日志，不影响步骤重试
+func RecordTaskStepAttempt(sess *db.Session, task *models.Task, step *models.TaskStep,
+	pattern string, delay int, logSize int) {
+	attempt := models.TaskStepAttempt{
+		OrgId:     task.OrgId,
+		ProjectId: task.ProjectId,
+		EnvId:     task.EnvId,
+		TaskId:    task.Id,
+		StepId:    step.Id,
+		Step:      step.Index,
+		StepName:  step.Name,
+		Attempt:   step.CurrentRetryCount + 1,
+		Status:    step.Status,
+		ExitCode:  step.ExitCode,
+		Pattern:   pattern,
+		Message:   step.Message,
+		Delay:     delay,
+		LogSize:   logSize,
+		StartAt:   step.StartAt,
+		EndAt:     step.EndAt,
+	}
+	if err := sess.Insert(&attempt); err != nil {
+		logs.Get().WithField("taskId", task.Id).Errorf("record step %d attempt error: %v", step.Index, err)
+	}
+
+	index := step.Index
+	message := fmt.Sprintf("attempt %d %s, retry in %ds", attempt.Attempt, step.Status, delay)
+	if pattern != "" {
+		message = fmt.Sprintf("%s, transient error matched '%s'", message, pattern)
+	}
+	RecordTaskEvent(sess, task, models.TaskEvent{
+		Type:     models.TaskEventStepRetry,
+		Step:     &index,
+		StepType: step.Type,
+		StepName: step.Name,
+		Status:   step.Status,
+		Message:  message,
+	})
+}
+
+// QueryTaskStepAttempts 查询任务各步骤自动重试前的失败执行记录
+func QueryTaskStepAttempts(sess *db.Session, taskId models.Id) *db.Session {
+	return sess.Model(&models.TaskStepAttempt{}).Where("task_id = ?", taskId).Order("step, attempt")
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepRetryDelay(t *testing.T) {
+	p := models.PipelineRetry{Count: 5}
+	assert.Equal(t, []int{10, 20, 40, 80, 160, 300}, []int{
+		StepRetryDelay(p, 1), StepRetryDelay(p, 2), StepRetryDelay(p, 3),
+		StepRetryDelay(p, 4), StepRetryDelay(p, 5), StepRetryDelay(p, 6),
+	})
+
+	p = models.PipelineRetry{Delay: 5, Backoff: 1.5, MaxDelay: 10}
+	assert.Equal(t, 5, StepRetryDelay(p, 1))
+	assert.Equal(t, 7, StepRetryDelay(p, 2))
+	assert.Equal(t, 10, StepRetryDelay(p, 3))
+}
+
+func TestNextStepRetry(t *testing.T) {
+	task := &models.Task{}
+	step := &models.TaskStep{PipelineStep: models.PipelineStep{Retry: &models.PipelineRetry{Count: 2}}}
+
+	throttled := []byte("Error: creating EC2 Instance: RequestLimitExceeded: Request limit exceeded.")
+	retry, delay, pattern := NextStepRetry(task, step, throttled)
+	assert.True(t, retry)
+	assert.Equal(t, 10, delay)
+	assert.NotEmpty(t, pattern)
+
+	// 非临时性错误不重试
+	retry, _, _ = NextStepRetry(task, step, []byte("Error: Unsupported argument"))
+	assert.False(t, retry)
+
+	step.CurrentRetryCount = 2
+	retry, _, _ = NextStepRetry(task, step, throttled)
+	assert.False(t, retry)
+
+	// 自定义规则
+	step.CurrentRetryCount = 0
+	step.Retry.Patterns = []string{`QuotaExceeded`}
+	retry, _, _ = NextStepRetry(task, step, throttled)
+	assert.False(t, retry)
+	retry, _, pattern = NextStepRetry(task, step, []byte("code: QuotaExceeded"))
+	assert.True(t, retry)
+	assert.Equal(t, `QuotaExceeded`, pattern)
+
+	// 未设置重试策略时按环境的重试设置重试所有失败
+	task = &models.Task{RetryAble: true, RetryDelay: 5}
+	step = &models.TaskStep{RetryNumber: 1}
+	retry, delay, pattern = NextStepRetry(task, step, []byte("Error: Unsupported argument"))
+	assert.True(t, retry)
+	assert.Equal(t, 5, delay)
+	assert.Empty(t, pattern)
+}
+
+func TestCheckTaskRetryPolicy(t *testing.T) {
+	flow := models.PipelineTask{
+		Retry: &models.PipelineRetry{Count: 3, Backoff: 2},
+		Steps: []models.PipelineStep{{Name: "init", Retry: &models.PipelineRetry{Count: 1, Patterns: []string{`timeout`}}}},
+	}
+	assert.Nil(t, CheckTaskRetryPolicy(flow))
+
+	flow.Steps[0].Retry.Patterns = []string{`(`}
+	err := CheckTaskRetryPolicy(flow)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, e.TaskRetryPolicyInvalid, err.Code())
+	}
+
+	flow.Steps[0].Retry = nil
+	flow.Retry.Backoff = 0.5
+	assert.NotNil(t, CheckTaskRetryPolicy(flow))
+}
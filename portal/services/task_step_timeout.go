@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+)
+
+// ValidateStepTimeouts 校验按步骤类型设置的超时时间
+func ValidateStepTimeouts(v models.StepTimeouts) e.Error {
+	for key, timeout := range v {
+		if !utils.StrInArray(key, models.StepTimeoutKeys...) {
+			return e.New(e.TaskStepTimeoutsInvalid, fmt.Errorf("unsupported step type '%s'", key))
+		}
+		if timeout <= 0 {
+			return e.New(e.TaskStepTimeoutsInvalid, fmt.Errorf("invalid timeout %d of step type '%s'", timeout, key))
+		}
+	}
+	return nil
+}
+
+// MergeStepTimeouts 合并云模板及环境的步骤超时设置，环境的设置优先
+func MergeStepTimeouts(tpl, env models.StepTimeouts) models.StepTimeouts {
+	if len(tpl) == 0 && len(env) == 0 {
+		return nil
+	}
+	timeouts := make(models.StepTimeouts, len(tpl)+len(env))
+	for k, v := range tpl {
+		timeouts[k] = v
+	}
+	for k, v := range env {
+		timeouts[k] = v
+	}
+	return timeouts
+}
+
+// TaskStepTimeout 返回任务步骤的超时时间，步骤类型未单独设置时使用任务的步骤超时时间
+func TaskStepTimeout(task *models.Task, stepType string) int {
+	if key := models.StepTimeoutKey(stepType); key != "" {
+		if n := task.StepTimeouts[key]; n > 0 {
+			return n
+		}
+	}
+	return task.StepTimeout
+}
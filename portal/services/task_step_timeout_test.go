@@ -0,0 +1,35 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskStepTimeout(t *testing.T) {
+	task := &models.Task{
+		StepTimeouts: MergeStepTimeouts(
+			models.StepTimeouts{models.StepTimeoutApply: 3600, models.StepTimeoutPlan: 900},
+			models.StepTimeouts{models.StepTimeoutApply: 7200},
+		),
+	}
+	task.StepTimeout = 1800
+
+	assert.Equal(t, 7200, TaskStepTimeout(task, models.TaskStepApply))
+	assert.Equal(t, 7200, TaskStepTimeout(task, models.TaskStepDestroy))
+	assert.Equal(t, 900, TaskStepTimeout(task, models.TaskStepPlan))
+	assert.Equal(t, 1800, TaskStepTimeout(task, models.TaskStepInit))
+	assert.Equal(t, 1800, TaskStepTimeout(task, models.TaskStepCommand))
+
+	assert.Nil(t, MergeStepTimeouts(nil, models.StepTimeouts{}))
+}
+
+func TestValidateStepTimeouts(t *testing.T) {
+	assert.Nil(t, ValidateStepTimeouts(nil))
+	assert.Nil(t, ValidateStepTimeouts(models.StepTimeouts{models.StepTimeoutPlay: 600}))
+	assert.NotNil(t, ValidateStepTimeouts(models.StepTimeouts{"destroy": 600}))
+	assert.NotNil(t, ValidateStepTimeouts(models.StepTimeouts{models.StepTimeoutInit: 0}))
+}
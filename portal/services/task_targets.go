@@ -0,0 +1,92 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// terraform -target 参数支持模块地址(module.vpc)、资源地址(aws_instance.web)及资源实例地址(aws_instance.web[0])
+var tfTargetAddrRegex = regexp.MustCompile(
+	`^module\.[A-Za-z_][\w-]*(\[[^\]]+\])?(\.module\.[A-Za-z_][\w-]*(\[[^\]]+\])?)*$`)
+
+// ParseTaskTargets 解析以 , 分隔的 target 参数列表，忽略空值及重复值
+func ParseTaskTargets(s string) []string {
+	targets := make([]string, 0)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" && !utils.StrInArray(t, targets...) {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// checkTargetAddress 检查 target 地址格式
+func checkTargetAddress(addr string) bool {
+	if tfTargetAddrRegex.MatchString(addr) {
+		return true
+	}
+	resAddr := strings.TrimPrefix(tfModuleAddrPrefixRegex.ReplaceAllString(addr, ""), "data.")
+	return tfResourceAddrRegex.MatchString(resAddr) && !strings.HasPrefix(resAddr, "module.")
+}
+
+// targetMatchResource 资源地址是否在 target 的范围内，target 为模块或不带索引的资源地址时匹配其下的所有资源实例
+func targetMatchResource(target string, addr string) bool {
+	if addr == target {
+		return true
+	}
+	return strings.HasPrefix(addr, target+".") || strings.HasPrefix(addr, target+"[")
+}
+
+// CheckTaskTargets 检查部署任务的 target 参数。
+// 所有任务类型都检查地址格式；destroy 任务的 target 必须匹配环境当前的资源，
+// apply 任务可能创建新资源，所以不要求 target 匹配已有资源
+func CheckTaskTargets(tx *db.Session, env *models.Env, taskType string, targets []string) e.Error {
+	for _, t := range targets {
+		if !checkTargetAddress(t) {
+			return e.New(e.TaskTargetInvalid, fmt.Errorf("invalid target address '%s'", t))
+		}
+	}
+	if len(targets) == 0 || taskType != common.TaskJobDestroy {
+		return nil
+	}
+
+	addrs := make([]string, 0)
+	if env.LastResTaskId != "" {
+		if err := tx.Model(&models.Resource{}).Where("task_id = ?", env.LastResTaskId).
+			Pluck("address", &addrs); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	if unmatched := unmatchedTargets(targets, addrs); len(unmatched) > 0 {
+		return e.New(e.TaskTargetNotFound, fmt.Errorf("targets not found in env resources: %s",
+			strings.Join(unmatched, ", ")))
+	}
+	return nil
+}
+
+// unmatchedTargets 返回没有匹配任何资源的 target
+func unmatchedTargets(targets []string, addrs []string) []string {
+	unmatched := make([]string, 0)
+	for _, t := range targets {
+		matched := false
+		for _, addr := range addrs {
+			if targetMatchResource(t, addr) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			unmatched = append(unmatched, t)
+		}
+	}
+	return unmatched
+}
@@ -0,0 +1,32 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTaskTargets(t *testing.T) {
+	assert.Equal(t, []string{}, ParseTaskTargets(" "))
+	assert.Equal(t, []string{"aws_instance.web", "module.vpc"},
+		ParseTaskTargets(" aws_instance.web,,module.vpc , aws_instance.web"))
+}
+
+func TestCheckTargetAddress(t *testing.T) {
+	for _, addr := range []string{"aws_instance.web", `aws_instance.web["a"]`, "module.vpc",
+		"module.vpc[0].aws_subnet.private[1]", "data.aws_ami.ubuntu"} {
+		assert.True(t, checkTargetAddress(addr), addr)
+	}
+	for _, addr := range []string{"aws_instance", "module.", "-target=aws_instance.web", "a.b c"} {
+		assert.False(t, checkTargetAddress(addr), addr)
+	}
+}
+
+func TestUnmatchedTargets(t *testing.T) {
+	addrs := []string{"aws_instance.web[0]", "aws_instance.web[1]", "module.vpc.aws_subnet.private"}
+	assert.Empty(t, unmatchedTargets([]string{"aws_instance.web", "aws_instance.web[1]", "module.vpc"}, addrs))
+	assert.Equal(t, []string{"aws_instance.we", "module.vp"},
+		unmatchedTargets([]string{"aws_instance.we", "module.vp"}, addrs))
+}
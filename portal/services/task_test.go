@@ -4,6 +4,8 @@ package services
 
 import (
 	"cloudiac/policy"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
 	"encoding/json"
 	"testing"
 
@@ -322,3 +324,26 @@ func TestUnmarshalTfResultJson(t *testing.T) {
 		})
 	}
 }
+
+func TestCountPlanChanges(t *testing.T) {
+	rs := []TfPlanResource{
+		{Address: "a.a", Change: TfPlanResourceChange{Actions: []string{"create"}}},
+		{Address: "a.b", Change: TfPlanResourceChange{Actions: []string{"update"}}},
+		{Address: "a.c", Change: TfPlanResourceChange{Actions: []string{"delete", "create"}}},
+		{Address: "a.d", Change: TfPlanResourceChange{Actions: []string{"delete"}}},
+		{Address: "a.e", Change: TfPlanResourceChange{Actions: []string{"no-op"}}},
+	}
+	added, changed, destroyed := CountPlanChanges(rs, logs.Get())
+	assert.Equal(t, 1, added)
+	assert.Equal(t, 2, changed)
+	assert.Equal(t, 1, destroyed)
+}
+
+func TestIsScanStep(t *testing.T) {
+	for _, typ := range []string{models.TaskStepEnvScan, models.TaskStepTplScan, models.TaskStepOpaScan} {
+		assert.True(t, IsScanStep(typ), typ)
+	}
+	for _, typ := range []string{models.TaskStepPlan, models.TaskStepScanInit, models.TaskStepEnvParse} {
+		assert.False(t, IsScanStep(typ), typ)
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+)
+
+const (
+	TaskVarAdded   = "added"
+	TaskVarChanged = "changed"
+	TaskVarRemoved = "removed"
+)
+
+// sensitiveVarDigest 计算敏感变量值的摘要，使用 secretKey 做 hmac 避免通过摘要反推变量值
+func sensitiveVarDigest(secretKey string, value string) string {
+	// 旧版本创建的敏感变量保存时不会添加 secret 前缀，这里强制解密，解密失败时使用保存的值计算
+	encrypted, _ := utils.DecodeSecretVar(value)
+	if plain, err := utils.AesDecryptWithKey(encrypted, secretKey); err == nil {
+		value = plain
+	}
+	mac := hmac.New(sha256.New, []byte(secretKey))
+	mac.Write([]byte(value))
+	return fmt.Sprintf("%x", mac.Sum(nil))[:16]
+}
+
+// NewTaskVarSnapshot 根据任务使用的变量生成变量快照，敏感变量的值使用占位符代替
+func NewTaskVarSnapshot(task *models.Task, secretKey string) *models.TaskVarSnapshot {
+	items := make(models.TaskVarSnapshotItems, 0, len(task.Variables))
+	for _, v := range task.Variables {
+		item := models.TaskVarSnapshotItem{
+			Type:      v.Type,
+			Name:      v.Name,
+			Scope:     v.Scope,
+			Value:     v.Value,
+			Sensitive: v.Sensitive,
+		}
+		if v.Sensitive {
+			item.Value = SensitiveValueMask
+			item.Digest = sensitiveVarDigest(secretKey, v.Value)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Type != items[j].Type {
+			return items[i].Type < items[j].Type
+		}
+		return items[i].Name < items[j].Name
+	})
+
+	return &models.TaskVarSnapshot{
+		OrgId:        task.OrgId,
+		ProjectId:    task.ProjectId,
+		EnvId:        task.EnvId,
+		TaskId:       task.Id,
+		TfVarsFile:   task.TfVarsFile,
+		PlayVarsFile: task.PlayVarsFile,
+		Variables:    items,
+	}
+}
+
+// CreateTaskVarSnapshot 记录任务创建时使用的变量
+func CreateTaskVarSnapshot(tx *db.Session, task *models.Task) e.Error {
+	if err := models.Create(tx, NewTaskVarSnapshot(task, configs.Get().SecretKey)); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// GetTaskVarSnapshot 查询任务的变量快照，没有快照的任务(功能上线前创建的任务)根据任务保存的变量生成
+func GetTaskVarSnapshot(tx *db.Session, task *models.Task) (*models.TaskVarSnapshot, e.Error) {
+	snapshot := models.TaskVarSnapshot{}
+	if err := tx.Where("task_id = ?", task.Id).First(&snapshot); err != nil {
+		if e.IsRecordNotFound(err) {
+			return NewTaskVarSnapshot(task, configs.Get().SecretKey), nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &snapshot, nil
+}
+
+// GetPreviousEnvTask 查询环境中在指定任务之前创建的最近一个任务
+func GetPreviousEnvTask(tx *db.Session, task *models.Task) (*models.Task, e.Error) {
+	prev := models.Task{}
+	if err := tx.Model(&models.Task{}).
+		Where("env_id = ? AND created_at < ?", task.EnvId, task.CreatedAt).
+		Order("created_at DESC").First(&prev); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TaskNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &prev, nil
+}
+
+// TaskVarChange 两个任务之间的变量差异
+type TaskVarChange struct {
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Action    string `json:"action" enums:"added,changed,removed"`
+	OldValue  string `json:"oldValue"`
+	NewValue  string `json:"newValue"`
+	OldScope  string `json:"oldScope"`
+	NewScope  string `json:"newScope"`
+	Sensitive bool   `json:"sensitive"`
+}
+
+// DiffTaskVarSnapshots 比较两个任务的变量，返回按类型、名称排序的差异。
+// 敏感变量通过摘要判断值是否变化，不返回变量值
+func DiffTaskVarSnapshots(base, target *models.TaskVarSnapshot) []*TaskVarChange {
+	key := func(v models.TaskVarSnapshotItem) string { return v.Type + "/" + v.Name }
+	baseVars := make(map[string]models.TaskVarSnapshotItem, len(base.Variables))
+	for _, v := range base.Variables {
+		baseVars[key(v)] = v
+	}
+
+	changes := make([]*TaskVarChange, 0)
+	for _, v := range target.Variables {
+		old, ok := baseVars[key(v)]
+		delete(baseVars, key(v))
+		if !ok {
+			changes = append(changes, &TaskVarChange{Type: v.Type, Name: v.Name, Action: TaskVarAdded,
+				NewValue: v.Value, NewScope: v.Scope, Sensitive: v.Sensitive})
+		} else if old.Value != v.Value || old.Digest != v.Digest || old.Sensitive != v.Sensitive {
+			changes = append(changes, &TaskVarChange{Type: v.Type, Name: v.Name, Action: TaskVarChanged,
+				OldValue: old.Value, NewValue: v.Value, OldScope: old.Scope, NewScope: v.Scope,
+				Sensitive: old.Sensitive || v.Sensitive})
+		}
+	}
+	for _, old := range baseVars {
+		changes = append(changes, &TaskVarChange{Type: old.Type, Name: old.Name, Action: TaskVarRemoved,
+			OldValue: old.Value, OldScope: old.Scope, Sensitive: old.Sensitive})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Type != changes[j].Type {
+			return changes[i].Type < changes[j].Type
+		}
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
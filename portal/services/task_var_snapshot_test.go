@@ -0,0 +1,58 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTaskVarSnapshots(t *testing.T) {
+	key := "0123456789abcdef0123456789abcdef"
+	encrypt := func(v string) string {
+		s, err := utils.AesEncryptWithKey(v, key)
+		assert.NoError(t, err)
+		return utils.EncodeSecretVar(s, true)
+	}
+	newTask := func(vars ...models.VariableBody) *models.Task {
+		return &models.Task{Variables: vars}
+	}
+	tfVar := func(name, value string, sensitive bool) models.VariableBody {
+		return models.VariableBody{Type: consts.VarTypeTerraform, Name: name, Value: value,
+			Sensitive: sensitive, Scope: consts.ScopeEnv}
+	}
+
+	base := NewTaskVarSnapshot(newTask(
+		tfVar("region", "cn-1", false),
+		tfVar("password", encrypt("a"), true),
+		tfVar("token", encrypt("x"), true),
+		tfVar("removed", "1", false),
+	), key)
+	target := NewTaskVarSnapshot(newTask(
+		tfVar("region", "cn-2", false),
+		// 加密结果每次不同，值未变化时摘要相同
+		tfVar("password", encrypt("a"), true),
+		tfVar("token", encrypt("y"), true),
+		tfVar("added", "2", false),
+	), key)
+	assert.Equal(t, SensitiveValueMask, target.Variables[1].Value)
+
+	changes := DiffTaskVarSnapshots(base, target)
+	actions := make(map[string]string)
+	for _, c := range changes {
+		actions[c.Name] = c.Action
+		if c.Sensitive {
+			assert.Equal(t, SensitiveValueMask, c.NewValue)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"region":  TaskVarChanged,
+		"token":   TaskVarChanged,
+		"removed": TaskVarRemoved,
+		"added":   TaskVarAdded,
+	}, actions)
+}
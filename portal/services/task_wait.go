@@ -0,0 +1,58 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+)
+
+// 等待任务结束接口返回的退出码，供 CI 流水线直接作为命令退出码使用
+const (
+	TaskWaitExitSuccess  = 0 // 部署任务执行成功或扫描通过
+	TaskWaitExitFailed   = 1 // 任务失败、被驳回或执行超时
+	TaskWaitExitViolated = 2 // 扫描发现不合规资源
+	TaskWaitExitTimeout  = 3 // 等待超时，任务尚未结束
+)
+
+// TaskWaitResult 等待任务结束的结果
+type TaskWaitResult struct {
+	TaskId       models.Id `json:"taskId"`
+	Type         string    `json:"type"`
+	Status       string    `json:"status"`
+	PolicyStatus string    `json:"policyStatus,omitempty"` // 扫描任务的策略检查结果
+	Message      string    `json:"message"`
+	Exited       bool      `json:"exited"`   // 任务是否已结束
+	TimedOut     bool      `json:"timedOut"` // 是否等待超时
+	ExitCode     int       `json:"exitCode"`
+}
+
+// NewTaskWaitResult 根据任务当前状态生成等待结果，任务未结束时视为等待超时
+func NewTaskWaitResult(tasker models.Tasker) *TaskWaitResult {
+	r := &TaskWaitResult{}
+	switch t := tasker.(type) {
+	case *models.Task:
+		r.TaskId, r.Type, r.Status, r.Message = t.Id, t.Type, t.Status, t.Message
+	case *models.ScanTask:
+		r.TaskId, r.Type, r.Status, r.Message = t.Id, t.Type, t.Status, t.Message
+		r.PolicyStatus = t.PolicyStatus
+	}
+	r.Exited = tasker.Exited()
+	r.ExitCode = taskWaitExitCode(r)
+	r.TimedOut = r.ExitCode == TaskWaitExitTimeout
+	return r
+}
+
+func taskWaitExitCode(r *TaskWaitResult) int {
+	if !r.Exited {
+		return TaskWaitExitTimeout
+	}
+	// 扫描发现违规时任务状态为 failed，需要先判断策略检查结果
+	if r.PolicyStatus == common.PolicyStatusViolated {
+		return TaskWaitExitViolated
+	}
+	if r.Status != common.TaskComplete {
+		return TaskWaitExitFailed
+	}
+	return TaskWaitExitSuccess
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTaskWaitResult(t *testing.T) {
+	task := &models.Task{}
+	task.Status = common.TaskRunning
+	r := NewTaskWaitResult(task)
+	assert.False(t, r.Exited)
+	assert.True(t, r.TimedOut)
+	assert.Equal(t, TaskWaitExitTimeout, r.ExitCode)
+
+	task.Status = common.TaskComplete
+	assert.Equal(t, TaskWaitExitSuccess, NewTaskWaitResult(task).ExitCode)
+	task.Status = common.TaskRejected
+	assert.Equal(t, TaskWaitExitFailed, NewTaskWaitResult(task).ExitCode)
+
+	scan := &models.ScanTask{}
+	scan.Status, scan.PolicyStatus = common.TaskFailed, common.PolicyStatusViolated
+	assert.Equal(t, TaskWaitExitViolated, NewTaskWaitResult(scan).ExitCode)
+	scan.PolicyStatus = common.PolicyStatusFailed
+	assert.Equal(t, TaskWaitExitFailed, NewTaskWaitResult(scan).ExitCode)
+	scan.Status, scan.PolicyStatus = common.TaskComplete, common.PolicyStatusPassed
+	assert.Equal(t, TaskWaitExitSuccess, NewTaskWaitResult(scan).ExitCode)
+}
@@ -8,7 +8,9 @@ import (
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"fmt"
+	"path"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -31,6 +33,24 @@ func CreateTemplate(tx *db.Session, tpl models.Template) (*models.Template, e.Er
 	return &tpl, nil
 }
 
+// CleanTemplateWorkdirs 规范化多工作目录配置，工作目录必须为代码仓库内的相对路径且不能重复
+func CleanTemplateWorkdirs(workdirs []string) ([]string, e.Error) {
+	dirs := make([]string, 0, len(workdirs))
+	seen := make(map[string]bool, len(workdirs))
+	for _, dir := range workdirs {
+		cleaned := path.Clean(strings.TrimSpace(dir))
+		if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.HasPrefix(cleaned, "/") {
+			return nil, e.New(e.TemplateWorkdirError, fmt.Errorf("invalid workdir '%s'", dir))
+		}
+		if seen[cleaned] {
+			return nil, e.New(e.TemplateWorkdirError, fmt.Errorf("duplicate workdir '%s'", dir))
+		}
+		seen[cleaned] = true
+		dirs = append(dirs, cleaned)
+	}
+	return dirs, nil
+}
+
 func UpdateTemplate(tx *db.Session, id models.Id, attrs models.Attrs) (tpl *models.Template, re e.Error) {
 	tpl = &models.Template{}
 	if _, err := models.UpdateAttr(tx.Where("id = ?", id), &models.Template{}, attrs); err != nil {
@@ -52,6 +72,26 @@ func DeleteTemplate(tx *db.Session, id models.Id) e.Error {
 	return nil
 }
 
+// ArchiveTemplate 归档或恢复云模板
+func ArchiveTemplate(tx *db.Session, id models.Id, archived bool) (*models.Template, e.Error) {
+	attrs := models.Attrs{"archived": archived, "archived_at": nil}
+	if archived {
+		attrs["archived_at"] = models.Time(time.Now())
+	}
+	return UpdateTemplate(tx, id, attrs)
+}
+
+// PurgeTemplate 清除云模板及其标签、收藏记录
+func PurgeTemplate(tx *db.Session, id models.Id) e.Error {
+	if _, err := tx.Where("tpl_id = ?", id).Delete(&models.TemplateLabel{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if _, err := tx.Where("tpl_id = ?", id).Delete(&models.UserTemplate{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return DeleteTemplate(tx, id)
+}
+
 func GetTemplateById(tx *db.Session, id models.Id) (*models.Template, e.Error) {
 	tpl := models.Template{}
 	if err := tx.Where("id = ?", id).First(&tpl); err != nil {
@@ -81,7 +121,7 @@ func QueryTemplateByOrgId(tx *db.Session, q string, orgId models.Id, templateIdL
 		qs := "%" + q + "%"
 		query = query.Where("iac_template.name LIKE ? OR iac_template.description LIKE ?", qs, qs)
 	}
-	query = query.Where("iac_template.org_id = ?", orgId).Order("iac_template.created_at DESC")
+	query = query.Where("iac_template.org_id = ?", orgId)
 	if len(templateIdList) != 0 {
 		// 如果传入项目id，需要项目ID 再次筛选
 		query = query.Where("iac_template.id in (?) ", templateIdList)
@@ -119,6 +159,57 @@ func QueryTemplateByVcsIdAndRepoId(tx *db.Session, vcsId, repoId string) ([]mode
 	return tpl, nil
 }
 
+// UpdateTemplateWebhookError 记录云模板注册 webhook 的结果，err 为空表示注册成功
+func UpdateTemplateWebhookError(tx *db.Session, id models.Id, err error) e.Error {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if _, er := tx.Model(&models.Template{}).Where("id = ?", id).
+		UpdateColumn("webhook_error", msg); er != nil {
+		return e.New(e.DBError, er)
+	}
+	return nil
+}
+
+// UpdateTemplateLockCheck 保存云模板 provider 依赖锁文件的检查结果
+func UpdateTemplateLockCheck(tx *db.Session, id models.Id, check *models.TemplateLockCheck) e.Error {
+	if _, err := tx.Model(&models.Template{}).Where("id = ?", id).
+		UpdateColumn("lock_check", check); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// UpdateTemplateVarSchema 保存从代码仓库解析的云模板变量声明
+func UpdateTemplateVarSchema(tx *db.Session, id models.Id, schema *models.TemplateVarSchema) e.Error {
+	if _, err := tx.Model(&models.Template{}).Where("id = ?", id).
+		UpdateColumn("var_schema", schema); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func UpdateTemplateRevisionDiff(tx *db.Session, id models.Id, diff *models.TemplateRevisionDiff) e.Error {
+	if _, err := tx.Model(&models.Template{}).Where("id = ?", id).
+		UpdateColumn("revision_diff", diff); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// UpdateTemplateWebhookDelivered 更新云模板最近一次收到 webhook 推送的时间
+func UpdateTemplateWebhookDelivered(tx *db.Session, ids []models.Id) e.Error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if _, err := tx.Model(&models.Template{}).Where("id IN (?)", ids).
+		UpdateColumn("webhook_delivered_at", models.Time(time.Now())); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
 func QueryTplByVcsId(tx *db.Session, VcsId models.Id) (bool, e.Error) {
 	exists, err := tx.Table(models.Template{}.TableName()).
 		Where("vcs_id = ? and deleted_at_t = 0", VcsId).Exists()
@@ -165,6 +256,25 @@ func GetTplByEnvId(sess *db.Session, envId models.Id) (*models.Template, e.Error
 }
 
 func GetLastScanTaskByScope(sess *db.Session, scope string, id models.Id) (*models.ScanTask, error) {
+	return GetLastScanTaskByContext(sess, scope, id, "")
+}
+
+// lastScanTaskColumn 返回扫描触发方式对应的最后一次扫描任务 id 字段，scanContext 为空时返回所有扫描的最后一次任务
+func lastScanTaskColumn(scanContext string) string {
+	switch scanContext {
+	case models.ScanContextManual:
+		return "last_manual_scan_task_id"
+	case models.ScanContextDeploy:
+		return "last_deploy_scan_task_id"
+	case models.ScanContextScheduled:
+		return "last_scheduled_scan_task_id"
+	default:
+		return "last_scan_task_id"
+	}
+}
+
+// GetLastScanTaskByContext 查询环境或云模板指定触发方式的最后一次扫描任务
+func GetLastScanTaskByContext(sess *db.Session, scope string, id models.Id, scanContext string) (*models.ScanTask, error) {
 	task := models.ScanTask{}
 	switch scope {
 	case consts.ScopeTemplate:
@@ -172,11 +282,27 @@ func GetLastScanTaskByScope(sess *db.Session, scope string, id models.Id) (*mode
 	case consts.ScopeEnv:
 		sess = sess.Model(&models.Env{})
 	}
-	scanTaskIdQuery := sess.Where("id = ?", id).Select("last_scan_task_id")
+	scanTaskIdQuery := sess.Where("id = ?", id).Select(lastScanTaskColumn(scanContext))
 	err := sess.Model(&models.ScanTask{}).Where("id = (?)", scanTaskIdQuery.Expr()).First(&task)
 	return &task, err
 }
 
+// UpdateLastScanTask 更新环境或云模板的最后一次扫描任务，同时记录该触发方式的最后一次扫描任务
+func UpdateLastScanTask(tx *db.Session, scope string, id models.Id, task *models.ScanTask) e.Error {
+	var m interface{} = &models.Template{}
+	if scope == consts.ScopeEnv {
+		m = &models.Env{}
+	}
+	attrs := models.Attrs{"last_scan_task_id": task.Id}
+	if task.ScanContext != "" {
+		attrs[lastScanTaskColumn(task.ScanContext)] = task.Id
+	}
+	if _, err := tx.Model(m).Where("id = ?", id).UpdateAttrs(attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
 // GetAvailableTemplateIdsByUserId 获取用户已授权访问的云模板ID列表
 func GetAvailableTemplateIdsByUserId(sess *db.Session, userId, orgId models.Id) ([]*models.Id, e.Error) {
 	projectIds := UserProjectIds(userId, orgId)
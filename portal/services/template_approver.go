@@ -0,0 +1,67 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+)
+
+// 可以设置为云模板审批人的角色，组织角色和项目角色不重名
+var tplApproverRoles = []string{consts.OrgRoleAdmin, consts.ProjectRoleManager, consts.ProjectRoleApprover}
+
+// ValidateTemplateApprovers 校验云模板指定审批人的定义
+func ValidateTemplateApprovers(approvers *models.TemplateApprovers) e.Error {
+	if approvers == nil {
+		return nil
+	}
+	for _, role := range approvers.Roles {
+		if !utils.StrInArray(role, tplApproverRoles...) {
+			return e.New(e.TplApproversInvalid, fmt.Errorf("invalid approver role '%s'", role))
+		}
+	}
+	for _, uid := range approvers.UserIds {
+		if uid == "" {
+			return e.New(e.TplApproversInvalid, fmt.Errorf("approver user id is required"))
+		}
+	}
+	if approvers.MinApprovals < 0 {
+		return e.New(e.TplApproversInvalid, fmt.Errorf("invalid min approvals %d", approvers.MinApprovals))
+	}
+	// 只指定了审批用户时审批人数不能超过用户数量，否则任务无法通过审批
+	if len(approvers.Roles) == 0 && approvers.MinApprovals > len(approvers.UserIds) {
+		return e.New(e.TplApproversInvalid, fmt.Errorf("min approvals exceeds the number of approvers"))
+	}
+	return nil
+}
+
+// TemplateRequiresApproval 使用云模板部署的任务是否必须由指定审批人审批，
+// 不受项目及环境自动审批设置的影响
+func TemplateRequiresApproval(tpl *models.Template, taskType string) bool {
+	return tpl != nil && !tpl.RequiredApprovers.IsEmpty() && taskType == common.TaskJobApply
+}
+
+// IsTemplateApprover 用户是否为云模板的指定审批人，用户在列表中或拥有列表中的组织/项目角色
+func IsTemplateApprover(approvers *models.TemplateApprovers, userId, orgId, projectId models.Id) bool {
+	if approvers.IsEmpty() {
+		return true
+	}
+	for _, uid := range approvers.UserIds {
+		if uid == userId {
+			return true
+		}
+	}
+	for _, role := range approvers.Roles {
+		if role == consts.OrgRoleAdmin && UserHasOrgRole(userId, orgId, role) {
+			return true
+		}
+		if role != consts.OrgRoleAdmin && UserHasProjectRole(userId, orgId, projectId, role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestValidateTemplateApprovers(t *testing.T) {
+	cases := []struct {
+		approvers *models.TemplateApprovers
+		valid     bool
+	}{
+		{nil, true},
+		{&models.TemplateApprovers{Roles: []string{"admin", "manager", "approver"}}, true},
+		{&models.TemplateApprovers{UserIds: []models.Id{"u-1"}}, true},
+		{&models.TemplateApprovers{Roles: []string{"guest"}}, false},
+		{&models.TemplateApprovers{UserIds: []models.Id{""}}, false},
+		{&models.TemplateApprovers{UserIds: []models.Id{"u-1", "u-2"}, MinApprovals: 2}, true},
+		{&models.TemplateApprovers{UserIds: []models.Id{"u-1"}, MinApprovals: 2}, false},
+		{&models.TemplateApprovers{Roles: []string{"approver"}, MinApprovals: 3}, true},
+		{&models.TemplateApprovers{Roles: []string{"approver"}, MinApprovals: -1}, false},
+	}
+	for _, c := range cases {
+		err := ValidateTemplateApprovers(c.approvers)
+		if (err == nil) != c.valid {
+			t.Errorf("approvers %+v: expect valid=%v, got err=%v", c.approvers, c.valid, err)
+		}
+	}
+}
+
+func TestTemplateRequiresApproval(t *testing.T) {
+	tpl := &models.Template{RequiredApprovers: &models.TemplateApprovers{Roles: []string{"approver"}}}
+	if !TemplateRequiresApproval(tpl, common.TaskJobApply) {
+		t.Errorf("apply task should require approval")
+	}
+	if TemplateRequiresApproval(tpl, common.TaskJobPlan) || TemplateRequiresApproval(tpl, common.TaskJobDestroy) {
+		t.Errorf("only apply task should require approval")
+	}
+	if TemplateRequiresApproval(&models.Template{}, common.TaskJobApply) || TemplateRequiresApproval(nil, common.TaskJobApply) {
+		t.Errorf("template without approvers should not require approval")
+	}
+}
+
+func TestTaskRequiredApprovals(t *testing.T) {
+	tpl := &models.Template{RequiredApprovers: &models.TemplateApprovers{Roles: []string{"approver"}, MinApprovals: 2}}
+	if n := TaskRequiredApprovals(tpl, common.TaskJobApply); n != 2 {
+		t.Errorf("expect 2 approvals, got %d", n)
+	}
+	if n := TaskRequiredApprovals(tpl, common.TaskJobDestroy); n != 1 {
+		t.Errorf("expect 1 approval for destroy task, got %d", n)
+	}
+	if n := TaskRequiredApprovals(nil, common.TaskJobApply); n != 1 {
+		t.Errorf("expect 1 approval without template, got %d", n)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultDependencyTimeout = 5 * time.Second
+
+// ValidateTemplateDependencies 校验云模板外部依赖的定义
+func ValidateTemplateDependencies(deps *models.TemplateDependencies) e.Error {
+	if deps == nil {
+		return nil
+	}
+	for _, ep := range deps.Endpoints {
+		if ep.Address == "" {
+			return e.New(e.TplDependencyInvalid, fmt.Errorf("endpoint '%s' address is required", ep.Name))
+		}
+		if ep.Timeout < 0 {
+			return e.New(e.TplDependencyInvalid, fmt.Errorf("endpoint '%s' timeout must be positive", ep.Name))
+		}
+		switch ep.Type {
+		case models.TplEndpointHttp:
+			u, err := url.Parse(ep.Address)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return e.New(e.TplDependencyInvalid, fmt.Errorf("endpoint '%s' address must be a http(s) url", ep.Name))
+			}
+		case models.TplEndpointTcp:
+			if _, _, err := net.SplitHostPort(ep.Address); err != nil {
+				return e.New(e.TplDependencyInvalid, fmt.Errorf("endpoint '%s' address must be host:port", ep.Name))
+			}
+		case models.TplEndpointConsul:
+		default:
+			return e.New(e.TplDependencyInvalid, fmt.Errorf("endpoint '%s' has invalid type '%s'", ep.Name, ep.Type))
+		}
+	}
+	for _, name := range deps.Secrets {
+		if strings.TrimSpace(name) == "" {
+			return e.New(e.TplDependencyInvalid, fmt.Errorf("secret name is required"))
+		}
+	}
+	for _, rs := range deps.RemoteStates {
+		if rs.EnvId == "" {
+			return e.New(e.TplDependencyInvalid, fmt.Errorf("remote state '%s' envId is required", rs.Name))
+		}
+	}
+	return nil
+}
+
+// CheckTaskDependencies 任务开始执行前检查云模板声明的外部依赖，返回所有不可用依赖组成的错误
+func CheckTaskDependencies(dbSess *db.Session, task *models.Task) error {
+	tpl, err := GetTemplateById(dbSess, task.TplId)
+	if err != nil {
+		return err
+	}
+	if tpl.Dependencies == nil {
+		return nil
+	}
+
+	failures := make([]string, 0)
+	for _, ep := range tpl.Dependencies.Endpoints {
+		if err := checkEndpoint(ep); err != nil {
+			failures = append(failures, fmt.Sprintf("endpoint '%s': %v", ep.Name, err))
+		}
+	}
+	for _, name := range missingSecrets(tpl.Dependencies.Secrets, task.Variables) {
+		failures = append(failures, fmt.Sprintf("secret '%s' is not set", name))
+	}
+	for _, rs := range tpl.Dependencies.RemoteStates {
+		if err := checkRemoteState(dbSess, task.OrgId, rs); err != nil {
+			failures = append(failures, fmt.Sprintf("remote state '%s': %v", rs.Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("dependency check failed: %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func checkEndpoint(ep models.TemplateEndpointDep) error {
+	timeout := defaultDependencyTimeout
+	if ep.Timeout > 0 {
+		timeout = time.Duration(ep.Timeout) * time.Second
+	}
+
+	switch ep.Type {
+	case models.TplEndpointHttp:
+		client := http.Client{Timeout: timeout}
+		resp, err := client.Get(ep.Address)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("unhealthy, status: %s", resp.Status)
+		}
+	case models.TplEndpointTcp:
+		conn, err := net.DialTimeout("tcp", ep.Address, timeout)
+		if err != nil {
+			return err
+		}
+		_ = conn.Close()
+	case models.TplEndpointConsul:
+		value, err := ConsulKVSearch(ep.Address)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			return fmt.Errorf("key '%s' not found", ep.Address)
+		}
+	default:
+		return fmt.Errorf("unknown endpoint type '%s'", ep.Type)
+	}
+	return nil
+}
+
+// missingSecrets 返回未配置或值为空的变量名称
+func missingSecrets(secrets []string, vars models.TaskVariables) []string {
+	values := make(map[string]bool, len(vars))
+	for _, v := range vars {
+		if v.Value != "" {
+			values[v.Name] = true
+		}
+	}
+
+	missing := make([]string, 0)
+	for _, name := range secrets {
+		if !values[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// checkRemoteState 检查引用的环境是否存在且已有 state
+func checkRemoteState(dbSess *db.Session, orgId models.Id, rs models.TemplateRemoteStateDep) error {
+	env, err := GetEnvById(dbSess, rs.EnvId)
+	if err != nil {
+		return err
+	}
+	if env.OrgId != orgId {
+		return fmt.Errorf("environment '%s' not found", rs.EnvId)
+	}
+	if env.StatePath == "" {
+		return fmt.Errorf("environment '%s' has no state", env.Name)
+	}
+	value, err := ConsulKVSearch(env.StatePath)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		return fmt.Errorf("environment '%s' has no state", env.Name)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTemplateDependencies(t *testing.T) {
+	ep := func(typ, addr string) *models.TemplateDependencies {
+		return &models.TemplateDependencies{
+			Endpoints: []models.TemplateEndpointDep{{Name: "svc", Type: typ, Address: addr}},
+		}
+	}
+
+	assert.Nil(t, ValidateTemplateDependencies(nil))
+	assert.Nil(t, ValidateTemplateDependencies(ep(models.TplEndpointHttp, "https://example.com/health")))
+	assert.Nil(t, ValidateTemplateDependencies(ep(models.TplEndpointTcp, "10.0.0.1:5432")))
+	assert.Nil(t, ValidateTemplateDependencies(ep(models.TplEndpointConsul, "config/app")))
+
+	assert.NotNil(t, ValidateTemplateDependencies(ep(models.TplEndpointHttp, "example.com")))
+	assert.NotNil(t, ValidateTemplateDependencies(ep(models.TplEndpointTcp, "10.0.0.1")))
+	assert.NotNil(t, ValidateTemplateDependencies(ep("ftp", "ftp://example.com")))
+	assert.NotNil(t, ValidateTemplateDependencies(ep(models.TplEndpointConsul, "")))
+	assert.NotNil(t, ValidateTemplateDependencies(&models.TemplateDependencies{Secrets: []string{" "}}))
+	assert.NotNil(t, ValidateTemplateDependencies(&models.TemplateDependencies{
+		RemoteStates: []models.TemplateRemoteStateDep{{Name: "network"}},
+	}))
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	assert.NoError(t, checkEndpoint(models.TemplateEndpointDep{Type: models.TplEndpointHttp, Address: healthy.URL}))
+	assert.Error(t, checkEndpoint(models.TemplateEndpointDep{Type: models.TplEndpointHttp, Address: unhealthy.URL}))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	assert.NoError(t, checkEndpoint(models.TemplateEndpointDep{Type: models.TplEndpointTcp, Address: addr, Timeout: 1}))
+	_ = ln.Close()
+	assert.Error(t, checkEndpoint(models.TemplateEndpointDep{Type: models.TplEndpointTcp, Address: addr, Timeout: 1}))
+}
+
+func TestMissingSecrets(t *testing.T) {
+	vars := models.TaskVariables{
+		{Name: "ACCESS_KEY", Value: "xxx", Sensitive: true},
+		{Name: "SECRET_KEY", Value: ""},
+	}
+	assert.Equal(t, []string{"SECRET_KEY", "TOKEN"}, missingSecrets([]string{"ACCESS_KEY", "SECRET_KEY", "TOKEN"}, vars))
+	assert.Empty(t, missingSecrets(nil, vars))
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"time"
+)
+
+// TplMigrationEnv 使用已废弃云模板的环境
+type TplMigrationEnv struct {
+	Id          models.Id `json:"id"`
+	Name        string    `json:"name"`
+	Status      string    `json:"status"`
+	ProjectId   models.Id `json:"projectId"`
+	ProjectName string    `json:"projectName"`
+
+	PreviewTaskId     models.Id    `json:"previewTaskId" gorm:"-"`     // 最近一次迁移预览任务 id
+	PreviewTaskStatus string       `json:"previewTaskStatus" gorm:"-"` // 最近一次迁移预览任务状态
+	PreviewAt         *models.Time `json:"previewAt" gorm:"-"`         // 最近一次迁移预览时间
+}
+
+// CheckTplSuccessor 检查替代云模板，替代云模板不能是当前云模板或已废弃、已归档的云模板
+func CheckTplSuccessor(tpl *models.Template, successor *models.Template) e.Error {
+	if successor.Id == tpl.Id {
+		return e.New(e.TplSuccessorInvalid, fmt.Errorf("successor can not be the template itself"))
+	}
+	if successor.OrgId != tpl.OrgId {
+		return e.New(e.TplSuccessorInvalid, fmt.Errorf("successor %s not in the same org", successor.Id))
+	}
+	if successor.Deprecated {
+		return e.New(e.TplSuccessorInvalid, fmt.Errorf("successor %s is deprecated", successor.Id))
+	}
+	if successor.Archived {
+		return e.New(e.TplSuccessorInvalid, fmt.Errorf("successor %s is archived", successor.Id))
+	}
+	return nil
+}
+
+// DeprecateTemplate 废弃云模板并指定替代云模板
+func DeprecateTemplate(tx *db.Session, id models.Id, successorId models.Id, note string) (*models.Template, e.Error) {
+	return UpdateTemplate(tx, id, models.Attrs{
+		"deprecated":       true,
+		"deprecated_at":    models.Time(time.Now()),
+		"successor_tpl_id": successorId,
+		"deprecation_note": note,
+	})
+}
+
+// UndeprecateTemplate 取消云模板的废弃状态
+func UndeprecateTemplate(tx *db.Session, id models.Id) (*models.Template, e.Error) {
+	return UpdateTemplate(tx, id, models.Attrs{
+		"deprecated":       false,
+		"deprecated_at":    nil,
+		"successor_tpl_id": "",
+		"deprecation_note": "",
+	})
+}
+
+// TplDeprecationWarning 使用已废弃云模板的环境的提示信息，云模板未废弃时返回空字符串
+func TplDeprecationWarning(tpl *models.Template, successor *models.Template) string {
+	if !tpl.Deprecated {
+		return ""
+	}
+	msg := fmt.Sprintf("template '%s' is deprecated", tpl.Name)
+	if successor != nil {
+		msg = fmt.Sprintf("%s, please migrate to '%s'", msg, successor.Name)
+	}
+	if tpl.DeprecationNote != "" {
+		msg = fmt.Sprintf("%s: %s", msg, tpl.DeprecationNote)
+	}
+	return msg
+}
+
+// QueryTplEnvs 查询使用云模板的未归档环境
+func QueryTplEnvs(query *db.Session, tplId models.Id) *db.Session {
+	return query.Model(&models.Env{}).Where("iac_env.tpl_id = ? AND iac_env.archived = ?", tplId, false)
+}
+
+// QueryTplMigrationEnvs 查询使用云模板的未归档环境及所属项目
+func QueryTplMigrationEnvs(query *db.Session, tplId models.Id) *db.Session {
+	return QueryTplEnvs(query, tplId).
+		Joins("LEFT JOIN iac_project ON iac_project.id = iac_env.project_id").
+		LazySelectAppend("iac_env.id", "iac_env.name", "iac_env.status", "iac_env.project_id",
+			"iac_project.name AS project_name")
+}
+
+// FillTplMigrationPreviews 填充各环境最近一次迁移到替代云模板的预览任务
+func FillTplMigrationPreviews(query *db.Session, successorId models.Id, envs []*TplMigrationEnv) e.Error {
+	if len(envs) == 0 {
+		return nil
+	}
+	envIds := make([]models.Id, 0, len(envs))
+	for _, env := range envs {
+		envIds = append(envIds, env.Id)
+	}
+
+	tasks := make([]*models.Task, 0)
+	if err := query.Model(&models.Task{}).
+		Where("env_id IN (?) AND tpl_id = ? AND source = ?", envIds, successorId, consts.TaskSourceTplMigration).
+		Order("created_at").Find(&tasks); err != nil {
+		return e.New(e.DBError, err)
+	}
+
+	lastTasks := make(map[models.Id]*models.Task)
+	for _, task := range tasks {
+		lastTasks[task.EnvId] = task
+	}
+	for _, env := range envs {
+		if task, ok := lastTasks[env.Id]; ok {
+			env.PreviewTaskId = task.Id
+			env.PreviewTaskStatus = task.Status
+			env.PreviewAt = &task.CreatedAt
+		}
+	}
+	return nil
+}
+
+// CreateTplMigrationPlanTask 使用替代云模板的代码及变量对环境创建 plan 任务，预览迁移后环境资源的变更，
+// 环境本身的云模板及配置不变
+func CreateTplMigrationPlanTask(tx *db.Session, env *models.Env, successor *models.Template, creatorId models.Id) (*models.Task, e.Error) {
+	vars, err := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, successor.Id, env.Id)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+
+	migrateEnv := *env
+	migrateEnv.TplId = successor.Id
+	migrateEnv.Revision = ""
+	migrateEnv.Playbook = successor.Playbook
+	migrateEnv.TfVarsFile = successor.TfVarsFile
+	migrateEnv.PlayVarsFile = successor.PlayVarsFile
+
+	pt := models.Task{
+		Name:      fmt.Sprintf("Migrate to %s", successor.Name),
+		CreatorId: creatorId,
+		Variables: vars,
+		BaseTask: models.BaseTask{
+			Type: common.TaskJobPlan,
+		},
+		Source: consts.TaskSourceTplMigration,
+	}
+	return CreateTask(tx, successor, &migrateEnv, pt)
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckTplSuccessor(t *testing.T) {
+	tpl := &models.Template{OrgId: "org-1"}
+	tpl.Id = "tpl-1"
+	successor := &models.Template{OrgId: "org-1", Name: "vpc-v2"}
+	successor.Id = "tpl-2"
+
+	assert.Nil(t, CheckTplSuccessor(tpl, successor))
+
+	cases := []func(s *models.Template){
+		func(s *models.Template) { s.Id = tpl.Id },
+		func(s *models.Template) { s.OrgId = "org-2" },
+		func(s *models.Template) { s.Deprecated = true },
+		func(s *models.Template) { s.Archived = true },
+	}
+	for i, fn := range cases {
+		s := *successor
+		fn(&s)
+		err := CheckTplSuccessor(tpl, &s)
+		if assert.NotNil(t, err, "case %d", i) {
+			assert.Equal(t, e.TplSuccessorInvalid, err.Code())
+		}
+	}
+}
+
+func TestTplDeprecationWarning(t *testing.T) {
+	tpl := &models.Template{Name: "vpc"}
+	successor := &models.Template{Name: "vpc-v2"}
+	assert.Equal(t, "", TplDeprecationWarning(tpl, successor))
+
+	tpl.Deprecated = true
+	assert.Equal(t, "template 'vpc' is deprecated", TplDeprecationWarning(tpl, nil))
+
+	tpl.DeprecationNote = "use the shared network module"
+	assert.Equal(t, "template 'vpc' is deprecated, please migrate to 'vpc-v2': use the shared network module",
+		TplDeprecationWarning(tpl, successor))
+}
@@ -18,6 +18,8 @@ type TplExportedData struct {
 	Templates []exportedTpl      `json:"templates"`
 	Vcs       []exportedVcs      `json:"vcs"`
 	VarGroups []exportedVarGroup `json:"varGroups"`
+
+	Watermark *ReportWatermark `json:"watermark,omitempty"` // 审计员导出时记录导出人
 }
 
 type exportedTpl struct {
@@ -36,6 +38,14 @@ type exportedTpl struct {
 	Playbook     string `json:"playbook"`
 	PlayVarsFile string `json:"playVarsFile"`
 	TfVersion    string `json:"tfVersion"`
+	EngineType   string `json:"engineType"`
+
+	Workdirs []string `json:"workdirs"`
+
+	DefaultCronDriftExpress string `json:"defaultCronDriftExpress"`
+	DefaultAutoRepairDrift  bool   `json:"defaultAutoRepairDrift"`
+	DefaultTTL              string `json:"defaultTTL"`
+	DefaultAutoApproval     bool   `json:"defaultAutoApproval"`
 
 	Variables   []exportedTplVar `json:"variables"`
 	VarGroupIds []models.Id      `json:"varGroupIds"`
@@ -133,11 +143,19 @@ func appendTemplate(tpls []models.Template, vars []models.Variable, dbSess *db.S
 			RepoRevision: t.RepoRevision,
 			Status:       t.Status,
 			Workdir:      t.Workdir,
+			Workdirs:     t.Workdirs,
 			TfVarsFile:   t.TfVarsFile,
 			Playbook:     t.Playbook,
 			PlayVarsFile: t.PlayVarsFile,
 			TfVersion:    t.TfVersion,
-			Variables:    []exportedTplVar{},
+			EngineType:   t.EngineType,
+
+			DefaultCronDriftExpress: t.DefaultCronDriftExpress,
+			DefaultAutoRepairDrift:  t.DefaultAutoRepairDrift,
+			DefaultTTL:              t.DefaultTTL,
+			DefaultAutoApproval:     t.DefaultAutoApproval,
+
+			Variables: []exportedTplVar{},
 		}
 
 		for _, v := range vars {
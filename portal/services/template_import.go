@@ -3,6 +3,7 @@
 package services
 
 import (
+	"cloudiac/common"
 	"cloudiac/portal/consts"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
@@ -411,11 +412,18 @@ func (t *TplImporter) getTplFromExportData(tpl exportedTpl) (*models.Template, e
 		RepoRevision:   tpl.RepoRevision,
 		Status:         tpl.Status,
 		Workdir:        tpl.Workdir,
+		Workdirs:       tpl.Workdirs,
 		TfVarsFile:     tpl.TfVarsFile,
 		Playbook:       tpl.Playbook,
 		PlayVarsFile:   tpl.PlayVarsFile,
 		LastScanTaskId: "",
 		TfVersion:      tpl.TfVersion,
+		EngineType:     utils.FirstValueStr(tpl.EngineType, common.EngineTerraform),
+
+		DefaultCronDriftExpress: tpl.DefaultCronDriftExpress,
+		DefaultAutoRepairDrift:  tpl.DefaultAutoRepairDrift,
+		DefaultTTL:              tpl.DefaultTTL,
+		DefaultAutoApproval:     tpl.DefaultAutoApproval,
 	}
 	newTpl.Id = models.Id(tpl.Id)
 
@@ -0,0 +1,118 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var templateLabelKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.\-/]*[a-zA-Z0-9])?$`)
+
+// LabelSelector 标签选择条件，Value 为空时只要求存在该标签
+type LabelSelector struct {
+	Key   string
+	Value string
+}
+
+// ParseLabelSelector 解析标签选择表达式，格式为 key1=value1,key2=value2，只写 key 表示存在该标签
+func ParseLabelSelector(s string) ([]LabelSelector, error) {
+	selectors := make([]LabelSelector, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		sel := LabelSelector{Key: item}
+		if i := strings.Index(item, "="); i >= 0 {
+			sel.Key, sel.Value = strings.TrimSpace(item[:i]), strings.TrimSpace(item[i+1:])
+			if sel.Value == "" {
+				return nil, fmt.Errorf("invalid label selector '%s'", item)
+			}
+		}
+		if !templateLabelKeyRegex.MatchString(sel.Key) {
+			return nil, fmt.Errorf("invalid label key '%s'", sel.Key)
+		}
+		selectors = append(selectors, sel)
+	}
+	return selectors, nil
+}
+
+// QueryTemplateByLabels 按标签筛选云模板，所有条件都满足的云模板才会返回
+func QueryTemplateByLabels(query *db.Session, selectors []LabelSelector) *db.Session {
+	for _, sel := range selectors {
+		sub := query.New().Model(&models.TemplateLabel{}).Select("tpl_id").Where("label_key = ?", sel.Key)
+		if sel.Value != "" {
+			sub = sub.Where("label_value = ?", sel.Value)
+		}
+		query = query.Where("iac_template.id IN (?)", sub.Expr())
+	}
+	return query
+}
+
+func CheckTemplateLabelKey(key string) e.Error {
+	if !templateLabelKeyRegex.MatchString(key) {
+		return e.New(e.BadParam, fmt.Errorf("invalid label key '%s'", key))
+	}
+	return nil
+}
+
+// SetTemplateLabel 添加云模板标签，标签已存在时更新标签值
+func SetTemplateLabel(tx *db.Session, tpl *models.Template, key, value string) (*models.TemplateLabel, e.Error) {
+	label := models.TemplateLabel{}
+	err := tx.Where("tpl_id = ? AND label_key = ?", tpl.Id, key).First(&label)
+	if err != nil && !e.IsRecordNotFound(err) {
+		return nil, e.New(e.DBError, err)
+	} else if err == nil {
+		if _, err := models.UpdateAttr(tx.Where("id = ?", label.Id), &models.TemplateLabel{},
+			models.Attrs{"label_value": value}); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		label.Value = value
+		return &label, nil
+	}
+
+	label = models.TemplateLabel{OrgId: tpl.OrgId, TplId: tpl.Id, Key: key, Value: value}
+	if err := models.Create(tx, &label); err != nil {
+		return nil, e.AutoNew(err, e.DBError)
+	}
+	return &label, nil
+}
+
+func DeleteTemplateLabel(tx *db.Session, tplId models.Id, key string) e.Error {
+	if _, err := tx.Where("tpl_id = ? AND label_key = ?", tplId, key).Delete(&models.TemplateLabel{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+func GetTemplateLabels(query *db.Session, tplId models.Id) ([]*models.TemplateLabel, e.Error) {
+	labels := make([]*models.TemplateLabel, 0)
+	if err := query.Where("tpl_id = ?", tplId).Order("label_key").Find(&labels); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return labels, nil
+}
+
+// GetTemplateLabelsMap 批量查询云模板标签，返回云模板 id 到标签的映射
+func GetTemplateLabelsMap(query *db.Session, tplIds []models.Id) (map[models.Id]map[string]string, e.Error) {
+	result := make(map[models.Id]map[string]string)
+	if len(tplIds) == 0 {
+		return result, nil
+	}
+	labels := make([]*models.TemplateLabel, 0)
+	if err := query.Where("tpl_id IN (?)", tplIds).Find(&labels); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, l := range labels {
+		if result[l.TplId] == nil {
+			result[l.TplId] = make(map[string]string)
+		}
+		result[l.TplId][l.Key] = l.Value
+	}
+	return result, nil
+}
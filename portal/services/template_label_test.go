@@ -0,0 +1,39 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	cases := []struct {
+		input  string
+		expect []LabelSelector
+		hasErr bool
+	}{
+		{"", []LabelSelector{}, false},
+		{"team=payments", []LabelSelector{{Key: "team", Value: "payments"}}, false},
+		{" team = payments , env=prod,", []LabelSelector{{Key: "team", Value: "payments"}, {Key: "env", Value: "prod"}}, false},
+		{"critical,cost-center=a/b", []LabelSelector{{Key: "critical"}, {Key: "cost-center", Value: "a/b"}}, false},
+		{"team=", nil, true},
+		{"=payments", nil, true},
+		{"bad key=x", nil, true},
+	}
+
+	for _, c := range cases {
+		selectors, err := ParseLabelSelector(c.input)
+		if c.hasErr {
+			if err == nil {
+				t.Errorf("%q: expect error", c.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", c.input, err)
+		} else if !reflect.DeepEqual(selectors, c.expect) {
+			t.Errorf("%q: expect %v, got %v", c.input, c.expect, selectors)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/utils"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TemplateManifest 代码仓库根目录下的云模板清单(.cloudiac.yml)，用于在一个仓库(monorepo)中声明多个云模板
+type TemplateManifest struct {
+	Templates []TemplateManifestItem `yaml:"templates"`
+}
+
+// TemplateManifestItem 清单中声明的云模板，同步时按名称匹配组织中已有的云模板
+type TemplateManifestItem struct {
+	Name            string   `yaml:"name"`
+	Description     string   `yaml:"description"`
+	Revision        string   `yaml:"revision"` // 云模板使用的分支或 tag，为空时使用同步清单的分支
+	Workdir         string   `yaml:"workdir"`
+	TfVarsFile      string   `yaml:"tfVarsFile"`
+	TfVersion       string   `yaml:"tfVersion"`
+	Playbook        string   `yaml:"playbook"`
+	PlayVarsFile    string   `yaml:"playVarsFile"`
+	Triggers        []string `yaml:"triggers"`        // 自动触发合规检测的事件，例如 ["commit"]
+	TriggerBranches []string `yaml:"triggerBranches"` // 触发分支通配符
+	TriggerPaths    []string `yaml:"triggerPaths"`    // 变更文件通配符
+}
+
+// ParseTemplateManifest 解析并检查云模板清单，清单中包含未知字段时报错，避免字段名拼写错误被忽略
+func ParseTemplateManifest(content []byte) (*TemplateManifest, e.Error) {
+	manifest := TemplateManifest{}
+	if err := yaml.UnmarshalStrict(content, &manifest); err != nil {
+		return nil, e.New(e.TplManifestInvalid, err)
+	}
+	if len(manifest.Templates) == 0 {
+		return nil, e.New(e.TplManifestInvalid, fmt.Errorf("no template declared in %s", consts.TemplateManifestFile))
+	}
+
+	names := make(map[string]bool)
+	for i := range manifest.Templates {
+		item := &manifest.Templates[i]
+		item.Name = strings.TrimSpace(item.Name)
+		if n := utf8.RuneCountInString(item.Name); n < 2 || n > 64 {
+			return nil, e.New(e.TplManifestInvalid, fmt.Errorf("templates[%d]: name length must be between 2 and 64", i))
+		}
+		if names[item.Name] {
+			return nil, e.New(e.TplManifestInvalid, fmt.Errorf("templates[%d]: duplicate name '%s'", i, item.Name))
+		}
+		names[item.Name] = true
+
+		if strings.HasPrefix(item.Workdir, "..") || strings.HasPrefix(item.Workdir, "/") {
+			return nil, e.New(e.TplManifestInvalid, fmt.Errorf("%s: invalid workdir '%s'", item.Name, item.Workdir))
+		}
+		for _, t := range item.Triggers {
+			if !utils.StrInArray(t, consts.EnvTriggerCommit, consts.EnvTriggerPRMR) {
+				return nil, e.New(e.TplManifestInvalid, fmt.Errorf("%s: unknown trigger '%s'", item.Name, t))
+			}
+		}
+	}
+	return &manifest, nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplateManifest(t *testing.T) {
+	manifest, err := ParseTemplateManifest([]byte(`
+templates:
+  - name: " network "
+    workdir: network
+    tfVarsFile: network/prod.tfvars
+    triggers: [commit]
+  - name: compute
+    workdir: compute
+    revision: release
+`))
+	assert.Nil(t, err)
+	assert.Len(t, manifest.Templates, 2)
+	assert.Equal(t, "network", manifest.Templates[0].Name)
+	assert.Equal(t, "network/prod.tfvars", manifest.Templates[0].TfVarsFile)
+	assert.Equal(t, "release", manifest.Templates[1].Revision)
+
+	for _, content := range []string{
+		"templates: []",
+		"templates:\n  - name: a",
+		"templates:\n  - name: dup\n  - name: dup",
+		"templates:\n  - name: network\n    workdir: ../network",
+		"templates:\n  - name: network\n    triggers: [push]",
+		"templates:\n  - name: network\n    workDir: network",
+	} {
+		_, err := ParseTemplateManifest([]byte(content))
+		assert.NotNil(t, err, content)
+	}
+}
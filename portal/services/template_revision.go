@@ -0,0 +1,161 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/lib/pq"
+)
+
+// tplRevisionAttrs 修订记录中保存的云模板属性，key 为属性名称(json 字段名)，value 为数据库字段名。
+// 仓库 token 等敏感信息不记录
+var tplRevisionAttrs = []struct {
+	Attr   string
+	Column string
+}{
+	{"name", "name"},
+	{"description", "description"},
+	{"status", "status"},
+	{"vcsId", "vcs_id"},
+	{"repoId", "repo_id"},
+	{"repoFullName", "repo_full_name"},
+	{"repoAddr", "repo_addr"},
+	{"repoRevision", "repo_revision"},
+	{"workdir", "workdir"},
+	{"tfVarsFile", "tf_vars_file"},
+	{"playbook", "playbook"},
+	{"playVarsFile", "play_vars_file"},
+	{"tfVersion", "tf_version"},
+	{"tplTriggers", "triggers"},
+	{"policyEnable", "policy_enable"},
+	{"keyId", "key_id"},
+	{"moduleSource", "module_source"},
+	{"moduleVersion", "module_version"},
+}
+
+// templateSnapshot 生成云模板的属性快照，属性值经过 json 编解码，与从数据库中读取的快照可以直接比较
+func templateSnapshot(tpl *models.Template) models.TemplateSnapshot {
+	bs, _ := json.Marshal(tpl)
+	values := make(map[string]interface{})
+	_ = json.Unmarshal(bs, &values)
+
+	snapshot := make(models.TemplateSnapshot, len(tplRevisionAttrs))
+	for _, a := range tplRevisionAttrs {
+		snapshot[a.Attr] = values[a.Attr]
+	}
+	return snapshot
+}
+
+// DiffTemplateSnapshot 对比两个快照，返回发生变化的属性
+func DiffTemplateSnapshot(from, to models.TemplateSnapshot) models.TemplateAttrChanges {
+	changes := make(models.TemplateAttrChanges, 0)
+	for _, a := range tplRevisionAttrs {
+		if !reflect.DeepEqual(from[a.Attr], to[a.Attr]) {
+			changes = append(changes, models.TemplateAttrChange{Attr: a.Attr, Old: from[a.Attr], New: to[a.Attr]})
+		}
+	}
+	return changes
+}
+
+func getLatestTemplateRevision(query *db.Session, tplId models.Id) (*models.TemplateRevision, e.Error) {
+	rev := models.TemplateRevision{}
+	if err := query.Where("tpl_id = ?", tplId).Order("revision DESC").First(&rev); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, nil
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &rev, nil
+}
+
+// CreateTemplateRevision 记录云模板的一次修改，before 和 after 分别为修改前后的云模板。
+// 云模板没有修订记录时会先以修改前的状态生成初始修订，属性没有变化时不生成修订
+func CreateTemplateRevision(tx *db.Session, before, after *models.Template, userId models.Id,
+	action string, baseRevision int) (*models.TemplateRevision, e.Error) {
+	last, err := getLatestTemplateRevision(tx, after.Id)
+	if err != nil {
+		return nil, err
+	}
+	if last == nil {
+		last = &models.TemplateRevision{
+			OrgId:     before.OrgId,
+			TplId:     before.Id,
+			Revision:  1,
+			Action:    models.TplRevisionInit,
+			CreatorId: before.CreatorId,
+			Changes:   models.TemplateAttrChanges{},
+			Snapshot:  templateSnapshot(before),
+		}
+		if err := models.Create(tx, last); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+	}
+
+	snapshot := templateSnapshot(after)
+	changes := DiffTemplateSnapshot(last.Snapshot, snapshot)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	rev := &models.TemplateRevision{
+		OrgId:        after.OrgId,
+		TplId:        after.Id,
+		Revision:     last.Revision + 1,
+		Action:       action,
+		BaseRevision: baseRevision,
+		CreatorId:    userId,
+		Changes:      changes,
+		Snapshot:     snapshot,
+	}
+	if err := models.Create(tx, rev); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return rev, nil
+}
+
+func SearchTemplateRevisions(query *db.Session, tplId models.Id) *db.Session {
+	return query.Model(&models.TemplateRevision{}).Where("tpl_id = ?", tplId).Order("revision DESC")
+}
+
+func GetTemplateRevision(query *db.Session, tplId models.Id, revision int) (*models.TemplateRevision, e.Error) {
+	rev := models.TemplateRevision{}
+	if err := query.Where("tpl_id = ? AND revision = ?", tplId, revision).First(&rev); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.TplRevisionNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &rev, nil
+}
+
+// TemplateRevisionAttrs 将修订快照转换为更新云模板的字段
+func TemplateRevisionAttrs(rev *models.TemplateRevision) (models.Attrs, error) {
+	attrs := models.Attrs{}
+	for _, a := range tplRevisionAttrs {
+		v, ok := rev.Snapshot[a.Attr]
+		if !ok {
+			continue
+		}
+		if a.Column == "triggers" {
+			var triggers pq.StringArray
+			if list, ok := v.([]interface{}); ok {
+				for _, t := range list {
+					s, ok := t.(string)
+					if !ok {
+						return nil, fmt.Errorf("invalid trigger value: %v", t)
+					}
+					triggers = append(triggers, s)
+				}
+			}
+			v = triggers
+		}
+		attrs[a.Column] = v
+	}
+	return attrs, nil
+}
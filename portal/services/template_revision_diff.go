@@ -0,0 +1,66 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/tfanalysis"
+	"fmt"
+)
+
+// EnvTplChangeProblems 根据云模板的配置变化检查环境的 terraform 变量在新版本中是否仍然有效，
+// 环境使用了 tfvars 文件时无法确定变量是否已赋值，不检查必填变量
+func EnvTplChangeProblems(changes []models.TemplateConfigChange, env *models.Env, vars []models.VariableBody) []string {
+	values := make(map[string]bool)
+	for _, v := range vars {
+		if v.Type == consts.VarTypeTerraform {
+			values[v.Name] = true
+		}
+	}
+
+	problems := make([]string, 0)
+	for _, c := range changes {
+		switch c.Kind {
+		case tfanalysis.ChangeVarAdded, tfanalysis.ChangeVarRequired:
+			if c.Required && !values[c.Name] && env.TfVarsFile == "" {
+				problems = append(problems, fmt.Sprintf("required variable '%s' is not set", c.Name))
+			}
+		case tfanalysis.ChangeVarRemoved:
+			if values[c.Name] {
+				problems = append(problems, fmt.Sprintf("variable '%s' is no longer declared", c.Name))
+			}
+		case tfanalysis.ChangeVarTypeChanged:
+			if values[c.Name] {
+				problems = append(problems, fmt.Sprintf("type of variable '%s' changed from '%s' to '%s'",
+					c.Name, c.Before, c.After))
+			}
+		}
+	}
+	return problems
+}
+
+// GetTemplateEnvImpacts 查询云模板下变量在新版本中无效的环境
+func GetTemplateEnvImpacts(tx *db.Session, tpl *models.Template, changes []models.TemplateConfigChange) ([]models.TemplateEnvImpact, e.Error) {
+	impacts := make([]models.TemplateEnvImpact, 0)
+	envs := make([]*models.Env, 0)
+	if err := tx.Model(&models.Env{}).Where("tpl_id = ? AND archived = ?", tpl.Id, false).Find(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	for _, env := range envs {
+		vars, err := GetValidVarsAndVgVars(tx, env.OrgId, env.ProjectId, env.TplId, env.Id)
+		if err != nil {
+			return nil, e.AutoNew(err, e.DBError)
+		}
+		if problems := EnvTplChangeProblems(changes, env, vars); len(problems) > 0 {
+			impacts = append(impacts, models.TemplateEnvImpact{
+				EnvId:    env.Id,
+				EnvName:  env.Name,
+				Problems: problems,
+			})
+		}
+	}
+	return impacts, nil
+}
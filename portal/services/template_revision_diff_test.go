@@ -0,0 +1,45 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/tfanalysis"
+	"reflect"
+	"testing"
+)
+
+func TestEnvTplChangeProblems(t *testing.T) {
+	changes := []models.TemplateConfigChange{
+		{Kind: tfanalysis.ChangeVarAdded, Name: "vpc_id", Required: true},
+		{Kind: tfanalysis.ChangeVarAdded, Name: "optional"},
+		{Kind: tfanalysis.ChangeVarRequired, Name: "zone", Required: true},
+		{Kind: tfanalysis.ChangeVarRemoved, Name: "legacy"},
+		{Kind: tfanalysis.ChangeVarTypeChanged, Name: "instance_type", Before: "string", After: "list(string)"},
+		{Kind: tfanalysis.ChangeProviderRemoved, Name: "random"},
+	}
+	vars := []models.VariableBody{
+		{Type: consts.VarTypeTerraform, Name: "zone"},
+		{Type: consts.VarTypeTerraform, Name: "legacy"},
+		{Type: consts.VarTypeTerraform, Name: "instance_type"},
+		// 同名的环境变量不是 terraform 变量
+		{Type: consts.VarTypeEnv, Name: "vpc_id"},
+	}
+
+	problems := EnvTplChangeProblems(changes, &models.Env{}, vars)
+	expected := []string{
+		"required variable 'vpc_id' is not set",
+		"variable 'legacy' is no longer declared",
+		"type of variable 'instance_type' changed from 'string' to 'list(string)'",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("got %v, want %v", problems, expected)
+	}
+
+	// 使用 tfvars 文件时不检查必填变量
+	problems = EnvTplChangeProblems(changes, &models.Env{TfVarsFile: "prod.tfvars"}, vars)
+	if len(problems) != 2 {
+		t.Errorf("expected 2 problems, got %v", problems)
+	}
+}
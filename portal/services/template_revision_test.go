@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestTemplateRevisionDiff(t *testing.T) {
+	before := &models.Template{Name: "tpl", Workdir: "aws", Triggers: pq.StringArray{"commit"}}
+	after := &models.Template{Name: "tpl", Workdir: "ali", RepoToken: "secret", PolicyEnable: true}
+
+	// 从数据库读取的快照经过 json 编解码，需要与新生成的快照保持一致
+	from := models.TemplateSnapshot{}
+	bs, _ := json.Marshal(templateSnapshot(before))
+	if err := json.Unmarshal(bs, &from); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := DiffTemplateSnapshot(from, templateSnapshot(after))
+	got := make([]string, 0)
+	for _, c := range changes {
+		got = append(got, c.Attr)
+	}
+	want := []string{"workdir", "tplTriggers", "policyEnable"}
+	if len(got) != len(want) {
+		t.Fatalf("changes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", got, want)
+		}
+	}
+
+	attrs, err := TemplateRevisionAttrs(&models.TemplateRevision{Snapshot: from})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if triggers, ok := attrs["triggers"].(pq.StringArray); !ok || len(triggers) != 1 || triggers[0] != "commit" {
+		t.Errorf("triggers = %#v", attrs["triggers"])
+	}
+	if _, ok := attrs["repo_token"]; ok {
+		t.Errorf("repo token should not be recorded")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// CleanTriggerPatterns 校验并整理云模板触发过滤的分支或路径通配符，去除空白及重复项
+func CleanTriggerPatterns(patterns []string) ([]string, e.Error) {
+	result := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if _, err := utils.GlobMatch(p, ""); err != nil {
+			return nil, e.New(e.TplTriggerFilterInvalid, fmt.Errorf("invalid pattern '%s': %v", p, err))
+		}
+		if !utils.StrInArray(p, result...) {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// TemplateTriggerPaths 返回云模板触发过滤的变更路径，开启 TriggerWorkdirOnly 时包含云模板的工作目录
+func TemplateTriggerPaths(tpl *models.Template) []string {
+	paths := append([]string{}, tpl.TriggerPaths...)
+	if !tpl.TriggerWorkdirOnly {
+		return paths
+	}
+	workdirs := []string(tpl.Workdirs)
+	if len(workdirs) == 0 {
+		workdirs = []string{tpl.Workdir}
+	}
+	for _, dir := range workdirs {
+		dir = path.Clean(strings.TrimSpace(dir))
+		if dir == "." || dir == "/" {
+			// 工作目录为仓库根目录时任何文件变更都需要触发
+			return nil
+		}
+		paths = append(paths, strings.TrimPrefix(dir, "/")+"/")
+	}
+	return paths
+}
+
+// MatchTriggerBranch 判断分支是否匹配任一通配符，未设置通配符时总是匹配
+func MatchTriggerBranch(patterns []string, branch string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if ok, _ := utils.GlobMatch(p, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTriggerPaths 判断变更文件中是否有匹配任一路径的文件，以 / 结尾的路径匹配目录下的所有文件。
+// 未设置路径或变更文件未知(files 为 nil)时总是匹配
+func MatchTriggerPaths(patterns []string, files []string) bool {
+	if len(patterns) == 0 || files == nil {
+		return true
+	}
+	for _, f := range files {
+		for _, p := range patterns {
+			if strings.HasSuffix(p, "/") {
+				if strings.HasPrefix(f, p) {
+					return true
+				}
+			} else if ok, _ := utils.GlobMatch(p, f); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TemplateTriggerMatched 判断 webhook 事件是否满足云模板的触发过滤条件，不满足时返回原因
+func TemplateTriggerMatched(tpl *models.Template, branch string, changedFiles []string) (bool, string) {
+	if !MatchTriggerBranch(tpl.TriggerBranches, branch) {
+		return false, fmt.Sprintf("branch '%s' not match trigger branches", branch)
+	}
+	if !MatchTriggerPaths(TemplateTriggerPaths(tpl), changedFiles) {
+		return false, "no changed file match trigger paths"
+	}
+	return true, ""
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanTriggerPatterns(t *testing.T) {
+	patterns, err := CleanTriggerPatterns([]string{" main ", "", "release/*", "main"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"main", "release/*"}, patterns)
+
+	_, err = CleanTriggerPatterns([]string{"release/["})
+	assert.NotNil(t, err)
+}
+
+func TestTemplateTriggerMatched(t *testing.T) {
+	tpl := &models.Template{
+		TriggerBranches:    []string{"main", "release/*"},
+		TriggerWorkdirOnly: true,
+		Workdir:            "aws/",
+	}
+	cases := []struct {
+		branch string
+		files  []string
+		expect bool
+	}{
+		{"main", []string{"aws/main.tf"}, true},
+		{"release/v1", []string{"README.md", "aws/vars.tf"}, true},
+		{"feature/x", []string{"aws/main.tf"}, false},
+		{"main", []string{"gcp/main.tf"}, false},
+		{"main", []string{}, false},
+		{"main", nil, true},
+	}
+	for _, c := range cases {
+		ok, _ := TemplateTriggerMatched(tpl, c.branch, c.files)
+		assert.Equal(t, c.expect, ok, "%s %v", c.branch, c.files)
+	}
+
+	tpl.TriggerPaths = []string{"*.tf"}
+	ok, _ := TemplateTriggerMatched(tpl, "main", []string{"main.tf"})
+	assert.True(t, ok)
+
+	// 工作目录为仓库根目录时不按路径过滤
+	tpl.Workdir = ""
+	ok, _ = TemplateTriggerMatched(tpl, "main", []string{"gcp/main.tf"})
+	assert.True(t, ok)
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+	"cloudiac/runner"
+	"cloudiac/utils"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RunValidateCheck 在 runner 中单独执行一次 terraform validate 及 fmt 检查，并等待检查结果返回。
+// 检查使用独立的容器，执行结束后容器会被停止
+func RunValidateCheck(req runner.RunTaskReq) (*runner.ValidateResult, error) {
+	logger := logs.Get().WithField("func", "RunValidateCheck").WithField("taskId", req.TaskId)
+
+	runnerAddr, err := GetRunnerAddress(req.RunnerId)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Step = 0
+	req.StepType = common.TaskStepTfValidate
+	if req.Timeout == 0 {
+		req.Timeout = common.DefaultTaskStepTimeout
+	}
+
+	header := &http.Header{}
+	header.Set("Content-Type", "application/json")
+	timeout := int(consts.RunnerConnectTimeout.Seconds())
+	respData, err := utils.HttpService(utils.JoinURL(runnerAddr, consts.RunnerRunTaskStepURL), "POST",
+		header, req, timeout, timeout*10)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := runner.Response{}
+	if err := json.Unmarshal(respData, &resp); err != nil {
+		return nil, fmt.Errorf("unexpected response: %s", respData)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf(resp.Error)
+	}
+	if result, ok := resp.Result.(map[string]interface{}); ok {
+		containerId := fmt.Sprintf("%v", result["containerId"])
+		defer func() {
+			stopReq := runner.TaskStopReq{TaskId: req.TaskId, ContainerIds: []string{containerId}}
+			if _, err := utils.HttpService(utils.JoinURL(runnerAddr, consts.RunnerStopTaskURL), "POST",
+				header, stopReq, timeout, timeout); err != nil {
+				logger.Warnf("stop validate container error: %v", err)
+			}
+		}()
+	}
+
+	params := url.Values{}
+	params.Add("envId", req.Env.Id)
+	params.Add("taskId", req.TaskId)
+	params.Add("step", "0")
+	wsConn, _, err := utils.WebsocketDail(runnerAddr, consts.RunnerTaskStepStatusURL, params)
+	if err != nil {
+		return nil, errors.Wrapf(err, "websocket dail: %s/%s", runnerAddr, consts.RunnerTaskStepStatusURL)
+	}
+	defer utils.WebsocketClose(wsConn)
+
+	// runner 端会处理步骤超时，这里额外保留一倍的时间避免连接一直阻塞
+	_ = wsConn.SetReadDeadline(time.Now().Add(time.Duration(req.Timeout*2) * time.Second))
+
+	message := runner.TaskStatusMessage{}
+	for {
+		if err := wsConn.ReadJSON(&message); err != nil {
+			return nil, newReadMessageErr(err)
+		}
+		if message.Timeout {
+			return nil, fmt.Errorf("validate timeout")
+		}
+		if message.Exited {
+			break
+		}
+	}
+
+	if len(message.TfValidateJson) == 0 {
+		// 未生成检查结果说明 checkout 或 init 失败，直接返回执行日志
+		return nil, fmt.Errorf("validate failed: %s", message.LogContent)
+	}
+	result := runner.ValidateResult{}
+	if err := json.Unmarshal(message.TfValidateJson, &result); err != nil {
+		return nil, errors.Wrap(err, "unmarshal validate result")
+	}
+	return &result, nil
+}
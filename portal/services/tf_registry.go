@@ -0,0 +1,178 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/runner"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTfRegistryHost = "registry.terraform.io"
+
+	// TfModuleAddrPrefix 使用 registry 模块的云模板创建任务时，任务的 repoAddr 记录为该前缀加模块地址，commitId 记录为模块版本
+	TfModuleAddrPrefix = "tfregistry::"
+)
+
+var tfRegistryClient = &http.Client{Timeout: 30 * time.Second}
+
+// TfRegistryModule terraform registry 中模块的版本信息
+type TfRegistryModule struct {
+	Id      string `json:"id"`
+	Source  string `json:"source"`
+	Version string `json:"version"`
+	Root    struct {
+		Inputs []struct {
+			Name     string `json:"name"`
+			Type     string `json:"type"`
+			Default  string `json:"default"` // json 格式的默认值
+			Required bool   `json:"required"`
+		} `json:"inputs"`
+		Outputs []struct {
+			Name string `json:"name"`
+		} `json:"outputs"`
+	} `json:"root"`
+}
+
+// ParseTfModuleSource 解析 registry 模块地址，
+// 格式为 [<HOSTNAME>/]<NAMESPACE>/<NAME>/<PROVIDER>，未指定 hostname 时使用 registry.terraform.io
+func ParseTfModuleSource(source string) (host string, path string, err error) {
+	parts := strings.Split(strings.Trim(source, "/"), "/")
+	switch {
+	case len(parts) == 3:
+		host = DefaultTfRegistryHost
+	case len(parts) == 4 && strings.Contains(parts[0], "."):
+		host, parts = parts[0], parts[1:]
+	default:
+		return "", "", fmt.Errorf("invalid registry module source '%s'", source)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return "", "", fmt.Errorf("invalid registry module source '%s'", source)
+		}
+	}
+	return host, strings.Join(parts, "/"), nil
+}
+
+func tfRegistryGet(url string, result interface{}) error {
+	logs.Get().WithField("func", "tfRegistryGet").Debugf("request %s", url)
+	resp, err := tfRegistryClient.Get(url) //nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("not found")
+	} else if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry response %d: %s", resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, result)
+}
+
+// tfRegistryModulesBase 通过 registry 的服务发现接口获取模块 api 地址，
+// 离线模式下公网 registry 的模块从 registry 镜像获取
+func tfRegistryModulesBase(host string) (string, error) {
+	if configs.Get().Offline.Enabled && runner.IsPublicTfRegistryHost(host) {
+		if base := runner.OfflineRegistryModulesUrl(); base != "" {
+			return base, nil
+		}
+		return "", fmt.Errorf("offline.registry_mirror is required to use module from %s in offline mode", host)
+	}
+
+	discovery := struct {
+		ModulesV1 string `json:"modules.v1"`
+	}{}
+	if err := tfRegistryGet(fmt.Sprintf("https://%s/.well-known/terraform.json", host), &discovery); err != nil ||
+		discovery.ModulesV1 == "" {
+		return fmt.Sprintf("https://%s/v1/modules/", host), nil
+	}
+	if strings.Contains(discovery.ModulesV1, "://") {
+		return strings.TrimRight(discovery.ModulesV1, "/") + "/", nil
+	}
+	return fmt.Sprintf("https://%s/%s/", host, strings.Trim(discovery.ModulesV1, "/")), nil
+}
+
+// GetTfRegistryModule 查询 registry 模块，version 为空时返回最新版本
+func GetTfRegistryModule(source string, version string) (*TfRegistryModule, error) {
+	host, path, err := ParseTfModuleSource(source)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := tfRegistryModulesBase(host)
+	if err != nil {
+		return nil, err
+	}
+	url := base + path
+	if version != "" {
+		url = fmt.Sprintf("%s/%s", url, version)
+	}
+	module := TfRegistryModule{}
+	if err := tfRegistryGet(url, &module); err != nil {
+		if version != "" {
+			return nil, fmt.Errorf("get registry module %s@%s: %v", source, version, err)
+		}
+		return nil, fmt.Errorf("get registry module %s: %v", source, err)
+	}
+	return &module, nil
+}
+
+// IsTfModuleAddr 判断任务的 repoAddr 是否为 registry 模块，是则返回模块地址
+func IsTfModuleAddr(repoAddr string) (string, bool) {
+	if !strings.HasPrefix(repoAddr, TfModuleAddrPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(repoAddr, TfModuleAddrPrefix), true
+}
+
+// GetRunnerTfModule 查询模块的输入及输出，runner 根据这些信息生成引用该模块的根模块
+func GetRunnerTfModule(source string, version string) (*runner.TfModule, error) {
+	module, err := GetTfRegistryModule(source, version)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &runner.TfModule{
+		Source:  source,
+		Version: module.Version,
+		Inputs:  make([]runner.TfModuleInput, 0, len(module.Root.Inputs)),
+		Outputs: make([]string, 0, len(module.Root.Outputs)),
+	}
+	for _, in := range module.Root.Inputs {
+		input := runner.TfModuleInput{Name: in.Name, Type: in.Type, Default: in.Default, Required: in.Required}
+		if !input.Required && input.Default == "" {
+			input.Default = "null"
+		}
+		m.Inputs = append(m.Inputs, input)
+	}
+	for _, out := range module.Root.Outputs {
+		m.Outputs = append(m.Outputs, out.Name)
+	}
+	return m, nil
+}
+
+// SetRunTaskReqModule 任务使用 registry 模块时，为 runner 请求设置模块信息
+func SetRunTaskReqModule(req *runner.RunTaskReq) error {
+	source, ok := IsTfModuleAddr(req.RepoAddress)
+	if !ok {
+		return nil
+	}
+	module, err := GetRunnerTfModule(source, req.RepoCommitId)
+	if err != nil {
+		return err
+	}
+	req.Module = module
+	return nil
+}
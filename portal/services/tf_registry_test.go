@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import "testing"
+
+func TestParseTfModuleSource(t *testing.T) {
+	cases := []struct {
+		source string
+		host   string
+		path   string
+		valid  bool
+	}{
+		{"terraform-aws-modules/vpc/aws", DefaultTfRegistryHost, "terraform-aws-modules/vpc/aws", true},
+		{"app.terraform.io/example/vpc/aws", "app.terraform.io", "example/vpc/aws", true},
+		{"example/vpc", "", "", false},
+		{"example/vpc/aws/extra", "", "", false},
+		{"example//aws", "", "", false},
+	}
+	for _, c := range cases {
+		host, path, err := ParseTfModuleSource(c.source)
+		if (err == nil) != c.valid || host != c.host || path != c.path {
+			t.Errorf("ParseTfModuleSource(%s) = %s, %s, %v", c.source, host, path, err)
+		}
+	}
+}
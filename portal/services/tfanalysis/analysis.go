@@ -0,0 +1,306 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+// Package tfanalysis 对云模板的 terraform 源码进行静态分析，检测未使用的变量、未声明的变量引用以及未使用的输出
+package tfanalysis
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const (
+	IssueUnusedVariable     = "unused_variable"
+	IssueUndeclaredVariable = "undeclared_variable"
+	IssueUnusedOutput       = "unused_output"
+)
+
+// Issue 单条分析结果
+type Issue struct {
+	Type   string `json:"type" enums:"unused_variable,undeclared_variable,unused_output"`
+	Name   string `json:"name" example:"instance_type"` // 变量或输出名称
+	Module string `json:"module" example:"."`           // 所在模块目录，相对于工作目录
+	File   string `json:"file" example:"variables.tf"`  // 所在文件(未声明的变量为首次引用所在文件)
+	Line   int    `json:"line" example:"12"`
+}
+
+type Report struct {
+	UnusedVariables     []Issue  `json:"unusedVariables"`
+	UndeclaredVariables []Issue  `json:"undeclaredVariables"`
+	UnusedOutputs       []Issue  `json:"unusedOutputs"`
+	ParseErrors         []string `json:"parseErrors"` // 解析失败的文件
+}
+
+// Healthy 模板中不存在任何问题
+func (r *Report) Healthy() bool {
+	return len(r.UnusedVariables) == 0 && len(r.UndeclaredVariables) == 0 && len(r.UnusedOutputs) == 0
+}
+
+func (r *Report) Issues() []Issue {
+	issues := make([]Issue, 0, len(r.UnusedVariables)+len(r.UndeclaredVariables)+len(r.UnusedOutputs))
+	issues = append(issues, r.UnusedVariables...)
+	issues = append(issues, r.UndeclaredVariables...)
+	return append(issues, r.UnusedOutputs...)
+}
+
+// Resource 模板解析(tfparse)结果中的资源
+type Resource struct {
+	ModuleName string
+	Config     map[string]interface{}
+}
+
+type location struct {
+	file string
+	line int
+}
+
+type module struct {
+	dir       string
+	variables map[string]location
+	outputs   map[string]location
+	varRefs   map[string]location
+	// 模块调用名称 => 被引用的输出名称，"*" 表示整个模块被引用
+	moduleRefs map[string]map[string]bool
+	// 模块调用名称 => 本地模块目录
+	calls map[string]string
+}
+
+func newModule(dir string) *module {
+	return &module{
+		dir:        dir,
+		variables:  make(map[string]location),
+		outputs:    make(map[string]location),
+		varRefs:    make(map[string]location),
+		moduleRefs: make(map[string]map[string]bool),
+		calls:      make(map[string]string),
+	}
+}
+
+// Analyze 分析工作目录下的 terraform 源码，files 的 key 为相对于工作目录的文件路径。
+// resources 为模板解析结果中的资源，其配置中未能解析的变量引用同样会被视为引用。
+// 根模块的输出由环境使用，只检查被本地模块调用的子模块的输出是否被引用。
+func Analyze(files map[string][]byte, resources []Resource) *Report {
+	report := &Report{
+		UnusedVariables:     make([]Issue, 0),
+		UndeclaredVariables: make([]Issue, 0),
+		UnusedOutputs:       make([]Issue, 0),
+		ParseErrors:         make([]string, 0),
+	}
+
+	modules := make(map[string]*module)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".tf") {
+			continue
+		}
+		dir := path.Dir(path.Clean(name))
+		m, ok := modules[dir]
+		if !ok {
+			m = newModule(dir)
+			modules[dir] = m
+		}
+		if err := m.parseFile(name, files[name]); err != nil {
+			report.ParseErrors = append(report.ParseErrors, err.Error())
+		}
+	}
+
+	if root, ok := modules["."]; ok {
+		for _, r := range resources {
+			if r.ModuleName != "" && r.ModuleName != "root" {
+				continue
+			}
+			collectConfigVarRefs(r.Config, root.varRefs)
+		}
+	}
+
+	// 汇总每个本地子模块被引用的输出
+	usedOutputs := make(map[string]map[string]bool)
+	calledDirs := make(map[string]bool)
+	for _, m := range modules {
+		for call, dir := range m.calls {
+			calledDirs[dir] = true
+			if usedOutputs[dir] == nil {
+				usedOutputs[dir] = make(map[string]bool)
+			}
+			for output := range m.moduleRefs[call] {
+				usedOutputs[dir][output] = true
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(modules))
+	for dir := range modules {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		m := modules[dir]
+		for _, name := range sortedKeys(m.variables) {
+			if _, ok := m.varRefs[name]; !ok {
+				loc := m.variables[name]
+				report.UnusedVariables = append(report.UnusedVariables, Issue{
+					Type: IssueUnusedVariable, Name: name, Module: dir, File: loc.file, Line: loc.line,
+				})
+			}
+		}
+		for _, name := range sortedKeys(m.varRefs) {
+			if _, ok := m.variables[name]; !ok {
+				loc := m.varRefs[name]
+				report.UndeclaredVariables = append(report.UndeclaredVariables, Issue{
+					Type: IssueUndeclaredVariable, Name: name, Module: dir, File: loc.file, Line: loc.line,
+				})
+			}
+		}
+
+		if dir == "." || !calledDirs[dir] || usedOutputs[dir]["*"] {
+			continue
+		}
+		for _, name := range sortedKeys(m.outputs) {
+			if !usedOutputs[dir][name] {
+				loc := m.outputs[name]
+				report.UnusedOutputs = append(report.UnusedOutputs, Issue{
+					Type: IssueUnusedOutput, Name: name, Module: dir, File: loc.file, Line: loc.line,
+				})
+			}
+		}
+	}
+	return report
+}
+
+func (m *module) parseFile(name string, content []byte) error {
+	file, diags := hclsyntax.ParseConfig(content, name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return fmt.Errorf("%s: %v", name, diags)
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil
+	}
+
+	for _, block := range body.Blocks {
+		loc := location{file: name, line: block.DefRange().Start.Line}
+		switch block.Type {
+		case "variable":
+			if len(block.Labels) > 0 {
+				m.variables[block.Labels[0]] = loc
+			}
+			// variable 块中只允许在 validation 中引用自身，不计入引用
+			continue
+		case "output":
+			if len(block.Labels) > 0 {
+				m.outputs[block.Labels[0]] = loc
+			}
+		case "module":
+			if len(block.Labels) > 0 {
+				if src, ok := block.Body.Attributes["source"]; ok {
+					if v, diags := src.Expr.Value(nil); !diags.HasErrors() && v.Type() == cty.String && v.IsKnown() && !v.IsNull() {
+						if dir, ok := localModuleDir(m.dir, v.AsString()); ok {
+							m.calls[block.Labels[0]] = dir
+						}
+					}
+				}
+			}
+		}
+		m.collectBodyRefs(block.Body)
+	}
+	m.collectAttrRefs(body.Attributes)
+	return nil
+}
+
+func (m *module) collectBodyRefs(body *hclsyntax.Body) {
+	m.collectAttrRefs(body.Attributes)
+	for _, b := range body.Blocks {
+		m.collectBodyRefs(b.Body)
+	}
+}
+
+func (m *module) collectAttrRefs(attrs hclsyntax.Attributes) {
+	for _, attr := range attrs {
+		for _, traversal := range attr.Expr.Variables() {
+			m.addTraversal(traversal)
+		}
+	}
+}
+
+func (m *module) addTraversal(traversal hcl.Traversal) {
+	if len(traversal) < 2 {
+		return
+	}
+	attr, ok := traversal[1].(hcl.TraverseAttr)
+	if !ok {
+		return
+	}
+	loc := location{file: traversal.SourceRange().Filename, line: traversal.SourceRange().Start.Line}
+
+	switch traversal.RootName() {
+	case "var":
+		if _, ok := m.varRefs[attr.Name]; !ok {
+			m.varRefs[attr.Name] = loc
+		}
+	case "module":
+		refs := m.moduleRefs[attr.Name]
+		if refs == nil {
+			refs = make(map[string]bool)
+			m.moduleRefs[attr.Name] = refs
+		}
+		if len(traversal) > 2 {
+			if output, ok := traversal[2].(hcl.TraverseAttr); ok {
+				refs[output.Name] = true
+				return
+			}
+		}
+		// 引用了整个模块(如 module.x 或 module.x[0])，无法确定使用了哪些输出
+		refs["*"] = true
+	}
+}
+
+// localModuleDir 解析本地模块的目录，非本地模块返回 false
+func localModuleDir(dir string, source string) (string, bool) {
+	if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+		return "", false
+	}
+	return path.Clean(path.Join(dir, source)), true
+}
+
+var varRefRegex = regexp.MustCompile(`\bvar\.([A-Za-z_][A-Za-z0-9_-]*)`)
+
+// collectConfigVarRefs 收集资源配置中未被解析的变量引用(如 "${var.name}")
+func collectConfigVarRefs(v interface{}, refs map[string]location) {
+	switch val := v.(type) {
+	case string:
+		for _, match := range varRefRegex.FindAllStringSubmatch(val, -1) {
+			if _, ok := refs[match[1]]; !ok {
+				refs[match[1]] = location{}
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range val {
+			collectConfigVarRefs(item, refs)
+		}
+	case []interface{}:
+		for _, item := range val {
+			collectConfigVarRefs(item, refs)
+		}
+	}
+}
+
+func sortedKeys(m map[string]location) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tfanalysis
+
+import (
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	files := map[string][]byte{
+		"main.tf": []byte(`
+module "vpc" {
+  source = "./modules/vpc"
+  cidr   = var.cidr
+}
+
+resource "alicloud_instance" "web" {
+  vswitch_id    = module.vpc.vswitch_id
+  instance_type = var.instance_type
+  image_id      = var.image_id
+}
+`),
+		"variables.tf": []byte(`
+variable "cidr" {}
+variable "instance_type" {}
+variable "unused" {
+  validation {
+    condition     = length(var.unused) > 0
+    error_message = "required"
+  }
+}
+`),
+		"modules/vpc/main.tf": []byte(`
+variable "cidr" {}
+variable "zone" {}
+
+output "vswitch_id" {
+  value = "vsw"
+}
+
+output "vpc_id" {
+  value = var.cidr
+}
+`),
+		"README.md": []byte("# readme"),
+	}
+
+	r := Analyze(files, []Resource{{
+		ModuleName: "root",
+		Config:     map[string]interface{}{"tags": map[string]interface{}{"name": "${var.instance_type}"}},
+	}})
+
+	assertIssues(t, "unused variables", r.UnusedVariables, []Issue{
+		{Type: IssueUnusedVariable, Name: "unused", Module: ".", File: "variables.tf", Line: 4},
+		{Type: IssueUnusedVariable, Name: "zone", Module: "modules/vpc", File: "modules/vpc/main.tf", Line: 3},
+	})
+	assertIssues(t, "undeclared variables", r.UndeclaredVariables, []Issue{
+		{Type: IssueUndeclaredVariable, Name: "image_id", Module: ".", File: "main.tf", Line: 10},
+	})
+	assertIssues(t, "unused outputs", r.UnusedOutputs, []Issue{
+		{Type: IssueUnusedOutput, Name: "vpc_id", Module: "modules/vpc", File: "modules/vpc/main.tf", Line: 9},
+	})
+	if r.Healthy() {
+		t.Errorf("expect unhealthy report")
+	}
+}
+
+func TestAnalyzeParseError(t *testing.T) {
+	r := Analyze(map[string][]byte{"main.tf": []byte(`resource "a" {`)}, nil)
+	if len(r.ParseErrors) != 1 {
+		t.Fatalf("expect 1 parse error, got %v", r.ParseErrors)
+	}
+	if !r.Healthy() {
+		t.Errorf("expect healthy report")
+	}
+}
+
+func assertIssues(t *testing.T, name string, got, expect []Issue) {
+	t.Helper()
+	if len(got) != len(expect) {
+		t.Fatalf("%s: expect %v, got %v", name, expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("%s[%d]: expect %+v, got %+v", name, i, expect[i], got[i])
+		}
+	}
+}
+
+func TestParseLockFile(t *testing.T) {
+	content := []byte(`
+provider "registry.terraform.io/hashicorp/aws" {
+  version     = "3.63.0"
+  constraints = "~> 3.0"
+  hashes = [
+    "h1:abc",
+  ]
+}
+
+provider "registry.terraform.io/aliyun/alicloud" {
+  version     = "1.140.0"
+  constraints = "1.140.0"
+}
+
+provider "registry.terraform.io/hashicorp/random" {
+  version = "3.1.0"
+}
+`)
+	locks, err := ParseLockFile(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 3 {
+		t.Fatalf("locks = %v", locks)
+	}
+	pinned := map[string]bool{
+		"registry.terraform.io/hashicorp/aws":    false,
+		"registry.terraform.io/aliyun/alicloud":  true,
+		"registry.terraform.io/hashicorp/random": false,
+	}
+	for _, l := range locks {
+		if l.Pinned != pinned[l.Source] {
+			t.Errorf("%s pinned = %v", l.Source, l.Pinned)
+		}
+	}
+	if locks[0].Version != "3.63.0" || locks[0].Constraints != "~> 3.0" {
+		t.Errorf("unexpected lock: %+v", locks[0])
+	}
+}
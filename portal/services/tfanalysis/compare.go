@@ -0,0 +1,259 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tfanalysis
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ProviderRequirement 根模块依赖的 provider
+type ProviderRequirement struct {
+	Name    string `json:"name" example:"aws"`
+	Source  string `json:"source" example:"hashicorp/aws"` // 未在 required_providers 中声明时为空
+	Version string `json:"version" example:"~> 3.0"`       // 版本约束
+}
+
+// ModuleConfig 根模块中与环境部署兼容性相关的配置
+type ModuleConfig struct {
+	Variables     []VariableDecl         `json:"variables"`
+	Providers     []ProviderRequirement  `json:"providers"`
+	Backend       string                 `json:"backend"`       // backend 类型，未声明时为空
+	BackendConfig map[string]interface{} `json:"backendConfig"` // backend 配置中的字面量属性
+}
+
+// ParseModuleConfig 解析根模块 .tf 文件中的变量、provider 及 backend 配置，
+// 返回的第二个值为解析失败的文件信息
+func ParseModuleConfig(files map[string][]byte) (*ModuleConfig, []string) {
+	vars, parseErrors := ParseVariables(files)
+	cfg := &ModuleConfig{
+		Variables:     vars,
+		Providers:     make([]ProviderRequirement, 0),
+		BackendConfig: make(map[string]interface{}),
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasSuffix(name, ".tf") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	providers := make(map[string]*ProviderRequirement)
+	for _, name := range names {
+		file, diags := hclsyntax.ParseConfig(files[name], name, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			// 解析错误已在 ParseVariables 中记录
+			continue
+		}
+		body, ok := file.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "provider":
+				if len(block.Labels) > 0 && providers[block.Labels[0]] == nil {
+					providers[block.Labels[0]] = &ProviderRequirement{Name: block.Labels[0]}
+				}
+			case "terraform":
+				cfg.parseTerraformBlock(block, providers)
+			}
+		}
+	}
+
+	for _, p := range providers {
+		cfg.Providers = append(cfg.Providers, *p)
+	}
+	sort.Slice(cfg.Providers, func(i, j int) bool {
+		return cfg.Providers[i].Name < cfg.Providers[j].Name
+	})
+	return cfg, parseErrors
+}
+
+func (cfg *ModuleConfig) parseTerraformBlock(block *hclsyntax.Block, providers map[string]*ProviderRequirement) {
+	for _, b := range block.Body.Blocks {
+		switch b.Type {
+		case "backend":
+			if len(b.Labels) == 0 {
+				continue
+			}
+			cfg.Backend = b.Labels[0]
+			for name, attr := range b.Body.Attributes {
+				cfg.BackendConfig[name] = exprJSONValue(attr.Expr)
+			}
+		case "required_providers":
+			for name, attr := range b.Body.Attributes {
+				p := &ProviderRequirement{Name: name}
+				v, diags := attr.Expr.Value(nil)
+				if diags.HasErrors() || !v.IsKnown() || v.IsNull() {
+					providers[name] = p
+					continue
+				}
+				if v.Type() == cty.String {
+					// 旧版本语法: aws = "~> 3.0"
+					p.Version = v.AsString()
+				} else if v.Type().IsObjectType() {
+					p.Source = ctyObjectString(v, "source")
+					p.Version = ctyObjectString(v, "version")
+				}
+				providers[name] = p
+			}
+		}
+	}
+}
+
+func ctyObjectString(v cty.Value, key string) string {
+	if !v.Type().HasAttribute(key) {
+		return ""
+	}
+	attr := v.GetAttr(key)
+	if !attr.IsKnown() || attr.IsNull() || attr.Type() != cty.String {
+		return ""
+	}
+	return attr.AsString()
+}
+
+const (
+	ChangeVarAdded          = "variable_added"           // 新增变量
+	ChangeVarRemoved        = "variable_removed"         // 删除变量
+	ChangeVarTypeChanged    = "variable_type_changed"    // 变量类型约束变化
+	ChangeVarRequired       = "variable_required"        // 变量的默认值被删除
+	ChangeVarDefaultChanged = "variable_default_changed" // 变量的默认值变化
+	ChangeProviderAdded     = "provider_added"           // 新增 provider
+	ChangeProviderRemoved   = "provider_removed"         // 删除 provider
+	ChangeProviderSource    = "provider_source_changed"  // provider 来源变化
+	ChangeProviderVersion   = "provider_version_changed" // provider 版本约束变化
+	ChangeBackendChanged    = "backend_changed"          // backend 类型或配置变化
+)
+
+// ConfigChange 两个版本根模块配置的差异
+type ConfigChange struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`     // 变量名或 provider 名称，backend 变化时为 backend 类型
+	Before   string `json:"before"`   // 变化前的值(类型约束、版本约束等)
+	After    string `json:"after"`    // 变化后的值
+	Required bool   `json:"required"` // 变量变化后是否必须传入
+	Breaking bool   `json:"breaking"` // 是否可能导致已有环境部署失败或资源重建
+	Message  string `json:"message"`
+}
+
+// CompareModuleConfig 比较两个版本的根模块配置，结果按变量、provider、backend 的顺序排列
+func CompareModuleConfig(before, after *ModuleConfig) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+	changes = append(changes, compareVariables(before.Variables, after.Variables)...)
+	changes = append(changes, compareProviders(before.Providers, after.Providers)...)
+
+	if before.Backend != after.Backend || !reflect.DeepEqual(before.BackendConfig, after.BackendConfig) {
+		changes = append(changes, ConfigChange{
+			Kind:     ChangeBackendChanged,
+			Name:     after.Backend,
+			Before:   before.Backend,
+			After:    after.Backend,
+			Breaking: true,
+			Message: fmt.Sprintf("backend changed from '%s' to '%s', state may need to be migrated",
+				before.Backend, after.Backend),
+		})
+	}
+	return changes
+}
+
+func compareVariables(before, after []VariableDecl) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+	old := make(map[string]VariableDecl, len(before))
+	for _, v := range before {
+		old[v.Name] = v
+	}
+	declared := make(map[string]bool, len(after))
+	for _, v := range after {
+		declared[v.Name] = true
+		o, ok := old[v.Name]
+		if !ok {
+			c := ConfigChange{Kind: ChangeVarAdded, Name: v.Name, After: v.Type, Required: v.Required}
+			if v.Required {
+				c.Breaking = true
+				c.Message = fmt.Sprintf("required variable '%s' added", v.Name)
+			} else {
+				c.Message = fmt.Sprintf("optional variable '%s' added", v.Name)
+			}
+			changes = append(changes, c)
+			continue
+		}
+		if o.Type != v.Type {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeVarTypeChanged, Name: v.Name, Before: o.Type, After: v.Type,
+				Required: v.Required, Breaking: true,
+				Message: fmt.Sprintf("type of variable '%s' changed from '%s' to '%s'", v.Name, o.Type, v.Type),
+			})
+		}
+		if !o.Required && v.Required {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeVarRequired, Name: v.Name, Required: true, Breaking: true,
+				Message: fmt.Sprintf("default value of variable '%s' removed", v.Name),
+			})
+		} else if !v.Required && !reflect.DeepEqual(o.Default, v.Default) {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeVarDefaultChanged, Name: v.Name,
+				Message: fmt.Sprintf("default value of variable '%s' changed", v.Name),
+			})
+		}
+	}
+	for _, v := range before {
+		if !declared[v.Name] {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeVarRemoved, Name: v.Name, Before: v.Type, Breaking: true,
+				Message: fmt.Sprintf("variable '%s' removed", v.Name),
+			})
+		}
+	}
+	return changes
+}
+
+func compareProviders(before, after []ProviderRequirement) []ConfigChange {
+	changes := make([]ConfigChange, 0)
+	old := make(map[string]ProviderRequirement, len(before))
+	for _, p := range before {
+		old[p.Name] = p
+	}
+	declared := make(map[string]bool, len(after))
+	for _, p := range after {
+		declared[p.Name] = true
+		o, ok := old[p.Name]
+		if !ok {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeProviderAdded, Name: p.Name, After: p.Version,
+				Message: fmt.Sprintf("provider '%s' added", p.Name),
+			})
+			continue
+		}
+		if o.Source != p.Source {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeProviderSource, Name: p.Name, Before: o.Source, After: p.Source, Breaking: true,
+				Message: fmt.Sprintf("source of provider '%s' changed from '%s' to '%s'", p.Name, o.Source, p.Source),
+			})
+		}
+		if o.Version != p.Version {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeProviderVersion, Name: p.Name, Before: o.Version, After: p.Version,
+				Message: fmt.Sprintf("version constraint of provider '%s' changed from '%s' to '%s'",
+					p.Name, o.Version, p.Version),
+			})
+		}
+	}
+	for _, p := range before {
+		if !declared[p.Name] {
+			changes = append(changes, ConfigChange{
+				Kind: ChangeProviderRemoved, Name: p.Name, Before: p.Version, Breaking: true,
+				Message: fmt.Sprintf("provider '%s' removed, resources managed by it will be orphaned", p.Name),
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tfanalysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareModuleConfig(t *testing.T) {
+	before, errs := ParseModuleConfig(map[string][]byte{
+		"main.tf": []byte(`
+terraform {
+  required_providers {
+    alicloud = {
+      source  = "aliyun/alicloud"
+      version = "~> 1.100"
+    }
+    random = "~> 3.0"
+  }
+  backend "consul" {
+    path = "old"
+  }
+}
+
+variable "instance_type" {
+  type    = string
+  default = "ecs.t5-lc1m1.small"
+}
+
+variable "zone" {
+  type    = string
+  default = "cn-beijing-a"
+}
+
+variable "legacy" {}
+`),
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+	if len(before.Providers) != 2 || before.Providers[0].Source != "aliyun/alicloud" || before.Providers[1].Version != "~> 3.0" {
+		t.Fatalf("unexpected providers: %+v", before.Providers)
+	}
+
+	after, errs := ParseModuleConfig(map[string][]byte{
+		"main.tf": []byte(`
+terraform {
+  required_providers {
+    alicloud = {
+      source  = "aliyun/alicloud"
+      version = "~> 1.150"
+    }
+  }
+  backend "consul" {
+    path = "new"
+  }
+}
+
+provider "tls" {}
+
+variable "instance_type" {
+  type    = list(string)
+  default = ["ecs.t5-lc1m1.small"]
+}
+
+variable "zone" {
+  type = string
+}
+
+variable "vpc_id" {
+  type = string
+}
+`),
+	})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected parse errors: %v", errs)
+	}
+
+	kinds := make(map[string][]string)
+	for _, c := range CompareModuleConfig(before, after) {
+		kinds[c.Kind] = append(kinds[c.Kind], c.Name)
+	}
+	expected := map[string][]string{
+		ChangeVarTypeChanged:  {"instance_type"},
+		ChangeVarRequired:     {"zone"},
+		ChangeVarAdded:        {"vpc_id"},
+		ChangeVarRemoved:      {"legacy"},
+		ChangeProviderVersion: {"alicloud"},
+		ChangeProviderAdded:   {"tls"},
+		ChangeProviderRemoved: {"random"},
+		ChangeBackendChanged:  {"consul"},
+		// 类型变化的变量同时默认值也变化
+		ChangeVarDefaultChanged: {"instance_type"},
+	}
+	if !reflect.DeepEqual(kinds, expected) {
+		t.Errorf("got changes %v, want %v", kinds, expected)
+	}
+
+	if changes := CompareModuleConfig(after, after); len(changes) != 0 {
+		t.Errorf("expected no changes, got %v", changes)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tfanalysis
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+const LockFileName = ".terraform.lock.hcl"
+
+// ProviderLock 依赖锁文件中记录的 provider 版本
+type ProviderLock struct {
+	Source      string `json:"source" example:"registry.terraform.io/hashicorp/aws"`
+	Version     string `json:"version" example:"3.63.0"`     // 锁定的版本
+	Constraints string `json:"constraints" example:"~> 3.0"` // 代码中声明的版本约束，为空表示未声明
+	Pinned      bool   `json:"pinned"`                       // 版本约束是否固定为单一版本
+}
+
+// 固定版本的约束，如 "1.2.3" 或 "= 1.2.3"
+var exactVersionRegex = regexp.MustCompile(`^=?\s*v?\d+\.\d+\.\d+(-[\w.]+)?$`)
+
+// ParseLockFile 解析 .terraform.lock.hcl 文件内容
+func ParseLockFile(content []byte) ([]ProviderLock, error) {
+	file, diags := hclsyntax.ParseConfig(content, LockFileName, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s: %v", LockFileName, diags)
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil
+	}
+
+	locks := make([]ProviderLock, 0)
+	for _, block := range body.Blocks {
+		if block.Type != "provider" || len(block.Labels) == 0 {
+			continue
+		}
+		lock := ProviderLock{Source: block.Labels[0]}
+		for name, attr := range block.Body.Attributes {
+			if name != "version" && name != "constraints" {
+				continue
+			}
+			val, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || val.IsNull() || val.Type() != cty.String {
+				continue
+			}
+			if name == "version" {
+				lock.Version = val.AsString()
+			} else {
+				lock.Constraints = val.AsString()
+			}
+		}
+		lock.Pinned = exactVersionRegex.MatchString(lock.Constraints)
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
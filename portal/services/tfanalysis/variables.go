@@ -0,0 +1,123 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tfanalysis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// VariableDecl terraform 变量声明
+type VariableDecl struct {
+	Name        string      `json:"name" example:"instance_type"`
+	Type        string      `json:"type" example:"list(string)"` // 类型约束表达式，未声明类型时为空
+	Default     interface{} `json:"default"`                     // 默认值，未声明默认值时为 null
+	Required    bool        `json:"required"`                    // 未声明默认值的变量创建环境时必须传入
+	Description string      `json:"description"`
+	Sensitive   bool        `json:"sensitive"`
+	File        string      `json:"file" example:"variables.tf"` // 声明所在文件
+	Line        int         `json:"line" example:"12"`
+}
+
+// ParseVariables 解析根模块 .tf 文件中的变量声明，结果按文件及行号排序，
+// 返回的第二个值为解析失败的文件信息
+func ParseVariables(files map[string][]byte) ([]VariableDecl, []string) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		if strings.HasSuffix(name, ".tf") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	vars := make([]VariableDecl, 0)
+	parseErrors := make([]string, 0)
+	for _, name := range names {
+		decls, err := parseFileVariables(name, files[name])
+		if err != nil {
+			parseErrors = append(parseErrors, err.Error())
+			continue
+		}
+		vars = append(vars, decls...)
+	}
+	return vars, parseErrors
+}
+
+func parseFileVariables(name string, content []byte) ([]VariableDecl, error) {
+	file, diags := hclsyntax.ParseConfig(content, name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s: %v", name, diags)
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, nil
+	}
+
+	decls := make([]VariableDecl, 0)
+	for _, block := range body.Blocks {
+		if block.Type != "variable" || len(block.Labels) == 0 {
+			continue
+		}
+		decl := VariableDecl{
+			Name:     block.Labels[0],
+			Required: true,
+			File:     name,
+			Line:     block.DefRange().Start.Line,
+		}
+		attrs := block.Body.Attributes
+		if attr, ok := attrs["type"]; ok {
+			// 类型约束保留源码形式，如 map(object({ name = string }))
+			decl.Type = string(attr.Expr.Range().SliceBytes(content))
+		}
+		if attr, ok := attrs["default"]; ok {
+			decl.Required = false
+			decl.Default = exprJSONValue(attr.Expr)
+		}
+		if v, ok := attrStringValue(attrs, "description"); ok {
+			decl.Description = v
+		}
+		if attr, ok := attrs["sensitive"]; ok {
+			if v, diags := attr.Expr.Value(nil); !diags.HasErrors() && v.Type() == cty.Bool && v.IsKnown() && !v.IsNull() {
+				decl.Sensitive = v.True()
+			}
+		}
+		decls = append(decls, decl)
+	}
+	return decls, nil
+}
+
+func attrStringValue(attrs hclsyntax.Attributes, name string) (string, bool) {
+	attr, ok := attrs[name]
+	if !ok {
+		return "", false
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || v.Type() != cty.String || !v.IsKnown() || v.IsNull() {
+		return "", false
+	}
+	return v.AsString(), true
+}
+
+// exprJSONValue 将字面量表达式转为可 JSON 序列化的值，无法求值时返回 nil
+func exprJSONValue(expr hclsyntax.Expression) interface{} {
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() {
+		return nil
+	}
+	bs, err := ctyjson.SimpleJSONValue{Value: v}.MarshalJSON()
+	if err != nil {
+		return nil
+	}
+	var result interface{}
+	if err := json.Unmarshal(bs, &result); err != nil {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package tfanalysis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseVariables(t *testing.T) {
+	files := map[string][]byte{
+		"variables.tf": []byte(`
+variable "instance_type" {
+  type        = string
+  default     = "ecs.t5-lc1m1.small"
+  description = "实例规格"
+}
+
+variable "password" {
+  type      = string
+  sensitive = true
+}
+
+variable "tags" {
+  type = map(object({ value = string }))
+  default = {
+    env = { value = "dev" }
+  }
+}
+
+variable "untyped" {}
+`),
+		"main.tf": []byte(`
+variable "count" {
+  type    = number
+  default = 2
+}
+
+resource "alicloud_instance" "web" {
+  instance_type = var.instance_type
+}
+`),
+		"README.md": []byte(`variable "ignored" {}`),
+		"broken.tf": []byte(`variable "x" {`),
+	}
+
+	vars, errs := ParseVariables(files)
+	if len(errs) != 1 {
+		t.Fatalf("expect 1 parse error, got %v", errs)
+	}
+
+	expect := []VariableDecl{
+		{Name: "count", Type: "number", Default: float64(2), File: "main.tf", Line: 2},
+		{Name: "instance_type", Type: "string", Default: "ecs.t5-lc1m1.small", Description: "实例规格", File: "variables.tf", Line: 2},
+		{Name: "password", Type: "string", Required: true, Sensitive: true, File: "variables.tf", Line: 8},
+		{Name: "tags", Type: "map(object({ value = string }))", File: "variables.tf", Line: 13,
+			Default: map[string]interface{}{"env": map[string]interface{}{"value": "dev"}}},
+		{Name: "untyped", Required: true, File: "variables.tf", Line: 20},
+	}
+	if !reflect.DeepEqual(vars, expect) {
+		t.Errorf("unexpected variables:\n%+v\nexpect:\n%+v", vars, expect)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"time"
+)
+
+// setUserTemplateAttrs 更新用户对云模板的标记，记录不存在时创建
+func setUserTemplateAttrs(tx *db.Session, userId, tplId models.Id, attrs models.Attrs) e.Error {
+	ut := models.UserTemplate{}
+	err := tx.Where("user_id = ? AND tpl_id = ?", userId, tplId).First(&ut)
+	if err != nil && !e.IsRecordNotFound(err) {
+		return e.New(e.DBError, err)
+	} else if err == nil {
+		if _, err := models.UpdateAttr(tx.Where("id = ?", ut.Id), &models.UserTemplate{}, attrs); err != nil {
+			return e.New(e.DBError, err)
+		}
+		return nil
+	}
+
+	ut = models.UserTemplate{UserId: userId, TplId: tplId}
+	if err := models.Create(tx, &ut); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", ut.Id), &models.UserTemplate{}, attrs); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// SetTemplateFavorite 收藏或取消收藏云模板
+func SetTemplateFavorite(tx *db.Session, userId, tplId models.Id, favorite bool) e.Error {
+	return setUserTemplateAttrs(tx, userId, tplId, models.Attrs{"favorite": favorite})
+}
+
+// MarkTemplateUsed 记录用户最近一次使用云模板的时间
+func MarkTemplateUsed(tx *db.Session, userId, tplId models.Id) e.Error {
+	return setUserTemplateAttrs(tx, userId, tplId, models.Attrs{"last_used_at": models.Time(time.Now())})
+}
+
+// QueryWithUserTemplate 查询云模板时关联用户的收藏及最近使用时间，
+// 查询需要已按云模板 id 分组，返回的字段为 favorite 及 last_used_at
+func QueryWithUserTemplate(query *db.Session, userId models.Id) *db.Session {
+	return query.Joins("LEFT JOIN iac_user_template AS ut ON ut.tpl_id = iac_template.id AND ut.user_id = ?", userId).
+		LazySelectAppend(
+			"IFNULL(MAX(ut.favorite), 0) AS favorite",
+			"MAX(ut.last_used_at) AS last_used_at")
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"fmt"
+	"sort"
+)
+
+// VarGroupSharedWith 变量组是否共享给指定的项目及云模板，id 为空时不检查对应的共享范围
+func VarGroupSharedWith(vg models.VariableGroup, projectId, tplId models.Id) bool {
+	if projectId != "" && len(vg.ShareProjects) > 0 && !utils.StrInArray(projectId.String(), vg.ShareProjects...) {
+		return false
+	}
+	if tplId != "" && len(vg.ShareTemplates) > 0 && !utils.StrInArray(tplId.String(), vg.ShareTemplates...) {
+		return false
+	}
+	return true
+}
+
+func filterSharedVarGroups(vgs []VarGroupRel, projectId, tplId models.Id) []VarGroupRel {
+	shared := make([]VarGroupRel, 0, len(vgs))
+	for _, vg := range vgs {
+		if VarGroupSharedWith(vg.VariableGroup, projectId, tplId) {
+			shared = append(shared, vg)
+		}
+	}
+	return shared
+}
+
+// ValidateVarGroupShare 校验变量组共享的项目及云模板都属于组织
+func ValidateVarGroupShare(query *db.Session, orgId models.Id, projectIds, tplIds []models.Id) e.Error {
+	check := func(model interface{}, ids []models.Id, name string) e.Error {
+		if len(ids) == 0 {
+			return nil
+		}
+		uniq := make(map[models.Id]struct{}, len(ids))
+		for _, id := range ids {
+			uniq[id] = struct{}{}
+		}
+		count, err := query.Model(model).Where("org_id = ? AND id IN (?)", orgId, ids).Count()
+		if err != nil {
+			return e.New(e.DBError, err)
+		}
+		if int(count) != len(uniq) {
+			return e.New(e.VariableGroupShareInvalid, fmt.Errorf("%s not found in organization", name))
+		}
+		return nil
+	}
+	if err := check(&models.Project{}, projectIds, "project"); err != nil {
+		return err
+	}
+	return check(&models.Template{}, tplIds, "template")
+}
+
+// varGroupObjectScope 查询变量组关联对象所属的项目及云模板
+func varGroupObjectScope(tx *db.Session, objectType string, objectId models.Id) (projectId, tplId models.Id, er e.Error) {
+	switch objectType {
+	case consts.ScopeProject:
+		return objectId, "", nil
+	case consts.ScopeTemplate:
+		return "", objectId, nil
+	case consts.ScopeEnv:
+		env, err := GetEnvById(tx, objectId)
+		if err != nil {
+			return "", "", err
+		}
+		return env.ProjectId, env.TplId, nil
+	}
+	return "", "", nil
+}
+
+// CheckVarGroupsShared 检查变量组是否共享给要关联的对象
+func CheckVarGroupsShared(tx *db.Session, vgIds []models.Id, objectType string, objectId models.Id) e.Error {
+	if len(vgIds) == 0 {
+		return nil
+	}
+	projectId, tplId, err := varGroupObjectScope(tx, objectType, objectId)
+	if err != nil {
+		return err
+	}
+	vgs, err := GetVariableGroupListByIds(tx, vgIds)
+	if err != nil {
+		return err
+	}
+	for _, vg := range vgs {
+		if !VarGroupSharedWith(vg, projectId, tplId) {
+			return e.New(e.VariableGroupNotShared,
+				fmt.Errorf("variable group '%s' is not shared with %s %s", vg.Name, objectType, objectId))
+		}
+	}
+	return nil
+}
+
+// VarGroupAccessEnv 可以使用变量组的环境
+type VarGroupAccessEnv struct {
+	EnvId       models.Id `json:"envId"`
+	EnvName     string    `json:"envName"`
+	ProjectId   models.Id `json:"projectId"`
+	ProjectName string    `json:"projectName"`
+	TplId       models.Id `json:"tplId"`
+	TplName     string    `json:"tplName"`
+	ObjectType  string    `json:"objectType"` // 环境通过哪一级的关联使用变量组 enum('org','template','project','env')
+}
+
+// GetVarGroupAccessEnvs 查询可以使用变量组的环境(不包括已归档的环境)
+func GetVarGroupAccessEnvs(query *db.Session, vg models.VariableGroup) ([]VarGroupAccessEnv, e.Error) {
+	rels := make([]models.VariableGroupRel, 0)
+	if err := query.Model(&models.VariableGroupRel{}).Where("var_group_id = ?", vg.Id).Find(&rels); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if len(rels) == 0 {
+		return []VarGroupAccessEnv{}, nil
+	}
+
+	ids := make(map[string][]models.Id)
+	for _, rel := range rels {
+		ids[rel.ObjectType] = append(ids[rel.ObjectType], rel.ObjectId)
+	}
+	envQuery := query.Table("iac_env AS env").
+		Joins("LEFT JOIN iac_project AS p ON p.id = env.project_id").
+		Joins("LEFT JOIN iac_template AS t ON t.id = env.tpl_id").
+		Where("env.org_id = ? AND env.archived = 0", vg.OrgId)
+	if len(ids[consts.ScopeOrg]) == 0 {
+		// 非组织级关联时只查询关联的项目、云模板及环境
+		cond, args := "1 = 0", make([]interface{}, 0)
+		for _, c := range []struct{ scope, column string }{
+			{consts.ScopeProject, "env.project_id"},
+			{consts.ScopeTemplate, "env.tpl_id"},
+			{consts.ScopeEnv, "env.id"},
+		} {
+			if len(ids[c.scope]) > 0 {
+				cond += fmt.Sprintf(" OR %s IN (?)", c.column)
+				args = append(args, ids[c.scope])
+			}
+		}
+		envQuery = envQuery.Where(cond, args...)
+	}
+
+	envs := make([]VarGroupAccessEnv, 0)
+	if err := envQuery.Select("env.id AS env_id, env.name AS env_name, env.project_id, p.name AS project_name, " +
+		"env.tpl_id, t.name AS tpl_name").Scan(&envs); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return resolveVarGroupAccess(vg, rels, envs), nil
+}
+
+// resolveVarGroupAccess 计算环境使用变量组的关联方式，并过滤掉不在共享范围内的环境
+func resolveVarGroupAccess(vg models.VariableGroup, rels []models.VariableGroupRel, envs []VarGroupAccessEnv) []VarGroupAccessEnv {
+	bound := make(map[string]bool, len(rels))
+	for _, rel := range rels {
+		bound[rel.ObjectType+"/"+rel.ObjectId.String()] = true
+	}
+
+	result := make([]VarGroupAccessEnv, 0, len(envs))
+	for _, env := range envs {
+		if !VarGroupSharedWith(vg, env.ProjectId, env.TplId) {
+			continue
+		}
+		// 按继承顺序取最具体的一级关联
+		switch {
+		case bound[consts.ScopeEnv+"/"+env.EnvId.String()]:
+			env.ObjectType = consts.ScopeEnv
+		case bound[consts.ScopeTemplate+"/"+env.TplId.String()]:
+			env.ObjectType = consts.ScopeTemplate
+		case bound[consts.ScopeProject+"/"+env.ProjectId.String()]:
+			env.ObjectType = consts.ScopeProject
+		case bound[consts.ScopeOrg+"/"+vg.OrgId.String()]:
+			env.ObjectType = consts.ScopeOrg
+		default:
+			continue
+		}
+		result = append(result, env)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ProjectName != result[j].ProjectName {
+			return result[i].ProjectName < result[j].ProjectName
+		}
+		return result[i].EnvName < result[j].EnvName
+	})
+	return result
+}
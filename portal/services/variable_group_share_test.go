@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts"
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestVarGroupSharedWith(t *testing.T) {
+	vg := models.VariableGroup{ShareProjects: models.StrSlice{"p-prod"}}
+	if !VarGroupSharedWith(vg, "p-prod", "tpl-a") || VarGroupSharedWith(vg, "p-dev", "tpl-a") {
+		t.Errorf("project share scope not respected")
+	}
+	if !VarGroupSharedWith(vg, "", "tpl-a") {
+		t.Errorf("empty project id should not be checked")
+	}
+
+	vg = models.VariableGroup{ShareTemplates: models.StrSlice{"tpl-a"}}
+	if !VarGroupSharedWith(vg, "p-dev", "tpl-a") || VarGroupSharedWith(vg, "p-dev", "tpl-b") {
+		t.Errorf("template share scope not respected")
+	}
+	if !VarGroupSharedWith(models.VariableGroup{}, "p-dev", "tpl-b") {
+		t.Errorf("variable group without share scope should be shared with all")
+	}
+}
+
+func TestResolveVarGroupAccess(t *testing.T) {
+	vg := models.VariableGroup{OrgId: "org-1", ShareProjects: models.StrSlice{"p-prod"}}
+	vg.Id = "vg-1"
+	rels := []models.VariableGroupRel{
+		{VarGroupId: "vg-1", ObjectType: consts.ScopeOrg, ObjectId: "org-1"},
+		{VarGroupId: "vg-1", ObjectType: consts.ScopeTemplate, ObjectId: "tpl-a"},
+	}
+	envs := []VarGroupAccessEnv{
+		{EnvId: "env-1", EnvName: "b", ProjectId: "p-prod", ProjectName: "prod", TplId: "tpl-a"},
+		{EnvId: "env-2", EnvName: "a", ProjectId: "p-prod", ProjectName: "prod", TplId: "tpl-b"},
+		{EnvId: "env-3", EnvName: "c", ProjectId: "p-dev", ProjectName: "dev", TplId: "tpl-a"},
+	}
+	result := resolveVarGroupAccess(vg, rels, envs)
+	if len(result) != 2 {
+		t.Fatalf("expect 2 envs, got %+v", result)
+	}
+	if result[0].EnvId != "env-2" || result[0].ObjectType != consts.ScopeOrg {
+		t.Errorf("unexpected access %+v", result[0])
+	}
+	if result[1].EnvId != "env-1" || result[1].ObjectType != consts.ScopeTemplate {
+		t.Errorf("unexpected access %+v", result[1])
+	}
+}
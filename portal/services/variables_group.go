@@ -133,6 +133,8 @@ func SearchVariableGroupRel(dbSess *db.Session, objectAttr map[string]models.Id,
 		if err != nil {
 			continue
 		}
+		// 未共享给当前项目或云模板的变量组不生效
+		vgs = filterSharedVarGroups(vgs, objectAttr[consts.ScopeProject], objectAttr[consts.ScopeTemplate])
 
 		addRels := addVarGroupRel(vgs, rels, coverRels, index)
 
@@ -289,6 +291,9 @@ func BatchUpdateRelationship(tx *db.Session, vgIds, delVgIds []models.Id, object
 	if err := DeleteRelationship(tx, delVgIds); err != nil {
 		return err
 	}
+	if err := CheckVarGroupsShared(tx, vgIds, objectType, models.Id(objectId)); err != nil {
+		return err
+	}
 
 	for _, v := range vgIds {
 		rel = append(rel, models.VariableGroupRel{
@@ -0,0 +1,120 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// VcsOauthStateExpire 用户需要在该时间内完成代码仓库的授权
+const VcsOauthStateExpire = 10 * time.Minute
+
+type VcsOauthStateClaims struct {
+	jwt.StandardClaims
+
+	VcsId  models.Id `json:"vcsId"`
+	UserId models.Id `json:"userId"`
+	// 用户是否有 vcs 的编辑权限，只有编辑者的授权可以作为 vcs 的默认授权
+	CanUpdateVcs bool `json:"canUpdateVcs,omitempty"`
+}
+
+// VcsOauthRedirectUri 代码仓库授权后的回调地址
+func VcsOauthRedirectUri() string {
+	return strings.TrimRight(configs.Get().Portal.Address, "/") + "/api/v1/vcs/oauth/callback"
+}
+
+// GenerateVcsOauthState 生成授权请求的 state 参数，回调时用于校验请求并确定授权的 vcs 及用户
+func GenerateVcsOauthState(vcsId, userId models.Id, canUpdateVcs bool) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, VcsOauthStateClaims{
+		VcsId:        vcsId,
+		UserId:       userId,
+		CanUpdateVcs: canUpdateVcs,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(VcsOauthStateExpire).Unix(),
+			Subject:   consts.JwtSubjectVcsOauth,
+		},
+	})
+	return token.SignedString([]byte(configs.Get().JwtSecretKey))
+}
+
+func VerifyVcsOauthState(state string) (*VcsOauthStateClaims, e.Error) {
+	claims := VcsOauthStateClaims{}
+	token, err := jwt.ParseWithClaims(state, &claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(configs.Get().JwtSecretKey), nil
+	})
+	if err != nil {
+		return nil, e.New(e.InvalidToken, err)
+	}
+	if !token.Valid || claims.Subject != consts.JwtSubjectVcsOauth {
+		return nil, e.New(e.InvalidToken, fmt.Errorf("invalid oauth state"))
+	}
+	return &claims, nil
+}
+
+// SaveVcsOauthToken 保存用户对 vcs 的授权，已授权时更新 token
+func SaveVcsOauthToken(tx *db.Session, vcsId, userId models.Id, token *vcsrv.OauthToken) (*models.VcsOauthToken, e.Error) {
+	record := models.VcsOauthToken{}
+	if err := tx.Where("vcs_id = ? AND user_id = ?", vcsId, userId).First(&record); err != nil {
+		if !e.IsRecordNotFound(err) {
+			return nil, e.New(e.DBError, err)
+		}
+		record = models.VcsOauthToken{VcsId: vcsId, UserId: userId}
+	}
+	record.Login = token.Login
+	if err := vcsrv.SetOauthToken(&record, token); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	if record.Id == "" {
+		if err := models.Create(tx, &record); err != nil {
+			return nil, e.New(e.DBError, err)
+		}
+		return &record, nil
+	}
+	if _, err := models.UpdateAttr(tx.Where("id = ?", record.Id), &models.VcsOauthToken{}, models.Attrs{
+		"login":         record.Login,
+		"access_token":  record.AccessToken,
+		"refresh_token": record.RefreshToken,
+		"expires_at":    record.ExpiresAt,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return &record, nil
+}
+
+func GetVcsOauthToken(tx *db.Session, vcsId, userId models.Id) (*models.VcsOauthToken, e.Error) {
+	record := models.VcsOauthToken{}
+	if err := tx.Where("vcs_id = ? AND user_id = ?", vcsId, userId).First(&record); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.VcsUnauthorized, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &record, nil
+}
+
+// DeleteVcsOauthToken 删除用户对 vcs 的授权，删除的是 vcs 默认使用的授权时清空 vcs 的授权用户
+func DeleteVcsOauthToken(tx *db.Session, vcs *models.Vcs, userId models.Id) e.Error {
+	if _, err := tx.Where("vcs_id = ? AND user_id = ?", vcs.Id, userId).Delete(&models.VcsOauthToken{}); err != nil {
+		return e.New(e.DBError, err)
+	}
+	if vcs.OauthUserId == userId {
+		if _, err := models.UpdateAttr(tx.Where("id = ?", vcs.Id), &models.Vcs{}, models.Attrs{"oauth_user_id": ""}); err != nil {
+			return e.New(e.DBError, err)
+		}
+	}
+	return nil
+}
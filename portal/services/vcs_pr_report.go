@@ -0,0 +1,145 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"cloudiac/utils/logs"
+	"fmt"
+	"strings"
+)
+
+// 合规检测结果摘要中各状态的展示顺序
+var prPolicyStatuses = []string{
+	common.PolicyStatusPassed,
+	common.PolicyStatusViolated,
+	common.PolicyStatusFailed,
+	common.PolicyStatusSuppressed,
+}
+
+// TaskDetailAddr 返回任务详情页面地址
+func TaskDetailAddr(task *models.Task) string {
+	//http://{{addr}}/org/{{orgId}}/project/{{ProjectId}}/m-project-env/detail/{{envId}}/task/{{TaskId}}
+	return fmt.Sprintf("%s/org/%s/project/%s/m-project-env/detail/%s/task/%s",
+		configs.Get().Portal.Address, task.OrgId, task.ProjectId, task.EnvId, task.Id)
+}
+
+// TplScanResultAddr 返回云模板扫描结果页面地址
+func TplScanResultAddr(task *models.ScanTask) string {
+	//http://{{addr}}/org/{{orgId}}/m-org-ct/detail/{{tplId}}/scan?taskId={{TaskId}}
+	return fmt.Sprintf("%s/org/%s/m-org-ct/detail/%s/scan?taskId=%s",
+		configs.Get().Portal.Address, task.OrgId, task.TplId, task.Id)
+}
+
+// PlanSummaryText 返回 plan 结果的资源变更摘要，如 2 to add, 1 to change, 0 to destroy，无资源变更数据时返回空字符串
+func PlanSummaryText(result models.TaskResult) string {
+	if result.ResAdded == nil && result.ResChanged == nil && result.ResDestroyed == nil {
+		return ""
+	}
+	count := func(n *int) int {
+		if n == nil {
+			return 0
+		}
+		return *n
+	}
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy",
+		count(result.ResAdded), count(result.ResChanged), count(result.ResDestroyed))
+}
+
+// PolicySummaryText 返回合规检测结果摘要，如 passed 10, violated 2，未执行合规检测时返回空字符串
+func PolicySummaryText(summary []*PolicyScanSummary) string {
+	counts := make(map[string]int)
+	for _, s := range summary {
+		counts[s.Status] += s.Count
+	}
+	parts := make([]string, 0, len(prPolicyStatuses))
+	for _, status := range prPolicyStatuses {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", status, counts[status]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TaskCommitState 返回任务状态对应的 commit 状态
+func TaskCommitState(taskStatus string) string {
+	switch taskStatus {
+	case models.TaskComplete:
+		return vcsrv.CommitStatusSuccess
+	case models.TaskFailed, models.TaskRejected, models.TaskCancelled:
+		return vcsrv.CommitStatusFailure
+	default:
+		return vcsrv.CommitStatusPending
+	}
+}
+
+// SetTaskCommitStatus 设置 PR plan 任务对应 commit 的状态，失败时只打印日志
+func SetTaskCommitStatus(repo vcsrv.RepoIface, task *models.Task, envName string, taskStatus string, description string) {
+	if task.CommitId == "" {
+		return
+	}
+	status := vcsrv.CommitStatus{
+		State:       TaskCommitState(taskStatus),
+		Context:     fmt.Sprintf("cloudiac/plan/%s", envName),
+		TargetUrl:   TaskDetailAddr(task),
+		Description: description,
+	}
+	if err := repo.SetCommitStatus(task.CommitId, status); err != nil {
+		logs.Get().WithField("taskId", task.Id).Warnf("set vcs commit status err: %v", err)
+	}
+}
+
+// SetWebhookPlanPending PR 触发的 plan 任务创建后将 commit 状态设置为 pending
+func SetWebhookPlanPending(session *db.Session, task *models.Task, env *models.Env) {
+	if task.Source != consts.TaskSourceWebhookPlan {
+		return
+	}
+	repo, err := GetVcsRepoByTplId(session, task.TplId)
+	if err != nil {
+		logs.Get().WithField("taskId", task.Id).Warnf("get vcs repo err: %v", err)
+		return
+	}
+	SetTaskCommitStatus(repo, task, env.Name, models.TaskPending, "plan is pending")
+}
+
+// SetScanTaskCommitStatus 设置 webhook 触发的云模板扫描任务对应 commit 的状态，
+// 扫描未通过时状态为 failure，可以通过分支保护规则阻止合并，失败时只打印日志
+func SetScanTaskCommitStatus(session *db.Session, task *models.ScanTask) {
+	if task.Source != consts.TaskSourceWebhookScan || task.CommitId == "" {
+		return
+	}
+	logger := logs.Get().WithField("taskId", task.Id)
+	tpl, err := GetTemplateById(session, task.TplId)
+	if err != nil {
+		logger.Warnf("get template err: %v", err)
+		return
+	}
+	repo, err := GetVcsRepoByTplId(session, task.TplId)
+	if err != nil {
+		logger.Warnf("get vcs repo err: %v", err)
+		return
+	}
+
+	description := "policy scan is pending"
+	switch {
+	case !task.Exited():
+	case task.PolicyStatus == common.PolicyStatusPassed || task.PolicyStatus == common.PolicyStatusViolated:
+		description = fmt.Sprintf("policy scan %s", task.PolicyStatus)
+	default:
+		description = fmt.Sprintf("scan task %s", task.Status)
+	}
+	status := vcsrv.CommitStatus{
+		State:       TaskCommitState(task.Status),
+		Context:     fmt.Sprintf("cloudiac/scan/%s", tpl.Name),
+		TargetUrl:   TplScanResultAddr(task),
+		Description: description,
+	}
+	if err := repo.SetCommitStatus(task.CommitId, status); err != nil {
+		logger.Warnf("set vcs commit status err: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services/vcsrv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSummaryText(t *testing.T) {
+	assert.Equal(t, "", PlanSummaryText(models.TaskResult{}))
+
+	added, destroyed := 2, 1
+	assert.Equal(t, "2 to add, 0 to change, 1 to destroy",
+		PlanSummaryText(models.TaskResult{ResAdded: &added, ResDestroyed: &destroyed}))
+}
+
+func TestPolicySummaryText(t *testing.T) {
+	assert.Equal(t, "", PolicySummaryText(nil))
+
+	summary := []*PolicyScanSummary{
+		{Status: common.PolicyStatusViolated, Count: 2},
+		{Status: common.PolicyStatusPassed, Count: 10},
+		{Status: common.PolicyStatusFailed, Count: 0},
+	}
+	assert.Equal(t, "passed 10, violated 2", PolicySummaryText(summary))
+}
+
+func TestTaskCommitState(t *testing.T) {
+	assert.Equal(t, vcsrv.CommitStatusSuccess, TaskCommitState(models.TaskComplete))
+	assert.Equal(t, vcsrv.CommitStatusFailure, TaskCommitState(models.TaskFailed))
+	assert.Equal(t, vcsrv.CommitStatusPending, TaskCommitState(models.TaskRunning))
+}
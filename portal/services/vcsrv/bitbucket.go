@@ -0,0 +1,498 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"bytes"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	bitbucketCloudApi  = "https://api.bitbucket.org/2.0"
+	bitbucketPageLimit = 100
+
+	// BitbucketCloneUser 使用 access token clone 代码时的用户名
+	BitbucketCloneUser = "x-token-auth"
+)
+
+// webhook 订阅的事件，PR 创建及源分支有新的推送时都需要执行 plan
+var (
+	bitbucketCloudHookEvents  = []string{"repo:push", "pullrequest:created", "pullrequest:updated"}
+	bitbucketServerHookEvents = []string{"repo:refs_changed", "pr:opened", "pr:from_ref_updated"}
+)
+
+// newBitbucketInstance
+// bitbucket cloud api文档: https://developer.atlassian.com/cloud/bitbucket/rest/intro/
+// bitbucket server api文档: https://docs.atlassian.com/bitbucket-server/rest/7.21.0/bitbucket-rest.html
+// vcs 地址为 bitbucket.org 时使用 cloud 版本的接口，否则使用自部署 server 版本的接口。
+// token 使用 access token(cloud 为仓库/工作空间 access token，server 为 HTTP access token)
+func newBitbucketInstance(vcs *models.Vcs) (VcsIface, error) {
+	if isBitbucketCloud(vcs.Address) {
+		return &bitbucketCloudVcs{vcs: vcs}, nil
+	}
+	return &bitbucketServerVcs{vcs: vcs}, nil
+}
+
+func isBitbucketCloud(address string) bool {
+	u, err := url.Parse(address)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "bitbucket.org" || host == "api.bitbucket.org"
+}
+
+type bitbucketCloudVcs struct {
+	vcs *models.Vcs
+}
+
+type bitbucketLink struct {
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+type RepositoryBitbucketCloud struct {
+	Uuid        string    `json:"uuid"`
+	FullName    string    `json:"full_name"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UpdatedOn   time.Time `json:"updated_on"`
+	MainBranch  struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+	Links struct {
+		Clone []bitbucketLink `json:"clone"`
+	} `json:"links"`
+}
+
+type bitbucketCloudPage struct {
+	Size   int             `json:"size"`
+	Next   string          `json:"next"`
+	Values json.RawMessage `json:"values"`
+}
+
+func bitbucketCloudUrl(path string, params url.Values) string {
+	return utils.GenQueryURL(bitbucketCloudApi, path, params)
+}
+
+func (bitbucket *bitbucketCloudVcs) GetRepo(idOrPath string) (RepoIface, error) {
+	response, body, err := bitbucketRequest(bitbucketCloudUrl(fmt.Sprintf("/repositories/%s", idOrPath), nil),
+		http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.BadRequest, err)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return nil, err
+	}
+
+	rep := RepositoryBitbucketCloud{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	return &bitbucketCloudRepoIface{
+		vcs:        bitbucket.vcs,
+		repository: &rep,
+	}, nil
+}
+
+func (bitbucket *bitbucketCloudVcs) ListRepos(namespace, search string, limit, offset int) ([]RepoIface, int64, error) {
+	if limit <= 0 {
+		limit = bitbucketPageLimit
+	}
+	urlParam := url.Values{}
+	urlParam.Set("role", "member")
+	urlParam.Set("page", strconv.Itoa(utils.LimitOffset2Page(limit, offset)))
+	urlParam.Set("pagelen", strconv.Itoa(limit))
+	if search != "" {
+		urlParam.Set("q", fmt.Sprintf("name ~ %q", search))
+	}
+	repoPath := "/repositories"
+	if namespace != "" {
+		repoPath = fmt.Sprintf("/repositories/%s", namespace)
+	}
+	response, body, err := bitbucketRequest(bitbucketCloudUrl(repoPath, urlParam), http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, 0, e.New(e.BadRequest, err)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return nil, 0, err
+	}
+
+	page := bitbucketCloudPage{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, 0, e.New(e.VcsError, err)
+	}
+	rep := make([]*RepositoryBitbucketCloud, 0)
+	_ = json.Unmarshal(page.Values, &rep)
+	repoList := make([]RepoIface, 0, len(rep))
+	for _, v := range rep {
+		repoList = append(repoList, &bitbucketCloudRepoIface{
+			vcs:        bitbucket.vcs,
+			repository: v,
+		})
+	}
+	return repoList, int64(page.Size), nil
+}
+
+func (bitbucket *bitbucketCloudVcs) UserInfo() (UserInfo, error) {
+	response, body, err := bitbucketRequest(bitbucketCloudUrl("/user", nil), http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return UserInfo{}, e.New(e.BadRequest, err)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return UserInfo{}, err
+	}
+	user := struct {
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	}{}
+	_ = json.Unmarshal(body, &user)
+	return UserInfo{Login: user.Username, Name: user.DisplayName}, nil
+}
+
+type bitbucketCloudRepoIface struct {
+	vcs        *models.Vcs
+	repository *RepositoryBitbucketCloud
+}
+
+func (bitbucket *bitbucketCloudRepoIface) repoUrl(subPath string, params url.Values) string {
+	return bitbucketCloudUrl(fmt.Sprintf("/repositories/%s%s", bitbucket.repository.FullName, subPath), params)
+}
+
+// listAll 按 next 链接查询所有分页的数据
+func (bitbucket *bitbucketCloudRepoIface) listAll(addr string) ([]json.RawMessage, error) {
+	values := make([]json.RawMessage, 0)
+	for addr != "" {
+		response, body, err := bitbucketRequest(addr, http.MethodGet, bitbucket.vcs.VcsToken, nil)
+		if err != nil {
+			return nil, e.New(e.BadRequest, err)
+		}
+		if err := bitbucketRespErr(response, body); err != nil {
+			return nil, err
+		}
+		page := bitbucketCloudPage{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, e.New(e.VcsError, err)
+		}
+		items := make([]json.RawMessage, 0)
+		_ = json.Unmarshal(page.Values, &items)
+		values = append(values, items...)
+		addr = page.Next
+	}
+	return values, nil
+}
+
+// listRefNames 列出分支或 tag，search 不为空时只返回名称包含 search 的分支或 tag
+func (bitbucket *bitbucketCloudRepoIface) listRefNames(refType, search string) ([]string, error) {
+	urlParam := url.Values{}
+	urlParam.Set("pagelen", strconv.Itoa(bitbucketPageLimit))
+	if search != "" {
+		urlParam.Set("q", fmt.Sprintf("name ~ %s", strconv.Quote(search)))
+	}
+	values, err := bitbucket.listAll(bitbucket.repoUrl(fmt.Sprintf("/refs/%s", refType), urlParam))
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		ref := struct {
+			Name string `json:"name"`
+		}{}
+		_ = json.Unmarshal(v, &ref)
+		names = append(names, ref.Name)
+	}
+	return names, nil
+}
+
+func (bitbucket *bitbucketCloudRepoIface) ListBranches() ([]string, error) {
+	return bitbucket.listRefNames("branches", "")
+}
+
+func (bitbucket *bitbucketCloudRepoIface) ListTags() ([]string, error) {
+	return bitbucket.listRefNames("tags", "")
+}
+
+// SearchRevisions 使用 q 参数在服务端按名称过滤分支及 tag(不区分大小写)，过滤后在本地分页
+func (bitbucket *bitbucketCloudRepoIface) SearchRevisions(revType, search string, limit, offset int) ([]string, int64, error) {
+	refType, err := bitbucketRefType(revType)
+	if err != nil {
+		return nil, 0, err
+	}
+	names, err := bitbucket.listRefNames(refType, search)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pageRevisions(names, limit, offset), int64(len(names)), nil
+}
+
+func bitbucketRefType(revType string) (string, error) {
+	switch revType {
+	case RevisionTypeBranch:
+		return "branches", nil
+	case RevisionTypeTag:
+		return "tags", nil
+	default:
+		return "", e.New(e.BadParam, fmt.Errorf("unknown revision type: %s", revType))
+	}
+}
+
+// BranchCommitId doc: https://developer.atlassian.com/cloud/bitbucket/rest/api-group-commits/#api-repositories-workspace-repo-slug-commit-commit-get
+func (bitbucket *bitbucketCloudRepoIface) BranchCommitId(branch string) (string, error) {
+	response, body, err := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/commit/%s", branch), nil),
+		http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return "", e.New(e.VcsError, err)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return "", err
+	}
+	commit := struct {
+		Hash string `json:"hash"`
+	}{}
+	if err := json.Unmarshal(body, &commit); err != nil {
+		return "", e.New(e.VcsError, err)
+	}
+	if commit.Hash == "" {
+		return "", e.New(e.VcsError, fmt.Errorf("query commit id failed"))
+	}
+	return commit.Hash, nil
+}
+
+type bitbucketCloudSrc struct {
+	Type string `json:"type"` // commit_file 或 commit_directory
+	Path string `json:"path"`
+}
+
+func (bitbucket *bitbucketCloudRepoIface) ListFiles(option VcsIfaceOptions) ([]string, error) {
+	urlParam := url.Values{}
+	urlParam.Set("pagelen", strconv.Itoa(bitbucketPageLimit))
+	// 目录需要以 / 结尾，否则返回的是文件内容
+	srcPath := fmt.Sprintf("/src/%s/%s", getBranch(bitbucket, option.Ref), strings.Trim(option.Path, "/"))
+	if !strings.HasSuffix(srcPath, "/") {
+		srcPath += "/"
+	}
+	values, err := bitbucket.listAll(bitbucket.repoUrl(srcPath, urlParam))
+	if err != nil {
+		return []string{}, err
+	}
+
+	resp := make([]string, 0)
+	for _, v := range values {
+		src := bitbucketCloudSrc{}
+		_ = json.Unmarshal(v, &src)
+		if src.Type == "commit_directory" && option.Recursive {
+			option.Path = src.Path
+			repList, _ := bitbucket.ListFiles(option)
+			resp = append(resp, repList...)
+		}
+		if src.Type == "commit_file" && matchGlob(option.Search, path.Base(src.Path)) {
+			resp = append(resp, src.Path)
+		}
+	}
+	if option.Limit > 0 && len(resp) > option.Limit {
+		resp = resp[:option.Limit]
+	}
+	return resp, nil
+}
+
+func (bitbucket *bitbucketCloudRepoIface) ReadFileContent(branch, path string) (content []byte, err error) {
+	response, body, er := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/src/%s/%s", branch, path), nil),
+		http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if er != nil {
+		return nil, e.New(e.BadRequest, er)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (bitbucket *bitbucketCloudRepoIface) FormatRepoSearch() (project *Projects, err e.Error) {
+	p := &Projects{
+		ID:             bitbucket.repository.FullName,
+		Description:    bitbucket.repository.Description,
+		DefaultBranch:  bitbucket.repository.MainBranch.Name,
+		Name:           bitbucket.repository.Name,
+		LastActivityAt: &bitbucket.repository.UpdatedOn,
+		FullName:       bitbucket.repository.FullName,
+	}
+	p.HTTPURLToRepo, p.SSHURLToRepo = bitbucketCloneUrls(bitbucket.repository.Links.Clone)
+	return p, nil
+}
+
+func (bitbucket *bitbucketCloudRepoIface) DefaultBranch() string {
+	return bitbucket.repository.MainBranch.Name
+}
+
+type bitbucketCloudHook struct {
+	Uuid string `json:"uuid"`
+	Url  string `json:"url"`
+}
+
+func (bitbucket *bitbucketCloudRepoIface) listHooks() ([]bitbucketCloudHook, error) {
+	values, err := bitbucket.listAll(bitbucket.repoUrl("/hooks", nil))
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]bitbucketCloudHook, 0, len(values))
+	for _, v := range values {
+		hook := bitbucketCloudHook{}
+		_ = json.Unmarshal(v, &hook)
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// ListWebhook cloud 的 webhook id 为 uuid，返回时转换为整数 id
+func (bitbucket *bitbucketCloudRepoIface) ListWebhook() ([]RepoHook, error) {
+	hooks, err := bitbucket.listHooks()
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]RepoHook, 0, len(hooks))
+	for _, hook := range hooks {
+		resp = append(resp, RepoHook{Id: bitbucketHookId(hook.Uuid), Url: hook.Url})
+	}
+	return resp, nil
+}
+
+func (bitbucket *bitbucketCloudRepoIface) DeleteWebhook(id int) error {
+	hooks, err := bitbucket.listHooks()
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if bitbucketHookId(hook.Uuid) != id {
+			continue
+		}
+		response, body, err := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/hooks/%s", hook.Uuid), nil),
+			http.MethodDelete, bitbucket.vcs.VcsToken, nil)
+		if err != nil {
+			return e.New(e.BadRequest, err)
+		}
+		return bitbucketRespErr(response, body)
+	}
+	return nil
+}
+
+// AddWebhook doc: https://developer.atlassian.com/cloud/bitbucket/rest/api-group-repositories/#api-repositories-workspace-repo-slug-hooks-post
+func (bitbucket *bitbucketCloudRepoIface) AddWebhook(url string) error {
+	b, _ := json.Marshal(map[string]interface{}{
+		"description": "cloudiac",
+		"url":         url,
+		"active":      true,
+		"events":      bitbucketCloudHookEvents,
+	})
+	response, body, err := bitbucketRequest(bitbucket.repoUrl("/hooks", nil), http.MethodPost, bitbucket.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
+
+func (bitbucket *bitbucketCloudRepoIface) CreatePrComment(prId int, comment string) error {
+	b, _ := json.Marshal(map[string]interface{}{
+		"content": map[string]string{"raw": comment},
+	})
+	response, body, err := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/pullrequests/%d/comments", prId), nil),
+		http.MethodPost, bitbucket.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
+
+// SetCommitStatus doc: https://developer.atlassian.com/cloud/bitbucket/rest/api-group-commit-statuses/#api-repositories-workspace-repo-slug-commit-commit-statuses-build-post
+func (bitbucket *bitbucketCloudRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	b, _ := json.Marshal(bitbucketBuildStatus(status))
+	response, body, err := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/commit/%s/statuses/build", commitId), nil),
+		http.MethodPost, bitbucket.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
+
+// bitbucketCloneUrls 返回 clone 链接中的 http 及 ssh 地址，cloud 的 http 链接名称为 https，server 为 http
+func bitbucketCloneUrls(links []bitbucketLink) (httpUrl string, sshUrl string) {
+	for _, link := range links {
+		switch link.Name {
+		case "https", "http":
+			httpUrl = link.Href
+		case "ssh":
+			sshUrl = link.Href
+		}
+	}
+	return httpUrl, sshUrl
+}
+
+// bitbucketHookId cloud 的 webhook id 为 uuid，转换为整数 id
+func bitbucketHookId(uuid string) int {
+	return int(crc32.ChecksumIEEE([]byte(uuid)) & 0x7fffffff)
+}
+
+// bitbucketBuildStatus 返回 commit 状态对应的 build status 参数，key 长度有限制，使用 context 的 md5 值
+func bitbucketBuildStatus(status CommitStatus) map[string]string {
+	state := "INPROGRESS"
+	switch status.State {
+	case CommitStatusSuccess:
+		state = "SUCCESSFUL"
+	case CommitStatusFailure:
+		state = "FAILED"
+	}
+	return map[string]string{
+		"key":         utils.Md5String(status.Context),
+		"name":        status.Context,
+		"state":       state,
+		"url":         status.TargetUrl,
+		"description": status.Description,
+	}
+}
+
+func bitbucketRespErr(response *http.Response, body []byte) error {
+	if response.StatusCode == http.StatusNotFound {
+		return e.New(e.ObjectNotExists, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	if response.StatusCode >= 300 {
+		return e.New(e.VcsError, fmt.Errorf("%s: %s", response.Status, body))
+	}
+	return nil
+}
+
+// bitbucketRequest
+// param path : bitbucket api路径
+// param method 请求方式
+func bitbucketRequest(path, method, token string, requestBody []byte) (*http.Response, []byte, error) {
+	vcsToken, err := GetVcsToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	request, er := http.NewRequest(method, path, bytes.NewBuffer(requestBody))
+	if er != nil {
+		return nil, nil, er
+	}
+	client := &http.Client{}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", vcsToken))
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+
+	return response, body, nil
+}
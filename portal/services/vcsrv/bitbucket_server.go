@@ -0,0 +1,365 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	bitbucketServerApiRoute         = "/rest/api/1.0"
+	bitbucketServerBuildStatusRoute = "/rest/build-status/1.0"
+)
+
+type bitbucketServerVcs struct {
+	vcs *models.Vcs
+}
+
+type RepositoryBitbucketServer struct {
+	Id          int    `json:"id"`
+	Slug        string `json:"slug"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Project     struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Clone []bitbucketLink `json:"clone"`
+	} `json:"links"`
+
+	defaultBranch string
+}
+
+// FullName 仓库全名，格式为 {projectKey}/{repoSlug}，作为仓库 id 使用
+func (r *RepositoryBitbucketServer) FullName() string {
+	return fmt.Sprintf("%s/%s", r.Project.Key, r.Slug)
+}
+
+type bitbucketServerPage struct {
+	Size          int             `json:"size"`
+	Start         int             `json:"start"`
+	IsLastPage    bool            `json:"isLastPage"`
+	NextPageStart int             `json:"nextPageStart"`
+	Values        json.RawMessage `json:"values"`
+}
+
+func bitbucketServerUrl(address, path string, params url.Values) string {
+	return utils.GenQueryURL(address, bitbucketServerApiRoute+path, params)
+}
+
+func (bitbucket *bitbucketServerVcs) getPage(addr string) (*bitbucketServerPage, error) {
+	response, body, err := bitbucketRequest(addr, http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.BadRequest, err)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return nil, err
+	}
+	page := bitbucketServerPage{}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	return &page, nil
+}
+
+// listAll 按 nextPageStart 查询所有分页的数据
+func (bitbucket *bitbucketServerVcs) listAll(path string, params url.Values) ([]json.RawMessage, error) {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("limit", strconv.Itoa(bitbucketPageLimit))
+	values := make([]json.RawMessage, 0)
+	for start := 0; ; {
+		params.Set("start", strconv.Itoa(start))
+		page, err := bitbucket.getPage(bitbucketServerUrl(bitbucket.vcs.Address, path, params))
+		if err != nil {
+			return nil, err
+		}
+		items := make([]json.RawMessage, 0)
+		_ = json.Unmarshal(page.Values, &items)
+		values = append(values, items...)
+		if page.IsLastPage || len(items) == 0 {
+			return values, nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+func (bitbucket *bitbucketServerVcs) GetRepo(idOrPath string) (RepoIface, error) {
+	parts := strings.SplitN(idOrPath, "/", 2)
+	if len(parts) != 2 {
+		return nil, e.New(e.BadRequest, fmt.Errorf("invalid bitbucket repository '%s'", idOrPath))
+	}
+	repoPath := fmt.Sprintf("/projects/%s/repos/%s", parts[0], parts[1])
+	response, body, err := bitbucketRequest(bitbucketServerUrl(bitbucket.vcs.Address, repoPath, nil),
+		http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.BadRequest, err)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return nil, err
+	}
+	rep := RepositoryBitbucketServer{}
+	if err := json.Unmarshal(body, &rep); err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+
+	// 空仓库没有默认分支，此时忽略错误
+	response, body, err = bitbucketRequest(bitbucketServerUrl(bitbucket.vcs.Address, repoPath+"/default-branch", nil),
+		http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if err == nil && response.StatusCode < 300 {
+		branch := struct {
+			DisplayId string `json:"displayId"`
+		}{}
+		_ = json.Unmarshal(body, &branch)
+		rep.defaultBranch = branch.DisplayId
+	}
+
+	return &bitbucketServerRepoIface{
+		bitbucketServerVcs: bitbucket,
+		repository:         &rep,
+	}, nil
+}
+
+// ListRepos bitbucket server 的分页接口不返回总数，未到最后一页时总数加一以便继续翻页
+func (bitbucket *bitbucketServerVcs) ListRepos(namespace, search string, limit, offset int) ([]RepoIface, int64, error) {
+	if limit <= 0 {
+		limit = bitbucketPageLimit
+	}
+	urlParam := url.Values{}
+	urlParam.Set("start", strconv.Itoa(offset))
+	urlParam.Set("limit", strconv.Itoa(limit))
+	if search != "" {
+		urlParam.Set("name", search)
+	}
+	repoPath := "/repos"
+	if namespace != "" {
+		repoPath = fmt.Sprintf("/projects/%s/repos", namespace)
+	}
+	page, err := bitbucket.getPage(bitbucketServerUrl(bitbucket.vcs.Address, repoPath, urlParam))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rep := make([]*RepositoryBitbucketServer, 0)
+	_ = json.Unmarshal(page.Values, &rep)
+	repoList := make([]RepoIface, 0, len(rep))
+	for _, v := range rep {
+		repoList = append(repoList, &bitbucketServerRepoIface{
+			bitbucketServerVcs: bitbucket,
+			repository:         v,
+		})
+	}
+	total := int64(offset + len(rep))
+	if !page.IsLastPage {
+		total++
+	}
+	return repoList, total, nil
+}
+
+func (bitbucket *bitbucketServerVcs) UserInfo() (UserInfo, error) {
+	return UserInfo{}, nil
+}
+
+type bitbucketServerRepoIface struct {
+	*bitbucketServerVcs
+	repository *RepositoryBitbucketServer
+}
+
+func (bitbucket *bitbucketServerRepoIface) repoPath(subPath string) string {
+	return fmt.Sprintf("/projects/%s/repos/%s%s", bitbucket.repository.Project.Key, bitbucket.repository.Slug, subPath)
+}
+
+func (bitbucket *bitbucketServerRepoIface) repoUrl(subPath string, params url.Values) string {
+	return bitbucketServerUrl(bitbucket.vcs.Address, bitbucket.repoPath(subPath), params)
+}
+
+// listRefNames 列出分支或 tag，filterText 不为空时只返回名称包含 filterText 的分支或 tag
+func (bitbucket *bitbucketServerRepoIface) listRefNames(refType, filterText string) ([]string, error) {
+	var urlParam url.Values
+	if filterText != "" {
+		urlParam = url.Values{}
+		urlParam.Set("filterText", filterText)
+	}
+	values, err := bitbucket.listAll(bitbucket.repoPath("/"+refType), urlParam)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		ref := struct {
+			DisplayId string `json:"displayId"`
+		}{}
+		_ = json.Unmarshal(v, &ref)
+		names = append(names, ref.DisplayId)
+	}
+	return names, nil
+}
+
+func (bitbucket *bitbucketServerRepoIface) ListBranches() ([]string, error) {
+	return bitbucket.listRefNames("branches", "")
+}
+
+func (bitbucket *bitbucketServerRepoIface) ListTags() ([]string, error) {
+	return bitbucket.listRefNames("tags", "")
+}
+
+// SearchRevisions 在服务端按名称过滤分支及 tag，bitbucket server 分页结果不包含总数，过滤后在本地分页
+func (bitbucket *bitbucketServerRepoIface) SearchRevisions(revType, search string, limit, offset int) ([]string, int64, error) {
+	refType, err := bitbucketRefType(revType)
+	if err != nil {
+		return nil, 0, err
+	}
+	names, err := bitbucket.listRefNames(refType, search)
+	if err != nil {
+		return nil, 0, err
+	}
+	return pageRevisions(names, limit, offset), int64(len(names)), nil
+}
+
+// BranchCommitId 查询分支最新的 commit，until 参数支持分支、tag 及 commit id
+func (bitbucket *bitbucketServerRepoIface) BranchCommitId(branch string) (string, error) {
+	urlParam := url.Values{}
+	urlParam.Set("until", branch)
+	urlParam.Set("limit", "1")
+	page, err := bitbucket.getPage(bitbucket.repoUrl("/commits", urlParam))
+	if err != nil {
+		return "", err
+	}
+	commits := make([]struct {
+		Id string `json:"id"`
+	}, 0)
+	_ = json.Unmarshal(page.Values, &commits)
+	if len(commits) == 0 || commits[0].Id == "" {
+		return "", e.New(e.VcsError, fmt.Errorf("query commit id failed"))
+	}
+	return commits[0].Id, nil
+}
+
+// ListFiles files 接口返回目录下所有文件(包含子目录)相对于该目录的路径
+func (bitbucket *bitbucketServerRepoIface) ListFiles(option VcsIfaceOptions) ([]string, error) {
+	urlParam := url.Values{}
+	urlParam.Set("at", getBranch(bitbucket, option.Ref))
+	dir := strings.Trim(option.Path, "/")
+	filesPath := "/files"
+	if dir != "" {
+		filesPath = fmt.Sprintf("/files/%s", dir)
+	}
+	values, err := bitbucket.listAll(bitbucket.repoPath(filesPath), urlParam)
+	if err != nil {
+		return []string{}, err
+	}
+
+	resp := make([]string, 0)
+	for _, v := range values {
+		var file string
+		_ = json.Unmarshal(v, &file)
+		if !option.Recursive && strings.Contains(file, "/") {
+			continue
+		}
+		if matchGlob(option.Search, path.Base(file)) {
+			resp = append(resp, path.Join(dir, file))
+		}
+		if option.Limit > 0 && len(resp) >= option.Limit {
+			break
+		}
+	}
+	return resp, nil
+}
+
+func (bitbucket *bitbucketServerRepoIface) ReadFileContent(branch, path string) (content []byte, err error) {
+	urlParam := url.Values{}
+	urlParam.Set("at", branch)
+	response, body, er := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/raw/%s", path), urlParam),
+		http.MethodGet, bitbucket.vcs.VcsToken, nil)
+	if er != nil {
+		return nil, e.New(e.BadRequest, er)
+	}
+	if err := bitbucketRespErr(response, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+func (bitbucket *bitbucketServerRepoIface) FormatRepoSearch() (project *Projects, err e.Error) {
+	p := &Projects{
+		ID:            bitbucket.repository.FullName(),
+		Description:   bitbucket.repository.Description,
+		DefaultBranch: bitbucket.repository.defaultBranch,
+		Name:          bitbucket.repository.Name,
+		FullName:      bitbucket.repository.FullName(),
+	}
+	p.HTTPURLToRepo, p.SSHURLToRepo = bitbucketCloneUrls(bitbucket.repository.Links.Clone)
+	return p, nil
+}
+
+func (bitbucket *bitbucketServerRepoIface) DefaultBranch() string {
+	return bitbucket.repository.defaultBranch
+}
+
+func (bitbucket *bitbucketServerRepoIface) ListWebhook() ([]RepoHook, error) {
+	values, err := bitbucket.listAll(bitbucket.repoPath("/webhooks"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp := make([]RepoHook, 0, len(values))
+	for _, v := range values {
+		hook := RepoHook{}
+		_ = json.Unmarshal(v, &hook)
+		resp = append(resp, hook)
+	}
+	return resp, nil
+}
+
+func (bitbucket *bitbucketServerRepoIface) DeleteWebhook(id int) error {
+	response, body, err := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/webhooks/%d", id), nil),
+		http.MethodDelete, bitbucket.vcs.VcsToken, nil)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
+
+func (bitbucket *bitbucketServerRepoIface) AddWebhook(url string) error {
+	b, _ := json.Marshal(map[string]interface{}{
+		"name":          "cloudiac",
+		"url":           url,
+		"active":        true,
+		"events":        bitbucketServerHookEvents,
+		"configuration": map[string]string{},
+	})
+	response, body, err := bitbucketRequest(bitbucket.repoUrl("/webhooks", nil), http.MethodPost, bitbucket.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
+
+func (bitbucket *bitbucketServerRepoIface) CreatePrComment(prId int, comment string) error {
+	b, _ := json.Marshal(map[string]string{"text": comment})
+	response, body, err := bitbucketRequest(bitbucket.repoUrl(fmt.Sprintf("/pull-requests/%d/comments", prId), nil),
+		http.MethodPost, bitbucket.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
+
+func (bitbucket *bitbucketServerRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	b, _ := json.Marshal(bitbucketBuildStatus(status))
+	addr := utils.GenQueryURL(bitbucket.vcs.Address, fmt.Sprintf("%s/commits/%s", bitbucketServerBuildStatusRoute, commitId), nil)
+	response, body, err := bitbucketRequest(addr, http.MethodPost, bitbucket.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return bitbucketRespErr(response, body)
+}
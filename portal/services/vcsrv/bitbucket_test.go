@@ -0,0 +1,29 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsBitbucketCloud(t *testing.T) {
+	assert.True(t, isBitbucketCloud("https://bitbucket.org"))
+	assert.True(t, isBitbucketCloud("https://api.bitbucket.org/2.0"))
+	assert.False(t, isBitbucketCloud("https://bitbucket.example.com"))
+}
+
+func TestBitbucketBuildStatus(t *testing.T) {
+	cases := map[string]string{
+		CommitStatusPending: "INPROGRESS",
+		CommitStatusSuccess: "SUCCESSFUL",
+		CommitStatusFailure: "FAILED",
+	}
+	for state, expect := range cases {
+		status := bitbucketBuildStatus(CommitStatus{State: state, Context: "cloudiac/plan/dev"})
+		assert.Equal(t, expect, status["state"])
+		assert.Equal(t, "cloudiac/plan/dev", status["name"])
+		assert.Len(t, status["key"], 32)
+	}
+}
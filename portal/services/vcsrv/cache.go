@@ -0,0 +1,326 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"cloudiac/utils/logs"
+	"cloudiac/utils/rdb"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	vcsCacheKeyPrefix  = "cloudiac:vcs:"
+	vcsCacheDefaultTTL = 60 * time.Second
+	// 超过该大小的文件内容不缓存
+	vcsCacheMaxFileSize = 256 * 1024
+	// 内存缓存的最大条目数，超出时清理过期条目，仍超出时清空
+	vcsCacheMaxEntries = 10000
+)
+
+// vcsCacheStore 缓存存储，配置了 redis 时使用 redis 在实例间共享，否则使用实例内存
+type vcsCacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	DeletePrefix(prefix string)
+}
+
+type memoryCacheItem struct {
+	value    []byte
+	expireAt time.Time
+}
+
+type memoryCacheStore struct {
+	lock  sync.Mutex
+	items map[string]memoryCacheItem
+}
+
+func (m *memoryCacheStore) Get(key string) ([]byte, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	item, ok := m.items[key]
+	if !ok || time.Now().After(item.expireAt) {
+		return nil, false
+	}
+	return item.value, true
+}
+
+func (m *memoryCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if len(m.items) >= vcsCacheMaxEntries {
+		now := time.Now()
+		for k, item := range m.items {
+			if now.After(item.expireAt) {
+				delete(m.items, k)
+			}
+		}
+		if len(m.items) >= vcsCacheMaxEntries {
+			m.items = make(map[string]memoryCacheItem)
+		}
+	}
+	m.items[key] = memoryCacheItem{value: value, expireAt: time.Now().Add(ttl)}
+}
+
+func (m *memoryCacheStore) DeletePrefix(prefix string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for k := range m.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.items, k)
+		}
+	}
+}
+
+type redisCacheStore struct {
+	client *redis.Client
+}
+
+func (r *redisCacheStore) Get(key string) ([]byte, bool) {
+	value, err := r.client.Get(context.Background(), key).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logs.Get().Warnf("get vcs cache %s: %v", key, err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (r *redisCacheStore) Set(key string, value []byte, ttl time.Duration) {
+	if err := r.client.Set(context.Background(), key, value, ttl).Err(); err != nil {
+		logs.Get().Warnf("set vcs cache %s: %v", key, err)
+	}
+}
+
+func (r *redisCacheStore) DeletePrefix(prefix string) {
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	keys := make([]string, 0)
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		logs.Get().Warnf("scan vcs cache %s: %v", prefix, err)
+	}
+	if len(keys) > 0 {
+		if err := r.client.Del(ctx, keys...).Err(); err != nil {
+			logs.Get().Warnf("delete vcs cache %s: %v", prefix, err)
+		}
+	}
+}
+
+var (
+	memoryCache = &memoryCacheStore{items: make(map[string]memoryCacheItem)}
+)
+
+// getVcsCache 返回缓存存储，未开启缓存时返回 nil
+func getVcsCache() (vcsCacheStore, time.Duration) {
+	conf := configs.Get()
+	if conf == nil || conf.VcsCache.Disabled {
+		return nil, 0
+	}
+	ttl := vcsCacheDefaultTTL
+	if conf.VcsCache.TTL > 0 {
+		ttl = time.Duration(conf.VcsCache.TTL) * time.Second
+	}
+	if client := rdb.Get(); client != nil {
+		return &redisCacheStore{client: client}, ttl
+	}
+	return memoryCache, ttl
+}
+
+func vcsCachePrefix(vcsId models.Id, repoId string) string {
+	if repoId == "" {
+		return fmt.Sprintf("%s%s:", vcsCacheKeyPrefix, vcsId)
+	}
+	return fmt.Sprintf("%s%s:repo:%s:", vcsCacheKeyPrefix, vcsId, repoId)
+}
+
+// InvalidateVcsCache 清除 vcs 的缓存，repoId 不为空时只清除该仓库的缓存
+func InvalidateVcsCache(vcsId models.Id, repoId string) {
+	if store, _ := getVcsCache(); store != nil {
+		store.DeletePrefix(vcsCachePrefix(vcsId, repoId))
+	}
+}
+
+// loadWithCache 缓存存在时将缓存数据解析到 out，否则调用 load 加载数据并写入缓存。load 返回的数据需要与 out 类型一致
+func loadWithCache(key string, out interface{}, load func() (interface{}, error)) error {
+	store, ttl := getVcsCache()
+	if store != nil {
+		if value, ok := store.Get(key); ok && json.Unmarshal(value, out) == nil {
+			return nil
+		}
+	}
+
+	data, err := load()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		store.Set(key, value, ttl)
+	}
+	return json.Unmarshal(value, out)
+}
+
+// cachedVcsIface 缓存 GetRepo 返回的仓库的分支、tag 及文件数据，其他接口直接调用
+type cachedVcsIface struct {
+	VcsIface
+	vcs *models.Vcs
+}
+
+func (c *cachedVcsIface) GetRepo(idOrPath string) (RepoIface, error) {
+	repo, err := c.VcsIface.GetRepo(idOrPath)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedRepoIface{RepoIface: repo, prefix: vcsCachePrefix(c.vcs.Id, idOrPath)}, nil
+}
+
+// cachedRepoIface 缓存仓库的分支、tag 列表及文件数据。
+// BranchCommitId 用于确定部署的 commit，webhook 及 PR 相关接口有副作用，均不缓存
+type cachedRepoIface struct {
+	RepoIface
+	prefix string
+}
+
+func (c *cachedRepoIface) ListBranches() ([]string, error) {
+	branches := make([]string, 0)
+	err := loadWithCache(c.prefix+"branches", &branches, func() (interface{}, error) {
+		return c.RepoIface.ListBranches()
+	})
+	return branches, err
+}
+
+func (c *cachedRepoIface) ListTags() ([]string, error) {
+	tags := make([]string, 0)
+	err := loadWithCache(c.prefix+"tags", &tags, func() (interface{}, error) {
+		return c.RepoIface.ListTags()
+	})
+	return tags, err
+}
+
+type revisionsPage struct {
+	Revisions []string `json:"revisions"`
+	Total     int64    `json:"total"`
+}
+
+// SearchRevisions 仓库支持服务端过滤时缓存每次查询的分页结果，否则基于缓存的分支、tag 列表过滤
+func (c *cachedRepoIface) SearchRevisions(revType, search string, limit, offset int) ([]string, int64, error) {
+	s, ok := c.RepoIface.(RevisionSearcher)
+	if !ok {
+		return searchRevisionsLocal(c, revType, search, limit, offset)
+	}
+	result := revisionsPage{}
+	key := fmt.Sprintf("%srevisions:%s:%s:%d:%d", c.prefix, revType, search, limit, offset)
+	err := loadWithCache(key, &result, func() (interface{}, error) {
+		revisions, total, err := s.SearchRevisions(revType, search, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		return revisionsPage{Revisions: revisions, Total: total}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result.Revisions, result.Total, nil
+}
+
+func (c *cachedRepoIface) ListFiles(option VcsIfaceOptions) ([]string, error) {
+	files := make([]string, 0)
+	key := fmt.Sprintf("%sfiles:%s:%s:%s:%v:%d:%d", c.prefix, option.Ref, option.Path, option.Search,
+		option.Recursive, option.Limit, option.Offset)
+	err := loadWithCache(key, &files, func() (interface{}, error) {
+		return c.RepoIface.ListFiles(option)
+	})
+	return files, err
+}
+
+func (c *cachedRepoIface) ListTree(ref, dir string) ([]TreeEntry, error) {
+	entries := make([]TreeEntry, 0)
+	err := loadWithCache(fmt.Sprintf("%stree:%s:%s", c.prefix, ref, dir), &entries, func() (interface{}, error) {
+		return ListTree(c.RepoIface, ref, dir)
+	})
+	return entries, err
+}
+
+// cachedFile 文件内容缓存，同时缓存文件不存在的结果(云模板检查等场景会频繁检查文件是否存在)
+type cachedFile struct {
+	Content  []byte `json:"content"`
+	NotFound bool   `json:"notFound"`
+}
+
+func (c *cachedRepoIface) ReadFileContent(branch, path string) ([]byte, error) {
+	key := fmt.Sprintf("%sfile:%s:%s", c.prefix, branch, path)
+	store, ttl := getVcsCache()
+	if store != nil {
+		if value, ok := store.Get(key); ok {
+			file := cachedFile{}
+			if json.Unmarshal(value, &file) == nil {
+				if file.NotFound {
+					return nil, e.New(e.ObjectNotExists, fmt.Errorf("file '%s' not found", path))
+				}
+				return file.Content, nil
+			}
+		}
+	}
+
+	content, err := c.RepoIface.ReadFileContent(branch, path)
+	if err != nil && !IsNotFoundErr(err) {
+		return nil, err
+	}
+	if store != nil && len(content) <= vcsCacheMaxFileSize {
+		if value, er := json.Marshal(cachedFile{Content: content, NotFound: err != nil}); er == nil {
+			store.Set(key, value, ttl)
+		}
+	}
+	return content, err
+}
+
+type repoProjectsPage struct {
+	Projects []*Projects `json:"projects"`
+	Total    int64       `json:"total"`
+}
+
+// ListRepoProjects 列出 vcs 的仓库并格式化为前端需要的内容，结果会被缓存。
+// OAuth 认证时不同用户可访问的仓库不同，缓存按授权用户区分
+func ListRepoProjects(vcs *models.Vcs, search string, limit, offset int) ([]*Projects, int64, error) {
+	key := fmt.Sprintf("%srepos:%s:%s:%d:%d", vcsCachePrefix(vcs.Id, ""), vcs.OauthUserId, search, limit, offset)
+	result := repoProjectsPage{}
+	err := loadWithCache(key, &result, func() (interface{}, error) {
+		vcsService, err := GetVcsInstance(vcs)
+		if err != nil {
+			return nil, err
+		}
+		repos, total, err := vcsService.ListRepos("", search, limit, offset)
+		if err != nil {
+			return nil, err
+		}
+		projects := make([]*Projects, 0, len(repos))
+		for _, repo := range repos {
+			proj, err := repo.FormatRepoSearch()
+			if err != nil {
+				return nil, err
+			}
+			projects = append(projects, proj)
+		}
+		return repoProjectsPage{Projects: projects, Total: total}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return result.Projects, result.Total, nil
+}
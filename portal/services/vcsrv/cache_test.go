@@ -0,0 +1,38 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCacheStore(t *testing.T) {
+	store := &memoryCacheStore{items: make(map[string]memoryCacheItem)}
+	repoPrefix := vcsCachePrefix("vcs-1", "10")
+	store.Set(repoPrefix+"branches", []byte(`["master"]`), time.Minute)
+	store.Set(vcsCachePrefix("vcs-1", "")+"repos", []byte(`[]`), time.Minute)
+	store.Set(vcsCachePrefix("vcs-2", "10")+"branches", []byte(`["main"]`), time.Minute)
+	store.Set(repoPrefix+"tags", []byte(`[]`), -time.Second)
+
+	value, ok := store.Get(repoPrefix + "branches")
+	assert.True(t, ok)
+	assert.Equal(t, `["master"]`, string(value))
+	_, ok = store.Get(repoPrefix + "tags")
+	assert.False(t, ok, "expired")
+
+	// 清除仓库缓存不影响 vcs 级别及其他 vcs 的缓存
+	store.DeletePrefix(repoPrefix)
+	_, ok = store.Get(repoPrefix + "branches")
+	assert.False(t, ok)
+	_, ok = store.Get(vcsCachePrefix("vcs-1", "") + "repos")
+	assert.True(t, ok)
+
+	store.DeletePrefix(vcsCachePrefix("vcs-1", ""))
+	_, ok = store.Get(vcsCachePrefix("vcs-1", "") + "repos")
+	assert.False(t, ok)
+	_, ok = store.Get(vcsCachePrefix("vcs-2", "10") + "branches")
+	assert.True(t, ok)
+}
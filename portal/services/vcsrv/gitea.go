@@ -341,6 +341,24 @@ func (gitea *giteaRepoIface) CreatePrComment(prId int, comment string) error {
 	return nil
 }
 
+func (gitea *giteaRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	path := gitea.vcs.Address + giteaApiRoute + fmt.Sprintf("/repos/%s/statuses/%s", gitea.repository.FullName, commitId)
+	b, err := json.Marshal(map[string]string{
+		"state":       status.State,
+		"context":     status.Context,
+		"target_url":  status.TargetUrl,
+		"description": status.Description,
+	})
+	if err != nil {
+		return err
+	}
+	_, _, err = giteaRequest(path, http.MethodPost, gitea.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	return nil
+}
+
 //giteeRequest
 //param path : gitea api路径
 //param method 请求方式
@@ -385,3 +403,16 @@ func getGiteaUserMe(vcs *models.Vcs) (*giteaUser, error) {
 	_ = json.Unmarshal(body, user)
 	return user, nil
 }
+
+// ListTree 列出目录下的文件及子目录
+func (gitea *giteaRepoIface) ListTree(ref, dir string) ([]TreeEntry, error) {
+	urlParam := url.Values{}
+	urlParam.Set("ref", ref)
+	path := utils.GenQueryURL(gitea.vcs.Address,
+		giteaApiRoute+strings.TrimSuffix(fmt.Sprintf("/repos/%s/contents/%s", gitea.repository.FullName, dir), "/"), urlParam)
+	_, body, err := giteaRequest(path, "GET", gitea.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	return contentsTreeEntries(body)
+}
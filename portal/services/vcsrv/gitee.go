@@ -341,6 +341,11 @@ func (gitee *giteeRepoIface) CreatePrComment(prId int, comment string) error {
 	return nil
 }
 
+// SetCommitStatus gitee 不支持设置 commit 状态，结果只通过 PR 评论展示
+func (gitee *giteeRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	return nil
+}
+
 //giteeRequest
 //param path : gitea api路径
 //param method 请求方式
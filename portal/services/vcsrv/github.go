@@ -68,6 +68,10 @@ func (github *githubVcs) ListRepos(namespace, search string, limit, offset int)
 	urlParam.Set("page", strconv.Itoa(page))
 	urlParam.Set("per_page", strconv.Itoa(limit))
 
+	if github.vcs.AuthType == models.VcsAuthGithubApp {
+		return github.listInstallationRepos(urlParam)
+	}
+
 	if search != "" {
 		urlParam.Set("q", search)
 	}
@@ -111,6 +115,31 @@ func (github *githubVcs) ListRepos(namespace, search string, limit, offset int)
 	return repoList, int64(r.LastPage), nil
 }
 
+// listInstallationRepos 列出 GitHub App 安装可访问的仓库，安装 token 无法访问 /user/repos
+// doc: https://docs.github.com/en/rest/apps/installations#list-repositories-accessible-to-the-app-installation
+func (github *githubVcs) listInstallationRepos(urlParam url.Values) ([]RepoIface, int64, error) {
+	path := utils.GenQueryURL(github.vcs.Address, "/installation/repositories", urlParam)
+	_, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, 0, e.New(e.BadRequest, err)
+	}
+
+	rep := struct {
+		TotalCount   int64               `json:"total_count"`
+		Repositories []*RepositoryGithub `json:"repositories"`
+	}{}
+	_ = json.Unmarshal(body, &rep)
+	repoList := make([]RepoIface, 0)
+	for _, v := range rep.Repositories {
+		repoList = append(repoList, &githubRepoIface{
+			vcs:        github.vcs,
+			repository: v,
+			total:      int(rep.TotalCount),
+		})
+	}
+	return repoList, rep.TotalCount, nil
+}
+
 func (github *githubVcs) UserInfo() (UserInfo, error) {
 
 	return UserInfo{}, nil
@@ -122,47 +151,44 @@ type githubRepoIface struct {
 	total      int
 }
 
-type githubBranch struct {
+// githubRefPageSize 列出分支及 tag 时每页的数量(github 允许的最大值)
+const githubRefPageSize = 100
+
+type githubRef struct {
 	Name string `json:"name" form:"name" `
 }
 
-func (github *githubRepoIface) ListBranches() ([]string, error) {
-
-	path := utils.GenQueryURL(github.vcs.Address,
-		fmt.Sprintf("/repos/%s/branches", github.repository.FullName), nil)
-	_, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
-	if err != nil {
-		return nil, e.New(e.BadRequest, err)
-	}
-	rep := make([]githubBranch, 0)
+// listRefNames 分页查询全部分支或 tag，refType 为 branches 或 tags
+func (github *githubRepoIface) listRefNames(refType string) ([]string, error) {
+	names := []string{}
+	for page := 1; ; page++ {
+		urlParam := url.Values{}
+		urlParam.Set("per_page", strconv.Itoa(githubRefPageSize))
+		urlParam.Set("page", strconv.Itoa(page))
+		path := utils.GenQueryURL(github.vcs.Address,
+			fmt.Sprintf("/repos/%s/%s", github.repository.FullName, refType), urlParam)
+		_, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
+		if err != nil {
+			return nil, e.New(e.BadRequest, err)
+		}
+		rep := make([]githubRef, 0)
 
-	_ = json.Unmarshal(body, &rep)
-	branchList := []string{}
-	for _, v := range rep {
-		branchList = append(branchList, v.Name)
+		_ = json.Unmarshal(body, &rep)
+		for _, v := range rep {
+			names = append(names, v.Name)
+		}
+		if len(rep) < githubRefPageSize {
+			return names, nil
+		}
 	}
-	return branchList, nil
 }
 
-type githubTag struct {
-	Name string `json:"name" form:"name" `
+func (github *githubRepoIface) ListBranches() ([]string, error) {
+	return github.listRefNames("branches")
 }
 
 func (github *githubRepoIface) ListTags() ([]string, error) {
-	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/tags", github.repository.FullName), nil)
-	_, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
-	if err != nil {
-		return nil, e.New(e.BadRequest, err)
-	}
-	rep := make([]githubTag, 0)
-
-	_ = json.Unmarshal(body, &rep)
-	tagList := []string{}
-	for _, v := range rep {
-		tagList = append(tagList, v.Name)
-	}
-	return tagList, nil
-
+	return github.listRefNames("tags")
 }
 
 type githubCommit struct {
@@ -356,6 +382,28 @@ func (github *githubRepoIface) CreatePrComment(prId int, comment string) error {
 	return nil
 }
 
+//SetCommitStatus doc: https://docs.github.com/en/rest/commits/statuses#create-a-commit-status
+func (github *githubRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	path := utils.GenQueryURL(github.vcs.Address, fmt.Sprintf("/repos/%s/statuses/%s", github.repository.FullName, commitId), nil)
+	b, er := json.Marshal(map[string]string{
+		"state":       status.State,
+		"context":     status.Context,
+		"target_url":  status.TargetUrl,
+		"description": status.Description,
+	})
+	if er != nil {
+		return er
+	}
+	response, body, err := githubRequest(path, http.MethodPost, github.vcs.VcsToken, b)
+	if err != nil {
+		return e.New(e.BadRequest, err)
+	}
+	if response.StatusCode > 300 {
+		return e.New(e.VcsError, fmt.Errorf("code: %s, err: %s", response.Status, string(body)))
+	}
+	return nil
+}
+
 //giteaRequest
 //param path : gitea api路径
 //param method 请求方式
@@ -383,3 +431,16 @@ func githubRequest(path, method, token string, requestBody []byte) (*http.Respon
 	return response, body, nil
 
 }
+
+// ListTree 列出目录下的文件及子目录
+func (github *githubRepoIface) ListTree(ref, dir string) ([]TreeEntry, error) {
+	urlParam := url.Values{}
+	urlParam.Set("ref", ref)
+	path := utils.GenQueryURL(github.vcs.Address,
+		strings.TrimSuffix(fmt.Sprintf("/repos/%s/contents/%s", github.repository.FullName, dir), "/"), urlParam)
+	_, body, err := githubRequest(path, "GET", github.vcs.VcsToken, nil)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	return contentsTreeEntries(body)
+}
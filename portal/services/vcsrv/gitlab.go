@@ -15,7 +15,15 @@ import (
 )
 
 func newGitlabInstance(vcs *models.Vcs) (VcsIface, error) {
-	gitConn, err := GetGitConn(vcs.VcsToken, vcs.Address)
+	var (
+		gitConn *gitlab.Client
+		err     e.Error
+	)
+	if vcs.UseOauth() {
+		gitConn, err = GetGitOauthConn(vcs.VcsToken, vcs.Address)
+	} else {
+		gitConn, err = GetGitConn(vcs.VcsToken, vcs.Address)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -100,6 +108,54 @@ func (git *gitlabRepoIface) ListTags() ([]string, error) {
 	return tagList, nil
 }
 
+// SearchRevisions 使用 gitlab 的 search 参数在服务端过滤分支及 tag
+func (git *gitlabRepoIface) SearchRevisions(revType, search string, limit, offset int) ([]string, int64, error) {
+	listOpt := gitlab.ListOptions{
+		Page:    utils.LimitOffset2Page(limit, offset),
+		PerPage: limit,
+	}
+	var searchOpt *string
+	if search != "" {
+		searchOpt = gitlab.String(search)
+	}
+
+	names := make([]string, 0)
+	var (
+		resp *gitlab.Response
+		er   error
+	)
+	switch revType {
+	case RevisionTypeBranch:
+		var branches []*gitlab.Branch
+		branches, resp, er = git.gitConn.Branches.ListBranches(git.Project.ID,
+			&gitlab.ListBranchesOptions{ListOptions: listOpt, Search: searchOpt})
+		for _, b := range branches {
+			names = append(names, b.Name)
+		}
+	case RevisionTypeTag:
+		var tags []*gitlab.Tag
+		tags, resp, er = git.gitConn.Tags.ListTags(git.Project.ID,
+			&gitlab.ListTagsOptions{ListOptions: listOpt, Search: searchOpt})
+		for _, t := range tags {
+			names = append(names, t.Name)
+		}
+	default:
+		return nil, 0, e.New(e.BadParam, fmt.Errorf("unknown revision type: %s", revType))
+	}
+	if er != nil {
+		return nil, 0, e.New(e.VcsError, er)
+	}
+	// 数据量很大时 gitlab 不返回总数，此时按是否有下一页计算
+	total := int64(resp.TotalItems)
+	if total == 0 {
+		total = int64(offset + len(names))
+		if resp.NextPage > 0 {
+			total++
+		}
+	}
+	return names, total, nil
+}
+
 func (git *gitlabRepoIface) BranchCommitId(branch string) (string, error) {
 	lco := &gitlab.ListCommitsOptions{
 		RefName: gitlab.String(branch),
@@ -239,6 +295,33 @@ func (git *gitlabRepoIface) CreatePrComment(prId int, comment string) error {
 	return nil
 }
 
+func (git *gitlabRepoIface) SetCommitStatus(commitId string, status CommitStatus) error {
+	state := gitlab.BuildStateValue(status.State)
+	if status.State == CommitStatusFailure {
+		state = gitlab.Failed
+	}
+	_, _, err := git.gitConn.Commits.SetCommitStatus(git.Project.ID, commitId, &gitlab.SetCommitStatusOptions{
+		State:       state,
+		Name:        gitlab.String(status.Context),
+		TargetURL:   gitlab.String(status.TargetUrl),
+		Description: gitlab.String(status.Description),
+	})
+	return err
+}
+
+// GetGitOauthConn 使用 OAuth token 连接 gitlab
+func GetGitOauthConn(gitlabToken, gitlabUrl string) (*gitlab.Client, e.Error) {
+	token, err := GetVcsToken(gitlabToken)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	git, er := gitlab.NewOAuthClient(token, gitlab.WithBaseURL(gitlabUrl+"/api/v4"))
+	if er != nil {
+		return nil, e.New(e.JSONParseError, er)
+	}
+	return git, nil
+}
+
 func GetGitConn(gitlabToken, gitlabUrl string) (*gitlab.Client, e.Error) {
 	token, err := GetVcsToken(gitlabToken)
 	if err != nil {
@@ -250,3 +333,32 @@ func GetGitConn(gitlabToken, gitlabUrl string) (*gitlab.Client, e.Error) {
 	}
 	return git, nil
 }
+
+// ListTree 列出目录下的文件及子目录
+func (git *gitlabRepoIface) ListTree(ref, dir string) ([]TreeEntry, error) {
+	entries := make([]TreeEntry, 0)
+	lto := &gitlab.ListTreeOptions{
+		ListOptions: gitlab.ListOptions{Page: 1, PerPage: 100},
+		Ref:         gitlab.String(ref),
+		Path:        gitlab.String(dir),
+	}
+	for {
+		treeNode, resp, err := git.gitConn.Repositories.ListTree(git.Project.ID, lto)
+		if err != nil {
+			return nil, e.New(e.VcsError, err)
+		}
+		for _, i := range treeNode {
+			switch i.Type {
+			case "blob":
+				entries = append(entries, TreeEntry{Name: i.Name, Path: i.Path, Type: TreeEntryFile})
+			case "tree":
+				entries = append(entries, TreeEntry{Name: i.Name, Path: i.Path, Type: TreeEntryDir})
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		lto.Page = resp.NextPage
+	}
+	return entries, nil
+}
@@ -16,6 +16,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing/storer"
 
@@ -226,13 +227,16 @@ func (l *LocalRepo) ReadFileContent(revision string, path string) (content []byt
 }
 
 func (l *LocalRepo) FormatRepoSearch() (*Projects, e.Error) {
+	var lastActivityAt *time.Time
 	head, err := l.repo.Head()
-	if err != nil {
-		return nil, e.New(e.InternalError, err)
-	}
-
-	headCommit, err := l.repo.CommitObject(head.Hash())
-	if err != nil {
+	if err == nil {
+		headCommit, err := l.repo.CommitObject(head.Hash())
+		if err != nil {
+			return nil, e.New(e.InternalError, err)
+		}
+		lastActivityAt = &headCommit.Author.When
+	} else if err != plumbing.ErrReferenceNotFound {
+		// 新创建的仓库在第一次提交前默认分支不存在
 		return nil, e.New(e.InternalError, err)
 	}
 	httpUrl := fmt.Sprintf("%s/%s",
@@ -246,13 +250,20 @@ func (l *LocalRepo) FormatRepoSearch() (*Projects, e.Error) {
 		SSHURLToRepo:   "",
 		HTTPURLToRepo:  httpUrl,
 		Name:           strings.TrimSuffix(filepath.Base(l.path), ".git"),
-		LastActivityAt: &headCommit.Author.When,
+		LastActivityAt: lastActivityAt,
 		FullName:       strings.TrimSuffix(filepath.Base(l.path), ".git"),
 	}, nil
 }
 
 func (l *LocalRepo) DefaultBranch() string {
-	head, _ := l.repo.Head()
+	// 不解析 HEAD 指向的分支，第一次提交前也可以获取默认分支
+	head, err := l.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return ""
+	}
+	if head.Type() == plumbing.SymbolicReference {
+		return head.Target().Short()
+	}
 	return head.Name().Short()
 }
 
@@ -272,3 +283,7 @@ func (l *LocalRepo) CreatePrComment(prId int, comment string) error {
 
 	return nil
 }
+
+func (l *LocalRepo) SetCommitStatus(commitId string, status CommitStatus) error {
+	return nil
+}
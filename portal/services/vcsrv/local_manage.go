@@ -0,0 +1,473 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+/*
+本地 vcs 仓库管理: 创建仓库、通过上传压缩包提交代码及分支管理。
+本地仓库通过 http 静态文件服务提供 clone(dumb http 协议)，引用变更后需要更新 info/refs 等文件
+*/
+
+import (
+	"archive/zip"
+	"bytes"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/models"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/pkg/errors"
+)
+
+// 仓库名称，支持使用 / 分隔的多级目录，不需要 .git 后缀
+var localRepoNameRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*(/[A-Za-z0-9][A-Za-z0-9_.-]*)*$`)
+
+// 本地仓库的写操作串行执行，避免并发提交时分支引用被覆盖
+var localRepoLock sync.Mutex
+
+// LocalCommitOptions 通过压缩包提交代码的参数
+type LocalCommitOptions struct {
+	Branch      string // 提交的分支，分支不存在时创建
+	Message     string
+	Dir         string // 作为仓库根目录的压缩包内目录，为空时使用压缩包根目录
+	AuthorName  string
+	AuthorEmail string
+}
+
+// GetLocalVcs 返回本地 vcs 实例，vcs 不是本地类型时返回错误
+func GetLocalVcs(vcs *models.Vcs) (*LocalVcs, e.Error) {
+	if vcs.VcsType != consts.GitTypeLocal {
+		return nil, e.New(e.BadParam, fmt.Errorf("vcs type '%s' does not support repo management", vcs.VcsType),
+			http.StatusBadRequest)
+	}
+	return newLocalVcs(vcs.Address), nil
+}
+
+// GetLocalRepo 打开本地仓库，repoId 为 ListRepos 返回的仓库 ID
+func (l *LocalVcs) GetLocalRepo(repoId string) (*LocalRepo, e.Error) {
+	if repoId == "" || strings.Contains(repoId, "..") {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid repo id '%s'", repoId), http.StatusBadRequest)
+	}
+	repo, err := newLocalRepo(l.absPath, repoId)
+	if err != nil {
+		return nil, e.New(e.ObjectNotExists, err, http.StatusBadRequest)
+	}
+	return repo, nil
+}
+
+// CreateRepo 创建空的 bare 仓库，仓库在第一次提交后才有内容
+func (l *LocalVcs) CreateRepo(name string, defaultBranch string) (*LocalRepo, e.Error) {
+	name = strings.TrimSuffix(strings.Trim(name, "/"), ".git")
+	if !localRepoNameRegex.MatchString(name) || strings.Contains(name, "..") {
+		return nil, e.New(e.BadParam, fmt.Errorf("invalid repo name '%s'", name), http.StatusBadRequest)
+	}
+	if defaultBranch == "" {
+		defaultBranch = plumbing.Master.Short()
+	}
+	if err := checkBranchName(defaultBranch); err != nil {
+		return nil, err
+	}
+
+	localRepoLock.Lock()
+	defer localRepoLock.Unlock()
+
+	repoPath := "/" + name + ".git"
+	absPath := filepath.Join(l.absPath, repoPath)
+	if _, err := os.Stat(absPath); err == nil {
+		return nil, e.New(e.ObjectAlreadyExists, fmt.Errorf("repo '%s' already exists", name), http.StatusBadRequest)
+	}
+	repo, err := git.PlainInit(absPath, true)
+	if err != nil {
+		return nil, e.New(e.IOError, errors.Wrap(err, "init repo"))
+	}
+	head := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.NewBranchReferenceName(defaultBranch))
+	if err := repo.Storer.SetReference(head); err != nil {
+		return nil, e.New(e.IOError, errors.Wrap(err, "set default branch"))
+	}
+
+	localRepo := &LocalRepo{absPath: absPath, path: repoPath, repo: repo}
+	if err := localRepo.updateServerInfo(); err != nil {
+		return nil, e.New(e.IOError, err)
+	}
+	return localRepo, nil
+}
+
+// CommitArchive 将 zip 压缩包的内容作为分支的最新代码提交，返回提交的 commit id。
+// 提交的内容与分支当前代码相同时不创建新的提交
+func (l *LocalRepo) CommitArchive(archive []byte, opt LocalCommitOptions) (string, e.Error) {
+	if err := checkBranchName(opt.Branch); err != nil {
+		return "", err
+	}
+	files, err := readArchiveFiles(archive, opt.Dir)
+	if err != nil {
+		return "", err
+	}
+
+	localRepoLock.Lock()
+	defer localRepoLock.Unlock()
+
+	treeHash, er := l.writeTree(files)
+	if er != nil {
+		return "", e.New(e.IOError, errors.Wrap(er, "write tree"))
+	}
+
+	refName := plumbing.NewBranchReferenceName(opt.Branch)
+	oldRef, er := l.repo.Reference(refName, true)
+	if er != nil && er != plumbing.ErrReferenceNotFound {
+		return "", e.New(e.IOError, er)
+	}
+	parents := make([]plumbing.Hash, 0)
+	if oldRef != nil {
+		parent, er := l.repo.CommitObject(oldRef.Hash())
+		if er != nil {
+			return "", e.New(e.IOError, er)
+		}
+		if parent.TreeHash == treeHash {
+			return parent.Hash.String(), nil
+		}
+		parents = append(parents, parent.Hash)
+	}
+
+	sign := object.Signature{Name: opt.AuthorName, Email: opt.AuthorEmail, When: time.Now()}
+	commit := object.Commit{
+		Author:       sign,
+		Committer:    sign,
+		Message:      opt.Message,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	}
+	commitHash, er := l.storeObject(&commit)
+	if er != nil {
+		return "", e.New(e.IOError, errors.Wrap(er, "write commit"))
+	}
+	if er := l.repo.Storer.CheckAndSetReference(plumbing.NewHashReference(refName, commitHash), oldRef); er != nil {
+		return "", e.New(e.IOError, errors.Wrap(er, "update branch"))
+	}
+	if er := l.updateServerInfo(); er != nil {
+		return "", e.New(e.IOError, er)
+	}
+	return commitHash.String(), nil
+}
+
+// CreateBranch 基于分支、tag 或 commit 创建分支
+func (l *LocalRepo) CreateBranch(name string, from string) e.Error {
+	if err := checkBranchName(name); err != nil {
+		return err
+	}
+
+	localRepoLock.Lock()
+	defer localRepoLock.Unlock()
+
+	refName := plumbing.NewBranchReferenceName(name)
+	if _, err := l.repo.Reference(refName, false); err == nil {
+		return e.New(e.ObjectAlreadyExists, fmt.Errorf("branch '%s' already exists", name), http.StatusBadRequest)
+	}
+	hash, err := l.repo.ResolveRevision(plumbing.Revision(getBranch(l, from)))
+	if err != nil {
+		return e.New(e.BadParam, errors.Wrapf(err, "resolve revision '%s'", from), http.StatusBadRequest)
+	}
+	if err := l.repo.Storer.SetReference(plumbing.NewHashReference(refName, *hash)); err != nil {
+		return e.New(e.IOError, err)
+	}
+	if err := l.updateServerInfo(); err != nil {
+		return e.New(e.IOError, err)
+	}
+	return nil
+}
+
+// DeleteBranch 删除分支，不允许删除默认分支
+func (l *LocalRepo) DeleteBranch(name string) e.Error {
+	localRepoLock.Lock()
+	defer localRepoLock.Unlock()
+
+	if name == l.DefaultBranch() {
+		return e.New(e.BadParam, fmt.Errorf("can not delete default branch '%s'", name), http.StatusBadRequest)
+	}
+	refName := plumbing.NewBranchReferenceName(name)
+	if _, err := l.repo.Reference(refName, false); err != nil {
+		return e.New(e.ObjectNotExists, fmt.Errorf("branch '%s' not found", name), http.StatusBadRequest)
+	}
+	if err := l.repo.Storer.RemoveReference(refName); err != nil {
+		return e.New(e.IOError, err)
+	}
+	if err := l.updateServerInfo(); err != nil {
+		return e.New(e.IOError, err)
+	}
+	return nil
+}
+
+// SetDefaultBranch 设置仓库的默认分支
+func (l *LocalRepo) SetDefaultBranch(name string) e.Error {
+	localRepoLock.Lock()
+	defer localRepoLock.Unlock()
+
+	refName := plumbing.NewBranchReferenceName(name)
+	if _, err := l.repo.Reference(refName, false); err != nil {
+		return e.New(e.ObjectNotExists, fmt.Errorf("branch '%s' not found", name), http.StatusBadRequest)
+	}
+	if err := l.repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, refName)); err != nil {
+		return e.New(e.IOError, err)
+	}
+	return nil
+}
+
+func checkBranchName(name string) e.Error {
+	if name == "" || !plumbing.NewBranchReferenceName(name).IsBranch() ||
+		strings.ContainsAny(name, " ~^:?*[\\") || strings.Contains(name, "..") ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".lock") {
+		return e.New(e.BadParam, fmt.Errorf("invalid branch name '%s'", name), http.StatusBadRequest)
+	}
+	return nil
+}
+
+// archiveFile 压缩包中的文件，path 为相对仓库根目录的路径
+type archiveFile struct {
+	path    string
+	mode    filemode.FileMode
+	content []byte
+}
+
+// readArchiveFiles 读取 zip 压缩包中 dir 目录下的文件，忽略目录项及 .git 目录
+func readArchiveFiles(archive []byte, dir string) ([]archiveFile, e.Error) {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, e.New(e.BadParam, errors.Wrap(err, "invalid zip archive"), http.StatusBadRequest)
+	}
+
+	prefix := CleanTreePath(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	// 限制文件数量及解压后的大小，避免压缩炸弹占满内存
+	if len(reader.File) > consts.MaxLocalRepoArchiveFiles {
+		return nil, e.New(e.BadParam, fmt.Errorf("archive contains more than %d files", consts.MaxLocalRepoArchiveFiles),
+			http.StatusBadRequest)
+	}
+	remaining := int64(consts.MaxLocalRepoUnzipSize)
+	unzipSizeErr := e.New(e.BadParam, fmt.Errorf("archive uncompressed size exceeds %d bytes", consts.MaxLocalRepoUnzipSize),
+		http.StatusBadRequest)
+
+	files := make([]archiveFile, 0)
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean("/"+f.Name), "/")
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		name = strings.TrimPrefix(name, prefix)
+		if name == ".git" || strings.HasPrefix(name, ".git/") || strings.Contains(name, "/.git/") {
+			continue
+		}
+
+		mode := filemode.Regular
+		if f.Mode()&os.ModeSymlink != 0 {
+			mode = filemode.Symlink
+		} else if f.Mode()&0111 != 0 {
+			mode = filemode.Executable
+		}
+		if f.UncompressedSize64 > uint64(remaining) {
+			return nil, unzipSizeErr
+		}
+		content, err := readZipFile(f, remaining)
+		if err == errZipFileTooLarge {
+			return nil, unzipSizeErr
+		} else if err != nil {
+			return nil, e.New(e.BadParam, errors.Wrapf(err, "read file '%s'", f.Name), http.StatusBadRequest)
+		}
+		remaining -= int64(len(content))
+		files = append(files, archiveFile{path: name, mode: mode, content: content})
+	}
+	if len(files) == 0 {
+		return nil, e.New(e.BadParam, fmt.Errorf("no file found in archive dir '%s'", dir), http.StatusBadRequest)
+	}
+	if err := checkArchivePaths(files); err != nil {
+		return nil, e.New(e.BadParam, err, http.StatusBadRequest)
+	}
+	return files, nil
+}
+
+var errZipFileTooLarge = errors.New("zip file too large")
+
+// readZipFile 读取压缩包中的文件，内容超过 limit 时返回 errZipFileTooLarge(文件头中记录的大小可能不准确)
+func readZipFile(f *zip.File, limit int64) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, errZipFileTooLarge
+	}
+	return content, nil
+}
+
+// checkArchivePaths 检查压缩包中的文件路径，同一路径不能重复出现，也不能同时是文件和目录
+func checkArchivePaths(files []archiveFile) error {
+	paths := make(map[string]bool, len(files))
+	for _, f := range files {
+		if paths[f.path] {
+			return fmt.Errorf("duplicate file '%s' in archive", f.path)
+		}
+		paths[f.path] = true
+	}
+	for _, f := range files {
+		for dir := path.Dir(f.path); dir != "."; dir = path.Dir(dir) {
+			if paths[dir] {
+				return fmt.Errorf("'%s' is both a file and a directory in archive", dir)
+			}
+		}
+	}
+	return nil
+}
+
+// localTreeNode 构建 tree 对象时使用的目录节点
+type localTreeNode struct {
+	dirs  map[string]*localTreeNode
+	files map[string]object.TreeEntry
+}
+
+func newLocalTreeNode() *localTreeNode {
+	return &localTreeNode{dirs: make(map[string]*localTreeNode), files: make(map[string]object.TreeEntry)}
+}
+
+// writeTree 保存文件内容并逐级生成目录的 tree 对象，返回根目录 tree 的 hash
+func (l *LocalRepo) writeTree(files []archiveFile) (plumbing.Hash, error) {
+	root := newLocalTreeNode()
+	for _, f := range files {
+		blob := l.repo.Storer.NewEncodedObject()
+		blob.SetType(plumbing.BlobObject)
+		w, err := blob.Writer()
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if _, err := w.Write(f.content); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if err := w.Close(); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		hash, err := l.repo.Storer.SetEncodedObject(blob)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+
+		node := root
+		parts := strings.Split(f.path, "/")
+		for _, dir := range parts[:len(parts)-1] {
+			if _, ok := node.files[dir]; ok {
+				return plumbing.ZeroHash, fmt.Errorf("'%s' is both a file and a directory", dir)
+			}
+			if node.dirs[dir] == nil {
+				node.dirs[dir] = newLocalTreeNode()
+			}
+			node = node.dirs[dir]
+		}
+		name := parts[len(parts)-1]
+		if _, ok := node.dirs[name]; ok {
+			return plumbing.ZeroHash, fmt.Errorf("'%s' is both a file and a directory", f.path)
+		}
+		node.files[name] = object.TreeEntry{Name: name, Mode: f.mode, Hash: hash}
+	}
+	return l.writeTreeNode(root)
+}
+
+func (l *LocalRepo) writeTreeNode(node *localTreeNode) (plumbing.Hash, error) {
+	entries := make([]object.TreeEntry, 0, len(node.dirs)+len(node.files))
+	for name, child := range node.dirs {
+		hash, err := l.writeTreeNode(child)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		entries = append(entries, object.TreeEntry{Name: name, Mode: filemode.Dir, Hash: hash})
+	}
+	for _, entry := range node.files {
+		entries = append(entries, entry)
+	}
+	// git 要求 tree 的条目有序，比较时目录名称以 / 结尾
+	sortKey := func(entry object.TreeEntry) string {
+		if entry.Mode == filemode.Dir {
+			return entry.Name + "/"
+		}
+		return entry.Name
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return sortKey(entries[i]) < sortKey(entries[j])
+	})
+	return l.storeObject(&object.Tree{Entries: entries})
+}
+
+func (l *LocalRepo) storeObject(obj interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	encoded := l.repo.Storer.NewEncodedObject()
+	if err := obj.Encode(encoded); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return l.repo.Storer.SetEncodedObject(encoded)
+}
+
+// updateServerInfo 更新 dumb http 协议 clone 时需要的 info/refs 及 objects/info/packs 文件，
+// 作用同 git update-server-info
+func (l *LocalRepo) updateServerInfo() error {
+	refs, err := l.repo.Storer.IterReferences()
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0)
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Type() != plumbing.HashReference || ref.Name() == plumbing.HEAD {
+			return nil
+		}
+		lines = append(lines, fmt.Sprintf("%s\t%s\n", ref.Hash(), ref.Name()))
+		if tag, err := l.repo.TagObject(ref.Hash()); err == nil {
+			lines = append(lines, fmt.Sprintf("%s\t%s^{}\n", tag.Target, ref.Name()))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(lines)
+	if err := writeServerInfoFile(filepath.Join(l.absPath, "info", "refs"), strings.Join(lines, "")); err != nil {
+		return err
+	}
+
+	packs := ""
+	if packer, ok := l.repo.Storer.(storer.PackedObjectStorer); ok {
+		hashes, err := packer.ObjectPacks()
+		if err != nil {
+			return err
+		}
+		for _, h := range hashes {
+			packs += fmt.Sprintf("P pack-%s.pack\n", h)
+		}
+	}
+	return writeServerInfoFile(filepath.Join(l.absPath, "objects", "info", "packs"), packs+"\n")
+}
+
+func writeServerInfoFile(p string, content string) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(content), 0644) //nolint:gosec
+}
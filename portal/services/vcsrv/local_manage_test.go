@@ -0,0 +1,104 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	buf := bytes.Buffer{}
+	w := zip.NewWriter(&buf)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = fw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestLocalRepoManage(t *testing.T) {
+	vcs := newLocalVcs(t.TempDir())
+
+	repo, err := vcs.CreateRepo("demo/network", "main")
+	assert.NoError(t, err)
+	assert.Equal(t, "/demo/network.git", repo.path)
+	assert.Equal(t, "main", repo.DefaultBranch())
+	_, err = vcs.CreateRepo("demo/network.git", "")
+	assert.Error(t, err)
+	_, err = vcs.CreateRepo("../network", "")
+	assert.Error(t, err)
+
+	archive := zipArchive(t, map[string]string{
+		"network-main/main.tf":            "# main",
+		"network-main/modules/vpc/vpc.tf": "# vpc",
+		"network-main/.git/config":        "",
+	})
+	opt := LocalCommitOptions{Branch: "main", Message: "init", Dir: "network-main", AuthorName: "test"}
+	commitId, err := repo.CommitArchive(archive, opt)
+	assert.NoError(t, err)
+
+	// 内容未变更时不创建新的提交
+	sameCommitId, err := repo.CommitArchive(archive, opt)
+	assert.NoError(t, err)
+	assert.Equal(t, commitId, sameCommitId)
+
+	repo, err = vcs.GetLocalRepo("/demo/network.git")
+	assert.NoError(t, err)
+	files, er := repo.ListFiles(VcsIfaceOptions{Ref: "main", Recursive: true})
+	assert.NoError(t, er)
+	assert.ElementsMatch(t, []string{"main.tf", "modules/vpc/vpc.tf"}, files)
+	content, er := repo.ReadFileContent("main", "modules/vpc/vpc.tf")
+	assert.NoError(t, er)
+	assert.Equal(t, "# vpc", string(content))
+
+	assert.NoError(t, repo.CreateBranch("dev", ""))
+	assert.Error(t, repo.CreateBranch("dev", "main"))
+	assert.NoError(t, repo.SetDefaultBranch("dev"))
+	assert.Error(t, repo.DeleteBranch("dev"))
+	assert.NoError(t, repo.DeleteBranch("main"))
+	branches, er := repo.ListBranches()
+	assert.NoError(t, er)
+	assert.Equal(t, []string{"dev"}, branches)
+
+	refs, er := os.ReadFile(filepath.Join(repo.absPath, "info", "refs"))
+	assert.NoError(t, er)
+	assert.Equal(t, commitId+"\trefs/heads/dev\n", string(refs))
+}
+
+func TestCheckBranchName(t *testing.T) {
+	for _, name := range []string{"main", "release/v1.0", "feature_a"} {
+		assert.Nil(t, checkBranchName(name), name)
+	}
+	for _, name := range []string{"", "a..b", "a b", "/a", "a/", "a.lock", strings.Repeat("x~", 2)} {
+		assert.NotNil(t, checkBranchName(name), name)
+	}
+}
+
+func TestReadArchiveFiles(t *testing.T) {
+	_, err := readArchiveFiles(zipArchive(t, map[string]string{
+		"network/main.tf":     "# main",
+		"network/modules":     "# file",
+		"network/modules/vpc": "# vpc",
+	}), "network")
+	assert.NotNil(t, err)
+	assert.Equal(t, 400, err.Status())
+
+	archive := zipArchive(t, map[string]string{"main.tf": strings.Repeat("#", 100)})
+	reader, er := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	assert.NoError(t, er)
+	_, er = readZipFile(reader.File[0], 99)
+	assert.Equal(t, errZipFileTooLarge, er)
+	content, er := readZipFile(reader.File[0], 100)
+	assert.NoError(t, er)
+	assert.Len(t, content, 100)
+}
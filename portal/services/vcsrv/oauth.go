@@ -0,0 +1,411 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"bytes"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// token 在过期前提前刷新，避免请求过程中过期
+	oauthTokenRefreshAhead = 5 * time.Minute
+	// GitHub App jwt 的有效期最长为 10 分钟
+	githubAppJwtExpire = 9 * time.Minute
+
+	// 使用 OAuth token clone 代码时的用户名
+	OauthCloneUserGitlab = "oauth2"
+	OauthCloneUserGithub = "x-access-token"
+)
+
+var (
+	// GitHub App 安装 token 缓存，key 为 {vcsId}/{installationId}
+	githubAppTokens sync.Map
+	// 刷新 token 时加锁，gitlab 刷新后旧的 refresh token 立即失效，避免并发刷新
+	oauthRefreshLock sync.Mutex
+)
+
+// OauthToken OAuth 授权或 GitHub App 安装得到的 token
+type OauthToken struct {
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time // 零值表示不过期
+	Login        string    // 授权用户在代码仓库中的登录名
+}
+
+// SupportOauth 是否支持 OAuth 认证
+func SupportOauth(vcsType string) bool {
+	return vcsType == models.VcsGitlab || vcsType == models.VcsGithub
+}
+
+// OauthCloneUser 使用 OAuth 认证时 clone 代码的用户名
+func OauthCloneUser(vcs *models.Vcs) string {
+	if vcs.VcsType == models.VcsGitlab {
+		return OauthCloneUserGitlab
+	}
+	return OauthCloneUserGithub
+}
+
+// githubWebAddress 返回 github api 地址对应的网页地址，
+// github.com 的 api 地址为 api.github.com，GitHub Enterprise 的 api 地址为 {host}/api/v3
+func githubWebAddress(apiAddress string) string {
+	address := utils.GetUrl(apiAddress)
+	u, err := url.Parse(address)
+	if err != nil {
+		return address
+	}
+	if strings.EqualFold(u.Host, "api.github.com") {
+		return "https://github.com"
+	}
+	return strings.TrimSuffix(address, "/api/v3")
+}
+
+func oauthConfig(vcs *models.Vcs, redirectUri string) (*oauth2.Config, error) {
+	secret, err := utils.DecryptSecretVar(vcs.OauthClientSecret)
+	if err != nil {
+		return nil, e.New(e.VcsAuthInvalid, err)
+	}
+	conf := &oauth2.Config{
+		ClientID:     vcs.OauthClientId,
+		ClientSecret: secret,
+		RedirectURL:  redirectUri,
+	}
+	switch vcs.VcsType {
+	case models.VcsGitlab:
+		address := utils.GetUrl(vcs.Address)
+		conf.Endpoint = oauth2.Endpoint{AuthURL: address + "/oauth/authorize", TokenURL: address + "/oauth/token"}
+		conf.Scopes = []string{"api", "read_user"}
+	case models.VcsGithub:
+		address := githubWebAddress(vcs.Address)
+		conf.Endpoint = oauth2.Endpoint{AuthURL: address + "/login/oauth/authorize", TokenURL: address + "/login/oauth/access_token"}
+		// GitHub App 的权限由 app 的配置决定，OAuth App 需要申请仓库及 webhook 权限
+		if vcs.AuthType == models.VcsAuthOauth {
+			conf.Scopes = []string{"repo", "admin:repo_hook"}
+		}
+	default:
+		return nil, e.New(e.VcsAuthInvalid, fmt.Errorf("vcs type '%s' does not support oauth", vcs.VcsType))
+	}
+	return conf, nil
+}
+
+// OauthAuthorizeUrl 返回用户授权页面地址，用户授权后跳转到 redirectUri 并带上 code 及 state 参数
+func OauthAuthorizeUrl(vcs *models.Vcs, redirectUri, state string) (string, error) {
+	conf, err := oauthConfig(vcs, redirectUri)
+	if err != nil {
+		return "", err
+	}
+	return conf.AuthCodeURL(state), nil
+}
+
+// ExchangeOauthCode 使用授权回调的 code 换取 token
+func ExchangeOauthCode(vcs *models.Vcs, redirectUri, code string) (*OauthToken, error) {
+	conf, err := oauthConfig(vcs, redirectUri)
+	if err != nil {
+		return nil, err
+	}
+	token, err := conf.Exchange(context.Background(), code)
+	if err != nil {
+		return nil, e.New(e.VcsUnauthorized, err)
+	}
+	login, err := oauthUserLogin(vcs, token.AccessToken)
+	if err != nil {
+		return nil, e.New(e.VcsUnauthorized, err)
+	}
+	return &OauthToken{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Expiry:       token.Expiry,
+		Login:        login,
+	}, nil
+}
+
+// oauthUserLogin 查询 token 对应的用户登录名
+func oauthUserLogin(vcs *models.Vcs, accessToken string) (string, error) {
+	var path, auth string
+	if vcs.VcsType == models.VcsGitlab {
+		path = utils.GenQueryURL(vcs.Address, "/api/v4/user", nil)
+		auth = fmt.Sprintf("Bearer %s", accessToken)
+	} else {
+		path = utils.GenQueryURL(vcs.Address, "/user", nil)
+		auth = fmt.Sprintf("token %s", accessToken)
+	}
+	request, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Authorization", auth)
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode >= 300 {
+		return "", fmt.Errorf("%s: %s", response.Status, body)
+	}
+
+	user := struct {
+		Login    string `json:"login"`    // github
+		Username string `json:"username"` // gitlab
+	}{}
+	if err := json.Unmarshal(body, &user); err != nil {
+		return "", err
+	}
+	if user.Username != "" {
+		return user.Username, nil
+	}
+	return user.Login, nil
+}
+
+// GithubUserHasInstallation 判断授权用户是否可以访问 GitHub App 的安装，
+// 回调参数中的 installation_id 可以被篡改，需要使用用户的 token 确认
+// doc: https://docs.github.com/en/rest/apps/installations#list-app-installations-accessible-to-the-user-access-token
+func GithubUserHasInstallation(vcs *models.Vcs, accessToken string, installationId int64) (bool, error) {
+	for page := 1; ; page++ {
+		path := utils.GenQueryURL(vcs.Address, "/user/installations",
+			url.Values{"per_page": []string{"100"}, "page": []string{strconv.Itoa(page)}})
+		request, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return false, err
+		}
+		request.Header.Set("Accept", "application/vnd.github.v3+json")
+		request.Header.Set("Authorization", fmt.Sprintf("token %s", accessToken))
+		response, err := (&http.Client{}).Do(request)
+		if err != nil {
+			return false, e.New(e.VcsConnectError, err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		_ = response.Body.Close()
+		if response.StatusCode >= 300 {
+			return false, e.New(e.VcsUnauthorized, fmt.Errorf("%s: %s", response.Status, body))
+		}
+
+		resp := struct {
+			Installations []struct {
+				Id int64 `json:"id"`
+			} `json:"installations"`
+		}{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return false, e.New(e.VcsError, err)
+		}
+		for _, inst := range resp.Installations {
+			if inst.Id == installationId {
+				return true, nil
+			}
+		}
+		if len(resp.Installations) < 100 {
+			return false, nil
+		}
+	}
+}
+
+// RefreshOauthToken 使用 refresh token 刷新 token
+func RefreshOauthToken(vcs *models.Vcs, refreshToken string) (*OauthToken, error) {
+	conf, err := oauthConfig(vcs, "")
+	if err != nil {
+		return nil, err
+	}
+	// 设置已过期的 token，强制 token source 刷新
+	expired := &oauth2.Token{RefreshToken: refreshToken, Expiry: time.Now().Add(-time.Minute)}
+	token, err := conf.TokenSource(context.Background(), expired).Token()
+	if err != nil {
+		return nil, e.New(e.VcsUnauthorized, err)
+	}
+	return &OauthToken{AccessToken: token.AccessToken, RefreshToken: token.RefreshToken, Expiry: token.Expiry}, nil
+}
+
+// GithubAppInstallationToken 获取 GitHub App 安装的访问 token，token 有效期为 1 小时，过期前使用缓存
+// doc: https://docs.github.com/en/rest/apps/apps#create-an-installation-access-token-for-an-app
+func GithubAppInstallationToken(vcs *models.Vcs) (string, error) {
+	cacheKey := fmt.Sprintf("%s/%d", vcs.Id, vcs.InstallationId)
+	if v, ok := githubAppTokens.Load(cacheKey); ok {
+		if token := v.(*OauthToken); time.Until(token.Expiry) > oauthTokenRefreshAhead {
+			return token.AccessToken, nil
+		}
+	}
+
+	pem, err := utils.DecryptSecretVar(vcs.GithubAppPrivateKey)
+	if err != nil {
+		return "", e.New(e.VcsAuthInvalid, err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(pem))
+	if err != nil {
+		return "", e.New(e.VcsAuthInvalid, err)
+	}
+	now := time.Now()
+	appJwt, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		IssuedAt:  now.Add(-time.Minute).Unix(), // 避免与 github 的时钟偏差
+		ExpiresAt: now.Add(githubAppJwtExpire).Unix(),
+		Issuer:    strconv.FormatInt(vcs.GithubAppId, 10),
+	}).SignedString(key)
+	if err != nil {
+		return "", e.New(e.VcsAuthInvalid, err)
+	}
+
+	path := utils.GenQueryURL(vcs.Address, fmt.Sprintf("/app/installations/%d/access_tokens", vcs.InstallationId), nil)
+	request, err := http.NewRequest(http.MethodPost, path, bytes.NewBuffer(nil))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Accept", "application/vnd.github.v3+json")
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", appJwt))
+	response, err := (&http.Client{}).Do(request)
+	if err != nil {
+		return "", e.New(e.VcsConnectError, err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode >= 300 {
+		return "", e.New(e.VcsUnauthorized, fmt.Errorf("%s: %s", response.Status, body))
+	}
+
+	resp := struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}{}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return "", e.New(e.VcsError, err)
+	}
+	githubAppTokens.Store(cacheKey, &OauthToken{AccessToken: resp.Token, Expiry: resp.ExpiresAt})
+	return resp.Token, nil
+}
+
+// ResolveVcs 返回使用实际访问 token 的 vcs 副本。
+// OAuth 认证使用 vcs 授权用户的 token(过期前自动刷新)，GitHub App 认证使用安装的 token，token 认证直接返回
+func ResolveVcs(vcs *models.Vcs) (*models.Vcs, error) {
+	switch vcs.AuthType {
+	case models.VcsAuthGithubApp:
+		token, err := GithubAppInstallationToken(vcs)
+		if err != nil {
+			return nil, err
+		}
+		return vcsWithToken(vcs, token)
+	case models.VcsAuthOauth:
+		if vcs.OauthUserId == "" {
+			return nil, e.New(e.VcsUnauthorized, fmt.Errorf("vcs '%s' is not authorized", vcs.Name))
+		}
+		return ResolveUserVcs(vcs, vcs.OauthUserId)
+	default:
+		return vcs, nil
+	}
+}
+
+// ResolveUserVcs 同 ResolveVcs，OAuth 认证时使用指定用户的授权，用户未授权时使用 vcs 授权用户的授权
+func ResolveUserVcs(vcs *models.Vcs, userId models.Id) (*models.Vcs, error) {
+	if vcs.AuthType != models.VcsAuthOauth {
+		return ResolveVcs(vcs)
+	}
+
+	token, err := getOauthToken(db.Get(), vcs.Id, userId)
+	if err != nil {
+		if e.IsRecordNotFound(err) && userId != vcs.OauthUserId {
+			return ResolveVcs(vcs)
+		} else if e.IsRecordNotFound(err) {
+			return nil, e.New(e.VcsUnauthorized, fmt.Errorf("vcs '%s' is not authorized", vcs.Name))
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	if token.ExpiresAt != nil && time.Until(time.Time(*token.ExpiresAt)) < oauthTokenRefreshAhead {
+		if token, err = refreshUserOauthToken(vcs, userId); err != nil {
+			return nil, err
+		}
+	}
+	// 记录实际使用的授权用户，副本再次 resolve 时使用相同用户的授权
+	resolved := *vcs
+	resolved.VcsToken = token.AccessToken
+	resolved.OauthUserId = userId
+	return &resolved, nil
+}
+
+func vcsWithToken(vcs *models.Vcs, token string) (*models.Vcs, error) {
+	encrypted, err := utils.EncryptSecretVar(token)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *vcs
+	resolved.VcsToken = encrypted
+	return &resolved, nil
+}
+
+func getOauthToken(sess *db.Session, vcsId, userId models.Id) (*models.VcsOauthToken, error) {
+	token := models.VcsOauthToken{}
+	if err := sess.Where("vcs_id = ? AND user_id = ?", vcsId, userId).First(&token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// refreshUserOauthToken 刷新用户的 token 并保存，加锁后重新查询，token 已被其他请求刷新时直接使用
+func refreshUserOauthToken(vcs *models.Vcs, userId models.Id) (*models.VcsOauthToken, error) {
+	oauthRefreshLock.Lock()
+	defer oauthRefreshLock.Unlock()
+
+	sess := db.Get()
+	token, err := getOauthToken(sess, vcs.Id, userId)
+	if err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	if token.ExpiresAt == nil || time.Until(time.Time(*token.ExpiresAt)) >= oauthTokenRefreshAhead {
+		return token, nil
+	}
+	if token.RefreshToken == "" {
+		return nil, e.New(e.VcsUnauthorized, fmt.Errorf("oauth token expired"))
+	}
+	refreshToken, err := utils.DecryptSecretVar(token.RefreshToken)
+	if err != nil {
+		return nil, e.New(e.VcsError, err)
+	}
+	newToken, err := RefreshOauthToken(vcs, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := SetOauthToken(token, newToken); err != nil {
+		return nil, err
+	}
+	if _, err := models.UpdateAttr(sess.Where("id = ?", token.Id), &models.VcsOauthToken{}, models.Attrs{
+		"access_token":  token.AccessToken,
+		"refresh_token": token.RefreshToken,
+		"expires_at":    token.ExpiresAt,
+	}); err != nil {
+		return nil, e.New(e.DBError, err)
+	}
+	return token, nil
+}
+
+// SetOauthToken 加密保存 token 到授权记录，未返回新的 refresh token 时保留原值
+func SetOauthToken(record *models.VcsOauthToken, token *OauthToken) error {
+	accessToken, err := utils.EncryptSecretVar(token.AccessToken)
+	if err != nil {
+		return err
+	}
+	record.AccessToken = accessToken
+	if token.RefreshToken != "" {
+		refreshToken, err := utils.EncryptSecretVar(token.RefreshToken)
+		if err != nil {
+			return err
+		}
+		record.RefreshToken = refreshToken
+	}
+	record.ExpiresAt = nil
+	if !token.Expiry.IsZero() {
+		expiresAt := models.Time(token.Expiry)
+		record.ExpiresAt = &expiresAt
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/portal/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGithubWebAddress(t *testing.T) {
+	assert.Equal(t, "https://github.com", githubWebAddress("https://api.github.com"))
+	assert.Equal(t, "https://github.example.com", githubWebAddress("https://github.example.com/api/v3"))
+}
+
+func TestOauthCloneUser(t *testing.T) {
+	assert.Equal(t, OauthCloneUserGitlab, OauthCloneUser(&models.Vcs{VcsType: models.VcsGitlab}))
+	assert.Equal(t, OauthCloneUserGithub, OauthCloneUser(&models.Vcs{VcsType: models.VcsGithub, AuthType: models.VcsAuthGithubApp}))
+}
+
+func TestGithubUserHasInstallation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/user/installations" || r.Header.Get("Authorization") != "token user-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		// 第一页返回 100 个安装，第二页返回用户的另一个安装
+		installations := make([]map[string]int64, 0)
+		if r.URL.Query().Get("page") == "1" {
+			for i := int64(1); i <= 100; i++ {
+				installations = append(installations, map[string]int64{"id": i})
+			}
+		} else {
+			installations = append(installations, map[string]int64{"id": 1001})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"installations": installations})
+	}))
+	defer server.Close()
+
+	vcs := &models.Vcs{VcsType: models.VcsGithub, AuthType: models.VcsAuthGithubApp, Address: server.URL}
+	ok, err := GithubUserHasInstallation(vcs, "user-token", 1001)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = GithubUserHasInstallation(vcs, "user-token", 2002)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	_, err = GithubUserHasInstallation(vcs, "other-token", 1001)
+	assert.Error(t, err)
+}
@@ -248,6 +248,10 @@ func (r *RegistryRepo) CreatePrComment(prId int, comment string) error {
 	return nil
 }
 
+func (r *RegistryRepo) SetCommitStatus(commitId string, status CommitStatus) error {
+	return nil
+}
+
 func registryVcsRequest(path, method string, params map[string]string) (*http.Response, []byte, error) {
 	payload := &bytes.Buffer{}
 	writer := multipart.NewWriter(payload)
@@ -0,0 +1,78 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	RevisionTypeBranch = "branch"
+	RevisionTypeTag    = "tag"
+)
+
+// RevisionSearcher 支持在 vcs 服务端按名称过滤并分页查询分支及 tag 的仓库，
+// 分支数量很多时避免每次查询全部分支
+type RevisionSearcher interface {
+	// SearchRevisions 分页查询名称包含 search 的分支或 tag
+	// param revType: branch 或 tag
+	// param limit: 限制返回的数量，传 0 表示无限制
+	// return int64(分页total数量)
+	SearchRevisions(revType, search string, limit, offset int) ([]string, int64, error)
+}
+
+// SearchRevisions 分页查询仓库名称包含 search(不区分大小写)的分支或 tag，
+// 仓库不支持服务端过滤时查询全部分支或 tag 后再过滤、分页
+func SearchRevisions(repo RepoIface, revType, search string, limit, offset int) ([]string, int64, error) {
+	if s, ok := repo.(RevisionSearcher); ok {
+		return s.SearchRevisions(revType, search, limit, offset)
+	}
+	return searchRevisionsLocal(repo, revType, search, limit, offset)
+}
+
+func searchRevisionsLocal(repo RepoIface, revType, search string, limit, offset int) ([]string, int64, error) {
+	var (
+		revisions []string
+		err       error
+	)
+	switch revType {
+	case RevisionTypeBranch:
+		revisions, err = repo.ListBranches()
+	case RevisionTypeTag:
+		revisions, err = repo.ListTags()
+	default:
+		return nil, 0, fmt.Errorf("unknown revision type: %s", revType)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	revisions = filterRevisions(revisions, search)
+	return pageRevisions(revisions, limit, offset), int64(len(revisions)), nil
+}
+
+// filterRevisions 过滤名称包含 search 的分支或 tag，不区分大小写
+func filterRevisions(revisions []string, search string) []string {
+	if search == "" {
+		return revisions
+	}
+	search = strings.ToLower(search)
+	matched := make([]string, 0)
+	for _, r := range revisions {
+		if strings.Contains(strings.ToLower(r), search) {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+func pageRevisions(revisions []string, limit, offset int) []string {
+	if offset >= len(revisions) {
+		return []string{}
+	}
+	revisions = revisions[offset:]
+	if limit > 0 && limit < len(revisions) {
+		revisions = revisions[:limit]
+	}
+	return revisions
+}
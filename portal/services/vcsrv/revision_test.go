@@ -0,0 +1,39 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type revisionTestRepo struct {
+	RepoIface
+	branches []string
+}
+
+func (r *revisionTestRepo) ListBranches() ([]string, error) {
+	return r.branches, nil
+}
+
+func TestSearchRevisions(t *testing.T) {
+	repo := &revisionTestRepo{branches: []string{"master", "dev", "feature/Login", "feature/logout", "release"}}
+
+	names, total, err := SearchRevisions(repo, RevisionTypeBranch, "LOG", 1, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, []string{"feature/Login"}, names)
+
+	names, total, err = SearchRevisions(repo, RevisionTypeBranch, "", 2, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	assert.Equal(t, []string{"release"}, names)
+
+	names, _, err = SearchRevisions(repo, RevisionTypeBranch, "", 2, 6)
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+
+	_, _, err = SearchRevisions(repo, "commit", "", 2, 0)
+	assert.Error(t, err)
+}
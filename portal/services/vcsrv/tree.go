@@ -0,0 +1,155 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"cloudiac/portal/consts/e"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	TreeEntryFile = "file"
+	TreeEntryDir  = "dir"
+
+	// BlobMaxSize 文件浏览时读取的文件大小上限，超出时不返回内容
+	BlobMaxSize = 1024 * 1024
+)
+
+// TreeEntry 目录下的文件或子目录
+type TreeEntry struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // 相对仓库根目录的完整路径
+	Type string `json:"type"` // file/dir
+}
+
+// Blob 仓库中指定版本的文件内容
+type Blob struct {
+	Path      string `json:"path"`
+	Ref       string `json:"ref"`
+	Size      int    `json:"size"`
+	Binary    bool   `json:"binary"`    // 二进制文件不返回内容
+	Truncated bool   `json:"truncated"` // 文件超过 BlobMaxSize 时不返回内容
+	Content   string `json:"content"`
+}
+
+// TreeLister 支持直接列出目录下文件及子目录的仓库实现，
+// 未实现的仓库通过 ListFiles 递归列出文件后计算目录内容
+type TreeLister interface {
+	ListTree(ref, dir string) ([]TreeEntry, error)
+}
+
+// CleanTreePath 整理浏览路径，返回不以 / 开头及结尾的相对路径(不会超出仓库根目录)，根目录返回空字符串
+func CleanTreePath(p string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.TrimSpace(p)), "/")
+}
+
+// ListTree 列出仓库指定版本目录下的文件及子目录，目录排在文件之前，同类型按名称排序
+func ListTree(repo RepoIface, ref, dir string) ([]TreeEntry, error) {
+	dir = CleanTreePath(dir)
+	ref = getBranch(repo, ref)
+
+	var (
+		entries []TreeEntry
+		err     error
+	)
+	if lister, ok := repo.(TreeLister); ok {
+		entries, err = lister.ListTree(ref, dir)
+	} else {
+		var files []string
+		files, err = repo.ListFiles(VcsIfaceOptions{Ref: ref, Path: dir, Recursive: true})
+		entries = treeEntriesFromFiles(dir, files)
+	}
+	if err != nil {
+		return nil, err
+	}
+	sortTreeEntries(entries)
+	return entries, nil
+}
+
+// ReadBlob 读取仓库指定版本的文件，二进制文件及超过大小上限的文件不返回内容
+func ReadBlob(repo RepoIface, ref, filePath string) (*Blob, error) {
+	filePath = CleanTreePath(filePath)
+	if filePath == "" {
+		return nil, e.New(e.BadParam, fmt.Errorf("file path is required"), http.StatusBadRequest)
+	}
+	ref = getBranch(repo, ref)
+	content, err := repo.ReadFileContent(ref, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	blob := Blob{Path: filePath, Ref: ref, Size: len(content)}
+	if blob.Size > BlobMaxSize {
+		blob.Truncated = true
+	} else if !utf8.Valid(content) || strings.ContainsRune(string(content), 0) {
+		blob.Binary = true
+	} else {
+		blob.Content = string(content)
+	}
+	return &blob, nil
+}
+
+// treeEntriesFromFiles 根据目录下递归列出的文件路径计算目录的直接子项
+func treeEntriesFromFiles(dir string, files []string) []TreeEntry {
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	entries := make([]TreeEntry, 0)
+	dirs := make(map[string]bool)
+	for _, f := range files {
+		f = strings.TrimPrefix(f, "/")
+		if !strings.HasPrefix(f, prefix) {
+			continue
+		}
+		rel := strings.TrimPrefix(f, prefix)
+		if i := strings.Index(rel, "/"); i >= 0 {
+			name := rel[:i]
+			if !dirs[name] {
+				dirs[name] = true
+				entries = append(entries, TreeEntry{Name: name, Path: prefix + name, Type: TreeEntryDir})
+			}
+		} else if rel != "" {
+			entries = append(entries, TreeEntry{Name: rel, Path: f, Type: TreeEntryFile})
+		}
+	}
+	return entries
+}
+
+func sortTreeEntries(entries []TreeEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == TreeEntryDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+}
+
+// contentsTreeEntries 解析 github/gitea contents 接口返回的目录内容，路径为文件时接口返回的是对象
+func contentsTreeEntries(body []byte) ([]TreeEntry, error) {
+	items := make([]struct {
+		Type string `json:"type"`
+		Path string `json:"path"`
+		Name string `json:"name"`
+	}, 0)
+	if err := json.Unmarshal(body, &items); err != nil {
+		return nil, e.New(e.BadParam, fmt.Errorf("path is not a directory"), http.StatusBadRequest)
+	}
+	entries := make([]TreeEntry, 0, len(items))
+	for _, v := range items {
+		switch v.Type {
+		case "file":
+			entries = append(entries, TreeEntry{Name: v.Name, Path: v.Path, Type: TreeEntryFile})
+		case "dir":
+			entries = append(entries, TreeEntry{Name: v.Name, Path: v.Path, Type: TreeEntryDir})
+		}
+	}
+	return entries, nil
+}
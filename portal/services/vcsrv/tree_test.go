@@ -0,0 +1,42 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package vcsrv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanTreePath(t *testing.T) {
+	for input, expect := range map[string]string{
+		"":            "",
+		"/":           "",
+		"./":          "",
+		"modules/":    "modules",
+		"/modules/vm": "modules/vm",
+		"a/../b":      "b",
+		"../../etc":   "etc",
+	} {
+		assert.Equal(t, expect, CleanTreePath(input), input)
+	}
+}
+
+func TestTreeEntriesFromFiles(t *testing.T) {
+	files := []string{"modules/vm/main.tf", "modules/vm/vars.tf", "modules/README.md", "modules/net/main.tf", "main.tf"}
+
+	entries := treeEntriesFromFiles("", files)
+	sortTreeEntries(entries)
+	assert.Equal(t, []TreeEntry{
+		{Name: "modules", Path: "modules", Type: TreeEntryDir},
+		{Name: "main.tf", Path: "main.tf", Type: TreeEntryFile},
+	}, entries)
+
+	entries = treeEntriesFromFiles("modules", files)
+	sortTreeEntries(entries)
+	assert.Equal(t, []TreeEntry{
+		{Name: "net", Path: "modules/net", Type: TreeEntryDir},
+		{Name: "vm", Path: "modules/vm", Type: TreeEntryDir},
+		{Name: "README.md", Path: "modules/README.md", Type: TreeEntryFile},
+	}, entries)
+}
@@ -27,10 +27,11 @@ type UserInfo struct {
 }
 
 const (
-	WebhookUrlGitlab = "/webhooks/gitlab"
-	WebhookUrlGitea  = "/webhooks/gitea"
-	WebhookUrlGitee  = "/webhooks/gitee"
-	WebhookUrlGithub = "/webhooks/github"
+	WebhookUrlGitlab    = "/webhooks/gitlab"
+	WebhookUrlGitea     = "/webhooks/gitea"
+	WebhookUrlGitee     = "/webhooks/gitee"
+	WebhookUrlGithub    = "/webhooks/github"
+	WebhookUrlBitbucket = "/webhooks/bitbucket"
 )
 
 type VcsIfaceOptions struct {
@@ -99,6 +100,23 @@ type RepoIface interface {
 
 	//CreatePrComment 添加PR评论
 	CreatePrComment(prId int, comment string) error
+
+	// SetCommitStatus 设置 commit 状态，PR/MR 页面会展示 head commit 的状态
+	SetCommitStatus(commitId string, status CommitStatus) error
+}
+
+const (
+	CommitStatusPending = "pending"
+	CommitStatusSuccess = "success"
+	CommitStatusFailure = "failure"
+)
+
+// CommitStatus commit 状态，同一 commit 相同 context 的状态会被覆盖
+type CommitStatus struct {
+	State       string // pending/success/failure
+	Context     string // 状态名称，如 cloudiac/plan/{envName}
+	TargetUrl   string // 状态链接，指向任务详情
+	Description string
 }
 
 type RepoHook struct {
@@ -107,6 +125,22 @@ type RepoHook struct {
 }
 
 func GetVcsInstance(vcs *models.Vcs) (VcsIface, error) {
+	// OAuth 及 GitHub App 认证时使用实际的访问 token
+	vcs, err := ResolveVcs(vcs)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := newVcsInstance(vcs)
+	if err != nil {
+		return nil, err
+	}
+	if store, _ := getVcsCache(); store != nil && vcs.VcsType != consts.GitTypeLocal {
+		return &cachedVcsIface{VcsIface: instance, vcs: vcs}, nil
+	}
+	return instance, nil
+}
+
+func newVcsInstance(vcs *models.Vcs) (VcsIface, error) {
 	switch vcs.VcsType {
 	case consts.GitTypeLocal:
 		return newLocalVcs(vcs.Address), nil
@@ -118,6 +152,8 @@ func GetVcsInstance(vcs *models.Vcs) (VcsIface, error) {
 		return newGithubInstance(vcs)
 	case consts.GitTypeGitee:
 		return newGiteeInstance(vcs)
+	case consts.GitTypeBitbucket:
+		return newBitbucketInstance(vcs)
 	case consts.GitTypeRegistry:
 		return newRegistryVcs(vcs)
 	default:
@@ -162,6 +198,18 @@ func GetRepoAddress(repo RepoIface) (string, error) {
 	return p.HTTPURLToRepo, nil
 }
 
+// GetRepoSshAddress 返回仓库的 SSH clone 地址，使用部署密钥 clone 代码时使用
+func GetRepoSshAddress(repo RepoIface) (string, error) {
+	p, err := repo.FormatRepoSearch()
+	if err != nil {
+		return "", err
+	}
+	if p.SSHURLToRepo == "" {
+		return "", fmt.Errorf("repo '%s' does not support ssh clone", p.FullName)
+	}
+	return p.SSHURLToRepo, nil
+}
+
 func chkAndDelWebhook(repo RepoIface, vcsId models.Id, webhookId int) error {
 	// 判断同vcs、仓库的环境是否存在
 	envExist, err := db.Get().Model(&models.Env{}).
@@ -217,6 +265,35 @@ func SetWebhook(vcs *models.Vcs, repoId, apiToken string, triggers []string) err
 	return nil
 }
 
+type WebhookStatus struct {
+	Exists bool   `json:"exists"` // 代码仓库中是否存在 webhook
+	HookId int    `json:"hookId"`
+	Url    string `json:"url"` // webhook 地址，不包含 token 参数
+}
+
+// GetWebhookStatus 查询代码仓库中 webhook 的注册状态
+func GetWebhookStatus(vcs *models.Vcs, repoId, apiToken string) (*WebhookStatus, error) {
+	webhookUrl := GetWebhookUrl(vcs, apiToken)
+	status := &WebhookStatus{Url: strings.SplitN(webhookUrl, "?", 2)[0]}
+
+	repo, err := GetRepo(vcs, repoId)
+	if err != nil {
+		return status, err
+	}
+	webhooks, err := repo.ListWebhook()
+	if err != nil {
+		return status, err
+	}
+	for _, webhook := range webhooks {
+		if webhook.Url == webhookUrl {
+			status.Exists = true
+			status.HookId = webhook.Id
+			break
+		}
+	}
+	return status, nil
+}
+
 func GetVcsToken(token string) (string, error) {
 	return utils.DecryptSecretVar(token)
 }
@@ -232,6 +309,8 @@ func GetWebhookUrl(vcs *models.Vcs, apiToken string) string {
 		webhookUrl += WebhookUrlGitee
 	case models.VcsGithub:
 		webhookUrl += WebhookUrlGithub
+	case models.VcsBitbucket:
+		webhookUrl += WebhookUrlBitbucket
 	}
 	webhookUrl += fmt.Sprintf("/%s?token=%s", vcs.Id.String(), apiToken)
 	return webhookUrl
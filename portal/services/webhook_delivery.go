@@ -0,0 +1,79 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"net/http"
+	"strings"
+)
+
+// webhookSecretHeaders 记录投递日志时隐藏的请求头(认证信息)，github 的签名头(X-Hub-Signature*)同样隐藏
+var webhookSecretHeaders = map[string]bool{
+	"Authorization":  true,
+	"Cookie":         true,
+	"X-Gitlab-Token": true,
+	"X-Gitee-Token":  true,
+}
+
+// webhookEventHeaders 各 vcs 标识事件类型的请求头
+var webhookEventHeaders = []string{
+	"X-Gitlab-Event",
+	"X-Github-Event",
+	"X-Gitea-Event",
+	"X-Gitee-Event",
+	"X-Event-Key", // bitbucket
+}
+
+// RedactWebhookHeaders 将请求头转换为投递日志记录的格式，认证信息替换为 ******
+func RedactWebhookHeaders(headers map[string]string) models.WebhookDeliveryHeaders {
+	redacted := models.WebhookDeliveryHeaders{}
+	for k, v := range headers {
+		key := http.CanonicalHeaderKey(k)
+		if webhookSecretHeaders[key] || strings.HasPrefix(key, "X-Hub-Signature") {
+			v = "******"
+		}
+		redacted[key] = v
+	}
+	return redacted
+}
+
+// WebhookDeliveryEvent 根据请求头获取事件类型，请求头中没有事件类型时使用 gitlab 的 object_kind
+func WebhookDeliveryEvent(headers map[string]string, objectKind string) string {
+	for _, h := range webhookEventHeaders {
+		if v := headers[h]; v != "" {
+			return v
+		}
+	}
+	return objectKind
+}
+
+func CreateWebhookDelivery(tx *db.Session, delivery *models.WebhookDelivery) e.Error {
+	if err := models.Create(tx, delivery); err != nil {
+		return e.New(e.DBError, err)
+	}
+	return nil
+}
+
+// SearchWebhookDeliveries 查询代码仓库的 webhook 投递记录，列表不返回请求头及请求内容
+func SearchWebhookDeliveries(query *db.Session, vcsId models.Id, repoId string, status string) *db.Session {
+	query = query.Model(&models.WebhookDelivery{}).Omit("headers", "payload").
+		Where("vcs_id = ? AND repo_id = ?", vcsId, repoId)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	return query.Order("created_at DESC")
+}
+
+func GetWebhookDelivery(query *db.Session, vcsId models.Id, repoId string, id models.Id) (*models.WebhookDelivery, e.Error) {
+	delivery := models.WebhookDelivery{}
+	if err := query.Where("id = ? AND vcs_id = ? AND repo_id = ?", id, vcsId, repoId).First(&delivery); err != nil {
+		if e.IsRecordNotFound(err) {
+			return nil, e.New(e.WebhookDeliveryNotExists, err)
+		}
+		return nil, e.New(e.DBError, err)
+	}
+	return &delivery, nil
+}
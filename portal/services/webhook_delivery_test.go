@@ -0,0 +1,28 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactWebhookHeaders(t *testing.T) {
+	headers := RedactWebhookHeaders(map[string]string{
+		"x-gitlab-token":      "secret",
+		"X-Hub-Signature-256": "sha256=abc",
+		"Authorization":       "Bearer token",
+		"X-Gitlab-Event":      "Push Hook",
+	})
+	assert.Equal(t, "******", headers["X-Gitlab-Token"])
+	assert.Equal(t, "******", headers["X-Hub-Signature-256"])
+	assert.Equal(t, "******", headers["Authorization"])
+	assert.Equal(t, "Push Hook", headers["X-Gitlab-Event"])
+}
+
+func TestWebhookDeliveryEvent(t *testing.T) {
+	assert.Equal(t, "pull_request", WebhookDeliveryEvent(map[string]string{"X-Github-Event": "pull_request"}, ""))
+	assert.Equal(t, "repo:push", WebhookDeliveryEvent(map[string]string{"X-Event-Key": "repo:push"}, ""))
+	assert.Equal(t, "push", WebhookDeliveryEvent(map[string]string{}, "push"))
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/services"
+	"time"
+)
+
+// AutoDestroyRemindInterval 检查环境自动销毁提醒的时间间隔
+const AutoDestroyRemindInterval = time.Minute
+
+// processAutoDestroyReminder 在环境自动销毁前按配置的提前时间发送提醒通知
+func (m *TaskManager) processAutoDestroyReminder() {
+	if time.Since(m.autoDestroyRemindedAt) < AutoDestroyRemindInterval {
+		return
+	}
+	m.autoDestroyRemindedAt = time.Now()
+
+	logger := m.logger.WithField("func", "processAutoDestroyReminder")
+	reminders := services.GetAutoDestroyReminders()
+	if len(reminders) == 0 {
+		return
+	}
+
+	now := time.Now()
+	// reminders 按从长到短排序，第一个即为最长的提前时间
+	envs, err := services.GetAutoDestroyRemindEnvs(m.db, now, reminders[0])
+	if err != nil {
+		logger.Errorf("get auto destroy envs error: %v", err)
+		return
+	}
+	for _, env := range envs {
+		if reminded, err := services.RemindEnvAutoDestroy(m.db, env, now, reminders); err != nil {
+			logger.WithField("envId", env.Id).Errorf("remind env auto destroy error: %v", err)
+		} else if reminded {
+			logger.WithField("envId", env.Id).Infof("auto destroy reminder sent, destroy at %v", time.Time(*env.AutoDestroyAt))
+		}
+	}
+}
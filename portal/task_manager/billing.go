@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/services"
+	"cloudiac/portal/services/billing"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// processBillingSync 在后台同步所有到期的账单连接器，同一时间只会有一个同步协程运行
+func (m *TaskManager) processBillingSync(ctx context.Context) {
+	if !atomic.CompareAndSwapInt32(&m.billingSyncing, 0, 1) {
+		return
+	}
+
+	logger := m.logger.WithField("func", "processBillingSync")
+	connectors, err := services.GetDueBillingConnectors(m.db, time.Now())
+	if err != nil {
+		logger.Errorf("get due billing connectors error: %v", err)
+		atomic.StoreInt32(&m.billingSyncing, 0)
+		return
+	}
+	if len(connectors) == 0 {
+		atomic.StoreInt32(&m.billingSyncing, 0)
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer atomic.StoreInt32(&m.billingSyncing, 0)
+
+		for _, c := range connectors {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			cycle := billing.CurrentCycle(time.Now())
+			count, err := services.SyncBillingConnector(m.db, c, cycle)
+			if err != nil {
+				// 错误信息已记录到连接器的同步状态中
+				continue
+			}
+			logger.WithField("connectorId", c.Id).Infof("synced %d billing records of %s", count, cycle)
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/models"
+	"sync"
+)
+
+// taskCounter 统计正在执行的任务数量，任务启动时增加计数，任务协程退出时减少计数
+type taskCounter struct {
+	mu sync.Mutex
+
+	runnerTasks     map[string]int         // 每个 runner 正在执行的任务数量
+	runnerScanTasks map[string]int         // 每个 runner 正在执行的扫描任务数量
+	orgScanTasks    map[models.Id]int      // 每个组织正在执行的扫描任务数量
+	scanTasks       map[models.Id]struct{} // 正在执行的扫描任务
+
+	orgTasks     map[models.Id]int // 每个组织正在执行的任务数量，用于公平调度
+	projectTasks map[models.Id]int // 每个项目正在执行的任务数量，用于公平调度
+}
+
+func newTaskCounter() *taskCounter {
+	return &taskCounter{
+		runnerTasks:     make(map[string]int),
+		runnerScanTasks: make(map[string]int),
+		orgScanTasks:    make(map[models.Id]int),
+		scanTasks:       make(map[models.Id]struct{}),
+		orgTasks:        make(map[models.Id]int),
+		projectTasks:    make(map[models.Id]int),
+	}
+}
+
+// add 增加任务计数，扫描任务已在执行时返回 false
+func (c *taskCounter) add(task models.Tasker) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := task.(*models.ScanTask); ok {
+		if _, running := c.scanTasks[t.Id]; running {
+			return false
+		}
+		c.scanTasks[t.Id] = struct{}{}
+		c.runnerScanTasks[t.RunnerId]++
+		c.orgScanTasks[t.OrgId]++
+	}
+	c.runnerTasks[task.GetRunnerId()]++
+	orgId, projectId := taskTenant(task)
+	c.orgTasks[orgId]++
+	c.projectTasks[projectId]++
+	return true
+}
+
+func (c *taskCounter) done(task models.Tasker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t, ok := task.(*models.ScanTask); ok {
+		delete(c.scanTasks, t.Id)
+		c.runnerScanTasks[t.RunnerId]--
+		c.orgScanTasks[t.OrgId]--
+	}
+	c.runnerTasks[task.GetRunnerId()]--
+	orgId, projectId := taskTenant(task)
+	c.orgTasks[orgId]--
+	c.projectTasks[projectId]--
+}
+
+// tenantTasks 返回每个组织及每个项目正在执行的任务数量
+func (c *taskCounter) tenantTasks() (orgs map[models.Id]int, projects map[models.Id]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orgs = make(map[models.Id]int, len(c.orgTasks))
+	for k, v := range c.orgTasks {
+		orgs[k] = v
+	}
+	projects = make(map[models.Id]int, len(c.projectTasks))
+	for k, v := range c.projectTasks {
+		projects[k] = v
+	}
+	return orgs, projects
+}
+
+func (c *taskCounter) runnerTaskNum(runnerId string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.runnerTasks[runnerId]
+}
+
+// limitedRunners 返回已达到并发限制的 runner，scan 为 true 时同时返回扫描任务数量达到限制的 runner
+func (c *taskCounter) limitedRunners(maxTasks int, maxScanTasks int, scan bool) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	runners := make([]string, 0)
+	for runnerId, count := range c.runnerTasks {
+		if count >= maxTasks || (scan && c.runnerScanTasks[runnerId] >= maxScanTasks) {
+			runners = append(runners, runnerId)
+		}
+	}
+	return runners
+}
+
+// limitedOrgs 返回扫描任务数量已达到并发限制的组织，maxScanTasks 为 0 表示不限制
+func (c *taskCounter) limitedOrgs(maxScanTasks int) []models.Id {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	orgs := make([]models.Id, 0)
+	if maxScanTasks <= 0 {
+		return orgs
+	}
+	for orgId, count := range c.orgScanTasks {
+		if count >= maxScanTasks {
+			orgs = append(orgs, orgId)
+		}
+	}
+	return orgs
+}
+
+// scanLimited 判断扫描任务是否超出 runner 或组织的扫描并发限制
+func (c *taskCounter) scanLimited(task *models.ScanTask, maxScanTasksPerRunner, maxScanTasksPerOrg int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.runnerScanTasks[task.RunnerId] >= maxScanTasksPerRunner {
+		return true
+	}
+	return maxScanTasksPerOrg > 0 && c.orgScanTasks[task.OrgId] >= maxScanTasksPerOrg
+}
+
+// getMaxScanTasksPerRunner 每个 runner 允许并发执行的扫描任务数量，
+// 未配置时为 runner 并发任务数量的一半，保证扫描任务不会占满 runner 导致部署任务无法执行
+func getMaxScanTasksPerRunner(maxTasksPerRunner int) int {
+	n := configs.Get().Policy.MaxScanTasksPerRunner
+	if n <= 0 {
+		n = maxTasksPerRunner / 2
+	} else if n > maxTasksPerRunner {
+		n = maxTasksPerRunner
+	}
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
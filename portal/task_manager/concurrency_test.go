@@ -0,0 +1,46 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestTaskCounter(t *testing.T) {
+	c := newTaskCounter()
+	scan1 := &models.ScanTask{OrgId: "org-1", BaseTask: models.BaseTask{RunnerId: "runner-1"}}
+	scan1.Id = "run-1"
+	scan2 := &models.ScanTask{OrgId: "org-1", BaseTask: models.BaseTask{RunnerId: "runner-1"}}
+	scan2.Id = "run-2"
+	deploy := &models.Task{OrgId: "org-2", BaseTask: models.BaseTask{RunnerId: "runner-1"}}
+	deploy.Id = "run-3"
+
+	if !c.add(scan1) || c.add(scan1) {
+		t.Fatalf("scan task should only be added once")
+	}
+	c.add(deploy)
+	if n := c.runnerTaskNum("runner-1"); n != 2 {
+		t.Errorf("runnerTaskNum() = %d, want 2", n)
+	}
+	if !c.scanLimited(scan2, 1, 0) {
+		t.Errorf("scan task should be limited by runner")
+	}
+	if !c.scanLimited(scan2, 2, 1) {
+		t.Errorf("scan task should be limited by org")
+	}
+	if c.scanLimited(scan2, 2, 0) {
+		t.Errorf("scan task should not be limited")
+	}
+	if runners := c.limitedRunners(3, 1, false); len(runners) != 0 {
+		t.Errorf("limitedRunners() = %v, want empty", runners)
+	}
+	if runners := c.limitedRunners(3, 1, true); len(runners) != 1 {
+		t.Errorf("limitedRunners() = %v, want [runner-1]", runners)
+	}
+
+	c.done(scan1)
+	if orgs := c.limitedOrgs(1); len(orgs) != 0 {
+		t.Errorf("limitedOrgs() = %v, want empty", orgs)
+	}
+}
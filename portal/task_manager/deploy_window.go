@@ -0,0 +1,36 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"time"
+)
+
+// firstPendingTaskIdQuery 查询每个环境中最先创建的且已到计划执行时间的 pending 任务 id，
+// 未到计划时间的任务不参与排序，避免阻塞同一环境下之后创建的任务
+func firstPendingTaskIdQuery(sess *db.Session, now time.Time) *db.Session {
+	firstPendingQuery := sess.Raw(
+		"SELECT env_id, MIN(created_at) AS created_at FROM iac_task "+
+			"WHERE status = ? AND (scheduled_at IS NULL OR scheduled_at <= ?) GROUP BY env_id", models.TaskPending, now)
+	// 根据上一步查询到的 env_id + created_at 查询符合条件的任务，并取每个 env 下 id 最小的一条 task 记录
+	// (注意：直接通过 env_id + created_at 匹配可能同一个 env 会返回多条记录)
+	return sess.Raw("SELECT iac_task.env_id, MIN(iac_task.id) AS task_id FROM iac_task, (?) AS fpt "+
+		"WHERE iac_task.env_id = fpt.env_id AND iac_task.created_at = fpt.created_at "+
+		"AND iac_task.status = ? AND (iac_task.scheduled_at IS NULL OR iac_task.scheduled_at <= ?) GROUP BY env_id",
+		firstPendingQuery.Expr(), models.TaskPending, now)
+}
+
+// taskScheduled 判断任务是否在等待环境部署窗口开始，等待期间任务保持排队状态
+func (m *TaskManager) taskScheduled(task *models.Task) bool {
+	if task.ScheduledAt == nil || task.Started() {
+		return false
+	}
+	if time.Now().Before(time.Time(*task.ScheduledAt)) {
+		m.logger.WithField("taskId", task.Id).Debugf("task scheduled at %s",
+			time.Time(*task.ScheduledAt).Format(time.RFC3339))
+		return true
+	}
+	return false
+}
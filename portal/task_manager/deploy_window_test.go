@@ -0,0 +1,41 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestFirstPendingTaskIdQuery(t *testing.T) {
+	// 只生成 SQL，不连接数据库
+	gdb, err := gorm.Open(mysql.New(mysql.Config{DSN: "test@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := db.ToSess(gdb)
+
+	now := time.Date(2022, 4, 1, 12, 0, 0, 0, time.UTC)
+	tasks := make([]*models.Task, 0)
+	stmt := sess.GormDB().Model(&models.Task{}).
+		Joins("JOIN (?) AS t ON t.task_id = iac_task.id", firstPendingTaskIdQuery(sess, now).Expr()).
+		Find(&tasks).Statement
+	sql := gdb.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+
+	// 计划在未来执行的任务不参与每个环境首个 pending 任务的选择，之后创建的未计划任务可以先调度
+	for _, cond := range []string{
+		"WHERE status = 'pending' AND (scheduled_at IS NULL OR scheduled_at <= '2022-04-01 12:00:00')",
+		"AND iac_task.status = 'pending' AND (iac_task.scheduled_at IS NULL OR iac_task.scheduled_at <= '2022-04-01 12:00:00')",
+	} {
+		if !strings.Contains(sql, cond) {
+			t.Fatalf("query %q should contain %q", sql, cond)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+)
+
+// taskEnvLocked 判断任务是否因环境被其他用户锁定而暂缓启动，
+// 任务创建后环境才被锁定时任务保持排队状态，直到环境解锁
+func (m *TaskManager) taskEnvLocked(task *models.Task) bool {
+	if task.Started() {
+		return false
+	}
+	env, err := services.GetEnvById(m.db, task.EnvId)
+	if err != nil {
+		m.logger.WithField("taskId", task.Id).Errorf("get task environment %s: %v", task.EnvId, err)
+		return false
+	}
+	if services.EnvLockBlocksTask(env, task.Type, task.CreatorId) {
+		m.logger.WithField("taskId", task.Id).Debugf("env %s locked by %s, task delayed", env.Id, env.LockedBy)
+		return true
+	}
+	return false
+}
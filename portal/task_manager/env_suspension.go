@@ -0,0 +1,36 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/services"
+	"time"
+)
+
+// EnvSuspendCheckInterval 检查到期的环境定时任务暂停的时间间隔
+const EnvSuspendCheckInterval = time.Minute
+
+// processEnvSuspendExpire 恢复暂停已到期的环境定时任务
+func (m *TaskManager) processEnvSuspendExpire() {
+	if time.Since(m.envSuspendCheckedAt) < EnvSuspendCheckInterval {
+		return
+	}
+	m.envSuspendCheckedAt = time.Now()
+
+	logger := m.logger.WithField("func", "processEnvSuspendExpire")
+	tx := m.db.Begin()
+	n, err := services.ResumeExpiredEnvSuspensions(tx, time.Now())
+	if err != nil {
+		_ = tx.Rollback()
+		logger.Errorf("resume expired env suspensions error: %v", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		logger.Errorf("commit error: %v", err)
+		return
+	}
+	if n > 0 {
+		logger.Infof("%d env suspensions expired and resumed", n)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/configs"
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"sort"
+)
+
+func fairShareEnabled() bool {
+	return configs.Get().Scheduler.FairShare
+}
+
+// taskTenant 返回任务所属的组织和项目
+func taskTenant(task models.Tasker) (orgId models.Id, projectId models.Id) {
+	switch t := task.(type) {
+	case *models.Task:
+		return t.OrgId, t.ProjectId
+	case *models.ScanTask:
+		return t.OrgId, t.ProjectId
+	}
+	return "", ""
+}
+
+// fairPendingQueries 开启公平调度时按组织拆分等待任务的查询，每个组织最多查询 limit/组织数量 个任务，
+// 避免单个组织大量排队的任务占满单次查询的结果，导致其他组织的任务无法被调度
+func fairPendingQueries(query func() *db.Session, orgColumn string, limit int) ([]*db.Session, error) {
+	if !fairShareEnabled() {
+		return []*db.Session{query().Limit(limit)}, nil
+	}
+
+	orgIds := make([]models.Id, 0)
+	if err := query().Pluck("DISTINCT "+orgColumn, &orgIds); err != nil {
+		return nil, err
+	}
+	if len(orgIds) == 0 {
+		return nil, nil
+	}
+	perOrg := limit / len(orgIds)
+	if perOrg < 1 {
+		perOrg = 1
+	}
+
+	queries := make([]*db.Session, 0, len(orgIds))
+	for _, orgId := range orgIds {
+		queries = append(queries, query().Where(orgColumn+" = ?", orgId).Limit(perOrg))
+	}
+	return queries, nil
+}
+
+// fairOrder 开启公平调度时按组织及项目的权重对等待任务重新排序
+func (m *TaskManager) fairOrder(tasks []models.Tasker) []models.Tasker {
+	if !fairShareEnabled() || len(tasks) < 2 {
+		return tasks
+	}
+	orgRunning, projectRunning := m.runningTasks.tenantTasks()
+	return fairOrderTasks(tasks, orgRunning, projectRunning,
+		services.SchedulerOrgWeight, services.SchedulerProjectWeight)
+}
+
+// fairOrderTasks 加权公平排序，任务的虚拟完成时间为(租户正在执行的任务数 + 任务在租户内的排队序号) / 租户权重。
+// 先按项目的虚拟完成时间排序确定组织内各项目任务的先后，再按组织的虚拟完成时间在组织间交替调度，
+// 虚拟完成时间相同时保持原有顺序(优先级、创建时间)
+func fairOrderTasks(tasks []models.Tasker, orgRunning, projectRunning map[models.Id]int,
+	orgWeight, projectWeight func(models.Id) int) []models.Tasker {
+
+	type fairTask struct {
+		task       models.Tasker
+		orgTag     float64
+		projectTag float64
+	}
+
+	projectSeq := make(map[models.Id]int)
+	items := make([]*fairTask, 0, len(tasks))
+	for _, task := range tasks {
+		_, projectId := taskTenant(task)
+		projectSeq[projectId]++
+		items = append(items, &fairTask{
+			task:       task,
+			projectTag: float64(projectRunning[projectId]+projectSeq[projectId]) / float64(projectWeight(projectId)),
+		})
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].projectTag < items[j].projectTag })
+
+	orgSeq := make(map[models.Id]int)
+	for _, item := range items {
+		orgId, _ := taskTenant(item.task)
+		orgSeq[orgId]++
+		item.orgTag = float64(orgRunning[orgId]+orgSeq[orgId]) / float64(orgWeight(orgId))
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].orgTag < items[j].orgTag })
+
+	ordered := make([]models.Tasker, 0, len(items))
+	for _, item := range items {
+		ordered = append(ordered, item.task)
+	}
+	return ordered
+}
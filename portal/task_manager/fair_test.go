@@ -0,0 +1,49 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/models"
+	"testing"
+)
+
+func TestFairOrderTasks(t *testing.T) {
+	newTask := func(id, orgId, projectId models.Id) *models.Task {
+		task := &models.Task{OrgId: orgId, ProjectId: projectId}
+		task.Id = id
+		return task
+	}
+	tasks := []models.Tasker{
+		newTask("run-1", "org-a", "p-a1"),
+		newTask("run-2", "org-a", "p-a1"),
+		newTask("run-3", "org-a", "p-a1"),
+		newTask("run-4", "org-a", "p-a2"),
+		newTask("run-5", "org-b", "p-b1"),
+		newTask("run-6", "org-b", "p-b1"),
+	}
+	weight := func(models.Id) int { return 1 }
+	projectWeight := func(id models.Id) int {
+		if id == "p-a2" {
+			return 2
+		}
+		return 1
+	}
+
+	// org-a 已有一个任务在执行，org-b 的任务应优先调度；org-a 内权重更高的 p-a2 先于 p-a1 的任务
+	orgRunning := map[models.Id]int{"org-a": 1}
+	ordered := fairOrderTasks(tasks, orgRunning, map[models.Id]int{}, weight, projectWeight)
+	want := []models.Id{"run-5", "run-4", "run-6", "run-1", "run-2", "run-3"}
+	for i, task := range ordered {
+		if task.GetId() != want[i] {
+			t.Fatalf("fairOrderTasks() = %v, want %v", taskIds(ordered), want)
+		}
+	}
+}
+
+func taskIds(tasks []models.Tasker) []models.Id {
+	ids := make([]models.Id, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.GetId())
+	}
+	return ids
+}
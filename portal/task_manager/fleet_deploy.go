@@ -0,0 +1,84 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/libs/db"
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"time"
+)
+
+// FleetDeployCheckInterval 检查批量部署进度的时间间隔
+const FleetDeployCheckInterval = 5 * time.Second
+
+// processFleetDeploy 推进执行中的批量部署：同步各环境部署任务的状态，
+// 按并发数启动后续环境的部署，所有环境结束(或失败后停止)时结束批量部署
+func (m *TaskManager) processFleetDeploy() {
+	if time.Since(m.fleetDeployCheckedAt) < FleetDeployCheckInterval {
+		return
+	}
+	m.fleetDeployCheckedAt = time.Now()
+
+	logger := m.logger.WithField("func", "processFleetDeploy")
+	fds, err := services.GetRunningFleetDeploys(m.db)
+	if err != nil {
+		logger.Errorf("get running fleet deploys error: %v", err)
+		return
+	}
+	for _, fd := range fds {
+		if err := m.doProcessFleetDeploy(fd); err != nil {
+			logger.WithField("fleetId", fd.Id).Errorf("process fleet deploy error: %v", err)
+		}
+	}
+}
+
+func (m *TaskManager) doProcessFleetDeploy(fd *models.FleetDeploy) error {
+	logger := m.logger.WithField("fleetId", fd.Id)
+
+	if err := services.SyncFleetDeployItems(m.db, fd.Id); err != nil {
+		return err
+	}
+
+	for {
+		progress, err := services.GetFleetDeployProgress(m.db, []models.Id{fd.Id})
+		if err != nil {
+			return err
+		}
+		toStart, finalStatus := services.FleetDeployNextAction(fd, progress[fd.Id])
+		if finalStatus != "" {
+			logger.Infof("fleet deploy finished: %s", finalStatus)
+			return services.FinishFleetDeploy(m.db, fd, finalStatus, "")
+		}
+		if toStart == 0 {
+			return nil
+		}
+
+		items, err := services.GetPendingFleetDeployItems(m.db, fd.Id, toStart)
+		if err != nil {
+			return err
+		}
+		failed := false
+		for _, item := range items {
+			er := m.db.Transaction(func(tx *db.Session) error {
+				if err := services.StartFleetDeployItem(tx, fd, item); err != nil {
+					return err
+				}
+				return nil
+			})
+			if er != nil {
+				logger.Warnf("start deploy of env %s error: %v", item.EnvId, er)
+				if err := services.FailFleetDeployItem(m.db, item, er.Error()); err != nil {
+					return err
+				}
+				failed = true
+				break
+			}
+			logger.Infof("env %s deploy started, task %s", item.EnvId, item.TaskId)
+		}
+		// 创建任务失败后重新计算进度，判断是否需要停止或者补充启动其他环境
+		if !failed {
+			return nil
+		}
+	}
+}
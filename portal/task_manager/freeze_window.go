@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"time"
+)
+
+// taskFrozen 判断部署任务是否因冻结窗口暂缓启动，冻结期间任务保持排队状态直到冻结结束，
+// windows 缓存本轮调度中已查询的组织冻结窗口，避免每个任务都查询数据库
+func (m *TaskManager) taskFrozen(task *models.Task, windows map[models.Id][]*models.FreezeWindow) bool {
+	if task.FreezeOverrideId != "" || task.Started() {
+		return false
+	}
+	logger := m.logger.WithField("taskId", task.Id)
+
+	orgWindows, ok := windows[task.OrgId]
+	if !ok {
+		var err error
+		if orgWindows, err = services.GetOrgFreezeWindows(m.db, task.OrgId); err != nil {
+			logger.Errorf("get freeze windows error: %v", err)
+			return false
+		}
+		windows[task.OrgId] = orgWindows
+	}
+	if len(orgWindows) == 0 {
+		return false
+	}
+
+	env, err := services.GetEnvById(m.db, task.EnvId)
+	if err != nil {
+		logger.Errorf("get task environment %s: %v", task.EnvId, err)
+		return false
+	}
+	w, until := services.MatchFreezeWindow(orgWindows, env.ProjectId, env.Criticality, task.Type, time.Now())
+	if w == nil {
+		return false
+	}
+	logger.Debugf("freeze window %s is active until %s, task delayed", w.Id, until.Format(time.RFC3339))
+	return true
+}
@@ -23,6 +23,7 @@ import (
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/acarl005/stripansi"
@@ -35,7 +36,8 @@ const (
 )
 
 var (
-	ErrMaxTasksPerRunner = fmt.Errorf("concurrent limite")
+	ErrMaxTasksPerRunner    = fmt.Errorf("concurrent limite")
+	ErrProjectQuotaExceeded = fmt.Errorf("project quota exceeded")
 )
 
 type TaskManager struct {
@@ -43,12 +45,36 @@ type TaskManager struct {
 	db     *db.Session
 	logger logs.Logger
 
-	envRunningTask sync.Map       // 每个环境下正在执行的任务
-	runnerTaskNum  map[string]int // 每个 runner 正在执行的任务数量
+	envRunningTask sync.Map     // 每个环境下正在执行的任务
+	runningTasks   *taskCounter // 正在执行的任务数量统计
 
 	wg sync.WaitGroup // 等待执行任务协程退出的 wait group
 
-	maxTasksPerRunner int // 每个 runner 并发任务数量限制
+	maxTasksPerRunner     int // 每个 runner 并发任务数量限制
+	maxScanTasksPerRunner int // 每个 runner 并发扫描任务数量限制
+	maxScanTasksPerOrg    int // 每个组织并发扫描任务数量限制，0 表示不限制
+
+	billingSyncing int32 // 是否有正在执行的账单同步
+
+	registryChecking  int32     // 是否有正在执行的 registry 策略组更新检查
+	registryCheckedAt time.Time // 上次 registry 策略组更新检查的时间
+
+	orgPurgeCheckedAt time.Time // 上次检查到期组织数据清除的时间
+
+	autoDestroyRemindedAt time.Time // 上次检查环境自动销毁提醒的时间
+
+	envSuspendCheckedAt time.Time // 上次检查到期的环境定时任务暂停的时间
+
+	fleetDeployCheckedAt time.Time // 上次检查批量部署进度的时间
+
+	taskQueuedReasons sync.Map // 排队任务最近一次记录的排队原因，原因变化时才记录新的排队事件
+
+	runnerReconciling  int32     // 是否有正在执行的 runner 孤儿容器清理
+	runnerReconciledAt time.Time // 上次 runner 孤儿容器清理的时间
+
+	runnerPool            atomic.Value // 最近一次同步的 runner 池，[]*models.Runner
+	runnerHealthChecking  int32        // 是否有正在执行的 runner 健康检查
+	runnerHealthCheckedAt time.Time    // 上次 runner 健康检查的时间
 }
 
 func Start(serviceId string) {
@@ -75,9 +101,11 @@ func Start(serviceId string) {
 func (m *TaskManager) reset() {
 	m.db = db.Get()
 	m.envRunningTask = sync.Map{}
-	m.runnerTaskNum = make(map[string]int)
+	m.runningTasks = newTaskCounter()
 	m.wg = sync.WaitGroup{}
 	m.maxTasksPerRunner = services.GetRunnerMax()
+	m.maxScanTasksPerRunner = getMaxScanTasksPerRunner(m.maxTasksPerRunner)
+	m.maxScanTasksPerOrg = configs.Get().Policy.MaxScanTasksPerOrg
 }
 
 func (m *TaskManager) acquireLock(ctx context.Context) (<-chan struct{}, error) {
@@ -147,10 +175,27 @@ func (m *TaskManager) start() {
 		if err := m.processAutoDestroy(); err != nil {
 			m.logger.Errorf("process auto destroy error: %v", err)
 		}
+		// 恢复暂停已到期的环境定时任务
+		m.processEnvSuspendExpire()
+		// 发送环境即将自动销毁的提醒
+		m.processAutoDestroyReminder()
+
+		// 推进执行中的批量部署
+		m.processFleetDeploy()
 
 		m.processPendingTask(ctx)
 		// 执行所有偏移检测任务
 		m.beginCronDriftTask()
+		// 同步到期的云账单
+		m.processBillingSync(ctx)
+		// 检查 registry 策略组更新
+		m.processRegistryPolicyGroupCheck(ctx)
+		// 清除到期的组织数据
+		m.processOrgPurge()
+		// 清理 runner 上的孤儿容器及工作目录
+		m.processRunnerReconcile(ctx)
+		// 同步 runner 池并获取 runner 健康状态
+		m.processRunnerHealth(ctx)
 		select {
 		case <-ticker.C:
 			continue
@@ -165,8 +210,8 @@ func (m *TaskManager) start() {
 func (m *TaskManager) beginCronDriftTask() {
 	logger := m.logger.WithField("func", "beginCronDriftTask")
 	cronDriftEnvs := make([]*models.Env, 0)
-	query := m.db.Where("status = ? and open_cron_drift = ? and next_drift_task_time <= ?",
-		models.EnvStatusActive, true, time.Now())
+	query := m.db.Where("status = ? and open_cron_drift = ? and drift_suspended = ? and next_drift_task_time <= ?",
+		models.EnvStatusActive, true, false, time.Now())
 	if err := query.Model(&models.Env{}).Find(&cronDriftEnvs); err != nil {
 		logger.Error(err)
 		return
@@ -276,34 +321,41 @@ func (m *TaskManager) getPendingDeployTasks() []*models.Task {
 		return true
 	})
 
-	// 查询每个环境中最先创建的且状态为 pending 的任务
-	firstPendingQuery := m.db.Raw(
-		"SELECT env_id, MIN(created_at) AS created_at FROM iac_task "+
-			"WHERE status = ? GROUP BY env_id", models.TaskPending)
-	// 根据上一步查询到的 env_id + created_at 查询符合条件的任务，并取每个 env 下 id 最小的一条 task 记录
-	// (注意：直接通过 env_id + created_at 匹配可能同一个 env 会返回多条记录)
-	firstPendingIdQuery := m.db.Raw("SELECT iac_task.env_id, MIN(iac_task.id) AS task_id FROM iac_task, (?) AS fpt "+
-		"WHERE iac_task.env_id = fpt.env_id AND iac_task.created_at = fpt.created_at "+
-		"AND iac_task.status = ? GROUP BY env_id", firstPendingQuery.Expr(), models.TaskPending)
-
-	// 通过 id 查询完整任务信息
-	query := m.db.Model(&models.Task{}).Joins("JOIN (?) AS t ON t.task_id = iac_task.id", firstPendingIdQuery.Expr())
+	firstPendingIdQuery := firstPendingTaskIdQuery(m.db, time.Now())
 
-	if len(runningEnvs) > 0 {
-		// 过滤掉同一环境下有其他任务在执行的任务
-		query = query.Where("iac_task.env_id NOT IN (?)", runningEnvs)
+	limitedRunners := m.getLimitedRunner()
+	if len(m.availableRunners()) > 0 {
+		// 有其他可用的 runner 时不过滤，已达并发限制的 runner 上的任务会被调度到其他 runner
+		limitedRunners = nil
 	}
+	pendingQuery := func() *db.Session {
+		// 通过 id 查询完整任务信息
+		query := m.db.Model(&models.Task{}).Joins("JOIN (?) AS t ON t.task_id = iac_task.id", firstPendingIdQuery.Expr())
 
-	limitedRunners := m.getLimitedRunner()
-	if len(limitedRunners) > 0 {
-		// 查询时过滤掉己达并发限制的 runner
-		query = query.Where("runner_id NOT IN (?)", limitedRunners)
+		if len(runningEnvs) > 0 {
+			// 过滤掉同一环境下有其他任务在执行的任务
+			query = query.Where("iac_task.env_id NOT IN (?)", runningEnvs)
+		}
+		if len(limitedRunners) > 0 {
+			// 查询时过滤掉己达并发限制的 runner
+			query = query.Where("runner_id NOT IN (?)", limitedRunners)
+		}
+		return query
 	}
 
 	queryTaskLimit := 64 // 单次查询任务数量限制
+	queries, err := fairPendingQueries(pendingQuery, "iac_task.org_id", queryTaskLimit)
+	if err != nil {
+		logger.Panicf("find '%s' task orgs error: %v", models.TaskPending, err)
+	}
 	tasks := make([]*models.Task, 0)
-	if err := query.Limit(queryTaskLimit).Find(&tasks); err != nil {
-		logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
+	for _, query := range queries {
+		orgTasks := make([]*models.Task, 0)
+		// 按优先级调度，管理员可以调整排队中任务的优先级
+		if err := query.Order("iac_task.priority DESC, iac_task.created_at").Find(&orgTasks); err != nil {
+			logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
+		}
+		tasks = append(tasks, orgTasks...)
 	}
 
 	return tasks
@@ -312,32 +364,43 @@ func (m *TaskManager) getPendingDeployTasks() []*models.Task {
 func (m *TaskManager) getPendingScanTasks() []*models.ScanTask {
 	logger := m.logger
 
-	// 扫描类型任务支持多个并行执行，不会互相影响，这里获取所有处于 pending 状态的任务列表
-	query := m.db.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending)
+	limitedRunners := m.runningTasks.limitedRunners(m.maxTasksPerRunner, m.maxScanTasksPerRunner, true)
+	limitedOrgs := m.runningTasks.limitedOrgs(m.maxScanTasksPerOrg)
+	pendingQuery := func() *db.Session {
+		// 扫描类型任务支持多个并行执行，不会互相影响，这里获取所有处于 pending 状态的任务列表
+		query := m.db.Model(&models.ScanTask{}).Where("status = ? AND mirror = 0", models.TaskPending)
 
-	limitedRunners := m.getLimitedRunner()
-	if len(limitedRunners) > 0 {
-		// 查询时过滤掉己达并发限制的 runner
-		query = query.Where("runner_id NOT IN (?)", limitedRunners)
+		if len(limitedRunners) > 0 {
+			// 查询时过滤掉己达并发限制或扫描任务并发限制的 runner
+			query = query.Where("runner_id NOT IN (?)", limitedRunners)
+		}
+		if len(limitedOrgs) > 0 {
+			// 过滤掉扫描任务已达并发限制的组织
+			query = query.Where("org_id NOT IN (?)", limitedOrgs)
+		}
+		return query
 	}
 
 	queryTaskLimit := 64 // 单次查询任务数量限制
+	queries, err := fairPendingQueries(pendingQuery, "org_id", queryTaskLimit)
+	if err != nil {
+		logger.Panicf("find '%s' task orgs error: %v", models.TaskPending, err)
+	}
 	tasks := make([]*models.ScanTask, 0)
-	if err := query.Limit(queryTaskLimit).Find(&tasks); err != nil {
-		logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
+	for _, query := range queries {
+		orgTasks := make([]*models.ScanTask, 0)
+		// 按环境重要程度的优先级调度，避免大批量扫描时生产环境的扫描任务长时间排队
+		if err := query.Order("priority DESC, created_at").Find(&orgTasks); err != nil {
+			logger.Panicf("find '%s' task error: %v", models.TaskPending, err)
+		}
+		tasks = append(tasks, orgTasks...)
 	}
 
 	return tasks
 }
 
 func (m *TaskManager) getLimitedRunner() []string {
-	limitedRunners := make([]string, 0)
-	for runnerId, count := range m.runnerTaskNum {
-		if count >= m.maxTasksPerRunner {
-			limitedRunners = append(limitedRunners, runnerId)
-		}
-	}
-	return limitedRunners
+	return m.runningTasks.limitedRunners(m.maxTasksPerRunner, m.maxScanTasksPerRunner, false)
 }
 
 func (m *TaskManager) processPendingTask(ctx context.Context) {
@@ -355,7 +418,11 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 	for idx := range deployTasks {
 		tasks[scanTasksLen+idx] = deployTasks[idx]
 	}
+	// 开启公平调度时扫描任务和部署任务分别按组织及项目的权重排序，避免单个租户的任务占满 runner
+	copy(tasks, m.fairOrder(tasks[:scanTasksLen]))
+	copy(tasks[scanTasksLen:], m.fairOrder(tasks[scanTasksLen:]))
 
+	freezeWindows := make(map[models.Id][]*models.FreezeWindow)
 	for i := range tasks {
 		select {
 		case <-ctx.Done():
@@ -364,15 +431,36 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 		}
 
 		task := tasks[i]
+		// 部署冻结期间不启动匹配的任务(紧急放行的任务除外)，环境部署窗口外提交的任务等待窗口开始，
+		// 环境被其他用户锁定时任务保持排队
+		if t, ok := task.(*models.Task); ok {
+			if reason := m.taskWaitReason(t, freezeWindows); reason != "" {
+				m.recordTaskQueued(t, reason)
+				continue
+			}
+		}
+		// runner 不可用或并发已满时调度到其他负载最低的 runner
+		if t, ok := task.(*models.Task); ok {
+			m.balanceTaskRunner(t)
+		}
 		// 判断 runner 并发数量
-		n := m.runnerTaskNum[task.GetRunnerId()]
+		n := m.runningTasks.runnerTaskNum(task.GetRunnerId())
 		if n >= m.maxTasksPerRunner {
 			logger.WithField("count", n).Infof("runner %s: %v", task.GetRunnerId(), ErrMaxTasksPerRunner)
+			m.recordTaskQueued(task, fmt.Sprintf("runner %s: %v", task.GetRunnerId(), ErrMaxTasksPerRunner))
+			continue
+		}
+		// 判断扫描任务并发数量，避免扫描任务占满 runner 导致部署任务无法执行
+		if t, ok := task.(*models.ScanTask); ok &&
+			m.runningTasks.scanLimited(t, m.maxScanTasksPerRunner, m.maxScanTasksPerOrg) {
 			continue
 		}
 
 		if err := m.runTask(ctx, task); err != nil {
-			if errors.Is(err, errHasRunningTask)  {
+			if errors.Is(err, errHasRunningTask) {
+				m.recordTaskQueued(task, err.Error())
+				continue
+			} else if errors.Is(err, errTaskIsRunning) {
 				continue
 			} else {
 				logger.WithField("taskId", task.GetId()).Errorf("run task error: %s", err)
@@ -383,8 +471,35 @@ func (m *TaskManager) processPendingTask(ctx context.Context) {
 
 var (
 	errHasRunningTask = errors.New("environment has running task")
+	errTaskIsRunning  = errors.New("task is running")
 )
 
+// taskWaitReason 返回任务需要继续排队的原因，可以启动时返回空字符串
+func (m *TaskManager) taskWaitReason(task *models.Task, freezeWindows map[models.Id][]*models.FreezeWindow) string {
+	switch {
+	case m.taskFrozen(task, freezeWindows):
+		return "deployment freeze window"
+	case m.taskScheduled(task):
+		return "waiting for scheduled time"
+	case m.taskEnvLocked(task):
+		return "environment locked"
+	}
+	return ""
+}
+
+// recordTaskQueued 记录部署任务的排队事件，同一任务排队原因不变时只记录一次
+func (m *TaskManager) recordTaskQueued(task models.Tasker, reason string) {
+	t, ok := task.(*models.Task)
+	if !ok {
+		return
+	}
+	if v, loaded := m.taskQueuedReasons.Load(t.Id); loaded && v.(string) == reason {
+		return
+	}
+	m.taskQueuedReasons.Store(t.Id, reason)
+	services.RecordTaskEvent(m.db, t, models.TaskEvent{Type: models.TaskEventQueued, Status: t.Status, Message: reason})
+}
+
 func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 	logger := m.logger.WithField("taskId", task.GetId())
 
@@ -395,6 +510,10 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 			return errHasRunningTask
 		}
 	}
+	if !m.runningTasks.add(task) {
+		return errTaskIsRunning
+	}
+	m.taskQueuedReasons.Delete(task.GetId())
 
 	m.wg.Add(1)
 	go func() {
@@ -402,6 +521,7 @@ func (m *TaskManager) runTask(ctx context.Context, task models.Tasker) error {
 			if t, ok := task.(*models.Task); ok {
 				m.envRunningTask.Delete(t.EnvId)
 			}
+			m.runningTasks.done(task)
 			m.wg.Done()
 		}()
 
@@ -461,6 +581,12 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 	}
 
 	if !task.Started() { // 任务可能为己启动状态(比如异常退出后的任务恢复)，这里判断一下
+		// 外部依赖不可用时直接失败，避免任务执行到一半才出错
+		if err := services.CheckTaskDependencies(m.db, task); err != nil {
+			taskStartFailed(err)
+			return
+		}
+
 		// 先更新任务为 running 状态
 		// 极端情况下任务未执行好过重复执行，所以先设置状态，后发起调用
 		if err := changeTaskStatus(models.TaskRunning, "", false); err != nil {
@@ -476,10 +602,8 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 			return
 		}
 		if scanTask != nil {
-			if _, er := m.db.Model(&models.Env{}).
-				Where("id = ?", task.EnvId). //nolint
-				Update(&models.Env{LastScanTaskId: task.Id}); er != nil {
-				logger.Errorf("update env lastTaskId: %v", er)
+			if er := services.UpdateLastScanTask(m.db, consts.ScopeEnv, task.EnvId, scanTask); er != nil {
+				logger.Errorf("update env lastScanTaskId: %v", er)
 				return
 			}
 		}
@@ -508,6 +632,24 @@ func (m *TaskManager) doRunTask(ctx context.Context, task *models.Task) (startEr
 				Warnf("run task step error: %v", err)
 			break
 		}
+
+		if step.Type == common.TaskStepTfPlan {
+			if err := m.processTaskCostEstimate(task); err != nil {
+				logger.Errorf("process task cost estimate: %v", err)
+			}
+		}
+		if step.Type == common.TaskStepTfPlan && task.IsEffectTask() {
+			if err := m.processTaskGuardrails(task, step, steps); errors.Is(err, ErrProjectQuotaExceeded) {
+				// 项目设置为禁止超出配额的部署时 plan 步骤置为失败，不再执行后续的部署步骤
+				logger.Infof("task blocked: %v", err)
+				if er := services.ChangeTaskStepStatusAndUpdate(m.db, task, step, models.TaskStepFailed, err.Error()); er != nil {
+					logger.Errorf("change step status: %v", er)
+				}
+				break
+			} else if err != nil {
+				logger.Errorf("process task guardrails: %v", err)
+			}
+		}
 	}
 
 	if err := m.runTaskStepsDoneActions(ctx, task.Id); err != nil {
@@ -543,7 +685,11 @@ func (m *TaskManager) processStartStep(
 			return errors.Wrapf(err, "get task %s", task.Id.String()), nil
 		}
 		req.ContainerId = tTask.ContainerId
+		// 从失败步骤重试的任务没有容器，runner 需要在新容器中复用已有的工作目录继续执行
+		req.Resume = req.ContainerId == "" && step.Index > 0
 	}
+	// 步骤类型单独设置了超时时间时由 runner 按该时间处理步骤超时
+	req.Timeout = services.TaskStepTimeout(task, step.Type)
 
 	runErr = m.runTaskStep(ctx, req, task, step)
 	if err := m.processStepDone(task, step); err != nil {
@@ -553,7 +699,7 @@ func (m *TaskManager) processStartStep(
 
 	if runErr != nil {
 		logger.Infof("run task step err: %v", runErr)
-		if errors.Is(runErr, ErrTaskStepRejected)  {
+		if errors.Is(runErr, ErrTaskStepRejected) || errors.Is(runErr, ErrTaskStepCancelled) {
 			return nil, runErr
 		}
 
@@ -571,6 +717,61 @@ func (m *TaskManager) processStartStep(
 	return nil, nil
 }
 
+// processTaskGuardrails plan 完成后检查环境资源规模限制，超出限制时后续的部署步骤必须经过审批
+func (m *TaskManager) processTaskGuardrails(task *models.Task, planStep *models.TaskStep, steps []*models.TaskStep) error {
+	bs, err := readIfExist(task.PlanJsonPath())
+	if err != nil {
+		return err
+	}
+	violations, err := services.CheckTaskGuardrails(task, bs)
+	if err != nil {
+		return err
+	}
+	// 估算费用超出环境预算时同样需要组织管理员审批
+	env, er := services.GetEnvById(m.db, task.EnvId)
+	if er != nil {
+		return er
+	}
+	if v := services.CheckEnvBudget(env, task); v != "" {
+		violations = append(violations, v)
+	}
+	// 超出项目配额时按项目的设置需要组织管理员审批或禁止部署
+	quotaViolations, action, er := services.CheckTaskProjectQuota(m.db, env, task, bs)
+	if er != nil {
+		return er
+	}
+	if len(quotaViolations) > 0 && action == models.ProjectQuotaActionBlock {
+		return errors.Wrap(ErrProjectQuotaExceeded, strings.Join(quotaViolations, "; "))
+	}
+	violations = append(violations, quotaViolations...)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	m.logger.WithField("taskId", task.Id).Infof("task exceeds guardrails: %v", violations)
+	if err := services.RequireTaskGuardrailApproval(m.db, task, planStep.Index, violations); err != nil {
+		return err
+	}
+	for _, s := range steps {
+		if s.Index > planStep.Index && (s.Type == common.TaskStepTfApply || s.Type == common.TaskStepTfDestroy) {
+			s.MustApproval = true
+		}
+	}
+	return nil
+}
+
+// processTaskCostEstimate plan 完成后根据组织的价格配置估算任务的费用变化
+func (m *TaskManager) processTaskCostEstimate(task *models.Task) error {
+	bs, err := readIfExist(task.PlanJsonPath())
+	if err != nil {
+		return err
+	}
+	if _, er := services.EstimateTaskCost(m.db, task, bs); er != nil {
+		return er
+	}
+	return nil
+}
+
 func (m *TaskManager) processStepDone(task *models.Task, step *models.TaskStep) error {
 	dbSess := m.db
 	processScanResult := func() error {
@@ -674,6 +875,9 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 		if err := taskDoneProcessState(dbSess, task); err != nil {
 			logger.Errorf("process task state: %v", err)
 		}
+		if err := services.SaveTaskStateVersions(dbSess, task); err != nil {
+			logger.Errorf("save task state versions: %v", err)
+		}
 
 		// 任务执行成功才会进行 changes 统计，失败的话基于 plan 文件进行变更统计是不准确的
 		// (terraform 执行 apply 失败也不会输出资源变更情况)
@@ -684,6 +888,12 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 		}
 	}
 
+	if lastStep.Status == models.TaskComplete && task.Type == models.TaskTypePlan {
+		if _, err := services.SaveTaskPlanArtifact(dbSess, task); err != nil {
+			logger.Errorf("save task plan artifact: %v", err)
+		}
+	}
+
 	if lastStep.Status == models.TaskComplete && task.IsDriftTask {
 		if err := taskDoneProcessDriftTask(logger, dbSess, task); err != nil {
 			logger.Errorf("process drafit task done: %v", err)
@@ -695,6 +905,12 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 		logger.Errorf("update task status error: %v", err)
 	}
 
+	if task.IsEffectTask() && lastStep.Status == models.TaskComplete {
+		if err := services.UpdateEnvMonthlyCost(dbSess, task); err != nil {
+			logger.Errorf("update env monthly cost: %v", err)
+		}
+	}
+
 	if task.IsEffectTask() {
 		// 注意：环境的 lastResTaskId 必须在资源漂移信息统计后执行
 		if err = services.UpdateEnvModel(dbSess, task.EnvId, models.Env{LastResTaskId: task.Id}); err != nil {
@@ -703,6 +919,10 @@ func (m *TaskManager) processTaskDone(taskId models.Id) { //nolint:cyclop
 			// 注意: 该步骤需要在环境状态被更新之后执行
 			logger.Errorf("process auto destroy: %v", err)
 		}
+
+		if err := taskDoneProcessRollback(dbSess, task, lastStep); err != nil {
+			logger.Errorf("process auto rollback: %v", err)
+		}
 	}
 }
 
@@ -753,12 +973,17 @@ func (m *TaskManager) runTaskStep(
 	}
 
 	if err := waitTaskStepDone(ctx, m.db, task, step, taskReq); err != nil {
+		if step.Status == models.TaskStepCancelled {
+			return ErrTaskStepCancelled
+		}
 		return err
 	}
 
 	switch step.Status {
 	case models.TaskStepComplete:
 		return nil
+	case models.TaskStepCancelled:
+		return ErrTaskStepCancelled
 	case models.TaskStepFailed:
 		message := "failed"
 		if step.Message != "" {
@@ -796,7 +1021,7 @@ func waitTaskStepApprove(ctx context.Context, db *db.Session, task *models.Task,
 			}
 
 			logger.Errorf("wait task step approve error: %v", err)
-			if !errors.Is(err, ErrTaskStepRejected) {
+			if !errors.Is(err, ErrTaskStepRejected) && !errors.Is(err, ErrTaskStepCancelled) {
 				changeStepStatus(models.TaskStepFailed, err.Error(), step)
 			}
 			return nil, err
@@ -837,6 +1062,13 @@ func waitTaskStepDone(
 
 		switch step.Status {
 		case models.TaskStepPending, models.TaskApproving:
+			// 任务已被请求取消时不再启动新的步骤
+			if cancelled, err := services.IsTaskCancelRequested(db, task.Id); err != nil {
+				return err
+			} else if cancelled {
+				return services.CancelUnstartedTaskStep(db, step)
+			}
+
 			// 先将步骤置为 running 状态，然后再发起调用，保证步骤不会重复执行
 			changeStepStatus(models.TaskStepRunning, "", step)
 			if cid, retryAble, err := StartTaskStep(taskReq, *step); err != nil {
@@ -858,6 +1090,10 @@ func waitTaskStepDone(
 				if err := services.UpdateTaskContainerId(db, models.Id(taskReq.TaskId), cid); err != nil {
 					panic(errors.Wrapf(err, "update task %s container id", taskReq.TaskId))
 				}
+				if cid != taskReq.ContainerId {
+					services.RecordTaskEvent(db, task, models.TaskEvent{Type: models.TaskEventContainerAssigned,
+						Message: fmt.Sprintf("container %s on runner %s", cid, task.RunnerId)})
+				}
 			}
 		case models.TaskStepRunning:
 			stepResult, err := WaitTaskStep(ctx, db, task, step)
@@ -873,11 +1109,21 @@ func waitTaskStepDone(
 				changeStepStatus(models.TaskStepFailed, message, step)
 				return nil
 			}
-			if stepResult.Status == models.TaskStepFailed || stepResult.Status == models.TaskStepTimeout {
-				if task.RetryAble && step.RetryNumber > 0 && step.CurrentRetryCount < step.RetryNumber {
-					step.NextRetryTime = time.Now().Unix() + int64(task.RetryDelay)
+			// 被取消的步骤不需要重试
+			if (stepResult.Status == models.TaskStepFailed || stepResult.Status == models.TaskStepTimeout) &&
+				step.Status != models.TaskStepCancelled {
+				logContent := stepResult.Result.LogContent
+				attemptLog := services.StepAttemptLog(db, step, logContent)
+				if retry, delay, pattern := services.NextStepRetry(task, step, attemptLog); retry {
+					// 重试前记录本次失败的执行，重试的步骤重新计算开始及结束时间
+					services.RecordTaskStepAttempt(db, task, step, pattern, delay, len(logContent))
+					step.StartAt, step.EndAt = nil, nil
+					step.NextRetryTime = time.Now().Unix() + int64(delay)
 					step.CurrentRetryCount += 1
-					message := fmt.Sprintf("Task step start failed and try again. The current number of retries is %d", step.CurrentRetryCount)
+					message := fmt.Sprintf("Task step failed and try again in %ds. The current number of retries is %d", delay, step.CurrentRetryCount)
+					if pattern != "" {
+						message = fmt.Sprintf("Task step failed with transient error and try again in %ds. The current number of retries is %d", delay, step.CurrentRetryCount)
+					}
 					changeStepStatus(models.TaskStepPending, message, step)
 				}
 			}
@@ -902,17 +1148,19 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 	runnerEnv := runner.TaskEnv{
 		Id:              string(task.EnvId),
 		Workdir:         task.Workdir,
+		Workdirs:        task.Workdirs,
 		TfVarsFile:      task.TfVarsFile,
 		Playbook:        task.Playbook,
 		PlayVarsFile:    task.PlayVarsFile,
 		TfVersion:       task.TfVersion,
+		EngineType:      task.EngineType,
 		EnvironmentVars: make(map[string]string),
 		TerraformVars:   make(map[string]string),
 		AnsibleVars:     make(map[string]string),
 	}
 
 	if runnerEnv.TfVersion == "" {
-		runnerEnv.TfVersion = consts.DefaultTerraformVersion
+		runnerEnv.TfVersion = runner.DefaultEngineVersion(runnerEnv.EngineType)
 	}
 	if err := buildTaskReqEnvVars(&runnerEnv, task.Variables); err != nil {
 		return nil, err
@@ -946,11 +1194,26 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 		Timeout:         task.StepTimeout,
 		StopOnViolation: task.StopOnViolation,
 		ContainerId:     task.ContainerId,
+		Labels: taskContainerLabels(task.OrgId, task.ProjectId, task.TplId, task.EnvId,
+			task.Id, task.Type),
 	}
 
 	if err := runTaskReqAddSysEnvs(taskReq); err != nil {
 		return nil, err
 	}
+	if err := services.SetRunTaskReqModule(taskReq); err != nil {
+		return nil, errors.Wrapf(err, "get task '%s' module", task.Id)
+	}
+
+	if task.PlanArtifactId != "" {
+		artifact, err := services.GetEnvPlanArtifact(dbSess, task.EnvId, task.PlanArtifactId)
+		if err != nil {
+			return nil, errors.Wrapf(err, "get task '%s' plan artifact", task.Id)
+		}
+		if taskReq.SavedPlan, err = services.ReadPlanArtifact(artifact, true); err != nil {
+			return nil, errors.Wrapf(err, "read plan artifact '%s'", artifact.Id)
+		}
+	}
 
 	if scanStep, err := services.GetTaskScanStep(dbSess, task.Id); err == nil && scanStep != nil {
 		policies, err := services.GetTaskPolicies(dbSess, &task)
@@ -958,11 +1221,15 @@ func buildRunTaskReq(dbSess *db.Session, task models.Task) (taskReq *runner.RunT
 			return nil, errors.Wrapf(err, "get task '%s' policies", task.Id)
 		}
 		taskReq.Policies = policies
+		taskReq.BaseScanTaskId = string(services.GetScanBaseTaskId(dbSess, task.TplId, task.EnvId, task.Id))
 	}
 
 	if pk != "" {
 		taskReq.PrivateKey = utils.EncodeSecretVar(pk, true)
 	}
+	if taskReq.RepoPrivateKey, err = services.GetRepoPrivateKey(dbSess, task.RepoKeyId); err != nil {
+		return nil, errors.Wrapf(err, "get task '%s' repo key", task.Id)
+	}
 
 	return taskReq, nil
 }
@@ -983,6 +1250,7 @@ func (m *TaskManager) processAutoDestroy() error {
 	err := dbSess.Model(&models.Env{}).
 		Where("status IN (?)", []string{models.EnvStatusActive, models.EnvStatusFailed}).
 		Where("auto_destroy_task_id = ''").
+		Where("auto_destroy_suspended = ?", false).
 		Where("auto_destroy_at <= ?", time.Now()).
 		Order("auto_destroy_at").Limit(limit).Find(&destroyEnvs)
 
@@ -1077,15 +1345,12 @@ func (m *TaskManager) doRunScanTask(ctx context.Context, task *models.ScanTask)
 	}
 
 	if task.Type == common.TaskTypeEnvScan || (task.Type == common.TaskTypeScan && task.EnvId != "") {
-		if err := services.UpdateEnvModel(m.db, task.EnvId,
-			models.Env{LastScanTaskId: task.Id}); err != nil {
+		if err := services.UpdateLastScanTask(m.db, consts.ScopeEnv, task.EnvId, task); err != nil {
 			logger.Errorf("update env lastScanTaskId: %v", err)
 			return
 		}
 	} else if task.Type == common.TaskTypeTplScan || (task.Type == common.TaskTypeScan && task.EnvId == "") { // 模板扫描
-		if _, err := m.db.
-			Where("id = ?", task.TplId). //nolint
-			Update(&models.Template{LastScanTaskId: task.Id}); err != nil {
+		if err := services.UpdateLastScanTask(m.db, consts.ScopeTemplate, task.TplId, task); err != nil {
 			logger.Errorf("update template lastScanTaskId: %v", err)
 			return
 		}
@@ -1201,6 +1466,22 @@ func buildTaskReqEnvVars(env *runner.TaskEnv, variables models.TaskVariables) er
 	return nil
 }
 
+// taskContainerLabels 任务容器的标签，用于在 runner 宿主机上关联容器与任务
+func taskContainerLabels(orgId, projectId, tplId, envId, taskId models.Id, taskType string) map[string]string {
+	labels := map[string]string{
+		"task-id":   string(taskId),
+		"task-type": taskType,
+	}
+	for k, v := range map[string]models.Id{
+		"org-id": orgId, "project-id": projectId, "tpl-id": tplId, "env-id": envId,
+	} {
+		if v != "" {
+			labels[k] = string(v)
+		}
+	}
+	return labels
+}
+
 // buildScanTaskReq 构建扫描任务 RunTaskReq 对象
 func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.TaskStep) (taskReq *runner.RunTaskReq, err error) {
 	taskReq = &runner.RunTaskReq{
@@ -1213,6 +1494,8 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 		StopOnViolation: true,
 		DockerImage:     task.Flow.Image,
 		ContainerId:     task.ContainerId,
+		Labels: taskContainerLabels(task.OrgId, task.ProjectId, task.TplId, task.EnvId,
+			task.Id, task.Type),
 	}
 
 	runnerEnv := runner.TaskEnv{
@@ -1222,12 +1505,13 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 		Playbook:        task.Playbook,
 		PlayVarsFile:    task.PlayVarsFile,
 		TfVersion:       task.TfVersion,
+		EngineType:      task.EngineType,
 		EnvironmentVars: make(map[string]string),
 		TerraformVars:   make(map[string]string),
 		AnsibleVars:     make(map[string]string),
 	}
 	if runnerEnv.TfVersion == "" {
-		runnerEnv.TfVersion = consts.DefaultTerraformVersion
+		runnerEnv.TfVersion = runner.DefaultEngineVersion(runnerEnv.EngineType)
 	}
 	if err := buildTaskReqEnvVars(&runnerEnv, task.Variables); err != nil {
 		return nil, err
@@ -1248,12 +1532,19 @@ func buildScanTaskReq(dbSess *db.Session, task *models.ScanTask, step *models.Ta
 	if err := runTaskReqAddSysEnvs(taskReq); err != nil {
 		return nil, err
 	}
+	if err := services.SetRunTaskReqModule(taskReq); err != nil {
+		return nil, errors.Wrapf(err, "get scan task '%s' module", task.Id)
+	}
 
 	if step.Type == models.TaskStepOpaScan || step.Type == models.TaskStepEnvScan || step.Type == models.TaskStepTplScan {
 		taskReq.Policies, err = services.GetTaskPolicies(dbSess, task)
 		if err != nil {
 			return nil, errors.Wrapf(err, "get scan task '%s' policies", task.Id)
 		}
+		taskReq.BaseScanTaskId = string(services.GetScanBaseTaskId(dbSess, task.TplId, task.EnvId, task.Id))
+	}
+	if taskReq.RepoPrivateKey, err = services.GetRepoPrivateKey(dbSess, task.RepoKeyId); err != nil {
+		return nil, errors.Wrapf(err, "get task '%s' repo key", task.Id)
 	}
 
 	return taskReq, nil
@@ -1388,6 +1679,8 @@ func runTaskReqAddSysEnvs(req *runner.RunTaskReq) error {
 		sysEnvs["CLOUDIAC_ENV_RESOURCES"] = fmt.Sprintf("%d", resCount)
 		// CLOUDIAC_TF_VERSION	当前任务使用的 terraform 版本号(eg. 0.14.11)
 		sysEnvs["CLOUDIAC_TF_VERSION"] = req.Env.TfVersion
+		// CLOUDIAC_ENGINE_TYPE	当前任务使用的执行引擎(terraform/opentofu)
+		sysEnvs["CLOUDIAC_ENGINE_TYPE"] = req.Env.EngineType
 	}
 
 	req.SysEnvironments = sysEnvs
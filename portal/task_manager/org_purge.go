@@ -0,0 +1,42 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/services"
+	"time"
+)
+
+// OrgPurgeCheckInterval 检查到期组织数据清除的时间间隔
+const OrgPurgeCheckInterval = 10 * time.Minute
+
+// processOrgPurge 清除已过保留期的组织数据，每个组织的清除在独立事务中执行
+func (m *TaskManager) processOrgPurge() {
+	if time.Since(m.orgPurgeCheckedAt) < OrgPurgeCheckInterval {
+		return
+	}
+	m.orgPurgeCheckedAt = time.Now()
+
+	logger := m.logger.WithField("func", "processOrgPurge")
+	orgs, err := services.GetDueOrgPurges(m.db, time.Now())
+	if err != nil {
+		logger.Errorf("get due org purges error: %v", err)
+		return
+	}
+
+	for _, org := range orgs {
+		tx := m.db.Begin()
+		cert, err := services.PurgeOrgData(tx, org)
+		if err != nil {
+			_ = tx.Rollback()
+			logger.WithField("orgId", org.Id).Errorf("purge org data error: %v", err)
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			_ = tx.Rollback()
+			logger.WithField("orgId", org.Id).Errorf("commit org purge error: %v", err)
+			continue
+		}
+		logger.WithField("orgId", org.Id).Infof("org data purged, certificate %s", cert.Id)
+	}
+}
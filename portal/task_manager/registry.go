@@ -0,0 +1,58 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/services"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// RegistryCheckInterval registry 策略组更新检查的时间间隔
+const RegistryCheckInterval = 6 * time.Hour
+
+// processRegistryPolicyGroupCheck 定期检查从 registry 导入的策略组是否有新版本，同一时间只会有一个检查协程运行
+func (m *TaskManager) processRegistryPolicyGroupCheck(ctx context.Context) {
+	if time.Since(m.registryCheckedAt) < RegistryCheckInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&m.registryChecking, 0, 1) {
+		return
+	}
+	m.registryCheckedAt = time.Now()
+
+	logger := m.logger.WithField("func", "processRegistryPolicyGroupCheck")
+	groups, err := services.GetRegistryPolicyGroups(m.db)
+	if err != nil {
+		logger.Errorf("get registry policy groups error: %v", err)
+		atomic.StoreInt32(&m.registryChecking, 0)
+		return
+	}
+	if len(groups) == 0 {
+		atomic.StoreInt32(&m.registryChecking, 0)
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer atomic.StoreInt32(&m.registryChecking, 0)
+
+		for _, g := range groups {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			hasUpdate, err := services.CheckRegistryPolicyGroupUpdate(m.db, g)
+			if err != nil {
+				logger.WithField("groupId", g.Id).Warnf("check registry policy group update error: %v", err)
+				continue
+			}
+			if hasUpdate {
+				logger.WithField("groupId", g.Id).Infof("new version %s available for %s", g.LatestVersion, g.RegistryRef)
+			}
+		}
+	}()
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/models"
+	"cloudiac/portal/services"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// RunnerHealthCheckInterval 同步 runner 池及获取 runner 健康状态的时间间隔
+const RunnerHealthCheckInterval = 30 * time.Second
+
+// processRunnerHealth 定期同步 consul 中的 runner 到 runner 池并获取各 runner 的健康状态，同一时间只会有一个检查协程运行
+func (m *TaskManager) processRunnerHealth(ctx context.Context) {
+	if time.Since(m.runnerHealthCheckedAt) < RunnerHealthCheckInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&m.runnerHealthChecking, 0, 1) {
+		return
+	}
+	m.runnerHealthCheckedAt = time.Now()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer atomic.StoreInt32(&m.runnerHealthChecking, 0)
+
+		logger := m.logger.WithField("func", "processRunnerHealth")
+		actives, err := services.RunnerSearch()
+		if err != nil {
+			logger.Errorf("search runners error: %v", err)
+			return
+		}
+		pool, err := services.SyncRunnerPool(m.db, actives)
+		if err != nil {
+			logger.Errorf("sync runner pool error: %v", err)
+			return
+		}
+
+		for _, r := range pool {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+			if r.Status != models.RunnerOnline {
+				continue
+			}
+			health, err := services.FetchRunnerHealth(r)
+			if err != nil {
+				logger.WithField("runnerId", r.ServiceId).Warnf("fetch runner health error: %v", err)
+			}
+			if err := services.UpdateRunnerHealth(m.db, r, health, err); err != nil {
+				logger.WithField("runnerId", r.ServiceId).Errorf("update runner health error: %v", err)
+			}
+		}
+		m.runnerPool.Store(pool)
+	}()
+}
+
+// availableRunners 返回 runner 池中可用且未达到并发限制的 runner，
+// 正在运行的任务数量取 runner 上报的数量与当前 portal 统计的数量中的较大值
+func (m *TaskManager) availableRunners() []*models.Runner {
+	pool, _ := m.runnerPool.Load().([]*models.Runner)
+	now := time.Now()
+	result := make([]*models.Runner, 0, len(pool))
+	for _, r := range pool {
+		if !r.Available(now) {
+			continue
+		}
+		n := m.runningTasks.runnerTaskNum(r.ServiceId)
+		if n >= m.maxTasksPerRunner {
+			continue
+		}
+		c := *r
+		if n > c.RunningTasks {
+			c.RunningTasks = n
+		}
+		result = append(result, &c)
+	}
+	return result
+}
+
+// balanceTaskRunner 任务分配的 runner 不可用(禁用或不健康)或已达到并发限制时，
+// 将还未开始执行的任务调度到负载最低的可用 runner，调度后的 runner 需要对任务所在的组织及项目可用且包含任务要求的全部标签，
+// 优先选择同时包含云模板 runner 标签的 runner
+func (m *TaskManager) balanceTaskRunner(task *models.Task) {
+	// 从失败步骤重试的任务需要复用原 runner 上的工作目录
+	if task.CurrStep > 0 || task.ContainerId != "" || task.StepRetryCount > 0 {
+		return
+	}
+	pool, _ := m.runnerPool.Load().([]*models.Runner)
+	if len(pool) == 0 {
+		// 还没有获取到 runner 池信息
+		return
+	}
+
+	now := time.Now()
+	full := m.runningTasks.runnerTaskNum(task.RunnerId) >= m.maxTasksPerRunner
+	available := false
+	for _, r := range pool {
+		if r.ServiceId == task.RunnerId {
+			available = r.Available(now)
+			break
+		}
+	}
+	if available && !full {
+		return
+	}
+
+	logger := m.logger.WithField("taskId", task.Id).WithField("func", "balanceTaskRunner")
+	var tplTags []string
+	if task.TplId != "" {
+		tpl, err := services.GetTemplateById(m.db, task.TplId)
+		if err != nil {
+			logger.Warnf("get template error: %v", err)
+			return
+		}
+		// 云模板指定了默认 runner 时只在该 runner 不可用时才调度到其他 runner
+		if available && tpl.DefaultRunnerId == task.RunnerId {
+			return
+		}
+		tplTags = tpl.RunnerTags
+	}
+
+	candidates := make([]*models.Runner, 0)
+	for _, r := range m.availableRunners() {
+		if r.ServiceId != task.RunnerId {
+			candidates = append(candidates, r)
+		}
+	}
+	affinity := services.RunnerAffinity{OrgId: task.OrgId, ProjectId: task.ProjectId, Tags: task.RunnerTags}
+	var picked *models.Runner
+	if len(tplTags) > 0 {
+		tplAffinity := affinity
+		tplAffinity.Tags = append(append([]string{}, task.RunnerTags...), tplTags...)
+		picked = services.PickRunnerFor(candidates, tplAffinity, now)
+	}
+	if picked == nil {
+		picked = services.PickRunnerFor(candidates, affinity, now)
+	}
+	if picked == nil {
+		return
+	}
+	if err := services.UpdateTaskRunnerId(m.db, task.Id, picked.ServiceId); err != nil {
+		logger.Errorf("update task runner error: %v", err)
+		return
+	}
+	logger.Infof("move task from runner %s to %s", task.RunnerId, picked.ServiceId)
+	task.RunnerId = picked.ServiceId
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package task_manager
+
+import (
+	"cloudiac/portal/services"
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// RunnerReconcileInterval runner 孤儿容器及工作目录清理的时间间隔
+const RunnerReconcileInterval = 30 * time.Minute
+
+// processRunnerReconcile 定期清理各 runner 上任务已结束或不存在的容器及工作目录，同一时间只会有一个清理协程运行
+func (m *TaskManager) processRunnerReconcile(ctx context.Context) {
+	if time.Since(m.runnerReconciledAt) < RunnerReconcileInterval {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&m.runnerReconciling, 0, 1) {
+		return
+	}
+	m.runnerReconciledAt = time.Now()
+
+	logger := m.logger.WithField("func", "processRunnerReconcile")
+	runners, err := services.RunnerSearch()
+	if err != nil {
+		logger.Errorf("search runners error: %v", err)
+		atomic.StoreInt32(&m.runnerReconciling, 0)
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer atomic.StoreInt32(&m.runnerReconciling, 0)
+
+		for _, r := range runners {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			rLogger := logger.WithField("runnerId", r.ID)
+			resp, err := services.ReconcileRunner(m.db, r.ID)
+			if err != nil {
+				rLogger.Warnf("reconcile runner error: %v", err)
+				continue
+			}
+			if len(resp.RemovedContainers) > 0 || len(resp.RemovedWorkspaces) > 0 {
+				rLogger.Infof("removed orphan containers: %v, workspaces: %v",
+					resp.RemovedContainers, resp.RemovedWorkspaces)
+			}
+			for _, msg := range resp.Errors {
+				rLogger.Warnf("cleanup error: %s", msg)
+			}
+		}
+	}()
+}
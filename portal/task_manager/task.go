@@ -48,6 +48,13 @@ func StartTaskStep(taskReq runner.RunTaskReq, step models.TaskStep) (
 	taskReq.Step = step.Index
 	taskReq.StepType = step.Type
 	taskReq.StepArgs = step.Args
+	taskReq.StepImage = step.Image
+	taskReq.StepArtifacts = step.Artifacts
+	if step.Workdir != "" {
+		// 多工作目录云模板的步骤在各自的工作目录中执行，并使用独立的 state
+		taskReq.Env.Workdir = step.Workdir
+		taskReq.StateStore.Path = step.StatePath(taskReq.StateStore.Path)
+	}
 
 	respData, err := utils.HttpService(requestUrl, "POST", header, taskReq,
 		int(consts.RunnerConnectTimeout.Seconds()), int(consts.RunnerConnectTimeout.Seconds())*10)
@@ -89,7 +96,8 @@ func WaitTaskStep(ctx context.Context, sess *db.Session, task *models.Task, step
 	}
 
 	// runner 端己经增加了超时处理，portal 端的超时暂时保留，但时间设置为给定时间的 2 倍
-	taskDeadline := time.Time(*step.StartAt).Add(time.Duration(task.StepTimeout*2) * time.Second)
+	stepTimeout := services.TaskStepTimeout(task, step.Type)
+	taskDeadline := time.Time(*step.StartAt).Add(time.Duration(stepTimeout*2) * time.Second)
 
 	// 当前版本实现中需要 portal 主动连接到 runner 获取状态
 	err = utils.RetryFunc(10, time.Second*5, func(retryN int) (retry bool, er error) {
@@ -160,6 +168,13 @@ func saveTaskStepResultFiles(task *models.Task, step *models.TaskStep, result ru
 			logger.WithField("path", path).Errorf("write task plan json error: %v", err)
 		}
 	}
+	// 二进制 plan 文件会保留在工作目录中，只在 plan 步骤结束时保存
+	if len(result.TfPlanFile) > 0 && step.Type == models.TaskStepPlan {
+		path := task.PlanFilePath()
+		if err := logstorage.Get().Write(path, result.TfPlanFile); err != nil {
+			logger.WithField("path", path).Errorf("write task plan file error: %v", err)
+		}
+	}
 	if len(result.TfScanJson) > 0 {
 		path := task.TfParseJsonPath()
 		if err := logstorage.Get().Write(path, result.TfScanJson); err != nil {
@@ -172,6 +187,23 @@ func saveTaskStepResultFiles(task *models.Task, step *models.TaskStep, result ru
 			logger.WithField("path", path).Errorf("write task scan result json error: %v", err)
 		}
 	}
+	if len(result.TfValidateJson) > 0 {
+		path := task.TfValidateJsonPath()
+		if err := logstorage.Get().Write(path, result.TfValidateJson); err != nil {
+			logger.WithField("path", path).Errorf("write task validate result json error: %v", err)
+		}
+	}
+	// 决策日志文件会保留在工作目录中，只在扫描步骤结束时导出，避免后续步骤重复导出
+	if len(result.DecisionLogJson) > 0 && services.IsScanStep(step.Type) {
+		if err := services.ExportDecisionLogs(task, nil, result.DecisionLogJson); err != nil {
+			logger.Errorf("export policy decision logs error: %v", err)
+		}
+	}
+	if len(result.Artifacts) > 0 {
+		if err := services.SaveTaskArtifacts(db.Get(), task, step, result.Artifacts); err != nil {
+			logger.Errorf("save task artifacts error: %v", err)
+		}
+	}
 }
 
 func newReadMessageErr(err error) error {
@@ -313,7 +345,8 @@ func pullTaskStepStatusLoop(
 }
 
 var (
-	ErrTaskStepRejected = fmt.Errorf("rejected")
+	ErrTaskStepRejected  = fmt.Errorf("rejected")
+	ErrTaskStepCancelled = fmt.Errorf("cancelled")
 )
 
 // WaitTaskStepApprove
@@ -339,6 +372,16 @@ func WaitTaskStepApprove(ctx context.Context, dbSess *db.Session, taskId models.
 			} else if taskStep.IsApproved() {
 				return taskStep, nil
 			}
+
+			// 等待审批时任务被取消
+			if cancelled, err := services.IsTaskCancelRequested(dbSess, taskId); err != nil {
+				return nil, err
+			} else if cancelled {
+				if err := services.CancelUnstartedTaskStep(dbSess, taskStep); err != nil {
+					return nil, err
+				}
+				return nil, ErrTaskStepCancelled
+			}
 		}
 	}
 }
@@ -398,6 +441,11 @@ func WaitScanTaskStep(ctx context.Context, sess *db.Session, task *models.ScanTa
 			logger.WithField("path", path).Errorf("write task scan result json error: %v", err)
 		}
 	}
+	if len(stepResult.Result.DecisionLogJson) > 0 && services.IsScanStep(step.Type) {
+		if err := services.ExportDecisionLogs(nil, task, stepResult.Result.DecisionLogJson); err != nil {
+			logger.Errorf("export policy decision logs error: %v", err)
+		}
+	}
 	// 合规任务暂时不需要发送消息
 	//if stepResult.Status != models.TaskRunning && task.Extra.Source == consts.WorkFlow {
 	//	k := kafka.Get()
@@ -6,6 +6,7 @@ import (
 	"cloudiac/common"
 	"cloudiac/policy"
 	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/db"
 	"cloudiac/portal/models"
 	"cloudiac/portal/services"
@@ -108,11 +109,18 @@ func taskDoneProcessDriftTask(logger logs.Logger, dbSess *db.Session, task *mode
 						services.InsertOrUpdateCronTaskInfo(db.Get(), driftInfo)
 					}
 				}
+				// 保存偏移历史，用于统计资源及环境的偏移频率
+				if err := services.SaveDriftHistory(dbSess, task, driftInfoMap, time.Now()); err != nil {
+					logger.Errorf("save drift history: %v", err)
+				}
 			}
 
 			if len(driftInfoMap) > 0 {
 				// 发送邮件通知
 				services.TaskStatusChangeSendMessage(task, consts.EvenvtCronDrift)
+				if err := taskDoneProcessDriftRemediation(dbSess, env, task); err != nil {
+					logger.Errorf("process drift remediation: %v", err)
+				}
 			}
 		}
 	}
@@ -154,6 +162,77 @@ func taskDoneProcessAutoDestroy(dbSess *db.Session, task *models.Task) error {
 	return nil
 }
 
+// taskDoneProcessRollback apply 失败后基于最后一次部署成功的配置创建回滚任务
+func taskDoneProcessRollback(dbSess *db.Session, task *models.Task, lastStep *models.TaskStep) error {
+	env, err := services.GetEnv(dbSess, task.EnvId)
+	if err != nil {
+		return errors.Wrapf(err, "get env '%s'", task.EnvId)
+	}
+	if !services.NeedRollback(env, task, lastStep) {
+		return nil
+	}
+
+	tx := dbSess.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	rollbackTask, er := services.CreateRollbackTask(tx, env, task)
+	if er != nil {
+		_ = tx.Rollback()
+		if er.Code() == e.TaskNotExists {
+			logs.Get().WithField("taskId", task.Id).Infof("no successful apply task, skip rollback")
+			return nil
+		}
+		return errors.Wrapf(er, "create rollback task")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "commit")
+	}
+
+	logs.Get().WithField("taskId", task.Id).Infof("created rollback task: %s", rollbackTask.Id)
+	return nil
+}
+
+// taskDoneProcessDriftRemediation 偏移处理模式为 remediate 时，偏移检测发现偏移后创建纠偏部署任务
+func taskDoneProcessDriftRemediation(dbSess *db.Session, env *models.Env, task *models.Task) error {
+	if !services.NeedDriftRemediation(env, task) {
+		return nil
+	}
+	logger := logs.Get().WithField("taskId", task.Id)
+
+	// 环境已有未结束的部署任务时不再重复创建，下次偏移检测时再处理
+	if exist, er := services.HasActiveEnvDeployTask(dbSess, env.Id); er != nil {
+		return errors.Wrapf(er, "check env deploy task")
+	} else if exist {
+		logger.Infof("env has active deploy task, skip drift remediation")
+		return nil
+	}
+
+	tx := dbSess.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			_ = tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	remediationTask, er := services.CreateDriftRemediationTask(tx, env, task)
+	if er != nil {
+		_ = tx.Rollback()
+		return errors.Wrapf(er, "create drift remediation task")
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "commit")
+	}
+
+	logger.Infof("created drift remediation task: %s", remediationTask.Id)
+	return nil
+}
+
 func StopTaskContainers(sess *db.Session, taskId models.Id) error {
 	return stopTaskContainers(sess, taskId, false)
 }
@@ -195,7 +274,10 @@ func stopTaskContainers(sess *db.Session, taskId models.Id, isScanTask bool) err
 		TaskId:       taskId.String(),
 		ContainerIds: []string{},
 	}
-	req.ContainerIds = append(req.ContainerIds, containerId)
+	// 容器 id 为空时 runner 会按任务 id 标签查找并停止容器
+	if containerId != "" {
+		req.ContainerIds = append(req.ContainerIds, containerId)
+	}
 
 	header := &http.Header{}
 	header.Set("Content-Type", "application/json")
@@ -0,0 +1,162 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type BillingConnector struct {
+	ctrl.GinController
+}
+
+// Search 查询账单导入连接器
+// @Tags 账单
+// @Summary 查询账单导入连接器
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchBillingConnectorForm true "parameter"
+// @router /billing/connectors [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.BillingConnector}}
+func (BillingConnector) Search(c *ctx.GinRequest) {
+	form := forms.SearchBillingConnectorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchBillingConnector(c.Service(), &form))
+}
+
+// Create 创建账单导入连接器
+// @Tags 账单
+// @Summary 创建账单导入连接器
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.CreateBillingConnectorForm true "parameter"
+// @router /billing/connectors [post]
+// @Success 200 {object} ctx.JSONResult{result=models.BillingConnector}
+func (BillingConnector) Create(c *ctx.GinRequest) {
+	form := forms.CreateBillingConnectorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateBillingConnector(c.Service(), &form))
+}
+
+// Detail 账单导入连接器详情
+// @Tags 账单
+// @Summary 账单导入连接器详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "连接器ID"
+// @router /billing/connectors/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.BillingConnector}
+func (BillingConnector) Detail(c *ctx.GinRequest) {
+	form := forms.DetailBillingConnectorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.BillingConnectorDetail(c.Service(), &form))
+}
+
+// Update 修改账单导入连接器
+// @Tags 账单
+// @Summary 修改账单导入连接器
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "连接器ID"
+// @Param json body forms.UpdateBillingConnectorForm true "parameter"
+// @router /billing/connectors/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.BillingConnector}
+func (BillingConnector) Update(c *ctx.GinRequest) {
+	form := forms.UpdateBillingConnectorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateBillingConnector(c.Service(), &form))
+}
+
+// Delete 删除账单导入连接器
+// @Tags 账单
+// @Summary 删除账单导入连接器
+// @Description 删除连接器同时删除其导入的账单记录
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "连接器ID"
+// @router /billing/connectors/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (BillingConnector) Delete(c *ctx.GinRequest) {
+	form := forms.DeleteBillingConnectorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteBillingConnector(c.Service(), &form))
+}
+
+// Sync 立即同步账单
+// @Tags 账单
+// @Summary 立即同步账单
+// @Description 拉取指定账期的账单并与组织下的资源进行对账，同一账期的已有记录会被替换
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "连接器ID"
+// @Param json body forms.SyncBillingConnectorForm true "parameter"
+// @router /billing/connectors/{id}/sync [post]
+// @Success 200 {object} ctx.JSONResult{result=apps.SyncBillingResp}
+func (BillingConnector) Sync(c *ctx.GinRequest) {
+	form := forms.SyncBillingConnectorForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SyncBillingConnector(c.Service(), &form))
+}
+
+// BillingReport 账单费用报表
+// @Tags 账单
+// @Summary 账单费用报表
+// @Description 按环境汇总已匹配资源的费用，并统计未被 CloudIaC 管理的资源费用
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.BillingReportForm true "parameter"
+// @router /billing/report [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.BillingReportResp}
+func BillingReport(c *ctx.GinRequest) {
+	form := forms.BillingReportForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.BillingReport(c.Service(), &form))
+}
+
+// BillingUnmanaged 未管理资源费用明细
+// @Tags 账单
+// @Summary 未管理资源费用明细
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchUnmanagedBillingForm true "parameter"
+// @router /billing/unmanaged [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.BillingRecord}}
+func BillingUnmanaged(c *ctx.GinRequest) {
+	form := forms.SearchUnmanagedBillingForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchUnmanagedBilling(c.Service(), &form))
+}
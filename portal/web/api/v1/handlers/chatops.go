@@ -0,0 +1,120 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+	"io/ioutil"
+	"net/http"
+)
+
+type ChatIdentity struct {
+	ctrl.GinController
+}
+
+// Search 查询聊天账号绑定
+// @Tags 聊天指令
+// @Summary 查询聊天账号绑定
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchChatIdentityForm true "parameter"
+// @router /chatops/identities [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]apps.ChatIdentityResp}}
+func (ChatIdentity) Search(c *ctx.GinRequest) {
+	form := forms.SearchChatIdentityForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchChatIdentity(c.Service(), &form))
+}
+
+// Create 绑定聊天账号
+// @Tags 聊天指令
+// @Summary 绑定聊天账号
+// @Description 聊天指令以绑定用户的身份及权限执行
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.CreateChatIdentityForm true "parameter"
+// @router /chatops/identities [post]
+// @Success 200 {object} ctx.JSONResult{result=models.ChatIdentity}
+func (ChatIdentity) Create(c *ctx.GinRequest) {
+	form := forms.CreateChatIdentityForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateChatIdentity(c.Service(), &form))
+}
+
+// Delete 解除聊天账号绑定
+// @Tags 聊天指令
+// @Summary 解除聊天账号绑定
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "绑定ID"
+// @router /chatops/identities/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (ChatIdentity) Delete(c *ctx.GinRequest) {
+	form := forms.DeleteChatIdentityForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteChatIdentity(c.Service(), &form))
+}
+
+// ChatOpsSlack Slack slash command 回调
+// @Tags 聊天指令
+// @Summary Slack slash command 回调
+// @Description 请求通过 Slack Signing Secret 签名校验，返回 Slack 消息格式的回复
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param X-Slack-Request-Timestamp header string true "请求时间戳"
+// @Param X-Slack-Signature header string true "请求签名"
+// @router /chatops/slack [post]
+// @Success 200 {object} chatops.SlackResponse
+func ChatOpsSlack(c *ctx.GinRequest) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSONError(e.New(e.IOError, err), http.StatusInternalServerError)
+		return
+	}
+	reply, er := apps.ChatOpsSlack(c.Service(),
+		c.GetHeader("X-Slack-Request-Timestamp"), c.GetHeader("X-Slack-Signature"), body)
+	if er != nil {
+		c.JSONError(er)
+		return
+	}
+	c.Context.JSON(http.StatusOK, reply)
+}
+
+// ChatOpsDingTalk 钉钉机器人回调
+// @Tags 聊天指令
+// @Summary 钉钉机器人回调
+// @Description 请求通过钉钉机器人 AppSecret 签名校验，返回钉钉消息格式的回复
+// @Accept application/json
+// @Produce json
+// @Param timestamp header string true "请求时间戳(毫秒)"
+// @Param sign header string true "请求签名"
+// @router /chatops/dingtalk [post]
+// @Success 200 {object} chatops.DingTalkMessage
+func ChatOpsDingTalk(c *ctx.GinRequest) {
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSONError(e.New(e.IOError, err), http.StatusInternalServerError)
+		return
+	}
+	reply, er := apps.ChatOpsDingTalk(c.Service(), c.GetHeader("timestamp"), c.GetHeader("sign"), body)
+	if er != nil {
+		c.JSONError(er)
+		return
+	}
+	c.Context.JSON(http.StatusOK, reply)
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type CostPrice struct {
+	ctrl.GinController
+}
+
+// Search 查询费用估算价格配置
+// @Tags 费用估算
+// @Summary 查询费用估算价格配置
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchCostPriceForm true "parameter"
+// @router /cost/prices [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.CostPrice}}
+func (CostPrice) Search(c *ctx.GinRequest) {
+	form := forms.SearchCostPriceForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchCostPrice(c.Service(), &form))
+}
+
+// Create 创建费用估算价格配置
+// @Tags 费用估算
+// @Summary 创建费用估算价格配置
+// @Description plan 任务完成后根据价格配置估算资源的月度费用，matchAttr 为空时为该资源类型的默认价格，否则只匹配属性值等于 matchValue 的资源
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.CreateCostPriceForm true "parameter"
+// @router /cost/prices [post]
+// @Success 200 {object} ctx.JSONResult{result=models.CostPrice}
+func (CostPrice) Create(c *ctx.GinRequest) {
+	form := forms.CreateCostPriceForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateCostPrice(c.Service(), &form))
+}
+
+// Detail 费用估算价格配置详情
+// @Tags 费用估算
+// @Summary 费用估算价格配置详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "价格配置ID"
+// @router /cost/prices/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.CostPrice}
+func (CostPrice) Detail(c *ctx.GinRequest) {
+	form := forms.DetailCostPriceForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CostPriceDetail(c.Service(), &form))
+}
+
+// Update 修改费用估算价格配置
+// @Tags 费用估算
+// @Summary 修改费用估算价格配置
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "价格配置ID"
+// @Param json body forms.UpdateCostPriceForm true "parameter"
+// @router /cost/prices/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.CostPrice}
+func (CostPrice) Update(c *ctx.GinRequest) {
+	form := forms.UpdateCostPriceForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateCostPrice(c.Service(), &form))
+}
+
+// Delete 删除费用估算价格配置
+// @Tags 费用估算
+// @Summary 删除费用估算价格配置
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "价格配置ID"
+// @router /cost/prices/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (CostPrice) Delete(c *ctx.GinRequest) {
+	form := forms.DeleteCostPriceForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteCostPrice(c.Service(), &form))
+}
+
+// CostDashboard 估算费用看板
+// @Tags 费用估算
+// @Summary 估算费用看板
+// @Description 按项目及环境汇总各环境最近一次部署时估算的月度费用，并统计超出预算的环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.CostDashboardForm true "parameter"
+// @router /cost/dashboard [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.CostDashboardResp}
+func CostDashboard(c *ctx.GinRequest) {
+	form := forms.CostDashboardForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CostDashboard(c.Service(), &form))
+}
@@ -5,10 +5,13 @@ package handlers
 import (
 	"cloudiac/portal/apps"
 	"cloudiac/portal/consts"
+	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
+	"fmt"
+	"io/ioutil"
 )
 
 type Env struct {
@@ -142,12 +145,20 @@ func (Env) Deploy(c *ctx.GinRequest) {
 // @Param IaC-Org-Id header string true "组织ID"
 // @Param IaC-Project-Id header string true "项目ID"
 // @Param envId path string true "环境ID"
+// @Param json body forms.DestroyEnvForm false "parameter"
 // @router /envs/{envId}/destroy [post]
 // @Success 200 {object} ctx.JSONResult{result=models.EnvDetail}
 func (Env) Destroy(c *ctx.GinRequest) {
+	destroyForm := forms.DestroyEnvForm{}
+	if err := c.Bind(&destroyForm); err != nil {
+		return
+	}
 	form := forms.DeployEnvForm{}
 	form.Id = models.Id(c.Param("id"))
 	form.TaskType = models.TaskTypeDestroy
+	form.FreezeOverrideForm = destroyForm.FreezeOverrideForm
+	form.TaskScheduleForm = destroyForm.TaskScheduleForm
+	form.Targets = destroyForm.Targets
 	c.JSONResult(apps.EnvDeploy(c.Service(), &form))
 }
 
@@ -211,6 +222,27 @@ func (Env) Variables(c *ctx.GinRequest) {
 	c.JSONResult(apps.EnvVariables(c.Service(), form))
 }
 
+// Snapshot 查询环境在指定时间点的配置
+// @Tags 环境
+// @Summary 查询环境在指定时间点的配置
+// @Description 根据指定时间点之前最后一次部署任务还原环境使用的模板版本、变量、资源列表，以及最近一次合规扫描结果
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.EnvSnapshotForm true "parameter"
+// @Param envId path string true "环境ID"
+// @router /envs/{envId}/snapshot [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.EnvSnapshotResp}
+func (Env) Snapshot(c *ctx.GinRequest) {
+	form := forms.EnvSnapshotForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvSnapshot(c.Service(), &form))
+}
+
 // SearchTasks 部署历史
 // @Tags 环境
 // @Summary 部署历史
@@ -332,3 +364,514 @@ func (Env) ResourceGraphDetail(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.ResourceGraphDetail(c.Service(), form))
 }
+
+// Attest 环境合规声明
+// @Tags 环境
+// @Summary 环境合规声明
+// @Description 环境负责人确认环境当前的合规状态，声明时记录环境的合规扫描结果，并根据声明周期计算下次声明的截止时间
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.CreateEnvAttestationForm true "parameter"
+// @router /envs/{envId}/attestations [post]
+// @Success 200 {object} ctx.JSONResult{result=models.EnvAttestation}
+func (Env) Attest(c *ctx.GinRequest) {
+	form := forms.CreateEnvAttestationForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateEnvAttestation(c.Service(), &form))
+}
+
+// Lock 锁定环境
+// @Tags 环境
+// @Summary 锁定环境
+// @Description 锁定期间只有锁定人可以发起部署或销毁任务，其他用户发起的任务会被拒绝
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.LockEnvForm true "parameter"
+// @router /envs/{envId}/lock [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func (Env) Lock(c *ctx.GinRequest) {
+	form := forms.LockEnvForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.LockEnv(c.Service(), &form))
+}
+
+// Unlock 解锁环境
+// @Tags 环境
+// @Summary 解锁环境
+// @Description 其他用户锁定的环境需要项目管理员通过 force 参数强制解锁
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.UnlockEnvForm true "parameter"
+// @router /envs/{envId}/unlock [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func (Env) Unlock(c *ctx.GinRequest) {
+	form := forms.UnlockEnvForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UnlockEnv(c.Service(), &form))
+}
+
+// SearchStateVersions 环境 state 历史版本
+// @Tags 环境
+// @Summary 环境 state 历史版本
+// @Description 部署及销毁任务结束后保存环境的 state，内容未变化时不生成新版本
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvStateVersionForm true "parameter"
+// @router /envs/{envId}/state_versions [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvStateVersion}}
+func (Env) SearchStateVersions(c *ctx.GinRequest) {
+	form := forms.SearchEnvStateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvStateVersions(c.Service(), &form))
+}
+
+// DiffStateVersions 比较环境 state 版本
+// @Tags 环境
+// @Summary 比较环境两个 state 版本中的资源
+// @Description 返回新增、删除及属性变化的资源，只返回变化的属性名称
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.DiffEnvStateVersionForm true "parameter"
+// @router /envs/{envId}/state_versions/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.EnvStateVersionDiff}
+func (Env) DiffStateVersions(c *ctx.GinRequest) {
+	form := forms.DiffEnvStateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DiffEnvStateVersions(c.Service(), &form))
+}
+
+// RestoreStateVersion 恢复环境 state 版本
+// @Tags 环境
+// @Summary 恢复环境 state 到历史版本
+// @Description 恢复前备份当前 state，恢复只修改 state 不变更资源，恢复后请执行 plan 确认资源状态
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param version path int true "版本号"
+// @Param form body forms.RestoreEnvStateVersionForm true "parameter"
+// @router /envs/{envId}/state_versions/{version}/restore [post]
+// @Success 200 {object} ctx.JSONResult{result=apps.EnvStateRestoreResult}
+func (Env) RestoreStateVersion(c *ctx.GinRequest) {
+	form := forms.RestoreEnvStateVersionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RestoreEnvStateVersion(c.Service(), &form))
+}
+
+// ExportState 导出环境 state
+// @Tags 环境
+// @Summary 下载环境当前的 terraform state 文件
+// @Description state 中可能包含敏感信息，导出操作会记录审计日志
+// @Accept application/x-www-form-urlencoded
+// @Produce application/octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.ExportEnvStateForm true "parameter"
+// @router /envs/{envId}/state/export [get]
+// @Success 200 {file} file "terraform.tfstate"
+func (Env) ExportState(c *ctx.GinRequest) {
+	form := forms.ExportEnvStateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	data, err := apps.ExportEnvState(c.Service(), &form)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	c.FileDownloadResponse(data, fmt.Sprintf("%s.tfstate", form.Id), "application/json")
+}
+
+// ImportState 导入环境 state
+// @Tags 环境
+// @Summary 导入外部管理的 terraform state 到未部署过的环境
+// @Description 导入后基于 state 生成环境资源列表，并生成一条已完成的部署任务记录
+// @Accept application/json, multipart/form-data
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.ImportEnvStateForm true "parameter"
+// @Param file formData file false "待导入的 state 文件(与 data 参数二选一)"
+// @router /envs/{envId}/state/import [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Env) ImportState(c *ctx.GinRequest) {
+	form := forms.ImportEnvStateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+
+	if form.File != nil {
+		file, err := form.File.Open()
+		if err != nil {
+			c.JSONError(e.New(e.BadParam, err))
+			return
+		}
+		defer file.Close()
+
+		if form.Data, err = ioutil.ReadAll(file); err != nil {
+			c.JSONError(e.New(e.BadParam, err))
+			return
+		}
+	}
+	c.JSONResult(apps.ImportEnvState(c.Service(), &form))
+}
+
+// ImportResource 导入云资源
+// @Tags 环境
+// @Summary 创建 terraform import 任务将已有云资源导入环境
+// @Description 任务执行 terraform import，结束后重新统计环境资源，导入后需要在云模板代码中添加对应的资源定义
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form body forms.ImportEnvResourceForm true "parameter"
+// @router /envs/{envId}/resources/import [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Env) ImportResource(c *ctx.GinRequest) {
+	form := forms.ImportEnvResourceForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ImportEnvResource(c.Service(), &form))
+}
+
+// SearchPlans 环境 plan 产物列表
+// @Tags 环境
+// @Summary 环境 plan 产物列表
+// @Description plan 任务成功后保存二进制 plan 文件及 plan json，多工作目录云模板的环境不生成 plan 产物
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvPlanArtifactForm true "parameter"
+// @router /envs/{envId}/plans [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvPlanArtifact}}
+func (Env) SearchPlans(c *ctx.GinRequest) {
+	form := forms.SearchEnvPlanArtifactForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvPlanArtifacts(c.Service(), &form))
+}
+
+// DownloadPlan 下载 plan 产物
+// @Tags 环境
+// @Summary 下载 plan 产物
+// @Description 二进制 plan 文件中包含变量的明文值，下载操作会记录审计日志
+// @Accept application/x-www-form-urlencoded
+// @Produce application/octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param planId path string true "plan 产物ID"
+// @Param form query forms.DownloadEnvPlanArtifactForm true "parameter"
+// @router /envs/{envId}/plans/{planId}/download [get]
+// @Success 200 {file} file "tfplan"
+func (Env) DownloadPlan(c *ctx.GinRequest) {
+	form := forms.DownloadEnvPlanArtifactForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	data, err := apps.DownloadEnvPlanArtifact(c.Service(), &form)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	if form.Format == "binary" {
+		c.FileDownloadResponse(data, fmt.Sprintf("%s.tfplan", form.PlanId), "application/octet-stream")
+		return
+	}
+	c.FileDownloadResponse(data, fmt.Sprintf("%s.json", form.PlanId), "application/json")
+}
+
+// ApplyPlan 执行已保存的 plan
+// @Tags 环境
+// @Summary 创建执行已保存 plan 的部署任务
+// @Description 任务 apply 的是该 plan 文件的内容，plan 之后环境资源发生过变更时不能执行，每个 plan 只能执行一次
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param planId path string true "plan 产物ID"
+// @Param form body forms.ApplyEnvPlanArtifactForm false "parameter"
+// @router /envs/{envId}/plans/{planId}/apply [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Env) ApplyPlan(c *ctx.GinRequest) {
+	form := forms.ApplyEnvPlanArtifactForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ApplyEnvPlanArtifact(c.Service(), &form))
+}
+
+// SearchAttestations 环境合规声明历史
+// @Tags 环境
+// @Summary 环境合规声明历史
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvAttestationForm true "parameter"
+// @router /envs/{envId}/attestations [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]apps.EnvAttestationResp}}
+func (Env) SearchAttestations(c *ctx.GinRequest) {
+	form := forms.SearchEnvAttestationForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvAttestations(c.Service(), &form))
+}
+
+// SearchAutoDestroy 将要自动销毁的环境
+// @Tags 环境
+// @Summary 将要自动销毁的环境
+// @Description 按销毁时间查询组织或项目下将要自动销毁的环境，未传入项目ID时查询整个组织
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.SearchAutoDestroyEnvForm true "parameter"
+// @router /auto_destroy_envs [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]services.AutoDestroyEvent}}
+func (Env) SearchAutoDestroy(c *ctx.GinRequest) {
+	form := forms.SearchAutoDestroyEnvForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchAutoDestroyEnvs(c.Service(), &form))
+}
+
+// ExtendAutoDestroy 延长环境存活时间
+// @Tags 环境
+// @Summary 延长环境存活时间
+// @Description 将环境的自动销毁时间推迟指定的时间，未指定时按环境的 ttl 延长
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param json body forms.ExtendEnvAutoDestroyForm true "parameter"
+// @router /envs/{envId}/auto_destroy/extend [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func (Env) ExtendAutoDestroy(c *ctx.GinRequest) {
+	form := forms.ExtendEnvAutoDestroyForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ExtendEnvAutoDestroy(c.Service(), &form))
+}
+
+// SuspendJobs 暂停环境定时任务
+// @Tags 环境
+// @Summary 暂停环境定时任务
+// @Description 暂停环境的自动销毁(autoDestroy)、偏移检测(drift)及 commit 自动部署(autoDeploy)，jobs 为空时暂停所有定时任务
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param json body forms.SuspendEnvJobsForm true "parameter"
+// @router /envs/{envId}/suspend [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func (Env) SuspendJobs(c *ctx.GinRequest) {
+	form := forms.SuspendEnvJobsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SuspendEnvJobs(c.Service(), &form))
+}
+
+// ResumeJobs 恢复环境定时任务
+// @Tags 环境
+// @Summary 恢复环境定时任务
+// @Description 恢复环境暂停的定时任务，恢复时自动销毁时间或偏移检测时间已过的环境会立即执行对应的任务
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param json body forms.ResumeEnvJobsForm true "parameter"
+// @router /envs/{envId}/resume [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Env}
+func (Env) ResumeJobs(c *ctx.GinRequest) {
+	form := forms.ResumeEnvJobsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ResumeEnvJobs(c.Service(), &form))
+}
+
+// SearchSuspensions 环境定时任务暂停记录
+// @Tags 环境
+// @Summary 环境定时任务暂停记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvSuspensionForm true "parameter"
+// @router /envs/{envId}/suspensions [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvSuspension}}
+func (Env) SearchSuspensions(c *ctx.GinRequest) {
+	form := forms.SearchEnvSuspensionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvSuspensions(c.Service(), &form))
+}
+
+// SearchDriftHistory 环境资源偏移历史
+// @Tags 环境
+// @Summary 环境资源偏移历史
+// @Description 查询偏移检测发现的资源偏移记录，按检测时间倒序
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvDriftHistoryForm true "parameter"
+// @router /envs/{envId}/drift/history [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.ResourceDriftHistory}}
+func (Env) SearchDriftHistory(c *ctx.GinRequest) {
+	form := forms.SearchEnvDriftHistoryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvDriftHistory(c.Service(), &form))
+}
+
+// DriftTrend 环境偏移趋势
+// @Tags 环境
+// @Summary 环境偏移趋势
+// @Description 统计环境每天的偏移检测次数、发现偏移的次数及各资源的偏移频率
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.EnvDriftTrendForm true "parameter"
+// @router /envs/{envId}/drift/trend [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.EnvDriftTrendResp}
+func (Env) DriftTrend(c *ctx.GinRequest) {
+	form := forms.EnvDriftTrendForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvDriftTrend(c.Service(), &form))
+}
+
+// DriftStats 环境偏移频率统计
+// @Tags 环境
+// @Summary 环境偏移频率统计
+// @Description 统计组织或项目下各环境的偏移检测次数及发现偏移的次数，未传入项目ID时统计整个组织
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string false "项目ID"
+// @Param form query forms.EnvDriftStatsForm true "parameter"
+// @router /drift_stats [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.EnvDriftStat}
+func (Env) DriftStats(c *ctx.GinRequest) {
+	form := forms.EnvDriftStatsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvDriftStats(c.Service(), &form))
+}
+
+// Outputs 环境的 terraform outputs
+// @Tags 环境
+// @Summary 环境的 terraform outputs
+// @Description 返回环境最后一次部署的 outputs，敏感 output 的值默认隐藏，传入 reveal 时需要环境的 outputreveal 权限
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.EnvOutputsForm true "parameter"
+// @router /envs/{envId}/outputs [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.EnvOutput}
+func (Env) Outputs(c *ctx.GinRequest) {
+	form := forms.EnvOutputsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvOutputs(c.Service(), &form))
+}
+
+// OutputHistory 环境 output 变更历史
+// @Tags 环境
+// @Summary 环境 output 变更历史
+// @Description 比较环境最近多次部署的 outputs，返回 output 的新增、修改及删除记录，最新的变化在前
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.EnvOutputHistoryForm true "parameter"
+// @router /envs/{envId}/outputs/history [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.OutputChange}
+func (Env) OutputHistory(c *ctx.GinRequest) {
+	form := forms.EnvOutputHistoryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnvOutputHistory(c.Service(), &form))
+}
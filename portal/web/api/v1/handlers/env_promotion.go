@@ -0,0 +1,153 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type PromotionChain struct {
+	ctrl.GinController
+}
+
+// Create 创建环境晋级链
+// @Tags 环境晋级
+// @Summary 创建环境晋级链
+// @Description 将同一云模板的多个环境按顺序作为部署阶段(如 dev→staging→prod)，前一阶段部署成功的 commit 可以晋级部署到下一阶段
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param json body forms.CreatePromotionChainForm true "parameter"
+// @router /promotion_chains [post]
+// @Success 200 {object} ctx.JSONResult{result=models.PromotionChain}
+func (PromotionChain) Create(c *ctx.GinRequest) {
+	form := forms.CreatePromotionChainForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreatePromotionChain(c.Service(), &form))
+}
+
+// Search 查询环境晋级链
+// @Tags 环境晋级
+// @Summary 查询环境晋级链
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchPromotionChainForm true "parameter"
+// @router /promotion_chains [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.PromotionChain}}
+func (PromotionChain) Search(c *ctx.GinRequest) {
+	form := forms.SearchPromotionChainForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchPromotionChain(c.Service(), &form))
+}
+
+// Detail 环境晋级链详情
+// @Tags 环境晋级
+// @Summary 环境晋级链详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "晋级链ID"
+// @router /promotion_chains/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.PromotionChain}
+func (PromotionChain) Detail(c *ctx.GinRequest) {
+	form := forms.DetailPromotionChainForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PromotionChainDetail(c.Service(), &form))
+}
+
+// Update 修改环境晋级链
+// @Tags 环境晋级
+// @Summary 修改环境晋级链
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "晋级链ID"
+// @Param json body forms.UpdatePromotionChainForm true "parameter"
+// @router /promotion_chains/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.PromotionChain}
+func (PromotionChain) Update(c *ctx.GinRequest) {
+	form := forms.UpdatePromotionChainForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdatePromotionChain(c.Service(), &form))
+}
+
+// Delete 删除环境晋级链
+// @Tags 环境晋级
+// @Summary 删除环境晋级链
+// @Description 删除晋级链不影响各环境及已创建的部署任务，晋级记录保留
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "晋级链ID"
+// @router /promotion_chains/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (PromotionChain) Delete(c *ctx.GinRequest) {
+	form := forms.DeletePromotionChainForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeletePromotionChain(c.Service(), &form))
+}
+
+// Promote 环境晋级
+// @Tags 环境晋级
+// @Summary 环境晋级
+// @Description 使用来源环境部署成功任务的分支及 commit 为晋级链中下一阶段的环境创建部署任务。
+// @Description 部署任务使用目标环境自身的变量，variables 中的变量只对本次部署生效
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "晋级链ID"
+// @Param json body forms.PromoteEnvForm true "parameter"
+// @router /promotion_chains/{id}/promote [post]
+// @Success 200 {object} ctx.JSONResult{result=apps.EnvPromotionResp}
+func (PromotionChain) Promote(c *ctx.GinRequest) {
+	form := forms.PromoteEnvForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PromoteEnv(c.Service(), &form))
+}
+
+// Promotions 晋级记录
+// @Tags 环境晋级
+// @Summary 查询晋级链的晋级记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param id path string true "晋级链ID"
+// @Param form query forms.SearchEnvPromotionForm true "parameter"
+// @router /promotion_chains/{id}/promotions [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.EnvPromotion}}
+func (PromotionChain) Promotions(c *ctx.GinRequest) {
+	form := forms.SearchEnvPromotionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvPromotion(c.Service(), &form))
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type FleetDeploy struct {
+	ctrl.GinController
+}
+
+// Create 创建批量部署
+// @Tags 批量部署
+// @Summary 创建批量部署
+// @Description 为符合筛选条件的所有环境创建部署任务，按 concurrency 限制同时部署的环境数量，dev 环境最先部署，prod 环境最后部署。
+// @Description failurePolicy 为 stop 时有环境部署失败后不再启动其他环境的部署，为 continue 时继续部署其他环境。
+// @Description dryRun 为 true 时只返回会被部署的环境列表
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.CreateFleetDeployForm true "parameter"
+// @router /fleet_deploys [post]
+// @Success 200 {object} ctx.JSONResult{result=models.FleetDeploy}
+func (FleetDeploy) Create(c *ctx.GinRequest) {
+	form := forms.CreateFleetDeployForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateFleetDeploy(c.Service(), &form))
+}
+
+// Search 查询批量部署
+// @Tags 批量部署
+// @Summary 查询批量部署
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchFleetDeployForm true "parameter"
+// @router /fleet_deploys [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.FleetDeploy}}
+func (FleetDeploy) Search(c *ctx.GinRequest) {
+	form := forms.SearchFleetDeployForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchFleetDeploy(c.Service(), &form))
+}
+
+// Detail 批量部署详情
+// @Tags 批量部署
+// @Summary 批量部署详情
+// @Description 返回批量部署及各状态的环境数量
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "批量部署ID"
+// @router /fleet_deploys/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.FleetDeploy}
+func (FleetDeploy) Detail(c *ctx.GinRequest) {
+	form := forms.DetailFleetDeployForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.FleetDeployDetail(c.Service(), &form))
+}
+
+// Items 查询批量部署中各环境的部署状态
+// @Tags 批量部署
+// @Summary 查询批量部署中各环境的部署状态
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "批量部署ID"
+// @Param form query forms.SearchFleetDeployItemForm true "parameter"
+// @router /fleet_deploys/{id}/items [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.FleetDeployItem}}
+func (FleetDeploy) Items(c *ctx.GinRequest) {
+	form := forms.SearchFleetDeployItemForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchFleetDeployItems(c.Service(), &form))
+}
+
+// Stop 停止批量部署
+// @Tags 批量部署
+// @Summary 停止批量部署
+// @Description 未启动的环境不再部署，已创建的部署任务继续执行
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "批量部署ID"
+// @router /fleet_deploys/{id}/stop [post]
+// @Success 200 {object} ctx.JSONResult{result=models.FleetDeploy}
+func (FleetDeploy) Stop(c *ctx.GinRequest) {
+	form := forms.StopFleetDeployForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.StopFleetDeploy(c.Service(), &form))
+}
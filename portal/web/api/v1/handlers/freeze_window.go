@@ -0,0 +1,124 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type FreezeWindow struct {
+	ctrl.GinController
+}
+
+// Search 查询部署冻结窗口
+// @Tags 部署冻结窗口
+// @Summary 查询部署冻结窗口
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchFreezeWindowForm true "parameter"
+// @router /freeze_windows [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.FreezeWindow}}
+func (FreezeWindow) Search(c *ctx.GinRequest) {
+	form := forms.SearchFreezeWindowForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchFreezeWindow(c.Service(), &form))
+}
+
+// Create 创建部署冻结窗口
+// @Tags 部署冻结窗口
+// @Summary 创建部署冻结窗口
+// @Description 冻结期间匹配的部署任务不会启动，type 为 cron 时按 cron 表达式周期冻结，每次持续 duration 分钟；type 为 range 时在 startAt 至 endAt 之间冻结
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.CreateFreezeWindowForm true "parameter"
+// @router /freeze_windows [post]
+// @Success 200 {object} ctx.JSONResult{result=models.FreezeWindow}
+func (FreezeWindow) Create(c *ctx.GinRequest) {
+	form := forms.CreateFreezeWindowForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateFreezeWindow(c.Service(), &form))
+}
+
+// Detail 部署冻结窗口详情
+// @Tags 部署冻结窗口
+// @Summary 部署冻结窗口详情
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "冻结窗口ID"
+// @router /freeze_windows/{id} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.FreezeWindow}
+func (FreezeWindow) Detail(c *ctx.GinRequest) {
+	form := forms.DetailFreezeWindowForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.FreezeWindowDetail(c.Service(), &form))
+}
+
+// Update 修改部署冻结窗口
+// @Tags 部署冻结窗口
+// @Summary 修改部署冻结窗口
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "冻结窗口ID"
+// @Param json body forms.UpdateFreezeWindowForm true "parameter"
+// @router /freeze_windows/{id} [put]
+// @Success 200 {object} ctx.JSONResult{result=models.FreezeWindow}
+func (FreezeWindow) Update(c *ctx.GinRequest) {
+	form := forms.UpdateFreezeWindowForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateFreezeWindow(c.Service(), &form))
+}
+
+// Delete 删除部署冻结窗口
+// @Tags 部署冻结窗口
+// @Summary 删除部署冻结窗口
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "冻结窗口ID"
+// @router /freeze_windows/{id} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (FreezeWindow) Delete(c *ctx.GinRequest) {
+	form := forms.DeleteFreezeWindowForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteFreezeWindow(c.Service(), &form))
+}
+
+// SearchOverrides 查询紧急放行记录
+// @Tags 部署冻结窗口
+// @Summary 查询紧急放行记录
+// @Description 查询冻结期间通过紧急放行创建的部署任务记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchFreezeOverrideForm true "parameter"
+// @router /freeze_windows/overrides [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.FreezeOverride}}
+func (FreezeWindow) SearchOverrides(c *ctx.GinRequest) {
+	form := forms.SearchFreezeOverrideForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchFreezeOverride(c.Service(), &form))
+}
@@ -4,10 +4,14 @@ package handlers
 
 import (
 	"cloudiac/portal/apps"
+	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models"
 	"cloudiac/portal/models/forms"
+	"cloudiac/utils/logs"
+	"encoding/json"
+	"fmt"
 )
 
 type Organization struct {
@@ -266,3 +270,91 @@ func (Organization) UpdateUserOrg(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.UpdateUserOrg(c.Service(), &form))
 }
+
+// ExportData 导出组织数据
+// @Tags 组织
+// @Summary 导出组织的所有数据
+// @Description 需要平台管理员权限
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param orgId path string true "组织ID"
+// @Param form query forms.ExportOrgDataForm true "parameter"
+// @router /orgs/{orgId}/export [get]
+// @Success 200 {object} ctx.JSONResult{result=services.OrgExportedData}
+func (Organization) ExportData(c *ctx.GinRequest) {
+	form := forms.ExportOrgDataForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+
+	resp, err := apps.ExportOrgData(c.Service(), &form)
+	if err != nil || !form.Download {
+		c.JSONResult(resp, err)
+		return
+	}
+	data, er := json.MarshalIndent(resp, "", "  ")
+	if er != nil {
+		logs.Get().Warnf("json.Marshal: %v", er)
+		c.JSONError(e.New(e.JSONParseError))
+		return
+	}
+	c.FileDownloadResponse(data, fmt.Sprintf("cloudiac-org-%s.json", form.Id), "")
+}
+
+// SchedulePurge 计划清除组织数据
+// @Tags 组织
+// @Summary 计划清除组织数据
+// @Description 需要平台管理员权限，组织将被禁用，并在保留期结束后不可逆地删除所有数据，保留期内可以取消
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param orgId path string true "组织ID"
+// @Param form formData forms.ScheduleOrgPurgeForm true "parameter"
+// @router /orgs/{orgId}/purge [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Organization}
+func (Organization) SchedulePurge(c *ctx.GinRequest) {
+	form := forms.ScheduleOrgPurgeForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ScheduleOrgPurge(c.Service(), &form))
+}
+
+// CancelPurge 取消清除组织数据
+// @Tags 组织
+// @Summary 取消清除组织数据
+// @Description 需要平台管理员权限，取消后组织保持禁用状态
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param orgId path string true "组织ID"
+// @router /orgs/{orgId}/purge [delete]
+// @Success 200 {object} ctx.JSONResult{result=models.Organization}
+func (Organization) CancelPurge(c *ctx.GinRequest) {
+	form := forms.CancelOrgPurgeForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CancelOrgPurge(c.Service(), &form))
+}
+
+// DestructionCert 组织数据销毁证明
+// @Tags 组织
+// @Summary 查询组织数据销毁证明
+// @Description 需要平台管理员权限，组织数据清除后可查询
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param orgId path string true "组织ID"
+// @router /orgs/{orgId}/destruction_cert [get]
+// @Success 200 {object} ctx.JSONResult{result=models.OrgDestructionCert}
+func (Organization) DestructionCert(c *ctx.GinRequest) {
+	form := forms.OrgDestructionCertForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.OrgDestructionCert(c.Service(), &form))
+}
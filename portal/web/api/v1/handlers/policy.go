@@ -111,6 +111,7 @@ func (Policy) Parse(c *ctx.GinRequest) {
 
 // Test 策略测试
 // @Summary 策略测试
+// @Description 支持通过 inputs 传入多组命名的输入数据，返回每组输入的测试结果及 rego 脚本覆盖率
 // @Tags 合规/策略
 // @Accept  json
 // @Produce  json
@@ -139,3 +140,23 @@ func (Policy) Test(c *ctx.GinRequest) {
 func (Policy) PolicySummary(c *ctx.GinRequest) {
 	c.JSONResult(apps.PolicySummary(c.Service()))
 }
+
+// WaitScanTask 等待扫描任务结束
+// @Tags 合规/策略
+// @Summary 等待扫描任务结束
+// @Description 阻塞等待扫描任务结束或超时，exitCode: 0 扫描通过，1 扫描失败，2 存在不合规资源，3 等待超时
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param taskId path string true "扫描任务ID"
+// @Param form query forms.WaitTaskForm true "parameter"
+// @Router /policies/scans/{taskId}/wait [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TaskWaitResult}
+func (Policy) WaitScanTask(c *ctx.GinRequest) {
+	form := &forms.WaitTaskForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.WaitScanTask(c, form))
+}
@@ -96,6 +96,25 @@ func (Policy) ScanEnvironment(c *ctx.GinRequest) {
 	c.JSONResult(apps.ScanEnvironment(c.Service(), form))
 }
 
+// ScanEnvironments 运行多个环境策略扫描
+// @Summary 运行多个环境策略扫描
+// @Description 逐个发起环境扫描，单个环境失败不会中止整个批次，返回每个环境的发起结果
+// @Tags 合规/环境
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.ScanEnvironmentForms true "parameter"
+// @Success 200 {object}  ctx.JSONResult{result=[]apps.ScanEnvironmentResult}
+// @Router /policies/envs/scans [post]
+func (Policy) ScanEnvironments(c *ctx.GinRequest) {
+	form := &forms.ScanEnvironmentForms{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ScanEnvironments(c.Service(), form))
+}
+
 // EnvScanResult 环境策略扫描结果
 // @Tags 合规/环境
 // @Summary 环境策略扫描结果
@@ -116,6 +135,45 @@ func (Policy) EnvScanResult(c *ctx.GinRequest) {
 	c.JSONResult(apps.PolicyScanResult(c.Service(), consts.ScopeEnv, form))
 }
 
+// EnvScoreTrend 环境合规评分趋势
+// @Tags 合规/环境
+// @Summary 环境合规评分趋势
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.PolicyScoreTrendForm true "parameter"
+// @Param envId path string true "环境ID"
+// @Router /policies/envs/{envId}/score_trend [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.ComplianceScorePoint}
+func (Policy) EnvScoreTrend(c *ctx.GinRequest) {
+	form := &forms.PolicyScoreTrendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PolicyScoreTrend(c.Service(), consts.ScopeEnv, form))
+}
+
+// ScanResultRego 扫描结果的策略代码
+// @Tags 合规/环境
+// @Summary 查询单条扫描结果对应策略的 rego 代码及修复建议
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param resultId path int true "扫描结果ID"
+// @Router /policies/results/{resultId}/rego [get]
+// @Success 200 {object} ctx.JSONResult{result=services.PolicyResultRego}
+func (Policy) ScanResultRego(c *ctx.GinRequest) {
+	form := &forms.PolicyResultRegoForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PolicyResultRego(c.Service(), form))
+}
+
 // EnablePolicyEnv 启用环境扫描
 // @Tags 合规/环境
 // @Summary 启用环境扫描
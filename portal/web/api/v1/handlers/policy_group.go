@@ -30,6 +30,25 @@ func (PolicyGroup) Create(c *ctx.GinRequest) {
 	c.JSONResult(apps.CreatePolicyGroup(c.Service(), form))
 }
 
+// Upload 上传压缩包创建策略组
+// @Summary 上传 rego 文件压缩包创建策略组
+// @Tags 合规/策略组
+// @Accept multipart/form-data
+// @Produce  json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form formData forms.UploadPolicyGroupForm true "parameter"
+// @Param file formData file true "策略组 zip 压缩包"
+// @Success 200 {object}  ctx.JSONResult{result=models.PolicyGroup}
+// @Router /policies/groups/upload [post]
+func (PolicyGroup) Upload(c *ctx.GinRequest) {
+	form := &forms.UploadPolicyGroupForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UploadPolicyGroup(c.Service(), form))
+}
+
 // Search 查询策略组列表
 // @Tags 合规/策略组
 // @Summary 查询策略组列表
@@ -177,6 +196,44 @@ func (PolicyGroup) LastTasks(c *ctx.GinRequest) {
 	c.JSONResult(apps.PolicyGroupScanTasks(c.Service(), form))
 }
 
+// SearchSync 策略组同步历史
+// @Tags 合规/策略组
+// @Summary 策略组同步历史
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param policyGroupId path string true "策略组id"
+// @Param form query forms.SearchPolicyGroupSyncForm true "parameter"
+// @Router /policies/groups/{policyGroupId}/syncs [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.PolicyGroupSync}}
+func (PolicyGroup) SearchSync(c *ctx.GinRequest) {
+	form := &forms.SearchPolicyGroupSyncForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchPolicyGroupSync(c.Service(), form))
+}
+
+// SyncDetail 策略组同步详情
+// @Tags 合规/策略组
+// @Summary 策略组同步详情，包含各策略 rego 及元数据的变更
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param policyGroupId path string true "策略组id"
+// @Param syncId path string true "同步记录id"
+// @Router /policies/groups/{policyGroupId}/syncs/{syncId} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.PolicyGroupSync}
+func (PolicyGroup) SyncDetail(c *ctx.GinRequest) {
+	form := &forms.DetailPolicyGroupSyncForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PolicyGroupSyncDetail(c.Service(), form))
+}
+
 // PolicyGroupChecks
 // @Tags 合规/策略组
 // @Accept multipart/form-data
@@ -228,3 +285,22 @@ func SearchRegistryPGVersions(c *ctx.GinRequest) {
 
 	c.JSONResult(apps.SearchRegistryPGVersions(c.Service(), &form))
 }
+
+// ImportRegistryPG 从 registry 导入策略组
+// @Tags registry
+// @Summary 从 registry 一键导入策略组
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.ImportRegistryPgForm true "parameter"
+// @router /registry/policy_groups/import [POST]
+// @Success 200 {object} ctx.JSONResult{result=models.PolicyGroup}
+func ImportRegistryPG(c *ctx.GinRequest) {
+	form := forms.ImportRegistryPgForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+
+	c.JSONResult(apps.ImportRegistryPG(c.Service(), &form))
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+// UpdatePolicySeverity 覆盖策略严重性
+// @Tags 合规/策略
+// @Summary 覆盖策略严重性
+// @Description 修改策略在当前组织内生效的严重性，不影响策略的 rego 定义
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.UpdatePolicySeverityForm true "parameter"
+// @Param policyId path string true "策略id"
+// @Router /policies/{policyId}/severity [put]
+// @Success 200 {object} ctx.JSONResult{result=models.OrgPolicyOverride}
+func (Policy) UpdatePolicySeverity(c *ctx.GinRequest) {
+	form := &forms.UpdatePolicySeverityForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdatePolicySeverity(c.Service(), form))
+}
+
+// DeletePolicySeverity 恢复策略严重性
+// @Tags 合规/策略
+// @Summary 恢复策略严重性
+// @Description 删除组织内的严重性覆盖，恢复使用策略定义的严重性
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param policyId path string true "策略id"
+// @Router /policies/{policyId}/severity [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Policy) DeletePolicySeverity(c *ctx.GinRequest) {
+	form := &forms.DeletePolicySeverityForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeletePolicySeverity(c.Service(), form))
+}
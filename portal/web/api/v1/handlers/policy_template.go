@@ -68,6 +68,26 @@ func (Policy) TemplateScanResult(c *ctx.GinRequest) {
 	c.JSONResult(apps.PolicyScanResult(c.Service(), consts.ScopeTemplate, form))
 }
 
+// TemplateScoreTrend 云模板合规评分趋势
+// @Tags 合规/云模板
+// @Summary 云模板合规评分趋势
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.PolicyScoreTrendForm true "parameter"
+// @Param templateId path string true "云模板ID"
+// @Router /policies/templates/{templateId}/score_trend [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.ComplianceScorePoint}
+func (Policy) TemplateScoreTrend(c *ctx.GinRequest) {
+	form := &forms.PolicyScoreTrendForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PolicyScoreTrend(c.Service(), consts.ScopeTemplate, form))
+}
+
 // SearchPolicyTpl 查询云模板策略配置
 // @Tags 合规/云模板
 // @Summary 查询云模板策略配置
@@ -106,3 +106,42 @@ func (Project) Detail(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.DetailProject(c.Service(), form))
 }
+
+// Quota 项目配额
+// @Summary 项目配额
+// @Description 返回项目的配额设置及当前的使用情况(环境数量、资源数量及估算月度费用)
+// @Tags 项目
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param projectId path string true "项目id"
+// @Success 200 {object} ctx.JSONResult{result=apps.ProjectQuotaResp}
+// @Router /projects/{projectId}/quota [get]
+func (Project) Quota(c *ctx.GinRequest) {
+	form := &forms.ProjectQuotaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ProjectQuota(c.Service(), form))
+}
+
+// UpdateQuota 修改项目配额
+// @Summary 修改项目配额
+// @Description 修改项目配额，环境数量达到配额时不能创建环境，部署任务 plan 后的资源数量或估算费用超出配额时按 quotaAction 需要组织管理员审批或禁止部署
+// @Tags 项目
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织id"
+// @Param projectId path string true "项目id"
+// @Param json body forms.UpdateProjectQuotaForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=apps.ProjectQuotaResp}
+// @Router /projects/{projectId}/quota [put]
+func (Project) UpdateQuota(c *ctx.GinRequest) {
+	form := &forms.UpdateProjectQuotaForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateProjectQuota(c.Service(), form))
+}
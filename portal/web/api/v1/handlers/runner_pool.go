@@ -0,0 +1,141 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type RunnerPool struct {
+	ctrl.GinController
+}
+
+// Search 查询 runner 池
+// @Tags runner
+// @Summary 查询 runner 池
+// @Description 返回 runner 池中的 runner 及其健康状态(心跳时间、运行中的任务数量、磁盘及 cpu 负载)
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param form query forms.SearchRunnerPoolForm true "parameter"
+// @router /runners/pool [get]
+// @Success 200 {object} ctx.JSONResult{result=[]models.Runner}
+func (RunnerPool) Search(c *ctx.GinRequest) {
+	form := forms.SearchRunnerPoolForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRunnerPool(c.Service(), &form))
+}
+
+// Register 注册 runner
+// @Tags runner
+// @Summary 注册 runner
+// @Description 将 runner 注册到 consul 并加入 runner 池，已注册的 runner 会更新地址及标签
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param form body forms.RegisterRunnerForm true "parameter"
+// @router /runners/pool [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Runner}
+func (RunnerPool) Register(c *ctx.GinRequest) {
+	form := forms.RegisterRunnerForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RegisterRunner(c.Service(), &form))
+}
+
+// Enable 启用 runner
+// @Tags runner
+// @Summary 启用 runner
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "runner ID"
+// @router /runners/pool/{id}/enable [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Runner}
+func (RunnerPool) Enable(c *ctx.GinRequest) {
+	form := forms.ChangeRunnerStatusForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.EnableRunner(c.Service(), &form))
+}
+
+// Disable 禁用 runner
+// @Tags runner
+// @Summary 禁用 runner
+// @Description 禁用的 runner 不再分配新任务，已分配且还未开始执行的任务会调度到其他可用的 runner
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "runner ID"
+// @router /runners/pool/{id}/disable [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Runner}
+func (RunnerPool) Disable(c *ctx.GinRequest) {
+	form := forms.ChangeRunnerStatusForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DisableRunner(c.Service(), &form))
+}
+
+// UpdateBindings 设置 runner 绑定的组织及项目
+// @Tags runner
+// @Summary 设置 runner 绑定的组织及项目
+// @Description 绑定后 runner 只执行这些组织或项目的任务，组织及项目都为空时为所有组织共享的 runner。选择 runner 时优先选择绑定了项目的 runner，其次为绑定了组织的 runner
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "runner ID"
+// @Param form body forms.UpdateRunnerBindingsForm true "parameter"
+// @router /runners/pool/{id}/bindings [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Runner}
+func (RunnerPool) UpdateBindings(c *ctx.GinRequest) {
+	form := forms.UpdateRunnerBindingsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateRunnerBindings(c.Service(), &form))
+}
+
+// SearchPluginCache 查询 runner 的 provider 缓存
+// @Tags runner
+// @Summary 查询 runner 的 provider 缓存
+// @Description 返回 runner 的 provider 缓存目录中已下载的 provider，同一 runner 上的任务执行 init 时共享该缓存
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "runner ID"
+// @router /runners/pool/{id}/plugin_cache [get]
+// @Success 200 {object} ctx.JSONResult{result=[]runner.CachedProvider}
+func (RunnerPool) SearchPluginCache(c *ctx.GinRequest) {
+	form := forms.SearchRunnerPluginCacheForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRunnerPluginCache(c.Service(), &form))
+}
+
+// PrewarmPluginCache 预热 runner 的 provider 缓存
+// @Tags runner
+// @Summary 预热 runner 的 provider 缓存
+// @Description 在 runner 上执行 init 将指定的 provider 下载到缓存目录，未指定 provider 时使用 runner 配置的 prewarm_providers。接口等待下载完成后返回，exitCode 非 0 表示部分 provider 下载失败
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "runner ID"
+// @Param form body forms.PrewarmRunnerPluginCacheForm true "parameter"
+// @router /runners/pool/{id}/plugin_cache/prewarm [post]
+// @Success 200 {object} ctx.JSONResult{result=runner.PluginCachePrewarmResp}
+func (RunnerPool) PrewarmPluginCache(c *ctx.GinRequest) {
+	form := forms.PrewarmRunnerPluginCacheForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PrewarmRunnerPluginCache(c.Service(), &form))
+}
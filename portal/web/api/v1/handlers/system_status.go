@@ -21,6 +21,24 @@ func PortalSystemStatusSearch(c *ctx.GinRequest) {
 	c.JSONResult(apps.SystemStatusSearch())
 }
 
+// SchedulerStatsSearch 查询任务调度统计
+// @Summary 查询任务调度统计
+// @Description 查询每个组织正在执行及排队的任务数量、实际占用比例、按公平调度权重应占的比例以及排队时长
+// @Tags 系统状态
+// @Accept  json
+// @Produce  json
+// @Security AuthToken
+// @Param form query forms.SchedulerStatsForm true "parameter"
+// @Success 200 {object} ctx.JSONResult{result=[]services.TenantSchedulerStat}
+// @Router /systems/scheduler [get]
+func SchedulerStatsSearch(c *ctx.GinRequest) {
+	form := forms.SchedulerStatsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SchedulerStats(c.Service(), &form))
+}
+
 func ConsulKVSearch(c *ctx.GinRequest) {
 	key := c.Query("key")
 	c.JSONResult(apps.ConsulKVSearch(key))
@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models/forms"
+	"path"
 )
 
 type Task struct {
@@ -51,6 +52,66 @@ func (Task) Detail(c *ctx.GinRequest) {
 	c.JSONResult(apps.TaskDetail(c.Service(), form))
 }
 
+// Wait 等待任务结束
+// @Tags 环境
+// @Summary 等待任务结束
+// @Description 阻塞等待部署任务结束或超时，exitCode: 0 执行成功，1 执行失败或被驳回，3 等待超时
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form query forms.WaitTaskForm true "parameter"
+// @router /tasks/{taskId}/wait [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TaskWaitResult}
+func (Task) Wait(c *ctx.GinRequest) {
+	form := forms.WaitTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.WaitTask(c, &form))
+}
+
+// SearchScheduled 查询等待计划执行的任务
+// @Tags 环境
+// @Summary 查询等待计划执行的任务
+// @Description 包括指定了计划执行时间及在环境部署窗口外提交的任务，按计划执行时间排序
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchScheduledTaskForm true "parameter"
+// @router /scheduled_tasks [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.Task}}
+func (Task) SearchScheduled(c *ctx.GinRequest) {
+	form := forms.SearchScheduledTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchScheduledTask(c.Service(), &form))
+}
+
+// CancelScheduled 取消等待计划执行的任务
+// @Tags 环境
+// @Summary 取消等待计划执行的任务
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /scheduled_tasks/{taskId} [delete]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Task) CancelScheduled(c *ctx.GinRequest) {
+	form := forms.CancelScheduledTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CancelScheduledTask(c.Service(), &form))
+}
+
 // FollowLogSse 当前任务实时日志
 // @Tags 环境
 // @Summary 当前任务实时日志
@@ -103,6 +164,7 @@ func (Task) FollowStepLogSse(c *ctx.GinRequest) { //nolint:dupl
 // TaskApprove 审批执行计划
 // @Tags 环境
 // @Summary 审批执行计划
+// @Description 云模板设置了审批人数时需要多个审批人通过审批，每个审批人只能审批一次，任一审批人驳回即驳回该作业
 // @Accept application/x-www-form-urlencoded
 // @Produce json
 // @Security AuthToken
@@ -111,7 +173,7 @@ func (Task) FollowStepLogSse(c *ctx.GinRequest) { //nolint:dupl
 // @Param taskId path string true "任务ID"
 // @Param form formData forms.ApproveTaskForm true "parameter"
 // @router /tasks/{taskId}/approve [post]
-// @Success 200 {object} ctx.JSONResult{result=apps.taskDetailResp}
+// @Success 200 {object} ctx.JSONResult{result=apps.TaskApprovalStatus}
 func (Task) TaskApprove(c *ctx.GinRequest) {
 	form := &forms.ApproveTaskForm{}
 	if err := c.Bind(form); err != nil {
@@ -120,6 +182,44 @@ func (Task) TaskApprove(c *ctx.GinRequest) {
 	c.JSONResult(apps.ApproveTask(c.Service(), form))
 }
 
+// SearchApprovals 查询任务的审批记录
+// @Tags 环境
+// @Summary 查询任务的审批记录
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/approvals [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.TaskApprovalsResp}
+func (Task) SearchApprovals(c *ctx.GinRequest) {
+	form := &forms.SearchTaskApprovalForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskApprovals(c.Service(), form))
+}
+
+// PendingApprovals 查询等待当前用户审批的任务
+// @Tags 环境
+// @Summary 查询等待当前用户审批的任务
+// @Description 返回组织下所有项目中当前用户有权限审批且还未审批过的任务
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.SearchPendingApprovalForm true "parameter"
+// @router /approvals/pending [get]
+// @Success 200 {object} ctx.JSONResult{result=[]apps.PendingApprovalResp}
+func (Task) PendingApprovals(c *ctx.GinRequest) {
+	form := &forms.SearchPendingApprovalForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchPendingApprovals(c.Service(), form))
+}
+
 // Log 任务日志
 // @Tags 环境
 // @Summary 任务日志
@@ -180,6 +280,27 @@ func (Task) Resource(c *ctx.GinRequest) {
 	c.JSONResult(apps.SearchTaskResources(c.Service(), &form))
 }
 
+// CostEstimate 获取任务的费用估算
+// @Tags 环境
+// @Summary 获取任务的费用估算
+// @Description 返回任务 plan 结果中各资源的月度费用变化，组织未配置费用估算价格时不进行估算
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param form query forms.SearchTaskCostEstimateForm true "parameter"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/cost_estimate [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.TaskCostEstimateResp{list=[]models.TaskCostEstimate}}
+func (Task) CostEstimate(c *ctx.GinRequest) {
+	form := forms.SearchTaskCostEstimateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskCostEstimates(c.Service(), &form))
+}
+
 // SearchTaskStep 获取任务的步骤列表和各步骤的状态
 // @Tags 任务管理
 // @Summary 获取任务步骤详情
@@ -243,3 +364,170 @@ func (Task) ResourceGraph(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.SearchTaskResourcesGraph(c.Service(), &form))
 }
+
+// Variables 任务使用的变量
+// @Tags 环境
+// @Summary 任务使用的变量
+// @Description 返回任务创建时解析得到的完整变量集合，敏感变量只返回占位符
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/variables [get]
+// @Success 200 {object} ctx.JSONResult{result=models.TaskVarSnapshot}
+func (Task) Variables(c *ctx.GinRequest) {
+	form := forms.TaskVariablesForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TaskVariables(c.Service(), &form))
+}
+
+// Timeline 任务执行时间线
+// @Tags 环境
+// @Summary 任务执行时间线
+// @Description 按时间顺序返回任务的创建、排队、步骤执行、审批、结束等事件，以及排队、审批、执行等阶段的耗时(秒)
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/timeline [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TaskTimeline}
+func (Task) Timeline(c *ctx.GinRequest) {
+	form := forms.TaskTimelineForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TaskTimeline(c.Service(), &form))
+}
+
+// SearchStepAttempts 任务步骤重试记录
+// @Tags 环境
+// @Summary 任务步骤重试记录
+// @Description 返回步骤自动重试前每次失败执行的结果，包括退出码、匹配到的临时性错误规则及重试等待时间
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/attempts [get]
+// @Success 200 {object} ctx.JSONResult{result=[]models.TaskStepAttempt}
+func (Task) SearchStepAttempts(c *ctx.GinRequest) {
+	form := forms.SearchTaskStepAttemptForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskStepAttempts(c.Service(), &form))
+}
+
+// SearchArtifacts 任务产物列表
+// @Tags 环境
+// @Summary 任务产物列表
+// @Description 返回任务步骤发布的产物文件，步骤可以将文件写入 $CLOUDIAC_ARTIFACTS_DIR 目录，或者在 pipeline 步骤中通过 artifacts 指定需要保存的文件
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/artifacts [get]
+// @Success 200 {object} ctx.JSONResult{result=[]models.TaskArtifact}
+func (Task) SearchArtifacts(c *ctx.GinRequest) {
+	form := forms.SearchTaskArtifactForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskArtifacts(c.Service(), &form))
+}
+
+// DownloadArtifact 下载任务产物
+// @Tags 环境
+// @Summary 下载任务产物
+// @Accept application/x-www-form-urlencoded
+// @Produce application/octet-stream
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param artifactId path string true "产物ID"
+// @router /tasks/{taskId}/artifacts/{artifactId}/download [get]
+// @Success 200 {file} file "artifact"
+func (Task) DownloadArtifact(c *ctx.GinRequest) {
+	form := forms.DownloadTaskArtifactForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	artifact, data, err := apps.DownloadTaskArtifact(c.Service(), &form)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	c.FileDownloadResponse(data, path.Base(artifact.Name), "application/octet-stream")
+}
+
+// VariablesDiff 比较两个任务使用的变量
+// @Tags 环境
+// @Summary 比较两个任务使用的变量
+// @Description 比较任务与基准任务使用的变量，未指定基准任务时与同一环境的上一个任务比较，敏感变量只返回值是否变化
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form query forms.DiffTaskVariablesForm true "parameter"
+// @router /tasks/{taskId}/variables/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.TaskVarsDiffResp}
+func (Task) VariablesDiff(c *ctx.GinRequest) {
+	form := forms.DiffTaskVariablesForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DiffTaskVariables(c.Service(), &form))
+}
+
+// Retry 从失败步骤重试任务
+// @Tags 环境
+// @Summary 从失败步骤重试任务
+// @Description 只有环境最新的失败任务可以重试，已成功的步骤不再执行，apply/destroy 步骤失败时从 plan 步骤重新执行
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @router /tasks/{taskId}/retry [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Task) Retry(c *ctx.GinRequest) {
+	form := forms.RetryTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RetryTask(c.Service(), &form))
+}
+
+// Cancel 取消任务
+// @Tags 环境
+// @Summary 取消任务
+// @Description 未开始执行的任务直接取消；执行中的任务先中断 terraform 执行使其释放 state 锁，超过等待时间后强制停止，任务状态为 cancelled
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param taskId path string true "任务ID"
+// @Param form formData forms.CancelTaskForm true "parameter"
+// @router /tasks/{taskId}/cancel [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (Task) Cancel(c *ctx.GinRequest) {
+	form := forms.CancelTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CancelTask(c.Service(), &form))
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type TaskQueue struct {
+	ctrl.GinController
+}
+
+// Search 查询任务队列
+// @Tags 系统状态
+// @Summary 查询任务队列
+// @Description 返回每个 runner 排队中的任务(按调度顺序)及预计开始时间，以及每个组织的排队任务统计。预计开始时间按 runner 近期任务的平均执行时长估算
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param form query forms.SearchTaskQueueForm true "parameter"
+// @router /systems/task_queue [get]
+// @Success 200 {object} ctx.JSONResult{result=services.TaskQueue}
+func (TaskQueue) Search(c *ctx.GinRequest) {
+	form := forms.SearchTaskQueueForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTaskQueue(c.Service(), &form))
+}
+
+// UpdatePriority 调整排队中任务的优先级
+// @Tags 系统状态
+// @Summary 调整排队中任务的优先级
+// @Description 值越大越优先执行，同一环境的部署任务仍按创建顺序执行
+// @Accept application/x-www-form-urlencoded, application/json
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "任务ID"
+// @Param form body forms.UpdateTaskQueuePriorityForm true "parameter"
+// @router /systems/task_queue/{id}/priority [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (TaskQueue) UpdatePriority(c *ctx.GinRequest) {
+	form := forms.UpdateTaskQueuePriorityForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateTaskQueuePriority(c.Service(), &form))
+}
+
+// Cancel 取消排队中的任务
+// @Tags 系统状态
+// @Summary 取消排队中的任务
+// @Description 只能取消未开始执行的任务
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param id path string true "任务ID"
+// @router /systems/task_queue/{id} [delete]
+// @Success 200 {object} ctx.JSONResult{result=models.Task}
+func (TaskQueue) Cancel(c *ctx.GinRequest) {
+	form := forms.CancelQueuedTaskForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CancelQueuedTask(c.Service(), &form))
+}
@@ -3,7 +3,6 @@
 package handlers
 
 import (
-	"cloudiac/common"
 	"cloudiac/portal/apps"
 	"cloudiac/portal/consts/e"
 	"cloudiac/portal/libs/ctrl"
@@ -77,10 +76,10 @@ func (Template) Update(c *ctx.GinRequest) {
 	c.JSONResult(apps.UpdateTemplate(c.Service(), &form))
 }
 
-// Delete 删除活跃云模板
-// @Summary 删除云模板
+// Delete 删除(归档)云模板
+// @Summary 删除(归档)云模板
 // @Tags 云模板
-// @Description 删除云模板,需要组织管理员权限。
+// @Description 归档云模板，归档后默认不在列表中显示，可以恢复，需要组织管理员权限。
 // @Accept multipart/form-data
 // @Accept json
 // @Produce json
@@ -118,6 +117,215 @@ func (Template) Detail(c *ctx.GinRequest) {
 	c.JSONResult(apps.TemplateDetail(c.Service(), &form))
 }
 
+// Health 云模板健康报告
+// @Summary 云模板健康报告
+// @Tags 云模板
+// @Description 静态分析云模板源码，列出未使用的变量、未声明的变量引用以及未被引用的模块输出
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/health [get]
+// @Success 200 {object} ctx.JSONResult{result=tfanalysis.Report}
+func (Template) Health(c *ctx.GinRequest) {
+	form := forms.TemplateHealthForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateHealth(c.Service(), &form))
+}
+
+// Triggers 云模板触发器
+// @Summary 查询云模板触发器及 webhook 注册状态
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/triggers [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.TemplateTriggersResp}
+func (Template) Triggers(c *ctx.GinRequest) {
+	form := forms.TemplateTriggersForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateTriggers(c.Service(), &form))
+}
+
+// UpdateTriggers 更新云模板触发器
+// @Summary 更新云模板触发器并重新注册 webhook
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param json body forms.UpdateTemplateTriggersForm true "parameter"
+// @Router /templates/{templateId}/triggers [put]
+// @Success 200 {object} ctx.JSONResult{result=apps.TemplateTriggersResp}
+func (Template) UpdateTriggers(c *ctx.GinRequest) {
+	form := forms.UpdateTemplateTriggersForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UpdateTemplateTriggers(c.Service(), &form))
+}
+
+// Revisions 云模板修订记录
+// @Summary 查询云模板的修订记录
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form query forms.SearchTemplateRevisionForm true "parameter"
+// @Router /templates/{templateId}/revisions [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.TemplateRevision}}
+func (Template) Revisions(c *ctx.GinRequest) {
+	form := forms.SearchTemplateRevisionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTemplateRevisions(c.Service(), &form))
+}
+
+// RevisionDiff 对比云模板修订
+// @Summary 对比云模板两个修订之间的属性差异
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form query forms.TemplateRevisionDiffForm true "parameter"
+// @Router /templates/{templateId}/revisions/diff [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.TemplateRevisionDiffResp}
+func (Template) RevisionDiff(c *ctx.GinRequest) {
+	form := forms.TemplateRevisionDiffForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateRevisionDiff(c.Service(), &form))
+}
+
+// Rollback 回滚云模板
+// @Summary 将云模板回滚到指定修订
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param revision path int true "修订号"
+// @Router /templates/{templateId}/revisions/{revision}/rollback [post]
+// @Success 200 {object} ctx.JSONResult{result=models.Template}
+func (Template) Rollback(c *ctx.GinRequest) {
+	form := forms.RollbackTemplateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RollbackTemplate(c.Service(), &form))
+}
+
+// WebhookDeliveries 云模板 webhook 投递记录
+// @Summary 查询云模板代码仓库的 webhook 投递记录
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form query forms.SearchTemplateWebhookDeliveryForm true "parameter"
+// @Router /templates/{templateId}/webhook_deliveries [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]models.WebhookDelivery}}
+func (Template) WebhookDeliveries(c *ctx.GinRequest) {
+	form := forms.SearchTemplateWebhookDeliveryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTemplateWebhookDeliveries(c.Service(), &form))
+}
+
+// WebhookDeliveryDetail webhook 投递记录详情
+// @Summary 查询 webhook 投递记录详情，包含请求头及请求内容
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param deliveryId path string true "投递记录ID"
+// @Router /templates/{templateId}/webhook_deliveries/{deliveryId} [get]
+// @Success 200 {object} ctx.JSONResult{result=models.WebhookDelivery}
+func (Template) WebhookDeliveryDetail(c *ctx.GinRequest) {
+	form := forms.TemplateWebhookDeliveryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateWebhookDeliveryDetail(c.Service(), &form))
+}
+
+// ReplayWebhookDelivery 重放 webhook 投递
+// @Summary 使用投递记录的请求内容重新处理 webhook，返回新的投递记录
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param deliveryId path string true "投递记录ID"
+// @Router /templates/{templateId}/webhook_deliveries/{deliveryId}/replay [post]
+// @Success 200 {object} ctx.JSONResult{result=models.WebhookDelivery}
+func (Template) ReplayWebhookDelivery(c *ctx.GinRequest) {
+	form := forms.TemplateWebhookDeliveryForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ReplayTemplateWebhookDelivery(c.Service(), &form))
+}
+
+// SyncRepo 从代码仓库的云模板清单同步云模板
+// @Summary 按代码仓库根目录下的 .cloudiac.yml 清单创建或更新云模板
+// @Tags 云模板
+// @Description 按名称匹配组织中的云模板，不存在时创建，存在时更新与清单不一致的属性。每个云模板单独处理，results 中返回每个云模板的同步结果，使用该仓库但未在清单中声明的云模板不会被归档
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.SyncTemplateRepoForm true "parameter"
+// @Router /templates/sync_repo [post]
+// @Success 200 {object} ctx.JSONResult{result=apps.SyncTemplateRepoResp}
+func (Template) SyncRepo(c *ctx.GinRequest) {
+	form := forms.SyncTemplateRepoForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SyncTemplateRepo(c.Service(), &form))
+}
+
+// Batch 批量操作云模板
+// @Summary 批量启用/禁用、删除云模板或重新绑定策略组
+// @Tags 云模板
+// @Description 所有云模板在同一事务中处理，任意一个云模板操作失败时整个批量操作都不会生效，results 中返回每个云模板的处理结果
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param json body forms.BatchTemplateForm true "parameter"
+// @Router /templates/batch [post]
+// @Success 200 {object} ctx.JSONResult{result=apps.BatchTemplateResp}
+func (Template) Batch(c *ctx.GinRequest) {
+	form := forms.BatchTemplateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.BatchTemplate(c.Service(), &form))
+}
+
 // TemplateTfvarsSearch 列出代码仓库下包含.tfvars 的所有文件
 // @Tags 云模板
 // @Summary 列出代码仓库下.tfvars 的所有文件
@@ -176,14 +384,19 @@ func TemplatePlaybookSearch(c *ctx.GinRequest) {
 
 // TemplateTfVersionSearch
 // @Tags 云模板
-// @Summary terraform versions tf版本列表接口
+// @Summary terraform versions 引擎版本列表接口，engineType 为 opentofu 时返回 OpenTofu 版本
 // @Accept application/x-www-form-urlencoded
 // @Security AuthToken
 // @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.TemplateEngineVersionsForm true "parameter"
 // @router /templates/tfversions [get]
 // @Success 200 {object} []string
 func TemplateTfVersionSearch(c *ctx.GinRequest) {
-	c.JSONResult(common.TerraformVersions, nil)
+	form := forms.TemplateEngineVersionsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateEngineVersions(c.Service(), &form))
 }
 
 // AutoTemplateTfVersionChoice
@@ -208,7 +421,7 @@ func AutoTemplateTfVersionChoice(c *ctx.GinRequest) {
 // @Tags 云模板
 // @Accept multipart/form-data
 // @Accept application/x-www-form-urlencoded
-// @Summary 创建云模版前检查名称是否重复和工作目录是否正确
+// @Summary 云模板就绪检查，返回名称、工作目录、validate、变量文件、playbook、密钥等各检查项的结果
 // @Param IaC-Org-Id header string true "组织ID"
 // @Security AuthToken
 // @Param form query forms.TemplateTfVersionSearchForm true "parameter"
@@ -288,3 +501,204 @@ func TemplateImport(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.TemplateImport(c.Service(), &form))
 }
+
+// Favorite 收藏云模板
+// @Summary 收藏云模板
+// @Tags 云模板
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/favorite [put]
+// @Success 200 {object} ctx.JSONResult
+func (Template) Favorite(c *ctx.GinRequest) {
+	form := forms.TemplateFavoriteForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.FavoriteTemplate(c.Service(), &form, true))
+}
+
+// Unfavorite 取消收藏云模板
+// @Summary 取消收藏云模板
+// @Tags 云模板
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/favorite [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Template) Unfavorite(c *ctx.GinRequest) {
+	form := forms.TemplateFavoriteForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.FavoriteTemplate(c.Service(), &form, false))
+}
+
+// Labels 查询云模板标签
+// @Summary 查询云模板标签
+// @Tags 云模板
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/labels [get]
+// @Success 200 {object} ctx.JSONResult{result=[]models.TemplateLabel}
+func (Template) Labels(c *ctx.GinRequest) {
+	form := forms.SearchTemplateLabelForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchTemplateLabels(c.Service(), &form))
+}
+
+// SetLabel 设置云模板标签
+// @Summary 设置云模板标签
+// @Description 标签已存在时更新标签值
+// @Tags 云模板
+// @Accept multipart/form-data
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param json body forms.TemplateLabelForm true "parameter"
+// @Router /templates/{templateId}/labels [put]
+// @Success 200 {object} ctx.JSONResult{result=models.TemplateLabel}
+func (Template) SetLabel(c *ctx.GinRequest) {
+	form := forms.TemplateLabelForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SetTemplateLabel(c.Service(), &form))
+}
+
+// DeleteLabel 删除云模板标签
+// @Summary 删除云模板标签
+// @Tags 云模板
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param key path string true "标签名称"
+// @Router /templates/{templateId}/labels/{key} [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Template) DeleteLabel(c *ctx.GinRequest) {
+	form := forms.DeleteTemplateLabelForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteTemplateLabel(c.Service(), &form))
+}
+
+// Restore 恢复已归档的云模板
+// @Summary 恢复已归档的云模板
+// @Tags 云模板
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/restore [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Template}
+func (Template) Restore(c *ctx.GinRequest) {
+	form := forms.RestoreTemplateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.RestoreTemplate(c.Service(), &form))
+}
+
+// Purge 清除已归档的云模板
+// @Summary 清除已归档的云模板
+// @Tags 云模板
+// @Description 清除后云模板不可恢复，只有组织管理员可以操作
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/purge [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Template) Purge(c *ctx.GinRequest) {
+	form := forms.PurgeTemplateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PurgeTemplate(c.Service(), &form))
+}
+
+// Deprecate 废弃云模板
+// @Summary 废弃云模板并指定替代云模板
+// @Tags 云模板
+// @Description 废弃后云模板仍可部署，使用该云模板的环境会提示迁移到替代云模板
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param json body forms.DeprecateTemplateForm true "parameter"
+// @Router /templates/{templateId}/deprecation [put]
+// @Success 200 {object} ctx.JSONResult{result=models.Template}
+func (Template) Deprecate(c *ctx.GinRequest) {
+	form := forms.DeprecateTemplateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeprecateTemplate(c.Service(), &form))
+}
+
+// Undeprecate 取消云模板的废弃状态
+// @Summary 取消云模板的废弃状态
+// @Tags 云模板
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Router /templates/{templateId}/deprecation [delete]
+// @Success 200 {object} ctx.JSONResult{result=models.Template}
+func (Template) Undeprecate(c *ctx.GinRequest) {
+	form := forms.UndeprecateTemplateForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UndeprecateTemplate(c.Service(), &form))
+}
+
+// DeprecationReport 使用已废弃云模板的环境
+// @Summary 查询使用已废弃云模板的环境及最近一次迁移预览任务
+// @Tags 云模板
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param form query forms.TemplateDeprecationReportForm true "parameter"
+// @Router /templates/{templateId}/deprecation/envs [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]services.TplMigrationEnv}}
+func (Template) DeprecationReport(c *ctx.GinRequest) {
+	form := forms.TemplateDeprecationReportForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.TemplateDeprecationReport(c.Service(), &form))
+}
+
+// MigrateEnvs 预览环境迁移到替代云模板
+// @Summary 对使用已废弃云模板的环境批量创建基于替代云模板的 plan 任务
+// @Tags 云模板
+// @Description 任务只执行 plan 预览迁移后的资源变更，不修改环境的云模板及配置
+// @Accept application/json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param templateId path string true "云模板ID"
+// @Param json body forms.MigrateTemplateEnvsForm true "parameter"
+// @Router /templates/{templateId}/deprecation/migrate [post]
+// @Success 200 {object} ctx.JSONResult{result=[]apps.TplMigrationResult}
+func (Template) MigrateEnvs(c *ctx.GinRequest) {
+	form := forms.MigrateTemplateEnvsForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.MigrateTemplateEnvs(c.Service(), &form))
+}
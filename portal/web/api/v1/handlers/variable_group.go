@@ -145,6 +145,25 @@ func (VariableGroup) BatchUpdateRelationship(c *ctx.GinRequest) {
 	c.JSONResult(apps.BatchUpdateRelationship(c.Service(), &form))
 }
 
+// Access 变量组访问报告
+// @Tags 变量组
+// @Summary 查询可以使用变量组的环境
+// @Description 根据变量组的关联关系及共享范围，列出可以使用该变量组的环境
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param id path string true "变量组ID"
+// @router /var_groups/{id}/access [get]
+// @Success 200 {object} ctx.JSONResult{result=[]services.VarGroupAccessEnv}
+func (VariableGroup) Access(c *ctx.GinRequest) {
+	form := forms.VariableGroupAccessForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.VariableGroupAccess(c.Service(), &form))
+}
+
 // DeleteRelationship 删除变量组与实例的关系
 // @Tags 变量组
 // @Summary 删除变量组与实例的关系
@@ -7,6 +7,7 @@ import (
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models/forms"
+	"net/http"
 )
 
 type Vcs struct {
@@ -155,6 +156,44 @@ func (Vcs) ListTags(c *ctx.GinRequest) {
 	c.JSONResult(apps.ListRepoTags(c.Service(), &form))
 }
 
+// SearchBranches 分页查询代码仓库分支
+// @Tags Vcs仓库
+// @Summary 分页查询代码仓库分支，支持按名称过滤
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.SearchGitRevisionForm true "parameter"
+// @Router /vcs/{vcsId}/repo/branches [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]apps.Revision}}
+func (Vcs) SearchBranches(c *ctx.GinRequest) {
+	form := forms.SearchGitRevisionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRepoBranches(c.Service(), &form))
+}
+
+// SearchTags 分页查询代码仓库 tag
+// @Tags Vcs仓库
+// @Summary 分页查询代码仓库 tag，支持按名称过滤
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.SearchGitRevisionForm true "parameter"
+// @Router /vcs/{vcsId}/repo/tags [get]
+// @Success 200 {object} ctx.JSONResult{result=page.PageResp{list=[]apps.Revision}}
+func (Vcs) SearchTags(c *ctx.GinRequest) {
+	form := forms.SearchGitRevisionForm{}
+	if err := c.Bind(&form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchRepoTags(c.Service(), &form))
+}
+
 // GetReadmeContent 列出代码仓库下Readme 文件内容
 // @Tags Vcs仓库
 // @Summary 列出代码仓库下 Readme 文件内容
@@ -194,3 +233,221 @@ func (Vcs) SearchVcsFileContent(c *ctx.GinRequest) {
 	}
 	c.JSONResult(apps.SearchVcsFile(c.Service(), &form))
 }
+
+// ListRepoTree 浏览代码仓库目录
+// @Tags Vcs仓库
+// @Summary 列出代码仓库指定版本目录下的文件及子目录
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.GetRepoTreeForm true "parameter"
+// @Router /vcs/{vcsId}/repo/tree [get]
+// @Success 200 {object} ctx.JSONResult{result=[]vcsrv.TreeEntry}
+func (Vcs) ListRepoTree(c *ctx.GinRequest) {
+	form := &forms.GetRepoTreeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ListRepoTree(c.Service(), form))
+}
+
+// GetRepoBlob 读取代码仓库文件
+// @Tags Vcs仓库
+// @Summary 读取代码仓库指定版本的文件内容
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.GetRepoBlobForm true "parameter"
+// @Router /vcs/{vcsId}/repo/blob [get]
+// @Success 200 {object} ctx.JSONResult{result=vcsrv.Blob}
+func (Vcs) GetRepoBlob(c *ctx.GinRequest) {
+	form := &forms.GetRepoBlobForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.GetRepoBlob(c.Service(), form))
+}
+
+// ClearCache 清除vcs缓存
+// @Tags Vcs仓库
+// @Summary 清除vcs的仓库列表、分支/tag 及文件缓存
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.ClearVcsCacheForm true "parameter"
+// @Router /vcs/{vcsId}/cache [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) ClearCache(c *ctx.GinRequest) {
+	form := &forms.ClearVcsCacheForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.ClearVcsCache(c.Service(), form))
+}
+
+// OauthAuthorize 获取代码仓库授权地址
+// @Tags Vcs仓库
+// @Summary 获取当前用户授权访问代码仓库的地址(OAuth / GitHub App)
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "vcs ID"
+// @Router /vcs/{vcsId}/oauth/authorize [get]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) OauthAuthorize(c *ctx.GinRequest) {
+	form := &forms.VcsOauthAuthorizeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.VcsOauthAuthorize(c.Service(), form))
+}
+
+// DeleteOauthAuthorize 删除代码仓库授权
+// @Tags Vcs仓库
+// @Summary 删除当前用户对代码仓库的授权
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "vcs ID"
+// @Router /vcs/{vcsId}/oauth/authorize [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) DeleteOauthAuthorize(c *ctx.GinRequest) {
+	form := &forms.VcsOauthAuthorizeForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteVcsOauth(c.Service(), form))
+}
+
+// OauthCallback 代码仓库授权回调
+// @Tags Vcs仓库
+// @Summary 代码仓库授权回调，保存授权后跳转到平台页面
+// @Accept application/x-www-form-urlencoded
+// @Param form query forms.VcsOauthCallbackForm true "parameter"
+// @Router /vcs/oauth/callback [get]
+// @Success 302
+func (Vcs) OauthCallback(c *ctx.GinRequest) {
+	form := &forms.VcsOauthCallbackForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	redirectUrl, err := apps.VcsOauthCallback(c.Service(), form)
+	if err != nil {
+		c.JSONError(err)
+		return
+	}
+	c.Redirect(http.StatusFound, redirectUrl)
+}
+
+// CreateLocalRepo 创建本地仓库
+// @Tags Vcs仓库
+// @Summary 在本地 vcs 中创建代码仓库
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form formData forms.CreateLocalRepoForm true "parameter"
+// @Router /vcs/{vcsId}/repo [post]
+// @Success 200 {object} ctx.JSONResult{result=vcsrv.Projects}
+func (Vcs) CreateLocalRepo(c *ctx.GinRequest) {
+	form := &forms.CreateLocalRepoForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateLocalRepo(c.Service(), form))
+}
+
+// UploadLocalRepoArchive 上传代码压缩包到本地仓库
+// @Tags Vcs仓库
+// @Summary 上传代码 zip 压缩包，将压缩包内容提交到本地仓库的分支
+// @Accept multipart/form-data
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form formData forms.UploadLocalRepoArchiveForm true "parameter"
+// @Param file formData file true "代码 zip 压缩包"
+// @Router /vcs/{vcsId}/repo/archive [post]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) UploadLocalRepoArchive(c *ctx.GinRequest) {
+	form := &forms.UploadLocalRepoArchiveForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.UploadLocalRepoArchive(c.Service(), form))
+}
+
+// SetLocalRepoDefaultBranch 设置本地仓库默认分支
+// @Tags Vcs仓库
+// @Summary 设置本地仓库的默认分支
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form formData forms.SetLocalRepoDefaultBranchForm true "parameter"
+// @Router /vcs/{vcsId}/repo/default_branch [put]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) SetLocalRepoDefaultBranch(c *ctx.GinRequest) {
+	form := &forms.SetLocalRepoDefaultBranchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SetLocalRepoDefaultBranch(c.Service(), form))
+}
+
+// CreateLocalRepoBranch 创建本地仓库分支
+// @Tags Vcs仓库
+// @Summary 创建本地仓库分支
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form formData forms.CreateLocalRepoBranchForm true "parameter"
+// @Router /vcs/{vcsId}/branch [post]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) CreateLocalRepoBranch(c *ctx.GinRequest) {
+	form := &forms.CreateLocalRepoBranchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.CreateLocalRepoBranch(c.Service(), form))
+}
+
+// DeleteLocalRepoBranch 删除本地仓库分支
+// @Tags Vcs仓库
+// @Summary 删除本地仓库分支
+// @Accept application/x-www-form-urlencoded
+// @Accept json
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param vcsId path string true "Vcs仓库ID"
+// @Param form query forms.DeleteLocalRepoBranchForm true "parameter"
+// @Router /vcs/{vcsId}/branch [delete]
+// @Success 200 {object} ctx.JSONResult
+func (Vcs) DeleteLocalRepoBranch(c *ctx.GinRequest) {
+	form := &forms.DeleteLocalRepoBranchForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.DeleteLocalRepoBranch(c.Service(), form))
+}
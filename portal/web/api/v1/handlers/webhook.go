@@ -3,15 +3,26 @@
 package handlers
 
 import (
+	"bytes"
 	"cloudiac/portal/apps"
 	"cloudiac/portal/libs/ctx"
 	"cloudiac/portal/models/forms"
+	"io"
 )
 
 func WebhooksApiHandler(c *ctx.GinRequest) {
+	// 绑定参数会读取请求内容，先保存原始内容用于记录投递日志
+	payload, _ := c.GetRawData()
+	c.Request.Body = io.NopCloser(bytes.NewReader(payload))
+
 	form := forms.WebhooksApiHandler{}
 	if err := c.Bind(&form); err != nil {
 		return
 	}
+	form.Payload = payload
+	form.Headers = make(map[string]string)
+	for k := range c.Request.Header {
+		form.Headers[k] = c.GetHeader(k)
+	}
 	c.JSONResult(apps.WebhooksApiHandler(c.Service(), form))
 }
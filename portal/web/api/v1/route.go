@@ -49,8 +49,15 @@ func Register(g *gin.RouterGroup) {
 	apiToken.Use(w(middleware.AuthApiToken))
 	apiToken.POST("/webhooks/:vcsType/:vcsId", w(handlers.WebhooksApiHandler))
 
+	// 聊天指令，通过平台签名校验请求，以聊天账号绑定的用户身份执行
+	g.POST("/chatops/slack", w(handlers.ChatOpsSlack))
+	g.POST("/chatops/dingtalk", w(handlers.ChatOpsDingTalk))
+
 	g.POST("/auth/login", w(handlers.Auth{}.Login))
 
+	// 代码仓库 OAuth 授权回调，通过 state 参数校验请求及确定授权用户
+	g.GET("/vcs/oauth/callback", w(handlers.Vcs{}.OauthCallback))
+
 	// Authorization Header 鉴权
 	g.Use(w(middleware.Auth)) // 解析 header token
 
@@ -65,11 +72,22 @@ func Register(g *gin.RouterGroup) {
 	g.PUT("/users/self", ac("self", "update"), w(handlers.User{}.UpdateSelf))
 	//todo runner list权限怎么划分
 	g.GET("/runners", ac(), w(handlers.RunnerSearch))
+	g.GET("/runners/pool", ac(), w(handlers.RunnerPool{}.Search))
+	g.POST("/runners/pool", ac(), w(handlers.RunnerPool{}.Register))
+	g.PUT("/runners/pool/:id/enable", ac(), w(handlers.RunnerPool{}.Enable))
+	g.PUT("/runners/pool/:id/disable", ac(), w(handlers.RunnerPool{}.Disable))
+	g.PUT("/runners/pool/:id/bindings", ac(), w(handlers.RunnerPool{}.UpdateBindings))
+	g.GET("/runners/pool/:id/plugin_cache", ac(), w(handlers.RunnerPool{}.SearchPluginCache))
+	g.POST("/runners/pool/:id/plugin_cache/prewarm", ac(), w(handlers.RunnerPool{}.PrewarmPluginCache))
 	g.PUT("/consul/tags/update", ac(), w(handlers.ConsulTagUpdate))
 	g.GET("/consul/kv/search", ac(), w(handlers.ConsulKVSearch))
 
 	ctrl.Register(g.Group("orgs", ac()), &handlers.Organization{})
 	g.PUT("/orgs/:id/status", ac(), w(handlers.Organization{}.ChangeOrgStatus))
+	g.GET("/orgs/:id/export", ac(), w(handlers.Organization{}.ExportData))
+	g.POST("/orgs/:id/purge", ac(), w(handlers.Organization{}.SchedulePurge))
+	g.DELETE("/orgs/:id/purge", ac(), w(handlers.Organization{}.CancelPurge))
+	g.GET("/orgs/:id/destruction_cert", ac(), w(handlers.Organization{}.DestructionCert))
 	ctrl.Register(g.Group("users", ac()), &handlers.User{})
 	g.PUT("/users/:id/status", ac(), w(handlers.User{}.ChangeUserStatus))
 	g.POST("/users/:id/password/reset", ac(), w(handlers.User{}.PasswordReset))
@@ -79,6 +97,12 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/systems", ac(), w(handlers.SystemConfig{}.Search))
 	// 系统状态
 	g.GET("/systems/status", w(handlers.PortalSystemStatusSearch))
+	// 任务调度统计
+	g.GET("/systems/scheduler", ac(), w(handlers.SchedulerStatsSearch))
+	// 任务队列，平台管理员可以调整排队任务的优先级或取消排队任务
+	g.GET("/systems/task_queue", ac(), w(handlers.TaskQueue{}.Search))
+	g.PUT("/systems/task_queue/:id/priority", ac(), w(handlers.TaskQueue{}.UpdatePriority))
+	g.DELETE("/systems/task_queue/:id", ac(), w(handlers.TaskQueue{}.Cancel))
 	// 系统设置registry addr 配置
 	g.GET("/system_config/registry/addr", ac(), w(handlers.GetRegistryAddr))     // 获取registry地址的设置
 	g.POST("/system_config/registry/addr", ac(), w(handlers.UpsertRegistryAddr)) // 更新registry地址的设置
@@ -95,6 +119,8 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/policies/:id/suppress/sources", ac(), w(handlers.Policy{}.SearchPolicySuppressSource))
 	g.DELETE("/policies/:id/suppress/:suppressId", ac("suppress"), w(handlers.Policy{}.DeletePolicySuppress))
 	g.GET("/policies/:id/report", ac(), w(handlers.Policy{}.PolicyReport))
+	g.PUT("/policies/:id/severity", ac("severity"), w(handlers.Policy{}.UpdatePolicySeverity))
+	g.DELETE("/policies/:id/severity", ac("severity"), w(handlers.Policy{}.DeletePolicySeverity))
 	g.POST("/policies/parse", ac(), w(handlers.Policy{}.Parse))
 	g.POST("/policies/test", ac(), w(handlers.Policy{}.Test))
 
@@ -106,7 +132,8 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/policies/templates/:id/valid_policies", ac(), w(handlers.Policy{}.ValidTplOfPolicy))
 	g.POST("/policies/templates/:id/scan", ac("scan"), w(handlers.Policy{}.ScanTemplate))
 	g.POST("/policies/templates/scans", ac("scan"), w(handlers.Policy{}.ScanTemplates))
-	g.GET("/policies/templates/:id/result", ac(), w(handlers.Policy{}.TemplateScanResult))
+	g.GET("/policies/templates/:id/result", ac(), w(middleware.Deprecated("/api/v2/policies/templates/:id/result")), w(handlers.Policy{}.TemplateScanResult))
+	g.GET("/policies/templates/:id/score_trend", ac(), w(handlers.Policy{}.TemplateScoreTrend))
 
 	g.GET("/policies/envs", ac(), w(handlers.Policy{}.SearchPolicyEnv))
 	g.PUT("/policies/envs/:id", ac(), w(handlers.Policy{}.UpdatePolicyEnv))
@@ -114,14 +141,21 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/policies/envs/:id/policies", ac(), w(handlers.Policy{}.EnvOfPolicy))
 	g.GET("/policies/envs/:id/valid_policies", ac(), w(handlers.Policy{}.ValidEnvOfPolicy))
 	g.POST("/policies/envs/:id/scan", ac("scan"), w(handlers.Policy{}.ScanEnvironment))
-	g.GET("/policies/envs/:id/result", ac(), w(handlers.Policy{}.EnvScanResult))
+	g.POST("/policies/envs/scans", ac("scan"), w(handlers.Policy{}.ScanEnvironments))
+	g.GET("/policies/envs/:id/result", ac(), w(middleware.Deprecated("/api/v2/policies/envs/:id/result")), w(handlers.Policy{}.EnvScanResult))
+	g.GET("/policies/envs/:id/score_trend", ac(), w(handlers.Policy{}.EnvScoreTrend))
+	g.GET("/policies/scans/:id/wait", ac(), w(handlers.Policy{}.WaitScanTask))
+	g.GET("/policies/results/:id/rego", ac(), w(handlers.Policy{}.ScanResultRego))
 
 	ctrl.Register(g.Group("policies/groups", ac()), &handlers.PolicyGroup{})
 	g.POST("/policies/groups/checks", ac(), w(handlers.PolicyGroupChecks))
+	g.POST("/policies/groups/upload", ac(), w(handlers.PolicyGroup{}.Upload))
 	g.GET("/policies/groups/:id/policies", ac(), w(handlers.PolicyGroup{}.SearchGroupOfPolicy))
 	g.POST("/policies/groups/:id", ac(), w(handlers.PolicyGroup{}.OpPolicyAndPolicyGroupRel))
 	g.GET("/policies/groups/:id/report", ac(), w(handlers.PolicyGroup{}.ScanReport))
 	g.GET("/policies/groups/:id/last_tasks", ac(), w(handlers.PolicyGroup{}.LastTasks))
+	g.GET("/policies/groups/:id/syncs", ac(), w(handlers.PolicyGroup{}.SearchSync))
+	g.GET("/policies/groups/:id/syncs/:syncId", ac(), w(handlers.PolicyGroup{}.SyncDetail))
 
 	// 组织下的资源搜索(只需要有项目的读权限即可查看资源)
 	g.GET("/orgs/resources", ac("orgs", "read"), w(handlers.Organization{}.SearchOrgResources))
@@ -141,6 +175,8 @@ func Register(g *gin.RouterGroup) {
 	g.DELETE("/projects/users/:id", ac(), w(handlers.ProjectUser{}.Delete))
 
 	//项目管理
+	g.GET("/projects/:id/quota", ac("project_quotas", "read"), w(handlers.Project{}.Quota))
+	g.PUT("/projects/:id/quota", ac("project_quotas", "update"), w(handlers.Project{}.UpdateQuota))
 	ctrl.Register(g.Group("projects", ac()), &handlers.Project{})
 
 	//变量管理
@@ -155,6 +191,7 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/var_groups/relationship", ac(), w(handlers.VariableGroup{}.SearchRelationship))
 	g.GET("/var_groups/relationship/all", ac(), w(handlers.VariableGroup{}.SearchRelationshipAll))
 	g.PUT("/var_groups/relationship/batch", ac(), w(handlers.VariableGroup{}.BatchUpdateRelationship))
+	g.GET("/var_groups/:id/access", ac(), w(handlers.VariableGroup{}.Access))
 	//g.DELETE("/var_groups/relationship/:id", ac(), w(handlers.VariableGroup{}.DeleteRelationship))
 
 	//token管理
@@ -164,12 +201,25 @@ func Register(g *gin.RouterGroup) {
 
 	ctrl.Register(g.Group("vcs", ac()), &handlers.Vcs{})
 	g.GET("/vcs/:id/repo", ac(), w(handlers.Vcs{}.ListRepos))
+	g.GET("/vcs/:id/repo/tree", ac(), w(handlers.Vcs{}.ListRepoTree))
+	g.GET("/vcs/:id/repo/blob", ac(), w(handlers.Vcs{}.GetRepoBlob))
+	g.GET("/vcs/:id/repo/branches", ac(), w(handlers.Vcs{}.SearchBranches))
+	g.GET("/vcs/:id/repo/tags", ac(), w(handlers.Vcs{}.SearchTags))
+	g.POST("/vcs/:id/repo", ac(), w(handlers.Vcs{}.CreateLocalRepo))
+	g.POST("/vcs/:id/repo/archive", ac(), w(handlers.Vcs{}.UploadLocalRepoArchive))
+	g.PUT("/vcs/:id/repo/default_branch", ac(), w(handlers.Vcs{}.SetLocalRepoDefaultBranch))
+	g.DELETE("/vcs/:id/cache", ac("update"), w(handlers.Vcs{}.ClearCache))
 	g.GET("/vcs/:id/branch", ac(), w(handlers.Vcs{}.ListBranches))
+	g.POST("/vcs/:id/branch", ac(), w(handlers.Vcs{}.CreateLocalRepoBranch))
+	g.DELETE("/vcs/:id/branch", ac(), w(handlers.Vcs{}.DeleteLocalRepoBranch))
 	g.GET("/vcs/:id/tag", ac(), w(handlers.Vcs{}.ListTags))
 	g.GET("/vcs/:id/readme", ac(), w(handlers.Vcs{}.GetReadmeContent))
+	g.GET("/vcs/:id/oauth/authorize", ac("read"), w(handlers.Vcs{}.OauthAuthorize))
+	g.DELETE("/vcs/:id/oauth/authorize", ac("read"), w(handlers.Vcs{}.DeleteOauthAuthorize))
 
 	g.GET("/registry/policy_groups", w(handlers.SearchRegistryPG))
 	g.GET("/registry/policy_groups/versions", w(handlers.SearchRegistryPGVersions))
+	g.POST("/registry/policy_groups/import", ac("policies", "import"), w(handlers.ImportRegistryPG))
 
 	// 云模板
 	ctrl.Register(g.Group("templates", ac()), &handlers.Template{})
@@ -177,6 +227,29 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/templates/tfversions", ac(), w(handlers.TemplateTfVersionSearch))
 	g.GET("/templates/autotfversion", ac(), w(handlers.AutoTemplateTfVersionChoice))
 	g.POST("/templates/checks", ac(), w(handlers.TemplateChecks))
+	g.POST("/templates/batch", ac("delete"), w(handlers.Template{}.Batch))
+	g.POST("/templates/sync_repo", ac(), w(handlers.Template{}.SyncRepo))
+	g.GET("/templates/:id/health", ac(), w(handlers.Template{}.Health))
+	g.PUT("/templates/:id/restore", ac("delete"), w(handlers.Template{}.Restore))
+	g.DELETE("/templates/:id/purge", ac("delete"), w(handlers.Template{}.Purge))
+	g.PUT("/templates/:id/deprecation", ac("update"), w(handlers.Template{}.Deprecate))
+	g.DELETE("/templates/:id/deprecation", ac("update"), w(handlers.Template{}.Undeprecate))
+	g.GET("/templates/:id/deprecation/envs", ac("read"), w(handlers.Template{}.DeprecationReport))
+	g.POST("/templates/:id/deprecation/migrate", ac("update"), w(handlers.Template{}.MigrateEnvs))
+	// 收藏只影响当前用户，有云模板读权限即可
+	g.PUT("/templates/:id/favorite", ac("read"), w(handlers.Template{}.Favorite))
+	g.DELETE("/templates/:id/favorite", ac("read"), w(handlers.Template{}.Unfavorite))
+	g.GET("/templates/:id/labels", ac("read"), w(handlers.Template{}.Labels))
+	g.PUT("/templates/:id/labels", ac("update"), w(handlers.Template{}.SetLabel))
+	g.DELETE("/templates/:id/labels/:key", ac("update"), w(handlers.Template{}.DeleteLabel))
+	g.GET("/templates/:id/triggers", ac(), w(handlers.Template{}.Triggers))
+	g.PUT("/templates/:id/triggers", ac(), w(handlers.Template{}.UpdateTriggers))
+	g.GET("/templates/:id/revisions", ac(), w(handlers.Template{}.Revisions))
+	g.GET("/templates/:id/revisions/diff", ac(), w(handlers.Template{}.RevisionDiff))
+	g.POST("/templates/:id/revisions/:revision/rollback", ac("update"), w(handlers.Template{}.Rollback))
+	g.GET("/templates/:id/webhook_deliveries", ac(), w(handlers.Template{}.WebhookDeliveries))
+	g.GET("/templates/:id/webhook_deliveries/:deliveryId", ac(), w(handlers.Template{}.WebhookDeliveryDetail))
+	g.POST("/templates/:id/webhook_deliveries/:deliveryId/replay", ac("update"), w(handlers.Template{}.ReplayWebhookDelivery))
 	g.GET("/templates/export", ac(), w(handlers.TemplateExport))
 	g.POST("/templates/import", ac(), w(handlers.TemplateImport))
 	g.GET("/vcs/:id/repos/tfvars", ac(), w(handlers.TemplateTfvarsSearch))
@@ -184,6 +257,31 @@ func Register(g *gin.RouterGroup) {
 	g.GET("/vcs/:id/file", ac(), w(handlers.Vcs{}.SearchVcsFileContent))
 	ctrl.Register(g.Group("notifications", ac()), &handlers.Notification{})
 
+	// 账单导入
+	ctrl.Register(g.Group("billing/connectors", ac()), &handlers.BillingConnector{})
+	g.POST("/billing/connectors/:id/sync", ac("sync"), w(handlers.BillingConnector{}.Sync))
+	g.GET("/billing/report", ac(), w(handlers.BillingReport))
+	g.GET("/billing/unmanaged", ac(), w(handlers.BillingUnmanaged))
+
+	// 费用估算
+	ctrl.Register(g.Group("cost/prices", ac()), &handlers.CostPrice{})
+	g.GET("/cost/dashboard", ac(), w(handlers.CostDashboard))
+
+	// 聊天账号绑定
+	ctrl.Register(g.Group("chatops/identities", ac()), &handlers.ChatIdentity{})
+
+	// 部署冻结窗口
+	g.GET("/freeze_windows/overrides", ac(), w(handlers.FreezeWindow{}.SearchOverrides))
+	ctrl.Register(g.Group("freeze_windows", ac()), &handlers.FreezeWindow{})
+
+	// 批量部署
+	ctrl.Register(g.Group("fleet_deploys", ac()), &handlers.FleetDeploy{})
+	g.GET("/fleet_deploys/:id/items", ac("fleet_deploys", "read"), w(handlers.FleetDeploy{}.Items))
+	g.POST("/fleet_deploys/:id/stop", ac("fleet_deploys", "stop"), w(handlers.FleetDeploy{}.Stop))
+
+	// 等待当前用户审批的任务(跨项目)
+	g.GET("/approvals/pending", ac("approvals", "read"), w(handlers.Task{}.PendingApprovals))
+
 	// 任务实时日志（云模板检测无项目ID）
 	g.GET("/tasks/:id/log/sse", ac(), w(handlers.Task{}.FollowLogSse))
 
@@ -193,25 +291,67 @@ func Register(g *gin.RouterGroup) {
 	// 环境管理
 	ctrl.Register(g.Group("envs", ac()), &handlers.Env{})
 	g.PUT("/envs/:id/archive", ac(), w(handlers.Env{}.Archive))
-	g.GET("/envs/:id/tasks", ac(), w(handlers.Env{}.SearchTasks))
+	g.GET("/envs/:id/tasks", ac(), w(middleware.Deprecated("/api/v2/envs/:id/tasks")), w(handlers.Env{}.SearchTasks))
 	g.GET("/envs/:id/tasks/last", ac(), w(handlers.Env{}.LastTask))
 	g.POST("/envs/:id/deploy", ac("envs", "deploy"), w(handlers.Env{}.Deploy))
 	g.POST("/envs/:id/destroy", ac("envs", "destroy"), w(handlers.Env{}.Destroy))
 	g.GET("/envs/:id/resources", ac(), w(handlers.Env{}.SearchResources))
 	g.GET("/envs/:id/output", ac(), w(handlers.Env{}.Output))
+	g.GET("/envs/:id/outputs", ac(), w(handlers.Env{}.Outputs))
+	g.GET("/envs/:id/outputs/history", ac(), w(handlers.Env{}.OutputHistory))
 	g.GET("/envs/:id/resources/:resourceId", ac(), w(handlers.Env{}.ResourceDetail))
 	g.GET("/envs/:id/variables", ac(), w(handlers.Env{}.Variables))
+	g.GET("/envs/:id/snapshot", ac(), w(handlers.Env{}.Snapshot))
+	g.POST("/envs/:id/attestations", ac("envs", "attest"), w(handlers.Env{}.Attest))
+	g.GET("/envs/:id/attestations", ac(), w(handlers.Env{}.SearchAttestations))
+	g.POST("/envs/:id/lock", ac("envs", "lock"), w(handlers.Env{}.Lock))
+	g.POST("/envs/:id/unlock", ac("envs", "lock"), w(handlers.Env{}.Unlock))
+	g.GET("/envs/:id/state_versions", ac(), w(handlers.Env{}.SearchStateVersions))
+	g.GET("/envs/:id/state_versions/diff", ac(), w(handlers.Env{}.DiffStateVersions))
+	g.POST("/envs/:id/state_versions/:version/restore", ac("envs", "staterestore"), w(handlers.Env{}.RestoreStateVersion))
+	g.GET("/envs/:id/state/export", ac("envs", "stateexport"), w(handlers.Env{}.ExportState))
+	g.POST("/envs/:id/state/import", ac("envs", "stateimport"), w(handlers.Env{}.ImportState))
+	g.POST("/envs/:id/resources/import", ac("envs", "deploy"), w(handlers.Env{}.ImportResource))
+	g.GET("/envs/:id/plans", ac(), w(handlers.Env{}.SearchPlans))
+	g.GET("/envs/:id/plans/:planId/download", ac("envs", "plandownload"), w(handlers.Env{}.DownloadPlan))
+	g.POST("/envs/:id/plans/:planId/apply", ac("envs", "deploy"), w(handlers.Env{}.ApplyPlan))
+	g.POST("/envs/:id/auto_destroy/extend", ac("envs", "update"), w(handlers.Env{}.ExtendAutoDestroy))
+	g.POST("/envs/:id/suspend", ac("envs", "suspend"), w(handlers.Env{}.SuspendJobs))
+	g.POST("/envs/:id/resume", ac("envs", "suspend"), w(handlers.Env{}.ResumeJobs))
+	g.GET("/envs/:id/suspensions", ac(), w(handlers.Env{}.SearchSuspensions))
+	g.GET("/envs/:id/drift/history", ac(), w(handlers.Env{}.SearchDriftHistory))
+	g.GET("/envs/:id/drift/trend", ac(), w(handlers.Env{}.DriftTrend))
+	g.GET("/auto_destroy_envs", ac("envs", "read"), w(handlers.Env{}.SearchAutoDestroy))
+	g.GET("/drift_stats", ac("envs", "read"), w(handlers.Env{}.DriftStats))
 	g.GET("/envs/:id/policy_result", ac(), w(handlers.Env{}.PolicyResult))
 	g.GET("/envs/:id/resources/graph", ac(), w(handlers.Env{}.SearchResourcesGraph))
 	g.GET("/envs/:id/resources/graph/:resourceId", ac(), w(handlers.Env{}.ResourceGraphDetail))
 
+	// 环境晋级
+	ctrl.Register(g.Group("promotion_chains", ac()), &handlers.PromotionChain{})
+	g.POST("/promotion_chains/:id/promote", ac("promotion_chains", "promote"), w(handlers.PromotionChain{}.Promote))
+	g.GET("/promotion_chains/:id/promotions", ac("promotion_chains", "read"), w(handlers.PromotionChain{}.Promotions))
+
 	// 任务管理
 	g.GET("/tasks", ac(), w(handlers.Task{}.Search))
 	g.GET("/tasks/:id", ac(), w(handlers.Task{}.Detail))
+	g.GET("/tasks/:id/wait", ac(), w(handlers.Task{}.Wait))
+	g.GET("/scheduled_tasks", ac("tasks", "read"), w(handlers.Task{}.SearchScheduled))
+	g.DELETE("/scheduled_tasks/:id", ac("tasks", "cancel"), w(handlers.Task{}.CancelScheduled))
 	g.GET("/tasks/:id/log", ac(), w(handlers.Task{}.Log))
 	g.GET("/tasks/:id/output", ac(), w(handlers.Task{}.Output))
 	g.GET("/tasks/:id/resources", ac(), w(handlers.Task{}.Resource))
+	g.GET("/tasks/:id/cost_estimate", ac(), w(handlers.Task{}.CostEstimate))
+	g.GET("/tasks/:id/variables", ac(), w(handlers.Task{}.Variables))
+	g.GET("/tasks/:id/variables/diff", ac(), w(handlers.Task{}.VariablesDiff))
+	g.GET("/tasks/:id/timeline", ac(), w(handlers.Task{}.Timeline))
+	g.GET("/tasks/:id/attempts", ac(), w(handlers.Task{}.SearchStepAttempts))
+	g.GET("/tasks/:id/artifacts", ac(), w(handlers.Task{}.SearchArtifacts))
+	g.GET("/tasks/:id/artifacts/:artifactId/download", ac(), w(handlers.Task{}.DownloadArtifact))
 	g.POST("/tasks/:id/approve", ac("tasks", "approve"), w(handlers.Task{}.TaskApprove))
+	g.GET("/tasks/:id/approvals", ac("tasks", "read"), w(handlers.Task{}.SearchApprovals))
+	g.POST("/tasks/:id/retry", ac("tasks", "retry"), w(handlers.Task{}.Retry))
+	g.POST("/tasks/:id/cancel", ac("tasks", "cancel"), w(handlers.Task{}.Cancel))
 	g.POST("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Create))
 	g.GET("/tasks/:id/comment", ac(), w(handlers.TaskComment{}.Search))
 	g.GET("/tasks/:id/steps", ac(), w(handlers.Task{}.SearchTaskStep))
@@ -0,0 +1,35 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package v2
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	pathPrefix   = "/api/v2/"
+	compatPrefix = "/api/v1/"
+)
+
+// Compat 兼容层，/api/v2 下没有单独实现的接口转发给 v1 处理，
+// 这样客户端可以统一使用 v2 地址，而无需为每个接口在 v2 中重复注册路由。
+// 需要作为第一个全局中间件注册，以保证转发前不会执行其他全局中间件(如操作日志记录)，避免重复执行
+func Compat(engine *gin.Engine) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// FullPath() 为空表示请求没有匹配到任何路由
+		if c.FullPath() != "" || !strings.HasPrefix(c.Request.URL.Path, pathPrefix) {
+			c.Next()
+			return
+		}
+
+		c.Request.URL.Path = compatPrefix + strings.TrimPrefix(c.Request.URL.Path, pathPrefix)
+		if c.Request.URL.RawPath != "" {
+			c.Request.URL.RawPath = compatPrefix + strings.TrimPrefix(c.Request.URL.RawPath, pathPrefix)
+		}
+		// 先 Abort 终止当前调用链，HandleContext 结束后会恢复 index，不会继续执行原调用链中的 handler
+		c.Abort()
+		engine.HandleContext(c)
+	}
+}
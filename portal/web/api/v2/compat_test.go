@@ -0,0 +1,57 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package v2
+
+import (
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/web/middleware"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e := gin.New()
+	e.Use(Compat(e))
+
+	calls := 0
+	e.Use(func(c *gin.Context) {
+		calls++
+		c.Next()
+	})
+	e.GET("/api/v1/envs/:id", ctrl.WrapHandler(middleware.Deprecated("/api/v2/envs/:id")), func(c *gin.Context) {
+		c.String(http.StatusOK, "v1 "+c.Param("id"))
+	})
+	e.GET("/api/v2/envs/:id/tasks", func(c *gin.Context) {
+		c.String(http.StatusOK, "v2 "+c.Param("id"))
+	})
+
+	cases := []struct {
+		path string
+		code int
+		body string
+		link string
+	}{
+		{"/api/v1/envs/env-1", http.StatusOK, "v1 env-1", "</api/v2/envs/env-1>; rel=\"successor-version\""},
+		{"/api/v2/envs/env-1", http.StatusOK, "v1 env-1", "</api/v2/envs/env-1>; rel=\"successor-version\""},
+		{"/api/v2/envs/env-1/tasks", http.StatusOK, "v2 env-1", ""},
+		{"/api/v2/notfound", http.StatusNotFound, "404 page not found", ""},
+	}
+	for _, c := range cases {
+		calls = 0
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, c.path, nil))
+		if w.Code != c.code || w.Body.String() != c.body {
+			t.Errorf("%s: got %d %q, want %d %q", c.path, w.Code, w.Body.String(), c.code, c.body)
+		}
+		if link := w.Header().Get("Link"); link != c.link {
+			t.Errorf("%s: got link %q, want %q", c.path, link, c.link)
+		}
+		if calls != 1 {
+			t.Errorf("%s: global middleware called %d times", c.path, calls)
+		}
+	}
+}
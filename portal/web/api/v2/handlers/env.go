@@ -0,0 +1,31 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type Env struct{}
+
+// SearchTasks 部署历史
+// @Tags 环境
+// @Summary 部署历史(游标分页)
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param IaC-Project-Id header string true "项目ID"
+// @Param envId path string true "环境ID"
+// @Param form query forms.SearchEnvTasksCursorForm true "parameter"
+// @Router /api/v2/envs/{envId}/tasks [get]
+// @Success 200 {object} ctx.JSONResult{result=page.CursorResp}
+func (Env) SearchTasks(c *ctx.GinRequest) {
+	form := &forms.SearchEnvTasksCursorForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.SearchEnvTasksByCursor(c.Service(), form))
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handlers
+
+import (
+	"cloudiac/portal/apps"
+	"cloudiac/portal/consts"
+	"cloudiac/portal/libs/ctx"
+	"cloudiac/portal/models/forms"
+)
+
+type Policy struct{}
+
+// EnvScanResult 环境策略扫描结果
+// @Tags 合规/环境
+// @Summary 环境策略扫描结果(按策略组分页)
+// @Description 与 v1 接口不同，v2 按策略组进行游标分页，每页返回完整的策略组，策略组的统计数据为该组全部结果的统计
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.PolicyScanResultCursorForm true "parameter"
+// @Param envId path string true "环境ID"
+// @Router /api/v2/policies/envs/{envId}/result [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.ScanResultCursorResp}
+func (Policy) EnvScanResult(c *ctx.GinRequest) {
+	form := &forms.PolicyScanResultCursorForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PolicyScanResultByGroup(c.Service(), consts.ScopeEnv, form))
+}
+
+// TemplateScanResult 云模板策略扫描结果
+// @Tags 合规/云模板
+// @Summary 云模板策略扫描结果(按策略组分页)
+// @Description 与 v1 接口不同，v2 按策略组进行游标分页，每页返回完整的策略组，策略组的统计数据为该组全部结果的统计
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Security AuthToken
+// @Param IaC-Org-Id header string true "组织ID"
+// @Param form query forms.PolicyScanResultCursorForm true "parameter"
+// @Param templateId path string true "云模板ID"
+// @Router /api/v2/policies/templates/{templateId}/result [get]
+// @Success 200 {object} ctx.JSONResult{result=apps.ScanResultCursorResp}
+func (Policy) TemplateScanResult(c *ctx.GinRequest) {
+	form := &forms.PolicyScanResultCursorForm{}
+	if err := c.Bind(form); err != nil {
+		return
+	}
+	c.JSONResult(apps.PolicyScanResultByGroup(c.Service(), consts.ScopeTemplate, form))
+}
@@ -0,0 +1,28 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package v2
+
+import (
+	"cloudiac/portal/libs/ctrl"
+	"cloudiac/portal/web/api/v2/handlers"
+	"cloudiac/portal/web/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Register 注册 v2 接口，v2 只包含相对 v1 有不兼容变更的接口，
+// 其他 /api/v2 请求由 Compat 转发到对应的 v1 接口处理
+func Register(g *gin.RouterGroup) {
+	w := ctrl.WrapHandler
+	ac := middleware.AccessControl
+
+	g.Use(gin.Logger())
+	g.Use(w(middleware.Auth))
+
+	g.Use(w(middleware.AuthOrgId))
+	g.GET("/policies/templates/:id/result", ac(), w(handlers.Policy{}.TemplateScanResult))
+	g.GET("/policies/envs/:id/result", ac(), w(handlers.Policy{}.EnvScanResult))
+
+	g.Use(w(middleware.AuthProjectId))
+	g.GET("/envs/:id/tasks", ac(), w(handlers.Env{}.SearchTasks))
+}
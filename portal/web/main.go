@@ -10,6 +10,7 @@ import (
 	"cloudiac/portal/libs/ctrl"
 	"cloudiac/portal/libs/ctx"
 	api_v1 "cloudiac/portal/web/api/v1"
+	api_v2 "cloudiac/portal/web/api/v2"
 	"cloudiac/portal/web/middleware"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
@@ -30,6 +31,8 @@ func GetRouter() *gin.Engine {
 		gin.DefaultWriter,
 		logs.MustGetLogWriter("error"),
 	)))
+	// v2 中未实现的接口转发到 v1
+	e.Use(api_v2.Compat(e))
 
 	// 允许跨域
 	e.Use(w(middleware.Cors))
@@ -43,6 +46,7 @@ func GetRouter() *gin.Engine {
 		})
 	}))
 	api_v1.Register(e.Group("/api/v1"))
+	api_v2.Register(e.Group("/api/v2"))
 
 	// 直接提供静态文件访问，生产环境部署时也可以使用 nginx 反代
 	e.StaticFS(consts.ReposUrlPrefix, gin.Dir(consts.LocalGitReposPath, true))
@@ -109,8 +109,10 @@ func Auth(c *ctx.GinRequest) {
 		c.JSONError(e.New(e.PermissionDeny, fmt.Errorf("project disabled")), http.StatusForbidden)
 		return
 	}
+	// 审计员可以访问组织下的所有项目，操作权限由 rbac 控制为只读
 	if c.Service().IsSuperAdmin ||
 		services.UserHasOrgRole(c.Service().UserId, c.Service().OrgId, consts.OrgRoleAdmin) ||
+		services.UserIsOrgAuditor(c.Service().UserId, c.Service().OrgId) ||
 		services.UserHasProjectRole(c.Service().UserId, c.Service().OrgId, c.Service().ProjectId, "") {
 		c.Next()
 		return
@@ -9,7 +9,7 @@ import (
 
 var (
 	allowHeaders  = "Content-Type,AccessToken,X-CSRF-Token,Authorization,Token"
-	exposeHeaders = "Content-Length,Access-Control-Allow-Origin,Access-Control-Allow-Headers,Content-Type"
+	exposeHeaders = "Content-Length,Access-Control-Allow-Origin,Access-Control-Allow-Headers,Content-Type,Deprecation,Link"
 )
 
 func Cors(c *ctx.GinRequest) {
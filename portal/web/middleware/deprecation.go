@@ -0,0 +1,23 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package middleware
+
+import (
+	"cloudiac/portal/libs/ctx"
+	"fmt"
+	"strings"
+)
+
+// Deprecated 返回标记接口已废弃的中间件，响应中会添加 Deprecation 头，
+// 并通过 Link 头指向替代的新版本接口，successor 中的路径参数(如 :id)会替换为本次请求的参数值
+func Deprecated(successor string) func(c *ctx.GinRequest) {
+	return func(c *ctx.GinRequest) {
+		link := successor
+		for _, p := range c.Params {
+			link = strings.ReplaceAll(link, ":"+p.Key, p.Value)
+		}
+		c.Header("Deprecation", "true")
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", link))
+		c.Next()
+	}
+}
@@ -105,6 +105,9 @@ func getCtxProjectRole(s *ctx.ServiceContext) string {
 		proj = consts.ProjectRoleManager
 	case services.UserHasOrgRole(s.UserId, s.OrgId, consts.OrgRoleAdmin):
 		proj = consts.ProjectRoleManager
+	case services.UserIsOrgAuditor(s.UserId, s.OrgId):
+		// 审计员只有只读权限，忽略其项目角色
+		proj = ""
 	case s.ProjectId != "":
 		userProjects := services.UserProjectRoles(s.UserId)
 		userProject := userProjects[s.ProjectId]
@@ -0,0 +1,36 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package handler
+
+import (
+	"net/http"
+
+	"cloudiac/runner"
+	"cloudiac/runner/api/ctx"
+)
+
+// ListCachedProviders 列出 provider 缓存目录中的 provider
+func ListCachedProviders(c *ctx.Context) {
+	providers, err := runner.ListCachedProviders()
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(providers)
+}
+
+// PrewarmPluginCache 下载指定的 provider 到缓存目录，等待下载完成后返回
+func PrewarmPluginCache(c *ctx.Context) {
+	req := runner.PluginCachePrewarmReq{}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := runner.PrewarmPluginCache(c.Context, req)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(resp)
+}
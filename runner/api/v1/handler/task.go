@@ -10,6 +10,7 @@ import (
 	"github.com/docker/docker/errdefs"
 	"github.com/gin-gonic/gin"
 
+	"cloudiac/configs"
 	"cloudiac/runner"
 	"cloudiac/runner/api/ctx"
 )
@@ -37,14 +38,32 @@ func StopTask(c *ctx.Context) {
 		return
 	}
 
+	if configs.Get().Runner.IsKubernetesBackend() {
+		if err := runner.DeleteTaskPods(c.Context, req.TaskId, req.ContainerIds); err != nil {
+			c.Error(err, http.StatusInternalServerError)
+			return
+		}
+		c.Result(nil)
+		return
+	}
+
 	cli, err := runner.DockerClient()
 	if err != nil {
 		c.Error(err, http.StatusInternalServerError)
 		return
 	}
 
+	containerIds := req.ContainerIds
+	if len(containerIds) == 0 {
+		// 容器 id 丢失时(如任务启动后未能保存容器 id)按任务 id 标签查找容器
+		if containerIds, err = runner.ListTaskContainerIds(c.Context, req.TaskId); err != nil {
+			c.Error(err, http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// 这里仅 kill container，container 的 remove 通过启动时的 AutoRemove 参数配置
-	for _, cid := range req.ContainerIds {
+	for _, cid := range containerIds {
 		// default signal "SIGKILL"
 		if err := cli.ContainerKill(c.Context, cid, ""); err != nil {
 			var targetErr errdefs.ErrNotFound
@@ -66,3 +85,70 @@ func StopTask(c *ctx.Context) {
 	}
 	c.Result(nil)
 }
+
+// CancelTask 优雅取消任务，先中断 terraform 执行，超过等待时间后强制停止容器
+func CancelTask(c *ctx.Context) {
+	req := runner.TaskCancelReq{}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := runner.CancelTask(c.Context, req)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(resp)
+}
+
+// ListContainers 按标签查询 runner 启动的任务容器，如 ?label=task-id=run-xxx&label=env-id=env-xxx
+func ListContainers(c *ctx.Context) {
+	req := runner.ContainerListReq{}
+	if err := c.BindQuery(&req); err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	containers, err := runner.ListContainers(c.Context, req.Labels, req.All)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(containers)
+}
+
+// ListWorkspaces 查询 runner 上的所有任务工作目录
+func ListWorkspaces(c *ctx.Context) {
+	workspaces, err := runner.ListWorkspaces()
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(workspaces)
+}
+
+// Health 查询 runner 的健康状态
+func Health(c *ctx.Context) {
+	health, err := runner.GetRunnerHealth(c.Context)
+	if err != nil {
+		c.Error(err, http.StatusInternalServerError)
+		return
+	}
+	c.Result(health)
+}
+
+// Cleanup 清理 portal 判定为孤儿的容器及工作目录
+func Cleanup(c *ctx.Context) {
+	req := runner.CleanupReq{}
+	if err := c.BindJSON(&req); err != nil {
+		c.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	resp := runner.Cleanup(c.Context, req)
+	for _, msg := range resp.Errors {
+		logger.Warnf("cleanup error: %s", msg)
+	}
+	c.Result(resp)
+}
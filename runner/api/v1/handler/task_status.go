@@ -163,6 +163,11 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 		} else {
 			msg.TfPlanJson = planJson
 		}
+		if planFile, err := runner.FetchPlanFile(task.EnvId, task.TaskId); err != nil {
+			logger.Errorf("fetch terraform plan file error: %v", err)
+		} else {
+			msg.TfPlanFile = planFile
+		}
 
 		if parseJson, err := runner.FetchJson(task.EnvId, task.TaskId, runner.ScanInputFile); err != nil {
 			logger.Errorf("fetch terrascan parsed json error: %v", err)
@@ -174,6 +179,21 @@ func doSendTaskStatus(wsConn *websocket.Conn, task *runner.StartedTask, withLog
 		} else {
 			msg.TfResultJson = resultJson
 		}
+		if validateJson, err := runner.FetchValidateResult(task.EnvId, task.TaskId); err != nil {
+			logger.Errorf("fetch terraform validate result error: %v", err)
+		} else {
+			msg.TfValidateJson = validateJson
+		}
+		if decisionLogJson, err := runner.FetchJson(task.EnvId, task.TaskId, runner.DecisionLogFile); err != nil {
+			logger.Errorf("fetch policy decision log error: %v", err)
+		} else {
+			msg.DecisionLogJson = decisionLogJson
+		}
+		if artifacts, err := runner.FetchStepArtifacts(task.EnvId, task.TaskId, task.Step); err != nil {
+			logger.Errorf("fetch step artifacts error: %v", err)
+		} else {
+			msg.Artifacts = artifacts
+		}
 	}
 
 	if err := wsConn.WriteJSON(msg); err != nil {
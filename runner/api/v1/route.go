@@ -25,5 +25,12 @@ func RegisterRoute(apiV1 *gin.RouterGroup) {
 	apiV1.POST("/task/step/run", w(handler.RunTask))
 	apiV1.GET("/task/step/status", w(handler.TaskStatus))
 	apiV1.POST("/task/stop", w(handler.StopTask))
+	apiV1.POST("/task/cancel", w(handler.CancelTask))
+	apiV1.GET("/containers", w(handler.ListContainers))
+	apiV1.GET("/workspaces", w(handler.ListWorkspaces))
+	apiV1.POST("/cleanup", w(handler.Cleanup))
+	apiV1.GET("/health", w(handler.Health))
+	apiV1.GET("/plugin_cache/providers", w(handler.ListCachedProviders))
+	apiV1.POST("/plugin_cache/prewarm", w(handler.PrewarmPluginCache))
 	apiV1.GET("/task/step/log/follow", w(handler.TaskLogFollow))
 }
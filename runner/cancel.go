@@ -0,0 +1,103 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+)
+
+// 向容器中的 terraform/tofu 进程发送 SIGINT，terraform 收到信号后会停止执行并释放 state 锁。
+// 通过 comm 匹配进程名，避免匹配到 provider 插件进程及本脚本自身
+const interruptEngineScript = `for p in /proc/[0-9]*; do
+  case "$(cat "$p/comm" 2>/dev/null)" in
+    terraform|tofu) kill -INT "${p#/proc/}" 2>/dev/null;;
+  esac
+done
+exit 0`
+
+// CancelTask 优雅取消任务：先中断正在执行的 terraform 命令，等待步骤结束，
+// 超过 gracePeriod 后步骤仍未结束时强制停止任务容器。
+// 步骤在等待时间内退出时保留容器，以便 portal 继续执行信息采集步骤
+func CancelTask(ctx context.Context, req TaskCancelReq) (resp TaskCancelResp, err error) {
+	task, err := LoadStartedTask(req.EnvId, req.TaskId, req.Step)
+	if err != nil && !os.IsNotExist(err) {
+		return resp, errors.Wrap(err, "load started task")
+	}
+	if configs.Get().Runner.IsKubernetesBackend() {
+		return cancelKubeTask(ctx, req, task)
+	}
+	if task != nil {
+		if resp.Graceful, err = interruptTaskStep(ctx, task, time.Duration(req.GracePeriod)*time.Second); err != nil {
+			logger.WithField("taskId", req.TaskId).Warnf("interrupt task step: %v", err)
+		}
+		if resp.Graceful {
+			return resp, nil
+		}
+	}
+
+	containerIds := req.ContainerIds
+	if len(containerIds) == 0 {
+		if containerIds, err = ListTaskContainerIds(ctx, req.TaskId); err != nil {
+			return resp, err
+		}
+	}
+	return resp, killContainers(ctx, containerIds)
+}
+
+// interruptTaskStep 中断步骤中的 terraform 进程并等待步骤结束，返回步骤是否已结束
+func interruptTaskStep(ctx context.Context, task *StartedTask, gracePeriod time.Duration) (bool, error) {
+	if paused, err := (Executor{}).IsPaused(task.ContainerId); err != nil {
+		return false, err
+	} else if paused {
+		// 容器在步骤结束后被暂停，没有在执行的命令
+		return true, nil
+	}
+	if info, err := (Executor{}).GetExecInfo(task.ExecId); err != nil {
+		return false, err
+	} else if !info.Running {
+		return true, nil
+	}
+
+	if _, err := (Executor{}).RunCommand(task.ContainerId, []string{"/bin/sh", "-c", interruptEngineScript}); err != nil {
+		return false, errors.Wrap(err, "interrupt engine")
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, gracePeriod)
+	defer cancel()
+	if _, err := (Executor{}).WaitCommand(waitCtx, task.ContainerId, task.ExecId); err != nil {
+		if errors.Is(err, ErrContainerNotRun) {
+			// 步骤结束后容器可能被暂停
+			if info, er := (Executor{}).GetExecInfo(task.ExecId); er == nil && !info.Running {
+				return true, nil
+			}
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func killContainers(ctx context.Context, containerIds []string) error {
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+	for _, cid := range containerIds {
+		// default signal "SIGKILL"
+		if err := cli.ContainerKill(ctx, cid, ""); err != nil {
+			if errdefs.IsNotFound(err) || strings.Contains(err.Error(), "already in progress") ||
+				strings.Contains(err.Error(), "is not running") {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
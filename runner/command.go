@@ -29,11 +29,14 @@ type Executor struct {
 	Timeout    int
 	PrivateKey string
 
-	TerraformVersion string
+	TerraformVersion string // 引擎版本号
+	EngineType       string // 执行引擎(terraform/opentofu)
 	Commands         []string
-	HostWorkdir      string // 宿主机目录
-	Workdir          string // 容器目录
-	AutoRemove       bool   // 开启容器的自动删除？
+	Entrypoint       []string          // 覆盖镜像的 entrypoint，为空时使用镜像默认值
+	HostWorkdir      string            // 宿主机目录
+	Workdir          string            // 容器目录
+	AutoRemove       bool              // 开启容器的自动删除？
+	Labels           map[string]string // 容器标签
 	// for container
 	//ContainerInstance *Container
 }
@@ -124,7 +127,15 @@ func (exec *Executor) Start() (string, error) {
 	// 注意，该方案有个问题：客户无法自定义镜像预先安装需要的 terraform 版本，
 	// 因为判断版本不在 TerraformVersions 列表中就会挂载目录，客户自定义镜像安装的版本会被覆盖
 	//（考虑把版本列表写到配置文件？）
-	if !utils.StrInArray(exec.TerraformVersion, common.TerraformVersions...) {
+	if exec.EngineType == common.EngineOpenTofu {
+		if !utils.StrInArray(exec.TerraformVersion, common.OpenTofuVersions...) {
+			mountConfigs = append(mountConfigs, mount.Mount{
+				Type:   mount.TypeBind,
+				Source: conf.Runner.AbsTofuenvVersionsCachePath(),
+				Target: "/root/.tofuenv/versions",
+			})
+		}
+	} else if !utils.StrInArray(exec.TerraformVersion, common.TerraformVersions...) {
 		mountConfigs = append(mountConfigs, mount.Mount{
 			Type:   mount.TypeBind,
 			Source: conf.Runner.AbsTfenvVersionsCachePath(),
@@ -138,12 +149,14 @@ func (exec *Executor) Start() (string, error) {
 			Image:        exec.Image,
 			WorkingDir:   exec.Workdir,
 			Cmd:          exec.Commands,
+			Entrypoint:   exec.Entrypoint,
 			Env:          exec.Env,
 			OpenStdin:    true,
 			Tty:          true,
 			AttachStdin:  false,
 			AttachStdout: true,
 			AttachStderr: true,
+			Labels:       exec.Labels,
 		},
 		&container.HostConfig{
 			AutoRemove: exec.AutoRemove,
@@ -32,6 +32,10 @@ type StartedTask struct {
 
 	PauseOnFinish bool `json:"pauseOnFinish"` // 该步骤结束时暂停容器
 
+	RemoveOnFinish bool `json:"removeOnFinish"` // 步骤在独立的容器中执行，结束时删除容器
+
+	Backend string `json:"backend,omitempty"` // 执行后端，为空表示 docker，kubernetes 后端时 ContainerId 为 pod 名称
+
 	containerInfoLock sync.RWMutex `json:"-"`
 }
 
@@ -51,6 +55,14 @@ func LoadStartedTask(envId string, taskId string, step int) (*StartedTask, error
 }
 
 func (task *StartedTask) Cancel() error {
+	if task.isKubernetes() {
+		cli, err := kubernetesClient()
+		if err != nil {
+			return err
+		}
+		return cli.DeletePod(context.Background(), task.ContainerId, 0)
+	}
+
 	cli, err := client.NewClientWithOpts()
 	cli.NegotiateAPIVersion(context.Background())
 	if err != nil {
@@ -76,6 +88,12 @@ func (task *StartedTask) Status() (info types.ContainerExecInspect, err error) {
 	if task.hasContainerInfo() {
 		return task.readContainerInfo()
 	}
+	if task.isKubernetes() {
+		// pod 日志保存等结束后的处理由 Wait() 完成，处理完成(写入容器信息文件)前总是返回运行中
+		info, _, err = task.kubeExecInfo(context.Background())
+		info.Running = true
+		return info, err
+	}
 
 	info, err = Executor{}.GetExecInfo(task.ExecId)
 	if err != nil {
@@ -150,8 +168,12 @@ func (task *StartedTask) Wait(ctx context.Context) (int64, error) {
 	var (
 		info types.ContainerExecInspect
 		err  error
+
+		podMessage string
 	)
-	if task.StartedAt != nil && task.Timeout > 0 {
+	if task.isKubernetes() {
+		info, podMessage, err = task.waitKubePod(ctx)
+	} else if task.StartedAt != nil && task.Timeout > 0 {
 		deadline := task.StartedAt.Add(time.Duration(task.Timeout) * time.Second)
 		info, err = Executor{}.WaitCommandWithDeadline(ctx, task.ContainerId, task.ExecId, deadline)
 	} else {
@@ -166,7 +188,13 @@ func (task *StartedTask) Wait(ctx context.Context) (int64, error) {
 	// 执行结束后的处理
 	{
 		// 调用 Status() 获取一次任务最新状态，并保存状态到文件
-		if info, err = task.Status(); err != nil {
+		if task.isKubernetes() {
+			// pod 的状态己在等待时获取，pod 删除前先保存其输出
+			task.saveKubePodLogs(ctx, podMessage)
+			if err := task.writeContainerInfo(&info); err != nil {
+				logger.Warnf("write container info error: %v", err)
+			}
+		} else if info, err = task.Status(); err != nil {
 			logger.Warnf("get task status error: %v", err)
 		} else if err := task.writeContainerInfo(&info); err != nil {
 			logger.Warnf("write container info error: %v", err)
@@ -181,6 +209,13 @@ func (task *StartedTask) Wait(ctx context.Context) (int64, error) {
 				logger.Warn(err)
 			}
 		}
+
+		// 删除步骤使用的独立容器，容器不存在时 Cancel() 不会报错，可以重复调用
+		if task.RemoveOnFinish {
+			if err := task.Cancel(); err != nil {
+				logger.Warnf("remove step container error: %v", err)
+			}
+		}
 	}
 
 	return int64(info.ExitCode), nil
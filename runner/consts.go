@@ -25,6 +25,16 @@ const (
 	ContainerAssetsDir       = "/cloudiac/assets"                  // 挂载依赖资源，如 terraform.py 等(己打包到 worker 镜像)
 	ContainerPluginPath      = "/cloudiac/terraform/plugins"       // 预置 providers 目录(己打包到镜像)
 	ContainerPluginCachePath = "/cloudiac/terraform/plugins-cache" // terraform plugins 缓存目录
+
+	PluginCacheLockName = ".cloudiac.lock" // plugins 缓存目录的锁，执行 init 时持有
+)
+
+// 任务容器的标签，用于关联宿主机上的容器与 CloudIaC 任务
+const (
+	ContainerLabelPrefix  = "io.cloudiac."
+	ContainerLabelManaged = ContainerLabelPrefix + "managed" // 标识容器由 runner 启动
+	ContainerLabelTaskId  = ContainerLabelPrefix + "task-id"
+	ContainerLabelEnvId   = ContainerLabelPrefix + "env-id"
 )
 
 const (
@@ -34,13 +44,29 @@ const (
 	TaskInfoFileName          = "info.json"
 	TaskContainerInfoFileName = "container.json"
 
+	// kubernetes 后端步骤的退出码及 pod 输出，pod 删除后通过退出码文件获取步骤结果
+	TaskExitCodeFileName = "exit_code"
+	TaskPodLogFileName   = "pod.log"
+
+	// 步骤产物目录(位于步骤目录下)，步骤执行时通过 CLOUDIAC_ARTIFACTS_DIR 环境变量传入，
+	// 步骤结束后目录中的文件会上传到 portal
+	TaskArtifactsDirName = "artifacts"
+	TaskArtifactMaxSize  = 10 * 1024 * 1024 // 单个产物文件的大小限制，超出的文件不上传
+
 	CloudIacTfFile   = "_cloudiac.tf"
 	CloudIacPlayVars = "_cloudiac_play_vars.yml"
 
+	CloudIacModuleFile = "_cloudiac_module.tf" // 使用 registry 模块的云模板生成的根模块
+
 	TFStateJsonFile  = "tfstate.json"
 	TFPlanJsonFile   = "tfplan.json"
+	TFPlanFile       = "tfplan.bin" // plan 步骤生成的二进制 plan 文件
 	TFProviderSchema = "tfproviderschema.json"
 
+	TFValidateJsonFile   = "tfvalidate.json" // terraform validate -json 输出
+	TFFmtCheckFile       = "tffmt.txt"       // terraform fmt -check 输出的未格式化文件列表
+	TFValidateResultFile = "validate_result.json"
+
 	AnsibleStateAnalysisName = "terraform.py"
 
 	FollowLogDelay = time.Second // follow 文件时读到 EOF 后进行下次读取的等待时长
@@ -51,6 +77,10 @@ const (
 	ScanResultFile   = "scan_result.json"
 	ScanLogFile      = "scan.log"
 	RegoResultFile   = "scan_raw.json"
+	DecisionLogFile  = "decision_log.json" // 策略评估的决策日志，json lines 格式
+
+	ScanBaseInputFile  = "tfscan.base.json"      // 增量扫描基准任务的扫描输入
+	ScanBaseResultFile = "scan_result.base.json" // 增量扫描基准任务的扫描结果
 
 	PopulateSourceLineCount = 3
 )
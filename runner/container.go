@@ -0,0 +1,137 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+// ContainerLabels 生成任务容器的标签，task-id 及 env-id 总是使用请求中的值
+func ContainerLabels(req RunTaskReq) map[string]string {
+	labels := make(map[string]string, len(req.Labels)+3)
+	for k, v := range req.Labels {
+		labels[labelKey(k)] = v
+	}
+	labels[ContainerLabelManaged] = "true"
+	labels[ContainerLabelTaskId] = req.TaskId
+	if req.Env.Id != "" {
+		labels[ContainerLabelEnvId] = req.Env.Id
+	}
+	return labels
+}
+
+func labelKey(k string) string {
+	if strings.HasPrefix(k, ContainerLabelPrefix) {
+		return k
+	}
+	return ContainerLabelPrefix + k
+}
+
+// labelSelectors 生成 key=value 或 key(只要求存在该标签)格式的标签查询条件，只查询 runner 启动的容器，
+// selectors 格式同样为 key=value 或 key，key 可以省略标签前缀
+func labelSelectors(selectors []string) []string {
+	result := []string{ContainerLabelManaged + "=true"}
+	for _, s := range selectors {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if i := strings.Index(s, "="); i >= 0 {
+			result = append(result, labelKey(strings.TrimSpace(s[:i]))+"="+strings.TrimSpace(s[i+1:]))
+		} else {
+			result = append(result, labelKey(s))
+		}
+	}
+	return result
+}
+
+// labelFilters 生成容器查询条件
+func labelFilters(selectors []string) filters.Args {
+	args := filters.NewArgs()
+	for _, s := range labelSelectors(selectors) {
+		args.Add("label", s)
+	}
+	return args
+}
+
+// ListContainers 按标签查询 runner 启动的任务容器
+func ListContainers(ctx context.Context, selectors []string, all bool) ([]ContainerInfo, error) {
+	if configs.Get().Runner.IsKubernetesBackend() {
+		return listKubePods(ctx, selectors, all)
+	}
+
+	cli, err := dockerClient()
+	if err != nil {
+		return nil, err
+	}
+
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     all,
+		Filters: labelFilters(selectors),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "list containers")
+	}
+
+	result := make([]ContainerInfo, 0, len(containers))
+	for _, c := range containers {
+		labels := make(map[string]string)
+		for k, v := range c.Labels {
+			if strings.HasPrefix(k, ContainerLabelPrefix) {
+				labels[strings.TrimPrefix(k, ContainerLabelPrefix)] = v
+			}
+		}
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		result = append(result, ContainerInfo{
+			Id:      utils.ShortContainerId(c.ID),
+			Name:    name,
+			Image:   c.Image,
+			State:   c.State,
+			Status:  c.Status,
+			Created: c.Created,
+			Labels:  labels,
+		})
+	}
+	return result, nil
+}
+
+// ListTaskContainerIds 查询任务的所有运行中的容器
+func ListTaskContainerIds(ctx context.Context, taskId string) ([]string, error) {
+	containers, err := ListContainers(ctx, []string{ContainerLabelTaskId + "=" + taskId}, false)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(containers))
+	for _, c := range containers {
+		ids = append(ids, c.Id)
+	}
+	return ids, nil
+}
+
+// isContainerRunning 容器是否在运行，容器不存在时返回 false
+func isContainerRunning(ctx context.Context, cid string) (bool, error) {
+	cli, err := dockerClient()
+	if err != nil {
+		return false, err
+	}
+	info, err := cli.ContainerInspect(ctx, cid)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return info.State != nil && info.State.Running, nil
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"cloudiac/common"
+	"cloudiac/portal/consts"
+)
+
+// DefaultEngineVersion 返回引擎未指定版本时使用的默认版本
+func DefaultEngineVersion(engineType string) string {
+	if engineType == common.EngineOpenTofu {
+		return consts.DefaultOpenTofuVersion
+	}
+	return consts.DefaultTerraformVersion
+}
+
+// IsOpenTofu 任务是否使用 OpenTofu 引擎执行，未指定引擎时使用 terraform
+func (e TaskEnv) IsOpenTofu() bool {
+	return e.EngineType == common.EngineOpenTofu
+}
+
+// EngineBin 返回引擎的命令行程序名
+func (e TaskEnv) EngineBin() string {
+	if e.IsOpenTofu() {
+		return "tofu"
+	}
+	return "terraform"
+}
+
+// EngineVersionEnv 返回版本管理工具(tfenv/tofuenv)读取版本号的环境变量名
+func (e TaskEnv) EngineVersionEnv() string {
+	if e.IsOpenTofu() {
+		return "TOFUENV_TOFU_VERSION"
+	}
+	return "TFENV_TERRAFORM_VERSION"
+}
+
+// EngineInstallCmd 返回安装并切换到指定引擎版本的命令
+func (e TaskEnv) EngineInstallCmd() string {
+	if e.IsOpenTofu() {
+		return "tofuenv install $TOFUENV_TOFU_VERSION && tofuenv use $TOFUENV_TOFU_VERSION"
+	}
+	return "tfenv install $TFENV_TERRAFORM_VERSION && tfenv use $TFENV_TERRAFORM_VERSION"
+}
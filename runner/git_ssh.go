@@ -0,0 +1,51 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// 使用 SSH 部署密钥 clone 代码时写入的私钥及 known_hosts 文件(位于任务工作目录下)
+	gitSshKeyName        = "git_ssh_key"
+	gitSshKnownHostsName = "git_known_hosts"
+
+	// 任务容器中 ssh-agent 的 socket 路径
+	gitSshAuthSock = "/tmp/cloudiac-ssh-agent.sock"
+)
+
+// writeGitSshKey 将 clone 代码使用的 SSH 部署密钥写入工作目录
+func (t *Task) writeGitSshKey(workspace string) error {
+	if t.req.RepoPrivateKey == "" {
+		return nil
+	}
+	keyContent := fmt.Sprintf("%s\n", strings.TrimSpace(t.req.RepoPrivateKey))
+	return os.WriteFile(filepath.Join(workspace, gitSshKeyName), []byte(keyContent), 0600)
+}
+
+// gitSshEnv 使用 SSH 部署密钥时 git 需要的环境变量，首次连接自动信任仓库主机
+func (t *Task) gitSshEnv() []string {
+	if t.req.RepoPrivateKey == "" {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("SSH_AUTH_SOCK=%s", gitSshAuthSock),
+		fmt.Sprintf("GIT_SSH_COMMAND=ssh -o StrictHostKeyChecking=accept-new -o UserKnownHostsFile=%s",
+			filepath.Join(ContainerWorkspace, gitSshKnownHostsName)),
+	}
+}
+
+// gitSshAgentScript 生成启动 ssh-agent 并加载部署密钥的脚本，ssh-agent 已在运行时直接复用。
+// 除 clone 代码外，terraform init 下载 git 模块时同样需要使用该密钥
+func (t *Task) gitSshAgentScript() string {
+	if t.req.RepoPrivateKey == "" {
+		return ""
+	}
+	return fmt.Sprintf(`ssh-add -l >/dev/null 2>&1
+if [ $? -eq 2 ]; then rm -f "$SSH_AUTH_SOCK" && ssh-agent -a "$SSH_AUTH_SOCK" >/dev/null || exit $?; fi
+ssh-add -q '%s' || exit $?`, filepath.Join(ContainerWorkspace, gitSshKeyName))
+}
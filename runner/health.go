@@ -0,0 +1,54 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+
+	"cloudiac/common"
+	"cloudiac/configs"
+)
+
+// GetRunnerHealth 获取 runner 的健康状态，负载信息读取失败时不返回错误
+func GetRunnerHealth(ctx context.Context) (*RunnerHealth, error) {
+	containers, err := ListContainers(ctx, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	health := &RunnerHealth{
+		Version:      common.VERSION,
+		RunningTasks: len(containers),
+		CpuNum:       runtime.NumCPU(),
+		Load1:        loadAverage(),
+	}
+
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(configs.Get().Runner.AbsStoragePath(), &stat); err != nil {
+		return nil, errors.Wrap(err, "statfs storage dir")
+	}
+	health.DiskTotal = uint64(stat.Blocks) * uint64(stat.Bsize)
+	health.DiskFree = uint64(stat.Bavail) * uint64(stat.Bsize)
+	return health, nil
+}
+
+// loadAverage 读取最近 1 分钟的系统负载，不支持的系统返回 0
+func loadAverage() float64 {
+	content, err := ioutil.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return 0
+	}
+	load, _ := strconv.ParseFloat(fields[0], 64)
+	return load
+}
@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
@@ -93,6 +94,12 @@ func FetchTaskLog(envId string, taskId string, step int) ([]byte, error) {
 }
 
 func FetchStateJson(envId string, taskId string) ([]byte, error) {
+	if contents, err := readWorkdirJsonFiles(GetTaskWorkspace(envId, taskId), TFStateJsonFile); err != nil {
+		return nil, err
+	} else if len(contents) > 0 {
+		return mergeStateJson(contents)
+	}
+
 	path := filepath.Join(GetTaskWorkspace(envId, taskId), TFStateJsonFile)
 	content, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -105,12 +112,22 @@ func FetchStateJson(envId string, taskId string) ([]byte, error) {
 }
 
 func FetchProviderJson(envId string, taskId string) ([]byte, error) {
-	path := filepath.Join(GetTaskWorkspace(envId, taskId), TFProviderSchema)
-	content, err := ioutil.ReadFile(path)
+	workspace := GetTaskWorkspace(envId, taskId)
+	contents, err := readWorkdirJsonFiles(workspace, TFProviderSchema)
 	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if len(contents) > 0 {
+		content, err = mergeProviderSchemaJson(contents)
+	} else {
+		content, err = ioutil.ReadFile(filepath.Join(workspace, TFProviderSchema))
 		if os.IsNotExist(err) {
 			return nil, nil
 		}
+	}
+	if err != nil {
 		return nil, err
 	}
 	providerSchemaContent, err := BuildProviderSensitiveAttrMap(content)
@@ -161,6 +178,10 @@ func FetchPlanJson(envId string, taskId string) ([]byte, error) {
 	return content, nil
 }
 
+func FetchPlanFile(envId string, taskId string) ([]byte, error) {
+	return FetchJson(envId, taskId, TFPlanFile)
+}
+
 func FetchJson(envId string, taskId string, jsonFile string) ([]byte, error) {
 	path := filepath.Join(GetTaskWorkspace(envId, taskId), jsonFile)
 	content, err := ioutil.ReadFile(path)
@@ -172,3 +193,53 @@ func FetchJson(envId string, taskId string, jsonFile string) ([]byte, error) {
 	}
 	return content, nil
 }
+
+// shellQuote 使用单引号包裹参数，避免参数中的特殊字符被 shell 解析
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// FetchStepArtifacts 读取步骤产物目录中的文件，超出大小限制的文件会被忽略
+func FetchStepArtifacts(envId string, taskId string, step int) ([]TaskArtifactFile, error) {
+	dir := filepath.Join(GetTaskDir(envId, taskId, step), TaskArtifactsDirName)
+	artifacts := make([]TaskArtifactFile, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if info.Size() > TaskArtifactMaxSize {
+			logger.Warnf("artifact '%s' is too large (%d bytes), skipped", name, info.Size())
+			return nil
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, TaskArtifactFile{Name: filepath.ToSlash(name), Content: content})
+		return nil
+	})
+	return artifacts, err
+}
+
+// readExitCodeFile 读取命令写入的退出码文件，文件不存在或内容无效时返回 false
+func readExitCodeFile(path string) (int, bool) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+)
+
+// pod 内 service account 的挂载目录
+const kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var (
+	defaultKubeClient         *kubeClient
+	defaultKubeClientErr      error
+	defaultKubeClientInitOnce sync.Once
+)
+
+// kubeClient 通过 REST API 访问 kubernetes，只实现了 runner 管理任务 pod 需要的接口
+type kubeClient struct {
+	server    string
+	token     string
+	namespace string
+	http      *http.Client
+}
+
+// kubeStatusError kubernetes api 返回的错误
+type kubeStatusError struct {
+	Code    int    `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *kubeStatusError) Error() string {
+	return fmt.Sprintf("kubernetes api error(%d %s): %s", e.Code, e.Reason, e.Message)
+}
+
+func isKubeNotFound(err error) bool {
+	var statusErr *kubeStatusError
+	return errors.As(err, &statusErr) && statusErr.Code == http.StatusNotFound
+}
+
+func kubernetesClient() (*kubeClient, error) {
+	defaultKubeClientInitOnce.Do(func() {
+		defaultKubeClient, defaultKubeClientErr = initKubeClient(configs.Get().Runner.Kubernetes)
+	})
+	return defaultKubeClient, defaultKubeClientErr
+}
+
+// initKubeClient 创建 kubernetes 客户端，未配置的项使用 pod 内的 service account 信息
+func initKubeClient(conf configs.KubernetesConfig) (*kubeClient, error) {
+	cli := &kubeClient{
+		server:    strings.TrimSuffix(conf.ApiServer, "/"),
+		token:     conf.Token,
+		namespace: conf.Namespace,
+	}
+	if cli.server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("kubernetes api server is not configured")
+		}
+		cli.server = "https://" + net.JoinHostPort(host, port)
+	}
+	if cli.token == "" {
+		token, err := ioutil.ReadFile(kubeServiceAccountDir + "/token")
+		if err != nil {
+			return nil, errors.Wrap(err, "read service account token")
+		}
+		cli.token = strings.TrimSpace(string(token))
+	}
+	if cli.namespace == "" {
+		if ns, err := ioutil.ReadFile(kubeServiceAccountDir + "/namespace"); err == nil {
+			cli.namespace = strings.TrimSpace(string(ns))
+		} else {
+			cli.namespace = "default"
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: conf.Insecure} //nolint:gosec
+	caFile := conf.CAFile
+	if caFile == "" && conf.ApiServer == "" {
+		caFile = kubeServiceAccountDir + "/ca.crt"
+	}
+	if caFile != "" && !conf.Insecure {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read kubernetes ca file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("invalid kubernetes ca file '%s'", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	cli.http = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	return cli, nil
+}
+
+func (c *kubeClient) podsPath() string {
+	return fmt.Sprintf("/api/v1/namespaces/%s/pods", url.PathEscape(c.namespace))
+}
+
+func (c *kubeClient) request(ctx context.Context, method, path string, body interface{}) (io.ReadCloser, error) {
+	var reader io.Reader
+	if body != nil {
+		bs, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(bs)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "request kubernetes api")
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		statusErr := &kubeStatusError{Code: resp.StatusCode}
+		bs, _ := ioutil.ReadAll(resp.Body)
+		if err := json.Unmarshal(bs, statusErr); err != nil || statusErr.Message == "" {
+			statusErr.Message = string(bs)
+		}
+		statusErr.Code = resp.StatusCode
+		return nil, statusErr
+	}
+	return resp.Body, nil
+}
+
+func (c *kubeClient) do(ctx context.Context, method, path string, body interface{}, out interface{}) error {
+	reader, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, reader)
+		return err
+	}
+	return json.NewDecoder(reader).Decode(out)
+}
+
+func (c *kubeClient) CreatePod(ctx context.Context, pod *kubePod) (*kubePod, error) {
+	created := kubePod{}
+	if err := c.do(ctx, http.MethodPost, c.podsPath(), pod, &created); err != nil {
+		return nil, errors.Wrap(err, "create pod")
+	}
+	return &created, nil
+}
+
+func (c *kubeClient) GetPod(ctx context.Context, name string) (*kubePod, error) {
+	pod := kubePod{}
+	if err := c.do(ctx, http.MethodGet, c.podsPath()+"/"+url.PathEscape(name), nil, &pod); err != nil {
+		return nil, err
+	}
+	return &pod, nil
+}
+
+// DeletePod 删除 pod，gracePeriod 为 pod 收到 SIGTERM 后到强制停止的等待时间，pod 不存在时不返回错误
+func (c *kubeClient) DeletePod(ctx context.Context, name string, gracePeriod int64) error {
+	body := map[string]interface{}{
+		"gracePeriodSeconds": gracePeriod,
+		"propagationPolicy":  "Background",
+	}
+	err := c.do(ctx, http.MethodDelete, c.podsPath()+"/"+url.PathEscape(name), body, nil)
+	if err != nil && !isKubeNotFound(err) {
+		return errors.Wrapf(err, "delete pod %s", name)
+	}
+	return nil
+}
+
+func (c *kubeClient) ListPods(ctx context.Context, labelSelector string) ([]kubePod, error) {
+	list := struct {
+		Items []kubePod `json:"items"`
+	}{}
+	path := c.podsPath() + "?labelSelector=" + url.QueryEscape(labelSelector)
+	if err := c.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return nil, errors.Wrap(err, "list pods")
+	}
+	return list.Items, nil
+}
+
+// PodLogs 获取 pod 的标准输出及标准错误
+func (c *kubeClient) PodLogs(ctx context.Context, name string) ([]byte, error) {
+	reader, err := c.request(ctx, http.MethodGet, c.podsPath()+"/"+url.PathEscape(name)+"/log", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,244 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 以下为 kubernetes pod 对象中 runner 使用到的字段
+
+type kubeObjectMeta struct {
+	Name              string            `json:"name,omitempty"`
+	GenerateName      string            `json:"generateName,omitempty"`
+	Namespace         string            `json:"namespace,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	Annotations       map[string]string `json:"annotations,omitempty"`
+	CreationTimestamp *time.Time        `json:"creationTimestamp,omitempty"`
+}
+
+type kubePod struct {
+	ApiVersion string         `json:"apiVersion,omitempty"`
+	Kind       string         `json:"kind,omitempty"`
+	Metadata   kubeObjectMeta `json:"metadata"`
+	Spec       kubePodSpec    `json:"spec"`
+	Status     kubePodStatus  `json:"status"`
+}
+
+type kubePodSpec struct {
+	RestartPolicy                string               `json:"restartPolicy,omitempty"`
+	ServiceAccountName           string               `json:"serviceAccountName,omitempty"`
+	AutomountServiceAccountToken *bool                `json:"automountServiceAccountToken,omitempty"`
+	NodeSelector                 map[string]string    `json:"nodeSelector,omitempty"`
+	ImagePullSecrets             []kubeLocalObjectRef `json:"imagePullSecrets,omitempty"`
+	Containers                   []kubeContainer      `json:"containers"`
+	Volumes                      []kubeVolume         `json:"volumes,omitempty"`
+}
+
+type kubeLocalObjectRef struct {
+	Name string `json:"name"`
+}
+
+type kubeContainer struct {
+	Name            string            `json:"name"`
+	Image           string            `json:"image"`
+	ImagePullPolicy string            `json:"imagePullPolicy,omitempty"`
+	Command         []string          `json:"command,omitempty"`
+	WorkingDir      string            `json:"workingDir,omitempty"`
+	Env             []kubeEnvVar      `json:"env,omitempty"`
+	VolumeMounts    []kubeVolumeMount `json:"volumeMounts,omitempty"`
+	Resources       kubeResources     `json:"resources"`
+}
+
+type kubeEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type kubeVolumeMount struct {
+	Name      string `json:"name"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+}
+
+type kubeVolume struct {
+	Name                  string               `json:"name"`
+	PersistentVolumeClaim *kubePVCVolumeSource `json:"persistentVolumeClaim,omitempty"`
+	EmptyDir              *struct{}            `json:"emptyDir,omitempty"`
+}
+
+type kubePVCVolumeSource struct {
+	ClaimName string `json:"claimName"`
+}
+
+type kubeResources struct {
+	Requests map[string]string `json:"requests,omitempty"`
+	Limits   map[string]string `json:"limits,omitempty"`
+}
+
+type kubePodStatus struct {
+	Phase             string                `json:"phase,omitempty"`
+	Reason            string                `json:"reason,omitempty"`
+	Message           string                `json:"message,omitempty"`
+	ContainerStatuses []kubeContainerStatus `json:"containerStatuses,omitempty"`
+}
+
+type kubeContainerStatus struct {
+	Name  string `json:"name"`
+	State struct {
+		Waiting *struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"waiting,omitempty"`
+		Terminated *struct {
+			ExitCode int    `json:"exitCode"`
+			Reason   string `json:"reason"`
+			Message  string `json:"message"`
+		} `json:"terminated,omitempty"`
+	} `json:"state"`
+}
+
+const (
+	kubePodPending   = "Pending"
+	kubePodRunning   = "Running"
+	kubePodSucceeded = "Succeeded"
+	kubePodFailed    = "Failed"
+)
+
+// 容器处于这些等待状态时不会自动恢复，步骤直接按失败处理
+var kubeFatalWaitingReasons = []string{
+	"ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull", "CreateContainerConfigError",
+}
+
+// kubePodExitState 返回 pod 中的步骤是否已结束、退出码及异常结束的原因
+func kubePodExitState(pod *kubePod) (exited bool, exitCode int, message string) {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if t := cs.State.Terminated; t != nil {
+			if t.ExitCode != 0 && t.Message != "" {
+				message = fmt.Sprintf("%s: %s", t.Reason, t.Message)
+			}
+			return true, t.ExitCode, message
+		}
+		if w := cs.State.Waiting; w != nil {
+			for _, reason := range kubeFatalWaitingReasons {
+				if w.Reason == reason {
+					return true, 1, fmt.Sprintf("%s: %s", w.Reason, w.Message)
+				}
+			}
+		}
+	}
+
+	switch pod.Status.Phase {
+	case kubePodSucceeded:
+		return true, 0, ""
+	case kubePodFailed:
+		// 如 pod 被驱逐，此时没有容器的退出状态
+		return true, 1, fmt.Sprintf("%s: %s", pod.Status.Reason, pod.Status.Message)
+	}
+	return false, 0, ""
+}
+
+// 标签的 key(不含前缀部分)及 value 格式，不符合格式的标签保存为 pod 的 annotation
+var kubeLabelPattern = regexp.MustCompile(`^([A-Za-z0-9][-A-Za-z0-9_.]{0,61})?[A-Za-z0-9]$`)
+
+func isValidKubeLabel(key, value string) bool {
+	return kubeLabelPattern.MatchString(key) && (value == "" || kubeLabelPattern.MatchString(value))
+}
+
+// kubePodContainerInfo 将 pod 信息转换为 ContainerInfo，id 及名称均为 pod 名称
+func kubePodContainerInfo(pod *kubePod) ContainerInfo {
+	info := ContainerInfo{
+		Id:     pod.Metadata.Name,
+		Name:   pod.Metadata.Name,
+		State:  strings.ToLower(pod.Status.Phase),
+		Status: pod.Status.Phase,
+		Labels: make(map[string]string),
+	}
+	if len(pod.Spec.Containers) > 0 {
+		info.Image = pod.Spec.Containers[0].Image
+	}
+	if pod.Metadata.CreationTimestamp != nil {
+		info.Created = pod.Metadata.CreationTimestamp.Unix()
+	}
+	if _, _, message := kubePodExitState(pod); message != "" {
+		info.Status = fmt.Sprintf("%s (%s)", pod.Status.Phase, message)
+	}
+	for _, m := range []map[string]string{pod.Metadata.Annotations, pod.Metadata.Labels} {
+		for k, v := range m {
+			if strings.HasPrefix(k, ContainerLabelPrefix) {
+				info.Labels[strings.TrimPrefix(k, ContainerLabelPrefix)] = v
+			}
+		}
+	}
+	return info
+}
+
+// listKubePods 按标签查询 runner 启动的任务 pod，all 为 false 时只返回未结束的 pod
+func listKubePods(ctx context.Context, selectors []string, all bool) ([]ContainerInfo, error) {
+	cli, err := kubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	pods, err := cli.ListPods(ctx, strings.Join(labelSelectors(selectors), ","))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]ContainerInfo, 0, len(pods))
+	for i := range pods {
+		phase := pods[i].Status.Phase
+		if !all && phase != kubePodPending && phase != kubePodRunning {
+			continue
+		}
+		result = append(result, kubePodContainerInfo(&pods[i]))
+	}
+	return result, nil
+}
+
+// DeleteTaskPods 强制删除任务的 pod，包括 podNames 中的 pod 及所有带有任务 id 标签的 pod
+func DeleteTaskPods(ctx context.Context, taskId string, podNames []string) error {
+	cli, err := kubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	names := append([]string{}, podNames...)
+	if taskId != "" {
+		pods, err := cli.ListPods(ctx, strings.Join(labelSelectors([]string{ContainerLabelTaskId + "=" + taskId}), ","))
+		if err != nil {
+			return err
+		}
+		for _, p := range pods {
+			names = append(names, p.Metadata.Name)
+		}
+	}
+	for _, name := range names {
+		if err := cli.DeletePod(ctx, name, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeKubePod 删除 runner 启动的任务 pod
+func removeKubePod(ctx context.Context, name string) error {
+	cli, err := kubernetesClient()
+	if err != nil {
+		return err
+	}
+	pod, err := cli.GetPod(ctx, name)
+	if err != nil {
+		if isKubeNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if pod.Metadata.Labels[ContainerLabelManaged] != "true" {
+		return fmt.Errorf("pod '%s' is not managed by runner", name)
+	}
+	return cli.DeletePod(ctx, name, 0)
+}
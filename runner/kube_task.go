@@ -0,0 +1,374 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+
+	"cloudiac/common"
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+// kubernetes 后端步骤 pod 的启动脚本，在后台执行步骤命令(脚本参数)：
+// pod 被删除(收到 SIGTERM)时中断 terraform 进程，使其可以释放 state 锁后退出，
+// 步骤结束后将退出码写入步骤目录，pod 被删除后仍可以获取步骤的执行结果
+const kubeStepScriptTpl = `trap '(` + interruptEngineScript + `); interrupted=1' TERM
+"$@" &
+pid=$!
+wait "$pid"; code=$?
+# wait 被信号中断时命令仍在执行，需要再次等待以获取命令的退出码
+while [ -n "$interrupted" ]; do interrupted=""; wait "$pid"; code=$?; done
+echo "$code" >%s
+exit "$code"`
+
+// 轮询 pod 状态的间隔
+const kubePodPollInterval = 2 * time.Second
+
+// runKubeStep 启动 kubernetes pod 执行任务步骤，返回 pod 名称。
+// pod 通过 PVC 挂载任务工作目录，步骤脚本、日志及产物与 docker 后端一样保存在工作目录中
+func (t *Task) runKubeStep() (podName string, err error) {
+	if t.req.PrivateKey != "" {
+		t.req.PrivateKey, err = utils.DecryptSecretVar(t.req.PrivateKey)
+		if err != nil {
+			return "", errors.Wrap(err, "decrypt private key")
+		}
+	}
+	if t.req.RepoPrivateKey != "" {
+		t.req.RepoPrivateKey, err = utils.DecryptSecretVar(t.req.RepoPrivateKey)
+		if err != nil {
+			return "", errors.Wrap(err, "decrypt repo private key")
+		}
+	}
+	t.workspace, err = t.initWorkspace()
+	if err != nil {
+		return "", errors.Wrap(err, "initial workspace")
+	}
+	if t.req.Resume {
+		if _, err = os.Stat(t.workspace); err != nil {
+			return "", errors.Wrap(err, "resume task workspace")
+		}
+	}
+
+	command, err := t.stepExecCommand()
+	if err != nil {
+		return "", err
+	}
+	cmd := Executor{Image: t.taskImage()}
+	if t.req.StepImage != "" {
+		cmd.Image = OfflineImage(t.req.StepImage)
+	}
+	if err := t.buildVarsAndCmdEnv(&cmd); err != nil {
+		return "", err
+	}
+
+	// 删除上次执行(步骤重试)的结果文件，否则 StartedTask.Wait() 会直接返回
+	stepDir := GetTaskDir(t.req.Env.Id, t.req.TaskId, t.req.Step)
+	for _, name := range []string{TaskContainerInfoFileName, TaskExitCodeFileName, TaskPodLogFileName} {
+		if err = os.Remove(filepath.Join(stepDir, name)); err != nil && !os.IsNotExist(err) {
+			return "", errors.Wrapf(err, "remove %s", name)
+		}
+	}
+
+	pod, err := t.buildStepPod(cmd, command)
+	if err != nil {
+		return "", err
+	}
+	cli, err := kubernetesClient()
+	if err != nil {
+		return "", err
+	}
+	t.logger.Infof("start task step pod, %s, image: %s", stepDir, cmd.Image)
+	if pod, err = cli.CreatePod(context.Background(), pod); err != nil {
+		return "", err
+	}
+	podName = pod.Metadata.Name
+
+	now := time.Now()
+	infoJson := utils.MustJSON(StartedTask{
+		EnvId:          t.req.Env.Id,
+		TaskId:         t.req.TaskId,
+		Step:           t.req.Step,
+		ContainerId:    podName,
+		StartedAt:      &now,
+		Timeout:        t.req.Timeout,
+		RemoveOnFinish: !t.reserveContainer(),
+		Backend:        configs.RunnerBackendKubernetes,
+	})
+	if err := os.WriteFile(filepath.Join(stepDir, TaskInfoFileName), infoJson, 0644); err != nil { //nolint:gosec
+		return podName, errors.Wrap(err, "write step info")
+	}
+	return podName, nil
+}
+
+// buildStepPod 生成执行步骤的 pod，pod 名称为 {taskId}-step{N}-{随机后缀}
+func (t *Task) buildStepPod(cmd Executor, command string) (*kubePod, error) {
+	conf := t.config.Kubernetes
+	subPath, err := filepath.Rel(t.config.AbsStoragePath(), t.workspace)
+	if err != nil || strings.HasPrefix(subPath, "..") {
+		return nil, fmt.Errorf("workspace '%s' is not in storage path", t.workspace)
+	}
+
+	labels := make(map[string]string)
+	annotations := make(map[string]string)
+	for k, v := range ContainerLabels(t.req) {
+		if isValidKubeLabel(strings.TrimPrefix(k, ContainerLabelPrefix), v) {
+			labels[k] = v
+		} else {
+			annotations[k] = v
+		}
+	}
+
+	env := make([]kubeEnvVar, 0, len(cmd.Env))
+	for _, kv := range cmd.Env {
+		if i := strings.Index(kv, "="); i > 0 {
+			env = append(env, kubeEnvVar{Name: kv[:i], Value: kv[i+1:]})
+		}
+	}
+
+	volumes := []kubeVolume{
+		{Name: "storage", PersistentVolumeClaim: &kubePVCVolumeSource{ClaimName: conf.StoragePVC}},
+	}
+	mounts := []kubeVolumeMount{
+		{Name: "storage", MountPath: ContainerWorkspace, SubPath: subPath},
+		{Name: "plugin-cache", MountPath: ContainerPluginCachePath},
+	}
+	if conf.PluginCachePVC == "" {
+		volumes = append(volumes, kubeVolume{Name: "plugin-cache", EmptyDir: &struct{}{}})
+	} else {
+		volumes = append(volumes, kubeVolume{
+			Name:                  "plugin-cache",
+			PersistentVolumeClaim: &kubePVCVolumeSource{ClaimName: conf.PluginCachePVC},
+		})
+		// 与 docker 后端一样缓存镜像中未内置的 terraform/tofu 版本
+		if cmd.EngineType == common.EngineOpenTofu {
+			if !utils.StrInArray(cmd.TerraformVersion, common.OpenTofuVersions...) {
+				mounts = append(mounts, kubeVolumeMount{
+					Name: "plugin-cache", MountPath: "/root/.tofuenv/versions", SubPath: ".tofuenv-versions",
+				})
+			}
+		} else if !utils.StrInArray(cmd.TerraformVersion, common.TerraformVersions...) {
+			mounts = append(mounts, kubeVolumeMount{
+				Name: "plugin-cache", MountPath: "/root/.tfenv/versions", SubPath: ".tfenv-versions",
+			})
+		}
+	}
+
+	resources := kubeResources{Requests: map[string]string{}, Limits: map[string]string{}}
+	for _, r := range []struct {
+		m     map[string]string
+		name  string
+		value string
+	}{
+		{resources.Requests, "cpu", conf.CPURequest},
+		{resources.Requests, "memory", conf.MemoryRequest},
+		{resources.Limits, "cpu", conf.CPULimit},
+		{resources.Limits, "memory", conf.MemoryLimit},
+	} {
+		if r.value != "" {
+			r.m[r.name] = r.value
+		}
+	}
+
+	exitCodeFile := filepath.Join(ContainerWorkspace, t.stepDirName(t.req.Step), TaskExitCodeFileName)
+	pod := &kubePod{
+		ApiVersion: "v1",
+		Kind:       "Pod",
+		Metadata: kubeObjectMeta{
+			GenerateName: strings.ToLower(fmt.Sprintf("%s-step%d-", t.req.TaskId, t.req.Step)),
+			Labels:       labels,
+			Annotations:  annotations,
+		},
+		Spec: kubePodSpec{
+			RestartPolicy:      "Never",
+			ServiceAccountName: conf.ServiceAccount,
+			NodeSelector:       conf.NodeSelector,
+			Containers: []kubeContainer{{
+				Name:            "step",
+				Image:           cmd.Image,
+				ImagePullPolicy: conf.ImagePullPolicy,
+				Command: append([]string{"/bin/sh", "-c", fmt.Sprintf(kubeStepScriptTpl, shellQuote(exitCodeFile)), "sh"},
+					t.generateCommand(command)...),
+				WorkingDir:   ContainerWorkspace,
+				Env:          env,
+				VolumeMounts: mounts,
+				Resources:    resources,
+			}},
+			Volumes: volumes,
+		},
+	}
+	if conf.ServiceAccount == "" {
+		// 未指定 service account 时不挂载 token，避免步骤脚本访问集群
+		automount := false
+		pod.Spec.AutomountServiceAccountToken = &automount
+	}
+	for _, name := range conf.ImagePullSecrets {
+		pod.Spec.ImagePullSecrets = append(pod.Spec.ImagePullSecrets, kubeLocalObjectRef{Name: name})
+	}
+	return pod, nil
+}
+
+func (task *StartedTask) isKubernetes() bool {
+	return task.Backend == configs.RunnerBackendKubernetes
+}
+
+func (task *StartedTask) exitCodePath() string {
+	return filepath.Join(task.TaskDir(), TaskExitCodeFileName)
+}
+
+// readExitCode 读取步骤命令的退出码，步骤未结束时返回 false
+func (task *StartedTask) readExitCode() (int, bool) {
+	return readExitCodeFile(task.exitCodePath())
+}
+
+// kubeExecInfo 获取步骤 pod 的执行状态，步骤命令已结束时以退出码文件为准
+func (task *StartedTask) kubeExecInfo(ctx context.Context) (info types.ContainerExecInspect, message string, err error) {
+	info.ContainerID = task.ContainerId
+	if code, ok := task.readExitCode(); ok {
+		info.ExitCode = code
+		return info, "", nil
+	}
+
+	cli, err := kubernetesClient()
+	if err != nil {
+		return info, "", err
+	}
+	pod, err := cli.GetPod(ctx, task.ContainerId)
+	if err != nil {
+		if isKubeNotFound(err) {
+			return info, "", errors.Wrapf(ErrContainerNotRun, "pod %s not found", task.ContainerId)
+		}
+		return info, "", errors.Wrap(err, "get pod")
+	}
+	exited, code, message := kubePodExitState(pod)
+	info.Running = !exited
+	info.ExitCode = code
+	return info, message, nil
+}
+
+// waitKubePod 等待步骤 pod 结束，返回 pod 异常结束的原因，超过步骤超时时间时删除 pod 并返回 context.DeadlineExceeded
+func (task *StartedTask) waitKubePod(ctx context.Context) (info types.ContainerExecInspect, message string, err error) {
+	if task.StartedAt != nil && task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, task.StartedAt.Add(time.Duration(task.Timeout)*time.Second))
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(kubePodPollInterval)
+	defer ticker.Stop()
+	for {
+		if info, message, err = task.kubeExecInfo(ctx); err != nil {
+			if !errors.Is(err, context.DeadlineExceeded) {
+				return info, "", err
+			}
+		} else if !info.Running {
+			return info, message, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				if err := task.Cancel(); err != nil {
+					logger.WithField("pod", task.ContainerId).Errorf("delete pod error: %v", err)
+				}
+			}
+			return info, "", ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// saveKubePodLogs 保存 pod 的输出并追加到步骤日志中(如开启 CLOUDIAC_DEBUG 时的命令跟踪信息)，
+// message 为 pod 异常结束的原因，通过独占创建 pod 日志文件保证并发调用时只追加一次
+func (task *StartedTask) saveKubePodLogs(ctx context.Context, message string) {
+	logger := logger.WithField("taskId", task.TaskId).WithField("pod", task.ContainerId)
+	fp, err := os.OpenFile(filepath.Join(task.TaskDir(), TaskPodLogFileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if !os.IsExist(err) {
+			logger.Warnf("create pod log file error: %v", err)
+		}
+		return
+	}
+	defer fp.Close()
+
+	if message != "" {
+		defer task.appendLog(utils.TaskLogMsgBytes("Step pod failed: %s", message))
+	}
+	cli, err := kubernetesClient()
+	if err != nil {
+		logger.Warn(err)
+		return
+	}
+	content, err := cli.PodLogs(ctx, task.ContainerId)
+	if err != nil {
+		if !isKubeNotFound(err) {
+			logger.Warnf("get pod logs error: %v", err)
+		}
+		return
+	}
+	if _, err := fp.Write(content); err != nil {
+		logger.Warnf("write pod log error: %v", err)
+	}
+	if len(content) > 0 {
+		task.appendLog(content)
+	}
+}
+
+func (task *StartedTask) appendLog(content []byte) {
+	fp, err := os.OpenFile(filepath.Join(task.TaskDir(), TaskLogName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		logger.WithField("taskId", task.TaskId).Warnf("open task log error: %v", err)
+		return
+	}
+	defer fp.Close()
+	_, _ = fp.Write(content)
+}
+
+// cancelKubeTask 删除步骤 pod，pod 收到 SIGTERM 后中断 terraform 进程，
+// 步骤在 gracePeriod 内结束时返回 Graceful，否则强制删除任务的所有 pod
+func cancelKubeTask(ctx context.Context, req TaskCancelReq, task *StartedTask) (resp TaskCancelResp, err error) {
+	if task != nil {
+		if _, ok := task.readExitCode(); ok {
+			resp.Graceful = true
+			return resp, nil
+		}
+
+		cli, err := kubernetesClient()
+		if err != nil {
+			return resp, err
+		}
+		if err := cli.DeletePod(ctx, task.ContainerId, int64(req.GracePeriod)); err != nil {
+			logger.WithField("taskId", req.TaskId).Warnf("interrupt task step: %v", err)
+		} else if resp.Graceful = waitKubeStepExited(ctx, task, time.Duration(req.GracePeriod)*time.Second); resp.Graceful {
+			return resp, nil
+		}
+	}
+	return resp, DeleteTaskPods(ctx, req.TaskId, req.ContainerIds)
+}
+
+// waitKubeStepExited 等待步骤命令结束(写入退出码文件)，超时返回 false
+func waitKubeStepExited(ctx context.Context, task *StartedTask, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(kubePodPollInterval / 2)
+	defer ticker.Stop()
+	for {
+		if _, ok := task.readExitCode(); ok {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
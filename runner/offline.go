@@ -0,0 +1,179 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+// 离线模式下生成的 terraform CLI 配置文件(位于任务工作目录下)
+const offlineTerraformrcName = "_cloudiac.terraformrc"
+
+// 公网 terraform registry，离线模式下这些 registry 的模块通过 registry_mirror 下载
+var publicTfRegistryHosts = []string{"registry.terraform.io", "registry.opentofu.org"}
+
+// IsPublicTfRegistryHost 是否为公网的 terraform registry
+func IsPublicTfRegistryHost(host string) bool {
+	return utils.StrInArray(strings.ToLower(host), publicTfRegistryHosts...)
+}
+
+// OfflineRegistryModulesUrl 返回离线模式下 registry 镜像的模块 api 地址，未开启离线模式或未配置镜像时返回空
+func OfflineRegistryModulesUrl() string {
+	conf := configs.Get().Offline
+	if !conf.Enabled || conf.RegistryMirror == "" {
+		return ""
+	}
+	return strings.TrimRight(conf.RegistryMirror, "/") + "/v1/modules/"
+}
+
+// 通过 host 块覆盖公网 registry 的服务发现，使模块从 registry 镜像下载；
+// provider 先从预置目录查找，其次从 network mirror 下载，不直接访问公网
+var offlineTerraformrcTpl = template.Must(template.New("").Parse(`provider_installation {
+  filesystem_mirror {
+    path = "{{.PluginPath}}"
+  }
+{{- if .ProviderMirror}}
+  network_mirror {
+    url = "{{.ProviderMirror}}"
+  }
+{{- end}}
+  direct {
+    exclude = ["*/*"]
+  }
+}
+{{- if .ModulesUrl}}
+{{range .RegistryHosts}}
+host "{{.}}" {
+  services = {
+    "modules.v1" = "{{$.ModulesUrl}}"
+  }
+}
+{{- end}}
+{{- end}}
+`))
+
+// prepareTerraformrc 返回任务使用的 terraformrc 在容器中的路径。
+// 离线模式配置了 registry 或 provider 镜像时在工作目录(workspace 为宿主机路径)下生成配置文件，否则使用 assets 中预置的配置
+func prepareTerraformrc(workspace string) (string, error) {
+	conf := configs.Get().Offline
+	if !conf.Enabled {
+		return filepath.Join(ContainerAssetsDir, "terraformrc-default"), nil
+	}
+	if conf.RegistryMirror == "" && conf.ProviderMirror == "" {
+		return filepath.Join(ContainerAssetsDir, "terraformrc-offline"), nil
+	}
+
+	providerMirror := conf.ProviderMirror
+	if providerMirror != "" && !strings.HasSuffix(providerMirror, "/") {
+		// network mirror 地址必须以 / 结尾
+		providerMirror += "/"
+	}
+	content := bytes.NewBuffer(nil)
+	if err := offlineTerraformrcTpl.Execute(content, map[string]interface{}{
+		"PluginPath":     ContainerPluginPath,
+		"ProviderMirror": providerMirror,
+		"ModulesUrl":     OfflineRegistryModulesUrl(),
+		"RegistryHosts":  publicTfRegistryHosts,
+	}); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(workspace, offlineTerraformrcName), content.Bytes(), 0644); err != nil { //nolint:gosec
+		return "", err
+	}
+	return filepath.Join(ContainerWorkspace, offlineTerraformrcName), nil
+}
+
+// offlineEnv 离线模式下为任务容器设置 pip 及 ansible galaxy 镜像源，用户定义了同名环境变量时不覆盖
+func offlineEnv(userEnv map[string]string) []string {
+	conf := configs.Get().Offline
+	if !conf.Enabled {
+		return nil
+	}
+
+	env := make([]string, 0)
+	setEnv := func(k, v string) {
+		if _, ok := userEnv[k]; !ok && v != "" {
+			env = append(env, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+	setEnv("PIP_INDEX_URL", conf.PipIndexUrl)
+	if u, err := url.Parse(conf.PipIndexUrl); err == nil && u.Scheme == "http" {
+		// pip 默认不信任 http 源
+		setEnv("PIP_TRUSTED_HOST", u.Hostname())
+	}
+	setEnv("ANSIBLE_GALAXY_SERVER", conf.AnsibleGalaxyServer)
+	return env
+}
+
+// 镜像地址格式: [registry/]path[:tag][@digest]
+var (
+	imageRegistryPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]+)?$`)
+	imagePathPattern     = regexp.MustCompile(`^[a-z0-9]+([._-]+[a-z0-9]+)*(/[a-z0-9]+([._-]+[a-z0-9]+)*)*(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+)
+
+// docker hub 的仓库地址，镜像未指定仓库时也从 docker hub 拉取
+var dockerHubRegistries = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+// ParseImageRef 解析镜像地址，返回仓库地址(未指定时为空)及镜像路径(包含 tag 及 digest)
+func ParseImageRef(image string) (registry string, path string, err error) {
+	path = image
+	if i := strings.Index(image, "/"); i > 0 {
+		first := image[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			registry, path = first, image[i+1:]
+		}
+	}
+	if registry != "" && !imageRegistryPattern.MatchString(registry) {
+		return "", "", fmt.Errorf("invalid image registry '%s'", registry)
+	}
+	if !imagePathPattern.MatchString(path) {
+		return "", "", fmt.Errorf("invalid image '%s'", image)
+	}
+	return registry, path, nil
+}
+
+// isDockerHubImage 镜像是否从 docker hub 拉取
+func isDockerHubImage(registry string) bool {
+	return registry == "" || utils.StrInArray(strings.ToLower(registry), dockerHubRegistries...)
+}
+
+// CheckOfflineImage 检查离线模式下镜像是否可以从内网拉取。
+// docker hub 的镜像需要配置 offline.image_registry，其他仓库的镜像视为内网镜像
+func CheckOfflineImage(image string) error {
+	registry, _, err := ParseImageRef(image)
+	if err != nil {
+		return err
+	}
+	if isDockerHubImage(registry) && configs.Get().Offline.ImageRegistry == "" {
+		return fmt.Errorf("image '%s' is pulled from docker hub, offline.image_registry is required in offline mode", image)
+	}
+	return nil
+}
+
+// OfflineImage 离线模式下将 docker hub 的镜像替换为从 offline.image_registry 拉取，
+// 如 alpine:3 替换为 harbor.example.com/mirror/library/alpine:3，其他镜像保持不变
+func OfflineImage(image string) string {
+	conf := configs.Get().Offline
+	if !conf.Enabled || conf.ImageRegistry == "" || image == "" {
+		return image
+	}
+	registry, path, err := ParseImageRef(image)
+	if err != nil || !isDockerHubImage(registry) {
+		return image
+	}
+	if !strings.Contains(path, "/") {
+		// docker hub 的官方镜像位于 library 下
+		path = "library/" + path
+	}
+	return conf.ImageRegistry + "/" + path
+}
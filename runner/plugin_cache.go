@@ -0,0 +1,242 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+	"cloudiac/utils"
+)
+
+// provider 缓存目录锁。terraform 的 plugin cache 不支持并发写入，同一 runner 上的任务执行 init 时需要串行，
+// 锁使用 mkdir 实现(不依赖镜像中的 flock 命令)，锁超过 30 分钟未释放(如容器被强制停止)时视为失效。
+// 等待锁超过 5 分钟时不再使用缓存目录，直接下载 provider 到工作目录
+const pluginCacheLockScript = `cloudiac_lock_plugin_cache() {
+  _lock="${TF_PLUGIN_CACHE_DIR:-` + ContainerPluginCachePath + `}/` + PluginCacheLockName + `"
+  _waited=0
+  while ! mkdir "$_lock" 2>/dev/null; do
+    if [ -n "$(find "$_lock" -maxdepth 0 -mmin +30 2>/dev/null)" ]; then
+      rmdir "$_lock" 2>/dev/null; continue
+    fi
+    if [ $_waited -ge 300 ]; then
+      echo "wait plugin cache lock timeout, disable plugin cache"
+      unset TF_PLUGIN_CACHE_DIR; return 0
+    fi
+    [ $_waited -eq 0 ] && echo "waiting for plugin cache lock..."
+    sleep 2; _waited=$((_waited+2))
+  done
+  CLOUDIAC_PLUGIN_CACHE_LOCK="$_lock"
+  trap cloudiac_unlock_plugin_cache EXIT
+}
+cloudiac_unlock_plugin_cache() {
+  [ -n "$CLOUDIAC_PLUGIN_CACHE_LOCK" ] && rmdir "$CLOUDIAC_PLUGIN_CACHE_LOCK" 2>/dev/null
+  CLOUDIAC_PLUGIN_CACHE_LOCK=""
+}`
+
+// 预热 provider 缓存的工作目录(位于 storage 目录下)
+const pluginCachePrewarmDir = ".prewarm"
+
+// provider 地址及版本约束格式，避免生成 tf 文件时注入其他内容
+var (
+	providerSourcePattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*(/[A-Za-z0-9][A-Za-z0-9._-]*){1,2}$`)
+	providerConstraintPattern = regexp.MustCompile(`^[0-9A-Za-z.~>=<!, -]+$`)
+)
+
+// ParseProviderRequirement 解析 source[@version] 格式的 provider，如 hashicorp/aws@~> 5.0
+func ParseProviderRequirement(s string) (source string, version string, err error) {
+	source = strings.TrimSpace(s)
+	if i := strings.Index(source, "@"); i >= 0 {
+		source, version = strings.TrimSpace(source[:i]), strings.TrimSpace(source[i+1:])
+		if !providerConstraintPattern.MatchString(version) {
+			return "", "", fmt.Errorf("invalid provider version '%s'", version)
+		}
+	}
+	if !providerSourcePattern.MatchString(source) {
+		return "", "", fmt.Errorf("invalid provider source '%s'", source)
+	}
+	return source, version, nil
+}
+
+// ListCachedProviders 列出 provider 缓存目录中的 provider，
+// 目录结构为 {hostname}/{namespace}/{type}/{version}/{os_arch}
+func ListCachedProviders() ([]CachedProvider, error) {
+	root := configs.Get().Runner.AbsPluginCachePath()
+	result := make([]CachedProvider, 0)
+	matches, err := filepath.Glob(filepath.Join(root, "*", "*", "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range matches {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || strings.HasPrefix(rel, ".") {
+			// 跳过 .tfenv-versions 等非 provider 目录
+			continue
+		}
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		if info, err := os.Stat(path); err != nil || !info.IsDir() {
+			continue
+		}
+		result = append(result, CachedProvider{
+			Source:   strings.Join(parts[:3], "/"),
+			Version:  parts[3],
+			Platform: parts[4],
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+		return result[i].Version < result[j].Version
+	})
+	return result, nil
+}
+
+var prewarmTfTpl = template.Must(template.New("").Parse(`terraform {
+  required_providers {
+{{- range $i, $p := .}}
+    p{{$i}} = {
+      source = "{{$p.Source}}"
+      {{- if $p.Version}}
+      version = "{{$p.Version}}"
+      {{- end}}
+    }
+{{- end}}
+  }
+}
+`))
+
+var prewarmCommandTpl = template.Must(template.New("").Parse(`{{.LockScript}}
+{
+ln -sf '{{.Terraformrc}}' ~/.terraformrc && \
+{{.Env.EngineInstallCmd}} && \
+cloudiac_lock_plugin_cache && \
+{{.Env.EngineBin}} init -input=false -backend=false -no-color
+} >>{{.LogName}} 2>&1
+echo $? >{{.ExitCodeName}}
+`))
+
+// PrewarmPluginCache 启动容器对指定 provider 执行 terraform init，将 provider 下载到缓存目录，
+// 未指定 provider 时使用 runner 配置的 prewarm_providers，等待容器执行结束后返回执行日志
+func PrewarmPluginCache(ctx context.Context, req PluginCachePrewarmReq) (*PluginCachePrewarmResp, error) {
+	conf := configs.Get().Runner
+	if conf.IsKubernetesBackend() {
+		return nil, fmt.Errorf("plugin cache prewarm is not supported by %s backend", conf.Backend)
+	}
+
+	providers := req.Providers
+	if len(providers) == 0 {
+		providers = conf.PrewarmProviders
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no providers to prewarm")
+	}
+	requirements := make([]CachedProvider, 0, len(providers))
+	for _, p := range providers {
+		source, version, err := ParseProviderRequirement(p)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, CachedProvider{Source: source, Version: version})
+	}
+
+	env := TaskEnv{EngineType: req.EngineType, TfVersion: req.TfVersion}
+	if env.TfVersion == "" {
+		env.TfVersion = DefaultEngineVersion(env.EngineType)
+	}
+	workdir := filepath.Join(conf.AbsStoragePath(), pluginCachePrewarmDir, utils.GenGuid("prewarm"))
+	if err := os.MkdirAll(workdir, 0755); err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workdir)
+
+	tfContent := bytes.NewBuffer(nil)
+	if err := prewarmTfTpl.Execute(tfContent, requirements); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(workdir, "main.tf"), tfContent.Bytes(), 0644); err != nil { //nolint:gosec
+		return nil, err
+	}
+
+	tfrc, err := prepareTerraformrc(workdir)
+	if err != nil {
+		return nil, err
+	}
+	command := bytes.NewBuffer(nil)
+	if err := prewarmCommandTpl.Execute(command, map[string]interface{}{
+		"LockScript":   pluginCacheLockScript,
+		"Terraformrc":  tfrc,
+		"Env":          env,
+		"LogName":      TaskLogName,
+		"ExitCodeName": TaskExitCodeFileName,
+	}); err != nil {
+		return nil, err
+	}
+
+	image := conf.DefaultImage
+	if env.IsOpenTofu() && conf.OpenTofuImage != "" {
+		image = conf.OpenTofuImage
+	}
+	image = OfflineImage(image)
+	cmd := Executor{
+		Image:            image,
+		Workdir:          ContainerWorkspace,
+		HostWorkdir:      workdir,
+		AutoRemove:       true,
+		TerraformVersion: env.TfVersion,
+		EngineType:       env.EngineType,
+		Entrypoint:       []string{"/bin/sh"},
+		Commands:         []string{"-c", command.String()},
+		Labels:           map[string]string{ContainerLabelManaged: "true", ContainerLabelPrefix + "prewarm": "true"},
+		Env: []string{
+			fmt.Sprintf("TF_PLUGIN_CACHE_DIR=%s", ContainerPluginCachePath),
+			"TF_PLUGIN_CACHE_MAY_BREAK_DEPENDENCY_LOCK_FILE=true",
+			fmt.Sprintf("%s=%s", env.EngineVersionEnv(), env.TfVersion),
+		},
+	}
+	cid, err := cmd.Start()
+	if err != nil {
+		return nil, errors.Wrap(err, "start prewarm container")
+	}
+
+	resp := &PluginCachePrewarmResp{}
+	exitCodeFile := filepath.Join(workdir, TaskExitCodeFileName)
+	for {
+		var ok bool
+		if resp.ExitCode, ok = readExitCodeFile(exitCodeFile); ok {
+			break
+		}
+		if running, err := isContainerRunning(ctx, cid); err == nil && !running {
+			// 容器退出后会被自动删除，退出前写入的退出码文件需要再读取一次
+			if resp.ExitCode, ok = readExitCodeFile(exitCodeFile); ok {
+				break
+			}
+			return nil, fmt.Errorf("prewarm container exited unexpectedly")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	if content, err := ioutil.ReadFile(filepath.Join(workdir, TaskLogName)); err == nil {
+		resp.Log = string(content)
+	}
+	if resp.Providers, err = ListCachedProviders(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
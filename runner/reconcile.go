@@ -0,0 +1,128 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/errdefs"
+	"github.com/pkg/errors"
+
+	"cloudiac/configs"
+)
+
+// 任务 id 的前缀，用于识别 storage 目录下的任务工作目录
+const taskIdPrefix = "run-"
+
+// ListWorkspaces 列出 storage 目录下的所有任务工作目录，
+// 目录结构为 {storage}/{envId}/{taskId}，云模板扫描等没有环境的任务为 {storage}/{taskId}
+func ListWorkspaces() ([]WorkspaceInfo, error) {
+	root := configs.Get().Runner.AbsStoragePath()
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "read storage dir")
+	}
+
+	result := make([]WorkspaceInfo, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), taskIdPrefix) {
+			result = append(result, WorkspaceInfo{TaskId: entry.Name(), ModTime: entry.ModTime().Unix()})
+			continue
+		}
+
+		children, err := ioutil.ReadDir(filepath.Join(root, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrap(err, "read env dir")
+		}
+		for _, child := range children {
+			if child.IsDir() && strings.HasPrefix(child.Name(), taskIdPrefix) {
+				result = append(result, WorkspaceInfo{
+					EnvId:   entry.Name(),
+					TaskId:  child.Name(),
+					ModTime: child.ModTime().Unix(),
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+// RemoveWorkspace 删除任务工作目录，环境目录为空时一并删除
+func RemoveWorkspace(envId string, taskId string) error {
+	if !strings.HasPrefix(taskId, taskIdPrefix) || strings.ContainsAny(taskId+envId, `/\`) ||
+		strings.HasPrefix(envId, ".") {
+		return fmt.Errorf("invalid workspace '%s/%s'", envId, taskId)
+	}
+
+	if err := os.RemoveAll(GetTaskWorkspace(envId, taskId)); err != nil {
+		return err
+	}
+	if envId != "" {
+		// 目录非空时删除会失败，忽略该错误
+		_ = os.Remove(filepath.Dir(GetTaskWorkspace(envId, taskId)))
+	}
+	return nil
+}
+
+// RemoveContainer 强制删除 runner 启动的任务容器
+func RemoveContainer(ctx context.Context, containerId string) error {
+	if configs.Get().Runner.IsKubernetesBackend() {
+		return removeKubePod(ctx, containerId)
+	}
+
+	cli, err := dockerClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := cli.ContainerInspect(ctx, containerId)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Config == nil || info.Config.Labels[ContainerLabelManaged] != "true" {
+		return fmt.Errorf("container '%s' is not managed by runner", containerId)
+	}
+
+	err = cli.ContainerRemove(ctx, containerId, types.ContainerRemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) && !strings.Contains(err.Error(), "already in progress") {
+		return err
+	}
+	return nil
+}
+
+// Cleanup 删除 portal 判定为孤儿的容器及工作目录，返回实际的清理结果
+func Cleanup(ctx context.Context, req CleanupReq) CleanupResp {
+	resp := CleanupResp{
+		RemovedContainers: make([]string, 0),
+		RemovedWorkspaces: make([]WorkspaceRef, 0),
+		Errors:            make([]string, 0),
+	}
+
+	for _, cid := range req.Containers {
+		if err := RemoveContainer(ctx, cid); err != nil {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("container %s: %v", cid, err))
+			continue
+		}
+		resp.RemovedContainers = append(resp.RemovedContainers, cid)
+	}
+	for _, ws := range req.Workspaces {
+		if err := RemoveWorkspace(ws.EnvId, ws.TaskId); err != nil {
+			resp.Errors = append(resp.Errors, fmt.Sprintf("workspace %s/%s: %v", ws.EnvId, ws.TaskId, err))
+			continue
+		}
+		resp.RemovedWorkspaces = append(resp.RemovedWorkspaces, ws)
+	}
+	return resp
+}
@@ -6,7 +6,6 @@ import (
 	"bytes"
 	"cloudiac/common"
 	"cloudiac/configs"
-	"cloudiac/portal/consts"
 	"cloudiac/utils"
 	"cloudiac/utils/logs"
 	"encoding/json"
@@ -37,6 +36,11 @@ func NewTask(req RunTaskReq, logger logs.Logger) *Task {
 }
 
 func (t *Task) Run() (cid string, err error) {
+	if t.config.IsKubernetesBackend() {
+		// kubernetes 后端每个步骤都启动新的 pod 执行，不复用任务容器
+		return t.runKubeStep()
+	}
+
 	if t.req.ContainerId == "" {
 		cid, err = t.start()
 		if err != nil {
@@ -60,36 +64,34 @@ func (t *Task) start() (cid string, err error) {
 			return "", errors.Wrap(err, "decrypt private key")
 		}
 	}
+	if t.req.RepoPrivateKey != "" {
+		t.req.RepoPrivateKey, err = utils.DecryptSecretVar(t.req.RepoPrivateKey)
+		if err != nil {
+			return "", errors.Wrap(err, "decrypt repo private key")
+		}
+	}
 
 	t.workspace, err = t.initWorkspace()
 	if err != nil {
 		return "", errors.Wrap(err, "initial workspace")
 	}
+	if t.req.Resume {
+		// 工作目录可能已被清理或任务被调度到了其他 runner，此时不能继续执行
+		if _, err = os.Stat(t.workspace); err != nil {
+			return "", errors.Wrap(err, "resume task workspace")
+		}
+	}
 
-	conf := configs.Get().Runner
 	cmd := Executor{
-		Image:       conf.DefaultImage,
+		Image:       t.taskImage(),
 		Name:        t.req.TaskId,
 		Timeout:     t.req.Timeout,
 		Workdir:     ContainerWorkspace,
 		HostWorkdir: t.workspace,
+		Labels:      ContainerLabels(t.req),
+		AutoRemove:  !t.reserveContainer(),
 	}
 
-	if t.req.DockerImage != "" {
-		cmd.Image = t.req.DockerImage
-	}
-
-	reserveContainer := conf.ReserveContainer
-	if v, ok := t.req.Env.EnvironmentVars["CLOUDIAC_RESERVER_CONTAINER"]; ok {
-		// 需要明确判断是否为 true 或者 false，其他情况使用配置文件中的值
-		if utils.IsTrueStr(v) {
-			reserveContainer = true
-		} else if utils.IsFalseStr(v) {
-			reserveContainer = false
-		}
-	}
-	cmd.AutoRemove = !reserveContainer
-
 	if err := t.buildVarsAndCmdEnv(&cmd); err != nil {
 		return "", err
 	}
@@ -113,6 +115,30 @@ func (t *Task) start() (cid string, err error) {
 	return cid, nil
 }
 
+// taskImage 任务容器使用的镜像
+func (t *Task) taskImage() string {
+	image := t.config.DefaultImage
+	if t.req.DockerImage != "" {
+		image = t.req.DockerImage
+	} else if t.req.Env.IsOpenTofu() && t.config.OpenTofuImage != "" {
+		image = t.config.OpenTofuImage
+	}
+	return OfflineImage(image)
+}
+
+// reserveContainer 任务结束后是否保留容器，环境变量 CLOUDIAC_RESERVER_CONTAINER 可以覆盖配置文件中的值
+func (t *Task) reserveContainer() bool {
+	if v, ok := t.req.Env.EnvironmentVars["CLOUDIAC_RESERVER_CONTAINER"]; ok {
+		// 需要明确判断是否为 true 或者 false，其他情况使用配置文件中的值
+		if utils.IsTrueStr(v) {
+			return true
+		} else if utils.IsFalseStr(v) {
+			return false
+		}
+	}
+	return t.config.ReserveContainer
+}
+
 func (t *Task) buildVarsAndCmdEnv(cmd *Executor) error {
 	for _, vars := range []map[string]string{
 		t.req.Env.EnvironmentVars, t.req.Env.TerraformVars, t.req.Env.AnsibleVars} {
@@ -131,6 +157,13 @@ func (t *Task) buildVarsAndCmdEnv(cmd *Executor) error {
 	if tfPluginCacheDir == "" {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("TF_PLUGIN_CACHE_DIR=%s", ContainerPluginCachePath))
 	}
+	if _, ok := t.req.Env.EnvironmentVars["TF_PLUGIN_CACHE_MAY_BREAK_DEPENDENCY_LOCK_FILE"]; !ok {
+		// terraform 1.4 起代码中没有 .terraform.lock.hcl 时不会使用缓存中的 provider，
+		// 大部分云模板不提交 lock 文件，默认开启以复用缓存
+		cmd.Env = append(cmd.Env, "TF_PLUGIN_CACHE_MAY_BREAK_DEPENDENCY_LOCK_FILE=true")
+	}
+	cmd.Env = append(cmd.Env, offlineEnv(t.req.Env.EnvironmentVars)...)
+	cmd.Env = append(cmd.Env, t.gitSshEnv()...)
 
 	// 变量名冲突时，系统环境变量覆盖用户定义的环境变量
 	for k, v := range t.req.SysEnvironments {
@@ -141,10 +174,11 @@ func (t *Task) buildVarsAndCmdEnv(cmd *Executor) error {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("TF_VAR_%s=%s", k, v))
 	}
 	if t.req.Env.TfVersion == "" {
-		t.req.Env.TfVersion = consts.DefaultTerraformVersion
+		t.req.Env.TfVersion = DefaultEngineVersion(t.req.Env.EngineType)
 	}
 	cmd.TerraformVersion = t.req.Env.TfVersion
-	cmd.Env = append(cmd.Env, fmt.Sprintf("TFENV_TERRAFORM_VERSION=%s", cmd.TerraformVersion))
+	cmd.EngineType = t.req.Env.EngineType
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", t.req.Env.EngineVersionEnv(), cmd.TerraformVersion))
 	return nil
 }
 
@@ -156,22 +190,30 @@ func (t *Task) generateCommand(cmd string) []string {
 	return append(cmds, "-c", cmd)
 }
 
-func (t *Task) runStep() (err error) {
-	_, err = t.genStepScript()
-	if err != nil {
-		return errors.Wrap(err, "generate step script")
+// stepExecCommand 生成步骤脚本，返回在容器中执行步骤脚本的命令，命令输出写入步骤日志文件
+func (t *Task) stepExecCommand() (string, error) {
+	if _, err := t.genStepScript(); err != nil {
+		return "", errors.Wrap(err, "generate step script")
 	}
 
 	containerScriptPath := filepath.Join(t.stepDirName(t.req.Step), TaskScriptName)
 	logPath := filepath.Join(t.stepDirName(t.req.Step), TaskLogName)
 
 	var command string
-	if utils.StrInArray(t.req.StepType, common.TaskStepCheckout, common.TaskStepScanInit) {
+	if utils.StrInArray(t.req.StepType, common.TaskStepCheckout, common.TaskStepScanInit, common.TaskStepTfValidate) {
 		// 移除日志中可能出现的 token 信息
 		command = fmt.Sprintf("set -o pipefail\n%s 2>&1 | sed -re 's/token:[^@]+/token:******/' >>%s", containerScriptPath, logPath)
 	} else {
 		command = fmt.Sprintf("%s >>%s 2>&1", containerScriptPath, logPath)
 	}
+	return t.wrapArtifactsCommand(command, logPath), nil
+}
+
+func (t *Task) runStep() (err error) {
+	command, err := t.stepExecCommand()
+	if err != nil {
+		return err
+	}
 
 	if ok, err := (Executor{}).IsPaused(t.req.ContainerId); err != nil {
 		return err
@@ -185,21 +227,29 @@ func (t *Task) runStep() (err error) {
 		logger.Debugf("unpause container done")
 	}
 
-	execId, err := (&Executor{}).RunCommand(t.req.ContainerId, t.generateCommand(command))
+	execContainerId := t.req.ContainerId
+	if t.req.StepImage != "" {
+		if execContainerId, err = t.startStepContainer(); err != nil {
+			return errors.Wrap(err, "start step container")
+		}
+	}
+
+	execId, err := (&Executor{}).RunCommand(execContainerId, t.generateCommand(command))
 	if err != nil {
 		return err
 	}
 
 	now := time.Now()
 	infoJson := utils.MustJSON(StartedTask{
-		EnvId:         t.req.Env.Id,
-		TaskId:        t.req.TaskId,
-		Step:          t.req.Step,
-		ContainerId:   t.req.ContainerId,
-		PauseOnFinish: t.req.PauseTask,
-		ExecId:        execId,
-		StartedAt:     &now,
-		Timeout:       t.req.Timeout,
+		EnvId:          t.req.Env.Id,
+		TaskId:         t.req.TaskId,
+		Step:           t.req.Step,
+		ContainerId:    execContainerId,
+		PauseOnFinish:  t.req.PauseTask && t.req.StepImage == "",
+		RemoveOnFinish: t.req.StepImage != "",
+		ExecId:         execId,
+		StartedAt:      &now,
+		Timeout:        t.req.Timeout,
 	})
 	stepInfoFile := filepath.Join(
 		GetTaskDir(t.req.Env.Id, t.req.TaskId, t.req.Step),
@@ -212,6 +262,46 @@ func (t *Task) runStep() (err error) {
 	return nil
 }
 
+// wrapArtifactsCommand 为步骤命令设置产物目录，步骤脚本可以直接将文件写入 $CLOUDIAC_ARTIFACTS_DIR，
+// 步骤指定了 artifacts 时在脚本执行结束后将匹配的文件拷贝到产物目录，命令的退出码保持为步骤脚本的退出码
+func (t *Task) wrapArtifactsCommand(command string, logPath string) string {
+	artifactsDir := filepath.Join(ContainerWorkspace, t.stepDirName(t.req.Step), TaskArtifactsDirName)
+	prefix := fmt.Sprintf("export CLOUDIAC_ARTIFACTS_DIR=%s && mkdir -p \"$CLOUDIAC_ARTIFACTS_DIR\"\n", shellQuote(artifactsDir))
+	if len(t.req.StepArtifacts) == 0 {
+		return prefix + command
+	}
+
+	// 通配符需要由 shell 展开，所以 pattern 不做引号处理
+	return fmt.Sprintf("%s%s\ncode=$?\n"+
+		"cd %s && for f in %s; do if [ -e \"$f\" ]; then cp -r \"$f\" \"$CLOUDIAC_ARTIFACTS_DIR/\"; fi; done >>%s 2>&1\n"+
+		"exit $code",
+		prefix, command,
+		shellQuote(filepath.Join(ContainerWorkspace, "code", t.req.Env.Workdir)),
+		strings.Join(t.req.StepArtifacts, " "),
+		shellQuote(filepath.Join(ContainerWorkspace, logPath)))
+}
+
+// startStepContainer 使用步骤指定的镜像启动独立的容器执行步骤，
+// 容器挂载任务的工作目录并使用与任务容器相同的环境变量，步骤结束后删除
+func (t *Task) startStepContainer() (cid string, err error) {
+	cmd := Executor{
+		Image:       OfflineImage(t.req.StepImage),
+		Timeout:     t.req.Timeout,
+		Workdir:     ContainerWorkspace,
+		HostWorkdir: t.workspace,
+		Labels:      ContainerLabels(t.req),
+		AutoRemove:  true,
+		// 自定义镜像可能设置了其他 entrypoint，统一执行 /bin/sh 以保持容器运行
+		Entrypoint: []string{"/bin/sh"},
+	}
+	if err := t.buildVarsAndCmdEnv(&cmd); err != nil {
+		return "", err
+	}
+
+	t.logger.Infof("start step container, image: %s", cmd.Image)
+	return cmd.Start()
+}
+
 func (t *Task) decryptVariables(vars map[string]string) error {
 	var err error
 	for k, v := range vars {
@@ -243,13 +333,19 @@ func (t *Task) initWorkspace() (workspace string, err error) {
 	if err = os.WriteFile(privateKeyPath, []byte(keyContent), 0600); err != nil {
 		return workspace, err
 	}
+	if err = t.writeGitSshKey(workspace); err != nil {
+		return workspace, errors.Wrap(err, "write git ssh key")
+	}
 
-	if err = t.genIacTfFile(workspace); err != nil {
+	if err = t.genIacTfFile(workspace, CloudIacTfFile); err != nil {
 		return workspace, errors.Wrap(err, "generate tf file")
 	}
 	if err = t.genPlayVarsFile(workspace); err != nil {
 		return workspace, errors.Wrap(err, "generate play vars file")
 	}
+	if err = t.genModuleFile(workspace); err != nil {
+		return workspace, errors.Wrap(err, "generate module file")
+	}
 
 	return workspace, nil
 }
@@ -280,7 +376,7 @@ func execTpl2File(tpl *template.Template, data interface{}, savePath string) err
 	return tpl.Execute(fp, data)
 }
 
-func (t *Task) genIacTfFile(workspace string) error {
+func (t *Task) genIacTfFile(workspace string, name string) error {
 	if t.req.StateStore.Address == "" {
 		if os.Getenv("IAC_WORKER_CONSUL") != "" {
 			t.req.StateStore.Address = os.Getenv("IAC_WORKER_CONSUL")
@@ -295,7 +391,7 @@ func (t *Task) genIacTfFile(workspace string) error {
 		"PrivateKeyPath": t.up2Workspace("ssh_key"),
 		"State":          t.req.StateStore,
 	}
-	if err := execTpl2File(iacTerraformTpl, ctx, filepath.Join(workspace, CloudIacTfFile)); err != nil {
+	if err := execTpl2File(iacTerraformTpl, ctx, filepath.Join(workspace, name)); err != nil {
 		return err
 	}
 	return nil
@@ -309,6 +405,37 @@ func (t *Task) genPlayVarsFile(workspace string) error {
 	return yaml.NewEncoder(fp).Encode(t.req.Env.AnsibleVars)
 }
 
+// 引用 registry 模块的根模块，模块的输入声明为同名变量，输出原样导出
+var moduleTerraformTpl = template.Must(template.New("").Parse(`module "main" {
+  source  = "{{.Source}}"
+  version = "{{.Version}}"
+{{- range .Inputs}}
+  {{.Name}} = var.{{.Name}}
+{{- end}}
+}
+{{range .Inputs}}
+variable "{{.Name}}" {
+{{- if .Type}}
+  type    = {{.Type}}
+{{- end}}
+{{- if not .Required}}
+  default = {{.Default}}
+{{- end}}
+}
+{{end}}
+{{- range .Outputs}}
+output "{{.}}" {
+  value = module.main.{{.}}
+}
+{{end}}`))
+
+func (t *Task) genModuleFile(workspace string) error {
+	if t.req.Module == nil {
+		return nil
+	}
+	return execTpl2File(moduleTerraformTpl, t.req.Module, filepath.Join(workspace, CloudIacModuleFile))
+}
+
 func (t *Task) genPolicyFiles(workspace string) error {
 	if len(t.req.Policies) == 0 {
 		return nil
@@ -331,6 +458,31 @@ func (t *Task) genPolicyFiles(workspace string) error {
 	return nil
 }
 
+// prepareScanBase 将增量扫描基准任务的扫描输入及结果复制到当前任务目录，
+// 基准任务不存在或文件不完整(如在其他 runner 上执行)时返回 false，执行全量扫描
+func (t *Task) prepareScanBase(workspace string) bool {
+	if t.req.BaseScanTaskId == "" || t.req.BaseScanTaskId == t.req.TaskId {
+		return false
+	}
+	baseWorkspace := GetTaskWorkspace(t.req.Env.Id, t.req.BaseScanTaskId)
+	files := map[string]string{
+		ScanInputFile:  ScanBaseInputFile,
+		ScanResultFile: ScanBaseResultFile,
+	}
+	for src, dst := range files {
+		content, err := os.ReadFile(filepath.Join(baseWorkspace, src))
+		if err != nil {
+			t.logger.Infof("scan base '%s' not available, run full scan: %v", t.req.BaseScanTaskId, err)
+			return false
+		}
+		if err := os.WriteFile(filepath.Join(workspace, dst), content, 0644); err != nil { //nolint:gosec
+			t.logger.Warnf("write scan base file: %v", err)
+			return false
+		}
+	}
+	return true
+}
+
 func (t *Task) executeTpl(tpl *template.Template, data interface{}) (string, error) {
 	buffer := bytes.NewBuffer(nil)
 	err := tpl.Execute(buffer, data)
@@ -362,10 +514,16 @@ func (t *Task) genStepScript() (string, error) {
 		command, err = t.stepApply()
 	case common.TaskStepTfDestroy:
 		command, err = t.stepDestroy()
+	case common.TaskStepTfImport:
+		command, err = t.stepImport()
+	case common.TaskStepTfValidate:
+		command, err = t.stepValidate()
 	case common.TaskStepAnsiblePlay:
 		command, err = t.stepPlay()
 	case common.TaskStepCommand:
 		command, err = t.stepCommand()
+	case common.TaskStepCheckov:
+		command, err = t.stepCheckov()
 	case common.TaskStepCollect:
 		command, err = t.collectCommand()
 	case common.TaskStepScanInit:
@@ -396,6 +554,21 @@ func (t *Task) genStepScript() (string, error) {
 		return "", err
 	}
 
+	if t.req.Resume && t.req.StepImage == "" {
+		// 新容器中还没有安装引擎及 terraformrc 配置(由 init 步骤完成)，需要先执行准备命令
+		var prepare, tfrc string
+		if tfrc, err = t.terraformrcPath(); err != nil {
+			return "", err
+		}
+		if prepare, err = t.executeTpl(resumeCommandTpl, map[string]interface{}{
+			"Req":         t.req,
+			"terraformrc": tfrc,
+		}); err != nil {
+			return "", err
+		}
+		command = prepare + command
+	}
+
 	stepDir := GetTaskDir(t.req.Env.Id, t.req.TaskId, t.req.Step)
 	if err = os.MkdirAll(stepDir, 0755); err != nil {
 		return "", err
@@ -416,26 +589,38 @@ func (t *Task) genStepScript() (string, error) {
 }
 
 var checkoutCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+{{.GitSshAgent}}
+{{if .Req.Module -}}
+if [[ ! -e code ]]; then mkdir -p code && cp '{{.ModuleFile}}' code/main.tf || exit $?; fi && \
+echo 'use module {{.Req.Module.Source}} {{.Req.Module.Version}}.' && \
+cd code
+{{- else -}}
 if [[ ! -e code ]]; then git clone '{{.Req.RepoAddress}}' code || exit $?; fi && \
 cd code && \
 echo 'checkout {{.Req.RepoCommitId}}.' && \
 git checkout -q '{{.Req.RepoCommitId}}' && \
 cd '{{.Req.Env.Workdir}}'
+{{- end}}
 `))
 
 func (t *Task) stepCheckout() (command string, err error) {
 	return t.executeTpl(checkoutCommandTpl, map[string]interface{}{
-		"Req": t.req,
+		"Req":         t.req,
+		"ModuleFile":  CloudIacModuleFile,
+		"GitSshAgent": t.gitSshAgentScript(),
 	})
 }
 
+// 多个任务共享 plugins 缓存目录，执行 init 前需要获取缓存目录锁，脚本退出时释放
 var initCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+{{.PluginCacheLock}}
+{{.GitSshAgent}}
 cd 'code/{{.Req.Env.Workdir}}' && \
 ln -sf '{{.IacTfFile}}' . && \
 ln -sf '{{.terraformrc}}' ~/.terraformrc && \
-tfenv install $TFENV_TERRAFORM_VERSION && \
-tfenv use $TFENV_TERRAFORM_VERSION  && \
-terraform init -input=false {{- range $arg := .Req.StepArgs }} {{$arg}}{{ end }}
+{{.Req.Env.EngineInstallCmd}} && \
+cloudiac_lock_plugin_cache && \
+{{.Req.Env.EngineBin}} init -input=false {{- range $arg := .Req.StepArgs }} {{$arg}}{{ end }}
 `))
 
 // 将 workspace 根目录下的文件名转为可以在环境的 code/workdir 下访问的相对路径
@@ -448,32 +633,66 @@ func (t *Task) up2Workspace(name string) string {
 	return filepath.Join(append(ups, name)...)
 }
 
+// 从失败步骤重试时在新容器中恢复 init 步骤准备的执行环境
+var resumeCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+ln -sf '{{.terraformrc}}' ~/.terraformrc && \
+{{.Req.Env.EngineInstallCmd}} || exit 1
+`))
+
+func (t *Task) terraformrcPath() (string, error) {
+	return prepareTerraformrc(t.workspace)
+}
+
 func (t *Task) stepInit() (command string, err error) {
-	tfrcName := "terraformrc-default"
-	if configs.Get().Runner.OfflineMode {
-		tfrcName = "terraformrc-offline"
+	tfrc, err := t.terraformrcPath()
+	if err != nil {
+		return "", err
+	}
+	iacTfFile := t.iacTfFileName()
+	if iacTfFile != CloudIacTfFile {
+		if err := t.genIacTfFile(t.workspace, iacTfFile); err != nil {
+			return "", errors.Wrap(err, "generate tf file")
+		}
 	}
-	tfrc := filepath.Join(ContainerAssetsDir, tfrcName)
 	return t.executeTpl(initCommandTpl, map[string]interface{}{
 		"Req":             t.req,
 		"terraformrc":     tfrc,
 		"PluginCachePath": ContainerPluginCachePath,
-		"IacTfFile":       t.up2Workspace(CloudIacTfFile),
+		"PluginCacheLock": pluginCacheLockScript,
+		"IacTfFile":       t.up2Workspace(iacTfFile),
+		"GitSshAgent":     t.gitSshAgentScript(),
 	})
 }
 
 var planCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd 'code/{{.Req.Env.Workdir}}' && \
-terraform plan -input=false -out=_cloudiac.tfplan \
+{{.Req.Env.EngineBin}} plan -input=false -out=_cloudiac.tfplan \
 {{if .TfVars}}-var-file={{.TfVars}}{{end}} \
 {{ range $arg := .Req.StepArgs }}{{$arg}} {{ end }}&& \
-terraform show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}}
+cp -f _cloudiac.tfplan {{.TFPlanFilePath}} && \
+{{.Req.Env.EngineBin}} show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}}
+`))
+
+// 使用已保存的 plan 文件，apply 步骤执行的是该 plan 文件的内容
+var savedPlanCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+echo 'use saved plan.' && \
+cp -f {{.TFPlanFilePath}} _cloudiac.tfplan && \
+{{.Req.Env.EngineBin}} show -no-color -json _cloudiac.tfplan >{{.TFPlanJsonFilePath}}
 `))
 
 func (t *Task) stepPlan() (command string, err error) {
-	return t.executeTpl(planCommandTpl, map[string]interface{}{
+	tpl := planCommandTpl
+	if len(t.req.SavedPlan) > 0 {
+		if err := os.WriteFile(filepath.Join(t.workspace, TFPlanFile), t.req.SavedPlan, 0644); err != nil { //nolint:gosec
+			return "", errors.Wrap(err, "write saved plan")
+		}
+		tpl = savedPlanCommandTpl
+	}
+	return t.executeTpl(tpl, map[string]interface{}{
 		"Req":                t.req,
 		"TfVars":             t.req.Env.TfVarsFile,
+		"TFPlanFilePath":     t.up2Workspace(TFPlanFile),
 		"TFPlanJsonFilePath": t.up2Workspace(TFPlanJsonFile),
 	})
 }
@@ -481,7 +700,7 @@ func (t *Task) stepPlan() (command string, err error) {
 // 当指定了 plan 文件时不需要也不能传 -var-file 参数
 var applyCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 cd 'code/{{.Req.Env.Workdir}}' && \
-terraform apply -input=false -auto-approve \
+{{.Req.Env.EngineBin}} apply -input=false -auto-approve \
 {{ range $arg := .Req.StepArgs}}{{$arg}} {{ end }}_cloudiac.tfplan
 `))
 
@@ -499,6 +718,78 @@ func (t *Task) stepDestroy() (command string, err error) {
 	})
 }
 
+var importCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+{{.Req.Env.EngineBin}} import -input=false \
+{{if .TfVars}}-var-file={{.TfVars}}{{end}} \
+{{ range $arg := .Args }}{{$arg}} {{ end }}{{.Address}} {{.ResourceId}}
+`))
+
+// 导入的资源地址及云资源 id 为步骤的最后两个参数，资源地址可能包含引号(如 aws_s3_bucket.b["logs"])，需要转义
+func (t *Task) stepImport() (command string, err error) {
+	n := len(t.req.StepArgs)
+	if n < 2 {
+		return "", fmt.Errorf("import step requires resource address and id")
+	}
+	return t.executeTpl(importCommandTpl, map[string]interface{}{
+		"Req":        t.req,
+		"TfVars":     t.req.Env.TfVarsFile,
+		"Args":       t.req.StepArgs[:n-2],
+		"Address":    shellQuote(t.req.StepArgs[n-2]),
+		"ResourceId": shellQuote(t.req.StepArgs[n-1]),
+	})
+}
+
+// validate 步骤可以单独执行(如云模板检查)，所以代码不存在时先进行 checkout。
+// init 使用 -backend=false，不会影响后续步骤使用的 backend 配置
+var validateCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+{{.PluginCacheLock}}
+{{.GitSshAgent}}
+{{if .Req.Module -}}
+if [[ ! -e code ]]; then mkdir -p code && cp '{{.ModuleFile}}' code/main.tf || exit $?; fi
+{{- else -}}
+if [[ ! -e code ]]; then git clone '{{.Req.RepoAddress}}' code || exit $?; \
+cd code && git checkout -q '{{.Req.RepoCommitId}}' && cd .. || exit $?; fi
+{{- end}}
+cd 'code/{{.Req.Env.Workdir}}' && \
+ln -sf '{{.terraformrc}}' ~/.terraformrc && \
+{{.Req.Env.EngineInstallCmd}} && \
+cloudiac_lock_plugin_cache && \
+{{.Req.Env.EngineBin}} init -input=false -backend=false >/dev/null || exit $?
+cloudiac_unlock_plugin_cache
+{{- if .Req.Module}}
+{{.Req.Env.EngineBin}} fmt >/dev/null
+{{- end}}
+
+{{.Req.Env.EngineBin}} validate -json >{{.TFValidateJsonFile}}
+validateCode=$?
+{{.Req.Env.EngineBin}} validate -no-color
+
+{{.Req.Env.EngineBin}} fmt -check -list=true -recursive >{{.TFFmtCheckFile}}
+fmtCode=$?
+if [ $fmtCode -ne 0 ]; then
+  echo "The following files are not formatted:"
+  cat {{.TFFmtCheckFile}}
+fi
+[ $validateCode -eq 0 ] && [ $fmtCode -eq 0 ]
+`))
+
+func (t *Task) stepValidate() (command string, err error) {
+	tfrc, err := t.terraformrcPath()
+	if err != nil {
+		return "", err
+	}
+	return t.executeTpl(validateCommandTpl, map[string]interface{}{
+		"Req":                t.req,
+		"terraformrc":        tfrc,
+		"TFValidateJsonFile": t.up2Workspace(TFValidateJsonFile),
+		"TFFmtCheckFile":     t.up2Workspace(TFFmtCheckFile),
+		"ModuleFile":         CloudIacModuleFile,
+		"PluginCacheLock":    pluginCacheLockScript,
+		"GitSshAgent":        t.gitSshAgentScript(),
+	})
+}
+
 var playCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
 export ANSIBLE_HOST_KEY_CHECKING="False"
 export ANSIBLE_TF_DIR="."
@@ -544,14 +835,29 @@ func (t *Task) stepCommand() (command string, err error) {
 	})
 }
 
+// checkov 扫描失败时步骤失败，可以通过 args 传入 --soft-fail 等参数
+var checkovCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+cd 'code/{{.Req.Env.Workdir}}' && \
+checkov -d . --compact {{ range $arg := .Req.StepArgs }}{{$arg}} {{ end }}
+`))
+
+func (t *Task) stepCheckov() (command string, err error) {
+	return t.executeTpl(checkovCommandTpl, map[string]interface{}{
+		"Req": t.req,
+	})
+}
+
 // collect command 失败不影响任务状态
 var collectCommandTpl = template.Must(template.New("").Parse(`# state collect command
 cd 'code/{{.Req.Env.Workdir}}' && \
-terraform show -no-color -json >{{.TFStateJsonFilePath}} && \
-terraform providers schema -json > {{.TFProviderSchema}}
+{{.Req.Env.EngineBin}} show -no-color -json >{{.TFStateJsonFilePath}} && \
+{{.Req.Env.EngineBin}} providers schema -json > {{.TFProviderSchema}}
 `))
 
 func (t *Task) collectCommand() (string, error) {
+	if len(t.req.Env.Workdirs) > 0 {
+		return t.collectWorkdirsCommand()
+	}
 	return t.executeTpl(collectCommandTpl, map[string]interface{}{
 		"Req":                 t.req,
 		"TFStateJsonFilePath": t.up2Workspace(TFStateJsonFile),
@@ -579,7 +885,7 @@ cd 'code/{{.Req.Env.Workdir}}' && \
 mkdir -p {{.PoliciesDir}} && \
 mkdir -p ~/.terrascan/pkg/policies/opa/rego/aws && \
 terrascan scan --config-only -o json --iac-type terraform > {{.ScanInputFile}} 2>/dev/null && \
-/usr/yunji/cloudiac/iac-tool scan --internal -p {{.PoliciesDir}} -i {{.ScanInputFile}} -o {{.ScanResultFile}}
+/usr/yunji/cloudiac/iac-tool scan --internal -p {{.PoliciesDir}} -i {{.ScanInputFile}} -o {{.ScanResultFile}} --decision-log {{.DecisionLogFile}}{{if .Incremental}} --base-input {{.ScanBaseInputFile}} --base-result {{.ScanBaseResultFile}}{{end}}
 `))
 
 func (t *Task) stepTplScan() (command string, err error) {
@@ -587,26 +893,39 @@ func (t *Task) stepTplScan() (command string, err error) {
 		return "", errors.Wrap(err, "generate policy files")
 	}
 	return t.executeTpl(scanTplCommandTpl, map[string]interface{}{
-		"Req":            t.req,
-		"PoliciesDir":    t.up2Workspace(PoliciesDir),
-		"ScanResultFile": t.up2Workspace(ScanResultFile),
-		"ScanInputFile":  t.up2Workspace(ScanInputFile),
+		"Req":             t.req,
+		"PoliciesDir":     t.up2Workspace(PoliciesDir),
+		"ScanResultFile":  t.up2Workspace(ScanResultFile),
+		"ScanInputFile":   t.up2Workspace(ScanInputFile),
+		"DecisionLogFile": t.up2Workspace(DecisionLogFile),
+
+		"Incremental":        t.prepareScanBase(t.workspace),
+		"ScanBaseInputFile":  t.up2Workspace(ScanBaseInputFile),
+		"ScanBaseResultFile": t.up2Workspace(ScanBaseResultFile),
 	})
 }
 
 var scanInitCommandTpl = template.Must(template.New("").Parse(`#!/bin/sh
+{{.GitSshAgent}}
+{{if .Req.Module -}}
+if [[ ! -e code ]]; then mkdir -p code && cp '{{.ModuleFile}}' code/main.tf || exit $?; fi && \
+cd code
+{{- else -}}
 if [[ ! -e code ]]; then git clone '{{.Req.RepoAddress}}' code || exit $?; fi && \
 cd code && \
 echo 'checkout {{.Req.RepoCommitId}}.' && \
 git checkout -q '{{.Req.RepoCommitId}}' && \
 cd '{{.Req.Env.Workdir}}'
+{{- end}}
 `))
 
 func (t *Task) stepScanInit() (command string, err error) {
 	return t.executeTpl(scanInitCommandTpl, map[string]interface{}{
 		"Req":             t.req,
+		"ModuleFile":      CloudIacModuleFile,
 		"PluginCachePath": ContainerPluginCachePath,
 		"IacTfFile":       t.up2Workspace(CloudIacTfFile),
+		"GitSshAgent":     t.gitSshAgentScript(),
 	})
 }
 
@@ -631,7 +950,7 @@ mkdir -p {{.PoliciesDir}} && \
 mkdir -p ~/.terrascan/pkg/policies/opa/rego/aws && \
 terrascan scan --config-only -o json --iac-type terraform > {{.ScanInputMapFile}} 2>/dev/null && \
 /usr/yunji/cloudiac/iac-tool scan --parse-plan --plan {{.TerraformPlanFile}} > {{.ScanInputFile}} && \
-/usr/yunji/cloudiac/iac-tool scan --internal -p {{.PoliciesDir}} -i {{.ScanInputFile}} -m {{.ScanInputMapFile}} -o {{.ScanResultFile}}
+/usr/yunji/cloudiac/iac-tool scan --internal -p {{.PoliciesDir}} -i {{.ScanInputFile}} -m {{.ScanInputMapFile}} -o {{.ScanResultFile}} --decision-log {{.DecisionLogFile}}{{if .Incremental}} --base-input {{.ScanBaseInputFile}} --base-result {{.ScanBaseResultFile}}{{end}}
 `))
 
 func (t *Task) stepEnvScan() (command string, err error) {
@@ -646,5 +965,10 @@ func (t *Task) stepEnvScan() (command string, err error) {
 		"ScanResultFile":    t.up2Workspace(ScanResultFile),
 		"ScanInputFile":     t.up2Workspace(ScanInputFile),
 		"ScanInputMapFile":  t.up2Workspace(ScanInputMapFile),
+		"DecisionLogFile":   t.up2Workspace(DecisionLogFile),
+
+		"Incremental":        t.prepareScanBase(t.workspace),
+		"ScanBaseInputFile":  t.up2Workspace(ScanBaseInputFile),
+		"ScanBaseResultFile": t.up2Workspace(ScanBaseResultFile),
 	})
 }
@@ -15,7 +15,11 @@ type TaskEnv struct {
 	TfVarsFile   string `json:"tfVarsFile"`
 	Playbook     string `json:"playbook"`
 	PlayVarsFile string `json:"playVarsFile"`
-	TfVersion    string `json:"tfVersion"`
+	TfVersion    string `json:"tfVersion"`  // 引擎版本号
+	EngineType   string `json:"engineType"` // 执行引擎(terraform/opentofu)，为空时使用 terraform
+
+	// 多工作目录云模板按顺序部署的工作目录，信息采集步骤会汇总各目录的 state
+	Workdirs []string `json:"workdirs"`
 
 	EnvironmentVars map[string]string `json:"environment"`
 	TerraformVars   map[string]string `json:"terraform"`
@@ -36,24 +40,56 @@ type RunTaskReq struct {
 	Step         int        `json:"step" binding:""`
 	StepType     string     `json:"stepType" binding:"required"`
 	StepArgs     []string   `json:"stepArgs"`
+	StepImage    string     `json:"stepImage"` // 步骤使用的镜像，为空时在任务容器中执行
 	DockerImage  string     `json:"dockerImage"`
 	StateStore   StateStore `json:"stateStore" binding:""`
 	RepoAddress  string     `json:"repoAddress" binding:""` // 带 token 的完整路径
 	RepoBranch   string     `json:"repoBranch" binding:""`  // git branch or tag
 	RepoCommitId string     `json:"repoCommitId" binding:""`
 
+	// 步骤结束后需要保存为产物的文件(相对于代码工作目录，支持通配符)
+	StepArtifacts []string `json:"stepArtifacts"`
+
 	SysEnvironments map[string]string `json:"sysEnvironments "` // 系统注入的环境变量
 
 	Timeout    int    `json:"timeout"`
 	PrivateKey string `json:"privateKey"`
+	// clone 代码使用的 SSH 部署密钥(加密)，不为空时 RepoAddress 为 SSH 地址
+	RepoPrivateKey string `json:"repoPrivateKey"`
 
 	Policies        []TaskPolicy `json:"policies"` // 策略内容
 	StopOnViolation bool         `json:"stopOnViolation"`
 
 	Repos []Repository `json:"repos"` // 待扫描仓库列表
 
+	BaseScanTaskId string `json:"baseScanTaskId"` // 增量扫描的基准任务 id，为空时执行全量扫描
+
+	Module *TfModule `json:"module"` // 云模板使用的 registry 模块，不为空时不拉取代码仓库，生成引用该模块的根模块
+
+	SavedPlan []byte `json:"savedPlan"` // 已保存的二进制 plan 文件，不为空时 plan 步骤不重新执行 plan，直接使用该文件
+
 	ContainerId string `json:"containerId"`
 	PauseTask   bool   `json:"pauseTask"` // 本次执行结束后暂停任务
+
+	Resume bool `json:"resume"` // 从失败步骤重试任务，启动新容器并复用任务已有的工作目录
+
+	// 任务容器的标签，key 为 org-id、project-id、env-id、task-id、task-type 等，runner 会添加统一前缀
+	Labels map[string]string `json:"labels"`
+}
+
+// TfModule terraform registry 模块
+type TfModule struct {
+	Source  string          `json:"source"`
+	Version string          `json:"version"`
+	Inputs  []TfModuleInput `json:"inputs"`
+	Outputs []string        `json:"outputs"`
+}
+
+type TfModuleInput struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Default  string `json:"default"` // hcl 格式的默认值，required 为 false 时有效
+	Required bool   `json:"required"`
 }
 
 type Repository struct {
@@ -69,7 +105,90 @@ type TaskStatusReq struct {
 
 type TaskStopReq struct {
 	TaskId       string   `json:"taskId" form:"taskId" binding:"required"`
-	ContainerIds []string `json:"containerIds" form:"containerIds" binding:"required"`
+	ContainerIds []string `json:"containerIds" form:"containerIds" binding:""` // 为空时按任务 id 标签查找容器
+}
+
+// TaskCancelReq 优雅取消任务，先中断 terraform 执行，GracePeriod 秒后步骤仍未结束时强制停止容器
+type TaskCancelReq struct {
+	EnvId        string   `json:"envId" binding:""`
+	TaskId       string   `json:"taskId" binding:"required"`
+	Step         int      `json:"step" binding:""`
+	ContainerIds []string `json:"containerIds" binding:""` // 为空时按任务 id 标签查找容器
+	GracePeriod  int      `json:"gracePeriod" binding:""`
+}
+
+type TaskCancelResp struct {
+	Graceful bool `json:"graceful"` // 步骤是否在等待时间内退出，为 false 表示容器被强制停止
+}
+
+type ContainerListReq struct {
+	Labels []string `json:"labels" form:"label" binding:""` // 标签过滤条件，格式为 key=value 或 key，可传多个
+	All    bool     `json:"all" form:"all" binding:""`      // 是否包含已停止的容器
+}
+
+// ContainerInfo runner 启动的任务容器信息
+type ContainerInfo struct {
+	Id      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	State   string            `json:"state"`  // 容器状态，如 running、exited
+	Status  string            `json:"status"` // 容器状态描述，如 Up 2 minutes
+	Created int64             `json:"created"`
+	Labels  map[string]string `json:"labels"` // 去除前缀后的标签
+}
+
+// WorkspaceRef 任务工作目录，EnvId 为空表示没有环境的任务(如云模板扫描)
+type WorkspaceRef struct {
+	EnvId  string `json:"envId"`
+	TaskId string `json:"taskId" binding:"required"`
+}
+
+type WorkspaceInfo struct {
+	EnvId   string `json:"envId"`
+	TaskId  string `json:"taskId"`
+	ModTime int64  `json:"modTime"` // 目录最后修改时间
+}
+
+// CleanupReq portal 通知 runner 清理孤儿容器及工作目录
+type CleanupReq struct {
+	Containers []string       `json:"containers" binding:""`
+	Workspaces []WorkspaceRef `json:"workspaces" binding:""`
+}
+
+// CleanupResp runner 返回给 portal 的清理结果
+type CleanupResp struct {
+	RemovedContainers []string       `json:"removedContainers"`
+	RemovedWorkspaces []WorkspaceRef `json:"removedWorkspaces"`
+	Errors            []string       `json:"errors"`
+}
+
+// CachedProvider provider 缓存目录中的 provider
+type CachedProvider struct {
+	Source   string `json:"source"`             // 如 registry.terraform.io/hashicorp/aws，预热请求中可省略 hostname
+	Version  string `json:"version"`            // 预热请求中为版本约束
+	Platform string `json:"platform,omitempty"` // 如 linux_amd64
+}
+
+type PluginCachePrewarmReq struct {
+	Providers  []string `json:"providers"`  // source[@version] 格式，如 hashicorp/aws@5.31.0，为空时使用 runner 配置的 prewarm_providers
+	EngineType string   `json:"engineType"` // terraform(默认) 或 opentofu
+	TfVersion  string   `json:"tfVersion"`  // 执行 init 的引擎版本，为空时使用默认版本
+}
+
+type PluginCachePrewarmResp struct {
+	ExitCode  int              `json:"exitCode"`  // init 命令的退出码，非 0 表示部分 provider 下载失败
+	Log       string           `json:"log"`       // init 命令的输出
+	Providers []CachedProvider `json:"providers"` // 预热后缓存目录中的所有 provider
+}
+
+// RunnerHealth runner 的健康状态，portal 定期获取用于在多个 runner 间调度任务
+type RunnerHealth struct {
+	Version      string  `json:"version"`
+	RunningTasks int     `json:"runningTasks"` // 正在运行的任务容器数量
+	CpuNum       int     `json:"cpuNum"`
+	Load1        float64 `json:"load1"`     // 最近 1 分钟的系统负载
+	DiskTotal    uint64  `json:"diskTotal"` // 任务工作目录所在磁盘的总空间(字节)
+	DiskFree     uint64  `json:"diskFree"`  // 任务工作目录所在磁盘的可用空间(字节)
 }
 
 type TaskPolicy struct {
@@ -79,18 +198,22 @@ type TaskPolicy struct {
 }
 
 type Meta struct {
-	Category      string `json:"category"`
-	Root          string `json:"root"`
-	File          string `json:"file"`
-	Id            string `json:"id"`
-	Name          string `json:"name"`
-	PolicyType    string `json:"policy_type"`
-	ReferenceId   string `json:"reference_id"`
-	ResourceType  string `json:"resource_type"`
-	Severity      string `json:"severity"`
-	Version       int    `json:"version"`
-	FixSuggestion string `json:"fix_suggestion"`
-	Description   string `json:"description"`
+	Category       string `json:"category"`
+	Root           string `json:"root"`
+	File           string `json:"file"`
+	Id             string `json:"id"`
+	Name           string `json:"name"`
+	PolicyType     string `json:"policy_type"`
+	ReferenceId    string `json:"reference_id"`
+	ResourceType   string `json:"resource_type"`
+	Severity       string `json:"severity"`
+	Version        int    `json:"version"`
+	FixSuggestion  string `json:"fix_suggestion"`
+	Description    string `json:"description"`
+	OpaVersion     string `json:"opa_version"`
+	RegoVersion    string `json:"rego_version"`
+	Bundle         string `json:"bundle"`
+	BundleRevision string `json:"bundle_revision"`
 }
 
 type TaskLogReq TaskStatusReq
@@ -106,9 +229,20 @@ type TaskStatusMessage struct {
 	LogContent           []byte `json:"logContent"`
 	TfStateJson          []byte `json:"tfStateJson"`
 	TfPlanJson           []byte `json:"tfPlanJson"`
+	TfPlanFile           []byte `json:"tfPlanFile"` // 二进制 plan 文件
 	TfScanJson           []byte `json:"tfScanJson"`
 	TfResultJson         []byte `json:"tfResultJson"`
 	TFProviderSchemaJson []byte `json:"tfProviderSchemaJson"`
+	TfValidateJson       []byte `json:"tfValidateJson"`  // ValidateResult 的 json 内容
+	DecisionLogJson      []byte `json:"decisionLogJson"` // 策略评估的决策日志
+
+	Artifacts []TaskArtifactFile `json:"artifacts"` // 步骤产物目录中的文件
+}
+
+// TaskArtifactFile 步骤产物文件，Name 为相对于产物目录的路径
+type TaskArtifactFile struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
 }
 
 type ErrorMessage struct {
@@ -0,0 +1,105 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ValidateDiagnostic terraform validate 及 fmt 检查的单条诊断信息
+type ValidateDiagnostic struct {
+	Severity string `json:"severity" example:"error"` // error/warning
+	Summary  string `json:"summary" example:"Unsupported argument"`
+	Detail   string `json:"detail"`
+	File     string `json:"file" example:"main.tf"` // 相对于工作目录的文件路径
+	Line     int    `json:"line" example:"12"`
+}
+
+// ValidateResult terraform validate 及 fmt 检查结果
+type ValidateResult struct {
+	Valid            bool                 `json:"valid"`            // validate 是否通过
+	Formatted        bool                 `json:"formatted"`        // 所有文件是否已格式化
+	Diagnostics      []ValidateDiagnostic `json:"diagnostics"`      // validate 诊断信息
+	UnformattedFiles []string             `json:"unformattedFiles"` // 未格式化的文件
+}
+
+func (r *ValidateResult) Passed() bool {
+	return r.Valid && r.Formatted
+}
+
+type tfValidateOutput struct {
+	Valid       bool `json:"valid"`
+	Diagnostics []struct {
+		Severity string `json:"severity"`
+		Summary  string `json:"summary"`
+		Detail   string `json:"detail"`
+		Range    *struct {
+			Filename string `json:"filename"`
+			Start    struct {
+				Line int `json:"line"`
+			} `json:"start"`
+		} `json:"range"`
+	} `json:"diagnostics"`
+}
+
+// ParseValidateResult 解析 terraform validate -json 输出及 terraform fmt -check -list 输出的文件列表
+func ParseValidateResult(validateJson []byte, fmtOutput []byte) (*ValidateResult, error) {
+	result := &ValidateResult{
+		Valid:            true,
+		Diagnostics:      make([]ValidateDiagnostic, 0),
+		UnformattedFiles: make([]string, 0),
+	}
+
+	if len(bytes.TrimSpace(validateJson)) > 0 {
+		output := tfValidateOutput{}
+		if err := json.Unmarshal(validateJson, &output); err != nil {
+			return nil, err
+		}
+		result.Valid = output.Valid
+		for _, d := range output.Diagnostics {
+			diag := ValidateDiagnostic{
+				Severity: d.Severity,
+				Summary:  d.Summary,
+				Detail:   d.Detail,
+			}
+			if d.Range != nil {
+				diag.File = d.Range.Filename
+				diag.Line = d.Range.Start.Line
+			}
+			result.Diagnostics = append(result.Diagnostics, diag)
+		}
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(fmtOutput))
+	for scanner.Scan() {
+		if file := strings.TrimSpace(scanner.Text()); file != "" {
+			result.UnformattedFiles = append(result.UnformattedFiles, file)
+		}
+	}
+	result.Formatted = len(result.UnformattedFiles) == 0
+	return result, nil
+}
+
+// FetchValidateResult 读取任务的 validate 及 fmt 检查输出，任务未执行检查时返回空
+func FetchValidateResult(envId string, taskId string) ([]byte, error) {
+	validateJson, err := FetchJson(envId, taskId, TFValidateJsonFile)
+	if err != nil {
+		return nil, err
+	}
+	fmtOutput, err := FetchJson(envId, taskId, TFFmtCheckFile)
+	if err != nil {
+		return nil, err
+	}
+	if validateJson == nil && fmtOutput == nil {
+		return nil, nil
+	}
+
+	result, err := ParseValidateResult(validateJson, fmtOutput)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(result)
+}
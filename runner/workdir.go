@@ -0,0 +1,157 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// workdirIndex 返回当前步骤的工作目录在多工作目录列表中的位置，不是多工作目录任务时返回 -1
+func (t *Task) workdirIndex() int {
+	for i, dir := range t.req.Env.Workdirs {
+		if dir == t.req.Env.Workdir {
+			return i
+		}
+	}
+	return -1
+}
+
+// iacTfFileName 返回工作目录使用的 backend 配置文件名，
+// 多工作目录云模板的各工作目录使用独立的 state，需要生成各自的配置文件
+func (t *Task) iacTfFileName() string {
+	if i := t.workdirIndex(); i >= 0 {
+		return fmt.Sprintf("_cloudiac_workdir%d.tf", i)
+	}
+	return CloudIacTfFile
+}
+
+// workdirJsonFile 返回第 index 个工作目录的信息采集文件名，如 tfstate.json -> tfstate.0.json
+func workdirJsonFile(name string, index int) string {
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), index, ext)
+}
+
+// 多工作目录云模板依次采集各工作目录的 state 及 provider schema
+var collectWorkdirsCommandTpl = template.Must(template.New("").Parse(`# state collect command
+{{- range $index, $dir := .Req.Env.Workdirs}}
+cd '{{$.Workspace}}/code/{{$dir}}' && \
+{{$.Req.Env.EngineBin}} show -no-color -json >{{$.Workspace}}/{{index $.StateFiles $index}} && \
+{{$.Req.Env.EngineBin}} providers schema -json >{{$.Workspace}}/{{index $.SchemaFiles $index}}
+{{- end}}
+`))
+
+func (t *Task) collectWorkdirsCommand() (string, error) {
+	stateFiles := make([]string, 0, len(t.req.Env.Workdirs))
+	schemaFiles := make([]string, 0, len(t.req.Env.Workdirs))
+	for i := range t.req.Env.Workdirs {
+		stateFiles = append(stateFiles, workdirJsonFile(TFStateJsonFile, i))
+		schemaFiles = append(schemaFiles, workdirJsonFile(TFProviderSchema, i))
+	}
+	return t.executeTpl(collectWorkdirsCommandTpl, map[string]interface{}{
+		"Req":         t.req,
+		"Workspace":   ContainerWorkspace,
+		"StateFiles":  stateFiles,
+		"SchemaFiles": schemaFiles,
+	})
+}
+
+// readWorkdirJsonFiles 按工作目录顺序读取各工作目录的信息采集文件，不是多工作目录任务时返回空
+func readWorkdirJsonFiles(workspace string, name string) ([][]byte, error) {
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext) + "."
+	paths, err := filepath.Glob(filepath.Join(workspace, prefix+"*"+ext))
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]int, len(paths))
+	files := make([]string, 0, len(paths))
+	for _, path := range paths {
+		i, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), prefix), ext))
+		if err != nil {
+			continue
+		}
+		indexes[path] = i
+		files = append(files, path)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return indexes[files[i]] < indexes[files[j]]
+	})
+
+	contents := make([][]byte, 0, len(files))
+	for _, path := range files {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if len(content) > 0 {
+			contents = append(contents, content)
+		}
+	}
+	return contents, nil
+}
+
+// mergeStateJson 合并各工作目录 show -json 输出的 state，资源及子模块依次追加，同名 output 以后部署的目录为准
+func mergeStateJson(contents [][]byte) ([]byte, error) {
+	merged := make(map[string]interface{})
+	outputs := make(map[string]interface{})
+	resources := make([]interface{}, 0)
+	childModules := make([]interface{}, 0)
+	for _, content := range contents {
+		state := make(map[string]interface{})
+		if err := json.Unmarshal(content, &state); err != nil {
+			return nil, err
+		}
+		for k, v := range state {
+			if k != "values" {
+				merged[k] = v
+			}
+		}
+
+		values, _ := state["values"].(map[string]interface{})
+		if o, ok := values["outputs"].(map[string]interface{}); ok {
+			for k, v := range o {
+				outputs[k] = v
+			}
+		}
+		if root, ok := values["root_module"].(map[string]interface{}); ok {
+			if rs, ok := root["resources"].([]interface{}); ok {
+				resources = append(resources, rs...)
+			}
+			if cs, ok := root["child_modules"].([]interface{}); ok {
+				childModules = append(childModules, cs...)
+			}
+		}
+	}
+
+	merged["values"] = map[string]interface{}{
+		"outputs": outputs,
+		"root_module": map[string]interface{}{
+			"resources":     resources,
+			"child_modules": childModules,
+		},
+	}
+	return json.Marshal(merged)
+}
+
+// mergeProviderSchemaJson 合并各工作目录的 provider schema
+func mergeProviderSchemaJson(contents [][]byte) ([]byte, error) {
+	merged := ProviderMeta{ProviderSchemas: make(map[string]Schemas)}
+	for _, content := range contents {
+		meta := ProviderMeta{}
+		if err := json.Unmarshal(content, &meta); err != nil {
+			return nil, err
+		}
+		for name, schema := range meta.ProviderSchemas {
+			merged.ProviderSchemas[name] = schema
+		}
+	}
+	return json.Marshal(merged)
+}
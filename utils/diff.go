@@ -0,0 +1,136 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 计算行差异时允许的最大行数乘积，超出时将整个内容视为替换
+const maxDiffMatrixSize = 4000000
+
+type diffLine struct {
+	kind byte // ' ' 未变化，'-' 删除，'+' 新增
+	text string
+	a, b int // 该行之前 a、b 两个文本已处理的行数
+}
+
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// UnifiedDiff 返回 a 到 b 的 unified 格式行差异，每处变更保留 3 行上下文，内容相同时返回空
+func UnifiedDiff(a, b string) string {
+	if a == b {
+		return ""
+	}
+	const context = 3
+
+	al, bl := splitDiffLines(a), splitDiffLines(b)
+	lines := diffLines(al, bl)
+
+	var buf strings.Builder
+	for start := 0; start < len(lines); {
+		first := start
+		for first < len(lines) && lines[first].kind == ' ' {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		// 两处变更之间未变化的行不超过两倍上下文时合并到同一段
+		last := first
+		for i := first; i < len(lines) && i-last <= 2*context; i++ {
+			if lines[i].kind != ' ' {
+				last = i
+			}
+		}
+
+		from, to := first-context, last+context+1
+		if from < start {
+			from = start
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+		writeDiffHunk(&buf, lines[from:to])
+		start = to
+	}
+	return buf.String()
+}
+
+func writeDiffHunk(buf *strings.Builder, lines []diffLine) {
+	aCount, bCount := 0, 0
+	for _, l := range lines {
+		if l.kind != '+' {
+			aCount++
+		}
+		if l.kind != '-' {
+			bCount++
+		}
+	}
+	aStart, bStart := lines[0].a, lines[0].b
+	if aCount > 0 {
+		aStart++
+	}
+	if bCount > 0 {
+		bStart++
+	}
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+	for _, l := range lines {
+		buf.WriteByte(l.kind)
+		buf.WriteString(l.text)
+		buf.WriteByte('\n')
+	}
+}
+
+// diffLines 基于最长公共子序列计算两组行的差异
+func diffLines(al, bl []string) []diffLine {
+	n, m := len(al), len(bl)
+	lines := make([]diffLine, 0, n+m)
+	if n*m > maxDiffMatrixSize {
+		for i, l := range al {
+			lines = append(lines, diffLine{kind: '-', text: l, a: i})
+		}
+		for j, l := range bl {
+			lines = append(lines, diffLine{kind: '+', text: l, a: n, b: j})
+		}
+		return lines
+	}
+
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if al[i] == bl[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && al[i] == bl[j]:
+			lines = append(lines, diffLine{kind: ' ', text: al[i], a: i, b: j})
+			i, j = i+1, j+1
+		case i < n && (j == m || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{kind: '-', text: al[i], a: i, b: j})
+			i++
+		default:
+			lines = append(lines, diffLine{kind: '+', text: bl[j], a: i, b: j})
+			j++
+		}
+	}
+	return lines
+}
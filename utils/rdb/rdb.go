@@ -0,0 +1,43 @@
+// Copyright (c) 2015-2022 CloudJ Technology Co., Ltd.
+
+package rdb
+
+import (
+	"cloudiac/configs"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	client *redis.Client
+	once   sync.Once
+)
+
+// Init 根据配置连接 redis，未配置 redis 地址时不做任何操作
+func Init() error {
+	if Get() == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return client.Ping(ctx).Err()
+}
+
+// Get 返回 redis 客户端，未配置 redis 时返回 nil，调用方需要回退到单实例的处理方式
+func Get() *redis.Client {
+	once.Do(func() {
+		conf := configs.Get().Redis
+		if conf.Address == "" {
+			return
+		}
+		client = redis.NewClient(&redis.Options{
+			Addr:     conf.Address,
+			Password: conf.Password,
+			DB:       conf.DB,
+		})
+	})
+	return client
+}
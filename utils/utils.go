@@ -202,62 +202,91 @@ func StrInArray(v string, arr ...string) bool {
 }
 
 func UnzipFile(src, dest string) error {
+	return UnzipFileWithLimit(src, dest, 0, 0)
+}
+
+// UnzipFileWithLimit 解压 zip 文件，限制解压后的总大小(字节)及文件数量，避免压缩炸弹耗尽磁盘，值为 0 表示不限制
+func UnzipFileWithLimit(src, dest string, maxSize int64, maxFiles int) error {
 	r, err := zip.OpenReader(src)
 	if err != nil {
 		return err
 	}
 	defer r.Close()
 
+	if maxFiles > 0 && len(r.File) > maxFiles {
+		return fmt.Errorf("zip contains more than %d files", maxFiles)
+	}
 	if err := os.MkdirAll(dest, 0755); err != nil {
 		return err
 	}
 
+	remaining := int64(-1)
+	if maxSize > 0 {
+		remaining = maxSize
+	}
 	// Closure to address file descriptors issue with all the deferred .Close() methods
 	for _, f := range r.File {
-		err := extractAndWriteFile(dest, f)
+		if remaining >= 0 && f.UncompressedSize64 > uint64(remaining) {
+			return fmt.Errorf("zip uncompressed size exceeds %d bytes", maxSize)
+		}
+		written, err := extractAndWriteFile(dest, f, remaining)
 		if err != nil {
 			return err
 		}
+		if remaining >= 0 {
+			remaining -= written
+		}
 	}
 	return nil
 }
 
-func extractAndWriteFile(destDir string, f *zip.File) error {
+// extractAndWriteFile 解压单个文件，limit 不小于 0 时文件内容超过 limit 字节会返回错误
+func extractAndWriteFile(destDir string, f *zip.File, limit int64) (int64, error) {
 	rc, err := f.Open()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer rc.Close()
 
 	path := filepath.Join(destDir, f.Name) //nolint:gosec
-	if strings.HasPrefix(filepath.Clean(path)+string(os.PathSeparator), destDir) {
-		return fmt.Errorf("%s: illegal file path", f.Name)
+	if path != filepath.Clean(destDir) && !strings.HasPrefix(path, filepath.Clean(destDir)+string(os.PathSeparator)) {
+		return 0, fmt.Errorf("%s: illegal file path", f.Name)
 	}
 
 	if f.FileInfo().IsDir() {
-		return os.MkdirAll(path, f.Mode())
+		return 0, os.MkdirAll(path, f.Mode())
 	}
 
 	if err := os.MkdirAll(filepath.Dir(path), f.Mode()); err != nil {
-		return err
+		return 0, err
 	}
 
 	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer fp.Close()
 
+	// 文件头中记录的大小可能不准确，按实际读取的内容限制大小
+	var reader io.Reader = rc
+	if limit >= 0 {
+		reader = io.LimitReader(rc, limit+1)
+	}
+	var written int64
 	for {
-		_, err := io.CopyN(fp, rc, 1024)
+		n, err := io.CopyN(fp, reader, 1024)
+		written += n
+		if limit >= 0 && written > limit {
+			return written, fmt.Errorf("%s: uncompressed size exceeds limit", f.Name)
+		}
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return err
+			return written, err
 		}
 	}
-	return nil
+	return written, nil
 }
 
 func CheckRespCode(respCode int, code int) bool {
@@ -3,8 +3,10 @@
 package utils
 
 import (
+	"archive/zip"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -116,3 +118,36 @@ func TestJoinUrl(t *testing.T) {
 		}
 	}
 }
+
+func TestUnifiedDiff(t *testing.T) {
+	assert.Equal(t, "", UnifiedDiff("a\nb\n", "a\nb\n"))
+	assert.Equal(t, "@@ -0,0 +1,2 @@\n+a\n+b\n", UnifiedDiff("", "a\nb\n"))
+	assert.Equal(t, "@@ -1,2 +0,0 @@\n-a\n-b\n", UnifiedDiff("a\nb", ""))
+
+	before := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	after := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	assert.Equal(t, "@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n"+
+		"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n", UnifiedDiff(before, after))
+}
+
+func TestUnzipFileWithLimit(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "test.zip")
+	fp, err := os.Create(src)
+	assert.NoError(t, err)
+	w := zip.NewWriter(fp)
+	for _, name := range []string{"a.rego", "b/b.rego"} {
+		fw, err := w.Create(name)
+		assert.NoError(t, err)
+		_, err = fw.Write(make([]byte, 100))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.NoError(t, fp.Close())
+
+	assert.Error(t, UnzipFileWithLimit(src, filepath.Join(dir, "files"), 0, 1))
+	assert.Error(t, UnzipFileWithLimit(src, filepath.Join(dir, "size"), 199, 0))
+	assert.NoError(t, UnzipFileWithLimit(src, filepath.Join(dir, "ok"), 200, 2))
+	assert.True(t, FileExist(filepath.Join(dir, "ok", "b", "b.rego")))
+	assert.NoError(t, UnzipFile(src, filepath.Join(dir, "unlimited")))
+}